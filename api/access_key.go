@@ -1,6 +1,9 @@
 package api
 
 import (
+	"net/http"
+	"time"
+
 	"github.com/infrahq/infra/internal/validate"
 	"github.com/infrahq/infra/uid"
 )
@@ -16,6 +19,7 @@ type AccessKey struct {
 	Expires           Time     `json:"expires" note:"key is no longer valid after this time"`
 	InactivityTimeout Time     `json:"inactivityTimeout" note:"key must be used by this time to remain valid"`
 	Scopes            []string `json:"scopes" note:"additional access level scopes that control what an access key can do"`
+	ImpersonatedBy    uid.ID   `json:"impersonatedBy,omitempty" note:"ID of the support admin that created the key to act as the user"`
 }
 
 type ListAccessKeysRequest struct {
@@ -34,16 +38,37 @@ func (r ListAccessKeysRequest) ValidationRules() []validate.ValidationRule {
 type CreateAccessKeyRequest struct {
 	UserID            uid.ID   `json:"userID"`
 	Name              string   `json:"name"`
-	Expiry            Duration `json:"expiry" note:"maximum time valid"`
-	InactivityTimeout Duration `json:"inactivityTimeout" note:"key must be used within this duration to remain valid"`
+	Expiry            Duration `json:"expiry" note:"maximum time valid, ex: 12h, 30d, or 2w. Defaults to the accessKeyTTL setting of the organization" example:"30d"`
+	Expires           Time     `json:"expires" note:"key is no longer valid after this time. Can not be used with expiry"`
+	InactivityTimeout Duration `json:"inactivityTimeout" note:"key must be used within this duration to remain valid. Defaults to the sessionInactivityTimeout setting of the organization"`
 }
 
 func (r CreateAccessKeyRequest) ValidationRules() []validate.ValidationRule {
 	return []validate.ValidationRule{
 		ValidateName(r.Name),
 		validate.Required("userID", r.UserID),
-		validate.Required("expiry", r.Expiry),
-		validate.Required("inactivityTimeout", r.InactivityTimeout),
+		validate.MutuallyExclusive(
+			validate.Field{Name: "expiry", Value: r.Expiry},
+			validate.Field{Name: "expires", Value: r.Expires},
+		),
+		validate.ValidatorFunc(func() *validate.Failure {
+			if r.Expiry < 0 {
+				return validate.Fail("expiry", "must not be negative")
+			}
+			return nil
+		}),
+		validate.ValidatorFunc(func() *validate.Failure {
+			if !r.Expires.Time().IsZero() && r.Expires.Time().Before(time.Now()) {
+				return validate.Fail("expires", "must be in the future")
+			}
+			return nil
+		}),
+		validate.ValidatorFunc(func() *validate.Failure {
+			if r.InactivityTimeout < 0 {
+				return validate.Fail("inactivityTimeout", "must not be negative")
+			}
+			return nil
+		}),
 	}
 }
 
@@ -58,6 +83,19 @@ type CreateAccessKeyResponse struct {
 	AccessKey         string `json:"accessKey"`
 }
 
+// ExtendAccessKeyResponse is the result of extending the inactivity timeout
+// of the access key used for the request.
+type ExtendAccessKeyResponse struct {
+	ID                uid.ID `json:"id" note:"ID of the access key"`
+	Expires           Time   `json:"expires" note:"after this deadline the key is no longer valid. Extending the key does not change it"`
+	InactivityTimeout Time   `json:"inactivityTimeout" note:"the new time by which the key must be used to remain valid. Empty if the key has no inactivity timeout"`
+}
+
+// StatusCode is 200 OK, because extending a key does not create anything.
+func (r *ExtendAccessKeyResponse) StatusCode() int {
+	return http.StatusOK
+}
+
 // ValidateName returns a standard validation rule for all name fields. The
 // field name must always be "name".
 func ValidateName(value string) validate.StringRule {
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"github.com/infrahq/infra/internal/validate"
+	"github.com/infrahq/infra/uid"
+)
+
+// AuditEvent is a record of a security relevant action, like a login or a
+// change to a grant.
+type AuditEvent struct {
+	ID               uid.ID            `json:"id"`
+	Created          Time              `json:"created"`
+	ActorID          uid.ID            `json:"actorID" note:"ID of the user that performed the action. Empty when the user is not known, for example a failed login"`
+	ActorName        string            `json:"actorName" example:"admin@example.com" note:"Name of the user that performed the action, or the name used to login"`
+	ImpersonatorID   uid.ID            `json:"impersonatorID,omitempty" note:"ID of the support admin that performed the action as the actor"`
+	ImpersonatorName string            `json:"impersonatorName,omitempty" note:"Name of the support admin that performed the action as the actor"`
+	Action           string            `json:"action" example:"grant.create"`
+	TargetType       string            `json:"targetType" example:"grant" note:"Kind of the resource the action was performed on"`
+	TargetID         string            `json:"targetID" note:"ID of the resource the action was performed on"`
+	TargetName       string            `json:"targetName" example:"production" note:"Name of the resource when the action was performed"`
+	Metadata         map[string]string `json:"metadata,omitempty" note:"Other details of the action, like the privilege of a grant"`
+	Result           string            `json:"result" example:"success" note:"Either success or failure"`
+	Reason           string            `json:"reason,omitempty" note:"Why the action failed"`
+	RequestID        string            `json:"requestID"`
+	SourceIP         string            `json:"sourceIP" example:"192.0.2.10" note:"Address of the client that made the request"`
+}
+
+type ListAuditEventsRequest struct {
+	ActorID    uid.ID `form:"actorID" note:"ID of the user that performed the action"`
+	ActorName  string `form:"actorName" example:"admin@example.com" note:"Name of the user that performed the action"`
+	Action     string `form:"action" example:"grant.*" note:"Name of the action. A trailing * matches any action with that prefix"`
+	TargetType string `form:"targetType" example:"grant" note:"Kind of the resource the action was performed on"`
+	TargetID   string `form:"targetID" note:"ID of the resource the action was performed on"`
+	TargetName string `form:"targetName" example:"production" note:"Name of the resource. Also matches any resource nested under the name, like production.namespace"`
+	After      Time   `form:"after" note:"Only events created at or after this time"`
+	Before     Time   `form:"before" note:"Only events created before this time"`
+	PaginationRequest
+}
+
+// ValidationRules rejects a before time that is earlier than the after time.
+// The rules of the embedded PaginationRequest are applied separately.
+func (r ListAuditEventsRequest) ValidationRules() []validate.ValidationRule {
+	notBefore := minTime
+	if !r.After.Time().IsZero() {
+		notBefore = r.After.Time()
+	}
+	return []validate.ValidationRule{
+		validate.Date("before", r.Before.Time(), notBefore, maxTime),
+	}
+}
+
+func (req ListAuditEventsRequest) SetPage(page int) Paginatable {
+	req.PaginationRequest.Page = page
+
+	return req
+}
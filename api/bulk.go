@@ -0,0 +1,56 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/infrahq/infra/internal/validate"
+	"github.com/infrahq/infra/uid"
+)
+
+// MaxBulkDeleteIDs is the maximum number of IDs in a BulkDeleteRequest.
+const MaxBulkDeleteIDs = 100
+
+// BulkDeleteRequest deletes many users, grants, or access keys in a single
+// request.
+type BulkDeleteRequest struct {
+	IDs []uid.ID `json:"ids" note:"IDs of the items to delete" example:"[6dYiUyYgKa,6hPY5vqB2R]"`
+}
+
+func (r BulkDeleteRequest) ValidationRules() []validate.ValidationRule {
+	return []validate.ValidationRule{
+		validate.Required("ids", r.IDs),
+		validate.ValidatorFunc(func() *validate.Failure {
+			if len(r.IDs) > MaxBulkDeleteIDs {
+				return validate.Fail("ids", fmt.Sprintf("must have at most %d items", MaxBulkDeleteIDs))
+			}
+			return nil
+		}),
+	}
+}
+
+// The status of each item in a BulkDeleteResponse.
+const (
+	BulkDeleteStatusDeleted    = "deleted"
+	BulkDeleteStatusNotFound   = "not_found"
+	BulkDeleteStatusForbidden  = "forbidden"
+	BulkDeleteStatusBadRequest = "bad_request"
+)
+
+// BulkDeleteResponse has a result for each ID in the BulkDeleteRequest, in the
+// same order as the request. An item that could not be deleted does not
+// prevent the other items from being deleted.
+type BulkDeleteResponse struct {
+	Items []BulkDeleteResult `json:"items"`
+}
+
+// StatusCode is always 200 OK, even when some of the items were not deleted.
+func (r *BulkDeleteResponse) StatusCode() int {
+	return http.StatusOK
+}
+
+type BulkDeleteResult struct {
+	ID      uid.ID `json:"id"`
+	Status  string `json:"status" note:"One of deleted, not_found, forbidden, or bad_request" example:"deleted"`
+	Message string `json:"message,omitempty" note:"Reason the item was not deleted"`
+}
@@ -15,12 +15,14 @@ import (
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/ssoroka/slice"
+	"go.opentelemetry.io/otel/propagation"
 
+	"github.com/infrahq/infra/internal/generate"
 	"github.com/infrahq/infra/internal/logging"
 	"github.com/infrahq/infra/uid"
 )
 
-var apiVersion = "0.18.1"
+var apiVersion = "0.20.0"
 
 var (
 	ErrTimeout            = errors.New("client timed out waiting for response from server")
@@ -28,9 +30,12 @@ var (
 )
 
 const (
-	InfraAdminRole     = "admin"
-	InfraViewRole      = "view"
-	InfraConnectorRole = "connector"
+	InfraAdminRole        = "admin"
+	InfraViewRole         = "view"
+	InfraConnectorRole    = "connector"
+	InfraUserAdminRole    = "user-admin"
+	InfraGrantAdminRole   = "grant-admin"
+	InfraImpersonatorRole = "impersonator"
 )
 
 type Client struct {
@@ -47,10 +52,15 @@ type Client struct {
 
 	// ObserveFunc is a callback to measure and record the status and duration of the request
 	ObserveFunc func(time.Time, *http.Request, *http.Response, error)
+
+	// Retry configures retries of requests that failed with a status that may
+	// be temporary. By default requests are not retried.
+	Retry RetryPolicy
 }
 
 // checkError checks the resp for an error code, and returns an api.Error with
-// details about the error. Returns nil if the status code is 2xx.
+// details about the error, or a ValidationError that wraps the api.Error when
+// fields of the request are invalid. Returns nil if the status code is 2xx.
 //
 // 3xx codes are considered an error because redirects should have already
 // been followed before calling checkError.
@@ -67,6 +77,9 @@ func checkError(resp *http.Response, body []byte) error {
 		apiError.Message = string(body)
 	}
 
+	if apiError.Code == http.StatusBadRequest && len(apiError.FieldErrors) > 0 {
+		return ValidationError{Err: apiError}
+	}
 	return apiError
 }
 
@@ -111,35 +124,20 @@ func (c *Client) buildRequest(
 	for k, v := range c.Headers {
 		req.Header[k] = v
 	}
+
+	// continue the trace of the caller, so that the request to the server is
+	// part of the same trace
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
 	return req, nil
 }
 
 func request[Res any](client Client, req *http.Request) (*Res, error) {
-	start := time.Now()
-	resp, err := client.HTTP.Do(req)
-
-	if client.ObserveFunc != nil {
-		client.ObserveFunc(start, req, resp, err)
-	}
-
-	if resp != nil && resp.StatusCode == 401 && client.OnUnauthorized != nil {
+	resp, body, err := client.do(req)
+	if resp != nil && resp.StatusCode == http.StatusUnauthorized && client.OnUnauthorized != nil {
 		defer client.OnUnauthorized()
 	}
-
-	if err != nil {
-		if connError := HandleConnError(err); connError != nil {
-			return nil, connError
-		}
-		return nil, fmt.Errorf("%s %q: %w", req.Method, req.URL.Path, err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		if errors.Is(err, context.DeadlineExceeded) {
-			return nil, fmt.Errorf("%w: %s", ErrTimeout, err)
-		}
-		return nil, fmt.Errorf("reading response: %w", err)
+		return nil, err
 	}
 
 	if err := checkError(resp, body); err != nil {
@@ -159,13 +157,80 @@ func request[Res any](client Client, req *http.Request) (*Res, error) {
 		}
 	}
 
+	if r, ok := any(&resBody).(readsResponseBody); ok {
+		r.setResponseBody(resp.Header, body)
+	}
+
 	return &resBody, nil
 }
 
+// do sends the request, and returns the response and its body. The request is
+// sent again when the response is a failure that client.Retry allows to be
+// retried. The response is returned with the error when the body could not be
+// read.
+func (c Client) do(req *http.Request) (*http.Response, []byte, error) {
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		resp, err := c.HTTP.Do(req)
+
+		if c.ObserveFunc != nil {
+			c.ObserveFunc(start, req, resp, err)
+		}
+
+		if err != nil {
+			if connError := HandleConnError(err); connError != nil {
+				return nil, nil, connError
+			}
+			return nil, nil, fmt.Errorf("%s %q: %w", req.Method, req.URL.Path, err)
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return resp, nil, fmt.Errorf("%w: %s", ErrTimeout, err)
+			}
+			return resp, nil, fmt.Errorf("reading response: %w", err)
+		}
+
+		if !c.Retry.shouldRetry(attempt, req, resp) {
+			return resp, body, nil
+		}
+
+		delay := c.Retry.backoff(attempt, resp)
+		logging.Debugf("%s %q: retrying after %v, response status %d", req.Method, req.URL.Path, delay, resp.StatusCode)
+		if err := sleep(req.Context(), delay); err != nil {
+			// return the failed response, it is more informative than the
+			// context error
+			return resp, body, nil
+		}
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, nil, fmt.Errorf("retry request: %w", err)
+			}
+		}
+	}
+}
+
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 type readsResponseHeader interface {
 	setValuesFromHeader(header http.Header) error
 }
 
+type readsResponseBody interface {
+	setResponseBody(header http.Header, body []byte)
+}
+
 func get[Res any](ctx context.Context, client Client, path string, query Query) (*Res, error) {
 	req, err := client.buildRequest(ctx, http.MethodGet, path, query, nil)
 	if err != nil {
@@ -186,6 +251,28 @@ func post[Res any](ctx context.Context, client Client, path string, req any) (*R
 	return request[Res](client, httpReq)
 }
 
+// postIdempotent sends a POST request to an endpoint that accepts an
+// Idempotency-Key header. The header is set when retries are enabled, so that a
+// request which is retried after a failure is not applied twice.
+func postIdempotent[Res any](ctx context.Context, client Client, path string, req any) (*Res, error) {
+	body, err := encodeRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := client.buildRequest(ctx, http.MethodPost, path, nil, body)
+	if err != nil {
+		return nil, err
+	}
+	if client.Retry.MaxRetries > 0 {
+		key, err := generate.CryptoRandom(32, generate.CharsetAlphaNumeric)
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Idempotency-Key", key)
+	}
+	return request[Res](client, httpReq)
+}
+
 func encodeRequestBody(req any) (io.Reader, error) {
 	if req == nil {
 		return nil, nil
@@ -240,11 +327,19 @@ func (c Client) ListUsers(ctx context.Context, req ListUsersRequest) (*ListRespo
 		"ids":                  ids,
 		"page":                 {strconv.Itoa(req.Page)},
 		"limit":                {strconv.Itoa(req.Limit)},
+		"withTotal":            req.withTotalQuery(),
+		"cursor":               {req.Cursor},
 		"showSystem":           {strconv.FormatBool(req.ShowSystem)},
 		"publicKeyFingerprint": {req.PublicKeyFingerprint},
+		"fields":               req.Fields,
 	})
 }
 
+// Users returns an iterator over the users of every page of ListUsers.
+func (c Client) Users(ctx context.Context, req ListUsersRequest) *ListIterator[User] {
+	return NewListIterator(ctx, c.ListUsers, req)
+}
+
 func (c Client) GetUser(ctx context.Context, id uid.ID) (*User, error) {
 	return get[User](ctx, c, fmt.Sprintf("/api/users/%s", id), Query{})
 }
@@ -253,18 +348,39 @@ func (c Client) GetUserSelf(ctx context.Context) (*User, error) {
 	return get[User](ctx, c, "/api/users/self", Query{})
 }
 
+// GetCSRFToken returns the CSRF token of the session used by the client.
+// Clients that authenticate with an access key in the Authorization header do
+// not need the token.
+func (c Client) GetCSRFToken(ctx context.Context) (*CSRFTokenResponse, error) {
+	return get[CSRFTokenResponse](ctx, c, "/api/csrf-token", Query{})
+}
+
+// GetSelf returns the user, organization, privileges, and session of the
+// access key used by the client.
+func (c Client) GetSelf(ctx context.Context) (*Self, error) {
+	return get[Self](ctx, c, "/api/self", Query{})
+}
+
 func (c Client) CreateUser(ctx context.Context, req *CreateUserRequest) (*CreateUserResponse, error) {
-	return post[CreateUserResponse](ctx, c, "/api/users", req)
+	return postIdempotent[CreateUserResponse](ctx, c, "/api/users", req)
 }
 
 func (c Client) UpdateUser(ctx context.Context, req *UpdateUserRequest) (*User, error) {
 	return put[User](ctx, c, fmt.Sprintf("/api/users/%s", req.ID.String()), req)
 }
 
+func (c Client) PatchUser(ctx context.Context, req *PatchUserRequest) (*User, error) {
+	return patch[User](ctx, c, fmt.Sprintf("/api/users/%s", req.ID.String()), req)
+}
+
 func (c Client) DeleteUser(ctx context.Context, id uid.ID) error {
 	return delete(ctx, c, fmt.Sprintf("/api/users/%s", id), Query{})
 }
 
+func (c Client) BulkDeleteUsers(ctx context.Context, req *BulkDeleteRequest) (*BulkDeleteResponse, error) {
+	return post[BulkDeleteResponse](ctx, c, "/api/users/bulk-delete", req)
+}
+
 func (c Client) AddUserPublicKey(ctx context.Context, req *AddUserPublicKeyRequest) (*UserPublicKey, error) {
 	return put[UserPublicKey](ctx, c, "/api/users/public-key", req)
 }
@@ -277,13 +393,30 @@ func (c Client) GetDeviceFlowStatus(ctx context.Context, req *DeviceFlowStatusRe
 	return post[DeviceFlowStatusResponse](ctx, c, "/api/device/status", req)
 }
 
+func (c Client) ApproveDeviceFlow(ctx context.Context, req *ApproveDeviceFlowRequest) error {
+	_, err := post[EmptyResponse](ctx, c, "/api/device/approve", req)
+	return err
+}
+
+func (c Client) DenyDeviceFlow(ctx context.Context, req *DenyDeviceFlowRequest) error {
+	_, err := post[EmptyResponse](ctx, c, "/api/device/deny", req)
+	return err
+}
+
 func (c Client) ListGroups(ctx context.Context, req ListGroupsRequest) (*ListResponse[Group], error) {
 	return get[ListResponse[Group]](ctx, c, "/api/groups", Query{
 		"name": {req.Name}, "userID": {req.UserID.String()},
 		"page": {strconv.Itoa(req.Page)}, "limit": {strconv.Itoa(req.Limit)},
+		"withTotal": req.withTotalQuery(),
+		"fields":    req.Fields,
 	})
 }
 
+// Groups returns an iterator over the groups of every page of ListGroups.
+func (c Client) Groups(ctx context.Context, req ListGroupsRequest) *ListIterator[Group] {
+	return NewListIterator(ctx, c.ListGroups, req)
+}
+
 func (c Client) GetGroup(ctx context.Context, id uid.ID) (*Group, error) {
 	return get[Group](ctx, c, fmt.Sprintf("/api/groups/%s", id), Query{})
 }
@@ -305,15 +438,26 @@ func (c Client) ListProviders(ctx context.Context, req ListProvidersRequest) (*L
 	return get[ListResponse[Provider]](ctx, c, "/api/providers", Query{
 		"name": {req.Name},
 		"page": {strconv.Itoa(req.Page)}, "limit": {strconv.Itoa(req.Limit)},
+		"withTotal": req.withTotalQuery(),
 	})
 }
 
+// Providers returns an iterator over the providers of every page of ListProviders.
+func (c Client) Providers(ctx context.Context, req ListProvidersRequest) *ListIterator[Provider] {
+	return NewListIterator(ctx, c.ListProviders, req)
+}
+
 func (c Client) ListOrganizations(ctx context.Context, req ListOrganizationsRequest) (*ListResponse[Organization], error) {
 	return get[ListResponse[Organization]](ctx, c, "/api/organizations", Query{
 		"name": {req.Name},
 	})
 }
 
+// Organizations returns an iterator over the organizations of every page of ListOrganizations.
+func (c Client) Organizations(ctx context.Context, req ListOrganizationsRequest) *ListIterator[Organization] {
+	return NewListIterator(ctx, c.ListOrganizations, req)
+}
+
 func (c Client) GetOrganization(ctx context.Context, id uid.ID) (*Organization, error) {
 	return get[Organization](ctx, c, fmt.Sprintf("/api/organizations/%s", id), Query{})
 }
@@ -322,12 +466,43 @@ func (c Client) GetOrganizationSelf(ctx context.Context) (*Organization, error)
 	return get[Organization](ctx, c, "/api/organizations/self", Query{})
 }
 
-func (c Client) CreateOrganization(ctx context.Context, req *CreateOrganizationRequest) (*Organization, error) {
-	return post[Organization](ctx, c, "/api/organizations", req)
+func (c Client) CreateOrganization(ctx context.Context, req *CreateOrganizationRequest) (*CreateOrganizationResponse, error) {
+	return post[CreateOrganizationResponse](ctx, c, "/api/organizations", req)
+}
+
+func (c Client) UpdateOrganization(ctx context.Context, req *UpdateOrganizationRequest) (*Organization, error) {
+	return patch[Organization](ctx, c, fmt.Sprintf("/api/organizations/%s", req.ID), req)
+}
+
+func (c Client) GetOrganizationRateLimits(ctx context.Context, id uid.ID) (*OrganizationRateLimits, error) {
+	return get[OrganizationRateLimits](ctx, c, fmt.Sprintf("/api/organizations/%s/rate-limits", id), Query{})
 }
 
-func (c Client) DeleteOrganization(ctx context.Context, id uid.ID) error {
-	return delete(ctx, c, fmt.Sprintf("/api/organizations/%s", id), Query{})
+func (c Client) UpdateOrganizationRateLimits(ctx context.Context, req *UpdateOrganizationRateLimitsRequest) (*OrganizationRateLimits, error) {
+	return put[OrganizationRateLimits](ctx, c, fmt.Sprintf("/api/organizations/%s/rate-limits", req.ID), req)
+}
+
+func (c Client) GetOrganizationStats(ctx context.Context, id uid.ID) (*OrganizationStats, error) {
+	return get[OrganizationStats](ctx, c, fmt.Sprintf("/api/organizations/%s/stats", id), Query{})
+}
+
+func (c Client) ExportOrganization(ctx context.Context, id uid.ID) (*OrganizationExport, error) {
+	return get[OrganizationExport](ctx, c, fmt.Sprintf("/api/organizations/%s/export", id), Query{})
+}
+
+func (c Client) GetStats(ctx context.Context) (*OrganizationStats, error) {
+	return get[OrganizationStats](ctx, c, "/api/stats", Query{})
+}
+
+func (c Client) DeleteOrganization(ctx context.Context, req *DeleteOrganizationRequest) (*DeleteOrganizationResponse, error) {
+	httpReq, err := c.buildRequest(ctx, http.MethodDelete, fmt.Sprintf("/api/organizations/%s", req.ID), Query{
+		"confirm": {req.Confirm},
+		"dryRun":  {strconv.FormatBool(req.DryRun)},
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return request[DeleteOrganizationResponse](c, httpReq)
 }
 
 func (c Client) GetProvider(ctx context.Context, id uid.ID) (*Provider, error) {
@@ -350,8 +525,8 @@ func (c Client) DeleteProvider(ctx context.Context, id uid.ID) error {
 	return delete(ctx, c, fmt.Sprintf("/api/providers/%s", id), Query{})
 }
 
-func (c Client) ListGrants(ctx context.Context, req ListGrantsRequest) (*ListResponse[Grant], error) {
-	return get[ListResponse[Grant]](ctx, c, "/api/grants", Query{
+func (c Client) ListGrants(ctx context.Context, req ListGrantsRequest) (*ListGrantsResponse, error) {
+	return get[ListGrantsResponse](ctx, c, "/api/grants", Query{
 		"user":            {req.User.String()},
 		"group":           {req.Group.String()},
 		"resource":        {req.Resource},
@@ -361,31 +536,60 @@ func (c Client) ListGrants(ctx context.Context, req ListGrantsRequest) (*ListRes
 		"showSystem":      {strconv.FormatBool(req.ShowSystem)},
 		"page":            {strconv.Itoa(req.Page)},
 		"limit":           {strconv.Itoa(req.Limit)},
+		"withTotal":       req.withTotalQuery(),
+		"cursor":          {req.Cursor},
 		"lastUpdateIndex": {strconv.FormatInt(req.LastUpdateIndex, 10)},
+		"fields":          req.Fields,
 	})
 }
 
+// Grants returns an iterator over the grants of every page of ListGrants.
+func (c Client) Grants(ctx context.Context, req ListGrantsRequest) *ListIterator[Grant] {
+	list := func(ctx context.Context, req ListGrantsRequest) (*ListResponse[Grant], error) {
+		resp, err := c.ListGrants(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return &resp.ListResponse, nil
+	}
+	return NewListIterator(ctx, list, req)
+}
+
 func (c Client) GetGrant(ctx context.Context, id uid.ID) (*Grant, error) {
 	return get[Grant](ctx, c, fmt.Sprintf("/api/grants/%s", id), Query{})
 }
 
 func (c Client) CreateGrant(ctx context.Context, req *GrantRequest) (*CreateGrantResponse, error) {
-	return post[CreateGrantResponse](ctx, c, "/api/grants", req)
+	return postIdempotent[CreateGrantResponse](ctx, c, "/api/grants", req)
+}
+
+func (c Client) PatchGrant(ctx context.Context, req *PatchGrantRequest) (*Grant, error) {
+	return patch[Grant](ctx, c, fmt.Sprintf("/api/grants/%s", req.ID.String()), req)
 }
 
 func (c Client) DeleteGrant(ctx context.Context, id uid.ID) error {
 	return delete(ctx, c, fmt.Sprintf("/api/grants/%s", id), Query{})
 }
 
+func (c Client) BulkDeleteGrants(ctx context.Context, req *BulkDeleteRequest) (*BulkDeleteResponse, error) {
+	return post[BulkDeleteResponse](ctx, c, "/api/grants/bulk-delete", req)
+}
+
 func (c Client) ListDestinations(ctx context.Context, req ListDestinationsRequest) (*ListResponse[Destination], error) {
 	return get[ListResponse[Destination]](ctx, c, "/api/destinations", Query{
 		"name":      {req.Name},
 		"unique_id": {req.UniqueID},
 		"kind":      {req.Kind},
 		"page":      {strconv.Itoa(req.Page)}, "limit": {strconv.Itoa(req.Limit)},
+		"withTotal": req.withTotalQuery(),
 	})
 }
 
+// Destinations returns an iterator over the destinations of every page of ListDestinations.
+func (c Client) Destinations(ctx context.Context, req ListDestinationsRequest) *ListIterator[Destination] {
+	return NewListIterator(ctx, c.ListDestinations, req)
+}
+
 func (c Client) CreateDestination(ctx context.Context, req *CreateDestinationRequest) (*Destination, error) {
 	return post[Destination](ctx, c, "/api/destinations", req)
 }
@@ -398,17 +602,121 @@ func (c Client) DeleteDestination(ctx context.Context, id uid.ID) error {
 	return delete(ctx, c, fmt.Sprintf("/api/destinations/%s", id), Query{})
 }
 
+func (c Client) CreateDestinationLogs(ctx context.Context, req *CreateDestinationLogsRequest) error {
+	_, err := post[EmptyResponse](ctx, c, fmt.Sprintf("/api/destinations/%s/logs", req.ID), req)
+	return err
+}
+
+func (c Client) ListDestinationLogs(ctx context.Context, req ListDestinationLogsRequest) (*ListResponse[DestinationLog], error) {
+	return get[ListResponse[DestinationLog]](ctx, c, fmt.Sprintf("/api/destinations/%s/logs", req.ID), Query{
+		"page": {strconv.Itoa(req.Page)}, "limit": {strconv.Itoa(req.Limit)},
+		"withTotal": req.withTotalQuery(),
+	})
+}
+
+func (c Client) GetDestinationUsage(ctx context.Context, req DestinationUsageRequest) (*DestinationUsage, error) {
+	return get[DestinationUsage](ctx, c, fmt.Sprintf("/api/destinations/%s/usage", req.ID), Query{
+		"days": {strconv.Itoa(req.Days)},
+	})
+}
+
+func (c Client) GetDestinationMetrics(ctx context.Context, id uid.ID) (*DestinationMetrics, error) {
+	return get[DestinationMetrics](ctx, c, fmt.Sprintf("/api/destinations/%s/metrics", id), Query{})
+}
+
+func (c Client) ListWebhooks(ctx context.Context, req ListWebhooksRequest) (*ListResponse[Webhook], error) {
+	return get[ListResponse[Webhook]](ctx, c, "/api/webhooks", Query{
+		"page": {strconv.Itoa(req.Page)}, "limit": {strconv.Itoa(req.Limit)},
+		"withTotal": req.withTotalQuery(),
+	})
+}
+
+// Webhooks returns an iterator over the webhooks of every page of ListWebhooks.
+func (c Client) Webhooks(ctx context.Context, req ListWebhooksRequest) *ListIterator[Webhook] {
+	return NewListIterator(ctx, c.ListWebhooks, req)
+}
+
+func (c Client) GetWebhook(ctx context.Context, id uid.ID) (*Webhook, error) {
+	return get[Webhook](ctx, c, fmt.Sprintf("/api/webhooks/%s", id), Query{})
+}
+
+func (c Client) CreateWebhook(ctx context.Context, req *CreateWebhookRequest) (*Webhook, error) {
+	return post[Webhook](ctx, c, "/api/webhooks", req)
+}
+
+func (c Client) DeleteWebhook(ctx context.Context, id uid.ID) error {
+	return delete(ctx, c, fmt.Sprintf("/api/webhooks/%s", id), Query{})
+}
+
+func (c Client) ListWebhookDeliveries(ctx context.Context, req ListWebhookDeliveriesRequest) (*ListResponse[WebhookDelivery], error) {
+	return get[ListResponse[WebhookDelivery]](ctx, c, fmt.Sprintf("/api/webhooks/%s/deliveries", req.ID), Query{
+		"status": {req.Status},
+		"page":   {strconv.Itoa(req.Page)}, "limit": {strconv.Itoa(req.Limit)},
+		"withTotal": req.withTotalQuery(),
+	})
+}
+
 func (c Client) ListAccessKeys(ctx context.Context, req ListAccessKeysRequest) (*ListResponse[AccessKey], error) {
 	return get[ListResponse[AccessKey]](ctx, c, "/api/access-keys", Query{
 		"userID":       {req.UserID.String()},
 		"name":         {req.Name},
 		"show_expired": {fmt.Sprint(req.ShowExpired)},
 		"page":         {strconv.Itoa(req.Page)}, "limit": {strconv.Itoa(req.Limit)},
+		"withTotal": req.withTotalQuery(),
 	})
 }
 
+// AccessKeys returns an iterator over the access keys of every page of ListAccessKeys.
+func (c Client) AccessKeys(ctx context.Context, req ListAccessKeysRequest) *ListIterator[AccessKey] {
+	return NewListIterator(ctx, c.ListAccessKeys, req)
+}
+
+func (c Client) ListAuditEvents(ctx context.Context, req ListAuditEventsRequest) (*ListResponse[AuditEvent], error) {
+	query := Query{
+		"actorID":    {req.ActorID.String()},
+		"actorName":  {req.ActorName},
+		"action":     {req.Action},
+		"targetType": {req.TargetType},
+		"targetID":   {req.TargetID},
+		"targetName": {req.TargetName},
+		"page":       {strconv.Itoa(req.Page)}, "limit": {strconv.Itoa(req.Limit)},
+		"withTotal": req.withTotalQuery(),
+	}
+	if !req.After.Time().IsZero() {
+		query["after"] = []string{req.After.Format(time.RFC3339Nano)}
+	}
+	if !req.Before.Time().IsZero() {
+		query["before"] = []string{req.Before.Format(time.RFC3339Nano)}
+	}
+	return get[ListResponse[AuditEvent]](ctx, c, "/api/audit-events", query)
+}
+
+// AuditEvents returns an iterator over the audit events of every page of ListAuditEvents.
+func (c Client) AuditEvents(ctx context.Context, req ListAuditEventsRequest) *ListIterator[AuditEvent] {
+	return NewListIterator(ctx, c.ListAuditEvents, req)
+}
+
+// GetAuthenticationReport returns the report in JSON. The format of req is
+// ignored, use the API directly to download the report as CSV.
+func (c Client) GetAuthenticationReport(ctx context.Context, req AuthenticationReportRequest) (*AuthenticationReport, error) {
+	query := Query{}
+	if !req.After.Time().IsZero() {
+		query["after"] = []string{req.After.Format(time.RFC3339Nano)}
+	}
+	if !req.Before.Time().IsZero() {
+		query["before"] = []string{req.Before.Format(time.RFC3339Nano)}
+	}
+	return get[AuthenticationReport](ctx, c, "/api/reports/authentication", query)
+}
+
 func (c Client) CreateAccessKey(ctx context.Context, req *CreateAccessKeyRequest) (*CreateAccessKeyResponse, error) {
-	return post[CreateAccessKeyResponse](ctx, c, "/api/access-keys", req)
+	return postIdempotent[CreateAccessKeyResponse](ctx, c, "/api/access-keys", req)
+}
+
+// ExtendAccessKey extends the inactivity timeout of the access key used by the
+// client, and returns the new timeout.
+func (c Client) ExtendAccessKey(ctx context.Context) (*ExtendAccessKeyResponse, error) {
+	return post[ExtendAccessKeyResponse](ctx, c, "/api/access-keys/self/extend", &EmptyRequest{})
 }
 
 func (c Client) DeleteAccessKey(ctx context.Context, id uid.ID) error {
@@ -419,14 +727,54 @@ func (c Client) DeleteAccessKeyByName(ctx context.Context, name string) error {
 	return delete(ctx, c, "/api/access-keys", Query{"name": []string{name}})
 }
 
+func (c Client) BulkDeleteAccessKeys(ctx context.Context, req *BulkDeleteRequest) (*BulkDeleteResponse, error) {
+	return post[BulkDeleteResponse](ctx, c, "/api/access-keys/bulk-delete", req)
+}
+
 func (c Client) CreateToken(ctx context.Context) (*CreateTokenResponse, error) {
-	return post[CreateTokenResponse](ctx, c, "/api/tokens", &EmptyRequest{})
+	return post[CreateTokenResponse](ctx, c, "/api/tokens", &CreateTokenRequest{})
+}
+
+// CreateDestinationToken creates a token that is only accepted by the
+// destination.
+func (c Client) CreateDestinationToken(ctx context.Context, destination string) (*CreateTokenResponse, error) {
+	return post[CreateTokenResponse](ctx, c, "/api/tokens", &CreateTokenRequest{Destination: destination})
 }
 
 func (c Client) Login(ctx context.Context, req *LoginRequest) (*LoginResponse, error) {
 	return post[LoginResponse](ctx, c, "/api/login", req)
 }
 
+func (c Client) EnrollTOTP(ctx context.Context) (*EnrollTOTPResponse, error) {
+	return post[EnrollTOTPResponse](ctx, c, "/api/users/self/mfa/totp", &EmptyRequest{})
+}
+
+func (c Client) ConfirmTOTP(ctx context.Context, req *ConfirmTOTPRequest) (*ConfirmTOTPResponse, error) {
+	return post[ConfirmTOTPResponse](ctx, c, "/api/users/self/mfa/totp/confirm", req)
+}
+
+func (c Client) UnlockUser(ctx context.Context, id uid.ID) error {
+	return delete(ctx, c, fmt.Sprintf("/api/users/%s/lockout", id), Query{})
+}
+
+func (c Client) ResetUserMFA(ctx context.Context, id uid.ID) error {
+	return delete(ctx, c, fmt.Sprintf("/api/users/%s/mfa", id), Query{})
+}
+
+func (c Client) ListUserSessions(ctx context.Context, req ListUserSessionsRequest) (*ListResponse[UserSession], error) {
+	return get[ListResponse[UserSession]](ctx, c, fmt.Sprintf("/api/users/%s/sessions", req.ID), Query{
+		"page": {strconv.Itoa(req.Page)}, "limit": {strconv.Itoa(req.Limit)},
+		"withTotal": req.withTotalQuery(),
+	})
+}
+
+func (c Client) DeleteUserSessions(ctx context.Context, req DeleteUserSessionsRequest) error {
+	notIDs := slice.Map[uid.ID, string](req.NotIDs, func(id uid.ID) string {
+		return id.String()
+	})
+	return delete(ctx, c, fmt.Sprintf("/api/users/%s/sessions", req.ID), Query{"notIDs": notIDs})
+}
+
 func (c Client) Logout(ctx context.Context) error {
 	_, err := post[EmptyResponse](ctx, c, "/api/logout", &EmptyRequest{})
 	return err
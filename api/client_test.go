@@ -5,10 +5,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"runtime"
+	"strconv"
 	"testing"
+	"time"
 
 	"gotest.tools/v3/assert"
 )
@@ -184,6 +187,12 @@ func TestListGrants(t *testing.T) {
 			}
 
 			resp.Header().Set("Last-Update-Index", "10010")
+			if r.URL.Query().Get("destination") == "signed" {
+				resp.Header().Set("Infra-Signature", "the-signature")
+				resp.WriteHeader(http.StatusOK)
+				_, _ = resp.Write([]byte(`{"items":[{"privilege":"view"}]}`))
+				return
+			}
 			resp.WriteHeader(http.StatusOK)
 			_, _ = resp.Write([]byte(`{}`))
 		default:
@@ -209,10 +218,21 @@ func TestListGrants(t *testing.T) {
 		assert.NilError(t, err)
 
 		assert.Equal(t, resp.LastUpdateIndex.Index, int64(10010))
+		assert.Equal(t, resp.Signature, "")
+		assert.Assert(t, resp.Payload == nil)
 
 		req := <-reqCh
 		assert.Equal(t, req.URL.Query().Get("lastUpdateIndex"), "1234")
 	})
+	t.Run("sets signature and payload from a signed response", func(t *testing.T) {
+		resp, err := c.ListGrants(ctx, ListGrantsRequest{Destination: "signed"})
+		assert.NilError(t, err)
+		<-reqCh
+
+		assert.Equal(t, resp.Signature, "the-signature")
+		assert.Equal(t, string(resp.Payload), `{"items":[{"privilege":"view"}]}`)
+		assert.Equal(t, len(resp.Items), 1)
+	})
 	t.Run("not modified", func(t *testing.T) {
 		_, err := c.ListGrants(ctx, ListGrantsRequest{
 			Resource:        "anything",
@@ -259,3 +279,249 @@ func TestVersionAhead(t *testing.T) {
 		assert.Assert(t, !res)
 	})
 }
+
+func TestClient_Retry(t *testing.T) {
+	type attempt struct {
+		method         string
+		body           string
+		idempotencyKey string
+	}
+	var attempts []attempt
+	var failures []int
+	var retryAfter string
+
+	handler := func(resp http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		attempts = append(attempts, attempt{
+			method:         r.Method,
+			body:           string(body),
+			idempotencyKey: r.Header.Get("Idempotency-Key"),
+		})
+		if len(failures) > 0 {
+			code := failures[0]
+			failures = failures[1:]
+			if retryAfter != "" {
+				resp.Header().Set("Retry-After", retryAfter)
+			}
+			resp.WriteHeader(code)
+			_ = json.NewEncoder(resp).Encode(Error{Code: int32(code), Message: "injected failure"})
+			return
+		}
+		resp.WriteHeader(http.StatusOK)
+		_, _ = resp.Write([]byte(`{}`))
+	}
+	srv := httptest.NewServer(http.HandlerFunc(handler))
+	t.Cleanup(srv.Close)
+
+	c := Client{
+		URL:   srv.URL,
+		Retry: RetryPolicy{MaxRetries: 2, MinBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond},
+	}
+	ctx := context.Background()
+
+	setup := func(codes ...int) {
+		attempts, failures, retryAfter = nil, codes, ""
+	}
+
+	t.Run("get is retried after a server error", func(t *testing.T) {
+		setup(http.StatusServiceUnavailable, http.StatusBadGateway)
+		_, err := c.GetUser(ctx, 1234)
+		assert.NilError(t, err)
+		assert.Equal(t, len(attempts), 3)
+	})
+	t.Run("retries are exhausted", func(t *testing.T) {
+		setup(http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError)
+		_, err := c.GetUser(ctx, 1234)
+		assert.Equal(t, ErrorStatusCode(err), int32(http.StatusInternalServerError))
+		assert.Error(t, err, "injected failure")
+		assert.Equal(t, len(attempts), 3)
+	})
+	t.Run("client errors are not retried", func(t *testing.T) {
+		setup(http.StatusNotFound)
+		_, err := c.GetUser(ctx, 1234)
+		assert.Assert(t, errors.Is(err, ErrNotFound), err)
+		assert.Equal(t, len(attempts), 1)
+	})
+	t.Run("post is not retried after a server error", func(t *testing.T) {
+		setup(http.StatusInternalServerError)
+		_, err := c.CreateGroup(ctx, &CreateGroupRequest{Name: "group"})
+		assert.Equal(t, ErrorStatusCode(err), int32(http.StatusInternalServerError))
+		assert.Equal(t, len(attempts), 1)
+	})
+	t.Run("post is retried when rate limited", func(t *testing.T) {
+		setup(http.StatusTooManyRequests)
+		retryAfter = "0"
+		_, err := c.CreateGroup(ctx, &CreateGroupRequest{Name: "group"})
+		assert.NilError(t, err)
+		assert.Equal(t, len(attempts), 2)
+		assert.Equal(t, attempts[1].body, attempts[0].body)
+		assert.Equal(t, attempts[1].idempotencyKey, "")
+	})
+	t.Run("post with an idempotency key is retried", func(t *testing.T) {
+		setup(http.StatusBadGateway)
+		_, err := c.CreateUser(ctx, &CreateUserRequest{Name: "user@example.com"})
+		assert.NilError(t, err)
+		assert.Equal(t, len(attempts), 2)
+		assert.Assert(t, attempts[0].idempotencyKey != "")
+		assert.Equal(t, attempts[1].idempotencyKey, attempts[0].idempotencyKey)
+		assert.Equal(t, attempts[1].body, attempts[0].body)
+		assert.Equal(t, attempts[1].body, `{"name":"user@example.com"}`)
+	})
+	t.Run("retries disabled", func(t *testing.T) {
+		setup(http.StatusServiceUnavailable)
+		c := Client{URL: srv.URL}
+		_, err := c.GetUser(ctx, 1234)
+		assert.Equal(t, ErrorStatusCode(err), int32(http.StatusServiceUnavailable))
+		assert.Equal(t, len(attempts), 1)
+
+		setup()
+		_, err = c.CreateUser(ctx, &CreateUserRequest{Name: "user@example.com"})
+		assert.NilError(t, err)
+		assert.Equal(t, attempts[0].idempotencyKey, "")
+	})
+	t.Run("context canceled while waiting", func(t *testing.T) {
+		setup(http.StatusTooManyRequests)
+		retryAfter = "60"
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		_, err := c.GetUser(ctx, 1234)
+		assert.Assert(t, errors.Is(err, ErrRateLimited), err)
+		assert.Equal(t, len(attempts), 1)
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	delay, ok := retryAfter("3")
+	assert.Assert(t, ok)
+	assert.Equal(t, delay, 3*time.Second)
+
+	delay, ok = retryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.Assert(t, ok)
+	assert.Assert(t, delay > 50*time.Second && delay <= time.Minute, delay)
+
+	delay, ok = retryAfter(time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat))
+	assert.Assert(t, ok)
+	assert.Equal(t, delay, time.Duration(0))
+
+	for _, value := range []string{"", "-1", "soon"} {
+		_, ok = retryAfter(value)
+		assert.Assert(t, !ok, value)
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	resp := &http.Response{Header: http.Header{}}
+
+	between := func(attempt int, low, high time.Duration) {
+		t.Helper()
+		delay := p.backoff(attempt, resp)
+		assert.Assert(t, delay >= low && delay <= high, "attempt %d: %v", attempt, delay)
+	}
+	between(0, 100*time.Millisecond, 125*time.Millisecond)
+	between(1, 200*time.Millisecond, 250*time.Millisecond)
+	between(2, 400*time.Millisecond, 500*time.Millisecond)
+	between(10, time.Second, 1250*time.Millisecond)
+
+	resp.Header.Set("Retry-After", "30")
+	assert.Equal(t, p.backoff(0, resp), 30*time.Second)
+}
+
+func TestCheckError_TypedErrors(t *testing.T) {
+	check := func(code int, body string) error {
+		return checkError(&http.Response{StatusCode: code}, []byte(body))
+	}
+
+	err := check(http.StatusNotFound, `{"code":404,"message":"user not found"}`)
+	assert.Assert(t, errors.Is(err, ErrNotFound))
+	assert.Assert(t, !errors.Is(err, ErrForbidden))
+	assert.Error(t, err, "user not found")
+
+	err = fmt.Errorf("wrapped: %w", check(http.StatusConflict, `{}`))
+	assert.Assert(t, errors.Is(err, ErrConflict))
+
+	err = check(http.StatusPreconditionFailed, `{"code":412}`)
+	assert.Assert(t, errors.Is(err, ErrPreconditionFailed))
+
+	err = check(http.StatusBadRequest, `{
+		"code": 400,
+		"message": "validation failed: name: is required",
+		"fieldErrors": [
+			{"fieldName": "name", "errors": ["is required"]},
+			{"fieldName": "password", "errors": ["too short", "needs a symbol"]}
+		]
+	}`)
+	var validationError ValidationError
+	assert.Assert(t, errors.As(err, &validationError), "wrong type %T", err)
+	expected := map[string][]string{
+		"name":     {"is required"},
+		"password": {"too short", "needs a symbol"},
+	}
+	assert.DeepEqual(t, validationError.Fields(), expected)
+	assert.Assert(t, errors.Is(err, ErrBadRequest))
+	assert.Equal(t, ErrorStatusCode(err), int32(http.StatusBadRequest))
+	assert.Error(t, err, "validation failed: name: is required")
+
+	err = check(http.StatusBadRequest, `{"code":400,"message":"bad request"}`)
+	assert.Assert(t, !errors.As(err, &validationError))
+	assert.Assert(t, errors.Is(err, ErrBadRequest))
+}
+
+func TestListIterator(t *testing.T) {
+	handler := func(resp http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		switch r.URL.Query().Get("name") {
+		case "error":
+			if page == 2 {
+				resp.WriteHeader(http.StatusForbidden)
+				_, _ = resp.Write([]byte(`{"code":403,"message":"forbidden"}`))
+				return
+			}
+		case "empty":
+			_ = json.NewEncoder(resp).Encode(ListResponse[User]{Items: []User{}})
+			return
+		}
+		_ = json.NewEncoder(resp).Encode(ListResponse[User]{
+			Items: []User{
+				{Name: fmt.Sprintf("%d-a@example.com", page)},
+				{Name: fmt.Sprintf("%d-b@example.com", page)},
+			},
+			PaginationResponse: PaginationResponse{Page: page, TotalPages: 3, TotalCount: 6},
+		})
+	}
+	srv := httptest.NewServer(http.HandlerFunc(handler))
+	t.Cleanup(srv.Close)
+
+	c := Client{URL: srv.URL}
+	ctx := context.Background()
+
+	t.Run("every page", func(t *testing.T) {
+		var names []string
+		users := c.Users(ctx, ListUsersRequest{PaginationRequest: PaginationRequest{Page: 2}})
+		for users.Next() {
+			names = append(names, users.Item().Name)
+		}
+		assert.NilError(t, users.Err())
+		expected := []string{
+			"1-a@example.com", "1-b@example.com",
+			"2-a@example.com", "2-b@example.com",
+			"3-a@example.com", "3-b@example.com",
+		}
+		assert.DeepEqual(t, names, expected)
+		assert.Assert(t, !users.Next())
+	})
+	t.Run("empty", func(t *testing.T) {
+		users, err := c.Users(ctx, ListUsersRequest{Name: "empty"}).All()
+		assert.NilError(t, err)
+		assert.DeepEqual(t, users, []User{})
+	})
+	t.Run("error", func(t *testing.T) {
+		users := c.Users(ctx, ListUsersRequest{Name: "error"})
+		count := 0
+		for users.Next() {
+			count++
+		}
+		assert.Equal(t, count, 2)
+		assert.Assert(t, errors.Is(users.Err(), ErrForbidden), users.Err())
+	})
+}
@@ -0,0 +1,8 @@
+package api
+
+// CSRFTokenResponse is the CSRF token of the session used for the request.
+// Requests authenticated with the session cookie must send the token in the
+// X-CSRF-Token header, unless the request method is GET, HEAD, or OPTIONS.
+type CSRFTokenResponse struct {
+	Token string `json:"token" note:"send this value in the X-CSRF-Token header"`
+}
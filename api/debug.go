@@ -0,0 +1,55 @@
+package api
+
+import "github.com/infrahq/infra/internal/validate"
+
+type LogLevel struct {
+	Level         string `json:"level" example:"debug"`
+	PreviousLevel string `json:"previousLevel,omitempty" note:"The log level before the update" example:"info"`
+}
+
+type UpdateLogLevelRequest struct {
+	Level       string   `json:"level" example:"debug"`
+	RevertAfter Duration `json:"revertAfter" note:"Change the log level back to the previous level after this amount of time. When zero the level is not reverted." example:"30m0s"`
+}
+
+func (r UpdateLogLevelRequest) ValidationRules() []validate.ValidationRule {
+	return []validate.ValidationRule{
+		validate.Required("level", r.Level),
+		validate.Enum("level", r.Level, []string{"trace", "debug", "info", "warn", "error"}),
+	}
+}
+
+type Migration struct {
+	ID          string `json:"id" example:"2023-01-04T10:00"`
+	Description string `json:"description" example:"addDestinationsUpdateIndex"`
+	AppliedAt   Time   `json:"appliedAt" note:"null when the migration is pending, or was applied before the time was recorded"`
+	Version     string `json:"version,omitempty" note:"The version of the server that applied the migration" example:"0.18.0"`
+	Pending     bool   `json:"pending"`
+}
+
+type ListMigrationsResponse struct {
+	Items   []Migration `json:"items"`
+	Pending int         `json:"pending" note:"The number of migrations that have not been applied"`
+}
+
+type Cache struct {
+	Name           string   `json:"name" example:"db-reads"`
+	Entries        int      `json:"entries" note:"The number of entries in the cache"`
+	Hits           int64    `json:"hits" note:"The number of lookups that found a value in the cache since the server started"`
+	Misses         int64    `json:"misses" note:"The number of lookups that did not find a value in the cache since the server started"`
+	OldestEntryAge Duration `json:"oldestEntryAge" note:"The age of the oldest entry in the cache. Zero when the cache is empty" example:"45s"`
+}
+
+type ListCachesResponse struct {
+	Items []Cache `json:"items"`
+}
+
+type FlushCacheRequest struct {
+	Name string `uri:"name" json:"-"`
+}
+
+func (r FlushCacheRequest) ValidationRules() []validate.ValidationRule {
+	return []validate.ValidationRule{
+		validate.Required("name", r.Name),
+	}
+}
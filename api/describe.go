@@ -0,0 +1,22 @@
+package api
+
+// ListDescription describes the query parameters accepted by a list endpoint.
+// It is the response of a list endpoint when the request has the query
+// parameter describe=true, so that a client can render controls for the
+// filters without hard coding them.
+type ListDescription struct {
+	Filters          []ListFilter `json:"filters" note:"Query parameters that filter the items in the list"`
+	SortableFields   []string     `json:"sortableFields" note:"Fields that the list can be sorted by"`
+	DefaultPageSize  int          `json:"defaultPageSize" note:"Number of items in a page when the limit is not set" example:"100"`
+	MaxPageSize      int          `json:"maxPageSize" note:"Largest limit accepted by the endpoint" example:"1000"`
+	CursorPagination bool         `json:"cursorPagination" note:"True when the endpoint accepts a cursor instead of a page number"`
+}
+
+type ListFilter struct {
+	Name        string   `json:"name" note:"Name of the query parameter" example:"name"`
+	Type        string   `json:"type" note:"One of string, integer, number, or boolean" example:"string"`
+	Format      string   `json:"format,omitempty" note:"Format of the value" example:"uid"`
+	Multiple    bool     `json:"multiple" note:"True when the parameter accepts more than one value"`
+	Enum        []string `json:"enum,omitempty" note:"The values accepted by the parameter, if it only accepts some values"`
+	Description string   `json:"description,omitempty" note:"Description of the parameter"`
+}
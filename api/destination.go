@@ -10,17 +10,19 @@ type Destination struct {
 	UniqueID   string                `json:"uniqueID" form:"uniqueID" note:"Unique ID generated by the connector" example:"94c2c570a20311180ec325fd56"`
 	Name       string                `json:"name" form:"name" note:"Name of the destination" example:"production-cluster"`
 	Kind       string                `json:"kind" note:"Kind of destination. eg. kubernetes or ssh or postgres" example:"kubernetes"`
-	Created    Time                  `json:"created" note:"Time destination was created" example:"2022-11-10T23:35:22Z"`
-	Updated    Time                  `json:"updated" note:"Time destination was updated" example:"2022-12-01T19:48:55Z"`
+	Created    Time                  `json:"created" note:"Time destination was created" example:"2022-11-10T23:35:22.000Z"`
+	Updated    Time                  `json:"updated" note:"Time destination was updated" example:"2022-12-01T19:48:55.000Z"`
 	Connection DestinationConnection `json:"connection" note:"Object that includes the URL and CA for the destination"`
 
 	Resources []string `json:"resources" note:"Destination specific. For Kubernetes, it is the list of namespaces" example:"['default', 'kube-system']"`
 	Roles     []string `json:"roles" example:"['cluster-admin', 'admin', 'edit', 'view', 'exec', 'logs', 'port-forward']" note:"Destination specific. For Kubernetes, it is the list of cluster roles available on that cluster"`
 
-	LastSeen  Time `json:"lastSeen"`
-	Connected bool `json:"connected" note:"Shows if the destination is currently connected" example:"true"`
+	LastSeenAt Time `json:"lastSeenAt" note:"Time the connector of the destination was last seen"`
+	Connected  bool `json:"connected" note:"Shows if the destination is currently connected" example:"true"`
 
 	Version string `json:"version" note:"Application version of the connector for this destination"`
+
+	UpdateIndex int64 `json:"updateIndex" note:"Changes every time the destination is updated. Used to detect concurrent updates" example:"1052"`
 }
 
 type DestinationConnection struct {
@@ -57,6 +59,8 @@ type CreateDestinationRequest struct {
 
 	Resources []string `json:"resources"`
 	Roles     []string `json:"roles"`
+
+	Metrics *ConnectorMetrics `json:"metrics,omitempty" note:"Metrics reported by the connector"`
 }
 
 func (r CreateDestinationRequest) ValidationRules() []validate.ValidationRule {
@@ -80,6 +84,10 @@ type UpdateDestinationRequest struct {
 
 	Resources []string `json:"resources"`
 	Roles     []string `json:"roles"`
+
+	Metrics *ConnectorMetrics `json:"metrics,omitempty" note:"Metrics reported by the connector"`
+
+	UpdateIndex int64 `json:"updateIndex" note:"When set, the update fails with a 409 if the destination was updated since this index was read" example:"1052"`
 }
 
 func (r UpdateDestinationRequest) ValidationRules() []validate.ValidationRule {
@@ -90,6 +98,44 @@ func (r UpdateDestinationRequest) ValidationRules() []validate.ValidationRule {
 	}
 }
 
+// DestinationLog is a log entry written by a connector.
+type DestinationLog struct {
+	Time  Time   `json:"time" note:"Time the entry was logged by the connector" example:"2022-12-01T19:48:55.000Z"`
+	Level string `json:"level" note:"Log level of the entry" example:"error"`
+	Line  string `json:"line" note:"The log entry as a JSON object"`
+}
+
+type CreateDestinationLogsRequest struct {
+	ID   uid.ID           `uri:"id" json:"-"`
+	Logs []DestinationLog `json:"logs"`
+	// Dropped is the number of log entries the connector did not send because
+	// its buffer was full.
+	Dropped int `json:"dropped"`
+}
+
+func (r CreateDestinationLogsRequest) ValidationRules() []validate.ValidationRule {
+	return []validate.ValidationRule{
+		validate.Required("id", r.ID),
+	}
+}
+
+type ListDestinationLogsRequest struct {
+	ID uid.ID `uri:"id" json:"-"`
+	PaginationRequest
+}
+
+func (r ListDestinationLogsRequest) ValidationRules() []validate.ValidationRule {
+	return []validate.ValidationRule{
+		validate.Required("id", r.ID),
+	}
+}
+
+func (req ListDestinationLogsRequest) SetPage(page int) Paginatable {
+	req.PaginationRequest.Page = page
+
+	return req
+}
+
 func (req ListDestinationsRequest) SetPage(page int) Paginatable {
 	req.PaginationRequest.Page = page
 
@@ -109,3 +155,71 @@ func validateDestinationName(value string) validate.StringRule {
 	}
 	return rule
 }
+
+type DestinationUsageRequest struct {
+	ID   uid.ID `uri:"id" json:"-"`
+	Days int    `form:"days" note:"Number of days of usage to return, ending with the current day. Defaults to 30" example:"30"`
+}
+
+func (r DestinationUsageRequest) ValidationRules() []validate.ValidationRule {
+	return []validate.ValidationRule{
+		validate.Required("id", r.ID),
+		validate.IntRule{Name: "days", Value: r.Days, Min: validate.Int(0), Max: validate.Int(MaxDestinationUsageDays)},
+	}
+}
+
+// MaxDestinationUsageDays is the largest number of days of usage returned by
+// the API.
+const MaxDestinationUsageDays = 366
+
+// DestinationUsage is the daily activity of a destination.
+type DestinationUsage struct {
+	DestinationID uid.ID                `json:"destinationID"`
+	Days          []DestinationUsageDay `json:"days" note:"Usage of each day, from the oldest to the current day. Days without any activity are included"`
+}
+
+type DestinationUsageDay struct {
+	Day           Time  `json:"day" note:"Start of the day, in UTC"`
+	Logins        int64 `json:"logins" note:"Number of times a user was issued a token for the destination"`
+	DistinctUsers int64 `json:"distinctUsers" note:"Number of different users issued a token for the destination"`
+	ProxyRequests int64 `json:"proxyRequests" note:"Number of requests proxied to the destination by the connector"`
+}
+
+// ConnectorMetrics is a snapshot of the metrics of a connector, sent with the
+// periodic registration of its destination. The counts are the totals since
+// the previous snapshot.
+type ConnectorMetrics struct {
+	PeriodSeconds  float64  `json:"periodSeconds" note:"Number of seconds since the previous snapshot" example:"60"`
+	ProxyRequests  int64    `json:"proxyRequests" note:"Number of requests proxied to the destination"`
+	ProxyErrors    int64    `json:"proxyErrors" note:"Number of proxied requests that failed with a 5xx status"`
+	SyncLagSeconds *float64 `json:"syncLagSeconds,omitempty" note:"Seconds since the connector last confirmed its grants were up to date. Not set when the grants were never synced"`
+}
+
+type DestinationMetricsRequest struct {
+	ID uid.ID `uri:"id" json:"-"`
+}
+
+func (r DestinationMetricsRequest) ValidationRules() []validate.ValidationRule {
+	return []validate.ValidationRule{
+		validate.Required("id", r.ID),
+	}
+}
+
+// DestinationMetrics are the metrics most recently reported by the connector
+// of a destination.
+type DestinationMetrics struct {
+	DestinationID uid.ID                     `json:"destinationID"`
+	Stale         bool                       `json:"stale" note:"True when the connector has not reported metrics recently. Latest is the last report that was received"`
+	Latest        *DestinationMetricsReport  `json:"latest" note:"The most recent report, or null when the connector never reported metrics"`
+	History       []DestinationMetricsReport `json:"history" note:"Recent reports, from the oldest to the most recent"`
+}
+
+type DestinationMetricsReport struct {
+	ReportedAt       Time     `json:"reportedAt" note:"Time the report was received"`
+	PeriodSeconds    float64  `json:"periodSeconds" note:"Number of seconds covered by the report" example:"60"`
+	ProxyRequests    int64    `json:"proxyRequests"`
+	ProxyErrors      int64    `json:"proxyErrors"`
+	ProxyRequestRate float64  `json:"proxyRequestRate" note:"Proxied requests per second"`
+	ProxyErrorRate   float64  `json:"proxyErrorRate" note:"Fraction of the proxied requests that failed, from 0 to 1"`
+	SyncLagSeconds   *float64 `json:"syncLagSeconds,omitempty" note:"Seconds since the connector last confirmed its grants were up to date"`
+}
@@ -6,6 +6,10 @@ const (
 	DeviceFlowStatusPending   = "pending"
 	DeviceFlowStatusExpired   = "expired"
 	DeviceFlowStatusConfirmed = "confirmed"
+	DeviceFlowStatusDenied    = "denied"
+	// DeviceFlowStatusSlowDown means the device polled more frequently than the
+	// poll interval. The device should increase its poll interval by 5 seconds.
+	DeviceFlowStatusSlowDown = "slow_down"
 )
 
 type ApproveDeviceFlowRequest struct {
@@ -18,6 +22,16 @@ func (adfr *ApproveDeviceFlowRequest) ValidationRules() []validate.ValidationRul
 	}
 }
 
+type DenyDeviceFlowRequest struct {
+	UserCode string `json:"userCode" example:"BDSD-HQMK"`
+}
+
+func (r *DenyDeviceFlowRequest) ValidationRules() []validate.ValidationRule {
+	return []validate.ValidationRule{
+		validate.String("userCode", r.UserCode, 8, 9, append(validate.DeviceFlowUserCode, validate.CharRange{Low: '-', High: '-'})),
+	}
+}
+
 type DeviceFlowResponse struct {
 	DeviceCode          string `json:"deviceCode" example:"NGU4QWFiNjQ5YmQwNG3YTdmZMEyNzQ3YzQ1YSA" note:"a code that a device will use to exchange for an access key after device login is approved"`
 	VerificationURI     string `json:"verificationURI" example:"https://infrahq.com/device" note:"This is the URL the user needs to enter into their browser to start logging in"`
@@ -37,7 +51,7 @@ func (pdfr *DeviceFlowStatusRequest) ValidationRules() []validate.ValidationRule
 }
 
 type DeviceFlowStatusResponse struct {
-	Status        string         `json:"status,omitempty" note:"can be one of pending, expired, confirmed"`
+	Status        string         `json:"status,omitempty" note:"can be one of pending, slow_down, expired, denied, confirmed"`
 	DeviceCode    string         `json:"deviceCode,omitempty" example:""`
 	LoginResponse *LoginResponse `json:"login,omitempty"`
 }
@@ -1,22 +1,34 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
 )
 
 // Error is used as the response body for failed HTTP requests. It is also
 // the error returned by api.Client methods when the request fails.
 type Error struct {
 	// Code is the HTTP status of the response.
-	Code int32 `json:"code"`
+	Code int32 `json:"code" note:"HTTP status of the response" example:"400"`
+	// ErrorCode identifies the kind of failure. Unlike Message, the value is
+	// stable, so clients should check ErrorCode instead of matching the
+	// Message.
+	ErrorCode ErrorCode `json:"errorCode,omitempty" note:"Identifies the kind of failure. Unlike the message, the value does not change" example:"validation_failed"`
 	// Message contains the full text of the failure as a single string. The
 	// details of the failure may also be available in a structured representation
 	// from one of the other fields on the Error struct.
-	Message string `json:"message"`
+	Message string `json:"message" note:"Description of the failure" example:"validation failed: name: is required"`
 	// FieldErrors contains a structured representation of any validation errors.
-	FieldErrors []FieldError `json:"fieldErrors,omitempty"`
+	FieldErrors []FieldError `json:"fieldErrors,omitempty" note:"Problems with each invalid field of the request"`
+	// Current contains the current state of the resource when the request
+	// failed because the resource was modified by another request. Clients
+	// can use it to merge their changes before trying again.
+	Current json.RawMessage `json:"current,omitempty" note:"Current state of the resource, when the request failed because the resource was modified by another request"`
 }
 
 func (e Error) Error() string {
@@ -26,7 +38,128 @@ func (e Error) Error() string {
 	return e.Message
 }
 
+// Is returns true if target is the sentinel error for the status code of the
+// Error, so that callers can use errors.Is(err, api.ErrNotFound) instead of
+// checking the status code.
+func (e Error) Is(target error) bool {
+	sentinel, ok := errorsByStatus[e.Code]
+	return ok && target == sentinel
+}
+
+// Sentinel errors that match an Error with the same status code when used with
+// errors.Is.
+var (
+	ErrNotModified  = errors.New("not modified")
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrRateLimited  = errors.New("rate limited")
+
+	ErrPreconditionFailed = errors.New("precondition failed")
+)
+
+var errorsByStatus = map[int32]error{
+	http.StatusNotModified:        ErrNotModified,
+	http.StatusBadRequest:         ErrBadRequest,
+	http.StatusUnauthorized:       ErrUnauthorized,
+	http.StatusForbidden:          ErrForbidden,
+	http.StatusNotFound:           ErrNotFound,
+	http.StatusConflict:           ErrConflict,
+	http.StatusPreconditionFailed: ErrPreconditionFailed,
+	http.StatusTooManyRequests:    ErrRateLimited,
+}
+
+// ValidationError is the error returned by Client methods when the request
+// was rejected because one or more fields are invalid. The Error in Err is
+// also available with errors.As.
+type ValidationError struct {
+	Err Error
+}
+
+func (e ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Fields returns the problems with each invalid field, keyed by the name of
+// the field.
+func (e ValidationError) Fields() map[string][]string {
+	fields := make(map[string][]string, len(e.Err.FieldErrors))
+	for _, fe := range e.Err.FieldErrors {
+		fields[fe.FieldName] = append(fields[fe.FieldName], fe.Errors...)
+	}
+	return fields
+}
+
 type FieldError struct {
-	FieldName string   `json:"fieldName"`
-	Errors    []string `json:"errors"`
+	FieldName string `json:"fieldName" example:"name"`
+	// ErrorCode identifies the kind of problem with the field. One of
+	// ErrorCodeRequired, ErrorCodeInvalid, or ErrorCodeAlreadyExists.
+	ErrorCode ErrorCode `json:"errorCode,omitempty" note:"Identifies the kind of problem with the field" example:"required"`
+	Errors    []string  `json:"errors" example:"['is required']"`
+}
+
+// ErrorCode is a machine readable identifier for the kind of an Error, or of
+// a FieldError. New codes may be added, but existing codes will not change.
+type ErrorCode string
+
+// Error codes of Error.
+const (
+	ErrorCodeBadRequest         ErrorCode = "bad_request"
+	ErrorCodeValidationFailed   ErrorCode = "validation_failed"
+	ErrorCodeUnauthorized       ErrorCode = "unauthorized"
+	ErrorCodeForbidden          ErrorCode = "forbidden"
+	ErrorCodeNotFound           ErrorCode = "not_found"
+	ErrorCodeConflict           ErrorCode = "conflict"
+	ErrorCodePreconditionFailed ErrorCode = "precondition_failed"
+	ErrorCodeExpired            ErrorCode = "expired"
+	ErrorCodeRateLimited        ErrorCode = "rate_limited"
+	ErrorCodeAccountLocked      ErrorCode = "account_locked"
+	ErrorCodeRequestTooLarge    ErrorCode = "request_too_large"
+	ErrorCodeCanceled           ErrorCode = "canceled"
+	ErrorCodeTimeout            ErrorCode = "timeout"
+	ErrorCodeUnavailable        ErrorCode = "unavailable"
+	ErrorCodeBadGateway         ErrorCode = "bad_gateway"
+	ErrorCodeInternal           ErrorCode = "internal"
+)
+
+// Error codes of FieldError.
+const (
+	ErrorCodeRequired      ErrorCode = "required"
+	ErrorCodeInvalid       ErrorCode = "invalid"
+	ErrorCodeAlreadyExists ErrorCode = "already_exists"
+)
+
+var errorCodes = []ErrorCode{
+	ErrorCodeBadRequest,
+	ErrorCodeValidationFailed,
+	ErrorCodeUnauthorized,
+	ErrorCodeForbidden,
+	ErrorCodeNotFound,
+	ErrorCodeConflict,
+	ErrorCodePreconditionFailed,
+	ErrorCodeExpired,
+	ErrorCodeRateLimited,
+	ErrorCodeAccountLocked,
+	ErrorCodeRequestTooLarge,
+	ErrorCodeCanceled,
+	ErrorCodeTimeout,
+	ErrorCodeUnavailable,
+	ErrorCodeBadGateway,
+	ErrorCodeInternal,
+	ErrorCodeRequired,
+	ErrorCodeInvalid,
+	ErrorCodeAlreadyExists,
+}
+
+func (ErrorCode) DescribeSchema(schema *openapi3.Schema) {
+	schema.Type = "string"
+	for _, code := range errorCodes {
+		schema.Enum = append(schema.Enum, string(code))
+	}
 }
@@ -0,0 +1,41 @@
+package api
+
+import "strings"
+
+// FieldsRequest restricts the JSON of a response to the requested fields. It
+// is embedded in the request of get and list endpoints that support field
+// selection. For list responses the fields are the fields of each item.
+type FieldsRequest struct {
+	Fields []string `form:"fields" note:"Comma separated list of the fields to include in the response. For list responses these are the fields of each item. All fields are included when empty." example:"id,name"`
+}
+
+// SelectedFields returns the names of the requested fields, or nil when all
+// fields should be included. Each value of Fields may be a comma separated
+// list of names. It is promoted to every request that embeds FieldsRequest, so
+// that the server can select the fields of all of them.
+func (r FieldsRequest) SelectedFields() []string {
+	var fields []string
+	for _, value := range r.Fields {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				fields = append(fields, name)
+			}
+		}
+	}
+	return fields
+}
+
+// IncludesField returns true if the response should include the field with
+// name, either because it was requested, or because no fields were requested.
+func (r FieldsRequest) IncludesField(name string) bool {
+	fields := r.SelectedFields()
+	if len(fields) == 0 {
+		return true
+	}
+	for _, field := range fields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
@@ -42,8 +42,26 @@ type ListGrantsRequest struct {
 	Privilege     string `form:"privilege" example:"view" note:"a role or permission"`
 	ShowInherited bool   `form:"showInherited" note:"if true, this field includes grants that the user inherits through groups" example:"true"`
 	ShowSystem    bool   `form:"showSystem" note:"if true, this shows the connector and other internal grants" example:"false"`
+	Cursor        string `form:"cursor" note:"Use cursor pagination. Use 'start' for the first page, and nextCursor from the previous response for the following pages" example:"start"`
 	BlockingRequest
 	PaginationRequest
+	FieldsRequest
+}
+
+// ListGrantsResponse is the response to a request to list grants.
+type ListGrantsResponse struct {
+	ListResponse[Grant] `json:",inline"`
+	RevokedTokens       []RevokedToken `json:"revokedTokens,omitempty" note:"Tokens for the destination that were revoked before they expired. Only set when listing the grants of a destination"`
+
+	// SignedResponse is set when listing the grants of a destination.
+	SignedResponse `json:"-"`
+}
+
+// RevokedToken identifies a token that a destination must reject, even though
+// it has not expired.
+type RevokedToken struct {
+	ID      string `json:"id" note:"The jti claim of the revoked token" example:"4yJ3n3D8E2"`
+	Expires Time   `json:"expires" note:"The time the token expires. The destination can forget the token after this time"`
 }
 
 func (r ListGrantsRequest) ValidationRules() []validate.ValidationRule {
@@ -59,13 +77,12 @@ func (r ListGrantsRequest) ValidationRules() []validate.ValidationRule {
 			validate.Field{Name: "resource", Value: r.Resource},
 			validate.Field{Name: "destination", Value: r.Destination},
 		),
+		validate.MutuallyExclusive(
+			validate.Field{Name: "cursor", Value: r.Cursor},
+			validate.Field{Name: "page", Value: r.Page},
+		),
 		destNameRule,
-		validate.ValidatorFunc(func() *validate.Failure {
-			if r.ShowInherited && r.User == 0 {
-				return validate.Fail("showInherited", "requires a user ID")
-			}
-			return nil
-		}),
+		validate.RequiredIf("user", r.User, r.ShowInherited),
 		validate.ValidatorFunc(r.validateLastUpdateIndex),
 	}
 }
@@ -165,6 +182,23 @@ func (r GrantRequest) ValidationRules() []validate.ValidationRule {
 	}
 }
 
+// PatchGrantRequest updates only the fields of a grant that are set. A field
+// that is omitted, or null, is not changed.
+type PatchGrantRequest struct {
+	ID        uid.ID  `uri:"id" json:"-"`
+	Privilege *string `json:"privilege,omitempty" example:"view" note:"a role or permission"`
+}
+
+func (r PatchGrantRequest) ValidationRules() []validate.ValidationRule {
+	return []validate.ValidationRule{
+		validate.Required("id", r.ID),
+		// privilege is the only field, so it is required to make a change
+		validate.Required("privilege", r.Privilege),
+		// a field that is set can not be set to an empty value
+		validate.RequiredIf("privilege", valueOf(r.Privilege), r.Privilege != nil),
+	}
+}
+
 type UpdateGrantsRequest struct {
 	GrantsToAdd    []GrantRequest `json:"grantsToAdd" note:"List of grant objects. See POST api/grants for more"`
 	GrantsToRemove []GrantRequest `json:"grantsToRemove" note:"List of grant objects. See POST api/grants for more"`
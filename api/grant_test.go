@@ -0,0 +1,34 @@
+package api
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/validate"
+)
+
+func TestPatchGrantRequest_ValidationRules(t *testing.T) {
+	empty := ""
+	privilege := "view"
+
+	req := PatchGrantRequest{ID: 1234, Privilege: &privilege}
+	assert.NilError(t, validate.Validate(req))
+
+	req = PatchGrantRequest{ID: 1234, Privilege: &empty}
+	err := validate.Validate(req)
+	assert.Error(t, err, "validation failed: privilege: is required")
+}
+
+func TestListGrantsRequest_ValidationRules(t *testing.T) {
+	req := ListGrantsRequest{ShowInherited: true, User: 1234}
+	assert.NilError(t, validate.Validate(req))
+
+	req = ListGrantsRequest{ShowInherited: true, Resource: "example"}
+	err := validate.Validate(req)
+	assert.Error(t, err, "validation failed: user: is required")
+
+	req = ListGrantsRequest{Cursor: "abc", PaginationRequest: PaginationRequest{Page: 2}}
+	err = validate.Validate(req)
+	assert.Error(t, err, "validation failed: only one of (cursor, page) can have a value")
+}
@@ -19,6 +19,7 @@ type ListGroupsRequest struct {
 	// UserID filters the results to only groups where this user is a member.
 	UserID uid.ID `form:"userID" note:"UserID of a user who is a member of the group"`
 	PaginationRequest
+	FieldsRequest
 }
 
 func (r ListGroupsRequest) ValidationRules() []validate.ValidationRule {
@@ -34,6 +35,7 @@ type CreateGroupRequest struct {
 func (r CreateGroupRequest) ValidationRules() []validate.ValidationRule {
 	return []validate.ValidationRule{
 		validate.Required("name", r.Name),
+		validate.StringRule{Name: "name", Value: r.Name, MaxLength: 256},
 	}
 }
 
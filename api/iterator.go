@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"fmt"
+)
+
+// ListIterator iterates over the items of every page of a list endpoint. The
+// next page is requested once the items of the current page have been read.
+//
+//	users := client.Users(ctx, api.ListUsersRequest{})
+//	for users.Next() {
+//		user := users.Item()
+//		...
+//	}
+//	if err := users.Err(); err != nil {
+//		...
+//	}
+type ListIterator[T any] struct {
+	ctx   context.Context
+	list  func(ctx context.Context, page int) (*ListResponse[T], error)
+	page  int
+	last  bool
+	items []T
+	item  T
+	err   error
+}
+
+// NewListIterator returns a ListIterator that calls list to request each page
+// of items, starting from the first page. The page of req is ignored.
+//
+// The pages are requested with withTotal=false, because the total number of
+// items is not needed to iterate over every page.
+func NewListIterator[T any, Req Paginatable](
+	ctx context.Context,
+	list func(context.Context, Req) (*ListResponse[T], error),
+	req Req,
+) *ListIterator[T] {
+	if r, ok := any(&req).(interface{ skipTotal() }); ok {
+		r.skipTotal()
+	}
+	return &ListIterator[T]{
+		ctx: ctx,
+		list: func(ctx context.Context, page int) (*ListResponse[T], error) {
+			req, ok := req.SetPage(page).(Req)
+			if !ok {
+				panic(fmt.Sprintf("SetPage returned a different request type than %T", req))
+			}
+			return list(ctx, req)
+		},
+	}
+}
+
+// Next advances the iterator to the next item, requesting the next page if
+// necessary. It returns false when there are no more items, or when the
+// request for a page failed. Check Err after Next returns false.
+func (it *ListIterator[T]) Next() bool {
+	for len(it.items) == 0 {
+		if it.last || it.err != nil {
+			return false
+		}
+
+		it.page++
+		resp, err := it.list(it.ctx, it.page)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.items = resp.Items
+		switch {
+		case len(resp.Items) == 0:
+			it.last = true
+		case resp.TotalPages < 0:
+			// the total was not counted, a partial page is the last page
+			it.last = len(resp.Items) < resp.Limit
+		default:
+			it.last = it.page >= resp.TotalPages
+		}
+	}
+
+	it.item, it.items = it.items[0], it.items[1:]
+	return true
+}
+
+// Item returns the current item. It must only be called after Next returned
+// true.
+func (it *ListIterator[T]) Item() T {
+	return it.item
+}
+
+// Err returns the error from the request for a page, or nil if all the
+// requests succeeded.
+func (it *ListIterator[T]) Err() error {
+	return it.err
+}
+
+// All returns the remaining items of every page.
+func (it *ListIterator[T]) All() ([]T, error) {
+	items := []T{}
+	for it.Next() {
+		items = append(items, it.Item())
+	}
+	return items, it.Err()
+}
@@ -30,10 +30,29 @@ func (r LoginRequestPasswordCredentials) ValidationRules() []validate.Validation
 	}
 }
 
+// LoginRequestMFA completes a password login for a user enrolled in MFA.
+// Token is the MFAToken from the LoginResponse of the password login.
+type LoginRequestMFA struct {
+	Token        string `json:"token"`
+	Code         string `json:"code" note:"TOTP code from an authenticator app"`
+	RecoveryCode string `json:"recoveryCode" note:"One of the recovery codes, used when the authenticator app is not available"`
+}
+
+func (r LoginRequestMFA) ValidationRules() []validate.ValidationRule {
+	return []validate.ValidationRule{
+		validate.Required("token", r.Token),
+		validate.RequireOneOf(
+			validate.Field{Name: "code", Value: r.Code},
+			validate.Field{Name: "recoveryCode", Value: r.RecoveryCode},
+		),
+	}
+}
+
 type LoginRequest struct {
 	AccessKey           string                           `json:"accessKey"`
 	PasswordCredentials *LoginRequestPasswordCredentials `json:"passwordCredentials"`
 	OIDC                *LoginRequestOIDC                `json:"oidc"`
+	MFA                 *LoginRequestMFA                 `json:"mfa"`
 }
 
 func (r LoginRequest) ValidationRules() []validate.ValidationRule {
@@ -42,6 +61,7 @@ func (r LoginRequest) ValidationRules() []validate.ValidationRule {
 			validate.Field{Name: "accessKey", Value: r.AccessKey},
 			validate.Field{Name: "passwordCredentials", Value: r.PasswordCredentials},
 			validate.Field{Name: "oidc", Value: r.OIDC},
+			validate.Field{Name: "mfa", Value: r.MFA},
 		),
 	}
 }
@@ -53,4 +73,12 @@ type LoginResponse struct {
 	PasswordUpdateRequired bool   `json:"passwordUpdateRequired,omitempty"`
 	Expires                Time   `json:"expires"`
 	OrganizationName       string `json:"organizationName,omitempty"`
+	// MFARequired is true when the user must complete the login with a TOTP
+	// code. AccessKey is empty, and MFAToken must be sent with the code in a
+	// LoginRequestMFA.
+	MFARequired bool   `json:"mfaRequired,omitempty"`
+	MFAToken    string `json:"mfaToken,omitempty"`
+	// MFAEnrollmentRequired is true when the organization requires MFA and the
+	// user has not enrolled. AccessKey can only be used to enroll.
+	MFAEnrollmentRequired bool `json:"mfaEnrollmentRequired,omitempty"`
 }
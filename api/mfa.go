@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/infrahq/infra/internal/validate"
+	"github.com/infrahq/infra/uid"
+)
+
+type EnrollTOTPResponse struct {
+	Secret string `json:"secret" note:"base32 encoded TOTP secret, for authenticator apps that can not scan a QR code"`
+	URI    string `json:"uri" note:"otpauth URI of the secret, usually shown as a QR code" example:"otpauth://totp/Infra:alice@example.com?secret=...&issuer=Infra"`
+}
+
+type ConfirmTOTPRequest struct {
+	Code string `json:"code" note:"TOTP code from the authenticator app"`
+}
+
+func (r ConfirmTOTPRequest) ValidationRules() []validate.ValidationRule {
+	return []validate.ValidationRule{
+		validate.Required("code", r.Code),
+	}
+}
+
+type ConfirmTOTPResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes" note:"One-time codes that can be used to log in when the authenticator app is not available. They are only shown once."`
+}
+
+// StatusCode is 200 OK, because the enrollment was created by EnrollTOTP.
+func (r *ConfirmTOTPResponse) StatusCode() int {
+	return http.StatusOK
+}
+
+type ResetUserMFARequest struct {
+	ID uid.ID `uri:"id" json:"-"`
+}
+
+func (r ResetUserMFARequest) ValidationRules() []validate.ValidationRule {
+	return []validate.ValidationRule{
+		validate.Required("id", r.ID),
+	}
+}
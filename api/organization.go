@@ -1,6 +1,8 @@
 package api
 
 import (
+	"net/http"
+
 	"github.com/infrahq/infra/internal/validate"
 	"github.com/infrahq/infra/uid"
 )
@@ -12,12 +14,27 @@ type Organization struct {
 	Updated        Time     `json:"updated"`
 	Domain         string   `json:"domain"`
 	AllowedDomains []string `json:"allowedDomains" note:"domains which can be used to login to this organization" example:"['example.com', 'infrahq.com']"`
+
+	DomainAlias        string `json:"domainAlias,omitempty" note:"previous domain of the organization which is still accepted" example:"old.infrahq.com"`
+	DomainAliasExpires *Time  `json:"domainAliasExpires,omitempty" note:"time after which the domain alias is no longer accepted"`
 }
 
 type GetOrganizationRequest struct {
 	ID IDOrSelf `uri:"id"`
 }
 
+func (r GetOrganizationRequest) ValidationRules() []validate.ValidationRule {
+	return []validate.ValidationRule{
+		// organizations can not be found by name
+		validate.ValidatorFunc(func() *validate.Failure {
+			if r.ID.Name != "" {
+				return validate.Fail("id", "must be an ID or self")
+			}
+			return nil
+		}),
+	}
+}
+
 type ListOrganizationsRequest struct {
 	Name string `form:"name"`
 	PaginationRequest
@@ -32,6 +49,9 @@ func (r ListOrganizationsRequest) ValidationRules() []validate.ValidationRule {
 type CreateOrganizationRequest struct {
 	Name   string `json:"name"`
 	Domain string `json:"domain"`
+
+	AdminEmail      string `json:"adminEmail" note:"Email of the initial admin user of the organization. When empty no admin user is created" example:"admin@example.com"`
+	AdminInviteLink bool   `json:"adminInviteLink" note:"Return a link to set a password for the admin user instead of a one-time password"`
 }
 
 func (r CreateOrganizationRequest) ValidationRules() []validate.ValidationRule {
@@ -39,10 +59,115 @@ func (r CreateOrganizationRequest) ValidationRules() []validate.ValidationRule {
 		validate.Required("name", r.Name),
 		validate.Required("domain", r.Domain),
 		ValidateName(r.Name),
+		validate.Email("adminEmail", r.AdminEmail),
 	}
 }
 
+type CreateOrganizationResponse struct {
+	Organization
+
+	AdminUser       *CreateUserResponse `json:"adminUser,omitempty" note:"The initial admin user of the organization, only returned when adminEmail was set"`
+	AdminInviteLink string              `json:"adminInviteLink,omitempty" note:"Link the admin user can use to set their password"`
+}
+
 func (req ListOrganizationsRequest) SetPage(page int) Paginatable {
 	req.PaginationRequest.Page = page
 	return req
 }
+
+type UpdateOrganizationRequest struct {
+	ID     uid.ID `uri:"id" json:"-"`
+	Name   string `json:"name" note:"New name of the organization. Unchanged when empty"`
+	Domain string `json:"domain" note:"New domain of the organization. Unchanged when empty" example:"example.infrahq.com"`
+
+	DomainAliasDuration Duration `json:"domainAliasDuration" note:"When the domain changes, continue to accept requests to the previous domain for this duration" example:"168h0m0s"`
+}
+
+func (r UpdateOrganizationRequest) ValidationRules() []validate.ValidationRule {
+	return []validate.ValidationRule{
+		validate.Required("id", r.ID),
+		ValidateName(r.Name),
+		validate.Domain("domain", r.Domain),
+	}
+}
+
+type OrganizationRateLimits struct {
+	RateLimit          int `json:"rateLimit" note:"Requests per minute allowed for the organization. 0 uses the server default" example:"5000"`
+	ConnectorRateLimit int `json:"connectorRateLimit" note:"Requests per minute allowed for the connectors of the organization. 0 uses the server default" example:"20000"`
+}
+
+type UpdateOrganizationRateLimitsRequest struct {
+	ID                 uid.ID `uri:"id" json:"-"`
+	RateLimit          int    `json:"rateLimit" note:"Requests per minute allowed for the organization. 0 uses the server default" example:"5000"`
+	ConnectorRateLimit int    `json:"connectorRateLimit" note:"Requests per minute allowed for the connectors of the organization. 0 uses the server default" example:"20000"`
+}
+
+func (r UpdateOrganizationRateLimitsRequest) ValidationRules() []validate.ValidationRule {
+	return []validate.ValidationRule{
+		validate.Required("id", r.ID),
+		validate.IntRule{Name: "rateLimit", Value: r.RateLimit, Min: validate.Int(0)},
+		validate.IntRule{Name: "connectorRateLimit", Value: r.ConnectorRateLimit, Min: validate.Int(0)},
+	}
+}
+
+type OrganizationStats struct {
+	Users            int64 `json:"users" note:"Number of users, excluding system users"`
+	Groups           int64 `json:"groups"`
+	Grants           int64 `json:"grants"`
+	Destinations     int64 `json:"destinations"`
+	ActiveAccessKeys int64 `json:"activeAccessKeys" note:"Number of access keys that have not expired"`
+}
+
+type DeleteOrganizationRequest struct {
+	ID      uid.ID `uri:"id"`
+	Confirm string `form:"confirm" note:"Must be the domain of the organization, to confirm the deletion" example:"example.infrahq.com"`
+	DryRun  bool   `form:"dryRun" note:"Report the data that would be deleted, without deleting anything"`
+}
+
+func (r DeleteOrganizationRequest) ValidationRules() []validate.ValidationRule {
+	return []validate.ValidationRule{
+		validate.Required("id", r.ID),
+		validate.Required("confirm", r.Confirm),
+	}
+}
+
+type DeleteOrganizationResponse struct {
+	DryRun bool         `json:"dryRun"`
+	Tables []TableCount `json:"tables" note:"Number of rows deleted from each table, or that would be deleted when dryRun is true"`
+}
+
+type TableCount struct {
+	Name  string `json:"name" example:"identities"`
+	Count int64  `json:"count" example:"12"`
+}
+
+func (r *DeleteOrganizationResponse) StatusCode() int {
+	return http.StatusOK
+}
+
+// OrganizationExportVersion is the version of the OrganizationExport document.
+// The version is incremented when a field is removed or changes meaning.
+const OrganizationExportVersion = 1
+
+// OrganizationExport is a logical backup of the data in an organization. It
+// is read from a single consistent snapshot of the database. Secrets, like the
+// client secret of a provider, are never included.
+type OrganizationExport struct {
+	Version              int               `json:"version" note:"Version of the export document" example:"1"`
+	ExportedAt           Time              `json:"exportedAt"`
+	Organization         Organization      `json:"organization"`
+	GrantsMaxUpdateIndex int64             `json:"grantsMaxUpdateIndex" note:"Update index of the most recent change to grants in the snapshot. A restore is consistent as of this index."`
+	Settings             Settings          `json:"settings"`
+	Users                []User            `json:"users"`
+	Groups               []Group           `json:"groups"`
+	Memberships          []GroupMembership `json:"memberships"`
+	Grants               []Grant           `json:"grants"`
+	Providers            []Provider        `json:"providers"`
+	Destinations         []Destination     `json:"destinations"`
+}
+
+// GroupMembership is the membership of a user in a group.
+type GroupMembership struct {
+	GroupID uid.ID `json:"groupID"`
+	UserID  uid.ID `json:"userID"`
+}
@@ -1,6 +1,10 @@
 package api
 
-import "github.com/infrahq/infra/internal/validate"
+import (
+	"strconv"
+
+	"github.com/infrahq/infra/internal/validate"
+)
 
 type Paginatable interface {
 	SetPage(page int) Paginatable
@@ -8,9 +12,14 @@ type Paginatable interface {
 
 type PaginationRequest struct {
 	Page  int `form:"page" note:"Page number to retrieve" example:"1"`
-	Limit int `form:"limit" note:"Number of objects to retrieve per page (up to 1000)" example:"100"`
+	Limit int `form:"limit" note:"Number of objects to retrieve per page (up to 1000, unless the server is configured with a different maximum)" example:"100"`
+	// WithTotal defaults to true when it is nil.
+	WithTotal *bool `form:"withTotal" note:"Set to false to skip counting the total number of objects, which is faster for large lists. totalCount and totalPages are -1 in the response" example:"false"`
 }
 
+// ValidationRules rejects negative values. The maximum limit is configured on
+// the server, and is checked by the server for every request that embeds
+// PaginationRequest.
 func (p PaginationRequest) ValidationRules() []validate.ValidationRule {
 	return []validate.ValidationRule{
 		validate.IntRule{
@@ -22,14 +31,47 @@ func (p PaginationRequest) ValidationRules() []validate.ValidationRule {
 			Name:  "limit",
 			Value: p.Limit,
 			Min:   validate.Int(0),
-			Max:   validate.Int(1000),
 		},
 	}
 }
 
+// PaginationLimit returns the requested limit. It is promoted to every request
+// that embeds PaginationRequest, so that the server can check the limit of all
+// of them.
+func (p PaginationRequest) PaginationLimit() int {
+	return p.Limit
+}
+
+// withTotalQuery returns the query value for WithTotal, or nil when WithTotal
+// is not set so that the parameter is omitted from the request.
+func (p PaginationRequest) withTotalQuery() []string {
+	if p.WithTotal == nil {
+		return nil
+	}
+	return []string{strconv.FormatBool(*p.WithTotal)}
+}
+
+// skipTotal is used by ListIterator to request pages without counting the
+// total number of objects. The iterator detects the last page from the number
+// of items instead.
+func (p *PaginationRequest) skipTotal() {
+	withTotal := false
+	p.WithTotal = &withTotal
+}
+
 type PaginationResponse struct {
 	Page       int `json:"page" note:"Page number retrieved" example:"1"`
 	Limit      int `json:"limit" note:"Number of objects per page" example:"100"`
-	TotalPages int `json:"totalPages" note:"Total number of pages" example:"5"`
-	TotalCount int `json:"totalCount" note:"Total number of objects" example:"485"`
+	TotalPages int `json:"totalPages" note:"Total number of pages. -1 when the request set withTotal=false" example:"5"`
+	TotalCount int `json:"totalCount" note:"Total number of objects. -1 when the request set withTotal=false" example:"485"`
+	// NextCursor is only set when the request used a cursor.
+	NextCursor string `json:"nextCursor,omitempty" note:"Cursor to retrieve the next page of objects. Empty when there are no more objects" example:"NlRqV1RBZ1lZdQ"`
 }
+
+// PaginationCursorStart is the cursor used to retrieve the first page of
+// objects with cursor pagination. The cursors for the following pages are
+// returned in PaginationResponse.NextCursor.
+//
+// Cursor pagination does not count the total number of objects, which makes it
+// faster than page pagination for large lists.
+const PaginationCursorStart = "start"
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"github.com/infrahq/infra/internal/validate"
+	"github.com/infrahq/infra/uid"
+)
+
+// Formats of the authentication report.
+const (
+	ReportFormatJSON = "json"
+	ReportFormatCSV  = "csv"
+)
+
+type AuthenticationReportRequest struct {
+	After  Time   `form:"after" note:"Start of the period of the report. Defaults to 7 days before the end of the period"`
+	Before Time   `form:"before" note:"End of the period of the report. Defaults to the current time"`
+	Format string `form:"format" example:"csv" note:"Format of the response. Defaults to json"`
+}
+
+func (r AuthenticationReportRequest) ValidationRules() []validate.ValidationRule {
+	notBefore := minTime
+	if !r.After.Time().IsZero() {
+		notBefore = r.After.Time()
+	}
+	return []validate.ValidationRule{
+		validate.Date("before", r.Before.Time(), notBefore, maxTime),
+		validate.Enum("format", r.Format, []string{ReportFormatJSON, ReportFormatCSV}),
+	}
+}
+
+// AuthenticationReport summarizes the failed logins, lockouts, and logins from
+// new addresses in a period. It is computed from the audit events, so events
+// that were purged by the retention period are not included.
+type AuthenticationReport struct {
+	After              Time                        `json:"after"`
+	Before             Time                        `json:"before"`
+	FailedLogins       int64                       `json:"failedLogins" note:"Number of failed logins in the period"`
+	FailuresByIdentity []AuthenticationReportEntry `json:"failuresByIdentity" note:"Failed logins for each name used to login, most failures first"`
+	FailuresBySourceIP []AuthenticationReportEntry `json:"failuresBySourceIP" note:"Failed logins from each address, most failures first"`
+	NewSourceIPs       []AuthenticationReportEntry `json:"newSourceIPs" note:"Addresses that a user logged in from for the first time in the period"`
+	Lockouts           []AuthenticationReportEntry `json:"lockouts" note:"Users that were locked out after too many failed logins"`
+}
+
+// AuthenticationReportEntry is one row of a section of an AuthenticationReport.
+// Fields that do not apply to the section are empty.
+type AuthenticationReportEntry struct {
+	UserID     uid.ID `json:"userID,omitempty"`
+	Name       string `json:"name,omitempty" example:"admin@example.com" note:"Name of the user, or the name used to login"`
+	SourceIP   string `json:"sourceIP,omitempty" example:"192.0.2.10"`
+	Count      int64  `json:"count"`
+	Identities int64  `json:"identities,omitempty" note:"Number of different names used to login from the address"`
+	First      Time   `json:"first"`
+	Last       Time   `json:"last"`
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy configures how a Client retries a request that failed with a
+// 429 Too Many Requests, or with a 5xx status that may be temporary.
+//
+// Requests that were rate limited are always safe to retry. Other failures are
+// only retried when the request is idempotent: a GET, HEAD, PUT, or DELETE
+// request, or a request with an Idempotency-Key header.
+type RetryPolicy struct {
+	// MaxRetries is the number of times a request is retried. Zero disables
+	// retries.
+	MaxRetries int
+	// MinBackoff is the delay before the first retry. The delay doubles for
+	// every retry, up to MaxBackoff. Defaults to 500ms.
+	MinBackoff time.Duration
+	// MaxBackoff is the longest delay between retries. Defaults to 10s. A
+	// Retry-After header in the response takes precedence over the backoff,
+	// even when it is longer than MaxBackoff.
+	MaxBackoff time.Duration
+}
+
+const (
+	defaultRetryMinBackoff = 500 * time.Millisecond
+	defaultRetryMaxBackoff = 10 * time.Second
+)
+
+// shouldRetry returns true if the response to req may succeed when req is
+// sent again.
+func (p RetryPolicy) shouldRetry(attempt int, req *http.Request, resp *http.Response) bool {
+	if attempt >= p.MaxRetries {
+		return false
+	}
+	if req.Body != nil && req.GetBody == nil {
+		// the body can not be sent again
+		return false
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return isIdempotent(req)
+	default:
+		return false
+	}
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return req.Header.Get("Idempotency-Key") != ""
+	}
+}
+
+// backoff returns the delay before the next attempt. The delay from the
+// Retry-After header of resp is used when it is set, otherwise the delay is an
+// exponential backoff with jitter.
+func (p RetryPolicy) backoff(attempt int, resp *http.Response) time.Duration {
+	if delay, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+		return delay
+	}
+
+	minBackoff, maxBackoff := p.MinBackoff, p.MaxBackoff
+	if minBackoff <= 0 {
+		minBackoff = defaultRetryMinBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultRetryMaxBackoff
+	}
+
+	delay := minBackoff
+	for i := 0; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	// add up to 25% of jitter, so that clients that failed at the same time
+	// do not all retry at the same time.
+	//nolint:gosec // the jitter does not need to be cryptographically secure
+	return delay + time.Duration(rand.Int63n(int64(delay)/4+1))
+}
+
+// retryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or an HTTP date.
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		delay := time.Until(at)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
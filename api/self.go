@@ -0,0 +1,27 @@
+package api
+
+import "github.com/infrahq/infra/uid"
+
+// The kind of identity in a Self response.
+const (
+	SelfKindUser      = "user"
+	SelfKindConnector = "connector"
+)
+
+// Self describes the identity that made the request, the organization it
+// belongs to, and the session used to make the request.
+type Self struct {
+	Kind              string           `json:"kind" note:"One of user or connector" example:"user"`
+	User              User             `json:"user"`
+	Organization      SelfOrganization `json:"organization"`
+	Privileges        []string         `json:"privileges" note:"Roles granted to the user on the infra resource, directly or from their groups" example:"[admin]"`
+	ProviderID        uid.ID           `json:"providerID" note:"ID of the provider used to log in"`
+	ProviderName      string           `json:"providerName" note:"Name of the provider used to log in" example:"infra"`
+	Expires           Time             `json:"expires" note:"The session is no longer valid after this time"`
+	InactivityTimeout Time             `json:"inactivityTimeout" note:"The session must be used by this time to remain valid"`
+}
+
+type SelfOrganization struct {
+	ID   uid.ID `json:"id" note:"Organization ID" example:"4yJ3n3D8E2"`
+	Name string `json:"name" note:"Name of the organization" example:"acme"`
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"github.com/infrahq/infra/internal/validate"
+	"github.com/infrahq/infra/uid"
+)
+
+// UserSession is an access key issued to a user, with details about the last
+// request that used the key.
+type UserSession struct {
+	ID                uid.ID   `json:"id" note:"ID of the access key"`
+	Name              string   `json:"name" example:"cicdkey" note:"Name of the access key"`
+	Created           Time     `json:"created"`
+	Expires           Time     `json:"expires" note:"key is no longer valid after this time"`
+	InactivityTimeout Time     `json:"inactivityTimeout" note:"key must be used by this time to remain valid"`
+	LastUsed          Time     `json:"lastUsed" note:"time of the last request that used the key"`
+	LastUsedIP        string   `json:"lastUsedIP" example:"192.0.2.10" note:"IP address of the client that last used the key"`
+	LastUsedUserAgent string   `json:"lastUsedUserAgent" example:"Infra CLI/0.20.0" note:"User-Agent of the client that last used the key"`
+	Scopes            []string `json:"scopes" note:"additional access level scopes that control what an access key can do"`
+	ImpersonatedBy    uid.ID   `json:"impersonatedBy,omitempty" note:"ID of the support admin that used this session to act as the user"`
+}
+
+type ListUserSessionsRequest struct {
+	ID uid.ID `uri:"id" json:"-"`
+	PaginationRequest
+}
+
+func (r ListUserSessionsRequest) ValidationRules() []validate.ValidationRule {
+	return []validate.ValidationRule{
+		validate.Required("id", r.ID),
+	}
+}
+
+func (req ListUserSessionsRequest) SetPage(page int) Paginatable {
+	req.PaginationRequest.Page = page
+
+	return req
+}
+
+type DeleteUserSessionsRequest struct {
+	ID     uid.ID   `uri:"id" json:"-"`
+	NotIDs []uid.ID `form:"notIDs" note:"IDs of access keys that are not revoked"`
+}
+
+func (r DeleteUserSessionsRequest) ValidationRules() []validate.ValidationRule {
+	return []validate.ValidationRule{
+		validate.Required("id", r.ID),
+	}
+}
+
+type ImpersonateUserRequest struct {
+	ID         uid.ID `uri:"id" json:"-"`
+	ApprovedBy uid.ID `json:"approvedBy" note:"ID of a second user with the impersonator role, who approved this impersonation. Required to impersonate a user with an admin role"`
+}
+
+func (r ImpersonateUserRequest) ValidationRules() []validate.ValidationRule {
+	return []validate.ValidationRule{
+		validate.Required("id", r.ID),
+	}
+}
+
+type ImpersonateUserResponse struct {
+	ID        uid.ID `json:"id" note:"ID of the access key"`
+	IssuedFor uid.ID `json:"issuedFor" note:"ID of the impersonated user"`
+	Expires   Time   `json:"expires" note:"key is no longer valid after this time"`
+	AccessKey string `json:"accessKey"`
+}
+
+type CreateImpersonationApprovalRequest struct {
+	ID           uid.ID `uri:"id" json:"-"`
+	Impersonator uid.ID `json:"impersonator" note:"ID of the user who may impersonate the user"`
+}
+
+func (r CreateImpersonationApprovalRequest) ValidationRules() []validate.ValidationRule {
+	return []validate.ValidationRule{
+		validate.Required("id", r.ID),
+		validate.Required("impersonator", r.Impersonator),
+	}
+}
+
+// ImpersonationApproval allows a user to impersonate a user with an admin
+// role once, by calling ImpersonateUser with ApprovedBy.
+type ImpersonationApproval struct {
+	ID           uid.ID `json:"id"`
+	User         uid.ID `json:"user" note:"ID of the user who may be impersonated"`
+	Impersonator uid.ID `json:"impersonator" note:"ID of the user who may impersonate the user"`
+	ApprovedBy   uid.ID `json:"approvedBy" note:"ID of the user who approved the impersonation"`
+	Expires      Time   `json:"expires" note:"the approval can not be used after this time"`
+}
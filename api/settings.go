@@ -4,6 +4,14 @@ import "github.com/infrahq/infra/internal/validate"
 
 type Settings struct {
 	PasswordRequirements PasswordRequirements `json:"passwordRequirements"`
+
+	AccessKeyTTL             Duration `json:"accessKeyTTL" note:"Default expiry of new access keys" example:"720h0m0s"`
+	MaxAccessKeyTTL          Duration `json:"maxAccessKeyTTL" note:"Longest expiry allowed for access keys created with the API. When zero any expiry is allowed" example:"2160h0m0s"`
+	SessionInactivityTimeout Duration `json:"sessionInactivityTimeout" note:"Default inactivity timeout of new access keys and login sessions" example:"72h0m0s"`
+	PublicKeyAlgorithms      []string `json:"publicKeyAlgorithms" note:"SSH key types users are allowed to add. When empty all key types are allowed" example:"['ssh-ed25519']"`
+	AllowedSignupDomains     []string `json:"allowedSignupDomains" note:"Email domains that can create a user by logging in with Google. When empty users must be added by an admin" example:"['example.com']"`
+	RequireMFA               bool     `json:"requireMFA" note:"When true users who log in with a password must enroll in TOTP multi-factor authentication"`
+	AuditEventRetention      Duration `json:"auditEventRetention" note:"Period audit events are kept before they are deleted" example:"8760h0m0s"`
 }
 
 type PasswordRequirements struct {
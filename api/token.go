@@ -1,5 +1,9 @@
 package api
 
+type CreateTokenRequest struct {
+	Destination string `json:"destination" note:"Name of the destination the token will be used with. When set, the token is only accepted by that destination" example:"production-cluster"`
+}
+
 type CreateTokenResponse struct {
 	Expires Time   `json:"expires"`
 	Token   string `json:"token"`
@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -26,11 +27,23 @@ func (r Resource) ValidationRules() []validate.ValidationRule {
 	}
 }
 
-// IDOrSelf is a union type that may represent either a uid.ID or the literal
-// string "self".
+// valueOf returns the value p points to, or the zero value when p is nil. It
+// is used to validate the optional fields of patch requests.
+func valueOf[T any](p *T) T {
+	if p == nil {
+		var zero T
+		return zero
+	}
+	return *p
+}
+
+// IDOrSelf is a union type that may represent either a uid.ID, the literal
+// string "self", or a name. A value that is not "self" and is not a valid
+// uid.ID is a name. Not every endpoint that accepts IDOrSelf supports names.
 type IDOrSelf struct {
 	ID     uid.ID
 	IsSelf bool
+	Name   string
 }
 
 func (i *IDOrSelf) UnmarshalText(b []byte) error {
@@ -38,29 +51,45 @@ func (i *IDOrSelf) UnmarshalText(b []byte) error {
 		i.IsSelf = true
 		return nil
 	}
-	var err error
-	i.ID, err = uid.Parse(b)
-	return err
+	id, err := uid.Parse(b)
+	if err != nil {
+		i.Name = string(b)
+		return nil
+	}
+	i.ID = id
+	return nil
 }
 
 func (i IDOrSelf) DescribeSchema(schema *openapi3.Schema) {
 	schema.Type = "string"
-	schema.Format = "uid|self"
-	schema.Pattern = `[1-9a-km-zA-HJ-NP-Z]{1,11}|self`
+	schema.Format = "uid|self|name"
 	schema.Example = "4yJ3n3D8E2"
-	schema.Description = "a uid or the literal self"
+	schema.Description = "a uid, the literal self, or a URL escaped name"
 }
 
 type Time time.Time
 
+// TimePrecision is the precision of every Time sent or received by the API.
+// Times are also stored in the database with this precision, so a time in the
+// response to a create request is the same as the time read back later.
+const TimePrecision = time.Millisecond
+
+// timeLayout is RFC3339 with exactly three digits of fractional seconds.
+const timeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// MarshalJSON formats the time in UTC, truncated to TimePrecision.
 func (t Time) MarshalJSON() ([]byte, error) {
 	if time.Time(t).IsZero() {
 		return []byte("null"), nil
 	}
-	s := time.Time(t).UTC().Format(time.RFC3339)
+	s := time.Time(t).UTC().Truncate(TimePrecision).Format(timeLayout)
 	return []byte(`"` + s + `"`), nil
 }
 
+// UnmarshalJSON accepts an RFC3339 time, with or without fractional seconds,
+// or a unix timestamp in seconds or milliseconds. A unix timestamp may be a
+// number or a string. The time is always converted to UTC, and truncated to
+// TimePrecision.
 func (t *Time) UnmarshalJSON(data []byte) error {
 	if string(data) == "null" {
 		return nil
@@ -69,14 +98,70 @@ func (t *Time) UnmarshalJSON(data []byte) error {
 		return nil
 	}
 	s := strings.Trim(string(data), `"`)
-	tmp, err := time.Parse(time.RFC3339, s)
+	if isUnixTimestamp(s) {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid unix timestamp %q: %w", s, err)
+		}
+		*t = Time(unixTimestamp(n))
+		return nil
+	}
+	tmp, err := time.Parse(time.RFC3339Nano, s)
 	if err != nil {
-		return err
+		return fmt.Errorf("invalid time %q: must be an RFC3339 time or a unix timestamp", s)
 	}
-	*t = Time(tmp.UTC())
+	*t = Time(tmp.UTC().Truncate(TimePrecision))
 	return nil
 }
 
+// UnmarshalText accepts the same formats as UnmarshalJSON, so that a Time
+// can be used as a query parameter.
+func (t *Time) UnmarshalText(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+	return t.UnmarshalJSON(b)
+}
+
+func isUnixTimestamp(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// unixMillisecondsThreshold is the smallest unix timestamp that is read as
+// milliseconds instead of seconds. As seconds it is a time in the year 5138, as
+// milliseconds it is a time in 1973.
+const unixMillisecondsThreshold = 100_000_000_000
+
+func unixTimestamp(n int64) time.Time {
+	if n >= unixMillisecondsThreshold || n <= -unixMillisecondsThreshold {
+		return time.UnixMilli(n).UTC()
+	}
+	return time.Unix(n, 0).UTC()
+}
+
+var (
+	minTime = time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+	maxTime = time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// ValidationRules rejects times before 1970 or after 2100, which are most
+// likely a mistake by the client, like a timestamp in the wrong unit. The
+// rules apply to every Time field of a request.
+func (t Time) ValidationRules() []validate.ValidationRule {
+	return []validate.ValidationRule{
+		validate.Date("", time.Time(t), minTime, maxTime),
+	}
+}
+
 func (t Time) String() string {
 	return time.Time(t).Format(time.RFC3339)
 }
@@ -101,7 +186,7 @@ func (d Duration) MarshalJSON() ([]byte, error) {
 
 func (d *Duration) UnmarshalJSON(data []byte) error {
 	s := strings.Trim(string(data), `"`)
-	dur, err := time.ParseDuration(s)
+	dur, err := ParseDuration(s)
 	if err != nil {
 		return err
 	}
@@ -109,6 +194,45 @@ func (d *Duration) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// ParseDuration parses a duration in the format accepted by
+// time.ParseDuration, with the additional units "d" for days and "w" for
+// weeks. A day is always 24 hours, so 30d is the same as 720h.
+func ParseDuration(s string) (time.Duration, error) {
+	var converted strings.Builder
+	rest := s
+	for {
+		i := strings.IndexAny(rest, "dw")
+		if i < 0 {
+			converted.WriteString(rest)
+			break
+		}
+
+		// find the number before the unit
+		start := i
+		for start > 0 && (rest[start-1] == '.' || '0' <= rest[start-1] && rest[start-1] <= '9') {
+			start--
+		}
+		value, err := strconv.ParseFloat(rest[start:i], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		hours := value * 24
+		if rest[i] == 'w' {
+			hours *= 7
+		}
+
+		converted.WriteString(rest[:start])
+		converted.WriteString(strconv.FormatFloat(hours, 'f', -1, 64) + "h")
+		rest = rest[i+1:]
+	}
+
+	dur, err := time.ParseDuration(converted.String())
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q, must be a number followed by a unit of w, d, h, m, or s", s)
+	}
+	return dur, nil
+}
+
 func (d Duration) String() string {
 	return time.Duration(d).String()
 }
@@ -116,7 +240,7 @@ func (d Duration) String() string {
 func (t Time) DescribeSchema(schema *openapi3.Schema) {
 	schema.Type = "string"
 	schema.Format = "date-time" // date-time is rfc3339
-	schema.Example = time.Date(2022, 3, 14, 9, 48, 0, 0, time.UTC).Format(time.RFC3339)
+	schema.Example = time.Date(2022, 3, 14, 9, 48, 0, 0, time.UTC).Format(timeLayout)
 	if len(schema.Description) == 0 {
 		schema.Description = "formatted as an RFC3339 date-time"
 	}
@@ -127,7 +251,7 @@ func (d Duration) DescribeSchema(schema *openapi3.Schema) {
 	schema.Format = "duration"
 	schema.Example = "72h3m6.5s"
 	if len(schema.Description) == 0 {
-		schema.Description = "a duration of time supporting (h)ours, (m)inutes, and (s)econds"
+		schema.Description = "a duration of time supporting (w)eeks, (d)ays, (h)ours, (m)inutes, and (s)econds"
 	}
 }
 
@@ -168,6 +292,36 @@ func (l *LastUpdateIndex) setValuesFromHeader(header http.Header) error {
 	return nil
 }
 
+// SignedResponse is the signature of a response body. The server signs the
+// responses that a destination uses to update its configuration, so that the
+// destination can verify that they were not modified after they left the
+// server.
+type SignedResponse struct {
+	// Signature is the value of the Infra-Signature response header, a JWS
+	// with a detached payload, signed by a key from /.well-known/jwks.json.
+	// Signature is empty when the response was not signed.
+	Signature string `json:"-"`
+	// Payload is the response body that is verified with Signature.
+	Payload []byte `json:"-"`
+}
+
+// The protected headers of the signature of a SignedResponse. The headers bind
+// the signature to the destination that requested the response, to the update
+// index of the response, and to the time it was signed, so that a signed
+// response can not be sent to a different destination, or replayed later.
+const (
+	SignatureHeaderDestination = "infra-destination"
+	SignatureHeaderUpdateIndex = "infra-update-index"
+	SignatureHeaderIssuedAt    = "iat"
+)
+
+func (s *SignedResponse) setResponseBody(header http.Header, body []byte) {
+	s.Signature = header.Get("Infra-Signature")
+	if s.Signature != "" {
+		s.Payload = body
+	}
+}
+
 // BlockingRequest is used to identify the last update index that was
 // visible to the client. The API endpoint will block until there is a
 // new updated index for the query.
@@ -2,10 +2,14 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"testing"
 	"time"
 
 	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/validate"
+	"github.com/infrahq/infra/uid"
 )
 
 func TestTime_MarshalJSON_RoundTripProperty(t *testing.T) {
@@ -32,7 +36,12 @@ func TestTime_MarshalJSON_RoundTripProperty(t *testing.T) {
 		{
 			name:     "values",
 			input:    `{"T1":"2016-01-02T01:24:21Z","T2":"2016-01-02T01:24:21Z"}`,
-			expected: `{"T1":"2016-01-02T01:24:21Z","T2":"2016-01-02T01:24:21Z"}`,
+			expected: `{"T1":"2016-01-02T01:24:21.000Z","T2":"2016-01-02T01:24:21.000Z"}`,
+		},
+		{
+			name:     "values with fractional seconds",
+			input:    `{"T1":"2016-01-02T01:24:21.123456Z","T2":"2016-01-02T03:24:21.5+02:00"}`,
+			expected: `{"T1":"2016-01-02T01:24:21.123Z","T2":"2016-01-02T01:24:21.500Z"}`,
 		},
 	}
 
@@ -82,27 +91,32 @@ func TestTime_MarshalJSON(t *testing.T) {
 		{
 			name:     "from value",
 			source:   Time(td),
-			expected: `"2020-01-02T03:04:05Z"`,
+			expected: `"2020-01-02T03:04:05.000Z"`,
 		},
 		{
 			name:     "from pointer",
 			source:   (*Time)(&td),
-			expected: `"2020-01-02T03:04:05Z"`,
+			expected: `"2020-01-02T03:04:05.000Z"`,
 		},
 		{
 			name:     "from value in struct",
 			source:   Container{Time: Time(td)},
-			expected: `{"Time":"2020-01-02T03:04:05Z"}`,
+			expected: `{"Time":"2020-01-02T03:04:05.000Z"}`,
 		},
 		{
 			name:     "from value in pointer to struct",
 			source:   &Container{Time: Time(td)},
-			expected: `{"Time":"2020-01-02T03:04:05Z"}`,
+			expected: `{"Time":"2020-01-02T03:04:05.000Z"}`,
 		},
 		{
 			name:     "from pointer in pointer to struct",
 			source:   &PtrContainer{Time: (*Time)(&td)},
-			expected: `{"Time":"2020-01-02T03:04:05Z"}`,
+			expected: `{"Time":"2020-01-02T03:04:05.000Z"}`,
+		},
+		{
+			name:     "truncated to milliseconds",
+			source:   Time(time.Date(2020, 1, 2, 3, 4, 5, 123456789, time.UTC)),
+			expected: `"2020-01-02T03:04:05.123Z"`,
 		},
 		{
 			name:     "nil pointer",
@@ -122,7 +136,154 @@ func TestTime_MarshalJSON(t *testing.T) {
 		{
 			name:     "with non-UTC location",
 			source:   Time(time.Date(2020, 1, 2, 3, 4, 5, 6, time.FixedZone("ET", -5))),
-			expected: `"2020-01-02T03:04:10Z"`,
+			expected: `"2020-01-02T03:04:10.000Z"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
+
+func TestTime_UnmarshalJSON(t *testing.T) {
+	type testCase struct {
+		name     string
+		input    string
+		expected time.Time
+		err      string
+	}
+
+	run := func(t *testing.T, tc testCase) {
+		var actual Time
+		err := json.Unmarshal([]byte(tc.input), &actual)
+		if tc.err != "" {
+			assert.ErrorContains(t, err, tc.err)
+			return
+		}
+		assert.NilError(t, err)
+		assert.Equal(t, actual.Time(), tc.expected)
+		assert.Equal(t, actual.Time().Location(), time.UTC)
+	}
+
+	testCases := []testCase{
+		{
+			name:     "RFC3339",
+			input:    `"2023-01-20T10:11:12Z"`,
+			expected: time.Date(2023, 1, 20, 10, 11, 12, 0, time.UTC),
+		},
+		{
+			name:     "RFC3339 with nanoseconds is truncated to milliseconds",
+			input:    `"2023-01-20T10:11:12.123456789Z"`,
+			expected: time.Date(2023, 1, 20, 10, 11, 12, 123000000, time.UTC),
+		},
+		{
+			name:     "RFC3339 with offset",
+			input:    `"2023-01-20T05:11:12.5-05:00"`,
+			expected: time.Date(2023, 1, 20, 10, 11, 12, 500000000, time.UTC),
+		},
+		{
+			name:     "unix seconds",
+			input:    `1674209472`,
+			expected: time.Date(2023, 1, 20, 10, 11, 12, 0, time.UTC),
+		},
+		{
+			name:     "unix seconds as a string",
+			input:    `"1674209472"`,
+			expected: time.Date(2023, 1, 20, 10, 11, 12, 0, time.UTC),
+		},
+		{
+			name:     "unix milliseconds",
+			input:    `1674209472345`,
+			expected: time.Date(2023, 1, 20, 10, 11, 12, 345000000, time.UTC),
+		},
+		{
+			name:     "unix zero",
+			input:    `0`,
+			expected: time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "unix seconds with a fraction",
+			input: `1674209472.5`,
+			err:   `invalid time "1674209472.5"`,
+		},
+		{
+			name:  "date only",
+			input: `"2023-01-20"`,
+			err:   `invalid time "2023-01-20": must be an RFC3339 time or a unix timestamp`,
+		},
+		{
+			name:  "too large",
+			input: `99999999999999999999`,
+			err:   `invalid unix timestamp "99999999999999999999"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
+
+func TestTime_UnmarshalText(t *testing.T) {
+	var actual Time
+	assert.NilError(t, actual.UnmarshalText([]byte("2023-01-20T10:11:12Z")))
+	assert.Equal(t, actual.Time(), time.Date(2023, 1, 20, 10, 11, 12, 0, time.UTC))
+
+	actual = Time{}
+	assert.NilError(t, actual.UnmarshalText([]byte("1674209472")))
+	assert.Equal(t, actual.Time(), time.Date(2023, 1, 20, 10, 11, 12, 0, time.UTC))
+
+	actual = Time{}
+	assert.NilError(t, actual.UnmarshalText(nil))
+	assert.Assert(t, actual.Time().IsZero())
+
+	err := actual.UnmarshalText([]byte("yesterday"))
+	assert.ErrorContains(t, err, `invalid time "yesterday"`)
+}
+
+func TestTime_ValidationRules(t *testing.T) {
+	type testCase struct {
+		name     string
+		input    string
+		expected validate.Error
+	}
+
+	run := func(t *testing.T, tc testCase) {
+		var req CreateDestinationLogsRequest
+		assert.NilError(t, json.Unmarshal([]byte(tc.input), &req))
+		req.ID = uid.New()
+
+		err := validate.Validate(req)
+		if tc.expected == nil {
+			assert.NilError(t, err)
+			return
+		}
+		var fieldErrs validate.Error
+		assert.Assert(t, errors.As(err, &fieldErrs), err)
+		assert.DeepEqual(t, fieldErrs, tc.expected)
+	}
+
+	testCases := []testCase{
+		{
+			name:  "in range",
+			input: `{"logs": [{"time": 1674209472}, {"time": "2099-12-31T23:59:59Z"}, {}]}`,
+		},
+		{
+			name:  "before 1970",
+			input: `{"logs": [{"time": "1969-12-31T23:59:59Z"}]}`,
+			expected: validate.Error{
+				"logs.time": {"must be after 1970-01-01T00:00:00Z"},
+			},
+		},
+		{
+			name:  "after 2100",
+			input: `{"logs": [{"time": 4102444801}]}`,
+			expected: validate.Error{
+				"logs.time": {"must be before 2100-01-01T00:00:00Z"},
+			},
 		},
 	}
 
@@ -160,6 +321,11 @@ func TestDuration_MarshalJSON_RoundTripProperty(t *testing.T) {
 			input:    `{"D1":"4h0m12s","D2":"4h0m12s"}`,
 			expected: `{"D1":"4h0m12s","D2":"4h0m12s"}`,
 		},
+		{
+			name:     "days and weeks",
+			input:    `{"D1":"30d","D2":"2w"}`,
+			expected: `{"D1":"720h0m0s","D2":"336h0m0s"}`,
+		},
 	}
 
 	for _, test := range tests {
@@ -183,3 +349,49 @@ func TestDuration_MarshalJSON_RoundTripProperty(t *testing.T) {
 		})
 	}
 }
+
+func TestParseDuration(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected time.Duration
+		err      string
+	}{
+		{input: "90m", expected: 90 * time.Minute},
+		{input: "4h0m12s", expected: 4*time.Hour + 12*time.Second},
+		{input: "30d", expected: 30 * 24 * time.Hour},
+		{input: "2w", expected: 14 * 24 * time.Hour},
+		{input: "1w2d12h", expected: 9*24*time.Hour + 12*time.Hour},
+		{input: "1.5d", expected: 36 * time.Hour},
+		{input: "-1d", expected: -24 * time.Hour},
+		{input: "3y", err: `invalid duration "3y", must be a number followed by a unit of w, d, h, m, or s`},
+		{input: "d", err: `invalid duration "d"`},
+		{input: "5", err: `invalid duration "5"`},
+		{input: "", err: `invalid duration ""`},
+	}
+	for _, tc := range testCases {
+		actual, err := ParseDuration(tc.input)
+		if tc.err != "" {
+			assert.ErrorContains(t, err, tc.err, "input: %v", tc.input)
+			continue
+		}
+		assert.NilError(t, err, "input: %v", tc.input)
+		assert.Equal(t, actual, tc.expected, "input: %v", tc.input)
+	}
+}
+
+func TestIDOrSelf_UnmarshalText(t *testing.T) {
+	id := uid.New()
+	testCases := []struct {
+		text     string
+		expected IDOrSelf
+	}{
+		{text: id.String(), expected: IDOrSelf{ID: id}},
+		{text: "self", expected: IDOrSelf{IsSelf: true}},
+		{text: "bob@example.com", expected: IDOrSelf{Name: "bob@example.com"}},
+	}
+	for _, tc := range testCases {
+		var actual IDOrSelf
+		assert.NilError(t, actual.UnmarshalText([]byte(tc.text)))
+		assert.Equal(t, actual, tc.expected, "text: %v", tc.text)
+	}
+}
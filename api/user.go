@@ -1,12 +1,17 @@
 package api
 
 import (
+	"bytes"
+
+	"golang.org/x/crypto/ssh"
+
 	"github.com/infrahq/infra/internal/validate"
 	"github.com/infrahq/infra/uid"
 )
 
 type GetUserRequest struct {
 	ID IDOrSelf `uri:"id"`
+	FieldsRequest
 }
 
 func (r GetUserRequest) ValidationRules() []validate.ValidationRule {
@@ -32,13 +37,20 @@ type ListUsersRequest struct {
 	IDs                  []uid.ID `form:"ids" note:"List of User IDs"`
 	ShowSystem           bool     `form:"showSystem" note:"if true, this shows the connector and other internal users" example:"false"`
 	PublicKeyFingerprint string   `form:"publicKeyFingerprint" note:"Find the user with a public key that matches this SHA256 fingerprint."`
+	Cursor               string   `form:"cursor" note:"Use cursor pagination. Use 'start' for the first page, and nextCursor from the previous response for the following pages" example:"start"`
 	PaginationRequest
+	FieldsRequest
 }
 
 func (r ListUsersRequest) ValidationRules() []validate.ValidationRule {
-	// no-op ValidationRules implementation so that the rules from the
-	// embedded PaginationRequest struct are not applied twice.
-	return nil
+	// the rules from the embedded PaginationRequest struct are applied
+	// separately, so they are not included here.
+	return []validate.ValidationRule{
+		validate.MutuallyExclusive(
+			validate.Field{Name: "cursor", Value: r.Cursor},
+			validate.Field{Name: "page", Value: r.Page},
+		),
+	}
 }
 
 // CreateUserRequest is only for creating users with the Infra provider
@@ -50,6 +62,7 @@ func (r CreateUserRequest) ValidationRules() []validate.ValidationRule {
 	return []validate.ValidationRule{
 		validate.Required("name", r.Name),
 		validate.Email("name", r.Name),
+		validate.StringRule{Name: "name", Value: r.Name, MaxLength: 256},
 	}
 }
 
@@ -72,6 +85,35 @@ func (r UpdateUserRequest) ValidationRules() []validate.ValidationRule {
 	}
 }
 
+// PatchUserRequest updates only the fields of a user that are set. A field
+// that is omitted, or null, is not changed.
+type PatchUserRequest struct {
+	ID           uid.ID  `uri:"id" json:"-"`
+	OldPassword  *string `json:"oldPassword,omitempty" note:"Old password for the user. Only required to change the password when the access key making this request is not owned by an Infra admin" example:"oldpassword"`
+	Password     *string `json:"password,omitempty" note:"New one-time password for the user" example:"newpassword"`
+	SSHLoginName *string `json:"sshLoginName,omitempty" note:"Username for SSH destinations" example:"bob"`
+}
+
+func (r PatchUserRequest) ValidationRules() []validate.ValidationRule {
+	return []validate.ValidationRule{
+		validate.Required("id", r.ID),
+		validate.RequireAnyOf(
+			validate.Field{Name: "password", Value: r.Password},
+			validate.Field{Name: "sshLoginName", Value: r.SSHLoginName},
+		),
+		validate.StringRule{
+			Name:                "sshLoginName",
+			Value:               valueOf(r.SSHLoginName),
+			MaxLength:           31,
+			CharacterRanges:     []validate.CharRange{validate.AlphabetLower, validate.Numbers, validate.Dash, validate.Underscore},
+			FirstCharacterRange: []validate.CharRange{validate.AlphabetLower},
+		},
+		// a field that is set can not be set to an empty value
+		validate.RequiredIf("password", valueOf(r.Password), r.Password != nil),
+		validate.RequiredIf("sshLoginName", valueOf(r.SSHLoginName), r.SSHLoginName != nil),
+	}
+}
+
 func (req ListUsersRequest) SetPage(page int) Paginatable {
 	req.PaginationRequest.Page = page
 
@@ -88,6 +130,23 @@ type AddUserPublicKeyRequest struct {
 func (r AddUserPublicKeyRequest) ValidationRules() []validate.ValidationRule {
 	return []validate.ValidationRule{
 		validate.Required("publicKey", r.PublicKey),
+		// large enough for a 16384 bit RSA key with a comment
+		validate.StringRule{Name: "publicKey", Value: r.PublicKey, MaxLength: 8192},
+		validate.ValidatorFunc(func() *validate.Failure {
+			if r.PublicKey == "" {
+				return nil
+			}
+			_, _, _, rest, err := ssh.ParseAuthorizedKey([]byte(r.PublicKey))
+			switch {
+			case err != nil:
+				// the error text is always the same "ssh: no key found", so we
+				// return a better error message.
+				return validate.Fail("publicKey", "must be in authorized_keys format")
+			case len(bytes.TrimSpace(rest)) > 0:
+				return validate.Fail("publicKey", "must be only a single key")
+			}
+			return nil
+		}),
 		ValidateName(r.Name),
 	}
 }
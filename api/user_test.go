@@ -0,0 +1,25 @@
+package api
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/validate"
+)
+
+func TestPatchUserRequest_ValidationRules(t *testing.T) {
+	empty := ""
+	name := "bob"
+
+	req := PatchUserRequest{ID: 1234, SSHLoginName: &name}
+	assert.NilError(t, validate.Validate(req))
+
+	req = PatchUserRequest{ID: 1234, Password: &empty}
+	err := validate.Validate(req)
+	assert.Error(t, err, "validation failed: password: is required")
+
+	req = PatchUserRequest{ID: 1234, SSHLoginName: &empty}
+	err = validate.Validate(req)
+	assert.Error(t, err, "validation failed: sshLoginName: is required")
+}
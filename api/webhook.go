@@ -0,0 +1,218 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/infrahq/infra/internal/validate"
+	"github.com/infrahq/infra/uid"
+)
+
+// Types of the events sent to webhooks.
+const (
+	WebhookEventUserCreated           = "user.created"
+	WebhookEventUserDeleted           = "user.deleted"
+	WebhookEventGrantCreated          = "grant.created"
+	WebhookEventGrantDeleted          = "grant.deleted"
+	WebhookEventAccessKeyCreated      = "accesskey.created"
+	WebhookEventAccessKeyRevoked      = "accesskey.revoked"
+	WebhookEventDestinationRegistered = "destination.registered"
+)
+
+// WebhookEventTypes are all the types of events sent to webhooks.
+var WebhookEventTypes = []string{
+	WebhookEventUserCreated,
+	WebhookEventUserDeleted,
+	WebhookEventGrantCreated,
+	WebhookEventGrantDeleted,
+	WebhookEventAccessKeyCreated,
+	WebhookEventAccessKeyRevoked,
+	WebhookEventDestinationRegistered,
+}
+
+// Status of a WebhookDelivery.
+const (
+	WebhookDeliveryPending    = "pending"
+	WebhookDeliveryDelivered  = "delivered"
+	WebhookDeliveryDeadLetter = "dead_letter"
+)
+
+type Webhook struct {
+	ID      uid.ID   `json:"id" note:"ID of the webhook"`
+	Created Time     `json:"created"`
+	Updated Time     `json:"updated"`
+	URL     string   `json:"url" note:"URL that receives the events" example:"https://example.com/infra-events"`
+	Events  []string `json:"events" note:"Types of events sent to the webhook. Empty when every type of event is sent" example:"user.created"`
+}
+
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" example:"https://example.com/infra-events"`
+	Secret string   `json:"secret" note:"Secret used to sign the events sent to the webhook"`
+	Events []string `json:"events" note:"Types of events to send to the webhook. Every type of event is sent when empty" example:"user.created"`
+}
+
+func (r CreateWebhookRequest) ValidationRules() []validate.ValidationRule {
+	return []validate.ValidationRule{
+		validate.Required("url", r.URL),
+		validate.ValidatorFunc(func() *validate.Failure {
+			if r.URL == "" {
+				return nil
+			}
+			u, err := url.Parse(r.URL)
+			if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				return validate.Fail("url", "must be an http or https URL")
+			}
+			return nil
+		}),
+		validate.Required("secret", r.Secret),
+		validate.String("secret", r.Secret, 16, 256, nil),
+		validate.ValidatorFunc(func() *validate.Failure {
+			var problems []string
+			for _, event := range r.Events {
+				if !isWebhookEventType(event) {
+					problems = append(problems, fmt.Sprintf("unknown event type %q", event))
+				}
+			}
+			if len(problems) > 0 {
+				problems = append(problems, "must be one of ("+strings.Join(WebhookEventTypes, ", ")+")")
+				return validate.Fail("events", problems...)
+			}
+			return nil
+		}),
+	}
+}
+
+func isWebhookEventType(event string) bool {
+	for _, t := range WebhookEventTypes {
+		if t == event {
+			return true
+		}
+	}
+	return false
+}
+
+type ListWebhooksRequest struct {
+	PaginationRequest
+}
+
+func (req ListWebhooksRequest) SetPage(page int) Paginatable {
+	req.PaginationRequest.Page = page
+	return req
+}
+
+// WebhookDelivery is an event sent, or waiting to be sent, to a webhook.
+type WebhookDelivery struct {
+	ID             uid.ID          `json:"id" note:"ID of the delivery, which is also the ID of the event"`
+	Created        Time            `json:"created"`
+	EventType      string          `json:"eventType" example:"user.created"`
+	Status         string          `json:"status" note:"One of pending, delivered, or dead_letter. A dead_letter delivery failed too many times and will not be sent again" example:"delivered"`
+	Attempts       int             `json:"attempts" note:"Number of times the event was sent" example:"1"`
+	LastAttempt    Time            `json:"lastAttempt,omitempty"`
+	NextAttempt    Time            `json:"nextAttempt,omitempty" note:"Time of the next attempt of a pending delivery"`
+	ResponseStatus int             `json:"responseStatus,omitempty" note:"HTTP status of the response to the last attempt" example:"200"`
+	LastError      string          `json:"lastError,omitempty" note:"Reason the last attempt failed"`
+	Payload        json.RawMessage `json:"payload" note:"The WebhookEvent sent to the webhook"`
+}
+
+type ListWebhookDeliveriesRequest struct {
+	ID     uid.ID `uri:"id" json:"-"`
+	Status string `form:"status" note:"Only list deliveries with this status" example:"dead_letter"`
+	PaginationRequest
+}
+
+func (r ListWebhookDeliveriesRequest) ValidationRules() []validate.ValidationRule {
+	return []validate.ValidationRule{
+		validate.Required("id", r.ID),
+		validate.Enum("status", r.Status,
+			[]string{WebhookDeliveryPending, WebhookDeliveryDelivered, WebhookDeliveryDeadLetter}),
+	}
+}
+
+func (req ListWebhookDeliveriesRequest) SetPage(page int) Paginatable {
+	req.PaginationRequest.Page = page
+	return req
+}
+
+// WebhookEvent is the body of the request sent to a webhook.
+type WebhookEvent struct {
+	// ID of the event. Retries of the event use the same ID, so that a
+	// receiver can ignore events it already processed. The ID is also sent in
+	// the WebhookDeliveryHeader.
+	ID             uid.ID `json:"id"`
+	Type           string `json:"type"`
+	Created        Time   `json:"created"`
+	OrganizationID uid.ID `json:"organizationID"`
+	// Data is the resource the event is about, for example a User for
+	// user.created. The data of user.deleted only includes the id of the user.
+	Data json.RawMessage `json:"data"`
+}
+
+// Request headers sent with every event.
+const (
+	WebhookEventHeader    = "Infra-Webhook-Event"
+	WebhookDeliveryHeader = "Infra-Webhook-Delivery"
+)
+
+// WebhookSignatureHeader is the request header that contains the signature of
+// an event sent to a webhook. The value has the form t=<unix time>,v1=<hex>,
+// where v1 is the HMAC-SHA256 of "<unix time>.<request body>", keyed with the
+// secret of the webhook.
+const WebhookSignatureHeader = "Infra-Webhook-Signature"
+
+// SignWebhookPayload returns the value of the WebhookSignatureHeader for body,
+// signed at time t.
+func SignWebhookPayload(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + webhookSignature(secret, timestamp, body)
+}
+
+func webhookSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+var ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+
+// VerifyWebhookSignature checks that header is a valid signature of body by a
+// webhook with secret. Signatures older than tolerance are rejected, to limit
+// the replay of captured requests. A tolerance of zero accepts any age.
+func VerifyWebhookSignature(secret string, header string, body []byte, tolerance time.Duration) error {
+	var timestamp, signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signature = value
+		}
+	}
+	if timestamp == "" || signature == "" {
+		return fmt.Errorf("%w: missing timestamp or signature", ErrInvalidWebhookSignature)
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid timestamp", ErrInvalidWebhookSignature)
+	}
+	if tolerance > 0 && time.Since(time.Unix(unix, 0)) > tolerance {
+		return fmt.Errorf("%w: signature is too old", ErrInvalidWebhookSignature)
+	}
+
+	expected := webhookSignature(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidWebhookSignature
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/validate"
+)
+
+func TestCreateWebhookRequest_ValidationRules(t *testing.T) {
+	req := CreateWebhookRequest{
+		URL:    "https://example.com/hooks",
+		Secret: "0123456789abcdef",
+		Events: []string{WebhookEventUserCreated},
+	}
+	assert.NilError(t, validate.Validate(req))
+
+	req = CreateWebhookRequest{URL: "ftp://example.com", Secret: "short", Events: []string{"user.renamed"}}
+	err := validate.Validate(req)
+	assert.ErrorContains(t, err, "url: must be an http or https URL")
+	assert.ErrorContains(t, err, "secret: must be at least 16 characters")
+	assert.ErrorContains(t, err, `events: unknown event type "user.renamed"`)
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	secret := "the-secret-of-the-webhook"
+	body := []byte(`{"type":"user.created"}`)
+	now := time.Now()
+	header := SignWebhookPayload(secret, now, body)
+
+	t.Run("valid", func(t *testing.T) {
+		assert.NilError(t, VerifyWebhookSignature(secret, header, body, time.Minute))
+	})
+	t.Run("wrong secret", func(t *testing.T) {
+		err := VerifyWebhookSignature("a-different-secret", header, body, time.Minute)
+		assert.ErrorIs(t, err, ErrInvalidWebhookSignature)
+	})
+	t.Run("modified body", func(t *testing.T) {
+		err := VerifyWebhookSignature(secret, header, []byte(`{"type":"user.deleted"}`), time.Minute)
+		assert.ErrorIs(t, err, ErrInvalidWebhookSignature)
+	})
+	t.Run("too old", func(t *testing.T) {
+		old := SignWebhookPayload(secret, now.Add(-time.Hour), body)
+		err := VerifyWebhookSignature(secret, old, body, time.Minute)
+		assert.ErrorContains(t, err, "signature is too old")
+
+		assert.NilError(t, VerifyWebhookSignature(secret, old, body, 0))
+	})
+	t.Run("malformed header", func(t *testing.T) {
+		err := VerifyWebhookSignature(secret, "v1=abcd", body, time.Minute)
+		assert.ErrorContains(t, err, "missing timestamp or signature")
+	})
+}
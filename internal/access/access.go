@@ -64,13 +64,14 @@ func HandleAuthErr(err error, resource, operation string, roles ...string) error
 	return AuthorizationError{
 		Resource:      resource,
 		Operation:     operation,
-		RequiredRoles: roles,
+		RequiredRoles: expandRoles(roles),
 	}
 }
 
 // IsAuthorized checks if the request has permission to perform the action. The
 // request has permission if the user or one of the groups they belong to
-// has a grant with one of the required roles.
+// has a grant with one of the required roles, or with a role that implies one
+// of the required roles.
 // The resource is always ResourceInfraAPI.
 func IsAuthorized(rCtx RequestContext, requiredRole ...string) error {
 	user := rCtx.Authenticated.User
@@ -80,7 +81,7 @@ func IsAuthorized(rCtx RequestContext, requiredRole ...string) error {
 	grants, err := data.ListGrants(rCtx.DBTxn, data.ListGrantsOptions{
 		Pagination:                 &data.Pagination{Limit: 1},
 		BySubject:                  uid.NewIdentityPolymorphicID(user.ID),
-		ByPrivileges:               requiredRole,
+		ByPrivileges:               expandRoles(requiredRole),
 		ByResource:                 ResourceInfraAPI,
 		IncludeInheritedFromGroups: true,
 	})
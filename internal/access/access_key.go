@@ -1,6 +1,7 @@
 package access
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/gin-gonic/gin"
@@ -35,6 +36,12 @@ func ListAccessKeys(c *gin.Context, identityID uid.ID, name string, showExpired
 func CreateAccessKey(c *gin.Context, accessKey *models.AccessKey) (string, error) {
 	rCtx := GetRequestContext(c)
 
+	if rCtx.Authenticated.Impersonator != nil {
+		// a new key would not expire with the impersonation, or record the
+		// impersonator
+		return "", fmt.Errorf("%w: cannot create access keys from an impersonation session", internal.ErrBadRequest)
+	}
+
 	if rCtx.Authenticated.AccessKey != nil && !rCtx.Authenticated.AccessKey.Scopes.Includes(models.ScopeAllowCreateAccessKey) {
 		if connector := data.InfraConnectorIdentity(rCtx.DBTxn); connector.ID != accessKey.IssuedFor {
 			// non-login access keys can not currently create non-connector access keys.
@@ -55,14 +62,14 @@ func CreateAccessKey(c *gin.Context, accessKey *models.AccessKey) (string, error
 	return body, err
 }
 
-func DeleteAccessKey(rCtx RequestContext, id uid.ID, name string) error {
+func DeleteAccessKey(rCtx RequestContext, id uid.ID, name string) (*models.AccessKey, error) {
 	var key *models.AccessKey
 	var err error
 
 	if id != 0 {
 		key, err = data.GetAccessKey(rCtx.DBTxn, data.GetAccessKeysOptions{ByID: id})
 		if err != nil {
-			return err
+			return nil, err
 		}
 	} else {
 		// if the specific key isn't specified, look up the key by name for the current user
@@ -73,12 +80,12 @@ func DeleteAccessKey(rCtx RequestContext, id uid.ID, name string) error {
 		}
 		keys, err := data.ListAccessKeys(rCtx.DBTxn, opts)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if len(keys) > 0 {
 			key = &keys[0]
 		} else {
-			return fmt.Errorf("%w: no key named '%s' found", internal.ErrNotFound, name)
+			return nil, fmt.Errorf("%w: no key named '%s' found", internal.ErrNotFound, name)
 		}
 	}
 
@@ -86,13 +93,154 @@ func DeleteAccessKey(rCtx RequestContext, id uid.ID, name string) error {
 		// users can delete their own keys
 	} else {
 		if err := IsAuthorized(rCtx, models.InfraAdminRole); err != nil {
-			return HandleAuthErr(err, "access key", "delete", models.InfraAdminRole)
+			return nil, HandleAuthErr(err, "access key", "delete", models.InfraAdminRole)
 		}
 	}
 
 	if rCtx.Authenticated.AccessKey.ID == key.ID {
-		return fmt.Errorf("%w: cannot delete the access key used by this request", internal.ErrBadRequest)
+		return nil, fmt.Errorf("%w: cannot delete the access key used by this request", internal.ErrBadRequest)
+	}
+
+	if err := data.DeleteAccessKeys(rCtx.DBTxn, data.DeleteAccessKeysOptions{ByID: key.ID}); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// DeleteAccessKeys deletes the access keys with ids. It returns the keys that
+// were deleted, and an error for each ID that was not deleted. A key that can
+// not be deleted does not prevent the others from being deleted. Users can
+// delete their own keys, deleting the keys of other users requires the infra
+// admin role.
+func DeleteAccessKeys(rCtx RequestContext, ids []uid.ID) ([]models.AccessKey, map[uid.ID]error, error) {
+	failed := map[uid.ID]error{}
+
+	keys, err := data.ListAccessKeys(rCtx.DBTxn, data.ListAccessKeyOptions{
+		ByIDs:          ids,
+		IncludeExpired: true,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	byID := make(map[uid.ID]models.AccessKey, len(keys))
+	for _, key := range keys {
+		byID[key.ID] = key
+	}
+
+	var authzErr error
+	var authzChecked bool
+	isAdmin := func() error {
+		if !authzChecked {
+			authzErr = IsAuthorized(rCtx, models.InfraAdminRole)
+			authzChecked = true
+		}
+		return authzErr
 	}
 
-	return data.DeleteAccessKeys(rCtx.DBTxn, data.DeleteAccessKeysOptions{ByID: key.ID})
+	var toDelete []models.AccessKey
+	var toDeleteIDs []uid.ID
+	for _, id := range ids {
+		key, ok := byID[id]
+		if !ok {
+			failed[id] = fmt.Errorf("%w: access key not found", internal.ErrNotFound)
+			continue
+		}
+
+		if key.IssuedFor != rCtx.Authenticated.User.ID {
+			if err := isAdmin(); err != nil {
+				err = HandleAuthErr(err, "access key", "delete", models.InfraAdminRole)
+				if !errors.Is(err, ErrNotAuthorized) {
+					return nil, nil, err
+				}
+				failed[id] = err
+				continue
+			}
+		}
+
+		if rCtx.Authenticated.AccessKey.ID == key.ID {
+			failed[id] = fmt.Errorf("%w: cannot delete the access key used by this request", internal.ErrBadRequest)
+			continue
+		}
+		toDelete = append(toDelete, key)
+		toDeleteIDs = append(toDeleteIDs, id)
+	}
+	if len(toDelete) == 0 {
+		return nil, failed, nil
+	}
+
+	if err := data.DeleteAccessKeys(rCtx.DBTxn, data.DeleteAccessKeysOptions{ByIDs: toDeleteIDs}); err != nil {
+		return nil, nil, err
+	}
+	return toDelete, failed, nil
+}
+
+// ListUserSessions returns the unexpired access keys issued to the user, and
+// the keys created by impersonating the user, even after they expire. Users can
+// list their own sessions. Listing the sessions of other users requires the
+// infra user-admin role, because sessions include the IP address of the client
+// that last used each key.
+func ListUserSessions(rCtx RequestContext, userID uid.ID, p *data.Pagination) ([]models.AccessKey, error) {
+	if userID == rCtx.Authenticated.User.ID {
+		// can list own sessions
+	} else if err := IsAuthorized(rCtx, models.InfraUserAdminRole); err != nil {
+		return nil, HandleAuthErr(err, "user sessions", "list", models.InfraUserAdminRole)
+	}
+
+	if _, err := data.GetIdentity(rCtx.DBTxn, data.GetIdentityOptions{ByID: userID}); err != nil {
+		return nil, err
+	}
+
+	opts := data.ListAccessKeyOptions{
+		ByIssuedForID:                userID,
+		IncludeExpiredImpersonations: true,
+		Pagination:                   p,
+	}
+	return data.ListAccessKeys(rCtx.DBTxn, opts)
+}
+
+// DeleteUserSessions deletes the unexpired access keys issued to the user,
+// except for the keys with notIDs and the key used by this request, and revokes
+// the tokens issued to the user for destinations. It returns the keys that
+// were deleted. Requires the infra user-admin role.
+func DeleteUserSessions(rCtx RequestContext, userID uid.ID, notIDs []uid.ID) ([]models.AccessKey, error) {
+	if err := IsAuthorized(rCtx, models.InfraUserAdminRole); err != nil {
+		return nil, HandleAuthErr(err, "user sessions", "delete", models.InfraUserAdminRole)
+	}
+
+	if _, err := data.GetIdentity(rCtx.DBTxn, data.GetIdentityOptions{ByID: userID}); err != nil {
+		return nil, err
+	}
+
+	keys, err := data.ListAccessKeys(rCtx.DBTxn, data.ListAccessKeyOptions{ByIssuedForID: userID})
+	if err != nil {
+		return nil, err
+	}
+
+	keep := make(map[uid.ID]bool, len(notIDs)+1)
+	for _, id := range notIDs {
+		keep[id] = true
+	}
+	if rCtx.Authenticated.AccessKey != nil {
+		keep[rCtx.Authenticated.AccessKey.ID] = true
+	}
+
+	var deleted []models.AccessKey
+	var ids []uid.ID
+	for _, key := range keys {
+		if keep[key.ID] {
+			continue
+		}
+		deleted = append(deleted, key)
+		ids = append(ids, key.ID)
+	}
+
+	if len(ids) > 0 {
+		if err := data.DeleteAccessKeys(rCtx.DBTxn, data.DeleteAccessKeysOptions{ByIDs: ids}); err != nil {
+			return nil, err
+		}
+	}
+	if err := data.RevokeIssuedTokens(rCtx.DBTxn, userID); err != nil {
+		return nil, err
+	}
+	return deleted, nil
 }
@@ -8,6 +8,7 @@ import (
 	"gotest.tools/v3/assert"
 
 	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/data/fixtures"
 	"github.com/infrahq/infra/internal/server/models"
 )
 
@@ -18,12 +19,13 @@ func TestAccessKeys_SelfManagement(t *testing.T) {
 	err := data.CreateOrganization(db, org)
 	assert.NilError(t, err)
 
-	user := &models.Identity{Name: "joe@example.com", OrganizationMember: models.OrganizationMember{OrganizationID: org.ID}}
-	err = data.CreateIdentity(db, user)
-	assert.NilError(t, err)
-
 	c, _ := gin.CreateTestContext(nil)
 	tx := txnForTestCase(t, db).WithOrgID(org.ID)
+
+	created, err := fixtures.User("joe@example.com").Create(tx)
+	assert.NilError(t, err)
+	user := created.Identity
+
 	rCtx := RequestContext{
 		DBTxn:         tx,
 		Authenticated: Authenticated{User: user, Organization: org},
@@ -42,7 +44,7 @@ func TestAccessKeys_SelfManagement(t *testing.T) {
 
 		r := rCtx // shallow copy
 		r.Authenticated.AccessKey = &models.AccessKey{}
-		err = DeleteAccessKey(r, key.ID, "")
+		_, err = DeleteAccessKey(r, key.ID, "")
 		assert.NilError(t, err)
 	})
 
@@ -80,16 +82,12 @@ func TestAccessKeys_AccessKeyAuthn(t *testing.T) {
 	tx := txnForTestCase(t, db).WithOrgID(org.ID)
 
 	t.Run("admin role", func(t *testing.T) {
-		user := &models.Identity{Name: "admin@example.com", OrganizationMember: orgMember}
-		err = data.CreateIdentity(db, user)
-		assert.NilError(t, err)
-
-		err = data.CreateGrant(db, &models.Grant{Subject: user.PolyID(), Privilege: "admin", Resource: "infra", OrganizationMember: orgMember})
-		assert.NilError(t, err)
-
-		key := &models.AccessKey{Name: "admin key", IssuedFor: user.ID, ExpiresAt: time.Now().Add(1 * time.Minute), OrganizationMember: orgMember}
-		_, err = data.CreateAccessKey(db, key)
+		created, err := fixtures.User("admin@example.com").
+			WithGrant("admin", "infra").
+			WithKey(time.Minute).
+			Create(tx)
 		assert.NilError(t, err)
+		user, key := created.Identity, created.Keys[0]
 
 		rCtx := RequestContext{
 			DBTxn:         tx,
@@ -109,9 +107,9 @@ func TestAccessKeys_AccessKeyAuthn(t *testing.T) {
 		})
 
 		t.Run("can create access key for another user", func(t *testing.T) {
-			user := &models.Identity{Name: "bob@example.com", OrganizationMember: orgMember}
-			err = data.CreateIdentity(db, user)
+			created, err := fixtures.User("bob@example.com").Create(tx)
 			assert.NilError(t, err)
+			user := created.Identity
 
 			key := &models.AccessKey{
 				Name:               "b key",
@@ -119,7 +117,7 @@ func TestAccessKeys_AccessKeyAuthn(t *testing.T) {
 				IssuedFor:          user.ID,
 				ExpiresAt:          time.Now().Add(1 * time.Minute),
 			}
-			_, err := CreateAccessKey(c, key)
+			_, err = CreateAccessKey(c, key)
 			assert.ErrorContains(t, err, "cannot use an access key to create other access keys")
 		})
 
@@ -138,13 +136,9 @@ func TestAccessKeys_AccessKeyAuthn(t *testing.T) {
 	})
 
 	t.Run("non admin role", func(t *testing.T) {
-		user := &models.Identity{Name: "user@example.com", OrganizationMember: orgMember}
-		err = data.CreateIdentity(db, user)
-		assert.NilError(t, err)
-
-		key := &models.AccessKey{Name: "user key", IssuedFor: user.ID, ExpiresAt: time.Now().Add(1 * time.Minute), OrganizationMember: orgMember}
-		_, err = data.CreateAccessKey(db, key)
+		created, err := fixtures.User("user@example.com").WithKey(time.Minute).Create(tx)
 		assert.NilError(t, err)
+		user, key := created.Identity, created.Keys[0]
 
 		rCtx := RequestContext{
 			DBTxn:         tx,
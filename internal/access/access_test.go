@@ -21,7 +21,10 @@ import (
 func setupDB(t *testing.T) *data.DB {
 	t.Helper()
 	patch.ModelsSymmetricKey(t)
-	db, err := data.NewDB(data.NewDBOptions{DSN: database.PostgresDriver(t, "_access").DSN})
+	db, err := data.NewDB(data.NewDBOptions{
+		DSN:             database.PostgresDriver(t, "_access").DSN,
+		EnforceOrgScope: true,
+	})
 	assert.NilError(t, err)
 	return db
 }
@@ -1,8 +1,10 @@
 package access
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"time"
 	"unicode"
 
 	"github.com/gin-gonic/gin"
@@ -14,12 +16,16 @@ import (
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
 	"github.com/infrahq/infra/internal/validate"
+	"github.com/infrahq/infra/uid"
 )
 
-func CreateCredential(c *gin.Context, user models.Identity) (string, error) {
-	db, err := RequireInfraRole(c, models.InfraAdminRole)
+// CreateCredential creates a one-time password for the user, which can be used
+// to log in once before expiry. A zero expiry means the password does not
+// expire.
+func CreateCredential(c *gin.Context, user models.Identity, expiry time.Duration) (string, error) {
+	db, err := RequireInfraRole(c, models.InfraUserAdminRole)
 	if err != nil {
-		return "", HandleAuthErr(err, "user", "create", models.InfraAdminRole)
+		return "", HandleAuthErr(err, "user", "create", models.InfraUserAdminRole)
 	}
 
 	tmpPassword, err := generate.CryptoRandom(12, generate.CharsetPassword)
@@ -33,9 +39,10 @@ func CreateCredential(c *gin.Context, user models.Identity) (string, error) {
 	}
 
 	userCredential := &models.Credential{
-		IdentityID:      user.ID,
-		PasswordHash:    hash,
-		OneTimePassword: true,
+		IdentityID:               user.ID,
+		PasswordHash:             hash,
+		OneTimePassword:          true,
+		OneTimePasswordExpiresAt: oneTimePasswordExpiry(expiry),
 	}
 
 	if err := data.CreateCredential(db, userCredential); err != nil {
@@ -50,25 +57,25 @@ func CreateCredential(c *gin.Context, user models.Identity) (string, error) {
 	return tmpPassword, nil
 }
 
-func UpdateCredential(c *gin.Context, user *models.Identity, oldPassword, newPassword string) error {
+// UpdateCredential sets the password of the user. When an admin sets the
+// password of another user it becomes a one-time password that expires after
+// expiry, unless expiry is zero.
+func UpdateCredential(c *gin.Context, user *models.Identity, oldPassword, newPassword string, expiry time.Duration) error {
 	rCtx := GetRequestContext(c)
 	isSelf := isIdentitySelf(rCtx, data.GetIdentityOptions{ByID: user.ID})
 
 	// anyone can update their own credentials, so check authorization when not self
 	if !isSelf {
-		err := IsAuthorized(rCtx, models.InfraAdminRole)
-		if err != nil {
-			return HandleAuthErr(err, "user", "update", models.InfraAdminRole)
+		if err := authorizeManageUser(rCtx, user.ID, "user", "update"); err != nil {
+			return err
 		}
 	}
 
 	// Users have to supply their old password to change their existing password
+	if failure := validate.RequiredIf("oldPassword", oldPassword, isSelf).Validate(); failure != nil {
+		return validate.Error{failure.Name: failure.Problems}
+	}
 	if isSelf {
-		if oldPassword == "" {
-			errs := make(validate.Error)
-			errs["oldPassword"] = append(errs["oldPassword"], "is required")
-			return errs
-		}
 
 		userCredential, err := data.GetCredentialByUserID(rCtx.DBTxn, user.ID)
 		if err != nil {
@@ -79,7 +86,11 @@ func UpdateCredential(c *gin.Context, user *models.Identity, oldPassword, newPas
 		err = bcrypt.CompareHashAndPassword(userCredential.PasswordHash, []byte(oldPassword))
 		if err != nil {
 			// this probably means the password was wrong
-			logging.L.Trace().Err(err).Msg("bcrypt comparison with oldpassword/newpassword failed")
+			var ctx context.Context
+			if rCtx.Request != nil {
+				ctx = rCtx.Request.Context()
+			}
+			logging.FromContext(ctx).Trace().Err(err).Msg("bcrypt comparison with oldpassword/newpassword failed")
 
 			errs := make(validate.Error)
 			errs["oldPassword"] = append(errs["oldPassword"], "invalid oldPassword")
@@ -88,7 +99,7 @@ func UpdateCredential(c *gin.Context, user *models.Identity, oldPassword, newPas
 
 	}
 
-	if err := updateCredential(c, user, newPassword, isSelf); err != nil {
+	if err := updateCredential(c, user, newPassword, isSelf, expiry); err != nil {
 		return err
 	}
 
@@ -101,7 +112,7 @@ func UpdateCredential(c *gin.Context, user *models.Identity, oldPassword, newPas
 	return nil
 }
 
-func updateCredential(c *gin.Context, user *models.Identity, newPassword string, isSelf bool) error {
+func updateCredential(c *gin.Context, user *models.Identity, newPassword string, isSelf bool, expiry time.Duration) error {
 	rCtx := GetRequestContext(c)
 	db := rCtx.DBTxn
 
@@ -119,9 +130,10 @@ func updateCredential(c *gin.Context, user *models.Identity, newPassword string,
 	if err != nil {
 		if errors.Is(err, internal.ErrNotFound) && !isSelf {
 			if err := data.CreateCredential(db, &models.Credential{
-				IdentityID:      user.ID,
-				PasswordHash:    hash,
-				OneTimePassword: true,
+				IdentityID:               user.ID,
+				PasswordHash:             hash,
+				OneTimePassword:          true,
+				OneTimePasswordExpiresAt: oneTimePasswordExpiry(expiry),
 			}); err != nil {
 				return fmt.Errorf("creating credentials: %w", err)
 			}
@@ -132,6 +144,15 @@ func updateCredential(c *gin.Context, user *models.Identity, newPassword string,
 
 	userCredential.PasswordHash = hash
 	userCredential.OneTimePassword = !isSelf
+	userCredential.OneTimePasswordExpiresAt = nil
+	if !isSelf {
+		// a password set by an admin is a new one-time password, which has
+		// its own expiry and number of attempts.
+		userCredential.OneTimePasswordExpiresAt = oneTimePasswordExpiry(expiry)
+		userCredential.FailedLoginAttempts = 0
+		userCredential.LastFailedLoginAt = nil
+		userCredential.LockedUntil = nil
+	}
 
 	if err := data.UpdateCredential(db, userCredential); err != nil {
 		return fmt.Errorf("saving credentials: %w", err)
@@ -149,6 +170,36 @@ func updateCredential(c *gin.Context, user *models.Identity, newPassword string,
 	return nil
 }
 
+// UnlockCredential resets the failed logins of the user, so that an account
+// locked by too many failed logins can be used before the lockout expires.
+// Requires the infra user-admin role.
+func UnlockCredential(c *gin.Context, userID uid.ID) error {
+	db, err := RequireInfraRole(c, models.InfraUserAdminRole)
+	if err != nil {
+		return HandleAuthErr(err, "user", "unlock", models.InfraUserAdminRole)
+	}
+
+	userCredential, err := data.GetCredentialByUserID(db, userID)
+	if err != nil {
+		return err
+	}
+
+	userCredential.FailedLoginAttempts = 0
+	userCredential.LastFailedLoginAt = nil
+	userCredential.LockedUntil = nil
+	return data.UpdateCredentialLoginAttempts(db, userCredential)
+}
+
+// oneTimePasswordExpiry returns the time that a one-time password issued now
+// expires, or nil if expiry is zero.
+func oneTimePasswordExpiry(expiry time.Duration) *time.Time {
+	if expiry == 0 {
+		return nil
+	}
+	expires := time.Now().Add(expiry).UTC()
+	return &expires
+}
+
 func sliceWithoutElement(s []string, without string) []string {
 	result := []string{}
 	for _, v := range s {
@@ -2,13 +2,16 @@ package access
 
 import (
 	"testing"
+	"time"
 	"unicode"
 
 	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/opt"
 
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
 	"github.com/infrahq/infra/internal/validate"
+	"github.com/infrahq/infra/uid"
 )
 
 func TestCreateCredential(t *testing.T) {
@@ -19,12 +22,15 @@ func TestCreateCredential(t *testing.T) {
 	err := data.CreateIdentity(db, user)
 	assert.NilError(t, err)
 
-	oneTimePassword, err := CreateCredential(c, *user)
+	oneTimePassword, err := CreateCredential(c, *user, time.Hour)
 	assert.NilError(t, err)
 	assert.Assert(t, oneTimePassword != "")
 
-	_, err = data.GetCredentialByUserID(db, user.ID)
+	creds, err := data.GetCredentialByUserID(db, user.ID)
 	assert.NilError(t, err)
+	assert.Assert(t, creds.OneTimePassword)
+	assert.Assert(t, creds.OneTimePasswordExpiresAt != nil)
+	assert.DeepEqual(t, *creds.OneTimePasswordExpiresAt, time.Now().Add(time.Hour), opt.TimeWithThreshold(time.Minute))
 }
 
 func TestUpdateCredentials(t *testing.T) {
@@ -36,19 +42,28 @@ func TestUpdateCredentials(t *testing.T) {
 	err := data.CreateIdentity(db, user)
 	assert.NilError(t, err)
 
-	tmpPassword, err := CreateCredential(c, *user)
+	tmpPassword, err := CreateCredential(c, *user, 0)
 	assert.NilError(t, err)
 
 	userCreds, err := data.GetCredentialByUserID(db, user.ID)
 	assert.NilError(t, err)
 
 	t.Run("Update user credentials IS single use password", func(t *testing.T) {
-		err := UpdateCredential(c, user, "", "newPassword")
+		locked := &models.Credential{}
+		*locked = *userCreds
+		locked.FailedLoginAttempts = 5
+		assert.NilError(t, data.UpdateCredentialLoginAttempts(db, locked))
+
+		err := UpdateCredential(c, user, "", "newPassword", 15*time.Minute)
 		assert.NilError(t, err)
 
 		creds, err := data.GetCredentialByUserID(db, user.ID)
 		assert.NilError(t, err)
 		assert.Equal(t, creds.OneTimePassword, true)
+		assert.Assert(t, creds.OneTimePasswordExpiresAt != nil)
+		assert.DeepEqual(t, *creds.OneTimePasswordExpiresAt, time.Now().Add(15*time.Minute), opt.TimeWithThreshold(time.Minute))
+		// the re-issued password gets a new set of attempts
+		assert.Equal(t, creds.FailedLoginAttempts, 0)
 	})
 
 	t.Run("Update own credentials is NOT single use password", func(t *testing.T) {
@@ -59,12 +74,13 @@ func TestUpdateCredentials(t *testing.T) {
 		rCtx.Authenticated.User = user
 		c.Set(RequestContextKey, rCtx)
 
-		err = UpdateCredential(c, user, tmpPassword, "newPassword")
+		err = UpdateCredential(c, user, tmpPassword, "newPassword", 0)
 		assert.NilError(t, err)
 
 		creds, err := data.GetCredentialByUserID(db, user.ID)
 		assert.NilError(t, err)
 		assert.Equal(t, creds.OneTimePassword, false)
+		assert.Assert(t, creds.OneTimePasswordExpiresAt == nil)
 	})
 
 	t.Run("Update own credentials removes password reset scope, but keeps other scopes", func(t *testing.T) {
@@ -87,13 +103,13 @@ func TestUpdateCredentials(t *testing.T) {
 		rCtx.Authenticated.AccessKey = key
 		c.Set(RequestContextKey, rCtx)
 
-		err = UpdateCredential(c, user, "", "newPassword")
+		err = UpdateCredential(c, user, "", "newPassword", 0)
 		assert.ErrorContains(t, err, "oldPassword: is required")
 
-		err = UpdateCredential(c, user, "somePassword", "newPassword")
+		err = UpdateCredential(c, user, "somePassword", "newPassword", 0)
 		assert.ErrorContains(t, err, "oldPassword: invalid oldPassword")
 
-		err = UpdateCredential(c, user, tmpPassword, "newPassword")
+		err = UpdateCredential(c, user, tmpPassword, "newPassword", 0)
 		assert.NilError(t, err)
 
 		creds, err := data.GetCredentialByUserID(db, user.ID)
@@ -106,6 +122,57 @@ func TestUpdateCredentials(t *testing.T) {
 	})
 }
 
+func TestUpdateCredential_UserAdmin(t *testing.T) {
+	c, db, _ := setupAccessTestContext(t)
+
+	helpdesk := &models.Identity{Name: "helpdesk@example.com"}
+	assert.NilError(t, data.CreateIdentity(db, helpdesk))
+	grant := &models.Grant{Subject: helpdesk.PolyID(), Privilege: models.InfraUserAdminRole, Resource: ResourceInfraAPI}
+	assert.NilError(t, data.CreateGrant(db, grant))
+
+	user := &models.Identity{Name: "user@example.com"}
+	assert.NilError(t, data.CreateIdentity(db, user))
+	_, err := CreateCredential(c, *user, 0)
+	assert.NilError(t, err)
+
+	admin := &models.Identity{Name: "other-admin@example.com"}
+	assert.NilError(t, data.CreateIdentity(db, admin))
+	grant = &models.Grant{Subject: admin.PolyID(), Privilege: models.InfraAdminRole, Resource: ResourceInfraAPI}
+	assert.NilError(t, data.CreateGrant(db, grant))
+	_, err = CreateCredential(c, *admin, 0)
+	assert.NilError(t, err)
+
+	rCtx := GetRequestContext(c)
+	rCtx.Authenticated.User = helpdesk
+	c.Set(RequestContextKey, rCtx)
+
+	t.Run("user-admin can reset the password of a user", func(t *testing.T) {
+		err := UpdateCredential(c, user, "", "newPassword", 0)
+		assert.NilError(t, err)
+	})
+
+	t.Run("user-admin can not reset the password of an admin", func(t *testing.T) {
+		err := UpdateCredential(c, admin, "", "newPassword", 0)
+		assert.ErrorIs(t, err, ErrNotAuthorized)
+		assert.ErrorContains(t, err, "requires role admin")
+	})
+
+	t.Run("user-admin can not reset the MFA of an admin", func(t *testing.T) {
+		err := ResetUserMFA(c, admin.ID)
+		assert.ErrorIs(t, err, ErrNotAuthorized)
+	})
+
+	t.Run("user-admin can not delete an admin", func(t *testing.T) {
+		err := DeleteIdentity(c, admin.ID)
+		assert.ErrorIs(t, err, ErrNotAuthorized)
+
+		deleted, failed, err := DeleteIdentities(c, []uid.ID{admin.ID, user.ID})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, deleted, []uid.ID{user.ID})
+		assert.ErrorIs(t, failed[admin.ID], ErrNotAuthorized)
+	})
+}
+
 func TestHasMinimumCount(t *testing.T) {
 	assert.Assert(t, !hasMinimumCount("aB1!", 2, unicode.IsLower))
 	assert.Assert(t, !hasMinimumCount("aB1!", 2, unicode.IsUpper))
@@ -27,6 +27,46 @@ func UpdateDestination(rCtx RequestContext, destination *models.Destination) err
 	return data.UpdateDestination(rCtx.DBTxn, destination)
 }
 
+// UpdateDestinationLastSeenAt saves the LastSeenAt of destination.
+func UpdateDestinationLastSeenAt(rCtx RequestContext, destination *models.Destination) error {
+	roles := []string{models.InfraAdminRole, models.InfraConnectorRole}
+	if err := IsAuthorized(rCtx, roles...); err != nil {
+		return HandleAuthErr(err, "destination", "update", roles...)
+	}
+
+	return data.UpdateDestinationLastSeenAt(rCtx.DBTxn, destination)
+}
+
+// AddDestinationMetricsReport saves a metrics report sent by the connector of
+// the destination, and adds the proxy requests of the report to the daily
+// usage of the destination.
+func AddDestinationMetricsReport(rCtx RequestContext, destinationID uid.ID, report models.DestinationMetricsReport, keep int) error {
+	roles := []string{models.InfraAdminRole, models.InfraConnectorRole}
+	if err := IsAuthorized(rCtx, roles...); err != nil {
+		return HandleAuthErr(err, "destination metrics", "create", roles...)
+	}
+
+	if err := data.AddDestinationMetricsReport(rCtx.DBTxn, destinationID, report, keep); err != nil {
+		return err
+	}
+	if report.ProxyRequests == 0 {
+		return nil
+	}
+	return data.AddDestinationProxyRequests(rCtx.DBTxn, destinationID, report.ReportedAt, report.ProxyRequests)
+}
+
+// UpdateDestinationIfUnmodified is like UpdateDestination, but fails with
+// data.ErrUpdateConflict when the destination was updated after updateIndex
+// was read.
+func UpdateDestinationIfUnmodified(rCtx RequestContext, destination *models.Destination, updateIndex int64) error {
+	roles := []string{models.InfraAdminRole, models.InfraConnectorRole}
+	if err := IsAuthorized(rCtx, roles...); err != nil {
+		return HandleAuthErr(err, "destination", "update", roles...)
+	}
+
+	return data.UpdateDestinationIfUnmodified(rCtx.DBTxn, destination, updateIndex)
+}
+
 func DeleteDestination(c *gin.Context, id uid.ID) error {
 	db, err := RequireInfraRole(c, models.InfraAdminRole)
 	if err != nil {
@@ -17,9 +17,9 @@ import (
 )
 
 func GetGrant(c *gin.Context, id uid.ID) (*models.Grant, error) {
-	db, err := RequireInfraRole(c, models.InfraAdminRole)
+	db, err := RequireInfraRole(c, models.InfraGrantAdminRole)
 	if err != nil {
-		return nil, HandleAuthErr(err, "grant", "get", models.InfraAdminRole)
+		return nil, HandleAuthErr(err, "grant", "get", models.InfraGrantAdminRole)
 	}
 
 	return data.GetGrant(db, data.GetGrantOptions{ByID: id})
@@ -28,35 +28,24 @@ func GetGrant(c *gin.Context, id uid.ID) (*models.Grant, error) {
 type ListGrantsResponse struct {
 	Grants         []models.Grant
 	MaxUpdateIndex int64
+	// RevokedTokens are the revoked tokens accepted by the destination. Only
+	// set when listing all the grants of a destination.
+	RevokedTokens []models.IssuedToken
 }
 
 func ListGrants(c *gin.Context, opts data.ListGrantsOptions, lastUpdateIndex int64) (ListGrantsResponse, error) {
 	rCtx := GetRequestContext(c)
-	subject := opts.BySubject
-
-	roles := []string{models.InfraAdminRole, models.InfraViewRole, models.InfraConnectorRole}
-	_, err := RequireInfraRole(c, roles...)
-	err = HandleAuthErr(err, "grants", "list", roles...)
-	if errors.Is(err, ErrNotAuthorized) {
-		// Allow an authenticated identity to view their own grants
-		subjectID, _ := subject.ID() // zero value will never match a user
-		switch {
-		case rCtx.Authenticated.User == nil:
-			return ListGrantsResponse{}, err
-		case subject.IsIdentity() && rCtx.Authenticated.User.ID == subjectID:
-			// authorized because the request is for their own grants
-		case subject.IsGroup() && userInGroup(rCtx.DBTxn, rCtx.Authenticated.User.ID, subjectID):
-			// authorized because the request is for grants of a group they belong to
-		default:
-			return ListGrantsResponse{}, err
-		}
-	} else if err != nil {
+	if err := authorizeListGrants(c, opts.BySubject); err != nil {
 		return ListGrantsResponse{}, err
 	}
 
 	if lastUpdateIndex == 0 {
 		result, err := data.ListGrants(rCtx.DBTxn, opts)
-		return ListGrantsResponse{Grants: result}, err
+		if err != nil {
+			return ListGrantsResponse{}, err
+		}
+		revoked, err := listRevokedTokens(rCtx.DBTxn, opts)
+		return ListGrantsResponse{Grants: result, RevokedTokens: revoked}, err
 	}
 
 	// Close the request scoped txn to avoid long-running transactions.
@@ -78,7 +67,7 @@ func ListGrants(c *gin.Context, opts data.ListGrantsOptions, lastUpdateIndex int
 		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 		defer cancel()
 		if err := listener.Release(ctx); err != nil {
-			logging.L.Error().Err(err).Msg("failed to release listener conn")
+			logging.FromContext(rCtx.Request.Context()).Error().Err(err).Msg("failed to release listener conn")
 		}
 	}()
 
@@ -111,8 +100,56 @@ func ListGrants(c *gin.Context, opts data.ListGrantsOptions, lastUpdateIndex int
 	return result, nil
 }
 
+// GrantsMaxUpdateIndex returns the maximum update index of all the grants in
+// the organization. When listing all the grants of destination, the update
+// index of tokens revoked for the destination is included. The caller must be
+// authorized to list the grants of subject.
+func GrantsMaxUpdateIndex(c *gin.Context, subject uid.PolymorphicID, destination string) (int64, error) {
+	if err := authorizeListGrants(c, subject); err != nil {
+		return 0, err
+	}
+	rCtx := GetRequestContext(c)
+	maxUpdateIndex, err := data.GrantsMaxUpdateIndex(rCtx.DBTxn, data.GrantsMaxUpdateIndexOptions{})
+	if err != nil || destination == "" || subject != "" {
+		return maxUpdateIndex, err
+	}
+	tokensMaxUpdateIndex, err := data.IssuedTokensMaxUpdateIndex(rCtx.DBTxn, destination)
+	if tokensMaxUpdateIndex > maxUpdateIndex {
+		maxUpdateIndex = tokensMaxUpdateIndex
+	}
+	return maxUpdateIndex, err
+}
+
+func authorizeListGrants(c *gin.Context, subject uid.PolymorphicID) error {
+	rCtx := GetRequestContext(c)
+	roles := []string{models.InfraAdminRole, models.InfraGrantAdminRole, models.InfraViewRole, models.InfraConnectorRole}
+	_, err := RequireInfraRole(c, roles...)
+	err = HandleAuthErr(err, "grants", "list", roles...)
+	if !errors.Is(err, ErrNotAuthorized) {
+		return err
+	}
+
+	// Allow an authenticated identity to view their own grants
+	subjectID, _ := subject.ID() // zero value will never match a user
+	switch {
+	case rCtx.Authenticated.User == nil:
+		return err
+	case subject.IsIdentity() && rCtx.Authenticated.User.ID == subjectID:
+		// authorized because the request is for their own grants
+		return nil
+	case subject.IsGroup() && userInGroup(rCtx.DBTxn, rCtx.Authenticated.User.ID, subjectID):
+		// authorized because the request is for grants of a group they belong to
+		return nil
+	default:
+		return err
+	}
+}
+
 func listGrantsWithMaxUpdateIndex(rCtx RequestContext, opts data.ListGrantsOptions) (ListGrantsResponse, error) {
-	tx, err := rCtx.DataDB.Begin(rCtx.Request.Context(), &sql.TxOptions{
+	// The max update index is compared to notifications from the primary, so
+	// the query must not use a replica.
+	ctx := data.RequirePrimary(rCtx.Request.Context())
+	tx, err := rCtx.DataDB.Begin(ctx, &sql.TxOptions{
 		ReadOnly:  true,
 		Isolation: sql.LevelRepeatableRead,
 	})
@@ -130,7 +167,36 @@ func listGrantsWithMaxUpdateIndex(rCtx RequestContext, opts data.ListGrantsOptio
 	maxUpdateIndex, err := data.GrantsMaxUpdateIndex(tx, data.GrantsMaxUpdateIndexOptions{
 		ByDestination: opts.ByDestination,
 	})
-	return ListGrantsResponse{Grants: result, MaxUpdateIndex: maxUpdateIndex}, err
+	if err != nil {
+		return ListGrantsResponse{}, err
+	}
+
+	revoked, err := listRevokedTokens(tx, opts)
+	if err != nil {
+		return ListGrantsResponse{}, err
+	}
+	if opts.ByDestination != "" {
+		// revoking a token changes the response, so the update index of
+		// revoked tokens is included in the max
+		tokensMaxUpdateIndex, err := data.IssuedTokensMaxUpdateIndex(tx, opts.ByDestination)
+		if err != nil {
+			return ListGrantsResponse{}, err
+		}
+		if tokensMaxUpdateIndex > maxUpdateIndex {
+			maxUpdateIndex = tokensMaxUpdateIndex
+		}
+	}
+	return ListGrantsResponse{Grants: result, MaxUpdateIndex: maxUpdateIndex, RevokedTokens: revoked}, nil
+}
+
+// listRevokedTokens returns the revoked tokens for a request that lists all
+// the grants of a destination, which is how connectors learn about tokens
+// they must reject.
+func listRevokedTokens(tx data.ReadTxn, opts data.ListGrantsOptions) ([]models.IssuedToken, error) {
+	if opts.ByDestination == "" || opts.BySubject != "" {
+		return nil, nil
+	}
+	return data.ListRevokedTokens(tx, opts.ByDestination)
 }
 
 func logError(fn func() error, msg string) {
@@ -164,17 +230,127 @@ func CreateGrant(c *gin.Context, grant *models.Grant) error {
 	// TODO: CreatedBy should be set automatically
 	grant.CreatedBy = rCtx.Authenticated.User.ID
 
-	return data.CreateGrant(rCtx.DBTxn, grant)
+	ctx := rCtx.Request.Context()
+	return data.RetryTxn(ctx, rCtx.DataDB, rCtx.DBTxn.OrganizationID(), func(tx *data.Transaction) error {
+		return data.CreateGrant(tx, grant)
+	})
 }
 
-func DeleteGrant(c *gin.Context, id uid.ID) error {
+func DeleteGrant(c *gin.Context, grant *models.Grant) error {
+	role := requiredInfraRoleForGrantOperation(grant)
 	// TODO: should support-admin role be required to delete support-admin grant?
-	db, err := RequireInfraRole(c, models.InfraAdminRole)
+	if role == models.InfraSupportAdminRole {
+		role = models.InfraAdminRole
+	}
+	db, err := RequireInfraRole(c, role)
 	if err != nil {
-		return HandleAuthErr(err, "grant", "delete", models.InfraAdminRole)
+		return HandleAuthErr(err, "grant", "delete", role)
 	}
 
-	return data.DeleteGrants(db, data.DeleteGrantsOptions{ByID: id})
+	return data.DeleteGrants(db, data.DeleteGrantsOptions{ByID: grant.ID})
+}
+
+// DeleteGrants deletes the grants with ids. It returns the grants that were
+// deleted, and an error for each ID that was not deleted. A grant that can not
+// be deleted does not prevent the others from being deleted. The last grant of
+// the infra admin role is never deleted.
+func DeleteGrants(c *gin.Context, ids []uid.ID) ([]models.Grant, map[uid.ID]error, error) {
+	rCtx := GetRequestContext(c)
+	failed := map[uid.ID]error{}
+
+	db, err := RequireInfraRole(c, models.InfraGrantAdminRole)
+	if err != nil {
+		err = HandleAuthErr(err, "grant", "delete", models.InfraGrantAdminRole)
+		if !errors.Is(err, ErrNotAuthorized) {
+			return nil, nil, err
+		}
+		for _, id := range ids {
+			failed[id] = err
+		}
+		return nil, failed, nil
+	}
+
+	grants, err := data.ListGrants(db, data.ListGrantsOptions{ByIDs: ids})
+	if err != nil {
+		return nil, nil, err
+	}
+	byID := make(map[uid.ID]models.Grant, len(grants))
+	for _, grant := range grants {
+		byID[grant.ID] = grant
+	}
+
+	infraAdminGrants, err := data.ListGrants(db, data.ListGrantsOptions{
+		ByResource:   ResourceInfraAPI,
+		ByPrivileges: []string{models.InfraAdminRole},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	remainingInfraAdmins := len(infraAdminGrants)
+
+	var toDelete []models.Grant
+	var toDeleteIDs []uid.ID
+	for _, id := range ids {
+		grant, ok := byID[id]
+		if !ok {
+			failed[id] = fmt.Errorf("%w: grant not found", internal.ErrNotFound)
+			continue
+		}
+
+		role := requiredInfraRoleForGrantOperation(&grant)
+		if role != models.InfraGrantAdminRole {
+			if err := IsAuthorized(rCtx, role); err != nil {
+				err = HandleAuthErr(err, "grant", "delete", role)
+				if !errors.Is(err, ErrNotAuthorized) {
+					return nil, nil, err
+				}
+				failed[id] = err
+				continue
+			}
+		}
+
+		if grant.Resource == ResourceInfraAPI && grant.Privilege == models.InfraAdminRole {
+			if remainingInfraAdmins == 1 {
+				failed[id] = fmt.Errorf("%w: cannot remove the last infra admin", internal.ErrBadRequest)
+				continue
+			}
+			remainingInfraAdmins--
+		}
+		toDelete = append(toDelete, grant)
+		toDeleteIDs = append(toDeleteIDs, id)
+	}
+	if len(toDelete) == 0 {
+		return nil, failed, nil
+	}
+
+	if err := data.DeleteGrants(db, data.DeleteGrantsOptions{ByIDs: toDeleteIDs}); err != nil {
+		return nil, nil, err
+	}
+	return toDelete, failed, nil
+}
+
+// UpdateGrant changes the privilege of current to the privilege of updated.
+func UpdateGrant(c *gin.Context, current, updated *models.Grant) error {
+	role := requiredInfraRoleForGrantOperation(current, updated)
+	db, err := RequireInfraRole(c, role)
+	if err != nil {
+		return HandleAuthErr(err, "grant", "update", role)
+	}
+
+	return data.UpdateGrant(db, updated)
+}
+
+// UpdateGrantIfUnmodified is like UpdateGrant, but fails with
+// data.ErrUpdateConflict when the grant was updated after updateIndex was
+// read.
+func UpdateGrantIfUnmodified(c *gin.Context, current, updated *models.Grant, updateIndex int64) error {
+	role := requiredInfraRoleForGrantOperation(current, updated)
+	db, err := RequireInfraRole(c, role)
+	if err != nil {
+		return HandleAuthErr(err, "grant", "update", role)
+	}
+
+	return data.UpdateGrantIfUnmodified(db, updated, updateIndex)
 }
 
 func UpdateGrants(c *gin.Context, addGrants, rmGrants []*models.Grant) error {
@@ -190,11 +366,21 @@ func UpdateGrants(c *gin.Context, addGrants, rmGrants []*models.Grant) error {
 	return data.UpdateGrants(db, addGrants, rmGrants)
 }
 
+// requiredInfraRoleForGrantOperation returns the role required to create,
+// update, or delete grants. Grants on the infra resource require the admin
+// role, so that a grant admin can not give themselves more privileges. Grants
+// of the support-admin and impersonator roles require the support-admin role.
 func requiredInfraRoleForGrantOperation(grants ...*models.Grant) string {
+	role := models.InfraGrantAdminRole
 	for _, grant := range grants {
-		if grant.Privilege == models.InfraSupportAdminRole && grant.Resource == ResourceInfraAPI {
+		if grant.Resource != ResourceInfraAPI {
+			continue
+		}
+		switch grant.Privilege {
+		case models.InfraSupportAdminRole, models.InfraImpersonatorRole:
 			return models.InfraSupportAdminRole
 		}
+		role = models.InfraAdminRole
 	}
-	return models.InfraAdminRole
+	return role
 }
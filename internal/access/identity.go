@@ -11,6 +11,7 @@ import (
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
 	"github.com/infrahq/infra/internal/server/providers"
+	"github.com/infrahq/infra/internal/validate"
 	"github.com/infrahq/infra/uid"
 )
 
@@ -36,7 +37,7 @@ func GetIdentity(c *gin.Context, opts data.GetIdentityOptions) (*models.Identity
 	rCtx := GetRequestContext(c)
 	// anyone can get their own user data
 	if !isIdentitySelf(rCtx, opts) {
-		roles := []string{models.InfraAdminRole, models.InfraViewRole, models.InfraConnectorRole}
+		roles := []string{models.InfraAdminRole, models.InfraUserAdminRole, models.InfraViewRole, models.InfraConnectorRole}
 		err := IsAuthorized(rCtx, roles...)
 		if err != nil {
 			return nil, HandleAuthErr(err, "user", "get", roles...)
@@ -46,28 +47,57 @@ func GetIdentity(c *gin.Context, opts data.GetIdentityOptions) (*models.Identity
 	return data.GetIdentity(rCtx.DBTxn, opts)
 }
 
+// GetIdentityByName returns the identity with opts.ByName, using the same
+// authorization checks as GetIdentity. An identity the caller is not authorized
+// to see is reported as not found, so that the error can not be used to discover
+// the names of other users.
+func GetIdentityByName(c *gin.Context, opts data.GetIdentityOptions) (*models.Identity, error) {
+	identity, err := GetIdentity(c, opts)
+	var authErr AuthorizationError
+	if errors.As(err, &authErr) {
+		return nil, fmt.Errorf("%w: user", internal.ErrNotFound)
+	}
+	return identity, err
+}
+
 func CreateIdentity(c *gin.Context, identity *models.Identity) error {
-	db, err := RequireInfraRole(c, models.InfraAdminRole)
+	db, err := RequireInfraRole(c, models.InfraUserAdminRole)
 	if err != nil {
-		return HandleAuthErr(err, "user", "create", models.InfraAdminRole)
+		return HandleAuthErr(err, "user", "create", models.InfraUserAdminRole)
 	}
 
 	return data.CreateIdentity(db, identity)
 }
 
+// UpdateIdentity saves the SSH login name of identity.
+func UpdateIdentity(c *gin.Context, identity *models.Identity) error {
+	db, err := RequireInfraRole(c, models.InfraUserAdminRole)
+	if err != nil {
+		return HandleAuthErr(err, "user", "update", models.InfraUserAdminRole)
+	}
+
+	if data.IsReservedUsername(identity.SSHLoginName) {
+		return validate.Error{"sshLoginName": {"is reserved and can not be used"}}
+	}
+
+	return data.UpdateIdentity(db, identity)
+}
+
 func DeleteIdentity(c *gin.Context, id uid.ID) error {
 	rCtx := GetRequestContext(c)
 	if isIdentitySelf(rCtx, data.GetIdentityOptions{ByID: id}) {
 		return fmt.Errorf("cannot delete self: %w", internal.ErrBadRequest)
 	}
 
-	if data.InfraConnectorIdentity(rCtx.DBTxn).ID == id {
-		return fmt.Errorf("%w: the connector user can not be deleted", internal.ErrBadRequest)
+	// authorize before looking at the user, so that only admins can see
+	// whether it exists
+	if err := authorizeManageUser(rCtx, id, "user", "delete"); err != nil {
+		return err
 	}
+	db := rCtx.DBTxn
 
-	db, err := RequireInfraRole(c, models.InfraAdminRole)
-	if err != nil {
-		return HandleAuthErr(err, "user", "delete", models.InfraAdminRole)
+	if data.InfraConnectorIdentity(db).ID == id {
+		return fmt.Errorf("%w: the connector user can not be deleted", internal.ErrBadRequest)
 	}
 
 	opts := data.DeleteIdentitiesOptions{
@@ -77,8 +107,71 @@ func DeleteIdentity(c *gin.Context, id uid.ID) error {
 	return data.DeleteIdentities(db, opts)
 }
 
+// DeleteIdentities deletes the users with ids. It returns the IDs of the users
+// that were deleted, and an error for each ID that was not deleted. A user
+// that can not be deleted does not prevent the others from being deleted.
+func DeleteIdentities(c *gin.Context, ids []uid.ID) ([]uid.ID, map[uid.ID]error, error) {
+	rCtx := GetRequestContext(c)
+	failed := map[uid.ID]error{}
+
+	db, err := RequireInfraRole(c, models.InfraUserAdminRole)
+	if err != nil {
+		err = HandleAuthErr(err, "user", "delete", models.InfraUserAdminRole)
+		if !errors.Is(err, ErrNotAuthorized) {
+			return nil, nil, err
+		}
+		for _, id := range ids {
+			failed[id] = err
+		}
+		return nil, failed, nil
+	}
+
+	identities, err := data.ListIdentities(db, data.ListIdentityOptions{ByIDs: ids})
+	if err != nil {
+		return nil, nil, err
+	}
+	found := make(map[uid.ID]bool, len(identities))
+	for _, identity := range identities {
+		found[identity.ID] = true
+	}
+
+	connectorID := data.InfraConnectorIdentity(db).ID
+	var toDelete []uid.ID
+	for _, id := range ids {
+		switch {
+		case !found[id]:
+			failed[id] = fmt.Errorf("%w: user not found", internal.ErrNotFound)
+		case isIdentitySelf(rCtx, data.GetIdentityOptions{ByID: id}):
+			failed[id] = fmt.Errorf("cannot delete self: %w", internal.ErrBadRequest)
+		case id == connectorID:
+			failed[id] = fmt.Errorf("%w: the connector user can not be deleted", internal.ErrBadRequest)
+		default:
+			if err := authorizeManageUser(rCtx, id, "user", "delete"); err != nil {
+				if !errors.Is(err, ErrNotAuthorized) {
+					return nil, nil, err
+				}
+				failed[id] = err
+				continue
+			}
+			toDelete = append(toDelete, id)
+		}
+	}
+	if len(toDelete) == 0 {
+		return nil, failed, nil
+	}
+
+	opts := data.DeleteIdentitiesOptions{
+		ByProviderID: data.InfraProvider(db).ID,
+		ByIDs:        toDelete,
+	}
+	if err := data.DeleteIdentities(db, opts); err != nil {
+		return nil, nil, err
+	}
+	return toDelete, failed, nil
+}
+
 func ListIdentities(c *gin.Context, opts data.ListIdentityOptions) ([]models.Identity, error) {
-	roles := []string{models.InfraAdminRole, models.InfraViewRole, models.InfraConnectorRole}
+	roles := []string{models.InfraAdminRole, models.InfraUserAdminRole, models.InfraViewRole, models.InfraConnectorRole}
 	db, err := RequireInfraRole(c, roles...)
 	if err != nil {
 		return nil, HandleAuthErr(err, "users", "list", roles...)
@@ -107,11 +200,11 @@ func UpdateIdentityInfoFromProvider(c RequestContext, provider *models.Provider,
 		}
 
 		if nestedErr := data.DeleteAccessKeys(db, data.DeleteAccessKeysOptions{ByIssuedForID: identity.ID, ByProviderID: provider.ID}); nestedErr != nil {
-			logging.Errorf("failed to revoke invalid user session: %s", nestedErr)
+			logging.FromContext(ctx).Error().Err(nestedErr).Msg("failed to revoke invalid user session")
 		}
 
 		if nestedErr := data.DeleteProviderUsers(db, data.DeleteProviderUsersOptions{ByIdentityID: identity.ID, ByProviderID: provider.ID}); nestedErr != nil {
-			logging.Errorf("failed to delete provider user: %s", nestedErr)
+			logging.FromContext(ctx).Error().Err(nestedErr).Msg("failed to delete provider user")
 		}
 
 		return fmt.Errorf("sync user: %w", err)
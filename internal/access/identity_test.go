@@ -10,28 +10,20 @@ import (
 	"gotest.tools/v3/assert"
 
 	"github.com/infrahq/infra/internal"
-	"github.com/infrahq/infra/internal/generate"
 	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/data/fixtures"
 	"github.com/infrahq/infra/internal/server/models"
 	"github.com/infrahq/infra/internal/server/providers"
-	"github.com/infrahq/infra/uid"
 )
 
 func TestListIdentities(t *testing.T) {
 	// create the identity
-	c, db, infraProvider := setupAccessTestContext(t)
-
-	activeIdentity := &models.Identity{Name: "active-list-hide-id"}
+	c, db, _ := setupAccessTestContext(t)
 
-	err := data.CreateIdentity(db, activeIdentity)
+	_, err := fixtures.User("active-list-hide-id").InInfraProvider().Create(db)
 	assert.NilError(t, err)
 
-	_, err = data.CreateProviderUser(db, infraProvider, activeIdentity)
-	assert.NilError(t, err)
-
-	unlinkedIdentity := &models.Identity{Name: "unlinked-list-hide-id"}
-
-	err = data.CreateIdentity(db, unlinkedIdentity)
+	_, err = fixtures.User("unlinked-list-hide-id").Create(db)
 	assert.NilError(t, err)
 
 	// test fetch all identities
@@ -53,19 +45,16 @@ func TestDeleteIdentityCleansUpResources(t *testing.T) {
 	// create the identity
 	c, db, infraProvider := setupAccessTestContext(t)
 
-	identity := &models.Identity{Name: "to-be-deleted"}
-
-	err := data.CreateIdentity(db, identity)
-	assert.NilError(t, err)
-
-	_, err = data.CreateProviderUser(db, infraProvider, identity)
-	assert.NilError(t, err)
-
-	// create some resources for this identity
-
-	keyID := generate.MathRandom(models.AccessKeyKeyLength, generate.CharsetAlphaNumeric)
-	_, err = data.CreateAccessKey(db, &models.AccessKey{KeyID: keyID, IssuedFor: identity.ID, ProviderID: infraProvider.ID})
+	created, err := fixtures.User("to-be-deleted").
+		InInfraProvider().
+		InGroup("Group").
+		WithGrant("admin", "infra").
+		WithGrant("cluster-admin", "example").
+		WithKey(time.Hour).
+		Create(db)
 	assert.NilError(t, err)
+	identity := created.Identity
+	keyID := created.Keys[0].KeyID
 
 	creds := &models.Credential{
 		IdentityID:   identity.ID,
@@ -74,26 +63,7 @@ func TestDeleteIdentityCleansUpResources(t *testing.T) {
 	err = data.CreateCredential(db, creds)
 	assert.NilError(t, err)
 
-	grantInfra := &models.Grant{
-		Subject:   identity.PolyID(),
-		Resource:  "infra",
-		Privilege: "admin",
-	}
-	err = data.CreateGrant(db, grantInfra)
-	assert.NilError(t, err)
-
-	grantDestination := &models.Grant{
-		Subject:   identity.PolyID(),
-		Resource:  "example",
-		Privilege: "cluster-admin",
-	}
-	err = data.CreateGrant(db, grantDestination)
-	assert.NilError(t, err)
-
-	group := &models.Group{Name: "Group"}
-	err = data.CreateGroup(db, group)
-	assert.NilError(t, err)
-	err = data.AddUsersToGroup(db, group.ID, []uid.ID{identity.ID})
+	group, err := data.GetGroup(db, data.GetGroupOptions{ByName: "Group"})
 	assert.NilError(t, err)
 
 	// delete the identity, and make sure all their resources are gone
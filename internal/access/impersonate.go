@@ -0,0 +1,169 @@
+package access
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+// ImpersonationDuration is the lifetime of an access key created by
+// impersonating a user. Impersonation is for break-glass support, so the
+// key is never extended beyond this duration.
+const ImpersonationDuration = 15 * time.Minute
+
+// ImpersonationApprovalDuration is how long an approval to impersonate a user
+// with an admin role can be used.
+const ImpersonationApprovalDuration = 15 * time.Minute
+
+// privilegedRoles are the infra roles that require a second approver to
+// impersonate a user who has them.
+var privilegedRoles = []string{
+	models.InfraAdminRole,
+	models.InfraSupportAdminRole,
+	models.InfraUserAdminRole,
+	models.InfraGrantAdminRole,
+	models.InfraImpersonatorRole,
+}
+
+// ImpersonateUser creates a short-lived access key that acts as the user with
+// userID. The key records the impersonator, so that every request made with
+// the key is audited with both identities. Requires the infra impersonator
+// role. Impersonating a user with an admin role also requires an approval
+// created by approvedBy with ApproveImpersonation.
+func ImpersonateUser(rCtx RequestContext, userID, approvedBy uid.ID) (*models.AccessKey, string, error) {
+	if err := IsAuthorized(rCtx, models.InfraImpersonatorRole); err != nil {
+		return nil, "", HandleAuthErr(err, "user", "impersonate", models.InfraImpersonatorRole)
+	}
+
+	impersonator := rCtx.Authenticated.User
+	if rCtx.Authenticated.Impersonator != nil {
+		return nil, "", fmt.Errorf("%w: cannot impersonate a user from an impersonation session", internal.ErrBadRequest)
+	}
+	if userID == impersonator.ID {
+		return nil, "", fmt.Errorf("%w: cannot impersonate yourself", internal.ErrBadRequest)
+	}
+
+	target, err := data.GetIdentity(rCtx.DBTxn, data.GetIdentityOptions{ByID: userID})
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := checkImpersonationApproval(rCtx, target, approvedBy); err != nil {
+		return nil, "", err
+	}
+
+	provider := data.InfraProvider(rCtx.DBTxn)
+	expires := time.Now().Add(ImpersonationDuration)
+	keyID := uid.New()
+	key := &models.AccessKey{
+		Model:               models.Model{ID: keyID},
+		Name:                fmt.Sprintf("impersonated-by-%s-%s", impersonator.ID, keyID),
+		IssuedFor:           target.ID,
+		IssuedForName:       target.Name,
+		ProviderID:          provider.ID,
+		ExpiresAt:           expires,
+		InactivityTimeout:   expires,
+		InactivityExtension: ImpersonationDuration,
+		ImpersonatedBy:      impersonator.ID,
+	}
+	body, err := data.CreateAccessKey(rCtx.DBTxn, key)
+	if err != nil {
+		return nil, "", fmt.Errorf("create access key: %w", err)
+	}
+	return key, body, nil
+}
+
+// checkImpersonationApproval returns an error if target has a privileged role,
+// and approvedBy did not approve the impersonation of target by the user of
+// the request. The approval is claimed, so that it can only be used once.
+func checkImpersonationApproval(rCtx RequestContext, target *models.Identity, approvedBy uid.ID) error {
+	targetCtx := RequestContext{DBTxn: rCtx.DBTxn, Authenticated: Authenticated{User: target}}
+	switch err := IsAuthorized(targetCtx, privilegedRoles...); {
+	case errors.Is(err, ErrNotAuthorized):
+		return nil
+	case err != nil:
+		return err
+	}
+
+	if approvedBy == 0 {
+		return fmt.Errorf("%w: impersonating a user with an admin role requires a second approver", internal.ErrBadRequest)
+	}
+	if approvedBy == rCtx.Authenticated.User.ID || approvedBy == target.ID {
+		return fmt.Errorf("%w: the approver must be a different user", internal.ErrBadRequest)
+	}
+
+	// the approver may have lost the role since they approved
+	if err := requireImpersonatorRole(rCtx.DBTxn, approvedBy, "approver"); err != nil {
+		return err
+	}
+
+	err := data.ClaimImpersonationApproval(rCtx.DBTxn, target.ID, rCtx.Authenticated.User.ID, approvedBy)
+	switch {
+	case errors.Is(err, internal.ErrNotFound):
+		return fmt.Errorf("%w: the approver has not approved this impersonation", internal.ErrBadRequest)
+	case errors.Is(err, internal.ErrExpired):
+		return fmt.Errorf("%w: the approval of this impersonation has expired", internal.ErrBadRequest)
+	case err != nil:
+		return fmt.Errorf("claim approval: %w", err)
+	}
+	return nil
+}
+
+// ApproveImpersonation allows the user with impersonatorID to impersonate the
+// user with userID once, within ImpersonationApprovalDuration. The approval is
+// created by the user of the request, who must have the infra impersonator
+// role, and must not be the impersonator or the impersonated user.
+func ApproveImpersonation(rCtx RequestContext, userID, impersonatorID uid.ID) (*data.ImpersonationApproval, error) {
+	if err := IsAuthorized(rCtx, models.InfraImpersonatorRole); err != nil {
+		return nil, HandleAuthErr(err, "impersonation", "approve", models.InfraImpersonatorRole)
+	}
+
+	approver := rCtx.Authenticated.User
+	if rCtx.Authenticated.Impersonator != nil {
+		return nil, fmt.Errorf("%w: cannot approve an impersonation from an impersonation session", internal.ErrBadRequest)
+	}
+	if approver.ID == impersonatorID || approver.ID == userID {
+		return nil, fmt.Errorf("%w: the approver must be a different user", internal.ErrBadRequest)
+	}
+
+	if _, err := data.GetIdentity(rCtx.DBTxn, data.GetIdentityOptions{ByID: userID}); err != nil {
+		return nil, err
+	}
+	if err := requireImpersonatorRole(rCtx.DBTxn, impersonatorID, "impersonator"); err != nil {
+		return nil, err
+	}
+
+	approval := &data.ImpersonationApproval{
+		IdentityID:     userID,
+		ImpersonatorID: impersonatorID,
+		ApprovedBy:     approver.ID,
+		ExpiresAt:      time.Now().Add(ImpersonationApprovalDuration),
+	}
+	if err := data.CreateImpersonationApproval(rCtx.DBTxn, approval); err != nil {
+		return nil, err
+	}
+	return approval, nil
+}
+
+// requireImpersonatorRole returns an error if the user with id does not exist,
+// or does not have the impersonator role. name describes the user in the
+// error.
+func requireImpersonatorRole(tx *data.Transaction, id uid.ID, name string) error {
+	user, err := data.GetIdentity(tx, data.GetIdentityOptions{ByID: id})
+	if err != nil {
+		return fmt.Errorf("%v: %w", name, err)
+	}
+	userCtx := RequestContext{DBTxn: tx, Authenticated: Authenticated{User: user}}
+	if err := IsAuthorized(userCtx, models.InfraImpersonatorRole); err != nil {
+		if errors.Is(err, ErrNotAuthorized) {
+			return fmt.Errorf("%w: the %v must have the %v role", internal.ErrBadRequest, name, models.InfraImpersonatorRole)
+		}
+		return err
+	}
+	return nil
+}
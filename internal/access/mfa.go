@@ -0,0 +1,24 @@
+package access
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/uid"
+)
+
+// ResetUserMFA removes the TOTP enrollment of a user, so that they can log in
+// with only their password and enroll again. Requires the infra user-admin
+// role, or the admin role to reset a user with a role above user-admin.
+func ResetUserMFA(c *gin.Context, id uid.ID) error {
+	rCtx := GetRequestContext(c)
+	if err := authorizeManageUser(rCtx, id, "user mfa", "reset"); err != nil {
+		return err
+	}
+	db := rCtx.DBTxn
+
+	if _, err := data.GetUserMFA(db, id); err != nil {
+		return err
+	}
+	return data.DeleteUserMFA(db, id)
+}
@@ -3,10 +3,13 @@ package access
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
 
 	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/generate"
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
 	"github.com/infrahq/infra/uid"
@@ -49,18 +52,170 @@ func CreateOrganization(c *gin.Context, org *models.Organization) error {
 		return HandleAuthErr(err, "organizations", "create", models.InfraSupportAdminRole)
 	}
 
+	// organization names are not enforced unique by the database, so check here
+	existing, err := data.ListOrganizations(db, data.ListOrganizationsOptions{ByName: org.Name})
+	if err != nil {
+		return fmt.Errorf("check name available: %w", err)
+	}
+	if len(existing) > 0 {
+		return data.UniqueConstraintError{Table: "organizations", Column: "name", Value: org.Name}
+	}
+
 	return data.CreateOrganization(db, org)
 }
 
-func DeleteOrganization(c *gin.Context, id uid.ID) error {
+// CreateOrganizationAdmin creates the initial admin user of a new organization.
+// The user is created in the infra provider of org with a one-time password,
+// and granted the admin role on the infra API. Returns the new identity and
+// its one-time password, which expires after expiry unless expiry is zero.
+func CreateOrganizationAdmin(c *gin.Context, org *models.Organization, name string, expiry time.Duration) (*models.Identity, string, error) {
 	db, err := RequireInfraRole(c, models.InfraSupportAdminRole)
 	if err != nil {
-		return HandleAuthErr(err, "organizations", "delete", models.InfraSupportAdminRole)
+		return nil, "", HandleAuthErr(err, "organizations", "create", models.InfraSupportAdminRole)
 	}
 
+	tx := db.WithOrgID(org.ID)
+	rCtx := GetRequestContext(c)
+
+	identity := &models.Identity{
+		Name:               name,
+		OrganizationMember: models.OrganizationMember{OrganizationID: org.ID},
+	}
+	if user := rCtx.Authenticated.User; user != nil {
+		identity.CreatedBy = user.ID
+	}
+	if err := data.CreateIdentity(tx, identity); err != nil {
+		return nil, "", fmt.Errorf("create identity: %w", err)
+	}
+
+	if _, err := data.CreateProviderUser(tx, data.InfraProvider(tx), identity); err != nil {
+		return nil, "", fmt.Errorf("create provider user: %w", err)
+	}
+
+	tmpPassword, err := generate.CryptoRandom(12, generate.CharsetPassword)
+	if err != nil {
+		return nil, "", fmt.Errorf("generate: %w", err)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(tmpPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, "", fmt.Errorf("hash: %w", err)
+	}
+
+	credential := &models.Credential{
+		IdentityID:               identity.ID,
+		PasswordHash:             hash,
+		OneTimePassword:          true,
+		OneTimePasswordExpiresAt: oneTimePasswordExpiry(expiry),
+	}
+	if err := data.CreateCredential(tx, credential); err != nil {
+		return nil, "", fmt.Errorf("create credential: %w", err)
+	}
+
+	err = data.CreateGrant(tx, &models.Grant{
+		Subject:   uid.NewIdentityPolymorphicID(identity.ID),
+		Privilege: models.InfraAdminRole,
+		Resource:  ResourceInfraAPI,
+		CreatedBy: identity.CreatedBy,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("create grant: %w", err)
+	}
+
+	return identity, tmpPassword, nil
+}
+
+// DeleteOrganization permanently removes the organization and all of its data.
+// When dryRun is true nothing is removed, and the result contains the number
+// of rows which would have been removed.
+func DeleteOrganization(c *gin.Context, id uid.ID, dryRun bool) (map[string]int64, error) {
+	db, err := RequireInfraRole(c, models.InfraSupportAdminRole)
+	if err != nil {
+		return nil, HandleAuthErr(err, "organizations", "delete", models.InfraSupportAdminRole)
+	}
+
+	if dryRun {
+		return data.CountOrganizationData(db, id)
+	}
 	return data.DeleteOrganization(db, id)
 }
 
+func UpdateOrganization(c *gin.Context, org *models.Organization) error {
+	db, err := RequireInfraRole(c, models.InfraSupportAdminRole)
+	if err != nil {
+		return HandleAuthErr(err, "organizations", "update", models.InfraSupportAdminRole)
+	}
+
+	if org.Name != "" {
+		existing, err := data.ListOrganizations(db, data.ListOrganizationsOptions{ByName: org.Name})
+		if err != nil {
+			return fmt.Errorf("check name available: %w", err)
+		}
+		for _, other := range existing {
+			if other.ID != org.ID {
+				return data.UniqueConstraintError{Table: "organizations", Column: "name", Value: org.Name}
+			}
+		}
+	}
+
+	return data.UpdateOrganization(db, org)
+}
+
+// GetOrganizationSettings returns the settings of the organization with id.
+// Unlike GetOrgSettings, the organization does not need to be the organization
+// of the request, and the support admin role is required.
+func GetOrganizationSettings(c *gin.Context, id uid.ID) (*models.OrgSettings, error) {
+	db, err := RequireInfraRole(c, models.InfraSupportAdminRole)
+	if err != nil {
+		return nil, HandleAuthErr(err, "organizations", "get", models.InfraSupportAdminRole)
+	}
+	return data.GetOrgSettings(db.WithOrgID(id))
+}
+
+// UpdateOrganizationSettings saves the settings of the organization
+// settings.OrganizationID. It requires the support admin role.
+func UpdateOrganizationSettings(c *gin.Context, settings *models.OrgSettings) error {
+	db, err := RequireInfraRole(c, models.InfraSupportAdminRole)
+	if err != nil {
+		return HandleAuthErr(err, "organizations", "update", models.InfraSupportAdminRole)
+	}
+	return data.UpdateOrgSettings(db.WithOrgID(settings.OrganizationID), settings)
+}
+
+// GetOrganizationStats returns the usage counts of the organization with id.
+// Admins of the organization may get the stats of their own organization,
+// support admins may get the stats of any organization.
+func GetOrganizationStats(c *gin.Context, id uid.ID) (*data.OrganizationStats, error) {
+	rCtx := GetRequestContext(c)
+	roles := []string{models.InfraSupportAdminRole}
+	if id == rCtx.DBTxn.OrganizationID() {
+		roles = append(roles, models.InfraAdminRole)
+	}
+
+	db, err := RequireInfraRole(c, roles...)
+	if err != nil {
+		return nil, HandleAuthErr(err, "organizations", "get", roles...)
+	}
+	return data.GetOrganizationStats(db, id)
+}
+
+// ExportOrganization checks that the caller is allowed to export the data of
+// the organization with id, and returns a transaction scoped to that
+// organization. The export should be read from the returned transaction.
+func ExportOrganization(c *gin.Context, id uid.ID) (*data.Transaction, error) {
+	rCtx := GetRequestContext(c)
+	roles := []string{models.InfraSupportAdminRole}
+	if id == rCtx.DBTxn.OrganizationID() {
+		roles = append(roles, models.InfraAdminRole)
+	}
+
+	db, err := RequireInfraRole(c, roles...)
+	if err != nil {
+		return nil, HandleAuthErr(err, "organizations", "export", roles...)
+	}
+	return db.WithOrgID(id), nil
+}
+
 // DomainAvailable is needed to check if an org domain is available before completing social sign-up
 func DomainAvailable(c *gin.Context, domain string) error {
 	rCtx := GetRequestContext(c)
@@ -29,7 +29,7 @@ func VerifiedPasswordReset(c *gin.Context, token, newPassword string) (*models.I
 		}
 	}
 
-	if err := updateCredential(c, user, newPassword, true); err != nil {
+	if err := updateCredential(c, user, newPassword, true, 0); err != nil {
 		return nil, err
 	}
 	return user, nil
@@ -23,6 +23,10 @@ type RequestContext struct {
 	// DataDB directly.
 	DataDB *data.DB
 
+	// APIVersion is the version of the API requested by the client with the
+	// Infra-Version header, or the latest version when the header is absent.
+	APIVersion string
+
 	// Response is a mutable field. It can be modified by API handlers to add
 	// new response metadata.
 	Response *ResponseMetadata
@@ -34,6 +38,9 @@ type Authenticated struct {
 	AccessKey    *models.AccessKey
 	User         *models.Identity
 	Organization *models.Organization
+	// Impersonator is the support admin acting as User, when the access key
+	// was created by impersonating User. Nil for all other requests.
+	Impersonator *models.Identity
 }
 
 // ResponseMetadata is accumulated by API endpoints and used for logging and
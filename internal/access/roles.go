@@ -0,0 +1,74 @@
+package access
+
+import (
+	"errors"
+
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+// impliedBy lists the roles that include every privilege of another role. A
+// user with any of these roles is authorized as if they had the role itself.
+// Roles that are not in the table are only satisfied by a grant of the same
+// role.
+var impliedBy = map[string][]string{
+	models.InfraUserAdminRole:  {models.InfraAdminRole},
+	models.InfraGrantAdminRole: {models.InfraAdminRole},
+}
+
+// expandRoles returns roles followed by the roles that imply them, without
+// duplicates.
+func expandRoles(roles []string) []string {
+	result := make([]string, 0, len(roles))
+	seen := make(map[string]bool, len(roles))
+	add := func(role string) {
+		if !seen[role] {
+			seen[role] = true
+			result = append(result, role)
+		}
+	}
+	for _, role := range roles {
+		add(role)
+	}
+	for _, role := range roles {
+		for _, implied := range impliedBy[role] {
+			add(implied)
+		}
+	}
+	return result
+}
+
+// rolesAboveUserAdmin are the infra roles that have privileges a user-admin
+// does not have. Changing the credentials of a user with one of these roles
+// would let a user-admin log in as that user, so it requires the admin role.
+var rolesAboveUserAdmin = []string{
+	models.InfraAdminRole,
+	models.InfraGrantAdminRole,
+	models.InfraSupportAdminRole,
+	models.InfraImpersonatorRole,
+}
+
+// authorizeManageUser checks that the request is authorized to change the
+// credentials of, or delete, the user with userID. Requires the infra
+// user-admin role, or the admin role when the user has a role in
+// rolesAboveUserAdmin.
+func authorizeManageUser(rCtx RequestContext, userID uid.ID, resource, operation string) error {
+	// check user-admin first, so that only a user-admin can see the roles of
+	// the target user
+	if err := IsAuthorized(rCtx, models.InfraUserAdminRole); err != nil {
+		return HandleAuthErr(err, resource, operation, models.InfraUserAdminRole)
+	}
+
+	target := RequestContext{DBTxn: rCtx.DBTxn, Authenticated: Authenticated{User: &models.Identity{Model: models.Model{ID: userID}}}}
+	switch err := IsAuthorized(target, rolesAboveUserAdmin...); {
+	case errors.Is(err, ErrNotAuthorized):
+		return nil
+	case err != nil:
+		return err
+	}
+
+	if err := IsAuthorized(rCtx, models.InfraAdminRole); err != nil {
+		return HandleAuthErr(err, resource, operation, models.InfraAdminRole)
+	}
+	return nil
+}
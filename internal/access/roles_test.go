@@ -0,0 +1,82 @@
+package access
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+func TestExpandRoles(t *testing.T) {
+	type testCase struct {
+		roles    []string
+		expected []string
+	}
+	testCases := []testCase{
+		{roles: []string{models.InfraAdminRole}, expected: []string{"admin"}},
+		{roles: []string{models.InfraUserAdminRole}, expected: []string{"user-admin", "admin"}},
+		{roles: []string{models.InfraGrantAdminRole}, expected: []string{"grant-admin", "admin"}},
+		{
+			roles:    []string{models.InfraAdminRole, models.InfraUserAdminRole, models.InfraViewRole},
+			expected: []string{"admin", "user-admin", "view"},
+		},
+		{
+			roles:    []string{models.InfraUserAdminRole, models.InfraGrantAdminRole},
+			expected: []string{"user-admin", "grant-admin", "admin"},
+		},
+	}
+	for _, tc := range testCases {
+		assert.DeepEqual(t, expandRoles(tc.roles), tc.expected)
+	}
+}
+
+func TestIsAuthorized_RoleMatrix(t *testing.T) {
+	db := setupDB(t)
+
+	roles := []string{
+		models.InfraAdminRole,
+		models.InfraUserAdminRole,
+		models.InfraGrantAdminRole,
+		models.InfraViewRole,
+		models.InfraSupportAdminRole,
+		models.InfraImpersonatorRole,
+	}
+	// the roles that are authorized for each required role
+	matrix := map[string][]string{
+		models.InfraAdminRole:        {models.InfraAdminRole},
+		models.InfraUserAdminRole:    {models.InfraAdminRole, models.InfraUserAdminRole},
+		models.InfraGrantAdminRole:   {models.InfraAdminRole, models.InfraGrantAdminRole},
+		models.InfraViewRole:         {models.InfraViewRole},
+		models.InfraSupportAdminRole: {models.InfraSupportAdminRole},
+		models.InfraImpersonatorRole: {models.InfraImpersonatorRole},
+	}
+
+	users := map[string]*models.Identity{}
+	for _, role := range roles {
+		user := &models.Identity{Name: "infra-" + role + "@example.com"}
+		assert.NilError(t, data.CreateIdentity(db, user))
+		grant := &models.Grant{Subject: user.PolyID(), Privilege: role, Resource: ResourceInfraAPI}
+		assert.NilError(t, data.CreateGrant(db, grant))
+		users[role] = user
+	}
+
+	for required, authorized := range matrix {
+		for _, role := range roles {
+			allowed := false
+			for _, a := range authorized {
+				allowed = allowed || a == role
+			}
+
+			t.Run(role+" for "+required, func(t *testing.T) {
+				subject := users[role].ID.String()
+				if allowed {
+					can(t, db, subject, required)
+				} else {
+					cant(t, db, subject, required)
+				}
+			})
+		}
+	}
+}
@@ -40,3 +40,21 @@ func SaveSettings(c *gin.Context, settings *models.Settings) error {
 	}
 	return nil
 }
+
+func GetOrgSettings(c *gin.Context) (*models.OrgSettings, error) {
+	db, err := RequireInfraRole(c, models.InfraAdminRole)
+	if err != nil {
+		return nil, HandleAuthErr(err, "settings", "get", models.InfraAdminRole)
+	}
+
+	return data.GetOrgSettings(db)
+}
+
+func SaveOrgSettings(c *gin.Context, settings *models.OrgSettings) error {
+	db, err := RequireInfraRole(c, models.InfraAdminRole)
+	if err != nil {
+		return HandleAuthErr(err, "settings", "update", models.InfraAdminRole)
+	}
+
+	return data.UpdateOrgSettings(db, settings)
+}
@@ -32,7 +32,7 @@ func newAgentCmd() *cobra.Command {
 			if err != nil {
 				return fmt.Errorf("infra home directory: %w", err)
 			}
-			logging.UseFileLogger(filepath.Join(infraDir, "agent.log"))
+			logging.UseFileLogger(filepath.Join(infraDir, "agent.log"), logging.FileLoggerOptions{})
 
 			group, ctx := errgroup.WithContext(context.Background())
 			group.Go(func() error {
@@ -19,11 +19,14 @@ import (
 	"github.com/infrahq/infra/internal"
 	"github.com/infrahq/infra/internal/cmd/cliopts"
 	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/tracing"
 )
 
 // Run the main CLI command with the given args. The args should not contain
 // the name of the binary (ex: os.Args[1:]).
 func Run(ctx context.Context, args ...string) error {
+	// requests to the server continue the trace of the caller, if there is one
+	ctx = tracing.ContextFromEnv(ctx)
 	cli := newCLI(ctx)
 	cmd := NewRootCmd(cli)
 	cmd.SetArgs(args)
@@ -105,6 +108,7 @@ func NewAPIClient(opts *APIClientOpts) (*api.Client, error) {
 			Timeout:   60 * time.Second,
 			Transport: opts.Transport,
 		},
+		Retry: api.RetryPolicy{MaxRetries: 2},
 	}
 	if !opts.SkipLogoutOnUnauthorized {
 		client.OnUnauthorized = logoutCurrent
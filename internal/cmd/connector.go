@@ -3,6 +3,7 @@ package cmd
 import (
 	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/infrahq/infra/internal/cmd/types"
 	"github.com/infrahq/infra/internal/connector"
 	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/tracing"
 )
 
 func newConnectorCmd() *cobra.Command {
@@ -21,8 +23,6 @@ func newConnectorCmd() *cobra.Command {
 		Args:   NoArgs,
 		Hidden: true,
 		RunE: func(cmd *cobra.Command, _ []string) error {
-			logging.UseServerLogger()
-
 			options := defaultConnectorOptions()
 			err := cliopts.Load(&options, cliopts.Options{
 				Filename:  configFilename,
@@ -33,6 +33,13 @@ func newConnectorCmd() *cobra.Command {
 				return err
 			}
 
+			if err := useServerLogger(cmd.Context(), options.LogFormat, options.LogFile, options.LogRotation); err != nil {
+				return err
+			}
+			if err := options.AccessLog.Validate(); err != nil {
+				return err
+			}
+
 			// backwards compat for old access key values with a prefix
 			accessKey := options.Server.AccessKey.String()
 			switch {
@@ -68,6 +75,10 @@ func newConnectorCmd() *cobra.Command {
 	cmd.Flags().String("ca-cert", "", "Path to CA certificate file")
 	cmd.Flags().String("ca-key", "", "Path to CA key file")
 	cmd.Flags().Bool("server-skip-tls-verify", false, "Skip verifying server TLS certificates")
+	cmd.Flags().String("log-format", "", "Format of the connector logs [json, console, auto]")
+	cmd.Flags().String("access-log-level", "", "Log level of HTTP access logs [trace, debug, info, warn, error]")
+	cmd.Flags().String("log-file", "", "Write logs to this file instead of stderr. The file is rotated, or reopened on SIGHUP")
+	cmd.Flags().Bool("forward-logs", false, "Send warn and error logs to the Infra server for troubleshooting")
 
 	return cmd
 }
@@ -82,7 +93,14 @@ func defaultConnectorOptions() connector.Options {
 			HTTPS:   ":443",
 			Metrics: ":9090",
 		},
-		Kind: "kubernetes",
+		Kind:            "kubernetes",
+		LogFormat:       string(logging.FormatAuto),
+		Tracing:         tracing.Options{SampleRatio: 1},
+		ClockSkewLeeway: 30 * time.Second,
+		AccessLog: logging.AccessLogOptions{
+			Level:              "info",
+			DemoteHealthChecks: true,
+		},
 		SSH: connector.SSHOptions{
 			Group:          "infra-users",
 			SSHDConfigPath: "/etc/ssh/sshd_config",
@@ -39,6 +39,7 @@ import (
 	"github.com/infrahq/infra/internal/server"
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/tracing"
 )
 
 func TestConnector_Run_Kubernetes(t *testing.T) {
@@ -395,6 +396,19 @@ server:
   trustedCertificate: ca.pem
 name: the-name
 kind: ssh
+logFormat: json
+accessLog:
+  level: debug
+  demoteHealthChecks: false
+logRotation:
+  maxSizeMB: 50
+  compress: true
+forwardLogs: true
+tracing:
+  endpoint: http://otel-collector:4318
+  sampleRatio: 0.5
+requireSignedSync: true
+clockSkewLeeway: 1m
 caCert: /path/to/cert
 caKey: /path/to/key
 addr:
@@ -408,8 +422,21 @@ ssh:
 `,
 			expected: func() connector.Options {
 				return connector.Options{
-					Name: "the-name",
-					Kind: "ssh",
+					Name:      "the-name",
+					Kind:      "ssh",
+					LogFormat: "json",
+					AccessLog: logging.AccessLogOptions{Level: "debug"},
+					LogRotation: logging.FileLoggerOptions{
+						MaxSizeMB: 50,
+						Compress:  true,
+					},
+					ForwardLogs:       true,
+					RequireSignedSync: true,
+					ClockSkewLeeway:   time.Minute,
+					Tracing: tracing.Options{
+						Endpoint:    "http://otel-collector:4318",
+						SampleRatio: 0.5,
+					},
 					Addr: connector.ListenerOptions{
 						HTTP:    "localhost:84",
 						HTTPS:   "localhost:414",
@@ -93,7 +93,7 @@ func newDestinationsListCmd(cli *CLI) *cobra.Command {
 						Kind:     d.Kind,
 						URL:      d.Connection.URL,
 						Status:   status,
-						LastSeen: humanfmt.HumanTime(d.LastSeen.Time(), "never"),
+						LastSeen: humanfmt.HumanTime(d.LastSeenAt.Time(), "never"),
 					})
 				}
 				if len(rows) > 0 {
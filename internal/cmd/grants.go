@@ -88,7 +88,7 @@ func newGrantsListCmd(cli *CLI) *cobra.Command {
 				listReq.Group = group.ID
 			}
 
-			grants, err := listAll(ctx, client.ListGrants, listReq)
+			grants, err := client.Grants(ctx, listReq).All()
 			if err != nil {
 				return err
 			}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -8,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/goware/urlx"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/clientcmd"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 
@@ -66,6 +68,17 @@ func updateKubeconfig(client *api.Client) error {
 	return writeKubeconfig(user, destinations, grants)
 }
 
+// execClusterExtension is the name of the cluster extension that kubectl
+// passes to an exec credential plugin as the config of the cluster.
+const execClusterExtension = "client.authentication.k8s.io/exec"
+
+// execClusterConfig is the config of a cluster passed by kubectl to
+// infra tokens add, so that the token is created for the destination of the
+// cluster.
+type execClusterConfig struct {
+	Destination string `json:"destination"`
+}
+
 func writeKubeconfig(user *api.User, destinations []api.Destination, grants []api.Grant) error {
 	defaultConfig := clientConfig()
 
@@ -75,9 +88,10 @@ func writeKubeconfig(user *api.User, destinations []api.Destination, grants []ap
 	}
 
 	type clusterContext struct {
-		Namespace string
-		URL       string
-		CA        []byte
+		Namespace   string
+		URL         string
+		CA          []byte
+		Destination string
 	}
 
 	infraContexts := make(map[string]clusterContext)
@@ -108,8 +122,9 @@ func writeKubeconfig(user *api.User, destinations []api.Destination, grants []ap
 
 			if isDestinationAvailable(d) {
 				infraContext = clusterContext{
-					URL: d.Connection.URL,
-					CA:  []byte(d.Connection.CA),
+					URL:         d.Connection.URL,
+					CA:          []byte(d.Connection.CA),
+					Destination: d.Name,
 				}
 				break
 			}
@@ -133,9 +148,18 @@ func writeKubeconfig(user *api.User, destinations []api.Destination, grants []ap
 
 		u.Scheme = "https"
 
+		execConfig, err := json.Marshal(execClusterConfig{Destination: infraContext.Destination})
+		if err != nil {
+			return err
+		}
+
 		kubeConfig.Clusters[contextName] = &clientcmdapi.Cluster{
 			Server:                   u.String(),
 			CertificateAuthorityData: infraContext.CA,
+			// passed to infra tokens add by kubectl, see execClusterConfig
+			Extensions: map[string]runtime.Object{
+				execClusterExtension: &runtime.Unknown{Raw: execConfig, ContentType: runtime.ContentTypeJSON},
+			},
 		}
 
 		// use existing kubeContext if possible which may contain
@@ -158,10 +182,11 @@ func writeKubeconfig(user *api.User, destinations []api.Destination, grants []ap
 
 		kubeConfig.AuthInfos[user.Name] = &clientcmdapi.AuthInfo{
 			Exec: &clientcmdapi.ExecConfig{
-				Command:         executable,
-				Args:            []string{"tokens", "add"},
-				APIVersion:      "client.authentication.k8s.io/v1beta1",
-				InteractiveMode: clientcmdapi.IfAvailableExecInteractiveMode,
+				Command:            executable,
+				Args:               []string{"tokens", "add"},
+				APIVersion:         "client.authentication.k8s.io/v1beta1",
+				InteractiveMode:    clientcmdapi.IfAvailableExecInteractiveMode,
+				ProvideClusterInfo: true,
 			},
 		}
 	}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -11,6 +12,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"gotest.tools/v3/assert"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/clientcmd"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 
@@ -111,6 +113,7 @@ func TestUpdateKubeconfig(t *testing.T) {
 			"infra:my-first-kubernetes-cluster": {
 				Server:                   "https://destination-connection-url",
 				CertificateAuthorityData: []byte("destination-connection-certificate"),
+				Extensions:               execClusterExtensions("my-first-kubernetes-cluster"),
 			},
 		}, cmpKubeconfig)
 		assert.DeepEqual(t, actualKubeconfig.AuthInfos, map[string]*clientcmdapi.AuthInfo{
@@ -171,6 +174,7 @@ func TestWriteKubeconfig(t *testing.T) {
 		"infra:connected": {
 			Server:                   "https://connected.example.com",
 			CertificateAuthorityData: []byte(destinationCA),
+			Extensions:               execClusterExtensions("connected"),
 		},
 	}
 
@@ -436,6 +440,15 @@ func TestSafelyWriteConfigToFile(t *testing.T) {
 	}
 }
 
+// execClusterExtensions returns the extensions of a cluster written by
+// writeKubeconfig for the destination.
+func execClusterExtensions(destination string) map[string]runtime.Object {
+	raw := fmt.Sprintf(`{"destination":%q}`, destination)
+	return map[string]runtime.Object{
+		execClusterExtension: &runtime.Unknown{Raw: []byte(raw), ContentType: runtime.ContentTypeJSON},
+	}
+}
+
 var cmpKubeconfig = cmp.Options{
 	cmpopts.EquateEmpty(),
 	cmpopts.IgnoreFields(clientcmdapi.Context{}, "LocationOfOrigin"),
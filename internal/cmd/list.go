@@ -125,7 +125,7 @@ func getUserDestinationGrants(client *api.Client, kind string) (*api.User, []api
 		return nil, nil, nil, err
 	}
 
-	grants, err := listAll(ctx, client.ListGrants, api.ListGrantsRequest{User: config.UserID, ShowInherited: true})
+	grants, err := client.Grants(ctx, api.ListGrantsRequest{User: config.UserID, ShowInherited: true}).All()
 	if err != nil {
 		return nil, nil, nil, err
 	}
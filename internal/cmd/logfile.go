@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/infrahq/infra/internal/logging"
+)
+
+// useServerLogger configures the logger for long-running processes, like the
+// server and connector. When logFile is set logs are written to the file
+// instead of stderr, and the file is reopened when the process receives
+// SIGHUP, so that logrotate can be used instead of the built-in rotation.
+func useServerLogger(ctx context.Context, format string, logFile string, rotation logging.FileLoggerOptions) error {
+	if logFile == "" {
+		return logging.UseServerLogger(format)
+	}
+	logging.UseFileLogger(logFile, rotation)
+	reopenLogFileOnSignal(ctx)
+	return nil
+}
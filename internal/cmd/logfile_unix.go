@@ -0,0 +1,33 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/infrahq/infra/internal/logging"
+)
+
+// reopenLogFileOnSignal reopens the log file every time the process receives
+// SIGHUP, until ctx is done.
+func reopenLogFileOnSignal(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				if err := logging.ReopenLogFile(); err != nil {
+					logging.L.Warn().Err(err).Msg("failed to reopen log file")
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package cmd
+
+import "context"
+
+// reopenLogFileOnSignal is a no-op on windows, which does not support SIGHUP.
+func reopenLogFileOnSignal(_ context.Context) {}
@@ -173,6 +173,13 @@ func login(cli *CLI, options loginCmdOptions) error {
 
 			return err
 		}
+
+		if loginRes.MFARequired {
+			loginRes, err = mfaLogin(ctx, lc.APIClient, cli, options, loginRes.MFAToken)
+			if err != nil {
+				return err
+			}
+		}
 	default:
 		if options.NonInteractive {
 			return Error{Message: "Non-interactive login requires setting either the INFRA_ACCESS_KEY or both the INFRA_USER and INFRA_PASSWORD environment variables"}
@@ -184,6 +191,10 @@ func login(cli *CLI, options loginCmdOptions) error {
 		}
 	}
 
+	if loginRes.MFAEnrollmentRequired {
+		return Error{Message: "Your organization requires multi-factor authentication. Log in to the Infra web UI to enroll, then run 'infra login' again"}
+	}
+
 	// Update the API client with the new access key from login
 	lc.APIClient.AccessKey = loginRes.AccessKey
 
@@ -244,6 +255,37 @@ func login(cli *CLI, options loginCmdOptions) error {
 	return nil
 }
 
+// mfaLogin completes a password login by prompting for a TOTP code, or a
+// recovery code.
+func mfaLogin(ctx context.Context, client *api.Client, cli *CLI, options loginCmdOptions, token string) (*api.LoginResponse, error) {
+	if options.NonInteractive {
+		return nil, Error{Message: "Non-interactive login is not supported for users with multi-factor authentication"}
+	}
+
+	var code string
+	prompt := &survey.Input{Message: "Authentication code (or recovery code):"}
+	if err := survey.AskOne(prompt, &code, cli.surveyIO, survey.WithValidator(survey.Required)); err != nil {
+		return nil, err
+	}
+
+	req := &api.LoginRequestMFA{Token: token}
+	code = strings.TrimSpace(code)
+	if strings.Contains(code, "-") {
+		req.RecoveryCode = code
+	} else {
+		req.Code = code
+	}
+
+	loginRes, err := client.Login(ctx, &api.LoginRequest{MFA: req})
+	if err != nil {
+		if api.ErrorStatusCode(err) == http.StatusUnauthorized {
+			return nil, &LoginError{Message: "your authentication code may be invalid"}
+		}
+		return nil, err
+	}
+	return loginRes, nil
+}
+
 func equalHosts(x, y string) bool {
 	return strings.TrimPrefix(x, "https://") == strings.TrimPrefix(y, "https://")
 }
@@ -454,7 +496,8 @@ func deviceFlowLogin(ctx context.Context, client *api.Client, cli *CLI) (*api.Lo
 	// poll for response
 	timeout := time.NewTimer(time.Duration(resp.ExpiresInSeconds) * time.Second)
 	defer timeout.Stop()
-	poll := time.NewTicker(time.Duration(resp.PollIntervalSeconds) * time.Second)
+	pollInterval := time.Duration(resp.PollIntervalSeconds) * time.Second
+	poll := time.NewTicker(pollInterval)
 	defer poll.Stop()
 	spinner := time.NewTicker(1000 * time.Millisecond)
 	defer spinner.Stop()
@@ -478,8 +521,13 @@ func deviceFlowLogin(ctx context.Context, client *api.Client, cli *CLI) (*api.Lo
 			switch pollResp.Status {
 			case api.DeviceFlowStatusExpired:
 				return nil, Error{Message: "device approval request expired"}
+			case api.DeviceFlowStatusDenied:
+				return nil, Error{Message: "device approval request was denied"}
 			case api.DeviceFlowStatusConfirmed:
 				return pollResp.LoginResponse, nil
+			case api.DeviceFlowStatusSlowDown:
+				pollInterval += 5 * time.Second
+				poll.Reset(pollInterval)
 			case api.DeviceFlowStatusPending:
 			default:
 				logging.Warnf("unexpected response status: " + pollResp.Status)
@@ -9,39 +9,15 @@ import (
 
 // listAll is a helper function that handles pagination and calls the given list request function.
 // listItems is the corresponding function in the API client that handles the Request "req".
-// handleError is a function that handles the error returned by the API client.
 func listAll[Item any, Req api.Paginatable](
 	ctx context.Context,
 	listItems func(context.Context, Req) (*api.ListResponse[Item], error),
 	req Req,
 ) ([]Item, error) {
-	logging.Debugf("call server: page 1")
-
-	req, ok := req.SetPage(1).(Req)
-	if !ok {
-		panic("SetPage returned a different request type than expected")
-	}
-
-	res, err := listItems(ctx, req)
-	if err != nil {
-		return nil, err
-	}
-	users := make([]Item, 0, res.TotalCount)
-	users = append(users, res.Items...)
-
-	for page := 2; page <= res.TotalPages; page++ {
-		req, ok := req.SetPage(page).(Req)
-		if !ok {
-			panic("SetPage returned a different request type than expected")
-		}
-
+	page := 0
+	return api.NewListIterator(ctx, func(ctx context.Context, req Req) (*api.ListResponse[Item], error) {
+		page++
 		logging.Debugf("call server: page %d", page)
-		res, err = listItems(ctx, req)
-		if err != nil {
-			return nil, err
-		}
-		users = append(users, res.Items...)
-	}
-
-	return users, nil
+		return listItems(ctx, req)
+	}, req).All()
 }
@@ -47,6 +47,15 @@ func TestListAll(t *testing.T) {
 		})
 	})
 
+	t.Run("without totals", func(t *testing.T) {
+		users, err := listAll(ctx, mockListUsers, api.ListUsersRequest{Name: "without totals"})
+		assert.NilError(t, err)
+
+		assert.DeepEqual(t, users, []api.User{
+			{Name: "1@test.com"}, {Name: "1@test.org"}, {Name: "2@test.com"}, {Name: "2@test.org"}, {Name: "3@test.com"},
+		})
+	})
+
 	t.Run("error", func(t *testing.T) {
 		_, err := listAll(ctx, mockListUsers, api.ListUsersRequest{Name: "error"})
 		assert.Error(t, err, "default error")
@@ -76,6 +85,18 @@ func mockListUsers(_ context.Context, req api.ListUsersRequest) (*api.ListRespon
 			Items:              []api.User{{Name: fmt.Sprintf("%d@test.com", req.Page)}, {Name: fmt.Sprintf("%d@test.org", req.Page)}},
 			PaginationResponse: api.PaginationResponse{TotalPages: 5, TotalCount: 5, Page: req.Page},
 		}, nil
+	case "without totals":
+		if req.WithTotal == nil || *req.WithTotal {
+			return nil, Error{Message: "expected withTotal=false"}
+		}
+		items := []api.User{{Name: fmt.Sprintf("%d@test.com", req.Page)}, {Name: fmt.Sprintf("%d@test.org", req.Page)}}
+		if req.Page == 3 {
+			items = items[:1]
+		}
+		return &api.ListResponse[api.User]{
+			Items:              items,
+			PaginationResponse: api.PaginationResponse{TotalPages: -1, TotalCount: -1, Page: req.Page, Limit: 2},
+		}, nil
 	case "403":
 		return nil, api.Error{Code: 403}
 	default:
@@ -0,0 +1,35 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/infrahq/infra/internal/logging"
+)
+
+// reloadSecretsOnSignal calls reload every time the process receives SIGHUP,
+// until ctx is done.
+func reloadSecretsOnSignal(ctx context.Context, reload func() error) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				if err := reload(); err != nil {
+					logging.L.Error().Err(err).Msg("failed to reload secrets")
+					continue
+				}
+				logging.L.Info().Msg("reloaded secrets")
+			}
+		}
+	}()
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package cmd
+
+import "context"
+
+// reloadSecretsOnSignal is a no-op on windows, which does not support SIGHUP.
+func reloadSecretsOnSignal(_ context.Context, _ func() error) {}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -13,12 +14,16 @@ import (
 	"github.com/infrahq/infra/internal/cmd/types"
 	"github.com/infrahq/infra/internal/logging"
 	"github.com/infrahq/infra/internal/server"
+	"github.com/infrahq/infra/internal/server/authn"
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/redis"
+	"github.com/infrahq/infra/tracing"
 )
 
 func newServerCmd() *cobra.Command {
 	var configFilename string
+	var checkMigrations bool
+	var rotateDBKey bool
 
 	cmd := &cobra.Command{
 		Use:    "server",
@@ -26,8 +31,6 @@ func newServerCmd() *cobra.Command {
 		Args:   NoArgs,
 		Hidden: true,
 		RunE: func(cmd *cobra.Command, _ []string) error {
-			logging.UseServerLogger()
-
 			if configFilename == "" {
 				configFilename = os.Getenv("INFRA_SERVER_CONFIG_FILE")
 			}
@@ -42,6 +45,13 @@ func newServerCmd() *cobra.Command {
 				return err
 			}
 
+			if err := useServerLogger(cmd.Context(), options.LogFormat, options.LogFile, options.LogRotation); err != nil {
+				return err
+			}
+			if err := options.AccessLog.Validate(); err != nil {
+				return err
+			}
+
 			tlsCache, err := canonicalPath(options.TLSCache)
 			if err != nil {
 				return err
@@ -49,12 +59,32 @@ func newServerCmd() *cobra.Command {
 
 			options.TLSCache = tlsCache
 
-			dbEncryptionKey, err := canonicalPath(options.DBEncryptionKey)
-			if err != nil {
-				return err
+			// the root key can be a reference to a secret, ex: env:INFRA_ROOT_KEY,
+			// instead of the path to a file
+			if !isSecretReference(options.DBEncryptionKey) {
+				dbEncryptionKey, err := canonicalPath(options.DBEncryptionKey)
+				if err != nil {
+					return err
+				}
+
+				options.DBEncryptionKey = dbEncryptionKey
+			}
+
+			if options.DB.Driver == data.DriverSQLite && options.DBConnectionString == "" {
+				options.DBConnectionString = filepath.Join(infraDir, "infra.db")
 			}
 
-			options.DBEncryptionKey = dbEncryptionKey
+			if checkMigrations {
+				return runCheckMigrations(cmd.OutOrStdout(), options)
+			}
+
+			if rotateDBKey {
+				if err := rotateDBEncryptionKey(options); err != nil {
+					return fmt.Errorf("rotate db encryption key: %w", err)
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), "Rotated the database encryption key.")
+				return nil
+			}
 
 			srv, err := newServer(options)
 			if err != nil {
@@ -65,7 +95,10 @@ func newServerCmd() *cobra.Command {
 	}
 
 	cmd.Flags().StringVarP(&configFilename, "config-file", "f", "", "Server configuration file")
+	cmd.Flags().BoolVar(&checkMigrations, "check-migrations", false, "List pending database migrations without applying them, and exit non-zero if any are pending")
+	cmd.Flags().BoolVar(&rotateDBKey, "rotate-db-encryption-key", false, "Re-encrypt the secrets in the database with a new key, encrypted by the root key from db-encryption-key, and exit. The server must not be running")
 	cmd.Flags().String("tls-cache", "", "Directory to cache TLS certificates")
+	cmd.Flags().String("db-driver", "", "Database driver, one of: postgres, sqlite")
 	cmd.Flags().String("db-name", "", "Database name")
 	cmd.Flags().String("db-host", "", "Database host")
 	cmd.Flags().Int("db-port", 0, "Database port")
@@ -75,10 +108,14 @@ func newServerCmd() *cobra.Command {
 	cmd.Flags().String("db-encryption-key", "", "Database encryption key")
 	cmd.Flags().String("db-encryption-key-provider", "", "Database encryption key provider")
 	cmd.Flags().Bool("enable-telemetry", false, "Enable telemetry")
+	cmd.Flags().String("log-format", "", "Format of the server logs [json, console, auto]")
+	cmd.Flags().String("access-log-level", "", "Log level of HTTP access logs [trace, debug, info, warn, error]")
+	cmd.Flags().String("log-file", "", "Write logs to this file instead of stderr. The file is rotated, or reopened on SIGHUP")
 	cmd.Flags().Var(&types.URL{}, "ui-proxy-url", "Enable UI and proxy requests to this url")
 	cmd.Flags().Duration("session-duration", 0, "Maximum session duration per user login")
 	cmd.Flags().Duration("session-inactivity-timeout", 0, "A user must interact with Infra at least once within this amount of time for their session to remain valid")
 	cmd.Flags().Bool("enable-signup", false, "Enable one-time admin signup")
+	cmd.Flags().Bool("seed-demo-data", false, "Populate the default organization with demo users, groups, and grants")
 	cmd.Flags().String("base-domain", "", "base-domain for the server, eg example.com")
 	cmd.Flags().String("login-domain-prefix", "", "The path prefix on the base-domain that clients are redirected to after social login")
 	cmd.Flags().String("google-client-id", "", "Client ID of the Google client used for social login")
@@ -96,9 +133,26 @@ func defaultServerOptions(infraDir string) server.Options {
 		EnableTelemetry:          true,
 		SessionDuration:          24 * time.Hour * 30, // 30 days
 		SessionInactivityTimeout: 24 * time.Hour * 3,  // 3 days
-		EnableSignup:             false,
-		BaseDomain:               "",
-		EnableLogSampling:        true,
+		DestinationTokenDuration: 5 * time.Minute,
+		ClockSkewLeeway:          data.DefaultClockSkewLeeway,
+		LoginThrottle: authn.LoginThrottle{
+			DelayThreshold:          3,
+			LockoutThreshold:        10,
+			LockoutDuration:         15 * time.Minute,
+			OneTimePasswordAttempts: 5,
+		},
+		OneTimePasswords: server.OneTimePasswordOptions{
+			InviteExpiry: 7 * 24 * time.Hour,
+			ResetExpiry:  15 * time.Minute,
+		},
+		EnableSignup:      false,
+		BaseDomain:        "",
+		EnableLogSampling: true,
+		LogFormat:         string(logging.FormatAuto),
+		AccessLog: logging.AccessLogOptions{
+			Level:              "info",
+			DemoteHealthChecks: true,
+		},
 
 		Addr: server.ListenerOptions{
 			HTTP:    ":80",
@@ -106,10 +160,13 @@ func defaultServerOptions(infraDir string) server.Options {
 			Metrics: ":9090",
 		},
 
+		Tracing: tracing.Options{
+			SampleRatio: 1,
+		},
+
 		DB: data.NewDBOptions{
-			MaxOpenConnections: 100,
-			MaxIdleConnections: 100,
-			MaxIdleTimeout:     5 * time.Minute,
+			// connection pool defaults are set by data.NewDB
+			StatementTimeout: 30 * time.Second,
 		},
 
 		Redis: redis.Options{
@@ -119,18 +176,52 @@ func defaultServerOptions(infraDir string) server.Options {
 		API: server.APIOptions{
 			RequestTimeout:         time.Minute,
 			BlockingRequestTimeout: 5 * time.Minute,
+			RateLimit:              5000,
+			ConnectorRateLimit:     20000,
+			MaxPaginationLimit:     data.DefaultMaxPaginationLimit,
+			MaxRequestBodySize:     server.DefaultMaxRequestBodySize,
 		},
 	}
 }
 
 // runServer is a shim for testing.
 var runServer = func(ctx context.Context, srv *server.Server) error {
+	reloadSecretsOnSignal(ctx, srv.ReloadSecrets)
 	return srv.Run(ctx)
 }
 
 // newServer is a shim for testing.
 var newServer = server.New
 
+// pendingMigrations is a shim for testing.
+var pendingMigrations = server.PendingMigrations
+
+// rotateDBEncryptionKey is a shim for testing.
+var rotateDBEncryptionKey = server.RotateDBEncryptionKey
+
+func runCheckMigrations(out io.Writer, options server.Options) error {
+	pending, err := pendingMigrations(options)
+	if err != nil {
+		return fmt.Errorf("check migrations: %w", err)
+	}
+	if len(pending) == 0 {
+		fmt.Fprintln(out, "No pending migrations, the database schema is up to date.")
+		return nil
+	}
+
+	fmt.Fprintf(out, "%d pending migrations:\n", len(pending))
+	for _, m := range pending {
+		fmt.Fprintf(out, "  %s\t%s\n", m.ID, m.Description)
+	}
+	return exitError{code: 1}
+}
+
+// isSecretReference returns true if value refers to a secret in a secret
+// storage, using the kind:name format.
+func isSecretReference(value string) bool {
+	return strings.Contains(value, ":") && filepath.VolumeName(value) == ""
+}
+
 func canonicalPath(path string) (string, error) {
 	path = os.ExpandEnv(path)
 
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"net/url"
@@ -16,10 +17,14 @@ import (
 	"gotest.tools/v3/fs"
 
 	"github.com/infrahq/infra/internal/cmd/types"
+	"github.com/infrahq/infra/internal/logging"
 	"github.com/infrahq/infra/internal/server"
+	"github.com/infrahq/infra/internal/server/authn"
 	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/data/migrator"
 	"github.com/infrahq/infra/internal/server/redis"
 	"github.com/infrahq/infra/internal/testing/database"
+	"github.com/infrahq/infra/tracing"
 )
 
 func TestServerCmd_LoadOptions(t *testing.T) {
@@ -57,6 +62,17 @@ func TestServerCmd_LoadOptions(t *testing.T) {
 	}
 
 	testCases := []testCase{
+		{
+			name: "db encryption key is a secret reference",
+			setup: func(t *testing.T, cmd *cobra.Command) {
+				t.Setenv("INFRA_SERVER_DB_ENCRYPTION_KEY", "env:INFRA_ROOT_KEY")
+			},
+			expected: func(t *testing.T) server.Options {
+				expected := defaultServerOptions(filepath.Join(dir, ".infra"))
+				expected.DBEncryptionKey = "env:INFRA_ROOT_KEY"
+				return expected
+			},
+		},
 		{
 			name: "config filename specified as env var",
 			setup: func(t *testing.T, cmd *cobra.Command) {
@@ -171,8 +187,42 @@ tlsCache: /cache/dir
 enableTelemetry: false # default is true
 enableSignup: false    # default is true
 enableLogSampling: false # default is true
+logFormat: json
+accessLog:
+  level: warn
+  demoteHealthChecks: false
+logRotation:
+  maxSizeMB: 100
+  maxBackups: 3
+  maxAgeDays: 90
+  compress: true
+audit:
+  file: /var/log/infra/audit.log
+  fileRotation:
+    maxBackups: 30
+  database: true
+  retention: 2160h
+purge:
+  retention:
+    grants: 720h
+  batchSize: 500
+tracing:
+  endpoint: http://otel-collector:4318
+  sampleRatio: 0.25
 sessionDuration: 3m
 sessionInactivityTimeout: 1m
+destinationTokenDuration: 10m
+clockSkewLeeway: 1m
+loginThrottle:
+  lockoutThreshold: 5
+  lockoutDuration: 1h
+  oneTimePasswordAttempts: 3
+oneTimePasswords:
+  inviteExpiry: 72h
+  resetExpiry: 30m
+trustedProxies:
+  - 10.0.0.0/8
+  - 2001:db8::/32
 
 dbEncryptionKey: /this-is-the-path
 dbEncryptionKeyProvider: the-provider
@@ -182,6 +232,13 @@ dbName: infradbname
 dbUsername: infra
 dbPassword: env:POSTGRES_DB_PASSWORD
 dbParameters: sslmode=require
+dbReplicaConnectionString: host=the-replica
+db:
+  maxOpenConnections: 40
+  maxIdleConnections: 20
+  maxIdleTimeout: 2m
+  maxConnectionLifetime: 1h
+  preparedStatementCacheSize: 256
 
 baseDomain: foo.example.com
 loginDomainPrefix: login
@@ -243,6 +300,7 @@ redis:
 api:
   requestTimeout: 2m
   blockingRequestTimeout: 4m
+  rateLimit: 600
 
 `
 
@@ -256,6 +314,41 @@ api:
 					TLSCache:                 "/cache/dir",
 					SessionDuration:          3 * time.Minute,
 					SessionInactivityTimeout: 1 * time.Minute,
+					DestinationTokenDuration: 10 * time.Minute,
+					ClockSkewLeeway:          time.Minute,
+					LoginThrottle: authn.LoginThrottle{
+						DelayThreshold:          3,
+						LockoutThreshold:        5,
+						LockoutDuration:         time.Hour,
+						OneTimePasswordAttempts: 3,
+					},
+					OneTimePasswords: server.OneTimePasswordOptions{
+						InviteExpiry: 72 * time.Hour,
+						ResetExpiry:  30 * time.Minute,
+					},
+					TrustedProxies: []string{"10.0.0.0/8", "2001:db8::/32"},
+					LogFormat:      "json",
+					AccessLog:      logging.AccessLogOptions{Level: "warn"},
+					LogRotation: logging.FileLoggerOptions{
+						MaxSizeMB:  100,
+						MaxBackups: 3,
+						MaxAgeDays: 90,
+						Compress:   true,
+					},
+					Audit: server.AuditOptions{
+						File:         "/var/log/infra/audit.log",
+						FileRotation: logging.FileLoggerOptions{MaxBackups: 30},
+						Database:     true,
+						Retention:    2160 * time.Hour,
+					},
+					Purge: server.PurgeOptions{
+						Retention: map[string]time.Duration{"grants": 720 * time.Hour},
+						BatchSize: 500,
+					},
+					Tracing: tracing.Options{
+						Endpoint:    "http://otel-collector:4318",
+						SampleRatio: 0.25,
+					},
 
 					DBEncryptionKey:         "/this-is-the-path",
 					DBEncryptionKeyProvider: "the-provider",
@@ -266,6 +359,8 @@ api:
 					DBUsername:              "infra",
 					DBName:                  "infradbname",
 
+					DBReplicaConnectionString: "host=the-replica",
+
 					BaseDomain:         "foo.example.com",
 					LoginDomainPrefix:  "login",
 					GoogleClientID:     "aaa",
@@ -341,9 +436,12 @@ api:
 					},
 
 					DB: data.NewDBOptions{
-						MaxOpenConnections: 100,
-						MaxIdleConnections: 100,
-						MaxIdleTimeout:     5 * time.Minute,
+						MaxOpenConnections:         40,
+						MaxIdleConnections:         20,
+						MaxIdleTimeout:             2 * time.Minute,
+						MaxConnectionLifetime:      time.Hour,
+						StatementTimeout:           30 * time.Second,
+						PreparedStatementCacheSize: 256,
 					},
 
 					Redis: redis.Options{
@@ -356,6 +454,10 @@ api:
 					API: server.APIOptions{
 						RequestTimeout:         2 * time.Minute,
 						BlockingRequestTimeout: 4 * time.Minute,
+						RateLimit:              600,
+						ConnectorRateLimit:     20000,
+						MaxPaginationLimit:     1000,
+						MaxRequestBodySize:     server.DefaultMaxRequestBodySize,
 					},
 				}
 			},
@@ -371,6 +473,8 @@ api:
 					"--session-duration", "3m",
 					"--session-inactivity-timeout", "1m",
 					"--enable-signup=false",
+					"--seed-demo-data",
+					"--access-log-level", "debug",
 				})
 			},
 			expected: func(t *testing.T) server.Options {
@@ -382,10 +486,31 @@ api:
 				expected.SessionDuration = 3 * time.Minute
 				expected.SessionInactivityTimeout = 1 * time.Minute
 				expected.EnableSignup = false
+				expected.SeedDemoData = true
 				expected.BaseDomain = ""
+				expected.AccessLog.Level = "debug"
+				return expected
+			},
+		},
+		{
+			name: "sqlite driver defaults to a file in the infra directory",
+			setup: func(t *testing.T, cmd *cobra.Command) {
+				cmd.SetArgs([]string{"--db-driver", "sqlite"})
+			},
+			expected: func(t *testing.T) server.Options {
+				expected := defaultServerOptions(filepath.Join(dir, ".infra"))
+				expected.DB.Driver = "sqlite"
+				expected.DBConnectionString = filepath.Join(dir, ".infra", "infra.db")
 				return expected
 			},
 		},
+		{
+			name: "invalid access log level",
+			setup: func(t *testing.T, cmd *cobra.Command) {
+				cmd.SetArgs([]string{"--access-log-level", "loud"})
+			},
+			expectedErr: `invalid access log level "loud"`,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -453,6 +578,87 @@ func patchNewServer(t *testing.T, target *server.Options) {
 	}
 }
 
+func TestServerCmd_CheckMigrations(t *testing.T) {
+	var pending []migrator.MigrationStatus
+	orig := pendingMigrations
+	t.Cleanup(func() {
+		pendingMigrations = orig
+	})
+	pendingMigrations = func(options server.Options) ([]migrator.MigrationStatus, error) {
+		assert.Equal(t, options.DBHost, "db.example.com")
+		return pending, nil
+	}
+	patchRunServer(t, func(context.Context, *server.Server) error {
+		t.Fatal("server should not run")
+		return nil
+	})
+
+	dir := fs.NewDir(t, t.Name())
+	t.Setenv("HOME", dir.Path())
+
+	run := func(t *testing.T) (string, error) {
+		t.Helper()
+		out := new(bytes.Buffer)
+		cmd := newServerCmd()
+		// match the root command
+		cmd.SilenceUsage, cmd.SilenceErrors = true, true
+		cmd.SetOut(out)
+		cmd.SetArgs([]string{"--check-migrations", "--db-host", "db.example.com"})
+		err := cmd.Execute()
+		return out.String(), err
+	}
+
+	t.Run("up to date", func(t *testing.T) {
+		out, err := run(t)
+		assert.NilError(t, err)
+		assert.Equal(t, out, "No pending migrations, the database schema is up to date.\n")
+	})
+
+	t.Run("pending", func(t *testing.T) {
+		pending = []migrator.MigrationStatus{
+			{ID: "2023-01-04T10:00", Description: "addDestinationsUpdateIndex", Pending: true},
+			{ID: "2023-01-05T10:00", Description: "the next one", Pending: true},
+		}
+		out, err := run(t)
+		assert.Equal(t, err, exitError{code: 1})
+		expected := `2 pending migrations:
+  2023-01-04T10:00	addDestinationsUpdateIndex
+  2023-01-05T10:00	the next one
+`
+		assert.Equal(t, out, expected)
+	})
+}
+
+func TestServerCmd_RotateDBEncryptionKey(t *testing.T) {
+	dir := fs.NewDir(t, t.Name())
+	t.Setenv("HOME", dir.Path())
+	rootKey := filepath.Join(dir.Path(), "next.key")
+
+	orig := rotateDBEncryptionKey
+	t.Cleanup(func() {
+		rotateDBEncryptionKey = orig
+	})
+	var called bool
+	rotateDBEncryptionKey = func(options server.Options) error {
+		called = true
+		assert.Equal(t, options.DBEncryptionKeyProvider, "native")
+		assert.Equal(t, options.DBEncryptionKey, rootKey)
+		return nil
+	}
+	patchRunServer(t, func(context.Context, *server.Server) error {
+		t.Fatal("server should not run")
+		return nil
+	})
+
+	out := new(bytes.Buffer)
+	cmd := newServerCmd()
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"--rotate-db-encryption-key", "--db-encryption-key", rootKey})
+	assert.NilError(t, cmd.Execute())
+	assert.Assert(t, called)
+	assert.Equal(t, out.String(), "Rotated the database encryption key.\n")
+}
+
 func TestServerCmd_NoFlagDefaults(t *testing.T) {
 	cmd := newServerCmd()
 	flags := cmd.Flags()
@@ -3,11 +3,14 @@ package cmd
 import (
 	"context"
 	"encoding/json"
+	"os"
 	"time"
 
 	"github.com/spf13/cobra"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clientauthenticationv1beta1 "k8s.io/client-go/pkg/apis/clientauthentication/v1beta1"
+
+	"github.com/infrahq/infra/internal/logging"
 )
 
 func newTokensCmd(cli *CLI) *cobra.Command {
@@ -40,7 +43,7 @@ func tokensCreate(cli *CLI) error {
 		return err
 	}
 
-	token, err := client.CreateToken(ctx)
+	token, err := client.CreateDestinationToken(ctx, execInfoDestination(os.Getenv("KUBERNETES_EXEC_INFO")))
 	if err != nil {
 		return err
 	}
@@ -66,3 +69,28 @@ func tokensCreate(cli *CLI) error {
 
 	return nil
 }
+
+// execInfoDestination returns the name of the destination from the
+// KUBERNETES_EXEC_INFO set by kubectl. It returns an empty string when kubectl
+// did not provide the cluster info, for example because the kubeconfig was
+// written by an older version of infra.
+func execInfoDestination(execInfo string) string {
+	if execInfo == "" {
+		return ""
+	}
+	var credential clientauthenticationv1beta1.ExecCredential
+	if err := json.Unmarshal([]byte(execInfo), &credential); err != nil {
+		logging.Debugf("failed to parse KUBERNETES_EXEC_INFO: %v", err)
+		return ""
+	}
+	cluster := credential.Spec.Cluster
+	if cluster == nil || len(cluster.Config.Raw) == 0 {
+		return ""
+	}
+	var config execClusterConfig
+	if err := json.Unmarshal(cluster.Config.Raw, &config); err != nil {
+		logging.Debugf("failed to parse cluster config: %v", err)
+		return ""
+	}
+	return config.Destination
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestExecInfoDestination(t *testing.T) {
+	type testCase struct {
+		name     string
+		execInfo string
+		expected string
+	}
+
+	testCases := []testCase{
+		{
+			name:     "not set",
+			execInfo: "",
+		},
+		{
+			name:     "without cluster info",
+			execInfo: `{"apiVersion":"client.authentication.k8s.io/v1beta1","kind":"ExecCredential","spec":{"interactive":true}}`,
+		},
+		{
+			name: "with cluster config",
+			execInfo: `{"apiVersion":"client.authentication.k8s.io/v1beta1","kind":"ExecCredential","spec":{` +
+				`"cluster":{"server":"https://cluster.example.com","config":{"destination":"production"}},"interactive":true}}`,
+			expected: "production",
+		},
+		{
+			name:     "invalid",
+			execInfo: `{"spec":`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, execInfoDestination(tc.execInfo), tc.expected)
+		})
+	}
+}
@@ -109,21 +109,19 @@ $ infra users edit janedoe@example.com --password`,
 
 // Parses the error to see if it is a password requirements error (and prints it)
 func passwordError(cli *CLI, err error) bool {
-	if api.ErrorStatusCode(err) == 400 {
-		var apiError api.Error
-		if errors.As(err, &apiError) {
-			for _, fe := range apiError.FieldErrors {
-				if fe.FieldName == "password" {
-					fmt.Fprintln(cli.Stdout, "  New password does not meet the following requirements:")
-					for _, pwe := range fe.Errors {
-						fmt.Fprintf(cli.Stdout, "  - %s\n", pwe)
-					}
-					return true
-				}
-			}
-		}
+	var validationError api.ValidationError
+	if !errors.As(err, &validationError) {
+		return false
+	}
+	problems, ok := validationError.Fields()["password"]
+	if !ok {
+		return false
+	}
+	fmt.Fprintln(cli.Stdout, "  New password does not meet the following requirements:")
+	for _, pwe := range problems {
+		fmt.Fprintf(cli.Stdout, "  - %s\n", pwe)
 	}
-	return false
+	return true
 }
 
 func newUsersListCmd(cli *CLI) *cobra.Command {
@@ -14,17 +14,30 @@ import (
 	"gopkg.in/square/go-jose.v2"
 	"gopkg.in/square/go-jose.v2/jwt"
 
+	"github.com/infrahq/infra/api"
 	"github.com/infrahq/infra/internal/claims"
+	"github.com/infrahq/infra/tracing"
 )
 
 type authenticator struct {
 	mu          sync.Mutex
-	key         *jose.JSONWebKey
+	keys        []jose.JSONWebKey
 	lastChecked time.Time
 
 	client          httpClient
 	baseURL         string
 	serverAccessKey string
+
+	status *connectorStatus
+
+	// leeway is the clock skew allowed when checking the time claims of a JWT.
+	leeway time.Duration
+	// now is time.Now. It is a field so that tests can use a fake clock.
+	now func() time.Time
+
+	revokedMu sync.Mutex
+	// revoked maps the jti of revoked tokens to the time they expire.
+	revoked map[string]time.Time
 }
 
 type httpClient interface {
@@ -34,15 +47,39 @@ type httpClient interface {
 func newAuthenticator(options Options) *authenticator {
 	transport := httpTransportFromOptions(options.Server)
 	return &authenticator{
-		client:          &http.Client{Transport: transport},
+		client:          &http.Client{Transport: tracing.Transport(transport)},
 		baseURL:         options.Server.URL.String(),
 		serverAccessKey: options.Server.AccessKey.String(),
+		leeway:          options.ClockSkewLeeway,
+		now:             time.Now,
 	}
 }
 
 var JWKCacheRefresh = 5 * time.Minute
 
-func (j *authenticator) Authenticate(req *http.Request) (claims.Custom, error) {
+// jwkFetchError is returned by Authenticate when the JWK could not be fetched
+// from the infra API. Every request fails with the same error until the API is
+// available again.
+type jwkFetchError struct {
+	err error
+}
+
+func (e jwkFetchError) Error() string {
+	return "get JWK from server: " + e.err.Error()
+}
+
+func (e jwkFetchError) Unwrap() error {
+	return e.err
+}
+
+// Authenticate validates the bearer token in the request. If the token has an
+// audience, the audience must include the name of the destination. When
+// requireAudience is true a token without an audience is rejected, so that a
+// token created for one destination can not be used with another.
+func (j *authenticator) Authenticate(req *http.Request, destination string, requireAudience bool) (_ claims.Custom, err error) {
+	ctx, span := tracing.Start(req.Context(), "authenticate JWT")
+	defer func() { tracing.End(span, err) }()
+
 	c := claims.Custom{}
 	authHeader := req.Header.Get("Authorization")
 
@@ -56,9 +93,9 @@ func (j *authenticator) Authenticate(req *http.Request) (claims.Custom, error) {
 		return c, fmt.Errorf("invalid JWT signature: %w", err)
 	}
 
-	key, err := j.getJWK()
+	key, err := j.getJWK(ctx)
 	if err != nil {
-		return c, fmt.Errorf("get JWK from server: %w", err)
+		return c, jwkFetchError{err: err}
 	}
 
 	var allClaims struct {
@@ -69,7 +106,7 @@ func (j *authenticator) Authenticate(req *http.Request) (claims.Custom, error) {
 		return c, fmt.Errorf("invalid token claims: %w", err)
 	}
 
-	err = allClaims.Claims.Validate(jwt.Expected{Time: time.Now().UTC()})
+	err = allClaims.Claims.ValidateWithLeeway(jwt.Expected{Time: j.now().UTC()}, j.leeway)
 	switch {
 	case errors.Is(err, jwt.ErrExpired):
 		return c, err
@@ -77,6 +114,17 @@ func (j *authenticator) Authenticate(req *http.Request) (claims.Custom, error) {
 		return c, fmt.Errorf("invalid JWT %w", err)
 	}
 
+	switch {
+	case len(allClaims.Audience) > 0 && !allClaims.Audience.Contains(destination):
+		return c, fmt.Errorf("invalid JWT audience: token is not valid for destination %q", destination)
+	case len(allClaims.Audience) == 0 && requireAudience:
+		return c, fmt.Errorf("invalid JWT audience: token has no audience, destination %q requires one", destination)
+	}
+
+	if j.isRevoked(allClaims.ID) {
+		return c, fmt.Errorf("token has been revoked")
+	}
+
 	if allClaims.Custom.Name == "" {
 		return c, fmt.Errorf("no username in JWT claims")
 	}
@@ -84,15 +132,59 @@ func (j *authenticator) Authenticate(req *http.Request) (claims.Custom, error) {
 	return allClaims.Custom, nil
 }
 
-func (j *authenticator) getJWK() (*jose.JSONWebKey, error) {
+// revoke adds tokens to the tokens rejected by Authenticate. Tokens are
+// forgotten after they expire and the clock skew leeway has passed, because
+// Authenticate rejects them anyway.
+func (j *authenticator) revoke(tokens []api.RevokedToken) {
+	j.revokedMu.Lock()
+	defer j.revokedMu.Unlock()
+
+	now := j.now()
+	for id, expires := range j.revoked {
+		if now.After(expires.Add(j.leeway)) {
+			delete(j.revoked, id)
+		}
+	}
+	if len(tokens) > 0 && j.revoked == nil {
+		j.revoked = make(map[string]time.Time)
+	}
+	for _, token := range tokens {
+		j.revoked[token.ID] = time.Time(token.Expires)
+	}
+}
+
+func (j *authenticator) isRevoked(id string) bool {
+	if id == "" {
+		return false
+	}
+	j.revokedMu.Lock()
+	defer j.revokedMu.Unlock()
+	_, ok := j.revoked[id]
+	return ok
+}
+
+func (j *authenticator) getJWK(ctx context.Context) (*jose.JSONWebKey, error) {
+	keys, err := j.getJWKS(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return &keys[0], nil
+}
+
+// getJWKS returns the keys from the JWKS of the server. The keys are cached
+// for JWKCacheRefresh, unless refresh is true.
+func (j *authenticator) getJWKS(ctx context.Context, refresh bool) (_ []jose.JSONWebKey, err error) {
 	j.mu.Lock()
 	defer j.mu.Unlock()
 
-	if !j.lastChecked.IsZero() && time.Now().Before(j.lastChecked.Add(JWKCacheRefresh)) {
-		return j.key, nil
+	if !refresh && !j.lastChecked.IsZero() && time.Now().Before(j.lastChecked.Add(JWKCacheRefresh)) {
+		return j.keys, nil
 	}
 
-	req, err := http.NewRequestWithContext(context.TODO(), http.MethodGet, fmt.Sprintf("%s/.well-known/jwks.json", j.baseURL), nil)
+	ctx, span := tracing.Start(ctx, "fetch JWKS")
+	defer func() { tracing.End(span, err) }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/.well-known/jwks.json", j.baseURL), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -127,7 +219,52 @@ func (j *authenticator) getJWK() (*jose.JSONWebKey, error) {
 	}
 
 	j.lastChecked = time.Now().UTC()
-	j.key = &response.Keys[0]
+	j.keys = response.Keys
+	j.status.markJWKSRefreshed()
+
+	return response.Keys, nil
+}
+
+// verifySignature checks that signature is a valid signature of payload by one
+// of the keys in the JWKS of the server. When the signature was created with a
+// key that is not in the cached JWKS, the JWKS is fetched again, because the
+// server may have rotated its keys since the JWKS was cached. It returns the
+// protected header of the signature.
+func (j *authenticator) verifySignature(ctx context.Context, signature string, payload []byte) (jose.Header, error) {
+	jws, err := jose.ParseDetached(signature, payload)
+	if err != nil {
+		return jose.Header{}, fmt.Errorf("invalid signature: %w", err)
+	}
+	if len(jws.Signatures) != 1 {
+		return jose.Header{}, fmt.Errorf("invalid signature: expected 1 signature, got %d", len(jws.Signatures))
+	}
+	kid := jws.Signatures[0].Header.KeyID
 
-	return &response.Keys[0], nil
+	keys, err := j.getJWKS(ctx, false)
+	if err != nil {
+		return jose.Header{}, jwkFetchError{err: err}
+	}
+	key := findKey(keys, kid)
+	if key == nil {
+		if keys, err = j.getJWKS(ctx, true); err != nil {
+			return jose.Header{}, jwkFetchError{err: err}
+		}
+		if key = findKey(keys, kid); key == nil {
+			return jose.Header{}, fmt.Errorf("invalid signature: key %q is not in the JWKS from the server", kid)
+		}
+	}
+
+	if _, err := jws.Verify(key); err != nil {
+		return jose.Header{}, fmt.Errorf("invalid signature: %w", err)
+	}
+	return jws.Signatures[0].Protected, nil
+}
+
+func findKey(keys []jose.JSONWebKey, kid string) *jose.JSONWebKey {
+	for i := range keys {
+		if keys[i].KeyID == kid {
+			return &keys[i]
+		}
+	}
+	return nil
 }
@@ -9,17 +9,19 @@ import (
 	"log"
 	"net"
 	"net/http"
-	"net/http/httputil"
 	"strconv"
 	"strings"
 	"time"
 
 	backoff "github.com/cenkalti/backoff/v4"
 	"github.com/gin-gonic/gin"
-	"github.com/goware/urlx"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/client-go/rest"
 
 	"github.com/infrahq/infra/api"
 	"github.com/infrahq/infra/internal"
@@ -29,10 +31,23 @@ import (
 	"github.com/infrahq/infra/internal/logging"
 	"github.com/infrahq/infra/internal/repeat"
 	"github.com/infrahq/infra/metrics"
+	"github.com/infrahq/infra/tracing"
 	"github.com/infrahq/infra/uid"
 )
 
 func Run(ctx context.Context, options Options) error {
+	stopTracing, err := tracing.Setup(ctx, "infra-connector", options.Tracing)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		stopCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := stopTracing(stopCtx); err != nil {
+			logging.L.Warn().Err(err).Msg("failed to flush traces")
+		}
+	}()
+
 	switch options.Kind {
 	case "kubernetes":
 		return runKubernetesConnector(ctx, options)
@@ -49,6 +64,38 @@ type Options struct {
 	Name   string // TODO: make this required
 	Kind   string
 
+	// LogFormat is the format of the connector logs. One of json, console, or
+	// auto. When auto, logs are written as JSON unless the connector is being
+	// run in an interactive terminal.
+	LogFormat string
+
+	// LogFile is the path to a file where logs are written instead of stderr.
+	// Logs in the file are always written as JSON.
+	LogFile string
+	// LogRotation configures the rotation of LogFile.
+	LogRotation logging.FileLoggerOptions
+
+	// AccessLog configures the log line written for each HTTP request.
+	AccessLog logging.AccessLogOptions
+
+	// ForwardLogs sends warn and error logs to the infra server, where they
+	// can be read by support admins to troubleshoot the connector.
+	ForwardLogs bool
+
+	// Tracing configures the export of OpenTelemetry traces of proxied
+	// requests, and of the requests to the infra server.
+	Tracing tracing.Options
+
+	// RequireSignedSync rejects grants from the server that are not signed.
+	// Grants that are signed are always verified using the keys from the JWKS
+	// of the server, whether or not RequireSignedSync is set.
+	RequireSignedSync bool
+
+	// ClockSkewLeeway is the amount of time a JWT is accepted before its not
+	// before time, and after it expires, to allow for a difference between the
+	// clock of the connector and the clock of the infra server.
+	ClockSkewLeeway time.Duration
+
 	// EndpointAddr is the host:port address that clients should use to connect
 	// to this destination.
 	// If this value is empty then the host:port will be looked up.
@@ -64,6 +111,62 @@ type Options struct {
 	// Kubernetes specific options below here
 	CACert types.StringOrFile
 	CAKey  types.StringOrFile
+
+	// Destinations are additional kubernetes clusters that are served by
+	// this connector. The cluster where the connector is running is always
+	// registered using Name, and is served from the root path. Requests for
+	// additional destinations are served from /proxy/<name>/, and only accept
+	// tokens created for that destination.
+	Destinations []DestinationOptions
+}
+
+// DestinationOptions configure an additional kubernetes destination that is
+// served by the connector.
+type DestinationOptions struct {
+	Name string
+
+	// APIServer is the URL of the kubernetes API server for this destination.
+	APIServer types.URL `config:"apiServer"`
+	// CACert is the PEM encoded CA used to verify the certificate of the
+	// kubernetes API server.
+	CACert types.StringOrFile `config:"caCert"`
+	// ServiceAccountToken is the bearer token used by the connector to
+	// authenticate to the kubernetes API server.
+	ServiceAccountToken types.StringOrFile `config:"serviceAccountToken"`
+}
+
+func (o DestinationOptions) kubernetes() *kubernetes.Kubernetes {
+	return &kubernetes.Kubernetes{
+		Config: &rest.Config{
+			Host:        o.APIServer.String(),
+			BearerToken: o.ServiceAccountToken.String(),
+			TLSClientConfig: rest.TLSClientConfig{
+				CAData: []byte(o.CACert),
+			},
+		},
+	}
+}
+
+func validateDestinationOptions(opts Options) error {
+	names := map[string]bool{opts.Name: true}
+	for i, dest := range opts.Destinations {
+		switch {
+		case dest.Name == "":
+			return fmt.Errorf("missing destinations[%d].name", i)
+		case names[dest.Name]:
+			return fmt.Errorf("duplicate destination name %q", dest.Name)
+		case strings.ContainsAny(dest.Name, "/."):
+			return fmt.Errorf("destination name %q must not contain '/' or '.'", dest.Name)
+		case dest.APIServer.Host == "":
+			return fmt.Errorf("missing destinations[%d].apiServer", i)
+		case dest.CACert == "":
+			return fmt.Errorf("missing destinations[%d].caCert", i)
+		case dest.ServiceAccountToken == "":
+			return fmt.Errorf("missing destinations[%d].serviceAccountToken", i)
+		}
+		names[dest.Name] = true
+	}
+	return nil
 }
 
 type ServerOptions struct {
@@ -81,11 +184,12 @@ func (o Options) APIClient() *api.Client {
 		URL:       o.Server.URL.String(),
 		AccessKey: o.Server.AccessKey.String(),
 		HTTP: http.Client{
-			Transport: httpTransportFromOptions(o.Server),
+			Transport: tracing.Transport(httpTransportFromOptions(o.Server)),
 		},
 		Headers: http.Header{
 			"Infra-Destination-Name": {o.Name},
 		},
+		Retry: api.RetryPolicy{MaxRetries: 3},
 	}
 }
 
@@ -102,10 +206,33 @@ type connector struct {
 	destination *api.Destination
 	certCache   *CertCache
 	options     Options
+	status      *connectorStatus
+
+	// endpointK8s is the client used to lookup the endpoint address of the
+	// connector. When nil, k8s is used.
+	endpointK8s kubeClient
+	// proxyPath is the path appended to the endpoint address of the
+	// connector to build the connection URL for this destination. It is empty
+	// for the cluster where the connector is running.
+	proxyPath string
+	// authn receives the tokens revoked for this destination, and verifies the
+	// signature of its grants. It is nil when
+	// the connector does not authenticate requests with tokens.
+	authn *authenticator
+	// metrics are sent to the server with the registration of the
+	// destination. It is nil when metrics are not reported.
+	metrics *destinationMetrics
+}
+
+func (con connector) endpointClient() kubeClient {
+	if con.endpointK8s != nil {
+		return con.endpointK8s
+	}
+	return con.k8s
 }
 
 type apiClient interface {
-	ListGrants(ctx context.Context, req api.ListGrantsRequest) (*api.ListResponse[api.Grant], error)
+	ListGrants(ctx context.Context, req api.ListGrantsRequest) (*api.ListGrantsResponse, error)
 	ListDestinations(ctx context.Context, req api.ListDestinationsRequest) (*api.ListResponse[api.Destination], error)
 	CreateDestination(ctx context.Context, req *api.CreateDestinationRequest) (*api.Destination, error)
 	UpdateDestination(ctx context.Context, req api.UpdateDestinationRequest) (*api.Destination, error)
@@ -145,6 +272,10 @@ func runKubernetesConnector(ctx context.Context, options Options) error {
 		options.Name = autoname
 	}
 
+	if err := validateDestinationOptions(options); err != nil {
+		return err
+	}
+
 	certCache := NewCertCache([]byte(options.CACert), []byte(options.CAKey))
 
 	// Generate TLS certificates on the fly for clients
@@ -161,12 +292,6 @@ func runKubernetesConnector(ctx context.Context, options Options) error {
 		UniqueID: checkSum,
 	}
 
-	// clone the default http transport which sets reasonable defaults
-	defaultHTTPTransport, ok := http.DefaultTransport.(*http.Transport)
-	if !ok {
-		return errors.New("unexpected type for http.DefaultTransport")
-	}
-
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
@@ -203,6 +328,12 @@ func runKubernetesConnector(ctx context.Context, options Options) error {
 	}
 
 	group, ctx := errgroup.WithContext(ctx)
+	handleLogLevelSignals(ctx)
+	runLogForwarder(ctx, group, client, options)
+
+	status := &connectorStatus{}
+	authn := newAuthenticator(options)
+	authn.status = status
 
 	con := connector{
 		k8s:         k8s,
@@ -210,69 +341,74 @@ func runKubernetesConnector(ctx context.Context, options Options) error {
 		destination: destination,
 		certCache:   certCache,
 		options:     options,
+		status:      status,
+		authn:       authn,
+		metrics:     newDestinationMetrics(time.Now()),
 	}
-	group.Go(func() error {
-		backOff := &backoff.ExponentialBackOff{
-			InitialInterval:     2 * time.Second,
-			MaxInterval:         time.Minute,
-			RandomizationFactor: 0.2,
-			Multiplier:          1.5,
-		}
-		waiter := repeat.NewWaiter(backOff)
-		fn := func(ctx context.Context, grants []api.Grant) error {
-			return updateRoles(ctx, con.client, con.k8s, grants)
-		}
-		return syncGrantsToDestination(ctx, con, waiter, fn)
-	})
-	group.Go(func() error {
-		// TODO: how long should this wait? Use exponential backoff on error?
-		waiter := repeat.NewWaiter(backoff.NewConstantBackOff(30 * time.Second))
-		for {
-			if err := syncDestination(ctx, con); err != nil {
-				logging.Errorf("failed to update destination in infra: %v", err)
-			} else {
-				waiter.Reset()
-			}
-			if err := waiter.Wait(ctx); err != nil {
-				return err
-			}
-		}
-	})
+	runDestinationSync(ctx, group, con)
 
-	ginutil.SetMode()
-	router := gin.New()
-	router.GET("/healthz", func(c *gin.Context) {
-		c.Status(http.StatusOK)
-	})
+	httpErrorLog := log.New(logging.NewFilteredHTTPLogger(), "", 0)
 
-	kubeAPIAddr, err := urlx.Parse(k8s.Config.Host)
+	proxy, proxyTransport, err := newKubeProxy(k8s.Config.Host, k8s.Config.CAData, httpErrorLog)
 	if err != nil {
-		return fmt.Errorf("parsing host config: %w", err)
-	}
-
-	certPool := x509.NewCertPool()
-	if ok := certPool.AppendCertsFromPEM(k8s.Config.CAData); !ok {
-		return errors.New("could not append CA to client cert bundle")
+		return err
 	}
 
-	proxyTransport := defaultHTTPTransport.Clone()
-	proxyTransport.ForceAttemptHTTP2 = false
-	proxyTransport.TLSClientConfig = &tls.Config{
-		RootCAs:    certPool,
-		MinVersion: tls.VersionTLS12,
+	prober := upstreamProber{
+		client:      &http.Client{Transport: proxyTransport},
+		url:         strings.TrimSuffix(k8s.Config.Host, "/") + "/readyz",
+		bearerToken: k8s.Config.BearerToken,
+		status:      status,
 	}
+	group.Go(func() error {
+		return prober.run(ctx)
+	})
 
-	httpErrorLog := log.New(logging.NewFilteredHTTPLogger(), "", 0)
+	ginutil.SetMode()
+	router := gin.New()
+	// tracing is before the access log, so that log lines include the trace ID
+	router.Use(tracing.Middleware(), accessLogMiddleware(options.AccessLog))
+	router.GET("/healthz", healthHandler(status))
+	router.GET("/statusz", statusHandler(status))
+
+	metricsMiddleware := metrics.Middleware(promRegistry, metrics.MiddlewareOptions{})
+
+	// Additional destinations are registered before the middleware for the
+	// primary destination, so that the primary proxy does not apply to them.
+	for _, destOpts := range options.Destinations {
+		destK8s := destOpts.kubernetes()
+		destCon := connector{
+			k8s:    destK8s,
+			client: client,
+			destination: &api.Destination{
+				Name:     destOpts.Name,
+				Kind:     "kubernetes",
+				UniqueID: destK8s.Checksum(),
+			},
+			certCache:   certCache,
+			options:     options,
+			endpointK8s: k8s,
+			proxyPath:   proxyPathPrefix(destOpts.Name),
+			authn:       authn,
+			metrics:     newDestinationMetrics(time.Now()),
+		}
+		runDestinationSync(ctx, group, destCon)
 
-	proxy := httputil.NewSingleHostReverseProxy(kubeAPIAddr)
-	proxy.Transport = proxyTransport
-	proxy.ErrorLog = httpErrorLog
+		destProxy, _, err := newKubeProxy(destK8s.Config.Host, destK8s.Config.CAData, httpErrorLog)
+		if err != nil {
+			return fmt.Errorf("destination %v: %w", destOpts.Name, err)
+		}
+		router.Any(proxyPathPrefix(destOpts.Name)+"/*path",
+			metricsMiddleware,
+			stripProxyPrefix,
+			proxyMiddleware(destProxy, authn, destOpts.Name, true, destK8s.Config.BearerToken, destCon.metrics))
+	}
 
 	metricsServer := &http.Server{
 		ReadHeaderTimeout: 30 * time.Second,
 		ReadTimeout:       60 * time.Second,
 		Addr:              options.Addr.Metrics,
-		Handler:           metrics.NewHandler(promRegistry),
+		Handler:           metrics.NewHandler(promRegistry, metrics.HandlerOptions{}),
 		ErrorLog:          httpErrorLog,
 	}
 
@@ -285,9 +421,9 @@ func runKubernetesConnector(ctx context.Context, options Options) error {
 	})
 
 	healthOnlyRouter := gin.New()
-	healthOnlyRouter.GET("/healthz", func(c *gin.Context) {
-		c.Status(http.StatusOK)
-	})
+	healthOnlyRouter.Use(accessLogMiddleware(options.AccessLog))
+	healthOnlyRouter.GET("/healthz", healthHandler(status))
+	healthOnlyRouter.GET("/statusz", statusHandler(status))
 
 	plaintextServer := &http.Server{
 		ReadHeaderTimeout: 30 * time.Second,
@@ -305,10 +441,9 @@ func runKubernetesConnector(ctx context.Context, options Options) error {
 		return err
 	})
 
-	authn := newAuthenticator(options)
 	router.Use(
-		metrics.Middleware(promRegistry),
-		proxyMiddleware(proxy, authn, k8s.Config.BearerToken),
+		metricsMiddleware,
+		proxyMiddleware(proxy, authn, options.Name, false, k8s.Config.BearerToken, con.metrics),
 	)
 	tlsServer := &http.Server{
 		ReadHeaderTimeout: 30 * time.Second,
@@ -352,6 +487,49 @@ func runKubernetesConnector(ctx context.Context, options Options) error {
 	return err
 }
 
+// repeatedErrors samples errors that are logged on every attempt of a retry
+// loop, so that an unavailable infra API does not flood the logs.
+var repeatedErrors = logging.NewRepeatSampler(5, 5*time.Minute)
+
+// runDestinationSync starts the goroutines that register the destination with
+// the infra API, and sync grants from the infra API to role bindings in the
+// cluster.
+func runDestinationSync(ctx context.Context, group *errgroup.Group, con connector) {
+	group.Go(func() error {
+		backOff := &backoff.ExponentialBackOff{
+			InitialInterval:     2 * time.Second,
+			MaxInterval:         time.Minute,
+			RandomizationFactor: 0.2,
+			Multiplier:          1.5,
+		}
+		waiter := repeat.NewWaiter(backOff)
+		// grants are applied by this goroutine only, so an apply never
+		// overlaps the previous one.
+		return syncGrantsToDestination(ctx, con, waiter, func(ctx context.Context, grants []api.Grant) error {
+			return updateRoles(ctx, con.client, con.k8s, grants)
+		})
+	})
+	group.Go(func() error {
+		// TODO: how long should this wait? Use exponential backoff on error?
+		waiter := repeat.NewWaiter(backoff.NewConstantBackOff(30 * time.Second))
+		for {
+			if err := syncDestination(ctx, con); err != nil {
+				repeatedErrors.Event(&logging.L.Logger, zerolog.ErrorLevel, "sync-destination").
+					Stack().
+					Err(err).
+					Str("destination", con.destination.Name).
+					Msg("failed to update destination in infra")
+			} else {
+				con.status.markRegistered()
+				waiter.Reset()
+			}
+			if err := waiter.Wait(ctx); err != nil {
+				return err
+			}
+		}
+	})
+}
+
 func httpTransportFromOptions(opts ServerOptions) *http.Transport {
 	roots, err := x509.SystemCertPool()
 	if err != nil {
@@ -379,7 +557,7 @@ func syncDestination(ctx context.Context, con connector) error {
 	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
 	defer cancel()
 
-	endpoint, err := getEndpointHostPort(con.k8s, con.options)
+	endpoint, err := getEndpointHostPort(con.endpointClient(), con.options)
 	if err != nil {
 		logging.L.Warn().Err(err).Msg("could not get host")
 	}
@@ -415,7 +593,7 @@ func syncDestination(ctx context.Context, con connector) error {
 	switch {
 	case con.destination.ID == 0:
 		// TODO: move this warning somewhere earlier in startup
-		isClusterIP, err := con.k8s.IsServiceTypeClusterIP()
+		isClusterIP, err := con.endpointClient().IsServiceTypeClusterIP()
 		if err != nil {
 			logging.Debugf("could not determine service type: %v", err)
 		}
@@ -438,12 +616,20 @@ func syncDestination(ctx context.Context, con connector) error {
 		con.destination.Connection.CA = api.PEM(con.options.CACert)
 		fallthrough
 
-	case con.destination.Connection.URL != endpoint.String():
-		con.destination.Connection.URL = endpoint.String()
+	case con.metrics.reportDue(time.Now()):
+		// the metrics are sent with the registration, even when the
+		// destination has not changed
+		fallthrough
+
+	case con.destination.Connection.URL != connectionURL(endpoint, con.proxyPath):
+		con.destination.Connection.URL = connectionURL(endpoint, con.proxyPath)
 
-		if err := createOrUpdateDestination(ctx, con.client, con.destination); err != nil {
+		now := time.Now()
+		snapshot := con.metrics.snapshot(now)
+		if err := createOrUpdateDestination(ctx, con.client, con.destination, snapshot); err != nil {
 			return fmt.Errorf("create or update destination: %w", err)
 		}
+		con.metrics.reported(now, snapshot)
 	}
 	return nil
 }
@@ -461,11 +647,73 @@ func getEndpointHostPort(k8s kubeClient, opts Options) (types.HostPort, error) {
 	return types.HostPort{Host: host, Port: port}, nil
 }
 
+// connectionURL returns the address clients use to connect to a destination.
+func connectionURL(endpoint types.HostPort, proxyPath string) string {
+	return endpoint.String() + proxyPath
+}
+
 type waiter interface {
 	Reset()
 	Wait(ctx context.Context) error
 }
 
+// signedGrantsMaxAge is how long after it was signed a grants response is
+// accepted. The server signs a blocking request when it returns, so an older
+// response was replayed.
+const signedGrantsMaxAge = 5 * time.Minute
+
+// verifyGrants checks the grants from the server before they are applied to
+// the destination. Every grant must be for a resource of the destination. The
+// signature of the grants must be valid, so that grants modified after they
+// left the server are never applied. The signature must also be for this
+// destination, for the update index of the response, and no older than
+// appliedIndex, so that a response for another destination, or an old
+// response, can not be replayed.
+func verifyGrants(ctx context.Context, con connector, grants *api.ListGrantsResponse, appliedIndex int64) error {
+	for _, grant := range grants.Items {
+		if cluster, _, _ := strings.Cut(grant.Resource, "."); cluster != con.destination.Name {
+			return fmt.Errorf("grant %v is for resource %q, not for destination %q", grant.ID, grant.Resource, con.destination.Name)
+		}
+	}
+
+	if grants.Signature == "" || con.authn == nil {
+		if con.options.RequireSignedSync {
+			return errors.New("the response is not signed, and requireSignedSync is enabled")
+		}
+		return nil
+	}
+	header, err := con.authn.verifySignature(ctx, grants.Signature, grants.Payload)
+	if err != nil {
+		return err
+	}
+
+	extra := header.ExtraHeaders
+	if destination, _ := extra[api.SignatureHeaderDestination].(string); destination != con.destination.Name {
+		return fmt.Errorf("invalid signature: signed for destination %q, not %q", destination, con.destination.Name)
+	}
+
+	// numbers in the header are decoded as float64
+	index, ok := extra[api.SignatureHeaderUpdateIndex].(float64)
+	switch {
+	case !ok:
+		return errors.New("invalid signature: missing update index")
+	case int64(index) != grants.LastUpdateIndex.Index:
+		return fmt.Errorf("invalid signature: signed for update index %d, not %d", int64(index), grants.LastUpdateIndex.Index)
+	case int64(index) < appliedIndex:
+		return fmt.Errorf("invalid signature: update index %d is older than the applied update index %d", int64(index), appliedIndex)
+	}
+
+	issuedAt, ok := extra[api.SignatureHeaderIssuedAt].(float64)
+	if !ok {
+		return errors.New("invalid signature: missing issued at")
+	}
+	issued := time.Unix(int64(issuedAt), 0)
+	if con.authn.now().Sub(issued) > signedGrantsMaxAge+con.authn.leeway {
+		return fmt.Errorf("invalid signature: signed at %v, more than %v ago", issued.UTC(), signedGrantsMaxAge)
+	}
+	return nil
+}
+
 func syncGrantsToDestination(
 	ctx context.Context,
 	con connector,
@@ -473,18 +721,24 @@ func syncGrantsToDestination(
 	toDestination func(context.Context, []api.Grant) error,
 ) error {
 	var latestIndex int64 = 1
+	// appliedIndex is the update index of the last grants that were applied,
+	// or zero before any grants were applied.
+	var appliedIndex int64
 
-	sync := func(ctx context.Context) error {
+	sync := func(ctx context.Context) (err error) {
 		ctx, cancel := context.WithTimeout(ctx, 7*time.Minute)
 		defer cancel()
 
+		ctx, span := tracing.Start(ctx, "sync grants",
+			trace.WithAttributes(attribute.String("infra.destination", con.destination.Name)))
+		defer func() { tracing.End(span, err) }()
+
 		grants, err := con.client.ListGrants(ctx, api.ListGrantsRequest{
 			Destination:     con.destination.Name, // TODO: use options.Name when that is required
 			BlockingRequest: api.BlockingRequest{LastUpdateIndex: latestIndex},
 		})
-		var apiError api.Error
 		switch {
-		case errors.As(err, &apiError) && apiError.Code == http.StatusNotModified:
+		case errors.Is(err, api.ErrNotModified):
 			// not modified is expected when there are no changes
 			logging.L.Info().
 				Int64("updateIndex", latestIndex).
@@ -493,25 +747,39 @@ func syncGrantsToDestination(
 		case err != nil:
 			return fmt.Errorf("list grants: %w", err)
 		}
+		if err := verifyGrants(ctx, con, grants, appliedIndex); err != nil {
+			return fmt.Errorf("list grants: %w", err)
+		}
 		logging.L.Info().
 			Int64("updateIndex", grants.LastUpdateIndex.Index).
 			Int("grants", len(grants.Items)).
+			Int("revokedTokens", len(grants.RevokedTokens)).
 			Msg("received grants from server")
 
-		err = toDestination(ctx, grants.Items)
-		if err != nil {
+		// revoked tokens are rejected even if the grants fail to apply
+		if con.authn != nil {
+			con.authn.revoke(grants.RevokedTokens)
+		}
+
+		if err := applyGrants(ctx, toDestination, grants.Items); err != nil {
 			return fmt.Errorf("sync to destination: %w", err)
 		}
 
 		// Only update latestIndex once the entire operation was a success
 		latestIndex = grants.LastUpdateIndex.Index
+		appliedIndex = latestIndex
+		con.status.markRolesApplied()
 		return nil
 	}
 
 	for {
 		if err := sync(ctx); err != nil {
-			logging.L.Error().Err(err).Msg("sync grants to destination")
+			repeatedErrors.Event(&logging.L.Logger, zerolog.ErrorLevel, "sync-grants").
+				Stack().
+				Err(err).
+				Msg("sync grants to destination")
 		} else {
+			con.metrics.markGrantsSynced(time.Now())
 			waiter.Reset()
 		}
 
@@ -524,6 +792,15 @@ func syncGrantsToDestination(
 	}
 }
 
+// applyGrants calls toDestination in a span, so that the time spent updating
+// the destination can be told apart from the time spent waiting for the server.
+func applyGrants(ctx context.Context, toDestination func(context.Context, []api.Grant) error, grants []api.Grant) (err error) {
+	ctx, span := tracing.Start(ctx, "apply grants",
+		trace.WithAttributes(attribute.Int("infra.grants", len(grants))))
+	defer func() { tracing.End(span, err) }()
+	return toDestination(ctx, grants)
+}
+
 // UpdateRoles converts infra grants to role-bindings in the current cluster
 func updateRoles(ctx context.Context, c apiClient, k kubeClient, grants []api.Grant) error {
 	logging.Debugf("syncing local grants from infra configuration")
@@ -596,11 +873,12 @@ func updateRoles(ctx context.Context, c apiClient, k kubeClient, grants []api.Gr
 	return nil
 }
 
-// createOrUpdateDestination creates a destination in the infra server if it does not exist and updates it if it does
-func createOrUpdateDestination(ctx context.Context, client apiClient, local *api.Destination) error {
+// createOrUpdateDestination creates a destination in the infra server if it does not exist and updates it if it does.
+// metrics is sent with the destination when it is not nil.
+func createOrUpdateDestination(ctx context.Context, client apiClient, local *api.Destination, metrics *api.ConnectorMetrics) error {
 	// TODO: we probably don't want to cache the ID
 	if local.ID != 0 {
-		return updateDestination(ctx, client, local)
+		return updateDestination(ctx, client, local, metrics)
 	}
 
 	destinations, err := client.ListDestinations(ctx, api.ListDestinationsRequest{
@@ -612,7 +890,7 @@ func createOrUpdateDestination(ctx context.Context, client apiClient, local *api
 
 	if destinations.Count > 0 {
 		local.ID = destinations.Items[0].ID
-		return updateDestination(ctx, client, local)
+		return updateDestination(ctx, client, local, metrics)
 	}
 
 	request := &api.CreateDestinationRequest{
@@ -623,6 +901,7 @@ func createOrUpdateDestination(ctx context.Context, client apiClient, local *api
 		Connection: local.Connection,
 		Resources:  local.Resources,
 		Roles:      local.Roles,
+		Metrics:    metrics,
 	}
 
 	destination, err := client.CreateDestination(ctx, request)
@@ -635,7 +914,7 @@ func createOrUpdateDestination(ctx context.Context, client apiClient, local *api
 }
 
 // updateDestination updates a destination in the infra server
-func updateDestination(ctx context.Context, client apiClient, local *api.Destination) error {
+func updateDestination(ctx context.Context, client apiClient, local *api.Destination, metrics *api.ConnectorMetrics) error {
 	logging.Debugf("updating destination details")
 
 	request := api.UpdateDestinationRequest{
@@ -646,6 +925,7 @@ func updateDestination(ctx context.Context, client apiClient, local *api.Destina
 		Connection: local.Connection,
 		Resources:  local.Resources,
 		Roles:      local.Roles,
+		Metrics:    metrics,
 	}
 
 	if _, err := client.UpdateDestination(ctx, request); err != nil {
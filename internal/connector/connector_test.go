@@ -9,14 +9,24 @@ import (
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
 	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/square/go-jose.v2"
 	"gopkg.in/square/go-jose.v2/jwt"
 	"gotest.tools/v3/assert"
@@ -26,16 +36,18 @@ import (
 	"github.com/infrahq/infra/internal/claims"
 	"github.com/infrahq/infra/internal/kubernetes"
 	"github.com/infrahq/infra/internal/server"
+	"github.com/infrahq/infra/tracing"
 	"github.com/infrahq/infra/uid"
 )
 
 func TestAuthenticator_Authenticate(t *testing.T) {
 	type testCase struct {
-		name        string
-		setup       func(t *testing.T, req *http.Request)
-		fakeClient  fakeClient
-		expectedErr string
-		expected    func(t *testing.T, claims claims.Custom)
+		name            string
+		setup           func(t *testing.T, req *http.Request)
+		requireAudience bool
+		fakeClient      fakeClient
+		expectedErr     string
+		expected        func(t *testing.T, claims claims.Custom)
 	}
 
 	pub, priv := generateJWK(t)
@@ -53,7 +65,7 @@ func TestAuthenticator_Authenticate(t *testing.T) {
 		authn := newAuthenticator(opts)
 		authn.client = tc.fakeClient
 
-		actual, err := authn.Authenticate(req)
+		actual, err := authn.Authenticate(req, "the-dest", tc.requireAudience)
 		if tc.expectedErr != "" {
 			assert.ErrorContains(t, err, tc.expectedErr)
 			return
@@ -135,6 +147,48 @@ func TestAuthenticator_Authenticate(t *testing.T) {
 			fakeClient:  fakeClient{key: *pub, statusCode: http.StatusBadRequest},
 			expectedErr: "Bad Request",
 		},
+		{
+			name: "JWT for a different destination",
+			setup: func(t *testing.T, req *http.Request) {
+				j := generateJWT(t, priv, "test@example.com", time.Now().Add(time.Hour), "other-dest")
+				req.Header.Set("Authorization", "Bearer "+j)
+			},
+			fakeClient:  fakeClient{key: *pub},
+			expectedErr: `token is not valid for destination "the-dest"`,
+		},
+		{
+			name: "JWT with audience for this destination",
+			setup: func(t *testing.T, req *http.Request) {
+				j := generateJWT(t, priv, "test@example.com", time.Now().Add(time.Hour), "the-dest")
+				req.Header.Set("Authorization", "Bearer "+j)
+			},
+			fakeClient: fakeClient{key: *pub},
+			expected: func(t *testing.T, actual claims.Custom) {
+				assert.Equal(t, actual.Name, "test@example.com")
+			},
+		},
+		{
+			name: "JWT without audience for a destination that requires one",
+			setup: func(t *testing.T, req *http.Request) {
+				j := generateJWT(t, priv, "test@example.com", time.Now().Add(time.Hour))
+				req.Header.Set("Authorization", "Bearer "+j)
+			},
+			requireAudience: true,
+			fakeClient:      fakeClient{key: *pub},
+			expectedErr:     `destination "the-dest" requires one`,
+		},
+		{
+			name: "JWT with audience for a destination that requires one",
+			setup: func(t *testing.T, req *http.Request) {
+				j := generateJWT(t, priv, "test@example.com", time.Now().Add(time.Hour), "the-dest")
+				req.Header.Set("Authorization", "Bearer "+j)
+			},
+			requireAudience: true,
+			fakeClient:      fakeClient{key: *pub},
+			expected: func(t *testing.T, actual claims.Custom) {
+				assert.Equal(t, actual.Name, "test@example.com")
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -144,6 +198,47 @@ func TestAuthenticator_Authenticate(t *testing.T) {
 	}
 }
 
+func TestAuthenticator_Authenticate_ClockSkewLeeway(t *testing.T) {
+	pub, priv := generateJWK(t)
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.EdDSA, Key: priv}, (&jose.SignerOptions{}).WithType("JWT"))
+	assert.NilError(t, err)
+
+	issued := time.Now().Truncate(time.Second)
+	expiry := issued.Add(5 * time.Minute)
+	cl := jwt.Claims{
+		Expiry:    jwt.NewNumericDate(expiry),
+		NotBefore: jwt.NewNumericDate(issued),
+		IssuedAt:  jwt.NewNumericDate(issued),
+	}
+	raw, err := jwt.Signed(signer).Claims(cl).Claims(claims.Custom{Name: "test@example.com"}).CompactSerialize()
+	assert.NilError(t, err)
+
+	leeway := 30 * time.Second
+	opts := Options{
+		Server:          ServerOptions{AccessKey: "the-access-key"},
+		ClockSkewLeeway: leeway,
+	}
+	authn := newAuthenticator(opts)
+	authn.client = fakeClient{key: *pub}
+
+	authenticateAt := func(now time.Time) error {
+		authn.now = func() time.Time { return now }
+		req := httptest.NewRequest(http.MethodGet, "/apis", nil)
+		req.Header.Set("Authorization", "Bearer "+raw)
+		_, err := authn.Authenticate(req, "the-dest", false)
+		return err
+	}
+
+	t.Run("before not before", func(t *testing.T) {
+		assert.NilError(t, authenticateAt(issued.Add(-leeway+time.Second)))
+		assert.ErrorContains(t, authenticateAt(issued.Add(-leeway-time.Second)), "token not valid yet")
+	})
+	t.Run("after expiry", func(t *testing.T) {
+		assert.NilError(t, authenticateAt(expiry.Add(leeway-time.Second)))
+		assert.ErrorIs(t, authenticateAt(expiry.Add(leeway+time.Second)), jwt.ErrExpired)
+	})
+}
+
 func generateJWK(t *testing.T) (pub *jose.JSONWebKey, priv *jose.JSONWebKey) {
 	t.Helper()
 	pubkey, key, err := ed25519.GenerateKey(rand.Reader)
@@ -159,7 +254,7 @@ func generateJWK(t *testing.T) (pub *jose.JSONWebKey, priv *jose.JSONWebKey) {
 	return pub, priv
 }
 
-func generateJWT(t *testing.T, priv *jose.JSONWebKey, email string, expiry time.Time) string {
+func generateJWT(t *testing.T, priv *jose.JSONWebKey, email string, expiry time.Time, audience ...string) string {
 	t.Helper()
 	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.EdDSA, Key: priv}, (&jose.SignerOptions{}).WithType("JWT"))
 	assert.NilError(t, err)
@@ -168,6 +263,7 @@ func generateJWT(t *testing.T, priv *jose.JSONWebKey, email string, expiry time.
 		Issuer:   "InfraHQ",
 		Expiry:   jwt.NewNumericDate(expiry),
 		IssuedAt: jwt.NewNumericDate(time.Now()),
+		Audience: audience,
 	}
 
 	custom := claims.Custom{
@@ -289,13 +385,13 @@ func TestSyncGrantsToDestination_KubeBindings(t *testing.T) {
 		{
 			name: "successful update",
 			fakeAPI: &fakeAPIClient{
-				listGrantsResult: &api.ListResponse[api.Grant]{
+				listGrantsResult: &api.ListGrantsResponse{ListResponse: api.ListResponse[api.Grant]{
 					Items: []api.Grant{
-						{User: uid.ID(123), Resource: "the-test", Privilege: "view"},
-						{User: uid.ID(124), Resource: "the-test.ns1", Privilege: "logs"},
+						{User: uid.ID(123), Resource: "the-dest", Privilege: "view"},
+						{User: uid.ID(124), Resource: "the-dest.ns1", Privilege: "logs"},
 					},
 					LastUpdateIndex: api.LastUpdateIndex{Index: 42},
-				},
+				}},
 			},
 			expectedListGrantIndexes: []int64{1, 42},
 			successCount:             2,
@@ -318,12 +414,12 @@ func TestSyncGrantsToDestination_KubeBindings(t *testing.T) {
 		{
 			name: "failed to update kube",
 			fakeAPI: &fakeAPIClient{
-				listGrantsResult: &api.ListResponse[api.Grant]{
+				listGrantsResult: &api.ListGrantsResponse{ListResponse: api.ListResponse[api.Grant]{
 					Items: []api.Grant{
-						{User: uid.ID(123), Resource: "the-test", Privilege: "view"},
+						{User: uid.ID(123), Resource: "the-dest", Privilege: "view"},
 					},
 					LastUpdateIndex: api.LastUpdateIndex{Index: 42},
-				},
+				}},
 			},
 			expectedListGrantIndexes: []int64{1, 1},
 			fakeKube: &fakeKubeClient{
@@ -365,15 +461,34 @@ var errDone = fmt.Errorf("done")
 type fakeAPIClient struct {
 	api.Client
 
-	listGrantsResult  *api.ListResponse[api.Grant]
+	listGrantsResult  *api.ListGrantsResponse
 	listGrantsError   error
 	listGrantsIndexes []int64
+	// listGrantsResults are returned in order instead of listGrantsResult when
+	// set. The last result is returned by every call after it.
+	listGrantsResults []api.ListGrantsResponse
 
 	users map[uid.ID]api.User
+
+	// grantsByDestination is used instead of listGrantsResult when it is set
+	grantsByDestination map[string][]api.Grant
 }
 
-func (f *fakeAPIClient) ListGrants(ctx context.Context, req api.ListGrantsRequest) (*api.ListResponse[api.Grant], error) {
+func (f *fakeAPIClient) ListGrants(ctx context.Context, req api.ListGrantsRequest) (*api.ListGrantsResponse, error) {
 	f.listGrantsIndexes = append(f.listGrantsIndexes, req.LastUpdateIndex)
+	if f.grantsByDestination != nil {
+		grants := f.grantsByDestination[req.Destination]
+		return &api.ListGrantsResponse{
+			ListResponse: api.ListResponse[api.Grant]{Items: grants, LastUpdateIndex: api.LastUpdateIndex{Index: 2}},
+		}, nil
+	}
+	if len(f.listGrantsResults) > 0 {
+		i := len(f.listGrantsIndexes) - 1
+		if i >= len(f.listGrantsResults) {
+			i = len(f.listGrantsResults) - 1
+		}
+		return &f.listGrantsResults[i], nil
+	}
 	return f.listGrantsResult, f.listGrantsError
 }
 
@@ -404,3 +519,585 @@ func (f *fakeKubeClient) UpdateRoleBindings(subjects map[kubernetes.ClusterRoleN
 	f.updateRoleBindingsArgs = append(f.updateRoleBindingsArgs, subjects)
 	return f.updateBindingsError
 }
+
+func TestSyncGrantsToDestination_MultipleDestinations(t *testing.T) {
+	fakeAPI := &fakeAPIClient{
+		grantsByDestination: map[string][]api.Grant{
+			"primary": {
+				{User: uid.ID(123), Resource: "primary", Privilege: "view"},
+			},
+			"vcluster": {
+				{User: uid.ID(124), Resource: "vcluster.ns1", Privilege: "edit"},
+			},
+		},
+		users: map[uid.ID]api.User{
+			123: {Name: "primary-user@example.com"},
+			124: {Name: "vcluster-user@example.com"},
+		},
+	}
+
+	sync := func(t *testing.T, name string) *fakeKubeClient {
+		t.Helper()
+		fakeKube := &fakeKubeClient{}
+		con := connector{
+			k8s:         fakeKube,
+			client:      fakeAPI,
+			destination: &api.Destination{Name: name},
+		}
+		err := syncGrantsToDestination(context.Background(), con, &fakeWaiter{}, func(ctx context.Context, grants []api.Grant) error {
+			return updateRoles(ctx, con.client, con.k8s, grants)
+		})
+		assert.ErrorIs(t, err, errDone)
+		return fakeKube
+	}
+
+	primary := sync(t, "primary")
+	vcluster := sync(t, "vcluster")
+
+	userSubject := func(name string) rbacv1.Subject {
+		return rbacv1.Subject{APIGroup: "rbac.authorization.k8s.io", Kind: rbacv1.UserKind, Name: name}
+	}
+
+	assert.DeepEqual(t, primary.updateClusterRoleBindingsArgs, []map[string][]rbacv1.Subject{
+		{"view": {userSubject("primary-user@example.com")}},
+	})
+	assert.DeepEqual(t, primary.updateRoleBindingsArgs, []map[kubernetes.ClusterRoleNamespace][]rbacv1.Subject{{}})
+
+	assert.DeepEqual(t, vcluster.updateClusterRoleBindingsArgs, []map[string][]rbacv1.Subject{{}})
+	assert.DeepEqual(t, vcluster.updateRoleBindingsArgs, []map[kubernetes.ClusterRoleNamespace][]rbacv1.Subject{
+		{{ClusterRole: "edit", Namespace: "ns1"}: {userSubject("vcluster-user@example.com")}},
+	})
+}
+
+func TestSyncGrantsToDestination_AppliesDoNotOverlap(t *testing.T) {
+	var results []api.ListGrantsResponse
+	for i := int64(2); i < 6; i++ {
+		results = append(results, api.ListGrantsResponse{
+			ListResponse: api.ListResponse[api.Grant]{LastUpdateIndex: api.LastUpdateIndex{Index: i}},
+		})
+	}
+	con := connector{
+		k8s:         &fakeKubeClient{},
+		client:      &fakeAPIClient{listGrantsResults: results},
+		destination: &api.Destination{Name: "the-dest"},
+	}
+
+	var inFlight, maxInFlight, calls int32
+	fn := func(ctx context.Context, grants []api.Grant) error {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			current := atomic.LoadInt32(&maxInFlight)
+			if n <= current || atomic.CompareAndSwapInt32(&maxInFlight, current, n) {
+				break
+			}
+		}
+		atomic.AddInt32(&calls, 1)
+		// a slow apply, so that an overlapping apply would be observed
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}
+
+	err := syncGrantsToDestination(context.Background(), con, &fakeWaiter{endAtIndex: len(results) - 1}, fn)
+	assert.ErrorIs(t, err, errDone)
+	assert.Equal(t, atomic.LoadInt32(&calls), int32(len(results)))
+	assert.Equal(t, atomic.LoadInt32(&maxInFlight), int32(1))
+}
+
+func TestSyncGrantsToDestination_RevokedTokens(t *testing.T) {
+	pub, priv := generateJWK(t)
+
+	opts := Options{Server: ServerOptions{AccessKey: "the-access-key"}}
+	authn := newAuthenticator(opts)
+	authn.client = fakeClient{key: *pub}
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.EdDSA, Key: priv}, (&jose.SignerOptions{}).WithType("JWT"))
+	assert.NilError(t, err)
+	expires := time.Now().Add(time.Hour)
+	token := func(id string) string {
+		cl := jwt.Claims{
+			ID:       id,
+			Issuer:   "InfraHQ",
+			Expiry:   jwt.NewNumericDate(expires),
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		}
+		raw, err := jwt.Signed(signer).Claims(cl).Claims(claims.Custom{Name: "test@example.com"}).CompactSerialize()
+		assert.NilError(t, err)
+		return raw
+	}
+
+	authenticate := func(raw string) error {
+		req := httptest.NewRequest(http.MethodGet, "/apis", nil)
+		req.Header.Set("Authorization", "Bearer "+raw)
+		_, err := authn.Authenticate(req, "the-dest", false)
+		return err
+	}
+
+	revokedToken, otherToken := token("the-revoked-id"), token("the-other-id")
+	assert.NilError(t, authenticate(revokedToken))
+
+	con := connector{
+		k8s: &fakeKubeClient{},
+		client: &fakeAPIClient{
+			listGrantsResult: &api.ListGrantsResponse{
+				ListResponse: api.ListResponse[api.Grant]{LastUpdateIndex: api.LastUpdateIndex{Index: 42}},
+				RevokedTokens: []api.RevokedToken{
+					{ID: "the-revoked-id", Expires: api.Time(expires)},
+					{ID: "already-expired", Expires: api.Time(time.Now().Add(-time.Minute))},
+				},
+			},
+		},
+		destination: &api.Destination{Name: "the-dest"},
+		authn:       authn,
+	}
+	fn := func(ctx context.Context, grants []api.Grant) error {
+		return nil
+	}
+	err = syncGrantsToDestination(context.Background(), con, &fakeWaiter{endAtIndex: 1}, fn)
+	assert.ErrorIs(t, err, errDone)
+
+	assert.ErrorContains(t, authenticate(revokedToken), "token has been revoked")
+	assert.NilError(t, authenticate(otherToken))
+
+	// expired tokens are pruned, they are already rejected by expiry
+	authn.revoke(nil)
+	assert.Equal(t, len(authn.revoked), 1)
+}
+
+func TestAuthenticator_RevokeWithClockSkewLeeway(t *testing.T) {
+	pub, priv := generateJWK(t)
+
+	leeway := 30 * time.Second
+	opts := Options{
+		Server:          ServerOptions{AccessKey: "the-access-key"},
+		ClockSkewLeeway: leeway,
+	}
+	authn := newAuthenticator(opts)
+	authn.client = fakeClient{key: *pub}
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.EdDSA, Key: priv}, (&jose.SignerOptions{}).WithType("JWT"))
+	assert.NilError(t, err)
+	issued := time.Now().Truncate(time.Second)
+	expires := issued.Add(5 * time.Minute)
+	cl := jwt.Claims{
+		ID:       "the-revoked-id",
+		Expiry:   jwt.NewNumericDate(expires),
+		IssuedAt: jwt.NewNumericDate(issued),
+	}
+	raw, err := jwt.Signed(signer).Claims(cl).Claims(claims.Custom{Name: "test@example.com"}).CompactSerialize()
+	assert.NilError(t, err)
+
+	authenticateAt := func(now time.Time) error {
+		authn.now = func() time.Time { return now }
+		req := httptest.NewRequest(http.MethodGet, "/apis", nil)
+		req.Header.Set("Authorization", "Bearer "+raw)
+		_, err := authn.Authenticate(req, "the-dest", false)
+		return err
+	}
+
+	authn.revoke([]api.RevokedToken{{ID: "the-revoked-id", Expires: api.Time(expires)}})
+
+	// the token is accepted by expiry until the leeway has passed, so the
+	// revocation is kept until then
+	err = authenticateAt(expires.Add(leeway - time.Second))
+	assert.ErrorContains(t, err, "token has been revoked")
+	authn.revoke(nil)
+	assert.Equal(t, len(authn.revoked), 1)
+
+	err = authenticateAt(expires.Add(leeway + time.Second))
+	assert.ErrorIs(t, err, jwt.ErrExpired)
+	authn.revoke(nil)
+	assert.Equal(t, len(authn.revoked), 0)
+}
+
+func TestSyncGrantsToDestination_SignedGrants(t *testing.T) {
+	pub, priv := generateJWK(t)
+	rotatedPub, rotatedPriv := generateJWK(t)
+	_, unknownPriv := generateJWK(t)
+
+	grants := api.ListGrantsResponse{
+		ListResponse: api.ListResponse[api.Grant]{
+			Items:           []api.Grant{{User: uid.ID(123), Resource: "the-dest", Privilege: "view"}},
+			LastUpdateIndex: api.LastUpdateIndex{Index: 42},
+		},
+	}
+	payload, err := json.Marshal(grants)
+	assert.NilError(t, err)
+
+	now := time.Now()
+	headers := func(destination string, index int64, issued time.Time) map[string]interface{} {
+		return map[string]interface{}{
+			api.SignatureHeaderDestination: destination,
+			api.SignatureHeaderUpdateIndex: index,
+			api.SignatureHeaderIssuedAt:    issued.Unix(),
+		}
+	}
+	validHeaders := headers("the-dest", 42, now)
+
+	sign := func(t *testing.T, key *jose.JSONWebKey, payload []byte, headers map[string]interface{}) string {
+		t.Helper()
+		options := &jose.SignerOptions{}
+		for k, v := range headers {
+			options.WithHeader(jose.HeaderKey(k), v)
+		}
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.EdDSA, Key: key}, options)
+		assert.NilError(t, err)
+		jws, err := signer.Sign(payload)
+		assert.NilError(t, err)
+		sig, err := jws.DetachedCompactSerialize()
+		assert.NilError(t, err)
+		return sig
+	}
+
+	type testCase struct {
+		name              string
+		signature         string
+		payload           []byte
+		items             []api.Grant
+		requireSignedSync bool
+		// jwks is the key returned by the server after the cached key expires
+		jwks *jose.JSONWebKey
+		// before are the responses applied before the response under test
+		before      []api.ListGrantsResponse
+		expectApply bool
+		expectedErr string
+	}
+
+	run := func(t *testing.T, tc testCase) {
+		authn := newAuthenticator(Options{Server: ServerOptions{AccessKey: "the-access-key"}})
+		authn.client = fakeClient{key: *pub}
+		authn.now = func() time.Time { return now }
+		_, err := authn.getJWKS(context.Background(), false) // cache the current key
+		assert.NilError(t, err)
+		if tc.jwks != nil {
+			authn.client = fakeClient{key: *tc.jwks}
+		}
+
+		resp := grants
+		resp.Signature = tc.signature
+		resp.Payload = tc.payload
+		if tc.items != nil {
+			resp.Items = tc.items
+		}
+
+		con := connector{
+			k8s:         &fakeKubeClient{},
+			client:      &fakeAPIClient{listGrantsResults: append(tc.before, resp)},
+			destination: &api.Destination{Name: "the-dest"},
+			options:     Options{RequireSignedSync: tc.requireSignedSync},
+			authn:       authn,
+		}
+		var applied [][]api.Grant
+		fn := func(ctx context.Context, grants []api.Grant) error {
+			applied = append(applied, grants)
+			return nil
+		}
+		waiter := &fakeWaiter{endAtIndex: len(tc.before)}
+		err = syncGrantsToDestination(context.Background(), con, waiter, fn)
+		assert.ErrorIs(t, err, errDone)
+
+		if !tc.expectApply {
+			assert.Equal(t, len(applied), len(tc.before))
+			assert.Equal(t, len(waiter.resets), len(tc.before))
+
+			var appliedIndex int64
+			for _, r := range tc.before {
+				appliedIndex = r.LastUpdateIndex.Index
+			}
+			err := verifyGrants(context.Background(), con, &resp, appliedIndex)
+			assert.ErrorContains(t, err, tc.expectedErr)
+			return
+		}
+		assert.Equal(t, len(applied), len(tc.before)+1)
+		assert.DeepEqual(t, applied[len(applied)-1], grants.Items)
+		assert.Equal(t, len(waiter.resets), len(tc.before)+1)
+	}
+
+	tampered := bytes.Replace(payload, []byte(`"view"`), []byte(`"admin"`), 1)
+	assert.Assert(t, !bytes.Equal(tampered, payload))
+
+	newer := grants
+	newer.LastUpdateIndex.Index = 50
+	newer.Payload, err = json.Marshal(newer)
+	assert.NilError(t, err)
+	newer.Signature = sign(t, priv, newer.Payload, headers("the-dest", 50, now))
+
+	otherDest := grants
+	otherDest.Items = []api.Grant{{User: uid.ID(123), Resource: "other-dest", Privilege: "cluster-admin"}}
+	otherDestPayload, err := json.Marshal(otherDest)
+	assert.NilError(t, err)
+
+	testCases := []testCase{
+		{
+			name:        "signed",
+			signature:   sign(t, priv, payload, validHeaders),
+			payload:     payload,
+			expectApply: true,
+		},
+		{
+			name:              "signed with signed sync required",
+			signature:         sign(t, priv, payload, validHeaders),
+			payload:           payload,
+			requireSignedSync: true,
+			expectApply:       true,
+		},
+		{
+			name:        "tampered payload",
+			signature:   sign(t, priv, payload, validHeaders),
+			payload:     tampered,
+			expectedErr: "invalid signature",
+		},
+		{
+			name:        "signed by an unknown key",
+			signature:   sign(t, unknownPriv, payload, validHeaders),
+			payload:     payload,
+			expectedErr: "is not in the JWKS",
+		},
+		{
+			name:        "signed by a rotated key",
+			signature:   sign(t, rotatedPriv, payload, validHeaders),
+			payload:     payload,
+			jwks:        rotatedPub,
+			expectApply: true,
+		},
+		{
+			name:        "signed for another destination",
+			signature:   sign(t, priv, payload, headers("other-dest", 42, now)),
+			payload:     payload,
+			expectedErr: `signed for destination "other-dest", not "the-dest"`,
+		},
+		{
+			name:        "signed without headers",
+			signature:   sign(t, priv, payload, nil),
+			payload:     payload,
+			expectedErr: `signed for destination "", not "the-dest"`,
+		},
+		{
+			name:        "signed for a different update index",
+			signature:   sign(t, priv, payload, headers("the-dest", 43, now)),
+			payload:     payload,
+			expectedErr: "signed for update index 43, not 42",
+		},
+		{
+			name:        "replayed after a newer update index was applied",
+			signature:   sign(t, priv, payload, validHeaders),
+			payload:     payload,
+			before:      []api.ListGrantsResponse{newer},
+			expectedErr: "update index 42 is older than the applied update index 50",
+		},
+		{
+			name:        "replayed long after it was signed",
+			signature:   sign(t, priv, payload, headers("the-dest", 42, now.Add(-time.Hour))),
+			payload:     payload,
+			expectedErr: "more than 5m0s ago",
+		},
+		{
+			name:        "grants for another destination",
+			signature:   sign(t, priv, otherDestPayload, validHeaders),
+			payload:     otherDestPayload,
+			items:       otherDest.Items,
+			expectedErr: `is for resource "other-dest", not for destination "the-dest"`,
+		},
+		{
+			name:        "unsigned",
+			expectApply: true,
+		},
+		{
+			name:              "unsigned with signed sync required",
+			requireSignedSync: true,
+			expectedErr:       "not signed",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
+
+func TestProxy_AdditionalDestination(t *testing.T) {
+	pub, priv := generateJWK(t)
+
+	upstream := func(name string) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%v %v %v %v", name, r.URL.Path, r.Header.Get("Authorization"), r.Header.Get("Impersonate-User"))
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	newProxy := func(srv *httptest.Server) *httputil.ReverseProxy {
+		u, err := url.Parse(srv.URL)
+		assert.NilError(t, err)
+		return httputil.NewSingleHostReverseProxy(u)
+	}
+
+	opts := Options{Server: ServerOptions{AccessKey: "the-access-key"}}
+	authn := newAuthenticator(opts)
+	authn.client = fakeClient{key: *pub}
+
+	router := gin.New()
+	router.Any(proxyPathPrefix("vcluster")+"/*path",
+		stripProxyPrefix,
+		proxyMiddleware(newProxy(upstream("vcluster")), authn, "vcluster", true, "vcluster-token", nil))
+	router.Use(proxyMiddleware(newProxy(upstream("primary")), authn, "primary", false, "primary-token", nil))
+
+	type testCase struct {
+		path         string
+		audience     string
+		expectedCode int
+		expectedBody string
+	}
+
+	// httptest.ResponseRecorder does not support CloseNotify, which is
+	// required by the reverse proxy, so use a real server.
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	run := func(t *testing.T, tc testCase) {
+		ctx := context.Background()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+tc.path, nil)
+		assert.NilError(t, err)
+		var audience []string
+		if tc.audience != "" {
+			audience = []string{tc.audience}
+		}
+		j := generateJWT(t, priv, "test@example.com", time.Now().Add(time.Hour), audience...)
+		req.Header.Set("Authorization", "Bearer "+j)
+
+		resp, err := srv.Client().Do(req)
+		assert.NilError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, resp.StatusCode, tc.expectedCode)
+		if tc.expectedBody != "" {
+			body, err := io.ReadAll(resp.Body)
+			assert.NilError(t, err)
+			assert.Equal(t, string(body), tc.expectedBody)
+		}
+	}
+
+	testCases := map[string]testCase{
+		"primary destination": {
+			path:         "/api/v1/namespaces",
+			expectedCode: http.StatusOK,
+			expectedBody: "primary /api/v1/namespaces Bearer primary-token test@example.com",
+		},
+		"additional destination": {
+			path:         "/proxy/vcluster/api/v1/namespaces",
+			audience:     "vcluster",
+			expectedCode: http.StatusOK,
+			expectedBody: "vcluster /api/v1/namespaces Bearer vcluster-token test@example.com",
+		},
+		"additional destination without audience": {
+			path:         "/proxy/vcluster/api",
+			expectedCode: http.StatusUnauthorized,
+		},
+		"additional destination with audience of primary": {
+			path:         "/proxy/vcluster/api",
+			audience:     "primary",
+			expectedCode: http.StatusUnauthorized,
+		},
+		"primary destination with audience of additional destination": {
+			path:         "/api",
+			audience:     "vcluster",
+			expectedCode: http.StatusUnauthorized,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
+
+func TestValidateDestinationOptions(t *testing.T) {
+	valid := func() DestinationOptions {
+		d := DestinationOptions{
+			Name:                "vcluster",
+			CACert:              "the-ca",
+			ServiceAccountToken: "the-token",
+		}
+		assert.NilError(t, d.APIServer.Set("https://vcluster.example.com"))
+		return d
+	}
+
+	opts := Options{Name: "primary", Destinations: []DestinationOptions{valid()}}
+	assert.NilError(t, validateDestinationOptions(opts))
+
+	dup := valid()
+	dup.Name = "primary"
+	opts = Options{Name: "primary", Destinations: []DestinationOptions{dup}}
+	assert.ErrorContains(t, validateDestinationOptions(opts), `duplicate destination name "primary"`)
+
+	noToken := valid()
+	noToken.ServiceAccountToken = ""
+	opts = Options{Name: "primary", Destinations: []DestinationOptions{noToken}}
+	assert.ErrorContains(t, validateDestinationOptions(opts), "missing destinations[0].serviceAccountToken")
+}
+
+func TestProxy_Tracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	})
+
+	pub, priv := generateJWK(t)
+
+	var upstreamTraceparent string
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamTraceparent = r.Header.Get("traceparent")
+	}))
+	t.Cleanup(upstream.Close)
+	caData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw})
+
+	proxy, _, err := newKubeProxy(upstream.URL, caData, nil)
+	assert.NilError(t, err)
+
+	opts := Options{Server: ServerOptions{AccessKey: "the-access-key"}}
+	authn := newAuthenticator(opts)
+	authn.client = fakeClient{key: *pub}
+
+	router := gin.New()
+	router.Use(tracing.Middleware())
+	router.Use(proxyMiddleware(proxy, authn, "primary", false, "primary-token", nil))
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	// the trace started by kubectl, or by the CLI
+	traceID := trace.TraceID{0x0a, 0x0b}
+	callerSpanID := trace.SpanID{0x01}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL+"/api/v1/namespaces", nil)
+	assert.NilError(t, err)
+	j := generateJWT(t, priv, "test@example.com", time.Now().Add(time.Hour))
+	req.Header.Set("Authorization", "Bearer "+j)
+	req.Header.Set("traceparent", "00-"+traceID.String()+"-"+callerSpanID.String()+"-01")
+
+	resp, err := srv.Client().Do(req)
+	assert.NilError(t, err)
+	assert.NilError(t, resp.Body.Close())
+	assert.Equal(t, resp.StatusCode, http.StatusOK)
+
+	// spans are keyed by name and kind, because the server and client spans of
+	// a request have the same name
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		assert.Equal(t, span.SpanContext.TraceID(), traceID, span.Name)
+		spans[span.Name+" "+span.SpanKind.String()] = span
+	}
+	assert.Equal(t, len(spans), 4, spans)
+
+	// kubectl -> connector
+	connectorSpan := spans["HTTP GET server"]
+	assert.Equal(t, connectorSpan.Parent.SpanID(), callerSpanID)
+
+	authnSpan := spans["authenticate JWT internal"]
+	assert.Equal(t, authnSpan.Parent.SpanID(), connectorSpan.SpanContext.SpanID())
+	jwksSpan := spans["fetch JWKS internal"]
+	assert.Equal(t, jwksSpan.Parent.SpanID(), authnSpan.SpanContext.SpanID())
+
+	// connector -> kubernetes API server
+	proxySpan := spans["HTTP GET client"]
+	assert.Equal(t, proxySpan.Parent.SpanID(), connectorSpan.SpanContext.SpanID())
+	assert.Equal(t, upstreamTraceparent,
+		"00-"+traceID.String()+"-"+proxySpan.SpanContext.SpanID().String()+"-01")
+}
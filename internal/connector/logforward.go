@@ -0,0 +1,132 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	"github.com/rs/zerolog"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/repeat"
+	"github.com/infrahq/infra/uid"
+)
+
+const (
+	// forwardLogsBufferSize is the number of log entries kept by the connector
+	// while waiting to send them to the server.
+	forwardLogsBufferSize = 1000
+	// forwardLogsBatchSize is the maximum number of log entries sent to the
+	// server in a single request.
+	forwardLogsBatchSize = 200
+	// forwardLogsInterval is how often buffered log entries are sent.
+	forwardLogsInterval = 30 * time.Second
+)
+
+type logForwarderClient interface {
+	ListDestinations(ctx context.Context, req api.ListDestinationsRequest) (*api.ListResponse[api.Destination], error)
+	CreateDestinationLogs(ctx context.Context, req *api.CreateDestinationLogsRequest) error
+}
+
+// logForwarder sends the warn and error logs of the connector to the infra
+// server, so that they can be read by support admins. Log entries are kept in
+// a LogBuffer until they are sent. When the server can not be reached the
+// oldest entries are dropped, logging is never blocked.
+type logForwarder struct {
+	client          logForwarderClient
+	buffer          *logging.LogBuffer
+	destinationName string
+	batchSize       int
+
+	// destinationID is looked up from destinationName before the first batch
+	// is sent.
+	destinationID uid.ID
+}
+
+func newLogForwarder(client logForwarderClient, destinationName string) *logForwarder {
+	return &logForwarder{
+		client:          client,
+		buffer:          logging.NewLogBuffer(forwardLogsBufferSize, zerolog.WarnLevel),
+		destinationName: destinationName,
+		batchSize:       forwardLogsBatchSize,
+	}
+}
+
+// runLogForwarder starts forwarding logs to the infra server when it is
+// enabled by options.
+func runLogForwarder(ctx context.Context, group *errgroup.Group, client logForwarderClient, options Options) {
+	if !options.ForwardLogs {
+		return
+	}
+	forwarder := newLogForwarder(client, options.Name)
+	logging.ForwardLogs(forwarder.buffer)
+	group.Go(func() error {
+		waiter := repeat.NewWaiter(backoff.NewConstantBackOff(forwardLogsInterval))
+		return forwarder.run(ctx, waiter)
+	})
+}
+
+func (f *logForwarder) run(ctx context.Context, waiter *repeat.Waiter) error {
+	for {
+		if err := waiter.Wait(ctx); err != nil {
+			// send anything that is left before exiting
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			_ = f.flush(flushCtx)
+			cancel()
+			return err
+		}
+		if err := f.flush(ctx); err != nil {
+			// Logged at debug level, because warn or error entries would be
+			// added to the buffer that could not be sent.
+			logging.L.Debug().Err(err).Msg("failed to forward logs to the infra server")
+		}
+	}
+}
+
+// flush sends batches of log entries until the buffer is empty, or a batch
+// fails to send. Entries that fail to send are returned to the buffer.
+func (f *logForwarder) flush(ctx context.Context) error {
+	for {
+		entries, dropped := f.buffer.Take(f.batchSize)
+		if len(entries) == 0 && dropped == 0 {
+			return nil
+		}
+		if err := f.send(ctx, entries, dropped); err != nil {
+			f.buffer.Requeue(entries, dropped)
+			return err
+		}
+		if len(entries) < f.batchSize {
+			return nil
+		}
+	}
+}
+
+func (f *logForwarder) send(ctx context.Context, entries []logging.LogEntry, dropped int) error {
+	if f.destinationID == 0 {
+		destinations, err := f.client.ListDestinations(ctx, api.ListDestinationsRequest{Name: f.destinationName})
+		if err != nil {
+			return fmt.Errorf("list destinations: %w", err)
+		}
+		if destinations.Count == 0 {
+			return fmt.Errorf("destination %v is not registered", f.destinationName)
+		}
+		f.destinationID = destinations.Items[0].ID
+	}
+
+	req := &api.CreateDestinationLogsRequest{
+		ID:      f.destinationID,
+		Logs:    make([]api.DestinationLog, 0, len(entries)),
+		Dropped: dropped,
+	}
+	for _, entry := range entries {
+		req.Logs = append(req.Logs, api.DestinationLog{
+			Time:  api.Time(entry.Time),
+			Level: entry.Level.String(),
+			Line:  entry.Line,
+		})
+	}
+	return f.client.CreateDestinationLogs(ctx, req)
+}
@@ -0,0 +1,123 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/uid"
+)
+
+type fakeLogRegistry struct {
+	err      error
+	requests []api.CreateDestinationLogsRequest
+}
+
+func (f *fakeLogRegistry) ListDestinations(_ context.Context, req api.ListDestinationsRequest) (*api.ListResponse[api.Destination], error) {
+	if req.Name != "the-destination" {
+		return &api.ListResponse[api.Destination]{}, nil
+	}
+	return &api.ListResponse[api.Destination]{
+		Count: 1,
+		Items: []api.Destination{{ID: uid.ID(555), Name: req.Name}},
+	}, nil
+}
+
+func (f *fakeLogRegistry) CreateDestinationLogs(_ context.Context, req *api.CreateDestinationLogsRequest) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.requests = append(f.requests, *req)
+	return nil
+}
+
+func writeLogLines(t *testing.T, buf *logging.LogBuffer, start, count int) {
+	t.Helper()
+	for i := start; i < start+count; i++ {
+		_, err := buf.WriteLevel(zerolog.ErrorLevel, []byte(fmt.Sprintf(`{"message":"line %d"}`, i)))
+		assert.NilError(t, err)
+	}
+}
+
+func requestLines(req api.CreateDestinationLogsRequest) []string {
+	var result []string
+	for _, entry := range req.Logs {
+		result = append(result, entry.Line)
+	}
+	return result
+}
+
+func TestLogForwarder_Flush_SendsBatches(t *testing.T) {
+	registry := &fakeLogRegistry{}
+	forwarder := newLogForwarder(registry, "the-destination")
+	forwarder.batchSize = 2
+
+	writeLogLines(t, forwarder.buffer, 0, 5)
+
+	err := forwarder.flush(context.Background())
+	assert.NilError(t, err)
+
+	assert.Equal(t, len(registry.requests), 3)
+	for _, req := range registry.requests {
+		assert.Equal(t, req.ID, uid.ID(555))
+		assert.Equal(t, req.Dropped, 0)
+	}
+	assert.DeepEqual(t, requestLines(registry.requests[0]), []string{`{"message":"line 0"}`, `{"message":"line 1"}`})
+	assert.DeepEqual(t, requestLines(registry.requests[1]), []string{`{"message":"line 2"}`, `{"message":"line 3"}`})
+	assert.DeepEqual(t, requestLines(registry.requests[2]), []string{`{"message":"line 4"}`})
+	assert.Equal(t, registry.requests[0].Logs[0].Level, "error")
+
+	// nothing is sent when the buffer is empty
+	err = forwarder.flush(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, len(registry.requests), 3)
+}
+
+func TestLogForwarder_Flush_DropsOldestWhenSendFails(t *testing.T) {
+	registry := &fakeLogRegistry{err: errors.New("server is down")}
+	forwarder := newLogForwarder(registry, "the-destination")
+	forwarder.buffer = logging.NewLogBuffer(4, zerolog.WarnLevel)
+	forwarder.batchSize = 10
+
+	writeLogLines(t, forwarder.buffer, 0, 3)
+	err := forwarder.flush(context.Background())
+	assert.ErrorContains(t, err, "server is down")
+
+	// logging continues while the server is down, and does not block
+	writeLogLines(t, forwarder.buffer, 3, 3)
+	err = forwarder.flush(context.Background())
+	assert.ErrorContains(t, err, "server is down")
+
+	registry.err = nil
+	err = forwarder.flush(context.Background())
+	assert.NilError(t, err)
+
+	assert.Equal(t, len(registry.requests), 1)
+	req := registry.requests[0]
+	assert.DeepEqual(t, requestLines(req), []string{
+		`{"message":"line 2"}`,
+		`{"message":"line 3"}`,
+		`{"message":"line 4"}`,
+		`{"message":"line 5"}`,
+	})
+	assert.Equal(t, req.Dropped, 2)
+}
+
+func TestLogForwarder_Flush_DestinationNotRegistered(t *testing.T) {
+	registry := &fakeLogRegistry{}
+	forwarder := newLogForwarder(registry, "other")
+
+	writeLogLines(t, forwarder.buffer, 0, 2)
+	err := forwarder.flush(context.Background())
+	assert.ErrorContains(t, err, "destination other is not registered")
+
+	// the entries are kept until they can be sent
+	entries, _ := forwarder.buffer.Take(0)
+	assert.Equal(t, len(entries), 2)
+}
@@ -0,0 +1,45 @@
+package connector
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/uid"
+)
+
+// authenticatedUserKey is the key of the gin context value set by
+// proxyMiddleware to the name of the authenticated user.
+const authenticatedUserKey = "authenticatedUser"
+
+// accessLogMiddleware writes a log line for every request. The request context
+// is given a logger with the request ID, method, and path of the request.
+func accessLogMiddleware(opts logging.AccessLogOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		begin := time.Now()
+		healthCheck := c.Request.URL.Path == "/healthz"
+
+		ctx := logging.WithRequestID(c.Request.Context(), uid.New().String())
+		ctx = logging.WithFields(ctx,
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path)
+		c.Request = c.Request.WithContext(ctx)
+		logger := logging.FromContext(ctx)
+
+		c.Next()
+
+		event := logger.WithLevel(opts.EventLevel(healthCheck)).
+			Str("remoteAddr", c.ClientIP()).
+			Str("userAgent", c.Request.UserAgent())
+
+		if user := c.GetString(authenticatedUserKey); user != "" {
+			event = event.Str("user", user)
+		}
+
+		event.Dur("elapsed", time.Since(begin)).
+			Int("statusCode", c.Writer.Status()).
+			Int("size", c.Writer.Size()).
+			Msg("request completed")
+	}
+}
@@ -0,0 +1,63 @@
+package connector
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/logging"
+)
+
+func TestAccessLogMiddleware(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logging.PatchLogger(t, buf)
+
+	router := gin.New()
+	router.Use(accessLogMiddleware(logging.AccessLogOptions{DemoteHealthChecks: true}))
+	router.GET("/healthz", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.GET("/api/v1/pods", func(c *gin.Context) {
+		c.Set(authenticatedUserKey, "alice@example.com")
+		c.String(http.StatusForbidden, "forbidden")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, buf.Len(), 0, "health check should be logged at debug")
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil)
+	req.RemoteAddr = "10.1.1.1:4444"
+	req.Header.Set("User-Agent", "kubectl/v1.25")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]interface{}
+	assert.NilError(t, json.Unmarshal(buf.Bytes(), &entry), buf.String())
+
+	requestID, _ := entry["requestID"].(string)
+	assert.Assert(t, requestID != "")
+	elapsed, _ := entry["elapsed"].(float64)
+	assert.Assert(t, elapsed >= 0)
+
+	delete(entry, "requestID")
+	delete(entry, "elapsed")
+	delete(entry, "time")
+	delete(entry, "caller")
+	expected := map[string]interface{}{
+		"level":      "info",
+		"message":    "request completed",
+		"method":     "GET",
+		"path":       "/api/v1/pods",
+		"remoteAddr": "10.1.1.1",
+		"userAgent":  "kubectl/v1.25",
+		"user":       "alice@example.com",
+		"statusCode": float64(http.StatusForbidden),
+		"size":       float64(len("forbidden")),
+	}
+	assert.DeepEqual(t, entry, expected)
+}
@@ -0,0 +1,52 @@
+//go:build !windows
+
+package connector
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/infrahq/infra/internal/logging"
+)
+
+// debugLogLevelDuration is how long the connector logs at debug level after
+// receiving SIGUSR1.
+const debugLogLevelDuration = 15 * time.Minute
+
+// handleLogLevelSignals changes the log level when the connector receives a
+// signal. SIGUSR1 enables debug logging for debugLogLevelDuration, and SIGUSR2
+// changes the log level back to the previous level immediately.
+func handleLogLevelSignals(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-signals:
+				switch sig {
+				case syscall.SIGUSR1:
+					previous, err := logging.SetLevelWithRevert("debug", debugLogLevelDuration)
+					if err != nil {
+						logging.L.Warn().Err(err).Msg("failed to change log level")
+						continue
+					}
+					logging.L.Info().
+						Str("previousLevel", previous).
+						Dur("revertAfter", debugLogLevelDuration).
+						Msg("log level changed to debug")
+				case syscall.SIGUSR2:
+					if logging.RevertLevel() {
+						logging.L.Info().Str("level", logging.GetLevel()).Msg("log level reverted")
+					}
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package connector
+
+import "context"
+
+// handleLogLevelSignals is a no-op on windows, which does not support SIGUSR1
+// or SIGUSR2.
+func handleLogLevelSignals(_ context.Context) {}
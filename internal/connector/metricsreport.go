@@ -0,0 +1,102 @@
+package connector
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/infrahq/infra/api"
+)
+
+// reportMetricsInterval is how often a snapshot of the metrics of a
+// destination is sent to the server with the registration of the destination.
+const reportMetricsInterval = time.Minute
+
+// destinationMetrics counts the requests proxied to a destination, and records
+// when its grants were last synced, so that a snapshot can be sent to the
+// server. It is safe for concurrent use. A nil *destinationMetrics ignores
+// all updates, and never has a snapshot to report.
+type destinationMetrics struct {
+	mu sync.Mutex
+
+	// proxyRequests and proxyErrors are the counts since lastReport.
+	proxyRequests int64
+	proxyErrors   int64
+	lastReport    time.Time
+
+	lastGrantsSync time.Time
+}
+
+func newDestinationMetrics(now time.Time) *destinationMetrics {
+	return &destinationMetrics{lastReport: now}
+}
+
+// countRequest counts a proxied request that responded with status.
+func (m *destinationMetrics) countRequest(status int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.proxyRequests++
+	if status >= http.StatusInternalServerError {
+		m.proxyErrors++
+	}
+}
+
+// markGrantsSynced records that the grants of the destination are up to date
+// with the server, either because they were applied, or because the server
+// reported no changes.
+func (m *destinationMetrics) markGrantsSynced(now time.Time) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastGrantsSync = now
+}
+
+// reportDue returns true when a snapshot should be sent with the next
+// registration.
+func (m *destinationMetrics) reportDue(now time.Time) bool {
+	if m == nil {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return now.Sub(m.lastReport) >= reportMetricsInterval
+}
+
+// snapshot returns the metrics since the last report. The counts are not
+// reset until reported is called, so that a snapshot which failed to send is
+// included in the next one. Returns nil when m is nil.
+func (m *destinationMetrics) snapshot(now time.Time) *api.ConnectorMetrics {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := &api.ConnectorMetrics{
+		PeriodSeconds: now.Sub(m.lastReport).Seconds(),
+		ProxyRequests: m.proxyRequests,
+		ProxyErrors:   m.proxyErrors,
+	}
+	if !m.lastGrantsSync.IsZero() {
+		lag := now.Sub(m.lastGrantsSync).Seconds()
+		result.SyncLagSeconds = &lag
+	}
+	return result
+}
+
+// reported removes the counts of a snapshot taken at now, after it was sent
+// to the server.
+func (m *destinationMetrics) reported(now time.Time, snapshot *api.ConnectorMetrics) {
+	if m == nil || snapshot == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.proxyRequests -= snapshot.ProxyRequests
+	m.proxyErrors -= snapshot.ProxyErrors
+	m.lastReport = now
+}
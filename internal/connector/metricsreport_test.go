@@ -0,0 +1,112 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestDestinationMetrics_Snapshot(t *testing.T) {
+	start := time.Date(2023, 2, 16, 10, 0, 0, 0, time.UTC)
+	metrics := newDestinationMetrics(start)
+
+	assert.Assert(t, !metrics.reportDue(start.Add(30*time.Second)))
+	assert.Assert(t, metrics.reportDue(start.Add(time.Minute)))
+
+	metrics.countRequest(http.StatusOK)
+	metrics.countRequest(http.StatusForbidden)
+	metrics.countRequest(http.StatusBadGateway)
+
+	// the grants were never synced, so there is no lag
+	now := start.Add(time.Minute)
+	snapshot := metrics.snapshot(now)
+	expected := &api.ConnectorMetrics{PeriodSeconds: 60, ProxyRequests: 3, ProxyErrors: 1}
+	assert.DeepEqual(t, snapshot, expected)
+
+	t.Run("a snapshot that was not reported is included in the next", func(t *testing.T) {
+		metrics.countRequest(http.StatusServiceUnavailable)
+		metrics.markGrantsSynced(start.Add(50 * time.Second))
+
+		now := start.Add(90 * time.Second)
+		snapshot := metrics.snapshot(now)
+		lag := 40.0
+		expected := &api.ConnectorMetrics{PeriodSeconds: 90, ProxyRequests: 4, ProxyErrors: 2, SyncLagSeconds: &lag}
+		assert.DeepEqual(t, snapshot, expected)
+
+		metrics.countRequest(http.StatusOK)
+		metrics.reported(now, snapshot)
+		assert.Assert(t, !metrics.reportDue(now))
+
+		now = now.Add(time.Minute)
+		lag = 100
+		expected = &api.ConnectorMetrics{PeriodSeconds: 60, ProxyRequests: 1, SyncLagSeconds: &lag}
+		assert.DeepEqual(t, metrics.snapshot(now), expected)
+	})
+}
+
+func TestDestinationMetrics_Nil(t *testing.T) {
+	var metrics *destinationMetrics
+	now := time.Now()
+	// none of these panic
+	metrics.countRequest(http.StatusOK)
+	metrics.markGrantsSynced(now)
+	metrics.reported(now, nil)
+	assert.Assert(t, !metrics.reportDue(now))
+	assert.Assert(t, metrics.snapshot(now) == nil)
+}
+
+type fakeRegistrationClient struct {
+	fakeAPIClient
+	created []api.CreateDestinationRequest
+	updated []api.UpdateDestinationRequest
+}
+
+func (f *fakeRegistrationClient) ListDestinations(_ context.Context, req api.ListDestinationsRequest) (*api.ListResponse[api.Destination], error) {
+	if req.Name != "the-destination" {
+		return &api.ListResponse[api.Destination]{}, nil
+	}
+	return &api.ListResponse[api.Destination]{
+		Count: 1,
+		Items: []api.Destination{{ID: uid.ID(555), Name: req.Name}},
+	}, nil
+}
+
+func (f *fakeRegistrationClient) CreateDestination(_ context.Context, req *api.CreateDestinationRequest) (*api.Destination, error) {
+	f.created = append(f.created, *req)
+	return &api.Destination{ID: uid.ID(777), Name: req.Name}, nil
+}
+
+func (f *fakeRegistrationClient) UpdateDestination(_ context.Context, req api.UpdateDestinationRequest) (*api.Destination, error) {
+	f.updated = append(f.updated, req)
+	return &api.Destination{ID: req.ID, Name: req.Name}, nil
+}
+
+func TestCreateOrUpdateDestination_SendsMetrics(t *testing.T) {
+	client := &fakeRegistrationClient{}
+	ctx := context.Background()
+	lag := 12.0
+	snapshot := &api.ConnectorMetrics{PeriodSeconds: 60, ProxyRequests: 20, ProxyErrors: 2, SyncLagSeconds: &lag}
+
+	existing := &api.Destination{Name: "the-destination", Kind: "kubernetes"}
+	assert.NilError(t, createOrUpdateDestination(ctx, client, existing, snapshot))
+	assert.Equal(t, len(client.updated), 1)
+	assert.Equal(t, client.updated[0].ID, uid.ID(555))
+	assert.DeepEqual(t, client.updated[0].Metrics, snapshot)
+
+	created := &api.Destination{Name: "new-destination", Kind: "kubernetes"}
+	assert.NilError(t, createOrUpdateDestination(ctx, client, created, snapshot))
+	assert.Equal(t, len(client.created), 1)
+	assert.DeepEqual(t, client.created[0].Metrics, snapshot)
+	assert.Equal(t, created.ID, uid.ID(777))
+
+	// metrics are omitted when there is no snapshot
+	assert.NilError(t, createOrUpdateDestination(ctx, client, existing, nil))
+	assert.Equal(t, len(client.updated), 2)
+	assert.Assert(t, client.updated[1].Metrics == nil)
+}
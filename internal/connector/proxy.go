@@ -3,30 +3,43 @@ package connector
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"net/http/httputil"
 	"sync"
 
 	"github.com/gin-gonic/gin"
+	"github.com/goware/urlx"
+	"github.com/rs/zerolog"
 
 	"github.com/infrahq/infra/internal/certs"
 	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/tracing"
 )
 
 func proxyMiddleware(
 	proxy *httputil.ReverseProxy,
 	authn *authenticator,
+	destination string,
+	requireAudience bool,
 	bearerToken string,
+	metrics *destinationMetrics,
 ) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		claim, err := authn.Authenticate(c.Request)
+		claim, err := authn.Authenticate(c.Request, destination, requireAudience)
 		if err != nil {
-			logging.L.Info().Err(err).Msgf("failed to authenticate request")
+			event := logging.L.Info()
+			if errors.As(err, &jwkFetchError{}) {
+				event = repeatedErrors.Event(&logging.L.Logger, zerolog.WarnLevel, "fetch-jwk")
+			}
+			event.Err(err).Msg("failed to authenticate request")
 			c.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
 
+		c.Set(authenticatedUserKey, claim.Name)
 		c.Request.Header.Set("Impersonate-User", claim.Name)
 		for _, g := range claim.Groups {
 			c.Request.Header.Add("Impersonate-Group", g)
@@ -34,9 +47,59 @@ func proxyMiddleware(
 
 		c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", bearerToken))
 		proxy.ServeHTTP(c.Writer, c.Request)
+		metrics.countRequest(c.Writer.Status())
 	}
 }
 
+// proxyPathPrefix returns the URL path used to proxy requests to an additional
+// destination.
+func proxyPathPrefix(destination string) string {
+	return "/proxy/" + destination
+}
+
+// stripProxyPrefix removes the /proxy/<destination> prefix from the request
+// path, so that the request can be sent to the kubernetes API server of
+// the destination.
+func stripProxyPrefix(c *gin.Context) {
+	c.Request.URL.Path = c.Param("path")
+	c.Request.URL.RawPath = ""
+}
+
+// newKubeProxy returns a reverse proxy to the kubernetes API server
+// identified by host. caData is the PEM encoded CA used to verify the
+// certificate of the API server.
+func newKubeProxy(host string, caData []byte, errorLog *log.Logger) (*httputil.ReverseProxy, *http.Transport, error) {
+	kubeAPIAddr, err := urlx.Parse(host)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing host config: %w", err)
+	}
+
+	certPool := x509.NewCertPool()
+	if ok := certPool.AppendCertsFromPEM(caData); !ok {
+		return nil, nil, errors.New("could not append CA to client cert bundle")
+	}
+
+	// clone the default http transport which sets reasonable defaults
+	defaultHTTPTransport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, nil, errors.New("unexpected type for http.DefaultTransport")
+	}
+
+	proxyTransport := defaultHTTPTransport.Clone()
+	proxyTransport.ForceAttemptHTTP2 = false
+	proxyTransport.TLSClientConfig = &tls.Config{
+		RootCAs:    certPool,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(kubeAPIAddr)
+	// the transport adds the traceparent of the proxied request, so that the
+	// trace continues to the kubernetes API server
+	proxy.Transport = tracing.Transport(proxyTransport)
+	proxy.ErrorLog = errorLog
+	return proxy, proxyTransport, nil
+}
+
 type CertCache struct {
 	mu     sync.Mutex
 	caCert []byte
@@ -53,6 +53,7 @@ func runSSHConnector(ctx context.Context, opts Options) error {
 	}
 
 	group, ctx := errgroup.WithContext(ctx)
+	runLogForwarder(ctx, group, client, opts)
 	group.Go(func() error {
 		backOff := &backoff.ExponentialBackOff{
 			InitialInterval:     2 * time.Second,
@@ -118,7 +119,7 @@ func registerSSHConnector(ctx context.Context, client apiClient, opts Options) (
 		},
 		// TODO: Roles - the groups available on the system,
 	}
-	err = createOrUpdateDestination(ctx, client, destination)
+	err = createOrUpdateDestination(ctx, client, destination, nil)
 	if err != nil {
 		return nil, err
 	}
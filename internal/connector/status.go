@@ -0,0 +1,181 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/repeat"
+)
+
+// connectorStatus records the time of the most recent successful operations
+// performed by the connector. It is safe for concurrent use. A nil
+// *connectorStatus ignores all updates, so that tests and other callers do
+// not need to provide one.
+type connectorStatus struct {
+	mu sync.Mutex
+
+	lastRegistration time.Time
+	lastRolesApply   time.Time
+	lastJWKSRefresh  time.Time
+
+	upstreamLatency   time.Duration
+	upstreamCheckedAt time.Time
+	upstreamErr       error
+}
+
+func (s *connectorStatus) markRegistered() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastRegistration = time.Now()
+}
+
+func (s *connectorStatus) markRolesApplied() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastRolesApply = time.Now()
+}
+
+func (s *connectorStatus) markJWKSRefreshed() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastJWKSRefresh = time.Now()
+}
+
+func (s *connectorStatus) recordUpstreamProbe(latency time.Duration, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.upstreamLatency = latency
+	s.upstreamCheckedAt = time.Now()
+	s.upstreamErr = err
+}
+
+// StatusResponse is the JSON document returned by /statusz and
+// /healthz?verbose=true. Ages and latencies are in seconds. A nil value
+// indicates the operation has not completed successfully since the connector
+// started.
+type StatusResponse struct {
+	LastRegistrationAge *float64 `json:"lastRegistrationAgeSeconds"`
+	LastRolesApplyAge   *float64 `json:"lastRoleBindingApplyAgeSeconds"`
+	LastJWKSRefreshAge  *float64 `json:"lastJWKSRefreshAgeSeconds"`
+	UpstreamLatency     *float64 `json:"upstreamLatencySeconds"`
+	UpstreamLatencyAge  *float64 `json:"upstreamLatencySampleAgeSeconds"`
+	UpstreamError       string   `json:"upstreamError,omitempty"`
+}
+
+func (s *connectorStatus) response(now time.Time) StatusResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resp := StatusResponse{
+		LastRegistrationAge: secondsSince(now, s.lastRegistration),
+		LastRolesApplyAge:   secondsSince(now, s.lastRolesApply),
+		LastJWKSRefreshAge:  secondsSince(now, s.lastJWKSRefresh),
+		UpstreamLatencyAge:  secondsSince(now, s.upstreamCheckedAt),
+	}
+	if !s.upstreamCheckedAt.IsZero() {
+		latency := s.upstreamLatency.Seconds()
+		resp.UpstreamLatency = &latency
+	}
+	if s.upstreamErr != nil {
+		resp.UpstreamError = s.upstreamErr.Error()
+	}
+	return resp
+}
+
+func secondsSince(now, t time.Time) *float64 {
+	if t.IsZero() {
+		return nil
+	}
+	age := now.Sub(t).Seconds()
+	return &age
+}
+
+// healthHandler responds with a plain 200 OK for liveness probes. When the
+// request includes verbose=true, the response is the JSON status document.
+func healthHandler(status *connectorStatus) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Query("verbose") == "true" {
+			c.JSON(http.StatusOK, status.response(time.Now()))
+			return
+		}
+		c.Status(http.StatusOK)
+	}
+}
+
+// statusHandler responds with the JSON status document.
+func statusHandler(status *connectorStatus) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, status.response(time.Now()))
+	}
+}
+
+// upstreamProber periodically sends a request to the readiness endpoint of
+// the upstream API server, and records the latency of the response.
+type upstreamProber struct {
+	client      *http.Client
+	url         string
+	bearerToken string
+	status      *connectorStatus
+}
+
+var upstreamProbeInterval = 15 * time.Second
+
+func (p upstreamProber) run(ctx context.Context) error {
+	waiter := repeat.NewWaiter(backoff.NewConstantBackOff(upstreamProbeInterval))
+	for {
+		latency, err := p.probe(ctx)
+		if err != nil {
+			logging.L.Debug().Err(err).Msg("upstream API server probe failed")
+		}
+		p.status.recordUpstreamProbe(latency, err)
+
+		if err := waiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+func (p upstreamProber) probe(ctx context.Context) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	if p.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+p.bearerToken)
+	}
+
+	start := time.Now()
+	resp, err := p.client.Do(req)
+	latency := time.Since(start)
+	if err != nil {
+		return latency, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return latency, fmt.Errorf("unexpected response: %v", resp.Status)
+	}
+	return latency, nil
+}
@@ -0,0 +1,102 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+)
+
+func TestHealthHandler(t *testing.T) {
+	status := &connectorStatus{}
+	router := gin.New()
+	router.GET("/healthz", healthHandler(status))
+	router.GET("/statusz", statusHandler(status))
+
+	get := func(t *testing.T, path string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, resp.Code, http.StatusOK)
+		return resp
+	}
+
+	t.Run("plain healthz", func(t *testing.T) {
+		resp := get(t, "/healthz")
+		assert.Equal(t, resp.Body.Len(), 0)
+	})
+
+	t.Run("no activity", func(t *testing.T) {
+		resp := get(t, "/statusz")
+
+		var actual StatusResponse
+		assert.NilError(t, json.NewDecoder(resp.Body).Decode(&actual))
+		assert.DeepEqual(t, actual, StatusResponse{})
+	})
+
+	t.Run("after activity", func(t *testing.T) {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, r.URL.Path, "/readyz")
+			assert.Equal(t, r.Header.Get("Authorization"), "Bearer the-token")
+		}))
+		t.Cleanup(upstream.Close)
+
+		prober := upstreamProber{
+			client:      upstream.Client(),
+			url:         upstream.URL + "/readyz",
+			bearerToken: "the-token",
+			status:      status,
+		}
+		latency, err := prober.probe(context.Background())
+		assert.NilError(t, err)
+		status.recordUpstreamProbe(latency, err)
+
+		con := connector{
+			client: &fakeAPIClient{
+				listGrantsResult: &api.ListGrantsResponse{ListResponse: api.ListResponse[api.Grant]{
+					LastUpdateIndex: api.LastUpdateIndex{Index: 42},
+				}},
+			},
+			destination: &api.Destination{Name: "the-dest"},
+			status:      status,
+		}
+		fn := func(ctx context.Context, grants []api.Grant) error { return nil }
+		err = syncGrantsToDestination(context.Background(), con, &fakeWaiter{}, fn)
+		assert.ErrorIs(t, err, errDone)
+
+		status.markRegistered()
+		status.markJWKSRefreshed()
+
+		for _, path := range []string{"/statusz", "/healthz?verbose=true"} {
+			resp := get(t, path)
+
+			var actual StatusResponse
+			assert.NilError(t, json.NewDecoder(resp.Body).Decode(&actual))
+			assert.Assert(t, actual.LastRegistrationAge != nil, path)
+			assert.Assert(t, actual.LastRolesApplyAge != nil, path)
+			assert.Assert(t, actual.LastJWKSRefreshAge != nil, path)
+			assert.Assert(t, actual.UpstreamLatency != nil, path)
+			assert.Assert(t, *actual.UpstreamLatency > 0, path)
+			assert.Assert(t, actual.UpstreamLatencyAge != nil, path)
+			assert.Equal(t, actual.UpstreamError, "", path)
+		}
+	})
+}
+
+func TestUpstreamProber_Error(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(upstream.Close)
+
+	prober := upstreamProber{client: upstream.Client(), url: upstream.URL + "/readyz"}
+	_, err := prober.probe(context.Background())
+	assert.ErrorContains(t, err, "503 Service Unavailable")
+}
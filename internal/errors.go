@@ -16,4 +16,7 @@ var (
 	ErrNotModified = fmt.Errorf("not modified")
 	ErrBadRequest  = fmt.Errorf("bad request")
 	ErrExpired     = fmt.Errorf("expired")
+	// ErrPreconditionFailed means the If-Match header of the request did not
+	// match the current version of the resource.
+	ErrPreconditionFailed = fmt.Errorf("precondition failed")
 )
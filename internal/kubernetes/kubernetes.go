@@ -24,6 +24,7 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/retry"
 
 	"github.com/infrahq/infra/internal/logging"
 )
@@ -64,12 +65,23 @@ func (k *Kubernetes) UpdateClusterRoleBindings(subjects map[string][]rbacv1.Subj
 		return err
 	}
 
+	summary, err := updateClusterRoleBindings(clientset, subjects)
+	if err != nil {
+		return err
+	}
+	summary.log("cluster role bindings")
+	return summary.err()
+}
+
+func updateClusterRoleBindings(clientset kubernetes.Interface, subjects map[string][]rbacv1.Subject) (bindingSummary, error) {
+	var summary bindingSummary
+
 	// store which cluster-roles currently exist locally
 	validClusterRoles := make(map[string]bool)
 
 	crs, err := clientset.RbacV1().ClusterRoles().List(context.TODO(), metav1.ListOptions{})
 	if err != nil {
-		return err
+		return summary, err
 	}
 
 	for _, cr := range crs.Items {
@@ -104,7 +116,7 @@ func (k *Kubernetes) UpdateClusterRoleBindings(subjects map[string][]rbacv1.Subj
 		context.Background(),
 		metav1.ListOptions{LabelSelector: "app.kubernetes.io/managed-by=infra"})
 	if err != nil {
-		return err
+		return summary, err
 	}
 
 	toDelete := make(map[string]bool)
@@ -114,29 +126,42 @@ func (k *Kubernetes) UpdateClusterRoleBindings(subjects map[string][]rbacv1.Subj
 
 	// Create or update CRBs for users
 	for _, crb := range crbs {
-		_, err = clientset.RbacV1().ClusterRoleBindings().Update(context.Background(), crb, metav1.UpdateOptions{})
-		if err != nil {
+		var created bool
+		err := retryOnConflict(func() error {
+			// a create that failed with AlreadyExists is retried as an update
+			created = false
+			_, err := clientset.RbacV1().ClusterRoleBindings().Update(context.Background(), crb, metav1.UpdateOptions{})
 			if k8sErrors.IsNotFound(err) {
+				created = true
 				_, err = clientset.RbacV1().ClusterRoleBindings().Create(context.Background(), crb, metav1.CreateOptions{})
-				if err != nil {
-					return err
-				}
-			} else {
-				return err
 			}
-		}
-
+			return err
+		})
+		// do not delete a binding that failed to update, it may still exist
 		delete(toDelete, crb.Name)
+		if err != nil {
+			summary.fail(fmt.Errorf("cluster role binding %v: %w", crb.Name, err))
+			continue
+		}
+		summary.applied(created)
 	}
 
 	for name := range toDelete {
-		err := clientset.RbacV1().ClusterRoleBindings().Delete(context.Background(), name, metav1.DeleteOptions{})
-		if err != nil {
+		err := retryOnConflict(func() error {
+			err := clientset.RbacV1().ClusterRoleBindings().Delete(context.Background(), name, metav1.DeleteOptions{})
+			if k8sErrors.IsNotFound(err) {
+				return nil
+			}
 			return err
+		})
+		if err != nil {
+			summary.fail(fmt.Errorf("delete cluster role binding %v: %w", name, err))
+			continue
 		}
+		summary.deleted++
 	}
 
-	return nil
+	return summary, nil
 }
 
 func (k *Kubernetes) UpdateRoleBindings(subjects map[ClusterRoleNamespace][]rbacv1.Subject) error {
@@ -145,12 +170,23 @@ func (k *Kubernetes) UpdateRoleBindings(subjects map[ClusterRoleNamespace][]rbac
 		return err
 	}
 
+	summary, err := updateRoleBindings(clientset, subjects)
+	if err != nil {
+		return err
+	}
+	summary.log("role bindings")
+	return summary.err()
+}
+
+func updateRoleBindings(clientset kubernetes.Interface, subjects map[ClusterRoleNamespace][]rbacv1.Subject) (bindingSummary, error) {
+	var summary bindingSummary
+
 	// store which cluster-roles currently exist locally
 	validClusterRoles := make(map[string]bool)
 
 	crs, err := clientset.RbacV1().ClusterRoles().List(context.TODO(), metav1.ListOptions{})
 	if err != nil {
-		return err
+		return summary, err
 	}
 
 	for _, cr := range crs.Items {
@@ -187,7 +223,7 @@ func (k *Kubernetes) UpdateRoleBindings(subjects map[ClusterRoleNamespace][]rbac
 		context.TODO(),
 		metav1.ListOptions{LabelSelector: "app.kubernetes.io/managed-by=infra"})
 	if err != nil {
-		return err
+		return summary, err
 	}
 
 	type rbIdentifier struct {
@@ -207,23 +243,27 @@ func (k *Kubernetes) UpdateRoleBindings(subjects map[ClusterRoleNamespace][]rbac
 
 	// Create or update RoleBindings for users/groups
 	for _, rb := range rbs {
-		_, err = clientset.RbacV1().RoleBindings(rb.Namespace).Update(context.TODO(), rb, metav1.UpdateOptions{})
-		if err != nil {
+		var created bool
+		err := retryOnConflict(func() error {
+			// a create that failed with AlreadyExists is retried as an update
+			created = false
+			_, err := clientset.RbacV1().RoleBindings(rb.Namespace).Update(context.TODO(), rb, metav1.UpdateOptions{})
 			if k8sErrors.IsNotFound(err) {
+				created = true
 				_, err = clientset.RbacV1().RoleBindings(rb.Namespace).Create(context.TODO(), rb, metav1.CreateOptions{})
-				if err != nil {
-					if k8sErrors.IsNotFound(err) {
-						// the namespace does not exist
-						// we can proceed in this case, the role mapping is just not applicable to this cluster
-						logging.Warnf("skipping unapplicable namespace for this cluster: %s %s", rb.Namespace, err.Error())
-						continue
-					}
-
-					return err
-				}
-			} else {
-				return err
 			}
+			return err
+		})
+		switch {
+		case created && k8sErrors.IsNotFound(err):
+			// the namespace does not exist
+			// we can proceed in this case, the role mapping is just not applicable to this cluster
+			logging.Warnf("skipping unapplicable namespace for this cluster: %s %s", rb.Namespace, err.Error())
+			continue
+		case err != nil:
+			summary.fail(fmt.Errorf("role binding %v/%v: %w", rb.Namespace, rb.Name, err))
+		default:
+			summary.applied(created)
 		}
 		// remove anything we update or create from the previous RoleBindings that will be deleted
 		delete(toDelete, rbIdentifier{namespace: rb.Namespace, name: rb.Name})
@@ -232,13 +272,71 @@ func (k *Kubernetes) UpdateRoleBindings(subjects map[ClusterRoleNamespace][]rbac
 	// Delete any Role-kind RoleBindings managed by infra that aren't in the config
 	// Do not need to worry about deleted namespaces as they will also delete all their resources
 	for _, td := range toDelete {
-		err := clientset.RbacV1().RoleBindings(td.Namespace).Delete(context.TODO(), td.Name, metav1.DeleteOptions{})
-		if err != nil {
+		err := retryOnConflict(func() error {
+			err := clientset.RbacV1().RoleBindings(td.Namespace).Delete(context.TODO(), td.Name, metav1.DeleteOptions{})
+			if k8sErrors.IsNotFound(err) {
+				return nil
+			}
 			return err
+		})
+		if err != nil {
+			summary.fail(fmt.Errorf("delete role binding %v/%v: %w", td.Namespace, td.Name, err))
+			continue
 		}
+		summary.deleted++
 	}
 
-	return nil
+	return summary, nil
+}
+
+// retryOnConflict retries fn with backoff when the API server responds with
+// a conflict, or when a concurrent create has already created the resource.
+func retryOnConflict(fn func() error) error {
+	return retry.OnError(retry.DefaultBackoff, func(err error) bool {
+		return k8sErrors.IsConflict(err) || k8sErrors.IsAlreadyExists(err)
+	}, fn)
+}
+
+// bindingSummary counts the changes made by a single apply of role bindings.
+type bindingSummary struct {
+	created int
+	updated int
+	deleted int
+	failed  int
+
+	firstErr error
+}
+
+func (s *bindingSummary) applied(created bool) {
+	if created {
+		s.created++
+		return
+	}
+	s.updated++
+}
+
+func (s *bindingSummary) fail(err error) {
+	logging.L.Warn().Err(err).Msg("failed to apply binding")
+	s.failed++
+	if s.firstErr == nil {
+		s.firstErr = err
+	}
+}
+
+func (s *bindingSummary) log(kind string) {
+	logging.L.Info().
+		Int("created", s.created).
+		Int("updated", s.updated).
+		Int("deleted", s.deleted).
+		Int("failed", s.failed).
+		Msgf("applied %v", kind)
+}
+
+func (s *bindingSummary) err() error {
+	if s.failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d bindings failed to apply: %w", s.failed, s.firstErr)
 }
 
 func (k *Kubernetes) Namespaces() ([]string, error) {
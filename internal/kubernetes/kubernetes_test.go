@@ -0,0 +1,223 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	rbacv1 "k8s.io/api/rbac/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestRetryOnConflict(t *testing.T) {
+	resource := schema.GroupResource{Group: "rbac.authorization.k8s.io", Resource: "clusterrolebindings"}
+
+	type testCase struct {
+		name          string
+		errs          []error
+		expectedCalls int
+		expectedErr   string
+	}
+
+	run := func(t *testing.T, tc testCase) {
+		var calls int
+		err := retryOnConflict(func() error {
+			calls++
+			if calls > len(tc.errs) {
+				return nil
+			}
+			return tc.errs[calls-1]
+		})
+		if tc.expectedErr != "" {
+			assert.ErrorContains(t, err, tc.expectedErr)
+		} else {
+			assert.NilError(t, err)
+		}
+		assert.Equal(t, calls, tc.expectedCalls)
+	}
+
+	testCases := []testCase{
+		{
+			name:          "success",
+			expectedCalls: 1,
+		},
+		{
+			name: "conflict is retried",
+			errs: []error{
+				k8sErrors.NewConflict(resource, "infra:view", errors.New("the object has been modified")),
+				k8sErrors.NewConflict(resource, "infra:view", errors.New("the object has been modified")),
+			},
+			expectedCalls: 3,
+		},
+		{
+			name:          "already exists is retried",
+			errs:          []error{k8sErrors.NewAlreadyExists(resource, "infra:view")},
+			expectedCalls: 2,
+		},
+		{
+			name:          "other errors are not retried",
+			errs:          []error{k8sErrors.NewForbidden(resource, "infra:view", errors.New("denied"))},
+			expectedCalls: 1,
+			expectedErr:   "denied",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
+
+func TestUpdateClusterRoleBindings(t *testing.T) {
+	managedBy := map[string]string{"app.kubernetes.io/managed-by": "infra"}
+	subject := rbacv1.Subject{APIGroup: "rbac.authorization.k8s.io", Kind: rbacv1.UserKind, Name: "user@example.com"}
+	clusterRole := func(name string) *rbacv1.ClusterRole {
+		return &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	}
+	binding := func(name string) *rbacv1.ClusterRoleBinding {
+		return &rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: managedBy}}
+	}
+
+	type testCase struct {
+		name     string
+		setup    func(t *testing.T, clientset *fake.Clientset)
+		expected bindingSummary
+	}
+
+	run := func(t *testing.T, tc testCase) {
+		clientset := fake.NewSimpleClientset(
+			clusterRole("view"),
+			clusterRole("edit"),
+			clusterRole("admin"),
+			binding("infra:edit"),
+			binding("infra:admin"),
+			binding("infra:removed"),
+		)
+		if tc.setup != nil {
+			tc.setup(t, clientset)
+		}
+
+		summary, err := updateClusterRoleBindings(clientset, map[string][]rbacv1.Subject{
+			"view":    {subject},
+			"edit":    {subject},
+			"admin":   {subject},
+			"missing": {subject},
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, summary.created, tc.expected.created)
+		assert.Equal(t, summary.updated, tc.expected.updated)
+		assert.Equal(t, summary.deleted, tc.expected.deleted)
+		assert.Equal(t, summary.failed, tc.expected.failed)
+		if tc.expected.failed == 0 {
+			assert.NilError(t, summary.err())
+		}
+
+		list, err := clientset.RbacV1().ClusterRoleBindings().List(context.Background(), metav1.ListOptions{})
+		assert.NilError(t, err)
+		var names []string
+		for _, item := range list.Items {
+			names = append(names, item.Name)
+		}
+		assert.DeepEqual(t, names, []string{"infra:admin", "infra:edit", "infra:view"})
+	}
+
+	testCases := []testCase{
+		{
+			name:     "created, updated, and deleted",
+			expected: bindingSummary{created: 1, updated: 2, deleted: 1},
+		},
+		{
+			name: "retried create is counted as an update",
+			setup: func(t *testing.T, clientset *fake.Clientset) {
+				var raced bool
+				clientset.PrependReactor("create", "clusterrolebindings",
+					func(action k8stesting.Action) (bool, runtime.Object, error) {
+						if raced {
+							return false, nil, nil
+						}
+						raced = true
+						// another client creates the binding first
+						obj := action.(k8stesting.CreateAction).GetObject()
+						assert.NilError(t, clientset.Tracker().Add(obj))
+						crb := obj.(*rbacv1.ClusterRoleBinding)
+						return true, nil, k8sErrors.NewAlreadyExists(rbacv1.Resource("clusterrolebindings"), crb.Name)
+					})
+			},
+			expected: bindingSummary{updated: 3, deleted: 1},
+		},
+		{
+			name: "failed update is not deleted",
+			setup: func(t *testing.T, clientset *fake.Clientset) {
+				clientset.PrependReactor("update", "clusterrolebindings",
+					func(action k8stesting.Action) (bool, runtime.Object, error) {
+						crb := action.(k8stesting.UpdateAction).GetObject().(*rbacv1.ClusterRoleBinding)
+						if crb.Name != "infra:admin" {
+							return false, nil, nil
+						}
+						return true, nil, k8sErrors.NewForbidden(rbacv1.Resource("clusterrolebindings"), crb.Name, errors.New("denied"))
+					})
+			},
+			expected: bindingSummary{created: 1, updated: 1, deleted: 1, failed: 1},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
+
+func TestUpdateRoleBindings_RetriedCreateIsAnUpdate(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "view"}})
+
+	var creates int
+	clientset.PrependReactor("create", "rolebindings",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			creates++
+			if creates > 1 {
+				return false, nil, nil
+			}
+			// another client creates the binding first
+			obj := action.(k8stesting.CreateAction).GetObject()
+			assert.NilError(t, clientset.Tracker().Add(obj))
+			rb := obj.(*rbacv1.RoleBinding)
+			return true, nil, k8sErrors.NewAlreadyExists(rbacv1.Resource("rolebindings"), rb.Name)
+		})
+
+	subject := rbacv1.Subject{APIGroup: "rbac.authorization.k8s.io", Kind: rbacv1.UserKind, Name: "user@example.com"}
+	summary, err := updateRoleBindings(clientset, map[ClusterRoleNamespace][]rbacv1.Subject{
+		{ClusterRole: "view", Namespace: "ns1"}: {subject},
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, creates, 1)
+	assert.Equal(t, summary.created, 0)
+	assert.Equal(t, summary.updated, 1)
+	assert.NilError(t, summary.err())
+
+	rb, err := clientset.RbacV1().RoleBindings("ns1").Get(context.Background(), "infra:view", metav1.GetOptions{})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, rb.Subjects, []rbacv1.Subject{subject})
+}
+
+func TestBindingSummary(t *testing.T) {
+	var summary bindingSummary
+	summary.applied(true)
+	summary.applied(false)
+	summary.applied(false)
+	summary.deleted++
+	assert.NilError(t, summary.err())
+
+	summary.fail(errors.New("first failure"))
+	summary.fail(errors.New("second failure"))
+	assert.Equal(t, summary.created, 1)
+	assert.Equal(t, summary.updated, 2)
+	assert.Equal(t, summary.deleted, 1)
+	assert.Equal(t, summary.failed, 2)
+	assert.Error(t, summary.err(), "2 bindings failed to apply: first failure")
+}
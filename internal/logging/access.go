@@ -0,0 +1,44 @@
+package logging
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog"
+)
+
+// AccessLogOptions configures the log line that the server and connector write
+// for each HTTP request.
+type AccessLogOptions struct {
+	// Level is the log level of access log lines. One of trace, debug, info,
+	// warn, or error. Defaults to info.
+	Level string
+
+	// DemoteHealthChecks logs requests to health check endpoints at debug
+	// level, so that frequent probes from a load balancer or kubelet do not
+	// fill the logs.
+	DemoteHealthChecks bool
+}
+
+// Validate returns an error if Level is not a valid log level.
+func (o AccessLogOptions) Validate() error {
+	if o.Level == "" {
+		return nil
+	}
+	if _, err := zerolog.ParseLevel(o.Level); err != nil {
+		return fmt.Errorf("invalid access log level %q: %w", o.Level, err)
+	}
+	return nil
+}
+
+// EventLevel returns the level to use for the access log line of a request.
+// healthCheck should be true when the request is for a health check endpoint.
+func (o AccessLogOptions) EventLevel(healthCheck bool) zerolog.Level {
+	if healthCheck && o.DemoteHealthChecks {
+		return zerolog.DebugLevel
+	}
+	level, err := zerolog.ParseLevel(o.Level)
+	if err != nil || o.Level == "" {
+		return zerolog.InfoLevel
+	}
+	return level
+}
@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type contextKey struct{}
+
+type requestIDKey struct{}
+
+type clientIPKey struct{}
+
+// WithFields returns a copy of ctx that carries a logger with fields added to
+// every log line. fields are pairs of a key and a value. The logger is created
+// from the logger already in ctx, or from L if ctx does not have a logger, so
+// fields accumulate as the context is passed down.
+func WithFields(ctx context.Context, fields ...interface{}) context.Context {
+	logger := FromContext(ctx).With().Fields(fields).Logger()
+	return context.WithValue(ctx, contextKey{}, &logger)
+}
+
+// FromContext returns the logger stored in ctx by WithFields. If ctx does not
+// have a logger, FromContext returns the global logger L, so it is always safe
+// to use.
+func FromContext(ctx context.Context) *zerolog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(contextKey{}).(*zerolog.Logger); ok {
+			return logger
+		}
+	}
+	return &L.Logger
+}
+
+// WithRequestID returns a copy of ctx that carries the ID of a request. The ID
+// is also added to the logger in ctx, the same as WithFields. When ctx has a
+// trace, the trace ID is added to the logger as well, so that log lines can be
+// found from a trace.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey{}, requestID)
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		return WithFields(ctx, "requestID", requestID, "traceID", sc.TraceID().String())
+	}
+	return WithFields(ctx, "requestID", requestID)
+}
+
+// RequestID returns the request ID stored in ctx by WithRequestID, or an empty
+// string if ctx does not have a request ID.
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithClientIP returns a copy of ctx that carries the IP address of the client
+// that made a request.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIP returns the IP address stored in ctx by WithClientIP, or an empty
+// string if ctx does not have an IP address.
+func ClientIP(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
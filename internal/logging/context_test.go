@@ -0,0 +1,83 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+	"gotest.tools/v3/assert"
+)
+
+func TestWithFields(t *testing.T) {
+	buf := new(bytes.Buffer)
+	PatchLogger(t, buf)
+
+	ctx := WithFields(context.Background(), "requestID", "abcd", "method", "GET")
+	ctx = WithFields(ctx, "orgID", "1234")
+
+	nested := func(ctx context.Context) {
+		FromContext(ctx).Info().Msg("from a nested call")
+	}
+	nested(ctx)
+
+	entry := map[string]interface{}{}
+	assert.NilError(t, json.Unmarshal(buf.Bytes(), &entry), buf.String())
+	assert.Equal(t, entry["message"], "from a nested call")
+	assert.Equal(t, entry["requestID"], "abcd")
+	assert.Equal(t, entry["method"], "GET")
+	assert.Equal(t, entry["orgID"], "1234")
+
+	t.Run("parent context is not modified", func(t *testing.T) {
+		buf.Reset()
+		parent := WithFields(context.Background(), "requestID", "abcd")
+		_ = WithFields(parent, "orgID", "1234")
+
+		FromContext(parent).Info().Msg("from the parent")
+		entry := map[string]interface{}{}
+		assert.NilError(t, json.Unmarshal(buf.Bytes(), &entry), buf.String())
+		assert.Equal(t, entry["requestID"], "abcd")
+		_, ok := entry["orgID"]
+		assert.Assert(t, !ok, buf.String())
+	})
+}
+
+func TestFromContext_Fallback(t *testing.T) {
+	buf := new(bytes.Buffer)
+	PatchLogger(t, buf)
+
+	FromContext(context.Background()).Info().Msg("without a logger")
+
+	entry := map[string]interface{}{}
+	assert.NilError(t, json.Unmarshal(buf.Bytes(), &entry), buf.String())
+	assert.Equal(t, entry["message"], "without a logger")
+}
+
+func TestWithRequestID_TraceID(t *testing.T) {
+	buf := new(bytes.Buffer)
+	PatchLogger(t, buf)
+
+	traceID := trace.TraceID{0x01, 0x02, 0x03}
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: trace.SpanID{0x04}})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+	ctx = WithRequestID(ctx, "abcd")
+
+	FromContext(ctx).Info().Msg("with a trace")
+
+	entry := map[string]interface{}{}
+	assert.NilError(t, json.Unmarshal(buf.Bytes(), &entry), buf.String())
+	assert.Equal(t, entry["requestID"], "abcd")
+	assert.Equal(t, entry["traceID"], traceID.String())
+
+	t.Run("without a trace", func(t *testing.T) {
+		buf.Reset()
+		ctx := WithRequestID(context.Background(), "abcd")
+		FromContext(ctx).Info().Msg("without a trace")
+
+		entry := map[string]interface{}{}
+		assert.NilError(t, json.Unmarshal(buf.Bytes(), &entry), buf.String())
+		_, ok := entry["traceID"]
+		assert.Assert(t, !ok, buf.String())
+	})
+}
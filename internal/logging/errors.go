@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"runtime"
+)
+
+// WithStack returns an error that wraps err and records the stack of the
+// caller. When the error is logged with Err the stack is included in the
+// errorChain field. WithStack returns nil if err is nil.
+func WithStack(err error) error {
+	if err == nil {
+		return nil
+	}
+	var pcs [32]uintptr
+	n := runtime.Callers(2, pcs[:])
+	return &stackError{err: err, pcs: pcs[:n]}
+}
+
+type stackError struct {
+	err error
+	pcs []uintptr
+}
+
+func (e *stackError) Error() string {
+	return e.err.Error()
+}
+
+func (e *stackError) Unwrap() error {
+	return e.err
+}
+
+// StackTrace returns the frames of the stack recorded by WithStack, formatted
+// as function followed by file:line.
+func (e *stackError) StackTrace() []string {
+	var result []string
+	frames := runtime.CallersFrames(e.pcs)
+	for {
+		frame, more := frames.Next()
+		short := filepath.Join(filepath.Base(filepath.Dir(frame.File)), filepath.Base(frame.File))
+		result = append(result, fmt.Sprintf("%s %s:%d", frame.Function, short, frame.Line))
+		if !more {
+			return result
+		}
+	}
+}
+
+// errorChainEntry is one error in the errorChain field of a log line.
+type errorChainEntry struct {
+	Type    string   `json:"type"`
+	Message string   `json:"message"`
+	Stack   []string `json:"stack,omitempty"`
+}
+
+// errorChain is used as the zerolog.ErrorStackMarshaler. It returns every
+// error in the chain of wrapped errors, starting with err. It returns nil when
+// err does not wrap any other error and has no stack, because the chain would
+// only repeat the error field.
+func errorChain(err error) interface{} {
+	var chain []errorChainEntry
+	var stack []string
+	for ; err != nil; err = errors.Unwrap(err) {
+		// the stack is added to the error wrapped by WithStack, so that the
+		// chain does not repeat the same message
+		if stackErr, ok := err.(*stackError); ok { // nolint:errorlint
+			stack = stackErr.StackTrace()
+			continue
+		}
+		chain = append(chain, errorChainEntry{
+			Type:    fmt.Sprintf("%T", err),
+			Message: err.Error(),
+			Stack:   stack,
+		})
+		stack = nil
+	}
+	if len(chain) < 2 && (len(chain) == 0 || chain[0].Stack == nil) {
+		return nil
+	}
+	return chain
+}
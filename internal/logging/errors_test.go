@@ -0,0 +1,78 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestErrorChain(t *testing.T) {
+	type entry struct {
+		Error      string            `json:"error"`
+		ErrorChain []errorChainEntry `json:"errorChain"`
+	}
+
+	logError := func(t *testing.T, err error) entry {
+		t.Helper()
+		buf := new(bytes.Buffer)
+		PatchLogger(t, buf)
+		L.Error().Err(err).Msg("failed")
+
+		assert.Equal(t, strings.Count(buf.String(), "\n"), 1, "expected one line: %s", buf.String())
+		var e entry
+		assert.NilError(t, json.Unmarshal(buf.Bytes(), &e), buf.String())
+		return e
+	}
+
+	t.Run("three deep wrapped error", func(t *testing.T) {
+		root := errors.New("connection refused")
+		err := fmt.Errorf("list grants: %w", fmt.Errorf("query: %w", root))
+
+		actual := logError(t, err)
+		expected := entry{
+			Error: "list grants: query: connection refused",
+			ErrorChain: []errorChainEntry{
+				{Type: "*fmt.wrapError", Message: "list grants: query: connection refused"},
+				{Type: "*fmt.wrapError", Message: "query: connection refused"},
+				{Type: "*errors.errorString", Message: "connection refused"},
+			},
+		}
+		assert.DeepEqual(t, actual, expected)
+	})
+
+	t.Run("error with stack", func(t *testing.T) {
+		root := errors.New("connection refused")
+		err := fmt.Errorf("list grants: %w", WithStack(root))
+
+		actual := logError(t, err)
+		assert.Equal(t, actual.Error, "list grants: connection refused")
+		assert.Equal(t, len(actual.ErrorChain), 2)
+		assert.Equal(t, actual.ErrorChain[0].Message, "list grants: connection refused")
+		assert.Assert(t, actual.ErrorChain[0].Stack == nil)
+
+		last := actual.ErrorChain[1]
+		assert.Equal(t, last.Message, "connection refused")
+		assert.Assert(t, len(last.Stack) > 0)
+		assert.Assert(t, strings.HasPrefix(last.Stack[0], "github.com/infrahq/infra/internal/logging.TestErrorChain"), last.Stack[0])
+		assert.Assert(t, strings.Contains(last.Stack[0], "logging/errors_test.go:"), last.Stack[0])
+	})
+
+	t.Run("error without a chain", func(t *testing.T) {
+		actual := logError(t, errors.New("not found"))
+		assert.DeepEqual(t, actual, entry{Error: "not found"})
+	})
+}
+
+func TestWithStack(t *testing.T) {
+	assert.NilError(t, WithStack(nil))
+
+	root := errors.New("the error")
+	err := WithStack(root)
+	assert.Error(t, err, "the error")
+	assert.Assert(t, errors.Is(err, root))
+}
@@ -0,0 +1,132 @@
+package logging
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// LogEntry is a log line stored in a LogBuffer.
+type LogEntry struct {
+	Time  time.Time
+	Level zerolog.Level
+	// Line is the log entry as a JSON object, with sensitive fields redacted.
+	Line string
+}
+
+// LogBuffer is a ring buffer of recent log entries, used to forward logs to
+// another service. When the buffer is full the oldest entries are dropped, so
+// that writing a log entry never blocks or fails.
+type LogBuffer struct {
+	level zerolog.Level
+
+	mu      sync.Mutex
+	entries []LogEntry
+	// start is the index of the oldest entry in entries, and count is the
+	// number of entries in the buffer.
+	start   int
+	count   int
+	dropped int
+
+	// now is time.Now. It is a field so that tests can use a fake clock.
+	now func() time.Time
+}
+
+// NewLogBuffer returns a LogBuffer that holds up to size entries that were
+// logged at level or higher.
+func NewLogBuffer(size int, level zerolog.Level) *LogBuffer {
+	return &LogBuffer{
+		level:   level,
+		entries: make([]LogEntry, size),
+		now:     time.Now,
+	}
+}
+
+// Write implements io.Writer. Entries without a level are not stored.
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	return b.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel implements zerolog.LevelWriter.
+func (b *LogBuffer) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if level < b.level || level == zerolog.NoLevel || len(b.entries) == 0 {
+		return len(p), nil
+	}
+	entry := LogEntry{Time: b.now(), Level: level, Line: trimNewline(string(p))}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.count == len(b.entries) {
+		b.start = (b.start + 1) % len(b.entries)
+		b.count--
+		b.dropped++
+	}
+	b.entries[(b.start+b.count)%len(b.entries)] = entry
+	b.count++
+	return len(p), nil
+}
+
+func trimNewline(s string) string {
+	if len(s) > 0 && s[len(s)-1] == '\n' {
+		return s[:len(s)-1]
+	}
+	return s
+}
+
+// Take removes up to max of the oldest entries from the buffer and returns
+// them. Take also returns the number of entries that were dropped because the
+// buffer was full since the last call to Take.
+func (b *LogBuffer) Take(max int) ([]LogEntry, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := b.count
+	if max > 0 && max < n {
+		n = max
+	}
+	result := make([]LogEntry, n)
+	for i := range result {
+		index := (b.start + i) % len(b.entries)
+		result[i] = b.entries[index]
+		b.entries[index] = LogEntry{}
+	}
+	if n > 0 {
+		b.start = (b.start + n) % len(b.entries)
+		b.count -= n
+	}
+
+	dropped := b.dropped
+	b.dropped = 0
+	return result, dropped
+}
+
+// Requeue returns entries that were removed by Take, and could not be sent,
+// to the front of the buffer. Entries that no longer fit in the buffer are
+// dropped, starting with the oldest. dropped is the count that was returned by
+// Take.
+func (b *LogBuffer) Requeue(entries []LogEntry, dropped int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.dropped += dropped
+	if room := len(b.entries) - b.count; len(entries) > room {
+		b.dropped += len(entries) - room
+		entries = entries[len(entries)-room:]
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		b.start = (b.start - 1 + len(b.entries)) % len(b.entries)
+		b.entries[b.start] = entries[i]
+		b.count++
+	}
+}
+
+// ForwardLogs changes L to also write log entries to buf. Sensitive fields are
+// redacted before entries are written to buf. ForwardLogs must be called after
+// the logger is configured by UseServerLogger or UseFileLogger.
+func ForwardLogs(buf *LogBuffer) {
+	L = &logger{
+		Logger: L.Output(redactWriter{out: zerolog.MultiLevelWriter(L.out, buf)}),
+		out:    L.out,
+	}
+}
@@ -0,0 +1,79 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"gotest.tools/v3/assert"
+)
+
+func lines(entries []LogEntry) []string {
+	var result []string
+	for _, entry := range entries {
+		result = append(result, entry.Line)
+	}
+	return result
+}
+
+func TestLogBuffer_DropsOldestWhenFull(t *testing.T) {
+	buf := NewLogBuffer(3, zerolog.WarnLevel)
+	for i := 0; i < 5; i++ {
+		_, err := buf.WriteLevel(zerolog.ErrorLevel, []byte(fmt.Sprintf("line %d\n", i)))
+		assert.NilError(t, err)
+	}
+	_, _ = buf.WriteLevel(zerolog.InfoLevel, []byte("info is not stored\n"))
+
+	entries, dropped := buf.Take(2)
+	assert.DeepEqual(t, lines(entries), []string{"line 2", "line 3"})
+	assert.Equal(t, dropped, 2)
+
+	entries, dropped = buf.Take(10)
+	assert.DeepEqual(t, lines(entries), []string{"line 4"})
+	assert.Equal(t, dropped, 0)
+
+	entries, _ = buf.Take(10)
+	assert.Equal(t, len(entries), 0)
+}
+
+func TestLogBuffer_Requeue(t *testing.T) {
+	buf := NewLogBuffer(4, zerolog.WarnLevel)
+	for i := 0; i < 3; i++ {
+		_, _ = buf.WriteLevel(zerolog.WarnLevel, []byte(fmt.Sprintf("line %d", i)))
+	}
+
+	entries, dropped := buf.Take(0)
+	assert.Equal(t, len(entries), 3)
+
+	// more entries are logged while the batch is being sent
+	_, _ = buf.WriteLevel(zerolog.WarnLevel, []byte("line 3"))
+	_, _ = buf.WriteLevel(zerolog.WarnLevel, []byte("line 4"))
+
+	// the send failed, only the newest of the failed batch fit in the buffer
+	buf.Requeue(entries, dropped)
+
+	entries, dropped = buf.Take(0)
+	assert.DeepEqual(t, lines(entries), []string{"line 1", "line 2", "line 3", "line 4"})
+	assert.Equal(t, dropped, 1)
+}
+
+func TestForwardLogs(t *testing.T) {
+	out := new(bytes.Buffer)
+	PatchLogger(t, out)
+
+	buf := NewLogBuffer(10, zerolog.WarnLevel)
+	ForwardLogs(buf)
+
+	L.Info().Msg("not forwarded")
+	L.Warn().Str("password", "hunter2").Msg("forwarded")
+
+	entries, _ := buf.Take(0)
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].Level, zerolog.WarnLevel)
+	assert.Assert(t, !bytes.Contains([]byte(entries[0].Line), []byte("hunter2")), entries[0].Line)
+	assert.Assert(t, bytes.Contains([]byte(entries[0].Line), []byte(`"message":"forwarded"`)), entries[0].Line)
+
+	// entries are still written to the original writer
+	assert.Equal(t, bytes.Count(out.Bytes(), []byte("\n")), 2)
+}
@@ -0,0 +1,98 @@
+package logging
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// levelRevert is the pending revert of the log level that was scheduled by
+// SetLevelWithRevert.
+var levelRevert struct {
+	sync.Mutex
+	timer interface{ Stop() bool }
+	level zerolog.Level
+}
+
+// afterFunc is time.AfterFunc. It is a variable so that tests can use a fake
+// clock.
+var afterFunc = func(d time.Duration, fn func()) interface{ Stop() bool } {
+	return time.AfterFunc(d, fn)
+}
+
+// GetLevel returns the name of the current log level.
+func GetLevel() string {
+	return zerolog.GlobalLevel().String()
+}
+
+// SetLevelWithRevert changes the log level to levelName, and returns the name
+// of the previous level. When revertAfter is greater than zero the level is
+// changed back to the previous level after revertAfter, so that a verbose
+// level can not be left on forever.
+//
+// Any revert that was pending from an earlier call is cancelled. If the new
+// call also reverts, it reverts to the level from before the pending revert,
+// not to the level set by the earlier call.
+func SetLevelWithRevert(levelName string, revertAfter time.Duration) (string, error) {
+	level, err := zerolog.ParseLevel(levelName)
+	if err != nil {
+		return "", err
+	}
+
+	levelRevert.Lock()
+	defer levelRevert.Unlock()
+
+	previous := zerolog.GlobalLevel()
+	revertTo := previous
+	if levelRevert.timer != nil {
+		revertTo = levelRevert.level
+	}
+	cancelLevelRevert()
+
+	// logging middleware depends on this level. If we stop using the global level
+	// make sure to adjust the logging middleware to check the level of the
+	// logger instead of the global level.
+	zerolog.SetGlobalLevel(level)
+
+	if revertAfter > 0 {
+		var timer interface{ Stop() bool }
+		timer = afterFunc(revertAfter, func() {
+			levelRevert.Lock()
+			defer levelRevert.Unlock()
+			// the revert was cancelled while this func was waiting for the lock
+			if levelRevert.timer != timer {
+				return
+			}
+			L.Info().Str("level", revertTo.String()).Msg("reverting log level")
+			zerolog.SetGlobalLevel(revertTo)
+			levelRevert.timer = nil
+		})
+		levelRevert.timer = timer
+		levelRevert.level = revertTo
+	}
+	return previous.String(), nil
+}
+
+// RevertLevel immediately changes the log level back to the level it was
+// before the last call to SetLevelWithRevert. RevertLevel returns false if
+// there was no revert pending.
+func RevertLevel() bool {
+	levelRevert.Lock()
+	defer levelRevert.Unlock()
+	if levelRevert.timer == nil {
+		return false
+	}
+	zerolog.SetGlobalLevel(levelRevert.level)
+	cancelLevelRevert()
+	return true
+}
+
+// cancelLevelRevert stops any pending revert. The caller must hold the lock on
+// levelRevert.
+func cancelLevelRevert() {
+	if levelRevert.timer != nil {
+		levelRevert.timer.Stop()
+		levelRevert.timer = nil
+	}
+}
@@ -0,0 +1,140 @@
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gotest.tools/v3/assert"
+)
+
+type fakeTimer struct {
+	duration time.Duration
+	fn       func()
+	stopped  bool
+}
+
+func (f *fakeTimer) Stop() bool {
+	wasActive := !f.stopped
+	f.stopped = true
+	return wasActive
+}
+
+// patchAfterFunc replaces afterFunc with a fake that records the scheduled
+// timers, so that tests can fire them without waiting.
+func patchAfterFunc(t *testing.T) *[]*fakeTimer {
+	t.Helper()
+	var timers []*fakeTimer
+	orig := afterFunc
+	afterFunc = func(d time.Duration, fn func()) interface{ Stop() bool } {
+		timer := &fakeTimer{duration: d, fn: fn}
+		timers = append(timers, timer)
+		return timer
+	}
+	t.Cleanup(func() {
+		afterFunc = orig
+		assert.NilError(t, SetLevel("info"))
+	})
+	return &timers
+}
+
+func TestSetLevelWithRevert(t *testing.T) {
+	timers := patchAfterFunc(t)
+	buf := new(bytes.Buffer)
+	PatchLogger(t, buf)
+	assert.NilError(t, SetLevel("info"))
+
+	L.Debug().Msg("debug before")
+	L.Info().Msg("info before")
+
+	previous, err := SetLevelWithRevert("debug", 30*time.Minute)
+	assert.NilError(t, err)
+	assert.Equal(t, previous, "info")
+	assert.Equal(t, GetLevel(), "debug")
+	assert.Equal(t, len(*timers), 1)
+	assert.Equal(t, (*timers)[0].duration, 30*time.Minute)
+
+	L.Debug().Msg("debug after")
+
+	// fire the revert
+	(*timers)[0].fn()
+	assert.Equal(t, GetLevel(), "info")
+
+	L.Debug().Msg("debug reverted")
+
+	output := buf.String()
+	assert.Assert(t, !strings.Contains(output, "debug before"), output)
+	assert.Assert(t, strings.Contains(output, "info before"), output)
+	assert.Assert(t, strings.Contains(output, "debug after"), output)
+	assert.Assert(t, strings.Contains(output, "reverting log level"), output)
+	assert.Assert(t, !strings.Contains(output, "debug reverted"), output)
+}
+
+func TestSetLevelWithRevert_CancelsPendingRevert(t *testing.T) {
+	timers := patchAfterFunc(t)
+	assert.NilError(t, SetLevel("warn"))
+
+	_, err := SetLevelWithRevert("debug", time.Minute)
+	assert.NilError(t, err)
+
+	previous, err := SetLevelWithRevert("trace", 0)
+	assert.NilError(t, err)
+	assert.Equal(t, previous, "debug")
+	assert.Equal(t, len(*timers), 1)
+	assert.Assert(t, (*timers)[0].stopped)
+
+	// a cancelled revert that fires anyway does not change the level
+	(*timers)[0].fn()
+	assert.Equal(t, zerolog.GlobalLevel(), zerolog.TraceLevel)
+}
+
+func TestSetLevelWithRevert_TwoCallsInARow(t *testing.T) {
+	timers := patchAfterFunc(t)
+	assert.NilError(t, SetLevel("info"))
+
+	_, err := SetLevelWithRevert("debug", time.Minute)
+	assert.NilError(t, err)
+
+	previous, err := SetLevelWithRevert("debug", time.Minute)
+	assert.NilError(t, err)
+	assert.Equal(t, previous, "debug")
+	assert.Equal(t, len(*timers), 2)
+	assert.Assert(t, (*timers)[0].stopped)
+
+	// the second revert restores the level from before the first call
+	(*timers)[1].fn()
+	assert.Equal(t, GetLevel(), "info")
+
+	_, err = SetLevelWithRevert("debug", time.Minute)
+	assert.NilError(t, err)
+	_, err = SetLevelWithRevert("trace", time.Minute)
+	assert.NilError(t, err)
+	assert.Assert(t, RevertLevel())
+	assert.Equal(t, GetLevel(), "info")
+}
+
+func TestSetLevelWithRevert_InvalidLevel(t *testing.T) {
+	patchAfterFunc(t)
+	assert.NilError(t, SetLevel("info"))
+
+	_, err := SetLevelWithRevert("loud", time.Minute)
+	assert.ErrorContains(t, err, "Unknown Level String")
+	assert.Equal(t, GetLevel(), "info")
+}
+
+func TestRevertLevel(t *testing.T) {
+	timers := patchAfterFunc(t)
+	assert.NilError(t, SetLevel("info"))
+
+	assert.Assert(t, !RevertLevel())
+
+	_, err := SetLevelWithRevert("debug", time.Hour)
+	assert.NilError(t, err)
+
+	assert.Assert(t, RevertLevel())
+	assert.Equal(t, GetLevel(), "info")
+	assert.Assert(t, (*timers)[0].stopped)
+	assert.Assert(t, !RevertLevel())
+}
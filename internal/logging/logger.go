@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -13,17 +14,13 @@ import (
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-var L = &logger{
-	Logger: zerolog.New(zerolog.ConsoleWriter{
-		Out:          os.Stderr,
-		NoColor:      !isTerminal(),
-		PartsExclude: []string{"time"},
-		FormatLevel:  consoleFormatLevel,
-	}),
-}
+var L = newConsoleLogger(os.Stderr)
 
 type logger struct {
 	zerolog.Logger
+	// out is the writer that receives redacted log entries. It is used by
+	// ForwardLogs to add another writer.
+	out io.Writer
 }
 
 func init() {
@@ -33,40 +30,168 @@ func init() {
 		return fmt.Sprintf("%s:%d", short, line)
 	}
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	zerolog.ErrorStackFieldName = "errorChain"
+	zerolog.ErrorStackMarshaler = errorChain
 }
 
 func newLogger(writer io.Writer) *logger {
 	return &logger{
-		Logger: zerolog.New(writer).With().Timestamp().Caller().Logger(),
+		Logger: zerolog.New(redactWriter{out: writer}).With().Timestamp().Caller().Stack().Logger(),
+		out:    writer,
+	}
+}
+
+// consoleTimestampsEnv is the name of an environment variable that adds a
+// short timestamp to each line written by the console logger, so that output
+// copied from a terminal can be matched with other logs. Timestamps are off by
+// default.
+const consoleTimestampsEnv = "INFRA_LOG_TIMESTAMPS"
+
+type consoleOptions struct {
+	noColor    bool
+	timestamps bool
+}
+
+func newConsoleLogger(writer io.Writer) *logger {
+	timestamps, _ := strconv.ParseBool(os.Getenv(consoleTimestampsEnv))
+	return newConsoleLoggerWithOptions(writer, consoleOptions{
+		noColor:    !isTerminal(),
+		timestamps: timestamps,
+	})
+}
+
+func newConsoleLoggerWithOptions(writer io.Writer, opts consoleOptions) *logger {
+	out := zerolog.ConsoleWriter{
+		Out:          writer,
+		NoColor:      opts.noColor,
+		PartsExclude: []string{"time"},
+		FormatLevel:  consoleFormatLevel(opts.noColor),
+	}
+	if opts.timestamps {
+		out.PartsExclude = nil
+		out.TimeFormat = "15:04:05"
 	}
+	zl := zerolog.New(redactWriter{out: out})
+	if opts.timestamps {
+		zl = zl.With().Timestamp().Logger()
+	}
+	return &logger{Logger: zl, out: out}
 }
 
+// Format is the format of the log output written by the logger from
+// UseServerLogger.
+type Format string
+
+const (
+	// FormatAuto uses FormatConsole when the process is being run in an
+	// interactive terminal, and FormatJSON otherwise.
+	FormatAuto Format = "auto"
+	// FormatJSON writes each log entry as a JSON object with a timestamp and
+	// the caller.
+	FormatJSON Format = "json"
+	// FormatConsole writes log entries in a format that is easy to read in a
+	// terminal.
+	FormatConsole Format = "console"
+)
+
 // UseServerLogger changes L to a logger appropriate for long-running processes,
-// like the infra server and connector. If the process is being run in an
-// interactive terminal, use the default console logger.
-func UseServerLogger() {
-	if isTerminal() {
-		return
+// like the infra server and connector. The format must be one of json,
+// console, or auto. An empty format is the same as auto.
+//
+// UseServerLogger does not change the log level, so it may be called before or
+// after SetLevel.
+func UseServerLogger(format string) error {
+	l, err := newServerLogger(os.Stderr, Format(format), isTerminal())
+	if err != nil {
+		return err
+	}
+	L = l
+	return nil
+}
+
+func newServerLogger(writer io.Writer, format Format, terminal bool) (*logger, error) {
+	switch format {
+	case FormatAuto, "":
+		if terminal {
+			return newConsoleLogger(writer), nil
+		}
+		return newLogger(writer), nil
+	case FormatJSON:
+		return newLogger(writer), nil
+	case FormatConsole:
+		return newConsoleLogger(writer), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q, must be one of json, console, or auto", format)
 	}
-	L = newLogger(os.Stderr)
 }
 
 func isTerminal() bool {
 	return os.Stdin != nil && term.IsTerminal(int(os.Stdin.Fd()))
 }
 
+// FileLoggerOptions configures the rotation of the log file written by the
+// logger from UseFileLogger. Zero values use the defaults.
+type FileLoggerOptions struct {
+	// MaxSizeMB is the maximum size of the log file in megabytes before it is
+	// rotated. Defaults to 10.
+	MaxSizeMB int
+	// MaxBackups is the maximum number of rotated log files to keep.
+	// Defaults to 7.
+	MaxBackups int
+	// MaxAgeDays is the maximum number of days to keep a rotated log file.
+	// Defaults to 28.
+	MaxAgeDays int
+	// Compress rotated log files using gzip.
+	Compress bool
+}
+
+// fileWriter is the writer used by the logger from UseFileLogger. It is kept
+// so that ReopenLogFile can close the file.
+var fileWriter *lumberjack.Logger
+
 // UseFileLogger changes L to a logger that writes log output to a file that is
 // rotated.
-func UseFileLogger(filepath string) {
+func UseFileLogger(filepath string, opts FileLoggerOptions) {
 	zerolog.TimeFieldFormat = time.RFC3339
+	fileWriter = newFileWriter(filepath, opts)
+	L = newLogger(fileWriter)
+}
+
+// NewFileWriter returns a writer that writes to a file that is rotated using
+// opts. It is used for log files other than the one used by L.
+func NewFileWriter(filepath string, opts FileLoggerOptions) io.WriteCloser {
+	return newFileWriter(filepath, opts)
+}
+
+func newFileWriter(filepath string, opts FileLoggerOptions) *lumberjack.Logger {
 	writer := &lumberjack.Logger{
 		Filename:   filepath,
 		MaxSize:    10, // megabytes
 		MaxBackups: 7,
 		MaxAge:     28, // days
+		Compress:   opts.Compress,
+	}
+	if opts.MaxSizeMB > 0 {
+		writer.MaxSize = opts.MaxSizeMB
 	}
+	if opts.MaxBackups > 0 {
+		writer.MaxBackups = opts.MaxBackups
+	}
+	if opts.MaxAgeDays > 0 {
+		writer.MaxAge = opts.MaxAgeDays
+	}
+	return writer
+}
 
-	L = newLogger(writer)
+// ReopenLogFile closes the log file used by the logger from UseFileLogger. The
+// file is opened again on the next write, so that an external tool like
+// logrotate can move the file. ReopenLogFile does nothing if UseFileLogger was
+// not called.
+func ReopenLogFile() error {
+	if fileWriter == nil {
+		return nil
+	}
+	return fileWriter.Close()
 }
 
 func Debugf(format string, v ...interface{}) {
@@ -85,17 +210,11 @@ func Errorf(format string, v ...interface{}) {
 	L.Error().CallerSkipFrame(1).Msgf(format, v...)
 }
 
+// SetLevel changes the log level to levelName. Any revert that was scheduled by
+// SetLevelWithRevert is cancelled.
 func SetLevel(levelName string) error {
-	level, err := zerolog.ParseLevel(levelName)
-	if err != nil {
-		return err
-	}
-
-	// logging middleware depends on this level. If we stop using the global level
-	// make sure to adjust the logging middleware to check the level of the
-	// logger instead of the global level.
-	zerolog.SetGlobalLevel(level)
-	return nil
+	_, err := SetLevelWithRevert(levelName, 0)
+	return err
 }
 
 type TestingT interface {
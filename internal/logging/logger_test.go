@@ -0,0 +1,275 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/poll"
+)
+
+func TestNewServerLogger(t *testing.T) {
+	type testCase struct {
+		name     string
+		format   Format
+		terminal bool
+		expected func(t *testing.T, output string)
+	}
+
+	expectJSON := func(t *testing.T, output string) {
+		t.Helper()
+		entry := map[string]interface{}{}
+		assert.NilError(t, json.Unmarshal([]byte(output), &entry), output)
+		assert.Equal(t, entry["level"], "info")
+		assert.Equal(t, entry["message"], "the message")
+		assert.Equal(t, entry["user"], "alice")
+		assert.Assert(t, entry["time"] != nil, output)
+		caller, _ := entry["caller"].(string)
+		assert.Assert(t, strings.HasPrefix(caller, "logging/logger_test.go:"), output)
+	}
+
+	expectConsole := func(t *testing.T, output string) {
+		t.Helper()
+		assert.Assert(t, !json.Valid([]byte(output)), output)
+		assert.Equal(t, strings.TrimSpace(output), "INFO  the message user=alice")
+	}
+
+	run := func(t *testing.T, tc testCase) {
+		buf := new(bytes.Buffer)
+		l, err := newServerLogger(buf, tc.format, tc.terminal)
+		assert.NilError(t, err)
+
+		l.Info().Str("user", "alice").Msg("the message")
+		tc.expected(t, buf.String())
+	}
+
+	testCases := []testCase{
+		{
+			name:     "json in a terminal",
+			format:   FormatJSON,
+			terminal: true,
+			expected: expectJSON,
+		},
+		{
+			name:     "console",
+			format:   FormatConsole,
+			expected: expectConsole,
+		},
+		{
+			name:     "auto in a terminal",
+			format:   FormatAuto,
+			terminal: true,
+			expected: expectConsole,
+		},
+		{
+			name:     "auto without a terminal",
+			format:   FormatAuto,
+			expected: expectJSON,
+		},
+		{
+			name:     "empty is auto",
+			expected: expectJSON,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+
+	t.Run("invalid format", func(t *testing.T) {
+		_, err := newServerLogger(new(bytes.Buffer), "xml", false)
+		assert.ErrorContains(t, err, `invalid log format "xml"`)
+	})
+}
+
+func TestUseServerLogger_WithSetLevel(t *testing.T) {
+	origL := L
+	t.Cleanup(func() {
+		L = origL
+		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	})
+
+	assert.NilError(t, SetLevel("warn"))
+	assert.NilError(t, UseServerLogger(string(FormatJSON)))
+
+	buf := new(bytes.Buffer)
+	L.Logger = L.Output(buf)
+
+	Infof("not logged")
+	Warnf("logged")
+
+	entry := map[string]interface{}{}
+	assert.NilError(t, json.Unmarshal(buf.Bytes(), &entry), buf.String())
+	assert.Equal(t, entry["level"], "warn")
+	assert.Equal(t, entry["message"], "logged")
+
+	t.Run("invalid format does not change the logger", func(t *testing.T) {
+		current := L
+		assert.ErrorContains(t, UseServerLogger("yaml"), "invalid log format")
+		assert.Assert(t, L == current)
+	})
+}
+
+func TestUseFileLogger_Rotation(t *testing.T) {
+	origL, origTimeFormat := L, zerolog.TimeFieldFormat
+	t.Cleanup(func() {
+		L = origL
+		zerolog.TimeFieldFormat = origTimeFormat
+		assert.NilError(t, ReopenLogFile())
+		fileWriter = nil
+	})
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "server.log")
+	UseFileLogger(filename, FileLoggerOptions{MaxSizeMB: 1, MaxBackups: 2, Compress: true})
+
+	// write enough to rotate the file 3 times
+	line := strings.Repeat("a", 1024)
+	for i := 0; i < 3*1024+100; i++ {
+		L.Info().Str("data", line).Msg("fill")
+	}
+
+	// compression and removal of old backups happen in the background
+	poll.WaitOn(t, func(t poll.LogT) poll.Result {
+		backups, err := filepath.Glob(filepath.Join(dir, "server-*.log.gz"))
+		if err != nil {
+			return poll.Error(err)
+		}
+		uncompressed, err := filepath.Glob(filepath.Join(dir, "server-*.log"))
+		if err != nil {
+			return poll.Error(err)
+		}
+		if len(backups) != 2 || len(uncompressed) != 0 {
+			return poll.Continue("backups=%v uncompressed=%v", backups, uncompressed)
+		}
+		return poll.Success()
+	}, poll.WithTimeout(10*time.Second))
+
+	info, err := os.Stat(filename)
+	assert.NilError(t, err)
+	assert.Assert(t, info.Size() < 1024*1024)
+}
+
+func TestReopenLogFile(t *testing.T) {
+	origL, origTimeFormat := L, zerolog.TimeFieldFormat
+	t.Cleanup(func() {
+		L = origL
+		zerolog.TimeFieldFormat = origTimeFormat
+		assert.NilError(t, ReopenLogFile())
+		fileWriter = nil
+	})
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "connector.log")
+	UseFileLogger(filename, FileLoggerOptions{})
+
+	Infof("before rotate")
+
+	// simulate logrotate moving the file
+	rotated := filepath.Join(dir, "connector.log.1")
+	assert.NilError(t, os.Rename(filename, rotated))
+	assert.NilError(t, ReopenLogFile())
+
+	Infof("after rotate")
+
+	before, err := os.ReadFile(rotated)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(string(before), "before rotate"))
+	assert.Assert(t, !strings.Contains(string(before), "after rotate"))
+
+	after, err := os.ReadFile(filename)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(string(after), "after rotate"))
+}
+
+func TestNewFileWriter_Defaults(t *testing.T) {
+	writer := newFileWriter("infra.log", FileLoggerOptions{})
+	assert.Equal(t, writer.MaxSize, 10)
+	assert.Equal(t, writer.MaxBackups, 7)
+	assert.Equal(t, writer.MaxAge, 28)
+	assert.Equal(t, writer.Compress, false)
+
+	writer = newFileWriter("infra.log", FileLoggerOptions{MaxSizeMB: 100, MaxBackups: 3, MaxAgeDays: 90, Compress: true})
+	assert.Equal(t, writer.MaxSize, 100)
+	assert.Equal(t, writer.MaxBackups, 3)
+	assert.Equal(t, writer.MaxAge, 90)
+	assert.Equal(t, writer.Compress, true)
+}
+
+func TestNewConsoleLoggerWithOptions(t *testing.T) {
+	origTimestampFunc := zerolog.TimestampFunc
+	t.Cleanup(func() {
+		zerolog.TimestampFunc = origTimestampFunc
+	})
+	zerolog.TimestampFunc = func() time.Time {
+		return time.Date(2022, 12, 28, 14, 5, 9, 0, time.Local)
+	}
+
+	type testCase struct {
+		name     string
+		opts     consoleOptions
+		expected string
+	}
+
+	run := func(t *testing.T, tc testCase) {
+		buf := new(bytes.Buffer)
+		l := newConsoleLoggerWithOptions(buf, tc.opts)
+		l.Warn().Str("user", "alice").Msg("the message")
+		assert.Equal(t, buf.String(), tc.expected)
+	}
+
+	testCases := []testCase{
+		{
+			name:     "default",
+			opts:     consoleOptions{noColor: true},
+			expected: "WARN  the message user=alice\n",
+		},
+		{
+			name:     "with timestamps",
+			opts:     consoleOptions{noColor: true, timestamps: true},
+			expected: "14:05:09 WARN  the message user=alice\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
+
+func TestConsoleFormatLevel(t *testing.T) {
+	type testCase struct {
+		level   string
+		noColor string
+		color   string
+	}
+
+	run := func(t *testing.T, tc testCase) {
+		assert.Equal(t, consoleFormatLevel(true)(tc.level), tc.noColor)
+		assert.Equal(t, consoleFormatLevel(false)(tc.level), tc.color)
+	}
+
+	testCases := []testCase{
+		{level: "trace", noColor: "TRACE", color: "\x1b[35mTRACE\x1b[0m"},
+		{level: "debug", noColor: "DEBUG", color: "\x1b[33mDEBUG\x1b[0m"},
+		{level: "info", noColor: "INFO ", color: "\x1b[32mINFO \x1b[0m"},
+		{level: "warn", noColor: "WARN ", color: "\x1b[31mWARN \x1b[0m"},
+		{level: "error", noColor: "ERROR", color: "\x1b[1m\x1b[31mERROR\x1b[0m\x1b[0m"},
+		{level: "fatal", noColor: "FATAL", color: "\x1b[1m\x1b[31mFATAL\x1b[0m\x1b[0m"},
+		{level: "panic", noColor: "PANIC", color: "\x1b[1m\x1b[31mPANIC\x1b[0m\x1b[0m"},
+		{level: "other", noColor: "?????", color: "\x1b[1m?????\x1b[0m"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.level, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
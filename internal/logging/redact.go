@@ -0,0 +1,134 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// Secret is a string that should never be written to logs. Secret always
+// renders as *** followed by a hint of its length, so that it is still possible
+// to tell an empty value from a set value.
+//
+//	logging.L.Debug().Stringer("clientSecret", logging.Secret(provider.ClientSecret))
+type Secret string
+
+const redacted = "***"
+
+func (s Secret) String() string {
+	return fmt.Sprintf("%s(%d)", redacted, len(s))
+}
+
+func (s Secret) GoString() string {
+	return s.String()
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// sensitiveFields are the lowercase names of log fields that are always
+// redacted, no matter what type of value they contain.
+var sensitiveFields = map[string]bool{
+	"secret":        true,
+	"clientsecret":  true,
+	"client_secret": true,
+	"password":      true,
+	"authorization": true,
+	"privatekey":    true,
+	"private_key":   true,
+}
+
+// sensitiveFieldKey matches a JSON object key that is in sensitiveFields. It is
+// used to skip decoding log lines that do not have any sensitive fields.
+var sensitiveFieldKey = regexp.MustCompile(`(?i)"(?:secret|client_?secret|password|authorization|private_?key)"\s*:`)
+
+// redactWriter masks the values of sensitiveFields in JSON log lines before
+// writing them to out. Fields are masked at any depth, so structs logged with
+// Interface are also redacted.
+type redactWriter struct {
+	out io.Writer
+}
+
+func (w redactWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+// WriteLevel implements zerolog.LevelWriter, so that the level of the entry is
+// passed along when out is also a zerolog.LevelWriter.
+func (w redactWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	out, ok := redact(p)
+	if !ok {
+		// not a JSON log line, drop it rather than risk writing the secret
+		return len(p), nil
+	}
+	var err error
+	if lw, isLevelWriter := w.out.(zerolog.LevelWriter); isLevelWriter {
+		_, err = lw.WriteLevel(level, out)
+	} else {
+		_, err = w.out.Write(out)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// redact returns p with the values of sensitiveFields masked. It returns false
+// if p contains a sensitive field but could not be decoded.
+func redact(p []byte) ([]byte, bool) {
+	if !sensitiveFieldKey.Match(p) {
+		return p, true
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+	var entry map[string]interface{}
+	if err := dec.Decode(&entry); err != nil {
+		return nil, false
+	}
+	redactFields(entry)
+
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(entry); err != nil {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+func redactFields(value interface{}) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, v := range value {
+			if sensitiveFields[strings.ToLower(key)] {
+				value[key] = redactValue(v)
+				continue
+			}
+			redactFields(v)
+		}
+	case []interface{}:
+		for _, v := range value {
+			redactFields(v)
+		}
+	}
+}
+
+func redactValue(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		if strings.HasPrefix(value, redacted) {
+			// already rendered by Secret
+			return value
+		}
+		return Secret(value).String()
+	default:
+		return redacted
+	}
+}
@@ -0,0 +1,119 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"gotest.tools/v3/assert"
+)
+
+type providerConfig struct {
+	Name         string `json:"name"`
+	ClientID     string `json:"clientID"`
+	ClientSecret string `json:"clientSecret"`
+	Keys         []signingKey
+}
+
+type signingKey struct {
+	ID         string
+	PrivateKey string
+	Token      Secret
+}
+
+const theSecret = "s3cr3t-value-that-must-not-be-logged"
+
+func TestRedaction(t *testing.T) {
+	type testCase struct {
+		name     string
+		log      func(l *logger)
+		expected []string
+	}
+
+	run := func(t *testing.T, tc testCase) {
+		for _, console := range []bool{false, true} {
+			buf := new(bytes.Buffer)
+			l := newLogger(buf)
+			if console {
+				l = newConsoleLogger(buf)
+			}
+			l.Logger = l.Level(zerolog.DebugLevel)
+
+			tc.log(l)
+			output := buf.String()
+			assert.Assert(t, !strings.Contains(output, theSecret), "console=%v output=%v", console, output)
+			for _, expected := range tc.expected {
+				assert.Assert(t, strings.Contains(output, expected), "console=%v output=%v", console, output)
+			}
+		}
+	}
+
+	testCases := []testCase{
+		{
+			name: "struct with a secret field",
+			log: func(l *logger) {
+				provider := providerConfig{Name: "okta", ClientID: "the-client-id", ClientSecret: theSecret}
+				l.Info().Interface("provider", provider).Msg("loaded provider")
+			},
+			expected: []string{"the-client-id", "***(36)"},
+		},
+		{
+			name: "nested secret fields",
+			log: func(l *logger) {
+				provider := providerConfig{
+					Name: "okta",
+					Keys: []signingKey{{ID: "key-id", PrivateKey: theSecret, Token: theSecret}},
+				}
+				l.Info().Interface("provider", provider).Msg("loaded provider")
+			},
+			expected: []string{"key-id", "***(36)"},
+		},
+		{
+			name: "well known field names",
+			log: func(l *logger) {
+				l.Info().
+					Str("password", theSecret).
+					Str("Authorization", "Bearer "+theSecret).
+					Str("secret", theSecret).
+					Int("clientSecret", 12345).
+					Str("user", "alice").
+					Msg("request")
+			},
+			expected: []string{"alice", "***(36)", "***(43)"},
+		},
+		{
+			name: "secret value type",
+			log: func(l *logger) {
+				l.Info().Stringer("key", Secret(theSecret)).Msgf("created key %v", Secret(theSecret))
+			},
+			expected: []string{"created key ***(36)"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
+
+func TestRedactWriter_NoSensitiveFields(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := redactWriter{out: buf}
+
+	line := `{"level":"info","user":"alice","message":"a <b> & c"}` + "\n"
+	n, err := w.Write([]byte(line))
+	assert.NilError(t, err)
+	assert.Equal(t, n, len(line))
+	assert.Equal(t, buf.String(), line)
+}
+
+func TestSecret(t *testing.T) {
+	s := Secret(theSecret)
+	assert.Equal(t, s.String(), "***(36)")
+	assert.Equal(t, fmt.Sprintf("%v %s %#v", s, s, s), "***(36) ***(36) ***(36)")
+	assert.Equal(t, fmt.Sprintf("%+v", signingKey{ID: "a", Token: s}), "{ID:a PrivateKey: Token:***(36)}")
+	assert.Equal(t, Secret("").String(), "***(0)")
+}
@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// RepeatSampler limits the number of log lines written for an event that
+// repeats many times, like an error from a dependency that is unavailable.
+// Events are identified by a key. The first Burst occurrences of an event are
+// always logged, after that at most one occurrence is logged every Period.
+// Logged events include a suppressed field with the number of similar
+// events that were not logged since the last one.
+//
+// When an event has not occurred for Period the count is reset, and the next
+// occurrence starts a new burst.
+//
+// Events at fatal or panic level are never sampled.
+type RepeatSampler struct {
+	Burst  int
+	Period time.Duration
+
+	// now is time.Now. It is a field so that tests can use a fake clock.
+	now func() time.Time
+
+	mu     sync.Mutex
+	events map[string]*repeatedEvent
+}
+
+type repeatedEvent struct {
+	count      int
+	suppressed int
+	lastSeen   time.Time
+	lastLogged time.Time
+}
+
+// NewRepeatSampler returns a RepeatSampler that logs the first burst
+// occurrences of each event, and then one occurrence every period.
+func NewRepeatSampler(burst int, period time.Duration) *RepeatSampler {
+	return &RepeatSampler{
+		Burst:  burst,
+		Period: period,
+		now:    time.Now,
+		events: make(map[string]*repeatedEvent),
+	}
+}
+
+// Event starts a new log event with logger at level, for the event identified
+// by key. Event returns nil when the event should not be logged. Like the nil
+// events returned by a zerolog.Logger with a higher level, it is safe to call
+// methods on the nil event.
+//
+//	sampler.Event(&logging.L.Logger, zerolog.ErrorLevel, "sync-destination").
+//		Err(err).
+//		Msg("failed to update destination")
+func (s *RepeatSampler) Event(logger *zerolog.Logger, level zerolog.Level, key string) *zerolog.Event {
+	switch level {
+	case zerolog.FatalLevel:
+		return logger.Fatal()
+	case zerolog.PanicLevel:
+		return logger.Panic()
+	}
+
+	suppressed, ok := s.sample(key)
+	if !ok {
+		return nil
+	}
+	event := logger.WithLevel(level)
+	if suppressed > 0 {
+		event = event.Int("suppressed", suppressed)
+	}
+	return event
+}
+
+// sample records an occurrence of the event identified by key. It returns true
+// if the occurrence should be logged, and the number of occurrences that were
+// suppressed since the event was last logged.
+func (s *RepeatSampler) sample(key string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	event, ok := s.events[key]
+	if !ok || now.Sub(event.lastSeen) >= s.Period {
+		// the first occurrence, or the event stopped for a while, start a new burst
+		suppressed := 0
+		if ok {
+			suppressed = event.suppressed
+		}
+		event = &repeatedEvent{suppressed: suppressed}
+		s.events[key] = event
+	}
+	event.lastSeen = now
+	event.count++
+
+	if event.count > s.Burst && now.Sub(event.lastLogged) < s.Period {
+		event.suppressed++
+		return 0, false
+	}
+
+	suppressed := event.suppressed
+	event.suppressed = 0
+	event.lastLogged = now
+	return suppressed, true
+}
@@ -0,0 +1,137 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gotest.tools/v3/assert"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestRepeatSampler(burst int, period time.Duration) (*RepeatSampler, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2022, 12, 1, 10, 0, 0, 0, time.UTC)}
+	sampler := NewRepeatSampler(burst, period)
+	sampler.now = clock.Now
+	return sampler, clock
+}
+
+type logLine struct {
+	Level      string `json:"level"`
+	Message    string `json:"message"`
+	Suppressed int    `json:"suppressed"`
+}
+
+func readLogLines(t *testing.T, buf *bytes.Buffer) []logLine {
+	t.Helper()
+	var lines []logLine
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var line logLine
+		assert.NilError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	assert.NilError(t, scanner.Err())
+	return lines
+}
+
+func TestRepeatSampler(t *testing.T) {
+	sampler, clock := newTestRepeatSampler(5, time.Minute)
+	buf := new(bytes.Buffer)
+	logger := zerolog.New(buf)
+
+	// 1000 events over 10 minutes
+	for i := 0; i < 1000; i++ {
+		sampler.Event(&logger, zerolog.ErrorLevel, "registry").Msg("registry is down")
+		clock.Advance(600 * time.Millisecond)
+	}
+
+	lines := readLogLines(t, buf)
+	// the first 5, then one for each minute after the last of the first 5
+	assert.Equal(t, len(lines), 5+9)
+
+	total := 0
+	for i, line := range lines {
+		assert.Equal(t, line.Level, "error")
+		assert.Equal(t, line.Message, "registry is down")
+		if i < 5 {
+			assert.Equal(t, line.Suppressed, 0)
+		}
+		total += 1 + line.Suppressed
+	}
+	assert.Equal(t, lines[5].Suppressed, 99)
+	// the events after the last log line are still pending
+	assert.Assert(t, total <= 1000)
+	assert.Assert(t, total > 1000-100)
+}
+
+func TestRepeatSampler_KeysAreIndependent(t *testing.T) {
+	sampler, _ := newTestRepeatSampler(1, time.Minute)
+	buf := new(bytes.Buffer)
+	logger := zerolog.New(buf)
+
+	for i := 0; i < 1000; i++ {
+		sampler.Event(&logger, zerolog.WarnLevel, "jwks").Msg("jwks")
+		sampler.Event(&logger, zerolog.WarnLevel, "db").Msg("db")
+	}
+
+	lines := readLogLines(t, buf)
+	assert.DeepEqual(t, lines, []logLine{
+		{Level: "warn", Message: "jwks"},
+		{Level: "warn", Message: "db"},
+	})
+}
+
+func TestRepeatSampler_NewBurstAfterQuietPeriod(t *testing.T) {
+	sampler, clock := newTestRepeatSampler(2, time.Minute)
+	buf := new(bytes.Buffer)
+	logger := zerolog.New(buf)
+
+	for i := 0; i < 1000; i++ {
+		sampler.Event(&logger, zerolog.ErrorLevel, "registry").Msg("down")
+	}
+	clock.Advance(2 * time.Minute)
+	for i := 0; i < 1000; i++ {
+		sampler.Event(&logger, zerolog.ErrorLevel, "registry").Msg("down")
+	}
+
+	lines := readLogLines(t, buf)
+	assert.DeepEqual(t, lines, []logLine{
+		{Level: "error", Message: "down"},
+		{Level: "error", Message: "down"},
+		{Level: "error", Message: "down", Suppressed: 998},
+		{Level: "error", Message: "down"},
+	})
+}
+
+func TestRepeatSampler_FatalAndPanicAreNotSampled(t *testing.T) {
+	sampler, _ := newTestRepeatSampler(1, time.Minute)
+	buf := new(bytes.Buffer)
+	logger := zerolog.New(buf)
+
+	for i := 0; i < 1000; i++ {
+		func() {
+			defer func() {
+				assert.Assert(t, recover() != nil)
+			}()
+			sampler.Event(&logger, zerolog.PanicLevel, "registry").Msg("down")
+		}()
+	}
+
+	lines := readLogLines(t, buf)
+	assert.Equal(t, len(lines), 1000)
+}
@@ -6,34 +6,42 @@ import (
 	"github.com/rs/zerolog"
 )
 
-// consoleDefaultFormatLevel is copied from zerolog/console.go to modify the
-// names and colors used for levels.
-func consoleFormatLevel(i interface{}) string {
-	noColor := !isTerminal()
-	l, ok := i.(string)
-	if !ok {
-		return fmt.Sprintf("%v", i)
-	}
+// consoleLevels are the names and colors used by the console logger for each
+// level. Every name is padded to the same width, so that messages line up.
+var consoleLevels = map[string]struct {
+	name  string
+	color int
+	bold  bool
+}{
+	zerolog.LevelTraceValue: {name: "TRACE", color: colorMagenta},
+	zerolog.LevelDebugValue: {name: "DEBUG", color: colorYellow},
+	zerolog.LevelInfoValue:  {name: "INFO ", color: colorGreen},
+	zerolog.LevelWarnValue:  {name: "WARN ", color: colorRed},
+	zerolog.LevelErrorValue: {name: "ERROR", color: colorRed, bold: true},
+	zerolog.LevelFatalValue: {name: "FATAL", color: colorRed, bold: true},
+	zerolog.LevelPanicValue: {name: "PANIC", color: colorRed, bold: true},
+}
+
+// consoleFormatLevel returns the zerolog.ConsoleWriter FormatLevel function
+// used to modify the names and colors used for levels. It replaces
+// consoleDefaultFormatLevel from zerolog/console.go.
+func consoleFormatLevel(noColor bool) zerolog.Formatter {
+	return func(i interface{}) string {
+		l, ok := i.(string)
+		if !ok {
+			return fmt.Sprintf("%v", i)
+		}
 
-	switch l {
-	case zerolog.LevelTraceValue:
-		l = colorize("TRACE", colorMagenta, noColor)
-	case zerolog.LevelDebugValue:
-		l = colorize("DEBUG", colorYellow, noColor)
-	case zerolog.LevelInfoValue:
-		l = colorize("INFO ", colorGreen, noColor)
-	case zerolog.LevelWarnValue:
-		l = colorize("WARN ", colorRed, noColor)
-	case zerolog.LevelErrorValue:
-		l = colorize(colorize("ERROR", colorRed, noColor), colorBold, noColor)
-	case zerolog.LevelFatalValue:
-		l = colorize(colorize("FATAL", colorRed, noColor), colorBold, noColor)
-	case zerolog.LevelPanicValue:
-		l = colorize(colorize("PANIC", colorRed, noColor), colorBold, noColor)
-	default:
-		l = colorize("?????", colorBold, noColor)
+		level, ok := consoleLevels[l]
+		if !ok {
+			return colorize("?????", colorBold, noColor)
+		}
+		name := colorize(level.name, level.color, noColor)
+		if level.bold {
+			name = colorize(name, colorBold, noColor)
+		}
+		return name
 	}
-	return l
 }
 
 // nolint:unused,deadcode,varcheck
@@ -0,0 +1,234 @@
+/*
+Package lru provides an in-memory cache that is bounded by the number of
+entries and by the age of each entry.
+
+Caches are used to avoid repeating work, like fetching a document from an
+identity provider, or querying a row that rarely changes. An entry that was
+evicted is read again by the caller, so a cache that is too small only costs
+extra reads, never an incorrect result.
+*/
+package lru
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Options configures a Cache.
+type Options struct {
+	// Name identifies the cache in the labels of its metrics.
+	Name string
+	// MaxEntries is the maximum number of entries in the cache. When the cache
+	// is full the least recently used entry is evicted to add a new one.
+	MaxEntries int
+	// MaxAge is the maximum time an entry is returned by Get after it was
+	// added. Zero means entries do not expire.
+	MaxAge time.Duration
+	// Now returns the current time, used to check the age of entries. The
+	// default is time.Now.
+	Now func() time.Time
+}
+
+// Cache is a least recently used cache. It is safe for concurrent use.
+//
+// Cache implements prometheus.Collector, reporting the number of entries and
+// the number of hits, misses, and evictions of the cache, labeled with the
+// name of the cache.
+type Cache[K comparable, V any] struct {
+	opts    Options
+	metrics cacheMetrics
+	// now is replaced in tests.
+	now func() time.Time
+
+	mu sync.Mutex
+	// order contains the entries from the most to the least recently used.
+	order   *list.List
+	entries map[K]*list.Element
+
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+type entry[K comparable, V any] struct {
+	key    K
+	value  V
+	stored time.Time
+}
+
+// Stats describes the entries of a cache, and how often values were found in
+// it.
+type Stats struct {
+	Entries   int
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	// Oldest is the time the oldest entry was added, or the zero value when
+	// the cache is empty.
+	Oldest time.Time
+}
+
+// New returns a Cache. New panics if opts.MaxEntries is not positive, because
+// an unbounded cache is what this package exists to prevent.
+func New[K comparable, V any](opts Options) *Cache[K, V] {
+	if opts.MaxEntries <= 0 {
+		panic("lru: MaxEntries must be greater than zero")
+	}
+	now := opts.Now
+	if now == nil {
+		now = time.Now
+	}
+	return &Cache[K, V]{
+		opts:    opts,
+		metrics: newCacheMetrics(opts.Name),
+		now:     now,
+		order:   list.New(),
+		entries: make(map[K]*list.Element),
+	}
+}
+
+// Get returns the value of key, and true if the key was found and the entry
+// has not expired.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if ok && c.expired(elem) {
+		c.remove(elem)
+		c.evictions++
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		var zero V
+		return zero, false
+	}
+	c.hits++
+	c.order.MoveToFront(elem)
+	return elem.Value.(*entry[K, V]).value, true // nolint:forcetypeassert
+}
+
+// Add stores value for key, replacing any existing value. When the cache is
+// full the least recently used entry is evicted.
+func (c *Cache[K, V]) Add(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		elem.Value = &entry[K, V]{key: key, value: value, stored: now}
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, stored: now})
+	for c.order.Len() > c.opts.MaxEntries {
+		c.remove(c.order.Back())
+		c.evictions++
+	}
+}
+
+// Remove removes key from the cache.
+func (c *Cache[K, V]) Remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+}
+
+// Purge removes every entry from the cache.
+func (c *Cache[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.entries = make(map[K]*list.Element)
+}
+
+// Len returns the number of entries in the cache, including expired entries
+// that have not been removed yet.
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Stats returns the stats of the cache. Expired entries are not counted.
+func (c *Cache[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := Stats{Hits: c.hits, Misses: c.misses, Evictions: c.evictions}
+	for elem := c.order.Front(); elem != nil; elem = elem.Next() {
+		if c.expired(elem) {
+			continue
+		}
+		stats.Entries++
+		stored := elem.Value.(*entry[K, V]).stored // nolint:forcetypeassert
+		if stats.Oldest.IsZero() || stored.Before(stats.Oldest) {
+			stats.Oldest = stored
+		}
+	}
+	return stats
+}
+
+func (c *Cache[K, V]) expired(elem *list.Element) bool {
+	if c.opts.MaxAge == 0 {
+		return false
+	}
+	stored := elem.Value.(*entry[K, V]).stored // nolint:forcetypeassert
+	return c.now().Sub(stored) > c.opts.MaxAge
+}
+
+func (c *Cache[K, V]) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*entry[K, V]).key) // nolint:forcetypeassert
+}
+
+// cacheMetrics are the descriptors of the metrics of a cache. The name of the
+// cache is a constant label, so that the metrics of every cache can be
+// registered in the same registry.
+type cacheMetrics struct {
+	entries   *prometheus.Desc
+	hits      *prometheus.Desc
+	misses    *prometheus.Desc
+	evictions *prometheus.Desc
+}
+
+func newCacheMetrics(name string) cacheMetrics {
+	labels := prometheus.Labels{"cache": name}
+	return cacheMetrics{
+		entries: prometheus.NewDesc("infra_cache_entries",
+			"The number of entries in the cache", nil, labels),
+		hits: prometheus.NewDesc("infra_cache_hits_total",
+			"The number of lookups that found a value in the cache", nil, labels),
+		misses: prometheus.NewDesc("infra_cache_misses_total",
+			"The number of lookups that did not find a value in the cache", nil, labels),
+		evictions: prometheus.NewDesc("infra_cache_evictions_total",
+			"The number of entries removed from the cache because it was full, or because they expired", nil, labels),
+	}
+}
+
+// Describe implements prometheus.Collector. Caches registered in the same
+// registry must have different names.
+func (c *Cache[K, V]) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.metrics.entries
+	ch <- c.metrics.hits
+	ch <- c.metrics.misses
+	ch <- c.metrics.evictions
+}
+
+// Collect implements prometheus.Collector.
+func (c *Cache[K, V]) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	entries, hits, misses, evictions := c.order.Len(), c.hits, c.misses, c.evictions
+	c.mu.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(c.metrics.entries, prometheus.GaugeValue, float64(entries))
+	ch <- prometheus.MustNewConstMetric(c.metrics.hits, prometheus.CounterValue, float64(hits))
+	ch <- prometheus.MustNewConstMetric(c.metrics.misses, prometheus.CounterValue, float64(misses))
+	ch <- prometheus.MustNewConstMetric(c.metrics.evictions, prometheus.CounterValue, float64(evictions))
+}
@@ -0,0 +1,139 @@
+package lru
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gotest.tools/v3/assert"
+)
+
+func newTestCache(t *testing.T, opts Options) (*Cache[string, int], *time.Time) {
+	t.Helper()
+	now := time.Date(2023, 2, 1, 10, 0, 0, 0, time.UTC)
+	opts.Now = func() time.Time {
+		return now
+	}
+	return New[string, int](opts), &now
+}
+
+func TestCache_EvictionOrder(t *testing.T) {
+	cache, _ := newTestCache(t, Options{Name: "test", MaxEntries: 3})
+
+	cache.Add("a", 1)
+	cache.Add("b", 2)
+	cache.Add("c", 3)
+
+	// a is now the most recently used entry, and b the least recently used
+	_, ok := cache.Get("a")
+	assert.Assert(t, ok)
+
+	cache.Add("d", 4)
+	_, ok = cache.Get("b")
+	assert.Assert(t, !ok, "expected the least recently used entry to be evicted")
+
+	for key, expected := range map[string]int{"a": 1, "c": 3, "d": 4} {
+		value, ok := cache.Get(key)
+		assert.Assert(t, ok, key)
+		assert.Equal(t, value, expected)
+	}
+	assert.Equal(t, cache.Len(), 3)
+
+	t.Run("replacing a value makes it the most recently used", func(t *testing.T) {
+		cache, _ := newTestCache(t, Options{Name: "test", MaxEntries: 2})
+		cache.Add("a", 1)
+		cache.Add("b", 2)
+		cache.Add("a", 10)
+		cache.Add("c", 3)
+
+		value, ok := cache.Get("a")
+		assert.Assert(t, ok)
+		assert.Equal(t, value, 10)
+		_, ok = cache.Get("b")
+		assert.Assert(t, !ok)
+	})
+}
+
+func TestCache_MaxAge(t *testing.T) {
+	cache, now := newTestCache(t, Options{Name: "test", MaxEntries: 10, MaxAge: time.Minute})
+
+	cache.Add("a", 1)
+	*now = now.Add(30 * time.Second)
+	cache.Add("b", 2)
+
+	*now = now.Add(31 * time.Second)
+	_, ok := cache.Get("a")
+	assert.Assert(t, !ok, "expected the entry to expire")
+	value, ok := cache.Get("b")
+	assert.Assert(t, ok)
+	assert.Equal(t, value, 2)
+
+	expected := Stats{Entries: 1, Hits: 1, Misses: 1, Evictions: 1, Oldest: now.Add(-31 * time.Second)}
+	assert.DeepEqual(t, cache.Stats(), expected)
+}
+
+func TestCache_RemoveAndPurge(t *testing.T) {
+	cache, _ := newTestCache(t, Options{Name: "test", MaxEntries: 10})
+	cache.Add("a", 1)
+	cache.Add("b", 2)
+
+	cache.Remove("a")
+	_, ok := cache.Get("a")
+	assert.Assert(t, !ok)
+
+	cache.Purge()
+	assert.Equal(t, cache.Len(), 0)
+
+	// removed entries are not evictions
+	assert.Equal(t, cache.Stats().Evictions, int64(0))
+}
+
+func TestNew_RequiresMaxEntries(t *testing.T) {
+	defer func() {
+		assert.Assert(t, recover() != nil, "expected a panic")
+	}()
+	New[string, int](Options{Name: "unbounded"})
+}
+
+func TestCache_Metrics(t *testing.T) {
+	first, _ := newTestCache(t, Options{Name: "first", MaxEntries: 1})
+	second, _ := newTestCache(t, Options{Name: "second", MaxEntries: 10})
+
+	registry := prometheus.NewRegistry()
+	assert.NilError(t, registry.Register(first))
+	assert.NilError(t, registry.Register(second))
+
+	t.Run("a cache with the same name can not be registered twice", func(t *testing.T) {
+		other, _ := newTestCache(t, Options{Name: "first", MaxEntries: 1})
+		assert.ErrorContains(t, registry.Register(other), "duplicate metrics collector registration")
+	})
+
+	first.Add("a", 1)
+	first.Add("b", 2)
+	first.Get("b")
+	first.Get("a")
+	second.Add("a", 1)
+
+	expected := `
+# HELP infra_cache_entries The number of entries in the cache
+# TYPE infra_cache_entries gauge
+infra_cache_entries{cache="first"} 1
+infra_cache_entries{cache="second"} 1
+# HELP infra_cache_evictions_total The number of entries removed from the cache because it was full, or because they expired
+# TYPE infra_cache_evictions_total counter
+infra_cache_evictions_total{cache="first"} 1
+infra_cache_evictions_total{cache="second"} 0
+# HELP infra_cache_hits_total The number of lookups that found a value in the cache
+# TYPE infra_cache_hits_total counter
+infra_cache_hits_total{cache="first"} 1
+infra_cache_hits_total{cache="second"} 0
+# HELP infra_cache_misses_total The number of lookups that did not find a value in the cache
+# TYPE infra_cache_misses_total counter
+infra_cache_misses_total{cache="first"} 1
+infra_cache_misses_total{cache="second"} 0
+`
+	err := testutil.GatherAndCompare(registry, strings.NewReader(expected))
+	assert.NilError(t, err)
+}
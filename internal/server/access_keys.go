@@ -1,13 +1,17 @@
 package server
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/infrahq/infra/api"
 	"github.com/infrahq/infra/internal/access"
+	"github.com/infrahq/infra/internal/server/audit"
+	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/internal/validate"
 )
 
 func (a *API) ListAccessKeys(c *gin.Context, r *api.ListAccessKeysRequest) (*api.ListResponse[api.AccessKey], error) {
@@ -26,27 +30,104 @@ func (a *API) ListAccessKeys(c *gin.Context, r *api.ListAccessKeysRequest) (*api
 
 // DeleteAccessKey deletes an access key by id
 func (a *API) DeleteAccessKey(c *gin.Context, r *api.Resource) (*api.EmptyResponse, error) {
-	return nil, access.DeleteAccessKey(getRequestContext(c), r.ID, "")
+	key, err := access.DeleteAccessKey(getRequestContext(c), r.ID, "")
+	target := auditTarget{Type: "accesskey", ID: r.ID.String()}
+	if key != nil {
+		target = accessKeyAuditTarget(key)
+	}
+	a.recordAuditOnCommit(c, audit.ActionAccessKeyDelete, target, err)
+	if err != nil {
+		return nil, err
+	}
+	return nil, a.emitWebhookEvent(c, api.WebhookEventAccessKeyRevoked, key.ToAPI())
 }
 
 // DeleteAccessKeys deletes 0 or more access keys by any attribute
 func (a *API) DeleteAccessKeys(c *gin.Context, r *api.DeleteAccessKeyRequest) (*api.EmptyResponse, error) {
-	return nil, access.DeleteAccessKey(getRequestContext(c), 0, r.Name)
+	key, err := access.DeleteAccessKey(getRequestContext(c), 0, r.Name)
+	target := auditTarget{Type: "accesskey", ID: r.Name, Name: r.Name}
+	if key != nil {
+		target = accessKeyAuditTarget(key)
+	}
+	a.recordAuditOnCommit(c, audit.ActionAccessKeyDelete, target, err)
+	if err != nil {
+		return nil, err
+	}
+	return nil, a.emitWebhookEvent(c, api.WebhookEventAccessKeyRevoked, key.ToAPI())
+}
+
+// BulkDeleteAccessKeys deletes each of the access keys in the request. A key
+// that can not be deleted does not prevent the others from being deleted.
+func (a *API) BulkDeleteAccessKeys(c *gin.Context, r *api.BulkDeleteRequest) (*api.BulkDeleteResponse, error) {
+	ids := uniqueIDs(r.IDs)
+	deleted, failed, err := access.DeleteAccessKeys(getRequestContext(c), ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if err, ok := failed[id]; ok {
+			a.recordAuditOnCommit(c, audit.ActionAccessKeyDelete, auditTarget{Type: "accesskey", ID: id.String()}, err)
+		}
+	}
+	for _, key := range deleted {
+		a.recordAuditOnCommit(c, audit.ActionAccessKeyDelete, accessKeyAuditTarget(&key), nil)
+		if err := a.emitWebhookEvent(c, api.WebhookEventAccessKeyRevoked, key.ToAPI()); err != nil {
+			return nil, err
+		}
+	}
+	return newBulkDeleteResponse(ids, failed), nil
 }
 
 func (a *API) CreateAccessKey(c *gin.Context, r *api.CreateAccessKeyRequest) (*api.CreateAccessKeyResponse, error) {
+	settings, err := a.server.orgSettings(getRequestContext(c).DBTxn)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	var expiresAt time.Time
+	switch {
+	case !r.Expires.Time().IsZero():
+		expiresAt = r.Expires.Time().UTC()
+	case r.Expiry != 0:
+		expiresAt = now.Add(time.Duration(r.Expiry))
+	default:
+		expiry := settings.AccessKeyTTL
+		// the server default may be longer than the maximum of the org
+		if settings.MaxAccessKeyTTL > 0 && expiry > settings.MaxAccessKeyTTL {
+			expiry = settings.MaxAccessKeyTTL
+		}
+		expiresAt = now.Add(expiry)
+	}
+	if maxTTL := settings.MaxAccessKeyTTL; maxTTL > 0 && expiresAt.Sub(now) > maxTTL {
+		field := "expiry"
+		if !r.Expires.Time().IsZero() {
+			field = "expires"
+		}
+		return nil, validate.Error{field: {fmt.Sprintf("must be at most %v from now, the maximum set by the organization", api.Duration(maxTTL))}}
+	}
+
+	inactivityTimeout := time.Duration(r.InactivityTimeout)
+	if inactivityTimeout == 0 {
+		inactivityTimeout = settings.SessionInactivityTimeout
+	}
+
 	accessKey := &models.AccessKey{
 		IssuedFor:           r.UserID,
 		Name:                r.Name,
-		ExpiresAt:           time.Now().UTC().Add(time.Duration(r.Expiry)),
-		InactivityExtension: time.Duration(r.InactivityTimeout),
-		InactivityTimeout:   time.Now().UTC().Add(time.Duration(r.InactivityTimeout)),
+		ExpiresAt:           expiresAt,
+		InactivityExtension: inactivityTimeout,
+		InactivityTimeout:   now.Add(inactivityTimeout),
 	}
 
 	raw, err := access.CreateAccessKey(c, accessKey)
+	a.recordAuditOnCommit(c, audit.ActionAccessKeyCreate, accessKeyAuditTarget(accessKey), err)
 	if err != nil {
 		return nil, err
 	}
+	if err := a.emitWebhookEvent(c, api.WebhookEventAccessKeyCreated, accessKey.ToAPI()); err != nil {
+		return nil, err
+	}
 
 	return &api.CreateAccessKeyResponse{
 		ID:                accessKey.ID,
@@ -58,3 +139,26 @@ func (a *API) CreateAccessKey(c *gin.Context, r *api.CreateAccessKeyRequest) (*a
 		AccessKey:         raw,
 	}, nil
 }
+
+// ExtendAccessKey extends the inactivity timeout of the access key used for
+// the request. Unlike the implicit extension that happens on every request,
+// the key is always updated, so a client can extend a key before a long
+// period of inactivity.
+func (a *API) ExtendAccessKey(c *gin.Context, _ *api.EmptyRequest) (*api.ExtendAccessKeyResponse, error) {
+	// does not need authorization check, this action is limited to the calling key
+	rCtx := getRequestContext(c)
+	key := rCtx.Authenticated.AccessKey
+	if key == nil {
+		return nil, fmt.Errorf("no authenticated access key")
+	}
+
+	if err := data.ExtendAccessKeyInactivityTimeout(rCtx.DBTxn, key, a.server.accessKeyOptions()); err != nil {
+		return nil, err
+	}
+
+	return &api.ExtendAccessKeyResponse{
+		ID:                key.ID,
+		Expires:           api.Time(key.ExpiresAt),
+		InactivityTimeout: api.Time(key.InactivityTimeout),
+	}, nil
+}
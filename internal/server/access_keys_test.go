@@ -13,8 +13,10 @@ import (
 
 	gocmp "github.com/google/go-cmp/cmp"
 	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/opt"
 
 	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal"
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
 	"github.com/infrahq/infra/uid"
@@ -109,7 +111,7 @@ func TestAPI_CreateAccessKey(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{FieldName: "name", Errors: []string{"character '/' at position 34 is not allowed"}},
+					{FieldName: "name", ErrorCode: api.ErrorCodeInvalid, Errors: []string{"character '/' at position 34 is not allowed"}},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
 			},
@@ -158,6 +160,127 @@ func TestAPI_CreateAccessKey(t *testing.T) {
 	}
 }
 
+func TestAPI_CreateAccessKey_Expiry(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+
+	user := createUser(t, srv, routes, "expiry@example.com")
+
+	post := func(t *testing.T, method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := post(t, http.MethodPut, "/api/settings", `{
+		"passwordRequirements": {"lengthMin": 8},
+		"maxAccessKeyTTL": "30d"
+	}`)
+	assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+	type testCase struct {
+		name            string
+		fields          string
+		expectedExpires time.Time
+		expectedErr     []api.FieldError
+		expectedMessage string
+	}
+
+	run := func(t *testing.T, tc testCase) {
+		body := fmt.Sprintf(`{"userID": %q, %s}`, user.ID, tc.fields)
+		resp := post(t, http.MethodPost, "/api/access-keys", body)
+
+		if tc.expectedErr != nil || tc.expectedMessage != "" {
+			assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+			var respBody api.Error
+			assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &respBody))
+			assert.DeepEqual(t, respBody.FieldErrors, tc.expectedErr)
+			assert.Assert(t, strings.Contains(respBody.Message, tc.expectedMessage), respBody.Message)
+			return
+		}
+
+		assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+		var respBody api.CreateAccessKeyResponse
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &respBody))
+		assert.DeepEqual(t, respBody.Expires.Time(), tc.expectedExpires, opt.TimeWithThreshold(time.Minute))
+	}
+
+	expires := time.Now().Add(10 * 24 * time.Hour).UTC().Truncate(time.Second)
+
+	testCases := []testCase{
+		{
+			name:            "minutes",
+			fields:          `"expiry": "90m"`,
+			expectedExpires: time.Now().Add(90 * time.Minute),
+		},
+		{
+			name:            "days",
+			fields:          `"expiry": "30d"`,
+			expectedExpires: time.Now().Add(30 * 24 * time.Hour),
+		},
+		{
+			name:            "weeks",
+			fields:          `"expiry": "2w"`,
+			expectedExpires: time.Now().Add(14 * 24 * time.Hour),
+		},
+		{
+			name:            "absolute expiry",
+			fields:          fmt.Sprintf(`"expires": %q`, expires.Format(time.RFC3339)),
+			expectedExpires: expires,
+		},
+		{
+			name:            "invalid unit",
+			fields:          `"expiry": "3y"`,
+			expectedMessage: `invalid duration "3y", must be a number followed by a unit of w, d, h, m, or s`,
+		},
+		{
+			name:   "both expiry and expires",
+			fields: fmt.Sprintf(`"expiry": "1d", "expires": %q`, expires.Format(time.RFC3339)),
+			expectedErr: []api.FieldError{
+				{ErrorCode: api.ErrorCodeInvalid, Errors: []string{"only one of (expiry, expires) can have a value"}},
+			},
+		},
+		{
+			name:   "exceeds the org max",
+			fields: `"expiry": "31d"`,
+			expectedErr: []api.FieldError{
+				{FieldName: "expiry", ErrorCode: api.ErrorCodeInvalid, Errors: []string{"must be at most 720h0m0s from now, the maximum set by the organization"}},
+			},
+		},
+		{
+			name:   "absolute expiry exceeds the org max",
+			fields: fmt.Sprintf(`"expires": %q`, time.Now().Add(31*24*time.Hour).UTC().Format(time.RFC3339)),
+			expectedErr: []api.FieldError{
+				{FieldName: "expires", ErrorCode: api.ErrorCodeInvalid, Errors: []string{"must be at most 720h0m0s from now, the maximum set by the organization"}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+
+	t.Run("default expiry is limited by the org max", func(t *testing.T) {
+		resp := post(t, http.MethodPut, "/api/settings", `{
+			"passwordRequirements": {"lengthMin": 8},
+			"maxAccessKeyTTL": "2m"
+		}`)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		assert.Assert(t, srv.options.SessionDuration > 2*time.Minute)
+
+		run(t, testCase{
+			fields:          `"name": "default-expiry"`,
+			expectedExpires: time.Now().Add(2 * time.Minute),
+		})
+	})
+}
+
 var cmpAPICreateAccessKeyJSON = gocmp.Options{
 	gocmp.FilterPath(pathMapKey(`created`, `expires`, `extensionDeadline`), cmpApproximateTime),
 	gocmp.FilterPath(pathMapKey(`id`), cmpAnyValidUID),
@@ -320,14 +443,14 @@ func TestAPI_ListAccessKeys(t *testing.T) {
 		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
 
 		routes.ServeHTTP(resp, req)
-		assert.Equal(t, resp.Code, http.StatusBadRequest)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		assert.Equal(t, resp.Header().Get("Infra-Version"), apiVersionLatest)
 
-		errMsg := api.Error{}
-		err := json.Unmarshal(resp.Body.Bytes(), &errMsg)
+		// the latest version uses the new field names
+		var keys api.ListResponse[api.AccessKey]
+		err := json.Unmarshal(resp.Body.Bytes(), &keys)
 		assert.NilError(t, err)
-
-		assert.Assert(t, strings.Contains(errMsg.Message, "Infra-Version header is required"))
-		assert.Equal(t, errMsg.Code, int32(400))
+		assert.Assert(t, !strings.Contains(resp.Body.String(), "extensionDeadline"))
 	})
 
 	t.Run("version 0.18.0", func(t *testing.T) {
@@ -375,6 +498,72 @@ func TestAPI_ListAccessKeys(t *testing.T) {
 	})
 }
 
+func TestAPI_BulkDeleteAccessKeys(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+	db := srv.DB()
+	provider := data.InfraProvider(db)
+
+	selfKey, user := createAccessKey(t, db, "keys@example.com")
+	keyID, _, _ := strings.Cut(selfKey, ".")
+	self, err := data.GetAccessKeyByKeyID(db, keyID)
+	assert.NilError(t, err)
+
+	createKey := func(t *testing.T, issuedFor uid.ID) *models.AccessKey {
+		t.Helper()
+		key := &models.AccessKey{
+			IssuedFor:  issuedFor,
+			ProviderID: provider.ID,
+			ExpiresAt:  time.Now().Add(time.Minute),
+		}
+		_, err := data.CreateAccessKey(db, key)
+		assert.NilError(t, err)
+		return key
+	}
+
+	other := &models.Identity{Name: "other@example.com"}
+	createIdentities(t, db, other)
+
+	ownKey := createKey(t, user.ID)
+	otherKey := createKey(t, other.ID)
+	missing := uid.New()
+
+	t.Run("mix of own, other, missing, and current keys", func(t *testing.T) {
+		results := bulkDelete(t, routes, "/api/access-keys/bulk-delete", selfKey,
+			ownKey.ID, otherKey.ID, missing, self.ID)
+		expected := []api.BulkDeleteResult{
+			{ID: ownKey.ID, Status: "deleted"},
+			{
+				ID:      otherKey.ID,
+				Status:  "forbidden",
+				Message: "you do not have permission to delete access key, requires role admin",
+			},
+			{ID: missing, Status: "not_found", Message: "record not found: access key not found"},
+			{
+				ID:      self.ID,
+				Status:  "bad_request",
+				Message: "bad request: cannot delete the access key used by this request",
+			},
+		}
+		assert.DeepEqual(t, results, expected)
+
+		_, err := data.GetAccessKey(db, data.GetAccessKeysOptions{ByID: ownKey.ID})
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+		_, err = data.GetAccessKey(db, data.GetAccessKeysOptions{ByID: otherKey.ID})
+		assert.NilError(t, err)
+	})
+
+	t.Run("admin can delete keys of other users", func(t *testing.T) {
+		results := bulkDelete(t, routes, "/api/access-keys/bulk-delete", adminAccessKey(srv),
+			otherKey.ID, self.ID)
+		expected := []api.BulkDeleteResult{
+			{ID: otherKey.ID, Status: "deleted"},
+			{ID: self.ID, Status: "deleted"},
+		}
+		assert.DeepEqual(t, results, expected)
+	})
+}
+
 func TestAPI_DeleteAccessKey(t *testing.T) {
 	srv := setupServer(t, withAdminUser)
 	routes := srv.GenerateRoutes()
@@ -481,3 +670,149 @@ func TestAPI_DeleteAccessKey(t *testing.T) {
 		assert.Equal(t, resp.Code, http.StatusNotFound)
 	})
 }
+
+func TestAPI_ExtendAccessKey(t *testing.T) {
+	type testCase struct {
+		name     string
+		setup    func(t *testing.T, key *models.AccessKey)
+		expected func(t *testing.T, resp *httptest.ResponseRecorder, key *models.AccessKey)
+	}
+
+	srv := setupServer(t)
+	routes := srv.GenerateRoutes()
+	provider := data.InfraProvider(srv.DB())
+
+	user := &models.Identity{Name: "extend@example.com"}
+	assert.NilError(t, data.CreateIdentity(srv.DB(), user))
+
+	run := func(t *testing.T, tc testCase) {
+		key := &models.AccessKey{
+			IssuedFor:           user.ID,
+			ProviderID:          provider.ID,
+			ExpiresAt:           time.Now().Add(time.Hour),
+			InactivityTimeout:   time.Now().Add(time.Minute),
+			InactivityExtension: 10 * time.Minute,
+		}
+		if tc.setup != nil {
+			tc.setup(t, key)
+		}
+		_, err := data.CreateAccessKey(srv.DB(), key)
+		assert.NilError(t, err)
+
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodPost, "/api/access-keys/self/extend", nil)
+		req.Header.Set("Authorization", "Bearer "+key.Token())
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+
+		tc.expected(t, resp, key)
+	}
+
+	testCases := []testCase{
+		{
+			name: "success",
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder, key *models.AccessKey) {
+				assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+				var actual api.ExtendAccessKeyResponse
+				assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &actual))
+				assert.Equal(t, actual.ID, key.ID)
+				assert.DeepEqual(t, actual.Expires.Time(), key.ExpiresAt, opt.TimeWithThreshold(api.TimePrecision))
+				assert.DeepEqual(t, actual.InactivityTimeout.Time(), time.Now().Add(10*time.Minute),
+					opt.TimeWithThreshold(time.Second))
+
+				updated, err := data.GetAccessKey(srv.DB(), data.GetAccessKeysOptions{ByID: key.ID})
+				assert.NilError(t, err)
+				assert.DeepEqual(t, updated.InactivityTimeout, actual.InactivityTimeout.Time(), opt.TimeWithThreshold(api.TimePrecision))
+			},
+		},
+		{
+			name: "past the inactivity timeout",
+			setup: func(t *testing.T, key *models.AccessKey) {
+				key.InactivityTimeout = time.Now().Add(-time.Minute)
+			},
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder, key *models.AccessKey) {
+				assert.Equal(t, resp.Code, http.StatusUnauthorized, resp.Body.String())
+
+				updated, err := data.GetAccessKey(srv.DB(), data.GetAccessKeysOptions{ByID: key.ID})
+				assert.NilError(t, err)
+				assert.Assert(t, updated.InactivityTimeout.Before(time.Now()))
+			},
+		},
+		{
+			name: "key without an inactivity timeout",
+			setup: func(t *testing.T, key *models.AccessKey) {
+				key.InactivityTimeout = time.Time{}
+			},
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder, key *models.AccessKey) {
+				assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+				var actual api.ExtendAccessKeyResponse
+				assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &actual))
+				assert.Assert(t, actual.InactivityTimeout.Time().IsZero())
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
+
+func TestAPI_ExtendAccessKey_ImplicitExtensionDisabled(t *testing.T) {
+	srv := setupServer(t, func(t *testing.T, options *Options) {
+		options.DisableImplicitSessionExtension = true
+	})
+	routes := srv.GenerateRoutes()
+
+	user := &models.Identity{Name: "extend@example.com"}
+	assert.NilError(t, data.CreateIdentity(srv.DB(), user))
+
+	key := &models.AccessKey{
+		IssuedFor:           user.ID,
+		ProviderID:          data.InfraProvider(srv.DB()).ID,
+		ExpiresAt:           time.Now().Add(time.Hour),
+		InactivityTimeout:   time.Now().Add(time.Minute),
+		InactivityExtension: 10 * time.Minute,
+	}
+	_, err := data.CreateAccessKey(srv.DB(), key)
+	assert.NilError(t, err)
+
+	request := func(t *testing.T, method, path string) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+key.Token())
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		return resp
+	}
+	inactivityTimeout := func(t *testing.T) time.Time {
+		t.Helper()
+		key, err := data.GetAccessKey(srv.DB(), data.GetAccessKeysOptions{ByID: key.ID})
+		assert.NilError(t, err)
+		return key.InactivityTimeout
+	}
+
+	orig := inactivityTimeout(t)
+
+	t.Run("other requests do not extend the key", func(t *testing.T) {
+		request(t, http.MethodGet, "/api/self")
+		assert.Equal(t, inactivityTimeout(t), orig)
+	})
+
+	t.Run("explicit extend", func(t *testing.T) {
+		resp := request(t, http.MethodPost, "/api/access-keys/self/extend")
+
+		var actual api.ExtendAccessKeyResponse
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &actual))
+		assert.DeepEqual(t, actual.InactivityTimeout.Time(), time.Now().Add(10*time.Minute),
+			opt.TimeWithThreshold(time.Second))
+		assert.DeepEqual(t, inactivityTimeout(t), actual.InactivityTimeout.Time(), opt.TimeWithThreshold(api.TimePrecision))
+	})
+}
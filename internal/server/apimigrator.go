@@ -84,10 +84,12 @@ func addRequestRewrite[oldReq any, newReq any](api *API, method, path, version s
 	})
 }
 
+// requestVersion returns the version of the API requested with the
+// Infra-Version header. Requests without the header get the latest version.
 func requestVersion(req *http.Request) (*semver.Version, error) {
 	headerVer := req.Header.Get("Infra-Version")
 	if headerVer == "" {
-		return nil, fmt.Errorf("%w: Infra-Version header is required. The current version is %s", internal.ErrBadRequest, internal.FullVersion())
+		return semver.MustParse(internal.FullVersion()), nil
 	}
 	reqVer, err := semver.NewVersion(headerVer)
 	if err != nil {
@@ -99,7 +101,8 @@ func requestVersion(req *http.Request) (*semver.Version, error) {
 func rewriteRequired(c *gin.Context, migrationVersion *semver.Version) bool {
 	reqVer, err := requestVersion(c.Request)
 	if err != nil {
-		// should be impossible, header was already validated earlier
+		// the header was already validated by wrapRoute, except on routes
+		// where it is optional. Those get the latest version.
 		return false
 	}
 	return reqVer.LessThan(migrationVersion) || reqVer.Equal(migrationVersion)
@@ -127,6 +130,14 @@ func rebuildRequest(c *gin.Context, newReqObj interface{}) {
 				rebuildRequestQuery(f)
 			}
 			if fieldName, ok := t.Field(i).Tag.Lookup("form"); ok {
+				f := f
+				if f.Kind() == reflect.Pointer {
+					// optional query parameters are omitted when they are nil
+					if f.IsNil() {
+						continue
+					}
+					f = f.Elem()
+				}
 				if f.Type() == reflect.TypeOf(uid.ID(0)) {
 					query.Add(fieldName, uid.ID(f.Int()).String())
 					continue
@@ -181,6 +192,10 @@ func rebuildRequest(c *gin.Context, newReqObj interface{}) {
 	}
 }
 
+// addResponseRewrite adds a response migration to the list of api.migrations.
+// version is the last version that supports the old response structure. f
+// converts the response of the handler to the old response structure, for
+// requests that use version or an earlier version.
 func addResponseRewrite[newResp any, oldResp any](a *API, method, path, version string, f func(newResp) oldResp) {
 	migrationVersion, err := semver.NewVersion(version)
 	if err != nil {
@@ -198,7 +213,8 @@ func addResponseRewrite[newResp any, oldResp any](a *API, method, path, version
 				return
 			}
 
-			w := &responseWriter{ResponseWriter: c.Writer}
+			// start as not written, so that wrapRoute writes the response to w
+			w := &responseWriter{ResponseWriter: c.Writer, size: noWritten}
 			c.Writer = w
 
 			c.Next()
@@ -47,6 +47,46 @@ func TestAddRequestRewrite(t *testing.T) {
 	assert.Equal(t, resp.Result().StatusCode, 200)
 }
 
+func TestAddRequestRewrite_PointerQueryParameter(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+
+	a := &API{server: srv}
+	router := gin.New()
+
+	type pointerTestRequest struct {
+		Name      string `form:"name"`
+		WithTotal *bool  `form:"withTotal"`
+	}
+
+	addRequestRewrite(a, "get", "/test", "0.1.0", func(old pointerTestRequest) pointerTestRequest {
+		return old
+	})
+
+	var got pointerTestRequest
+	get(a, rg(router.Group("/")), "/test", func(c *gin.Context, req *pointerTestRequest) (*api.EmptyResponse, error) {
+		got = *req
+		return nil, nil
+	})
+
+	run := func(t *testing.T, query string) {
+		t.Helper()
+		got = pointerTestRequest{}
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/test?"+query, nil)
+		req.Header.Add("Infra-Version", "0.1.0")
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, resp.Result().StatusCode, 200)
+	}
+
+	run(t, "name=carrot")
+	assert.Equal(t, got.Name, "carrot")
+	assert.Assert(t, got.WithTotal == nil)
+
+	run(t, "name=carrot&withTotal=false")
+	assert.Equal(t, got.Name, "carrot")
+	assert.Assert(t, got.WithTotal != nil && !*got.WithTotal)
+}
+
 func rg(g *gin.RouterGroup) *routeGroup {
 	return &routeGroup{RouterGroup: g, noAuthentication: true, noOrgRequired: true}
 }
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/access"
+	"github.com/infrahq/infra/internal/server/audit"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+// newAuditLogger returns an audit.Logger that writes to the sinks selected by
+// opts. It returns nil when no sink is selected, which discards all events.
+func newAuditLogger(opts AuditOptions, db *data.DB) *audit.Logger {
+	var sinks []audit.Sink
+	if opts.File != "" {
+		sinks = append(sinks, audit.NewFileSink(opts.File, opts.FileRotation))
+	}
+	if opts.Database {
+		sinks = append(sinks, audit.DBSink{DB: db})
+	}
+	if len(sinks) == 0 {
+		return nil
+	}
+	return audit.New(sinks...)
+}
+
+// auditTarget is the resource an audited action was performed on.
+type auditTarget struct {
+	Type string
+	ID   string
+	// Name is a snapshot of the name of the resource, so that events can be
+	// found by name after the resource was renamed or deleted.
+	Name     string
+	Metadata models.JSONMap
+}
+
+// recordAudit records an audit event for an action performed by the
+// authenticated user of the request. The result of the event is a failure
+// when err is not nil.
+func (a *API) recordAudit(c *gin.Context, action string, target auditTarget, err error) {
+	event := newAuditEvent(c, action, target, err)
+	a.server.auditLog.Record(auditContext(c), event)
+}
+
+// recordAuditOnCommit is like recordAudit, but a successful action is only
+// recorded after the request transaction commits, so that an action that
+// was rolled back is not in the audit log. Failures are recorded immediately.
+func (a *API) recordAuditOnCommit(c *gin.Context, action string, target auditTarget, err error) {
+	if err != nil {
+		a.recordAudit(c, action, target, err)
+		return
+	}
+	event := newAuditEvent(c, action, target, nil)
+	ctx := auditContext(c)
+	getRequestContext(c).DBTxn.OnCommit(func() {
+		a.server.auditLog.Record(ctx, event)
+	})
+}
+
+// auditContext returns the context of the request, which carries the request
+// ID recorded with the event. Handlers called without an HTTP request use the
+// background context.
+func auditContext(c *gin.Context) context.Context {
+	if c.Request == nil {
+		return context.Background()
+	}
+	return c.Request.Context()
+}
+
+func newAuditEvent(c *gin.Context, action string, target auditTarget, err error) models.AuditEvent {
+	rCtx := getRequestContext(c)
+	event := models.AuditEvent{
+		Action:     action,
+		TargetType: target.Type,
+		TargetID:   target.ID,
+		TargetName: target.Name,
+		Metadata:   target.Metadata,
+		Result:     models.AuditResultSuccess,
+	}
+	if err != nil {
+		event.Result = models.AuditResultFailure
+	}
+	if user := rCtx.Authenticated.User; user != nil {
+		event.ActorID = user.ID
+		event.ActorName = user.Name
+	}
+	if impersonator := rCtx.Authenticated.Impersonator; impersonator != nil {
+		event.ImpersonatorID = impersonator.ID
+		event.ImpersonatorName = impersonator.Name
+	}
+	if org := rCtx.Authenticated.Organization; org != nil {
+		event.OrganizationID = org.ID
+	}
+	return event
+}
+
+// grantAuditTarget returns the target of an audit event for a grant. The name
+// of the target is the resource of the grant, so that the changes to the
+// grants of a destination can be found by name.
+func grantAuditTarget(grant *models.Grant) auditTarget {
+	return auditTarget{
+		Type: "grant",
+		ID:   string(grant.Subject) + " " + grant.Privilege + " " + grant.Resource,
+		Name: grant.Resource,
+		Metadata: models.JSONMap{
+			"subject":   string(grant.Subject),
+			"privilege": grant.Privilege,
+			"resource":  grant.Resource,
+		},
+	}
+}
+
+// userAuditTarget returns the target of an audit event for a user.
+func userAuditTarget(user *models.Identity) auditTarget {
+	return auditTarget{Type: "user", ID: user.ID.String(), Name: user.Name}
+}
+
+// accessKeyAuditTarget returns the target of an audit event for an access key.
+func accessKeyAuditTarget(key *models.AccessKey) auditTarget {
+	return auditTarget{Type: "accesskey", ID: key.ID.String(), Name: key.Name}
+}
+
+// destinationAuditTarget returns the target for a token issued for the
+// destination with name. The ID is only set when the destination exists,
+// because a token can be issued for a destination that has not connected yet.
+// An empty name is a token that can be used with any destination.
+func destinationAuditTarget(tx data.ReadTxn, name string) (auditTarget, error) {
+	target := auditTarget{Type: "destination", Name: name}
+	if name == "" {
+		return target, nil
+	}
+	dest, err := data.GetDestination(tx, data.GetDestinationOptions{ByName: name})
+	switch {
+	case errors.Is(err, internal.ErrNotFound):
+		return target, nil
+	case err != nil:
+		return target, err
+	}
+	target.ID = dest.ID.String()
+	return target, nil
+}
+
+var listAuditEventsRoute = route[api.ListAuditEventsRequest, *api.ListResponse[api.AuditEvent]]{
+	handler: listAuditEventsHandler,
+	routeSettings: routeSettings{
+		txnOptions: &sql.TxOptions{ReadOnly: true},
+	},
+}
+
+// listAuditEventsHandler lists the audit events recorded by the database sink.
+// There is no route to update or delete an audit event, they are only deleted
+// when they are older than the retention period.
+func listAuditEventsHandler(c *gin.Context, r *api.ListAuditEventsRequest) (*api.ListResponse[api.AuditEvent], error) {
+	db, err := access.RequireInfraRole(c, models.InfraAdminRole)
+	if err != nil {
+		return nil, access.HandleAuthErr(err, "audit events", "list", models.InfraAdminRole)
+	}
+
+	p := PaginationFromRequest(r.PaginationRequest)
+	events, err := data.ListAuditEvents(db, data.ListAuditEventsOptions{
+		ByActorID:     r.ActorID,
+		ByActorName:   r.ActorName,
+		ByAction:      r.Action,
+		ByTargetType:  r.TargetType,
+		ByTargetID:    r.TargetID,
+		ByTargetName:  r.TargetName,
+		CreatedAfter:  r.After.Time(),
+		CreatedBefore: r.Before.Time(),
+		Pagination:    &p,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := api.NewListResponse(events, PaginationToResponse(p), func(e models.AuditEvent) api.AuditEvent {
+		return *e.ToAPI()
+	})
+	return result, nil
+}
@@ -0,0 +1,151 @@
+// Package audit records security relevant events, like logins and changes to
+// grants, to an audit log that is separate from the diagnostic logs.
+package audit
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionLogin           = "login"
+	ActionAccessKeyCreate = "accesskey.create"
+	ActionAccessKeyDelete = "accesskey.delete"
+	ActionCacheFlush      = "cache.flush"
+	// ActionDestinationLogin is recorded when a user is issued a token for a
+	// destination. The usage of each destination is aggregated from these
+	// events.
+	ActionDestinationLogin   = "destination.login"
+	ActionGrantCreate        = "grant.create"
+	ActionGrantDelete        = "grant.delete"
+	ActionGrantUpdate        = "grant.update"
+	ActionMFAEnroll          = "mfa.enroll"
+	ActionMFAReset           = "mfa.reset"
+	ActionOrganizationDelete = "organization.delete"
+	ActionUserCreate         = "user.create"
+	ActionUserDelete         = "user.delete"
+	ActionUserImpersonate    = "user.impersonate"
+	// ActionUserImpersonateApprove is recorded when a user approves the
+	// impersonation of a user with an admin role.
+	ActionUserImpersonateApprove = "user.impersonate.approve"
+	ActionUserLockout            = "user.lockout"
+	ActionUserUnlock             = "user.unlock"
+	ActionUserUpdate             = "user.update"
+)
+
+// Sink stores audit events.
+type Sink interface {
+	WriteAuditEvent(event *models.AuditEvent) error
+}
+
+// Logger writes audit events to one or more sinks. A nil Logger discards all
+// events.
+type Logger struct {
+	sinks []Sink
+}
+
+// New returns a Logger that writes events to sinks.
+func New(sinks ...Sink) *Logger {
+	return &Logger{sinks: sinks}
+}
+
+// Record writes event to every sink. The time, request ID, and source IP of the
+// event are set from ctx when they are empty. Errors from the sinks are logged and not
+// returned, because a failure to write the audit log should not fail the
+// action that was audited.
+func (l *Logger) Record(ctx context.Context, event models.AuditEvent) {
+	if l == nil {
+		return
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	if event.RequestID == "" {
+		event.RequestID = logging.RequestID(ctx)
+	}
+	if event.SourceIP == "" {
+		event.SourceIP = logging.ClientIP(ctx)
+	}
+	for _, sink := range l.sinks {
+		// each sink gets a copy, because sinks may modify the event
+		e := event
+		if err := sink.WriteAuditEvent(&e); err != nil {
+			logging.FromContext(ctx).Error().Err(err).
+				Str("action", event.Action).
+				Msg("failed to write audit event")
+		}
+	}
+}
+
+// FileSink writes audit events as JSON lines to a file that is rotated.
+type FileSink struct {
+	logger zerolog.Logger
+	closer io.Closer
+}
+
+// NewFileSink returns a FileSink that writes to filename.
+func NewFileSink(filename string, opts logging.FileLoggerOptions) *FileSink {
+	writer := logging.NewFileWriter(filename, opts)
+	return &FileSink{
+		logger: zerolog.New(writer),
+		closer: writer,
+	}
+}
+
+func (s *FileSink) WriteAuditEvent(event *models.AuditEvent) error {
+	line := s.logger.Log().
+		// the time is formatted explicitly so that the schema of the audit log
+		// does not depend on the format of the diagnostic logs
+		Str("time", event.CreatedAt.UTC().Format(time.RFC3339Nano)).
+		Str("action", event.Action).
+		Str("result", event.Result).
+		Str("reason", event.Reason).
+		Str("actorID", event.ActorID.String()).
+		Str("actorName", event.ActorName)
+	if event.ImpersonatorID != 0 {
+		line = line.
+			Str("impersonatorID", event.ImpersonatorID.String()).
+			Str("impersonatorName", event.ImpersonatorName)
+	}
+	line = line.
+		Str("targetType", event.TargetType).
+		Str("targetID", event.TargetID).
+		Str("targetName", event.TargetName)
+	if len(event.Metadata) > 0 {
+		metadata := zerolog.Dict()
+		for key, value := range event.Metadata {
+			metadata = metadata.Str(key, value)
+		}
+		line = line.Dict("metadata", metadata)
+	}
+	line.
+		Str("orgID", event.OrganizationID.String()).
+		Str("requestID", event.RequestID).
+		Str("sourceIP", event.SourceIP).
+		Send()
+	return nil
+}
+
+// Close the file.
+func (s *FileSink) Close() error {
+	return s.closer.Close()
+}
+
+// DBSink stores audit events in the audit_events table. The sink uses its own
+// connection instead of the transaction of the request, so that events are
+// stored even when the request fails and its transaction is rolled back.
+type DBSink struct {
+	DB data.WriteTxn
+}
+
+func (s DBSink) WriteAuditEvent(event *models.AuditEvent) error {
+	return data.CreateAuditEvent(s.DB, event)
+}
@@ -0,0 +1,118 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestLogger_Record_FileSink(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.log")
+	sink := NewFileSink(filename, logging.FileLoggerOptions{})
+	t.Cleanup(func() {
+		assert.NilError(t, sink.Close())
+	})
+
+	ctx := logging.WithRequestID(context.Background(), "the-request")
+	ctx = logging.WithClientIP(ctx, "2001:db8::10")
+	New(sink).Record(ctx, models.AuditEvent{
+		OrganizationMember: models.OrganizationMember{OrganizationID: uid.ID(42)},
+		CreatedAt:          time.Date(2022, 12, 23, 10, 11, 12, 0, time.UTC),
+		ActorID:            uid.ID(1234),
+		ActorName:          "admin@example.com",
+		Action:             ActionGrantDelete,
+		TargetType:         "grant",
+		TargetID:           "i:1234 view production",
+		TargetName:         "production",
+		Result:             models.AuditResultSuccess,
+		Reason:             "the reason",
+	})
+
+	raw, err := os.ReadFile(filename)
+	assert.NilError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	assert.Equal(t, len(lines), 1)
+
+	var actual map[string]string
+	assert.NilError(t, json.Unmarshal([]byte(lines[0]), &actual))
+	expected := map[string]string{
+		"time":       "2022-12-23T10:11:12Z",
+		"action":     "grant.delete",
+		"result":     "success",
+		"reason":     "the reason",
+		"actorID":    uid.ID(1234).String(),
+		"actorName":  "admin@example.com",
+		"targetType": "grant",
+		"targetID":   "i:1234 view production",
+		"targetName": "production",
+		"orgID":      uid.ID(42).String(),
+		"requestID":  "the-request",
+		"sourceIP":   "2001:db8::10",
+	}
+	assert.DeepEqual(t, actual, expected)
+}
+
+func TestLogger_Record_FileSink_Impersonation(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.log")
+	sink := NewFileSink(filename, logging.FileLoggerOptions{})
+	t.Cleanup(func() {
+		assert.NilError(t, sink.Close())
+	})
+
+	New(sink).Record(context.Background(), models.AuditEvent{
+		ActorID:          uid.ID(1234),
+		ActorName:        "user@example.com",
+		ImpersonatorID:   uid.ID(5678),
+		ImpersonatorName: "support@example.com",
+		Action:           ActionGrantDelete,
+		Result:           models.AuditResultSuccess,
+	})
+
+	raw, err := os.ReadFile(filename)
+	assert.NilError(t, err)
+
+	var actual map[string]string
+	assert.NilError(t, json.Unmarshal(raw, &actual))
+	assert.Equal(t, actual["actorName"], "user@example.com")
+	assert.Equal(t, actual["impersonatorID"], uid.ID(5678).String())
+	assert.Equal(t, actual["impersonatorName"], "support@example.com")
+}
+
+func TestLogger_Record_FileSink_Metadata(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.log")
+	sink := NewFileSink(filename, logging.FileLoggerOptions{})
+	t.Cleanup(func() {
+		assert.NilError(t, sink.Close())
+	})
+
+	New(sink).Record(context.Background(), models.AuditEvent{
+		Action:   ActionGrantCreate,
+		Result:   models.AuditResultSuccess,
+		Metadata: models.JSONMap{"privilege": "view", "resource": "production"},
+	})
+
+	raw, err := os.ReadFile(filename)
+	assert.NilError(t, err)
+
+	var actual struct {
+		Metadata map[string]string `json:"metadata"`
+	}
+	assert.NilError(t, json.Unmarshal(raw, &actual))
+	assert.DeepEqual(t, actual.Metadata, map[string]string{"privilege": "view", "resource": "production"})
+}
+
+func TestLogger_Record_Nil(t *testing.T) {
+	var logger *Logger
+	// does not panic
+	logger.Record(context.Background(), models.AuditEvent{Action: ActionLogin})
+}
@@ -0,0 +1,284 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/server/audit"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+type memoryAuditSink struct {
+	mu     sync.Mutex
+	events []models.AuditEvent
+}
+
+func (s *memoryAuditSink) WriteAuditEvent(event *models.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, *event)
+	return nil
+}
+
+// Events returns the recorded events, with the fields that change on every
+// run set to zero values.
+func (s *memoryAuditSink) Events(t *testing.T) []models.AuditEvent {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []models.AuditEvent
+	for _, event := range s.events {
+		assert.Assert(t, !event.CreatedAt.IsZero())
+		assert.Assert(t, event.RequestID != "")
+		assert.Assert(t, event.SourceIP != "")
+		event.CreatedAt = time.Time{}
+		event.RequestID = ""
+		event.SourceIP = ""
+		result = append(result, event)
+	}
+	s.events = nil
+	return result
+}
+
+func withMemoryAuditSink(srv *Server) *memoryAuditSink {
+	sink := &memoryAuditSink{}
+	srv.auditLog = audit.New(sink)
+	return sink
+}
+
+func TestAPI_Audit_Grants(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+	sink := withMemoryAuditSink(srv)
+
+	admin, err := data.GetIdentity(srv.DB(), data.GetIdentityOptions{ByName: "admin@example.com"})
+	assert.NilError(t, err)
+
+	user := &models.Identity{Name: "someone@example.com"}
+	assert.NilError(t, data.CreateIdentity(srv.DB(), user))
+
+	body := jsonBody(t, api.GrantRequest{
+		User:      user.ID,
+		Privilege: "view",
+		Resource:  "production",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/grants", body)
+	req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+	req.Header.Set("Infra-Version", apiVersionLatest)
+	resp := httptest.NewRecorder()
+	routes.ServeHTTP(resp, req)
+	assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+
+	target := uid.NewIdentityPolymorphicID(user.ID).String() + " view production"
+	expected := []models.AuditEvent{
+		{
+			OrganizationMember: models.OrganizationMember{OrganizationID: srv.db.DefaultOrg.ID},
+			ActorID:            admin.ID,
+			ActorName:          "admin@example.com",
+			Action:             audit.ActionGrantCreate,
+			TargetType:         "grant",
+			TargetID:           target,
+			TargetName:         "production",
+			Metadata: models.JSONMap{
+				"subject":   uid.NewIdentityPolymorphicID(user.ID).String(),
+				"privilege": "view",
+				"resource":  "production",
+			},
+			Result: models.AuditResultSuccess,
+		},
+	}
+	assert.DeepEqual(t, sink.Events(t), expected)
+
+	grants, err := data.ListGrants(srv.DB(), data.ListGrantsOptions{ByResource: "production"})
+	assert.NilError(t, err)
+	assert.Equal(t, len(grants), 1)
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/grants/"+grants[0].ID.String(), nil)
+	req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+	req.Header.Set("Infra-Version", apiVersionLatest)
+	resp = httptest.NewRecorder()
+	routes.ServeHTTP(resp, req)
+	assert.Equal(t, resp.Code, http.StatusNoContent, resp.Body.String())
+
+	expected[0].Action = audit.ActionGrantDelete
+	assert.DeepEqual(t, sink.Events(t), expected)
+}
+
+func TestAPI_Audit_AccessKeys(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+	sink := withMemoryAuditSink(srv)
+
+	admin, err := data.GetIdentity(srv.DB(), data.GetIdentityOptions{ByName: "admin@example.com"})
+	assert.NilError(t, err)
+
+	user := &models.Identity{Name: "someone@example.com"}
+	assert.NilError(t, data.CreateIdentity(srv.DB(), user))
+
+	doRequest := func(t *testing.T, method, path string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		var req *http.Request
+		if body != nil {
+			req = httptest.NewRequest(method, path, jsonBody(t, body))
+		} else {
+			req = httptest.NewRequest(method, path, nil)
+		}
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := doRequest(t, http.MethodPost, "/api/access-keys", api.CreateAccessKeyRequest{
+		UserID: user.ID,
+		Name:   "the-key",
+		Expiry: api.Duration(time.Hour),
+	})
+	assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+
+	var created api.CreateAccessKeyResponse
+	assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &created))
+
+	expected := []models.AuditEvent{
+		{
+			OrganizationMember: models.OrganizationMember{OrganizationID: srv.db.DefaultOrg.ID},
+			ActorID:            admin.ID,
+			ActorName:          "admin@example.com",
+			Action:             audit.ActionAccessKeyCreate,
+			TargetType:         "accesskey",
+			TargetID:           created.ID.String(),
+			TargetName:         "the-key",
+			Result:             models.AuditResultSuccess,
+		},
+	}
+	assert.DeepEqual(t, sink.Events(t), expected)
+
+	resp = doRequest(t, http.MethodDelete, "/api/access-keys/"+created.ID.String(), nil)
+	assert.Equal(t, resp.Code, http.StatusNoContent, resp.Body.String())
+
+	expected[0].Action = audit.ActionAccessKeyDelete
+	assert.DeepEqual(t, sink.Events(t), expected)
+
+	// failures are recorded even though the transaction is rolled back
+	resp = doRequest(t, http.MethodDelete, "/api/access-keys/"+created.ID.String(), nil)
+	assert.Equal(t, resp.Code, http.StatusNotFound, resp.Body.String())
+
+	expected[0].Result = models.AuditResultFailure
+	expected[0].TargetName = "" // the key was not found
+	assert.DeepEqual(t, sink.Events(t), expected)
+}
+
+func TestAPI_Audit_FailedLogin(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+	sink := withMemoryAuditSink(srv)
+
+	body := jsonBody(t, api.LoginRequest{
+		PasswordCredentials: &api.LoginRequestPasswordCredentials{
+			Name:     "someone@example.com",
+			Password: "wrong",
+		},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/login", body)
+	req.Header.Set("Infra-Version", apiVersionLatest)
+	resp := httptest.NewRecorder()
+	routes.ServeHTTP(resp, req)
+	assert.Equal(t, resp.Code, http.StatusUnauthorized, resp.Body.String())
+
+	expected := []models.AuditEvent{
+		{
+			OrganizationMember: models.OrganizationMember{OrganizationID: srv.db.DefaultOrg.ID},
+			ActorName:          "someone@example.com",
+			Action:             audit.ActionLogin,
+			Result:             models.AuditResultFailure,
+			Reason:             "failed to login: user not found: record not found",
+		},
+	}
+	assert.DeepEqual(t, sink.Events(t), expected)
+}
+
+func TestAPI_ListAuditEvents(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	events := []*models.AuditEvent{
+		{CreatedAt: now.Add(-3 * time.Hour), ActorName: "admin@example.com", Action: audit.ActionGrantCreate, TargetType: "grant", TargetName: "production", Result: models.AuditResultSuccess},
+		{CreatedAt: now.Add(-2 * time.Hour), ActorName: "admin@example.com", Action: audit.ActionGrantDelete, TargetType: "grant", TargetName: "production.kube-system", Result: models.AuditResultSuccess},
+		{CreatedAt: now.Add(-time.Hour), ActorName: "someone@example.com", Action: audit.ActionLogin, Result: models.AuditResultFailure},
+	}
+	for _, event := range events {
+		assert.NilError(t, data.CreateAuditEvent(srv.DB(), event))
+	}
+
+	otherOrg := &models.Organization{Name: "other", Domain: "other.example.com"}
+	createOrgs(t, srv.db, otherOrg)
+	tx := txnForTestCase(t, srv.db, otherOrg.ID)
+	assert.NilError(t, data.CreateAuditEvent(tx, &models.AuditEvent{Action: audit.ActionGrantCreate, Result: models.AuditResultSuccess}))
+	assert.NilError(t, tx.Commit())
+
+	list := func(t *testing.T, query string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/audit-events?"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+	ids := func(t *testing.T, resp *httptest.ResponseRecorder) []uid.ID {
+		t.Helper()
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		var body api.ListResponse[api.AuditEvent]
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+		var result []uid.ID
+		for _, item := range body.Items {
+			result = append(result, item.ID)
+		}
+		return result
+	}
+
+	t.Run("all events of the org", func(t *testing.T) {
+		resp := list(t, "")
+		assert.DeepEqual(t, ids(t, resp), []uid.ID{events[2].ID, events[1].ID, events[0].ID})
+	})
+	t.Run("by action prefix and target name", func(t *testing.T) {
+		resp := list(t, "action=grant.*&targetName=production")
+		assert.DeepEqual(t, ids(t, resp), []uid.ID{events[1].ID, events[0].ID})
+	})
+	t.Run("by actor", func(t *testing.T) {
+		resp := list(t, "actorName=someone@example.com")
+		assert.DeepEqual(t, ids(t, resp), []uid.ID{events[2].ID})
+	})
+	t.Run("by time range", func(t *testing.T) {
+		query := url.Values{
+			"after":  {now.Add(-3 * time.Hour).Format(time.RFC3339)},
+			"before": {now.Add(-time.Hour).Format(time.RFC3339)},
+		}
+		resp := list(t, query.Encode())
+		assert.DeepEqual(t, ids(t, resp), []uid.ID{events[1].ID, events[0].ID})
+	})
+	t.Run("before is earlier than after", func(t *testing.T) {
+		query := url.Values{
+			"after":  {now.Format(time.RFC3339)},
+			"before": {now.Add(-time.Hour).Format(time.RFC3339)},
+		}
+		resp := list(t, query.Encode())
+		assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+	})
+	t.Run("pagination", func(t *testing.T) {
+		resp := list(t, "limit=2&page=2")
+		assert.DeepEqual(t, ids(t, resp), []uid.ID{events[0].ID})
+	})
+}
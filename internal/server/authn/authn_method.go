@@ -7,6 +7,7 @@ import (
 
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
 )
 
 type AuthenticatedIdentity struct {
@@ -17,6 +18,9 @@ type AuthenticatedIdentity struct {
 	// CredentialUpdateRequired indicates that the login used credentials that
 	// must be updated because they will no longer be valid after this login.
 	CredentialUpdateRequired bool
+	// ImpersonatedBy is the user who is impersonating Identity, when the login
+	// exchanged an access key created by impersonation.
+	ImpersonatedBy uid.ID
 }
 
 type LoginMethod interface {
@@ -26,14 +30,30 @@ type LoginMethod interface {
 
 type AuthScope struct {
 	PasswordResetOnly bool
+	// MFAChallenge indicates that the user must enter a TOTP code before
+	// they receive an access key.
+	MFAChallenge bool
+	// MFAEnrollmentOnly indicates that the organization requires MFA, and the
+	// user must enroll before they can do anything else.
+	MFAEnrollmentOnly bool
 }
 
+// MFAChallengeTimeout is how long a user has to enter a TOTP code after they
+// log in with a password.
+const MFAChallengeTimeout = 5 * time.Minute
+
 type LoginResult struct {
 	AccessKey                *models.AccessKey
 	Bearer                   string
 	User                     *models.Identity
 	CredentialUpdateRequired bool
 	OrganizationName         string
+	// MFARequired indicates that the AccessKey is an MFA challenge, which
+	// must be exchanged for a new key by logging in with a TOTP code.
+	MFARequired bool
+	// MFAEnrollmentRequired indicates that the AccessKey can only be used to
+	// enroll in MFA.
+	MFAEnrollmentRequired bool
 }
 
 func Login(
@@ -49,6 +69,10 @@ func Login(
 		return LoginResult{}, fmt.Errorf("failed to login: %w", err)
 	}
 
+	if authenticated.AuthScope.MFAChallenge {
+		return mfaChallenge(db, authenticated)
+	}
+
 	// login authentication was successful, create an access key for the user
 
 	accessKey := &models.AccessKey{
@@ -64,6 +88,15 @@ func Login(
 	if authenticated.AuthScope.PasswordResetOnly {
 		accessKey.Scopes = append(accessKey.Scopes, models.ScopePasswordReset)
 	}
+	if authenticated.AuthScope.MFAEnrollmentOnly {
+		accessKey.Scopes = models.CommaSeparatedStrings{models.ScopeMFAEnrollment}
+	}
+	if authenticated.ImpersonatedBy != 0 {
+		// the new key is still audited as impersonation, and can not create
+		// access keys that would outlive the impersonation
+		accessKey.ImpersonatedBy = authenticated.ImpersonatedBy
+		accessKey.Scopes = nil
+	}
 
 	bearer, err := data.CreateAccessKey(db, accessKey)
 	if err != nil {
@@ -86,5 +119,40 @@ func Login(
 		User:                     authenticated.Identity,
 		CredentialUpdateRequired: authenticated.CredentialUpdateRequired,
 		OrganizationName:         org.Name,
+		MFAEnrollmentRequired:    authenticated.AuthScope.MFAEnrollmentOnly,
+	}, nil
+}
+
+// mfaChallenge creates a short lived access key that can only be exchanged
+// for a login session by logging in with a TOTP code.
+func mfaChallenge(db *data.Transaction, authenticated AuthenticatedIdentity) (LoginResult, error) {
+	accessKey := &models.AccessKey{
+		IssuedFor:     authenticated.Identity.ID,
+		IssuedForName: authenticated.Identity.Name,
+		ProviderID:    authenticated.Provider.ID,
+		ExpiresAt:     time.Now().UTC().Add(MFAChallengeTimeout),
+		Scopes:        models.CommaSeparatedStrings{models.ScopeMFAChallenge},
+	}
+	if authenticated.AuthScope.PasswordResetOnly {
+		accessKey.Scopes = append(accessKey.Scopes, models.ScopePasswordReset)
+	}
+
+	bearer, err := data.CreateAccessKey(db, accessKey)
+	if err != nil {
+		return LoginResult{}, fmt.Errorf("failed to create mfa challenge: %w", err)
+	}
+
+	org, err := data.GetOrganization(db, data.GetOrganizationOptions{ByID: accessKey.OrganizationID})
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	return LoginResult{
+		AccessKey:                accessKey,
+		Bearer:                   bearer,
+		User:                     authenticated.Identity,
+		CredentialUpdateRequired: authenticated.CredentialUpdateRequired,
+		OrganizationName:         org.Name,
+		MFARequired:              true,
 	}, nil
 }
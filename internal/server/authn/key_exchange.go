@@ -5,26 +5,33 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/infrahq/infra/internal"
 	"github.com/infrahq/infra/internal/logging"
 	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
 )
 
 // keyExchangeAuthn allows exchanging a valid access key for new access key with a shorter lifetime
 type keyExchangeAuthn struct {
 	RequestingAccessKey string // the access key being presented in the login request
+	keyOpts             data.ValidateAccessKeyOptions
 }
 
-func NewKeyExchangeAuthentication(requestingAccessKey string) LoginMethod {
+func NewKeyExchangeAuthentication(requestingAccessKey string, keyOpts data.ValidateAccessKeyOptions) LoginMethod {
 	return &keyExchangeAuthn{
 		RequestingAccessKey: requestingAccessKey,
+		keyOpts:             keyOpts,
 	}
 }
 
 func (a *keyExchangeAuthn) Authenticate(_ context.Context, db *data.Transaction, requestedExpiry time.Time) (AuthenticatedIdentity, error) {
-	validatedRequestKey, err := data.ValidateRequestAccessKey(db, a.RequestingAccessKey)
+	validatedRequestKey, err := data.ValidateRequestAccessKey(db, a.RequestingAccessKey, a.keyOpts)
 	if err != nil {
 		return AuthenticatedIdentity{}, fmt.Errorf("invalid access key in exchange: %w", err)
 	}
+	if validatedRequestKey.Scopes.Includes(models.ScopeMFAChallenge) || validatedRequestKey.Scopes.Includes(models.ScopeMFAEnrollment) {
+		return AuthenticatedIdentity{}, fmt.Errorf("%w: mfa access keys can not be exchanged", internal.ErrUnauthorized)
+	}
 
 	sessionExpiry := requestedExpiry
 
@@ -39,9 +46,10 @@ func (a *keyExchangeAuthn) Authenticate(_ context.Context, db *data.Transaction,
 	}
 
 	return AuthenticatedIdentity{
-		Identity:      identity,
-		Provider:      data.InfraProvider(db),
-		SessionExpiry: sessionExpiry,
+		Identity:       identity,
+		Provider:       data.InfraProvider(db),
+		SessionExpiry:  sessionExpiry,
+		ImpersonatedBy: validatedRequestKey.ImpersonatedBy,
 	}, nil
 }
 
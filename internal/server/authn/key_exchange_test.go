@@ -10,6 +10,7 @@ import (
 
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
 )
 
 func TestKeyExchangeAuthentication(t *testing.T) {
@@ -34,7 +35,7 @@ func TestKeyExchangeAuthentication(t *testing.T) {
 
 				invalidKey := "aaaaaaaaaa.bbbbbbbbbbbbbbbbbbbbbbbb"
 
-				return NewKeyExchangeAuthentication(invalidKey), time.Now().Add(5 * time.Minute)
+				return NewKeyExchangeAuthentication(invalidKey, data.ValidateAccessKeyOptions{}), time.Now().Add(5 * time.Minute)
 			},
 			expectedErr: "could not get access key from database",
 		},
@@ -54,7 +55,7 @@ func TestKeyExchangeAuthentication(t *testing.T) {
 				bearer, err := data.CreateAccessKey(db, key)
 				assert.NilError(t, err)
 
-				return NewKeyExchangeAuthentication(bearer), time.Now().Add(5 * time.Minute)
+				return NewKeyExchangeAuthentication(bearer, data.ValidateAccessKeyOptions{}), time.Now().Add(5 * time.Minute)
 			},
 			expectedErr: data.ErrAccessKeyExpired.Error(),
 		},
@@ -76,7 +77,7 @@ func TestKeyExchangeAuthentication(t *testing.T) {
 				bearer, err := data.CreateAccessKey(db, key)
 				assert.NilError(t, err)
 
-				return NewKeyExchangeAuthentication(bearer), time.Now().Add(5 * time.Minute)
+				return NewKeyExchangeAuthentication(bearer, data.ValidateAccessKeyOptions{}), time.Now().Add(5 * time.Minute)
 			},
 			expectedErr: "user is not valid",
 		},
@@ -96,7 +97,7 @@ func TestKeyExchangeAuthentication(t *testing.T) {
 				bearer, err := data.CreateAccessKey(db, key)
 				assert.NilError(t, err)
 
-				return NewKeyExchangeAuthentication(bearer), longExpiry
+				return NewKeyExchangeAuthentication(bearer, data.ValidateAccessKeyOptions{}), longExpiry
 			},
 			expected: func(t *testing.T, authnIdentity AuthenticatedIdentity) {
 				assert.Equal(t, authnIdentity.Identity.Name, "krillin@example.com")
@@ -120,7 +121,7 @@ func TestKeyExchangeAuthentication(t *testing.T) {
 				bearer, err := data.CreateAccessKey(db, key)
 				assert.NilError(t, err)
 
-				return NewKeyExchangeAuthentication(bearer), longExpiry
+				return NewKeyExchangeAuthentication(bearer, data.ValidateAccessKeyOptions{}), longExpiry
 			},
 			expected: func(t *testing.T, authnIdentity AuthenticatedIdentity) {
 				assert.Equal(t, authnIdentity.Identity.Name, "cell@example.com")
@@ -130,6 +131,31 @@ func TestKeyExchangeAuthentication(t *testing.T) {
 				assert.DeepEqual(t, authnIdentity.SessionExpiry, longExpiry, threshold)
 			},
 		},
+		"ImpersonationKeyExchangeKeepsImpersonator": {
+			setup: func(t *testing.T, db data.WriteTxn) (LoginMethod, time.Time) {
+				user := &models.Identity{Name: "gohan@example.com"}
+				err := data.CreateIdentity(db, user)
+				assert.NilError(t, err)
+
+				key := &models.AccessKey{
+					Name:           "gohan-impersonation-key",
+					IssuedFor:      user.ID,
+					ImpersonatedBy: 8128,
+					ProviderID:     data.InfraProvider(db).ID,
+					ExpiresAt:      shortExpiry,
+				}
+
+				bearer, err := data.CreateAccessKey(db, key)
+				assert.NilError(t, err)
+
+				return NewKeyExchangeAuthentication(bearer, data.ValidateAccessKeyOptions{}), longExpiry
+			},
+			expected: func(t *testing.T, authnIdentity AuthenticatedIdentity) {
+				assert.Equal(t, authnIdentity.Identity.Name, "gohan@example.com")
+				assert.Equal(t, authnIdentity.ImpersonatedBy, uid.ID(8128))
+				assert.DeepEqual(t, authnIdentity.SessionExpiry, shortExpiry, threshold)
+			},
+		},
 	}
 
 	for name, tc := range cases {
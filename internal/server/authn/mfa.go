@@ -0,0 +1,102 @@
+package authn
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+// mfaAuthn completes a password login for a user enrolled in TOTP, by
+// exchanging the MFA challenge key for a session with a TOTP code or a
+// recovery code.
+type mfaAuthn struct {
+	ChallengeKey string
+	Code         string
+	RecoveryCode string
+	now          time.Time
+	keyOpts      data.ValidateAccessKeyOptions
+}
+
+func NewMFAAuthentication(challengeKey, code, recoveryCode string, now time.Time, keyOpts data.ValidateAccessKeyOptions) LoginMethod {
+	return &mfaAuthn{
+		ChallengeKey: challengeKey,
+		Code:         code,
+		RecoveryCode: recoveryCode,
+		now:          now,
+		keyOpts:      keyOpts,
+	}
+}
+
+func (a *mfaAuthn) Authenticate(_ context.Context, db *data.Transaction, requestedExpiry time.Time) (AuthenticatedIdentity, error) {
+	challenge, err := data.ValidateRequestAccessKeyWithoutExtension(db, a.ChallengeKey, a.keyOpts)
+	if err != nil {
+		return AuthenticatedIdentity{}, fmt.Errorf("invalid mfa challenge: %w", err)
+	}
+	if !challenge.Scopes.Includes(models.ScopeMFAChallenge) {
+		return AuthenticatedIdentity{}, fmt.Errorf("%w: access key is not an mfa challenge", internal.ErrUnauthorized)
+	}
+
+	mfa, err := data.GetUserMFA(db, challenge.IssuedFor)
+	if err != nil {
+		return AuthenticatedIdentity{}, fmt.Errorf("get user mfa: %w", err)
+	}
+	if !mfa.Confirmed {
+		return AuthenticatedIdentity{}, fmt.Errorf("%w: user is not enrolled in mfa", internal.ErrUnauthorized)
+	}
+
+	switch {
+	case a.Code != "":
+		step, err := ValidateTOTPCode(string(mfa.TOTPSecret), a.Code, a.now, mfa.LastUsedStep)
+		if err != nil {
+			return AuthenticatedIdentity{}, err
+		}
+		mfa.LastUsedStep = step
+	case a.RecoveryCode != "":
+		hash := HashRecoveryCode(a.RecoveryCode)
+		remaining := models.CommaSeparatedStrings{}
+		for _, h := range mfa.RecoveryCodes {
+			if h != hash {
+				remaining = append(remaining, h)
+			}
+		}
+		if len(remaining) == len(mfa.RecoveryCodes) {
+			return AuthenticatedIdentity{}, ErrInvalidTOTPCode
+		}
+		mfa.RecoveryCodes = remaining
+	default:
+		return AuthenticatedIdentity{}, fmt.Errorf("%w: a code or recovery code is required", internal.ErrBadRequest)
+	}
+
+	if err := data.UpdateUserMFA(db, mfa); err != nil {
+		return AuthenticatedIdentity{}, fmt.Errorf("update user mfa: %w", err)
+	}
+
+	// the challenge can only be used once
+	if err := data.DeleteAccessKeys(db, data.DeleteAccessKeysOptions{ByID: challenge.ID}); err != nil {
+		return AuthenticatedIdentity{}, fmt.Errorf("delete mfa challenge: %w", err)
+	}
+
+	identity, err := data.GetIdentity(db, data.GetIdentityOptions{ByID: challenge.IssuedFor})
+	if err != nil {
+		return AuthenticatedIdentity{}, fmt.Errorf("user is not valid: %w", err)
+	}
+
+	authnIdentity := AuthenticatedIdentity{
+		Identity:      identity,
+		Provider:      data.InfraProvider(db),
+		SessionExpiry: requestedExpiry,
+	}
+	if challenge.Scopes.Includes(models.ScopePasswordReset) {
+		authnIdentity.AuthScope.PasswordResetOnly = true
+		authnIdentity.CredentialUpdateRequired = true
+	}
+	return authnIdentity, nil
+}
+
+func (a *mfaAuthn) Name() string {
+	return "mfa"
+}
@@ -21,18 +21,23 @@ type OIDCAuthn struct {
 	Code               string
 	OIDCProviderClient providers.OIDCClient
 	AllowedDomains     []string
+	// AllowedSignupDomains are the email domains that can create a new user
+	// with a social login. A new user must have a domain that is in both
+	// AllowedDomains and AllowedSignupDomains.
+	AllowedSignupDomains []string
 }
 
-func NewOIDCAuthentication(provider *models.Provider, redirectURL string, code string, oidcProviderClient providers.OIDCClient, allowedDomains []string) (LoginMethod, error) {
+func NewOIDCAuthentication(provider *models.Provider, redirectURL string, code string, oidcProviderClient providers.OIDCClient, allowedDomains, allowedSignupDomains []string) (LoginMethod, error) {
 	if provider == nil {
 		return nil, fmt.Errorf("nil provider in oidc authentication")
 	}
 	return &OIDCAuthn{
-		Provider:           provider,
-		RedirectURL:        redirectURL,
-		Code:               code,
-		OIDCProviderClient: oidcProviderClient,
-		AllowedDomains:     allowedDomains,
+		Provider:             provider,
+		RedirectURL:          redirectURL,
+		Code:                 code,
+		OIDCProviderClient:   oidcProviderClient,
+		AllowedDomains:       allowedDomains,
+		AllowedSignupDomains: allowedSignupDomains,
 	}, nil
 }
 
@@ -53,7 +58,7 @@ func (a *OIDCAuthn) Authenticate(ctx context.Context, db *data.Transaction, requ
 		if err != nil {
 			return AuthenticatedIdentity{}, err
 		}
-		if !slices.Contains(a.AllowedDomains, domain) {
+		if !slices.Contains(a.AllowedDomains, domain) || !slices.Contains(a.AllowedSignupDomains, domain) {
 			// check if the user has been added manually
 			_, err := data.GetIdentity(db, data.GetIdentityOptions{ByName: idpAuth.Email})
 			if err != nil {
@@ -9,6 +9,7 @@ import (
 	"gotest.tools/v3/assert"
 	is "gotest.tools/v3/assert/cmp"
 
+	"github.com/infrahq/infra/internal"
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
 	"github.com/infrahq/infra/internal/server/providers"
@@ -61,12 +62,12 @@ func TestOIDCAuthenticate(t *testing.T) {
 	}
 
 	t.Run("nil provider", func(t *testing.T) {
-		_, err := NewOIDCAuthentication(nil, "localhost:8031", "1234", oidc, []string{})
+		_, err := NewOIDCAuthentication(nil, "localhost:8031", "1234", oidc, []string{}, []string{})
 		assert.ErrorContains(t, err, "nil provider in oidc authentication")
 	})
 
 	t.Run("successful authentication", func(t *testing.T) {
-		oidcAuthn, err := NewOIDCAuthentication(mocktaProvider, "localhost:8031", "1234", oidc, []string{})
+		oidcAuthn, err := NewOIDCAuthentication(mocktaProvider, "localhost:8031", "1234", oidc, []string{}, []string{})
 		assert.NilError(t, err)
 		authnIdentity, err := oidcAuthn.Authenticate(context.Background(), db, time.Now().Add(1*time.Minute))
 
@@ -260,7 +261,7 @@ func TestExchangeAuthCodeForProviderTokens(t *testing.T) {
 			assert.NilError(t, err)
 
 			mockOIDC := tc.setup(t, db)
-			loginMethod, err := NewOIDCAuthentication(provider, "mockOIDC.example.com/redirect", "AAA", mockOIDC, []string{})
+			loginMethod, err := NewOIDCAuthentication(provider, "mockOIDC.example.com/redirect", "AAA", mockOIDC, []string{}, []string{})
 			assert.NilError(t, err)
 
 			a, err := loginMethod.Authenticate(context.Background(), db, sessionExpiry)
@@ -346,7 +347,8 @@ func TestExchangeAuthCodeForProviderTokensAllowedDomains(t *testing.T) {
 
 	for name, tc := range testCases {
 		t.Run(name, func(t *testing.T) {
-			loginMethod, err := NewOIDCAuthentication(provider, "mockOIDC.example.com/redirect", "AAA", tc.client, []string{"example.com", "infrahq.com"})
+			allowed := []string{"example.com", "infrahq.com"}
+			loginMethod, err := NewOIDCAuthentication(provider, "mockOIDC.example.com/redirect", "AAA", tc.client, allowed, allowed)
 			assert.NilError(t, err)
 
 			a, err := loginMethod.Authenticate(context.Background(), db, sessionExpiry)
@@ -354,3 +356,84 @@ func TestExchangeAuthCodeForProviderTokensAllowedDomains(t *testing.T) {
 		})
 	}
 }
+
+func TestOIDCAuthenticate_AllowedSignupDomains(t *testing.T) {
+	db := setupDB(t)
+
+	existing := &models.Identity{Name: "existing@example.com"}
+	assert.NilError(t, data.CreateIdentity(db, existing))
+
+	// setup fake social login provider
+	provider := &models.Provider{
+		Model: models.Model{
+			ID: models.InternalGoogleProviderID,
+		},
+		Name: "mockoidc",
+		URL:  "mockOIDC.example.com",
+		Kind: models.ProviderKindOIDC,
+	}
+	allowedDomains := []string{"example.com", "infrahq.com"}
+	sessionExpiry := time.Now().Add(5 * time.Minute)
+
+	type testCase struct {
+		name           string
+		email          string
+		signupDomains  []string
+		expectedErr    string
+		expectedCreate bool
+	}
+
+	run := func(t *testing.T, tc testCase) {
+		client := &mockOIDCImplementation{UserEmailResp: tc.email}
+		loginMethod, err := NewOIDCAuthentication(provider, "mockOIDC.example.com/redirect", "AAA", client, allowedDomains, tc.signupDomains)
+		assert.NilError(t, err)
+
+		a, err := loginMethod.Authenticate(context.Background(), db, sessionExpiry)
+		if tc.expectedErr != "" {
+			assert.ErrorContains(t, err, tc.expectedErr)
+
+			_, err = data.GetIdentity(db, data.GetIdentityOptions{ByName: tc.email})
+			assert.ErrorIs(t, err, internal.ErrNotFound, "identity should not be created")
+			return
+		}
+		assert.NilError(t, err)
+		assert.Equal(t, a.Identity.Name, tc.email)
+		assert.Equal(t, a.Identity.ID != existing.ID, tc.expectedCreate)
+	}
+
+	testCases := []testCase{
+		{
+			name:           "open domain",
+			email:          "open@example.com",
+			signupDomains:  []string{"example.com"},
+			expectedCreate: true,
+		},
+		{
+			name:          "domain not allowed to sign up",
+			email:         "closed@infrahq.com",
+			signupDomains: []string{"example.com"},
+			expectedErr:   "infrahq.com is not an allowed email domain or existing user",
+		},
+		{
+			name:          "sign up domain not in organization allowed domains",
+			email:         "other@other.com",
+			signupDomains: []string{"other.com"},
+			expectedErr:   "other.com is not an allowed email domain or existing user",
+		},
+		{
+			name:        "invite only",
+			email:       "invite@example.com",
+			expectedErr: "example.com is not an allowed email domain or existing user",
+		},
+		{
+			name:  "invite only with existing user",
+			email: existing.Name,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
@@ -2,11 +2,13 @@ package authn
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/infrahq/infra/internal"
 	"github.com/infrahq/infra/internal/server/data"
 )
 
@@ -29,20 +31,45 @@ func (a *passwordCredentialAuthn) Authenticate(ctx context.Context, db *data.Tra
 	}
 	identity, err := data.GetIdentity(db, data.GetIdentityOptions{ByName: a.Username})
 	if err != nil {
-		return AuthenticatedIdentity{}, fmt.Errorf("could not get identity for username: %w", err)
+		compareDummyPassword(a.Password)
+		return AuthenticatedIdentity{}, fmt.Errorf("user not found: %w", err)
 	}
 
 	// Infra users can have only one username/password combo, look it up
 	userCredential, err := data.GetCredentialByUserID(db, identity.ID)
 	if err != nil {
-		return AuthenticatedIdentity{}, fmt.Errorf("validate creds get user: %w", err)
+		compareDummyPassword(a.Password)
+		return AuthenticatedIdentity{}, fmt.Errorf("user does not have a password: %w", err)
 	}
 
 	// compare the stored hash of the user's password and the hash of the presented password
 	err = bcrypt.CompareHashAndPassword(userCredential.PasswordHash, []byte(a.Password))
 	if err != nil {
 		// this probably means the password was wrong
-		return AuthenticatedIdentity{}, fmt.Errorf("could not verify password: %w", err)
+		return AuthenticatedIdentity{}, fmt.Errorf("incorrect password: %w", err)
+	}
+
+	// the expiry is checked after the password, so that it is only revealed
+	// to someone who knows the password.
+	now := time.Now()
+	if userCredential.OneTimePassword {
+		if expires := userCredential.OneTimePasswordExpiresAt; expires != nil && !now.Before(*expires) {
+			return AuthenticatedIdentity{}, fmt.Errorf("one-time password: %w", internal.ErrExpired)
+		}
+	}
+
+	// a successful login resets the count of failed logins
+	changed := ResetLoginAttempts(userCredential)
+	if userCredential.OneTimePassword {
+		// a one-time password can only be used to log in once. The session
+		// from this login is used to set a new password.
+		userCredential.OneTimePasswordExpiresAt = &now
+		changed = true
+	}
+	if changed {
+		if err := data.UpdateCredentialLoginAttempts(db, userCredential); err != nil {
+			return AuthenticatedIdentity{}, fmt.Errorf("reset failed logins: %w", err)
+		}
 	}
 
 	authnIdentity := AuthenticatedIdentity{
@@ -57,10 +84,36 @@ func (a *passwordCredentialAuthn) Authenticate(ctx context.Context, db *data.Tra
 		authnIdentity.CredentialUpdateRequired = true
 	}
 
+	mfa, err := data.GetUserMFA(db, identity.ID)
+	switch {
+	case err == nil && mfa.Confirmed:
+		authnIdentity.AuthScope.MFAChallenge = true
+	case err != nil && !errors.Is(err, internal.ErrNotFound):
+		return AuthenticatedIdentity{}, fmt.Errorf("get user mfa: %w", err)
+	case !authnIdentity.AuthScope.PasswordResetOnly:
+		settings, err := data.GetOrgSettings(db)
+		if err != nil {
+			return AuthenticatedIdentity{}, fmt.Errorf("get org settings: %w", err)
+		}
+		authnIdentity.AuthScope.MFAEnrollmentOnly = settings.RequireMFA
+	}
+
 	// authentication was a success
 	return authnIdentity, nil // password login is always for infra users
 }
 
+// dummyPasswordHash is a bcrypt hash with the same cost as the hash of a user
+// password. It does not match any password.
+var dummyPasswordHash = []byte("$2a$10$CbvXz9qTeVTfGlERcB81j.QD0jhcdqDsbxxbO0TLjpsbE4R5.GGky")
+
+// compareDummyPassword does the same work as checking the password of a user,
+// so that a login for a user that does not exist, or that has no password,
+// takes as long as a login with the wrong password. Otherwise the time of the
+// response would reveal which users exist.
+func compareDummyPassword(password string) {
+	_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+}
+
 func (a *passwordCredentialAuthn) Name() string {
 	return "credentials"
 }
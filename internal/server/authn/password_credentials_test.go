@@ -170,6 +170,62 @@ func TestPasswordCredentialAuthentication(t *testing.T) {
 			},
 			expectedErr: "hashedPassword is not the hash of the given password",
 		},
+		"UsernameAndOneTimePasswordReuseFails": {
+			setup: func(t *testing.T, db *data.Transaction) LoginMethod {
+				username := "vegeta@example.com"
+				user := &models.Identity{Name: username}
+				err := data.CreateIdentity(db, user)
+				assert.NilError(t, err)
+
+				oneTimePassword := "password123"
+				hash, err := bcrypt.GenerateFromPassword([]byte(oneTimePassword), bcrypt.DefaultCost)
+				assert.NilError(t, err)
+
+				expires := time.Now().Add(time.Hour)
+				creds := models.Credential{
+					IdentityID:               user.ID,
+					PasswordHash:             hash,
+					OneTimePassword:          true,
+					OneTimePasswordExpiresAt: &expires,
+				}
+
+				err = data.CreateCredential(db, &creds)
+				assert.NilError(t, err)
+
+				login := NewPasswordCredentialAuthentication(username, oneTimePassword)
+				_, err = login.Authenticate(context.Background(), db, time.Now().Add(1*time.Minute))
+				assert.NilError(t, err)
+
+				return login
+			},
+			expectedErr: "one-time password: expired",
+		},
+		"UsernameAndExpiredOneTimePasswordFails": {
+			setup: func(t *testing.T, db *data.Transaction) LoginMethod {
+				username := "frieza@example.com"
+				user := &models.Identity{Name: username}
+				err := data.CreateIdentity(db, user)
+				assert.NilError(t, err)
+
+				oneTimePassword := "password123"
+				hash, err := bcrypt.GenerateFromPassword([]byte(oneTimePassword), bcrypt.DefaultCost)
+				assert.NilError(t, err)
+
+				expired := time.Now().Add(-time.Minute)
+				creds := models.Credential{
+					IdentityID:               user.ID,
+					PasswordHash:             hash,
+					OneTimePassword:          true,
+					OneTimePasswordExpiresAt: &expired,
+				}
+
+				err = data.CreateCredential(db, &creds)
+				assert.NilError(t, err)
+
+				return NewPasswordCredentialAuthentication(username, oneTimePassword)
+			},
+			expectedErr: "one-time password: expired",
+		},
 		"EmptyUsernameAndPasswordFails": {
 			setup: func(t *testing.T, db *data.Transaction) LoginMethod {
 				return NewPasswordCredentialAuthentication("", "whatever")
@@ -192,3 +248,10 @@ func TestPasswordCredentialAuthentication(t *testing.T) {
 		})
 	}
 }
+
+func TestDummyPasswordHash(t *testing.T) {
+	// the dummy hash must take as long to compare as the hash of a password
+	cost, err := bcrypt.Cost(dummyPasswordHash)
+	assert.NilError(t, err)
+	assert.Equal(t, cost, bcrypt.DefaultCost)
+}
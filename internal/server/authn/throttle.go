@@ -0,0 +1,124 @@
+package authn
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/internal/server/redis"
+)
+
+// maxLoginDelay is the longest delay between failed password logins when the
+// account is not locked.
+const maxLoginDelay = 5 * time.Minute
+
+// LoginThrottle protects password logins from brute force attacks. After
+// DelayThreshold consecutive failed logins, each login must wait for a delay
+// that doubles with every failure. After LockoutThreshold failures the account
+// is locked for LockoutDuration. A one-time password is invalidated after
+// OneTimePasswordAttempts failures.
+type LoginThrottle struct {
+	// DelayThreshold is the number of failed logins allowed before logins are
+	// delayed. Zero disables the delay.
+	DelayThreshold int
+	// LockoutThreshold is the number of failed logins that locks the account.
+	// Zero disables the lockout.
+	LockoutThreshold int
+	// LockoutDuration is how long the account is locked.
+	LockoutDuration time.Duration
+	// OneTimePasswordAttempts is the number of failed logins after which a
+	// one-time password can no longer be used, and must be re-issued by an
+	// admin. Zero disables the limit.
+	OneTimePasswordAttempts int
+}
+
+// AccountLockedError is returned when a user tries to log in with a password
+// while their account is locked. Unlike a wrong password, the error is shown
+// to the user, so that they know to wait or ask an admin to unlock it.
+type AccountLockedError struct {
+	LockedUntil time.Time
+	RetryAfter  time.Duration
+}
+
+func (e AccountLockedError) Error() string {
+	return fmt.Sprintf("account is locked because of too many failed login attempts, retry after %v", e.RetryAfter.Round(time.Second))
+}
+
+// Check returns an error if a login with the credential is not allowed at
+// time now. The error is an AccountLockedError if the account is locked, or a
+// redis.OverLimitError if the login must be delayed.
+func (t LoginThrottle) Check(cred *models.Credential, now time.Time) error {
+	if cred.LockedUntil != nil && now.Before(*cred.LockedUntil) {
+		return AccountLockedError{LockedUntil: *cred.LockedUntil, RetryAfter: cred.LockedUntil.Sub(now)}
+	}
+	if t.isLockExpired(cred, now) || cred.LastFailedLoginAt == nil {
+		return nil
+	}
+
+	if delay := t.delay(cred.FailedLoginAttempts); delay > 0 {
+		if next := cred.LastFailedLoginAt.Add(delay); now.Before(next) {
+			return redis.OverLimitError{RetryAfter: next.Sub(now)}
+		}
+	}
+	return nil
+}
+
+// RecordFailure updates cred after a failed login at time now. Returns true if
+// the failure locked the account.
+func (t LoginThrottle) RecordFailure(cred *models.Credential, now time.Time) (locked bool) {
+	if t.isLockExpired(cred, now) {
+		// the lockout is over, start counting again
+		cred.FailedLoginAttempts = 0
+		cred.LockedUntil = nil
+	}
+
+	cred.FailedLoginAttempts++
+	cred.LastFailedLoginAt = &now
+
+	if cred.OneTimePassword && t.OneTimePasswordAttempts > 0 && cred.FailedLoginAttempts >= t.OneTimePasswordAttempts {
+		if cred.OneTimePasswordExpiresAt == nil || now.Before(*cred.OneTimePasswordExpiresAt) {
+			cred.OneTimePasswordExpiresAt = &now
+		}
+	}
+
+	if t.LockoutThreshold > 0 && cred.FailedLoginAttempts >= t.LockoutThreshold && cred.LockedUntil == nil {
+		until := now.Add(t.LockoutDuration)
+		cred.LockedUntil = &until
+		return true
+	}
+	return false
+}
+
+// ResetLoginAttempts clears the failed logins of cred. Returns false if there
+// was nothing to reset.
+func ResetLoginAttempts(cred *models.Credential) bool {
+	if cred.FailedLoginAttempts == 0 && cred.LockedUntil == nil {
+		return false
+	}
+	cred.FailedLoginAttempts = 0
+	cred.LastFailedLoginAt = nil
+	cred.LockedUntil = nil
+	return true
+}
+
+func (t LoginThrottle) isLockExpired(cred *models.Credential, now time.Time) bool {
+	return cred.LockedUntil != nil && !now.Before(*cred.LockedUntil)
+}
+
+// delay returns the time that must pass after the last failed login, when
+// there have been attempts consecutive failures.
+func (t LoginThrottle) delay(attempts int) time.Duration {
+	if t.DelayThreshold <= 0 || attempts < t.DelayThreshold {
+		return 0
+	}
+	exp := attempts - t.DelayThreshold
+	if exp > 16 {
+		return maxLoginDelay
+	}
+	delay := time.Duration(math.Pow(2, float64(exp))) * time.Second
+	if delay > maxLoginDelay {
+		return maxLoginDelay
+	}
+	return delay
+}
@@ -0,0 +1,82 @@
+package authn
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/internal/server/redis"
+)
+
+func TestLoginThrottle(t *testing.T) {
+	throttle := LoginThrottle{DelayThreshold: 2, LockoutThreshold: 5, LockoutDuration: time.Hour}
+	now := time.Date(2023, 1, 25, 10, 0, 0, 0, time.UTC)
+
+	cred := &models.Credential{}
+	assert.NilError(t, throttle.Check(cred, now))
+
+	assert.Assert(t, !throttle.RecordFailure(cred, now))
+	assert.NilError(t, throttle.Check(cred, now))
+
+	assert.Assert(t, !throttle.RecordFailure(cred, now))
+	assert.DeepEqual(t, throttle.Check(cred, now), redis.OverLimitError{RetryAfter: time.Second})
+	assert.NilError(t, throttle.Check(cred, now.Add(time.Second)))
+
+	now = now.Add(time.Second)
+	assert.Assert(t, !throttle.RecordFailure(cred, now))
+	assert.DeepEqual(t, throttle.Check(cred, now), redis.OverLimitError{RetryAfter: 2 * time.Second})
+
+	now = now.Add(2 * time.Second)
+	assert.Assert(t, !throttle.RecordFailure(cred, now))
+	assert.DeepEqual(t, throttle.Check(cred, now), redis.OverLimitError{RetryAfter: 4 * time.Second})
+
+	now = now.Add(4 * time.Second)
+	assert.Assert(t, throttle.RecordFailure(cred, now))
+	assert.Equal(t, cred.FailedLoginAttempts, 5)
+	assert.DeepEqual(t, throttle.Check(cred, now), AccountLockedError{
+		LockedUntil: now.Add(time.Hour),
+		RetryAfter:  time.Hour,
+	})
+
+	// the first failure after the lockout expires starts counting again
+	now = now.Add(time.Hour)
+	assert.NilError(t, throttle.Check(cred, now))
+	assert.Assert(t, !throttle.RecordFailure(cred, now))
+	assert.Equal(t, cred.FailedLoginAttempts, 1)
+	assert.Assert(t, cred.LockedUntil == nil)
+
+	assert.Assert(t, ResetLoginAttempts(cred))
+	assert.Equal(t, cred.FailedLoginAttempts, 0)
+	assert.Assert(t, !ResetLoginAttempts(cred))
+
+	t.Run("delay is limited", func(t *testing.T) {
+		throttle := LoginThrottle{DelayThreshold: 1}
+		assert.Equal(t, throttle.delay(8), 128*time.Second)
+		assert.Equal(t, throttle.delay(10), maxLoginDelay)
+		assert.Equal(t, throttle.delay(100), maxLoginDelay)
+		assert.Equal(t, LoginThrottle{}.delay(100), time.Duration(0))
+	})
+	t.Run("one-time password attempts", func(t *testing.T) {
+		throttle := LoginThrottle{OneTimePasswordAttempts: 2}
+		expires := now.Add(time.Hour)
+		cred := &models.Credential{OneTimePassword: true, OneTimePasswordExpiresAt: &expires}
+
+		throttle.RecordFailure(cred, now)
+		assert.Equal(t, *cred.OneTimePasswordExpiresAt, expires)
+
+		throttle.RecordFailure(cred, now)
+		assert.Equal(t, *cred.OneTimePasswordExpiresAt, now)
+
+		// a later failure does not extend the expiry
+		throttle.RecordFailure(cred, now.Add(time.Minute))
+		assert.Equal(t, *cred.OneTimePasswordExpiresAt, now)
+
+		// passwords set by the user are not invalidated
+		cred = &models.Credential{}
+		throttle.RecordFailure(cred, now)
+		throttle.RecordFailure(cred, now)
+		assert.Assert(t, cred.OneTimePasswordExpiresAt == nil)
+	})
+}
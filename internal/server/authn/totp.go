@@ -0,0 +1,135 @@
+package authn
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1" // nolint:gosec // RFC 6238 uses SHA-1, and it is the only algorithm supported by most authenticator apps
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/infrahq/infra/internal/generate"
+)
+
+// TOTP codes use the parameters supported by most authenticator apps:
+// HMAC-SHA1, 6 digits, and a 30 second time step (RFC 6238).
+const (
+	totpDigits = 6
+	totpModulo = 1_000_000 // 10^totpDigits
+	totpPeriod = 30 * time.Second
+
+	// totpSkew is the number of time steps before and after the current step
+	// that are accepted, to allow for a clock difference between the server
+	// and the device that generated the code.
+	totpSkew = 1
+
+	// recoveryCodeCount is the number of recovery codes created when a user
+	// confirms their TOTP enrollment.
+	recoveryCodeCount = 10
+)
+
+var ErrInvalidTOTPCode = errors.New("invalid code")
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a new random TOTP seed, encoded as base32.
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPURI returns the otpauth URI used by authenticator apps to add the
+// secret, usually scanned from a QR code.
+func TOTPURI(issuer, account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// TOTPCode returns the code for secret at time t.
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+	return totpCodeForStep(key, totpStep(t)), nil
+}
+
+// ValidateTOTPCode checks that code is the code for secret at a time step
+// within totpSkew steps of now, and after lastUsedStep. Returns the time step
+// of the code, which must be stored as the new lastUsedStep so that the code
+// can not be used again.
+func ValidateTOTPCode(secret, code string, now time.Time, lastUsedStep int64) (int64, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+	code = strings.ReplaceAll(code, " ", "")
+
+	current := totpStep(now)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastUsedStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCodeForStep(key, step)), []byte(code)) == 1 {
+			return step, nil
+		}
+	}
+	return 0, ErrInvalidTOTPCode
+}
+
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(totpPeriod.Seconds())
+}
+
+// totpCodeForStep implements the HOTP algorithm from RFC 4226, using the time
+// step as the counter.
+func totpCodeForStep(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%totpModulo)
+}
+
+// GenerateRecoveryCodes returns new recovery codes, and the hashes of the
+// codes that should be stored.
+func GenerateRecoveryCodes() (codes []string, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generate.CryptoRandom(10, generate.CharsetAlphaNumericNoVowels)
+		if err != nil {
+			return nil, nil, err
+		}
+		code = strings.ToLower(code[:5] + "-" + code[5:])
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode returns the hash of a recovery code. Recovery codes are
+// random, so a fast hash is sufficient.
+func HashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
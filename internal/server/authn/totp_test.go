@@ -0,0 +1,114 @@
+package authn
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+// rfc6238Secret is the SHA1 secret from the test vectors in RFC 6238,
+// "12345678901234567890" encoded as base32.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// the RFC uses 8 digits, these are the last 6 digits of those codes
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, expected := range vectors {
+		code, err := TOTPCode(rfc6238Secret, time.Unix(unix, 0))
+		assert.NilError(t, err)
+		assert.Equal(t, code, expected, "time %d", unix)
+	}
+}
+
+func TestValidateTOTPCode(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := totpStep(now)
+
+	codeAt := func(t *testing.T, at time.Time) string {
+		t.Helper()
+		code, err := TOTPCode(rfc6238Secret, at)
+		assert.NilError(t, err)
+		return code
+	}
+
+	t.Run("current step", func(t *testing.T) {
+		actual, err := ValidateTOTPCode(rfc6238Secret, codeAt(t, now), now, 0)
+		assert.NilError(t, err)
+		assert.Equal(t, actual, step)
+	})
+	t.Run("code with spaces", func(t *testing.T) {
+		code := codeAt(t, now)
+		actual, err := ValidateTOTPCode(rfc6238Secret, code[:3]+" "+code[3:], now, 0)
+		assert.NilError(t, err)
+		assert.Equal(t, actual, step)
+	})
+	t.Run("one step of skew", func(t *testing.T) {
+		actual, err := ValidateTOTPCode(rfc6238Secret, codeAt(t, now.Add(-totpPeriod)), now, 0)
+		assert.NilError(t, err)
+		assert.Equal(t, actual, step-1)
+
+		actual, err = ValidateTOTPCode(rfc6238Secret, codeAt(t, now.Add(totpPeriod)), now, 0)
+		assert.NilError(t, err)
+		assert.Equal(t, actual, step+1)
+	})
+	t.Run("two steps of skew", func(t *testing.T) {
+		_, err := ValidateTOTPCode(rfc6238Secret, codeAt(t, now.Add(-2*totpPeriod)), now, 0)
+		assert.ErrorIs(t, err, ErrInvalidTOTPCode)
+
+		_, err = ValidateTOTPCode(rfc6238Secret, codeAt(t, now.Add(2*totpPeriod)), now, 0)
+		assert.ErrorIs(t, err, ErrInvalidTOTPCode)
+	})
+	t.Run("code was already used", func(t *testing.T) {
+		_, err := ValidateTOTPCode(rfc6238Secret, codeAt(t, now), now, step)
+		assert.ErrorIs(t, err, ErrInvalidTOTPCode)
+
+		// a code from an earlier step can not be used after a later one
+		_, err = ValidateTOTPCode(rfc6238Secret, codeAt(t, now.Add(-totpPeriod)), now, step)
+		assert.ErrorIs(t, err, ErrInvalidTOTPCode)
+	})
+	t.Run("wrong code", func(t *testing.T) {
+		_, err := ValidateTOTPCode(rfc6238Secret, "123456", now, 0)
+		assert.ErrorIs(t, err, ErrInvalidTOTPCode)
+	})
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	assert.NilError(t, err)
+	assert.Equal(t, len(secret), 32)
+
+	_, err = TOTPCode(secret, time.Now())
+	assert.NilError(t, err)
+
+	uri, err := url.Parse(TOTPURI("Infra", "alice@example.com", secret))
+	assert.NilError(t, err)
+	assert.Equal(t, uri.Scheme, "otpauth")
+	assert.Equal(t, uri.Host, "totp")
+	assert.Equal(t, uri.Path, "/Infra:alice@example.com")
+	assert.Equal(t, uri.Query().Get("secret"), secret)
+	assert.Equal(t, uri.Query().Get("issuer"), "Infra")
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes()
+	assert.NilError(t, err)
+	assert.Equal(t, len(codes), recoveryCodeCount)
+	assert.Equal(t, len(hashes), recoveryCodeCount)
+
+	for i, code := range codes {
+		assert.Equal(t, len(code), 11)
+		assert.Equal(t, HashRecoveryCode(code), hashes[i])
+		// codes are accepted regardless of case
+		assert.Equal(t, HashRecoveryCode(strings.ToUpper(code)), hashes[i])
+	}
+}
@@ -21,6 +21,11 @@ func (s *Server) SetupBackgroundJobs(ctx context.Context) {
 	s.registerJob(ctx, jobs.RemoveOldDeviceFlowRequests, 10*time.Minute)
 	s.registerJob(ctx, jobs.RemoveExpiredAccessKeys, 12*time.Hour)
 	s.registerJob(ctx, jobs.RemoveExpiredPasswordResetTokens, 15*time.Minute)
+	s.registerJob(ctx, jobs.RemoveExpiredIssuedTokens, 15*time.Minute)
+	s.registerJob(ctx, jobs.RemoveExpiredImpersonationApprovals, 15*time.Minute)
+	s.registerJob(ctx, jobs.AggregateDestinationUsage, time.Hour)
+	s.registerPurgeJob(ctx)
+	s.registerWebhookDeliverer(ctx)
 }
 
 func (s *Server) registerJob(ctx context.Context, job BackgroundJobFunc, every time.Duration) {
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/access"
+	"github.com/infrahq/infra/uid"
+)
+
+// uniqueIDs returns ids with any duplicates removed, in the same order.
+func uniqueIDs(ids []uid.ID) []uid.ID {
+	seen := make(map[uid.ID]bool, len(ids))
+	result := make([]uid.ID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// newBulkDeleteResponse returns the result of deleting each of ids. failed
+// contains the error for each ID that was not deleted.
+func newBulkDeleteResponse(ids []uid.ID, failed map[uid.ID]error) *api.BulkDeleteResponse {
+	resp := &api.BulkDeleteResponse{Items: make([]api.BulkDeleteResult, 0, len(ids))}
+	for _, id := range ids {
+		result := api.BulkDeleteResult{ID: id, Status: api.BulkDeleteStatusDeleted}
+		if err, ok := failed[id]; ok {
+			result.Message = err.Error()
+			switch {
+			case errors.Is(err, internal.ErrNotFound):
+				result.Status = api.BulkDeleteStatusNotFound
+			case errors.Is(err, access.ErrNotAuthorized):
+				result.Status = api.BulkDeleteStatusForbidden
+			default:
+				result.Status = api.BulkDeleteStatusBadRequest
+			}
+		}
+		resp.Items = append(resp.Items, result)
+	}
+	return resp
+}
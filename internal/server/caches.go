@@ -0,0 +1,95 @@
+package server
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/infrahq/infra/internal/lru"
+	"github.com/infrahq/infra/internal/server/data"
+)
+
+// Names of the caches in the cacheRegistry of the Server.
+const (
+	// cacheNameDBReads is the cache of the rows read by data.InfraProvider
+	// and data.GetOrgSettings.
+	cacheNameDBReads = "db-reads"
+	// cacheNameOIDCProviders is the cache of the discovery documents and
+	// signing keys of the OIDC identity providers.
+	cacheNameOIDCProviders = "oidc-providers"
+)
+
+// registeredCache is implemented by the in-memory caches of the server, so
+// that support admins can inspect and flush them with the /api/debug/caches
+// endpoints without restarting the server.
+type registeredCache interface {
+	CacheStats() data.CacheStats
+	// FlushCache removes every entry from the cache.
+	FlushCache()
+}
+
+// cacheRegistry stores the caches of the server by name.
+type cacheRegistry struct {
+	mu     sync.Mutex
+	caches map[string]registeredCache
+}
+
+func newCacheRegistry() *cacheRegistry {
+	return &cacheRegistry{caches: map[string]registeredCache{}}
+}
+
+// register adds cache to the registry, replacing any cache that was
+// registered with the same name.
+func (r *cacheRegistry) register(name string, cache registeredCache) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.caches[name] = cache
+}
+
+func (r *cacheRegistry) get(name string) (registeredCache, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cache, ok := r.caches[name]
+	return cache, ok
+}
+
+// names returns the names of the registered caches in sorted order.
+func (r *cacheRegistry) names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.caches))
+	for name := range r.caches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lruCacheStats converts the stats of an lru.Cache for the cache endpoints.
+func lruCacheStats(stats lru.Stats) data.CacheStats {
+	return data.CacheStats{
+		Entries: stats.Entries,
+		Hits:    stats.Hits,
+		Misses:  stats.Misses,
+		Oldest:  stats.Oldest,
+	}
+}
+
+// lruCache is the subset of lru.Cache that does not depend on the types of the
+// keys and values.
+type lruCache interface {
+	Stats() lru.Stats
+	Purge()
+}
+
+// registeredLRUCache adapts an lru.Cache to registeredCache.
+type registeredLRUCache struct {
+	cache lruCache
+}
+
+func (r registeredLRUCache) CacheStats() data.CacheStats {
+	return lruCacheStats(r.cache.Stats())
+}
+
+func (r registeredLRUCache) FlushCache() {
+	r.cache.Purge()
+}
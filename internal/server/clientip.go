@@ -0,0 +1,137 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/internal/logging"
+)
+
+// parseTrustedProxies parses a list of CIDR ranges. An IP address without a
+// prefix length is treated as a range with a single address.
+func parseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	result := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		result = append(result, ipNet)
+	}
+	return result, nil
+}
+
+// clientIPMiddleware resolves the IP address of the client that made the
+// request, and stores it in the request context. Use logging.ClientIP to
+// read it.
+func clientIPMiddleware(trusted []*net.IPNet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := resolveClientIP(c.Request, trusted)
+		c.Request = c.Request.WithContext(logging.WithClientIP(c.Request.Context(), ip))
+		c.Next()
+	}
+}
+
+// resolveClientIP returns the IP address of the client that made req. When
+// the request was sent by a trusted proxy the proxy headers are walked from
+// the right, which is the hop closest to the server, and the first address
+// that is not a trusted proxy is the client. Addresses to the left of an
+// untrusted address were set by the client, and can not be trusted.
+//
+// The Forwarded header (RFC 7239) is used when it is set, otherwise
+// X-Forwarded-For is used. The walk stops at a hop that is not an IP address,
+// like an obfuscated identifier or "unknown", and the last address that was
+// resolved is returned.
+func resolveClientIP(req *http.Request, trusted []*net.IPNet) string {
+	remote := parseHop(req.RemoteAddr)
+	if remote == nil {
+		return req.RemoteAddr
+	}
+	if !isTrustedProxy(remote, trusted) {
+		return remote.String()
+	}
+
+	var hops []string
+	if values := req.Header.Values("Forwarded"); len(values) > 0 {
+		hops = forwardedFor(values)
+	} else {
+		for _, value := range req.Header.Values("X-Forwarded-For") {
+			hops = append(hops, strings.Split(value, ",")...)
+		}
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := parseHop(hops[i])
+		if ip == nil {
+			break
+		}
+		client = ip
+		if !isTrustedProxy(ip, trusted) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// forwardedFor returns the for parameter of each element in the Forwarded
+// header values. Elements without a for parameter are returned as an empty
+// string, so that the walk stops at them.
+func forwardedFor(values []string) []string {
+	var result []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			var hop string
+			for _, pair := range strings.Split(element, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					hop = strings.Trim(val, `"`)
+					break
+				}
+			}
+			result = append(result, hop)
+		}
+	}
+	return result
+}
+
+// parseHop parses an IP address with an optional port. IPv6 addresses with a
+// port must be enclosed in square brackets. parseHop returns nil if hop is not
+// an IP address.
+func parseHop(hop string) net.IP {
+	hop = strings.TrimSpace(hop)
+	if ip := net.ParseIP(hop); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(hop); err == nil {
+		return net.ParseIP(host)
+	}
+	return net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(hop, "["), "]"))
+}
+
+func isTrustedProxy(ip net.IP, trusted []*net.IPNet) bool {
+	for _, ipNet := range trusted {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		trusted, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.5", "2001:db8::/32", "2001:db8:ffff::1"})
+		assert.NilError(t, err)
+
+		var actual []string
+		for _, ipNet := range trusted {
+			actual = append(actual, ipNet.String())
+		}
+		expected := []string{"10.0.0.0/8", "192.0.2.5/32", "2001:db8::/32", "2001:db8:ffff::1/128"}
+		assert.DeepEqual(t, actual, expected)
+	})
+	t.Run("invalid address", func(t *testing.T) {
+		_, err := parseTrustedProxies([]string{"10.0.0.0/8", "not-an-ip"})
+		assert.ErrorContains(t, err, `invalid trusted proxy "not-an-ip"`)
+	})
+	t.Run("invalid range", func(t *testing.T) {
+		_, err := parseTrustedProxies([]string{"10.0.0.0/33"})
+		assert.ErrorContains(t, err, `invalid trusted proxy "10.0.0.0/33"`)
+	})
+}
+
+func TestResolveClientIP(t *testing.T) {
+	trusted, err := parseTrustedProxies([]string{"10.0.0.0/8", "2001:db8:1::/48"})
+	assert.NilError(t, err)
+
+	type testCase struct {
+		name       string
+		remoteAddr string
+		headers    map[string][]string
+		expected   string
+	}
+
+	run := func(t *testing.T, tc testCase) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tc.remoteAddr
+		for key, values := range tc.headers {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
+		}
+		assert.Equal(t, resolveClientIP(req, trusted), tc.expected)
+	}
+
+	testCases := []testCase{
+		{
+			name:       "no proxy",
+			remoteAddr: "192.0.2.10:4321",
+			expected:   "192.0.2.10",
+		},
+		{
+			name:       "spoofed header from untrusted remote",
+			remoteAddr: "192.0.2.10:4321",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.7"}},
+			expected:   "192.0.2.10",
+		},
+		{
+			name:       "spoofed forwarded header from untrusted remote",
+			remoteAddr: "192.0.2.10:4321",
+			headers:    map[string][]string{"Forwarded": {"for=198.51.100.7"}},
+			expected:   "192.0.2.10",
+		},
+		{
+			name:       "trusted proxy",
+			remoteAddr: "10.0.0.1:4321",
+			headers:    map[string][]string{"X-Forwarded-For": {"192.0.2.10"}},
+			expected:   "192.0.2.10",
+		},
+		{
+			name:       "trusted proxy without header",
+			remoteAddr: "10.0.0.1:4321",
+			expected:   "10.0.0.1",
+		},
+		{
+			name:       "chained proxies",
+			remoteAddr: "10.0.0.1:4321",
+			headers:    map[string][]string{"X-Forwarded-For": {"192.0.2.10, 10.0.0.3, 10.0.0.2"}},
+			expected:   "192.0.2.10",
+		},
+		{
+			name:       "chained proxies in multiple headers",
+			remoteAddr: "10.0.0.1:4321",
+			headers:    map[string][]string{"X-Forwarded-For": {"192.0.2.10, 10.0.0.3", "10.0.0.2"}},
+			expected:   "192.0.2.10",
+		},
+		{
+			name:       "spoofed hops left of the client are ignored",
+			remoteAddr: "10.0.0.1:4321",
+			headers:    map[string][]string{"X-Forwarded-For": {"10.0.0.99, 198.51.100.7, 192.0.2.10, 10.0.0.2"}},
+			expected:   "192.0.2.10",
+		},
+		{
+			name:       "all hops trusted",
+			remoteAddr: "10.0.0.1:4321",
+			headers:    map[string][]string{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}},
+			expected:   "10.0.0.3",
+		},
+		{
+			name:       "invalid hop",
+			remoteAddr: "10.0.0.1:4321",
+			headers:    map[string][]string{"X-Forwarded-For": {"192.0.2.10, garbage, 10.0.0.2"}},
+			expected:   "10.0.0.2",
+		},
+		{
+			name:       "IPv6 remote and hops",
+			remoteAddr: "[2001:db8:1::1]:4321",
+			headers:    map[string][]string{"X-Forwarded-For": {"2001:db8:2::10, 2001:db8:1::2"}},
+			expected:   "2001:db8:2::10",
+		},
+		{
+			name:       "IPv6 untrusted remote",
+			remoteAddr: "[2001:db8:2::1]:4321",
+			headers:    map[string][]string{"X-Forwarded-For": {"2001:db8:2::10"}},
+			expected:   "2001:db8:2::1",
+		},
+		{
+			name:       "forwarded",
+			remoteAddr: "10.0.0.1:4321",
+			headers:    map[string][]string{"Forwarded": {"for=192.0.2.10;proto=https, for=10.0.0.2"}},
+			expected:   "192.0.2.10",
+		},
+		{
+			name:       "forwarded with quoted IPv6 and port",
+			remoteAddr: "[2001:db8:1::1]:4321",
+			headers:    map[string][]string{"Forwarded": {`For="[2001:db8:2::10]:4711", for="10.0.0.2:8080"`}},
+			expected:   "2001:db8:2::10",
+		},
+		{
+			name:       "forwarded with obfuscated hop",
+			remoteAddr: "10.0.0.1:4321",
+			headers:    map[string][]string{"Forwarded": {"for=192.0.2.10, for=_hidden, for=10.0.0.2"}},
+			expected:   "10.0.0.2",
+		},
+		{
+			name:       "forwarded with unknown hop",
+			remoteAddr: "10.0.0.1:4321",
+			headers:    map[string][]string{"Forwarded": {"for=unknown"}},
+			expected:   "10.0.0.1",
+		},
+		{
+			name:       "forwarded takes precedence over X-Forwarded-For",
+			remoteAddr: "10.0.0.1:4321",
+			headers: map[string][]string{
+				"Forwarded":       {"for=192.0.2.10"},
+				"X-Forwarded-For": {"198.51.100.7"},
+			},
+			expected: "192.0.2.10",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+
+	t.Run("no trusted proxies", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:4321"
+		req.Header.Set("X-Forwarded-For", "192.0.2.10")
+		assert.Equal(t, resolveClientIP(req, nil), "10.0.0.1")
+	})
+}
+
+func TestAPI_ClientIP_Audit(t *testing.T) {
+	srv := setupServer(t, withAdminUser, func(t *testing.T, options *Options) {
+		options.TrustedProxies = []string{"10.0.0.0/8"}
+	})
+	var err error
+	srv.trustedProxies, err = parseTrustedProxies(srv.options.TrustedProxies)
+	assert.NilError(t, err)
+	routes := srv.GenerateRoutes()
+
+	sink := withMemoryAuditSink(srv)
+
+	body := jsonBody(t, api.LoginRequest{
+		PasswordCredentials: &api.LoginRequestPasswordCredentials{
+			Name:     "nobody@example.com",
+			Password: "wrong",
+		},
+	})
+	// nolint:noctx
+	req := httptest.NewRequest(http.MethodPost, "/api/login", body)
+	req.Header.Set("Infra-Version", apiVersionLatest)
+	req.Header.Set("X-Forwarded-For", "198.51.100.7, 2001:db8::10, 10.0.0.2")
+	req.RemoteAddr = "10.0.0.1:4321"
+	resp := httptest.NewRecorder()
+	routes.ServeHTTP(resp, req)
+	assert.Equal(t, resp.Code, http.StatusUnauthorized, (*responseDebug)(resp))
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	assert.Equal(t, len(sink.events), 1)
+	assert.Equal(t, sink.events[0].Action, "login")
+	assert.Equal(t, sink.events[0].Result, models.AuditResultFailure)
+	assert.Equal(t, sink.events[0].SourceIP, "2001:db8::10")
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// compressMinSize is the smallest response body that is compressed. Smaller
+// responses fit in a few packets, so compressing them saves very little.
+const compressMinSize = 1024
+
+// compressionMiddleware compresses the response body with gzip when the
+// request accepts it. The body is buffered until it is at least
+// compressMinSize, so that small responses are sent unchanged. Responses that
+// already have a Content-Encoding, or a content type that is already
+// compressed, are also sent unchanged.
+//
+// Handlers that stream a response can call Flush, which flushes the
+// compressed output written so far.
+func compressionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		if c.Request.Method == http.MethodHead || !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+			c.Next()
+			return
+		}
+
+		w := &gzipResponseWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+		c.Writer = w
+		defer func() {
+			w.close()
+			c.Writer = w.ResponseWriter
+		}()
+		c.Next()
+	}
+}
+
+// acceptsGzip returns true if the value of an Accept-Encoding header allows a
+// gzip response. An explicit gzip entry takes precedence over *.
+func acceptsGzip(acceptEncoding string) bool {
+	wildcard := false
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "gzip" && name != "*" {
+			continue
+		}
+
+		accepted := true
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			q, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64)
+			accepted = err != nil || q > 0
+		}
+		if name == "gzip" {
+			return accepted
+		}
+		wildcard = accepted
+	}
+	return wildcard
+}
+
+// compressedContentTypes are the prefixes of content types that are already
+// compressed, and are not compressed again.
+var compressedContentTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"application/gzip",
+	"application/zip",
+	"application/x-gzip",
+	"application/zstd",
+}
+
+type gzipResponseWriter struct {
+	gin.ResponseWriter
+	status int
+	// buf holds the body until the writer decides whether to compress it.
+	buf     bytes.Buffer
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (w *gzipResponseWriter) WriteHeader(code int) {
+	if code > 0 && !w.decided {
+		w.status = code
+	}
+}
+
+func (w *gzipResponseWriter) WriteHeaderNow() {
+	if !w.decided {
+		_ = w.decide(false)
+	}
+}
+
+func (w *gzipResponseWriter) Status() int {
+	if !w.decided {
+		return w.status
+	}
+	return w.ResponseWriter.Status()
+}
+
+func (w *gzipResponseWriter) Written() bool {
+	return w.decided || w.buf.Len() > 0
+}
+
+func (w *gzipResponseWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.buf.Write(data)
+		if w.buf.Len() < compressMinSize {
+			return len(data), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if w.gz != nil {
+		return w.gz.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *gzipResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush sends the output written so far. A response that is flushed before
+// it reaches compressMinSize is not compressed.
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		_ = w.decide(w.buf.Len() >= compressMinSize)
+	}
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// decide writes the response header, and the buffered body. The body is
+// compressed when compress is true and the response can be compressed.
+func (w *gzipResponseWriter) decide(compress bool) error {
+	w.decided = true
+	header := w.Header()
+	if compress && w.canCompress() {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		// the compressed body is not byte for byte equal to the uncompressed
+		// one, so a strong entity tag becomes weak
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.WriteHeaderNow()
+
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(w.buf.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+	return err
+}
+
+func (w *gzipResponseWriter) canCompress() bool {
+	if w.status < http.StatusOK || w.status == http.StatusNoContent || w.status == http.StatusNotModified {
+		return false
+	}
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	for _, prefix := range compressedContentTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// close sends any buffered output, and completes the compressed body.
+func (w *gzipResponseWriter) close() {
+	if !w.decided {
+		if w.buf.Len() == 0 && w.status == http.StatusOK {
+			// nothing was written, leave the response to gin
+			return
+		}
+		_ = w.decide(w.buf.Len() >= compressMinSize)
+	}
+	if w.gz != nil {
+		_ = w.gz.Close()
+	}
+}
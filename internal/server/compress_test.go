@@ -0,0 +1,205 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	testCases := []struct {
+		acceptEncoding string
+		expected       bool
+	}{
+		{acceptEncoding: "", expected: false},
+		{acceptEncoding: "gzip", expected: true},
+		{acceptEncoding: "deflate, gzip;q=1.0, *;q=0.5", expected: true},
+		{acceptEncoding: "GZIP", expected: true},
+		{acceptEncoding: "br", expected: false},
+		{acceptEncoding: "gzip;q=0", expected: false},
+		{acceptEncoding: "*", expected: true},
+		{acceptEncoding: "*;q=0", expected: false},
+		{acceptEncoding: "gzip;q=0, *", expected: false},
+		{acceptEncoding: "identity", expected: false},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, acceptsGzip(tc.acceptEncoding), tc.expected, "Accept-Encoding: %v", tc.acceptEncoding)
+	}
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	large := strings.Repeat("abcdefghij", 2*compressMinSize/10)
+
+	router := gin.New()
+	router.Use(compressionMiddleware())
+	router.GET("/json", func(c *gin.Context) {
+		c.Header("ETag", `"abc"`)
+		c.JSON(http.StatusOK, map[string]string{"value": large})
+	})
+	router.GET("/small", func(c *gin.Context) {
+		c.JSON(http.StatusOK, map[string]string{"value": "small"})
+	})
+	router.GET("/image", func(c *gin.Context) {
+		c.Data(http.StatusOK, "image/png", []byte(large))
+	})
+	router.GET("/created", func(c *gin.Context) {
+		c.JSON(http.StatusCreated, map[string]string{"value": large})
+	})
+	router.GET("/no-content", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	router.GET("/stream", func(c *gin.Context) {
+		c.Header("Content-Type", "application/json")
+		for i := 0; i < 3; i++ {
+			_, _ = fmt.Fprintf(c.Writer, "%d%s\n", i, large)
+			c.Writer.Flush()
+		}
+	})
+
+	get := func(t *testing.T, path string, acceptEncoding string) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("large response is compressed", func(t *testing.T) {
+		plain := get(t, "/json", "")
+		assert.Equal(t, plain.Code, http.StatusOK)
+		assert.Equal(t, plain.Header().Get("Content-Encoding"), "")
+		assert.Equal(t, plain.Header().Get("Vary"), "Accept-Encoding")
+		assert.Equal(t, plain.Header().Get("ETag"), `"abc"`)
+
+		resp := get(t, "/json", "gzip")
+		assert.Equal(t, resp.Code, http.StatusOK)
+		assert.Equal(t, resp.Header().Get("Content-Encoding"), "gzip")
+		assert.Equal(t, resp.Header().Get("Vary"), "Accept-Encoding")
+		assert.Equal(t, resp.Header().Get("ETag"), `W/"abc"`)
+		assert.Assert(t, resp.Body.Len() < plain.Body.Len())
+		assert.Equal(t, gunzip(t, resp.Body), plain.Body.String())
+	})
+	t.Run("status code is preserved", func(t *testing.T) {
+		resp := get(t, "/created", "gzip")
+		assert.Equal(t, resp.Code, http.StatusCreated)
+		assert.Equal(t, resp.Header().Get("Content-Encoding"), "gzip")
+	})
+	t.Run("small response is not compressed", func(t *testing.T) {
+		resp := get(t, "/small", "gzip")
+		assert.Equal(t, resp.Code, http.StatusOK)
+		assert.Equal(t, resp.Header().Get("Content-Encoding"), "")
+		assert.Equal(t, resp.Body.String(), `{"value":"small"}`)
+	})
+	t.Run("compressed content type is not compressed", func(t *testing.T) {
+		resp := get(t, "/image", "gzip")
+		assert.Equal(t, resp.Code, http.StatusOK)
+		assert.Equal(t, resp.Header().Get("Content-Encoding"), "")
+		assert.Equal(t, resp.Body.String(), large)
+	})
+	t.Run("response without a body", func(t *testing.T) {
+		resp := get(t, "/no-content", "gzip")
+		assert.Equal(t, resp.Code, http.StatusNoContent)
+		assert.Equal(t, resp.Header().Get("Content-Encoding"), "")
+		assert.Equal(t, resp.Body.Len(), 0)
+	})
+	t.Run("streamed response is flushed", func(t *testing.T) {
+		plain := get(t, "/stream", "")
+		resp := get(t, "/stream", "gzip")
+		assert.Equal(t, resp.Code, http.StatusOK)
+		assert.Assert(t, resp.Flushed)
+		assert.Equal(t, resp.Header().Get("Content-Encoding"), "gzip")
+		assert.Equal(t, gunzip(t, resp.Body), plain.Body.String())
+	})
+}
+
+func gunzip(t *testing.T, body io.Reader) string {
+	t.Helper()
+	r, err := gzip.NewReader(body)
+	assert.NilError(t, err)
+	out, err := io.ReadAll(r)
+	assert.NilError(t, err)
+	assert.NilError(t, r.Close())
+	return string(out)
+}
+
+func TestAPI_CompressedResponses(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+
+	for i := 0; i < 20; i++ {
+		user := &models.Identity{Name: fmt.Sprintf("compress%d@example.com", i)}
+		assert.NilError(t, data.CreateIdentity(srv.DB(), user))
+	}
+
+	get := func(t *testing.T, path string, acceptEncoding string) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("list users", func(t *testing.T) {
+		plain := get(t, "/api/users", "")
+		assert.Equal(t, plain.Code, http.StatusOK, plain.Body.String())
+		assert.Equal(t, plain.Header().Get("Content-Encoding"), "")
+
+		resp := get(t, "/api/users", "gzip")
+		assert.Equal(t, resp.Code, http.StatusOK)
+		assert.Equal(t, resp.Header().Get("Content-Encoding"), "gzip")
+		assert.Equal(t, gunzip(t, resp.Body), plain.Body.String())
+	})
+
+	t.Run("export organization", func(t *testing.T) {
+		path := "/api/organizations/" + srv.db.DefaultOrg.ID.String() + "/export"
+		plain := get(t, path, "")
+		assert.Equal(t, plain.Code, http.StatusOK, plain.Body.String())
+
+		resp := get(t, path, "gzip")
+		assert.Equal(t, resp.Code, http.StatusOK)
+		assert.Equal(t, resp.Header().Get("Content-Encoding"), "gzip")
+
+		// exportedAt is different for each request
+		decode := func(body io.Reader) map[string]any {
+			var export map[string]any
+			assert.NilError(t, json.NewDecoder(body).Decode(&export))
+			delete(export, "exportedAt")
+			return export
+		}
+		expected := decode(plain.Body)
+		actual := decode(bytes.NewBufferString(gunzip(t, resp.Body)))
+		assert.DeepEqual(t, actual, expected)
+	})
+
+	t.Run("small and error responses", func(t *testing.T) {
+		resp := get(t, "/api/users/self", "gzip")
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		assert.Equal(t, resp.Header().Get("Content-Encoding"), "")
+
+		resp = get(t, "/api/users/2341", "gzip")
+		assert.Equal(t, resp.Code, http.StatusNotFound, resp.Body.String())
+		assert.Equal(t, resp.Header().Get("Content-Encoding"), "")
+	})
+}
@@ -184,8 +184,9 @@ func importKeyProviders(
 ) error {
 	var err error
 
-	// default to file-based native secret provider
-	keys["native"] = secrets.NewNativeKeyProvider(storage["file"])
+	// default to native secret provider, with the root key read from a file
+	// or from a secret storage reference
+	keys["native"] = secrets.NewNativeKeyProvider(rootKeyStorage{file: storage["file"], storage: storage})
 
 	for _, keyConfig := range cfg {
 		switch keyConfig.Kind {
@@ -546,6 +547,10 @@ func loadDefaultSecretConfig(storage map[string]secrets.SecretStorage) error {
 		}
 	}
 
+	if _, found := storage["exec"]; !found {
+		storage["exec"] = &execSecretProvider{timeout: defaultExecSecretTimeout}
+	}
+
 	return nil
 }
 
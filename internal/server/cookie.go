@@ -23,26 +23,24 @@ type cookieConfig struct {
 	Expires time.Time
 }
 
-func setCookie(req *http.Request, resp http.ResponseWriter, config cookieConfig) {
+// setCookie sets a cookie that is only sent over HTTPS and is not accessible
+// by javascript. SameSite=Lax sends the cookie when the user follows a link to
+// the UI from another site, but not with cross-site requests that change
+// state. Those are also rejected by validateCSRF.
+func setCookie(resp http.ResponseWriter, config cookieConfig) {
 	maxAge := int(time.Until(config.Expires).Seconds())
 	if maxAge == cookieMaxAgeNoExpiry {
 		maxAge = cookieMaxAgeDeleteImmediately
 	}
 
-	secure := true
-	if req.TLS == nil {
-		// if the request came over HTTP, then the cookie will need to be sent unsecured
-		secure = false
-	}
-
 	http.SetCookie(resp, &http.Cookie{
 		Name:     config.Name,
 		Value:    url.QueryEscape(config.Value),
 		MaxAge:   maxAge,
 		Path:     cookiePath,
 		Domain:   config.Domain,
-		SameSite: http.SameSiteStrictMode,
-		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   true, // only over https
 		HttpOnly: true, // not accessible by javascript
 	})
 }
@@ -78,7 +76,7 @@ func exchangeSignupCookieForSession(
 		Domain:  req.Host,
 		Expires: exp,
 	}
-	setCookie(req, resp, conf)
+	setCookie(resp, conf)
 	deleteCookie(resp, cookieSignupName, opts.BaseDomain)
 
 	return signupCookie
@@ -39,7 +39,7 @@ func TestResendAuthCookie(t *testing.T) {
 	cookies := resp.Header()["Set-Cookie"]
 
 	matched, err := regexp.MatchString(
-		"auth=aaa; Path=/; Domain=dev.example.com; Max-Age=\\d\\d; HttpOnly; SameSite=Strict",
+		"auth=aaa; Path=/; Domain=dev.example.com; Max-Age=\\d\\d; HttpOnly; Secure; SameSite=Lax",
 		cookies[0])
 	assert.NilError(t, err)
 	assert.Assert(t, matched)
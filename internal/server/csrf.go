@@ -0,0 +1,86 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/access"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+const headerCSRFToken = "X-CSRF-Token"
+
+// csrfToken returns the CSRF token for the session of key. The token is
+// derived from the secret of the access key, so that every session has a
+// different token, and the token does not need to be stored.
+func csrfToken(key *models.AccessKey) string {
+	mac := hmac.New(sha256.New, key.SecretChecksum)
+	mac.Write([]byte("csrf-token"))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validateCSRF checks a request that was authenticated with the auth cookie.
+// Requests that may change state must come from the same origin as the
+// server, and must include the CSRF token of the session in a header. A
+// cross-site request can send the cookie, but can not read the token.
+//
+// Requests authenticated with the Authorization header are not checked,
+// because browsers never send the header automatically.
+func validateCSRF(req *http.Request, key *models.AccessKey) error {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+
+	if err := validateRequestOrigin(req); err != nil {
+		return err
+	}
+
+	token := req.Header.Get(headerCSRFToken)
+	if token == "" {
+		return fmt.Errorf("%w: the %v header is required", access.ErrNotAuthorized, headerCSRFToken)
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(csrfToken(key))) != 1 {
+		return fmt.Errorf("%w: invalid %v header", access.ErrNotAuthorized, headerCSRFToken)
+	}
+	return nil
+}
+
+// validateRequestOrigin checks that the Origin header, or the Referer header
+// when there is no Origin, matches the host of the request. Requests with
+// neither header are allowed, because not every client sends them.
+func validateRequestOrigin(req *http.Request) error {
+	source := req.Header.Get("Origin")
+	if source == "" {
+		source = req.Header.Get("Referer")
+	}
+	if source == "" {
+		return nil
+	}
+
+	u, err := url.Parse(source)
+	if err != nil || u.Host != req.Host {
+		return fmt.Errorf("%w: request origin %q does not match the host %q",
+			access.ErrNotAuthorized, source, req.Host)
+	}
+	return nil
+}
+
+// GetCSRFToken returns the CSRF token of the session used for the request.
+func (a *API) GetCSRFToken(c *gin.Context, _ *api.EmptyRequest) (*api.CSRFTokenResponse, error) {
+	// does not need authorization check, the token is for the calling key
+	rCtx := getRequestContext(c)
+	key := rCtx.Authenticated.AccessKey
+	if key == nil {
+		return nil, fmt.Errorf("no authenticated access key")
+	}
+	return &api.CSRFTokenResponse{Token: csrfToken(key)}, nil
+}
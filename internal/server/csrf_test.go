@@ -0,0 +1,153 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+)
+
+func TestAPI_CSRF(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+	accessKey := adminAccessKey(srv)
+
+	type testCase struct {
+		name         string
+		method       string
+		path         string
+		bearer       bool
+		csrfToken    string
+		headers      map[string]string
+		expectedCode int
+	}
+
+	send := func(t *testing.T, tc testCase) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		if tc.bearer {
+			req.Header.Set("Authorization", "Bearer "+accessKey)
+		} else {
+			req.AddCookie(&http.Cookie{Name: cookieAuthorizationName, Value: accessKey})
+		}
+		if tc.csrfToken != "" {
+			req.Header.Set(headerCSRFToken, tc.csrfToken)
+		}
+		for key, value := range tc.headers {
+			req.Header.Set(key, value)
+		}
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := send(t, testCase{method: http.MethodGet, path: "/api/csrf-token"})
+	assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+	var tokenResp api.CSRFTokenResponse
+	assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &tokenResp))
+	token := tokenResp.Token
+	assert.Assert(t, token != "")
+
+	testCases := []testCase{
+		{
+			name:         "cookie with token",
+			method:       http.MethodPost,
+			path:         "/api/access-keys/self/extend",
+			csrfToken:    token,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "cookie without token",
+			method:       http.MethodPost,
+			path:         "/api/access-keys/self/extend",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "cookie with wrong token",
+			method:       http.MethodPost,
+			path:         "/api/access-keys/self/extend",
+			csrfToken:    "not-the-token",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "cookie with token from same origin",
+			method:       http.MethodPost,
+			path:         "/api/access-keys/self/extend",
+			csrfToken:    token,
+			headers:      map[string]string{"Origin": "https://example.com"},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "cookie with token from another origin",
+			method:       http.MethodPost,
+			path:         "/api/access-keys/self/extend",
+			csrfToken:    token,
+			headers:      map[string]string{"Origin": "https://evil.example.org"},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "cookie with token and referer from another origin",
+			method:       http.MethodPost,
+			path:         "/api/access-keys/self/extend",
+			csrfToken:    token,
+			headers:      map[string]string{"Referer": "https://evil.example.org/page"},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "cookie with token and null origin",
+			method:       http.MethodPost,
+			path:         "/api/access-keys/self/extend",
+			csrfToken:    token,
+			headers:      map[string]string{"Origin": "null"},
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "cookie with GET does not require a token",
+			method:       http.MethodGet,
+			path:         "/api/self",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "bearer does not require a token",
+			method:       http.MethodPost,
+			path:         "/api/access-keys/self/extend",
+			bearer:       true,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "bearer from another origin",
+			method:       http.MethodPost,
+			path:         "/api/access-keys/self/extend",
+			bearer:       true,
+			headers:      map[string]string{"Origin": "https://evil.example.org"},
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := send(t, tc)
+			assert.Equal(t, resp.Code, tc.expectedCode, (*responseDebug)(resp))
+		})
+	}
+
+	t.Run("token is different for each session", func(t *testing.T) {
+		key, _ := createAccessKey(t, srv.DB(), "other@example.com")
+		req := httptest.NewRequest(http.MethodGet, "/api/csrf-token", nil)
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		req.AddCookie(&http.Cookie{Name: cookieAuthorizationName, Value: key})
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+
+		var other api.CSRFTokenResponse
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &other))
+		assert.Assert(t, other.Token != token)
+	})
+}
@@ -17,22 +17,6 @@ import (
 
 type accessKeyTable models.AccessKey
 
-func (a accessKeyTable) Table() string {
-	return "access_keys"
-}
-
-func (a accessKeyTable) Columns() []string {
-	return []string{"created_at", "deleted_at", "expires_at", "inactivity_extension", "inactivity_timeout", "id", "issued_for", "key_id", "name", "organization_id", "provider_id", "scopes", "secret_checksum", "updated_at"}
-}
-
-func (a accessKeyTable) Values() []any {
-	return []any{a.CreatedAt, a.DeletedAt, a.ExpiresAt, a.InactivityExtension, a.InactivityTimeout, a.ID, a.IssuedFor, a.KeyID, a.Name, a.OrganizationID, a.ProviderID, a.Scopes, a.SecretChecksum, a.UpdatedAt}
-}
-
-func (a *accessKeyTable) ScanFields() []any {
-	return []any{&a.CreatedAt, &a.DeletedAt, &a.ExpiresAt, &a.InactivityExtension, &a.InactivityTimeout, &a.ID, &a.IssuedFor, &a.KeyID, &a.Name, &a.OrganizationID, &a.ProviderID, &a.Scopes, &a.SecretChecksum, &a.UpdatedAt}
-}
-
 var (
 	ErrAccessKeyExpired        = fmt.Errorf("access key expired")
 	ErrAccessInactivityTimeout = fmt.Errorf("%w: timed out due to inactivity", ErrAccessKeyExpired)
@@ -129,37 +113,71 @@ func UpdateAccessKey(tx WriteTxn, key *models.AccessKey) error {
 	return update(tx, (*accessKeyTable)(key))
 }
 
+// UpdateAccessKeyLastUsed sets the last_used_at, last_used_ip, and
+// last_used_user_agent of the key. Like UpdateIdentityLastSeenAt it does not
+// change updated_at.
+func UpdateAccessKeyLastUsed(tx WriteTxn, key *models.AccessKey) error {
+	stmt := `
+		UPDATE access_keys SET last_used_at = ?, last_used_ip = ?, last_used_user_agent = ?
+		WHERE id = ? AND organization_id = ? AND deleted_at is null
+	`
+	_, err := tx.Exec(stmt, key.LastUsedAt, key.LastUsedIP, key.LastUsedUserAgent, key.ID, key.OrganizationID)
+	return handleError(err)
+}
+
 type ListAccessKeyOptions struct {
 	IncludeExpired bool
-	ByIssuedForID  uid.ID
-	ByName         string
-	Pagination     *Pagination
+	// IncludeExpiredImpersonations instructs ListAccessKeys to also return
+	// expired keys that were created by impersonating the user, so that the
+	// user can see the impersonation after it ends.
+	IncludeExpiredImpersonations bool
+	// ByIDs instructs ListAccessKeys to return only the keys with these IDs.
+	ByIDs         []uid.ID
+	ByIssuedForID uid.ID
+	ByName        string
+	Pagination    *Pagination
 }
 
 func ListAccessKeys(tx ReadTxn, opts ListAccessKeyOptions) ([]models.AccessKey, error) {
+	filter := func(query *querybuilder.Query) error {
+		query.B("INNER JOIN identities")
+		query.B("ON access_keys.issued_for = identities.id")
+		query.B("WHERE access_keys.deleted_at is null AND identities.deleted_at is null")
+		query.B("AND access_keys.organization_id = ?", tx.OrganizationID())
+
+		if !opts.IncludeExpired {
+			// TODO: can we remove the need to check for both the zero value and nil?
+			now, zero := time.Now(), time.Time{}
+			query.B("AND (")
+			if opts.IncludeExpiredImpersonations {
+				query.B("access_keys.impersonated_by != 0 OR")
+			}
+			query.B("((expires_at > ? OR expires_at = ? OR expires_at is null)", now, zero)
+			query.B("AND (inactivity_timeout > ? OR inactivity_timeout = ? OR inactivity_timeout is null)))", now, zero)
+		}
+		if len(opts.ByIDs) > 0 {
+			query.B("AND")
+			querybuilder.In(query, "access_keys.id", opts.ByIDs)
+		}
+		if opts.ByIssuedForID != 0 {
+			query.B("AND issued_for = ?", opts.ByIssuedForID)
+		}
+		if opts.ByName != "" {
+			query.B("AND access_keys.name = ?", opts.ByName)
+		}
+		return nil
+	}
+
 	table := &accessKeyTable{}
 	query := querybuilder.New("SELECT")
 	query.B(columnsForSelect(table))
 	query.B(", identities.name")
-	if opts.Pagination != nil {
+	if opts.Pagination.countTotal() {
 		query.B(", count(*) OVER()")
 	}
-	query.B("FROM access_keys INNER JOIN identities")
-	query.B("ON access_keys.issued_for = identities.id")
-	query.B("WHERE access_keys.deleted_at is null AND identities.deleted_at is null")
-	query.B("AND access_keys.organization_id = ?", tx.OrganizationID())
-
-	if !opts.IncludeExpired {
-		// TODO: can we remove the need to check for both the zero value and nil?
-		now, zero := time.Now(), time.Time{}
-		query.B("AND (expires_at > ? OR expires_at = ? OR expires_at is null)", now, zero)
-		query.B("AND (inactivity_timeout > ? OR inactivity_timeout = ? OR inactivity_timeout is null)", now, zero)
-	}
-	if opts.ByIssuedForID != 0 {
-		query.B("AND issued_for = ?", opts.ByIssuedForID)
-	}
-	if opts.ByName != "" {
-		query.B("AND access_keys.name = ?", opts.ByName)
+	query.B("FROM access_keys")
+	if err := filter(query); err != nil {
+		return nil, err
 	}
 	query.B("ORDER BY access_keys.name ASC")
 	if opts.Pagination != nil {
@@ -170,13 +188,20 @@ func ListAccessKeys(tx ReadTxn, opts ListAccessKeyOptions) ([]models.AccessKey,
 	if err != nil {
 		return nil, err
 	}
-	return scanRows(rows, func(key *models.AccessKey) []any {
+	result, err := scanRows(rows, func(key *models.AccessKey) []any {
 		fields := append((*accessKeyTable)(key).ScanFields(), &key.IssuedForName)
-		if opts.Pagination != nil {
+		if opts.Pagination.countTotal() {
 			fields = append(fields, &opts.Pagination.TotalCount)
 		}
 		return fields
 	})
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.Pagination.countEmptyPage(tx, len(result), table, filter); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
 // GetAccessKeyByKeyID using the keyID. Note that the keyID is globally unique,
@@ -194,6 +219,7 @@ func GetAccessKeyByKeyID(tx ReadTxn, keyID string) (*models.AccessKey, error) {
 	query.B(accessKey.Table())
 	query.B("WHERE deleted_at is null")
 	query.B("AND key_id = ?", keyID)
+	query.B("/* all organizations */")
 
 	err := tx.QueryRow(query.String(), query.Args...).Scan(accessKey.ScanFields()...)
 	if err != nil {
@@ -240,6 +266,8 @@ func GetAccessKey(tx ReadTxn, opts GetAccessKeysOptions) (*models.AccessKey, err
 type DeleteAccessKeysOptions struct {
 	// ByID instructs DeleteAccessKeys to delete the key with this ID.
 	ByID uid.ID
+	// ByIDs instructs DeleteAccessKeys to delete the keys with these IDs.
+	ByIDs []uid.ID
 	// ByIssuedForID instructs DeleteAccessKeys to delete keys issued for this user.
 	ByIssuedForID uid.ID
 	// ByProviderID instructs DeleteAccessKeys to delete keys issued by this
@@ -248,7 +276,7 @@ type DeleteAccessKeysOptions struct {
 }
 
 func DeleteAccessKeys(tx WriteTxn, opts DeleteAccessKeysOptions) error {
-	if opts.ByID == 0 && opts.ByIssuedForID == 0 && opts.ByProviderID == 0 {
+	if opts.ByID == 0 && len(opts.ByIDs) == 0 && opts.ByIssuedForID == 0 && opts.ByProviderID == 0 {
 		return fmt.Errorf("DeleteAccessKeys requires an ID, IssuedForID, or ProviderID")
 	}
 	query := querybuilder.New("UPDATE access_keys")
@@ -258,6 +286,10 @@ func DeleteAccessKeys(tx WriteTxn, opts DeleteAccessKeysOptions) error {
 	if opts.ByID != 0 {
 		query.B("AND id = ?", opts.ByID)
 	}
+	if len(opts.ByIDs) > 0 {
+		query.B("AND")
+		querybuilder.In(query, "id", opts.ByIDs)
+	}
 	if opts.ByIssuedForID != 0 {
 		query.B("AND issued_for = ?", opts.ByIssuedForID)
 	}
@@ -269,8 +301,59 @@ func DeleteAccessKeys(tx WriteTxn, opts DeleteAccessKeysOptions) error {
 	return err
 }
 
+// DefaultClockSkewLeeway is the default value of ValidateAccessKeyOptions.Leeway.
+const DefaultClockSkewLeeway = 30 * time.Second
+
+// ValidateAccessKeyOptions are the options used to check the expiry of an
+// access key.
+type ValidateAccessKeyOptions struct {
+	// Now is the current time. Defaults to time.Now. Tests use it to check
+	// the expiry of keys with a fake clock.
+	Now func() time.Time
+	// Leeway is the amount of time an access key is accepted after its
+	// ExpiresAt or InactivityTimeout, to allow for a small difference between
+	// the clocks of the hosts that issue and check the key.
+	Leeway time.Duration
+}
+
+func (o ValidateAccessKeyOptions) now() time.Time {
+	if o.Now == nil {
+		return time.Now().UTC()
+	}
+	return o.Now().UTC()
+}
+
+// expired returns true if deadline has passed by more than the leeway.
+func (o ValidateAccessKeyOptions) expired(now, deadline time.Time) bool {
+	return now.After(deadline.Add(o.Leeway))
+}
+
 // TODO: move this to access package?
-func ValidateRequestAccessKey(tx *Transaction, authnKey string) (*models.AccessKey, error) {
+func ValidateRequestAccessKey(tx *Transaction, authnKey string, opts ValidateAccessKeyOptions) (*models.AccessKey, error) {
+	t, err := ValidateRequestAccessKeyWithoutExtension(tx, authnKey, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if !t.InactivityTimeout.IsZero() {
+		origTimeout := t.InactivityTimeout
+		t.InactivityTimeout = opts.now().Add(t.InactivityExtension)
+		// Throttle updates when the key is used frequently. Uses the
+		// same value as server.lastSeenUpdateThreshold.
+		if t.InactivityTimeout.Sub(origTimeout) > 2*time.Second {
+			if err := UpdateAccessKey(tx.WithOrgID(t.OrganizationID), t); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return t, nil
+}
+
+// ValidateRequestAccessKeyWithoutExtension checks the secret and the expiry of
+// the access key, like ValidateRequestAccessKey, but does not extend the
+// inactivity timeout of the key.
+func ValidateRequestAccessKeyWithoutExtension(tx *Transaction, authnKey string, opts ValidateAccessKeyOptions) (*models.AccessKey, error) {
 	keyID, secret, ok := strings.Cut(authnKey, ".")
 	if !ok {
 		return nil, fmt.Errorf("invalid access key format")
@@ -280,7 +363,6 @@ func ValidateRequestAccessKey(tx *Transaction, authnKey string) (*models.AccessK
 	if err != nil {
 		return nil, fmt.Errorf("%w: could not get access key from database, it may not exist", err)
 	}
-	tx = tx.WithOrgID(t.OrganizationID)
 
 	sum := secretChecksum(secret)
 
@@ -288,35 +370,47 @@ func ValidateRequestAccessKey(tx *Transaction, authnKey string) (*models.AccessK
 		return nil, fmt.Errorf("access key invalid secret")
 	}
 
-	now := time.Now().UTC()
-	if now.After(t.ExpiresAt) {
+	now := opts.now()
+	if opts.expired(now, t.ExpiresAt) {
 		return nil, ErrAccessKeyExpired
 	}
 
-	if !t.InactivityTimeout.IsZero() {
-		if now.After(t.InactivityTimeout) {
-			return nil, ErrAccessInactivityTimeout
-		}
-
-		origTimeout := t.InactivityTimeout
-		t.InactivityTimeout = now.Add(t.InactivityExtension)
-		// Throttle updates when the key is used frequently. Uses the
-		// same value as server.lastSeenUpdateThreshold.
-		if t.InactivityTimeout.Sub(origTimeout) > 2*time.Second {
-			if err := UpdateAccessKey(tx, t); err != nil {
-				return nil, err
-			}
-		}
+	if !t.InactivityTimeout.IsZero() && opts.expired(now, t.InactivityTimeout) {
+		return nil, ErrAccessInactivityTimeout
 	}
 
 	return t, nil
 }
 
+// ExtendAccessKeyInactivityTimeout moves the inactivity timeout of the access
+// key to InactivityExtension from now. Keys without an inactivity timeout are
+// not modified. Returns ErrAccessInactivityTimeout if the inactivity timeout
+// has already passed, because an expired key can not be extended.
+func ExtendAccessKeyInactivityTimeout(tx WriteTxn, key *models.AccessKey, opts ValidateAccessKeyOptions) error {
+	if key.InactivityTimeout.IsZero() {
+		return nil
+	}
+
+	now := opts.now()
+	if opts.expired(now, key.InactivityTimeout) {
+		return ErrAccessInactivityTimeout
+	}
+	key.InactivityTimeout = now.Add(key.InactivityExtension)
+	return UpdateAccessKey(tx, key)
+}
+
+// impersonationRetention is how long an expired key created by impersonating
+// a user is kept, so that the user can see the impersonation in their sessions.
+const impersonationRetention = 30 * 24 * time.Hour
+
 func RemoveExpiredAccessKeys(tx WriteTxn) error {
+	now := time.Now().UTC()
 	query := querybuilder.New("UPDATE access_keys")
-	query.B("SET deleted_at = ?", time.Now().UTC())
+	query.B("SET deleted_at = ?", now)
 	query.B("WHERE deleted_at is null")
-	query.B("AND expires_at <= ?", time.Now().UTC().Add(-1*time.Hour)) // leave buffer so keys aren't immediately deleted on expiry.
+	query.B("AND expires_at <= ?", now.Add(-1*time.Hour)) // leave buffer so keys aren't immediately deleted on expiry.
+	query.B("AND (impersonated_by = 0 OR expires_at <= ?)", now.Add(-impersonationRetention))
+	query.B("/* all organizations */")
 
 	_, err := tx.Exec(query.String(), query.Args...)
 	return err
@@ -18,7 +18,7 @@ import (
 )
 
 func TestCreateAccessKey(t *testing.T) {
-	runDBTests(t, func(t *testing.T, db *DB) {
+	runDBTestsParallel(t, func(t *testing.T, db *DB) {
 		org := &models.Organization{Name: "something", Domain: "example.com"}
 		assert.NilError(t, CreateOrganization(db, org))
 
@@ -162,7 +162,7 @@ var anyValidUID = cmp.Comparer(func(x, y uid.ID) bool {
 })
 
 // PostgreSQL only has microsecond precision
-var cmpTimeWithDBPrecision = cmpopts.EquateApproxTime(time.Microsecond)
+var cmpTimeWithDBPrecision = cmpopts.EquateApproxTime(timePrecision)
 
 func createAccessKeyWithInactivityTimeout(t *testing.T, db WriteTxn, expiry, timeout time.Duration) (string, *models.AccessKey) {
 	identity := &models.Identity{Name: "Wall-E"}
@@ -183,23 +183,23 @@ func createAccessKeyWithInactivityTimeout(t *testing.T, db WriteTxn, expiry, tim
 }
 
 func TestValidateRequestAccessKey(t *testing.T) {
-	runDBTests(t, func(t *testing.T, db *DB) {
+	runDBTestsParallel(t, func(t *testing.T, db *DB) {
 		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
 		body, _ := createTestAccessKey(t, tx, time.Hour*5)
 
-		_, err := ValidateRequestAccessKey(tx, body)
+		_, err := ValidateRequestAccessKey(tx, body, ValidateAccessKeyOptions{})
 		assert.NilError(t, err)
 
 		random := generate.MathRandom(models.AccessKeySecretLength, generate.CharsetAlphaNumeric)
 		authorization := fmt.Sprintf("%s.%s", strings.Split(body, ".")[0], random)
 
-		_, err = ValidateRequestAccessKey(tx, authorization)
+		_, err = ValidateRequestAccessKey(tx, authorization, ValidateAccessKeyOptions{})
 		assert.Error(t, err, "access key invalid secret")
 	})
 }
 
 func TestDeleteAccessKeys(t *testing.T) {
-	runDBTests(t, func(t *testing.T, db *DB) {
+	runDBTestsParallel(t, func(t *testing.T, db *DB) {
 		provider := &models.Provider{Name: "azure", Kind: models.ProviderKindAzure}
 		otherProvider := &models.Provider{Name: "other", Kind: models.ProviderKindGoogle}
 		createProviders(t, db, provider, otherProvider)
@@ -266,6 +266,28 @@ func TestDeleteAccessKeys(t *testing.T) {
 			assert.DeepEqual(t, remaining, expected, cmpModelByID)
 		})
 
+		t.Run("by ids", func(t *testing.T) {
+			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+			key1 := &models.AccessKey{IssuedFor: otherUser.ID, ProviderID: provider.ID}
+			key2 := &models.AccessKey{IssuedFor: user.ID, ProviderID: provider.ID}
+			toKeep := &models.AccessKey{IssuedFor: user.ID, ProviderID: otherProvider.ID}
+			createAccessKeys(t, tx, key1, key2, toKeep)
+
+			listed, err := ListAccessKeys(tx, ListAccessKeyOptions{ByIDs: []uid.ID{key1.ID, toKeep.ID}})
+			assert.NilError(t, err)
+			assert.Equal(t, len(listed), 2)
+
+			err = DeleteAccessKeys(tx, DeleteAccessKeysOptions{ByIDs: []uid.ID{key1.ID, key2.ID}})
+			assert.NilError(t, err)
+
+			remaining, err := ListAccessKeys(tx, ListAccessKeyOptions{})
+			assert.NilError(t, err)
+			expected := []models.AccessKey{
+				{Model: models.Model{ID: toKeep.ID}},
+			}
+			assert.DeepEqual(t, remaining, expected, cmpModelByID)
+		})
+
 		t.Run("already deleted", func(t *testing.T) {
 			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
 			key1 := &models.AccessKey{
@@ -302,27 +324,140 @@ var cmpModelByID = cmp.Comparer(func(x, y primaryKeyable) bool {
 })
 
 func TestCheckAccessKeyExpired(t *testing.T) {
-	runDBTests(t, func(t *testing.T, db *DB) {
+	runDBTestsParallel(t, func(t *testing.T, db *DB) {
 		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
 		body, _ := createTestAccessKey(t, tx, -1*time.Hour)
 
-		_, err := ValidateRequestAccessKey(tx, body)
+		_, err := ValidateRequestAccessKey(tx, body, ValidateAccessKeyOptions{})
 		assert.ErrorIs(t, err, ErrAccessKeyExpired)
 	})
 }
 
 func TestCheckAccessKeyPastInactivityTimeout(t *testing.T) {
-	runDBTests(t, func(t *testing.T, db *DB) {
+	runDBTestsParallel(t, func(t *testing.T, db *DB) {
 		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
 		body, _ := createAccessKeyWithInactivityTimeout(t, tx, 1*time.Hour, -1*time.Hour)
 
-		_, err := ValidateRequestAccessKey(tx, body)
+		_, err := ValidateRequestAccessKey(tx, body, ValidateAccessKeyOptions{})
 		assert.ErrorIs(t, err, ErrAccessInactivityTimeout)
 	})
 }
 
+func TestValidateRequestAccessKeyWithoutExtension(t *testing.T) {
+	runDBTestsParallel(t, func(t *testing.T, db *DB) {
+		t.Run("success", func(t *testing.T) {
+			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+			body, key := createAccessKeyWithInactivityTimeout(t, tx, time.Hour, time.Minute)
+			key.InactivityExtension = time.Hour
+			assert.NilError(t, UpdateAccessKey(tx, key))
+
+			_, err := ValidateRequestAccessKeyWithoutExtension(tx, body, ValidateAccessKeyOptions{})
+			assert.NilError(t, err)
+
+			actual, err := GetAccessKey(tx, GetAccessKeysOptions{ByID: key.ID})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, actual.InactivityTimeout, key.InactivityTimeout, cmpTimeWithDBPrecision)
+		})
+
+		t.Run("past the inactivity timeout", func(t *testing.T) {
+			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+			body, _ := createAccessKeyWithInactivityTimeout(t, tx, time.Hour, -time.Hour)
+
+			_, err := ValidateRequestAccessKeyWithoutExtension(tx, body, ValidateAccessKeyOptions{})
+			assert.ErrorIs(t, err, ErrAccessInactivityTimeout)
+		})
+	})
+}
+
+func TestExtendAccessKeyInactivityTimeout(t *testing.T) {
+	runDBTestsParallel(t, func(t *testing.T, db *DB) {
+		t.Run("success", func(t *testing.T) {
+			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+			_, key := createAccessKeyWithInactivityTimeout(t, tx, 3*time.Hour, time.Minute)
+			key.InactivityExtension = time.Hour
+
+			assert.NilError(t, ExtendAccessKeyInactivityTimeout(tx, key, ValidateAccessKeyOptions{}))
+			expected := time.Now().Add(time.Hour)
+			assert.DeepEqual(t, key.InactivityTimeout, expected, opt.TimeWithThreshold(time.Second))
+
+			actual, err := GetAccessKey(tx, GetAccessKeysOptions{ByID: key.ID})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, actual.InactivityTimeout, key.InactivityTimeout, cmpTimeWithDBPrecision)
+		})
+
+		t.Run("past the inactivity timeout", func(t *testing.T) {
+			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+			_, key := createAccessKeyWithInactivityTimeout(t, tx, 3*time.Hour, -time.Minute)
+			key.InactivityExtension = time.Hour
+			orig := key.InactivityTimeout
+
+			err := ExtendAccessKeyInactivityTimeout(tx, key, ValidateAccessKeyOptions{})
+			assert.ErrorIs(t, err, ErrAccessInactivityTimeout)
+			assert.Equal(t, key.InactivityTimeout, orig)
+		})
+
+		t.Run("no inactivity timeout", func(t *testing.T) {
+			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+			_, key := createTestAccessKey(t, tx, time.Hour)
+			key.InactivityTimeout = time.Time{}
+
+			assert.NilError(t, ExtendAccessKeyInactivityTimeout(tx, key, ValidateAccessKeyOptions{}))
+			assert.Assert(t, key.InactivityTimeout.IsZero())
+		})
+	})
+}
+
+func TestValidateAccessKey_ClockSkewLeeway(t *testing.T) {
+	leeway := 30 * time.Second
+	optsAt := func(now time.Time) ValidateAccessKeyOptions {
+		return ValidateAccessKeyOptions{
+			Now:    func() time.Time { return now },
+			Leeway: leeway,
+		}
+	}
+
+	runDBTestsParallel(t, func(t *testing.T, db *DB) {
+		t.Run("expires at", func(t *testing.T) {
+			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+			body, key := createTestAccessKey(t, tx, time.Hour)
+
+			_, err := ValidateRequestAccessKey(tx, body, optsAt(key.ExpiresAt.Add(leeway-time.Second)))
+			assert.NilError(t, err)
+
+			_, err = ValidateRequestAccessKey(tx, body, optsAt(key.ExpiresAt.Add(leeway+time.Second)))
+			assert.ErrorIs(t, err, ErrAccessKeyExpired)
+		})
+
+		t.Run("inactivity timeout", func(t *testing.T) {
+			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+			body, key := createAccessKeyWithInactivityTimeout(t, tx, 3*time.Hour, time.Hour)
+
+			_, err := ValidateRequestAccessKeyWithoutExtension(tx, body, optsAt(key.InactivityTimeout.Add(leeway-time.Second)))
+			assert.NilError(t, err)
+
+			_, err = ValidateRequestAccessKeyWithoutExtension(tx, body, optsAt(key.InactivityTimeout.Add(leeway+time.Second)))
+			assert.ErrorIs(t, err, ErrAccessInactivityTimeout)
+		})
+
+		t.Run("extension deadline", func(t *testing.T) {
+			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+			_, key := createAccessKeyWithInactivityTimeout(t, tx, 3*time.Hour, time.Hour)
+			key.InactivityExtension = time.Hour
+			orig := key.InactivityTimeout
+
+			err := ExtendAccessKeyInactivityTimeout(tx, key, optsAt(orig.Add(leeway+time.Second)))
+			assert.ErrorIs(t, err, ErrAccessInactivityTimeout)
+			assert.Equal(t, key.InactivityTimeout, orig)
+
+			now := orig.Add(leeway - time.Second)
+			assert.NilError(t, ExtendAccessKeyInactivityTimeout(tx, key, optsAt(now)))
+			assert.DeepEqual(t, key.InactivityTimeout, now.Add(time.Hour), cmpTimeWithDBPrecision)
+		})
+	})
+}
+
 func TestListAccessKeys(t *testing.T) {
-	runDBTests(t, func(t *testing.T, db *DB) {
+	runDBTestsParallel(t, func(t *testing.T, db *DB) {
 		user := &models.Identity{Name: "tmp@infrahq.com"}
 		otherUser := &models.Identity{Name: "admin@infrahq.com"}
 		createIdentities(t, db, user, otherUser)
@@ -528,6 +663,36 @@ func TestListAccessKeys(t *testing.T) {
 			}
 			assert.DeepEqual(t, page, expectedPage)
 		})
+
+		t.Run("include expired impersonations", func(t *testing.T) {
+			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+			impersonated := &models.AccessKey{
+				Name:           "echo",
+				Model:          models.Model{ID: 10},
+				IssuedFor:      otherUser.ID,
+				ProviderID:     InfraProvider(tx).ID,
+				ExpiresAt:      time.Now().Add(-time.Hour).UTC(),
+				ImpersonatedBy: user.ID,
+				KeyID:          "1234567895",
+			}
+			createAccessKeys(t, tx, impersonated)
+
+			actual, err := ListAccessKeys(tx, ListAccessKeyOptions{
+				ByIssuedForID:                otherUser.ID,
+				IncludeExpiredImpersonations: true,
+			})
+			assert.NilError(t, err)
+
+			expected := []models.AccessKey{
+				{Model: models.Model{ID: 9}, IssuedForName: "admin@infrahq.com"},
+				{Model: models.Model{ID: 10}, IssuedForName: "admin@infrahq.com"},
+			}
+			assert.DeepEqual(t, actual, expected, cmpAccessKeyShallow)
+
+			actual, err = ListAccessKeys(tx, ListAccessKeyOptions{ByIssuedForID: otherUser.ID})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, actual, expected[:1], cmpAccessKeyShallow)
+		})
 	})
 }
 
@@ -549,7 +714,7 @@ func createTestAccessKey(t *testing.T, db WriteTxn, sessionDuration time.Duratio
 }
 
 func TestUpdateAccessKey(t *testing.T) {
-	runDBTests(t, func(t *testing.T, db *DB) {
+	runDBTestsParallel(t, func(t *testing.T, db *DB) {
 		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
 
 		provider := InfraProvider(tx)
@@ -603,8 +768,39 @@ func TestUpdateAccessKey(t *testing.T) {
 	})
 }
 
+func TestUpdateAccessKeyLastUsed(t *testing.T) {
+	runDBTestsParallel(t, func(t *testing.T, db *DB) {
+		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+
+		user := &models.Identity{Name: "lastused@example.com"}
+		assert.NilError(t, CreateIdentity(tx, user))
+
+		key := &models.AccessKey{
+			Name:       "the-key",
+			IssuedFor:  user.ID,
+			ProviderID: InfraProvider(tx).ID,
+			ExpiresAt:  time.Now().Add(time.Hour),
+		}
+		_, err := CreateAccessKey(tx, key)
+		assert.NilError(t, err)
+		updatedAt := key.UpdatedAt
+
+		key.LastUsedAt = time.Date(2023, 1, 27, 10, 0, 0, 0, time.UTC)
+		key.LastUsedIP = "192.0.2.10"
+		key.LastUsedUserAgent = "the-agent/1.0"
+		assert.NilError(t, UpdateAccessKeyLastUsed(tx, key))
+
+		actual, err := GetAccessKey(tx, GetAccessKeysOptions{ByID: key.ID})
+		assert.NilError(t, err)
+		assert.Equal(t, actual.LastUsedAt.UTC(), key.LastUsedAt)
+		assert.Equal(t, actual.LastUsedIP, "192.0.2.10")
+		assert.Equal(t, actual.LastUsedUserAgent, "the-agent/1.0")
+		assert.Equal(t, actual.UpdatedAt.UTC(), updatedAt.UTC())
+	})
+}
+
 func TestGetAccessKey(t *testing.T) {
-	runDBTests(t, func(t *testing.T, db *DB) {
+	runDBTestsParallel(t, func(t *testing.T, db *DB) {
 		user := &models.Identity{Name: "su@example.com"}
 		createIdentities(t, db, user)
 
@@ -675,7 +871,7 @@ func TestGetAccessKey(t *testing.T) {
 }
 
 func TestGetAccessKeyByID(t *testing.T) {
-	runDBTests(t, func(t *testing.T, db *DB) {
+	runDBTestsParallel(t, func(t *testing.T, db *DB) {
 		ak := &models.AccessKey{
 			Name:       "the-key",
 			IssuedFor:  600600,
@@ -714,7 +910,7 @@ func TestGetAccessKeyByID(t *testing.T) {
 }
 
 func TestRemoveExpiredAccessKeys(t *testing.T) {
-	runDBTests(t, func(t *testing.T, db *DB) {
+	runDBTestsParallel(t, func(t *testing.T, db *DB) {
 		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
 		user := &models.Identity{Name: "user@example.com"}
 		createIdentities(t, tx, user)
@@ -736,7 +932,13 @@ func TestRemoveExpiredAccessKeys(t *testing.T) {
 		}
 		ak3.DeletedAt.Valid = true
 		ak3.DeletedAt.Time = time.Date(2022, 1, 2, 3, 4, 5, 600, time.UTC)
-		createAccessKeys(t, tx, ak, ak2, ak3)
+		impersonated := &models.AccessKey{
+			Name:           "impersonated",
+			IssuedFor:      user.ID,
+			ExpiresAt:      time.Now().Add(-2 * time.Hour),
+			ImpersonatedBy: uid.ID(9999),
+		}
+		createAccessKeys(t, tx, ak, ak2, ak3, impersonated)
 
 		err := RemoveExpiredAccessKeys(tx)
 		assert.NilError(t, err)
@@ -747,6 +949,10 @@ func TestRemoveExpiredAccessKeys(t *testing.T) {
 		_, err = GetAccessKey(tx, GetAccessKeysOptions{ByID: ak2.ID})
 		assert.NilError(t, err)
 
+		// impersonation keys are kept after they expire
+		_, err = GetAccessKey(tx, GetAccessKeysOptions{ByID: impersonated.ID})
+		assert.NilError(t, err)
+
 		deletedAt := getAccessKeyDeletedAtByID(t, tx, ak3.ID)
 		assert.DeepEqual(t, deletedAt, ak3.DeletedAt.Time, cmpTimeWithDBPrecision)
 	})
@@ -755,8 +961,8 @@ func TestRemoveExpiredAccessKeys(t *testing.T) {
 func getAccessKeyDeletedAtByID(t *testing.T, tx ReadTxn, id uid.ID) time.Time {
 	t.Helper()
 	var deletedAt time.Time
-	stmt := `SELECT deleted_at FROM access_keys WHERE id = ?`
-	err := tx.QueryRow(stmt, id).Scan(&deletedAt)
+	stmt := `SELECT deleted_at FROM access_keys WHERE id = ? AND organization_id = ?`
+	err := tx.QueryRow(stmt, id, tx.OrganizationID()).Scan(&deletedAt)
 	assert.NilError(t, err)
 	return deletedAt
 }
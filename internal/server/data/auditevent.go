@@ -0,0 +1,197 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/infrahq/infra/internal/server/data/querybuilder"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+type auditEventsTable models.AuditEvent
+
+func (auditEventsTable) Table() string {
+	return "audit_events"
+}
+
+func (a auditEventsTable) Columns() []string {
+	return []string{"action", "actor_id", "actor_name", "created_at", "id", "impersonator_id", "impersonator_name", "metadata", "organization_id", "reason", "request_id", "result", "source_ip", "target_id", "target_name", "target_type"}
+}
+
+func (a auditEventsTable) Values() []any {
+	return []any{a.Action, a.ActorID, a.ActorName, a.CreatedAt, a.ID, a.ImpersonatorID, a.ImpersonatorName, a.Metadata, a.OrganizationID, a.Reason, a.RequestID, a.Result, a.SourceIP, a.TargetID, a.TargetName, a.TargetType}
+}
+
+func (a *auditEventsTable) ScanFields() []any {
+	return []any{&a.Action, &a.ActorID, &a.ActorName, &a.CreatedAt, &a.ID, &a.ImpersonatorID, &a.ImpersonatorName, &a.Metadata, &a.OrganizationID, &a.Reason, &a.RequestID, &a.Result, &a.SourceIP, &a.TargetID, &a.TargetName, &a.TargetType}
+}
+
+func (a *auditEventsTable) OnInsert() error {
+	return (*models.AuditEvent)(a).OnInsert()
+}
+
+// CreateAuditEvent stores an audit event. Audit events are never updated or
+// deleted by the API.
+func CreateAuditEvent(tx WriteTxn, event *models.AuditEvent) error {
+	switch {
+	case event.Action == "":
+		return fmt.Errorf("an action is required")
+	case event.Result == "":
+		return fmt.Errorf("a result is required")
+	}
+	return insert(tx, (*auditEventsTable)(event))
+}
+
+type ListAuditEventsOptions struct {
+	ByActorID   uid.ID
+	ByActorName string
+	// ByAction selects events with this action. When ByAction ends with a *
+	// it selects events with an action that starts with the rest of the
+	// value, for example grant.* selects all the grant actions.
+	ByAction     string
+	ByTargetType string
+	ByTargetID   string
+	// ByTargetName selects events where the name of the target is this
+	// value, or starts with this value followed by a dot. The name of a grant
+	// target is its resource, so production selects the events for grants on
+	// both production and production.namespace.
+	ByTargetName string
+
+	// CreatedAfter and CreatedBefore select events created in the range
+	// [CreatedAfter, CreatedBefore). A zero value does not limit that end of
+	// the range.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+
+	Pagination *Pagination
+}
+
+// ListAuditEvents returns the audit events of the organization of tx, from the
+// most to the least recent.
+func ListAuditEvents(tx ReadTxn, opts ListAuditEventsOptions) ([]models.AuditEvent, error) {
+	table := &auditEventsTable{}
+	query := querybuilder.New("SELECT")
+	query.B(columnsForSelect(table))
+	if opts.Pagination.countTotal() {
+		query.B(", count(*) OVER()")
+	}
+	query.B("FROM audit_events")
+	query.B("WHERE organization_id = ?", tx.OrganizationID())
+
+	if opts.ByActorID != 0 {
+		query.B("AND actor_id = ?", opts.ByActorID)
+	}
+	if opts.ByActorName != "" {
+		query.B("AND actor_name = ?", opts.ByActorName)
+	}
+	if opts.ByAction != "" {
+		if prefix := strings.TrimSuffix(opts.ByAction, "*"); prefix != opts.ByAction {
+			// substr instead of LIKE, so that _ and % in the value are not wildcards
+			query.B("AND substr(action, 1, ?) = ?", len(prefix), prefix)
+		} else {
+			query.B("AND action = ?", opts.ByAction)
+		}
+	}
+	if opts.ByTargetType != "" {
+		query.B("AND target_type = ?", opts.ByTargetType)
+	}
+	if opts.ByTargetID != "" {
+		query.B("AND target_id = ?", opts.ByTargetID)
+	}
+	if opts.ByTargetName != "" {
+		query.B("AND (target_name = ? OR substr(target_name, 1, ?) = ?)",
+			opts.ByTargetName, len(opts.ByTargetName)+1, opts.ByTargetName+".")
+	}
+	if !opts.CreatedAfter.IsZero() {
+		query.B("AND created_at >= ?", opts.CreatedAfter)
+	}
+	if !opts.CreatedBefore.IsZero() {
+		query.B("AND created_at < ?", opts.CreatedBefore)
+	}
+
+	query.B("ORDER BY created_at DESC, id DESC")
+	if opts.Pagination != nil {
+		opts.Pagination.PaginateQuery(query)
+	}
+
+	rows, err := tx.Query(query.String(), query.Args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanRows(rows, func(event *models.AuditEvent) []any {
+		fields := (*auditEventsTable)(event).ScanFields()
+		if opts.Pagination.countTotal() {
+			fields = append(fields, &opts.Pagination.TotalCount)
+		}
+		return fields
+	})
+}
+
+// ListAuditEventRetentions returns the retention period of audit events for
+// each organization that has changed it from the default.
+func ListAuditEventRetentions(tx ReadTxn) (map[uid.ID]time.Duration, error) {
+	rows, err := tx.Query(`
+		SELECT organization_id, audit_event_retention
+		FROM org_settings
+		WHERE audit_event_retention > 0
+		/* all organizations */`)
+	if err != nil {
+		return nil, err
+	}
+	type retention struct {
+		orgID    uid.ID
+		duration time.Duration
+	}
+	items, err := scanRows(rows, func(item *retention) []any {
+		return []any{&item.orgID, &item.duration}
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[uid.ID]time.Duration, len(items))
+	for _, item := range items {
+		result[item.orgID] = item.duration
+	}
+	return result, nil
+}
+
+type PurgeAuditEventsOptions struct {
+	// ByOrganizationID selects the events of a single organization. When zero
+	// the events of every organization are selected, except the
+	// organizations in NotOrganizationIDs.
+	ByOrganizationID   uid.ID
+	NotOrganizationIDs []uid.ID
+
+	// OlderThan selects the events created before this time.
+	OlderThan time.Time
+	// Limit is the maximum number of events deleted.
+	Limit int
+}
+
+// PurgeAuditEvents permanently deletes audit events that are older than the
+// retention period, and returns the number of events deleted. This is the only
+// way audit events are deleted, the API can not update or delete them.
+//
+// Like PurgeSoftDeleted, callers should use a small limit, and commit the
+// transaction before purging the next batch.
+func PurgeAuditEvents(tx WriteTxn, opts PurgeAuditEventsOptions) (int64, error) {
+	query := querybuilder.New("DELETE FROM audit_events WHERE id IN (")
+	query.B("SELECT id FROM audit_events")
+	query.B("WHERE created_at < ?", opts.OlderThan)
+	if opts.ByOrganizationID != 0 {
+		query.B("AND organization_id = ?", opts.ByOrganizationID)
+	} else if len(opts.NotOrganizationIDs) > 0 {
+		query.B("AND organization_id NOT IN")
+		queryInClause(query, opts.NotOrganizationIDs)
+	}
+	query.B("LIMIT ?)", opts.Limit)
+	query.B(allOrganizations)
+
+	res, err := tx.Exec(query.String(), query.Args...)
+	if err != nil {
+		return 0, fmt.Errorf("purge audit events: %w", handleError(err))
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,249 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestCreateAuditEvent(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		t.Run("success", func(t *testing.T) {
+			event := &models.AuditEvent{
+				CreatedAt:  time.Date(2022, 12, 23, 10, 11, 12, 0, time.UTC),
+				ActorID:    uid.ID(1234),
+				ActorName:  "admin@example.com",
+				Action:     "grant.create",
+				TargetType: "grant",
+				TargetID:   "i:1234 view production",
+				TargetName: "production",
+				Metadata:   models.JSONMap{"privilege": "view", "resource": "production"},
+				Result:     models.AuditResultFailure,
+				Reason:     "user not found",
+				RequestID:  "request-id",
+				SourceIP:   "192.0.2.10",
+			}
+			err := CreateAuditEvent(db, event)
+			assert.NilError(t, err)
+			assert.Assert(t, event.ID != 0)
+
+			table := &auditEventsTable{}
+			query := "SELECT " + columnsForSelect(table) + " FROM audit_events WHERE id = ?"
+			err = db.QueryRow(query, event.ID).Scan(table.ScanFields()...)
+			assert.NilError(t, err)
+
+			expected := *event
+			expected.OrganizationID = db.DefaultOrg.ID
+			actual := models.AuditEvent(*table)
+			actual.CreatedAt = actual.CreatedAt.UTC()
+			assert.DeepEqual(t, actual, expected)
+		})
+		t.Run("without metadata", func(t *testing.T) {
+			event := &models.AuditEvent{Action: "login", Result: models.AuditResultSuccess}
+			assert.NilError(t, CreateAuditEvent(db, event))
+
+			events, err := ListAuditEvents(db, ListAuditEventsOptions{ByAction: "login"})
+			assert.NilError(t, err)
+			assert.Equal(t, len(events), 1)
+			assert.DeepEqual(t, events[0].Metadata, models.JSONMap{})
+		})
+		t.Run("missing action", func(t *testing.T) {
+			err := CreateAuditEvent(db, &models.AuditEvent{Result: models.AuditResultFailure})
+			assert.ErrorContains(t, err, "an action is required")
+		})
+		t.Run("missing result", func(t *testing.T) {
+			err := CreateAuditEvent(db, &models.AuditEvent{Action: "login"})
+			assert.ErrorContains(t, err, "a result is required")
+		})
+	})
+}
+
+func TestListAuditEvents(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		otherOrg := &models.Organization{Name: "other", Domain: "other.example.com"}
+		assert.NilError(t, CreateOrganization(db, otherOrg))
+
+		march := func(day int) time.Time {
+			return time.Date(2023, 3, day, 10, 0, 0, 0, time.UTC)
+		}
+		create := func(orgID uid.ID, event models.AuditEvent) models.AuditEvent {
+			t.Helper()
+			event.Result = models.AuditResultSuccess
+			tx := txnForTestCase(t, db, orgID)
+			assert.NilError(t, CreateAuditEvent(tx, &event))
+			assert.NilError(t, tx.Commit())
+			event.OrganizationID = orgID
+			return event
+		}
+
+		orgID := db.DefaultOrg.ID
+		grantProd := create(orgID, models.AuditEvent{
+			CreatedAt: march(2), ActorID: 1, ActorName: "admin@example.com",
+			Action: "grant.create", TargetType: "grant", TargetName: "prod",
+		})
+		grantProdNS := create(orgID, models.AuditEvent{
+			CreatedAt: march(10), ActorID: 2, ActorName: "ops@example.com",
+			Action: "grant.delete", TargetType: "grant", TargetName: "prod.kube-system",
+		})
+		grantProduction := create(orgID, models.AuditEvent{
+			CreatedAt: march(11), ActorID: 1, ActorName: "admin@example.com",
+			Action: "grant.create", TargetType: "grant", TargetName: "production",
+		})
+		grantProdApril := create(orgID, models.AuditEvent{
+			CreatedAt: time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC), ActorID: 1, ActorName: "admin@example.com",
+			Action: "grant.create", TargetType: "grant", TargetName: "prod",
+		})
+		userUpdate := create(orgID, models.AuditEvent{
+			CreatedAt: march(20), ActorID: 1, ActorName: "admin@example.com",
+			Action: "user.update", TargetType: "user", TargetID: "1234", TargetName: "prod@example.com",
+		})
+		// the same action in another org is never returned
+		create(otherOrg.ID, models.AuditEvent{
+			CreatedAt: march(2), ActorID: 1, ActorName: "admin@example.com",
+			Action: "grant.create", TargetType: "grant", TargetName: "prod",
+		})
+
+		cmpEvents := cmpTimeWithDBPrecision
+
+		type testCase struct {
+			name     string
+			opts     ListAuditEventsOptions
+			expected []models.AuditEvent
+		}
+		testCases := []testCase{
+			{
+				name:     "all, most recent first",
+				expected: []models.AuditEvent{grantProdApril, userUpdate, grantProduction, grantProdNS, grantProd},
+			},
+			{
+				name: "grant changes for destination prod in March",
+				opts: ListAuditEventsOptions{
+					ByAction:      "grant.*",
+					ByTargetName:  "prod",
+					CreatedAfter:  time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC),
+					CreatedBefore: time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC),
+				},
+				expected: []models.AuditEvent{grantProdNS, grantProd},
+			},
+			{
+				name:     "by actor",
+				opts:     ListAuditEventsOptions{ByActorID: 2},
+				expected: []models.AuditEvent{grantProdNS},
+			},
+			{
+				name:     "by actor name",
+				opts:     ListAuditEventsOptions{ByActorName: "ops@example.com"},
+				expected: []models.AuditEvent{grantProdNS},
+			},
+			{
+				name:     "by exact action",
+				opts:     ListAuditEventsOptions{ByAction: "grant.delete"},
+				expected: []models.AuditEvent{grantProdNS},
+			},
+			{
+				name:     "action prefix is not a LIKE pattern",
+				opts:     ListAuditEventsOptions{ByAction: "grant_*"},
+				expected: nil,
+			},
+			{
+				name:     "by target",
+				opts:     ListAuditEventsOptions{ByTargetType: "user", ByTargetID: "1234"},
+				expected: []models.AuditEvent{userUpdate},
+			},
+			{
+				name:     "created before",
+				opts:     ListAuditEventsOptions{CreatedBefore: march(10)},
+				expected: []models.AuditEvent{grantProd},
+			},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				actual, err := ListAuditEvents(db, tc.opts)
+				assert.NilError(t, err)
+				for i := range actual {
+					actual[i].CreatedAt = actual[i].CreatedAt.UTC()
+					actual[i].Metadata = nil
+				}
+				assert.DeepEqual(t, actual, tc.expected, cmpEvents)
+			})
+		}
+
+		t.Run("with pagination", func(t *testing.T) {
+			pagination := &Pagination{Page: 2, Limit: 2}
+			actual, err := ListAuditEvents(db, ListAuditEventsOptions{Pagination: pagination})
+			assert.NilError(t, err)
+			assert.Equal(t, len(actual), 2)
+			assert.Equal(t, actual[0].ID, grantProduction.ID)
+			assert.Equal(t, actual[1].ID, grantProdNS.ID)
+			assert.Equal(t, pagination.TotalCount, 5)
+		})
+	})
+}
+
+func TestPurgeAuditEvents(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		otherOrg := &models.Organization{Name: "other", Domain: "other.example.com"}
+		assert.NilError(t, CreateOrganization(db, otherOrg))
+
+		now := time.Now()
+		for _, orgID := range []uid.ID{db.DefaultOrg.ID, otherOrg.ID} {
+			tx := txnForTestCase(t, db, orgID)
+			for _, age := range []time.Duration{time.Hour, 10 * day, 40 * day, 400 * day} {
+				event := &models.AuditEvent{CreatedAt: now.Add(-age), Action: "login", Result: models.AuditResultSuccess}
+				assert.NilError(t, CreateAuditEvent(tx, event))
+			}
+			assert.NilError(t, tx.Commit())
+		}
+
+		tx := txnForTestCase(t, db, otherOrg.ID)
+		assert.NilError(t, UpdateOrgSettings(tx, &models.OrgSettings{AuditEventRetention: 7 * day}))
+		assert.NilError(t, tx.Commit())
+
+		retentions, err := ListAuditEventRetentions(db)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, retentions, map[uid.ID]time.Duration{otherOrg.ID: 7 * day})
+
+		count := func(orgID uid.ID) int {
+			t.Helper()
+			events, err := ListAuditEvents(txnForTestCase(t, db, orgID), ListAuditEventsOptions{})
+			assert.NilError(t, err)
+			return len(events)
+		}
+
+		t.Run("by organization", func(t *testing.T) {
+			deleted, err := PurgeAuditEvents(db, PurgeAuditEventsOptions{
+				ByOrganizationID: otherOrg.ID,
+				OlderThan:        now.Add(-7 * day),
+				Limit:            1,
+			})
+			assert.NilError(t, err)
+			assert.Equal(t, deleted, int64(1), "expected the limit to apply")
+
+			deleted, err = PurgeAuditEvents(db, PurgeAuditEventsOptions{
+				ByOrganizationID: otherOrg.ID,
+				OlderThan:        now.Add(-7 * day),
+				Limit:            10,
+			})
+			assert.NilError(t, err)
+			assert.Equal(t, deleted, int64(2))
+			assert.Equal(t, count(otherOrg.ID), 1)
+			assert.Equal(t, count(db.DefaultOrg.ID), 4)
+		})
+
+		t.Run("excluding organizations", func(t *testing.T) {
+			deleted, err := PurgeAuditEvents(db, PurgeAuditEventsOptions{
+				NotOrganizationIDs: []uid.ID{otherOrg.ID},
+				OlderThan:          now.Add(-365 * day),
+				Limit:              10,
+			})
+			assert.NilError(t, err)
+			assert.Equal(t, deleted, int64(1))
+			assert.Equal(t, count(db.DefaultOrg.ID), 3)
+			assert.Equal(t, count(otherOrg.ID), 1)
+		})
+	})
+}
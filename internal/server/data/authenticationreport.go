@@ -0,0 +1,191 @@
+package data
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/infrahq/infra/internal/server/data/querybuilder"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+type AuthenticationReportOptions struct {
+	// CreatedAfter and CreatedBefore select the events in the range
+	// [CreatedAfter, CreatedBefore).
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+
+	// LoginAction and LockoutAction are the actions of the audit events
+	// recorded for a login and for a lockout.
+	LoginAction   string
+	LockoutAction string
+
+	// Limit is the maximum number of entries in each section of the report.
+	Limit int
+}
+
+// AuthenticationReport is the result of GetAuthenticationReport.
+type AuthenticationReport struct {
+	FailedLogins       int64
+	FailuresByIdentity []AuthenticationReportEntry
+	FailuresBySourceIP []AuthenticationReportEntry
+	NewSourceIPs       []AuthenticationReportEntry
+	Lockouts           []AuthenticationReportEntry
+}
+
+// AuthenticationReportEntry is a row of one section of an
+// AuthenticationReport. Count is the number of events, and First and Last
+// are the times of the oldest and most recent event.
+type AuthenticationReportEntry struct {
+	UserID     uid.ID
+	Name       string
+	SourceIP   string
+	Count      int64
+	Identities int64
+	First      time.Time
+	Last       time.Time
+}
+
+// GetAuthenticationReport aggregates the login and lockout audit events of the
+// organization of tx. Each section is computed by a single aggregate query, so
+// the events are never loaded into memory.
+func GetAuthenticationReport(tx ReadTxn, opts AuthenticationReportOptions) (*AuthenticationReport, error) {
+	report := &AuthenticationReport{}
+
+	query := querybuilder.New("SELECT count(*) FROM audit_events")
+	query.B("WHERE organization_id = ?", tx.OrganizationID())
+	query.B("AND action = ? AND result = ?", opts.LoginAction, models.AuditResultFailure)
+	query.B("AND created_at >= ? AND created_at < ?", opts.CreatedAfter, opts.CreatedBefore)
+	if err := tx.QueryRow(query.String(), query.Args...).Scan(&report.FailedLogins); err != nil {
+		return nil, fmt.Errorf("count failed logins: %w", err)
+	}
+
+	var err error
+	report.FailuresByIdentity, err = failedLoginsByIdentity(tx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed logins by identity: %w", err)
+	}
+	report.FailuresBySourceIP, err = failedLoginsBySourceIP(tx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed logins by source ip: %w", err)
+	}
+	report.NewSourceIPs, err = newLoginSourceIPs(tx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("new source ips: %w", err)
+	}
+	report.Lockouts, err = lockouts(tx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("lockouts: %w", err)
+	}
+	return report, nil
+}
+
+// failedLoginsByIdentity counts the failed logins for each name that was used
+// to login. Logins that failed before a name was known, for example an
+// invalid access key, are only counted by source IP.
+func failedLoginsByIdentity(tx ReadTxn, opts AuthenticationReportOptions) ([]AuthenticationReportEntry, error) {
+	query := querybuilder.New("SELECT actor_name, count(*), min(created_at), max(created_at)")
+	query.B("FROM audit_events")
+	query.B("WHERE organization_id = ?", tx.OrganizationID())
+	query.B("AND action = ? AND result = ?", opts.LoginAction, models.AuditResultFailure)
+	query.B("AND created_at >= ? AND created_at < ?", opts.CreatedAfter, opts.CreatedBefore)
+	query.B("AND actor_name != ''")
+	query.B("GROUP BY actor_name")
+	query.B("ORDER BY count(*) DESC, actor_name")
+	query.B("LIMIT ?", opts.Limit)
+
+	rows, err := tx.Query(query.String(), query.Args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanRows(rows, func(entry *AuthenticationReportEntry) []any {
+		return []any{&entry.Name, &entry.Count, (*aggregateTime)(&entry.First), (*aggregateTime)(&entry.Last)}
+	})
+}
+
+// failedLoginsBySourceIP counts the failed logins from each client address,
+// and the number of different names used to login from the address.
+func failedLoginsBySourceIP(tx ReadTxn, opts AuthenticationReportOptions) ([]AuthenticationReportEntry, error) {
+	query := querybuilder.New("SELECT source_ip, count(*), count(DISTINCT nullif(actor_name, '')), min(created_at), max(created_at)")
+	query.B("FROM audit_events")
+	query.B("WHERE organization_id = ?", tx.OrganizationID())
+	query.B("AND action = ? AND result = ?", opts.LoginAction, models.AuditResultFailure)
+	query.B("AND created_at >= ? AND created_at < ?", opts.CreatedAfter, opts.CreatedBefore)
+	query.B("AND source_ip != ''")
+	query.B("GROUP BY source_ip")
+	query.B("ORDER BY count(*) DESC, source_ip")
+	query.B("LIMIT ?", opts.Limit)
+
+	rows, err := tx.Query(query.String(), query.Args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanRows(rows, func(entry *AuthenticationReportEntry) []any {
+		return []any{&entry.SourceIP, &entry.Count, &entry.Identities, (*aggregateTime)(&entry.First), (*aggregateTime)(&entry.Last)}
+	})
+}
+
+// newLoginSourceIPs returns the addresses that each user logged in from in the
+// period, and had not logged in from before the period. Only the events that
+// are still retained are used to decide if an address is new.
+func newLoginSourceIPs(tx ReadTxn, opts AuthenticationReportOptions) ([]AuthenticationReportEntry, error) {
+	query := querybuilder.New("SELECT e.actor_id, max(e.actor_name), e.source_ip, count(*), min(e.created_at), max(e.created_at)")
+	query.B("FROM audit_events AS e")
+	query.B("WHERE e.organization_id = ?", tx.OrganizationID())
+	query.B("AND e.action = ? AND e.result = ?", opts.LoginAction, models.AuditResultSuccess)
+	query.B("AND e.created_at >= ? AND e.created_at < ?", opts.CreatedAfter, opts.CreatedBefore)
+	query.B("AND e.actor_id != 0 AND e.source_ip != ''")
+	query.B("AND NOT EXISTS (")
+	query.B("SELECT 1 FROM audit_events AS prev")
+	query.B("WHERE prev.organization_id = e.organization_id")
+	query.B("AND prev.action = e.action AND prev.result = e.result")
+	query.B("AND prev.actor_id = e.actor_id AND prev.source_ip = e.source_ip")
+	query.B("AND prev.created_at < ?)", opts.CreatedAfter)
+	query.B("GROUP BY e.actor_id, e.source_ip")
+	query.B("ORDER BY min(e.created_at), e.actor_id, e.source_ip")
+	query.B("LIMIT ?", opts.Limit)
+
+	rows, err := tx.Query(query.String(), query.Args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanRows(rows, func(entry *AuthenticationReportEntry) []any {
+		return []any{&entry.UserID, &entry.Name, &entry.SourceIP, &entry.Count, (*aggregateTime)(&entry.First), (*aggregateTime)(&entry.Last)}
+	})
+}
+
+// lockouts counts the lockouts of each user. The target of a lockout event is
+// the user that was locked out.
+func lockouts(tx ReadTxn, opts AuthenticationReportOptions) ([]AuthenticationReportEntry, error) {
+	query := querybuilder.New("SELECT target_id, max(actor_name), count(*), min(created_at), max(created_at)")
+	query.B("FROM audit_events")
+	query.B("WHERE organization_id = ?", tx.OrganizationID())
+	query.B("AND action = ?", opts.LockoutAction)
+	query.B("AND created_at >= ? AND created_at < ?", opts.CreatedAfter, opts.CreatedBefore)
+	query.B("GROUP BY target_id")
+	query.B("ORDER BY count(*) DESC, max(created_at) DESC")
+	query.B("LIMIT ?", opts.Limit)
+
+	rows, err := tx.Query(query.String(), query.Args...)
+	if err != nil {
+		return nil, err
+	}
+	type lockout struct {
+		targetID string
+		entry    AuthenticationReportEntry
+	}
+	items, err := scanRows(rows, func(item *lockout) []any {
+		return []any{&item.targetID, &item.entry.Name, &item.entry.Count, (*aggregateTime)(&item.entry.First), (*aggregateTime)(&item.entry.Last)}
+	})
+	if err != nil {
+		return nil, err
+	}
+	var result []AuthenticationReportEntry
+	for _, item := range items {
+		// the target is the ID of the user, but a malformed ID should not
+		// prevent the report from being read
+		item.entry.UserID, _ = uid.Parse([]byte(item.targetID))
+		result = append(result, item.entry)
+	}
+	return result, nil
+}
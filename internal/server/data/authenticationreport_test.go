@@ -0,0 +1,131 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestGetAuthenticationReport(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		otherOrg := &models.Organization{Name: "other", Domain: "other.example.com"}
+		assert.NilError(t, CreateOrganization(db, otherOrg))
+
+		start := time.Date(2023, 2, 6, 0, 0, 0, 0, time.UTC)
+		end := start.Add(7 * 24 * time.Hour)
+		alice, bob := uid.ID(1001), uid.ID(1002)
+
+		event := func(tx WriteTxn, at time.Time, action string, actorID uid.ID, name, ip, result string) {
+			t.Helper()
+			e := &models.AuditEvent{
+				CreatedAt: at,
+				ActorID:   actorID,
+				ActorName: name,
+				Action:    action,
+				SourceIP:  ip,
+				Result:    result,
+			}
+			if action == "user.lockout" {
+				e.TargetType = "user"
+				e.TargetID = actorID.String()
+				e.ActorID = 0
+			}
+			assert.NilError(t, CreateAuditEvent(tx, e))
+		}
+		failure := func(at time.Time, name, ip string) {
+			t.Helper()
+			event(db, at, "login", 0, name, ip, models.AuditResultFailure)
+		}
+		success := func(at time.Time, actorID uid.ID, name, ip string) {
+			t.Helper()
+			event(db, at, "login", actorID, name, ip, models.AuditResultSuccess)
+		}
+
+		// before the period
+		failure(start.Add(-time.Hour), "alice@example.com", "192.0.2.1")
+		success(start.Add(-48*time.Hour), alice, "alice@example.com", "192.0.2.1")
+		success(start.Add(-48*time.Hour), bob, "bob@example.com", "192.0.2.2")
+
+		// failed logins in the period
+		failure(start, "alice@example.com", "192.0.2.1")
+		failure(start.Add(time.Hour), "alice@example.com", "198.51.100.7")
+		failure(start.Add(2*time.Hour), "alice@example.com", "198.51.100.7")
+		failure(start.Add(3*time.Hour), "mallory@example.com", "198.51.100.7")
+		failure(start.Add(4*time.Hour), "", "203.0.113.9") // an invalid access key
+
+		// lockouts in the period
+		event(db, start.Add(2*time.Hour), "user.lockout", alice, "alice@example.com", "198.51.100.7", models.AuditResultSuccess)
+		event(db, start.Add(26*time.Hour), "user.lockout", alice, "alice@example.com", "198.51.100.7", models.AuditResultSuccess)
+
+		// successful logins in the period
+		success(start.Add(5*time.Hour), alice, "alice@example.com", "192.0.2.1") // not new
+		success(start.Add(6*time.Hour), alice, "alice@example.com", "203.0.113.50")
+		success(start.Add(30*time.Hour), alice, "alice@example.com", "203.0.113.50")
+		success(start.Add(7*time.Hour), bob, "bob@example.com", "192.0.2.1") // new for bob
+
+		// after the period
+		failure(end, "alice@example.com", "192.0.2.1")
+		success(end, bob, "bob@example.com", "203.0.113.99")
+
+		// another organization
+		tx := txnForTestCase(t, db, otherOrg.ID)
+		event(tx, start.Add(time.Hour), "login", 0, "alice@example.com", "192.0.2.1", models.AuditResultFailure)
+		event(tx, start.Add(time.Hour), "login", alice, "alice@example.com", "203.0.113.77", models.AuditResultSuccess)
+		assert.NilError(t, tx.Commit())
+
+		opts := AuthenticationReportOptions{
+			CreatedAfter:  start,
+			CreatedBefore: end,
+			LoginAction:   "login",
+			LockoutAction: "user.lockout",
+			Limit:         10,
+		}
+		report, err := GetAuthenticationReport(db, opts)
+		assert.NilError(t, err)
+
+		expected := &AuthenticationReport{
+			FailedLogins: 5,
+			FailuresByIdentity: []AuthenticationReportEntry{
+				{Name: "alice@example.com", Count: 3, First: start, Last: start.Add(2 * time.Hour)},
+				{Name: "mallory@example.com", Count: 1, First: start.Add(3 * time.Hour), Last: start.Add(3 * time.Hour)},
+			},
+			FailuresBySourceIP: []AuthenticationReportEntry{
+				{SourceIP: "198.51.100.7", Count: 3, Identities: 2, First: start.Add(time.Hour), Last: start.Add(3 * time.Hour)},
+				{SourceIP: "192.0.2.1", Count: 1, Identities: 1, First: start, Last: start},
+				{SourceIP: "203.0.113.9", Count: 1, Identities: 0, First: start.Add(4 * time.Hour), Last: start.Add(4 * time.Hour)},
+			},
+			NewSourceIPs: []AuthenticationReportEntry{
+				{UserID: alice, Name: "alice@example.com", SourceIP: "203.0.113.50", Count: 2, First: start.Add(6 * time.Hour), Last: start.Add(30 * time.Hour)},
+				{UserID: bob, Name: "bob@example.com", SourceIP: "192.0.2.1", Count: 1, First: start.Add(7 * time.Hour), Last: start.Add(7 * time.Hour)},
+			},
+			Lockouts: []AuthenticationReportEntry{
+				{UserID: alice, Name: "alice@example.com", Count: 2, First: start.Add(2 * time.Hour), Last: start.Add(26 * time.Hour)},
+			},
+		}
+		assert.DeepEqual(t, report, expected, cmpTimeWithDBPrecision)
+
+		t.Run("limit", func(t *testing.T) {
+			opts := opts
+			opts.Limit = 1
+			report, err := GetAuthenticationReport(db, opts)
+			assert.NilError(t, err)
+			assert.Equal(t, report.FailedLogins, int64(5))
+			assert.Equal(t, len(report.FailuresByIdentity), 1)
+			assert.Equal(t, len(report.FailuresBySourceIP), 1)
+			assert.Equal(t, len(report.NewSourceIPs), 1)
+		})
+
+		t.Run("empty period", func(t *testing.T) {
+			opts := opts
+			opts.CreatedAfter = end.Add(time.Hour)
+			opts.CreatedBefore = end.Add(2 * time.Hour)
+			report, err := GetAuthenticationReport(db, opts)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, report, &AuthenticationReport{})
+		})
+	})
+}
@@ -0,0 +1,249 @@
+package data
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/infrahq/infra/internal/lru"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+// defaultReadCacheTTL limits how long a cached row can be stale when a write
+// does not invalidate it, for example when the row is written by another
+// process.
+const defaultReadCacheTTL = 30 * time.Second
+
+// readCacheSize is the maximum number of rows in the readCache. Each
+// organization uses one entry for each cached table.
+const readCacheSize = 20_000
+
+// readCacheName identifies the readCache in the labels of its metrics.
+const readCacheName = "db-reads"
+
+// readCache stores rows that are read by almost every request, and rarely
+// change, so that they are not queried from the database every time. Entries
+// are keyed by table and organization, and are invalidated by the functions
+// that write those rows. A nil readCache caches nothing.
+type readCache struct {
+	entries *lru.Cache[cacheKey, any]
+	// now is the clock of entries. It is a field so that tests can use a fake
+	// clock.
+	now func() time.Time
+
+	mu sync.Mutex
+	// generation is incremented by every invalidation, so that a value read
+	// before an invalidation is not stored after it.
+	generation uint64
+}
+
+type cacheKey struct {
+	table string
+	orgID uid.ID
+}
+
+// CacheStats describes the entries of a cache, and how often values were
+// found in it.
+type CacheStats struct {
+	Entries int
+	Hits    int64
+	Misses  int64
+	// Oldest is the time the oldest entry was stored, or the zero value when
+	// the cache is empty.
+	Oldest time.Time
+}
+
+func newReadCache(ttl time.Duration) *readCache {
+	c := &readCache{now: time.Now}
+	c.entries = lru.New[cacheKey, any](lru.Options{
+		Name:       readCacheName,
+		MaxEntries: readCacheSize,
+		MaxAge:     ttl,
+		Now:        func() time.Time { return c.now() },
+	})
+	return c
+}
+
+// lookup returns the cached value for key. The generation must be passed to
+// store when the value is not in the cache.
+func (c *readCache) lookup(key cacheKey) (value any, ok bool, generation uint64) {
+	// the generation is read before the value, so that an invalidation
+	// between the two prevents the value from being stored.
+	c.mu.Lock()
+	generation = c.generation
+	c.mu.Unlock()
+
+	value, ok = c.entries.Get(key)
+	return value, ok, generation
+}
+
+// store saves value in the cache, unless an entry was invalidated since
+// generation was returned by lookup.
+func (c *readCache) store(key cacheKey, value any, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	c.entries.Add(key, value)
+}
+
+func (c *readCache) invalidate(key cacheKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.entries.Remove(key)
+}
+
+func (c *readCache) stats() CacheStats {
+	stats := c.entries.Stats()
+	return CacheStats{
+		Entries: stats.Entries,
+		Hits:    stats.Hits,
+		Misses:  stats.Misses,
+		Oldest:  stats.Oldest,
+	}
+}
+
+func (c *readCache) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.entries.Purge()
+}
+
+// CacheStats returns the stats of the cache of rows read by InfraProvider and
+// GetOrgSettings.
+func (d *DB) CacheStats() CacheStats {
+	if d.cache == nil {
+		return CacheStats{}
+	}
+	return d.cache.stats()
+}
+
+// CacheMetrics returns the collector of the metrics of the cache of rows read
+// by InfraProvider and GetOrgSettings, or nil if the DB has no cache.
+func (d *DB) CacheMetrics() prometheus.Collector {
+	if d.cache == nil {
+		return nil
+	}
+	return d.cache.entries
+}
+
+// FlushCache removes every entry from the cache of rows read by InfraProvider
+// and GetOrgSettings, so that they are read from the database again.
+func (d *DB) FlushCache() {
+	if d.cache != nil {
+		d.cache.flush()
+	}
+}
+
+// txnCache is the readCache of a Transaction. It is shared by all the copies of
+// a Transaction created by WithOrgID.
+type txnCache struct {
+	cache *readCache
+	// fromReplica is true when the transaction reads from a read replica. The
+	// replica may be behind the primary, so values read from it are not stored.
+	fromReplica bool
+
+	mu sync.Mutex
+	// written are the keys of rows written by the transaction. The cache is
+	// bypassed for these rows, because the transaction must read its own
+	// uncommitted writes.
+	written map[cacheKey]struct{}
+}
+
+// markWritten records that the transaction wrote the rows of key, and returns
+// false if they were already written.
+func (t *txnCache) markWritten(key cacheKey) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.written[key]; ok {
+		return false
+	}
+	if t.written == nil {
+		t.written = make(map[cacheKey]struct{})
+	}
+	t.written[key] = struct{}{}
+	return true
+}
+
+func (t *txnCache) hasWritten(key cacheKey) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.written[key]
+	return ok
+}
+
+// cacheOf returns the readCache to use for reading the rows of key with tx, or
+// nil if the cache should be bypassed. canStore is false when values read with
+// tx must not be stored in the cache.
+func cacheOf(tx ReadTxn, key cacheKey) (cache *readCache, canStore bool) {
+	switch tx := tx.(type) {
+	case *DB:
+		return tx.cache, true
+	case *Transaction:
+		if tx.cache == nil || tx.cache.hasWritten(key) {
+			return nil, false
+		}
+		return tx.cache.cache, !tx.cache.fromReplica
+	default:
+		return nil, false
+	}
+}
+
+// cachedRead returns the value of key from the cache, or calls read and stores
+// the value it returns. Errors are not cached. clone is used to copy values in
+// and out of the cache, so that callers can not modify a cached value.
+func cachedRead[T any](tx ReadTxn, key cacheKey, clone func(T) T, read func() (T, error)) (T, error) {
+	cache, canStore := cacheOf(tx, key)
+	if cache == nil {
+		return read()
+	}
+
+	cached, ok, generation := cache.lookup(key)
+	if ok {
+		return clone(cached.(T)), nil // nolint:forcetypeassert
+	}
+
+	value, err := read()
+	if err != nil {
+		return value, err
+	}
+	if canStore {
+		cache.store(key, clone(value), generation)
+	}
+	return value, nil
+}
+
+func cloneStrings(s models.CommaSeparatedStrings) models.CommaSeparatedStrings {
+	if s == nil {
+		return nil
+	}
+	return append(models.CommaSeparatedStrings{}, s...)
+}
+
+// invalidateCache removes the cached rows of key. When tx is a Transaction the
+// rows are also invalidated when the transaction commits, so that a value read
+// by another request before the commit is not left in the cache.
+func invalidateCache(tx ReadTxn, key cacheKey) {
+	switch tx := tx.(type) {
+	case *DB:
+		if tx.cache != nil {
+			tx.cache.invalidate(key)
+		}
+	case *Transaction:
+		if tx.cache == nil {
+			return
+		}
+		tx.cache.cache.invalidate(key)
+		if tx.cache.markWritten(key) {
+			cache := tx.cache.cache
+			tx.OnCommit(func() {
+				cache.invalidate(key)
+			})
+		}
+	}
+}
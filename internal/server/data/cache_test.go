@@ -0,0 +1,259 @@
+package data
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+func setupReadCache(t *testing.T, db *DB) *time.Time {
+	t.Helper()
+	now := time.Now()
+	db.cache = newReadCache(time.Minute)
+	db.cache.now = func() time.Time {
+		return now
+	}
+	return &now
+}
+
+func TestGetOrgSettings_Cache(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		now := setupReadCache(t, db)
+		assert.NilError(t, UpdateOrgSettings(db, &models.OrgSettings{RateLimit: 10}))
+
+		setRateLimit := func(t *testing.T, limit int) {
+			t.Helper()
+			_, err := db.Exec("UPDATE org_settings SET rate_limit = ? WHERE organization_id = ?",
+				limit, db.DefaultOrg.ID)
+			assert.NilError(t, err)
+		}
+		getRateLimit := func(t *testing.T, tx ReadTxn) int {
+			t.Helper()
+			settings, err := GetOrgSettings(tx)
+			assert.NilError(t, err)
+			return settings.RateLimit
+		}
+
+		t.Run("hit", func(t *testing.T) {
+			assert.Equal(t, getRateLimit(t, db), 10)
+
+			setRateLimit(t, 20)
+			assert.Equal(t, getRateLimit(t, db), 10)
+		})
+
+		t.Run("cached value can not be modified by callers", func(t *testing.T) {
+			settings, err := GetOrgSettings(db)
+			assert.NilError(t, err)
+			settings.RateLimit = 1000
+
+			assert.Equal(t, getRateLimit(t, db), 10)
+		})
+
+		t.Run("ttl expiry", func(t *testing.T) {
+			*now = now.Add(time.Minute + time.Second)
+			assert.Equal(t, getRateLimit(t, db), 20)
+		})
+
+		t.Run("invalidation on write", func(t *testing.T) {
+			assert.Equal(t, getRateLimit(t, db), 20)
+
+			tx, err := db.Begin(context.Background(), nil)
+			assert.NilError(t, err)
+			defer tx.Rollback() // nolint:errcheck
+			tx = tx.WithOrgID(db.DefaultOrg.ID)
+
+			assert.NilError(t, UpdateOrgSettings(tx, &models.OrgSettings{RateLimit: 30}))
+			// the transaction reads its own write
+			assert.Equal(t, getRateLimit(t, tx), 30)
+			// other requests read the committed value
+			assert.Equal(t, getRateLimit(t, db), 20)
+
+			assert.NilError(t, tx.Commit())
+			assert.Equal(t, getRateLimit(t, db), 30)
+		})
+	})
+}
+
+func TestInfraProvider_Cache(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		now := setupReadCache(t, db)
+
+		setAuthURL := func(t *testing.T, authURL string) {
+			t.Helper()
+			_, err := db.Exec("UPDATE providers SET auth_url = ? WHERE organization_id = ? AND kind = ?",
+				authURL, db.DefaultOrg.ID, models.ProviderKindInfra)
+			assert.NilError(t, err)
+		}
+
+		t.Run("hit", func(t *testing.T) {
+			setAuthURL(t, "https://first.example.com")
+			assert.Equal(t, InfraProvider(db).AuthURL, "https://first.example.com")
+
+			setAuthURL(t, "https://second.example.com")
+			assert.Equal(t, InfraProvider(db).AuthURL, "https://first.example.com")
+		})
+
+		t.Run("ttl expiry", func(t *testing.T) {
+			*now = now.Add(time.Minute + time.Second)
+			assert.Equal(t, InfraProvider(db).AuthURL, "https://second.example.com")
+		})
+
+		t.Run("invalidation on write", func(t *testing.T) {
+			tx, err := db.Begin(context.Background(), nil)
+			assert.NilError(t, err)
+			defer tx.Rollback() // nolint:errcheck
+			tx = tx.WithOrgID(db.DefaultOrg.ID)
+
+			provider := InfraProvider(tx)
+			provider.AuthURL = "https://third.example.com"
+			assert.NilError(t, UpdateProvider(tx, provider))
+			assert.Equal(t, InfraProvider(tx).AuthURL, "https://third.example.com")
+			assert.Equal(t, InfraProvider(db).AuthURL, "https://second.example.com")
+
+			assert.NilError(t, tx.Commit())
+			assert.Equal(t, InfraProvider(db).AuthURL, "https://third.example.com")
+		})
+
+		t.Run("isolated between organizations", func(t *testing.T) {
+			tx, err := db.Begin(context.Background(), nil)
+			assert.NilError(t, err)
+			defer tx.Rollback() // nolint:errcheck
+
+			otherOrg := &models.Organization{Name: "other", Domain: "other.example.org"}
+			assert.NilError(t, CreateOrganization(tx, otherOrg))
+			otherTx := tx.WithOrgID(otherOrg.ID)
+
+			other := InfraProvider(otherTx)
+			assert.Equal(t, other.OrganizationID, otherOrg.ID)
+			assert.Equal(t, InfraProvider(db).AuthURL, "https://third.example.com")
+
+			other.AuthURL = "https://other.example.com"
+			assert.NilError(t, UpdateProvider(otherTx, other))
+			assert.Equal(t, InfraProvider(otherTx).AuthURL, "https://other.example.com")
+			assert.Equal(t, InfraProvider(tx.WithOrgID(db.DefaultOrg.ID)).AuthURL, "https://third.example.com")
+			assert.Equal(t, InfraProvider(db).AuthURL, "https://third.example.com")
+		})
+
+		t.Run("refreshed after the provider is recreated", func(t *testing.T) {
+			previous := InfraProvider(db)
+
+			tx, err := db.Begin(context.Background(), nil)
+			assert.NilError(t, err)
+			defer tx.Rollback() // nolint:errcheck
+			tx = tx.WithOrgID(db.DefaultOrg.ID)
+
+			assert.NilError(t, DeleteProviders(tx, DeleteProvidersOptions{ByID: previous.ID}))
+			recreated := &models.Provider{
+				Name: models.InternalInfraProviderName,
+				Kind: models.ProviderKindInfra,
+			}
+			assert.NilError(t, CreateProvider(tx, recreated))
+			assert.Equal(t, InfraProvider(tx).ID, recreated.ID)
+			assert.Equal(t, InfraProvider(db).ID, previous.ID)
+
+			assert.NilError(t, tx.Commit())
+			assert.Equal(t, InfraProvider(db).ID, recreated.ID)
+		})
+	})
+}
+
+// BenchmarkCreateAccessKeys_InfraProvider compares issuing 1000 access keys,
+// which looks up the infra provider for every key, with and without the cache.
+func BenchmarkCreateAccessKeys_InfraProvider(b *testing.B) {
+	db := setupDB(b)
+	user := &models.Identity{Name: "bench@example.com"}
+	assert.NilError(b, CreateIdentity(db, user))
+
+	run := func(b *testing.B, cache *readCache) {
+		db.cache = cache
+		for n := 0; n < b.N; n++ {
+			b.StopTimer()
+			tx, err := db.Begin(context.Background(), nil)
+			assert.NilError(b, err)
+			tx = tx.WithOrgID(db.DefaultOrg.ID)
+			b.StartTimer()
+
+			for i := 0; i < 1000; i++ {
+				key := &models.AccessKey{
+					IssuedFor:  user.ID,
+					ProviderID: InfraProvider(tx).ID,
+					ExpiresAt:  time.Now().Add(time.Hour),
+				}
+				_, err := CreateAccessKey(tx, key)
+				assert.NilError(b, err)
+			}
+
+			b.StopTimer()
+			assert.NilError(b, tx.Rollback())
+			b.StartTimer()
+		}
+	}
+
+	b.Run("without cache", func(b *testing.B) {
+		run(b, nil)
+	})
+	b.Run("with cache", func(b *testing.B) {
+		run(b, newReadCache(defaultReadCacheTTL))
+	})
+}
+
+func TestReadCache_StoreAfterInvalidate(t *testing.T) {
+	cache := newReadCache(time.Minute)
+	key := cacheKey{table: "org_settings", orgID: 1}
+
+	_, ok, generation := cache.lookup(key)
+	assert.Assert(t, !ok)
+
+	// a write is invalidated while the value is being read
+	cache.invalidate(key)
+	cache.store(key, "stale", generation)
+
+	_, ok, _ = cache.lookup(key)
+	assert.Assert(t, !ok, "expected value read before invalidate to not be stored")
+}
+
+func TestReadCache_StatsAndFlush(t *testing.T) {
+	cache := newReadCache(time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time {
+		return now
+	}
+	first := cacheKey{table: "org_settings", orgID: 1}
+	second := cacheKey{table: "providers", orgID: 1}
+
+	assert.DeepEqual(t, cache.stats(), CacheStats{})
+
+	_, _, generation := cache.lookup(first)
+	cache.store(first, "first", generation)
+	stored := now
+
+	now = now.Add(10 * time.Second)
+	_, _, generation = cache.lookup(second)
+	cache.store(second, "second", generation)
+	cache.lookup(first)
+
+	expected := CacheStats{Entries: 2, Hits: 1, Misses: 2, Oldest: stored}
+	assert.DeepEqual(t, cache.stats(), expected)
+
+	t.Run("expired entries are not counted", func(t *testing.T) {
+		now = stored.Add(time.Minute + time.Second)
+		expected := CacheStats{Entries: 1, Hits: 1, Misses: 2, Oldest: stored.Add(10 * time.Second)}
+		assert.DeepEqual(t, cache.stats(), expected)
+	})
+
+	t.Run("flush", func(t *testing.T) {
+		_, _, generation := cache.lookup(first)
+		cache.flush()
+		// a value read before the flush is not stored
+		cache.store(first, "stale", generation)
+
+		expected := CacheStats{Hits: 1, Misses: 3}
+		assert.DeepEqual(t, cache.stats(), expected)
+		_, ok, _ := cache.lookup(second)
+		assert.Assert(t, !ok)
+	})
+}
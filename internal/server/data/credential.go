@@ -16,15 +16,15 @@ func (credentialsTable) Table() string {
 }
 
 func (c credentialsTable) Columns() []string {
-	return []string{"created_at", "deleted_at", "id", "identity_id", "one_time_password", "organization_id", "password_hash", "updated_at"}
+	return []string{"created_at", "deleted_at", "failed_login_attempts", "id", "identity_id", "last_failed_login_at", "locked_until", "one_time_password", "one_time_password_expires_at", "organization_id", "password_hash", "updated_at"}
 }
 
 func (c credentialsTable) Values() []any {
-	return []any{c.CreatedAt, c.DeletedAt, c.ID, c.IdentityID, c.OneTimePassword, c.OrganizationID, c.PasswordHash, c.UpdatedAt}
+	return []any{c.CreatedAt, c.DeletedAt, c.FailedLoginAttempts, c.ID, c.IdentityID, c.LastFailedLoginAt, c.LockedUntil, c.OneTimePassword, c.OneTimePasswordExpiresAt, c.OrganizationID, c.PasswordHash, c.UpdatedAt}
 }
 
 func (c *credentialsTable) ScanFields() []any {
-	return []any{&c.CreatedAt, &c.DeletedAt, &c.ID, &c.IdentityID, &c.OneTimePassword, &c.OrganizationID, &c.PasswordHash, &c.UpdatedAt}
+	return []any{&c.CreatedAt, &c.DeletedAt, &c.FailedLoginAttempts, &c.ID, &c.IdentityID, &c.LastFailedLoginAt, &c.LockedUntil, &c.OneTimePassword, &c.OneTimePasswordExpiresAt, &c.OrganizationID, &c.PasswordHash, &c.UpdatedAt}
 }
 
 func validateCredential(c *models.Credential) error {
@@ -71,6 +71,24 @@ func GetCredentialByUserID(tx ReadTxn, userID uid.ID) (*models.Credential, error
 	return (*models.Credential)(&credential), nil
 }
 
+// UpdateCredentialLoginAttempts saves the failed login fields, and the expiry
+// of the one-time password, of the credential without changing the password.
+func UpdateCredentialLoginAttempts(tx WriteTxn, credential *models.Credential) error {
+	stmt := `
+		UPDATE credentials
+		SET failed_login_attempts = ?, last_failed_login_at = ?, locked_until = ?, one_time_password_expires_at = ?
+		WHERE id = ? AND organization_id = ? AND deleted_at is NULL`
+
+	_, err := tx.Exec(stmt,
+		credential.FailedLoginAttempts,
+		credential.LastFailedLoginAt,
+		credential.LockedUntil,
+		credential.OneTimePasswordExpiresAt,
+		credential.ID,
+		tx.OrganizationID())
+	return err
+}
+
 func DeleteCredential(tx WriteTxn, id uid.ID) error {
 	stmt := `
 		UPDATE credentials
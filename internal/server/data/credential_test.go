@@ -87,6 +87,49 @@ func TestUpdateCredential(t *testing.T) {
 	})
 }
 
+func TestUpdateCredentialLoginAttempts(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		cred := &models.Credential{
+			IdentityID:   7145,
+			PasswordHash: []byte("password-hash"),
+		}
+		err := CreateCredential(db, cred)
+		assert.NilError(t, err)
+
+		failedAt := time.Date(2023, 1, 25, 10, 0, 0, 0, time.UTC)
+		lockedUntil := failedAt.Add(15 * time.Minute)
+
+		updated := *cred // shallow copy
+		updated.FailedLoginAttempts = 10
+		updated.LastFailedLoginAt = &failedAt
+		updated.LockedUntil = &lockedUntil
+		updated.PasswordHash = []byte("ignored")
+		err = UpdateCredentialLoginAttempts(db, &updated)
+		assert.NilError(t, err)
+
+		actual, err := GetCredentialByUserID(db, cred.IdentityID)
+		assert.NilError(t, err)
+		assert.Equal(t, actual.FailedLoginAttempts, 10)
+		assert.Assert(t, actual.LastFailedLoginAt.Equal(failedAt))
+		assert.Assert(t, actual.LockedUntil.Equal(lockedUntil))
+		// the password is not changed
+		assert.DeepEqual(t, actual.PasswordHash, []byte("password-hash"))
+
+		// reset the attempts
+		updated.FailedLoginAttempts = 0
+		updated.LastFailedLoginAt = nil
+		updated.LockedUntil = nil
+		err = UpdateCredentialLoginAttempts(db, &updated)
+		assert.NilError(t, err)
+
+		actual, err = GetCredentialByUserID(db, cred.IdentityID)
+		assert.NilError(t, err)
+		assert.Equal(t, actual.FailedLoginAttempts, 0)
+		assert.Assert(t, actual.LastFailedLoginAt == nil)
+		assert.Assert(t, actual.LockedUntil == nil)
+	})
+}
+
 func TestGetCredentialByUserID(t *testing.T) {
 	runDBTests(t, func(t *testing.T, db *DB) {
 		cred := &models.Credential{
@@ -1,19 +1,29 @@
 package data
 
+//go:generate go run ../../tools/gentable -output tables_gen.go grantsTable=grants accessKeyTable=access_keys userPublicKeysTable=user_public_keys
+
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
+	"net"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
-	"unicode"
 
 	"github.com/jackc/pgconn"
+	"github.com/jackc/pgconn/stmtcache"
 	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v4"
+	pgxstdlib "github.com/jackc/pgx/v4/stdlib"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/infrahq/infra/internal"
 	"github.com/infrahq/infra/internal/logging"
@@ -23,38 +33,115 @@ import (
 )
 
 type NewDBOptions struct {
+	// Driver is the database driver, one of DriverPostgres or DriverSQLite.
+	// Defaults to DriverPostgres.
+	Driver string
+	// DSN is the connection string for the database. When Driver is
+	// DriverSQLite it is the path to the database file.
 	DSN string
+	// ReplicaDSN is the connection string for a read replica of the database.
+	// When set, read-only transactions are started on the replica.
+	ReplicaDSN string
 
 	EncryptionKeyProvider EncryptionKeyProvider
 	RootKeyID             string
 
+	// MaxOpenConnections is the maximum number of open connections to the
+	// database. Defaults to 4 times the number of CPUs, with a minimum of 10.
+	// A negative value removes the limit.
 	MaxOpenConnections int
+	// MaxIdleConnections is the maximum number of idle connections kept in
+	// the pool. Defaults to MaxOpenConnections. A negative value keeps no
+	// idle connections.
 	MaxIdleConnections int
-	MaxIdleTimeout     time.Duration
-}
+	// MaxIdleTimeout is the maximum amount of time a connection may be idle
+	// before it is closed. Defaults to 5 minutes. A negative value keeps idle
+	// connections open forever.
+	MaxIdleTimeout time.Duration
+	// MaxConnectionLifetime is the maximum amount of time a connection may be
+	// reused. Defaults to 30 minutes. A negative value reuses connections
+	// forever.
+	MaxConnectionLifetime time.Duration
+
+	// EnforceOrgScope causes every query performed by a Transaction that is
+	// scoped to an organization to panic if the query reads or modifies an
+	// org scoped table without an organization_id predicate. It is intended
+	// to be used by tests.
+	EnforceOrgScope bool
+
+	// SlowQueryThreshold is the duration after which a query is logged as a
+	// warning, and counted as a slow query. Defaults to 200ms.
+	SlowQueryThreshold time.Duration
+
+	// StatementTimeout is the maximum duration of any query performed by a
+	// Transaction. Queries that take longer are cancelled by the database,
+	// and return an error that is matched by IsStatementTimeout. Zero means
+	// no timeout. Migrations are never limited by the timeout.
+	StatementTimeout time.Duration
+
+	// Password returns the password used to open new connections to
+	// postgres. When it returns an empty string the password from DSN is
+	// used. It allows the password to be rotated without restarting the
+	// server. Connections that are already open are not affected.
+	Password func() string
+
+	// LegacyGroupGrantLookup restores the previous query used to list the
+	// grants of a user and their groups, which looks up the groups with a
+	// separate query. It is temporary, and will be removed once the new
+	// query plan is validated.
+	LegacyGroupGrantLookup bool
+
+	// PreparedStatementCacheSize is the number of prepared statements cached
+	// by each postgres connection, keyed by the query text. Cached statements
+	// are parsed and planned by the database once per connection, instead of
+	// every time they are executed. Zero keeps the statement cache configured
+	// by the DSN, which is the pgx default (512 prepared statements) unless
+	// the DSN sets statement_cache_mode or statement_cache_capacity.
+	PreparedStatementCacheSize int
+}
+
+const defaultSlowQueryThreshold = 200 * time.Millisecond
 
 // NewDB creates a new database connection and runs any required database migrations
 // before returning the connection. The loadDBKey function is called after
 // initializing the schema, but before any migrations.
 func NewDB(dbOpts NewDBOptions) (*DB, error) {
+	if dbOpts.Driver == DriverSQLite {
+		return newSQLiteDB(dbOpts)
+	}
+
 	db, err := newRawDB(dbOpts)
 	if err != nil {
 		return nil, fmt.Errorf("db conn: %w", err)
 	}
-	dataDB := &DB{DB: db}
+	dataDB := &DB{
+		DB:              db,
+		enforceOrgScope: dbOpts.EnforceOrgScope,
+		slowQueries:     newSlowQueryTracker(dbOpts.SlowQueryThreshold),
+		cache:           newReadCache(defaultReadCacheTTL),
+
+		legacyGroupGrantLookup: dbOpts.LegacyGroupGrantLookup,
+	}
+	if dbOpts.ReplicaDSN != "" {
+		replicaOpts := dbOpts
+		replicaOpts.DSN = dbOpts.ReplicaDSN
+		replicaDB, err := newRawDB(replicaOpts)
+		if err != nil {
+			return nil, fmt.Errorf("replica db conn: %w", err)
+		}
+		dataDB.replica = &replica{db: replicaDB}
+	}
 	tx, err := dataDB.Begin(context.TODO(), nil)
 	if err != nil {
 		return nil, err
 	}
 
-	opts := migrator.Options{
-		InitSchema: initializeSchema,
-		LoadKey: func(tx migrator.DB) error {
-			if dbOpts.EncryptionKeyProvider == nil {
-				return nil
-			}
-			return loadDBKey(tx, dbOpts.EncryptionKeyProvider, dbOpts.RootKeyID)
-		},
+	opts := migrationOptions()
+	opts.LoadKey = func(tx migrator.DB) error {
+		if dbOpts.EncryptionKeyProvider == nil {
+			return nil
+		}
+		return loadDBKey(tx, dbOpts.EncryptionKeyProvider, dbOpts.RootKeyID)
 	}
 	m := migrator.New(tx, opts, migrations())
 	if err := m.Migrate(); err != nil {
@@ -66,14 +153,58 @@ func NewDB(dbOpts NewDBOptions) (*DB, error) {
 	if err := tx.Commit(); err != nil {
 		return nil, fmt.Errorf("commit migrations: %w", err)
 	}
+	clearStatementCaches(db, dbOpts.withPoolDefaults().MaxIdleConnections)
 
 	if err := initialize(dataDB); err != nil {
 		return nil, fmt.Errorf("initialize database: %w", err)
 	}
 
+	dataDB.statementTimeout = dbOpts.StatementTimeout
 	return dataDB, nil
 }
 
+func migrationOptions() migrator.Options {
+	return migrator.Options{
+		InitSchema: initializeSchema,
+		Version:    internal.FullVersion(),
+	}
+}
+
+// MigrationStatus returns the status of every migration known to this
+// binary, including when and by which version it was applied. MigrationStatus
+// does not modify the database.
+func MigrationStatus(tx migrator.DB) ([]migrator.MigrationStatus, error) {
+	if dialectOf(tx) != nil {
+		return sqliteMigrationStatus(tx)
+	}
+	return migrator.New(tx, migrationOptions(), migrations()).Status()
+}
+
+// PendingMigrations connects to the database and returns the migrations that
+// would be run by NewDB, without running them.
+func PendingMigrations(dbOpts NewDBOptions) ([]migrator.MigrationStatus, error) {
+	db, err := newRawDB(dbOpts)
+	if err != nil {
+		return nil, fmt.Errorf("db conn: %w", err)
+	}
+	defer db.Close()
+
+	if dbOpts.Driver == DriverSQLite {
+		status, err := sqliteMigrationStatus(db)
+		if err != nil {
+			return nil, err
+		}
+		var pending []migrator.MigrationStatus
+		for _, m := range status {
+			if m.Pending {
+				pending = append(pending, m)
+			}
+		}
+		return pending, nil
+	}
+	return migrator.New(db, migrationOptions(), migrations()).Pending()
+}
+
 // DB wraps the underlying database and provides access to the default org,
 // and settings.
 type DB struct {
@@ -82,9 +213,30 @@ type DB struct {
 	DefaultOrg *models.Organization
 	// DefaultOrgSettings are the settings for DefaultOrg
 	DefaultOrgSettings *models.Settings
+
+	enforceOrgScope bool
+	slowQueries     *slowQueryTracker
+	replica         *replica
+	// dialect is nil for Postgres.
+	dialect dialect
+	// statementTimeout is set on every transaction started by Begin.
+	statementTimeout time.Duration
+	// tracer creates a span for every query in a transaction. A nil tracer
+	// uses the global tracer provider.
+	tracer trace.Tracer
+	// cache stores the rows read by InfraProvider and GetOrgSettings. A nil
+	// cache reads them from the database every time.
+	cache *readCache
+	// legacyGroupGrantLookup is set from NewDBOptions.LegacyGroupGrantLookup.
+	legacyGroupGrantLookup bool
 }
 
 func (d *DB) Close() error {
+	if d.replica != nil {
+		if err := d.replica.db.Close(); err != nil {
+			logging.L.Warn().Err(err).Msg("failed to close read replica connection")
+		}
+	}
 	return d.DB.Close()
 }
 
@@ -92,32 +244,53 @@ func (d *DB) SQLdb() *sql.DB {
 	return d.DB
 }
 
+// ReplicaSQLdb returns the connection pool of the read replica, or nil if
+// there is no read replica.
+func (d *DB) ReplicaSQLdb() *sql.DB {
+	if d.replica == nil {
+		return nil
+	}
+	return d.replica.db
+}
+
 func (d *DB) Exec(query string, args ...any) (sql.Result, error) {
 	var affected int64
 	start := time.Now()
-	query = rewriteQueryPlaceholders(query, len(args))
+	args = truncateTimes(args)
+	query, err := rewriteQuery(context.Background(), d.dialect, d.DB, query, args)
+	if err != nil {
+		return nil, err
+	}
 	result, err := d.DB.Exec(query, args...)
 	if err == nil {
 		affected, err = result.RowsAffected()
 	}
-	logQuery(query, err, start, affected)
+	d.slowQueries.logQuery(context.Background(), 0, query, err, start, affected)
 	return result, err
 }
 
 func (d *DB) Query(query string, args ...any) (*sql.Rows, error) {
 	start := time.Now()
-	query = rewriteQueryPlaceholders(query, len(args))
+	args = truncateTimes(args)
+	query, err := rewriteQuery(context.Background(), d.dialect, d.DB, query, args)
+	if err != nil {
+		return nil, err
+	}
 	rows, err := d.DB.Query(query, args...)
-	logQuery(query, err, start, -1)
+	d.slowQueries.logQuery(context.Background(), 0, query, err, start, -1)
 	return rows, err
 
 }
 
 func (d *DB) QueryRow(query string, args ...any) *sql.Row {
 	start := time.Now()
-	query = rewriteQueryPlaceholders(query, len(args))
+	args = truncateTimes(args)
+	query, err := rewriteQuery(context.Background(), d.dialect, d.DB, query, args)
+	if err != nil {
+		return sqliteQueryRowError(context.Background(), d.DB, err)
+	}
 	row := d.DB.QueryRow(query, args...)
-	logQuery(query, row.Err(), start, -1)
+	d.slowQueries.logQuery(context.Background(), 0, query, row.Err(), start, -1)
 	return row
 }
 
@@ -152,16 +325,58 @@ func (d *DB) OrganizationID() uid.ID {
 
 // Begin starts a new transaction. The ctx will cancel any queries performed by
 // the returned Transaction.
+//
+// When the DB has a read replica, read-only transactions are started on the
+// replica unless ctx was created by RequirePrimary. If the replica is
+// unavailable the transaction is started on the primary database.
 func (d *DB) Begin(ctx context.Context, opts *sql.TxOptions) (*Transaction, error) {
+	if d.replica != nil && opts != nil && opts.ReadOnly && !requiresPrimary(ctx) {
+		tx, err := d.replica.begin(ctx, opts)
+		if err == nil {
+			txn, err := d.newTransaction(ctx, tx)
+			if txn != nil && txn.cache != nil {
+				txn.cache.fromReplica = true
+			}
+			return txn, err
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+	}
+
 	tx, err := d.DB.BeginTx(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
-	return &Transaction{
-		Tx:        tx,
-		txCtx:     ctx,
-		completed: new(atomic.Bool),
-	}, nil
+	return d.newTransaction(ctx, tx)
+}
+
+func (d *DB) newTransaction(ctx context.Context, tx *sql.Tx) (*Transaction, error) {
+	if d.statementTimeout > 0 {
+		// SET does not accept placeholders, the value is formatted from an
+		// integer so it is safe to include in the statement.
+		stmt := fmt.Sprintf("SET LOCAL statement_timeout = %d", d.statementTimeout.Milliseconds())
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			_ = tx.Rollback()
+			return nil, fmt.Errorf("set statement timeout: %w", err)
+		}
+	}
+	txn := &Transaction{
+		Tx:              tx,
+		txCtx:           ctx,
+		completed:       new(atomic.Bool),
+		onCommit:        &commitCallbacks{},
+		enforceOrgScope: d.enforceOrgScope,
+		slowQueries:     d.slowQueries,
+		dialect:         d.dialect,
+		tracer:          d.tracer,
+
+		legacyGroupGrantLookup: d.legacyGroupGrantLookup,
+	}
+	if d.cache != nil {
+		txn.cache = &txnCache{cache: d.cache}
+	}
+	return txn, nil
 }
 
 // Transaction is a database transaction with metadata about the request that
@@ -172,37 +387,131 @@ type Transaction struct {
 
 	orgID     uid.ID
 	completed *atomic.Bool
+	onCommit  *commitCallbacks
+
+	enforceOrgScope bool
+	slowQueries     *slowQueryTracker
+	dialect         dialect
+	tracer          trace.Tracer
+	cache           *txnCache
+
+	legacyGroupGrantLookup bool
+}
+
+// commitCallbacks are the functions registered with Transaction.OnCommit. They
+// are shared by all the copies of a Transaction created by WithOrgID.
+type commitCallbacks struct {
+	mu  sync.Mutex
+	fns []func()
+}
+
+func (c *commitCallbacks) add(fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fns = append(c.fns, fn)
+}
+
+// take removes and returns all the callbacks.
+func (c *commitCallbacks) take() []func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fns := c.fns
+	c.fns = nil
+	return fns
+}
+
+// OnCommit registers fn to be called after the transaction is committed.
+// Callbacks are called in the order they were registered, and only when the
+// commit succeeds. They are dropped when the transaction is rolled back, or
+// when the commit fails. Use OnCommit for side effects, like sending events,
+// that must not happen unless the changes in the transaction are saved.
+//
+// A panic in fn is recovered and logged, so that a failed side effect does not
+// fail the request that already committed its changes.
+func (t *Transaction) OnCommit(fn func()) {
+	t.onCommit.add(fn)
+}
+
+func runCommitCallbacks(ctx context.Context, fns []func()) {
+	for _, fn := range fns {
+		func() {
+			defer func() {
+				if v := recover(); v != nil {
+					logging.FromContext(ctx).Error().
+						Str("panic", fmt.Sprint(v)).
+						Msg("panic in transaction commit callback")
+				}
+			}()
+			fn()
+		}()
+	}
 }
 
 func (t *Transaction) OrganizationID() uid.ID {
 	return t.orgID
 }
 
+// checkOrgScope panics when the transaction is scoped to an organization, and
+// query does not filter an org scoped table by organization_id. The check is
+// only performed when the DB was created with NewDBOptions.EnforceOrgScope.
+func (t *Transaction) checkOrgScope(query string) {
+	if !t.enforceOrgScope || t.orgID == 0 {
+		return
+	}
+	if err := checkOrgScope(query); err != nil {
+		panic(err.Error())
+	}
+}
+
 func (t *Transaction) Exec(query string, args ...any) (sql.Result, error) {
 	var affected int64
+	t.checkOrgScope(query)
 	start := time.Now()
-	query = rewriteQueryPlaceholders(query, len(args))
+	span := startQuerySpan(t.txCtx, t.tracer, t.dialect, query)
+	args = truncateTimes(args)
+	query, err := rewriteQuery(t.txCtx, t.dialect, t.Tx, query, args)
+	if err != nil {
+		span.end(err, -1)
+		return nil, err
+	}
 	result, err := t.Tx.ExecContext(t.txCtx, query, args...)
 	if err == nil {
 		affected, err = result.RowsAffected()
 	}
-	logQuery(query, err, start, affected)
+	span.end(err, affected)
+	t.slowQueries.logQuery(t.txCtx, t.orgID, query, err, start, affected)
 	return result, err
 }
 
 func (t *Transaction) Query(query string, args ...any) (*sql.Rows, error) {
+	t.checkOrgScope(query)
 	start := time.Now()
-	query = rewriteQueryPlaceholders(query, len(args))
+	span := startQuerySpan(t.txCtx, t.tracer, t.dialect, query)
+	args = truncateTimes(args)
+	query, err := rewriteQuery(t.txCtx, t.dialect, t.Tx, query, args)
+	if err != nil {
+		span.end(err, -1)
+		return nil, err
+	}
 	rows, err := t.Tx.QueryContext(t.txCtx, query, args...)
-	logQuery(query, err, start, -1)
+	span.end(err, -1)
+	t.slowQueries.logQuery(t.txCtx, t.orgID, query, err, start, -1)
 	return rows, err
 }
 
 func (t *Transaction) QueryRow(query string, args ...any) *sql.Row {
+	t.checkOrgScope(query)
 	start := time.Now()
-	query = rewriteQueryPlaceholders(query, len(args))
+	span := startQuerySpan(t.txCtx, t.tracer, t.dialect, query)
+	args = truncateTimes(args)
+	query, err := rewriteQuery(t.txCtx, t.dialect, t.Tx, query, args)
+	if err != nil {
+		span.end(err, -1)
+		return sqliteQueryRowError(t.txCtx, t.Tx, err)
+	}
 	row := t.Tx.QueryRowContext(t.txCtx, query, args...)
-	logQuery(query, row.Err(), start, -1)
+	span.end(row.Err(), -1)
+	t.slowQueries.logQuery(t.txCtx, t.orgID, query, row.Err(), start, -1)
 	return row
 }
 
@@ -216,15 +525,21 @@ func (t *Transaction) Rollback() error {
 	if err == nil {
 		t.completed.Store(true)
 	}
+	t.onCommit.take()
 	return err
 }
 
+// Commit the transaction. When the commit succeeds any functions registered
+// with OnCommit are called.
 func (t *Transaction) Commit() error {
 	err := t.Tx.Commit()
-	if err == nil {
-		t.completed.Store(true)
+	fns := t.onCommit.take()
+	if err != nil {
+		return err
 	}
-	return err
+	t.completed.Store(true)
+	runCommitCallbacks(t.txCtx, fns)
+	return nil
 }
 
 // WithOrgID returns a shallow copy of the Transaction with the OrganizationID
@@ -238,22 +553,116 @@ func (t *Transaction) WithOrgID(orgID uid.ID) *Transaction {
 
 // newRawDB creates a new database connection without running migrations.
 func newRawDB(options NewDBOptions) (*sql.DB, error) {
-	if options.DSN == "" {
+	driverName, dsn := "pgx", options.DSN
+	if options.Driver == DriverSQLite {
+		if options.DSN == "" {
+			return nil, fmt.Errorf("missing sqlite database path")
+		}
+		driverName, dsn = "sqlite", sqliteDSN(options.DSN)
+	}
+	if dsn == "" {
 		return nil, fmt.Errorf("missing postgres dsn")
 	}
 
-	db, err := sql.Open("pgx", options.DSN)
+	db, err := openDB(driverName, dsn, options)
 	if err != nil {
 		return nil, err
 	}
 
+	options = options.withPoolDefaults()
 	db.SetMaxOpenConns(options.MaxOpenConnections)
 	db.SetMaxIdleConns(options.MaxIdleConnections)
 	db.SetConnMaxIdleTime(options.MaxIdleTimeout)
+	db.SetConnMaxLifetime(options.MaxConnectionLifetime)
 
 	return db, nil
 }
 
+// openDB opens a connection pool. When options.Password is not nil it is
+// called before every new postgres connection is opened, so that the pool
+// uses the current password.
+func openDB(driverName, dsn string, options NewDBOptions) (*sql.DB, error) {
+	if driverName != "pgx" {
+		return sql.Open(driverName, dsn)
+	}
+
+	cfg, err := pgxConfig(dsn, options)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []pgxstdlib.OptionOpenDB
+	if password := options.Password; password != nil {
+		beforeConnect := func(_ context.Context, cfg *pgx.ConnConfig) error {
+			if p := password(); p != "" {
+				cfg.Password = p
+			}
+			return nil
+		}
+		opts = append(opts, pgxstdlib.OptionBeforeConnect(beforeConnect))
+	}
+	return pgxstdlib.OpenDB(*cfg, opts...), nil
+}
+
+// pgxConfig returns the connection config of dsn. The statement cache built by
+// pgx.ParseConfig is only replaced when options.PreparedStatementCacheSize is
+// set.
+func pgxConfig(dsn string, options NewDBOptions) (*pgx.ConnConfig, error) {
+	cfg, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if size := options.PreparedStatementCacheSize; size > 0 {
+		cfg.BuildStatementCache = statementCacheBuilder(size)
+	}
+	return cfg, nil
+}
+
+// statementCacheBuilder returns the function used by pgx to create the
+// statement cache of a new connection, which prepares up to size statements.
+func statementCacheBuilder(size int) pgx.BuildStatementCacheFunc {
+	return func(conn *pgconn.PgConn) stmtcache.Cache {
+		return stmtcache.New(conn, stmtcache.ModePrepare, size)
+	}
+}
+
+// clearStatementCaches closes the idle connections of the pool, so that the
+// statements prepared by those connections are not used again. It is called
+// after migrations, because a migration can change the result type of a
+// statement that was prepared before it, which causes the statement to fail.
+// Connections that are in use are not affected.
+func clearStatementCaches(db *sql.DB, maxIdle int) {
+	db.SetMaxIdleConns(0)
+	db.SetMaxIdleConns(maxIdle)
+}
+
+const (
+	minDefaultMaxOpenConnections = 10
+	defaultMaxIdleTimeout        = 5 * time.Minute
+	defaultMaxConnectionLifetime = 30 * time.Minute
+)
+
+// withPoolDefaults returns a copy of options with the connection pool fields
+// that are unset replaced by their default.
+func (o NewDBOptions) withPoolDefaults() NewDBOptions {
+	if o.MaxOpenConnections == 0 {
+		o.MaxOpenConnections = 4 * runtime.NumCPU()
+		if o.MaxOpenConnections < minDefaultMaxOpenConnections {
+			o.MaxOpenConnections = minDefaultMaxOpenConnections
+		}
+	}
+	if o.MaxIdleConnections == 0 {
+		o.MaxIdleConnections = o.MaxOpenConnections
+	}
+	if o.MaxIdleTimeout == 0 {
+		o.MaxIdleTimeout = defaultMaxIdleTimeout
+	}
+	if o.MaxConnectionLifetime == 0 {
+		o.MaxConnectionLifetime = defaultMaxConnectionLifetime
+	}
+	return o
+}
+
 const defaultOrganizationID = 1000
 
 func initialize(db *DB) error {
@@ -312,6 +721,9 @@ type UniqueConstraintError struct {
 	Table  string
 	Column string
 	Value  any
+	// Message is a user facing description of the conflict. When empty the
+	// message is built from Table, Column, and Value.
+	Message string
 }
 
 // these are tables whose names need the 'an' article rather than 'a'
@@ -321,6 +733,9 @@ var anArticleTableName = map[string]bool{
 }
 
 func (e UniqueConstraintError) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
 	table := e.Table
 	switch table {
 	case "":
@@ -347,6 +762,76 @@ func (e UniqueConstraintError) Error() string {
 	return fmt.Sprintf("%s %v with %v %v already exists", article, table, e.Column, e.Value)
 }
 
+// uniqueConstraints maps the name of a unique index in schema.sql to the error
+// returned when the index is violated. Column is the user facing name of the
+// field, which is used as the FieldName in API responses.
+var uniqueConstraints = map[string]UniqueConstraintError{
+	"idx_access_keys_issued_for_name": {
+		Table: "access_keys", Column: "name",
+		Message: "an access key with that name already exists for this user",
+	},
+	"idx_access_keys_key_id": {
+		Table: "access_keys", Column: "keyId",
+		Message: "an access key with that key ID already exists",
+	},
+	"idx_credentials_identity_id": {
+		Table: "credentials", Column: "identityID",
+		Message: "a credential for that user already exists",
+	},
+	"idx_destinations_name": {
+		Table: "destinations", Column: "name",
+		Message: "a destination with that name already exists",
+	},
+	"idx_destinations_unique_id": {
+		Table: "destinations", Column: "uniqueID",
+		Message: "a destination with that uniqueID already exists",
+	},
+	"idx_dfar_user_code": {
+		Table: "device_flow_auth_requests", Column: "userCode",
+		Message: "a device flow request with that user code already exists",
+	},
+	"idx_grant_srp": {
+		Table: "grants", Column: "privilege",
+		Message: "a grant for that user or group, privilege, and resource already exists",
+	},
+	"idx_groups_name": {
+		Table: "groups", Column: "name",
+		Message: "a group with that name already exists",
+	},
+	"idx_idempotency_keys_key": {
+		Table: "idempotency_keys", Column: "idempotencyKey",
+		Message: "a request with that idempotency key already exists",
+	},
+	"idx_identities_name": {
+		Table: "identities", Column: "name",
+		Message: "a user with that name already exists",
+	},
+	"idx_identities_verified": {
+		Table: "identities", Column: "verificationToken",
+		Message: "a user with that verification token already exists",
+	},
+	"idx_organizations_domain": {
+		Table: "organizations", Column: "domain",
+		Message: "an organization with that domain already exists",
+	},
+	"idx_password_reset_tokens_token": {
+		Table: "password_reset_tokens", Column: "token",
+		Message: "a password reset token with that value already exists",
+	},
+	"idx_providers_name": {
+		Table: "providers", Column: "name",
+		Message: "a provider with that name already exists",
+	},
+	"idx_user_public_keys_user_fingerprint": {
+		Table: "user_public_keys", Column: "publicKey",
+		Message: "that public key has already been added",
+	},
+	"idx_user_ssh_login_name": {
+		Table: "identities", Column: "sshLoginName",
+		Message: "a user with that SSH login name already exists",
+	},
+}
+
 // handleError looks for well known DB errors. If the error is recognized it
 // is translated into a UniqueConstraintError so that calling code can
 // inspect the error.
@@ -364,61 +849,53 @@ func handleError(err error) error {
 	if errors.As(err, &pgErr) {
 		switch pgErr.Code {
 		case pgerrcode.UniqueViolation:
-			// constraintFields maps the name of a unique constraint, to the
-			// user facing name of that field.
-			constraintFields := map[string]string{
-				"idx_identities_name":         "name",
-				"idx_identities_verified":     "verificationToken",
-				"idx_groups_name":             "name",
-				"idx_providers_name":          "name",
-				"idx_access_keys_name":        "name",
-				"idx_destinations_unique_id":  "uniqueID",
-				"idx_access_keys_key_id":      "keyId",
-				"idx_credentials_identity_id": "identityID",
-				"idx_organizations_domain":    "domain",
-				"idx_user_ssh_login_name":     "sshLoginName",
+			if ucErr, ok := uniqueConstraints[pgErr.ConstraintName]; ok {
+				return ucErr
 			}
-
-			columnName := constraintFields[pgErr.ConstraintName]
-			return UniqueConstraintError{Table: pgErr.TableName, Column: columnName}
+			return UniqueConstraintError{Table: pgErr.TableName}
 		}
 	}
 
-	// https://sqlite.org/src/file?name=ext/rtree/rtree.c:
-	// pRtree->base.zErrMsg = sqlite3_mprintf(
-	//     "UNIQUE constraint failed: %s.%s", pRtree->zName, zCol
-	// );
-	if strings.HasPrefix(err.Error(), "UNIQUE constraint failed:") {
-		fields := strings.FieldsFunc(err.Error(), func(r rune) bool {
-			return unicode.IsSpace(r) || r == '.'
-		})
-
-		// fields = [UNIQUE, constraint, failed:, <table>, column>]
-		switch len(fields) {
-		case 5, 7, 9, 11:
-			col := fields[4]
-			i := 6
-			for i < len(fields) {
-				col += fields[i]
-				i += 2
-			}
-			return UniqueConstraintError{
-				Table:  fields[3],
-				Column: col,
-			}
-		default:
-			logging.Warnf("unhandled unique constraint error format: %q", err.Error())
+	if ucErr, ok := sqliteUniqueConstraintError(err); ok {
+		return ucErr
+	}
 
-			return UniqueConstraintError{}
-		}
+	// record where the unexpected error happened, so that the stack is
+	// included when the error is logged
+	return logging.WithStack(err)
+}
+
+// IsConnectionError returns true if err is caused by a failure to connect to
+// the database, or by a lost connection to the database.
+func IsConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) || errors.Is(err, driver.ErrBadConn) {
+		return true
 	}
+	// pgconn does not export the type of connection errors
+	return strings.Contains(err.Error(), "failed to connect to")
+}
 
-	return err
+// IsStatementTimeout returns true if err is caused by a query that was
+// cancelled by the database because it ran for longer than the statement
+// timeout.
+func IsStatementTimeout(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) &&
+		pgErr.Code == pgerrcode.QueryCanceled &&
+		strings.Contains(pgErr.Message, "statement timeout")
 }
 
 // InfraProvider returns the infra provider for the organization set in the tx.
+// The provider is read from the cache of the DB when possible.
 func InfraProvider(tx ReadTxn) *models.Provider {
-	infra, err := GetProvider(tx, GetProviderOptions{KindInfra: true})
+	key := infraProviderCacheKey(tx.OrganizationID())
+	infra, err := cachedRead(tx, key, cloneProvider, func() (*models.Provider, error) {
+		return GetProvider(tx, GetProviderOptions{KindInfra: true})
+	})
 	if err != nil {
 		logging.L.Panic().Err(err).Msg("failed to retrieve infra provider")
 	}
@@ -435,26 +912,101 @@ func InfraConnectorIdentity(db ReadTxn) *models.Identity {
 	return connector
 }
 
-const slowQueryThreshold = time.Second
+// slowQueryTracker logs and counts queries that take longer than threshold,
+// and records the duration of every query. A nil slowQueryTracker uses the
+// default threshold, and does not count slow queries.
+type slowQueryTracker struct {
+	threshold time.Duration
+	count     prometheus.Counter
+	duration  *prometheus.HistogramVec
+}
 
-func logQuery(query string, err error, startedAt time.Time, rows int64) {
+func newSlowQueryTracker(threshold time.Duration) *slowQueryTracker {
+	if threshold <= 0 {
+		threshold = defaultSlowQueryThreshold
+	}
+	return &slowQueryTracker{
+		threshold: threshold,
+		count: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "infra",
+			Subsystem: "db",
+			Name:      "slow_queries_total",
+			Help:      "The number of database queries that took longer than the slow query threshold",
+		}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "infra",
+			Subsystem: "db",
+			Name:      "query_duration_seconds",
+			Help:      "A histogram of duration, in seconds, of database queries, labeled by statement",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+		}, []string{"statement"}),
+	}
+}
+
+// SlowQueryCounter returns the metric that counts slow queries, so that it can
+// be added to a prometheus registry.
+func (d *DB) SlowQueryCounter() prometheus.Collector {
+	return d.slowQueries.count
+}
+
+// QueryDurationHistogram returns the metric that records the duration of
+// queries, so that it can be added to a prometheus registry.
+func (d *DB) QueryDurationHistogram() prometheus.Collector {
+	return d.slowQueries.duration
+}
+
+// queryStatementName returns the label used for query in the query duration
+// metric, for example select_grants. The name is built from the operation and
+// the table so that the number of label values is bounded by the schema, not
+// by the number of distinct queries.
+func queryStatementName(query string) string {
+	operation := strings.ToLower(queryOperation(query))
+	if operation == "" {
+		return "unknown"
+	}
+	if table := queryTable(query); table != "" {
+		return operation + "_" + table
+	}
+	return operation
+}
+
+// logQuery writes a log line for query using the logger from ctx, so that
+// queries can be correlated with the request that made them. Queries that are
+// slower than the threshold are logged as a warning. The query is always the
+// parameterized text, the arguments are never logged.
+func (s *slowQueryTracker) logQuery(ctx context.Context, orgID uid.ID, query string, err error, startedAt time.Time, rows int64) {
 	level := zerolog.TraceLevel
+	msg := "DB query"
+
+	threshold := defaultSlowQueryThreshold
+	if s != nil {
+		threshold = s.threshold
+	}
 
 	elapsed := time.Since(startedAt)
+	if s != nil {
+		s.duration.WithLabelValues(queryStatementName(query)).Observe(elapsed.Seconds())
+	}
 	switch {
-	case errors.Is(err, sql.ErrNoRows):
+	case elapsed > threshold:
 		level = zerolog.WarnLevel
-	case elapsed > slowQueryThreshold:
+		msg = "slow DB query"
+		if s != nil {
+			s.count.Inc()
+		}
+	case errors.Is(err, sql.ErrNoRows):
 		level = zerolog.WarnLevel
 	}
 
-	query = normalizeQueryString(query)
-	logging.L.WithLevel(level).
+	event := logging.FromContext(ctx).WithLevel(level).
 		CallerSkipFrame(2). // logQuery + tx.{Query,Exec}
 		Int64("rows", rows).
-		Str("query", query).
-		Dur("elapsed", elapsed).
-		Msg("DB query")
+		Str("query", normalizeQueryString(query)).
+		Dur("elapsed", elapsed)
+	if orgID != 0 {
+		event = event.Str("queryOrgID", orgID.String())
+	}
+	event.Msg(msg)
 }
 
 var replaceQueryWhitespace = strings.NewReplacer("\t", " ", "\n", " ")
@@ -1,10 +1,26 @@
 package data
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/infrahq/secrets"
+	"github.com/jackc/pgconn/stmtcache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/rs/zerolog"
 	"gotest.tools/v3/assert"
 
@@ -16,11 +32,14 @@ import (
 	"github.com/infrahq/infra/uid"
 )
 
-func setupDB(t *testing.T) *DB {
+func setupDB(t testing.TB) *DB {
 	t.Helper()
 	patch.ModelsSymmetricKey(t)
 
-	db, err := NewDB(NewDBOptions{DSN: database.PostgresDriver(t, "_data").DSN})
+	db, err := NewDB(NewDBOptions{
+		DSN:             database.PostgresDriver(t, "_data").DSN,
+		EnforceOrgScope: true,
+	})
 	assert.NilError(t, err)
 
 	logging.PatchLogger(t, zerolog.NewTestWriter(t))
@@ -38,12 +57,96 @@ func txnForTestCase(t *testing.T, db *DB, orgID uid.ID) *Transaction {
 	return tx.WithOrgID(orgID)
 }
 
+func setupSQLiteDB(t testing.TB) *DB {
+	t.Helper()
+	patch.ModelsSymmetricKey(t)
+
+	db, err := NewDB(NewDBOptions{
+		Driver:          DriverSQLite,
+		DSN:             database.SQLiteDriver(t).DSN,
+		EnforceOrgScope: true,
+	})
+	assert.NilError(t, err)
+	t.Cleanup(func() {
+		assert.NilError(t, db.Close())
+	})
+
+	logging.PatchLogger(t, zerolog.NewTestWriter(t))
+
+	return db
+}
+
+// skipWithSQLite skips the test when db is a sqlite database, because the
+// test covers behaviour that is specific to postgres.
+func skipWithSQLite(t *testing.T, db *DB, reason string) {
+	t.Helper()
+	if db.dialect != nil {
+		t.Skip("not supported by sqlite: " + reason)
+	}
+}
+
 // runDBTests against all supported databases.
 // Set POSTGRESQL_CONNECTION to a postgresql connection string to run tests
-// against postgresql.
+// against postgresql, and INFRA_TEST_SQLITE=1 to run tests against sqlite.
 func runDBTests(t *testing.T, run func(t *testing.T, db *DB)) {
-	db := setupDB(t)
-	run(t, db)
+	t.Run("postgres", func(t *testing.T) {
+		run(t, setupDB(t))
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		run(t, setupSQLiteDB(t))
+	})
+}
+
+// runDBTestsParallel is runDBTests for tests that run in parallel with the
+// other parallel tests of the package. Every test already uses its own
+// postgres schema or sqlite file, so only the global state is different:
+// models.SymmetricKey is set once for all the parallel tests, and the logger
+// is not patched.
+//
+// The test must not modify any other global state.
+func runDBTestsParallel(t *testing.T, run func(t *testing.T, db *DB)) {
+	t.Parallel()
+	setupParallelSymmetricKey(t)
+
+	t.Run("postgres", func(t *testing.T) {
+		t.Parallel()
+		run(t, openParallelTestDB(t, NewDBOptions{
+			DSN: database.PostgresDriver(t, "_data").DSN,
+		}))
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		t.Parallel()
+		run(t, openParallelTestDB(t, NewDBOptions{
+			Driver: DriverSQLite,
+			DSN:    database.SQLiteDriver(t).DSN,
+		}))
+	})
+}
+
+var parallelSymmetricKey sync.Once
+
+// setupParallelSymmetricKey sets models.SymmetricKey for the parallel tests.
+// Unlike patch.ModelsSymmetricKey the key is never reset, because parallel
+// tests only start once all the other tests in the package have finished.
+func setupParallelSymmetricKey(t *testing.T) {
+	parallelSymmetricKey.Do(func() {
+		sp := secrets.NewFileSecretProviderFromConfig(secrets.FileConfig{Path: t.TempDir()})
+		key, err := secrets.NewNativeKeyProvider(sp).GenerateDataKey("db_at_rest")
+		assert.NilError(t, err)
+		models.SymmetricKey = key
+	})
+	assert.Assert(t, models.SymmetricKey != nil, "symmetric key was not set")
+}
+
+func openParallelTestDB(t *testing.T, opts NewDBOptions) *DB {
+	t.Helper()
+	opts.EnforceOrgScope = true
+	db, err := NewDB(opts)
+	assert.NilError(t, err)
+	t.Cleanup(func() {
+		assert.NilError(t, db.Close())
+	})
+	return db
 }
 
 func TestSnowflakeIDSerialization(t *testing.T) {
@@ -129,6 +232,54 @@ func TestNewDB(t *testing.T) {
 	})
 }
 
+func TestNewRawDB_PoolOptions(t *testing.T) {
+	t.Run("from options", func(t *testing.T) {
+		db, err := newRawDB(NewDBOptions{
+			DSN:                   "host=localhost",
+			MaxOpenConnections:    7,
+			MaxIdleConnections:    3,
+			MaxIdleTimeout:        time.Minute,
+			MaxConnectionLifetime: time.Hour,
+		})
+		assert.NilError(t, err)
+		defer db.Close()
+
+		assert.Equal(t, db.Stats().MaxOpenConnections, 7)
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		db, err := newRawDB(NewDBOptions{DSN: "host=localhost"})
+		assert.NilError(t, err)
+		defer db.Close()
+
+		assert.Assert(t, db.Stats().MaxOpenConnections >= minDefaultMaxOpenConnections)
+	})
+}
+
+func TestNewDBOptions_WithPoolDefaults(t *testing.T) {
+	opts := NewDBOptions{}.withPoolDefaults()
+	expectedOpen := 4 * runtime.NumCPU()
+	if expectedOpen < minDefaultMaxOpenConnections {
+		expectedOpen = minDefaultMaxOpenConnections
+	}
+	expected := NewDBOptions{
+		MaxOpenConnections:    expectedOpen,
+		MaxIdleConnections:    expectedOpen,
+		MaxIdleTimeout:        5 * time.Minute,
+		MaxConnectionLifetime: 30 * time.Minute,
+	}
+	assert.DeepEqual(t, opts, expected)
+
+	// values that are set are not changed
+	set := NewDBOptions{
+		MaxOpenConnections:    -1,
+		MaxIdleConnections:    2,
+		MaxIdleTimeout:        -1,
+		MaxConnectionLifetime: time.Hour,
+	}
+	assert.DeepEqual(t, set.withPoolDefaults(), set)
+}
+
 func TestDB_Begin(t *testing.T) {
 	runDBTests(t, func(t *testing.T, db *DB) {
 		t.Run("rollback", func(t *testing.T) {
@@ -180,6 +331,7 @@ func TestLongRunningQueriesAreCancelled(t *testing.T) {
 	}
 
 	runDBTests(t, func(t *testing.T, db *DB) {
+		skipWithSQLite(t, db, "pg_sleep")
 		started := time.Now()
 
 		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
@@ -195,3 +347,501 @@ func TestLongRunningQueriesAreCancelled(t *testing.T) {
 		assert.Assert(t, elapsed < 1500*time.Millisecond, "query should have timed out and been cancelled")
 	})
 }
+
+func TestIsConnectionError(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+
+	assert.Assert(t, IsConnectionError(fmt.Errorf("list grants: %w", dialErr)))
+	assert.Assert(t, IsConnectionError(driver.ErrBadConn))
+	assert.Assert(t, IsConnectionError(errors.New(`failed to connect to "host=localhost"`)))
+
+	assert.Assert(t, !IsConnectionError(nil))
+	assert.Assert(t, !IsConnectionError(internal.ErrNotFound))
+	assert.Assert(t, !IsConnectionError(UniqueConstraintError{Table: "grants"}))
+}
+
+func TestUniqueConstraints_ExistInSchema(t *testing.T) {
+	for name, ucErr := range uniqueConstraints {
+		prefix := fmt.Sprintf("CREATE UNIQUE INDEX %v ON %v ", name, ucErr.Table)
+		assert.Assert(t, strings.Contains(schemaSQL, prefix), "index %v not found in schema", name)
+	}
+}
+
+func TestHandleError_UniqueConstraints(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		type testCase struct {
+			name       string
+			constraint string
+			create     func(t *testing.T, tx *Transaction) error
+		}
+
+		run := func(t *testing.T, tc testCase) {
+			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+
+			// create twice, the second should violate the constraint
+			assert.NilError(t, tc.create(t, tx))
+			err := tc.create(t, tx)
+
+			var ucErr UniqueConstraintError
+			assert.Assert(t, errors.As(err, &ucErr), "wrong error type %T: %v", err, err)
+			assert.DeepEqual(t, ucErr, uniqueConstraints[tc.constraint])
+		}
+
+		testCases := []testCase{
+			{
+				name:       "user name",
+				constraint: "idx_identities_name",
+				create: func(t *testing.T, tx *Transaction) error {
+					return CreateIdentity(tx, &models.Identity{Name: "same@example.com"})
+				},
+			},
+			{
+				name:       "group name",
+				constraint: "idx_groups_name",
+				create: func(t *testing.T, tx *Transaction) error {
+					return CreateGroup(tx, &models.Group{Name: "same"})
+				},
+			},
+			{
+				name:       "access key name",
+				constraint: "idx_access_keys_issued_for_name",
+				create: func(t *testing.T, tx *Transaction) error {
+					user, err := GetIdentity(tx, GetIdentityOptions{ByName: "keys@example.com"})
+					if errors.Is(err, internal.ErrNotFound) {
+						user = &models.Identity{Name: "keys@example.com"}
+						assert.NilError(t, CreateIdentity(tx, user))
+					}
+					_, err = CreateAccessKey(tx, &models.AccessKey{
+						Name:      "same",
+						IssuedFor: user.ID,
+						ExpiresAt: time.Now().Add(time.Hour),
+					})
+					return err
+				},
+			},
+			{
+				name:       "grant",
+				constraint: "idx_grant_srp",
+				create: func(t *testing.T, tx *Transaction) error {
+					return CreateGrant(tx, &models.Grant{
+						Subject:   uid.NewIdentityPolymorphicID(1234),
+						Privilege: "view",
+						Resource:  "infra",
+					})
+				},
+			},
+			{
+				name:       "public key fingerprint",
+				constraint: "idx_user_public_keys_user_fingerprint",
+				create: func(t *testing.T, tx *Transaction) error {
+					return AddUserPublicKey(tx, &models.UserPublicKey{
+						UserID:      uid.ID(1234),
+						PublicKey:   "the-public-key",
+						KeyType:     "ssh-rsa",
+						Fingerprint: "the-fingerprint",
+					})
+				},
+			},
+			{
+				name:       "destination name",
+				constraint: "idx_destinations_name",
+				create: func(t *testing.T, tx *Transaction) error {
+					return CreateDestination(tx, &models.Destination{
+						Name:     "same",
+						Kind:     models.DestinationKindKubernetes,
+						UniqueID: uid.New().String(),
+					})
+				},
+			},
+			{
+				name:       "provider name",
+				constraint: "idx_providers_name",
+				create: func(t *testing.T, tx *Transaction) error {
+					return CreateProvider(tx, &models.Provider{
+						Name: "same",
+						Kind: models.ProviderKindOkta,
+					})
+				},
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				run(t, tc)
+			})
+		}
+	})
+}
+
+func TestSlowQueryLogging(t *testing.T) {
+	type logEntry struct {
+		Level      string `json:"level"`
+		Message    string `json:"message"`
+		Query      string `json:"query"`
+		QueryOrgID string `json:"queryOrgID"`
+		Rows       int64  `json:"rows"`
+	}
+
+	runDBTests(t, func(t *testing.T, db *DB) {
+		skipWithSQLite(t, db, "pg_sleep")
+		buf := new(bytes.Buffer)
+		logging.PatchLogger(t, buf)
+		db.slowQueries = newSlowQueryTracker(20 * time.Millisecond)
+
+		tx := txnForTestCase(t, db, 123456)
+
+		// fast queries are not logged at warn
+		var one int
+		assert.NilError(t, tx.QueryRow("SELECT 1").Scan(&one))
+		assert.Equal(t, buf.Len(), 0)
+
+		var secret string
+		err := tx.QueryRow("SELECT ? FROM pg_sleep(0.05)", "the-secret-value").Scan(&secret)
+		assert.NilError(t, err)
+		assert.Equal(t, secret, "the-secret-value")
+
+		assert.Assert(t, !strings.Contains(buf.String(), "the-secret-value"), buf.String())
+
+		var entry logEntry
+		assert.NilError(t, json.Unmarshal(buf.Bytes(), &entry), buf.String())
+		expected := logEntry{
+			Level:      "warn",
+			Message:    "slow DB query",
+			Query:      "SELECT $1 FROM pg_sleep(0.05)",
+			QueryOrgID: uid.ID(123456).String(),
+			Rows:       -1,
+		}
+		assert.DeepEqual(t, entry, expected)
+		assert.Equal(t, testutil.ToFloat64(db.slowQueries.count), float64(1))
+	})
+}
+
+func TestSlowQueryTracker_LogQuery(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logging.PatchLogger(t, buf)
+
+	tracker := newSlowQueryTracker(0)
+	assert.Equal(t, tracker.threshold, defaultSlowQueryThreshold)
+
+	tracker.logQuery(context.Background(), 0, "SELECT 1", nil, time.Now(), -1)
+	assert.Equal(t, buf.Len(), 0)
+	assert.Equal(t, testutil.ToFloat64(tracker.count), float64(0))
+
+	tracker.logQuery(context.Background(), 0, "SELECT id\n\tFROM grants", nil, time.Now().Add(-time.Second), 3)
+	assert.Assert(t, strings.Contains(buf.String(), `"message":"slow DB query"`), buf.String())
+	assert.Assert(t, strings.Contains(buf.String(), `"query":"SELECT id  FROM grants"`), buf.String())
+	assert.Equal(t, testutil.ToFloat64(tracker.count), float64(1))
+
+	t.Run("query duration", func(t *testing.T) {
+		registry := prometheus.NewPedanticRegistry()
+		assert.NilError(t, registry.Register(tracker.duration))
+		families, err := registry.Gather()
+		assert.NilError(t, err)
+		assert.Equal(t, len(families), 1)
+		assert.Equal(t, families[0].GetName(), "infra_db_query_duration_seconds")
+
+		counts := map[string]uint64{}
+		for _, metric := range families[0].GetMetric() {
+			counts[metric.GetLabel()[0].GetValue()] = metric.GetHistogram().GetSampleCount()
+		}
+		assert.DeepEqual(t, counts, map[string]uint64{"select": 1, "select_grants": 1})
+	})
+}
+
+func TestQueryStatementName(t *testing.T) {
+	cases := map[string]string{
+		"SELECT id, name FROM identities WHERE id = ?": "select_identities",
+		"\n\t\tINSERT INTO grants(id) VALUES (?)":      "insert_grants",
+		"UPDATE access_keys SET name = ?":              "update_access_keys",
+		"DELETE FROM groups WHERE id = ?":              "delete_groups",
+		"WITH ids AS (SELECT 1) SELECT * FROM ids":     "with",
+		"": "unknown",
+	}
+	for query, expected := range cases {
+		assert.Equal(t, queryStatementName(query), expected, query)
+	}
+}
+
+func TestPgxConfig_StatementCache(t *testing.T) {
+	dsn := "host=localhost user=infra dbname=infra"
+	type testCase struct {
+		name         string
+		dsn          string
+		size         int
+		expectedMode int
+		expectedCap  int
+	}
+
+	run := func(t *testing.T, tc testCase) {
+		cfg, err := pgxConfig(tc.dsn, NewDBOptions{PreparedStatementCacheSize: tc.size})
+		assert.NilError(t, err)
+		cache := cfg.BuildStatementCache(nil)
+		assert.Equal(t, cache.Mode(), tc.expectedMode)
+		assert.Equal(t, cache.Cap(), tc.expectedCap)
+	}
+
+	testCases := []testCase{
+		{
+			name:         "pgx default",
+			dsn:          dsn,
+			expectedMode: stmtcache.ModePrepare,
+			expectedCap:  512,
+		},
+		{
+			name:         "mode from dsn",
+			dsn:          dsn + " statement_cache_mode=describe statement_cache_capacity=64",
+			expectedMode: stmtcache.ModeDescribe,
+			expectedCap:  64,
+		},
+		{
+			name:         "size from options",
+			dsn:          dsn + " statement_cache_mode=describe",
+			size:         128,
+			expectedMode: stmtcache.ModePrepare,
+			expectedCap:  128,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
+
+func TestPreparedStatementCache(t *testing.T) {
+	patch.ModelsSymmetricKey(t)
+	opts := NewDBOptions{
+		DSN:                        database.PostgresDriver(t, "_data").DSN,
+		PreparedStatementCacheSize: 16,
+		// a single connection so that every query uses the same cache
+		MaxOpenConnections: 1,
+		MaxIdleConnections: 1,
+	}
+	db, err := NewDB(opts)
+	assert.NilError(t, err)
+	t.Cleanup(func() {
+		assert.NilError(t, db.Close())
+	})
+
+	_, err = db.Exec(`CREATE TABLE prepared_example (id bigint, name text)`)
+	assert.NilError(t, err)
+	_, err = db.Exec(`INSERT INTO prepared_example (id, name) VALUES (1, 'first')`)
+	assert.NilError(t, err)
+
+	countColumns := func(t *testing.T, tx ReadTxn) int {
+		t.Helper()
+		rows, err := tx.Query(`SELECT * FROM prepared_example WHERE id = ?`, 1)
+		assert.NilError(t, err)
+		defer rows.Close()
+		columns, err := rows.Columns()
+		assert.NilError(t, err)
+		assert.Assert(t, rows.Next())
+		dest := make([]any, len(columns))
+		for i := range dest {
+			dest[i] = new(any)
+		}
+		assert.NilError(t, rows.Scan(dest...))
+		assert.NilError(t, rows.Err())
+		return len(columns)
+	}
+
+	t.Run("across transactions", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			tx, err := db.Begin(context.Background(), nil)
+			assert.NilError(t, err)
+			assert.Equal(t, countColumns(t, tx), 2)
+			assert.NilError(t, tx.Commit())
+		}
+	})
+
+	t.Run("after a migration", func(t *testing.T) {
+		assert.Equal(t, countColumns(t, db), 2)
+
+		_, err := db.Exec(`ALTER TABLE prepared_example ADD COLUMN email text`)
+		assert.NilError(t, err)
+		clearStatementCaches(db.DB, opts.MaxIdleConnections)
+
+		assert.Equal(t, countColumns(t, db), 3)
+	})
+}
+
+// BenchmarkValidateRequestAccessKey_PreparedStatements compares the latency of
+// validating an access key, with and without the prepared statement cache.
+func BenchmarkValidateRequestAccessKey_PreparedStatements(b *testing.B) {
+	run := func(b *testing.B, dsnParams string, cacheSize int) {
+		patch.ModelsSymmetricKey(b)
+		db, err := NewDB(NewDBOptions{
+			DSN:                        database.PostgresDriver(b, "_data").DSN + dsnParams,
+			PreparedStatementCacheSize: cacheSize,
+		})
+		assert.NilError(b, err)
+		b.Cleanup(func() {
+			assert.NilError(b, db.Close())
+		})
+
+		user := &models.Identity{Name: "bench@example.com"}
+		assert.NilError(b, CreateIdentity(db, user))
+		key := &models.AccessKey{
+			IssuedFor:  user.ID,
+			ProviderID: InfraProvider(db).ID,
+			ExpiresAt:  time.Now().Add(time.Hour),
+		}
+		body, err := CreateAccessKey(db, key)
+		assert.NilError(b, err)
+
+		durations := make([]time.Duration, 0, b.N)
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			start := time.Now()
+			tx, err := db.Begin(context.Background(), nil)
+			assert.NilError(b, err)
+			_, err = ValidateRequestAccessKeyWithoutExtension(tx, body, ValidateAccessKeyOptions{})
+			assert.NilError(b, err)
+			assert.NilError(b, tx.Commit())
+			durations = append(durations, time.Since(start))
+		}
+		b.StopTimer()
+
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		b.ReportMetric(float64(durations[len(durations)/2].Nanoseconds()), "p50-ns")
+	}
+
+	b.Run("describe only", func(b *testing.B) {
+		run(b, " statement_cache_mode=describe", 0)
+	})
+	b.Run("pgx default", func(b *testing.B) {
+		run(b, "", 0)
+	})
+	b.Run("with cache size", func(b *testing.B) {
+		run(b, "", 256)
+	})
+}
+
+func TestTransaction_StatementTimeout(t *testing.T) {
+	patch.ModelsSymmetricKey(t)
+	db, err := NewDB(NewDBOptions{
+		DSN:              database.PostgresDriver(t, "_data").DSN,
+		StatementTimeout: 100 * time.Millisecond,
+	})
+	assert.NilError(t, err)
+	t.Cleanup(func() {
+		assert.NilError(t, db.Close())
+	})
+
+	tx, err := db.Begin(context.Background(), nil)
+	assert.NilError(t, err)
+	defer tx.Rollback()
+
+	start := time.Now()
+	_, err = tx.Exec("SELECT pg_sleep(5)")
+	assert.Assert(t, IsStatementTimeout(err), "wrong error: %v", err)
+	assert.Assert(t, time.Since(start) < 2*time.Second)
+
+	// queries that finish before the timeout succeed
+	tx2, err := db.Begin(context.Background(), &sql.TxOptions{ReadOnly: true})
+	assert.NilError(t, err)
+	defer tx2.Rollback()
+	_, err = tx2.Exec("SELECT pg_sleep(0.01)")
+	assert.NilError(t, err)
+}
+
+func TestTransaction_ContextCancelled(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		skipWithSQLite(t, db, "pg_sleep")
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		tx, err := db.Begin(ctx, nil)
+		assert.NilError(t, err)
+		defer tx.Rollback()
+
+		time.AfterFunc(100*time.Millisecond, cancel)
+
+		start := time.Now()
+		_, err = tx.Exec("SELECT pg_sleep(5)")
+		assert.Assert(t, errors.Is(err, context.Canceled), "wrong error: %v", err)
+		assert.Assert(t, !IsStatementTimeout(err))
+		assert.Assert(t, time.Since(start) < 2*time.Second)
+	})
+}
+
+func TestTransaction_OnCommit(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		t.Run("commit runs callbacks in order", func(t *testing.T) {
+			tx, err := db.Begin(context.Background(), nil)
+			assert.NilError(t, err)
+			defer tx.Rollback()
+
+			var calls []string
+			tx.OnCommit(func() { calls = append(calls, "first") })
+			// copies of the transaction share the callbacks
+			tx.WithOrgID(db.DefaultOrg.ID).OnCommit(func() { calls = append(calls, "second") })
+			tx.OnCommit(func() { panic("oops") })
+			tx.OnCommit(func() { calls = append(calls, "third") })
+
+			assert.Equal(t, len(calls), 0)
+			assert.NilError(t, tx.Commit())
+			assert.DeepEqual(t, calls, []string{"first", "second", "third"})
+		})
+
+		t.Run("rollback drops callbacks", func(t *testing.T) {
+			tx, err := db.Begin(context.Background(), nil)
+			assert.NilError(t, err)
+
+			var called bool
+			tx.OnCommit(func() { called = true })
+			assert.NilError(t, tx.Rollback())
+			assert.Assert(t, !called)
+		})
+
+		t.Run("failed commit drops callbacks", func(t *testing.T) {
+			skipWithSQLite(t, db, "a failed statement does not abort the transaction")
+			tx, err := db.Begin(context.Background(), nil)
+			assert.NilError(t, err)
+			defer tx.Rollback()
+
+			var called bool
+			tx.OnCommit(func() { called = true })
+			_, err = tx.Exec("SELECT not_a_column FROM organizations")
+			assert.ErrorContains(t, err, "not_a_column")
+
+			// the transaction is aborted, so commit performs a rollback
+			err = tx.Commit()
+			assert.Assert(t, err != nil)
+			assert.Assert(t, !called)
+		})
+	})
+}
+
+func TestTruncateTimes(t *testing.T) {
+	value := time.Date(2023, 1, 20, 10, 11, 12, 123456789, time.FixedZone("ET", -5*60*60))
+	expected := time.Date(2023, 1, 20, 15, 11, 12, 123000000, time.UTC)
+
+	args := []any{"name", value, &value, (*time.Time)(nil), 12}
+	actual := truncateTimes(args)
+	assert.DeepEqual(t, actual, []any{"name", expected, expected, (*time.Time)(nil), 12})
+	// the original args are not modified
+	assert.Equal(t, args[1], value)
+
+	noTimes := []any{"name", 12}
+	assert.DeepEqual(t, truncateTimes(noTimes), noTimes)
+}
+
+func TestTimesAreStoredWithTimePrecision(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+
+		identity := &models.Identity{Name: "precise@example.com"}
+		assert.NilError(t, CreateIdentity(tx, identity))
+		assert.Equal(t, identity.CreatedAt, identity.CreatedAt.Truncate(timePrecision))
+
+		identity.LastSeenAt = time.Date(2023, 1, 20, 10, 11, 12, 123456789, time.UTC)
+		assert.NilError(t, UpdateIdentityLastSeenAt(tx, identity))
+
+		actual, err := GetIdentity(tx, GetIdentityOptions{ByID: identity.ID})
+		assert.NilError(t, err)
+		assert.Assert(t, actual.CreatedAt.Equal(identity.CreatedAt), actual.CreatedAt)
+		expected := time.Date(2023, 1, 20, 10, 11, 12, 123000000, time.UTC)
+		assert.Assert(t, actual.LastSeenAt.Equal(expected), actual.LastSeenAt)
+	})
+}
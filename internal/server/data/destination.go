@@ -1,6 +1,8 @@
 package data
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
@@ -41,14 +43,87 @@ func CreateDestination(tx WriteTxn, destination *models.Destination) error {
 	if err := validateDestination(destination); err != nil {
 		return err
 	}
-	return insert(tx, (*destinationsTable)(destination))
+	if err := destination.OnInsert(); err != nil {
+		return err
+	}
+	setOrg(tx, destination)
+
+	table := (*destinationsTable)(destination)
+	query := querybuilder.New("INSERT INTO destinations (")
+	query.B(columnsForInsert(table))
+	query.B(", update_index")
+	query.B(") VALUES (")
+	query.B(placeholderForColumns(table), table.Values()...)
+	query.B(", nextval('seq_update_index'))")
+	query.B("RETURNING update_index")
+	err := tx.QueryRow(query.String(), query.Args...).Scan(&destination.UpdateIndex)
+	return handleError(err)
 }
 
+// ErrUpdateConflict is returned by the Update...IfUnmodified functions when the row
+// was modified after it was read by the caller.
+var ErrUpdateConflict = fmt.Errorf("the row was modified by another request")
+
 func UpdateDestination(tx WriteTxn, destination *models.Destination) error {
-	if err := validateDestination(destination); err != nil {
+	_, err := updateDestination(tx, destination, 0)
+	return err
+}
+
+// UpdateDestinationIfUnmodified updates the destination only when its
+// update_index is still equal to updateIndex. Returns ErrUpdateConflict when
+// the destination was modified since updateIndex was read.
+func UpdateDestinationIfUnmodified(tx WriteTxn, destination *models.Destination, updateIndex int64) error {
+	updated, err := updateDestination(tx, destination, updateIndex)
+	if err != nil {
 		return err
 	}
-	return update(tx, (*destinationsTable)(destination))
+	if !updated {
+		return ErrUpdateConflict
+	}
+	return nil
+}
+
+// UpdateDestinationLastSeenAt sets the last_seen_at of the destination. It
+// does not change the update_index, because connectors update last_seen_at
+// frequently, and that should not conflict with changes made by users.
+func UpdateDestinationLastSeenAt(tx WriteTxn, destination *models.Destination) error {
+	stmt := `
+		UPDATE destinations SET last_seen_at = ?
+		WHERE id = ? AND organization_id = ? AND deleted_at is null
+	`
+	_, err := tx.Exec(stmt, destination.LastSeenAt, destination.ID, tx.OrganizationID())
+	return handleError(err)
+}
+
+func updateDestination(tx WriteTxn, destination *models.Destination, updateIndex int64) (bool, error) {
+	if err := validateDestination(destination); err != nil {
+		return false, err
+	}
+	if err := destination.OnUpdate(); err != nil {
+		return false, err
+	}
+	setOrg(tx, destination)
+
+	table := (*destinationsTable)(destination)
+	query := querybuilder.New("UPDATE destinations SET")
+	query.B(columnsForUpdate(table), table.Values()...)
+	query.B(", update_index = nextval('seq_update_index')")
+	query.B("WHERE deleted_at is null")
+	query.B("AND id = ?", destination.ID)
+	query.B("AND organization_id = ?", tx.OrganizationID())
+	if updateIndex != 0 {
+		query.B("AND update_index = ?", updateIndex)
+	}
+	query.B("RETURNING update_index")
+
+	err := tx.QueryRow(query.String(), query.Args...).Scan(&destination.UpdateIndex)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, handleError(err)
+	}
+	return true, nil
 }
 
 type GetDestinationOptions struct {
@@ -63,11 +138,13 @@ type GetDestinationOptions struct {
 }
 
 func GetDestination(tx ReadTxn, opts GetDestinationOptions) (*models.Destination, error) {
-	destination := destinationsTable{}
+	table := &destinationsTable{}
 	query := querybuilder.New("SELECT")
-	query.B(columnsForSelect(destination))
+	query.B(columnsForSelect(table))
+	query.B(", update_index")
 	query.B("FROM destinations")
-	query.B("WHERE deleted_at is null AND organization_id = ?", tx.OrganizationID())
+	query.B("WHERE deleted_at is null")
+	query.B("AND organization_id = ?", tx.OrganizationID())
 
 	switch {
 	case opts.ByID != 0:
@@ -80,11 +157,12 @@ func GetDestination(tx ReadTxn, opts GetDestinationOptions) (*models.Destination
 		return nil, fmt.Errorf("an ID is required to GetDestination")
 	}
 
-	err := tx.QueryRow(query.String(), query.Args...).Scan(destination.ScanFields()...)
+	fields := append(table.ScanFields(), &table.UpdateIndex)
+	err := tx.QueryRow(query.String(), query.Args...).Scan(fields...)
 	if err != nil {
 		return nil, handleError(err)
 	}
-	return (*models.Destination)(&destination), nil
+	return (*models.Destination)(table), nil
 }
 
 type ListDestinationsOptions struct {
@@ -99,7 +177,8 @@ func ListDestinations(tx ReadTxn, opts ListDestinationsOptions) ([]models.Destin
 	table := destinationsTable{}
 	query := querybuilder.New("SELECT")
 	query.B(columnsForSelect(table))
-	if opts.Pagination != nil {
+	query.B(", update_index")
+	if opts.Pagination.countTotal() {
 		query.B(", count(*) OVER()")
 	}
 	query.B("FROM destinations")
@@ -126,8 +205,8 @@ func ListDestinations(tx ReadTxn, opts ListDestinationsOptions) ([]models.Destin
 		return nil, err
 	}
 	return scanRows(rows, func(d *models.Destination) []any {
-		fields := (*destinationsTable)(d).ScanFields()
-		if opts.Pagination != nil {
+		fields := append((*destinationsTable)(d).ScanFields(), &d.UpdateIndex)
+		if opts.Pagination.countTotal() {
 			fields = append(fields, &opts.Pagination.TotalCount)
 		}
 		return fields
@@ -157,6 +236,7 @@ func CountDestinationsByConnectedVersion(tx ReadTxn) ([]DestinationsCount, error
 		FROM destinations
 		WHERE deleted_at IS NULL
 		GROUP BY connected, version
+		/* all organizations */
 	`
 	rows, err := tx.Query(stmt, timeout)
 	if err != nil {
@@ -168,5 +248,5 @@ func CountDestinationsByConnectedVersion(tx ReadTxn) ([]DestinationsCount, error
 }
 
 func CountAllDestinations(tx ReadTxn) (int64, error) {
-	return countRows(tx, destinationsTable{})
+	return countRows(tx, destinationsTable{}, nil)
 }
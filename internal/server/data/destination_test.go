@@ -8,6 +8,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/opt"
 
 	"github.com/infrahq/infra/internal"
 	"github.com/infrahq/infra/internal/server/models"
@@ -49,7 +50,7 @@ func TestCreateDestination(t *testing.T) {
 				Resources:          []string{"res1", "res2"},
 				Roles:              []string{"role1", "role2"},
 			}
-			assert.DeepEqual(t, destination, expected, cmpModel)
+			assert.DeepEqual(t, destination, expected, cmpModel, cmpDestinationUpdateIndex)
 		})
 		t.Run("conflict on uniqueID", func(t *testing.T) {
 			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
@@ -71,7 +72,11 @@ func TestCreateDestination(t *testing.T) {
 			err = CreateDestination(tx, next)
 			var ucErr UniqueConstraintError
 			assert.Assert(t, errors.As(err, &ucErr))
-			expected := UniqueConstraintError{Table: "destinations", Column: "uniqueID"}
+			expected := UniqueConstraintError{
+				Table:   "destinations",
+				Column:  "uniqueID",
+				Message: "a destination with that uniqueID already exists",
+			}
 			assert.DeepEqual(t, ucErr, expected)
 		})
 		t.Run("multiple missing uniqueID", func(t *testing.T) {
@@ -141,7 +146,8 @@ func TestUpdateDestination(t *testing.T) {
 				Roles:              []string{"role1"},
 				Version:            "0.100.2",
 			}
-			assert.DeepEqual(t, actual, expected, cmpModel)
+			assert.DeepEqual(t, actual, expected, cmpModel, cmpDestinationUpdateIndex)
+			assert.Assert(t, actual.UpdateIndex > orig.UpdateIndex)
 		})
 		t.Run("multiple missing uniqueID", func(t *testing.T) {
 			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
@@ -168,6 +174,67 @@ func TestUpdateDestination(t *testing.T) {
 	})
 }
 
+var cmpDestinationUpdateIndex = cmp.FilterPath(
+	opt.PathField(models.Destination{}, "UpdateIndex"), notZeroInt64)
+
+func TestUpdateDestinationIfUnmodified(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+
+		orig := &models.Destination{
+			Name:     "example-cluster-1",
+			Kind:     "kubernetes",
+			UniqueID: "11111",
+		}
+		createDestinations(t, tx, orig)
+		readIndex := orig.UpdateIndex
+
+		// another request modifies the destination after it was read
+		concurrent := *orig
+		concurrent.Version = "0.100.3"
+		err := UpdateDestination(tx, &concurrent)
+		assert.NilError(t, err)
+		assert.Assert(t, concurrent.UpdateIndex > readIndex)
+
+		t.Run("conflict", func(t *testing.T) {
+			stale := *orig
+			stale.Version = "0.100.2"
+			err := UpdateDestinationIfUnmodified(tx, &stale, readIndex)
+			assert.ErrorIs(t, err, ErrUpdateConflict)
+
+			actual, err := GetDestination(tx, GetDestinationOptions{ByID: orig.ID})
+			assert.NilError(t, err)
+			assert.Equal(t, actual.Version, "0.100.3")
+			assert.Equal(t, actual.UpdateIndex, concurrent.UpdateIndex)
+		})
+		t.Run("success", func(t *testing.T) {
+			fresh := concurrent
+			fresh.Version = "0.100.4"
+			err := UpdateDestinationIfUnmodified(tx, &fresh, concurrent.UpdateIndex)
+			assert.NilError(t, err)
+			assert.Assert(t, fresh.UpdateIndex > concurrent.UpdateIndex)
+
+			actual, err := GetDestination(tx, GetDestinationOptions{ByID: orig.ID})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, actual, &fresh, cmpTimeWithDBPrecision, cmpopts.EquateEmpty())
+		})
+		t.Run("last seen at does not conflict", func(t *testing.T) {
+			before, err := GetDestination(tx, GetDestinationOptions{ByID: orig.ID})
+			assert.NilError(t, err)
+
+			seen := *before
+			seen.LastSeenAt = time.Now()
+			err = UpdateDestinationLastSeenAt(tx, &seen)
+			assert.NilError(t, err)
+
+			update := *before
+			update.Version = "0.100.5"
+			err = UpdateDestinationIfUnmodified(tx, &update, before.UpdateIndex)
+			assert.NilError(t, err)
+		})
+	})
+}
+
 func TestGetDestination(t *testing.T) {
 	runDBTests(t, func(t *testing.T, db *DB) {
 		destination := &models.Destination{
@@ -85,7 +85,7 @@ func DestinationCredentialsMaxUpdateIndex(tx ReadTxn, destinationID uid.ID) (int
 }
 
 func RemoveExpiredDestinationCredentials(tx WriteTxn) error {
-	_, err := tx.Exec("DELETE FROM destination_credentials WHERE request_expires_at < ?", time.Now())
+	_, err := tx.Exec("DELETE FROM destination_credentials WHERE request_expires_at < ? /* all organizations */", time.Now())
 	if err != nil {
 		return err
 	}
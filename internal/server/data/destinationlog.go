@@ -0,0 +1,104 @@
+package data
+
+import (
+	"fmt"
+
+	"github.com/infrahq/infra/internal/server/data/querybuilder"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+type destinationLogsTable models.DestinationLog
+
+func (destinationLogsTable) Table() string {
+	return "destination_logs"
+}
+
+func (l destinationLogsTable) Columns() []string {
+	return []string{"created_at", "destination_id", "id", "level", "line", "organization_id"}
+}
+
+func (l destinationLogsTable) Values() []any {
+	return []any{l.CreatedAt, l.DestinationID, l.ID, l.Level, l.Line, l.OrganizationID}
+}
+
+func (l *destinationLogsTable) ScanFields() []any {
+	return []any{&l.CreatedAt, &l.DestinationID, &l.ID, &l.Level, &l.Line, &l.OrganizationID}
+}
+
+func (l *destinationLogsTable) OnInsert() error {
+	return (*models.DestinationLog)(l).OnInsert()
+}
+
+// CreateDestinationLogs stores log entries forwarded by a connector. After the
+// entries are stored, only the most recent keep entries for each destination
+// are retained.
+func CreateDestinationLogs(tx WriteTxn, logs []models.DestinationLog, keep int) error {
+	destinations := map[uid.ID]struct{}{}
+	for i := range logs {
+		if logs[i].DestinationID == 0 {
+			return fmt.Errorf("a destination id is required")
+		}
+		if err := insert(tx, (*destinationLogsTable)(&logs[i])); err != nil {
+			return err
+		}
+		destinations[logs[i].DestinationID] = struct{}{}
+	}
+
+	for id := range destinations {
+		if err := trimDestinationLogs(tx, id, keep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func trimDestinationLogs(tx WriteTxn, destinationID uid.ID, keep int) error {
+	stmt := `
+		DELETE FROM destination_logs
+		WHERE organization_id = ? AND destination_id = ? AND id NOT IN (
+			SELECT id FROM destination_logs
+			WHERE organization_id = ? AND destination_id = ?
+			ORDER BY created_at DESC, id DESC
+			LIMIT ?
+		)`
+	orgID := tx.OrganizationID()
+	_, err := tx.Exec(stmt, orgID, destinationID, orgID, destinationID, keep)
+	return handleError(err)
+}
+
+type ListDestinationLogsOptions struct {
+	ByDestinationID uid.ID
+
+	Pagination *Pagination
+}
+
+// ListDestinationLogs returns the log entries of a destination, starting with
+// the most recent.
+func ListDestinationLogs(tx ReadTxn, opts ListDestinationLogsOptions) ([]models.DestinationLog, error) {
+	table := destinationLogsTable{}
+	query := querybuilder.New("SELECT")
+	query.B(columnsForSelect(table))
+	if opts.Pagination.countTotal() {
+		query.B(", count(*) OVER()")
+	}
+	query.B("FROM destination_logs")
+	query.B("WHERE organization_id = ?", tx.OrganizationID())
+	query.B("AND destination_id = ?", opts.ByDestinationID)
+	query.B("ORDER BY created_at DESC, id DESC")
+	if opts.Pagination != nil {
+		opts.Pagination.PaginateQuery(query)
+	}
+
+	rows, err := tx.Query(query.String(), query.Args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanRows(rows, func(l *models.DestinationLog) []any {
+		fields := (*destinationLogsTable)(l).ScanFields()
+		if opts.Pagination.countTotal() {
+			fields = append(fields, &opts.Pagination.TotalCount)
+		}
+		return fields
+	})
+}
@@ -0,0 +1,67 @@
+package data
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+func TestCreateDestinationLogs(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		dest := &models.Destination{Name: "dest", Kind: "ssh", UniqueID: "dest"}
+		assert.NilError(t, CreateDestination(db, dest))
+		other := &models.Destination{Name: "other", Kind: "ssh", UniqueID: "other"}
+		assert.NilError(t, CreateDestination(db, other))
+
+		start := time.Date(2022, 12, 27, 10, 0, 0, 0, time.UTC)
+		newLogs := func(destination *models.Destination, first, count int) []models.DestinationLog {
+			var logs []models.DestinationLog
+			for i := first; i < first+count; i++ {
+				logs = append(logs, models.DestinationLog{
+					DestinationID: destination.ID,
+					CreatedAt:     start.Add(time.Duration(i) * time.Second),
+					Level:         "error",
+					Line:          fmt.Sprintf("line %d", i),
+				})
+			}
+			return logs
+		}
+		lines := func(logs []models.DestinationLog) []string {
+			var result []string
+			for _, l := range logs {
+				result = append(result, l.Line)
+			}
+			return result
+		}
+
+		assert.NilError(t, CreateDestinationLogs(db, newLogs(other, 0, 2), 3))
+		assert.NilError(t, CreateDestinationLogs(db, newLogs(dest, 0, 2), 3))
+		assert.NilError(t, CreateDestinationLogs(db, newLogs(dest, 2, 3), 3))
+
+		t.Run("only the most recent are retained", func(t *testing.T) {
+			logs, err := ListDestinationLogs(db, ListDestinationLogsOptions{ByDestinationID: dest.ID})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, lines(logs), []string{"line 4", "line 3", "line 2"})
+		})
+		t.Run("other destinations are not trimmed", func(t *testing.T) {
+			logs, err := ListDestinationLogs(db, ListDestinationLogsOptions{ByDestinationID: other.ID})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, lines(logs), []string{"line 1", "line 0"})
+		})
+		t.Run("pagination", func(t *testing.T) {
+			p := &Pagination{Limit: 2}
+			logs, err := ListDestinationLogs(db, ListDestinationLogsOptions{ByDestinationID: dest.ID, Pagination: p})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, lines(logs), []string{"line 4", "line 3"})
+			assert.Equal(t, p.TotalCount, 3)
+		})
+		t.Run("missing destination", func(t *testing.T) {
+			err := CreateDestinationLogs(db, []models.DestinationLog{{Level: "warn"}}, 3)
+			assert.ErrorContains(t, err, "a destination id is required")
+		})
+	})
+}
@@ -0,0 +1,85 @@
+package data
+
+import (
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+// The metrics of a destination are stored in a column of the destinations
+// table, but are not part of destinationsTable, so that an update of the
+// destination never replaces a report sent by its connector.
+
+// AddDestinationMetricsReport appends report to the metrics history of the
+// destination, and removes the oldest reports so that at most keep are
+// retained. Like UpdateDestinationLastSeenAt, it does not change the
+// update_index of the destination.
+func AddDestinationMetricsReport(tx WriteTxn, destinationID uid.ID, report models.DestinationMetricsReport, keep int) error {
+	// the row is locked until the end of the transaction, so that a
+	// concurrent report is not lost.
+	stmt := `
+		SELECT metrics FROM destinations
+		WHERE id = ? AND organization_id = ? AND deleted_at is null
+		FOR UPDATE
+	`
+	var history models.DestinationMetricsHistory
+	err := tx.QueryRow(stmt, destinationID, tx.OrganizationID()).Scan(&history)
+	if err != nil {
+		return handleError(err)
+	}
+	history = append(history, report)
+	if len(history) > keep {
+		history = history[len(history)-keep:]
+	}
+
+	stmt = `
+		UPDATE destinations SET metrics = ?
+		WHERE id = ? AND organization_id = ? AND deleted_at is null
+	`
+	_, err = tx.Exec(stmt, history, destinationID, tx.OrganizationID())
+	return handleError(err)
+}
+
+// GetDestinationMetrics returns the metrics history of the destination. The
+// history is empty when the connector of the destination never reported
+// metrics.
+func GetDestinationMetrics(tx ReadTxn, destinationID uid.ID) (models.DestinationMetricsHistory, error) {
+	stmt := `
+		SELECT metrics FROM destinations
+		WHERE id = ? AND organization_id = ? AND deleted_at is null
+	`
+	var history models.DestinationMetricsHistory
+	err := tx.QueryRow(stmt, destinationID, tx.OrganizationID()).Scan(&history)
+	if err != nil {
+		return nil, handleError(err)
+	}
+	return history, nil
+}
+
+// DestinationMetrics is the metrics history of a destination in any
+// organization.
+type DestinationMetrics struct {
+	OrganizationID  uid.ID
+	DestinationID   uid.ID
+	DestinationName string
+	History         models.DestinationMetricsHistory
+}
+
+// ListAllDestinationMetrics returns the metrics history of the destinations in
+// every organization that have reported metrics, up to limit destinations.
+func ListAllDestinationMetrics(tx ReadTxn, limit int) ([]DestinationMetrics, error) {
+	stmt := `
+		SELECT organization_id, id, name, metrics
+		FROM destinations
+		WHERE deleted_at IS NULL AND metrics IS NOT NULL
+		ORDER BY organization_id, name
+		LIMIT ?
+		/* all organizations */
+	`
+	rows, err := tx.Query(stmt, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanRows(rows, func(item *DestinationMetrics) []any {
+		return []any{&item.OrganizationID, &item.DestinationID, &item.DestinationName, &item.History}
+	})
+}
@@ -0,0 +1,124 @@
+package data
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+func TestAddDestinationMetricsReport(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		dest := &models.Destination{Name: "dest", Kind: "kubernetes", UniqueID: "dest"}
+		quiet := &models.Destination{Name: "quiet", Kind: "kubernetes", UniqueID: "quiet"}
+		createDestinations(t, db, dest, quiet)
+
+		otherOrg := &models.Organization{Name: "other", Domain: "other.example.com"}
+		assert.NilError(t, CreateOrganization(db, otherOrg))
+
+		start := time.Date(2023, 2, 16, 10, 0, 0, 0, time.UTC)
+		lag := 4.5
+		report := func(i int) models.DestinationMetricsReport {
+			return models.DestinationMetricsReport{
+				ReportedAt:     start.Add(time.Duration(i) * time.Minute),
+				PeriodSeconds:  60,
+				ProxyRequests:  int64(10 * i),
+				ProxyErrors:    int64(i),
+				SyncLagSeconds: &lag,
+			}
+		}
+
+		history, err := GetDestinationMetrics(db, dest.ID)
+		assert.NilError(t, err)
+		assert.Equal(t, len(history), 0)
+
+		for i := 1; i <= 4; i++ {
+			assert.NilError(t, AddDestinationMetricsReport(db, dest.ID, report(i), 3))
+		}
+
+		history, err = GetDestinationMetrics(db, dest.ID)
+		assert.NilError(t, err)
+		expected := models.DestinationMetricsHistory{report(2), report(3), report(4)}
+		assert.DeepEqual(t, history, expected)
+
+		t.Run("does not change the update index", func(t *testing.T) {
+			before, err := GetDestination(db, GetDestinationOptions{ByID: dest.ID})
+			assert.NilError(t, err)
+			assert.NilError(t, AddDestinationMetricsReport(db, dest.ID, report(5), 3))
+			after, err := GetDestination(db, GetDestinationOptions{ByID: dest.ID})
+			assert.NilError(t, err)
+			assert.Equal(t, after.UpdateIndex, before.UpdateIndex)
+		})
+
+		t.Run("not replaced by an update of the destination", func(t *testing.T) {
+			dest.Version = "0.21.0"
+			assert.NilError(t, UpdateDestination(db, dest))
+			history, err := GetDestinationMetrics(db, dest.ID)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, history, models.DestinationMetricsHistory{report(3), report(4), report(5)})
+		})
+
+		t.Run("destination in another org", func(t *testing.T) {
+			tx := txnForTestCase(t, db, otherOrg.ID)
+			_, err := GetDestinationMetrics(tx, dest.ID)
+			assert.ErrorIs(t, err, internal.ErrNotFound)
+		})
+
+		t.Run("list all", func(t *testing.T) {
+			tx := txnForTestCase(t, db, otherOrg.ID)
+			otherDest := &models.Destination{Name: "other", Kind: "kubernetes", UniqueID: "other"}
+			createDestinations(t, tx, otherDest)
+			assert.NilError(t, AddDestinationMetricsReport(tx, otherDest.ID, report(1), 3))
+			assert.NilError(t, tx.Commit())
+
+			all, err := ListAllDestinationMetrics(db, 10)
+			assert.NilError(t, err)
+			expected := []DestinationMetrics{
+				{
+					OrganizationID:  db.DefaultOrg.ID,
+					DestinationID:   dest.ID,
+					DestinationName: "dest",
+					History:         models.DestinationMetricsHistory{report(3), report(4), report(5)},
+				},
+				{
+					OrganizationID:  otherOrg.ID,
+					DestinationID:   otherDest.ID,
+					DestinationName: "other",
+					History:         models.DestinationMetricsHistory{report(1)},
+				},
+			}
+			assert.DeepEqual(t, all, expected)
+
+			all, err = ListAllDestinationMetrics(db, 1)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, all, expected[:1])
+		})
+
+		t.Run("concurrent reports are not lost", func(t *testing.T) {
+			first := txnForTestCase(t, db, db.DefaultOrg.ID)
+			assert.NilError(t, AddDestinationMetricsReport(first, quiet.ID, report(1), 3))
+
+			done := make(chan error)
+			go func() {
+				// waits for first to commit. SQLite does not lock rows, and
+				// fails the first attempt instead.
+				done <- RetryTxn(context.Background(), db, db.DefaultOrg.ID, func(tx *Transaction) error {
+					return AddDestinationMetricsReport(tx, quiet.ID, report(2), 3)
+				})
+			}()
+
+			// give the second transaction time to read the metrics
+			time.Sleep(100 * time.Millisecond)
+			assert.NilError(t, first.Commit())
+			assert.NilError(t, <-done)
+
+			history, err := GetDestinationMetrics(db, quiet.ID)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, history, models.DestinationMetricsHistory{report(1), report(2)})
+		})
+	})
+}
@@ -0,0 +1,153 @@
+package data
+
+import (
+	"time"
+
+	"github.com/infrahq/infra/internal/server/data/querybuilder"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+type destinationUsageTable models.DestinationUsage
+
+func (destinationUsageTable) Table() string {
+	return "destination_usage"
+}
+
+func (u destinationUsageTable) Columns() []string {
+	return []string{"day", "destination_id", "distinct_users", "id", "logins", "organization_id", "proxy_requests"}
+}
+
+func (u destinationUsageTable) Values() []any {
+	return []any{u.Day, u.DestinationID, u.DistinctUsers, u.ID, u.Logins, u.OrganizationID, u.ProxyRequests}
+}
+
+func (u *destinationUsageTable) ScanFields() []any {
+	return []any{&u.Day, &u.DestinationID, &u.DistinctUsers, &u.ID, &u.Logins, &u.OrganizationID, &u.ProxyRequests}
+}
+
+func (u *destinationUsageTable) OnInsert() error {
+	return (*models.DestinationUsage)(u).OnInsert()
+}
+
+// AddDestinationProxyRequests adds count to the proxy requests of the
+// destination on the day that contains at.
+func AddDestinationProxyRequests(tx WriteTxn, destinationID uid.ID, at time.Time, count int64) error {
+	usage := &destinationUsageTable{
+		DestinationID: destinationID,
+		Day:           models.UsageDay(at),
+		ProxyRequests: count,
+	}
+	if err := usage.OnInsert(); err != nil {
+		return err
+	}
+	setOrg(tx, usage)
+
+	query := querybuilder.New("INSERT INTO destination_usage (")
+	query.B(columnsForInsert(usage))
+	query.B(") VALUES (")
+	query.B(placeholderForColumns(usage), usage.Values()...)
+	query.B(") ON CONFLICT (organization_id, destination_id, day) DO UPDATE SET")
+	query.B("proxy_requests = destination_usage.proxy_requests + excluded.proxy_requests")
+	_, err := tx.Exec(query.String(), query.Args...)
+	return handleError(err)
+}
+
+type AggregateDestinationUsageOptions struct {
+	// Day is the start of the UTC day to aggregate.
+	Day time.Time
+	// LoginAction is the action of the audit events that are counted as a
+	// login to the destination that is the target of the event.
+	LoginAction string
+}
+
+// AggregateDestinationUsage sets the logins and distinct users of every
+// destination in every organization on opts.Day, from the successful audit
+// events with opts.LoginAction. The usage of a day can be aggregated more than
+// once, each time replaces the previous result. The proxy requests are not
+// changed. AggregateDestinationUsage returns the number of destinations that
+// had any logins.
+func AggregateDestinationUsage(tx WriteTxn, opts AggregateDestinationUsageOptions) (int, error) {
+	day := models.UsageDay(opts.Day)
+
+	query := querybuilder.New("SELECT organization_id, target_id, count(*), count(DISTINCT actor_id)")
+	query.B("FROM audit_events")
+	query.B(allOrganizations)
+	query.B("WHERE action = ?", opts.LoginAction)
+	query.B("AND result = ?", models.AuditResultSuccess)
+	query.B("AND target_type = ?", "destination")
+	query.B("AND target_id <> ''")
+	query.B("AND created_at >= ? AND created_at < ?", day, day.Add(24*time.Hour))
+	query.B("GROUP BY organization_id, target_id")
+
+	rows, err := tx.Query(query.String(), query.Args...)
+	if err != nil {
+		return 0, err
+	}
+	type aggregate struct {
+		usage    models.DestinationUsage
+		targetID string
+	}
+	aggregates, err := scanRows(rows, func(a *aggregate) []any {
+		return []any{&a.usage.OrganizationID, &a.targetID, &a.usage.Logins, &a.usage.DistinctUsers}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	for _, a := range aggregates {
+		destinationID, err := uid.Parse([]byte(a.targetID))
+		if err != nil {
+			continue // not recorded by a login to a known destination
+		}
+		usage := (*destinationUsageTable)(&a.usage)
+		usage.DestinationID = destinationID
+		usage.Day = day
+		if err := usage.OnInsert(); err != nil {
+			return count, err
+		}
+
+		query := querybuilder.New("INSERT INTO destination_usage (")
+		query.B(columnsForInsert(usage))
+		query.B(") VALUES (")
+		query.B(placeholderForColumns(usage), usage.Values()...)
+		query.B(") ON CONFLICT (organization_id, destination_id, day) DO UPDATE SET")
+		query.B("logins = excluded.logins,")
+		query.B("distinct_users = excluded.distinct_users")
+		if _, err := tx.Exec(query.String(), query.Args...); err != nil {
+			return count, handleError(err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+type ListDestinationUsageOptions struct {
+	ByDestinationID uid.ID
+	// Since selects the usage of the days that start at or after this time.
+	Since time.Time
+}
+
+// ListDestinationUsage returns the usage of a destination, from the oldest to
+// the most recent day. Days without any usage are not included.
+func ListDestinationUsage(tx ReadTxn, opts ListDestinationUsageOptions) ([]models.DestinationUsage, error) {
+	table := &destinationUsageTable{}
+	query := querybuilder.New("SELECT")
+	query.B(columnsForSelect(table))
+	query.B("FROM destination_usage")
+	query.B("WHERE organization_id = ?", tx.OrganizationID())
+	query.B("AND destination_id = ?", opts.ByDestinationID)
+	if !opts.Since.IsZero() {
+		query.B("AND day >= ?", models.UsageDay(opts.Since))
+	}
+	query.B("ORDER BY day")
+
+	rows, err := tx.Query(query.String(), query.Args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanRows(rows, func(u *models.DestinationUsage) []any {
+		return (*destinationUsageTable)(u).ScanFields()
+	})
+}
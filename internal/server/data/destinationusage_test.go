@@ -0,0 +1,135 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestAggregateDestinationUsage(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		dest := &models.Destination{Name: "dest", Kind: "kubernetes", UniqueID: "dest"}
+		other := &models.Destination{Name: "other", Kind: "kubernetes", UniqueID: "other"}
+		createDestinations(t, db, dest, other)
+
+		otherOrg := &models.Organization{Name: "other", Domain: "other.example.com"}
+		assert.NilError(t, CreateOrganization(db, otherOrg))
+
+		day1 := time.Date(2023, 2, 6, 0, 0, 0, 0, time.UTC)
+		day2 := day1.Add(24 * time.Hour)
+		alice, bob := uid.New(), uid.New()
+
+		login := func(tx WriteTxn, at time.Time, actorID uid.ID, destination *models.Destination, result string) {
+			t.Helper()
+			event := &models.AuditEvent{
+				CreatedAt:  at,
+				ActorID:    actorID,
+				Action:     "destination.login",
+				TargetType: "destination",
+				TargetID:   destination.ID.String(),
+				TargetName: destination.Name,
+				Result:     result,
+			}
+			assert.NilError(t, CreateAuditEvent(tx, event))
+		}
+		// day 1: alice logs in to dest twice, bob once, and bob fails once
+		login(db, day1.Add(time.Hour), alice, dest, models.AuditResultSuccess)
+		login(db, day1.Add(2*time.Hour), alice, dest, models.AuditResultSuccess)
+		login(db, day1.Add(23*time.Hour+59*time.Minute), bob, dest, models.AuditResultSuccess)
+		login(db, day1.Add(3*time.Hour), bob, dest, models.AuditResultFailure)
+		// day 1: bob logs in to other
+		login(db, day1.Add(4*time.Hour), bob, other, models.AuditResultSuccess)
+		// day 2: alice logs in to dest at the first instant of the day
+		login(db, day2, alice, dest, models.AuditResultSuccess)
+		// an event for a different action is not counted
+		assert.NilError(t, CreateAuditEvent(db, &models.AuditEvent{
+			CreatedAt:  day1.Add(time.Hour),
+			Action:     "grant.create",
+			TargetType: "destination",
+			TargetID:   dest.ID.String(),
+			Result:     models.AuditResultSuccess,
+		}))
+
+		// a destination in another org
+		tx := txnForTestCase(t, db, otherOrg.ID)
+		otherOrgDest := &models.Destination{Name: "dest", Kind: "kubernetes", UniqueID: "dest"}
+		createDestinations(t, tx, otherOrgDest)
+		login(tx, day1.Add(time.Hour), alice, otherOrgDest, models.AuditResultSuccess)
+		assert.NilError(t, tx.Commit())
+
+		assert.NilError(t, AddDestinationProxyRequests(db, dest.ID, day1.Add(time.Hour), 10))
+		assert.NilError(t, AddDestinationProxyRequests(db, dest.ID, day1.Add(5*time.Hour), 5))
+
+		aggregate := func(day time.Time) int {
+			t.Helper()
+			count, err := AggregateDestinationUsage(db, AggregateDestinationUsageOptions{
+				Day:         day,
+				LoginAction: "destination.login",
+			})
+			assert.NilError(t, err)
+			return count
+		}
+		assert.Equal(t, aggregate(day1), 3)
+		assert.Equal(t, aggregate(day2), 1)
+		// aggregating again replaces the result
+		assert.Equal(t, aggregate(day1.Add(12*time.Hour)), 3)
+
+		list := func(tx ReadTxn, destination *models.Destination) []models.DestinationUsage {
+			t.Helper()
+			usage, err := ListDestinationUsage(tx, ListDestinationUsageOptions{ByDestinationID: destination.ID})
+			assert.NilError(t, err)
+			for i := range usage {
+				usage[i].ID = 0
+				usage[i].Day = usage[i].Day.UTC()
+			}
+			return usage
+		}
+		orgMember := models.OrganizationMember{OrganizationID: db.DefaultOrg.ID}
+		destUsage := []models.DestinationUsage{
+			{OrganizationMember: orgMember, DestinationID: dest.ID, Day: day1, Logins: 3, DistinctUsers: 2, ProxyRequests: 15},
+			{OrganizationMember: orgMember, DestinationID: dest.ID, Day: day2, Logins: 1, DistinctUsers: 1},
+		}
+		assert.DeepEqual(t, list(db, dest), destUsage)
+
+		expected := []models.DestinationUsage{
+			{OrganizationMember: orgMember, DestinationID: other.ID, Day: day1, Logins: 1, DistinctUsers: 1},
+		}
+		assert.DeepEqual(t, list(db, other), expected)
+
+		tx = txnForTestCase(t, db, otherOrg.ID)
+		expected = []models.DestinationUsage{
+			{
+				OrganizationMember: models.OrganizationMember{OrganizationID: otherOrg.ID},
+				DestinationID:      otherOrgDest.ID,
+				Day:                day1,
+				Logins:             1,
+				DistinctUsers:      1,
+			},
+		}
+		assert.DeepEqual(t, list(tx, otherOrgDest), expected)
+
+		t.Run("since", func(t *testing.T) {
+			usage, err := ListDestinationUsage(db, ListDestinationUsageOptions{
+				ByDestinationID: dest.ID,
+				Since:           day2.Add(time.Hour),
+			})
+			assert.NilError(t, err)
+			assert.Equal(t, len(usage), 1)
+			assert.Assert(t, usage[0].Day.Equal(day2))
+		})
+
+		t.Run("the usage is kept after the events are purged", func(t *testing.T) {
+			deleted, err := PurgeAuditEvents(db, PurgeAuditEventsOptions{OlderThan: day2.Add(time.Hour), Limit: 100})
+			assert.NilError(t, err)
+			assert.Equal(t, deleted, int64(8))
+
+			// aggregating a day without events does not remove its usage
+			assert.Equal(t, aggregate(day1), 0)
+			assert.DeepEqual(t, list(db, dest), destUsage)
+		})
+	})
+}
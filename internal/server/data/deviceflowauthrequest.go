@@ -17,15 +17,15 @@ func (d deviceFlowAuthRequestTable) Table() string {
 }
 
 func (d deviceFlowAuthRequestTable) Columns() []string {
-	return []string{"created_at", "deleted_at", "device_code", "expires_at", "id", "updated_at", "user_code", "user_id", "provider_id"}
+	return []string{"created_at", "deleted_at", "device_code", "expires_at", "id", "updated_at", "user_code", "user_id", "provider_id", "denied", "last_polled_at"}
 }
 
 func (d deviceFlowAuthRequestTable) Values() []any {
-	return []any{d.CreatedAt, d.DeletedAt, d.DeviceCode, d.ExpiresAt, d.ID, d.UpdatedAt, d.UserCode, d.UserID, d.ProviderID}
+	return []any{d.CreatedAt, d.DeletedAt, d.DeviceCode, d.ExpiresAt, d.ID, d.UpdatedAt, d.UserCode, d.UserID, d.ProviderID, d.Denied, d.LastPolledAt}
 }
 
 func (d *deviceFlowAuthRequestTable) ScanFields() []any {
-	return []any{&d.CreatedAt, &d.DeletedAt, &d.DeviceCode, &d.ExpiresAt, &d.ID, &d.UpdatedAt, &d.UserCode, &d.UserID, &d.ProviderID}
+	return []any{&d.CreatedAt, &d.DeletedAt, &d.DeviceCode, &d.ExpiresAt, &d.ID, &d.UpdatedAt, &d.UserCode, &d.UserID, &d.ProviderID, &d.Denied, &d.LastPolledAt}
 }
 
 // TODO: use regular if conditions here. There's no benefit to using the validate functions.
@@ -107,3 +107,25 @@ func ApproveDeviceFlowAuthRequest(tx WriteTxn, dfarID uid.ID, userID uid.ID, pro
 	_, err := tx.Exec(query.String(), query.Args...)
 	return handleError(err)
 }
+
+// DenyDeviceFlowAuthRequest marks the request as denied, so that the device
+// will not receive an access key.
+func DenyDeviceFlowAuthRequest(tx WriteTxn, dfarID uid.ID) error {
+	query := querybuilder.New("UPDATE device_flow_auth_requests")
+	query.B("SET denied = ?", true)
+	query.B("WHERE id = ?", dfarID)
+
+	_, err := tx.Exec(query.String(), query.Args...)
+	return handleError(err)
+}
+
+// SetDeviceFlowAuthRequestLastPolledAt records the time the device last
+// checked the status of the request.
+func SetDeviceFlowAuthRequestLastPolledAt(tx WriteTxn, dfarID uid.ID, polledAt time.Time) error {
+	query := querybuilder.New("UPDATE device_flow_auth_requests")
+	query.B("SET last_polled_at = ?", polledAt)
+	query.B("WHERE id = ?", dfarID)
+
+	_, err := tx.Exec(query.String(), query.Args...)
+	return handleError(err)
+}
@@ -37,3 +37,32 @@ func TestDeleteExpiredDeviceFlowAuthRequests(t *testing.T) {
 	_, err = GetDeviceFlowAuthRequest(tx, GetDeviceFlowAuthRequestOptions{ByUserCode: "LMNPQRST"})
 	assert.NilError(t, err)
 }
+
+func TestDenyDeviceFlowAuthRequest(t *testing.T) {
+	tx := setupDB(t)
+	dfar := &models.DeviceFlowAuthRequest{
+		UserCode:   "BCDFGHJK",
+		DeviceCode: "abcdefghijklmnopqrstuvwxyz123456789000",
+		ExpiresAt:  time.Now().Add(10 * time.Minute),
+	}
+	err := CreateDeviceFlowAuthRequest(tx, dfar)
+	assert.NilError(t, err)
+
+	actual, err := GetDeviceFlowAuthRequest(tx, GetDeviceFlowAuthRequestOptions{ByUserCode: "BCDFGHJK"})
+	assert.NilError(t, err)
+	assert.Equal(t, actual.Denied, false)
+	assert.Assert(t, actual.LastPolledAt == nil)
+
+	err = DenyDeviceFlowAuthRequest(tx, dfar.ID)
+	assert.NilError(t, err)
+
+	polledAt := time.Date(2023, 1, 23, 10, 11, 12, 0, time.UTC)
+	err = SetDeviceFlowAuthRequestLastPolledAt(tx, dfar.ID, polledAt)
+	assert.NilError(t, err)
+
+	actual, err = GetDeviceFlowAuthRequest(tx, GetDeviceFlowAuthRequestOptions{ByDeviceCode: dfar.DeviceCode})
+	assert.NilError(t, err)
+	assert.Equal(t, actual.Denied, true)
+	assert.Assert(t, actual.LastPolledAt != nil)
+	assert.Assert(t, actual.LastPolledAt.Equal(polledAt), actual.LastPolledAt)
+}
@@ -0,0 +1,121 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"modernc.org/sqlite"
+)
+
+const (
+	// DriverPostgres is the default database driver.
+	DriverPostgres = "postgres"
+	// DriverSQLite stores the database in a single file. It is intended for
+	// evaluating infra, and does not support every feature of DriverPostgres.
+	// See docs/dev/sqlite.md.
+	DriverSQLite = "sqlite"
+)
+
+// ValidateDriver returns an error if driver is not a supported database
+// driver. An empty driver is DriverPostgres.
+func ValidateDriver(driver string) error {
+	switch driver {
+	case "", DriverPostgres, DriverSQLite:
+		return nil
+	default:
+		return fmt.Errorf("unsupported database driver %q, must be one of: %v, %v",
+			driver, DriverPostgres, DriverSQLite)
+	}
+}
+
+// dialect rewrites the Postgres specific parts of a query for a database
+// other than Postgres. Queries are written for Postgres, so a nil dialect
+// sends every query to the database unchanged.
+type dialect interface {
+	// rewriteQuery returns query with any Postgres specific syntax replaced,
+	// including the ? placeholders. conn is the connection, or the
+	// transaction, that will run the query with args.
+	rewriteQuery(ctx context.Context, conn sqlConn, query string, args []any) (string, error)
+}
+
+// sqlConn is implemented by both sql.DB and sql.Tx.
+type sqlConn interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// rewriteQuery prepares query to be sent to the database by applying the
+// dialect, or by replacing the placeholders when the database is Postgres.
+func rewriteQuery(ctx context.Context, d dialect, conn sqlConn, query string, args []any) (string, error) {
+	if d == nil {
+		return rewriteQueryPlaceholders(query, len(args)), nil
+	}
+	return d.rewriteQuery(ctx, conn, query, args)
+}
+
+// timePrecision is the precision of the times stored in the database. It is
+// the same as api.TimePrecision, so that a time in an API response is the same
+// before and after it is read from the database.
+const timePrecision = time.Millisecond
+
+// truncateTimes returns args with every time.Time truncated to timePrecision
+// and converted to UTC. args is not modified.
+func truncateTimes(args []any) []any {
+	var result []any
+	for i, arg := range args {
+		var value time.Time
+		switch arg := arg.(type) {
+		case time.Time:
+			value = arg
+		case *time.Time:
+			if arg == nil {
+				continue
+			}
+			value = *arg
+		default:
+			continue
+		}
+		if result == nil {
+			result = append([]any{}, args...)
+		}
+		result[i] = value.UTC().Truncate(timePrecision)
+	}
+	if result == nil {
+		return args
+	}
+	return result
+}
+
+// errNoActiveTransaction is returned by a dialect for statements, like
+// SAVEPOINT, that are only valid in a transaction.
+var errNoActiveTransaction = errors.New("there is no transaction in progress")
+
+// isNoActiveTransaction returns true if err was caused by a statement that
+// can only be used in a transaction.
+func isNoActiveTransaction(err error) bool {
+	return errors.Is(err, errNoActiveTransaction) ||
+		isPgErrorCode(err, pgerrcode.NoActiveSQLTransaction)
+}
+
+// isSQLiteErrorCode returns true if err is a SQLite error with the code.
+// Extended result codes match their primary code.
+func isSQLiteErrorCode(err error, code int) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code()&0xff == code
+}
+
+// dialectOf returns the dialect of the database used by tx.
+func dialectOf(tx any) dialect {
+	switch tx := tx.(type) {
+	case *Transaction:
+		return tx.dialect
+	case *DB:
+		return tx.dialect
+	default:
+		return nil
+	}
+}
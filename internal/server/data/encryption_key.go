@@ -1,9 +1,12 @@
 package data
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	mathrand "math/rand"
+	"strings"
+	"time"
 
 	"github.com/infrahq/secrets"
 
@@ -103,6 +106,20 @@ func loadDBKey(tx StdlibTxn, provider EncryptionKeyProvider, rootKeyId string) e
 	return nil
 }
 
+// VerifyDBKey checks that the root key rootKeyID can decrypt the database
+// key. It does not replace the key used to encrypt fields, so it can be used
+// while the server is running, ex: to check the root key after it is rotated.
+func VerifyDBKey(tx StdlibTxn, provider EncryptionKeyProvider, rootKeyID string) error {
+	keyRec, err := GetEncryptionKeyByName(tx, dbKeyName)
+	if err != nil {
+		return err
+	}
+	if _, err := provider.DecryptDataKey(rootKeyID, keyRec.Encrypted); err != nil {
+		return fmt.Errorf("decrypt db key: %w", err)
+	}
+	return nil
+}
+
 func createDBKey(tx StdlibTxn, provider EncryptionKeyProvider, rootKeyId string) error {
 	sKey, err := provider.GenerateDataKey(rootKeyId)
 	if err != nil {
@@ -122,3 +139,199 @@ func createDBKey(tx StdlibTxn, provider EncryptionKeyProvider, rootKeyId string)
 	models.SymmetricKey = sKey
 	return nil
 }
+
+// nextDBKeyName is the name of the key that replaces the dbkey while the key
+// is being rotated.
+var nextDBKeyName = "dbkey-next"
+
+// encryptedColumns are the columns that store a models.EncryptedAtRest value,
+// with the primary key of their table.
+var encryptedColumns = []struct {
+	table  string
+	keys   []string
+	column string
+}{
+	{table: "destination_credentials", keys: []string{"id"}, column: "bearer_token"},
+	{table: "idempotency_keys", keys: []string{"id"}, column: "response_body"},
+	{table: "provider_users", keys: []string{"provider_id", "identity_id"}, column: "access_token"},
+	{table: "provider_users", keys: []string{"provider_id", "identity_id"}, column: "refresh_token"},
+	{table: "providers", keys: []string{"id"}, column: "client_secret"},
+	{table: "providers", keys: []string{"id"}, column: "private_key"},
+	{table: "settings", keys: []string{"id"}, column: "private_jwk"},
+	{table: "user_mfa", keys: []string{"id"}, column: "totp_secret"},
+	{table: "webhooks", keys: []string{"id"}, column: "secret"},
+}
+
+// RotateDBKey replaces the key used to encrypt fields in the database with a
+// new data key from provider, encrypted by the root key rootKeyID. Every
+// encrypted field is re-encrypted with the new key, batchSize rows at a time.
+// Fields that were stored before they were encrypted are encrypted as well.
+//
+// The server must not be running while the key is rotated. If the rotation
+// is interrupted, calling RotateDBKey again continues it with the same key.
+func RotateDBKey(db *DB, provider EncryptionKeyProvider, rootKeyID string, batchSize int) error {
+	current, err := GetEncryptionKeyByName(db, dbKeyName)
+	if err != nil {
+		return fmt.Errorf("get db key: %w", err)
+	}
+	currentKey, err := provider.DecryptDataKey(current.RootKeyID, current.Encrypted)
+	if err != nil {
+		return fmt.Errorf("decrypt db key: %w", err)
+	}
+
+	next, nextKey, err := getOrCreateNextDBKey(db, provider, rootKeyID)
+	if err != nil {
+		return err
+	}
+
+	models.SymmetricKey = nextKey
+	models.DecryptionKeys = []*secrets.SymmetricKey{currentKey}
+	models.AllowPlaintext = true
+	defer func() {
+		models.DecryptionKeys = nil
+		models.AllowPlaintext = false
+	}()
+
+	for _, col := range encryptedColumns {
+		if err := reencryptColumn(db, col.table, col.keys, col.column, batchSize); err != nil {
+			return fmt.Errorf("re-encrypt %v.%v: %w", col.table, col.column, err)
+		}
+	}
+
+	tx, err := db.Begin(context.TODO(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	_, err = tx.Exec(`UPDATE encryption_keys SET deleted_at = ?, updated_at = ? WHERE id = ?`, now, now, current.ID)
+	if err != nil {
+		return fmt.Errorf("delete previous db key: %w", handleError(err))
+	}
+	_, err = tx.Exec(`UPDATE encryption_keys SET name = ?, updated_at = ? WHERE id = ?`, dbKeyName, now, next.ID)
+	if err != nil {
+		return fmt.Errorf("rename db key: %w", handleError(err))
+	}
+	return tx.Commit()
+}
+
+// CheckDBKeyRotation returns an error if a rotation of the database key was
+// interrupted. Some secrets are encrypted with the next key until the rotation
+// is completed, so the server must not start.
+func CheckDBKeyRotation(tx StdlibTxn) error {
+	_, err := GetEncryptionKeyByName(tx, nextDBKeyName)
+	switch {
+	case err == nil:
+		return fmt.Errorf("a rotation of the database encryption key was interrupted, run 'infra server --rotate-db-encryption-key' again to complete it")
+	case errors.Is(err, internal.ErrNotFound):
+		return nil
+	default:
+		return err
+	}
+}
+
+func getOrCreateNextDBKey(tx StdlibTxn, provider EncryptionKeyProvider, rootKeyID string) (*models.EncryptionKey, *secrets.SymmetricKey, error) {
+	keyRec, err := GetEncryptionKeyByName(tx, nextDBKeyName)
+	switch {
+	case err == nil:
+		sKey, err := provider.DecryptDataKey(keyRec.RootKeyID, keyRec.Encrypted)
+		if err != nil {
+			return nil, nil, fmt.Errorf("decrypt next db key: %w", err)
+		}
+		return keyRec, sKey, nil
+	case !errors.Is(err, internal.ErrNotFound):
+		return nil, nil, err
+	}
+
+	sKey, err := provider.GenerateDataKey(rootKeyID)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyRec = &models.EncryptionKey{
+		Name:      nextDBKeyName,
+		Encrypted: sKey.Encrypted,
+		Algorithm: sKey.Algorithm,
+		RootKeyID: sKey.RootKeyID,
+	}
+	if err := CreateEncryptionKey(tx, keyRec); err != nil {
+		return nil, nil, err
+	}
+	return keyRec, sKey, nil
+}
+
+// reencryptColumn reads every non-empty value of column, and writes it back
+// so that it is encrypted with models.SymmetricKey. Each batch of rows is
+// updated in its own transaction.
+func reencryptColumn(db *DB, table string, keys []string, column string, batchSize int) error {
+	where := make([]string, len(keys))
+	for i, key := range keys {
+		where[i] = key + " = ?"
+	}
+	// the table and column names are trusted string literals
+	selectStmt := fmt.Sprintf(`SELECT %s, %s FROM %s WHERE %s IS NOT NULL AND %s <> '' ORDER BY %s LIMIT ? OFFSET ?`,
+		strings.Join(keys, ", "), column, table, column, column, strings.Join(keys, ", "))
+	updateStmt := fmt.Sprintf(`UPDATE %s SET %s = ? WHERE %s`,
+		table, column, strings.Join(where, " AND "))
+
+	for offset := 0; ; offset += batchSize {
+		tx, err := db.Begin(context.TODO(), nil)
+		if err != nil {
+			return err
+		}
+		count, err := reencryptBatch(tx, selectStmt, updateStmt, len(keys), batchSize, offset)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		if count < batchSize {
+			return nil
+		}
+	}
+}
+
+func reencryptBatch(tx *Transaction, selectStmt, updateStmt string, numKeys, limit, offset int) (int, error) {
+	type row struct {
+		keys  []any
+		value models.EncryptedAtRest
+	}
+	rows, err := tx.Query(selectStmt, limit, offset)
+	if err != nil {
+		return 0, err
+	}
+	var batch []row
+	for rows.Next() {
+		r := row{keys: make([]any, numKeys)}
+		keys := make([]int64, numKeys)
+		fields := make([]any, 0, numKeys+1)
+		for i := range keys {
+			fields = append(fields, &keys[i])
+		}
+		fields = append(fields, &r.value)
+		if err := rows.Scan(fields...); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		for i, key := range keys {
+			r.keys[i] = key
+		}
+		batch = append(batch, r)
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, r := range batch {
+		args := append([]any{r.value}, r.keys...)
+		if _, err := tx.Exec(updateStmt, args...); err != nil {
+			return 0, handleError(err)
+		}
+	}
+	return len(batch), nil
+}
@@ -4,6 +4,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/infrahq/secrets"
 	"gotest.tools/v3/assert"
 
 	"github.com/infrahq/infra/internal"
@@ -47,6 +49,7 @@ func TestEncryptionKeys(t *testing.T) {
 		})
 
 		t.Run("get by name", func(t *testing.T) {
+			skipWithSQLite(t, db, "a transaction does not see rows committed after it started")
 			err := CreateEncryptionKey(db, &models.EncryptionKey{
 				KeyID:     12,
 				Name:      "second",
@@ -75,3 +78,131 @@ func TestEncryptionKeys(t *testing.T) {
 		})
 	})
 }
+
+func TestRotateDBKey(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		storage := secrets.NewFileSecretProviderFromConfig(secrets.FileConfig{Path: t.TempDir()})
+		keyProvider := secrets.NewNativeKeyProvider(storage)
+
+		settings, err := GetSettings(db)
+		assert.NilError(t, err)
+
+		// replace the key from setup with a dbkey, and encrypt the existing
+		// settings with it
+		assert.NilError(t, createDBKey(db, keyProvider, "first"))
+		_, err = db.Exec(`UPDATE settings SET private_jwk = ?`, settings.PrivateJWK)
+		assert.NilError(t, err)
+		previousKey := models.SymmetricKey
+
+		provider := &models.Provider{
+			Name:         "okta",
+			Kind:         models.ProviderKindOkta,
+			ClientSecret: "the-client-secret",
+		}
+		assert.NilError(t, CreateProvider(db, provider))
+
+		user := &models.Identity{Name: "mfa@example.com"}
+		createIdentities(t, db, user)
+		mfa := &models.UserMFA{IdentityID: user.ID, TOTPSecret: "JBSWY3DPEHPK3PXP"}
+		assert.NilError(t, CreateUserMFA(db, mfa))
+
+		// a secret that was stored before it was encrypted
+		_, err = db.Exec(`UPDATE providers SET private_key = ? WHERE id = ?`, "plaintext-key", provider.ID)
+		assert.NilError(t, err)
+
+		readSecrets := func(t *testing.T) (clientSecret, privateKey, totpSecret string) {
+			t.Helper()
+			err := db.QueryRow(`SELECT client_secret, private_key FROM providers WHERE id = ?`, provider.ID).
+				Scan(&clientSecret, &privateKey)
+			assert.NilError(t, err)
+			err = db.QueryRow(`SELECT totp_secret FROM user_mfa WHERE id = ?`, mfa.ID).Scan(&totpSecret)
+			assert.NilError(t, err)
+			return clientSecret, privateKey, totpSecret
+		}
+		beforeClientSecret, _, _ := readSecrets(t)
+
+		// a secret that is not encrypted is only read by the rotation
+		_, err = GetProvider(db, GetProviderOptions{ByID: provider.ID})
+		assert.ErrorContains(t, err, "secret field is not encrypted")
+
+		// an interrupted rotation is continued with the same next key
+		_, nextKey, err := getOrCreateNextDBKey(db, keyProvider, "second")
+		assert.NilError(t, err)
+		assert.ErrorContains(t, CheckDBKeyRotation(db), "rotation of the database encryption key was interrupted")
+		models.SymmetricKey = previousKey
+
+		err = RotateDBKey(db, keyProvider, "second", 1)
+		assert.NilError(t, err)
+		assert.Assert(t, models.SymmetricKey != previousKey)
+		assert.DeepEqual(t, models.SymmetricKey, nextKey, cmpopts.IgnoreUnexported(secrets.SymmetricKey{}))
+		assert.Equal(t, len(models.DecryptionKeys), 0)
+		assert.Assert(t, !models.AllowPlaintext)
+		assert.NilError(t, CheckDBKeyRotation(db))
+
+		clientSecret, privateKey, totpSecret := readSecrets(t)
+		assert.Assert(t, clientSecret != beforeClientSecret)
+		for _, value := range []string{clientSecret, privateKey, totpSecret} {
+			assert.Assert(t, models.IsSealed(value), value)
+			_, err := secrets.Unseal(previousKey, []byte(value))
+			assert.ErrorContains(t, err, "wrong key was used")
+		}
+
+		actual, err := GetProvider(db, GetProviderOptions{ByID: provider.ID})
+		assert.NilError(t, err)
+		assert.Equal(t, string(actual.ClientSecret), "the-client-secret")
+		assert.Equal(t, string(actual.PrivateKey), "plaintext-key")
+
+		actualMFA, err := GetUserMFA(db, user.ID)
+		assert.NilError(t, err)
+		assert.Equal(t, string(actualMFA.TOTPSecret), "JBSWY3DPEHPK3PXP")
+
+		actualSettings, err := GetSettings(db)
+		assert.NilError(t, err)
+		assert.Equal(t, string(actualSettings.PrivateJWK), string(settings.PrivateJWK))
+
+		t.Run("new key is loaded", func(t *testing.T) {
+			keyRec, err := GetEncryptionKeyByName(db, dbKeyName)
+			assert.NilError(t, err)
+			assert.Equal(t, keyRec.RootKeyID, "second")
+
+			_, err = GetEncryptionKeyByName(db, nextDBKeyName)
+			assert.ErrorIs(t, err, internal.ErrNotFound)
+
+			rotatedKey := models.SymmetricKey
+			models.SymmetricKey = nil
+			assert.NilError(t, loadDBKey(db, keyProvider, "second"))
+			assert.DeepEqual(t, models.SymmetricKey, rotatedKey, cmpopts.IgnoreUnexported(secrets.SymmetricKey{}))
+
+			actual, err := GetProvider(db, GetProviderOptions{ByID: provider.ID})
+			assert.NilError(t, err)
+			assert.Equal(t, string(actual.ClientSecret), "the-client-secret")
+		})
+	})
+}
+
+func TestVerifyDBKey(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		dir := t.TempDir()
+		storage := secrets.NewFileSecretProviderFromConfig(secrets.FileConfig{Path: dir})
+		keyProvider := secrets.NewNativeKeyProvider(storage)
+
+		orig := models.SymmetricKey
+		t.Cleanup(func() {
+			models.SymmetricKey = orig
+		})
+
+		assert.NilError(t, createDBKey(db, keyProvider, "root"))
+		loaded := models.SymmetricKey
+
+		assert.NilError(t, VerifyDBKey(db, keyProvider, "root"))
+
+		// a different root key can not decrypt the db key
+		otherKey := make([]byte, 32)
+		assert.NilError(t, storage.SetSecret("other", otherKey))
+		err := VerifyDBKey(db, keyProvider, "other")
+		assert.ErrorContains(t, err, "decrypt db key")
+
+		// the key used by the server is not replaced
+		assert.Equal(t, models.SymmetricKey, loaded)
+	})
+}
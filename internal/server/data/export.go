@@ -0,0 +1,91 @@
+package data
+
+import (
+	"github.com/infrahq/infra/internal/server/data/querybuilder"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+// The ForEach functions call fn with every row of a table in the organization
+// of tx, in order of ID. Deleted rows are excluded. Rows are read one at a
+// time, so the ForEach functions can be used to export all the data of an
+// organization without holding it in memory. To get a consistent view of the
+// organization use a transaction with the repeatable read isolation level.
+
+// ForEachIdentity calls fn with each identity in the organization.
+func ForEachIdentity(tx ReadTxn, fn func(models.Identity) error) error {
+	return forEachInOrg(tx, &identitiesTable{}, func(i *models.Identity) []any {
+		return (*identitiesTable)(i).ScanFields()
+	}, fn)
+}
+
+// ForEachGroup calls fn with each group in the organization.
+func ForEachGroup(tx ReadTxn, fn func(models.Group) error) error {
+	return forEachInOrg(tx, &groupsTable{}, func(g *models.Group) []any {
+		return (*groupsTable)(g).ScanFields()
+	}, fn)
+}
+
+// ForEachGrant calls fn with each grant in the organization.
+func ForEachGrant(tx ReadTxn, fn func(models.Grant) error) error {
+	return forEachInOrg(tx, &grantsTable{}, func(g *models.Grant) []any {
+		return (*grantsTable)(g).ScanFields()
+	}, fn)
+}
+
+// ForEachProvider calls fn with each provider in the organization.
+func ForEachProvider(tx ReadTxn, fn func(models.Provider) error) error {
+	return forEachInOrg(tx, &providersTable{}, func(p *models.Provider) []any {
+		return (*providersTable)(p).ScanFields()
+	}, fn)
+}
+
+// ForEachDestination calls fn with each destination in the organization.
+func ForEachDestination(tx ReadTxn, fn func(models.Destination) error) error {
+	return forEachInOrg(tx, &destinationsTable{}, func(d *models.Destination) []any {
+		return (*destinationsTable)(d).ScanFields()
+	}, fn)
+}
+
+func forEachInOrg[T any](tx ReadTxn, table Selectable, fields func(*T) []any, fn func(T) error) error {
+	query := querybuilder.New("SELECT")
+	query.B(columnsForSelect(table))
+	query.B("FROM")
+	query.B(table.Table())
+	query.B("WHERE deleted_at is null")
+	query.B("AND organization_id = ?", tx.OrganizationID())
+	query.B("ORDER BY id")
+
+	rows, err := tx.Query(query.String(), query.Args...)
+	if err != nil {
+		return err
+	}
+	return forEachRow(rows, fields, fn)
+}
+
+// GroupMembership is the membership of a user in a group.
+type GroupMembership struct {
+	GroupID    uid.ID
+	IdentityID uid.ID
+}
+
+// ForEachGroupMembership calls fn with each membership of a group in the
+// organization, in order of group ID and then identity ID.
+func ForEachGroupMembership(tx ReadTxn, fn func(GroupMembership) error) error {
+	stmt := `
+		SELECT identities_groups.group_id, identities_groups.identity_id
+		FROM identities_groups
+		JOIN groups ON groups.id = identities_groups.group_id
+		JOIN identities ON identities.id = identities_groups.identity_id
+		WHERE groups.deleted_at is null
+		AND identities.deleted_at is null
+		AND groups.organization_id = ?
+		ORDER BY identities_groups.group_id, identities_groups.identity_id`
+	rows, err := tx.Query(stmt, tx.OrganizationID())
+	if err != nil {
+		return err
+	}
+	return forEachRow(rows, func(m *GroupMembership) []any {
+		return []any{&m.GroupID, &m.IdentityID}
+	}, fn)
+}
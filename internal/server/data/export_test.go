@@ -0,0 +1,61 @@
+package data
+
+import (
+	"sort"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestForEachGroupMembership(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+
+		otherOrg := &models.Organization{Name: "Other", Domain: "other.example.org"}
+		assert.NilError(t, CreateOrganization(tx, otherOrg))
+
+		var (
+			alice     = models.Identity{Name: "alice@example.com"}
+			bob       = models.Identity{Name: "bob@example.com"}
+			everyone  = models.Group{Name: "Everyone"}
+			engineers = models.Group{Name: "Engineering"}
+			deleted   = models.Group{Name: "Deleted"}
+		)
+		createIdentities(t, tx, &alice, &bob)
+		createGroups(t, tx, &everyone, &engineers, &deleted)
+		assert.NilError(t, AddUsersToGroup(tx, everyone.ID, []uid.ID{alice.ID, bob.ID}))
+		assert.NilError(t, AddUsersToGroup(tx, engineers.ID, []uid.ID{bob.ID}))
+		assert.NilError(t, AddUsersToGroup(tx, deleted.ID, []uid.ID{alice.ID}))
+		assert.NilError(t, DeleteGroup(tx, deleted.ID))
+
+		otherTx := tx.WithOrgID(otherOrg.ID)
+		otherUser := models.Identity{Name: "carol@example.com"}
+		otherGroup := models.Group{Name: "Everyone"}
+		createIdentities(t, otherTx, &otherUser)
+		createGroups(t, otherTx, &otherGroup)
+		assert.NilError(t, AddUsersToGroup(otherTx, otherGroup.ID, []uid.ID{otherUser.ID}))
+
+		var actual []GroupMembership
+		err := ForEachGroupMembership(tx, func(m GroupMembership) error {
+			actual = append(actual, m)
+			return nil
+		})
+		assert.NilError(t, err)
+
+		expected := []GroupMembership{
+			{GroupID: everyone.ID, IdentityID: alice.ID},
+			{GroupID: everyone.ID, IdentityID: bob.ID},
+			{GroupID: engineers.ID, IdentityID: bob.ID},
+		}
+		sort.Slice(expected, func(i, j int) bool {
+			if expected[i].GroupID != expected[j].GroupID {
+				return expected[i].GroupID < expected[j].GroupID
+			}
+			return expected[i].IdentityID < expected[j].IdentityID
+		})
+		assert.DeepEqual(t, actual, expected)
+	})
+}
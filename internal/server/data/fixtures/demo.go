@@ -0,0 +1,42 @@
+package fixtures
+
+import (
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+const (
+	demoDestination = "demo-cluster"
+	// infraAPIResource is the resource of grants for the Infra API. It is the
+	// same as access.ResourceInfraAPI, which is not imported because the tests
+	// of the access package use fixtures.
+	infraAPIResource = "infra"
+)
+
+// SeedDemo creates the users, groups, and grants of a demo environment in the
+// organization of tx. It is safe to call SeedDemo more than once.
+func SeedDemo(tx data.WriteTxn) error {
+	groups := []*GroupBuilder{
+		Group("Engineering").WithGrant("edit", demoDestination),
+		Group("Operations").WithGrant("view", demoDestination),
+	}
+	for _, group := range groups {
+		if _, err := group.Create(tx); err != nil {
+			return err
+		}
+	}
+
+	users := []*UserBuilder{
+		User("alice@example.com").InInfraProvider().InGroup("Engineering").
+			WithGrant(models.InfraAdminRole, infraAPIResource),
+		User("bob@example.com").InInfraProvider().InGroup("Engineering"),
+		User("carol@example.com").InInfraProvider().InGroup("Operations").
+			WithGrant(models.InfraViewRole, infraAPIResource),
+	}
+	for _, user := range users {
+		if _, err := user.Create(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+// Package fixtures creates users, groups, grants, and access keys for tests and
+// demo environments. Builders describe the rows to create, and Create inserts
+// them with the functions of the data package, so a builder can be used with
+// any data.WriteTxn, including the transactions of a running server.
+//
+// Users, groups, grants, and group memberships that already exist are reused,
+// so creating the same fixtures more than once is safe. Access keys are always
+// created, because the secret of a key is only available when it is created.
+//
+//	bob, err := fixtures.User("bob@example.com").InGroup("eng").WithKey(time.Hour).Create(tx)
+package fixtures
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+type grant struct {
+	privilege string
+	resource  string
+}
+
+// UserBuilder creates a user. Use User to create a UserBuilder.
+type UserBuilder struct {
+	name            string
+	groups          []string
+	grants          []grant
+	keys            []time.Duration
+	inInfraProvider bool
+}
+
+// User returns a builder for the user with name.
+func User(name string) *UserBuilder {
+	return &UserBuilder{name: name}
+}
+
+// InGroup adds the user to the group with name. The group is created if it
+// does not exist.
+func (b *UserBuilder) InGroup(name string) *UserBuilder {
+	b.groups = append(b.groups, name)
+	return b
+}
+
+// WithGrant grants privilege on resource to the user.
+func (b *UserBuilder) WithGrant(privilege, resource string) *UserBuilder {
+	b.grants = append(b.grants, grant{privilege: privilege, resource: resource})
+	return b
+}
+
+// WithKey creates an access key for the user that expires after ttl.
+func (b *UserBuilder) WithKey(ttl time.Duration) *UserBuilder {
+	b.keys = append(b.keys, ttl)
+	return b
+}
+
+// InInfraProvider adds the user to the infra provider, the same as a user
+// created with the API.
+func (b *UserBuilder) InInfraProvider() *UserBuilder {
+	b.inInfraProvider = true
+	return b
+}
+
+// CreatedUser is a user created by UserBuilder.Create.
+type CreatedUser struct {
+	Identity *models.Identity
+	// Keys are the access keys created by WithKey, in the same order.
+	Keys []*models.AccessKey
+	// Secrets are the secrets of Keys, which can be used as a bearer token.
+	Secrets []string
+}
+
+// Create the user and everything configured on the builder in the organization
+// of tx.
+func (b *UserBuilder) Create(tx data.WriteTxn) (*CreatedUser, error) {
+	identity, err := data.GetIdentity(tx, data.GetIdentityOptions{ByName: b.name})
+	switch {
+	case errors.Is(err, internal.ErrNotFound):
+		identity = &models.Identity{Name: b.name}
+		if err := data.CreateIdentity(tx, identity); err != nil {
+			return nil, fmt.Errorf("create user %v: %w", b.name, err)
+		}
+	case err != nil:
+		return nil, fmt.Errorf("get user %v: %w", b.name, err)
+	}
+	result := &CreatedUser{Identity: identity}
+
+	if b.inInfraProvider {
+		if _, err := data.CreateProviderUser(tx, data.InfraProvider(tx), identity); err != nil {
+			return nil, fmt.Errorf("create provider user %v: %w", b.name, err)
+		}
+	}
+
+	for _, name := range b.groups {
+		group, err := Group(name).Create(tx)
+		if err != nil {
+			return nil, err
+		}
+		if err := data.AddUsersToGroup(tx, group.ID, []uid.ID{identity.ID}); err != nil {
+			return nil, fmt.Errorf("add user %v to group %v: %w", b.name, name, err)
+		}
+	}
+
+	if err := createGrants(tx, identity.PolyID(), b.grants); err != nil {
+		return nil, fmt.Errorf("user %v: %w", b.name, err)
+	}
+
+	for _, ttl := range b.keys {
+		key := &models.AccessKey{IssuedFor: identity.ID, ExpiresAt: time.Now().Add(ttl)}
+		secret, err := data.CreateAccessKey(tx, key)
+		if err != nil {
+			return nil, fmt.Errorf("create access key for %v: %w", b.name, err)
+		}
+		result.Keys = append(result.Keys, key)
+		result.Secrets = append(result.Secrets, secret)
+	}
+	return result, nil
+}
+
+// GroupBuilder creates a group. Use Group to create a GroupBuilder.
+type GroupBuilder struct {
+	name   string
+	grants []grant
+}
+
+// Group returns a builder for the group with name.
+func Group(name string) *GroupBuilder {
+	return &GroupBuilder{name: name}
+}
+
+// WithGrant grants privilege on resource to the group.
+func (b *GroupBuilder) WithGrant(privilege, resource string) *GroupBuilder {
+	b.grants = append(b.grants, grant{privilege: privilege, resource: resource})
+	return b
+}
+
+// Create the group and its grants in the organization of tx.
+func (b *GroupBuilder) Create(tx data.WriteTxn) (*models.Group, error) {
+	group, err := data.GetGroup(tx, data.GetGroupOptions{ByName: b.name})
+	switch {
+	case errors.Is(err, internal.ErrNotFound):
+		group = &models.Group{Name: b.name}
+		if err := data.CreateGroup(tx, group); err != nil {
+			return nil, fmt.Errorf("create group %v: %w", b.name, err)
+		}
+	case err != nil:
+		return nil, fmt.Errorf("get group %v: %w", b.name, err)
+	}
+
+	if err := createGrants(tx, group.PolyID(), b.grants); err != nil {
+		return nil, fmt.Errorf("group %v: %w", b.name, err)
+	}
+	return group, nil
+}
+
+func createGrants(tx data.WriteTxn, subject uid.PolymorphicID, grants []grant) error {
+	for _, g := range grants {
+		err := data.CreateGrant(tx, &models.Grant{
+			Subject:   subject,
+			Privilege: g.privilege,
+			Resource:  g.resource,
+		})
+		var ucErr data.UniqueConstraintError
+		if err != nil && !errors.As(err, &ucErr) {
+			return fmt.Errorf("grant %v on %v: %w", g.privilege, g.resource, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package fixtures
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/internal/testing/database"
+	"github.com/infrahq/infra/internal/testing/patch"
+)
+
+// runDBTests against all supported databases, the same as the tests of the
+// data package.
+func runDBTests(t *testing.T, run func(t *testing.T, tx *data.Transaction)) {
+	setup := func(t *testing.T, opts data.NewDBOptions) *data.Transaction {
+		patch.ModelsSymmetricKey(t)
+		opts.EnforceOrgScope = true
+		db, err := data.NewDB(opts)
+		assert.NilError(t, err)
+
+		tx, err := db.Begin(context.Background(), nil)
+		assert.NilError(t, err)
+		t.Cleanup(func() {
+			_ = tx.Rollback()
+		})
+		return tx.WithOrgID(db.DefaultOrg.ID)
+	}
+
+	t.Run("postgres", func(t *testing.T) {
+		run(t, setup(t, data.NewDBOptions{DSN: database.PostgresDriver(t, "_fixtures").DSN}))
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		run(t, setup(t, data.NewDBOptions{Driver: data.DriverSQLite, DSN: database.SQLiteDriver(t).DSN}))
+	})
+}
+
+func TestUserBuilder_Create(t *testing.T) {
+	runDBTests(t, func(t *testing.T, tx *data.Transaction) {
+		builder := User("bob@example.com").
+			InInfraProvider().
+			InGroup("eng").
+			WithGrant(models.InfraViewRole, "infra").
+			WithKey(time.Hour)
+
+		first, err := builder.Create(tx)
+		assert.NilError(t, err)
+		assert.Equal(t, len(first.Keys), 1)
+		assert.Equal(t, len(first.Secrets), 1)
+
+		_, err = data.ValidateRequestAccessKey(tx, first.Secrets[0], data.ValidateAccessKeyOptions{})
+		assert.NilError(t, err)
+
+		_, err = data.GetProviderUser(tx, data.InfraProvider(tx).ID, first.Identity.ID)
+		assert.NilError(t, err)
+
+		// creating the user again reuses the existing rows
+		second, err := builder.Create(tx)
+		assert.NilError(t, err)
+		assert.Equal(t, second.Identity.ID, first.Identity.ID)
+
+		group, err := data.GetGroup(tx, data.GetGroupOptions{ByName: "eng"})
+		assert.NilError(t, err)
+		assert.Equal(t, group.TotalUsers, 1)
+
+		grants, err := data.ListGrants(tx, data.ListGrantsOptions{BySubject: first.Identity.PolyID()})
+		assert.NilError(t, err)
+		assert.Equal(t, len(grants), 1)
+	})
+}
+
+func TestSeedDemo(t *testing.T) {
+	runDBTests(t, func(t *testing.T, tx *data.Transaction) {
+		assert.NilError(t, SeedDemo(tx))
+		assert.NilError(t, SeedDemo(tx))
+
+		for _, name := range []string{"alice@example.com", "bob@example.com", "carol@example.com"} {
+			_, err := data.GetIdentity(tx, data.GetIdentityOptions{ByName: name})
+			assert.NilError(t, err, name)
+		}
+
+		group, err := data.GetGroup(tx, data.GetGroupOptions{ByName: "Engineering"})
+		assert.NilError(t, err)
+		assert.Equal(t, group.TotalUsers, 2)
+	})
+}
@@ -0,0 +1,206 @@
+package fixtures
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/internal/testing/database"
+	"github.com/infrahq/infra/internal/testing/patch"
+)
+
+// The number of rows created for TestQueryPlans. The planner only prefers an
+// index when a table has enough rows, so these are sized like a production
+// database with many organizations.
+const (
+	planOrgs            = 5
+	planUsersPerOrg     = 1000
+	planGroupsPerOrg    = 50
+	planClustersPerOrg  = 40
+	planNamespacesCount = 5
+)
+
+// TestQueryPlans checks that the most frequent queries use the expected
+// indexes, so that a change to a query that turns an index scan into a
+// sequential scan is caught before it reaches production. Creating the rows
+// takes a while, so the test only runs when INFRA_TEST_QUERY_PLANS is set.
+func TestQueryPlans(t *testing.T) {
+	if os.Getenv("INFRA_TEST_QUERY_PLANS") == "" {
+		t.Skip("Set INFRA_TEST_QUERY_PLANS=1 to test query plans")
+	}
+	patch.ModelsSymmetricKey(t)
+	db, err := data.NewDB(data.NewDBOptions{
+		DSN:             database.PostgresDriver(t, "_queryplan").DSN,
+		EnforceOrgScope: true,
+	})
+	assert.NilError(t, err)
+
+	orgs := createQueryPlanData(t, db)
+	for _, table := range []string{"grants", "identities", "identities_groups"} {
+		_, err := db.Exec("ANALYZE " + table)
+		assert.NilError(t, err)
+	}
+
+	tx, err := db.Begin(context.Background(), nil)
+	assert.NilError(t, err)
+	defer tx.Rollback() // nolint:errcheck
+	tx = tx.WithOrgID(orgs[len(orgs)/2].ID)
+
+	user, err := data.GetIdentity(tx, data.GetIdentityOptions{ByName: planUserName(planUsersPerOrg / 2)})
+	assert.NilError(t, err)
+
+	type testCase struct {
+		name          string
+		run           func(tx data.ReadTxn) error
+		expectedIndex string
+	}
+	testCases := []testCase{
+		{
+			name: "ListGrants by destination",
+			run: func(tx data.ReadTxn) error {
+				_, err := data.ListGrants(tx, data.ListGrantsOptions{ByDestination: planClusterName(3)})
+				return err
+			},
+			expectedIndex: "idx_grants_resource",
+		},
+		{
+			name: "ListGrants by subject with groups",
+			run: func(tx data.ReadTxn) error {
+				_, err := data.ListGrants(tx, data.ListGrantsOptions{
+					BySubject:                  user.PolyID(),
+					IncludeInheritedFromGroups: true,
+				})
+				return err
+			},
+			expectedIndex: "idx_grant_srp",
+		},
+		{
+			name: "ListIdentities by name",
+			run: func(tx data.ReadTxn) error {
+				_, err := data.ListIdentities(tx, data.ListIdentityOptions{ByName: user.Name})
+				return err
+			},
+			expectedIndex: "idx_identities_name",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := &recordingTxn{ReadTxn: tx}
+			assert.NilError(t, tc.run(recorder))
+
+			var raw string
+			err := tx.QueryRow("EXPLAIN (FORMAT JSON) "+recorder.query, recorder.args...).Scan(&raw)
+			assert.NilError(t, err)
+
+			var plans []struct{ Plan planNode }
+			assert.NilError(t, json.Unmarshal([]byte(raw), &plans))
+			assert.Equal(t, len(plans), 1)
+
+			var indexes []string
+			var seqScans []string
+			plans[0].Plan.walk(func(node planNode) {
+				if node.IndexName != "" {
+					indexes = append(indexes, node.IndexName)
+				}
+				if node.NodeType == "Seq Scan" {
+					seqScans = append(seqScans, node.RelationName)
+				}
+			})
+
+			assert.Assert(t, len(seqScans) == 0 && contains(indexes, tc.expectedIndex),
+				"expected the query to use index %v without a sequential scan\nquery: %v\nplan: %v",
+				tc.expectedIndex, recorder.query, raw)
+		})
+	}
+}
+
+// createQueryPlanData creates organizations with users, groups, and grants
+// on destinations, and returns the organizations.
+func createQueryPlanData(t *testing.T, db *data.DB) []*models.Organization {
+	t.Helper()
+	tx, err := db.Begin(context.Background(), nil)
+	assert.NilError(t, err)
+	defer tx.Rollback() // nolint:errcheck
+
+	var orgs []*models.Organization
+	for i := 0; i < planOrgs; i++ {
+		org := &models.Organization{Name: fmt.Sprintf("org %d", i), Domain: fmt.Sprintf("org-%d", i)}
+		assert.NilError(t, data.CreateOrganization(tx, org))
+		orgs = append(orgs, org)
+		orgTx := tx.WithOrgID(org.ID)
+
+		for g := 0; g < planGroupsPerOrg; g++ {
+			resource := fmt.Sprintf("%v.ns-%d", planClusterName(g%planClustersPerOrg), g%planNamespacesCount)
+			_, err := Group(fmt.Sprintf("group-%d", g)).WithGrant("view", resource).Create(orgTx)
+			assert.NilError(t, err)
+		}
+
+		for u := 0; u < planUsersPerOrg; u++ {
+			_, err := User(planUserName(u)).
+				InGroup(fmt.Sprintf("group-%d", u%planGroupsPerOrg)).
+				InGroup(fmt.Sprintf("group-%d", (u+1)%planGroupsPerOrg)).
+				WithGrant("edit", planClusterName(u%planClustersPerOrg)).
+				Create(orgTx)
+			assert.NilError(t, err)
+		}
+	}
+	assert.NilError(t, tx.Commit())
+	return orgs
+}
+
+func planUserName(i int) string {
+	return fmt.Sprintf("user-%d@example.com", i)
+}
+
+func planClusterName(i int) string {
+	return fmt.Sprintf("cluster-%d", i)
+}
+
+// recordingTxn records the last query, so that it can be explained.
+type recordingTxn struct {
+	data.ReadTxn
+	query string
+	args  []any
+}
+
+func (r *recordingTxn) Query(query string, args ...any) (*sql.Rows, error) {
+	r.query, r.args = query, args
+	return r.ReadTxn.Query(query, args...)
+}
+
+func (r *recordingTxn) QueryRow(query string, args ...any) *sql.Row {
+	r.query, r.args = query, args
+	return r.ReadTxn.QueryRow(query, args...)
+}
+
+// planNode is a node in the output of EXPLAIN (FORMAT JSON).
+type planNode struct {
+	NodeType     string     `json:"Node Type"`
+	RelationName string     `json:"Relation Name"`
+	IndexName    string     `json:"Index Name"`
+	Plans        []planNode `json:"Plans"`
+}
+
+func (n planNode) walk(fn func(planNode)) {
+	fn(n)
+	for _, child := range n.Plans {
+		child.walk(fn)
+	}
+}
+
+func contains(items []string, item string) bool {
+	for _, v := range items {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
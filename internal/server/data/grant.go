@@ -1,12 +1,12 @@
 package data
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/jackc/pgconn"
-	"github.com/jackc/pgerrcode"
 
 	"github.com/infrahq/infra/internal/server/data/querybuilder"
 	"github.com/infrahq/infra/internal/server/models"
@@ -15,22 +15,6 @@ import (
 
 type grantsTable models.Grant
 
-func (g grantsTable) Table() string {
-	return "grants"
-}
-
-func (g grantsTable) Columns() []string {
-	return []string{"created_at", "created_by", "deleted_at", "id", "organization_id", "privilege", "resource", "subject", "updated_at"}
-}
-
-func (g grantsTable) Values() []any {
-	return []any{g.CreatedAt, g.CreatedBy, g.DeletedAt, g.ID, g.OrganizationID, g.Privilege, g.Resource, g.Subject, g.UpdatedAt}
-}
-
-func (g *grantsTable) ScanFields() []any {
-	return []any{&g.CreatedAt, &g.CreatedBy, &g.DeletedAt, &g.ID, &g.OrganizationID, &g.Privilege, &g.Resource, &g.Subject, &g.UpdatedAt}
-}
-
 func CreateGrant(tx WriteTxn, grant *models.Grant) error {
 	switch {
 	case grant.Subject == "":
@@ -45,12 +29,13 @@ func CreateGrant(tx WriteTxn, grant *models.Grant) error {
 		return err
 	}
 	setOrg(tx, grant)
+	setGrantSubjectID(grant)
 
 	// Use a savepoint so that we can query for the duplicate grant on conflict
 	if _, err := tx.Exec("SAVEPOINT beforeCreate"); err != nil {
 		// ignore "not in a transaction" error, because outside of a transaction
 		// the db conn can continue to be used after the conflict error.
-		if !isPgErrorCode(err, pgerrcode.NoActiveSQLTransaction) {
+		if !isNoActiveTransaction(err) {
 			return err
 		}
 	}
@@ -121,6 +106,8 @@ func GetGrant(tx ReadTxn, opts GetGrantOptions) (*models.Grant, error) {
 }
 
 type ListGrantsOptions struct {
+	// ByIDs instructs ListGrants to return only the grants with these IDs.
+	ByIDs         []uid.ID
 	BySubject     uid.PolymorphicID
 	ByPrivileges  []string
 	ByResource    string
@@ -139,52 +126,64 @@ type ListGrantsOptions struct {
 }
 
 func ListGrants(tx ReadTxn, opts ListGrantsOptions) ([]models.Grant, error) {
+	filter := func(query *querybuilder.Query) error {
+		query.B("WHERE deleted_at is null")
+		query.B("AND organization_id = ?", tx.OrganizationID())
+
+		if len(opts.ByIDs) > 0 {
+			query.B("AND")
+			querybuilder.In(query, "id", opts.ByIDs)
+		}
+		if opts.BySubject != "" {
+			if !opts.IncludeInheritedFromGroups {
+				query.B("AND subject = ?", opts.BySubject)
+			} else {
+				userID, err := opts.BySubject.ID()
+				if err != nil || !opts.BySubject.IsIdentity() {
+					return fmt.Errorf("IncludeInheritedFromGroups requires a userId subject")
+				}
+				if useLegacyGroupGrantLookup(tx) {
+					if err := grantsBySubjectOrGroupsLegacy(tx, query, opts.BySubject, userID); err != nil {
+						return err
+					}
+				} else {
+					// the sub-select only returns group IDs, and IDs are unique
+					// across users and groups, so subject_id only matches the
+					// grants of groups where the user is a member.
+					query.B("AND (subject = ?", opts.BySubject)
+					query.B("OR subject_id IN (SELECT group_id FROM identities_groups WHERE identity_id = ?))", userID)
+				}
+			}
+		}
+		if len(opts.ByPrivileges) > 0 {
+			query.B("AND")
+			querybuilder.In(query, "privilege", opts.ByPrivileges)
+		}
+		if opts.ByResource != "" {
+			query.B("AND resource = ?", opts.ByResource)
+		}
+		if opts.ByDestination != "" {
+			grantsByDestination(query, opts.ByDestination)
+		}
+		if opts.ExcludeConnectorGrant {
+			query.B("AND NOT (privilege = 'connector' AND resource = 'infra')")
+		}
+		return nil
+	}
+
 	table := grantsTable{}
 	query := querybuilder.New("SELECT")
 	query.B(columnsForSelect(table))
 	query.B(", update_index")
-	if opts.Pagination != nil {
+	if opts.Pagination.countTotal() {
 		query.B(", count(*) OVER()")
 	}
 	query.B("FROM grants")
-	query.B("WHERE deleted_at is null")
-	query.B("AND organization_id = ?", tx.OrganizationID())
-
-	if opts.BySubject != "" {
-		if !opts.IncludeInheritedFromGroups {
-			query.B("AND subject = ?", opts.BySubject)
-		} else {
-			subjects := []string{opts.BySubject.String()}
-
-			userID, err := opts.BySubject.ID()
-			if err != nil || !opts.BySubject.IsIdentity() {
-				return nil, fmt.Errorf("IncludeInheritedFromGroups requires a userId subject")
-			}
-			// FIXME: store userID and groupID as a field on the grants table so
-			// that we can replace this with a sub-select or join.
-			groupIDs, err := ListGroupIDsForUser(tx, userID)
-			if err != nil {
-				return nil, err
-			}
-			for _, id := range groupIDs {
-				subjects = append(subjects, uid.NewGroupPolymorphicID(id).String())
-			}
-			query.B(`AND subject IN`)
-			queryInClause(query, subjects)
-		}
-	}
-	if len(opts.ByPrivileges) > 0 {
-		query.B("AND privilege IN")
-		queryInClause(query, opts.ByPrivileges)
-	}
-	if opts.ByResource != "" {
-		query.B("AND resource = ?", opts.ByResource)
-	}
-	if opts.ByDestination != "" {
-		grantsByDestination(query, opts.ByDestination)
+	if err := filter(query); err != nil {
+		return nil, err
 	}
-	if opts.ExcludeConnectorGrant {
-		query.B("AND NOT (privilege = 'connector' AND resource = 'infra')")
+	if opts.Pagination.useCursor() {
+		query.B("AND id > ?", opts.Pagination.AfterID)
 	}
 
 	query.B("ORDER BY id ASC")
@@ -196,13 +195,59 @@ func ListGrants(tx ReadTxn, opts ListGrantsOptions) ([]models.Grant, error) {
 	if err != nil {
 		return nil, err
 	}
-	return scanRows(rows, func(grant *models.Grant) []any {
+	result, err := scanRows(rows, func(grant *models.Grant) []any {
 		fields := append((*grantsTable)(grant).ScanFields(), &grant.UpdateIndex)
-		if opts.Pagination != nil {
+		if opts.Pagination.countTotal() {
 			fields = append(fields, &opts.Pagination.TotalCount)
 		}
 		return fields
 	})
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.Pagination.countEmptyPage(tx, len(result), table, filter); err != nil {
+		return nil, err
+	}
+	if opts.Pagination.useCursor() {
+		var lastID uid.ID
+		if len(result) > 0 {
+			lastID = result[len(result)-1].ID
+		}
+		opts.Pagination.setNextAfterID(len(result), lastID)
+	}
+	return result, nil
+}
+
+// useLegacyGroupGrantLookup returns true if tx was started from a DB created
+// with NewDBOptions.LegacyGroupGrantLookup.
+func useLegacyGroupGrantLookup(tx ReadTxn) bool {
+	switch tx := tx.(type) {
+	case *Transaction:
+		return tx.legacyGroupGrantLookup
+	case *DB:
+		return tx.legacyGroupGrantLookup
+	default:
+		return false
+	}
+}
+
+// grantsBySubjectOrGroupsLegacy is the query used by ListGrants with
+// IncludeInheritedFromGroups before grants stored the subject_id. It looks up
+// the groups of the user with a separate query. It is used when
+// NewDBOptions.LegacyGroupGrantLookup is set, and will be removed once the
+// query with the sub-select is validated.
+func grantsBySubjectOrGroupsLegacy(tx ReadTxn, query *querybuilder.Query, subject uid.PolymorphicID, userID uid.ID) error {
+	subjects := []string{subject.String()}
+	groupIDs, err := ListGroupIDsForUser(tx, userID)
+	if err != nil {
+		return err
+	}
+	for _, id := range groupIDs {
+		subjects = append(subjects, uid.NewGroupPolymorphicID(id).String())
+	}
+	query.B("AND")
+	querybuilder.In(query, "subject", subjects)
+	return nil
 }
 
 func grantsByDestination(query *querybuilder.Query, destination string) {
@@ -247,6 +292,9 @@ type DeleteGrantsOptions struct {
 	// ByID instructs DeleteGrants to delete the grant with this ID. When set
 	// all other fields on this struct are ignored.
 	ByID uid.ID
+	// ByIDs instructs DeleteGrants to delete the grants with these IDs. When
+	// set all fields below this on this struct are ignored.
+	ByIDs []uid.ID
 	// BySubject instructs DeleteGrants to delete all grants that match this
 	// subject. When set other fields below this on this struct are ignored.
 	BySubject uid.PolymorphicID
@@ -271,14 +319,13 @@ func DeleteGrants(tx WriteTxn, opts DeleteGrantsOptions) error {
 	switch {
 	case opts.ByID != 0:
 		query.B("id = ?", opts.ByID)
+	case len(opts.ByIDs) > 0:
+		querybuilder.In(query, "id", opts.ByIDs)
 	case opts.BySubject != "":
 		query.B("subject = ?", opts.BySubject)
 	case opts.ByCreatedBy != 0:
-		query.B("created_by = ?", opts.ByCreatedBy)
-		if len(opts.NotIDs) > 0 {
-			query.B("AND id NOT IN")
-			queryInClause(query, opts.NotIDs)
-		}
+		query.B("created_by = ? AND", opts.ByCreatedBy)
+		querybuilder.NotIn(query, "id", opts.NotIDs)
 	default:
 		return fmt.Errorf("DeleteGrants requires an ID to delete")
 	}
@@ -292,7 +339,7 @@ func UpdateGrants(tx WriteTxn, addGrants, rmGrants []*models.Grant) error {
 	if _, err := tx.Exec("SAVEPOINT beforeUpdate"); err != nil {
 		// ignore "not in a transaction" error, because outside of a transaction
 		// the db conn can continue to be used after the conflict error.
-		if !isPgErrorCode(err, pgerrcode.NoActiveSQLTransaction) {
+		if !isNoActiveTransaction(err) {
 			return err
 		}
 	}
@@ -310,6 +357,57 @@ func UpdateGrants(tx WriteTxn, addGrants, rmGrants []*models.Grant) error {
 	return nil
 }
 
+// UpdateGrant updates the privilege of grant. The update_index of the grant is
+// incremented, so that connectors receive the change.
+func UpdateGrant(tx WriteTxn, grant *models.Grant) error {
+	_, err := updateGrant(tx, grant, 0)
+	return err
+}
+
+// UpdateGrantIfUnmodified updates the grant only when its update_index is
+// still equal to updateIndex. Returns ErrUpdateConflict when the grant was
+// modified since updateIndex was read.
+func UpdateGrantIfUnmodified(tx WriteTxn, grant *models.Grant, updateIndex int64) error {
+	updated, err := updateGrant(tx, grant, updateIndex)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return ErrUpdateConflict
+	}
+	return nil
+}
+
+func updateGrant(tx WriteTxn, grant *models.Grant, updateIndex int64) (bool, error) {
+	if err := validateGrant(grant); err != nil {
+		return false, err
+	}
+	if err := grant.OnUpdate(); err != nil {
+		return false, err
+	}
+
+	query := querybuilder.New("UPDATE grants")
+	query.B("SET privilege = ?,", grant.Privilege)
+	query.B("updated_at = ?,", grant.UpdatedAt)
+	query.B("update_index = nextval('seq_update_index')")
+	query.B("WHERE organization_id = ?", tx.OrganizationID())
+	query.B("AND deleted_at is null")
+	query.B("AND id = ?", grant.ID)
+	if updateIndex != 0 {
+		query.B("AND update_index = ?", updateIndex)
+	}
+	query.B("RETURNING update_index")
+
+	err := tx.QueryRow(query.String(), query.Args...).Scan(&grant.UpdateIndex)
+	if updateIndex != 0 && errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, handleError(err)
+	}
+	return true, nil
+}
+
 func validateGrant(grant *models.Grant) error {
 	switch {
 	case grant.Subject == "":
@@ -322,42 +420,29 @@ func validateGrant(grant *models.Grant) error {
 	return nil
 }
 
-func createGrantsBulk(tx WriteTxn, grants []*models.Grant) error {
-	if len(grants) == 0 {
-		return nil
-	}
+// setGrantSubjectID sets grant.SubjectID from grant.Subject. A subject that
+// is not a valid polymorphic ID has a zero SubjectID, and is never matched by
+// the group memberships of a user.
+func setGrantSubjectID(grant *models.Grant) {
+	grant.SubjectID, _ = grant.Subject.ID()
+}
 
+func createGrantsBulk(tx WriteTxn, grants []*models.Grant) error {
 	for _, g := range grants {
 		if err := validateGrant(g); err != nil {
 			return err
 		}
-		if err := g.OnInsert(); err != nil {
-			return err
-		}
-		setOrg(tx, g)
 	}
 
-	table := &grantsTable{}
-	query := querybuilder.New("INSERT INTO grants")
-	query.B("(")
-	query.B(columnsForInsert(table))
-	query.B(", update_index")
-	query.B(") VALUES")
-
+	rows := make([]*grantsTable, len(grants))
 	for i, g := range grants {
-		gt := (*grantsTable)(g)
-		query.B("(")
-		query.B(placeholderForColumns(table), gt.Values()...)
-		query.B(", nextval('seq_update_index')")
-		query.B(")")
-		if i+1 != len(grants) {
-			query.B(",")
-		}
+		setGrantSubjectID(g)
+		rows[i] = (*grantsTable)(g)
 	}
-	query.B("ON CONFLICT DO NOTHING")
-
-	_, err := tx.Exec(query.String(), query.Args...)
-	return err
+	return insertMany(tx, rows, insertManyOptions{
+		withUpdateIndex:     true,
+		onConflictDoNothing: true,
+	})
 }
 
 func deleteGrantsBulk(tx WriteTxn, grants []*models.Grant) error {
@@ -397,5 +482,5 @@ func deleteGrantsBulk(tx WriteTxn, grants []*models.Grant) error {
 }
 
 func CountAllGrants(tx ReadTxn) (int64, error) {
-	return countRows(tx, grantsTable{})
+	return countRows(tx, grantsTable{}, nil)
 }
@@ -3,6 +3,7 @@ package data
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -16,7 +17,7 @@ import (
 )
 
 func TestCreateGrant(t *testing.T) {
-	runDBTests(t, func(t *testing.T, db *DB) {
+	runDBTestsParallel(t, func(t *testing.T, db *DB) {
 		t.Run("success", func(t *testing.T) {
 			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
 
@@ -30,6 +31,9 @@ func TestCreateGrant(t *testing.T) {
 			assert.NilError(t, err)
 			assert.Assert(t, actual.ID != 0)
 
+			subjectID, err := uid.Parse([]byte("1234567"))
+			assert.NilError(t, err)
+
 			expected := models.Grant{
 				Model: models.Model{
 					ID:        uid.ID(999),
@@ -38,6 +42,7 @@ func TestCreateGrant(t *testing.T) {
 				},
 				OrganizationMember: models.OrganizationMember{OrganizationID: defaultOrganizationID},
 				Subject:            "i:1234567",
+				SubjectID:          subjectID,
 				Privilege:          "view",
 				Resource:           "infra",
 				CreatedBy:          uid.ID(1091),
@@ -63,7 +68,11 @@ func TestCreateGrant(t *testing.T) {
 			err = CreateGrant(tx, &g2)
 			var ucErr UniqueConstraintError
 			assert.Assert(t, errors.As(err, &ucErr))
-			assert.DeepEqual(t, ucErr, UniqueConstraintError{Table: "grants"})
+			assert.DeepEqual(t, ucErr, UniqueConstraintError{
+				Table:   "grants",
+				Column:  "privilege",
+				Message: "a grant for that user or group, privilege, and resource already exists",
+			})
 
 			grants, err := ListGrants(tx, ListGrantsOptions{
 				BySubject:  "i:1234567",
@@ -111,7 +120,8 @@ func TestCreateGrant(t *testing.T) {
 }
 
 func TestDeleteGrants(t *testing.T) {
-	runDBTests(t, func(t *testing.T, db *DB) {
+	runDBTestsParallel(t, func(t *testing.T, db *DB) {
+		skipWithSQLite(t, db, "sequence values are rolled back with the transaction")
 		otherOrg := &models.Organization{Name: "other", Domain: "other.example.org"}
 		assert.NilError(t, CreateOrganization(db, otherOrg))
 
@@ -174,6 +184,33 @@ func TestDeleteGrants(t *testing.T) {
 			assert.NilError(t, err)
 			assert.Equal(t, len(actual), 1)
 		})
+		t.Run("by ids", func(t *testing.T) {
+			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+
+			grant1 := &models.Grant{Subject: "i:any1", Privilege: "view", Resource: "any"}
+			grant2 := &models.Grant{Subject: "i:any2", Privilege: "edit", Resource: "any"}
+			toKeep := &models.Grant{Subject: "i:any3", Privilege: "view", Resource: "any"}
+			createGrants(t, tx, grant1, grant2, toKeep)
+
+			listed, err := ListGrants(tx, ListGrantsOptions{ByIDs: []uid.ID{grant2.ID, toKeep.ID}})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, listed, []models.Grant{*grant2, *toKeep}, cmpModelByID)
+
+			err = DeleteGrants(tx, DeleteGrantsOptions{ByIDs: []uid.ID{grant1.ID, grant2.ID}})
+			assert.NilError(t, err)
+
+			actual, err := ListGrants(tx, ListGrantsOptions{ByDestination: "any"})
+			assert.NilError(t, err)
+			expected := []models.Grant{
+				{Model: models.Model{ID: toKeep.ID}},
+			}
+			assert.DeepEqual(t, actual, expected, cmpModelByID)
+
+			maxIndex, err := GrantsMaxUpdateIndex(tx, GrantsMaxUpdateIndexOptions{ByDestination: "any"})
+			assert.NilError(t, err)
+			assert.Equal(t, maxIndex, startUpdateIndex+5) // 3 inserts, 2 deletes
+			startUpdateIndex = maxIndex
+		})
 		t.Run("by created_by and not ids", func(t *testing.T) {
 			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
 
@@ -203,6 +240,28 @@ func TestDeleteGrants(t *testing.T) {
 			assert.Equal(t, maxIndex, startUpdateIndex+6) // 4 inserts, 2 deletes
 			startUpdateIndex = maxIndex
 		})
+		t.Run("by created_by and empty not ids", func(t *testing.T) {
+			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+
+			createdBy := uid.ID(9235)
+			grant1 := &models.Grant{Subject: "i:any1", Privilege: "view", Resource: "any", CreatedBy: createdBy}
+			grant2 := &models.Grant{Subject: "i:any2", Privilege: "view", Resource: "any", CreatedBy: createdBy}
+			toKeep := &models.Grant{Subject: "i:any3", Privilege: "view", Resource: "any"}
+			createGrants(t, tx, grant1, grant2, toKeep)
+
+			err := DeleteGrants(tx, DeleteGrantsOptions{
+				ByCreatedBy: createdBy,
+				NotIDs:      []uid.ID{},
+			})
+			assert.NilError(t, err)
+
+			actual, err := ListGrants(tx, ListGrantsOptions{ByDestination: "any"})
+			assert.NilError(t, err)
+			expected := []models.Grant{
+				{Model: models.Model{ID: toKeep.ID}},
+			}
+			assert.DeepEqual(t, actual, expected, cmpModelByID)
+		})
 		t.Run("notify", func(t *testing.T) {
 			g := models.Grant{
 				Subject:   "i:1234567",
@@ -236,7 +295,8 @@ func TestDeleteGrants(t *testing.T) {
 }
 
 func TestUpdateGrants(t *testing.T) {
-	runDBTests(t, func(t *testing.T, db *DB) {
+	runDBTestsParallel(t, func(t *testing.T, db *DB) {
+		skipWithSQLite(t, db, "sequence values are rolled back with the transaction")
 		otherOrg := &models.Organization{Name: "other", Domain: "other.example.org"}
 		assert.NilError(t, CreateOrganization(db, otherOrg))
 
@@ -377,8 +437,99 @@ func createGrants(t *testing.T, tx WriteTxn, grants ...*models.Grant) {
 	}
 }
 
+func TestUpdateGrant(t *testing.T) {
+	runDBTestsParallel(t, func(t *testing.T, db *DB) {
+		otherOrg := &models.Organization{Name: "other", Domain: "other.example.org"}
+		assert.NilError(t, CreateOrganization(db, otherOrg))
+
+		t.Run("success", func(t *testing.T) {
+			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+
+			grant := &models.Grant{Subject: "i:any", Privilege: "view", Resource: "any"}
+			toKeep := &models.Grant{Subject: "i:any2", Privilege: "view", Resource: "any"}
+			createGrants(t, tx, grant, toKeep)
+			created := *grant
+
+			grant.Privilege = "edit"
+			err := UpdateGrant(tx, grant)
+			assert.NilError(t, err)
+			assert.Assert(t, grant.UpdateIndex > created.UpdateIndex)
+
+			actual, err := GetGrant(tx, GetGrantOptions{ByID: grant.ID})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, actual, grant, cmpTimeWithDBPrecision)
+
+			actual, err = GetGrant(tx, GetGrantOptions{ByID: toKeep.ID})
+			assert.NilError(t, err)
+			assert.Equal(t, actual.Privilege, "view")
+		})
+		t.Run("duplicate grant", func(t *testing.T) {
+			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+
+			grant := &models.Grant{Subject: "i:any", Privilege: "view", Resource: "any"}
+			existing := &models.Grant{Subject: "i:any", Privilege: "edit", Resource: "any"}
+			createGrants(t, tx, grant, existing)
+
+			grant.Privilege = "edit"
+			err := UpdateGrant(tx, grant)
+			var ucErr UniqueConstraintError
+			assert.Assert(t, errors.As(err, &ucErr), "wrong error type %T", err)
+		})
+		t.Run("grant in another org", func(t *testing.T) {
+			tx := txnForTestCase(t, db, otherOrg.ID)
+
+			grant := &models.Grant{Subject: "i:any", Privilege: "view", Resource: "any"}
+			createGrants(t, tx, grant)
+
+			grant.Privilege = "edit"
+			err := UpdateGrant(tx.WithOrgID(db.DefaultOrg.ID), grant)
+			assert.ErrorIs(t, err, internal.ErrNotFound)
+		})
+	})
+}
+
+func TestUpdateGrantIfUnmodified(t *testing.T) {
+	runDBTestsParallel(t, func(t *testing.T, db *DB) {
+		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+
+		created := &models.Grant{Subject: "i:any", Privilege: "view", Resource: "any"}
+		createGrants(t, tx, created)
+		orig, err := GetGrant(tx, GetGrantOptions{ByID: created.ID})
+		assert.NilError(t, err)
+		readIndex := orig.UpdateIndex
+
+		// another request modifies the grant after it was read
+		concurrent := *orig
+		concurrent.Privilege = "edit"
+		assert.NilError(t, UpdateGrant(tx, &concurrent))
+
+		t.Run("conflict", func(t *testing.T) {
+			stale := *orig
+			stale.Privilege = "admin"
+			err := UpdateGrantIfUnmodified(tx, &stale, readIndex)
+			assert.ErrorIs(t, err, ErrUpdateConflict)
+
+			actual, err := GetGrant(tx, GetGrantOptions{ByID: orig.ID})
+			assert.NilError(t, err)
+			assert.Equal(t, actual.Privilege, "edit")
+			assert.Equal(t, actual.UpdateIndex, concurrent.UpdateIndex)
+		})
+		t.Run("success", func(t *testing.T) {
+			fresh := concurrent
+			fresh.Privilege = "admin"
+			err := UpdateGrantIfUnmodified(tx, &fresh, concurrent.UpdateIndex)
+			assert.NilError(t, err)
+			assert.Assert(t, fresh.UpdateIndex > concurrent.UpdateIndex)
+
+			actual, err := GetGrant(tx, GetGrantOptions{ByID: orig.ID})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, actual, &fresh, cmpTimeWithDBPrecision)
+		})
+	})
+}
+
 func TestGetGrant(t *testing.T) {
-	runDBTests(t, func(t *testing.T, db *DB) {
+	runDBTestsParallel(t, func(t *testing.T, db *DB) {
 		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
 
 		grant1 := &models.Grant{
@@ -395,6 +546,9 @@ func TestGetGrant(t *testing.T) {
 		}
 		createGrants(t, tx, grant1, grant2)
 
+		subjectID, err := uid.Parse([]byte("any1"))
+		assert.NilError(t, err)
+
 		otherOrg := &models.Organization{Name: "other", Domain: "other.example.org"}
 		assert.NilError(t, CreateOrganization(tx, otherOrg))
 		other := &models.Grant{Subject: "i:any1", Privilege: "view", Resource: "any"}
@@ -439,6 +593,7 @@ func TestGetGrant(t *testing.T) {
 				},
 				OrganizationMember: models.OrganizationMember{OrganizationID: db.DefaultOrg.ID},
 				Subject:            "i:any1",
+				SubjectID:          subjectID,
 				Privilege:          "view",
 				Resource:           "any",
 				CreatedBy:          uid.ID(777),
@@ -462,6 +617,7 @@ func TestGetGrant(t *testing.T) {
 				},
 				OrganizationMember: models.OrganizationMember{OrganizationID: db.DefaultOrg.ID},
 				Subject:            "i:any1",
+				SubjectID:          subjectID,
 				Privilege:          "view",
 				Resource:           "any",
 				CreatedBy:          uid.ID(777),
@@ -473,7 +629,7 @@ func TestGetGrant(t *testing.T) {
 }
 
 func TestListGrants(t *testing.T) {
-	runDBTests(t, func(t *testing.T, db *DB) {
+	runDBTestsParallel(t, func(t *testing.T, db *DB) {
 		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
 
 		user := &models.Identity{Name: "usera@example.com"}
@@ -618,6 +774,20 @@ func TestListGrants(t *testing.T) {
 			expected := []models.Grant{*grant1, *grant2, *grant3}
 			assert.DeepEqual(t, actual, expected, cmpModelByID)
 		})
+		t.Run("with many privileges", func(t *testing.T) {
+			privileges := []string{"view"}
+			for i := 0; i < 999; i++ {
+				privileges = append(privileges, fmt.Sprintf("custom-%d", i))
+			}
+			actual, err := ListGrants(tx, ListGrantsOptions{
+				ByResource:   "any",
+				ByPrivileges: privileges,
+			})
+			assert.NilError(t, err)
+
+			expected := []models.Grant{*grant1, *grant2}
+			assert.DeepEqual(t, actual, expected, cmpModelByID)
+		})
 		t.Run("by subject with include inherited", func(t *testing.T) {
 			actual, err := ListGrants(tx, ListGrantsOptions{
 				BySubject:                  "i:userchar",
@@ -628,6 +798,26 @@ func TestListGrants(t *testing.T) {
 			expected := []models.Grant{*grant1, *grant3, *grant4, *gGrant1, *gGrant2}
 			assert.DeepEqual(t, actual, expected, cmpModelByID)
 		})
+		t.Run("by subject with include inherited using legacy group lookup", func(t *testing.T) {
+			tx.legacyGroupGrantLookup = true
+			defer func() { tx.legacyGroupGrantLookup = false }()
+
+			actual, err := ListGrants(tx, ListGrantsOptions{
+				BySubject:                  "i:userchar",
+				IncludeInheritedFromGroups: true,
+			})
+			assert.NilError(t, err)
+
+			expected := []models.Grant{*grant1, *grant3, *grant4, *gGrant1, *gGrant2}
+			assert.DeepEqual(t, actual, expected, cmpModelByID)
+		})
+		t.Run("include inherited requires a user subject", func(t *testing.T) {
+			_, err := ListGrants(tx, ListGrantsOptions{
+				BySubject:                  uid.NewGroupPolymorphicID(111),
+				IncludeInheritedFromGroups: true,
+			})
+			assert.ErrorContains(t, err, "requires a userId subject")
+		})
 		t.Run("exclude connector grant", func(t *testing.T) {
 			actual, err := ListGrants(tx, ListGrantsOptions{ExcludeConnectorGrant: true})
 			assert.NilError(t, err)
@@ -655,6 +845,24 @@ func TestListGrants(t *testing.T) {
 			expectedPagination := &Pagination{Page: 2, Limit: 3, TotalCount: 9}
 			assert.DeepEqual(t, pagination, expectedPagination)
 		})
+		t.Run("with pagination without total", func(t *testing.T) {
+			pagination := &Pagination{Page: 2, Limit: 3, SkipTotalCount: true}
+			actual, err := ListGrants(tx, ListGrantsOptions{Pagination: pagination})
+			assert.NilError(t, err)
+
+			expected := []models.Grant{*grant3, *grant4, *grant5}
+			assert.DeepEqual(t, actual, expected, cmpModelByID)
+
+			expectedPagination := &Pagination{Page: 2, Limit: 3, SkipTotalCount: true}
+			assert.DeepEqual(t, pagination, expectedPagination)
+
+			// a page past the last page is not counted either
+			pagination = &Pagination{Page: 20, Limit: 3, SkipTotalCount: true}
+			actual, err = ListGrants(tx, ListGrantsOptions{Pagination: pagination})
+			assert.NilError(t, err)
+			assert.Equal(t, len(actual), 0)
+			assert.Equal(t, pagination.TotalCount, 0)
+		})
 		t.Run("by resource with pagination", func(t *testing.T) {
 			pagination := &Pagination{Page: 1, Limit: 2}
 			actual, err := ListGrants(tx, ListGrantsOptions{
@@ -681,8 +889,96 @@ func TestListGrants(t *testing.T) {
 	})
 }
 
+// BenchmarkListGrantsIncludeInheritedFromGroups compares looking up the groups
+// of the user with a separate query, to the sub-select on identities_groups.
+func BenchmarkListGrantsIncludeInheritedFromGroups(b *testing.B) {
+	db := setupDB(b)
+	tx, err := db.Begin(context.Background(), nil)
+	assert.NilError(b, err)
+	b.Cleanup(func() {
+		_ = tx.Rollback()
+	})
+	tx = tx.WithOrgID(db.DefaultOrg.ID)
+
+	userID := uid.New()
+	subject := uid.NewIdentityPolymorphicID(userID)
+
+	grants := make([]*models.Grant, 0, 10_000)
+	for i := 0; i < 50; i++ {
+		groupID := uid.New()
+		assert.NilError(b, AddUsersToGroup(tx, groupID, []uid.ID{userID}))
+		grants = append(grants, &models.Grant{
+			Subject:   uid.NewGroupPolymorphicID(groupID),
+			Privilege: "view",
+			Resource:  fmt.Sprintf("group-%d", i),
+		})
+	}
+	for i := 0; i < 50; i++ {
+		grants = append(grants, &models.Grant{
+			Subject:   subject,
+			Privilege: "view",
+			Resource:  fmt.Sprintf("user-%d", i),
+		})
+	}
+	for len(grants) < cap(grants) {
+		grants = append(grants, &models.Grant{
+			Subject:   uid.NewIdentityPolymorphicID(uid.New()),
+			Privilege: "view",
+			Resource:  "infra",
+		})
+	}
+	assert.NilError(b, createGrantsBulk(tx, grants))
+
+	opts := ListGrantsOptions{BySubject: subject, IncludeInheritedFromGroups: true}
+	run := func(b *testing.B, legacy bool) {
+		tx.legacyGroupGrantLookup = legacy
+		for n := 0; n < b.N; n++ {
+			actual, err := ListGrants(tx, opts)
+			assert.NilError(b, err)
+			assert.Equal(b, len(actual), 100)
+		}
+	}
+
+	b.Run("legacy group lookup", func(b *testing.B) {
+		run(b, true)
+	})
+	b.Run("sub-select", func(b *testing.B) {
+		run(b, false)
+	})
+}
+
+// BenchmarkListGrants1k measures listing 1,000 grants, most of the cost of
+// which is building the query and scanning the rows.
+func BenchmarkListGrants1k(b *testing.B) {
+	db := setupDB(b)
+	tx, err := db.Begin(context.Background(), nil)
+	assert.NilError(b, err)
+	b.Cleanup(func() {
+		_ = tx.Rollback()
+	})
+	tx = tx.WithOrgID(db.DefaultOrg.ID)
+
+	grants := make([]*models.Grant, 1000)
+	for i := range grants {
+		grants[i] = &models.Grant{
+			Subject:   uid.NewIdentityPolymorphicID(uid.New()),
+			Privilege: "view",
+			Resource:  fmt.Sprintf("infra-%d", i),
+		}
+	}
+	assert.NilError(b, createGrantsBulk(tx, grants))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		actual, err := ListGrants(tx, ListGrantsOptions{ByPrivileges: []string{"view"}})
+		assert.NilError(b, err)
+		assert.Equal(b, len(actual), 1000)
+	}
+}
+
 func TestGrantsMaxUpdateIndex(t *testing.T) {
-	runDBTests(t, func(t *testing.T, db *DB) {
+	runDBTestsParallel(t, func(t *testing.T, db *DB) {
 		t.Run("no results match the query", func(t *testing.T) {
 			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
 
@@ -708,7 +1004,8 @@ func TestListenForGrantsNotify(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	t.Cleanup(cancel)
 
-	runDBTests(t, func(t *testing.T, db *DB) {
+	runDBTestsParallel(t, func(t *testing.T, db *DB) {
+		skipWithSQLite(t, db, "LISTEN and NOTIFY")
 		mainOrg := &models.Organization{Name: "Main", Domain: "main.example.org"}
 		assert.NilError(t, CreateOrganization(db, mainOrg))
 
@@ -718,6 +1015,8 @@ func TestListenForGrantsNotify(t *testing.T) {
 		run := func(t *testing.T, tc testCase) {
 			listener, err := ListenForNotify(ctx, db, tc.opts)
 			assert.NilError(t, err)
+			// every operation is expected to wake the listener
+			listener.coalesceWindow = 0
 
 			chResult := make(chan struct{})
 			g, ctx := errgroup.WithContext(ctx)
@@ -850,7 +1149,7 @@ func isNotBlocked[T any](t *testing.T, ch chan T) (result T) {
 }
 
 func TestCountAllGrants(t *testing.T) {
-	runDBTests(t, func(t *testing.T, db *DB) {
+	runDBTestsParallel(t, func(t *testing.T, db *DB) {
 		createGrants(t, db,
 			&models.Grant{Subject: "sub", Privilege: "priv", Resource: "res1"},
 			&models.Grant{Subject: "sub", Privilege: "priv", Resource: "res2"},
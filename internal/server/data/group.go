@@ -40,24 +40,19 @@ type GetGroupOptions struct {
 
 func GetGroup(tx ReadTxn, opts GetGroupOptions) (*models.Group, error) {
 	group := &groupsTable{}
-	query := querybuilder.New("SELECT")
-	query.B(columnsForSelect(group))
-	query.B("FROM groups")
-	query.B("WHERE deleted_at is null")
-	query.B("AND organization_id = ?", tx.OrganizationID())
-
-	switch {
-	case opts.ByID != 0:
-		query.B("AND id = ?", opts.ByID)
-	case opts.ByName != "":
-		query.B("AND name = ?", opts.ByName)
-	default:
-		return nil, fmt.Errorf("GetGroup requires an ID")
-	}
-
-	err := tx.QueryRow(query.String(), query.Args...).Scan(group.ScanFields()...)
+	err := getInOrg(tx, group, func(query *querybuilder.Query) error {
+		switch {
+		case opts.ByID != 0:
+			query.B("AND id = ?", opts.ByID)
+		case opts.ByName != "":
+			query.B("AND name = ?", opts.ByName)
+		default:
+			return fmt.Errorf("GetGroup requires an ID")
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, handleError(err)
+		return nil, err
 	}
 
 	count, err := countUsersInGroup(tx, group.ID)
@@ -80,26 +75,33 @@ type ListGroupsOptions struct {
 }
 
 func ListGroups(tx ReadTxn, opts ListGroupsOptions) ([]models.Group, error) {
+	filter := func(query *querybuilder.Query) error {
+		if opts.ByGroupMember != 0 {
+			query.B("JOIN identities_groups ON groups.id = identities_groups.group_id")
+			query.B("AND identities_groups.identity_id = ?", opts.ByGroupMember)
+		}
+		query.B("WHERE deleted_at is null")
+		query.B("AND organization_id = ?", tx.OrganizationID())
+
+		if opts.ByName != "" {
+			query.B("AND name = ?", opts.ByName)
+		}
+		if len(opts.ByIDs) > 0 {
+			query.B("AND groups.id IN")
+			queryInClause(query, opts.ByIDs)
+		}
+		return nil
+	}
+
 	table := groupsTable{}
 	query := querybuilder.New("SELECT")
 	query.B(columnsForSelect(table))
-	if opts.Pagination != nil {
+	if opts.Pagination.countTotal() {
 		query.B(", count(*) OVER()")
 	}
 	query.B("FROM groups")
-	if opts.ByGroupMember != 0 {
-		query.B("JOIN identities_groups ON groups.id = identities_groups.group_id")
-		query.B("AND identities_groups.identity_id = ?", opts.ByGroupMember)
-	}
-	query.B("WHERE deleted_at is null")
-	query.B("AND organization_id = ?", tx.OrganizationID())
-
-	if opts.ByName != "" {
-		query.B("AND name = ?", opts.ByName)
-	}
-	if len(opts.ByIDs) > 0 {
-		query.B("AND groups.id IN")
-		queryInClause(query, opts.ByIDs)
+	if err := filter(query); err != nil {
+		return nil, err
 	}
 
 	query.B("ORDER BY name ASC")
@@ -113,7 +115,7 @@ func ListGroups(tx ReadTxn, opts ListGroupsOptions) ([]models.Group, error) {
 	}
 	result, err := scanRows(rows, func(group *models.Group) []any {
 		fields := (*groupsTable)(group).ScanFields()
-		if opts.Pagination != nil {
+		if opts.Pagination.countTotal() {
 			fields = append(fields, &opts.Pagination.TotalCount)
 		}
 		return fields
@@ -121,6 +123,9 @@ func ListGroups(tx ReadTxn, opts ListGroupsOptions) ([]models.Group, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := opts.Pagination.countEmptyPage(tx, len(result), table, filter); err != nil {
+		return nil, err
+	}
 
 	// TODO: do this in a single query
 	for i := range result {
@@ -173,19 +178,35 @@ func DeleteGroup(tx WriteTxn, id uid.ID) error {
 	return handleError(err)
 }
 
+// identitiesGroupsTable is a row in the identities_groups table, which
+// stores the membership of users in groups.
+type identitiesGroupsTable struct {
+	IdentityID uid.ID
+	GroupID    uid.ID
+}
+
+func (m identitiesGroupsTable) Table() string {
+	return "identities_groups"
+}
+
+func (m identitiesGroupsTable) Columns() []string {
+	return []string{"group_id", "identity_id"}
+}
+
+func (m identitiesGroupsTable) Values() []any {
+	return []any{m.GroupID, m.IdentityID}
+}
+
+func (m identitiesGroupsTable) OnInsert() error {
+	return nil
+}
+
 func AddUsersToGroup(tx WriteTxn, groupID uid.ID, idsToAdd []uid.ID) error {
-	query := querybuilder.New("INSERT INTO identities_groups(group_id, identity_id)")
-	query.B("VALUES")
+	rows := make([]identitiesGroupsTable, len(idsToAdd))
 	for i, id := range idsToAdd {
-		query.B("(?, ?)", groupID, id)
-		if i+1 != len(idsToAdd) {
-			query.B(",")
-		}
+		rows[i] = identitiesGroupsTable{IdentityID: id, GroupID: groupID}
 	}
-	query.B("ON CONFLICT DO NOTHING")
-
-	_, err := tx.Exec(query.String(), query.Args...)
-	return handleError(err)
+	return insertMany(tx, rows, insertManyOptions{onConflictDoNothing: true})
 }
 
 // RemoveUsersFromGroup removes any user ID listed in idsToRemove from the group
@@ -208,5 +229,5 @@ func countUsersInGroup(tx ReadTxn, groupID uid.ID) (int64, error) {
 }
 
 func CountAllGroups(tx ReadTxn) (int64, error) {
-	return countRows(tx, groupsTable{})
+	return countRows(tx, groupsTable{}, nil)
 }
@@ -48,7 +48,11 @@ func TestCreateGroup(t *testing.T) {
 			err = CreateGroup(tx, &models.Group{Name: "Everyone"})
 			var ucErr UniqueConstraintError
 			assert.Assert(t, errors.As(err, &ucErr))
-			expectedErr := UniqueConstraintError{Table: "groups", Column: "name"}
+			expectedErr := UniqueConstraintError{
+				Table:   "groups",
+				Column:  "name",
+				Message: "a group with that name already exists",
+			}
 			assert.DeepEqual(t, ucErr, expectedErr)
 		})
 	})
@@ -343,6 +347,24 @@ func TestAddUsersToGroup(t *testing.T) {
 			assert.NilError(t, err)
 			assert.Equal(t, len(actual), 0)
 		})
+		t.Run("more users than fit in a single statement", func(t *testing.T) {
+			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+
+			ids := make([]uid.ID, 40_000)
+			for i := range ids {
+				ids[i] = uid.New()
+			}
+			err := AddUsersToGroup(tx, other.ID, ids)
+			assert.NilError(t, err)
+
+			// adding the same users again is a no-op
+			err = AddUsersToGroup(tx, other.ID, ids[:10])
+			assert.NilError(t, err)
+
+			count, err := countUsersInGroup(tx, other.ID)
+			assert.NilError(t, err)
+			assert.Equal(t, count, int64(40_000))
+		})
 	})
 }
 
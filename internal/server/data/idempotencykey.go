@@ -0,0 +1,65 @@
+package data
+
+import (
+	"github.com/infrahq/infra/internal/server/data/querybuilder"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+// IdempotencyKeyTTL is how long the response to a request with an
+// idempotency key is kept. After the TTL the key may be used again.
+const IdempotencyKeyTTL = day
+
+type idempotencyKeysTable models.IdempotencyKey
+
+func (idempotencyKeysTable) Table() string {
+	return "idempotency_keys"
+}
+
+func (k idempotencyKeysTable) Columns() []string {
+	return []string{"created_at", "id", "idempotency_key", "organization_id", "request_hash", "response_body", "status_code"}
+}
+
+func (k idempotencyKeysTable) Values() []any {
+	return []any{k.CreatedAt, k.ID, k.Key, k.OrganizationID, k.RequestHash, k.ResponseBody, k.StatusCode}
+}
+
+func (k *idempotencyKeysTable) ScanFields() []any {
+	return []any{&k.CreatedAt, &k.ID, &k.Key, &k.OrganizationID, &k.RequestHash, &k.ResponseBody, &k.StatusCode}
+}
+
+func (k *idempotencyKeysTable) OnInsert() error {
+	return (*models.IdempotencyKey)(k).OnInsert()
+}
+
+// CreateIdempotencyKey stores the response to a request with an idempotency
+// key. It returns a UniqueConstraintError if the organization already has a
+// response for the key.
+func CreateIdempotencyKey(tx WriteTxn, key *models.IdempotencyKey) error {
+	return insert(tx, (*idempotencyKeysTable)(key))
+}
+
+// GetIdempotencyKey returns the stored response for key. The response may be
+// older than IdempotencyKeyTTL, callers must check CreatedAt.
+func GetIdempotencyKey(tx ReadTxn, key string) (*models.IdempotencyKey, error) {
+	table := &idempotencyKeysTable{}
+	query := querybuilder.New("SELECT")
+	query.B(columnsForSelect(table))
+	query.B("FROM idempotency_keys")
+	query.B("WHERE organization_id = ?", tx.OrganizationID())
+	query.B("AND idempotency_key = ?", key)
+
+	err := tx.QueryRow(query.String(), query.Args...).Scan(table.ScanFields()...)
+	if err != nil {
+		return nil, handleError(err)
+	}
+	return (*models.IdempotencyKey)(table), nil
+}
+
+// DeleteIdempotencyKey deletes the stored response with id, so that the key
+// can be used again.
+func DeleteIdempotencyKey(tx WriteTxn, id uid.ID) error {
+	stmt := `DELETE FROM idempotency_keys WHERE organization_id = ? AND id = ?`
+	_, err := tx.Exec(stmt, tx.OrganizationID(), id)
+	return handleError(err)
+}
@@ -93,6 +93,7 @@ func AssignIdentityToGroups(tx WriteTxn, user *models.Identity, provider *models
 		return err
 	}
 
+	memberships := make([]identitiesGroupsTable, 0, len(groupsToBeAdded))
 	for _, name := range groupsToBeAdded {
 		// find or create group
 		var groupID uid.ID
@@ -116,34 +117,33 @@ func AssignIdentityToGroups(tx WriteTxn, user *models.Identity, provider *models
 			groupID = group.ID
 		}
 
-		rows, err := tx.Query("SELECT identity_id FROM identities_groups WHERE identity_id = ? AND group_id = ?", user.ID, groupID)
-		if err != nil {
-			return err
-		}
-		ids, err := scanRows(rows, func(item *uid.ID) []any {
-			return []any{item}
-		})
-		if err != nil {
-			return err
-		}
-
-		if len(ids) == 0 {
-			// add user to group
-			_, err = tx.Exec("INSERT INTO identities_groups (identity_id, group_id) VALUES (?, ?)", user.ID, groupID)
-			if err != nil {
-				return fmt.Errorf("insert: %w", handleError(err))
-			}
-		}
-
+		memberships = append(memberships, identitiesGroupsTable{IdentityID: user.ID, GroupID: groupID})
 		user.Groups = append(user.Groups, models.Group{Model: models.Model{ID: groupID}, Name: name})
 	}
 
+	// add user to groups
+	err = insertMany(tx, memberships, insertManyOptions{onConflictDoNothing: true})
+	if err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
 	return nil
 }
 
+// verificationTokenLength is the length of the token that verifies the email
+// address of a user. It is long enough that the token can not be guessed.
+const verificationTokenLength = 20
+
+func newVerificationToken() (string, error) {
+	return generate.CryptoRandom(verificationTokenLength, generate.CharsetAlphaNumeric)
+}
+
 func CreateIdentity(tx WriteTxn, identity *models.Identity) error {
 	if identity.VerificationToken == "" {
-		identity.VerificationToken = generate.MathRandom(10, generate.CharsetAlphaNumeric)
+		token, err := newVerificationToken()
+		if err != nil {
+			return err
+		}
+		identity.VerificationToken = token
 	}
 	if err := insert(tx, (*identitiesTable)(identity)); err != nil {
 		return err
@@ -164,7 +164,7 @@ func setSSHLoginName(tx WriteTxn, user models.Identity) (string, error) {
 
 	for i := 0; i < 3; i++ {
 		nextUsername := normalizedUsername
-		if i != 0 || len(nextUsername) < 4 || isReservedUsername(nextUsername) {
+		if i != 0 || len(nextUsername) < 4 || IsReservedUsername(nextUsername) {
 			nextUsername = normalizedUsername + generate.MathRandom(3, generate.CharsetNumbers)
 		}
 
@@ -271,7 +271,9 @@ var linuxSystemUsernames = map[string]struct{}{
 	// TODO: what other users are created by commonly installed packages?
 }
 
-func isReservedUsername(username string) bool {
+// IsReservedUsername returns true if username is the name of a common linux
+// system user, which can not be used as the SSH login name of a user.
+func IsReservedUsername(username string) bool {
 	_, match := linuxSystemUsernames[username]
 	return match
 }
@@ -358,12 +360,31 @@ func GetIdentity(tx ReadTxn, opts GetIdentityOptions) (*models.Identity, error)
 	return (*models.Identity)(identity), nil
 }
 
+// SetIdentityVerified marks the user with the verification token as verified.
+// The token is replaced, so that it can only be used once. Returns
+// ErrNotFound if no unverified user has the token.
 func SetIdentityVerified(tx WriteTxn, token string) error {
-	q := querybuilder.New(`UPDATE identities SET verified = true`)
+	next, err := newVerificationToken()
+	if err != nil {
+		return err
+	}
+
+	q := querybuilder.New("UPDATE identities")
+	q.B("SET verified = true, verification_token = ?", next)
 	q.B("WHERE verified = ? AND verification_token = ? AND organization_id = ?", false, token, tx.OrganizationID())
 
-	_, err := tx.Exec(q.String(), q.Args...)
-	return err
+	result, err := tx.Exec(q.String(), q.Args...)
+	if err != nil {
+		return handleError(err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return internal.ErrNotFound
+	}
+	return nil
 }
 
 type ListIdentityOptions struct {
@@ -385,47 +406,59 @@ func ListIdentities(tx ReadTxn, opts ListIdentityOptions) ([]models.Identity, er
 	if len(opts.ByNotIDs) > 0 && opts.CreatedBy == 0 {
 		return nil, fmt.Errorf("ListIdentities by 'not IDs' requires 'created by'")
 	}
+	filter := func(query *querybuilder.Query) error {
+		if opts.ByGroupID != 0 {
+			query.B("JOIN identities_groups ON identities_groups.identity_id = id")
+		}
+		if opts.ByPublicKeyFingerprint != "" {
+			query.B("INNER JOIN user_public_keys ON identities.id = user_public_keys.user_id")
+			query.B("AND user_public_keys.fingerprint = ?", opts.ByPublicKeyFingerprint)
+		}
+		query.B("WHERE identities.deleted_at IS NULL")
+		query.B("AND identities.organization_id = ?", tx.OrganizationID())
+		if opts.ByID != 0 {
+			query.B("AND identities.id = ?", opts.ByID)
+		}
+		if len(opts.ByIDs) > 0 {
+			query.B("AND identities.id IN")
+			queryInClause(query, opts.ByIDs)
+		}
+		if opts.ByName != "" {
+			query.B("AND identities.name = ?", opts.ByName)
+		}
+		if opts.ByNotName != "" {
+			query.B("AND identities.name != ?", opts.ByNotName)
+		}
+		if opts.ByGroupID != 0 {
+			query.B("AND identities_groups.group_id = ?", opts.ByGroupID)
+		}
+		if opts.CreatedBy != 0 {
+			query.B("AND identities.created_by = ?", opts.CreatedBy)
+			if len(opts.ByNotIDs) > 0 {
+				query.B("AND identities.id NOT IN ")
+				queryInClause(query, opts.ByNotIDs)
+			}
+		}
+		return nil
+	}
+
 	identities := &identitiesTable{}
 	query := querybuilder.New("SELECT")
 	query.B(columnsForSelect(identities))
-	if opts.Pagination != nil {
+	if opts.Pagination.countTotal() {
 		query.B(", count(*) OVER()")
 	}
 	query.B("FROM")
 	query.B(identities.Table())
-	if opts.ByGroupID != 0 {
-		query.B("JOIN identities_groups ON identities_groups.identity_id = id")
-	}
-	if opts.ByPublicKeyFingerprint != "" {
-		query.B("INNER JOIN user_public_keys ON identities.id = user_public_keys.user_id")
-		query.B("AND user_public_keys.fingerprint = ?", opts.ByPublicKeyFingerprint)
-	}
-	query.B("WHERE identities.deleted_at IS NULL")
-	query.B("AND identities.organization_id = ?", tx.OrganizationID())
-	if opts.ByID != 0 {
-		query.B("AND identities.id = ?", opts.ByID)
-	}
-	if len(opts.ByIDs) > 0 {
-		query.B("AND identities.id IN")
-		queryInClause(query, opts.ByIDs)
-	}
-	if opts.ByName != "" {
-		query.B("AND identities.name = ?", opts.ByName)
-	}
-	if opts.ByNotName != "" {
-		query.B("AND identities.name != ?", opts.ByNotName)
-	}
-	if opts.ByGroupID != 0 {
-		query.B("AND identities_groups.group_id = ?", opts.ByGroupID)
+	if err := filter(query); err != nil {
+		return nil, err
 	}
-	if opts.CreatedBy != 0 {
-		query.B("AND identities.created_by = ?", opts.CreatedBy)
-		if len(opts.ByNotIDs) > 0 {
-			query.B("AND identities.id NOT IN ")
-			queryInClause(query, opts.ByNotIDs)
-		}
+	if opts.Pagination.useCursor() {
+		query.B("AND identities.id > ?", opts.Pagination.AfterID)
+		query.B("ORDER BY identities.id ASC")
+	} else {
+		query.B("ORDER BY identities.name ASC")
 	}
-	query.B("ORDER BY identities.name ASC")
 	if opts.Pagination != nil {
 		opts.Pagination.PaginateQuery(query)
 	}
@@ -436,7 +469,7 @@ func ListIdentities(tx ReadTxn, opts ListIdentityOptions) ([]models.Identity, er
 	}
 	result, err := scanRows(rows, func(identity *models.Identity) []any {
 		fields := (*identitiesTable)(identity).ScanFields()
-		if opts.Pagination != nil {
+		if opts.Pagination.countTotal() {
 			fields = append(fields, &opts.Pagination.TotalCount)
 		}
 		return fields
@@ -444,6 +477,16 @@ func ListIdentities(tx ReadTxn, opts ListIdentityOptions) ([]models.Identity, er
 	if err != nil {
 		return nil, err
 	}
+	if err := opts.Pagination.countEmptyPage(tx, len(result), identities, filter); err != nil {
+		return nil, err
+	}
+	if opts.Pagination.useCursor() {
+		var lastID uid.ID
+		if len(result) > 0 {
+			lastID = result[len(result)-1].ID
+		}
+		opts.Pagination.setNextAfterID(len(result), lastID)
+	}
 
 	if len(result) == 0 {
 		// return without attempting pre-loads
@@ -462,13 +505,9 @@ func ListIdentities(tx ReadTxn, opts ListIdentityOptions) ([]models.Identity, er
 		}
 	}
 
-	// TODO: use a join?
 	if opts.LoadPublicKeys {
-		for i, identity := range result {
-			result[i].PublicKeys, err = listUserPublicKeys(tx, identity.ID)
-			if err != nil {
-				return nil, err
-			}
+		if err := loadIdentitiesPublicKeys(tx, result); err != nil {
+			return nil, err
 		}
 	}
 
@@ -597,10 +636,99 @@ func loadIdentitiesProviders(tx ReadTxn, identities []models.Identity) error {
 	return nil
 }
 
+// loadIdentitiesPublicKeys sets the PublicKeys of every identity, using a
+// single query for all the identities.
+func loadIdentitiesPublicKeys(tx ReadTxn, identities []models.Identity) error {
+	identityIDs := make([]uid.ID, 0, len(identities))
+	for _, i := range identities {
+		identityIDs = append(identityIDs, i.ID)
+	}
+
+	table := userPublicKeysTable{}
+	query := querybuilder.New("SELECT")
+	query.B(columnsForSelect(table))
+	query.B("FROM user_public_keys")
+	query.B("WHERE deleted_at is null")
+	query.B("AND user_id IN")
+	queryInClause(query, identityIDs)
+	query.B("ORDER BY id")
+
+	rows, err := tx.Query(query.String(), query.Args...)
+	if err != nil {
+		return err
+	}
+	keys, err := scanRows(rows, func(k *models.UserPublicKey) []any {
+		return (*userPublicKeysTable)(k).ScanFields()
+	})
+	if err != nil {
+		return err
+	}
+
+	keysByIdentity := make(map[uid.ID][]models.UserPublicKey)
+	for _, key := range keys {
+		keysByIdentity[key.UserID] = append(keysByIdentity[key.UserID], key)
+	}
+	for i := range identities {
+		identities[i].PublicKeys = keysByIdentity[identities[i].ID]
+	}
+	return nil
+}
+
 func UpdateIdentity(tx WriteTxn, identity *models.Identity) error {
 	return update(tx, (*identitiesTable)(identity))
 }
 
+// UpdateIdentityIfUnmodified updates the identity only when its updated_at is
+// still equal to updatedAt. Returns ErrUpdateConflict when the identity was
+// modified since updatedAt was read.
+func UpdateIdentityIfUnmodified(tx WriteTxn, identity *models.Identity, updatedAt time.Time) error {
+	if err := identity.OnUpdate(); err != nil {
+		return err
+	}
+	// updated_at is the version of the identity, so it must change even when
+	// the previous update was within timePrecision.
+	updatedAt = updatedAt.Truncate(timePrecision)
+	if !identity.UpdatedAt.After(updatedAt) {
+		identity.UpdatedAt = updatedAt.Add(timePrecision)
+	}
+	setOrg(tx, identity)
+
+	table := (*identitiesTable)(identity)
+	query := querybuilder.New("UPDATE identities SET")
+	query.B(columnsForUpdate(table), table.Values()...)
+	query.B("WHERE deleted_at is null")
+	query.B("AND id = ?", identity.ID)
+	query.B("AND organization_id = ?", tx.OrganizationID())
+	// rows written before times were truncated to timePrecision have more
+	// precision than updatedAt, so compare the times with timePrecision.
+	query.B("AND updated_at >= ? AND updated_at < ?", updatedAt, updatedAt.Add(timePrecision))
+
+	result, err := tx.Exec(query.String(), query.Args...)
+	if err != nil {
+		return handleError(err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrUpdateConflict
+	}
+	return nil
+}
+
+// UpdateIdentityLastSeenAt sets the last_seen_at of the identity. It does not
+// change updated_at, because last_seen_at is updated by requests from the
+// user, and that should not conflict with changes made by an admin.
+func UpdateIdentityLastSeenAt(tx WriteTxn, identity *models.Identity) error {
+	stmt := `
+		UPDATE identities SET last_seen_at = ?
+		WHERE id = ? AND organization_id = ? AND deleted_at is null
+	`
+	_, err := tx.Exec(stmt, identity.LastSeenAt, identity.ID, identity.OrganizationID)
+	return handleError(err)
+}
+
 type DeleteIdentitiesOptions struct {
 	ByID         uid.ID
 	ByIDs        []uid.ID
@@ -690,6 +818,9 @@ func deleteReferencesToIdentities(tx WriteTxn, providerID uid.ID, toDelete []mod
 			if err != nil {
 				return nil, fmt.Errorf("delete identity creds: %w", err)
 			}
+			if err := RevokeIssuedTokens(tx, i.ID); err != nil {
+				return nil, fmt.Errorf("revoke identity tokens: %w", err)
+			}
 			unreferencedIdentityIDs = append(unreferencedIdentityIDs, user.ID)
 		}
 	}
@@ -697,7 +828,7 @@ func deleteReferencesToIdentities(tx WriteTxn, providerID uid.ID, toDelete []mod
 }
 
 func CountAllIdentities(tx ReadTxn) (int64, error) {
-	return countRows(tx, identitiesTable{})
+	return countRows(tx, identitiesTable{}, nil)
 }
 
 // stub details for google social login provider which is not stored in the database
@@ -1,9 +1,12 @@
 package data
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"golang.org/x/crypto/bcrypt"
@@ -459,6 +462,94 @@ var cmpModelsIdentityPreloadProvidersShallow = cmp.Comparer(func(x, y models.Ide
 	return x.Name == y.Name
 })
 
+// queryCountingTxn counts the queries performed with the ReadTxn.
+type queryCountingTxn struct {
+	ReadTxn
+	queries int
+}
+
+func (t *queryCountingTxn) Query(query string, args ...any) (*sql.Rows, error) {
+	t.queries++
+	return t.ReadTxn.Query(query, args...)
+}
+
+func (t *queryCountingTxn) QueryRow(query string, args ...any) *sql.Row {
+	t.queries++
+	return t.ReadTxn.QueryRow(query, args...)
+}
+
+// createUsersWithPublicKeys creates count users in the infra provider, each
+// with two public keys.
+func createUsersWithPublicKeys(t testing.TB, tx WriteTxn, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		user := &models.Identity{Name: fmt.Sprintf("user%03d@example.com", i)}
+		assert.NilError(t, CreateIdentity(tx, user))
+		_, err := CreateProviderUser(tx, InfraProvider(tx), user)
+		assert.NilError(t, err)
+
+		for j := 0; j < 2; j++ {
+			key := &models.UserPublicKey{
+				UserID:      user.ID,
+				PublicKey:   fmt.Sprintf("the-public-key-%d-%d", i, j),
+				KeyType:     "ssh-rsa",
+				Fingerprint: fmt.Sprintf("the-fingerprint-%d-%d", i, j),
+			}
+			assert.NilError(t, AddUserPublicKey(tx, key))
+		}
+	}
+}
+
+func TestListIdentities_QueryCount(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+		createUsersWithPublicKeys(t, tx, 50)
+
+		listUsers := func(t *testing.T, limit int) int {
+			t.Helper()
+			counter := &queryCountingTxn{ReadTxn: tx}
+			users, err := ListIdentities(counter, ListIdentityOptions{
+				ByNotName:      models.InternalInfraConnectorIdentityName,
+				Pagination:     &Pagination{Page: 1, Limit: limit},
+				LoadProviders:  true,
+				LoadPublicKeys: true,
+			})
+			assert.NilError(t, err)
+			assert.Equal(t, len(users), limit)
+			for _, user := range users {
+				assert.Equal(t, len(user.Providers), 1, user.Name)
+				assert.Equal(t, len(user.PublicKeys), 2, user.Name)
+			}
+			return counter.queries
+		}
+
+		assert.Equal(t, listUsers(t, 5), listUsers(t, 50))
+	})
+}
+
+func BenchmarkListIdentities_ProvidersAndPublicKeys(b *testing.B) {
+	db := setupDB(b)
+	tx, err := db.Begin(context.Background(), nil)
+	assert.NilError(b, err)
+	b.Cleanup(func() {
+		_ = tx.Rollback()
+	})
+	tx = tx.WithOrgID(db.DefaultOrg.ID)
+	createUsersWithPublicKeys(b, tx, 100)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		users, err := ListIdentities(tx, ListIdentityOptions{
+			ByNotName:      models.InternalInfraConnectorIdentityName,
+			Pagination:     &Pagination{Page: 1, Limit: 100},
+			LoadProviders:  true,
+			LoadPublicKeys: true,
+		})
+		assert.NilError(b, err)
+		assert.Equal(b, len(users), 100)
+	}
+}
+
 func TestUpdateIdentity(t *testing.T) {
 	runDBTests(t, func(t *testing.T, db *DB) {
 		identity := models.Identity{
@@ -482,6 +573,78 @@ func TestUpdateIdentity(t *testing.T) {
 	})
 }
 
+func TestSetIdentityVerified(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		identity := &models.Identity{Name: "alice@example.com"}
+		assert.NilError(t, CreateIdentity(db, identity))
+		assert.Equal(t, len(identity.VerificationToken), verificationTokenLength)
+
+		err := SetIdentityVerified(db, "not-the-token")
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+
+		err = SetIdentityVerified(db, identity.VerificationToken)
+		assert.NilError(t, err)
+
+		result, err := GetIdentity(db, GetIdentityOptions{ByID: identity.ID})
+		assert.NilError(t, err)
+		assert.Assert(t, result.Verified)
+		assert.Assert(t, result.VerificationToken != identity.VerificationToken)
+
+		// the token can only be used once
+		err = SetIdentityVerified(db, identity.VerificationToken)
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+	})
+}
+
+func TestUpdateIdentityIfUnmodified(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+
+		created := &models.Identity{Name: "alice@example.com"}
+		assert.NilError(t, CreateIdentity(tx, created))
+		orig, err := GetIdentity(tx, GetIdentityOptions{ByID: created.ID})
+		assert.NilError(t, err)
+
+		// another request modifies the identity after it was read
+		concurrent := *orig
+		concurrent.SSHLoginName = "alice2"
+		assert.NilError(t, UpdateIdentityIfUnmodified(tx, &concurrent, orig.UpdatedAt))
+		current, err := GetIdentity(tx, GetIdentityOptions{ByID: orig.ID})
+		assert.NilError(t, err)
+
+		t.Run("conflict", func(t *testing.T) {
+			stale := *orig
+			stale.SSHLoginName = "alice3"
+			err := UpdateIdentityIfUnmodified(tx, &stale, orig.UpdatedAt)
+			assert.ErrorIs(t, err, ErrUpdateConflict)
+
+			actual, err := GetIdentity(tx, GetIdentityOptions{ByID: orig.ID})
+			assert.NilError(t, err)
+			assert.Equal(t, actual.SSHLoginName, "alice2")
+		})
+		t.Run("last seen at does not conflict", func(t *testing.T) {
+			seen := *current
+			seen.LastSeenAt = time.Now()
+			assert.NilError(t, UpdateIdentityLastSeenAt(tx, &seen))
+
+			actual, err := GetIdentity(tx, GetIdentityOptions{ByID: orig.ID})
+			assert.NilError(t, err)
+			assert.Assert(t, actual.UpdatedAt.Equal(current.UpdatedAt))
+			assert.Assert(t, !actual.LastSeenAt.IsZero())
+		})
+		t.Run("success", func(t *testing.T) {
+			fresh := *current
+			fresh.SSHLoginName = "alice4"
+			err := UpdateIdentityIfUnmodified(tx, &fresh, current.UpdatedAt)
+			assert.NilError(t, err)
+
+			actual, err := GetIdentity(tx, GetIdentityOptions{ByID: orig.ID})
+			assert.NilError(t, err)
+			assert.Equal(t, actual.SSHLoginName, "alice4")
+		})
+	})
+}
+
 func TestDeleteIdentities(t *testing.T) {
 	type testCase struct {
 		name   string
@@ -0,0 +1,98 @@
+package data
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/server/data/querybuilder"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+// ImpersonationApproval allows Impersonator to impersonate the user with
+// IdentityID once before ExpiresAt. It is created by ApprovedBy.
+type ImpersonationApproval struct {
+	ID uid.ID
+	models.OrganizationMember
+
+	CreatedAt      time.Time
+	IdentityID     uid.ID
+	ImpersonatorID uid.ID
+	ApprovedBy     uid.ID
+	ExpiresAt      time.Time
+}
+
+func (ImpersonationApproval) Table() string {
+	return "impersonation_approvals"
+}
+
+func (a ImpersonationApproval) Columns() []string {
+	return []string{"approved_by", "created_at", "expires_at", "id", "identity_id", "impersonator_id", "organization_id"}
+}
+
+func (a ImpersonationApproval) Values() []any {
+	return []any{a.ApprovedBy, a.CreatedAt, a.ExpiresAt, a.ID, a.IdentityID, a.ImpersonatorID, a.OrganizationID}
+}
+
+func (a *ImpersonationApproval) ScanFields() []any {
+	return []any{&a.ApprovedBy, &a.CreatedAt, &a.ExpiresAt, &a.ID, &a.IdentityID, &a.ImpersonatorID, &a.OrganizationID}
+}
+
+func (a *ImpersonationApproval) OnInsert() error {
+	if a.ID == 0 {
+		a.ID = uid.New()
+	}
+	a.CreatedAt = time.Now().UTC()
+	return nil
+}
+
+func CreateImpersonationApproval(tx WriteTxn, approval *ImpersonationApproval) error {
+	switch {
+	case approval.IdentityID == 0:
+		return fmt.Errorf("an identityID is required")
+	case approval.ImpersonatorID == 0:
+		return fmt.Errorf("an impersonatorID is required")
+	case approval.ApprovedBy == 0:
+		return fmt.Errorf("an approvedBy is required")
+	case approval.ExpiresAt.IsZero():
+		return fmt.Errorf("an expiry is required")
+	}
+	return insert(tx, approval)
+}
+
+// ClaimImpersonationApproval deletes an approval by approvedBy for
+// impersonatorID to impersonate the user with identityID, so that each
+// approval is used only once. Returns an error if there is no such approval,
+// or the approval has expired.
+func ClaimImpersonationApproval(tx WriteTxn, identityID, impersonatorID, approvedBy uid.ID) error {
+	stmt := `
+		DELETE FROM impersonation_approvals
+		WHERE id = (
+			SELECT id FROM impersonation_approvals
+			WHERE identity_id = ? AND impersonator_id = ? AND approved_by = ? AND organization_id = ?
+			ORDER BY expires_at DESC
+			LIMIT 1
+		)
+		RETURNING expires_at`
+
+	var expiresAt time.Time
+	err := tx.QueryRow(stmt, identityID, impersonatorID, approvedBy, tx.OrganizationID()).Scan(&expiresAt)
+	if err != nil {
+		return handleError(err)
+	}
+
+	if expiresAt.Before(time.Now()) {
+		return internal.ErrExpired
+	}
+	return nil
+}
+
+func RemoveExpiredImpersonationApprovals(tx WriteTxn) error {
+	query := querybuilder.New("DELETE FROM impersonation_approvals")
+	query.B("WHERE expires_at <= ?", time.Now().UTC())
+	query.B("/* all organizations */")
+
+	_, err := tx.Exec(query.String(), query.Args...)
+	return err
+}
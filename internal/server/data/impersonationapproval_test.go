@@ -0,0 +1,79 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestClaimImpersonationApproval(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		const user, support, approver = uid.ID(8222), uid.ID(8223), uid.ID(8224)
+
+		approve := func(t *testing.T, tx WriteTxn, expiry time.Duration) {
+			t.Helper()
+			approval := &ImpersonationApproval{
+				IdentityID:     user,
+				ImpersonatorID: support,
+				ApprovedBy:     approver,
+				ExpiresAt:      time.Now().Add(expiry),
+			}
+			assert.NilError(t, CreateImpersonationApproval(tx, approval))
+		}
+
+		t.Run("claimed once", func(t *testing.T) {
+			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+			approve(t, tx, time.Minute)
+
+			assert.NilError(t, ClaimImpersonationApproval(tx, user, support, approver))
+
+			err := ClaimImpersonationApproval(tx, user, support, approver)
+			assert.ErrorIs(t, err, internal.ErrNotFound)
+		})
+		t.Run("only by the approved impersonator, for the approved user", func(t *testing.T) {
+			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+			approve(t, tx, time.Minute)
+
+			err := ClaimImpersonationApproval(tx, user, approver, approver)
+			assert.ErrorIs(t, err, internal.ErrNotFound)
+			err = ClaimImpersonationApproval(tx, support, support, approver)
+			assert.ErrorIs(t, err, internal.ErrNotFound)
+			err = ClaimImpersonationApproval(tx, user, support, support)
+			assert.ErrorIs(t, err, internal.ErrNotFound)
+		})
+		t.Run("expired", func(t *testing.T) {
+			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+			approve(t, tx, -time.Minute)
+
+			err := ClaimImpersonationApproval(tx, user, support, approver)
+			assert.ErrorIs(t, err, internal.ErrExpired)
+		})
+		t.Run("in another organization", func(t *testing.T) {
+			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+			approve(t, tx, time.Minute)
+
+			other := &models.Organization{Name: "other", Domain: "other.example.com"}
+			assert.NilError(t, CreateOrganization(tx, other))
+
+			err := ClaimImpersonationApproval(tx.WithOrgID(other.ID), user, support, approver)
+			assert.ErrorIs(t, err, internal.ErrNotFound)
+		})
+		t.Run("remove expired", func(t *testing.T) {
+			tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+			approve(t, tx, -time.Minute)
+			approve(t, tx, time.Minute)
+
+			assert.NilError(t, RemoveExpiredImpersonationApprovals(tx))
+
+			var count int
+			err := tx.QueryRow(`SELECT count(*) FROM impersonation_approvals WHERE organization_id = ?`, db.DefaultOrg.ID).Scan(&count)
+			assert.NilError(t, err)
+			assert.Equal(t, count, 1)
+		})
+	})
+}
@@ -0,0 +1,109 @@
+package data
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/infrahq/infra/internal/server/data/querybuilder"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+type issuedTokensTable models.IssuedToken
+
+func (i issuedTokensTable) Table() string {
+	return "issued_tokens"
+}
+
+func (i issuedTokensTable) Columns() []string {
+	return []string{"created_at", "deleted_at", "destination_name", "expires_at", "id", "identity_id", "organization_id", "revoked_at", "updated_at"}
+}
+
+func (i issuedTokensTable) Values() []any {
+	return []any{i.CreatedAt, i.DeletedAt, i.DestinationName, i.ExpiresAt, i.ID, i.IdentityID, i.OrganizationID, i.RevokedAt, i.UpdatedAt}
+}
+
+func (i *issuedTokensTable) ScanFields() []any {
+	return []any{&i.CreatedAt, &i.DeletedAt, &i.DestinationName, &i.ExpiresAt, &i.ID, &i.IdentityID, &i.OrganizationID, &i.RevokedAt, &i.UpdatedAt}
+}
+
+// CreateIssuedToken records a JWT issued to a user, so that it can be revoked
+// with RevokeIssuedTokens.
+func CreateIssuedToken(tx WriteTxn, token *models.IssuedToken) error {
+	if token.IdentityID == 0 {
+		return fmt.Errorf("CreateIssuedToken requires an IdentityID")
+	}
+	if token.ExpiresAt.IsZero() {
+		return fmt.Errorf("CreateIssuedToken requires an ExpiresAt")
+	}
+	return insert(tx, (*issuedTokensTable)(token))
+}
+
+// RevokeIssuedTokens revokes all the unexpired JWTs issued to the user. The
+// update_index of the revoked tokens is incremented, so that connectors
+// waiting for changes to grants of the destination receive the revoked tokens.
+func RevokeIssuedTokens(tx WriteTxn, identityID uid.ID) error {
+	now := time.Now()
+	query := querybuilder.New("UPDATE issued_tokens")
+	query.B("SET revoked_at = ?, updated_at = ?,", now, now)
+	query.B("update_index = nextval('seq_update_index')")
+	query.B("WHERE organization_id = ?", tx.OrganizationID())
+	query.B("AND identity_id = ?", identityID)
+	query.B("AND revoked_at IS NULL")
+	query.B("AND expires_at > ?", now)
+
+	_, err := tx.Exec(query.String(), query.Args...)
+	return handleError(err)
+}
+
+// ListRevokedTokens returns the revoked tokens that have not expired, and are
+// accepted by the destination.
+func ListRevokedTokens(tx ReadTxn, destination string) ([]models.IssuedToken, error) {
+	table := &issuedTokensTable{}
+	query := querybuilder.New("SELECT")
+	query.B(columnsForSelect(table))
+	query.B("FROM issued_tokens")
+	query.B("WHERE organization_id = ?", tx.OrganizationID())
+	query.B("AND revoked_at IS NOT NULL")
+	query.B("AND expires_at > ?", time.Now())
+	issuedTokensByDestination(query, destination)
+	query.B("ORDER BY id")
+
+	rows, err := tx.Query(query.String(), query.Args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanRows(rows, func(token *models.IssuedToken) []any {
+		return (*issuedTokensTable)(token).ScanFields()
+	})
+}
+
+// IssuedTokensMaxUpdateIndex returns the maximum update_index of the tokens
+// accepted by the destination. Returns 0 if no tokens were revoked.
+func IssuedTokensMaxUpdateIndex(tx ReadTxn, destination string) (int64, error) {
+	query := querybuilder.New("SELECT max(update_index) FROM issued_tokens")
+	query.B("WHERE organization_id = ?", tx.OrganizationID())
+	issuedTokensByDestination(query, destination)
+
+	var result *int64
+	err := tx.QueryRow(query.String(), query.Args...).Scan(&result)
+	if err != nil || result == nil {
+		return 0, err
+	}
+	return *result, nil
+}
+
+func issuedTokensByDestination(query *querybuilder.Query, destination string) {
+	query.B("AND (destination_name = ? OR destination_name = '')", destination)
+}
+
+// DeleteExpiredIssuedTokens removes the records of expired JWTs, which no
+// longer need to be revoked.
+func DeleteExpiredIssuedTokens(tx WriteTxn) error {
+	query := querybuilder.New("DELETE FROM issued_tokens")
+	query.B("WHERE expires_at <= ?", time.Now().UTC())
+	query.B("/* all organizations */")
+
+	_, err := tx.Exec(query.String(), query.Args...)
+	return err
+}
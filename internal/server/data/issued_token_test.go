@@ -0,0 +1,64 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestRevokeIssuedTokens(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+
+		userID, otherUserID := uid.ID(1234), uid.ID(5678)
+		expires := time.Now().Add(time.Hour)
+
+		forDest := &models.IssuedToken{IdentityID: userID, DestinationName: "the-dest", ExpiresAt: expires}
+		forOtherDest := &models.IssuedToken{IdentityID: userID, DestinationName: "other", ExpiresAt: expires}
+		forAnyDest := &models.IssuedToken{IdentityID: userID, ExpiresAt: expires}
+		otherUser := &models.IssuedToken{IdentityID: otherUserID, DestinationName: "the-dest", ExpiresAt: expires}
+		expired := &models.IssuedToken{IdentityID: userID, DestinationName: "the-dest", ExpiresAt: time.Now().Add(-time.Minute)}
+		for _, token := range []*models.IssuedToken{forDest, forOtherDest, forAnyDest, otherUser, expired} {
+			assert.NilError(t, CreateIssuedToken(tx, token))
+		}
+
+		revoked, err := ListRevokedTokens(tx, "the-dest")
+		assert.NilError(t, err)
+		assert.Equal(t, len(revoked), 0)
+
+		before, err := IssuedTokensMaxUpdateIndex(tx, "the-dest")
+		assert.NilError(t, err)
+
+		assert.NilError(t, RevokeIssuedTokens(tx, userID))
+
+		revoked, err = ListRevokedTokens(tx, "the-dest")
+		assert.NilError(t, err)
+		var ids []uid.ID
+		for _, token := range revoked {
+			assert.Assert(t, token.RevokedAt != nil)
+			ids = append(ids, token.ID)
+		}
+		expected := []uid.ID{forDest.ID, forAnyDest.ID}
+		if expected[0] > expected[1] {
+			expected[0], expected[1] = expected[1], expected[0]
+		}
+		assert.DeepEqual(t, ids, expected)
+
+		after, err := IssuedTokensMaxUpdateIndex(tx, "the-dest")
+		assert.NilError(t, err)
+		assert.Assert(t, after > before, "after=%v before=%v", after, before)
+
+		t.Run("delete expired", func(t *testing.T) {
+			assert.NilError(t, DeleteExpiredIssuedTokens(tx))
+
+			var count int
+			err := tx.QueryRow("SELECT count(*) FROM issued_tokens /* all organizations */").Scan(&count)
+			assert.NilError(t, err)
+			assert.Equal(t, count, 4)
+		})
+	})
+}
@@ -21,7 +21,8 @@ func migrations() []*migrator.Migration {
 	return []*migrator.Migration{
 		// drop Settings SignupEnabled column
 		{
-			ID: "202204281130",
+			ID:          "202204281130",
+			Description: "drop Settings SignupEnabled column",
 			Migrate: func(tx migrator.DB) error {
 				stmt := `ALTER TABLE settings DROP COLUMN IF EXISTS signup_enabled`
 				_, err := tx.Exec(stmt)
@@ -30,7 +31,8 @@ func migrations() []*migrator.Migration {
 		},
 		// #1657: get rid of identity kind
 		{
-			ID: "202204291613",
+			ID:          "202204291613",
+			Description: "drop identities kind column",
 			Migrate: func(tx migrator.DB) error {
 				stmt := `ALTER TABLE identities DROP COLUMN IF EXISTS kind`
 				_, err := tx.Exec(stmt)
@@ -39,7 +41,8 @@ func migrations() []*migrator.Migration {
 		},
 		// drop old Groups index; new index will be created automatically
 		{
-			ID: "2022-06-08T10:27-fixed",
+			ID:          "2022-06-08T10:27-fixed",
+			Description: "drop old groups name index",
 			Migrate: func(tx migrator.DB) error {
 				_, err := tx.Exec(`DROP INDEX IF EXISTS idx_groups_name_provider_id`)
 				return err
@@ -84,6 +87,32 @@ func migrations() []*migrator.Migration {
 		deviceFlowAuthRequestsAddUserIDProviderID(),
 		addDestinationCredentials(),
 		setGoogleSocialLoginDefaultID(),
+		addOrgSettingsTable(),
+		addOrganizationDomainAlias(),
+		addOrgSettingsRateLimits(),
+		addOrgSettingsAllowedSignupDomains(),
+		addAuditEventsTable(),
+		addDestinationLogsTable(),
+		addDestinationsUpdateIndex(),
+		addGrantsResourceIndex(),
+		addIdempotencyKeysTable(),
+		addWebhooksTables(),
+		addOrgSettingsMaxAccessKeyTTL(),
+		addDeviceFlowAuthRequestsDeniedLastPolled(),
+		addUserMFA(),
+		addCredentialsLoginAttempts(),
+		addIssuedTokens(),
+		addAccessKeysLastUsed(),
+		addAuditEventsSourceIP(),
+		addAuditEventsReason(),
+		addCredentialsOneTimePasswordExpiresAt(),
+		addImpersonation(),
+		addGrantsSubjectID(),
+		notifyGrantsByDestination(),
+		addAuditEventsTargetNameAndRetention(),
+		addDestinationUsageTable(),
+		addDestinationsMetrics(),
+		addImpersonationApprovalsTable(),
 		// next one here, then run `go test -run TestMigrations ./internal/server/data -update`
 	}
 }
@@ -1159,3 +1188,583 @@ func setGoogleSocialLoginDefaultID() *migrator.Migration {
 		},
 	}
 }
+
+func addOrgSettingsTable() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2022-12-19T10:00",
+		Migrate: func(tx migrator.DB) error {
+			stmt := `
+CREATE TABLE IF NOT EXISTS org_settings (
+    organization_id bigint NOT NULL,
+    updated_at timestamp with time zone,
+    access_key_ttl bigint DEFAULT 0 NOT NULL,
+    session_inactivity_timeout bigint DEFAULT 0 NOT NULL,
+    public_key_algorithms text DEFAULT ''::text NOT NULL
+);
+
+ALTER TABLE ONLY org_settings DROP CONSTRAINT IF EXISTS org_settings_pkey;
+ALTER TABLE ONLY org_settings
+    ADD CONSTRAINT org_settings_pkey PRIMARY KEY (organization_id);
+`
+			_, err := tx.Exec(stmt)
+			return err
+		},
+	}
+}
+
+func addOrganizationDomainAlias() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2022-12-20T10:00",
+		Migrate: func(tx migrator.DB) error {
+			_, err := tx.Exec(`
+				ALTER TABLE organizations
+					ADD COLUMN IF NOT EXISTS domain_alias text DEFAULT ''::text NOT NULL,
+					ADD COLUMN IF NOT EXISTS domain_alias_expires_at timestamp with time zone;
+			`)
+			return err
+		},
+	}
+}
+
+func addOrgSettingsRateLimits() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2022-12-21T10:00",
+		Migrate: func(tx migrator.DB) error {
+			_, err := tx.Exec(`
+				ALTER TABLE org_settings
+					ADD COLUMN IF NOT EXISTS rate_limit integer DEFAULT 0 NOT NULL,
+					ADD COLUMN IF NOT EXISTS connector_rate_limit integer DEFAULT 0 NOT NULL;
+			`)
+			return err
+		},
+	}
+}
+
+// addOrgSettingsAllowedSignupDomains adds the allowed_signup_domains column,
+// and copies the allowed_domains of existing organizations so that users who
+// could sign up before the migration can still sign up.
+func addOrgSettingsAllowedSignupDomains() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2022-12-22T10:00",
+		Migrate: func(tx migrator.DB) error {
+			stmt := `
+				ALTER TABLE org_settings
+					ADD COLUMN IF NOT EXISTS allowed_signup_domains text DEFAULT ''::text NOT NULL;
+
+				INSERT INTO org_settings (organization_id, updated_at, allowed_signup_domains)
+				SELECT id, now(), allowed_domains
+				FROM organizations
+				WHERE deleted_at is null AND allowed_domains <> ''
+				ON CONFLICT (organization_id) DO UPDATE
+				SET allowed_signup_domains = excluded.allowed_signup_domains;
+			`
+			_, err := tx.Exec(stmt)
+			return err
+		},
+	}
+}
+
+func addAuditEventsTable() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2022-12-23T10:00",
+		Migrate: func(tx migrator.DB) error {
+			stmt := `
+CREATE TABLE IF NOT EXISTS audit_events (
+    id bigint NOT NULL,
+    organization_id bigint NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    actor_id bigint DEFAULT 0 NOT NULL,
+    actor_name text DEFAULT ''::text NOT NULL,
+    action text NOT NULL,
+    target_type text DEFAULT ''::text NOT NULL,
+    target_id text DEFAULT ''::text NOT NULL,
+    result text NOT NULL,
+    request_id text DEFAULT ''::text NOT NULL
+);
+
+ALTER TABLE ONLY audit_events DROP CONSTRAINT IF EXISTS audit_events_pkey;
+ALTER TABLE ONLY audit_events
+    ADD CONSTRAINT audit_events_pkey PRIMARY KEY (id);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_org_created_at ON audit_events USING btree (organization_id, created_at);
+`
+			_, err := tx.Exec(stmt)
+			return err
+		},
+	}
+}
+
+func addDestinationLogsTable() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2022-12-27T10:00",
+		Migrate: func(tx migrator.DB) error {
+			stmt := `
+CREATE TABLE IF NOT EXISTS destination_logs (
+    id bigint NOT NULL,
+    organization_id bigint NOT NULL,
+    destination_id bigint NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    level text NOT NULL,
+    line text NOT NULL
+);
+
+ALTER TABLE ONLY destination_logs DROP CONSTRAINT IF EXISTS destination_logs_pkey;
+ALTER TABLE ONLY destination_logs
+    ADD CONSTRAINT destination_logs_pkey PRIMARY KEY (id);
+
+CREATE INDEX IF NOT EXISTS idx_destination_logs_org_dest_created_at ON destination_logs USING btree (organization_id, destination_id, created_at);
+`
+			_, err := tx.Exec(stmt)
+			return err
+		},
+	}
+}
+
+func addDestinationsUpdateIndex() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2023-01-04T10:00",
+		Migrate: func(tx migrator.DB) error {
+			stmt := `
+ALTER TABLE destinations ADD COLUMN IF NOT EXISTS update_index bigint;
+UPDATE destinations SET update_index = nextval('seq_update_index') WHERE update_index IS NULL;
+`
+			_, err := tx.Exec(stmt)
+			return err
+		},
+	}
+}
+
+// addGrantsResourceIndex adds an index for listing the grants of a
+// destination, which matches resource by equality and by prefix.
+func addGrantsResourceIndex() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2023-01-11T10:00",
+		Migrate: func(tx migrator.DB) error {
+			stmt := `
+CREATE INDEX IF NOT EXISTS idx_grants_resource ON grants USING btree (organization_id, resource text_pattern_ops) WHERE (deleted_at IS NULL);
+`
+			_, err := tx.Exec(stmt)
+			return err
+		},
+	}
+}
+
+func addIdempotencyKeysTable() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2023-01-18T10:00",
+		Migrate: func(tx migrator.DB) error {
+			stmt := `
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    id bigint NOT NULL,
+    organization_id bigint NOT NULL,
+    idempotency_key text NOT NULL,
+    request_hash text NOT NULL,
+    status_code integer NOT NULL,
+    response_body text NOT NULL,
+    created_at timestamp with time zone NOT NULL
+);
+
+ALTER TABLE ONLY idempotency_keys DROP CONSTRAINT IF EXISTS idempotency_keys_pkey;
+ALTER TABLE ONLY idempotency_keys
+    ADD CONSTRAINT idempotency_keys_pkey PRIMARY KEY (id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_idempotency_keys_key ON idempotency_keys USING btree (organization_id, idempotency_key);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys USING btree (created_at);
+`
+			_, err := tx.Exec(stmt)
+			return err
+		},
+	}
+}
+
+func addWebhooksTables() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2023-01-19T10:00",
+		Migrate: func(tx migrator.DB) error {
+			stmt := `
+CREATE TABLE IF NOT EXISTS webhooks (
+    id bigint NOT NULL,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    organization_id bigint NOT NULL,
+    url text NOT NULL,
+    secret text NOT NULL,
+    events text
+);
+
+ALTER TABLE ONLY webhooks DROP CONSTRAINT IF EXISTS webhooks_pkey;
+ALTER TABLE ONLY webhooks
+    ADD CONSTRAINT webhooks_pkey PRIMARY KEY (id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id bigint NOT NULL,
+    organization_id bigint NOT NULL,
+    webhook_id bigint NOT NULL,
+    event_type text NOT NULL,
+    payload text NOT NULL,
+    status text NOT NULL,
+    attempts integer DEFAULT 0 NOT NULL,
+    next_attempt_at timestamp with time zone,
+    last_attempt_at timestamp with time zone,
+    response_status integer DEFAULT 0 NOT NULL,
+    last_error text DEFAULT ''::text NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    updated_at timestamp with time zone NOT NULL
+);
+
+ALTER TABLE ONLY webhook_deliveries DROP CONSTRAINT IF EXISTS webhook_deliveries_pkey;
+ALTER TABLE ONLY webhook_deliveries
+    ADD CONSTRAINT webhook_deliveries_pkey PRIMARY KEY (id);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_created_at ON webhook_deliveries USING btree (created_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries USING btree (next_attempt_at) WHERE (status = 'pending'::text);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries USING btree (organization_id, webhook_id, created_at);
+`
+			_, err := tx.Exec(stmt)
+			return err
+		},
+	}
+}
+
+func addOrgSettingsMaxAccessKeyTTL() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2023-01-20T10:00",
+		Migrate: func(tx migrator.DB) error {
+			_, err := tx.Exec(`
+				ALTER TABLE org_settings
+					ADD COLUMN IF NOT EXISTS max_access_key_ttl bigint DEFAULT 0 NOT NULL;
+			`)
+			return err
+		},
+	}
+}
+
+func addDeviceFlowAuthRequestsDeniedLastPolled() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2023-01-23T10:00",
+		Migrate: func(tx migrator.DB) error {
+			_, err := tx.Exec(`
+				ALTER TABLE device_flow_auth_requests
+					ADD COLUMN IF NOT EXISTS denied boolean DEFAULT false NOT NULL,
+					ADD COLUMN IF NOT EXISTS last_polled_at timestamp with time zone;
+			`)
+			return err
+		},
+	}
+}
+
+func addUserMFA() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2023-01-24T10:00",
+		Migrate: func(tx migrator.DB) error {
+			stmt := `
+CREATE TABLE IF NOT EXISTS user_mfa (
+    id bigint NOT NULL,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    organization_id bigint NOT NULL,
+    identity_id bigint NOT NULL,
+    totp_secret text NOT NULL,
+    confirmed boolean DEFAULT false NOT NULL,
+    last_used_step bigint DEFAULT 0 NOT NULL,
+    recovery_codes text DEFAULT ''::text NOT NULL
+);
+
+ALTER TABLE ONLY user_mfa DROP CONSTRAINT IF EXISTS user_mfa_pkey;
+ALTER TABLE ONLY user_mfa
+    ADD CONSTRAINT user_mfa_pkey PRIMARY KEY (id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_mfa_identity_id ON user_mfa USING btree (organization_id, identity_id);
+
+ALTER TABLE org_settings
+    ADD COLUMN IF NOT EXISTS require_mfa boolean DEFAULT false NOT NULL;
+`
+			_, err := tx.Exec(stmt)
+			return err
+		},
+	}
+}
+
+func addCredentialsLoginAttempts() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2023-01-25T10:00",
+		Migrate: func(tx migrator.DB) error {
+			stmt := `
+ALTER TABLE credentials
+    ADD COLUMN IF NOT EXISTS failed_login_attempts integer DEFAULT 0 NOT NULL,
+    ADD COLUMN IF NOT EXISTS last_failed_login_at timestamp with time zone,
+    ADD COLUMN IF NOT EXISTS locked_until timestamp with time zone;
+`
+			_, err := tx.Exec(stmt)
+			return err
+		},
+	}
+}
+
+func addIssuedTokens() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2023-01-26T10:00",
+		Migrate: func(tx migrator.DB) error {
+			stmt := `
+CREATE TABLE IF NOT EXISTS issued_tokens (
+    id bigint NOT NULL,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    organization_id bigint NOT NULL,
+    identity_id bigint NOT NULL,
+    destination_name text DEFAULT ''::text NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    revoked_at timestamp with time zone,
+    update_index bigint DEFAULT 0 NOT NULL
+);
+
+ALTER TABLE ONLY issued_tokens DROP CONSTRAINT IF EXISTS issued_tokens_pkey;
+ALTER TABLE ONLY issued_tokens
+    ADD CONSTRAINT issued_tokens_pkey PRIMARY KEY (id);
+
+CREATE INDEX IF NOT EXISTS idx_issued_tokens_identity_id ON issued_tokens USING btree (organization_id, identity_id);
+
+CREATE OR REPLACE FUNCTION issued_tokens_notify() RETURNS trigger
+	LANGUAGE PLPGSQL
+	AS $$
+BEGIN
+PERFORM pg_notify(current_schema() || '.grants_' || NEW.organization_id, json_build_object('resource', NEW.destination_name)::text);
+RETURN NULL;
+END; $$;
+
+DROP TRIGGER IF EXISTS issued_tokens_notify_trigger on issued_tokens;
+
+CREATE TRIGGER issued_tokens_notify_trigger AFTER update OF revoked_at
+ON issued_tokens
+FOR EACH ROW EXECUTE FUNCTION issued_tokens_notify();
+`
+			_, err := tx.Exec(stmt)
+			return err
+		},
+	}
+}
+
+func addAccessKeysLastUsed() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2023-01-27T10:00",
+		Migrate: func(tx migrator.DB) error {
+			stmt := `
+ALTER TABLE access_keys
+    ADD COLUMN IF NOT EXISTS last_used_at timestamp with time zone,
+    ADD COLUMN IF NOT EXISTS last_used_ip text DEFAULT ''::text NOT NULL,
+    ADD COLUMN IF NOT EXISTS last_used_user_agent text DEFAULT ''::text NOT NULL;
+
+UPDATE access_keys SET last_used_at = updated_at WHERE last_used_at IS NULL;
+`
+			_, err := tx.Exec(stmt)
+			return err
+		},
+	}
+}
+
+func addAuditEventsSourceIP() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2023-01-28T10:00",
+		Migrate: func(tx migrator.DB) error {
+			stmt := `ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS source_ip text DEFAULT ''::text NOT NULL;`
+			_, err := tx.Exec(stmt)
+			return err
+		},
+	}
+}
+
+func addAuditEventsReason() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2023-01-29T10:00",
+		Migrate: func(tx migrator.DB) error {
+			stmt := `ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS reason text DEFAULT ''::text NOT NULL;`
+			_, err := tx.Exec(stmt)
+			return err
+		},
+	}
+}
+
+func addCredentialsOneTimePasswordExpiresAt() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2023-01-30T10:00",
+		Migrate: func(tx migrator.DB) error {
+			stmt := `ALTER TABLE credentials ADD COLUMN IF NOT EXISTS one_time_password_expires_at timestamp with time zone;`
+			_, err := tx.Exec(stmt)
+			return err
+		},
+	}
+}
+
+func addImpersonation() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2023-01-31T10:00",
+		Migrate: func(tx migrator.DB) error {
+			stmt := `
+ALTER TABLE access_keys ADD COLUMN IF NOT EXISTS impersonated_by bigint DEFAULT 0 NOT NULL;
+
+ALTER TABLE audit_events
+    ADD COLUMN IF NOT EXISTS impersonator_id bigint DEFAULT 0 NOT NULL,
+    ADD COLUMN IF NOT EXISTS impersonator_name text DEFAULT ''::text NOT NULL;
+`
+			_, err := tx.Exec(stmt)
+			return err
+		},
+	}
+}
+
+func addGrantsSubjectID() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2023-02-01T10:00",
+		Migrate: func(tx migrator.DB) error {
+			stmt := `
+ALTER TABLE grants ADD COLUMN IF NOT EXISTS subject_id bigint DEFAULT 0 NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_grants_subject_id ON grants
+    USING btree (organization_id, subject_id) WHERE (deleted_at IS NULL);
+`
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+
+			rows, err := tx.Query(`SELECT id, subject FROM grants WHERE subject_id = 0`)
+			if err != nil {
+				return err
+			}
+			grants, err := scanRows(rows, func(g *models.Grant) []any {
+				return []any{&g.ID, &g.Subject}
+			})
+			if err != nil {
+				return err
+			}
+
+			for i := range grants {
+				setGrantSubjectID(&grants[i])
+				if grants[i].SubjectID == 0 {
+					continue
+				}
+				stmt := `UPDATE grants SET subject_id = ? WHERE id = ?`
+				if _, err := tx.Exec(stmt, grants[i].SubjectID, grants[i].ID); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// notifyGrantsByDestination changes the payload of the grants notification to
+// the destination of the grant. Postgres only delivers one of the identical
+// notifications sent by a transaction, so a transaction that changes many
+// grants sends one notification for each destination.
+func notifyGrantsByDestination() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2023-02-06T10:00",
+		Migrate: func(tx migrator.DB) error {
+			stmt := `
+CREATE OR REPLACE FUNCTION grants_notify() RETURNS trigger
+	LANGUAGE PLPGSQL
+	AS $$
+BEGIN
+PERFORM pg_notify(current_schema() || '.grants_' || NEW.organization_id, json_build_object('resource', split_part(NEW.resource, '.', 1))::text);
+RETURN NULL;
+END; $$;
+`
+			_, err := tx.Exec(stmt)
+			return err
+		},
+	}
+}
+
+func addAuditEventsTargetNameAndRetention() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2023-02-08T10:00",
+		Migrate: func(tx migrator.DB) error {
+			stmt := `
+ALTER TABLE audit_events
+    ADD COLUMN IF NOT EXISTS target_name text DEFAULT ''::text NOT NULL,
+    ADD COLUMN IF NOT EXISTS metadata text DEFAULT '{}'::text NOT NULL;
+
+ALTER TABLE org_settings
+    ADD COLUMN IF NOT EXISTS audit_event_retention bigint DEFAULT 0 NOT NULL;
+`
+			_, err := tx.Exec(stmt)
+			return err
+		},
+	}
+}
+
+// addDestinationUsageTable adds the table for the daily usage of each
+// destination, and an index for aggregating the audit events of an action.
+func addDestinationUsageTable() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2023-02-15T10:00",
+		Migrate: func(tx migrator.DB) error {
+			stmt := `
+CREATE TABLE IF NOT EXISTS destination_usage (
+    id bigint NOT NULL,
+    organization_id bigint NOT NULL,
+    destination_id bigint NOT NULL,
+    day timestamp with time zone NOT NULL,
+    logins bigint DEFAULT 0 NOT NULL,
+    distinct_users bigint DEFAULT 0 NOT NULL,
+    proxy_requests bigint DEFAULT 0 NOT NULL
+);
+
+ALTER TABLE ONLY destination_usage DROP CONSTRAINT IF EXISTS destination_usage_pkey;
+ALTER TABLE ONLY destination_usage
+    ADD CONSTRAINT destination_usage_pkey PRIMARY KEY (id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_destination_usage_org_dest_day ON destination_usage USING btree (organization_id, destination_id, day);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_action_created_at ON audit_events USING btree (action, created_at);
+`
+			_, err := tx.Exec(stmt)
+			return err
+		},
+	}
+}
+
+// addDestinationsMetrics adds the column for the recent metrics reports of the
+// connector of a destination.
+func addDestinationsMetrics() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2023-02-16T10:00",
+		Migrate: func(tx migrator.DB) error {
+			stmt := `ALTER TABLE destinations ADD COLUMN IF NOT EXISTS metrics text;`
+			_, err := tx.Exec(stmt)
+			return err
+		},
+	}
+}
+
+// addImpersonationApprovalsTable adds the table for the approvals that allow
+// a user to impersonate a user with an admin role.
+func addImpersonationApprovalsTable() *migrator.Migration {
+	return &migrator.Migration{
+		ID: "2023-02-17T10:00",
+		Migrate: func(tx migrator.DB) error {
+			stmt := `
+CREATE TABLE IF NOT EXISTS impersonation_approvals (
+    id bigint NOT NULL,
+    organization_id bigint NOT NULL,
+    created_at timestamp with time zone,
+    identity_id bigint NOT NULL,
+    impersonator_id bigint NOT NULL,
+    approved_by bigint NOT NULL,
+    expires_at timestamp with time zone NOT NULL
+);
+
+ALTER TABLE ONLY impersonation_approvals DROP CONSTRAINT IF EXISTS impersonation_approvals_pkey;
+ALTER TABLE ONLY impersonation_approvals
+    ADD CONSTRAINT impersonation_approvals_pkey PRIMARY KEY (id);
+
+CREATE INDEX IF NOT EXISTS idx_impersonation_approvals_expires_at ON impersonation_approvals USING btree (expires_at);
+`
+			_, err := tx.Exec(stmt)
+			return err
+		},
+	}
+}
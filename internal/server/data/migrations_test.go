@@ -997,6 +997,250 @@ INSERT INTO providers(id, name) VALUES (12345, 'okta');
 				assert.DeepEqual(t, expectedKey, accessKey)
 			},
 		},
+		{
+			label: testCaseLine(addOrgSettingsTable().ID),
+			expected: func(t *testing.T, db WriteTxn) {
+				// schema changes are tested with schema comparison
+			},
+		},
+		{
+			label: testCaseLine(addOrganizationDomainAlias().ID),
+			expected: func(t *testing.T, db WriteTxn) {
+				// schema changes are tested with schema comparison
+			},
+		},
+		{
+			label: testCaseLine(addOrgSettingsRateLimits().ID),
+			expected: func(t *testing.T, db WriteTxn) {
+				// schema changes are tested with schema comparison
+			},
+		},
+		{
+			label: testCaseLine(addOrgSettingsAllowedSignupDomains().ID),
+			setup: func(t *testing.T, tx WriteTxn) {
+				stmt := `
+					INSERT INTO organizations(id, name, domain, allowed_domains)
+					VALUES (?, ?, ?, ?), (?, ?, ?, ?)
+				`
+				_, err := tx.Exec(stmt,
+					4001, "signup", "signup.example.com", "example.com,infrahq.com",
+					4002, "invite", "invite.example.com", "")
+				assert.NilError(t, err)
+			},
+			cleanup: func(t *testing.T, tx WriteTxn) {
+				_, err := tx.Exec(`DELETE FROM org_settings WHERE organization_id IN (4001, 4002)`)
+				assert.NilError(t, err)
+				_, err = tx.Exec(`DELETE FROM organizations WHERE id IN (4001, 4002)`)
+				assert.NilError(t, err)
+			},
+			expected: func(t *testing.T, tx WriteTxn) {
+				var domains string
+				err := tx.QueryRow(`SELECT allowed_signup_domains FROM org_settings WHERE organization_id = 4001`).Scan(&domains)
+				assert.NilError(t, err)
+				assert.Equal(t, domains, "example.com,infrahq.com")
+
+				var count int
+				err = tx.QueryRow(`SELECT count(*) FROM org_settings WHERE organization_id = 4002`).Scan(&count)
+				assert.NilError(t, err)
+				assert.Equal(t, count, 0)
+			},
+		},
+		{
+			label: testCaseLine(addAuditEventsTable().ID),
+			expected: func(t *testing.T, db WriteTxn) {
+				// schema changes are tested with schema comparison
+			},
+		},
+		{
+			label: testCaseLine(addDestinationLogsTable().ID),
+			expected: func(t *testing.T, db WriteTxn) {
+				// schema changes are tested with schema comparison
+			},
+		},
+		{
+			label: testCaseLine(addDestinationsUpdateIndex().ID),
+			setup: func(t *testing.T, tx WriteTxn) {
+				stmt := `
+					INSERT INTO destinations(id, name, organization_id)
+					VALUES (?, ?, ?)
+				`
+				_, err := tx.Exec(stmt, 5001, "the-destination", defaultOrganizationID)
+				assert.NilError(t, err)
+			},
+			cleanup: func(t *testing.T, tx WriteTxn) {
+				_, err := tx.Exec(`DELETE FROM destinations WHERE id = 5001`)
+				assert.NilError(t, err)
+			},
+			expected: func(t *testing.T, tx WriteTxn) {
+				var index int64
+				err := tx.QueryRow(`SELECT update_index FROM destinations WHERE id = 5001`).Scan(&index)
+				assert.NilError(t, err)
+				assert.Assert(t, index > 0)
+			},
+		},
+		{
+			label: testCaseLine(addGrantsResourceIndex().ID),
+			expected: func(t *testing.T, db WriteTxn) {
+				// schema changes are tested with schema comparison
+			},
+		},
+		{
+			label: testCaseLine(addIdempotencyKeysTable().ID),
+			expected: func(t *testing.T, db WriteTxn) {
+				// schema changes are tested with schema comparison
+			},
+		},
+		{
+			label: testCaseLine(addWebhooksTables().ID),
+			expected: func(t *testing.T, db WriteTxn) {
+				// schema changes are tested with schema comparison
+			},
+		},
+		{
+			label: testCaseLine(addOrgSettingsMaxAccessKeyTTL().ID),
+			expected: func(t *testing.T, db WriteTxn) {
+				// schema changes are tested with schema comparison
+			},
+		},
+		{
+			label: testCaseLine(addDeviceFlowAuthRequestsDeniedLastPolled().ID),
+			expected: func(t *testing.T, db WriteTxn) {
+				// schema changes are tested with schema comparison
+			},
+		},
+		{
+			label: testCaseLine(addUserMFA().ID),
+			expected: func(t *testing.T, db WriteTxn) {
+				// schema changes are tested with schema comparison
+			},
+		},
+		{
+			label: testCaseLine(addCredentialsLoginAttempts().ID),
+			expected: func(t *testing.T, db WriteTxn) {
+				// schema changes are tested with schema comparison
+			},
+		},
+		{
+			label: testCaseLine(addIssuedTokens().ID),
+			expected: func(t *testing.T, db WriteTxn) {
+				// schema changes are tested with schema comparison
+			},
+		},
+		{
+			label: testCaseLine(addAccessKeysLastUsed().ID),
+			setup: func(t *testing.T, tx WriteTxn) {
+				stmt := `
+					INSERT INTO access_keys(id, name, key_id, organization_id, updated_at)
+					VALUES (?, ?, ?, ?, ?)
+				`
+				updated := time.Date(2023, 1, 20, 10, 0, 0, 0, time.UTC)
+				_, err := tx.Exec(stmt, 5002, "the-key", "lastusedk1", defaultOrganizationID, updated)
+				assert.NilError(t, err)
+			},
+			cleanup: func(t *testing.T, tx WriteTxn) {
+				_, err := tx.Exec(`DELETE FROM access_keys WHERE id = 5002`)
+				assert.NilError(t, err)
+			},
+			expected: func(t *testing.T, tx WriteTxn) {
+				var lastUsed time.Time
+				var ip, userAgent string
+				err := tx.QueryRow(`SELECT last_used_at, last_used_ip, last_used_user_agent FROM access_keys WHERE id = 5002`).
+					Scan(&lastUsed, &ip, &userAgent)
+				assert.NilError(t, err)
+				assert.Equal(t, lastUsed.UTC(), time.Date(2023, 1, 20, 10, 0, 0, 0, time.UTC))
+				assert.Equal(t, ip, "")
+				assert.Equal(t, userAgent, "")
+			},
+		},
+		{
+			label: testCaseLine(addAuditEventsSourceIP().ID),
+			expected: func(t *testing.T, db WriteTxn) {
+				// schema changes are tested with schema comparison
+			},
+		},
+		{
+			label: testCaseLine(addAuditEventsReason().ID),
+			expected: func(t *testing.T, db WriteTxn) {
+				// schema changes are tested with schema comparison
+			},
+		},
+		{
+			label: testCaseLine(addCredentialsOneTimePasswordExpiresAt().ID),
+			expected: func(t *testing.T, db WriteTxn) {
+				// schema changes are tested with schema comparison
+			},
+		},
+		{
+			label: testCaseLine(addImpersonation().ID),
+			expected: func(t *testing.T, db WriteTxn) {
+				// schema changes are tested with schema comparison
+			},
+		},
+		{
+			label: testCaseLine(addGrantsSubjectID().ID),
+			setup: func(t *testing.T, tx WriteTxn) {
+				stmt := `
+					INSERT INTO grants(id, subject, privilege, resource, organization_id)
+					VALUES (?, ?, ?, ?, ?), (?, ?, ?, ?, ?)
+				`
+				_, err := tx.Exec(stmt,
+					6001, "g:3ACTaqEkJJ", "view", "infra", defaultOrganizationID,
+					6002, "i:3ACTaqEkJK", "view", "infra", defaultOrganizationID)
+				assert.NilError(t, err)
+			},
+			cleanup: func(t *testing.T, tx WriteTxn) {
+				_, err := tx.Exec(`DELETE FROM grants WHERE id IN (6001, 6002)`)
+				assert.NilError(t, err)
+			},
+			expected: func(t *testing.T, tx WriteTxn) {
+				rows, err := tx.Query(`SELECT id, subject_id FROM grants WHERE id IN (6001, 6002) ORDER BY id`)
+				assert.NilError(t, err)
+				actual, err := scanRows(rows, func(g *models.Grant) []any {
+					return []any{&g.ID, &g.SubjectID}
+				})
+				assert.NilError(t, err)
+
+				groupID, err := uid.Parse([]byte("3ACTaqEkJJ"))
+				assert.NilError(t, err)
+				userID, err := uid.Parse([]byte("3ACTaqEkJK"))
+				assert.NilError(t, err)
+				expected := []models.Grant{
+					{Model: models.Model{ID: 6001}, SubjectID: groupID},
+					{Model: models.Model{ID: 6002}, SubjectID: userID},
+				}
+				assert.DeepEqual(t, actual, expected)
+			},
+		},
+		{
+			label: testCaseLine(notifyGrantsByDestination().ID),
+			expected: func(t *testing.T, tx WriteTxn) {
+				// function changes are tested with schema comparison
+			},
+		},
+		{
+			label: testCaseLine(addAuditEventsTargetNameAndRetention().ID),
+			expected: func(t *testing.T, tx WriteTxn) {
+				// schema changes are tested with schema comparison
+			},
+		},
+		{
+			label: testCaseLine(addDestinationUsageTable().ID),
+			expected: func(t *testing.T, tx WriteTxn) {
+				// schema changes are tested with schema comparison
+			},
+		},
+		{
+			label: testCaseLine(addDestinationsMetrics().ID),
+			expected: func(t *testing.T, tx WriteTxn) {
+				// schema changes are tested with schema comparison
+			},
+		},
+		{
+			label: testCaseLine(addImpersonationApprovalsTable().ID),
+			expected: func(t *testing.T, tx WriteTxn) {
+				// schema changes are tested with schema comparison
+			},
+		},
 	}
 
 	ids := make(map[string]struct{}, len(testCases))
@@ -1092,6 +1336,91 @@ and the migration.`)
 	})
 }
 
+func TestPendingMigrations(t *testing.T) {
+	if testing.Short() {
+		t.Skip("too slow for -short run")
+	}
+	patch.ModelsSymmetricKey(t)
+	logging.PatchLogger(t, zerolog.NewTestWriter(t))
+
+	dsn := database.PostgresDriver(t, "").DSN
+	rawDB, err := newRawDB(NewDBOptions{DSN: dsn})
+	assert.NilError(t, err)
+	t.Cleanup(func() {
+		assert.NilError(t, rawDB.Close())
+	})
+
+	// the fixture was created before applied_at and version were recorded
+	raw, err := ioutil.ReadFile("testdata/migrations/202204281130-postgres.sql")
+	assert.NilError(t, err)
+	_, err = rawDB.Exec(string(raw))
+	assert.NilError(t, err)
+
+	// migrate to a few migrations behind the latest
+	allMigrations := migrations()
+	behind := 3
+	applied := allMigrations[:len(allMigrations)-behind]
+	migrate(t, &DB{DB: rawDB}, migrator.Options{Version: "0.1.0"}, applied)
+
+	pending, err := PendingMigrations(NewDBOptions{DSN: dsn})
+	assert.NilError(t, err)
+
+	var pendingIDs []string
+	for _, p := range pending {
+		pendingIDs = append(pendingIDs, p.ID)
+		assert.Assert(t, p.Description != "", p.ID)
+	}
+	var expected []string
+	for _, m := range allMigrations[len(applied):] {
+		expected = append(expected, m.ID)
+	}
+	assert.DeepEqual(t, pendingIDs, expected)
+	assert.Equal(t, pending[len(pending)-1].Description, "addImpersonationApprovalsTable")
+
+	t.Run("status", func(t *testing.T) {
+		status, err := MigrationStatus(rawDB)
+		assert.NilError(t, err)
+		assert.Equal(t, len(status), len(allMigrations)+1)
+
+		byID := map[string]migrator.MigrationStatus{}
+		for _, s := range status {
+			byID[s.ID] = s
+		}
+
+		// applied by the fixture
+		fromFixture := byID["SCHEMA_INIT"]
+		assert.Assert(t, !fromFixture.Pending)
+		assert.Assert(t, fromFixture.AppliedAt.IsZero())
+		assert.Equal(t, fromFixture.Version, "")
+
+		// applied by the migrator
+		last := byID[applied[len(applied)-1].ID]
+		assert.Assert(t, !last.Pending)
+		assert.Assert(t, !last.AppliedAt.IsZero())
+		assert.Equal(t, last.Version, "0.1.0")
+
+		assert.Assert(t, byID[allMigrations[len(allMigrations)-1].ID].Pending)
+	})
+
+	t.Run("nothing pending after migrate", func(t *testing.T) {
+		migrate(t, &DB{DB: rawDB}, migrator.Options{Version: "0.2.0"}, allMigrations)
+
+		pending, err := PendingMigrations(NewDBOptions{DSN: dsn})
+		assert.NilError(t, err)
+		assert.Equal(t, len(pending), 0)
+	})
+}
+
+func migrate(t *testing.T, db *DB, opts migrator.Options, mgs []*migrator.Migration) {
+	t.Helper()
+	tx, err := db.Begin(context.Background(), nil)
+	assert.NilError(t, err)
+	defer tx.Rollback()
+
+	assert.NilError(t, migrator.New(tx, opts, mgs).Migrate())
+	assert.NilError(t, tx.Commit())
+}
+
 func parseTime(t *testing.T, s string) time.Time {
 	t.Helper()
 	v, err := time.Parse(time.RFC3339Nano, s)
@@ -4,11 +4,17 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
 
 	"github.com/infrahq/infra/internal/logging"
 )
 
-const initSchemaMigrationID = "SCHEMA_INIT"
+// InitSchemaMigrationID is the ID recorded in the migrations table when the
+// schema is created by Options.InitSchema.
+const InitSchemaMigrationID = "SCHEMA_INIT"
 
 // Options used by the Migrator to perform database migrations.
 type Options struct {
@@ -21,6 +27,10 @@ type Options struct {
 	// LoadKey is an optional function to initialize an encryption key from the
 	// database, that is used to encrypt other fields.
 	LoadKey func(DB) error
+
+	// Version is the version of the binary applying the migrations. It is
+	// recorded in the migrations table alongside each migration ID.
+	Version string
 }
 
 // Migration defines a database migration, and an optional rollback.
@@ -31,6 +41,31 @@ type Migration struct {
 	Migrate func(DB) error
 	// Rollback will be executed on rollback. Can be nil.
 	Rollback func(DB) error
+	// Description is a short summary of the migration, shown to operators
+	// before the migration is applied. When empty, the name of the function
+	// that defines Migrate is used.
+	Description string
+}
+
+// Describe returns the Description of the migration, or the name of the
+// function that defined Migrate when there is no Description.
+func (m *Migration) Describe() string {
+	if m.Description != "" || m.Migrate == nil {
+		return m.Description
+	}
+	fn := runtime.FuncForPC(reflect.ValueOf(m.Migrate).Pointer())
+	if fn == nil {
+		return ""
+	}
+	name := fn.Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	parts := strings.Split(name, ".")
+	// parts is package, function, and any number of closure names, ex:
+	// data.addDestinationsUpdateIndex.func1
+	if len(parts) < 2 {
+		return name
+	}
+	return parts[1]
 }
 
 type DB interface {
@@ -108,7 +143,7 @@ func (g *Migrator) validate() error {
 		switch m.ID {
 		case "":
 			return fmt.Errorf("migration is missing an ID")
-		case initSchemaMigrationID:
+		case InitSchemaMigrationID:
 			return fmt.Errorf("migration can not use reserved ID: %v", m.ID)
 		}
 		if _, ok := lookup[m.ID]; ok {
@@ -120,7 +155,7 @@ func (g *Migrator) validate() error {
 }
 
 func (g *Migrator) checkIDExist(migrationID string) error {
-	if migrationID == initSchemaMigrationID {
+	if migrationID == InitSchemaMigrationID {
 		return nil
 	}
 	for _, migrate := range g.migrations {
@@ -175,7 +210,7 @@ func (g *Migrator) runInitSchema() error {
 	if err := g.options.InitSchema(g.tx); err != nil {
 		return err
 	}
-	if err := g.insertMigration(initSchemaMigrationID); err != nil {
+	if err := g.insertMigration(InitSchemaMigrationID); err != nil {
 		return err
 	}
 	for _, migration := range g.migrations {
@@ -202,11 +237,19 @@ func (g *Migrator) runMigration(migration *Migration) error {
 }
 
 func (g *Migrator) createMigrationTableIfNotExists() error {
-	if HasTable(g.tx, "migrations") {
-		return nil
+	if !HasTable(g.tx, "migrations") {
+		_, err := g.tx.Exec("CREATE TABLE migrations (id VARCHAR(255) PRIMARY KEY)")
+		if err != nil {
+			return err
+		}
 	}
 
-	_, err := g.tx.Exec("CREATE TABLE migrations (id VARCHAR(255) PRIMARY KEY)")
+	// applied_at and version were added after the migrations table, so they
+	// are added to existing tables as well.
+	_, err := g.tx.Exec(`
+		ALTER TABLE migrations
+			ADD COLUMN IF NOT EXISTS applied_at timestamp with time zone,
+			ADD COLUMN IF NOT EXISTS version text`)
 	return err
 }
 
@@ -219,7 +262,7 @@ func (g *Migrator) migrationRan(m *Migration) (bool, error) {
 }
 
 func (g *Migrator) mustInitializeSchema() (bool, error) {
-	migrationRan, err := g.migrationRan(&Migration{ID: initSchemaMigrationID})
+	migrationRan, err := g.migrationRan(&Migration{ID: InitSchemaMigrationID})
 	if err != nil {
 		return false, err
 	}
@@ -234,6 +277,102 @@ func (g *Migrator) mustInitializeSchema() (bool, error) {
 }
 
 func (g *Migrator) insertMigration(id string) error {
-	_, err := g.tx.Exec("INSERT INTO migrations (id) VALUES ($1)", id)
+	_, err := g.tx.Exec("INSERT INTO migrations (id, applied_at, version) VALUES ($1, $2, $3)",
+		id, time.Now().UTC(), g.options.Version)
 	return err
 }
+
+// MigrationStatus describes a migration, and when it was applied to the
+// database.
+type MigrationStatus struct {
+	ID          string
+	Description string
+	// AppliedAt is the time the migration was applied. It is zero when the
+	// migration is pending, or when it was applied before the time was
+	// recorded.
+	AppliedAt time.Time
+	// Version is the version of the binary that applied the migration. It is
+	// empty when the migration is pending, or when it was applied before the
+	// version was recorded.
+	Version string
+	Pending bool
+}
+
+// Status returns the status of the initial schema and of every migration, in
+// the order they would be applied. Status does not modify the database, so
+// it can be used to check which migrations would be run by Migrate.
+func (g *Migrator) Status() ([]MigrationStatus, error) {
+	if err := g.validate(); err != nil {
+		return nil, err
+	}
+
+	all := make([]*Migration, 0, len(g.migrations)+1)
+	all = append(all, &Migration{ID: InitSchemaMigrationID, Description: "initialize the schema"})
+	all = append(all, g.migrations...)
+
+	applied, err := g.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	// When the schema is initialized all the known migrations are recorded
+	// without running them, so none of them are pending.
+	_, schemaInitialized := applied[InitSchemaMigrationID]
+	initSchema := !schemaInitialized && len(applied) == 0 && g.options.InitSchema != nil
+
+	result := make([]MigrationStatus, 0, len(all))
+	for _, m := range all {
+		status := MigrationStatus{ID: m.ID, Description: m.Describe()}
+		if a, ok := applied[m.ID]; ok {
+			status.AppliedAt = a.AppliedAt
+			status.Version = a.Version
+		} else {
+			status.Pending = m.ID == InitSchemaMigrationID || !initSchema
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+// Pending returns the status of the migrations that would be run by Migrate.
+func (g *Migrator) Pending() ([]MigrationStatus, error) {
+	all, err := g.Status()
+	if err != nil {
+		return nil, err
+	}
+	var pending []MigrationStatus
+	for _, m := range all {
+		if m.Pending {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+func (g *Migrator) appliedMigrations() (map[string]MigrationStatus, error) {
+	result := map[string]MigrationStatus{}
+	if !HasTable(g.tx, "migrations") {
+		return result, nil
+	}
+
+	stmt := `SELECT id, NULL, NULL FROM migrations`
+	if HasColumn(g.tx, "migrations", "applied_at") && HasColumn(g.tx, "migrations", "version") {
+		stmt = `SELECT id, applied_at, version FROM migrations`
+	}
+	rows, err := g.tx.Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var appliedAt sql.NullTime
+		var version sql.NullString
+		if err := rows.Scan(&id, &appliedAt, &version); err != nil {
+			return nil, err
+		}
+		result[id] = MigrationStatus{ID: id, AppliedAt: appliedAt.Time, Version: version.String}
+	}
+	return result, rows.Err()
+}
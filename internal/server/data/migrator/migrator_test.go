@@ -110,21 +110,21 @@ func TestMigration_RunsNewMigrations(t *testing.T) {
 		assert.NilError(t, err)
 		assert.Assert(t, HasTable(db, "people"))
 		assert.Assert(t, HasTable(db, "pets"))
-		expected := []string{initSchemaMigrationID, "201608301400", "201608301430"}
+		expected := []string{InitSchemaMigrationID, "201608301400", "201608301430"}
 		assert.DeepEqual(t, migrationIDs(t, db), expected)
 
 		err = m.RollbackTo(migrations[len(migrations)-2].ID)
 		assert.NilError(t, err)
 		assert.Assert(t, HasTable(db, "people"))
 		assert.Assert(t, !HasTable(db, "pets"))
-		expected = []string{initSchemaMigrationID, "201608301400"}
+		expected = []string{InitSchemaMigrationID, "201608301400"}
 		assert.DeepEqual(t, migrationIDs(t, db), expected)
 
-		err = m.RollbackTo(initSchemaMigrationID)
+		err = m.RollbackTo(InitSchemaMigrationID)
 		assert.NilError(t, err)
 		assert.Assert(t, !HasTable(db, "people"))
 		assert.Assert(t, !HasTable(db, "pets"))
-		expected = []string{initSchemaMigrationID}
+		expected = []string{InitSchemaMigrationID}
 		assert.DeepEqual(t, migrationIDs(t, db), expected)
 	})
 }
@@ -162,7 +162,7 @@ func TestRollbackTo(t *testing.T) {
 		assert.Assert(t, HasTable(db, "people"))
 		assert.Assert(t, HasTable(db, "pets"))
 		assert.Assert(t, HasTable(db, "books"))
-		expected := []string{initSchemaMigrationID, "201608301400", "201608301430", "201807221927"}
+		expected := []string{InitSchemaMigrationID, "201608301400", "201608301430", "201807221927"}
 		assert.DeepEqual(t, migrationIDs(t, db), expected)
 
 		// Rollback to the first migration: only the last 2 migrations are expected to be rolled back.
@@ -171,7 +171,7 @@ func TestRollbackTo(t *testing.T) {
 		assert.Assert(t, HasTable(db, "people"))
 		assert.Assert(t, !HasTable(db, "pets"))
 		assert.Assert(t, !HasTable(db, "books"))
-		expected = []string{initSchemaMigrationID, "201608301400"}
+		expected = []string{InitSchemaMigrationID, "201608301400"}
 		assert.DeepEqual(t, migrationIDs(t, db), expected)
 	})
 }
@@ -272,7 +272,7 @@ func TestInitSchemaExistingMigrations(t *testing.T) {
 		assert.NilError(t, m.Migrate())
 
 		assert.Assert(t, !HasTable(db, "cars"))
-		expected := []string{initSchemaMigrationID, "201608301400", "201608301430"}
+		expected := []string{InitSchemaMigrationID, "201608301400", "201608301430"}
 		assert.DeepEqual(t, migrationIDs(t, db), expected)
 	})
 }
@@ -345,6 +345,88 @@ func TestMigrate_WithUnknownMigrationsInTable(t *testing.T) {
 	})
 }
 
+func TestStatus(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db DB) {
+		t.Run("before the schema is initialized", func(t *testing.T) {
+			m := New(db, DefaultOptions, migrations)
+			pending, err := m.Pending()
+			assert.NilError(t, err)
+			// migrations are recorded, not run, when the schema is initialized
+			assert.DeepEqual(t, statusIDs(pending), []string{InitSchemaMigrationID})
+			assert.Assert(t, !HasTable(db, "migrations"))
+		})
+
+		initEmptyMigrations(t, db)
+		opts := DefaultOptions
+		opts.Version = "0.1.0"
+		assert.NilError(t, New(db, opts, migrations).Migrate())
+
+		m := New(db, opts, extendedMigrations)
+		status, err := m.Status()
+		assert.NilError(t, err)
+		assert.DeepEqual(t, statusIDs(status),
+			[]string{InitSchemaMigrationID, "201608301400", "201608301430", "201807221927"})
+
+		applied := status[2]
+		assert.Assert(t, !applied.Pending)
+		assert.Equal(t, applied.Version, "0.1.0")
+		assert.Assert(t, !applied.AppliedAt.IsZero())
+		assert.Assert(t, status[3].Pending)
+		assert.Assert(t, status[3].AppliedAt.IsZero())
+
+		pending, err := m.Pending()
+		assert.NilError(t, err)
+		assert.DeepEqual(t, statusIDs(pending), []string{"201807221927"})
+		assert.Assert(t, !HasTable(db, "books"), "status must not run migrations")
+	})
+}
+
+func TestStatus_MigrationsTableWithoutAppliedAt(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db DB) {
+		_, err := db.Exec("CREATE TABLE migrations (id VARCHAR(255) PRIMARY KEY)")
+		assert.NilError(t, err)
+		_, err = db.Exec("INSERT INTO migrations (id) VALUES ('SCHEMA_INIT'), ('201608301400')")
+		assert.NilError(t, err)
+
+		m := New(db, DefaultOptions, migrations)
+		status, err := m.Status()
+		assert.NilError(t, err)
+		assert.Assert(t, !status[1].Pending)
+		assert.Assert(t, status[1].AppliedAt.IsZero())
+		assert.Assert(t, status[2].Pending)
+
+		// Migrate adds the columns to the existing table
+		assert.NilError(t, m.Migrate())
+		assert.Assert(t, HasColumn(db, "migrations", "applied_at"))
+		assert.Assert(t, HasColumn(db, "migrations", "version"))
+	})
+}
+
+func TestMigration_Description(t *testing.T) {
+	m := &Migration{ID: "1", Description: "the description"}
+	assert.Equal(t, m.Describe(), "the description")
+
+	m = namedMigration()
+	assert.Equal(t, m.Describe(), "namedMigration")
+}
+
+func namedMigration() *Migration {
+	return &Migration{
+		ID: "2",
+		Migrate: func(tx DB) error {
+			return nil
+		},
+	}
+}
+
+func statusIDs(status []MigrationStatus) []string {
+	var ids []string
+	for _, s := range status {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
+
 func migrationCount(t *testing.T, db DB) (count int64) {
 	t.Helper()
 	err := db.QueryRow(`SELECT count(id) from migrations`).Scan(&count)
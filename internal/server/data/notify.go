@@ -7,7 +7,9 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
 	pgxstdlib "github.com/jackc/pgx/v4/stdlib"
 
@@ -18,18 +20,80 @@ import (
 type Listener struct {
 	sqlDB   *sql.DB
 	pgxConn *pgx.Conn
+	// waiter receives the notifications. It is pgxConn, except in tests.
+	waiter notificationWaiter
+	// pollInterval is used instead of notifications when waiter is nil,
+	// because the database does not support LISTEN.
+	pollInterval time.Duration
+	// coalesceWindow is how long WaitForNotification continues to receive
+	// notifications after the first matching notification, so that a burst of
+	// changes wakes the caller once. Zero returns at the first match.
+	coalesceWindow time.Duration
 
 	isMatchingNotify func(payload string) error
 }
 
+// notificationWaiter is implemented by *pgx.Conn.
+type notificationWaiter interface {
+	WaitForNotification(ctx context.Context) (*pgconn.Notification, error)
+}
+
+// grantsNotifyCoalesceWindow is the coalesceWindow of listeners for grants.
+// Changing many grants at once, for example by applying a config file, sends
+// a notification for each transaction, and connectors only need to list the
+// grants once for all of them.
+const grantsNotifyCoalesceWindow = 250 * time.Millisecond
+
 var errNotificationNoMatch = fmt.Errorf("notification did not match")
 
 // WaitForNotification blocks until the listener receivers a notification on
 // one of the channels, or until the context is cancelled.
 // Returns the notification on success, or an error on failure or timeout.
+//
+// When the database does not support notifications, WaitForNotification
+// returns after a short interval, and the caller must check for changes.
 func (l *Listener) WaitForNotification(ctx context.Context) error {
+	if l.waiter == nil {
+		timer := time.NewTimer(l.pollInterval)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return nil
+		}
+	}
+	if err := l.waitForMatch(ctx); err != nil {
+		return err
+	}
+	if l.coalesceWindow == 0 {
+		return nil
+	}
+
+	// discard the notifications sent during the window, because the caller
+	// reads every change after WaitForNotification returns.
+	windowCtx, cancel := context.WithTimeout(ctx, l.coalesceWindow)
+	defer cancel()
 	for {
-		notficaition, err := l.pgxConn.WaitForNotification(ctx)
+		err := l.waitForMatch(windowCtx)
+		switch {
+		case err == nil:
+			continue
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case windowCtx.Err() != nil:
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+// waitForMatch blocks until the listener receives a notification that
+// matches isMatchingNotify.
+func (l *Listener) waitForMatch(ctx context.Context) error {
+	for {
+		notification, err := l.waiter.WaitForNotification(ctx)
 		if err != nil {
 			return err
 		}
@@ -38,7 +102,7 @@ func (l *Listener) WaitForNotification(ctx context.Context) error {
 			return nil
 		}
 
-		err = l.isMatchingNotify(notficaition.Payload)
+		err = l.isMatchingNotify(notification.Payload)
 		switch {
 		case errors.Is(err, errNotificationNoMatch):
 			continue
@@ -51,6 +115,9 @@ func (l *Listener) WaitForNotification(ctx context.Context) error {
 }
 
 func (l *Listener) Release(ctx context.Context) error {
+	if l.pgxConn == nil {
+		return nil
+	}
 	var errs []error
 	logging.Debugf("unlisten *")
 	if _, err := l.pgxConn.Exec(ctx, `UNLISTEN *`); err != nil {
@@ -65,6 +132,10 @@ func (l *Listener) Release(ctx context.Context) error {
 	return nil
 }
 
+// notifyPollInterval is how often a Listener checks for changes when the
+// database does not support notifications.
+const notifyPollInterval = 2 * time.Second
+
 type ListenForNotifyOptions struct {
 	OrgID                                 uid.ID
 	GrantsByDestination                   string
@@ -75,7 +146,8 @@ type ListenForNotifyOptions struct {
 // ListenForNotify starts listening for notification on one or more
 // postgres channels for notifications that a grant has changed. The channels to
 // listen on are determined by opts. Use Listener.WaitForNotification to block
-// and receive notifications.
+// and receive notifications. SQLite does not support notifications, so the
+// Listener polls instead.
 //
 // If error is nil the caller must call Listener.Release to return the database
 // connection to the pool.
@@ -83,6 +155,9 @@ func ListenForNotify(ctx context.Context, db *DB, opts ListenForNotifyOptions) (
 	if opts.OrgID == 0 {
 		return nil, fmt.Errorf("OrgID is required")
 	}
+	if db.dialect != nil {
+		return &Listener{pollInterval: notifyPollInterval}, nil
+	}
 
 	sqlDB := db.SQLdb()
 	pgxConn, err := pgxstdlib.AcquireConn(sqlDB)
@@ -90,7 +165,7 @@ func ListenForNotify(ctx context.Context, db *DB, opts ListenForNotifyOptions) (
 		return nil, err
 	}
 
-	listener := &Listener{sqlDB: sqlDB, pgxConn: pgxConn}
+	listener := &Listener{sqlDB: sqlDB, pgxConn: pgxConn, waiter: pgxConn}
 
 	var channel string
 	switch {
@@ -113,18 +188,26 @@ func ListenForNotify(ctx context.Context, db *DB, opts ListenForNotifyOptions) (
 
 	switch {
 	case opts.GrantsByDestination != "":
-		listener.isMatchingNotify = func(payload string) error {
-			var grant grantJSON
-			err := json.Unmarshal([]byte(payload), &grant)
-			if err != nil {
-				return err
-			}
-			destination, _, _ := strings.Cut(grant.Resource, ".")
-			if destination != opts.GrantsByDestination {
-				return errNotificationNoMatch
-			}
-			return nil
-		}
+		listener.coalesceWindow = grantsNotifyCoalesceWindow
+		listener.isMatchingNotify = grantsByDestinationMatcher(opts.GrantsByDestination)
 	}
 	return listener, nil
 }
+
+// grantsByDestinationMatcher returns the isMatchingNotify of a Listener for
+// the grants of destination.
+func grantsByDestinationMatcher(destination string) func(payload string) error {
+	return func(payload string) error {
+		var grant grantJSON
+		if err := json.Unmarshal([]byte(payload), &grant); err != nil {
+			return err
+		}
+		grantDestination, _, _ := strings.Cut(grant.Resource, ".")
+		// an empty resource is sent when a token that is accepted by
+		// every destination is revoked
+		if grantDestination != "" && grantDestination != destination {
+			return errNotificationNoMatch
+		}
+		return nil
+	}
+}
@@ -0,0 +1,109 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"gotest.tools/v3/assert"
+)
+
+// fakeWaiter is a notificationWaiter that receives notifications from ch.
+type fakeWaiter struct {
+	ch chan string
+}
+
+func (f *fakeWaiter) WaitForNotification(ctx context.Context) (*pgconn.Notification, error) {
+	select {
+	case payload := <-f.ch:
+		return &pgconn.Notification{Payload: payload}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestListener_WaitForNotification_Coalesce(t *testing.T) {
+	waiter := &fakeWaiter{ch: make(chan string, 2000)}
+	listener := &Listener{
+		waiter:           waiter,
+		coalesceWindow:   50 * time.Millisecond,
+		isMatchingNotify: grantsByDestinationMatcher("mydest"),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wakeups := make(chan struct{}, 100)
+	done := make(chan error, 1)
+	go func() {
+		for {
+			err := listener.WaitForNotification(ctx)
+			if err != nil {
+				done <- err
+				return
+			}
+			wakeups <- struct{}{}
+		}
+	}()
+
+	sendBurst := func(count int, resource string) {
+		for i := 0; i < count; i++ {
+			waiter.ch <- `{"resource":"` + resource + `"}`
+		}
+	}
+
+	t.Run("burst of changes to the destination", func(t *testing.T) {
+		sendBurst(1000, "mydest")
+		isNotBlockedAfter(t, wakeups, time.Second)
+		isBlocked(t, wakeups)
+		assert.Equal(t, len(waiter.ch), 0)
+	})
+
+	t.Run("burst of changes to other destinations", func(t *testing.T) {
+		sendBurst(1000, "otherdest")
+		isBlocked(t, wakeups)
+		assert.Equal(t, len(waiter.ch), 0)
+	})
+
+	t.Run("changes in separate windows", func(t *testing.T) {
+		sendBurst(10, "mydest.namespace")
+		isNotBlockedAfter(t, wakeups, time.Second)
+		sendBurst(10, "mydest")
+		isNotBlockedAfter(t, wakeups, time.Second)
+		isBlocked(t, wakeups)
+	})
+
+	t.Run("cancelled during the window", func(t *testing.T) {
+		sendBurst(1, "mydest")
+		cancel()
+		err := <-done
+		assert.Assert(t, errors.Is(err, context.Canceled), err)
+		assert.Equal(t, len(wakeups), 0)
+	})
+}
+
+func TestListener_WaitForNotification_NoCoalesce(t *testing.T) {
+	waiter := &fakeWaiter{ch: make(chan string, 10)}
+	listener := &Listener{waiter: waiter}
+
+	for i := 0; i < 3; i++ {
+		waiter.ch <- "payload"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i := 0; i < 3; i++ {
+		assert.NilError(t, listener.WaitForNotification(ctx))
+	}
+	assert.Equal(t, len(waiter.ch), 0)
+}
+
+func isNotBlockedAfter[T any](t *testing.T, ch chan T, timeout time.Duration) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(timeout):
+		t.Fatalf("expected operation to not block, timeout after: %v", timeout)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/infrahq/infra/internal"
 	"github.com/infrahq/infra/internal/server/data/querybuilder"
 	"github.com/infrahq/infra/internal/server/models"
 	"github.com/infrahq/infra/uid"
@@ -16,15 +17,15 @@ func (organizationsTable) Table() string {
 }
 
 func (o organizationsTable) Columns() []string {
-	return []string{"created_at", "created_by", "deleted_at", "domain", "id", "name", "updated_at", "allowed_domains"}
+	return []string{"created_at", "created_by", "deleted_at", "domain", "id", "name", "updated_at", "allowed_domains", "domain_alias", "domain_alias_expires_at"}
 }
 
 func (o organizationsTable) Values() []any {
-	return []any{o.CreatedAt, o.CreatedBy, o.DeletedAt, o.Domain, o.ID, o.Name, o.UpdatedAt, o.AllowedDomains}
+	return []any{o.CreatedAt, o.CreatedBy, o.DeletedAt, o.Domain, o.ID, o.Name, o.UpdatedAt, o.AllowedDomains, o.DomainAlias, o.DomainAliasExpiresAt}
 }
 
 func (o *organizationsTable) ScanFields() []any {
-	return []any{&o.CreatedAt, &o.CreatedBy, &o.DeletedAt, &o.Domain, &o.ID, &o.Name, &o.UpdatedAt, &o.AllowedDomains}
+	return []any{&o.CreatedAt, &o.CreatedBy, &o.DeletedAt, &o.Domain, &o.ID, &o.Name, &o.UpdatedAt, &o.AllowedDomains, &o.DomainAlias, &o.DomainAliasExpiresAt}
 }
 
 // CreateOrganization creates a new organization, and initializes it with
@@ -33,6 +34,9 @@ func CreateOrganization(tx WriteTxn, org *models.Organization) error {
 	if org.Name == "" {
 		return fmt.Errorf("Organization.Name is required")
 	}
+	if err := checkDomainAvailable(tx, org); err != nil {
+		return err
+	}
 	if err := insert(tx, (*organizationsTable)(org)); err != nil {
 		return fmt.Errorf("creating org: %w", err)
 	}
@@ -75,7 +79,9 @@ func CreateOrganization(tx WriteTxn, org *models.Organization) error {
 }
 
 type GetOrganizationOptions struct {
-	ByID     uid.ID
+	ByID uid.ID
+	// ByDomain instructs GetOrganization to return the organization with
+	// this domain, or with an unexpired domain alias that matches.
 	ByDomain string
 }
 
@@ -90,7 +96,8 @@ func GetOrganization(tx ReadTxn, opts GetOrganizationOptions) (*models.Organizat
 	case opts.ByID != 0:
 		query.B("AND id = ?", opts.ByID)
 	case opts.ByDomain != "":
-		query.B("AND domain = ?", opts.ByDomain)
+		query.B("AND (domain = ?", opts.ByDomain)
+		query.B("OR (domain_alias = ? AND domain_alias_expires_at > ?))", opts.ByDomain, time.Now())
 	default:
 		return nil, fmt.Errorf("an ID or domain is required to get organization")
 	}
@@ -112,7 +119,7 @@ func ListOrganizations(tx ReadTxn, opts ListOrganizationsOptions) ([]models.Orga
 	table := organizationsTable{}
 	query := querybuilder.New("SELECT")
 	query.B(columnsForSelect(table))
-	if opts.Pagination != nil {
+	if opts.Pagination.countTotal() {
 		query.B(", count(*) OVER()")
 	}
 	query.B("FROM organizations")
@@ -132,29 +139,176 @@ func ListOrganizations(tx ReadTxn, opts ListOrganizationsOptions) ([]models.Orga
 	}
 	return scanRows(rows, func(org *models.Organization) []any {
 		fields := (*organizationsTable)(org).ScanFields()
-		if opts.Pagination != nil {
+		if opts.Pagination.countTotal() {
 			fields = append(fields, &opts.Pagination.TotalCount)
 		}
 		return fields
 	})
 }
 
-func DeleteOrganization(tx WriteTxn, id uid.ID) error {
-	// TODO: delete everything in the organization
+// organizationData lists the tables which store data that belongs to an
+// organization, in the order the rows must be deleted. The where clause
+// selects the rows of one organization using a single organization ID
+// argument. Tables which do not have an organization_id column are selected
+// by the identity that owns the row, so they must be deleted before the
+// identities.
+var organizationData = []struct {
+	table string
+	where string
+}{
+	{table: "identities_groups", where: "identity_id IN (SELECT id FROM identities WHERE organization_id = ?)"},
+	{table: "provider_users", where: "identity_id IN (SELECT id FROM identities WHERE organization_id = ?)"},
+	{table: "user_public_keys", where: "user_id IN (SELECT id FROM identities WHERE organization_id = ?)"},
+	{table: "device_flow_auth_requests", where: "user_id IN (SELECT id FROM identities WHERE organization_id = ?)"},
+	{table: "user_mfa", where: "organization_id = ?"},
+	{table: "password_reset_tokens", where: "organization_id = ?"},
+	{table: "impersonation_approvals", where: "organization_id = ?"},
+	{table: "credentials", where: "organization_id = ?"},
+	{table: "destination_credentials", where: "organization_id = ?"},
+	{table: "webhook_deliveries", where: "organization_id = ?"},
+	{table: "webhooks", where: "organization_id = ?"},
+	{table: "idempotency_keys", where: "organization_id = ?"},
+	{table: "issued_tokens", where: "organization_id = ?"},
+	{table: "access_keys", where: "organization_id = ?"},
+	{table: "grants", where: "organization_id = ?"},
+	{table: "groups", where: "organization_id = ?"},
+	{table: "destination_logs", where: "organization_id = ?"},
+	{table: "destination_usage", where: "organization_id = ?"},
+	{table: "destinations", where: "organization_id = ?"},
+	{table: "identities", where: "organization_id = ?"},
+	{table: "providers", where: "organization_id = ?"},
+	{table: "org_settings", where: "organization_id = ?"},
+	{table: "settings", where: "organization_id = ?"},
+	// the deletion itself is audited in the organization of the user who
+	// deleted it, so that a record of the deletion is kept.
+	{table: "audit_events", where: "organization_id = ?"},
+	{table: "organizations", where: "id = ?"},
+}
+
+// CountOrganizationData returns the number of rows in each table that would
+// be removed by DeleteOrganization. Soft deleted rows are included in the
+// count. The result is keyed by table name.
+func CountOrganizationData(tx ReadTxn, id uid.ID) (map[string]int64, error) {
+	result := make(map[string]int64, len(organizationData))
+	for _, item := range organizationData {
+		var count int64
+		stmt := "SELECT count(*) FROM " + item.table + " WHERE " + item.where
+		if err := tx.QueryRow(stmt, id).Scan(&count); err != nil {
+			return nil, fmt.Errorf("count %v: %w", item.table, handleError(err))
+		}
+		result[item.table] = count
+	}
+	return result, nil
+}
+
+// DeleteOrganization permanently removes an organization and all of the data
+// that belongs to it, including rows that were previously soft deleted. The
+// default organization can not be deleted. DeleteOrganization returns the
+// number of rows removed from each table, keyed by table name.
+//
+// The caller is responsible for using a transaction, so that a failure
+// does not leave the organization partially deleted.
+func DeleteOrganization(tx WriteTxn, id uid.ID) (map[string]int64, error) {
+	if id == defaultOrganizationID {
+		return nil, fmt.Errorf("%w: the default organization can not be deleted", internal.ErrBadRequest)
+	}
 
-	stmt := `
-		UPDATE organizations
-		SET deleted_at = ?
-		WHERE id = ? AND deleted_at is NULL`
+	invalidateCache(tx, infraProviderCacheKey(id))
+	invalidateCache(tx, orgSettingsCacheKey(id))
 
-	_, err := tx.Exec(stmt, time.Now(), id)
-	return err
+	result := make(map[string]int64, len(organizationData))
+	for _, item := range organizationData {
+		stmt := "DELETE FROM " + item.table + " WHERE " + item.where
+		res, err := tx.Exec(stmt, id)
+		if err != nil {
+			return nil, fmt.Errorf("delete %v: %w", item.table, handleError(err))
+		}
+		count, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		result[item.table] = count
+	}
+	return result, nil
 }
 
+// UpdateOrganization updates all the fields of org. The domain and domain
+// alias of org must not be used by any other organization.
 func UpdateOrganization(tx WriteTxn, org *models.Organization) error {
+	if err := checkDomainAvailable(tx, org); err != nil {
+		return err
+	}
 	return update(tx, (*organizationsTable)(org))
 }
 
+// checkDomainAvailable returns a UniqueConstraintError if the domain or
+// domain alias of org is the domain or unexpired domain alias of a different
+// organization. The unique index on domain does not include aliases, so they
+// must be checked here.
+func checkDomainAvailable(tx ReadTxn, org *models.Organization) error {
+	domains := []string{org.Domain}
+	if org.DomainAlias != "" {
+		domains = append(domains, org.DomainAlias)
+	}
+
+	query := querybuilder.New("SELECT count(*) FROM organizations")
+	query.B("WHERE deleted_at is NULL")
+	if org.ID != 0 {
+		query.B("AND id != ?", org.ID)
+	}
+	query.B("AND (domain IN")
+	queryInClause(query, domains)
+	query.B("OR (domain_alias IN")
+	queryInClause(query, domains)
+	query.B("AND domain_alias_expires_at > ?))", time.Now())
+
+	var count int
+	if err := tx.QueryRow(query.String(), query.Args...).Scan(&count); err != nil {
+		return handleError(err)
+	}
+	if count > 0 {
+		return UniqueConstraintError{Table: "organizations", Column: "domain", Value: org.Domain}
+	}
+	return nil
+}
+
 func CountOrganizations(tx ReadTxn) (int64, error) {
-	return countRows(tx, organizationsTable{})
+	return countRows(tx, organizationsTable{}, nil)
+}
+
+// OrganizationStats are counts of the rows that belong to an organization.
+// Deleted rows are never counted.
+type OrganizationStats struct {
+	// Users excludes system identities, like the connector.
+	Users        int64
+	Groups       int64
+	Grants       int64
+	Destinations int64
+	// ActiveAccessKeys excludes access keys that have expired, or have
+	// passed their inactivity timeout.
+	ActiveAccessKeys int64
+}
+
+// GetOrganizationStats returns the usage counts of the organization with
+// orgID. All the counts are computed by a single query.
+func GetOrganizationStats(tx ReadTxn, orgID uid.ID) (*OrganizationStats, error) {
+	now, zero := time.Now(), time.Time{}
+
+	query := querybuilder.New("SELECT")
+	query.B("(SELECT count(*) FROM identities WHERE organization_id = ? AND deleted_at is null AND name <> ?),",
+		orgID, models.InternalInfraConnectorIdentityName)
+	query.B("(SELECT count(*) FROM groups WHERE organization_id = ? AND deleted_at is null),", orgID)
+	query.B("(SELECT count(*) FROM grants WHERE organization_id = ? AND deleted_at is null),", orgID)
+	query.B("(SELECT count(*) FROM destinations WHERE organization_id = ? AND deleted_at is null),", orgID)
+	query.B("(SELECT count(*) FROM access_keys WHERE organization_id = ? AND deleted_at is null", orgID)
+	query.B("AND (expires_at > ? OR expires_at = ? OR expires_at is null)", now, zero)
+	query.B("AND (inactivity_timeout > ? OR inactivity_timeout = ? OR inactivity_timeout is null))", now, zero)
+
+	stats := &OrganizationStats{}
+	err := tx.QueryRow(query.String(), query.Args...).Scan(
+		&stats.Users, &stats.Groups, &stats.Grants, &stats.Destinations, &stats.ActiveAccessKeys)
+	if err != nil {
+		return nil, handleError(err)
+	}
+	return stats, nil
 }
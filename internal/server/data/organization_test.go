@@ -1,6 +1,7 @@
 package data
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -9,6 +10,7 @@ import (
 
 	"github.com/infrahq/infra/internal"
 	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
 )
 
 func TestCreateOrganization(t *testing.T) {
@@ -79,6 +81,7 @@ func TestCreateOrganization(t *testing.T) {
 			Model:              connectorGrant.Model,
 			OrganizationMember: models.OrganizationMember{OrganizationID: org.ID},
 			Subject:            connector.PolyID(),
+			SubjectID:          connector.ID,
 			Privilege:          models.InfraConnectorRole,
 			Resource:           "infra",
 			CreatedBy:          models.CreatedBySystem,
@@ -191,6 +194,64 @@ func TestUpdateOrganization(t *testing.T) {
 	})
 }
 
+func TestUpdateOrganization_Domain(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+
+		first := &models.Organization{Name: "first", Domain: "first.example.com"}
+		second := &models.Organization{Name: "second", Domain: "second.example.com"}
+		assert.NilError(t, CreateOrganization(tx, first))
+		assert.NilError(t, CreateOrganization(tx, second))
+
+		t.Run("domain used by another org", func(t *testing.T) {
+			updated := *first
+			updated.Domain = "second.example.com"
+			err := UpdateOrganization(tx, &updated)
+			var ucErr UniqueConstraintError
+			assert.Assert(t, errors.As(err, &ucErr), "wrong error type %T", err)
+			assert.Equal(t, ucErr.Column, "domain")
+		})
+
+		expires := time.Now().Add(time.Hour)
+		first.DomainAlias = first.Domain
+		first.DomainAliasExpiresAt = &expires
+		first.Domain = "renamed.example.com"
+		assert.NilError(t, UpdateOrganization(tx, first))
+
+		t.Run("lookup by new domain and alias", func(t *testing.T) {
+			for _, domain := range []string{"renamed.example.com", "first.example.com"} {
+				actual, err := GetOrganization(tx, GetOrganizationOptions{ByDomain: domain})
+				assert.NilError(t, err, domain)
+				assert.Equal(t, actual.ID, first.ID, domain)
+			}
+		})
+
+		t.Run("alias is not available to other orgs", func(t *testing.T) {
+			updated := *second
+			updated.Domain = "first.example.com"
+			err := UpdateOrganization(tx, &updated)
+			var ucErr UniqueConstraintError
+			assert.Assert(t, errors.As(err, &ucErr), "wrong error type %T", err)
+
+			err = CreateOrganization(tx, &models.Organization{Name: "third", Domain: "first.example.com"})
+			assert.Assert(t, errors.As(err, &ucErr), "wrong error type %T", err)
+		})
+
+		t.Run("expired alias", func(t *testing.T) {
+			expired := time.Now().Add(-time.Minute)
+			first.DomainAliasExpiresAt = &expired
+			assert.NilError(t, UpdateOrganization(tx, first))
+
+			_, err := GetOrganization(tx, GetOrganizationOptions{ByDomain: "first.example.com"})
+			assert.ErrorIs(t, err, internal.ErrNotFound)
+
+			updated := *second
+			updated.Domain = "first.example.com"
+			assert.NilError(t, UpdateOrganization(tx, &updated))
+		})
+	})
+}
+
 func TestListOrganizations(t *testing.T) {
 	runDBTests(t, func(t *testing.T, db *DB) {
 		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
@@ -248,24 +309,128 @@ func TestListOrganizations(t *testing.T) {
 
 func TestDeleteOrganization(t *testing.T) {
 	runDBTests(t, func(t *testing.T, db *DB) {
-		org := &models.Organization{
-			Name:   "first",
-			Domain: "first.example.com",
+		populate := func(t *testing.T, tx *Transaction, org *models.Organization) {
+			t.Helper()
+			assert.NilError(t, CreateOrganization(tx, org))
+			tx = tx.WithOrgID(org.ID)
+
+			user := &models.Identity{Name: "user@" + org.Domain}
+			assert.NilError(t, CreateIdentity(tx, user))
+			_, err := CreateProviderUser(tx, InfraProvider(tx), user)
+			assert.NilError(t, err)
+			assert.NilError(t, CreateCredential(tx, &models.Credential{IdentityID: user.ID, PasswordHash: []byte("hash")}))
+			_, err = CreatePasswordResetToken(tx, user.ID, time.Minute)
+			assert.NilError(t, err)
+			assert.NilError(t, AddUserPublicKey(tx, &models.UserPublicKey{
+				UserID:      user.ID,
+				PublicKey:   "AAAA",
+				KeyType:     "ssh-ed25519",
+				Fingerprint: "SHA256:" + org.Domain,
+			}))
+			_, err = CreateAccessKey(tx, &models.AccessKey{IssuedFor: user.ID, ProviderID: InfraProvider(tx).ID})
+			assert.NilError(t, err)
+			assert.NilError(t, CreateIssuedToken(tx, &models.IssuedToken{IdentityID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}))
+			assert.NilError(t, CreateUserMFA(tx, &models.UserMFA{IdentityID: user.ID, TOTPSecret: "secret"}))
+			assert.NilError(t, CreateImpersonationApproval(tx, &ImpersonationApproval{
+				IdentityID:     user.ID,
+				ImpersonatorID: 8222,
+				ApprovedBy:     8223,
+				ExpiresAt:      time.Now().Add(time.Minute),
+			}))
+
+			group := &models.Group{Name: "everyone"}
+			assert.NilError(t, CreateGroup(tx, group))
+			assert.NilError(t, AddUsersToGroup(tx, group.ID, []uid.ID{user.ID}))
+
+			assert.NilError(t, CreateGrant(tx, &models.Grant{
+				Subject:   uid.NewIdentityPolymorphicID(user.ID),
+				Privilege: "admin",
+				Resource:  "infra",
+			}))
+			destination := &models.Destination{Name: "prod", Kind: "kubernetes"}
+			assert.NilError(t, CreateDestination(tx, destination))
+			logs := []models.DestinationLog{{DestinationID: destination.ID, Level: "info", Line: "started"}}
+			assert.NilError(t, CreateDestinationLogs(tx, logs, 10))
+			assert.NilError(t, AddDestinationProxyRequests(tx, destination.ID, time.Now(), 1))
+			assert.NilError(t, CreateDestinationCredential(tx, &models.DestinationCredential{
+				ID:                 uid.New(),
+				OrganizationMember: models.OrganizationMember{OrganizationID: org.ID},
+				RequestExpiresAt:   time.Now().Add(time.Minute),
+				UserID:             user.ID,
+				DestinationID:      destination.ID,
+			}))
+			assert.NilError(t, CreateProvider(tx, &models.Provider{Name: "okta", Kind: models.ProviderKindOkta}))
+			assert.NilError(t, UpdateOrgSettings(tx, &models.OrgSettings{AccessKeyTTL: time.Hour}))
+
+			assert.NilError(t, CreateIdempotencyKey(tx, &models.IdempotencyKey{
+				Key:          "the-key",
+				RequestHash:  "hash",
+				StatusCode:   201,
+				ResponseBody: "{}",
+			}))
+			assert.NilError(t, CreateAuditEvent(tx, &models.AuditEvent{
+				Action:  "login",
+				ActorID: user.ID,
+				Result:  models.AuditResultSuccess,
+			}))
+
+			webhook := &models.Webhook{URL: "https://hooks." + org.Domain, Secret: "secret"}
+			assert.NilError(t, CreateWebhook(tx, webhook))
+			assert.NilError(t, CreateWebhookDelivery(tx, &models.WebhookDelivery{
+				WebhookID: webhook.ID,
+				EventType: "user.created",
+				Payload:   `{"type":"user.created"}`,
+			}))
 		}
 
-		err := CreateOrganization(db, org)
-		assert.NilError(t, err)
-
 		t.Run("success", func(t *testing.T) {
 			tx := txnForTestCase(t, db, 0)
-			err := DeleteOrganization(tx, org.ID)
+			org := &models.Organization{Name: "first", Domain: "first.example.com"}
+			populate(t, tx, org)
+			other := &models.Organization{Name: "other", Domain: "other.example.com"}
+			populate(t, tx, other)
+
+			before, err := CountOrganizationData(tx, other.ID)
 			assert.NilError(t, err)
+			// every table with an organization_id column must be purged
+			tables := append(tablesWithOrganizationID(t, db),
+				"identities_groups", "provider_users", "user_public_keys", "organizations")
+			for _, table := range tables {
+				assert.Assert(t, before[table] > 0, table)
+			}
+
+			dryRun, err := CountOrganizationData(tx, org.ID)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, dryRun, before) // both orgs have the same data
+
+			deleted, err := DeleteOrganization(tx, org.ID)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, deleted, dryRun)
 
 			_, err = GetOrganization(tx, GetOrganizationOptions{ByID: org.ID})
 			assert.ErrorIs(t, err, internal.ErrNotFound)
 
+			after, err := CountOrganizationData(tx, org.ID)
+			assert.NilError(t, err)
+			for table, count := range after {
+				assert.Equal(t, count, int64(0), table)
+			}
+
+			// the other organization is untouched
+			otherAfter, err := CountOrganizationData(tx, other.ID)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, otherAfter, before)
+
 			// delete again to check idempotence
-			err = DeleteOrganization(tx, org.ID)
+			_, err = DeleteOrganization(tx, org.ID)
+			assert.NilError(t, err)
+		})
+		t.Run("default organization", func(t *testing.T) {
+			tx := txnForTestCase(t, db, 0)
+			_, err := DeleteOrganization(tx, db.DefaultOrg.ID)
+			assert.ErrorIs(t, err, internal.ErrBadRequest)
+
+			_, err = GetOrganization(tx, GetOrganizationOptions{ByID: db.DefaultOrg.ID})
 			assert.NilError(t, err)
 		})
 	})
@@ -287,3 +452,100 @@ func TestCountOrganizations(t *testing.T) {
 		assert.Equal(t, actual, int64(3)) // 2 + default org
 	})
 }
+
+func TestGetOrganizationStats(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		populate := func(t *testing.T, tx *Transaction, org *models.Organization) {
+			t.Helper()
+			assert.NilError(t, CreateOrganization(tx, org))
+			tx = tx.WithOrgID(org.ID)
+
+			alice := &models.Identity{Name: "alice@" + org.Domain}
+			bob := &models.Identity{Name: "bob@" + org.Domain}
+			deletedUser := &models.Identity{Name: "deleted@" + org.Domain}
+			createIdentities(t, tx, alice, bob, deletedUser)
+			assert.NilError(t, DeleteIdentities(tx, DeleteIdentitiesOptions{
+				ByID:         deletedUser.ID,
+				ByProviderID: InfraProvider(tx).ID,
+			}))
+
+			deletedGroup := &models.Group{Name: "deleted"}
+			createGroups(t, tx, &models.Group{Name: "first"}, &models.Group{Name: "second"}, deletedGroup)
+			assert.NilError(t, DeleteGroup(tx, deletedGroup.ID))
+
+			deletedGrant := &models.Grant{Subject: uid.NewIdentityPolymorphicID(bob.ID), Privilege: "view", Resource: "deleted"}
+			createGrants(t, tx,
+				&models.Grant{Subject: uid.NewIdentityPolymorphicID(alice.ID), Privilege: "admin", Resource: "infra"},
+				&models.Grant{Subject: uid.NewIdentityPolymorphicID(bob.ID), Privilege: "view", Resource: "prod"},
+				deletedGrant)
+			assert.NilError(t, DeleteGrants(tx, DeleteGrantsOptions{ByID: deletedGrant.ID}))
+
+			deletedDestination := &models.Destination{Name: "deleted", UniqueID: "deleted", Kind: "ssh"}
+			createDestinations(t, tx, &models.Destination{Name: "prod", UniqueID: "prod", Kind: "ssh"}, deletedDestination)
+			assert.NilError(t, DeleteDestination(tx, deletedDestination.ID))
+
+			provider := InfraProvider(tx)
+			deletedKey := &models.AccessKey{IssuedFor: alice.ID, ProviderID: provider.ID}
+			createAccessKeys(t, tx,
+				&models.AccessKey{IssuedFor: alice.ID, ProviderID: provider.ID},
+				&models.AccessKey{IssuedFor: bob.ID, ProviderID: provider.ID, ExpiresAt: time.Now().Add(time.Hour)},
+				&models.AccessKey{IssuedFor: bob.ID, ProviderID: provider.ID, ExpiresAt: time.Now().Add(-time.Hour)},
+				&models.AccessKey{
+					IssuedFor:         bob.ID,
+					ProviderID:        provider.ID,
+					ExpiresAt:         time.Now().Add(time.Hour),
+					InactivityTimeout: time.Now().Add(-time.Minute),
+				},
+				deletedKey)
+			assert.NilError(t, DeleteAccessKeys(tx, DeleteAccessKeysOptions{ByID: deletedKey.ID}))
+		}
+
+		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+		first := &models.Organization{Name: "first", Domain: "first.example.com"}
+		populate(t, tx, first)
+		second := &models.Organization{Name: "second", Domain: "second.example.com"}
+		populate(t, tx, second)
+
+		expected := &OrganizationStats{
+			Users:            2,
+			Groups:           2,
+			Grants:           3, // includes the grant for the connector
+			Destinations:     1,
+			ActiveAccessKeys: 2,
+		}
+		actual, err := GetOrganizationStats(tx, first.ID)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, actual, expected)
+
+		actual, err = GetOrganizationStats(tx.WithOrgID(second.ID), second.ID)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, actual, expected)
+
+		t.Run("organization with no rows", func(t *testing.T) {
+			actual, err := GetOrganizationStats(tx, 12345)
+			assert.NilError(t, err)
+			assert.DeepEqual(t, actual, &OrganizationStats{})
+		})
+	})
+}
+
+// tablesWithOrganizationID returns the names of the tables in the database
+// schema that have an organization_id column.
+func tablesWithOrganizationID(t *testing.T, db *DB) []string {
+	t.Helper()
+	query := `SELECT table_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND column_name = 'organization_id'`
+	if db.dialect != nil {
+		query = `SELECT m.name FROM sqlite_master AS m, pragma_table_info(m.name) AS c
+			WHERE m.type = 'table' AND c.name = 'organization_id'`
+	}
+
+	rows, err := db.Query(query)
+	assert.NilError(t, err)
+	tables, err := scanRows(rows, func(name *string) []any {
+		return []any{name}
+	})
+	assert.NilError(t, err)
+	assert.Assert(t, len(tables) > 0)
+	return tables
+}
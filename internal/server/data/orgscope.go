@@ -0,0 +1,87 @@
+package data
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/infrahq/infra/internal/server/data/querybuilder"
+)
+
+// orgScopedTables are the tables that have an organization_id column. Every
+// row in these tables belongs to a single organization.
+var orgScopedTables = []string{
+	"access_keys",
+	"audit_events",
+	"credentials",
+	"destination_credentials",
+	"destination_logs",
+	"destination_usage",
+	"destinations",
+	"grants",
+	"groups",
+	"idempotency_keys",
+	"identities",
+	"impersonation_approvals",
+	"issued_tokens",
+	"org_settings",
+	"password_reset_tokens",
+	"providers",
+	"settings",
+	"user_mfa",
+	"webhook_deliveries",
+	"webhooks",
+}
+
+// allOrganizations is a comment that marks a query which intentionally reads
+// or writes rows from every organization, for example a background job that
+// removes expired rows. checkOrgScope accepts these queries without an
+// organization_id predicate.
+const allOrganizations = "/* all organizations */"
+
+var (
+	orgScopedTableRef = regexp.MustCompile(
+		`(?i)\b(?:from|join|update)\s+(` + strings.Join(orgScopedTables, "|") + `)\b`)
+	orgPredicate = regexp.MustCompile(`(?i)\borganization_id\s*(?:=|in\b)`)
+)
+
+// checkOrgScope returns an error if query reads, updates, or deletes rows from
+// an org scoped table without filtering by organization_id. Inserts are not
+// checked, because the organization_id of the new row is set by setOrg.
+func checkOrgScope(query string) error {
+	if strings.Contains(query, allOrganizations) {
+		return nil
+	}
+	match := orgScopedTableRef.FindStringSubmatch(query)
+	if match == nil {
+		return nil
+	}
+	if orgPredicate.MatchString(query) {
+		return nil
+	}
+	return fmt.Errorf("query on org scoped table %v is missing an organization_id predicate: %v",
+		match[1], query)
+}
+
+// getInOrg selects a single row of table from the organization of tx, and
+// scans it into table.ScanFields(). Deleted rows and rows from any other
+// organization are always excluded. The where function adds the predicates that
+// identify the row, and may return an error when the row can not be
+// identified.
+//
+// Use getInOrg for single row fetches from tables with both organization_id and
+// deleted_at columns, so that the organization predicate can not be forgotten.
+func getInOrg(tx ReadTxn, table Selectable, where func(query *querybuilder.Query) error) error {
+	query := querybuilder.New("SELECT")
+	query.B(columnsForSelect(table))
+	query.B("FROM")
+	query.B(table.Table())
+	query.B("WHERE deleted_at is null")
+	query.B("AND organization_id = ?", tx.OrganizationID())
+	if err := where(query); err != nil {
+		return err
+	}
+
+	err := tx.QueryRow(query.String(), query.Args...).Scan(table.ScanFields()...)
+	return handleError(err)
+}
@@ -0,0 +1,154 @@
+package data
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/server/data/querybuilder"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+func TestCheckOrgScope(t *testing.T) {
+	type testCase struct {
+		name        string
+		query       string
+		expectedErr string
+	}
+
+	run := func(t *testing.T, tc testCase) {
+		err := checkOrgScope(tc.query)
+		if tc.expectedErr == "" {
+			assert.NilError(t, err)
+			return
+		}
+		assert.ErrorContains(t, err, tc.expectedErr)
+	}
+
+	testCases := []testCase{
+		{
+			name:  "select with org predicate",
+			query: "SELECT id FROM groups WHERE deleted_at is null AND organization_id = ? AND id = ?",
+		},
+		{
+			name:  "select with qualified org predicate",
+			query: "SELECT grants.id FROM grants WHERE grants.organization_id = ?",
+		},
+		{
+			name:  "join with org predicate",
+			query: "SELECT identities.id FROM identities JOIN identities_groups ON identities.id = identity_id WHERE identities.organization_id = ?",
+		},
+		{
+			name:  "org predicate with in clause",
+			query: "DELETE FROM identities WHERE organization_id IN (?, ?)",
+		},
+		{
+			name:        "select missing org predicate",
+			query:       "SELECT groups.id, groups.organization_id FROM groups WHERE deleted_at is null AND id = ?",
+			expectedErr: "query on org scoped table groups is missing an organization_id predicate",
+		},
+		{
+			name:        "update missing org predicate",
+			query:       "UPDATE access_keys SET deleted_at = ? WHERE id = ?",
+			expectedErr: "query on org scoped table access_keys is missing",
+		},
+		{
+			name:        "delete missing org predicate",
+			query:       "DELETE FROM password_reset_tokens WHERE token = ?",
+			expectedErr: "query on org scoped table password_reset_tokens is missing",
+		},
+		{
+			name:        "join to org scoped table missing org predicate",
+			query:       "SELECT identity_id FROM identities_groups JOIN groups ON groups.id = group_id",
+			expectedErr: "query on org scoped table groups is missing",
+		},
+		{
+			name:  "query marked for all organizations",
+			query: "SELECT count(*) FROM identities WHERE deleted_at is null /* all organizations */",
+		},
+		{
+			name:  "insert into org scoped table",
+			query: "INSERT INTO groups (id, name, organization_id) VALUES (?, ?, ?)",
+		},
+		{
+			name:  "table that is not org scoped",
+			query: "SELECT identity_id FROM identities_groups WHERE group_id = ?",
+		},
+		{
+			name:  "table name prefix of another table",
+			query: "SELECT id FROM grants_archive WHERE id = ?",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
+
+func TestTransaction_EnforceOrgScope(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+
+		t.Run("query missing org predicate panics", func(t *testing.T) {
+			defer func() {
+				r := recover()
+				assert.Assert(t, r != nil, "expected a panic")
+				assert.Assert(t, r.(string) != "")
+			}()
+			_, _ = tx.Query("SELECT id FROM groups WHERE name = ?", "admins")
+		})
+
+		t.Run("transaction without org is not checked", func(t *testing.T) {
+			rows, err := tx.WithOrgID(0).Query("SELECT id FROM groups WHERE name = ?", "admins")
+			assert.NilError(t, err)
+			assert.NilError(t, rows.Close())
+		})
+	})
+}
+
+func TestGetInOrg(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		otherOrg := &models.Organization{Name: "other", Domain: "other.example.com"}
+		assert.NilError(t, CreateOrganization(db, otherOrg))
+
+		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+		otherTx := txnForTestCase(t, db, otherOrg.ID)
+
+		group := &models.Group{Name: "everyone"}
+		assert.NilError(t, CreateGroup(tx, group))
+
+		t.Run("row in the same org", func(t *testing.T) {
+			actual := &groupsTable{}
+			err := getInOrg(tx, actual, func(query *querybuilder.Query) error {
+				query.B("AND id = ?", group.ID)
+				return nil
+			})
+			assert.NilError(t, err)
+			assert.Equal(t, actual.Name, "everyone")
+			assert.Equal(t, actual.OrganizationID, db.DefaultOrg.ID)
+		})
+
+		t.Run("row in another org", func(t *testing.T) {
+			err := getInOrg(otherTx, &groupsTable{}, func(query *querybuilder.Query) error {
+				query.B("AND id = ?", group.ID)
+				return nil
+			})
+			assert.ErrorIs(t, err, internal.ErrNotFound)
+		})
+
+		t.Run("deleted row", func(t *testing.T) {
+			deleted := &models.Group{Name: "deleted"}
+			assert.NilError(t, CreateGroup(tx, deleted))
+			assert.NilError(t, DeleteGroup(tx, deleted.ID))
+
+			err := getInOrg(tx, &groupsTable{}, func(query *querybuilder.Query) error {
+				query.B("AND id = ?", deleted.ID)
+				return nil
+			})
+			assert.ErrorIs(t, err, internal.ErrNotFound)
+		})
+	})
+}
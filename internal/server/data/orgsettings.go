@@ -0,0 +1,96 @@
+package data
+
+import (
+	"errors"
+	"time"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/server/data/querybuilder"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+type orgSettingsTable models.OrgSettings
+
+func (orgSettingsTable) Table() string {
+	return "org_settings"
+}
+
+func (s orgSettingsTable) Columns() []string {
+	return []string{"access_key_ttl", "allowed_signup_domains", "audit_event_retention", "connector_rate_limit", "max_access_key_ttl", "organization_id", "public_key_algorithms", "rate_limit", "require_mfa", "session_inactivity_timeout", "updated_at"}
+}
+
+func (s orgSettingsTable) Values() []any {
+	return []any{s.AccessKeyTTL, s.AllowedSignupDomains, s.AuditEventRetention, s.ConnectorRateLimit, s.MaxAccessKeyTTL, s.OrganizationID, s.PublicKeyAlgorithms, s.RateLimit, s.RequireMFA, s.SessionInactivityTimeout, s.UpdatedAt}
+}
+
+func (s *orgSettingsTable) ScanFields() []any {
+	return []any{&s.AccessKeyTTL, &s.AllowedSignupDomains, &s.AuditEventRetention, &s.ConnectorRateLimit, &s.MaxAccessKeyTTL, &s.OrganizationID, &s.PublicKeyAlgorithms, &s.RateLimit, &s.RequireMFA, &s.SessionInactivityTimeout, &s.UpdatedAt}
+}
+
+// GetOrgSettings returns the settings of the organization of tx. If the
+// organization has never saved its settings, GetOrgSettings returns settings
+// with all fields set to their zero value.
+func GetOrgSettings(tx ReadTxn) (*models.OrgSettings, error) {
+	return cachedRead(tx, orgSettingsCacheKey(tx.OrganizationID()), cloneOrgSettings, func() (*models.OrgSettings, error) {
+		return getOrgSettings(tx)
+	})
+}
+
+func getOrgSettings(tx ReadTxn) (*models.OrgSettings, error) {
+	settings := &orgSettingsTable{}
+	query := querybuilder.New("SELECT")
+	query.B(columnsForSelect(settings))
+	query.B("FROM org_settings")
+	query.B("WHERE organization_id = ?", tx.OrganizationID())
+
+	err := tx.QueryRow(query.String(), query.Args...).Scan(settings.ScanFields()...)
+	switch err = handleError(err); {
+	case errors.Is(err, internal.ErrNotFound):
+		return &models.OrgSettings{
+			OrganizationMember: models.OrganizationMember{OrganizationID: tx.OrganizationID()},
+		}, nil
+	case err != nil:
+		return nil, err
+	}
+	return (*models.OrgSettings)(settings), nil
+}
+
+// UpdateOrgSettings saves the settings of the organization of tx, creating
+// the row if it does not already exist.
+func UpdateOrgSettings(tx WriteTxn, settings *models.OrgSettings) error {
+	settings.OrganizationID = tx.OrganizationID()
+	settings.UpdatedAt = time.Now()
+
+	table := (*orgSettingsTable)(settings)
+	query := querybuilder.New("INSERT INTO org_settings (")
+	query.B(columnsForInsert(table))
+	query.B(") VALUES (")
+	query.B(placeholderForColumns(table), table.Values()...)
+	query.B(") ON CONFLICT (organization_id) DO UPDATE SET")
+	query.B("access_key_ttl = excluded.access_key_ttl,")
+	query.B("allowed_signup_domains = excluded.allowed_signup_domains,")
+	query.B("audit_event_retention = excluded.audit_event_retention,")
+	query.B("connector_rate_limit = excluded.connector_rate_limit,")
+	query.B("max_access_key_ttl = excluded.max_access_key_ttl,")
+	query.B("public_key_algorithms = excluded.public_key_algorithms,")
+	query.B("rate_limit = excluded.rate_limit,")
+	query.B("require_mfa = excluded.require_mfa,")
+	query.B("session_inactivity_timeout = excluded.session_inactivity_timeout,")
+	query.B("updated_at = excluded.updated_at;")
+
+	invalidateCache(tx, orgSettingsCacheKey(tx.OrganizationID()))
+	_, err := tx.Exec(query.String(), query.Args...)
+	return handleError(err)
+}
+
+func orgSettingsCacheKey(orgID uid.ID) cacheKey {
+	return cacheKey{table: "org_settings", orgID: orgID}
+}
+
+func cloneOrgSettings(s *models.OrgSettings) *models.OrgSettings {
+	c := *s
+	c.PublicKeyAlgorithms = cloneStrings(s.PublicKeyAlgorithms)
+	c.AllowedSignupDomains = cloneStrings(s.AllowedSignupDomains)
+	return &c
+}
@@ -0,0 +1,75 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestGetOrgSettings(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		t.Run("defaults when not saved", func(t *testing.T) {
+			tx := txnForTestCase(t, db, 181)
+
+			settings, err := GetOrgSettings(tx)
+			assert.NilError(t, err)
+			expected := &models.OrgSettings{
+				OrganizationMember: models.OrganizationMember{OrganizationID: 181},
+			}
+			assert.DeepEqual(t, settings, expected)
+		})
+		t.Run("scoped to organization", func(t *testing.T) {
+			tx := txnForTestCase(t, db, 181)
+			err := UpdateOrgSettings(tx, &models.OrgSettings{AccessKeyTTL: time.Hour})
+			assert.NilError(t, err)
+
+			settings, err := GetOrgSettings(tx.WithOrgID(182))
+			assert.NilError(t, err)
+			assert.Equal(t, settings.OrganizationID, uid.ID(182))
+			assert.Equal(t, settings.AccessKeyTTL, time.Duration(0))
+		})
+	})
+}
+
+func TestUpdateOrgSettings(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		tx := txnForTestCase(t, db, 181)
+
+		first := &models.OrgSettings{
+			AccessKeyTTL:             time.Hour,
+			SessionInactivityTimeout: time.Minute,
+			PublicKeyAlgorithms:      models.CommaSeparatedStrings{"ssh-ed25519"},
+			RateLimit:                100,
+			ConnectorRateLimit:       1000,
+			AllowedSignupDomains:     models.CommaSeparatedStrings{"example.com", "infrahq.com"},
+			RequireMFA:               true,
+			AuditEventRetention:      30 * 24 * time.Hour,
+		}
+		err := UpdateOrgSettings(tx, first)
+		assert.NilError(t, err)
+
+		actual, err := GetOrgSettings(tx)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, actual, first, cmpTimeWithDBPrecision)
+
+		second := &models.OrgSettings{
+			AccessKeyTTL: 2 * time.Hour,
+		}
+		err = UpdateOrgSettings(tx, second)
+		assert.NilError(t, err)
+
+		actual, err = GetOrgSettings(tx)
+		assert.NilError(t, err)
+		assert.Equal(t, actual.AccessKeyTTL, 2*time.Hour)
+		assert.Equal(t, actual.SessionInactivityTimeout, time.Duration(0))
+		assert.Equal(t, len(actual.PublicKeyAlgorithms), 0)
+		assert.Equal(t, actual.RateLimit, 0)
+		assert.Equal(t, actual.ConnectorRateLimit, 0)
+		assert.Equal(t, len(actual.AllowedSignupDomains), 0)
+		assert.Equal(t, actual.AuditEventRetention, time.Duration(0))
+	})
+}
@@ -1,12 +1,112 @@
 package data
 
-import "github.com/infrahq/infra/internal/server/data/querybuilder"
+import (
+	"fmt"
+
+	"github.com/infrahq/infra/internal/server/data/querybuilder"
+	"github.com/infrahq/infra/internal/validate"
+	"github.com/infrahq/infra/uid"
+)
+
+const (
+	// DefaultPaginationLimit is the Limit used by SetDefaults when Limit is zero.
+	DefaultPaginationLimit = 100
+	// DefaultMaxPaginationLimit is the largest Limit accepted by Validate when
+	// no other maximum is given.
+	DefaultMaxPaginationLimit = 1000
+)
 
 // Internal Pagination Data
 type Pagination struct {
 	Page       int
 	Limit      int
 	TotalCount int
+
+	// Cursor selects cursor pagination instead of page pagination. Rows are
+	// ordered by id, and only rows with an id greater than AfterID are
+	// returned. TotalCount is not set when Cursor is true, because counting
+	// every matching row is what makes pages of large lists slow.
+	//
+	// Cursor pagination is only supported by ListGrants and ListIdentities.
+	Cursor  bool
+	AfterID uid.ID
+	// NextAfterID is set by a query that uses Cursor when there may be more
+	// rows. It is the AfterID for the next page.
+	NextAfterID uid.ID
+
+	// SkipTotalCount instructs the query to not count the total number of
+	// rows with count(*) OVER(), which can be as expensive as the query
+	// itself. TotalCount is not set when SkipTotalCount is true.
+	SkipTotalCount bool
+}
+
+// SetDefaults sets Limit to DefaultPaginationLimit when it is zero, and Page to
+// the first page when it is zero and Cursor is false.
+func (p *Pagination) SetDefaults() {
+	if p.Limit == 0 {
+		p.Limit = DefaultPaginationLimit
+	}
+	if p.Page == 0 && !p.Cursor {
+		p.Page = 1
+	}
+}
+
+// Validate returns a validate.Error if Page or Limit is negative, or if Limit is
+// greater than maxLimit. A maxLimit of zero uses DefaultMaxPaginationLimit.
+func (p Pagination) Validate(maxLimit int) error {
+	if maxLimit <= 0 {
+		maxLimit = DefaultMaxPaginationLimit
+	}
+	err := make(validate.Error)
+	if p.Page < 0 {
+		err["page"] = append(err["page"], fmt.Sprintf("value %d must be at least 0", p.Page))
+	}
+	switch {
+	case p.Limit < 0:
+		err["limit"] = append(err["limit"], fmt.Sprintf("value %d must be at least 0", p.Limit))
+	case p.Limit > maxLimit:
+		err["limit"] = append(err["limit"], fmt.Sprintf("value %d must be at most %d", p.Limit, maxLimit))
+	}
+	if len(err) > 0 {
+		return err
+	}
+	return nil
+}
+
+// countTotal returns true if the query should count the total number of rows
+// with count(*) OVER().
+func (p *Pagination) countTotal() bool {
+	return p != nil && !p.Cursor && !p.SkipTotalCount
+}
+
+// useCursor returns true if the query should use cursor pagination.
+func (p *Pagination) useCursor() bool {
+	return p != nil && p.Cursor
+}
+
+// setNextAfterID sets NextAfterID from the rows returned by a query that used
+// cursor pagination. When fewer than Limit rows were returned there are no
+// more rows.
+func (p *Pagination) setNextAfterID(count int, lastID uid.ID) {
+	p.NextAfterID = 0
+	if p.Limit > 0 && count == p.Limit {
+		p.NextAfterID = lastID
+	}
+}
+
+// countEmptyPage sets TotalCount when a query that used count(*) OVER()
+// returned no rows. The window function has no rows to count when the page is
+// past the last page, so the rows matching filter are counted with countRows.
+func (p *Pagination) countEmptyPage(tx ReadTxn, rows int, table Table, filter func(query *querybuilder.Query) error) error {
+	if !p.countTotal() || p.Limit == 0 || rows > 0 || p.Page <= 1 {
+		return nil
+	}
+	count, err := countRows(tx, table, filter)
+	if err != nil {
+		return err
+	}
+	p.TotalCount = int(count)
+	return nil
 }
 
 func (p *Pagination) SetTotalCount(count int) {
@@ -19,6 +119,10 @@ func (p *Pagination) PaginateQuery(query *querybuilder.Query) {
 	if p.Limit == 0 {
 		return
 	}
+	if p.Cursor {
+		query.B("LIMIT ?", p.Limit)
+		return
+	}
 	if p.Page == 0 {
 		p.Page = 1
 	}
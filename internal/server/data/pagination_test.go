@@ -0,0 +1,298 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/internal/validate"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestListGrants_PageAndCursorPagination(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+		for i := 0; i < 25; i++ {
+			createGrants(t, tx, &models.Grant{
+				Subject:   uid.NewIdentityPolymorphicID(uid.ID(1000 + i)),
+				Privilege: "view",
+				Resource:  "res" + fmt.Sprint(i%3),
+			})
+		}
+		opts := ListGrantsOptions{ByPrivileges: []string{"view"}}
+
+		var byPage []uid.ID
+		for page := 1; ; page++ {
+			p := &Pagination{Page: page, Limit: 7}
+			opts.Pagination = p
+			grants, err := ListGrants(tx, opts)
+			assert.NilError(t, err)
+			assert.Equal(t, p.TotalCount, 25)
+			for _, g := range grants {
+				byPage = append(byPage, g.ID)
+			}
+			if len(grants) < p.Limit {
+				break
+			}
+		}
+
+		var byCursor []uid.ID
+		p := &Pagination{Limit: 7, Cursor: true}
+		for {
+			opts.Pagination = p
+			grants, err := ListGrants(tx, opts)
+			assert.NilError(t, err)
+			assert.Equal(t, p.TotalCount, 0)
+			for _, g := range grants {
+				byCursor = append(byCursor, g.ID)
+			}
+			if p.NextAfterID == 0 {
+				break
+			}
+			p = &Pagination{Limit: 7, Cursor: true, AfterID: p.NextAfterID}
+		}
+
+		assert.Equal(t, len(byPage), 25)
+		assert.DeepEqual(t, byCursor, byPage)
+	})
+}
+
+func TestListIdentities_PageAndCursorPagination(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+		for i := 0; i < 20; i++ {
+			// names in the opposite order of IDs, so that the page and cursor
+			// modes return users in a different order.
+			createIdentities(t, tx, &models.Identity{Name: fmt.Sprintf("user%02d@example.com", 20-i)})
+		}
+		opts := ListIdentityOptions{ByNotName: models.InternalInfraConnectorIdentityName}
+
+		var byPage []uid.ID
+		for page := 1; ; page++ {
+			p := &Pagination{Page: page, Limit: 6}
+			opts.Pagination = p
+			users, err := ListIdentities(tx, opts)
+			assert.NilError(t, err)
+			for _, u := range users {
+				byPage = append(byPage, u.ID)
+			}
+			if len(users) < p.Limit {
+				break
+			}
+		}
+
+		var byCursor []uid.ID
+		p := &Pagination{Limit: 6, Cursor: true}
+		for {
+			opts.Pagination = p
+			users, err := ListIdentities(tx, opts)
+			assert.NilError(t, err)
+			for _, u := range users {
+				byCursor = append(byCursor, u.ID)
+			}
+			if p.NextAfterID == 0 {
+				break
+			}
+			p = &Pagination{Limit: 6, Cursor: true, AfterID: p.NextAfterID}
+		}
+
+		assert.Equal(t, len(byPage), 20)
+		// cursor mode is ordered by id
+		assert.Assert(t, sort.SliceIsSorted(byCursor, func(i, j int) bool { return byCursor[i] < byCursor[j] }))
+		sort.Slice(byPage, func(i, j int) bool { return byPage[i] < byPage[j] })
+		assert.DeepEqual(t, byCursor, byPage)
+	})
+}
+
+func TestPagination_TotalCountWhenCountIsMultipleOfLimit(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+
+		// 4 of each, which is an exact multiple of the page size
+		user := &models.Identity{Name: "keys@example.com"}
+		createIdentities(t, tx, user)
+
+		var identityIDs, groupIDs []uid.ID
+		for i := 0; i < 4; i++ {
+			identity := &models.Identity{Name: fmt.Sprintf("user%d@example.com", i)}
+			createIdentities(t, tx, identity)
+			identityIDs = append(identityIDs, identity.ID)
+
+			group := &models.Group{Name: fmt.Sprintf("group%d", i)}
+			createGroups(t, tx, group)
+			groupIDs = append(groupIDs, group.ID)
+
+			createGrants(t, tx, &models.Grant{
+				Subject:   uid.NewIdentityPolymorphicID(identity.ID),
+				Privilege: "view",
+				Resource:  "paged",
+			})
+			createAccessKeys(t, tx, &models.AccessKey{
+				Name:       fmt.Sprintf("key%d", i),
+				IssuedFor:  user.ID,
+				ProviderID: InfraProvider(tx).ID,
+				ExpiresAt:  time.Now().Add(time.Hour),
+			})
+		}
+
+		type testCase struct {
+			name string
+			list func(p *Pagination) (int, error)
+		}
+
+		run := func(t *testing.T, tc testCase) {
+			for page, expectedItems := range map[int]int{1: 2, 2: 2, 3: 0, 4: 0} {
+				p := &Pagination{Page: page, Limit: 2}
+				items, err := tc.list(p)
+				assert.NilError(t, err)
+				assert.Equal(t, items, expectedItems, "page %d", page)
+				assert.Equal(t, p.TotalCount, 4, "page %d", page)
+			}
+		}
+
+		testCases := []testCase{
+			{
+				name: "grants",
+				list: func(p *Pagination) (int, error) {
+					result, err := ListGrants(tx, ListGrantsOptions{ByResource: "paged", Pagination: p})
+					return len(result), err
+				},
+			},
+			{
+				name: "identities",
+				list: func(p *Pagination) (int, error) {
+					result, err := ListIdentities(tx, ListIdentityOptions{ByIDs: identityIDs, Pagination: p})
+					return len(result), err
+				},
+			},
+			{
+				name: "groups",
+				list: func(p *Pagination) (int, error) {
+					result, err := ListGroups(tx, ListGroupsOptions{ByIDs: groupIDs, Pagination: p})
+					return len(result), err
+				},
+			},
+			{
+				name: "access keys",
+				list: func(p *Pagination) (int, error) {
+					result, err := ListAccessKeys(tx, ListAccessKeyOptions{ByIssuedForID: user.ID, Pagination: p})
+					return len(result), err
+				},
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				run(t, tc)
+			})
+		}
+	})
+}
+
+func TestPagination_SetDefaults(t *testing.T) {
+	p := Pagination{}
+	p.SetDefaults()
+	assert.DeepEqual(t, p, Pagination{Page: 1, Limit: DefaultPaginationLimit})
+
+	p = Pagination{Cursor: true}
+	p.SetDefaults()
+	assert.DeepEqual(t, p, Pagination{Limit: DefaultPaginationLimit, Cursor: true})
+
+	p = Pagination{Page: 3, Limit: 20}
+	p.SetDefaults()
+	assert.DeepEqual(t, p, Pagination{Page: 3, Limit: 20})
+}
+
+func TestPagination_Validate(t *testing.T) {
+	type testCase struct {
+		name        string
+		pagination  Pagination
+		maxLimit    int
+		expectedErr validate.Error
+	}
+	testCases := []testCase{
+		{name: "zero", pagination: Pagination{}},
+		{name: "default max", pagination: Pagination{Limit: DefaultMaxPaginationLimit}},
+		{
+			name:        "above default max",
+			pagination:  Pagination{Limit: DefaultMaxPaginationLimit + 1},
+			expectedErr: validate.Error{"limit": {"value 1001 must be at most 1000"}},
+		},
+		{name: "configured max", pagination: Pagination{Limit: 10}, maxLimit: 10},
+		{
+			name:        "above configured max",
+			pagination:  Pagination{Limit: 11},
+			maxLimit:    10,
+			expectedErr: validate.Error{"limit": {"value 11 must be at most 10"}},
+		},
+		{
+			name:       "negative",
+			pagination: Pagination{Page: -1, Limit: -1},
+			expectedErr: validate.Error{
+				"page":  {"value -1 must be at least 0"},
+				"limit": {"value -1 must be at least 0"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.pagination.Validate(tc.maxLimit)
+			if tc.expectedErr == nil {
+				assert.NilError(t, err)
+				return
+			}
+			assert.DeepEqual(t, err, tc.expectedErr)
+		})
+	}
+}
+
+// BenchmarkListGrants_SkipTotalCount compares listing the pages of a large
+// grants table with and without counting the total number of grants.
+func BenchmarkListGrants_SkipTotalCount(b *testing.B) {
+	db := setupDB(b)
+	tx, err := db.Begin(context.Background(), nil)
+	assert.NilError(b, err)
+	b.Cleanup(func() {
+		_ = tx.Rollback()
+	})
+	tx = tx.WithOrgID(db.DefaultOrg.ID)
+
+	const total, batch = 500_000, 5_000
+	for i := 0; i < total; i += batch {
+		grants := make([]*models.Grant, batch)
+		for j := range grants {
+			grants[j] = &models.Grant{
+				Subject:   uid.NewIdentityPolymorphicID(uid.New()),
+				Privilege: "view",
+				Resource:  fmt.Sprintf("infra-%d", i+j),
+			}
+		}
+		assert.NilError(b, createGrantsBulk(tx, grants))
+	}
+	_, err = tx.Exec("ANALYZE grants")
+	assert.NilError(b, err)
+
+	run := func(b *testing.B, skip bool) {
+		for n := 0; n < b.N; n++ {
+			p := &Pagination{Page: 10, Limit: 100, SkipTotalCount: skip}
+			actual, err := ListGrants(tx, ListGrantsOptions{
+				ByPrivileges: []string{"view"},
+				Pagination:   p,
+			})
+			assert.NilError(b, err)
+			assert.Equal(b, len(actual), 100)
+		}
+	}
+
+	b.Run("with total", func(b *testing.B) {
+		run(b, false)
+	})
+	b.Run("without total", func(b *testing.B) {
+		run(b, true)
+	})
+}
@@ -66,7 +66,7 @@ retry:
 	tries++
 	if err = insert(tx, prt); err != nil {
 		if tries <= 3 && errors.As(err, &ucErr) {
-			logging.Warnf("generated random token %q already exists in the database", token)
+			logging.L.Warn().Stringer("token", logging.Secret(token)).Msg("generated random token already exists in the database")
 			goto retry // on the off chance the token exists.
 		}
 		return "", err
@@ -100,6 +100,7 @@ func ClaimPasswordResetToken(tx WriteTxn, token string) (uid.ID, error) {
 func RemoveExpiredPasswordResetTokens(tx WriteTxn) error {
 	query := querybuilder.New("DELETE FROM password_reset_tokens")
 	query.B("WHERE expires_at <= ?", time.Now().UTC())
+	query.B("/* all organizations */")
 
 	_, err := tx.Exec(query.String(), query.Args...)
 	return err
@@ -44,9 +44,23 @@ func CreateProvider(tx WriteTxn, provider *models.Provider) error {
 	if err := validateProvider(provider); err != nil {
 		return err
 	}
+	// the provider may be created for an organization other than the one of
+	// tx, for example by CreateOrganization.
+	setOrg(tx, provider)
+	invalidateCache(tx, infraProviderCacheKey(provider.OrganizationID))
 	return insert(tx, (*providersTable)(provider))
 }
 
+func infraProviderCacheKey(orgID uid.ID) cacheKey {
+	return cacheKey{table: "providers", orgID: orgID}
+}
+
+func cloneProvider(p *models.Provider) *models.Provider {
+	c := *p
+	c.Scopes = cloneStrings(p.Scopes)
+	return &c
+}
+
 type GetProviderOptions struct {
 	ByID   uid.ID
 	ByName string
@@ -58,26 +72,21 @@ type GetProviderOptions struct {
 
 func GetProvider(tx ReadTxn, opts GetProviderOptions) (*models.Provider, error) {
 	provider := &providersTable{}
-	query := querybuilder.New("SELECT")
-	query.B(columnsForSelect(provider))
-	query.B("FROM providers")
-	query.B("WHERE deleted_at is null")
-	query.B("AND organization_id = ?", tx.OrganizationID())
-
-	switch {
-	case opts.ByID != 0:
-		query.B("AND id = ?", opts.ByID)
-	case opts.ByName != "":
-		query.B("AND name = ?", opts.ByName)
-	case opts.KindInfra:
-		query.B("AND kind = ?", models.ProviderKindInfra)
-	default:
-		return nil, fmt.Errorf("an ID is required to get provider")
-	}
-
-	err := tx.QueryRow(query.String(), query.Args...).Scan(provider.ScanFields()...)
+	err := getInOrg(tx, provider, func(query *querybuilder.Query) error {
+		switch {
+		case opts.ByID != 0:
+			query.B("AND id = ?", opts.ByID)
+		case opts.ByName != "":
+			query.B("AND name = ?", opts.ByName)
+		case opts.KindInfra:
+			query.B("AND kind = ?", models.ProviderKindInfra)
+		default:
+			return fmt.Errorf("an ID is required to get provider")
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, handleError(err)
+		return nil, err
 	}
 	return (*models.Provider)(provider), nil
 }
@@ -103,7 +112,7 @@ func ListProviders(tx ReadTxn, opts ListProvidersOptions) ([]models.Provider, er
 	table := providersTable{}
 	query := querybuilder.New("SELECT")
 	query.B(columnsForSelect(table))
-	if opts.Pagination != nil {
+	if opts.Pagination.countTotal() {
 		query.B(", count(*) OVER()")
 	}
 	query.B("FROM providers")
@@ -139,7 +148,7 @@ func ListProviders(tx ReadTxn, opts ListProvidersOptions) ([]models.Provider, er
 	}
 	return scanRows(rows, func(grant *models.Provider) []any {
 		fields := (*providersTable)(grant).ScanFields()
-		if opts.Pagination != nil {
+		if opts.Pagination.countTotal() {
 			fields = append(fields, &opts.Pagination.TotalCount)
 		}
 		return fields
@@ -150,6 +159,7 @@ func UpdateProvider(tx WriteTxn, provider *models.Provider) error {
 	if err := validateProvider(provider); err != nil {
 		return err
 	}
+	invalidateCache(tx, infraProviderCacheKey(tx.OrganizationID()))
 	return update(tx, (*providersTable)(provider))
 }
 
@@ -234,6 +244,7 @@ func DeleteProviders(db WriteTxn, opts DeleteProvidersOptions) error {
 		}
 	}
 
+	invalidateCache(db, infraProviderCacheKey(db.OrganizationID()))
 	query := querybuilder.New(`UPDATE providers`)
 	query.B(`SET deleted_at = ?`, time.Now())
 	query.B(`WHERE deleted_at is null`)
@@ -255,7 +266,8 @@ func CountProvidersByKind(tx ReadTxn) ([]providersCount, error) {
 		FROM providers
 		WHERE kind <> 'infra'
 		AND deleted_at IS NULL
-		GROUP BY kind`)
+		GROUP BY kind
+		/* all organizations */`)
 	if err != nil {
 		return nil, err
 	}
@@ -265,5 +277,5 @@ func CountProvidersByKind(tx ReadTxn) ([]providersCount, error) {
 }
 
 func CountAllProviders(tx ReadTxn) (int64, error) {
-	return countRows(tx, providersTable{})
+	return countRows(tx, providersTable{}, nil)
 }
@@ -47,7 +47,11 @@ func TestCreateProvider_DuplicateName(t *testing.T) {
 
 		var uniqueConstraintErr UniqueConstraintError
 		assert.Assert(t, errors.As(err, &uniqueConstraintErr), "error is wrong type %T", err)
-		expected := UniqueConstraintError{Column: "name", Table: "providers"}
+		expected := UniqueConstraintError{
+			Table:   "providers",
+			Column:  "name",
+			Message: "a provider with that name already exists",
+		}
 		assert.DeepEqual(t, uniqueConstraintErr, expected)
 	})
 }
@@ -298,7 +302,11 @@ func TestUpdateProvider(t *testing.T) {
 
 			var ucErr UniqueConstraintError
 			assert.Assert(t, errors.As(err, &ucErr))
-			expected := UniqueConstraintError{Column: "name", Table: "providers"}
+			expected := UniqueConstraintError{
+				Table:   "providers",
+				Column:  "name",
+				Message: "a provider with that name already exists",
+			}
 			assert.DeepEqual(t, ucErr, expected)
 		})
 	})
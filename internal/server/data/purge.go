@@ -0,0 +1,82 @@
+package data
+
+import (
+	"fmt"
+	"time"
+)
+
+// PurgeTable is a table with soft deleted rows that are permanently deleted
+// once they have been soft deleted for longer than the retention period.
+type PurgeTable struct {
+	Name      string
+	Retention time.Duration
+	// Column is the timestamp compared to the retention period. Defaults to
+	// deleted_at. Tables without soft deletes use a different column, so that
+	// rows are purged when they expire.
+	Column string
+}
+
+const day = 24 * time.Hour
+
+// purgeTables are the tables with soft deleted rows that may be purged, in the
+// order they must be purged. Rows that reference an identity are purged
+// before the identities. Idempotency keys and webhook deliveries are not soft
+// deleted, they are purged once they are older than the retention period.
+var purgeTables = []PurgeTable{
+	{Name: "idempotency_keys", Retention: IdempotencyKeyTTL, Column: "created_at"},
+	{Name: "webhook_deliveries", Retention: 30 * day, Column: "created_at"},
+	{Name: "device_flow_auth_requests", Retention: 7 * day},
+	{Name: "access_keys", Retention: 30 * day},
+	{Name: "credentials", Retention: 90 * day},
+	{Name: "user_public_keys", Retention: 90 * day},
+	{Name: "grants", Retention: 90 * day},
+	{Name: "groups", Retention: 90 * day},
+	{Name: "identities", Retention: 90 * day},
+	{Name: "destinations", Retention: 90 * day},
+	{Name: "providers", Retention: 90 * day},
+	{Name: "webhooks", Retention: 90 * day},
+}
+
+// PurgeTables returns the tables with soft deleted rows that may be purged,
+// and the default retention period for each table, in the order the tables
+// must be purged.
+func PurgeTables() []PurgeTable {
+	return append([]PurgeTable(nil), purgeTables...)
+}
+
+// PurgeSoftDeleted permanently deletes up to limit rows from table that were
+// soft deleted before olderThan, and returns the number of rows deleted. Rows
+// are deleted from all organizations. table must be one of the tables
+// returned by PurgeTables.
+//
+// To avoid holding locks on a large number of rows, callers should use a
+// small limit, and commit the transaction before purging the next batch.
+func PurgeSoftDeleted(tx WriteTxn, table string, olderThan time.Time, limit int) (int64, error) {
+	item, ok := purgeTable(table)
+	if !ok {
+		return 0, fmt.Errorf("soft deleted rows can not be purged from table %v", table)
+	}
+	column := item.Column
+	if column == "" {
+		column = "deleted_at"
+	}
+
+	// table and column are from purgeTables, so they are safe to include in
+	// the statement.
+	stmt := "DELETE FROM " + table + " WHERE id IN (" +
+		"SELECT id FROM " + table + " WHERE " + column + " < ? LIMIT ?) /* all organizations */"
+	res, err := tx.Exec(stmt, olderThan, limit)
+	if err != nil {
+		return 0, fmt.Errorf("purge %v: %w", table, handleError(err))
+	}
+	return res.RowsAffected()
+}
+
+func purgeTable(table string) (PurgeTable, bool) {
+	for _, item := range purgeTables {
+		if item.Name == table {
+			return item, true
+		}
+	}
+	return PurgeTable{}, false
+}
@@ -0,0 +1,124 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestPurgeSoftDeleted(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+		now := time.Now()
+		provider := InfraProvider(tx)
+
+		oldUser := &models.Identity{Name: "old@example.com"}
+		recentUser := &models.Identity{Name: "recent@example.com"}
+		activeUser := &models.Identity{Name: "active@example.com"}
+		createIdentities(t, tx, oldUser, recentUser, activeUser)
+
+		newKey := func(user *models.Identity) *models.AccessKey {
+			return &models.AccessKey{
+				IssuedFor:  user.ID,
+				ProviderID: provider.ID,
+				ExpiresAt:  now.Add(time.Hour),
+			}
+		}
+		oldKey, recentKey, activeKey := newKey(oldUser), newKey(recentUser), newKey(activeUser)
+		createAccessKeys(t, tx, oldKey, recentKey, activeKey)
+
+		oldGrant := &models.Grant{Subject: uid.NewIdentityPolymorphicID(oldUser.ID), Privilege: "view", Resource: "any"}
+		recentGrant := &models.Grant{Subject: uid.NewIdentityPolymorphicID(recentUser.ID), Privilege: "view", Resource: "any"}
+		activeGrant := &models.Grant{Subject: uid.NewIdentityPolymorphicID(activeUser.ID), Privilege: "view", Resource: "any"}
+		createGrants(t, tx, oldGrant, recentGrant, activeGrant)
+
+		softDelete := func(table string, id uid.ID, deletedAt time.Time) {
+			t.Helper()
+			stmt := "UPDATE " + table + " SET deleted_at = ? WHERE id = ? AND organization_id = ?"
+			_, err := tx.Exec(stmt, deletedAt, id, tx.OrganizationID())
+			assert.NilError(t, err)
+		}
+		old, recent := now.Add(-60*day), now.Add(-time.Hour)
+		softDelete("identities", oldUser.ID, old)
+		softDelete("identities", recentUser.ID, recent)
+		softDelete("access_keys", oldKey.ID, old)
+		softDelete("access_keys", recentKey.ID, recent)
+		softDelete("grants", oldGrant.ID, old)
+		softDelete("grants", recentGrant.ID, recent)
+
+		// purge in batches of one row
+		for _, table := range []string{"access_keys", "grants", "identities"} {
+			var total int64
+			for {
+				count, err := PurgeSoftDeleted(tx, table, now.Add(-30*day), 1)
+				assert.NilError(t, err)
+				if count == 0 {
+					break
+				}
+				total += count
+			}
+			assert.Equal(t, total, int64(1), table)
+		}
+
+		exists := func(table string, id uid.ID) bool {
+			t.Helper()
+			var count int
+			stmt := "SELECT count(*) FROM " + table + " WHERE id = ? AND organization_id = ?"
+			err := tx.QueryRow(stmt, id, tx.OrganizationID()).Scan(&count)
+			assert.NilError(t, err)
+			return count == 1
+		}
+		assert.Assert(t, !exists("identities", oldUser.ID))
+		assert.Assert(t, !exists("access_keys", oldKey.ID))
+		assert.Assert(t, !exists("grants", oldGrant.ID))
+
+		for _, item := range []struct {
+			table string
+			id    uid.ID
+		}{
+			{table: "identities", id: recentUser.ID},
+			{table: "identities", id: activeUser.ID},
+			{table: "access_keys", id: recentKey.ID},
+			{table: "access_keys", id: activeKey.ID},
+			{table: "grants", id: recentGrant.ID},
+			{table: "grants", id: activeGrant.ID},
+		} {
+			assert.Assert(t, exists(item.table, item.id), "%v %v was removed", item.table, item.id)
+		}
+	})
+}
+
+func TestPurgeSoftDeleted_IdempotencyKeys(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+		now := time.Now()
+
+		expired := &models.IdempotencyKey{Key: "expired", RequestHash: "a", StatusCode: 201}
+		assert.NilError(t, CreateIdempotencyKey(tx, expired))
+		_, err := tx.Exec("UPDATE idempotency_keys SET created_at = ? WHERE id = ? AND organization_id = ?",
+			now.Add(-IdempotencyKeyTTL-time.Hour), expired.ID, tx.OrganizationID())
+		assert.NilError(t, err)
+
+		active := &models.IdempotencyKey{Key: "active", RequestHash: "b", StatusCode: 201}
+		assert.NilError(t, CreateIdempotencyKey(tx, active))
+
+		count, err := PurgeSoftDeleted(tx, "idempotency_keys", now.Add(-IdempotencyKeyTTL), 10)
+		assert.NilError(t, err)
+		assert.Equal(t, count, int64(1))
+
+		_, err = GetIdempotencyKey(tx, "expired")
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+		_, err = GetIdempotencyKey(tx, "active")
+		assert.NilError(t, err)
+	})
+}
+
+func TestPurgeSoftDeleted_InvalidTable(t *testing.T) {
+	_, err := PurgeSoftDeleted(nil, "organizations; DROP TABLE grants", time.Now(), 10)
+	assert.ErrorContains(t, err, "can not be purged from table")
+}
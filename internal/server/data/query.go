@@ -2,8 +2,11 @@ package data
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"reflect"
 	"strings"
+	"sync"
 
 	"github.com/infrahq/infra/internal/server/data/querybuilder"
 	"github.com/infrahq/infra/uid"
@@ -91,6 +94,81 @@ func insert(tx WriteTxn, item Insertable) error {
 	return handleError(err)
 }
 
+// maxQueryArgs is the maximum number of arguments postgres accepts in a single
+// query.
+const maxQueryArgs = 65535
+
+// maxSQLiteQueryArgs is the maximum number of arguments sqlite accepts in a
+// single query.
+const maxSQLiteQueryArgs = 32766
+
+type insertManyOptions struct {
+	// withUpdateIndex adds an update_index column to every row, set to the
+	// next value of seq_update_index.
+	withUpdateIndex bool
+	// onConflictDoNothing skips rows that would violate a unique constraint,
+	// instead of returning an error.
+	onConflictDoNothing bool
+}
+
+// insertMany inserts items into the database using tx. Items are inserted with
+// multi-row INSERT statements, split into chunks so that no statement exceeds
+// maxQueryArgs. Returns the error from the first chunk that fails, which
+// identifies the range of items in the chunk. Chunks before the failed chunk
+// will have been inserted, so insertMany should be used in a transaction.
+func insertMany[T Insertable](tx WriteTxn, items []T, opts insertManyOptions) error {
+	if len(items) == 0 {
+		return nil
+	}
+	for _, item := range items {
+		if err := item.OnInsert(); err != nil {
+			return err
+		}
+		setOrg(tx, item)
+	}
+
+	table := items[0]
+	maxArgs := maxQueryArgs
+	if dialectOf(tx) != nil {
+		maxArgs = maxSQLiteQueryArgs
+	}
+	chunkSize := maxArgs / len(table.Columns())
+	for start := 0; start < len(items); start += chunkSize {
+		end := start + chunkSize
+		if end > len(items) {
+			end = len(items)
+		}
+
+		query := querybuilder.New("INSERT INTO")
+		query.B(table.Table())
+		query.B("(")
+		query.B(columnsForInsert(table))
+		if opts.withUpdateIndex {
+			query.B(", update_index")
+		}
+		query.B(") VALUES")
+		for i, item := range items[start:end] {
+			if i > 0 {
+				query.B(",")
+			}
+			query.B("(")
+			query.B(placeholderForColumns(table), item.Values()...)
+			if opts.withUpdateIndex {
+				query.B(", nextval('seq_update_index')")
+			}
+			query.B(")")
+		}
+		if opts.onConflictDoNothing {
+			query.B("ON CONFLICT DO NOTHING")
+		}
+
+		if _, err := tx.Exec(query.String(), query.Args...); err != nil {
+			return fmt.Errorf("insert %v rows %d to %d: %w", table.Table(), start, end-1, handleError(err))
+		}
+	}
+	return nil
+}
+
 // columnsForInsert returns the list of columns names for table as a string
 // appropriate for an INSERT statement.
 //
@@ -102,7 +180,42 @@ func insert(tx WriteTxn, item Insertable) error {
 // The return value must only include trusted strings from the source code,
 // never untrusted user input.
 func columnsForInsert(table Table) string {
-	return strings.Join(table.Columns(), ", ")
+	return columnStringsFor(table).insert
+}
+
+// columnStrings are the strings built from Table.Columns by columnsForInsert,
+// placeholderForColumns, columnsForUpdate, and columnsForSelect.
+type columnStrings struct {
+	insert       string
+	placeholders string
+	update       string
+	selects      string
+}
+
+// columnStringsCache stores the columnStrings for each Table type. The columns
+// of a table never change, so the strings are only built once.
+var columnStringsCache sync.Map // map[reflect.Type]*columnStrings
+
+func columnStringsFor(table Table) *columnStrings {
+	key := reflect.TypeOf(table)
+	if cached, ok := columnStringsCache.Load(key); ok {
+		return cached.(*columnStrings)
+	}
+
+	columns := table.Columns()
+	name := table.Table()
+	placeholders := make([]string, len(columns))
+	for i := range columns {
+		placeholders[i] = "?"
+	}
+	cs := &columnStrings{
+		insert:       strings.Join(columns, ", "),
+		placeholders: strings.Join(placeholders, ", "),
+		update:       strings.Join(columns, " = ?, ") + " = ?",
+		selects:      name + "." + strings.Join(columns, ", "+name+"."),
+	}
+	columnStringsCache.Store(key, cs)
+	return cs
 }
 
 // placeholderForColumns returns a list of argument placeholders as a string
@@ -115,12 +228,7 @@ func columnsForInsert(table Table) string {
 // The return value must only include trusted strings from the source code,
 // never untrusted user input.
 func placeholderForColumns(table Table) string {
-	columns := table.Columns()
-	result := make([]string, len(columns))
-	for i := range columns {
-		result[i] = "?"
-	}
-	return strings.Join(result, ", ")
+	return columnStringsFor(table).placeholders
 }
 
 // update an item in the database using tx. update is a convenience function
@@ -156,7 +264,7 @@ func update(tx WriteTxn, item Updatable) error {
 // The return value must only include trusted strings from the source code,
 // never untrusted user input.
 func columnsForUpdate(table Table) string {
-	return strings.Join(table.Columns(), " = ?, ") + " = ?"
+	return columnStringsFor(table).update
 }
 
 // columnsForSelect returns a list of column names as a string appropriate for
@@ -170,25 +278,58 @@ func columnsForUpdate(table Table) string {
 // The return value must only include trusted strings from the source code,
 // never untrusted user input.
 func columnsForSelect(table Table) string {
-	name := table.Table()
-	return name + "." + strings.Join(table.Columns(), ", "+name+".")
+	return columnStringsFor(table).selects
 }
 
 // scanRows iterates over rows and builds a slice of T by scanning each row
-// into fields. rows is closed before returning.
+// into fields. rows is closed before returning. See forEachRow for the
+// requirements of fields.
 func scanRows[T any](rows *sql.Rows, fields func(*T) []any) ([]T, error) {
+	var result []T
+	err := forEachRow(rows, fields, func(target T) error {
+		result = append(result, target)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// errStopRows may be returned by the function passed to forEachRow to stop
+// iterating over rows without returning an error.
+var errStopRows = errors.New("stop iterating over rows")
+
+// forEachRow scans each row into fields, and calls fn with the result, one
+// row at a time. Unlike scanRows the rows are never all held in memory, so
+// forEachRow should be used for queries that may return a large number of rows.
+//
+// fields is only called once, and the slice it returns is reused to scan
+// every row. Each row is scanned into the same target, which is reset to the
+// zero value first, so fields must only return pointers to target, or to
+// values that are not specific to a row.
+//
+// Iteration stops at the first error from scanning a row, or from fn. If fn
+// returns errStopRows iteration stops and forEachRow returns nil. rows is
+// closed before returning.
+func forEachRow[T any](rows *sql.Rows, fields func(*T) []any, fn func(T) error) error {
 	defer rows.Close()
 
-	var result []T
+	var target, zero T
+	dest := fields(&target)
 	for rows.Next() {
-		var target T
-
-		if err := rows.Scan(fields(&target)...); err != nil {
-			return nil, fmt.Errorf("scan row: %w", err)
+		target = zero
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("scan row: %w", err)
+		}
+		if err := fn(target); err != nil {
+			if errors.Is(err, errStopRows) {
+				return nil
+			}
+			return err
 		}
-		result = append(result, target)
 	}
-	return result, rows.Err()
+	return rows.Err()
 }
 
 // countRows performs a query that returns the number of rows in the table where
@@ -197,10 +338,19 @@ func scanRows[T any](rows *sql.Rows, fields func(*T) []any) ([]T, error) {
 // To get counts for tables that do not have a deleted_at column, or to scope
 // the count, copy the implementation of this function and add the necessary
 // parameters to the query.
-func countRows(tx ReadTxn, table Table) (int64, error) {
+// countRows returns the number of rows in table. filter adds the JOIN and
+// WHERE clauses to the query, and must exclude deleted rows and rows from
+// other organizations. When filter is nil, countRows counts the rows that are
+// not deleted in all organizations.
+func countRows(tx ReadTxn, table Table, filter func(query *querybuilder.Query) error) (int64, error) {
 	query := querybuilder.New("SELECT count(*) FROM")
 	query.B(table.Table())
-	query.B("WHERE deleted_at is null")
+	if filter == nil {
+		query.B("WHERE deleted_at is null")
+		query.B("/* all organizations */")
+	} else if err := filter(query); err != nil {
+		return 0, err
+	}
 
 	var count int64
 	err := tx.QueryRow(query.String(), query.Args...).Scan(&count)
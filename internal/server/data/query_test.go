@@ -1,7 +1,10 @@
 package data
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"runtime"
 	"testing"
 
 	"gotest.tools/v3/assert"
@@ -60,12 +63,17 @@ type txnCapture struct {
 	ReadTxn
 	query string
 	args  []any
+	// execCount is the number of calls to Exec.
+	execCount int
+	// err is returned by Exec when it is set.
+	err error
 }
 
 func (t *txnCapture) Exec(query string, args ...any) (sql.Result, error) {
 	t.query = query
 	t.args = args
-	return nil, nil
+	t.execCount++
+	return nil, t.err
 }
 
 func (t *txnCapture) OrganizationID() uid.ID {
@@ -82,3 +90,180 @@ func TestUpdate(t *testing.T) {
 	expectedArgs := []any{uid.ID(123), "first", 111, uid.ID(123), uid.ID(7)}
 	assert.DeepEqual(t, tx.args, expectedArgs)
 }
+
+func TestInsertMany(t *testing.T) {
+	t.Run("single chunk", func(t *testing.T) {
+		items := []example{
+			{ID: 123, First: "first", Age: 111},
+			{ID: 124, First: "second", Age: 222},
+		}
+		tx := &txnCapture{}
+		err := insertMany(tx, items, insertManyOptions{
+			withUpdateIndex:     true,
+			onConflictDoNothing: true,
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, tx.execCount, 1)
+		expected := `INSERT INTO examples ( id, first, age , update_index ) VALUES ` +
+			`( ?, ?, ? , nextval('seq_update_index') ) , ` +
+			`( ?, ?, ? , nextval('seq_update_index') ) ON CONFLICT DO NOTHING `
+		assert.Equal(t, tx.query, expected)
+		expectedArgs := []any{uid.ID(123), "first", 111, uid.ID(124), "second", 222}
+		assert.DeepEqual(t, tx.args, expectedArgs)
+	})
+	t.Run("no items", func(t *testing.T) {
+		tx := &txnCapture{}
+		err := insertMany(tx, []example{}, insertManyOptions{})
+		assert.NilError(t, err)
+		assert.Equal(t, tx.execCount, 0)
+	})
+	t.Run("multiple chunks", func(t *testing.T) {
+		items := make([]example, 50_000)
+		tx := &txnCapture{}
+		err := insertMany(tx, items, insertManyOptions{})
+		assert.NilError(t, err)
+
+		chunkSize := maxQueryArgs / 3
+		assert.Equal(t, tx.execCount, 3)
+		assert.Equal(t, len(tx.args), (50_000-2*chunkSize)*3)
+	})
+	t.Run("error identifies the chunk", func(t *testing.T) {
+		items := make([]example, 50_000)
+		tx := &txnCapture{err: errors.New("oops")}
+		err := insertMany(tx, items, insertManyOptions{})
+		assert.Error(t, err, "insert examples rows 0 to 21844: oops")
+		assert.Equal(t, tx.execCount, 1)
+	})
+}
+
+// BenchmarkInsertGrants compares inserting grants one at a time, to
+// inserting them with insertMany.
+func BenchmarkInsertGrants(b *testing.B) {
+	db := setupDB(b)
+
+	newGrants := func() []*models.Grant {
+		grants := make([]*models.Grant, 5000)
+		for i := range grants {
+			grants[i] = &models.Grant{
+				Subject:   uid.NewIdentityPolymorphicID(uid.New()),
+				Privilege: "view",
+				Resource:  "infra",
+			}
+		}
+		return grants
+	}
+
+	b.Run("single inserts", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			b.StopTimer()
+			grants := newGrants()
+			tx, err := db.Begin(context.Background(), nil)
+			assert.NilError(b, err)
+			b.StartTimer()
+
+			for _, grant := range grants {
+				assert.NilError(b, CreateGrant(tx.WithOrgID(db.DefaultOrg.ID), grant))
+			}
+
+			b.StopTimer()
+			assert.NilError(b, tx.Rollback())
+			b.StartTimer()
+		}
+	})
+	b.Run("insertMany", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			b.StopTimer()
+			grants := newGrants()
+			tx, err := db.Begin(context.Background(), nil)
+			assert.NilError(b, err)
+			b.StartTimer()
+
+			assert.NilError(b, createGrantsBulk(tx.WithOrgID(db.DefaultOrg.ID), grants))
+
+			b.StopTimer()
+			assert.NilError(b, tx.Rollback())
+			b.StartTimer()
+		}
+	})
+}
+
+type exampleRow struct {
+	N       int
+	Payload string
+}
+
+func TestForEachRow(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		skipWithSQLite(t, db, "generate_series")
+		// 10,000 rows with 1KB of data in each row
+		stmt := `SELECT n, repeat('x', 1000) FROM generate_series(1, 10000) AS n ORDER BY n`
+		fields := func(r *exampleRow) []any {
+			return []any{&r.N, &r.Payload}
+		}
+
+		t.Run("streams rows with bounded memory", func(t *testing.T) {
+			rows, err := db.Query(stmt)
+			assert.NilError(t, err)
+
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+
+			var count int
+			err = forEachRow(rows, fields, func(r exampleRow) error {
+				count++
+				assert.Equal(t, r.N, count)
+				if count == 10000 {
+					runtime.GC()
+					runtime.ReadMemStats(&after)
+				}
+				return nil
+			})
+			assert.NilError(t, err)
+			assert.Equal(t, count, 10000)
+
+			// holding all the rows in memory would use at least 10MB
+			growth := int64(after.HeapAlloc) - int64(before.HeapAlloc)
+			assert.Assert(t, growth < 2<<20, "heap grew by %d bytes", growth)
+		})
+		t.Run("stop early", func(t *testing.T) {
+			rows, err := db.Query(stmt)
+			assert.NilError(t, err)
+
+			var count int
+			err = forEachRow(rows, fields, func(r exampleRow) error {
+				count++
+				if count == 5 {
+					return errStopRows
+				}
+				return nil
+			})
+			assert.NilError(t, err)
+			assert.Equal(t, count, 5)
+			assert.Assert(t, !rows.Next())
+		})
+		t.Run("error from fn", func(t *testing.T) {
+			rows, err := db.Query(stmt)
+			assert.NilError(t, err)
+
+			errWrite := errors.New("client disconnected")
+			err = forEachRow(rows, fields, func(r exampleRow) error {
+				return errWrite
+			})
+			assert.ErrorIs(t, err, errWrite)
+			// rows are closed, so the connection can be used again
+			assert.Assert(t, !rows.Next())
+		})
+		t.Run("scan error", func(t *testing.T) {
+			rows, err := db.Query(`SELECT 'not a number', 'x'`)
+			assert.NilError(t, err)
+
+			err = forEachRow(rows, fields, func(r exampleRow) error {
+				t.Fatal("fn should not be called")
+				return nil
+			})
+			assert.ErrorContains(t, err, "scan row")
+			assert.Assert(t, !rows.Next())
+		})
+	})
+}
@@ -32,15 +32,23 @@ type Query struct {
 // Use Query.B to add sections of a query with parameters.
 func New(stmt string) *Query {
 	q := &Query{}
-	q.query.WriteString(stmt + " ")
+	q.query.Grow(defaultQueryCap)
+	q.query.WriteString(stmt)
+	q.query.WriteByte(' ')
 	return q
 }
 
+// defaultQueryCap is the initial size of the query of a new Query. It is
+// large enough for most queries, so that the buffer does not need to grow as
+// clauses are added.
+const defaultQueryCap = 512
+
 // B adds clause and args to the query. The clause must be a trusted string
 // literal. Any arguments must be passed as args so that they are properly
 // escaped by the database driver.
 func (q *Query) B(clause string, args ...interface{}) {
-	q.query.WriteString(clause + " ")
+	q.query.WriteString(clause)
+	q.query.WriteByte(' ')
 	q.Args = append(q.Args, args...)
 }
 
@@ -50,3 +58,49 @@ func (q *Query) B(clause string, args ...interface{}) {
 func (q *Query) String() string {
 	return q.query.String()
 }
+
+// In adds a "column IN (?, ?, ...)" condition to the query, with one
+// placeholder for each item in values. The column must be a trusted string
+// literal. Any SQL keyword that joins the condition to the rest of the query
+// (ex: AND) must be added with Query.B.
+//
+// When values is empty In adds a condition that is always false, because no
+// row can match an item in an empty list.
+func In[T any](q *Query, column string, values []T) {
+	if len(values) == 0 {
+		q.query.WriteString("1=0 ")
+		return
+	}
+	q.query.WriteString(column)
+	q.query.WriteString(" IN ")
+	writeList(q, values)
+}
+
+// NotIn adds a "column NOT IN (?, ?, ...)" condition to the query, with one
+// placeholder for each item in values. The column must be a trusted string
+// literal.
+//
+// When values is empty NotIn adds a condition that is always true, because
+// no row is in an empty list.
+func NotIn[T any](q *Query, column string, values []T) {
+	if len(values) == 0 {
+		q.query.WriteString("1=1 ")
+		return
+	}
+	q.query.WriteString(column)
+	q.query.WriteString(" NOT IN ")
+	writeList(q, values)
+}
+
+func writeList[T any](q *Query, values []T) {
+	q.query.Grow(len(values) * 3)
+	q.query.WriteString("(")
+	for i, value := range values {
+		if i != 0 {
+			q.query.WriteString(", ")
+		}
+		q.query.WriteString("?")
+		q.Args = append(q.Args, value)
+	}
+	q.query.WriteString(") ")
+}
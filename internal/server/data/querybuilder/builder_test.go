@@ -0,0 +1,74 @@
+package querybuilder
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestIn(t *testing.T) {
+	type testCase struct {
+		name          string
+		values        []int
+		expectedIn    string
+		expectedNotIn string
+		expectedArgs  []interface{}
+	}
+
+	run := func(t *testing.T, tc testCase) {
+		q := New("SELECT id FROM grants WHERE")
+		In(q, "id", tc.values)
+		q.B("AND")
+		NotIn(q, "created_by", tc.values)
+
+		expected := "SELECT id FROM grants WHERE " + tc.expectedIn + " AND " + tc.expectedNotIn + " "
+		assert.Equal(t, q.String(), expected)
+		assert.DeepEqual(t, q.Args, tc.expectedArgs)
+	}
+
+	thousand := make([]int, 1000)
+	var thousandArgs []interface{}
+	for i := range thousand {
+		thousand[i] = i
+	}
+	for i := 0; i < 2; i++ {
+		for _, v := range thousand {
+			thousandArgs = append(thousandArgs, v)
+		}
+	}
+	thousandPlaceholders := "(" + strings.Repeat("?, ", 999) + "?)"
+
+	testCases := []testCase{
+		{
+			name:          "nil",
+			expectedIn:    "1=0",
+			expectedNotIn: "1=1",
+		},
+		{
+			name:          "empty",
+			values:        []int{},
+			expectedIn:    "1=0",
+			expectedNotIn: "1=1",
+		},
+		{
+			name:          "one value",
+			values:        []int{7},
+			expectedIn:    "id IN (?)",
+			expectedNotIn: "created_by NOT IN (?)",
+			expectedArgs:  []interface{}{7, 7},
+		},
+		{
+			name:          "1000 values",
+			values:        thousand,
+			expectedIn:    "id IN " + thousandPlaceholders,
+			expectedNotIn: "created_by NOT IN " + thousandPlaceholders,
+			expectedArgs:  thousandArgs,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/infrahq/infra/internal/logging"
+)
+
+// replicaRetryInterval is how long read-only transactions use the primary
+// database after the replica failed to start a transaction.
+const replicaRetryInterval = 10 * time.Second
+
+var errReplicaUnavailable = errors.New("read replica is unavailable")
+
+// replica is a read replica of the primary database. Read-only transactions
+// are started on the replica, unless it is unavailable.
+type replica struct {
+	db *sql.DB
+
+	// down is true after the replica failed to start a transaction, and until
+	// it successfully starts a transaction again.
+	down atomic.Bool
+	// retryAt is the time, in unix nanoseconds, after which the replica should
+	// be used again.
+	retryAt atomic.Int64
+}
+
+func (r *replica) begin(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	if time.Now().UnixNano() < r.retryAt.Load() {
+		return nil, errReplicaUnavailable
+	}
+
+	tx, err := r.db.BeginTx(ctx, opts)
+	switch {
+	case err == nil:
+		if r.down.CompareAndSwap(true, false) {
+			logging.L.Info().Msg("read replica is available, using it for read-only transactions")
+		}
+		return tx, nil
+	case ctx.Err() != nil:
+		// the request was cancelled, this is not a problem with the replica
+		return nil, err
+	}
+
+	r.retryAt.Store(time.Now().Add(replicaRetryInterval).UnixNano())
+	if !r.down.Swap(true) {
+		logging.L.Warn().Err(err).Msg("read replica is unavailable, using the primary database")
+	}
+	return nil, err
+}
+
+type requirePrimaryKey struct{}
+
+// RequirePrimary returns a context that causes DB.Begin to start the
+// transaction on the primary database, even when the transaction is read-only.
+// Use it for reads that must see writes from a previous transaction, where a
+// replica may not have those writes yet.
+func RequirePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requirePrimaryKey{}, true)
+}
+
+func requiresPrimary(ctx context.Context) bool {
+	v, _ := ctx.Value(requirePrimaryKey{}).(bool)
+	return v
+}
@@ -0,0 +1,127 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/testing/database"
+	"github.com/infrahq/infra/internal/testing/patch"
+)
+
+func currentSchema(t *testing.T, tx *Transaction) string {
+	t.Helper()
+	var schema string
+	err := tx.QueryRow("SELECT current_schema()").Scan(&schema)
+	assert.NilError(t, err)
+	return schema
+}
+
+func TestDB_Begin_WithReplica(t *testing.T) {
+	patch.ModelsSymmetricKey(t)
+	primaryDSN := database.PostgresDriver(t, "_primary").DSN
+	replicaDSN := database.PostgresDriver(t, "_replica").DSN
+
+	// The test databases are in different schemas, so the schema identifies
+	// which database the transaction was started on. The replica is migrated
+	// separately because it is not a real replica of the primary.
+	replicaDB, err := NewDB(NewDBOptions{DSN: replicaDSN})
+	assert.NilError(t, err)
+	assert.NilError(t, replicaDB.Close())
+
+	db, err := NewDB(NewDBOptions{DSN: primaryDSN, ReplicaDSN: replicaDSN})
+	assert.NilError(t, err)
+	t.Cleanup(func() {
+		assert.NilError(t, db.Close())
+	})
+
+	begin := func(t *testing.T, ctx context.Context, opts *sql.TxOptions) string {
+		t.Helper()
+		tx, err := db.Begin(ctx, opts)
+		assert.NilError(t, err)
+		t.Cleanup(func() {
+			_ = tx.Rollback()
+		})
+		return currentSchema(t, tx)
+	}
+
+	ctx := context.Background()
+	primarySchema := begin(t, ctx, nil)
+	assert.Assert(t, strings.Contains(primarySchema, "_primary_"), primarySchema)
+
+	t.Run("read-only transactions use the replica", func(t *testing.T) {
+		schema := begin(t, ctx, &sql.TxOptions{ReadOnly: true})
+		assert.Assert(t, strings.Contains(schema, "_replica_"), schema)
+	})
+	t.Run("write transactions use the primary", func(t *testing.T) {
+		schema := begin(t, ctx, &sql.TxOptions{})
+		assert.Equal(t, schema, primarySchema)
+	})
+	t.Run("require primary", func(t *testing.T) {
+		schema := begin(t, RequirePrimary(ctx), &sql.TxOptions{ReadOnly: true})
+		assert.Equal(t, schema, primarySchema)
+	})
+}
+
+func TestDB_Begin_ReplicaUnavailable(t *testing.T) {
+	patch.ModelsSymmetricKey(t)
+	primaryDSN := database.PostgresDriver(t, "_primary").DSN
+
+	db, err := NewDB(NewDBOptions{
+		DSN:        primaryDSN,
+		ReplicaDSN: "host=127.0.0.1 port=1 user=nobody connect_timeout=2",
+	})
+	assert.NilError(t, err)
+	t.Cleanup(func() {
+		assert.NilError(t, db.Close())
+	})
+
+	logs := new(bytes.Buffer)
+	logging.PatchLogger(t, logs)
+
+	for i := 0; i < 3; i++ {
+		tx, err := db.Begin(context.Background(), &sql.TxOptions{ReadOnly: true})
+		assert.NilError(t, err)
+		schema := currentSchema(t, tx)
+		assert.Assert(t, strings.Contains(schema, "_primary_"), schema)
+		assert.NilError(t, tx.Rollback())
+	}
+
+	// the fallback is logged once, not for every transaction
+	assert.Equal(t, strings.Count(logs.String(), "read replica is unavailable"), 1, logs.String())
+}
+
+func TestReplica_Begin_Unavailable(t *testing.T) {
+	sqlDB, err := sql.Open("pgx", "host=127.0.0.1 port=1 user=nobody connect_timeout=2")
+	assert.NilError(t, err)
+	t.Cleanup(func() {
+		assert.NilError(t, sqlDB.Close())
+	})
+	r := &replica{db: sqlDB}
+
+	logs := new(bytes.Buffer)
+	logging.PatchLogger(t, logs)
+
+	ctx := context.Background()
+	_, err = r.begin(ctx, &sql.TxOptions{ReadOnly: true})
+	assert.Assert(t, err != nil)
+	assert.Assert(t, !errors.Is(err, errReplicaUnavailable))
+	assert.Assert(t, r.down.Load())
+
+	// the replica is not used again until the retry interval has passed
+	_, err = r.begin(ctx, &sql.TxOptions{ReadOnly: true})
+	assert.ErrorIs(t, err, errReplicaUnavailable)
+
+	r.retryAt.Store(0)
+	_, err = r.begin(ctx, &sql.TxOptions{ReadOnly: true})
+	assert.Assert(t, err != nil)
+	assert.Assert(t, !errors.Is(err, errReplicaUnavailable))
+
+	assert.Equal(t, strings.Count(logs.String(), "read replica is unavailable"), 1, logs.String())
+}
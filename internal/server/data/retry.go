@@ -0,0 +1,84 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/uid"
+)
+
+const (
+	// maxTxnAttempts is the number of times RetryTxn will attempt a
+	// transaction before returning the error.
+	maxTxnAttempts = 5
+	// retryTxnBaseDelay is the delay before the second attempt. The delay
+	// doubles for each attempt after that.
+	retryTxnBaseDelay = 20 * time.Millisecond
+)
+
+// RetryTxn runs fn in a new transaction scoped to orgID, and commits the
+// transaction. If fn or the commit fails because of a serialization failure or
+// a deadlock, the transaction is rolled back and fn is run again in a new
+// transaction after a short delay. Any other error is returned immediately.
+//
+// fn may be called more than once, so it must not have side effects outside of
+// the transaction. Side effects should be performed by the caller after
+// RetryTxn returns.
+func RetryTxn(ctx context.Context, db *DB, orgID uid.ID, fn func(tx *Transaction) error) error {
+	for attempt := 1; ; attempt++ {
+		err := runTxn(ctx, db, orgID, fn)
+		if err == nil || !isRetryableTxnError(err) || attempt == maxTxnAttempts {
+			return err
+		}
+
+		delay := retryTxnDelay(attempt)
+		logging.FromContext(ctx).Debug().Err(err).
+			Int("attempt", attempt).
+			Dur("delay", delay).
+			Msg("retrying transaction")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func runTxn(ctx context.Context, db *DB, orgID uid.ID, fn func(tx *Transaction) error) error {
+	tx, err := db.Begin(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx.WithOrgID(orgID)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+func isRetryableTxnError(err error) bool {
+	return isPgErrorCode(err, pgerrcode.SerializationFailure) ||
+		isPgErrorCode(err, pgerrcode.DeadlockDetected) ||
+		isSQLiteErrorCode(err, sqlite3.SQLITE_BUSY)
+}
+
+// retryTxnDelay returns a random delay between half and all of the backoff for
+// attempt, so that conflicting transactions are unlikely to be retried at the
+// same time.
+func retryTxnDelay(attempt int) time.Duration {
+	backoff := retryTxnBaseDelay << (attempt - 1)
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2))) // nolint:gosec
+}
@@ -0,0 +1,116 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+	"gotest.tools/v3/assert"
+)
+
+func TestIsRetryableTxnError(t *testing.T) {
+	pgErr := func(code string) error {
+		return fmt.Errorf("wrapped: %w", &pgconn.PgError{Code: code})
+	}
+	assert.Assert(t, isRetryableTxnError(pgErr(pgerrcode.SerializationFailure)))
+	assert.Assert(t, isRetryableTxnError(pgErr(pgerrcode.DeadlockDetected)))
+	assert.Assert(t, !isRetryableTxnError(pgErr(pgerrcode.UniqueViolation)))
+	assert.Assert(t, !isRetryableTxnError(errors.New("serialization failure")))
+}
+
+func TestRetryTxnDelay(t *testing.T) {
+	for attempt := 1; attempt < maxTxnAttempts; attempt++ {
+		backoff := retryTxnBaseDelay << (attempt - 1)
+		for i := 0; i < 20; i++ {
+			delay := retryTxnDelay(attempt)
+			assert.Assert(t, delay >= backoff/2 && delay < backoff, "attempt %d: %v", attempt, delay)
+		}
+	}
+}
+
+func TestRetryTxn(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		_, err := db.Exec(`CREATE TABLE retry_test (id integer PRIMARY KEY, value integer)`)
+		assert.NilError(t, err)
+		_, err = db.Exec(`INSERT INTO retry_test (id, value) VALUES (1, 0), (2, 0)`)
+		assert.NilError(t, err)
+
+		ctx := context.Background()
+		orgID := db.DefaultOrg.ID
+
+		t.Run("retries after a deadlock", func(t *testing.T) {
+			skipWithSQLite(t, db, "concurrent write transactions")
+			other, err := db.Begin(ctx, nil)
+			assert.NilError(t, err)
+			defer other.Rollback()
+
+			_, err = other.Exec(`UPDATE retry_test SET value = value + 1 WHERE id = 2`)
+			assert.NilError(t, err)
+
+			locked := make(chan struct{})
+			var once sync.Once
+			otherErr := make(chan error, 1)
+			go func() {
+				<-locked
+				// wait for the first attempt to block on row 2, so that the
+				// first attempt detects the deadlock.
+				time.Sleep(200 * time.Millisecond)
+				if _, err := other.Exec(`UPDATE retry_test SET value = value + 1 WHERE id = 1`); err != nil {
+					otherErr <- err
+					return
+				}
+				otherErr <- other.Commit()
+			}()
+
+			var attempts int
+			err = RetryTxn(ctx, db, orgID, func(tx *Transaction) error {
+				attempts++
+				if _, err := tx.Exec(`UPDATE retry_test SET value = value + 10 WHERE id = 1`); err != nil {
+					return err
+				}
+				once.Do(func() { close(locked) })
+				_, err := tx.Exec(`UPDATE retry_test SET value = value + 10 WHERE id = 2`)
+				return err
+			})
+			assert.NilError(t, err)
+			assert.NilError(t, <-otherErr)
+			assert.Equal(t, attempts, 2)
+
+			var value1, value2 int
+			err = db.QueryRow(`SELECT value FROM retry_test WHERE id = 1`).Scan(&value1)
+			assert.NilError(t, err)
+			err = db.QueryRow(`SELECT value FROM retry_test WHERE id = 2`).Scan(&value2)
+			assert.NilError(t, err)
+			// both transactions were committed once
+			assert.Equal(t, value1, 11)
+			assert.Equal(t, value2, 11)
+		})
+
+		t.Run("other errors are not retried", func(t *testing.T) {
+			var attempts int
+			err := RetryTxn(ctx, db, orgID, func(tx *Transaction) error {
+				attempts++
+				_, err := tx.Exec(`INSERT INTO retry_test (id, value) VALUES (1, 0)`)
+				return err
+			})
+			var ucErr UniqueConstraintError
+			assert.Assert(t, errors.As(handleError(err), &ucErr), err)
+			assert.Equal(t, attempts, 1)
+		})
+
+		t.Run("gives up after the max attempts", func(t *testing.T) {
+			var attempts int
+			err := RetryTxn(ctx, db, orgID, func(tx *Transaction) error {
+				attempts++
+				return &pgconn.PgError{Code: pgerrcode.SerializationFailure}
+			})
+			assert.Assert(t, isPgErrorCode(err, pgerrcode.SerializationFailure), err)
+			assert.Equal(t, attempts, maxTxnAttempts)
+		})
+	})
+}
@@ -26,7 +26,15 @@ CREATE FUNCTION grants_notify() RETURNS trigger
     LANGUAGE plpgsql
     AS $$
 BEGIN
-PERFORM pg_notify(current_schema() || '.grants_' || NEW.organization_id, row_to_json(NEW)::text);
+PERFORM pg_notify(current_schema() || '.grants_' || NEW.organization_id, json_build_object('resource', split_part(NEW.resource, '.', 1))::text);
+RETURN NULL;
+END; $$;
+
+CREATE FUNCTION issued_tokens_notify() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+PERFORM pg_notify(current_schema() || '.grants_' || NEW.organization_id, json_build_object('resource', NEW.destination_name)::text);
 RETURN NULL;
 END; $$;
 
@@ -121,7 +129,30 @@ CREATE TABLE access_keys (
     key_id text,
     secret_checksum bytea,
     scopes text,
-    organization_id bigint
+    organization_id bigint,
+    last_used_at timestamp with time zone,
+    last_used_ip text DEFAULT ''::text NOT NULL,
+    last_used_user_agent text DEFAULT ''::text NOT NULL,
+    impersonated_by bigint DEFAULT 0 NOT NULL
+);
+
+CREATE TABLE audit_events (
+    id bigint NOT NULL,
+    organization_id bigint NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    actor_id bigint DEFAULT 0 NOT NULL,
+    actor_name text DEFAULT ''::text NOT NULL,
+    action text NOT NULL,
+    target_type text DEFAULT ''::text NOT NULL,
+    target_id text DEFAULT ''::text NOT NULL,
+    result text NOT NULL,
+    request_id text DEFAULT ''::text NOT NULL,
+    source_ip text DEFAULT ''::text NOT NULL,
+    reason text DEFAULT ''::text NOT NULL,
+    impersonator_id bigint DEFAULT 0 NOT NULL,
+    impersonator_name text DEFAULT ''::text NOT NULL,
+    target_name text DEFAULT ''::text NOT NULL,
+    metadata text DEFAULT '{}'::text NOT NULL
 );
 
 CREATE TABLE credentials (
@@ -132,7 +163,11 @@ CREATE TABLE credentials (
     identity_id bigint,
     password_hash bytea,
     one_time_password boolean,
-    organization_id bigint
+    organization_id bigint,
+    failed_login_attempts integer DEFAULT 0 NOT NULL,
+    last_failed_login_at timestamp with time zone,
+    locked_until timestamp with time zone,
+    one_time_password_expires_at timestamp with time zone
 );
 
 CREATE TABLE destination_credentials (
@@ -147,6 +182,25 @@ CREATE TABLE destination_credentials (
     bearer_token text
 );
 
+CREATE TABLE destination_logs (
+    id bigint NOT NULL,
+    organization_id bigint NOT NULL,
+    destination_id bigint NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    level text NOT NULL,
+    line text NOT NULL
+);
+
+CREATE TABLE destination_usage (
+    id bigint NOT NULL,
+    organization_id bigint NOT NULL,
+    destination_id bigint NOT NULL,
+    day timestamp with time zone NOT NULL,
+    logins bigint DEFAULT 0 NOT NULL,
+    distinct_users bigint DEFAULT 0 NOT NULL,
+    proxy_requests bigint DEFAULT 0 NOT NULL
+);
+
 CREATE TABLE destinations (
     id bigint NOT NULL,
     created_at timestamp with time zone,
@@ -161,7 +215,9 @@ CREATE TABLE destinations (
     resources text,
     roles text,
     organization_id bigint,
-    kind text DEFAULT 'kubernetes'::text NOT NULL
+    kind text DEFAULT 'kubernetes'::text NOT NULL,
+    update_index bigint,
+    metrics text
 );
 
 CREATE TABLE device_flow_auth_requests (
@@ -173,7 +229,9 @@ CREATE TABLE device_flow_auth_requests (
     updated_at timestamp with time zone,
     deleted_at timestamp with time zone,
     user_id bigint,
-    provider_id bigint
+    provider_id bigint,
+    denied boolean DEFAULT false NOT NULL,
+    last_polled_at timestamp with time zone
 );
 
 CREATE TABLE encryption_keys (
@@ -198,7 +256,8 @@ CREATE TABLE grants (
     resource text,
     created_by bigint,
     organization_id bigint,
-    update_index bigint
+    update_index bigint,
+    subject_id bigint DEFAULT 0 NOT NULL
 );
 
 CREATE TABLE groups (
@@ -212,6 +271,16 @@ CREATE TABLE groups (
     organization_id bigint
 );
 
+CREATE TABLE idempotency_keys (
+    id bigint NOT NULL,
+    organization_id bigint NOT NULL,
+    idempotency_key text NOT NULL,
+    request_hash text NOT NULL,
+    status_code integer NOT NULL,
+    response_body text NOT NULL,
+    created_at timestamp with time zone NOT NULL
+);
+
 CREATE TABLE identities (
     id bigint NOT NULL,
     created_at timestamp with time zone,
@@ -231,6 +300,43 @@ CREATE TABLE identities_groups (
     group_id bigint NOT NULL
 );
 
+CREATE TABLE impersonation_approvals (
+    id bigint NOT NULL,
+    organization_id bigint NOT NULL,
+    created_at timestamp with time zone,
+    identity_id bigint NOT NULL,
+    impersonator_id bigint NOT NULL,
+    approved_by bigint NOT NULL,
+    expires_at timestamp with time zone NOT NULL
+);
+
+CREATE TABLE issued_tokens (
+    id bigint NOT NULL,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    organization_id bigint NOT NULL,
+    identity_id bigint NOT NULL,
+    destination_name text DEFAULT ''::text NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    revoked_at timestamp with time zone,
+    update_index bigint DEFAULT 0 NOT NULL
+);
+
+CREATE TABLE org_settings (
+    organization_id bigint NOT NULL,
+    updated_at timestamp with time zone,
+    access_key_ttl bigint DEFAULT 0 NOT NULL,
+    session_inactivity_timeout bigint DEFAULT 0 NOT NULL,
+    public_key_algorithms text DEFAULT ''::text NOT NULL,
+    rate_limit integer DEFAULT 0 NOT NULL,
+    connector_rate_limit integer DEFAULT 0 NOT NULL,
+    allowed_signup_domains text DEFAULT ''::text NOT NULL,
+    max_access_key_ttl bigint DEFAULT 0 NOT NULL,
+    require_mfa boolean DEFAULT false NOT NULL,
+    audit_event_retention bigint DEFAULT 0 NOT NULL
+);
+
 CREATE TABLE organizations (
     id bigint NOT NULL,
     created_at timestamp with time zone,
@@ -239,7 +345,9 @@ CREATE TABLE organizations (
     name text,
     created_by bigint,
     domain text,
-    allowed_domains text DEFAULT ''::text
+    allowed_domains text DEFAULT ''::text,
+    domain_alias text DEFAULT ''::text NOT NULL,
+    domain_alias_expires_at timestamp with time zone
 );
 
 CREATE TABLE password_reset_tokens (
@@ -306,6 +414,19 @@ CREATE TABLE settings (
     organization_id bigint
 );
 
+CREATE TABLE user_mfa (
+    id bigint NOT NULL,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    organization_id bigint NOT NULL,
+    identity_id bigint NOT NULL,
+    totp_secret text NOT NULL,
+    confirmed boolean DEFAULT false NOT NULL,
+    last_used_step bigint DEFAULT 0 NOT NULL,
+    recovery_codes text DEFAULT ''::text NOT NULL
+);
+
 CREATE TABLE user_public_keys (
     id bigint NOT NULL,
     user_id bigint NOT NULL,
@@ -319,12 +440,48 @@ CREATE TABLE user_public_keys (
     deleted_at timestamp with time zone
 );
 
+CREATE TABLE webhook_deliveries (
+    id bigint NOT NULL,
+    organization_id bigint NOT NULL,
+    webhook_id bigint NOT NULL,
+    event_type text NOT NULL,
+    payload text NOT NULL,
+    status text NOT NULL,
+    attempts integer DEFAULT 0 NOT NULL,
+    next_attempt_at timestamp with time zone,
+    last_attempt_at timestamp with time zone,
+    response_status integer DEFAULT 0 NOT NULL,
+    last_error text DEFAULT ''::text NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    updated_at timestamp with time zone NOT NULL
+);
+
+CREATE TABLE webhooks (
+    id bigint NOT NULL,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    organization_id bigint NOT NULL,
+    url text NOT NULL,
+    secret text NOT NULL,
+    events text
+);
+
 ALTER TABLE ONLY access_keys
     ADD CONSTRAINT access_keys_pkey PRIMARY KEY (id);
 
+ALTER TABLE ONLY audit_events
+    ADD CONSTRAINT audit_events_pkey PRIMARY KEY (id);
+
 ALTER TABLE ONLY credentials
     ADD CONSTRAINT credentials_pkey PRIMARY KEY (id);
 
+ALTER TABLE ONLY destination_logs
+    ADD CONSTRAINT destination_logs_pkey PRIMARY KEY (id);
+
+ALTER TABLE ONLY destination_usage
+    ADD CONSTRAINT destination_usage_pkey PRIMARY KEY (id);
+
 ALTER TABLE ONLY destinations
     ADD CONSTRAINT destinations_pkey PRIMARY KEY (id);
 
@@ -337,12 +494,24 @@ ALTER TABLE ONLY grants
 ALTER TABLE ONLY groups
     ADD CONSTRAINT groups_pkey PRIMARY KEY (id);
 
+ALTER TABLE ONLY idempotency_keys
+    ADD CONSTRAINT idempotency_keys_pkey PRIMARY KEY (id);
+
 ALTER TABLE ONLY identities_groups
     ADD CONSTRAINT identities_groups_pkey PRIMARY KEY (identity_id, group_id);
 
 ALTER TABLE ONLY identities
     ADD CONSTRAINT identities_pkey PRIMARY KEY (id);
 
+ALTER TABLE ONLY impersonation_approvals
+    ADD CONSTRAINT impersonation_approvals_pkey PRIMARY KEY (id);
+
+ALTER TABLE ONLY issued_tokens
+    ADD CONSTRAINT issued_tokens_pkey PRIMARY KEY (id);
+
+ALTER TABLE ONLY org_settings
+    ADD CONSTRAINT org_settings_pkey PRIMARY KEY (organization_id);
+
 ALTER TABLE ONLY organizations
     ADD CONSTRAINT organizations_pkey PRIMARY KEY (id);
 
@@ -358,19 +527,36 @@ ALTER TABLE ONLY providers
 ALTER TABLE ONLY settings
     ADD CONSTRAINT settings_pkey PRIMARY KEY (id);
 
+ALTER TABLE ONLY user_mfa
+    ADD CONSTRAINT user_mfa_pkey PRIMARY KEY (id);
+
 ALTER TABLE ONLY user_public_keys
     ADD CONSTRAINT user_public_keys_pkey PRIMARY KEY (id);
 
+ALTER TABLE ONLY webhook_deliveries
+    ADD CONSTRAINT webhook_deliveries_pkey PRIMARY KEY (id);
+
+ALTER TABLE ONLY webhooks
+    ADD CONSTRAINT webhooks_pkey PRIMARY KEY (id);
+
 CREATE INDEX idx_access_keys_expires_at ON access_keys USING btree (expires_at);
 
 CREATE UNIQUE INDEX idx_access_keys_issued_for_name ON access_keys USING btree (organization_id, issued_for, name) WHERE (deleted_at IS NULL);
 
 CREATE UNIQUE INDEX idx_access_keys_key_id ON access_keys USING btree (key_id) WHERE (deleted_at IS NULL);
 
+CREATE INDEX idx_audit_events_action_created_at ON audit_events USING btree (action, created_at);
+
+CREATE INDEX idx_audit_events_org_created_at ON audit_events USING btree (organization_id, created_at);
+
 CREATE INDEX idx_cred_req_org_dest ON destination_credentials USING btree (organization_id, destination_id);
 
 CREATE UNIQUE INDEX idx_credentials_identity_id ON credentials USING btree (organization_id, identity_id) WHERE (deleted_at IS NULL);
 
+CREATE INDEX idx_destination_logs_org_dest_created_at ON destination_logs USING btree (organization_id, destination_id, created_at);
+
+CREATE UNIQUE INDEX idx_destination_usage_org_dest_day ON destination_usage USING btree (organization_id, destination_id, day);
+
 CREATE UNIQUE INDEX idx_destinations_name ON destinations USING btree (organization_id, name) WHERE (deleted_at IS NULL);
 
 CREATE UNIQUE INDEX idx_destinations_unique_id ON destinations USING btree (organization_id, unique_id) WHERE (deleted_at IS NULL);
@@ -385,14 +571,26 @@ CREATE UNIQUE INDEX idx_encryption_keys_key_id ON encryption_keys USING btree (k
 
 CREATE UNIQUE INDEX idx_grant_srp ON grants USING btree (organization_id, subject, privilege, resource) WHERE (deleted_at IS NULL);
 
+CREATE INDEX idx_grants_resource ON grants USING btree (organization_id, resource text_pattern_ops) WHERE (deleted_at IS NULL);
+
+CREATE INDEX idx_grants_subject_id ON grants USING btree (organization_id, subject_id) WHERE (deleted_at IS NULL);
+
 CREATE INDEX idx_grants_update_index ON grants USING btree (organization_id, update_index);
 
 CREATE UNIQUE INDEX idx_groups_name ON groups USING btree (organization_id, name) WHERE (deleted_at IS NULL);
 
+CREATE INDEX idx_idempotency_keys_created_at ON idempotency_keys USING btree (created_at);
+
+CREATE UNIQUE INDEX idx_idempotency_keys_key ON idempotency_keys USING btree (organization_id, idempotency_key);
+
 CREATE UNIQUE INDEX idx_identities_name ON identities USING btree (organization_id, name) WHERE (deleted_at IS NULL);
 
 CREATE UNIQUE INDEX idx_identities_verified ON identities USING btree (organization_id, verification_token) WHERE (deleted_at IS NULL);
 
+CREATE INDEX idx_impersonation_approvals_expires_at ON impersonation_approvals USING btree (expires_at);
+
+CREATE INDEX idx_issued_tokens_identity_id ON issued_tokens USING btree (organization_id, identity_id);
+
 CREATE UNIQUE INDEX idx_organizations_domain ON organizations USING btree (domain) WHERE (deleted_at IS NULL);
 
 CREATE INDEX idx_password_reset_tokens_expires_at ON password_reset_tokens USING btree (expires_at);
@@ -401,10 +599,18 @@ CREATE UNIQUE INDEX idx_password_reset_tokens_token ON password_reset_tokens USI
 
 CREATE UNIQUE INDEX idx_providers_name ON providers USING btree (organization_id, name) WHERE (deleted_at IS NULL);
 
+CREATE UNIQUE INDEX idx_user_mfa_identity_id ON user_mfa USING btree (organization_id, identity_id);
+
 CREATE UNIQUE INDEX idx_user_public_keys_user_fingerprint ON user_public_keys USING btree (fingerprint) WHERE (deleted_at IS NULL);
 
 CREATE UNIQUE INDEX idx_user_ssh_login_name ON identities USING btree (organization_id, ssh_login_name) WHERE (deleted_at IS NULL);
 
+CREATE INDEX idx_webhook_deliveries_created_at ON webhook_deliveries USING btree (created_at);
+
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries USING btree (next_attempt_at) WHERE (status = 'pending'::text);
+
+CREATE INDEX idx_webhook_deliveries_webhook ON webhook_deliveries USING btree (organization_id, webhook_id, created_at);
+
 CREATE UNIQUE INDEX settings_org_id ON settings USING btree (organization_id) WHERE (deleted_at IS NULL);
 
 CREATE TRIGGER credreq_notify_insert_trigger AFTER INSERT ON destination_credentials FOR EACH ROW EXECUTE FUNCTION destination_credential_insert_notify();
@@ -412,3 +618,5 @@ CREATE TRIGGER credreq_notify_insert_trigger AFTER INSERT ON destination_credent
 CREATE TRIGGER credreq_notify_update_trigger AFTER UPDATE ON destination_credentials FOR EACH ROW EXECUTE FUNCTION destination_credential_update_notify();
 
 CREATE TRIGGER grants_notify_trigger AFTER INSERT OR UPDATE ON grants FOR EACH ROW EXECUTE FUNCTION grants_notify();
+
+CREATE TRIGGER issued_tokens_notify_trigger AFTER UPDATE OF revoked_at ON issued_tokens FOR EACH ROW EXECUTE FUNCTION issued_tokens_notify();
@@ -0,0 +1,478 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/server/data/migrator"
+)
+
+func init() {
+	// infra_error is used to return an error from QueryRow when a query can
+	// not be rewritten, because sql.Row can only be created by the sql package.
+	sqlite.MustRegisterScalarFunction("infra_error", 1,
+		func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			return nil, fmt.Errorf("%v", args[0])
+		})
+}
+
+// sqliteDSN returns the data source name used to open the SQLite database
+// in the file at path.
+func sqliteDSN(path string) string {
+	params := url.Values{}
+	params.Add("_pragma", "busy_timeout(10000)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	// store times in a format that is parsed back into a time.Time
+	params.Set("_time_format", "sqlite")
+	// SQLite allows a single writer, starting every transaction as a writer
+	// avoids a deadlock when two transactions try to upgrade to a writer.
+	params.Set("_txlock", "immediate")
+	return "file:" + path + "?" + params.Encode()
+}
+
+// sqliteDialect rewrites queries written for Postgres so that they can be run
+// by SQLite.
+type sqliteDialect struct{}
+
+var (
+	nextvalPattern   = regexp.MustCompile(`nextval\('(\w+)'\)`)
+	ilikePattern     = regexp.MustCompile(`\bILIKE\b`)
+	forUpdatePattern = regexp.MustCompile(`\bFOR UPDATE\b`)
+	offsetPattern    = regexp.MustCompile(`\bOFFSET\b`)
+	limitPattern     = regexp.MustCompile(`\bLIMIT\b`)
+	updatePattern    = regexp.MustCompile(`^\s*UPDATE (\w+)\s`)
+	wherePattern     = regexp.MustCompile(`\bWHERE\b`)
+	returningPattern = regexp.MustCompile(`\bRETURNING\b`)
+	savepointPattern = regexp.MustCompile(`^\s*(SAVEPOINT|RELEASE SAVEPOINT|ROLLBACK TO SAVEPOINT)\b`)
+)
+
+// rewriteQuery rewrites query for SQLite. SQLite accepts ? placeholders, and
+// binding numbered placeholders is slow for queries with many arguments, so
+// the placeholders are only numbered when the query requires it.
+func (sqliteDialect) rewriteQuery(ctx context.Context, conn sqlConn, query string, args []any) (string, error) {
+	if _, inTxn := conn.(*sql.Tx); !inTxn && savepointPattern.MatchString(query) {
+		// SQLite starts a transaction for a SAVEPOINT outside of a transaction,
+		// which would leave the pooled connection in a transaction.
+		return "", errNoActiveTransaction
+	}
+
+	query = ilikePattern.ReplaceAllString(query, "LIKE")
+	// SQLite does not lock rows. A transaction that writes after another
+	// transaction committed fails with SQLITE_BUSY, so an update is not lost.
+	query = forUpdatePattern.ReplaceAllString(query, "")
+	// SQLite only accepts an OFFSET after a LIMIT
+	if offsetPattern.MatchString(query) && !limitPattern.MatchString(query) {
+		query = offsetPattern.ReplaceAllString(query, "LIMIT -1 OFFSET")
+	}
+
+	if !nextvalPattern.MatchString(query) {
+		return query, nil
+	}
+	if match := updatePattern.FindStringSubmatch(query); match != nil {
+		// the WHERE clause is repeated, so the placeholders must be numbered
+		query = rewriteQueryPlaceholders(query, len(args))
+		return rewriteNextvalForUpdate(ctx, conn, query, args, match[1])
+	}
+
+	// Sequences are emulated with the counters table. The values for every
+	// nextval in the query are allocated by a single update, and included in
+	// the query as literals.
+	counts := map[string]int64{}
+	for _, match := range nextvalPattern.FindAllStringSubmatch(query, -1) {
+		counts[match[1]]++
+	}
+	next := map[string]int64{}
+	for name, count := range counts {
+		last, err := allocateCounter(ctx, conn, name, count)
+		if err != nil {
+			return "", err
+		}
+		next[name] = last - count + 1
+	}
+
+	query = nextvalPattern.ReplaceAllStringFunc(query, func(match string) string {
+		name := nextvalPattern.FindStringSubmatch(match)[1]
+		value := next[name]
+		next[name]++
+		return strconv.FormatInt(value, 10)
+	})
+	return query, nil
+}
+
+// rewriteNextvalForUpdate replaces nextval in an UPDATE of table. Postgres
+// calls nextval once for every row that is updated, so a value is allocated
+// for every row that matches the WHERE clause, and each row uses the value at
+// its position in the matching rows.
+func rewriteNextvalForUpdate(ctx context.Context, conn sqlConn, query string, args []any, table string) (string, error) {
+	loc := wherePattern.FindStringIndex(query)
+	if loc == nil || nextvalPattern.MatchString(query[loc[0]:]) {
+		return "", fmt.Errorf("nextval is only supported in the SET clause of an UPDATE with a WHERE clause")
+	}
+	where := query[loc[1]:]
+	if loc := returningPattern.FindStringIndex(where); loc != nil {
+		where = where[:loc[0]]
+	}
+	where = strings.TrimSuffix(strings.TrimSpace(where), ";")
+
+	// table is matched by \w+, so it is safe to include in
+	// the statement.
+	var count int64
+	stmt := `SELECT count(*) FROM ` + table + ` WHERE ` + where
+	if err := conn.QueryRowContext(ctx, stmt, args...).Scan(&count); err != nil {
+		return "", fmt.Errorf("count rows to update: %w", err)
+	}
+
+	var err error
+	query = nextvalPattern.ReplaceAllStringFunc(query, func(match string) string {
+		if err != nil {
+			return match
+		}
+		var last int64
+		last, err = allocateCounter(ctx, conn, nextvalPattern.FindStringSubmatch(match)[1], count)
+		// The matching rows are selected once, before any of them are updated.
+		return fmt.Sprintf(`(%d + (SELECT count(*) FROM %[2]v AS seq_rows
+			WHERE seq_rows.rowid < %[2]v.rowid
+			AND seq_rows.rowid IN (SELECT rowid FROM %[2]v WHERE %[3]v)))`,
+			last-count+1, table, where)
+	})
+	return query, err
+}
+
+// allocateCounter increments the counter by count, and returns the new value.
+func allocateCounter(ctx context.Context, conn sqlConn, name string, count int64) (int64, error) {
+	stmt := `UPDATE counters SET value = value + $1 WHERE name = $2 RETURNING value`
+	var value int64
+	if err := conn.QueryRowContext(ctx, stmt, count, name).Scan(&value); err != nil {
+		return 0, fmt.Errorf("next value of %v: %w", name, err)
+	}
+	return value, nil
+}
+
+// sqliteQueryRowError returns a sql.Row that returns err from Scan.
+func sqliteQueryRowError(ctx context.Context, conn sqlConn, err error) *sql.Row {
+	return conn.QueryRowContext(ctx, `SELECT infra_error($1)`, err.Error())
+}
+
+// sqliteSchema is the schema from schema.sql translated to SQLite by
+// translateSchemaToSQLite. uniqueIndexes maps the columns of each unique
+// index, as they appear in a SQLite constraint error, to the name of the
+// index.
+var sqliteSchema = struct {
+	once          sync.Once
+	stmts         []string
+	uniqueIndexes map[string]string
+	err           error
+}{}
+
+func loadSQLiteSchema() ([]string, map[string]string, error) {
+	sqliteSchema.once.Do(func() {
+		sqliteSchema.stmts, sqliteSchema.err = translateSchemaToSQLite(schemaSQL)
+		if sqliteSchema.err == nil {
+			sqliteSchema.uniqueIndexes = sqliteUniqueIndexes(sqliteSchema.stmts)
+		}
+	})
+	return sqliteSchema.stmts, sqliteSchema.uniqueIndexes, sqliteSchema.err
+}
+
+var (
+	sequencePattern   = regexp.MustCompile(`^CREATE SEQUENCE (\w+)\s+START WITH (\d+)\s+INCREMENT BY 1\s`)
+	primaryKeyPattern = regexp.MustCompile(`^ALTER TABLE ONLY (\w+)\s+ADD CONSTRAINT (\w+) PRIMARY KEY (\([\w, ]+\));$`)
+	randomDefault     = regexp.MustCompile(`DEFAULT .*random\(\).*?( NOT NULL)?(,?)$`)
+	uniqueIndex       = regexp.MustCompile(`^CREATE UNIQUE INDEX (\w+) ON (\w+) \(([\w, ]+)\)`)
+)
+
+// translateSchemaToSQLite translates the statements in schema, which is
+// generated by pg_dump, into statements that create the same tables and
+// indexes in SQLite. Functions and triggers are omitted, sequences are
+// replaced by rows in the counters table, and primary keys by unique indexes.
+func translateSchemaToSQLite(schema string) ([]string, error) {
+	stmts := []string{
+		`CREATE TABLE migrations (id text PRIMARY KEY, applied_at timestamp, version text);`,
+		`CREATE TABLE counters (name text PRIMARY KEY, value bigint NOT NULL);`,
+	}
+	var indexes []string
+
+	for _, stmt := range splitSchemaStatements(schema) {
+		switch {
+		case strings.HasPrefix(stmt, "CREATE FUNCTION "), strings.HasPrefix(stmt, "CREATE TRIGGER "):
+			continue
+
+		case strings.HasPrefix(stmt, "CREATE SEQUENCE "):
+			match := sequencePattern.FindStringSubmatch(stmt)
+			if match == nil {
+				return nil, fmt.Errorf("unsupported sequence: %v", stmt)
+			}
+			start, err := strconv.ParseInt(match[2], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("sequence %v: %w", match[1], err)
+			}
+			stmts = append(stmts, fmt.Sprintf(
+				"INSERT INTO counters (name, value) VALUES ('%v', %d);", match[1], start-1))
+
+		case strings.HasPrefix(stmt, "ALTER TABLE ONLY "):
+			match := primaryKeyPattern.FindStringSubmatch(stmt)
+			if match == nil {
+				return nil, fmt.Errorf("unsupported alter table: %v", stmt)
+			}
+			indexes = append(indexes, fmt.Sprintf("CREATE UNIQUE INDEX %v ON %v %v;", match[2], match[1], match[3]))
+
+		case strings.HasPrefix(stmt, "CREATE TABLE "):
+			lines := strings.Split(stmt, "\n")
+			for i, line := range lines {
+				line = randomDefault.ReplaceAllString(line, "DEFAULT (lower(hex(randomblob(5))))$1$2")
+				line = strings.ReplaceAll(line, "::text", "")
+				line = strings.ReplaceAll(line, " timestamp with time zone", " timestamp")
+				line = strings.ReplaceAll(line, " bytea", " blob")
+				lines[i] = line
+			}
+			stmts = append(stmts, strings.Join(lines, "\n"))
+
+		case strings.HasPrefix(stmt, "CREATE INDEX "), strings.HasPrefix(stmt, "CREATE UNIQUE INDEX "):
+			// SQLite has no operator classes or casts
+			stmt = strings.ReplaceAll(stmt, " USING btree", "")
+			stmt = strings.ReplaceAll(stmt, "::text", "")
+			indexes = append(indexes, strings.ReplaceAll(stmt, " text_pattern_ops", ""))
+
+		default:
+			return nil, fmt.Errorf("unsupported statement: %v", stmt)
+		}
+	}
+
+	// Postgres checks unique indexes in the order they were created, and
+	// SQLite checks the most recently created first. Create the indexes in
+	// reverse order so that a row that conflicts with more than one index is
+	// reported as a conflict with the same index by both.
+	for i := len(indexes) - 1; i >= 0; i-- {
+		stmts = append(stmts, indexes[i])
+	}
+	return stmts, nil
+}
+
+// splitSchemaStatements splits schema into statements, excluding comments.
+// Function bodies are quoted with $$ and may contain semicolons, so they end
+// at the first line ending with $$;
+func splitSchemaStatements(schema string) []string {
+	var stmts []string
+	var current []string
+	for _, line := range strings.Split(schema, "\n") {
+		if len(current) == 0 && (strings.TrimSpace(line) == "" || strings.HasPrefix(line, "--")) {
+			continue
+		}
+		current = append(current, line)
+
+		end := ";"
+		if strings.HasPrefix(current[0], "CREATE FUNCTION ") {
+			end = "$$;"
+		}
+		if strings.HasSuffix(strings.TrimSpace(line), end) {
+			stmts = append(stmts, strings.Join(current, "\n"))
+			current = nil
+		}
+	}
+	return stmts
+}
+
+func sqliteUniqueIndexes(stmts []string) map[string]string {
+	result := map[string]string{}
+	for _, stmt := range stmts {
+		match := uniqueIndex.FindStringSubmatch(stmt)
+		if match == nil {
+			continue
+		}
+		name, table := match[1], match[2]
+		var columns []string
+		for _, column := range strings.Split(match[3], ",") {
+			columns = append(columns, table+"."+strings.TrimSpace(column))
+		}
+		result[strings.Join(columns, ", ")] = name
+	}
+	return result
+}
+
+// sqliteUniqueConstraintError translates a unique constraint error from SQLite
+// into the same UniqueConstraintError that is returned for Postgres.
+func sqliteUniqueConstraintError(err error) (UniqueConstraintError, bool) {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return UniqueConstraintError{}, false
+	}
+	switch sqliteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+	default:
+		return UniqueConstraintError{}, false
+	}
+
+	// the message is formatted as one of:
+	// constraint failed: UNIQUE constraint failed: <table>.<column>, <table>.<column> (<code>)
+	// constraint failed: UNIQUE constraint failed: index '<name>' (<code>)
+	msg := sqliteErr.Error()
+	if i := strings.Index(msg, "UNIQUE constraint failed: "); i >= 0 {
+		msg = msg[i+len("UNIQUE constraint failed: "):]
+	}
+	msg = strings.TrimSuffix(msg, fmt.Sprintf(" (%d)", sqliteErr.Code()))
+
+	name := strings.TrimSuffix(strings.TrimPrefix(msg, "index '"), "'")
+	if name == msg {
+		_, indexes, _ := loadSQLiteSchema()
+		name = indexes[msg]
+	}
+	if ucErr, ok := uniqueConstraints[name]; ok {
+		return ucErr, true
+	}
+	table, _, _ := strings.Cut(msg, ".")
+	return UniqueConstraintError{Table: table}, true
+}
+
+// initializeSQLite creates the schema when the database is empty. SQLite
+// databases are created with the current schema, and are never migrated.
+func initializeSQLite(tx *Transaction, loadKey func(migrator.DB) error) error {
+	var count int
+	err := tx.QueryRow(`SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'migrations'`).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		stmts, _, err := loadSQLiteSchema()
+		if err != nil {
+			return fmt.Errorf("translate schema: %w", err)
+		}
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(stmt); err != nil {
+				return fmt.Errorf("failed to exec sql: %w", err)
+			}
+		}
+
+		now := time.Now().UTC()
+		ids := []string{migrator.InitSchemaMigrationID}
+		for _, m := range migrations() {
+			ids = append(ids, m.ID)
+		}
+		for _, id := range ids {
+			stmt := `INSERT INTO migrations (id, applied_at, version) VALUES (?, ?, ?)`
+			if _, err := tx.Exec(stmt, id, now, internal.FullVersion()); err != nil {
+				return err
+			}
+		}
+		return loadKey(tx)
+	}
+
+	status, err := sqliteMigrationStatus(tx)
+	if err != nil {
+		return err
+	}
+	for _, m := range status {
+		if m.Pending {
+			return fmt.Errorf("the sqlite database was created by an older version of infra, " +
+				"and can not be migrated; create a new database, or use postgres")
+		}
+	}
+	return loadKey(tx)
+}
+
+// sqliteMigrationStatus returns the status of every migration, like
+// migrator.Migrator.Status does for Postgres.
+func sqliteMigrationStatus(tx migrator.DB) ([]migrator.MigrationStatus, error) {
+	applied := map[string]migrator.MigrationStatus{}
+	var count int
+	err := tx.QueryRow(`SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'migrations'`).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		rows, err := tx.Query(`SELECT id, applied_at, version FROM migrations`)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var status migrator.MigrationStatus
+			var appliedAt sql.NullTime
+			if err := rows.Scan(&status.ID, &appliedAt, &status.Version); err != nil {
+				return nil, err
+			}
+			status.AppliedAt = appliedAt.Time
+			applied[status.ID] = status
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	all := []*migrator.Migration{{ID: migrator.InitSchemaMigrationID, Description: "initialize the schema"}}
+	all = append(all, migrations()...)
+	result := make([]migrator.MigrationStatus, 0, len(all))
+	for _, m := range all {
+		status, ok := applied[m.ID]
+		if !ok {
+			// an empty database is created with all the migrations applied
+			status = migrator.MigrationStatus{ID: m.ID, Pending: len(applied) > 0 || m.ID == migrator.InitSchemaMigrationID}
+		}
+		status.Description = m.Describe()
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+// newSQLiteDB opens the SQLite database file, and creates the schema when the
+// database is new.
+func newSQLiteDB(dbOpts NewDBOptions) (*DB, error) {
+	if dbOpts.ReplicaDSN != "" {
+		return nil, fmt.Errorf("a read replica is not supported by the sqlite driver")
+	}
+
+	db, err := newRawDB(dbOpts)
+	if err != nil {
+		return nil, fmt.Errorf("db conn: %w", err)
+	}
+	dataDB := &DB{
+		DB:              db,
+		enforceOrgScope: dbOpts.EnforceOrgScope,
+		slowQueries:     newSlowQueryTracker(dbOpts.SlowQueryThreshold),
+		dialect:         sqliteDialect{},
+		cache:           newReadCache(defaultReadCacheTTL),
+
+		legacyGroupGrantLookup: dbOpts.LegacyGroupGrantLookup,
+	}
+
+	tx, err := dataDB.Begin(context.TODO(), nil)
+	if err != nil {
+		return nil, err
+	}
+	loadKey := func(tx migrator.DB) error {
+		if dbOpts.EncryptionKeyProvider == nil {
+			return nil
+		}
+		return loadDBKey(tx, dbOpts.EncryptionKeyProvider, dbOpts.RootKeyID)
+	}
+	if err := initializeSQLite(tx, loadKey); err != nil {
+		if err := tx.Rollback(); err != nil {
+			logging.L.Warn().Err(err).Msg("failed to rollback")
+		}
+		return nil, fmt.Errorf("initialize schema: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit schema: %w", err)
+	}
+
+	if err := initialize(dataDB); err != nil {
+		return nil, fmt.Errorf("initialize database: %w", err)
+	}
+	// SQLite does not support a statement timeout, so StatementTimeout is
+	// ignored.
+	return dataDB, nil
+}
@@ -0,0 +1,192 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/server/data/migrator"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/internal/testing/patch"
+)
+
+func TestTranslateSchemaToSQLite(t *testing.T) {
+	stmts, err := translateSchemaToSQLite(schemaSQL)
+	assert.NilError(t, err)
+
+	all := strings.Join(stmts, "\n")
+	for _, unsupported := range []string{"CREATE FUNCTION", "CREATE TRIGGER", "CREATE SEQUENCE",
+		"ALTER TABLE", "timestamp with time zone", "bytea", "::text", "USING btree", "text_pattern_ops", "random()"} {
+		assert.Assert(t, !strings.Contains(all, unsupported), unsupported)
+	}
+	assert.Assert(t, strings.Contains(all,
+		"INSERT INTO counters (name, value) VALUES ('seq_update_index', 9999);"))
+	assert.Assert(t, strings.Contains(all,
+		"CREATE UNIQUE INDEX access_keys_pkey ON access_keys (id);"))
+
+	// every statement is valid sqlite
+	db, err := newRawDB(NewDBOptions{Driver: DriverSQLite, DSN: filepath.Join(t.TempDir(), "infra.db")})
+	assert.NilError(t, err)
+	defer db.Close()
+	for _, stmt := range stmts {
+		_, err := db.Exec(stmt)
+		assert.NilError(t, err, stmt)
+	}
+}
+
+func TestTranslateSchemaToSQLite_UnsupportedStatement(t *testing.T) {
+	_, err := translateSchemaToSQLite(`CREATE VIEW example AS SELECT 1;`)
+	assert.ErrorContains(t, err, "unsupported statement: CREATE VIEW")
+}
+
+func setupSQLiteUnitDB(t *testing.T) *DB {
+	t.Helper()
+	patch.ModelsSymmetricKey(t)
+	db, err := NewDB(NewDBOptions{Driver: DriverSQLite, DSN: filepath.Join(t.TempDir(), "infra.db")})
+	assert.NilError(t, err)
+	t.Cleanup(func() {
+		assert.NilError(t, db.Close())
+	})
+	return db
+}
+
+func TestSQLiteDialect_RewriteQuery(t *testing.T) {
+	db := setupSQLiteUnitDB(t)
+	ctx := context.Background()
+
+	tx, err := db.DB.BeginTx(ctx, nil)
+	assert.NilError(t, err)
+	defer tx.Rollback()
+
+	var start int64
+	err = tx.QueryRow(`SELECT value FROM counters WHERE name = 'seq_update_index'`).Scan(&start)
+	assert.NilError(t, err)
+
+	type testCase struct {
+		name     string
+		query    string
+		args     []any
+		expected string
+	}
+	run := func(t *testing.T, tc testCase) {
+		actual, err := sqliteDialect{}.rewriteQuery(ctx, tx, tc.query, tc.args)
+		assert.NilError(t, err)
+		assert.Equal(t, actual, tc.expected)
+	}
+
+	testCases := []testCase{
+		{
+			name:     "no changes",
+			query:    "SELECT id FROM grants WHERE resource = ?",
+			expected: "SELECT id FROM grants WHERE resource = ?",
+		},
+		{
+			name:     "ilike",
+			query:    "SELECT id FROM identities WHERE name ILIKE ?",
+			expected: "SELECT id FROM identities WHERE name LIKE ?",
+		},
+		{
+			name:     "for update",
+			query:    "SELECT id FROM destinations WHERE id = ? FOR UPDATE",
+			expected: "SELECT id FROM destinations WHERE id = ? ",
+		},
+		{
+			name:     "offset without limit",
+			query:    "SELECT id FROM identities OFFSET 10",
+			expected: "SELECT id FROM identities LIMIT -1 OFFSET 10",
+		},
+		{
+			name:     "offset with limit",
+			query:    "SELECT id FROM identities LIMIT 5 OFFSET 10",
+			expected: "SELECT id FROM identities LIMIT 5 OFFSET 10",
+		},
+		{
+			name:     "nextval in insert",
+			query:    "INSERT INTO grants (id, update_index) VALUES (?, nextval('seq_update_index')), (?, nextval('seq_update_index'))",
+			expected: fmt.Sprintf("INSERT INTO grants (id, update_index) VALUES (?, %d), (?, %d)", start+1, start+2),
+		},
+		{
+			name:  "nextval in update",
+			query: "UPDATE grants SET update_index = nextval('seq_update_index') WHERE id = ?",
+			args:  []any{1},
+			expected: fmt.Sprintf(`UPDATE grants SET update_index = (%d + (SELECT count(*) FROM grants AS seq_rows
+			WHERE seq_rows.rowid < grants.rowid
+			AND seq_rows.rowid IN (SELECT rowid FROM grants WHERE id = $1))) WHERE id = $1`, start+3),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
+
+func TestSQLiteDialect_SavepointOutsideTransaction(t *testing.T) {
+	db := setupSQLiteUnitDB(t)
+
+	_, err := db.Exec("SAVEPOINT example")
+	assert.Assert(t, isNoActiveTransaction(err), err)
+}
+
+func TestSQLite_UniqueConstraintError(t *testing.T) {
+	db := setupSQLiteUnitDB(t)
+
+	everyone := &models.Group{Name: "everyone"}
+	err := CreateGroup(db, everyone)
+	assert.NilError(t, err)
+
+	err = CreateGroup(db, &models.Group{Name: "everyone"})
+	assert.Error(t, err, "a group with that name already exists")
+
+	err = CreateGroup(db, &models.Group{Model: models.Model{ID: everyone.ID}, Name: "other"})
+	var ucErr UniqueConstraintError
+	assert.Assert(t, errors.As(err, &ucErr), err)
+	assert.Equal(t, ucErr.Table, "groups")
+}
+
+func TestSQLite_ListenForNotifyPolls(t *testing.T) {
+	db := setupSQLiteUnitDB(t)
+
+	listener, err := ListenForNotify(context.Background(), db, ListenForNotifyOptions{
+		OrgID:               db.DefaultOrg.ID,
+		GrantsByDestination: "example",
+	})
+	assert.NilError(t, err)
+	listener.pollInterval = 10 * time.Millisecond
+
+	assert.NilError(t, listener.WaitForNotification(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = listener.WaitForNotification(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NilError(t, listener.Release(context.Background()))
+}
+
+func TestSQLite_MigrationStatus(t *testing.T) {
+	db := setupSQLiteUnitDB(t)
+
+	tx, err := db.Begin(context.Background(), nil)
+	assert.NilError(t, err)
+	defer tx.Rollback()
+
+	status, err := MigrationStatus(tx)
+	assert.NilError(t, err)
+	assert.Equal(t, len(status), len(migrations())+1)
+	for _, m := range status {
+		assert.Assert(t, !m.Pending, m.ID)
+		assert.Assert(t, !m.AppliedAt.IsZero(), m.ID)
+	}
+
+	// a database created by an older version can not be migrated
+	_, err = tx.Exec(`DELETE FROM migrations WHERE id = ?`, migrations()[len(migrations())-1].ID)
+	assert.NilError(t, err)
+	err = initializeSQLite(tx, func(migrator.DB) error { return nil })
+	assert.ErrorContains(t, err, "can not be migrated")
+}
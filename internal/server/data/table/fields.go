@@ -0,0 +1,113 @@
+package table
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// Field is a struct field of a model, and the name of the table column that
+// stores it.
+type Field struct {
+	Name   string
+	Column string
+}
+
+// ColumnName returns the name of the column for a struct field. The name is
+// the value of the `db` struct tag when one is set, otherwise it is the field
+// name converted to snake case.
+func ColumnName(fieldName string, tag reflect.StructTag) string {
+	if name, _, _ := strings.Cut(tag.Get("db"), ","); name != "" {
+		return name
+	}
+	return snakeCase(fieldName)
+}
+
+// snakeCase converts a Go identifier to snake case. A run of upper case letters
+// is treated as a single word, so that OrganizationID becomes organization_id,
+// and SSHLoginName becomes ssh_login_name.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextIsLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// Model is a type that should have the Table, Columns, Values, and ScanFields
+// methods generated by GenerateFile.
+type Model struct {
+	// TypeName is the name of the type that receives the methods.
+	TypeName string
+	// Table is the name of the database table.
+	Table  string
+	Fields []Field
+}
+
+// Receiver returns the name of the receiver of the generated methods.
+func (m Model) Receiver() string {
+	return strings.ToLower(m.TypeName[:1])
+}
+
+// GenerateFile returns the formatted source of a file in package pkgName that
+// contains the methods of every model. The Columns, Values, and ScanFields
+// methods are all generated from the same list of fields, sorted by column
+// name, so the three lists always match.
+func GenerateFile(pkgName string, models []Model) ([]byte, error) {
+	for _, m := range models {
+		fields := m.Fields
+		sort.Slice(fields, func(i, j int) bool {
+			return fields[i].Column < fields[j].Column
+		})
+		for i := 1; i < len(fields); i++ {
+			if fields[i].Column == fields[i-1].Column {
+				return nil, fmt.Errorf("%v: fields %v and %v both use column %v",
+					m.TypeName, fields[i-1].Name, fields[i].Name, fields[i].Column)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	err := fileTemplate.Execute(&buf, struct {
+		Package string
+		Models  []Model
+	}{Package: pkgName, Models: models})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+var fileTemplate = template.Must(template.New("file").Parse(`// Code generated by gentable. DO NOT EDIT.
+
+package {{ .Package }}
+{{ range .Models }}{{ $recv := .Receiver }}
+func ({{ $recv }} {{ .TypeName }}) Table() string {
+	return "{{ .Table }}"
+}
+
+func ({{ $recv }} {{ .TypeName }}) Columns() []string {
+	return []string{ {{- range $i, $f := .Fields }}{{ if $i }}, {{ end }}"{{ $f.Column }}"{{ end -}} }
+}
+
+func ({{ $recv }} {{ .TypeName }}) Values() []any {
+	return []any{ {{- range $i, $f := .Fields }}{{ if $i }}, {{ end }}{{ $recv }}.{{ $f.Name }}{{ end -}} }
+}
+
+func ({{ $recv }} *{{ .TypeName }}) ScanFields() []any {
+	return []any{ {{- range $i, $f := .Fields }}{{ if $i }}, {{ end }}&{{ $recv }}.{{ $f.Name }}{{ end -}} }
+}
+{{ end }}`))
@@ -0,0 +1,82 @@
+package table
+
+import (
+	"reflect"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestColumnName(t *testing.T) {
+	type testCase struct {
+		field    string
+		tag      reflect.StructTag
+		expected string
+	}
+	testCases := []testCase{
+		{field: "ID", expected: "id"},
+		{field: "Name", expected: "name"},
+		{field: "CreatedAt", expected: "created_at"},
+		{field: "OrganizationID", expected: "organization_id"},
+		{field: "KeyID", expected: "key_id"},
+		{field: "SSHLoginName", expected: "ssh_login_name"},
+		{field: "URL", expected: "url"},
+		{field: "Name", tag: `db:"display_name"`, expected: "display_name"},
+		{field: "Name", tag: `db:"display_name,omitempty"`, expected: "display_name"},
+		{field: "Name", tag: `json:"other"`, expected: "name"},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, ColumnName(tc.field, tc.tag), tc.expected, "field %v", tc.field)
+	}
+}
+
+func TestGenerateFile(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		models := []Model{{
+			TypeName: "petsTable",
+			Table:    "pets",
+			Fields: []Field{
+				{Name: "Species", Column: "species"},
+				{Name: "ID", Column: "id"},
+				{Name: "Name", Column: "name"},
+			},
+		}}
+		actual, err := GenerateFile("data", models)
+		assert.NilError(t, err)
+
+		expected := `// Code generated by gentable. DO NOT EDIT.
+
+package data
+
+func (p petsTable) Table() string {
+	return "pets"
+}
+
+func (p petsTable) Columns() []string {
+	return []string{"id", "name", "species"}
+}
+
+func (p petsTable) Values() []any {
+	return []any{p.ID, p.Name, p.Species}
+}
+
+func (p *petsTable) ScanFields() []any {
+	return []any{&p.ID, &p.Name, &p.Species}
+}
+`
+		assert.Equal(t, string(actual), expected)
+	})
+
+	t.Run("duplicate column", func(t *testing.T) {
+		models := []Model{{
+			TypeName: "petsTable",
+			Table:    "pets",
+			Fields: []Field{
+				{Name: "Name", Column: "name"},
+				{Name: "DisplayName", Column: "name"},
+			},
+		}}
+		_, err := GenerateFile("data", models)
+		assert.ErrorContains(t, err, "petsTable: fields Name and DisplayName both use column name")
+	})
+}
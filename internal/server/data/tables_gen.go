@@ -0,0 +1,51 @@
+// Code generated by gentable. DO NOT EDIT.
+
+package data
+
+func (g grantsTable) Table() string {
+	return "grants"
+}
+
+func (g grantsTable) Columns() []string {
+	return []string{"created_at", "created_by", "deleted_at", "id", "organization_id", "privilege", "resource", "subject", "subject_id", "updated_at"}
+}
+
+func (g grantsTable) Values() []any {
+	return []any{g.CreatedAt, g.CreatedBy, g.DeletedAt, g.ID, g.OrganizationID, g.Privilege, g.Resource, g.Subject, g.SubjectID, g.UpdatedAt}
+}
+
+func (g *grantsTable) ScanFields() []any {
+	return []any{&g.CreatedAt, &g.CreatedBy, &g.DeletedAt, &g.ID, &g.OrganizationID, &g.Privilege, &g.Resource, &g.Subject, &g.SubjectID, &g.UpdatedAt}
+}
+
+func (a accessKeyTable) Table() string {
+	return "access_keys"
+}
+
+func (a accessKeyTable) Columns() []string {
+	return []string{"created_at", "deleted_at", "expires_at", "id", "impersonated_by", "inactivity_extension", "inactivity_timeout", "issued_for", "key_id", "last_used_at", "last_used_ip", "last_used_user_agent", "name", "organization_id", "provider_id", "scopes", "secret_checksum", "updated_at"}
+}
+
+func (a accessKeyTable) Values() []any {
+	return []any{a.CreatedAt, a.DeletedAt, a.ExpiresAt, a.ID, a.ImpersonatedBy, a.InactivityExtension, a.InactivityTimeout, a.IssuedFor, a.KeyID, a.LastUsedAt, a.LastUsedIP, a.LastUsedUserAgent, a.Name, a.OrganizationID, a.ProviderID, a.Scopes, a.SecretChecksum, a.UpdatedAt}
+}
+
+func (a *accessKeyTable) ScanFields() []any {
+	return []any{&a.CreatedAt, &a.DeletedAt, &a.ExpiresAt, &a.ID, &a.ImpersonatedBy, &a.InactivityExtension, &a.InactivityTimeout, &a.IssuedFor, &a.KeyID, &a.LastUsedAt, &a.LastUsedIP, &a.LastUsedUserAgent, &a.Name, &a.OrganizationID, &a.ProviderID, &a.Scopes, &a.SecretChecksum, &a.UpdatedAt}
+}
+
+func (u userPublicKeysTable) Table() string {
+	return "user_public_keys"
+}
+
+func (u userPublicKeysTable) Columns() []string {
+	return []string{"created_at", "deleted_at", "expires_at", "fingerprint", "id", "key_type", "name", "public_key", "updated_at", "user_id"}
+}
+
+func (u userPublicKeysTable) Values() []any {
+	return []any{u.CreatedAt, u.DeletedAt, u.ExpiresAt, u.Fingerprint, u.ID, u.KeyType, u.Name, u.PublicKey, u.UpdatedAt, u.UserID}
+}
+
+func (u *userPublicKeysTable) ScanFields() []any {
+	return []any{&u.CreatedAt, &u.DeletedAt, &u.ExpiresAt, &u.Fingerprint, &u.ID, &u.KeyType, &u.Name, &u.PublicKey, &u.UpdatedAt, &u.UserID}
+}
@@ -3,8 +3,10 @@ package data
 import (
 	"flag"
 	"go/ast"
+	"go/parser"
 	"go/token"
 	"reflect"
+	"sort"
 	"testing"
 
 	"golang.org/x/tools/go/packages"
@@ -15,29 +17,92 @@ import (
 
 var tables = []tabler{
 	accessKeyTable{},
+	auditEventsTable{},
 	credentialsTable{},
+	destinationLogsTable{},
+	destinationUsageTable{},
 	destinationsTable{},
 	encryptionKeysTable{},
 	grantsTable{},
 	groupsTable{},
 	identitiesTable{},
+	idempotencyKeysTable{},
+	ImpersonationApproval{},
+	issuedTokensTable{},
+	orgSettingsTable{},
 	organizationsTable{},
 	passwordResetToken{},
 	providersTable{},
 	providerUserTable{},
 	settingsTable{},
+	userMFATable{},
 	userPublicKeysTable{},
+	webhookDeliveriesTable{},
+	webhooksTable{},
 }
 
 type tabler interface {
 	Table() string
 }
 
+// unmappedColumns are columns of tables that are not in the Columns of the
+// table type, because they are set by the database or read by custom queries.
+var unmappedColumns = map[string][]string{
+	"destinations":  {"metrics", "update_index"},
+	"grants":        {"update_index"},
+	"issued_tokens": {"update_index"},
+}
+
+// TestTableColumnsMatchDatabase checks that the Columns of every table type
+// exist in the database schema, and that every column in the database is either
+// in Columns or in unmappedColumns.
+func TestTableColumnsMatchDatabase(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		for _, tbl := range tables {
+			tbl, ok := tbl.(hasColumns)
+			if !ok {
+				continue
+			}
+			t.Run(tbl.Table(), func(t *testing.T) {
+				expected := append(tbl.Columns(), unmappedColumns[tbl.Table()]...)
+				sort.Strings(expected)
+				assert.DeepEqual(t, databaseColumns(t, db, tbl.Table()), expected)
+			})
+		}
+	})
+}
+
+type hasColumns interface {
+	Table() string
+	Columns() []string
+}
+
+// databaseColumns returns the sorted names of the columns of table, read from
+// the database schema.
+func databaseColumns(t *testing.T, db *DB, table string) []string {
+	t.Helper()
+	query := `SELECT column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = ?`
+	if db.dialect != nil {
+		query = `SELECT name FROM pragma_table_info(?)`
+	}
+
+	rows, err := db.Query(query, table)
+	assert.NilError(t, err)
+	columns, err := scanRows(rows, func(c *string) []any {
+		return []any{c}
+	})
+	assert.NilError(t, err)
+	sort.Strings(columns)
+	return columns
+}
+
 var flagGenerate = flag.String("generate", "",
 	"generate methods for this struct, which must be in the tables list. Use 'all' to generate everything.")
 
 // TestGenerateTableMethods is not really a test, use it to update the methods of a
-// tables type.
+// tables type. Types listed in the go:generate directive in data.go are generated
+// by gentable instead, and are skipped.
 //
 //	go test -run TestGenerateTableMethods ./internal/server/data -generate=<structName>
 //
@@ -77,6 +142,13 @@ func TestGenerateTableMethods(t *testing.T) {
 			t.Fatalf("could not find type %v in package data", inputName)
 		}
 
+		if generatedByGentable(t, typ.Name()) {
+			if inputName == "all" {
+				continue
+			}
+			t.Fatalf("methods of %v are generated by gentable, use go generate instead", inputName)
+		}
+
 		filename := fileset.File(pos).Name()
 		cols := columnNames(tables[target.Table()])
 		err = table.GenerateMethods(target, cols, filename)
@@ -116,6 +188,23 @@ func positionOfType(pkg *packages.Package, name string) token.Pos {
 	return 0
 }
 
+// generatedByGentable returns true if the methods of the type with name are in
+// the file generated by gentable.
+func generatedByGentable(t *testing.T, name string) bool {
+	file, err := parser.ParseFile(token.NewFileSet(), "tables_gen.go", nil, parser.SkipObjectResolution)
+	assert.NilError(t, err)
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil {
+			continue
+		}
+		if ident, ok := fn.Recv.List[0].Type.(*ast.Ident); ok && ident.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 func columnNames(cols []table.Column) []string {
 	c := make([]string, len(cols))
 	for i := range cols {
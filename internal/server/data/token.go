@@ -16,25 +16,54 @@ var signatureAlgorithmFromKeyAlgorithm = map[string]string{
 	"ED25519": "EdDSA", // elliptic curve 25519
 }
 
-func createJWT(db ReadTxn, identity *models.Identity, groups []string, expires time.Time) (string, error) {
+// newSigner returns a signer that uses the private key of the organization.
+// The key ID is included in the header of every signature, so that the key
+// used to verify the signature can be found in the JWKS.
+func newSigner(db ReadTxn, options *jose.SignerOptions) (jose.Signer, error) {
 	settings, err := GetSettings(db)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	var sec jose.JSONWebKey
 	if err := sec.UnmarshalJSON([]byte(settings.PrivateJWK)); err != nil {
-		return "", err
+		return nil, err
 	}
 
 	algo, ok := signatureAlgorithmFromKeyAlgorithm[sec.Algorithm]
 	if !ok {
-		return "", fmt.Errorf("unsupported algorithm")
+		return nil, fmt.Errorf("unsupported algorithm")
 	}
 
+	return jose.NewSigner(jose.SigningKey{Algorithm: jose.SignatureAlgorithm(algo), Key: sec}, options)
+}
+
+// SignPayload signs payload with the private key of the organization. The
+// signature is returned as a JWS in compact serialization with a detached
+// payload, which can be verified with the public key from the JWKS. Each of
+// headers is added to the protected header of the JWS, so that it is covered
+// by the signature.
+func SignPayload(db ReadTxn, payload []byte, headers map[string]interface{}) (string, error) {
 	options := &jose.SignerOptions{}
+	for k, v := range headers {
+		options.WithHeader(jose.HeaderKey(k), v)
+	}
+	signer, err := newSigner(db, options)
+	if err != nil {
+		return "", err
+	}
 
-	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.SignatureAlgorithm(algo), Key: sec}, options.WithType("JWT"))
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+	return jws.DetachedCompactSerialize()
+}
+
+func createJWT(db ReadTxn, identity *models.Identity, groups []string, audience string, jti string, expires time.Time) (string, error) {
+	options := &jose.SignerOptions{}
+
+	signer, err := newSigner(db, options.WithType("JWT"))
 	if err != nil {
 		return "", err
 	}
@@ -45,6 +74,10 @@ func createJWT(db ReadTxn, identity *models.Identity, groups []string, expires t
 		NotBefore: jwt.NewNumericDate(now.Add(time.Minute * -5)), // adjust for clock drift
 		Expiry:    jwt.NewNumericDate(expires),
 		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+		ID:        jti,
+	}
+	if audience != "" {
+		claim.Audience = jwt.Audience{audience}
 	}
 
 	custom := claims.Custom{
@@ -60,7 +93,13 @@ func createJWT(db ReadTxn, identity *models.Identity, groups []string, expires t
 	return raw, nil
 }
 
-func CreateIdentityToken(db ReadTxn, identityID uid.ID) (token *models.Token, err error) {
+// CreateIdentityToken creates a JWT for the identity that expires after
+// lifetime. If destination is not empty the token audience is set to the
+// destination name, and the token will only be accepted by that destination.
+//
+// The token is recorded so that it can be revoked by RevokeIssuedTokens before
+// it expires.
+func CreateIdentityToken(db WriteTxn, identityID uid.ID, destination string, lifetime time.Duration) (token *models.Token, err error) {
 	identity, err := GetIdentity(db, GetIdentityOptions{ByID: identityID})
 	if err != nil {
 		return nil, err
@@ -76,9 +115,17 @@ func CreateIdentityToken(db ReadTxn, identityID uid.ID) (token *models.Token, er
 		groups = append(groups, g.Name)
 	}
 
-	expires := time.Now().Add(time.Minute * 5).UTC()
+	issued := &models.IssuedToken{
+		IdentityID:      identityID,
+		DestinationName: destination,
+		ExpiresAt:       time.Now().Add(lifetime).UTC(),
+	}
+	if err := CreateIssuedToken(db, issued); err != nil {
+		return nil, err
+	}
+	expires := issued.ExpiresAt
 
-	jwt, err := createJWT(db, identity, groups, expires)
+	jwt, err := createJWT(db, identity, groups, destination, issued.ID.String(), expires)
 	if err != nil {
 		return nil, err
 	}
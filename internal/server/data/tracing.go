@@ -0,0 +1,93 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultTracer is used for query spans when the DB has no tracer. The global
+// tracer provider is a no-op until one is configured, so spans are only
+// recorded when tracing is enabled.
+var defaultTracer = otel.Tracer("github.com/infrahq/infra/internal/server/data")
+
+var queryTablePattern = regexp.MustCompile(
+	`(?is)^\s*(?:select\b.*?\bfrom|insert\s+into|update|delete\s+from)\s+(\w+)`)
+
+// queryTable returns the name of the table used by query, or an empty string
+// if the table can not be found from the leading tokens of the query.
+func queryTable(query string) string {
+	match := queryTablePattern.FindStringSubmatch(query)
+	if match == nil {
+		return ""
+	}
+	return strings.ToLower(match[1])
+}
+
+// queryOperation returns the first keyword of query, for example SELECT.
+func queryOperation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(fields[0])
+}
+
+// querySpan is a span for a single query.
+type querySpan struct {
+	span  trace.Span
+	start time.Time
+}
+
+// startQuerySpan starts a span for query as a child of the span in ctx. The
+// span records the parameterized query, never the arguments.
+func startQuerySpan(ctx context.Context, tracer trace.Tracer, d dialect, query string) querySpan {
+	if tracer == nil {
+		tracer = defaultTracer
+	}
+	_, span := tracer.Start(ctx, "query", trace.WithSpanKind(trace.SpanKindClient))
+	if !span.IsRecording() {
+		return querySpan{span: span}
+	}
+
+	operation := queryOperation(query)
+	system := semconv.DBSystemPostgreSQL
+	if d != nil {
+		system = semconv.DBSystemSqlite
+	}
+	span.SetAttributes(
+		system,
+		semconv.DBOperationKey.String(operation),
+		semconv.DBStatementKey.String(normalizeQueryString(query)))
+	span.SetName(operation)
+	if table := queryTable(query); table != "" {
+		span.SetAttributes(semconv.DBSQLTableKey.String(table))
+		span.SetName(operation + " " + table)
+	}
+	return querySpan{span: span, start: time.Now()}
+}
+
+// end the span. rows is the number of rows affected by the query, or -1 when
+// the number is not known.
+func (s querySpan) end(err error, rows int64) {
+	if !s.span.IsRecording() {
+		return
+	}
+	if rows >= 0 {
+		s.span.SetAttributes(attribute.Int64("db.rows_affected", rows))
+	}
+	s.span.SetAttributes(attribute.Int64("db.duration_ms", time.Since(s.start).Milliseconds()))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
@@ -0,0 +1,80 @@
+package data
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestQueryTable(t *testing.T) {
+	type testCase struct {
+		query    string
+		expected string
+	}
+	testCases := []testCase{
+		{query: "SELECT id, name FROM grants WHERE id = ?", expected: "grants"},
+		{query: "\n  select id,\n  created_from FROM Identities", expected: "identities"},
+		{query: "INSERT INTO access_keys (id) VALUES (?)", expected: "access_keys"},
+		{query: "UPDATE providers SET name = ?", expected: "providers"},
+		{query: "DELETE FROM groups WHERE id = ?", expected: "groups"},
+		{query: "SAVEPOINT grants", expected: ""},
+		{query: "SELECT 1", expected: ""},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, queryTable(tc.query), tc.expected, tc.query)
+	}
+}
+
+func TestTransaction_QuerySpans(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		exporter := tracetest.NewInMemoryExporter()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+		db.tracer = provider.Tracer("test")
+
+		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+		grant := &models.Grant{
+			Subject:   uid.NewIdentityPolymorphicID(uid.New()),
+			Privilege: "view",
+			Resource:  "the-secret-resource",
+		}
+		assert.NilError(t, CreateGrant(tx, grant))
+
+		ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+		tx.txCtx = ctx
+		exporter.Reset()
+
+		grants, err := ListGrants(tx, ListGrantsOptions{ByResource: "the-secret-resource"})
+		assert.NilError(t, err)
+		assert.Equal(t, len(grants), 1)
+		parent.End()
+
+		spans := exporter.GetSpans()
+		assert.Assert(t, len(spans) >= 2, spans)
+		var found bool
+		for _, span := range spans {
+			if span.Name != "SELECT grants" {
+				continue
+			}
+			found = true
+			assert.Equal(t, span.Parent.SpanID(), parent.SpanContext().SpanID())
+
+			attrs := map[string]string{}
+			for _, attr := range span.Attributes {
+				attrs[string(attr.Key)] = attr.Value.Emit()
+				assert.Assert(t, !strings.Contains(attr.Value.Emit(), "the-secret-resource"),
+					"span attribute %v includes an argument", attr.Key)
+			}
+			assert.Equal(t, attrs["db.sql.table"], "grants")
+			assert.Equal(t, attrs["db.operation"], "SELECT")
+			assert.Assert(t, attrs["db.duration_ms"] != "")
+		}
+		assert.Assert(t, found, "no span for the ListGrants query")
+	})
+}
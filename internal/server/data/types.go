@@ -3,6 +3,9 @@ package data
 import (
 	"database/sql"
 	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
 )
 
 // optionalString has the behaviour of sql.NullString. A null entry
@@ -34,3 +37,45 @@ func (s optionalString) Value() (driver.Value, error) {
 	}
 	return string(s), nil
 }
+
+// aggregateTime scans the result of an aggregate function, like min or max, of
+// a timestamp column. Postgres returns a time.Time, but sqlite only converts a
+// column to a time.Time when the column has a declared type, so the result
+// of an aggregate is scanned as a string in the format written by the driver.
+type aggregateTime time.Time
+
+// aggregateTimeFormats are the formats used by the sqlite driver to write
+// timestamps.
+var aggregateTimeFormats = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+}
+
+func (t *aggregateTime) Scan(value any) error {
+	var raw string
+	switch v := value.(type) {
+	case nil:
+		*t = aggregateTime{}
+		return nil
+	case time.Time:
+		*t = aggregateTime(v)
+		return nil
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("unsupported type %T for timestamp", value)
+	}
+
+	raw = strings.TrimSuffix(raw, "Z")
+	for _, format := range aggregateTimeFormats {
+		if v, err := time.Parse(format, raw); err == nil {
+			*t = aggregateTime(v)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid timestamp %q", raw)
+}
@@ -11,22 +11,6 @@ import (
 
 type userPublicKeysTable models.UserPublicKey
 
-func (t userPublicKeysTable) Table() string {
-	return "user_public_keys"
-}
-
-func (t userPublicKeysTable) Columns() []string {
-	return []string{"created_at", "deleted_at", "expires_at", "fingerprint", "id", "key_type", "name", "public_key", "updated_at", "user_id"}
-}
-
-func (t userPublicKeysTable) Values() []any {
-	return []any{t.CreatedAt, t.DeletedAt, t.ExpiresAt, t.Fingerprint, t.ID, t.KeyType, t.Name, t.PublicKey, t.UpdatedAt, t.UserID}
-}
-
-func (t *userPublicKeysTable) ScanFields() []any {
-	return []any{&t.CreatedAt, &t.DeletedAt, &t.ExpiresAt, &t.Fingerprint, &t.ID, &t.KeyType, &t.Name, &t.PublicKey, &t.UpdatedAt, &t.UserID}
-}
-
 func listUserPublicKeys(tx ReadTxn, userID uid.ID) ([]models.UserPublicKey, error) {
 	table := userPublicKeysTable{}
 	query := querybuilder.New("SELECT")
@@ -0,0 +1,69 @@
+package data
+
+import (
+	"fmt"
+
+	"github.com/infrahq/infra/internal/server/data/querybuilder"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+type userMFATable models.UserMFA
+
+func (u userMFATable) Table() string {
+	return "user_mfa"
+}
+
+func (u userMFATable) Columns() []string {
+	return []string{"confirmed", "created_at", "deleted_at", "id", "identity_id", "last_used_step", "organization_id", "recovery_codes", "totp_secret", "updated_at"}
+}
+
+func (u userMFATable) Values() []any {
+	return []any{u.Confirmed, u.CreatedAt, u.DeletedAt, u.ID, u.IdentityID, u.LastUsedStep, u.OrganizationID, u.RecoveryCodes, u.TOTPSecret, u.UpdatedAt}
+}
+
+func (u *userMFATable) ScanFields() []any {
+	return []any{&u.Confirmed, &u.CreatedAt, &u.DeletedAt, &u.ID, &u.IdentityID, &u.LastUsedStep, &u.OrganizationID, &u.RecoveryCodes, &u.TOTPSecret, &u.UpdatedAt}
+}
+
+// CreateUserMFA stores a new TOTP enrollment for a user. A user can only have
+// one enrollment, use DeleteUserMFA to remove the existing one first.
+func CreateUserMFA(tx WriteTxn, mfa *models.UserMFA) error {
+	if mfa.IdentityID == 0 {
+		return fmt.Errorf("CreateUserMFA requires an IdentityID")
+	}
+	if mfa.TOTPSecret == "" {
+		return fmt.Errorf("CreateUserMFA requires a TOTPSecret")
+	}
+	return insert(tx, (*userMFATable)(mfa))
+}
+
+// GetUserMFA returns the TOTP enrollment of the user, or ErrNotFound if the
+// user has not enrolled.
+func GetUserMFA(tx ReadTxn, identityID uid.ID) (*models.UserMFA, error) {
+	mfa := &userMFATable{}
+	err := getInOrg(tx, mfa, func(query *querybuilder.Query) error {
+		if identityID == 0 {
+			return fmt.Errorf("GetUserMFA requires an identity ID")
+		}
+		query.B("AND identity_id = ?", identityID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return (*models.UserMFA)(mfa), nil
+}
+
+func UpdateUserMFA(tx WriteTxn, mfa *models.UserMFA) error {
+	return update(tx, (*userMFATable)(mfa))
+}
+
+// DeleteUserMFA removes the TOTP enrollment and recovery codes of the user.
+// The row is deleted instead of soft deleted, because the secret must not be
+// kept after the user is reset.
+func DeleteUserMFA(tx WriteTxn, identityID uid.ID) error {
+	stmt := `DELETE FROM user_mfa WHERE identity_id = ? AND organization_id = ?`
+	_, err := tx.Exec(stmt, identityID, tx.OrganizationID())
+	return handleError(err)
+}
@@ -0,0 +1,50 @@
+package data
+
+import (
+	"errors"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+func TestUserMFA(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+
+		user := &models.Identity{Name: "mfa@example.com"}
+		assert.NilError(t, CreateIdentity(tx, user))
+
+		_, err := GetUserMFA(tx, user.ID)
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+
+		mfa := &models.UserMFA{
+			IdentityID: user.ID,
+			TOTPSecret: "JBSWY3DPEHPK3PXP",
+		}
+		assert.NilError(t, CreateUserMFA(tx, mfa))
+
+		mfa.Confirmed = true
+		mfa.LastUsedStep = 55
+		mfa.RecoveryCodes = models.CommaSeparatedStrings{"first", "second"}
+		assert.NilError(t, UpdateUserMFA(tx, mfa))
+
+		actual, err := GetUserMFA(tx, user.ID)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, actual, mfa, cmpTimeWithDBPrecision)
+
+		assert.NilError(t, DeleteUserMFA(tx, user.ID))
+		_, err = GetUserMFA(tx, user.ID)
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+
+		// a new enrollment can be created after the old one is deleted
+		assert.NilError(t, CreateUserMFA(tx, &models.UserMFA{IdentityID: user.ID, TOTPSecret: "JBSWY3DPEHPK3PXP"}))
+
+		// only one enrollment for each user
+		err = CreateUserMFA(tx, &models.UserMFA{IdentityID: user.ID, TOTPSecret: "other"})
+		var ucErr UniqueConstraintError
+		assert.Assert(t, errors.As(err, &ucErr), err)
+	})
+}
@@ -0,0 +1,256 @@
+package data
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/infrahq/infra/internal/server/data/querybuilder"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+type webhooksTable models.Webhook
+
+func (w webhooksTable) Table() string {
+	return "webhooks"
+}
+
+func (w webhooksTable) Columns() []string {
+	return []string{"created_at", "deleted_at", "events", "id", "organization_id", "secret", "updated_at", "url"}
+}
+
+func (w webhooksTable) Values() []any {
+	return []any{w.CreatedAt, w.DeletedAt, w.Events, w.ID, w.OrganizationID, w.Secret, w.UpdatedAt, w.URL}
+}
+
+func (w *webhooksTable) ScanFields() []any {
+	return []any{&w.CreatedAt, &w.DeletedAt, &w.Events, &w.ID, &w.OrganizationID, &w.Secret, &w.UpdatedAt, &w.URL}
+}
+
+func CreateWebhook(tx WriteTxn, webhook *models.Webhook) error {
+	return insert(tx, (*webhooksTable)(webhook))
+}
+
+func GetWebhook(tx ReadTxn, id uid.ID) (*models.Webhook, error) {
+	webhook := &webhooksTable{}
+	err := getInOrg(tx, webhook, func(query *querybuilder.Query) error {
+		if id == 0 {
+			return fmt.Errorf("GetWebhook requires an ID")
+		}
+		query.B("AND id = ?", id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return (*models.Webhook)(webhook), nil
+}
+
+type ListWebhooksOptions struct {
+	Pagination *Pagination
+}
+
+func ListWebhooks(tx ReadTxn, opts ListWebhooksOptions) ([]models.Webhook, error) {
+	filter := func(query *querybuilder.Query) error {
+		query.B("WHERE deleted_at is null")
+		query.B("AND organization_id = ?", tx.OrganizationID())
+		return nil
+	}
+
+	table := webhooksTable{}
+	query := querybuilder.New("SELECT")
+	query.B(columnsForSelect(table))
+	if opts.Pagination.countTotal() {
+		query.B(", count(*) OVER()")
+	}
+	query.B("FROM webhooks")
+	if err := filter(query); err != nil {
+		return nil, err
+	}
+	query.B("ORDER BY created_at ASC, id ASC")
+	if opts.Pagination != nil {
+		opts.Pagination.PaginateQuery(query)
+	}
+
+	rows, err := tx.Query(query.String(), query.Args...)
+	if err != nil {
+		return nil, err
+	}
+	result, err := scanRows(rows, func(webhook *models.Webhook) []any {
+		fields := (*webhooksTable)(webhook).ScanFields()
+		if opts.Pagination.countTotal() {
+			fields = append(fields, &opts.Pagination.TotalCount)
+		}
+		return fields
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.Pagination.countEmptyPage(tx, len(result), table, filter); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DeleteWebhook soft deletes the webhook. Pending deliveries to the webhook
+// are not sent, and are moved to the dead letter status when they are next
+// attempted.
+func DeleteWebhook(tx WriteTxn, id uid.ID) error {
+	stmt := `
+		UPDATE webhooks
+		SET deleted_at = ?
+		WHERE id = ?
+		AND deleted_at is null
+		AND organization_id = ?`
+	_, err := tx.Exec(stmt, time.Now(), id, tx.OrganizationID())
+	return handleError(err)
+}
+
+type webhookDeliveriesTable models.WebhookDelivery
+
+func (d webhookDeliveriesTable) Table() string {
+	return "webhook_deliveries"
+}
+
+func (d webhookDeliveriesTable) Columns() []string {
+	return []string{"attempts", "created_at", "event_type", "id", "last_attempt_at", "last_error", "next_attempt_at", "organization_id", "payload", "response_status", "status", "updated_at", "webhook_id"}
+}
+
+func (d webhookDeliveriesTable) Values() []any {
+	return []any{d.Attempts, d.CreatedAt, d.EventType, d.ID, d.LastAttemptAt, d.LastError, d.NextAttemptAt, d.OrganizationID, d.Payload, d.ResponseStatus, d.Status, d.UpdatedAt, d.WebhookID}
+}
+
+func (d *webhookDeliveriesTable) ScanFields() []any {
+	return []any{&d.Attempts, &d.CreatedAt, &d.EventType, &d.ID, &d.LastAttemptAt, &d.LastError, &d.NextAttemptAt, &d.OrganizationID, &d.Payload, &d.ResponseStatus, &d.Status, &d.UpdatedAt, &d.WebhookID}
+}
+
+func (d *webhookDeliveriesTable) OnInsert() error {
+	return (*models.WebhookDelivery)(d).OnInsert()
+}
+
+func CreateWebhookDelivery(tx WriteTxn, delivery *models.WebhookDelivery) error {
+	return insert(tx, (*webhookDeliveriesTable)(delivery))
+}
+
+type ListWebhookDeliveriesOptions struct {
+	ByWebhookID uid.ID
+	ByStatus    string
+
+	Pagination *Pagination
+}
+
+// ListWebhookDeliveries returns the deliveries from the organization of tx,
+// most recent first.
+func ListWebhookDeliveries(tx ReadTxn, opts ListWebhookDeliveriesOptions) ([]models.WebhookDelivery, error) {
+	filter := func(query *querybuilder.Query) error {
+		query.B("WHERE organization_id = ?", tx.OrganizationID())
+		if opts.ByWebhookID != 0 {
+			query.B("AND webhook_id = ?", opts.ByWebhookID)
+		}
+		if opts.ByStatus != "" {
+			query.B("AND status = ?", opts.ByStatus)
+		}
+		return nil
+	}
+
+	table := webhookDeliveriesTable{}
+	query := querybuilder.New("SELECT")
+	query.B(columnsForSelect(table))
+	if opts.Pagination.countTotal() {
+		query.B(", count(*) OVER()")
+	}
+	query.B("FROM webhook_deliveries")
+	if err := filter(query); err != nil {
+		return nil, err
+	}
+	query.B("ORDER BY created_at DESC, id DESC")
+	if opts.Pagination != nil {
+		opts.Pagination.PaginateQuery(query)
+	}
+
+	rows, err := tx.Query(query.String(), query.Args...)
+	if err != nil {
+		return nil, err
+	}
+	result, err := scanRows(rows, func(delivery *models.WebhookDelivery) []any {
+		fields := (*webhookDeliveriesTable)(delivery).ScanFields()
+		if opts.Pagination.countTotal() {
+			fields = append(fields, &opts.Pagination.TotalCount)
+		}
+		return fields
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.Pagination.countEmptyPage(tx, len(result), table, filter); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ListDueWebhookDeliveries returns up to limit pending deliveries from all
+// organizations that should be attempted at or before now, oldest first.
+// A delivery must be claimed with ClaimWebhookDelivery before it is sent.
+func ListDueWebhookDeliveries(tx ReadTxn, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	table := webhookDeliveriesTable{}
+	query := querybuilder.New("SELECT")
+	query.B(columnsForSelect(table))
+	query.B("FROM webhook_deliveries")
+	query.B("WHERE status = ?", models.WebhookDeliveryPending)
+	query.B("AND next_attempt_at <= ?", now)
+	query.B(allOrganizations)
+	query.B("ORDER BY next_attempt_at ASC, id ASC")
+	query.B("LIMIT ?", limit)
+
+	rows, err := tx.Query(query.String(), query.Args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanRows(rows, func(delivery *models.WebhookDelivery) []any {
+		return (*webhookDeliveriesTable)(delivery).ScanFields()
+	})
+}
+
+// ClaimWebhookDelivery moves the next attempt of a pending delivery that is
+// due at now to leaseUntil, so that no other server sends the delivery while
+// it is being attempted. It returns false if the delivery was already claimed,
+// or is no longer pending. On success delivery.NextAttemptAt is set to
+// leaseUntil.
+func ClaimWebhookDelivery(tx WriteTxn, delivery *models.WebhookDelivery, now, leaseUntil time.Time) (bool, error) {
+	stmt := `
+		UPDATE webhook_deliveries
+		SET next_attempt_at = ?
+		WHERE id = ?
+		AND status = ?
+		AND next_attempt_at <= ?
+		AND organization_id = ?`
+	result, err := tx.Exec(stmt, leaseUntil, delivery.ID, models.WebhookDeliveryPending,
+		now, tx.OrganizationID())
+	if err != nil {
+		return false, handleError(err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if count == 0 {
+		return false, nil
+	}
+	delivery.NextAttemptAt = leaseUntil
+	return true, nil
+}
+
+// UpdateWebhookDelivery stores the result of an attempt to send the delivery.
+func UpdateWebhookDelivery(tx WriteTxn, delivery *models.WebhookDelivery) error {
+	delivery.UpdatedAt = time.Now()
+	stmt := `
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, next_attempt_at = ?, last_attempt_at = ?,
+			response_status = ?, last_error = ?, updated_at = ?
+		WHERE id = ?
+		AND organization_id = ?`
+	_, err := tx.Exec(stmt, delivery.Status, delivery.Attempts, delivery.NextAttemptAt,
+		delivery.LastAttemptAt, delivery.ResponseStatus, delivery.LastError, delivery.UpdatedAt,
+		delivery.ID, tx.OrganizationID())
+	return handleError(err)
+}
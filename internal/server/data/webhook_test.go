@@ -0,0 +1,155 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+var cmpWebhook = cmp.Options{cmpModel, cmpopts.EquateEmpty()}
+
+func TestWebhooks(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+
+		first := &models.Webhook{
+			URL:    "https://example.com/first",
+			Secret: "the-secret-of-the-first-webhook",
+			Events: []string{"user.created", "grant.created"},
+		}
+		assert.NilError(t, CreateWebhook(tx, first))
+		second := &models.Webhook{URL: "https://example.com/second", Secret: "the-secret-of-the-second"}
+		assert.NilError(t, CreateWebhook(tx, second))
+
+		otherOrg := &models.Organization{Name: "other", Domain: "webhooks.example.com"}
+		assert.NilError(t, CreateOrganization(tx, otherOrg))
+		other := &models.Webhook{URL: "https://example.com/other", Secret: "the-secret-of-the-other-org"}
+		assert.NilError(t, CreateWebhook(tx.WithOrgID(otherOrg.ID), other))
+
+		actual, err := GetWebhook(tx, first.ID)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, actual, first, cmpModel)
+
+		_, err = GetWebhook(tx, other.ID)
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+
+		pagination := &Pagination{Limit: 10}
+		webhooks, err := ListWebhooks(tx, ListWebhooksOptions{Pagination: pagination})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, webhooks, []models.Webhook{*first, *second}, cmpWebhook)
+		assert.Equal(t, pagination.TotalCount, 2)
+
+		assert.NilError(t, DeleteWebhook(tx, first.ID))
+		_, err = GetWebhook(tx, first.ID)
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+
+		webhooks, err = ListWebhooks(tx, ListWebhooksOptions{})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, webhooks, []models.Webhook{*second}, cmpWebhook)
+	})
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	runDBTests(t, func(t *testing.T, db *DB) {
+		tx := txnForTestCase(t, db, db.DefaultOrg.ID)
+
+		webhook := &models.Webhook{URL: "https://example.com/hook", Secret: "the-secret-of-the-webhook"}
+		assert.NilError(t, CreateWebhook(tx, webhook))
+
+		now := time.Now()
+		due := &models.WebhookDelivery{
+			WebhookID: webhook.ID,
+			EventType: "user.created",
+			Payload:   `{"type":"user.created"}`,
+			CreatedAt: now.Add(-time.Minute),
+		}
+		assert.NilError(t, CreateWebhookDelivery(tx, due))
+		later := &models.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			EventType:     "user.deleted",
+			Payload:       `{"type":"user.deleted"}`,
+			NextAttemptAt: now.Add(time.Hour),
+		}
+		assert.NilError(t, CreateWebhookDelivery(tx, later))
+
+		otherOrg := &models.Organization{Name: "other", Domain: "deliveries.example.com"}
+		assert.NilError(t, CreateOrganization(tx, otherOrg))
+		otherTx := tx.WithOrgID(otherOrg.ID)
+		other := &models.WebhookDelivery{
+			WebhookID: 1234,
+			EventType: "grant.created",
+			Payload:   `{"type":"grant.created"}`,
+			CreatedAt: now.Add(-2 * time.Minute),
+		}
+		assert.NilError(t, CreateWebhookDelivery(otherTx, other))
+
+		t.Run("list due includes all organizations", func(t *testing.T) {
+			deliveries, err := ListDueWebhookDeliveries(tx, now, 10)
+			assert.NilError(t, err)
+			assert.Equal(t, len(deliveries), 2)
+			assert.Equal(t, deliveries[0].ID, other.ID)
+			assert.Equal(t, deliveries[1].ID, due.ID)
+			assert.Equal(t, deliveries[1].Status, models.WebhookDeliveryPending)
+		})
+
+		t.Run("claim", func(t *testing.T) {
+			lease := now.Add(time.Minute)
+			claimed, err := ClaimWebhookDelivery(tx, due, now, lease)
+			assert.NilError(t, err)
+			assert.Assert(t, claimed)
+
+			// a second claim fails, because the delivery is leased
+			claimed, err = ClaimWebhookDelivery(tx, due, now, lease)
+			assert.NilError(t, err)
+			assert.Assert(t, !claimed)
+
+			deliveries, err := ListDueWebhookDeliveries(tx, now, 10)
+			assert.NilError(t, err)
+			assert.Equal(t, len(deliveries), 1)
+			assert.Equal(t, deliveries[0].ID, other.ID)
+		})
+
+		t.Run("update", func(t *testing.T) {
+			due.Status = models.WebhookDeliveryDelivered
+			due.Attempts = 1
+			due.LastAttemptAt = now
+			due.ResponseStatus = 200
+			assert.NilError(t, UpdateWebhookDelivery(tx, due))
+
+			claimed, err := ClaimWebhookDelivery(tx, due, now.Add(time.Hour), now.Add(2*time.Hour))
+			assert.NilError(t, err)
+			assert.Assert(t, !claimed, "delivered deliveries can not be claimed")
+		})
+
+		t.Run("list by webhook and status", func(t *testing.T) {
+			pagination := &Pagination{Limit: 10}
+			deliveries, err := ListWebhookDeliveries(tx, ListWebhookDeliveriesOptions{
+				ByWebhookID: webhook.ID,
+				Pagination:  pagination,
+			})
+			assert.NilError(t, err)
+			assert.Equal(t, pagination.TotalCount, 2)
+			assert.Equal(t, len(deliveries), 2)
+			// most recent first
+			assert.Equal(t, deliveries[0].ID, later.ID)
+			assert.Equal(t, deliveries[1].ID, due.ID)
+			assert.Equal(t, deliveries[1].Status, models.WebhookDeliveryDelivered)
+			assert.Equal(t, deliveries[1].ResponseStatus, 200)
+			assert.Equal(t, deliveries[1].Attempts, 1)
+
+			deliveries, err = ListWebhookDeliveries(tx, ListWebhookDeliveriesOptions{
+				ByWebhookID: webhook.ID,
+				ByStatus:    models.WebhookDeliveryPending,
+			})
+			assert.NilError(t, err)
+			assert.Equal(t, len(deliveries), 1)
+			assert.Equal(t, deliveries[0].ID, later.ID)
+		})
+	})
+}
@@ -2,14 +2,21 @@ package server
 
 import (
 	"database/sql"
+	"fmt"
 	"net/http"
 	"net/http/pprof"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal"
 	"github.com/infrahq/infra/internal/access"
+	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/server/audit"
+	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/internal/validate"
 )
 
 var pprofRoute = route[pprofRequest, *api.EmptyResponse]{
@@ -49,3 +56,158 @@ func pprofHandler(c *gin.Context, _ *pprofRequest) (*api.EmptyResponse, error) {
 	}
 	return nil, nil
 }
+
+// The log level is changed only on the server that handles the request. When
+// there are multiple replicas of the server each replica must be updated.
+var getLogLevelRoute = route[api.EmptyRequest, *api.LogLevel]{
+	handler: getLogLevelHandler,
+	routeSettings: routeSettings{
+		omitFromTelemetry: true,
+		omitFromDocs:      true,
+		txnOptions:        &sql.TxOptions{ReadOnly: true},
+	},
+}
+
+var updateLogLevelRoute = route[api.UpdateLogLevelRequest, *api.LogLevel]{
+	handler: updateLogLevelHandler,
+	routeSettings: routeSettings{
+		omitFromTelemetry: true,
+		omitFromDocs:      true,
+		txnOptions:        &sql.TxOptions{ReadOnly: true},
+	},
+}
+
+func getLogLevelHandler(c *gin.Context, _ *api.EmptyRequest) (*api.LogLevel, error) {
+	if _, err := access.RequireInfraRole(c, models.InfraSupportAdminRole); err != nil {
+		return nil, access.HandleAuthErr(err, "log level", "get", models.InfraSupportAdminRole)
+	}
+	return &api.LogLevel{Level: logging.GetLevel()}, nil
+}
+
+func updateLogLevelHandler(c *gin.Context, r *api.UpdateLogLevelRequest) (*api.LogLevel, error) {
+	if _, err := access.RequireInfraRole(c, models.InfraSupportAdminRole); err != nil {
+		return nil, access.HandleAuthErr(err, "log level", "update", models.InfraSupportAdminRole)
+	}
+	if r.RevertAfter < 0 {
+		return nil, validate.Error{"revertAfter": {"must not be negative"}}
+	}
+
+	previous, err := logging.SetLevelWithRevert(r.Level, time.Duration(r.RevertAfter))
+	if err != nil {
+		return nil, err
+	}
+	logging.FromContext(c.Request.Context()).Info().
+		Str("level", r.Level).
+		Str("previousLevel", previous).
+		Dur("revertAfter", time.Duration(r.RevertAfter)).
+		Msg("log level changed")
+	return &api.LogLevel{Level: r.Level, PreviousLevel: previous}, nil
+}
+
+// listMigrationsRoute shows the migrations known to the server, and which of
+// them have been applied to the database.
+var listMigrationsRoute = route[api.EmptyRequest, *api.ListMigrationsResponse]{
+	handler: listMigrationsHandler,
+	routeSettings: routeSettings{
+		omitFromTelemetry: true,
+		omitFromDocs:      true,
+		txnOptions:        &sql.TxOptions{ReadOnly: true},
+	},
+}
+
+func listMigrationsHandler(c *gin.Context, _ *api.EmptyRequest) (*api.ListMigrationsResponse, error) {
+	tx, err := access.RequireInfraRole(c, models.InfraSupportAdminRole)
+	if err != nil {
+		return nil, access.HandleAuthErr(err, "migrations", "list", models.InfraSupportAdminRole)
+	}
+
+	migrations, err := data.MigrationStatus(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &api.ListMigrationsResponse{Items: make([]api.Migration, 0, len(migrations))}
+	for _, m := range migrations {
+		resp.Items = append(resp.Items, api.Migration{
+			ID:          m.ID,
+			Description: m.Description,
+			AppliedAt:   api.Time(m.AppliedAt),
+			Version:     m.Version,
+			Pending:     m.Pending,
+		})
+		if m.Pending {
+			resp.Pending++
+		}
+	}
+	return resp, nil
+}
+
+// The caches are in the memory of the server that handles the request. When
+// there are multiple replicas of the server each replica must be flushed.
+func (a *API) listCachesRoute() route[api.EmptyRequest, *api.ListCachesResponse] {
+	return route[api.EmptyRequest, *api.ListCachesResponse]{
+		handler: a.listCaches,
+		routeSettings: routeSettings{
+			omitFromTelemetry: true,
+			omitFromDocs:      true,
+			txnOptions:        &sql.TxOptions{ReadOnly: true},
+		},
+	}
+}
+
+func (a *API) flushCacheRoute() route[api.FlushCacheRequest, *api.EmptyResponse] {
+	return route[api.FlushCacheRequest, *api.EmptyResponse]{
+		handler: a.flushCache,
+		routeSettings: routeSettings{
+			omitFromTelemetry: true,
+			omitFromDocs:      true,
+			txnOptions:        &sql.TxOptions{ReadOnly: true},
+		},
+	}
+}
+
+func (a *API) listCaches(c *gin.Context, _ *api.EmptyRequest) (*api.ListCachesResponse, error) {
+	if _, err := access.RequireInfraRole(c, models.InfraSupportAdminRole); err != nil {
+		return nil, access.HandleAuthErr(err, "caches", "list", models.InfraSupportAdminRole)
+	}
+
+	registry := a.server.caches
+	resp := &api.ListCachesResponse{Items: []api.Cache{}}
+	for _, name := range registry.names() {
+		cache, ok := registry.get(name)
+		if !ok {
+			continue
+		}
+		stats := cache.CacheStats()
+		item := api.Cache{
+			Name:    name,
+			Entries: stats.Entries,
+			Hits:    stats.Hits,
+			Misses:  stats.Misses,
+		}
+		if !stats.Oldest.IsZero() {
+			item.OldestEntryAge = api.Duration(time.Since(stats.Oldest))
+		}
+		resp.Items = append(resp.Items, item)
+	}
+	return resp, nil
+}
+
+func (a *API) flushCache(c *gin.Context, r *api.FlushCacheRequest) (*api.EmptyResponse, error) {
+	_, err := access.RequireInfraRole(c, models.InfraSupportAdminRole)
+	if err != nil {
+		a.recordAudit(c, audit.ActionCacheFlush, auditTarget{Type: "cache", ID: r.Name}, err)
+		return nil, access.HandleAuthErr(err, "cache", "flush", models.InfraSupportAdminRole)
+	}
+
+	cache, ok := a.server.caches.get(r.Name)
+	if !ok {
+		return nil, fmt.Errorf("%w: no cache named %q", internal.ErrNotFound, r.Name)
+	}
+	cache.FlushCache()
+	a.recordAudit(c, audit.ActionCacheFlush, auditTarget{Type: "cache", ID: r.Name}, nil)
+	logging.FromContext(c.Request.Context()).Info().
+		Str("cache", r.Name).
+		Msg("cache flushed")
+	return nil, nil
+}
@@ -5,12 +5,15 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"gotest.tools/v3/assert"
 	is "gotest.tools/v3/assert/cmp"
 
 	"github.com/infrahq/infra/api"
 	"github.com/infrahq/infra/internal/access"
+	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/server/audit"
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
 )
@@ -88,6 +91,87 @@ func TestAPI_PProfHandler(t *testing.T) {
 	}
 }
 
+func TestAPI_LogLevel(t *testing.T) {
+	s := setupServer(t)
+	routes := s.GenerateRoutes()
+	t.Cleanup(func() {
+		assert.NilError(t, logging.SetLevel("info"))
+	})
+	assert.NilError(t, logging.SetLevel("info"))
+
+	supportAdminKey, supportAdmin := createAccessKey(t, s.DB(), "support@example.com")
+	err := data.CreateGrant(s.DB(), &models.Grant{
+		Subject:   supportAdmin.PolyID(),
+		Privilege: models.InfraSupportAdminRole,
+		Resource:  access.ResourceInfraAPI,
+		CreatedBy: supportAdmin.ID,
+	})
+	assert.NilError(t, err)
+
+	userKey, _ := createAccessKey(t, s.DB(), "user@example.com")
+
+	doRequest := func(t *testing.T, method string, key string, body interface{}) *httptest.ResponseRecorder {
+		t.Helper()
+		var req *http.Request
+		if body != nil {
+			// nolint:noctx
+			req = httptest.NewRequest(method, "/api/debug/loglevel", jsonBody(t, body))
+		} else {
+			// nolint:noctx
+			req = httptest.NewRequest(method, "/api/debug/loglevel", nil)
+		}
+		req.Header.Add("Infra-Version", apiVersionLatest)
+		req.Header.Add("Authorization", "Bearer "+key)
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("missing support admin role", func(t *testing.T) {
+		resp := doRequest(t, http.MethodGet, userKey, nil)
+		assert.Equal(t, resp.Code, http.StatusForbidden, resp.Body.String())
+
+		resp = doRequest(t, http.MethodPut, userKey, api.UpdateLogLevelRequest{Level: "debug"})
+		assert.Equal(t, resp.Code, http.StatusForbidden, resp.Body.String())
+		assert.Equal(t, logging.GetLevel(), "info")
+	})
+
+	t.Run("invalid level", func(t *testing.T) {
+		resp := doRequest(t, http.MethodPut, supportAdminKey, api.UpdateLogLevelRequest{Level: "loud"})
+		assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+		assert.Equal(t, logging.GetLevel(), "info")
+	})
+
+	t.Run("negative revertAfter", func(t *testing.T) {
+		resp := doRequest(t, http.MethodPut, supportAdminKey, api.UpdateLogLevelRequest{
+			Level:       "debug",
+			RevertAfter: api.Duration(-time.Minute),
+		})
+		assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+		assert.Equal(t, logging.GetLevel(), "info")
+	})
+
+	t.Run("update and get", func(t *testing.T) {
+		resp := doRequest(t, http.MethodPut, supportAdminKey, api.UpdateLogLevelRequest{
+			Level:       "debug",
+			RevertAfter: api.Duration(time.Hour),
+		})
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		var updated api.LogLevel
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &updated))
+		assert.DeepEqual(t, updated, api.LogLevel{Level: "debug", PreviousLevel: "info"})
+
+		resp = doRequest(t, http.MethodGet, supportAdminKey, nil)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		var current api.LogLevel
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &current))
+		assert.DeepEqual(t, current, api.LogLevel{Level: "debug"})
+	})
+}
+
 func responseBodyAPIErrorWithCode(code int32) func(t *testing.T, resp *httptest.ResponseRecorder) {
 	return func(t *testing.T, resp *httptest.ResponseRecorder) {
 		t.Helper()
@@ -99,3 +183,191 @@ func responseBodyAPIErrorWithCode(code int32) func(t *testing.T, resp *httptest.
 		assert.Equal(t, apiError.Code, code)
 	}
 }
+
+func TestAPI_ListMigrations(t *testing.T) {
+	s := setupServer(t)
+	routes := s.GenerateRoutes()
+
+	supportAdminKey, supportAdmin := createAccessKey(t, s.DB(), "support@example.com")
+	err := data.CreateGrant(s.DB(), &models.Grant{
+		Subject:   supportAdmin.PolyID(),
+		Privilege: models.InfraSupportAdminRole,
+		Resource:  access.ResourceInfraAPI,
+		CreatedBy: supportAdmin.ID,
+	})
+	assert.NilError(t, err)
+
+	userKey, _ := createAccessKey(t, s.DB(), "user@example.com")
+
+	doRequest := func(t *testing.T, key string) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodGet, "/api/debug/migrations", nil)
+		req.Header.Add("Infra-Version", apiVersionLatest)
+		req.Header.Add("Authorization", "Bearer "+key)
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("missing support admin role", func(t *testing.T) {
+		resp := doRequest(t, userKey)
+		assert.Equal(t, resp.Code, http.StatusForbidden, resp.Body.String())
+	})
+
+	t.Run("success", func(t *testing.T) {
+		resp := doRequest(t, supportAdminKey)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		var actual api.ListMigrationsResponse
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &actual))
+		assert.Equal(t, actual.Pending, 0)
+		assert.Assert(t, len(actual.Items) > 1)
+		assert.Equal(t, actual.Items[0].ID, "SCHEMA_INIT")
+
+		last := actual.Items[len(actual.Items)-1]
+		assert.Assert(t, !last.Pending)
+		assert.Assert(t, last.Description != "")
+	})
+}
+
+type fakeCache struct {
+	stats   data.CacheStats
+	flushed int
+}
+
+func (f *fakeCache) CacheStats() data.CacheStats {
+	return f.stats
+}
+
+func (f *fakeCache) FlushCache() {
+	f.flushed++
+	f.stats.Entries = 0
+	f.stats.Oldest = time.Time{}
+}
+
+func TestAPI_Caches(t *testing.T) {
+	s := setupServer(t)
+	routes := s.GenerateRoutes()
+	sink := withMemoryAuditSink(s)
+
+	fake := &fakeCache{stats: data.CacheStats{
+		Entries: 3,
+		Hits:    10,
+		Misses:  2,
+		Oldest:  time.Now().Add(-time.Minute),
+	}}
+	s.caches.register("fake", fake)
+
+	supportAdminKey, supportAdmin := createAccessKey(t, s.DB(), "support@example.com")
+	err := data.CreateGrant(s.DB(), &models.Grant{
+		Subject:   supportAdmin.PolyID(),
+		Privilege: models.InfraSupportAdminRole,
+		Resource:  access.ResourceInfraAPI,
+		CreatedBy: supportAdmin.ID,
+	})
+	assert.NilError(t, err)
+
+	userKey, user := createAccessKey(t, s.DB(), "user@example.com")
+
+	doRequest := func(t *testing.T, method, path, key string) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Add("Infra-Version", apiVersionLatest)
+		req.Header.Add("Authorization", "Bearer "+key)
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	listCaches := func(t *testing.T) map[string]api.Cache {
+		t.Helper()
+		resp := doRequest(t, http.MethodGet, "/api/debug/caches", supportAdminKey)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		var actual api.ListCachesResponse
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &actual))
+		byName := map[string]api.Cache{}
+		for _, item := range actual.Items {
+			byName[item.Name] = item
+		}
+		return byName
+	}
+
+	t.Run("missing support admin role", func(t *testing.T) {
+		resp := doRequest(t, http.MethodGet, "/api/debug/caches", userKey)
+		assert.Equal(t, resp.Code, http.StatusForbidden, resp.Body.String())
+
+		resp = doRequest(t, http.MethodDelete, "/api/debug/caches/fake", userKey)
+		assert.Equal(t, resp.Code, http.StatusForbidden, resp.Body.String())
+		assert.Equal(t, fake.flushed, 0)
+
+		expected := []models.AuditEvent{
+			{
+				OrganizationMember: models.OrganizationMember{OrganizationID: s.db.DefaultOrg.ID},
+				ActorID:            user.ID,
+				ActorName:          "user@example.com",
+				Action:             audit.ActionCacheFlush,
+				TargetType:         "cache",
+				TargetID:           "fake",
+				Result:             models.AuditResultFailure,
+			},
+		}
+		assert.DeepEqual(t, sink.Events(t), expected)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		caches := listCaches(t)
+		assert.Assert(t, is.Contains(caches, cacheNameDBReads))
+
+		actual := caches["fake"]
+		assert.Equal(t, actual.Entries, 3)
+		assert.Equal(t, actual.Hits, int64(10))
+		assert.Equal(t, actual.Misses, int64(2))
+		age := time.Duration(actual.OldestEntryAge)
+		assert.Assert(t, age >= time.Minute && age < 2*time.Minute, age)
+	})
+
+	t.Run("flush", func(t *testing.T) {
+		resp := doRequest(t, http.MethodDelete, "/api/debug/caches/fake", supportAdminKey)
+		assert.Equal(t, resp.Code, http.StatusNoContent, resp.Body.String())
+		assert.Equal(t, fake.flushed, 1)
+
+		actual := listCaches(t)["fake"]
+		expected := api.Cache{Name: "fake", Hits: 10, Misses: 2}
+		assert.DeepEqual(t, actual, expected)
+
+		expectedEvents := []models.AuditEvent{
+			{
+				OrganizationMember: models.OrganizationMember{OrganizationID: s.db.DefaultOrg.ID},
+				ActorID:            supportAdmin.ID,
+				ActorName:          "support@example.com",
+				Action:             audit.ActionCacheFlush,
+				TargetType:         "cache",
+				TargetID:           "fake",
+				Result:             models.AuditResultSuccess,
+			},
+		}
+		assert.DeepEqual(t, sink.Events(t), expectedEvents)
+	})
+
+	t.Run("flush the db reads cache", func(t *testing.T) {
+		_, err := s.orgSettings(s.DB())
+		assert.NilError(t, err)
+		assert.Assert(t, s.DB().CacheStats().Entries > 0)
+
+		resp := doRequest(t, http.MethodDelete, "/api/debug/caches/"+cacheNameDBReads, supportAdminKey)
+		assert.Equal(t, resp.Code, http.StatusNoContent, resp.Body.String())
+		// requests read the org settings, so list caches would add the entry again
+		assert.Equal(t, s.DB().CacheStats().Entries, 0)
+		sink.Events(t)
+	})
+
+	t.Run("unknown cache", func(t *testing.T) {
+		resp := doRequest(t, http.MethodDelete, "/api/debug/caches/missing", supportAdminKey)
+		assert.Equal(t, resp.Code, http.StatusNotFound, resp.Body.String())
+	})
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/server/data"
+)
+
+// describeQueryParam is the query parameter that requests an
+// api.ListDescription from a list endpoint, instead of the list.
+const describeQueryParam = "describe"
+
+// sortableRequest is implemented by list requests that accept a sort
+// parameter. SortableFields returns the values accepted by the parameter, and
+// is used both to validate the request and to describe the endpoint.
+type sortableRequest interface {
+	SortableFields() []string
+}
+
+// nonFilterParams are the query parameters of list requests that control the
+// pagination, the fields, or the blocking of the response, instead of
+// filtering the items.
+var nonFilterParams = map[string]bool{
+	"page":            true,
+	"limit":           true,
+	"cursor":          true,
+	"fields":          true,
+	"lastUpdateIndex": true,
+	"withTotal":       true,
+}
+
+// isDescribeRequest returns true if the request is for the description of a
+// list endpoint.
+func isDescribeRequest(c *gin.Context, req any) bool {
+	if c.Request.Method != http.MethodGet || c.Query(describeQueryParam) != "true" {
+		return false
+	}
+	_, ok := req.(isPaginatedRequest)
+	return ok
+}
+
+// listDescription describes the list endpoint with request type reqType. The
+// filters are read from the query parameters of the same request struct that
+// is used to read the request, so a new filter is described without any
+// other changes. A maxLimit of zero uses data.DefaultMaxPaginationLimit.
+func listDescription(reqType reflect.Type, maxLimit int) *api.ListDescription {
+	if maxLimit == 0 {
+		maxLimit = data.DefaultMaxPaginationLimit
+	}
+	desc := &api.ListDescription{
+		Filters:         []api.ListFilter{},
+		SortableFields:  []string{},
+		DefaultPageSize: data.DefaultPaginationLimit,
+		MaxPageSize:     maxLimit,
+	}
+
+	op := openapi3.NewOperation()
+	buildRequest(reqType, op, http.MethodGet, false)
+	for _, param := range op.Parameters {
+		p := param.Value
+		switch {
+		case p.In != "query":
+			continue
+		case p.Name == "cursor":
+			desc.CursorPagination = true
+			continue
+		case nonFilterParams[p.Name]:
+			continue
+		}
+
+		schema := p.Schema.Value
+		filter := api.ListFilter{
+			Name:        p.Name,
+			Type:        schema.Type,
+			Format:      schema.Format,
+			Description: p.Description,
+		}
+		if schema.Type == "array" {
+			schema = schema.Items.Value
+			filter.Multiple = true
+			filter.Type = schema.Type
+			filter.Format = schema.Format
+		}
+		for _, value := range schema.Enum {
+			filter.Enum = append(filter.Enum, fmt.Sprint(value))
+		}
+		desc.Filters = append(desc.Filters, filter)
+	}
+
+	if r, ok := reflect.New(reqType).Interface().(sortableRequest); ok {
+		desc.SortableFields = append(desc.SortableFields, r.SortableFields()...)
+	}
+	return desc
+}
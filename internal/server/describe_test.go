@@ -0,0 +1,201 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestAPI_ListDescription(t *testing.T) {
+	srv := setupServer(t, withAdminUser, withSupportAdminGrant, func(t *testing.T, options *Options) {
+		options.API.MaxPaginationLimit = 500
+	})
+	routes := srv.GenerateRoutes()
+
+	admin, err := data.GetIdentity(srv.DB(), data.GetIdentityOptions{ByName: "admin@example.com"})
+	assert.NilError(t, err)
+
+	get := func(t *testing.T, path string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	type testCase struct {
+		path string
+		// filters maps the name of each filter that is expected in the
+		// description to a query string that uses the filter, and is accepted
+		// by the endpoint.
+		filters          map[string]string
+		cursorPagination bool
+	}
+
+	testCases := []testCase{
+		{
+			path: "/api/users",
+			filters: map[string]string{
+				"name":                 "name=alice@example.com",
+				"group":                "group=" + uid.New().String(),
+				"ids":                  "ids=" + uid.New().String() + "&ids=" + uid.New().String(),
+				"showSystem":           "showSystem=true",
+				"publicKeyFingerprint": "publicKeyFingerprint=SHA256:abcd",
+			},
+			cursorPagination: true,
+		},
+		{
+			path: "/api/grants",
+			filters: map[string]string{
+				"user":          "user=" + admin.ID.String(),
+				"group":         "group=" + uid.New().String(),
+				"resource":      "resource=example",
+				"destination":   "destination=example",
+				"privilege":     "privilege=view",
+				"showInherited": "showInherited=true&user=" + admin.ID.String(),
+				"showSystem":    "showSystem=true",
+			},
+			cursorPagination: true,
+		},
+		{
+			path: "/api/groups",
+			filters: map[string]string{
+				"name":   "name=everyone",
+				"userID": "userID=" + admin.ID.String(),
+			},
+		},
+		{
+			path: "/api/access-keys",
+			filters: map[string]string{
+				"userID":      "userID=" + admin.ID.String(),
+				"name":        "name=example",
+				"showExpired": "showExpired=true",
+			},
+		},
+		{
+			path: "/api/destinations",
+			filters: map[string]string{
+				"name":      "name=example",
+				"kind":      "kind=kubernetes",
+				"unique_id": "unique_id=abcd",
+			},
+		},
+		{
+			path: "/api/providers",
+			filters: map[string]string{
+				"name": "name=okta",
+			},
+		},
+		{
+			path: "/api/organizations",
+			filters: map[string]string{
+				"name": "name=example",
+			},
+		},
+		{
+			path:    "/api/webhooks",
+			filters: map[string]string{},
+		},
+	}
+
+	run := func(t *testing.T, tc testCase) {
+		resp := get(t, tc.path+"?describe=true")
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		var desc api.ListDescription
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &desc))
+		assert.Equal(t, desc.DefaultPageSize, 100)
+		assert.Equal(t, desc.MaxPageSize, 500)
+		assert.Equal(t, desc.CursorPagination, tc.cursorPagination)
+		assert.DeepEqual(t, desc.SortableFields, []string{})
+
+		var names, expectedNames []string
+		for _, filter := range desc.Filters {
+			names = append(names, filter.Name)
+		}
+		for name := range tc.filters {
+			expectedNames = append(expectedNames, name)
+		}
+		sort.Strings(names)
+		sort.Strings(expectedNames)
+		assert.DeepEqual(t, names, expectedNames)
+
+		for _, filter := range desc.Filters {
+			resp := get(t, tc.path+"?"+tc.filters[filter.Name])
+			assert.Equal(t, resp.Code, http.StatusOK, "filter %v: %v", filter.Name, resp.Body.String())
+
+			var invalid string
+			switch {
+			case filter.Type == "boolean":
+				invalid = "notabool"
+			case filter.Format == "uid":
+				invalid = "not-a-uid!"
+			default:
+				continue
+			}
+			resp = get(t, tc.path+"?"+filter.Name+"="+invalid)
+			assert.Equal(t, resp.Code, http.StatusBadRequest, "filter %v: %v", filter.Name, resp.Body.String())
+		}
+
+		resp = get(t, tc.path+"?limit="+strconv.Itoa(desc.MaxPageSize))
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		resp = get(t, tc.path+"?limit="+strconv.Itoa(desc.MaxPageSize+1))
+		assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+
+	t.Run("filter types", func(t *testing.T) {
+		resp := get(t, "/api/users?describe=true")
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		var desc api.ListDescription
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &desc))
+		filters := map[string]api.ListFilter{}
+		for _, filter := range desc.Filters {
+			filters[filter.Name] = filter
+		}
+		assert.DeepEqual(t, filters["ids"], api.ListFilter{
+			Name:        "ids",
+			Type:        "string",
+			Format:      "uid",
+			Multiple:    true,
+			Description: "List of User IDs",
+		})
+		assert.Equal(t, filters["showSystem"].Type, "boolean")
+		assert.Equal(t, filters["name"].Type, "string")
+	})
+
+	t.Run("enum values", func(t *testing.T) {
+		desc := listDescription(reflect.TypeOf(api.ListWebhookDeliveriesRequest{}), 0)
+		assert.Equal(t, desc.MaxPageSize, data.DefaultMaxPaginationLimit)
+		assert.Equal(t, len(desc.Filters), 1)
+		assert.Equal(t, desc.Filters[0].Name, "status")
+		assert.Assert(t, len(desc.Filters[0].Enum) > 0)
+	})
+
+	t.Run("describe is ignored by endpoints that are not lists", func(t *testing.T) {
+		resp := get(t, "/api/users/"+admin.ID.String()+"?describe=true")
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		var user api.User
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &user))
+		assert.Equal(t, user.ID, admin.ID)
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,8 +14,11 @@ import (
 	"gotest.tools/v3/assert"
 
 	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/access"
+	"github.com/infrahq/infra/internal/server/audit"
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
 )
 
 func TestAPI_CreateDestination(t *testing.T) {
@@ -70,11 +74,12 @@ func TestAPI_CreateDestination(t *testing.T) {
 		"ca": "-----BEGIN CERTIFICATE-----\nok\n-----END CERTIFICATE-----\n"
 	},
 	"connected": false,
-	"lastSeen": null,
+	"lastSeenAt": null,
 	"resources": ["res1", "res2"],
 	"roles": ["role1", "role2"],
 	"created": "%[1]v",
-	"updated": "%[1]v"
+	"updated": "%[1]v",
+	"updateIndex": 1
 }
 `,
 					time.Now().UTC().Format(time.RFC3339)))
@@ -96,8 +101,8 @@ func TestAPI_CreateDestination(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{FieldName: "connection.ca", Errors: []string{"is required"}},
-					{FieldName: "name", Errors: []string{"is required"}},
+					{FieldName: "connection.ca", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
+					{FieldName: "name", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
 			},
@@ -121,7 +126,7 @@ func TestAPI_CreateDestination(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{FieldName: "name", Errors: []string{"infra is reserved and can not be used"}},
+					{FieldName: "name", ErrorCode: api.ErrorCodeInvalid, Errors: []string{"infra is reserved and can not be used"}},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
 			},
@@ -136,10 +141,18 @@ func TestAPI_CreateDestination(t *testing.T) {
 }
 
 var cmpAPIDestinationJSON = gocmp.Options{
-	gocmp.FilterPath(pathMapKey(`created`, `updated`, `lastSeen`), cmpApproximateTime),
+	gocmp.FilterPath(pathMapKey(`created`, `updated`, `lastSeenAt`), cmpApproximateTime),
 	gocmp.FilterPath(pathMapKey(`id`), cmpAnyValidUID),
+	gocmp.FilterPath(pathMapKey(`updateIndex`), cmpNonZeroNumber),
 }
 
+// cmpNonZeroNumber compares JSON numbers, and passes when both are non-zero.
+var cmpNonZeroNumber = gocmp.Comparer(func(x, y interface{}) bool {
+	xn, _ := x.(float64)
+	yn, _ := y.(float64)
+	return xn != 0 && yn != 0
+})
+
 func TestAPI_UpdateDestination(t *testing.T) {
 	srv := setupServer(t, withAdminUser)
 	routes := srv.GenerateRoutes()
@@ -221,8 +234,8 @@ func TestAPI_UpdateDestination(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{FieldName: "connection.ca", Errors: []string{"is required"}},
-					{FieldName: "name", Errors: []string{"is required"}},
+					{FieldName: "connection.ca", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
+					{FieldName: "name", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
 			},
@@ -259,11 +272,12 @@ func TestAPI_UpdateDestination(t *testing.T) {
 							"ca": "the-ca-or-fingerprint"
 						},
 						"connected": true,
-						"lastSeen": "%[1]v",
+						"lastSeenAt": "%[1]v",
 						"resources": null,
 						"roles": ["one", "two"],
 						"created": "%[1]v",
-						"updated": "%[1]v"
+						"updated": "%[1]v",
+						"updateIndex": 1
 					}
 				`, time.Now().UTC().Format(time.RFC3339), dest.ID))
 
@@ -290,9 +304,320 @@ func TestAPI_UpdateDestination(t *testing.T) {
 				var cmpDestination = gocmp.Options{
 					cmpopts.EquateApproxTime(2 * time.Second),
 					cmpopts.EquateEmpty(),
+					cmpopts.IgnoreFields(models.Destination{}, "UpdateIndex"),
 				}
 				assert.DeepEqual(t, actual, expected, cmpDestination)
 				assert.Assert(t, dest.UpdatedAt != actual.UpdatedAt)
+				assert.Assert(t, actual.UpdateIndex > dest.UpdateIndex)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
+
+func TestAPI_UpdateDestination_Conflict(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+
+	dest := &models.Destination{
+		Name:     "the-dest",
+		Kind:     models.DestinationKindSSH,
+		UniqueID: "unique-id",
+	}
+	assert.NilError(t, data.CreateDestination(srv.db, dest))
+	readIndex := dest.UpdateIndex
+
+	// another request modifies the destination after the client read it
+	concurrent := *dest
+	concurrent.Version = "0.20.0"
+	assert.NilError(t, data.UpdateDestination(srv.db, &concurrent))
+
+	doRequest := func(t *testing.T, updateIndex int64) *httptest.ResponseRecorder {
+		t.Helper()
+		body := jsonBody(t, api.UpdateDestinationRequest{
+			Name:     "the-dest",
+			UniqueID: "unique-id",
+			Version:  "0.19.0",
+			Connection: api.DestinationConnection{
+				URL: "10.10.10.10:12345",
+				CA:  "the-ca-or-fingerprint",
+			},
+			UpdateIndex: updateIndex,
+		})
+		req := httptest.NewRequest(http.MethodPut, "/api/destinations/"+dest.ID.String(), body)
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("stale update index", func(t *testing.T) {
+		resp := doRequest(t, readIndex)
+		assert.Equal(t, resp.Code, http.StatusConflict, (*responseDebug)(resp))
+
+		respBody := &api.Error{}
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), respBody))
+		assert.Equal(t, respBody.Code, int32(http.StatusConflict))
+
+		current := &api.Destination{}
+		assert.NilError(t, json.Unmarshal(respBody.Current, current))
+		assert.Equal(t, current.ID, dest.ID)
+		assert.Equal(t, current.Version, "0.20.0")
+		assert.Equal(t, current.UpdateIndex, concurrent.UpdateIndex)
+
+		actual, err := data.GetDestination(srv.db, data.GetDestinationOptions{ByID: dest.ID})
+		assert.NilError(t, err)
+		assert.Equal(t, actual.Version, "0.20.0")
+	})
+	t.Run("current update index", func(t *testing.T) {
+		resp := doRequest(t, concurrent.UpdateIndex)
+		assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+
+		respBody := &api.Destination{}
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), respBody))
+		assert.Equal(t, respBody.Version, "0.19.0")
+		assert.Assert(t, respBody.UpdateIndex > concurrent.UpdateIndex)
+	})
+	t.Run("without update index", func(t *testing.T) {
+		resp := doRequest(t, 0)
+		assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+	})
+}
+
+func TestAPI_Destination_LastSeenAtRenamed(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+
+	lastSeen := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	dest := &models.Destination{
+		Name:       "the-dest",
+		Kind:       models.DestinationKindSSH,
+		UniqueID:   "unique-id",
+		LastSeenAt: lastSeen,
+	}
+	assert.NilError(t, data.CreateDestination(srv.db, dest))
+
+	doRequest := func(t *testing.T, path, version string) map[string]any {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		if version != "" {
+			req.Header.Set("Infra-Version", version)
+		}
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+
+		var body map[string]any
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+		if items, ok := body["items"].([]any); ok {
+			assert.Equal(t, len(items), 1)
+			body, _ = items[0].(map[string]any)
+		}
+		return body
+	}
+
+	for _, path := range []string{"/api/destinations", "/api/destinations/" + dest.ID.String()} {
+		t.Run(path, func(t *testing.T) {
+			t.Run("latest version", func(t *testing.T) {
+				body := doRequest(t, path, apiVersionLatest)
+				assert.Equal(t, body["lastSeenAt"], "2023-01-02T03:04:05.000Z")
+				assert.Equal(t, body["name"], "the-dest")
+				_, ok := body["lastSeen"]
+				assert.Assert(t, !ok, "unexpected lastSeen field")
+			})
+			t.Run("no version", func(t *testing.T) {
+				body := doRequest(t, path, "")
+				assert.Equal(t, body["lastSeenAt"], "2023-01-02T03:04:05.000Z")
+			})
+			t.Run("version 0.19.1", func(t *testing.T) {
+				body := doRequest(t, path, "0.19.1")
+				assert.Equal(t, body["lastSeen"], "2023-01-02T03:04:05.000Z")
+				assert.Equal(t, body["name"], "the-dest")
+				_, ok := body["lastSeenAt"]
+				assert.Assert(t, !ok, "unexpected lastSeenAt field")
+			})
+		})
+	}
+}
+
+func TestAPI_DestinationLogs(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+	db := srv.DB()
+
+	connectorKey, connector := createAccessKey(t, db, "connectorA")
+	err := data.CreateGrant(db, &models.Grant{
+		Subject:   connector.PolyID(),
+		Privilege: models.InfraConnectorRole,
+		Resource:  access.ResourceInfraAPI,
+	})
+	assert.NilError(t, err)
+
+	supportAdminKey, supportAdmin := createAccessKey(t, db, "support@example.com")
+	err = data.CreateGrant(db, &models.Grant{
+		Subject:   supportAdmin.PolyID(),
+		Privilege: models.InfraSupportAdminRole,
+		Resource:  access.ResourceInfraAPI,
+	})
+	assert.NilError(t, err)
+
+	destination := &models.Destination{Name: "the-dest", Kind: "kubernetes", UniqueID: "the-dest"}
+	assert.NilError(t, data.CreateDestination(db, destination))
+
+	doRequest := func(t *testing.T, method, key string, body interface{}) *httptest.ResponseRecorder {
+		t.Helper()
+		var req *http.Request
+		path := fmt.Sprintf("/api/destinations/%v/logs", destination.ID)
+		if body != nil {
+			req = httptest.NewRequest(method, path, jsonBody(t, body))
+		} else {
+			req = httptest.NewRequest(method, path, nil)
+		}
+		req.Header.Set("Authorization", "Bearer "+key)
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	logTime := time.Date(2022, 12, 27, 10, 11, 12, 0, time.UTC)
+	body := api.CreateDestinationLogsRequest{
+		Logs: []api.DestinationLog{
+			{Time: api.Time(logTime), Level: "error", Line: `{"message":"first"}`},
+			{Time: api.Time(logTime.Add(time.Second)), Level: "warn", Line: `{"message":"second"}`},
+		},
+	}
+
+	t.Run("create as connector", func(t *testing.T) {
+		resp := doRequest(t, http.MethodPost, connectorKey, body)
+		assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+	})
+
+	t.Run("list requires support admin", func(t *testing.T) {
+		resp := doRequest(t, http.MethodGet, adminAccessKey(srv), nil)
+		assert.Equal(t, resp.Code, http.StatusForbidden, resp.Body.String())
+	})
+
+	t.Run("list as support admin", func(t *testing.T) {
+		resp := doRequest(t, http.MethodGet, supportAdminKey, nil)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		var actual api.ListResponse[api.DestinationLog]
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &actual))
+		// most recent first
+		expected := []api.DestinationLog{body.Logs[1], body.Logs[0]}
+		assert.DeepEqual(t, actual.Items, expected)
+	})
+
+	t.Run("create for unknown destination", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/destinations/1234/logs", jsonBody(t, body))
+		req.Header.Set("Authorization", "Bearer "+connectorKey)
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		assert.Equal(t, resp.Code, http.StatusNotFound, resp.Body.String())
+	})
+}
+
+func TestAPI_CreateDestinationLogs_TimeFormats(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+	db := srv.DB()
+
+	connectorKey, connector := createAccessKey(t, db, "connectorA")
+	err := data.CreateGrant(db, &models.Grant{
+		Subject:   connector.PolyID(),
+		Privilege: models.InfraConnectorRole,
+		Resource:  access.ResourceInfraAPI,
+	})
+	assert.NilError(t, err)
+
+	type testCase struct {
+		name     string
+		body     string
+		expected func(t *testing.T, resp *httptest.ResponseRecorder)
+	}
+
+	run := func(t *testing.T, tc testCase) {
+		name := "dest-" + uid.New().String()
+		destination := &models.Destination{Name: name, Kind: "kubernetes", UniqueID: name}
+		assert.NilError(t, data.CreateDestination(db, destination))
+
+		path := fmt.Sprintf("/api/destinations/%v/logs", destination.ID)
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(tc.body))
+		req.Header.Set("Authorization", "Bearer "+connectorKey)
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+
+		if tc.expected != nil {
+			tc.expected(t, resp)
+			return
+		}
+		assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+
+		logs, err := data.ListDestinationLogs(db, data.ListDestinationLogsOptions{ByDestinationID: destination.ID})
+		assert.NilError(t, err)
+		assert.Equal(t, len(logs), 1)
+		expected := time.Date(2023, 1, 20, 10, 11, 12, 0, time.UTC)
+		assert.Assert(t, logs[0].CreatedAt.Truncate(time.Second).Equal(expected), logs[0].CreatedAt)
+	}
+
+	expectFieldError := func(problem string) func(t *testing.T, resp *httptest.ResponseRecorder) {
+		return func(t *testing.T, resp *httptest.ResponseRecorder) {
+			assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+
+			var respBody api.Error
+			assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &respBody))
+			expected := []api.FieldError{
+				{FieldName: "logs.time", ErrorCode: api.ErrorCodeInvalid, Errors: []string{problem}},
+			}
+			assert.DeepEqual(t, respBody.FieldErrors, expected)
+		}
+	}
+
+	testCases := []testCase{
+		{
+			name: "RFC3339",
+			body: `{"logs": [{"time": "2023-01-20T10:11:12Z", "level": "error", "line": "{}"}]}`,
+		},
+		{
+			name: "RFC3339 with nanoseconds and offset",
+			body: `{"logs": [{"time": "2023-01-20T11:11:12.123456789+01:00", "level": "error", "line": "{}"}]}`,
+		},
+		{
+			name: "unix seconds",
+			body: `{"logs": [{"time": 1674209472, "level": "error", "line": "{}"}]}`,
+		},
+		{
+			name: "unix milliseconds",
+			body: `{"logs": [{"time": 1674209472999, "level": "error", "line": "{}"}]}`,
+		},
+		{
+			name:     "before 1970",
+			body:     `{"logs": [{"time": "1960-01-01T00:00:00Z", "level": "error", "line": "{}"}]}`,
+			expected: expectFieldError("must be after 1970-01-01T00:00:00Z"),
+		},
+		{
+			name:     "after 2100",
+			body:     `{"logs": [{"time": "2200-01-01T00:00:00Z", "level": "error", "line": "{}"}]}`,
+			expected: expectFieldError("must be before 2100-01-01T00:00:00Z"),
+		},
+		{
+			name: "not a time",
+			body: `{"logs": [{"time": "yesterday", "level": "error", "line": "{}"}]}`,
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+				assert.Assert(t, strings.Contains(resp.Body.String(), "must be an RFC3339 time or a unix timestamp"), resp.Body.String())
 			},
 		},
 	}
@@ -303,3 +628,339 @@ func TestAPI_UpdateDestination(t *testing.T) {
 		})
 	}
 }
+
+func TestAPI_DestinationUsage(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+	db := srv.DB()
+
+	connectorKey, connector := createAccessKey(t, db, "connectorA")
+	err := data.CreateGrant(db, &models.Grant{
+		Subject:   connector.PolyID(),
+		Privilege: models.InfraConnectorRole,
+		Resource:  access.ResourceInfraAPI,
+	})
+	assert.NilError(t, err)
+
+	destination := &models.Destination{Name: "the-dest", Kind: "kubernetes", UniqueID: "the-dest"}
+	assert.NilError(t, data.CreateDestination(db, destination))
+
+	doRequest := func(t *testing.T, method, path, key string, body interface{}) *httptest.ResponseRecorder {
+		t.Helper()
+		var req *http.Request
+		if body != nil {
+			req = httptest.NewRequest(method, path, jsonBody(t, body))
+		} else {
+			req = httptest.NewRequest(method, path, nil)
+		}
+		req.Header.Set("Authorization", "Bearer "+key)
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+	path := fmt.Sprintf("/api/destinations/%v/usage", destination.ID)
+
+	today := models.UsageDay(time.Now())
+	yesterday := today.AddDate(0, 0, -1)
+	login := func(at time.Time, actor uid.ID) {
+		t.Helper()
+		assert.NilError(t, data.CreateAuditEvent(db, &models.AuditEvent{
+			CreatedAt:  at,
+			ActorID:    actor,
+			Action:     audit.ActionDestinationLogin,
+			TargetType: "destination",
+			TargetID:   destination.ID.String(),
+			TargetName: destination.Name,
+			Result:     models.AuditResultSuccess,
+		}))
+	}
+	login(yesterday.Add(time.Hour), 1001)
+	login(yesterday.Add(2*time.Hour), 1001)
+	login(yesterday.Add(3*time.Hour), 1002)
+	login(today, 1001)
+
+	for _, day := range []time.Time{yesterday, today} {
+		_, err := data.AggregateDestinationUsage(db, data.AggregateDestinationUsageOptions{
+			Day:         day,
+			LoginAction: audit.ActionDestinationLogin,
+		})
+		assert.NilError(t, err)
+	}
+
+	t.Run("proxy requests from connector metrics reports", func(t *testing.T) {
+		body := api.UpdateDestinationRequest{
+			Name:     destination.Name,
+			UniqueID: destination.UniqueID,
+			Connection: api.DestinationConnection{
+				URL: "10.0.0.1:443",
+				CA:  "the-ca",
+			},
+			Metrics: &api.ConnectorMetrics{PeriodSeconds: 60, ProxyRequests: 12},
+		}
+		destPath := fmt.Sprintf("/api/destinations/%v", destination.ID)
+		resp := doRequest(t, http.MethodPut, destPath, connectorKey, body)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		resp = doRequest(t, http.MethodPut, destPath, connectorKey, body)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+	})
+
+	t.Run("get usage", func(t *testing.T) {
+		resp := doRequest(t, http.MethodGet, path+"?days=3", adminAccessKey(srv), nil)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		var actual api.DestinationUsage
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &actual))
+		expected := api.DestinationUsage{
+			DestinationID: destination.ID,
+			Days: []api.DestinationUsageDay{
+				{Day: api.Time(today.AddDate(0, 0, -2))},
+				{Day: api.Time(yesterday), Logins: 3, DistinctUsers: 2},
+				{Day: api.Time(today), Logins: 1, DistinctUsers: 1, ProxyRequests: 24},
+			},
+		}
+		assert.DeepEqual(t, actual, expected)
+	})
+
+	t.Run("get usage defaults to 30 days", func(t *testing.T) {
+		resp := doRequest(t, http.MethodGet, path, adminAccessKey(srv), nil)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		var actual api.DestinationUsage
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &actual))
+		assert.Equal(t, len(actual.Days), 30)
+	})
+
+	t.Run("get usage with too many days", func(t *testing.T) {
+		resp := doRequest(t, http.MethodGet, path+"?days=1000", adminAccessKey(srv), nil)
+		assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+	})
+
+	t.Run("get usage of unknown destination", func(t *testing.T) {
+		resp := doRequest(t, http.MethodGet, "/api/destinations/1234/usage", adminAccessKey(srv), nil)
+		assert.Equal(t, resp.Code, http.StatusNotFound, resp.Body.String())
+	})
+}
+
+func TestAPI_DestinationMetrics(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+	db := srv.DB()
+
+	connectorKey, connector := createAccessKey(t, db, "connectorA")
+	err := data.CreateGrant(db, &models.Grant{
+		Subject:   connector.PolyID(),
+		Privilege: models.InfraConnectorRole,
+		Resource:  access.ResourceInfraAPI,
+	})
+	assert.NilError(t, err)
+
+	destination := &models.Destination{
+		Name:          "the-dest",
+		Kind:          "kubernetes",
+		UniqueID:      "the-dest",
+		ConnectionURL: "10.0.0.1:443",
+		ConnectionCA:  "the-ca",
+		Resources:     []string{"default"},
+		Roles:         []string{"view"},
+		Version:       "0.20.0",
+	}
+	stale := &models.Destination{Name: "stale-dest", Kind: "kubernetes", UniqueID: "stale-dest"}
+	assert.NilError(t, data.CreateDestination(db, destination))
+	assert.NilError(t, data.CreateDestination(db, stale))
+
+	doRequest := func(t *testing.T, method, path, key string, body interface{}) *httptest.ResponseRecorder {
+		t.Helper()
+		var req *http.Request
+		if body != nil {
+			req = httptest.NewRequest(method, path, jsonBody(t, body))
+		} else {
+			req = httptest.NewRequest(method, path, nil)
+		}
+		req.Header.Set("Authorization", "Bearer "+key)
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+	getMetrics := func(t *testing.T, id uid.ID) api.DestinationMetrics {
+		t.Helper()
+		resp := doRequest(t, http.MethodGet, fmt.Sprintf("/api/destinations/%v/metrics", id), adminAccessKey(srv), nil)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		var actual api.DestinationMetrics
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &actual))
+		return actual
+	}
+	// register sends the registration of the destination with a metrics
+	// snapshot, like the connector does.
+	register := func(t *testing.T, version string, metrics *api.ConnectorMetrics) {
+		t.Helper()
+		body := api.UpdateDestinationRequest{
+			Name:     destination.Name,
+			UniqueID: destination.UniqueID,
+			Version:  version,
+			Connection: api.DestinationConnection{
+				URL: destination.ConnectionURL,
+				CA:  api.PEM(destination.ConnectionCA),
+			},
+			Resources: destination.Resources,
+			Roles:     destination.Roles,
+			Metrics:   metrics,
+		}
+		path := fmt.Sprintf("/api/destinations/%v", destination.ID)
+		resp := doRequest(t, http.MethodPut, path, connectorKey, body)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+	}
+	lag := 15.0
+
+	t.Run("no reports", func(t *testing.T) {
+		actual := getMetrics(t, destination.ID)
+		expected := api.DestinationMetrics{
+			DestinationID: destination.ID,
+			Stale:         true,
+			History:       []api.DestinationMetricsReport{},
+		}
+		assert.DeepEqual(t, actual, expected)
+	})
+
+	t.Run("report with an unchanged registration", func(t *testing.T) {
+		before, err := data.GetDestination(db, data.GetDestinationOptions{ByID: destination.ID})
+		assert.NilError(t, err)
+
+		register(t, "0.20.0", &api.ConnectorMetrics{PeriodSeconds: 60, ProxyRequests: 120, ProxyErrors: 6, SyncLagSeconds: &lag})
+		register(t, "0.20.0", &api.ConnectorMetrics{PeriodSeconds: 60, ProxyRequests: 30})
+
+		after, err := data.GetDestination(db, data.GetDestinationOptions{ByID: destination.ID})
+		assert.NilError(t, err)
+		assert.Equal(t, after.UpdateIndex, before.UpdateIndex)
+
+		actual := getMetrics(t, destination.ID)
+		assert.Equal(t, actual.Stale, false)
+		assert.Equal(t, len(actual.History), 2)
+		first := actual.History[0]
+		assert.Equal(t, first.ProxyRequests, int64(120))
+		assert.Equal(t, first.ProxyRequestRate, 2.0)
+		assert.Equal(t, first.ProxyErrorRate, 0.05)
+		assert.DeepEqual(t, first.SyncLagSeconds, &lag)
+		assert.DeepEqual(t, actual.Latest, &actual.History[1])
+		assert.Equal(t, actual.Latest.ProxyRequestRate, 0.5)
+		assert.Assert(t, actual.Latest.SyncLagSeconds == nil)
+	})
+
+	t.Run("report with a changed registration", func(t *testing.T) {
+		register(t, "0.21.0", &api.ConnectorMetrics{PeriodSeconds: 60, ProxyRequests: 60})
+
+		after, err := data.GetDestination(db, data.GetDestinationOptions{ByID: destination.ID})
+		assert.NilError(t, err)
+		assert.Equal(t, after.Version, "0.21.0")
+		assert.Equal(t, len(getMetrics(t, destination.ID).History), 3)
+	})
+
+	t.Run("missing reports are stale", func(t *testing.T) {
+		report := models.DestinationMetricsReport{
+			ReportedAt:    time.Now().Add(-10 * time.Minute),
+			PeriodSeconds: 60,
+			ProxyRequests: 600,
+		}
+		assert.NilError(t, data.AddDestinationMetricsReport(db, stale.ID, report, 10))
+
+		actual := getMetrics(t, stale.ID)
+		assert.Equal(t, actual.Stale, true)
+		// the last report is kept, instead of reporting zeros
+		assert.Equal(t, actual.Latest.ProxyRequestRate, 10.0)
+	})
+
+	// gather returns the values of the destination metrics, keyed by the name
+	// and the labels of each series.
+	gather := func(t *testing.T, orgLabel bool) map[string]float64 {
+		t.Helper()
+		registry := setupMetrics(db, orgLabel)
+		families, err := registry.Gather()
+		assert.NilError(t, err)
+
+		values := map[string]float64{}
+		for _, family := range families {
+			if !strings.HasPrefix(family.GetName(), "infra_destination_") {
+				continue
+			}
+			for _, m := range family.GetMetric() {
+				key := family.GetName()
+				for _, l := range m.GetLabel() {
+					key += " " + l.GetName() + "=" + l.GetValue()
+				}
+				values[key] = m.GetGauge().GetValue()
+			}
+		}
+		return values
+	}
+
+	t.Run("prometheus metrics", func(t *testing.T) {
+		expected := map[string]float64{
+			"infra_destination_metrics_stale destination=the-dest":      0,
+			"infra_destination_proxy_request_rate destination=the-dest": 1,
+			"infra_destination_proxy_error_rate destination=the-dest":   0,
+			"infra_destination_metrics_stale destination=stale-dest":    1,
+		}
+		assert.DeepEqual(t, gather(t, false), expected)
+	})
+
+	t.Run("prometheus metrics with org label", func(t *testing.T) {
+		org := "org=" + srv.db.DefaultOrg.ID.String()
+		expected := map[string]float64{
+			"infra_destination_metrics_stale destination=the-dest " + org:      0,
+			"infra_destination_proxy_request_rate destination=the-dest " + org: 1,
+			"infra_destination_proxy_error_rate destination=the-dest " + org:   0,
+			"infra_destination_metrics_stale destination=stale-dest " + org:    1,
+		}
+		assert.DeepEqual(t, gather(t, true), expected)
+	})
+
+	t.Run("prometheus metrics of destinations with the same name", func(t *testing.T) {
+		otherOrg := &models.Organization{Name: "other", Domain: "other.example.org"}
+		assert.NilError(t, data.CreateOrganization(db, otherOrg))
+		tx := txnForTestCase(t, db, otherOrg.ID)
+		other := &models.Destination{Name: "the-dest", Kind: "kubernetes", UniqueID: "other-dest"}
+		assert.NilError(t, data.CreateDestination(tx, other))
+		report := models.DestinationMetricsReport{
+			ReportedAt:     time.Now(),
+			PeriodSeconds:  60,
+			ProxyRequests:  60,
+			ProxyErrors:    30,
+			SyncLagSeconds: &lag,
+		}
+		assert.NilError(t, data.AddDestinationMetricsReport(tx, other.ID, report, 10))
+		assert.NilError(t, tx.Commit())
+
+		// without the org label the destinations are combined
+		expected := map[string]float64{
+			"infra_destination_metrics_stale destination=the-dest":      0,
+			"infra_destination_proxy_request_rate destination=the-dest": 2,
+			"infra_destination_proxy_error_rate destination=the-dest":   0.25,
+			"infra_destination_sync_lag_seconds destination=the-dest":   lag,
+			"infra_destination_metrics_stale destination=stale-dest":    1,
+		}
+		assert.DeepEqual(t, gather(t, false), expected)
+
+		actual := gather(t, true)
+		assert.Equal(t, len(actual), 8)
+		assert.Equal(t, actual["infra_destination_proxy_request_rate destination=the-dest org="+otherOrg.ID.String()], 1.0)
+	})
+
+	t.Run("report requires connector", func(t *testing.T) {
+		userKey, _ := createAccessKey(t, db, "someone@example.com")
+		body := api.UpdateDestinationRequest{
+			Name:       destination.Name,
+			Connection: api.DestinationConnection{CA: "the-ca"},
+			Metrics:    &api.ConnectorMetrics{PeriodSeconds: 60},
+		}
+		path := fmt.Sprintf("/api/destinations/%v", destination.ID)
+		resp := doRequest(t, http.MethodPut, path, userKey, body)
+		assert.Equal(t, resp.Code, http.StatusForbidden, resp.Body.String())
+	})
+
+	t.Run("get metrics of unknown destination", func(t *testing.T) {
+		resp := doRequest(t, http.MethodGet, "/api/destinations/1234/metrics", adminAccessKey(srv), nil)
+		assert.Equal(t, resp.Code, http.StatusNotFound, resp.Body.String())
+	})
+}
@@ -1,15 +1,22 @@
 package server
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"golang.org/x/exp/slices"
 
 	"github.com/infrahq/infra/api"
 	"github.com/infrahq/infra/internal/access"
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/internal/validate"
+	"github.com/infrahq/infra/uid"
 )
 
 func (a *API) ListDestinations(c *gin.Context, r *api.ListDestinationsRequest) (*api.ListResponse[api.Destination], error) {
@@ -74,6 +81,15 @@ func (a *API) CreateDestination(c *gin.Context, r *api.CreateDestinationRequest)
 	if err != nil {
 		return nil, fmt.Errorf("create destination: %w", err)
 	}
+	if r.Metrics != nil {
+		report := destinationMetricsReport(r.Metrics)
+		if err := access.AddDestinationMetricsReport(getRequestContext(c), destination.ID, report, destinationMetricsRetained); err != nil {
+			return nil, fmt.Errorf("add metrics report: %w", err)
+		}
+	}
+	if err := a.emitWebhookEvent(c, api.WebhookEventDestinationRegistered, destination.ToAPI()); err != nil {
+		return nil, err
+	}
 
 	return destination.ToAPI(), nil
 }
@@ -87,6 +103,19 @@ func (a *API) UpdateDestination(c *gin.Context, r *api.UpdateDestinationRequest)
 		return nil, err
 	}
 
+	if r.Metrics != nil {
+		report := destinationMetricsReport(r.Metrics)
+		if err := access.AddDestinationMetricsReport(rCtx, r.ID, report, destinationMetricsRetained); err != nil {
+			return nil, fmt.Errorf("add metrics report: %w", err)
+		}
+		// connectors send their registration with every metrics report. An
+		// unchanged registration is not saved, so that the update index only
+		// changes when the destination changes.
+		if r.UpdateIndex == 0 && registrationUnchanged(destination, r) {
+			return destination.ToAPI(), nil
+		}
+	}
+
 	destination.Name = r.Name
 	destination.UniqueID = r.UniqueID
 	destination.ConnectionURL = r.Connection.URL
@@ -95,13 +124,235 @@ func (a *API) UpdateDestination(c *gin.Context, r *api.UpdateDestinationRequest)
 	destination.Roles = r.Roles
 	destination.Version = r.Version
 
-	if err := access.UpdateDestination(rCtx, destination); err != nil {
-		return nil, fmt.Errorf("update destination: %w", err)
+	if r.UpdateIndex == 0 {
+		if err := access.UpdateDestination(rCtx, destination); err != nil {
+			return nil, fmt.Errorf("update destination: %w", err)
+		}
+		return destination.ToAPI(), nil
 	}
 
+	err = access.UpdateDestinationIfUnmodified(rCtx, destination, r.UpdateIndex)
+	switch {
+	case errors.Is(err, data.ErrUpdateConflict):
+		return nil, newUpdateConflictError(rCtx, r.ID)
+	case err != nil:
+		return nil, fmt.Errorf("update destination: %w", err)
+	}
 	return destination.ToAPI(), nil
 }
 
+// registrationUnchanged returns true when the fields of r are the same as the
+// fields of destination.
+func registrationUnchanged(destination *models.Destination, r *api.UpdateDestinationRequest) bool {
+	return destination.Name == r.Name &&
+		destination.UniqueID == r.UniqueID &&
+		destination.ConnectionURL == r.Connection.URL &&
+		destination.ConnectionCA == string(r.Connection.CA) &&
+		slices.Equal(destination.Resources, r.Resources) &&
+		slices.Equal(destination.Roles, r.Roles) &&
+		destination.Version == r.Version
+}
+
+// newUpdateConflictError returns a 409 error that includes the current state
+// of the destination, so that the client can merge its changes and try again.
+func newUpdateConflictError(rCtx access.RequestContext, id uid.ID) error {
+	current, err := data.GetDestination(rCtx.DBTxn, data.GetDestinationOptions{ByID: id})
+	if err != nil {
+		return fmt.Errorf("get destination after conflict: %w", err)
+	}
+	body, err := json.Marshal(current.ToAPI())
+	if err != nil {
+		return err
+	}
+	return api.Error{
+		Code:    http.StatusConflict,
+		Message: "destination was modified by another request, merge the changes from current and try again",
+		Current: body,
+	}
+}
+
 func (a *API) DeleteDestination(c *gin.Context, r *api.Resource) (*api.EmptyResponse, error) {
 	return nil, access.DeleteDestination(c, r.ID)
 }
+
+const (
+	// destinationLogsRetained is the number of log entries that are retained
+	// for each destination. Older entries are deleted when new ones arrive.
+	destinationLogsRetained = 1000
+	// maxDestinationLogsPerRequest limits the size of a batch of log entries
+	// sent by a connector.
+	maxDestinationLogsPerRequest = 500
+)
+
+// The logs of a destination are forwarded by connectors that have enabled log
+// forwarding, and are only readable by support admins.
+var createDestinationLogsRoute = route[api.CreateDestinationLogsRequest, *api.EmptyResponse]{
+	handler: createDestinationLogsHandler,
+	routeSettings: routeSettings{
+		omitFromDocs:      true,
+		omitFromTelemetry: true,
+		// a batch of log entries may include long lines, like stack traces
+		maxRequestBodySize: 8 << 20,
+	},
+}
+
+var listDestinationLogsRoute = route[api.ListDestinationLogsRequest, *api.ListResponse[api.DestinationLog]]{
+	handler: listDestinationLogsHandler,
+	routeSettings: routeSettings{
+		omitFromDocs:      true,
+		omitFromTelemetry: true,
+		txnOptions:        &sql.TxOptions{ReadOnly: true},
+	},
+}
+
+func createDestinationLogsHandler(c *gin.Context, r *api.CreateDestinationLogsRequest) (*api.EmptyResponse, error) {
+	roles := []string{models.InfraAdminRole, models.InfraConnectorRole}
+	db, err := access.RequireInfraRole(c, roles...)
+	if err != nil {
+		return nil, access.HandleAuthErr(err, "destination logs", "create", roles...)
+	}
+	if len(r.Logs) > maxDestinationLogsPerRequest {
+		return nil, validate.Error{"logs": {fmt.Sprintf("must have at most %d entries", maxDestinationLogsPerRequest)}}
+	}
+
+	// check the destination exists in this organization
+	if _, err := data.GetDestination(db, data.GetDestinationOptions{ByID: r.ID}); err != nil {
+		return nil, err
+	}
+
+	logs := make([]models.DestinationLog, 0, len(r.Logs)+1)
+	for _, entry := range r.Logs {
+		logs = append(logs, models.DestinationLog{
+			DestinationID: r.ID,
+			CreatedAt:     time.Time(entry.Time),
+			Level:         entry.Level,
+			Line:          entry.Line,
+		})
+	}
+	if r.Dropped > 0 {
+		logs = append(logs, models.DestinationLog{
+			DestinationID: r.ID,
+			CreatedAt:     time.Now(),
+			Level:         "warn",
+			Line:          fmt.Sprintf(`{"message":"connector dropped %d log entries"}`, r.Dropped),
+		})
+	}
+	return nil, data.CreateDestinationLogs(db, logs, destinationLogsRetained)
+}
+
+func listDestinationLogsHandler(c *gin.Context, r *api.ListDestinationLogsRequest) (*api.ListResponse[api.DestinationLog], error) {
+	db, err := access.RequireInfraRole(c, models.InfraSupportAdminRole)
+	if err != nil {
+		return nil, access.HandleAuthErr(err, "destination logs", "list", models.InfraSupportAdminRole)
+	}
+
+	p := PaginationFromRequest(r.PaginationRequest)
+	logs, err := data.ListDestinationLogs(db, data.ListDestinationLogsOptions{
+		ByDestinationID: r.ID,
+		Pagination:      &p,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := api.NewListResponse(logs, PaginationToResponse(p), func(l models.DestinationLog) api.DestinationLog {
+		return *l.ToAPI()
+	})
+	return result, nil
+}
+
+// defaultDestinationUsageDays is the number of days of usage returned when the
+// request does not set days.
+const defaultDestinationUsageDays = 30
+
+var getDestinationUsageRoute = route[api.DestinationUsageRequest, *api.DestinationUsage]{
+	handler: getDestinationUsageHandler,
+	routeSettings: routeSettings{
+		txnOptions: &sql.TxOptions{ReadOnly: true},
+	},
+}
+
+// getDestinationUsageHandler returns the daily usage of a destination, ending
+// with the current day. Days without any usage are returned with zero values,
+// so that the response always has one entry for each day.
+func getDestinationUsageHandler(c *gin.Context, r *api.DestinationUsageRequest) (*api.DestinationUsage, error) {
+	roles := []string{models.InfraAdminRole, models.InfraViewRole}
+	db, err := access.RequireInfraRole(c, roles...)
+	if err != nil {
+		return nil, access.HandleAuthErr(err, "destination usage", "get", roles...)
+	}
+
+	if _, err := data.GetDestination(db, data.GetDestinationOptions{ByID: r.ID}); err != nil {
+		return nil, err
+	}
+
+	days := r.Days
+	if days == 0 {
+		days = defaultDestinationUsageDays
+	}
+	first := models.UsageDay(time.Now()).AddDate(0, 0, -(days - 1))
+	usage, err := data.ListDestinationUsage(db, data.ListDestinationUsageOptions{
+		ByDestinationID: r.ID,
+		Since:           first,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	byDay := make(map[time.Time]models.DestinationUsage, len(usage))
+	for _, u := range usage {
+		byDay[u.Day.UTC()] = u
+	}
+	result := &api.DestinationUsage{DestinationID: r.ID}
+	for i := 0; i < days; i++ {
+		day := first.AddDate(0, 0, i)
+		u, ok := byDay[day]
+		if !ok {
+			u = models.DestinationUsage{Day: day}
+		}
+		result.Days = append(result.Days, *u.ToAPI())
+	}
+	return result, nil
+}
+
+// destinationMetricsRetained is the number of metrics reports retained for
+// each destination. Connectors report every minute, so this is about an hour
+// of history.
+const destinationMetricsRetained = 60
+
+// destinationMetricsReport returns the report of the metrics sent by a
+// connector. The time of the report is set by the server, so that the
+// staleness of the report does not depend on the clock of the connector.
+func destinationMetricsReport(m *api.ConnectorMetrics) models.DestinationMetricsReport {
+	return models.DestinationMetricsReport{
+		ReportedAt:     time.Now(),
+		PeriodSeconds:  m.PeriodSeconds,
+		ProxyRequests:  m.ProxyRequests,
+		ProxyErrors:    m.ProxyErrors,
+		SyncLagSeconds: m.SyncLagSeconds,
+	}
+}
+
+var getDestinationMetricsRoute = route[api.DestinationMetricsRequest, *api.DestinationMetrics]{
+	handler: getDestinationMetricsHandler,
+	routeSettings: routeSettings{
+		txnOptions: &sql.TxOptions{ReadOnly: true},
+	},
+}
+
+// getDestinationMetricsHandler returns the metrics recently reported by the
+// connector of a destination. When the connector stops reporting, the last
+// report is returned and the response is marked as stale.
+func getDestinationMetricsHandler(c *gin.Context, r *api.DestinationMetricsRequest) (*api.DestinationMetrics, error) {
+	roles := []string{models.InfraAdminRole, models.InfraViewRole}
+	db, err := access.RequireInfraRole(c, roles...)
+	if err != nil {
+		return nil, access.HandleAuthErr(err, "destination metrics", "get", roles...)
+	}
+
+	history, err := data.GetDestinationMetrics(db, r.ID)
+	if err != nil {
+		return nil, err
+	}
+	return history.ToAPI(r.ID, time.Now()), nil
+}
@@ -16,10 +16,31 @@ import (
 	"github.com/infrahq/infra/internal/server/models"
 )
 
-const DeviceCodeExpirySeconds = 600
+const (
+	DeviceCodeExpirySeconds = 600
+	DeviceFlowPollSeconds   = 5
+
+	// deviceFlowMinPollInterval is the shortest time between two status
+	// checks of the same request. It is a bit shorter than the poll interval
+	// to allow for latency between the requests.
+	deviceFlowMinPollInterval = (DeviceFlowPollSeconds - 1) * time.Second
+
+	// deviceFlowStartRateLimit is the number of device flows that can be
+	// started per minute for each organization.
+	deviceFlowStartRateLimit = 30
+)
 
 func (a *API) StartDeviceFlow(c *gin.Context, req *api.EmptyRequest) (*api.DeviceFlowResponse, error) {
 	rctx := getRequestContext(c)
+
+	limitKey := "deviceflow"
+	if rctx.Authenticated.Organization != nil {
+		limitKey += ":" + rctx.Authenticated.Organization.ID.String()
+	}
+	if _, err := a.server.rateLimiter.Allow(limitKey, deviceFlowStartRateLimit); err != nil {
+		return nil, err
+	}
+
 	tries := 0
 retry:
 	tries++
@@ -59,12 +80,14 @@ retry:
 		VerificationURI:     fmt.Sprintf("https://%s/device", host),
 		UserCode:            userCode[0:4] + "-" + userCode[4:],
 		ExpiresInSeconds:    DeviceCodeExpirySeconds,
-		PollIntervalSeconds: 5,
+		PollIntervalSeconds: DeviceFlowPollSeconds,
 	}, nil
 }
 
 // GetDeviceFlowStatus is an API handler for checking the status of a device
-// flow login. The response status can be pending, expired, or confirmed.
+// flow login. The response status can be pending, slow_down, expired, denied,
+// or confirmed. Denied and confirmed requests are deleted, so that they can
+// only be claimed once.
 func (a *API) GetDeviceFlowStatus(c *gin.Context, req *api.DeviceFlowStatusRequest) (*api.DeviceFlowStatusResponse, error) {
 	rctx := getRequestContext(c)
 
@@ -80,9 +103,27 @@ func (a *API) GetDeviceFlowStatus(c *gin.Context, req *api.DeviceFlowStatusReque
 		}, nil
 	}
 
+	if dfar.Denied {
+		if err := data.DeleteDeviceFlowAuthRequest(rctx.DBTxn, dfar.ID); err != nil {
+			return nil, fmt.Errorf("device flow delete auth request: %w", err)
+		}
+		return &api.DeviceFlowStatusResponse{
+			Status:     api.DeviceFlowStatusDenied,
+			DeviceCode: dfar.DeviceCode,
+		}, nil
+	}
+
 	if !dfar.Approved() {
+		now := time.Now()
+		status := api.DeviceFlowStatusPending
+		if dfar.LastPolledAt != nil && now.Sub(*dfar.LastPolledAt) < deviceFlowMinPollInterval {
+			status = api.DeviceFlowStatusSlowDown
+		}
+		if err := data.SetDeviceFlowAuthRequestLastPolledAt(rctx.DBTxn, dfar.ID, now); err != nil {
+			return nil, fmt.Errorf("device flow update last polled: %w", err)
+		}
 		return &api.DeviceFlowStatusResponse{
-			Status:     api.DeviceFlowStatusPending,
+			Status:     status,
 			DeviceCode: dfar.DeviceCode,
 		}, nil
 	}
@@ -162,9 +203,38 @@ func (a *API) ApproveDeviceFlow(c *gin.Context, req *api.ApproveDeviceFlowReques
 		return nil, internal.ErrExpired
 	}
 
+	if dfar.Denied {
+		return nil, fmt.Errorf("%w: the request was denied", internal.ErrBadRequest)
+	}
+
 	if dfar.Approved() {
 		return nil, nil
 	}
 
 	return nil, data.ApproveDeviceFlowAuthRequest(rctx.DBTxn, dfar.ID, rctx.Authenticated.User.ID, rctx.Authenticated.AccessKey.ProviderID)
 }
+
+// DenyDeviceFlow rejects a device flow login, so that the device does not
+// receive an access key.
+func (a *API) DenyDeviceFlow(c *gin.Context, req *api.DenyDeviceFlowRequest) (*api.EmptyResponse, error) {
+	rctx := getRequestContext(c)
+
+	dfar, err := data.GetDeviceFlowAuthRequest(rctx.DBTxn, data.GetDeviceFlowAuthRequestOptions{ByUserCode: strings.Replace(req.UserCode, "-", "", 1)})
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid code", internal.ErrNotFound)
+	}
+
+	if dfar.ExpiresAt.Before(time.Now()) {
+		return nil, internal.ErrExpired
+	}
+
+	if dfar.Approved() {
+		return nil, fmt.Errorf("%w: the request was already approved", internal.ErrBadRequest)
+	}
+
+	if dfar.Denied {
+		return nil, nil
+	}
+
+	return nil, data.DenyDeviceFlowAuthRequest(rctx.DBTxn, dfar.ID)
+}
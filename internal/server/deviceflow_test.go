@@ -222,3 +222,130 @@ func TestAPI_StartDeviceFlow(t *testing.T) {
 		assert.DeepEqual(t, flowResp, expected, cmpDeviceFlowResponse)
 	})
 }
+
+func TestAPI_DeviceFlow_DenyExpireAndPolling(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+
+	user := &models.Identity{Name: "joe@example.com"}
+	assert.NilError(t, data.CreateIdentity(srv.DB(), user))
+
+	scoped := &models.AccessKey{
+		IssuedFor:  user.ID,
+		ProviderID: data.InfraProvider(srv.DB()).ID,
+		ExpiresAt:  time.Now().Add(10 * time.Minute),
+		Scopes:     models.CommaSeparatedStrings{models.ScopeAllowCreateAccessKey},
+	}
+	_, err := data.CreateAccessKey(srv.DB(), scoped)
+	assert.NilError(t, err)
+
+	request := func(t *testing.T, path, accessKey string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodPost, path, jsonBody(t, body))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		if accessKey != "" {
+			req.Header.Set("Authorization", "Bearer "+accessKey)
+		}
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	start := func(t *testing.T) api.DeviceFlowResponse {
+		t.Helper()
+		resp := request(t, "/api/device", "", api.EmptyRequest{})
+		assert.Equal(t, resp.Code, http.StatusCreated, (*responseDebug)(resp))
+
+		var flow api.DeviceFlowResponse
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &flow))
+		return flow
+	}
+
+	status := func(t *testing.T, flow api.DeviceFlowResponse) *httptest.ResponseRecorder {
+		t.Helper()
+		return request(t, "/api/device/status", "", api.DeviceFlowStatusRequest{DeviceCode: flow.DeviceCode})
+	}
+
+	statusOf := func(t *testing.T, resp *httptest.ResponseRecorder) string {
+		t.Helper()
+		assert.Equal(t, resp.Code, http.StatusCreated, (*responseDebug)(resp))
+		var statusResp api.DeviceFlowStatusResponse
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &statusResp))
+		assert.Assert(t, statusResp.LoginResponse == nil)
+		return statusResp.Status
+	}
+
+	t.Run("deny", func(t *testing.T) {
+		flow := start(t)
+
+		resp := request(t, "/api/device/deny", scoped.Token(), api.DenyDeviceFlowRequest{UserCode: flow.UserCode})
+		assert.Equal(t, resp.Code, http.StatusCreated, (*responseDebug)(resp))
+
+		// denied requests can not be approved
+		resp = request(t, "/api/device/approve", scoped.Token(), api.ApproveDeviceFlowRequest{UserCode: flow.UserCode})
+		assert.Equal(t, resp.Code, http.StatusBadRequest, (*responseDebug)(resp))
+
+		assert.Equal(t, statusOf(t, status(t, flow)), api.DeviceFlowStatusDenied)
+
+		// the request is single use
+		resp = status(t, flow)
+		assert.Equal(t, resp.Code, http.StatusUnauthorized, (*responseDebug)(resp))
+	})
+
+	t.Run("deny after approve", func(t *testing.T) {
+		flow := start(t)
+
+		resp := request(t, "/api/device/approve", scoped.Token(), api.ApproveDeviceFlowRequest{UserCode: flow.UserCode})
+		assert.Equal(t, resp.Code, http.StatusCreated, (*responseDebug)(resp))
+
+		resp = request(t, "/api/device/deny", scoped.Token(), api.DenyDeviceFlowRequest{UserCode: flow.UserCode})
+		assert.Equal(t, resp.Code, http.StatusBadRequest, (*responseDebug)(resp))
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		flow := start(t)
+		_, err := srv.DB().Exec(`UPDATE device_flow_auth_requests SET expires_at = ? WHERE device_code = ?`,
+			time.Now().Add(-time.Minute), flow.DeviceCode)
+		assert.NilError(t, err)
+
+		assert.Equal(t, statusOf(t, status(t, flow)), api.DeviceFlowStatusExpired)
+
+		resp := request(t, "/api/device/approve", scoped.Token(), api.ApproveDeviceFlowRequest{UserCode: flow.UserCode})
+		assert.Equal(t, resp.Code, http.StatusGone, (*responseDebug)(resp))
+
+		resp = request(t, "/api/device/deny", scoped.Token(), api.DenyDeviceFlowRequest{UserCode: flow.UserCode})
+		assert.Equal(t, resp.Code, http.StatusGone, (*responseDebug)(resp))
+	})
+
+	t.Run("polling too fast", func(t *testing.T) {
+		flow := start(t)
+
+		assert.Equal(t, statusOf(t, status(t, flow)), api.DeviceFlowStatusPending)
+		assert.Equal(t, statusOf(t, status(t, flow)), api.DeviceFlowStatusSlowDown)
+
+		_, err := srv.DB().Exec(`UPDATE device_flow_auth_requests SET last_polled_at = ? WHERE device_code = ?`,
+			time.Now().Add(-time.Duration(flow.PollIntervalSeconds)*time.Second), flow.DeviceCode)
+		assert.NilError(t, err)
+		assert.Equal(t, statusOf(t, status(t, flow)), api.DeviceFlowStatusPending)
+	})
+
+	t.Run("starting flows is rate limited", func(t *testing.T) {
+		srv := setupServer(t)
+		routes := srv.GenerateRoutes()
+
+		var resp *httptest.ResponseRecorder
+		for i := 0; i <= deviceFlowStartRateLimit; i++ {
+			// nolint:noctx
+			req := httptest.NewRequest(http.MethodPost, "/api/device", nil)
+			req.Header.Set("Infra-Version", apiVersionLatest)
+			resp = httptest.NewRecorder()
+			routes.ServeHTTP(resp, req)
+			if i < deviceFlowStartRateLimit {
+				assert.Equal(t, resp.Code, http.StatusCreated, (*responseDebug)(resp))
+			}
+		}
+		assert.Equal(t, resp.Code, http.StatusTooManyRequests, (*responseDebug)(resp))
+		assert.Assert(t, resp.Header().Get("Retry-After") != "")
+	})
+}
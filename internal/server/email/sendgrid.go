@@ -108,7 +108,7 @@ func SendTemplate(name, address string, template EmailTemplate, data any, bypass
 	msg.HTMLBody = w.Bytes()
 
 	if TestMode {
-		logging.Debugf("sent email to %q: %+v\n", address, data)
+		logging.L.Debug().Str("to", address).Interface("data", data).Msg("sent email in test mode")
 		logging.Debugf("plain: %s", string(msg.PlainBody))
 		logging.Debugf("html: %s", string(msg.HTMLBody))
 		TestDataSent = append(TestDataSent, data)
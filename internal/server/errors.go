@@ -4,21 +4,29 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"sort"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
 
 	"github.com/infrahq/infra/api"
 	"github.com/infrahq/infra/internal"
 	"github.com/infrahq/infra/internal/access"
 	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/server/authn"
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/redis"
 	"github.com/infrahq/infra/internal/validate"
 )
 
+// repeatedErrors samples the log lines for errors that are likely to repeat for
+// every request.
+var repeatedErrors = logging.NewRepeatSampler(10, time.Minute)
+
 // sendAPIError translates err into the appropriate HTTP status code, builds a
 // response body using api.Error, then sends both as a response to the active
 // request.
@@ -32,9 +40,13 @@ func sendAPIError(c *gin.Context, err error) {
 	var uniqueConstraintError data.UniqueConstraintError
 	var overLimitError redis.OverLimitError
 	var authnError AuthenticationError
+	var lockedError authn.AccountLockedError
+	var maxBytesError *http.MaxBytesError
 	var apiError api.Error
 
-	log := logging.L.Debug()
+	// the request scoped logger includes the method and path of the request
+	logger := logging.FromContext(c.Request.Context())
+	log := logger.Debug()
 
 	switch {
 	case errors.As(err, &apiError):
@@ -46,7 +58,7 @@ func sendAPIError(c *gin.Context, err error) {
 		// hide the error text, it may contain sensitive information
 		resp.Message = "unauthorized"
 		// log the error at info because it is not in the response
-		log = logging.L.Info()
+		log = logger.Info()
 
 	case errors.As(err, &authnError):
 		resp.Code = http.StatusUnauthorized
@@ -70,10 +82,12 @@ func sendAPIError(c *gin.Context, err error) {
 
 	case errors.As(err, &validationError):
 		resp.Code = http.StatusBadRequest
+		resp.ErrorCode = api.ErrorCodeValidationFailed
 		resp.Message = err.Error()
 		for name, problems := range validationError {
 			resp.FieldErrors = append(resp.FieldErrors, api.FieldError{
 				FieldName: name,
+				ErrorCode: fieldErrorCode(problems),
 				Errors:    problems,
 			})
 		}
@@ -89,16 +103,30 @@ func sendAPIError(c *gin.Context, err error) {
 		resp.Code = http.StatusBadRequest
 		resp.Message = err.Error()
 
+	case errors.As(err, &maxBytesError):
+		resp.Code = http.StatusRequestEntityTooLarge
+		resp.Message = fmt.Sprintf("request body is larger than the limit of %d bytes", maxBytesError.Limit)
+
 	case errors.Is(err, internal.ErrNotModified):
 		resp.Code = http.StatusNotModified
 		resp.Message = err.Error()
 
+	case errors.Is(err, internal.ErrPreconditionFailed):
+		resp.Code = http.StatusPreconditionFailed
+		resp.Message = err.Error()
+
 	case errors.Is(err, internal.ErrBadGateway):
 		resp.Code = http.StatusBadGateway
 		resp.Message = err.Error()
 
+	case errors.As(err, &lockedError):
+		c.Writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockedError.RetryAfter.Seconds()))))
+		resp.Code = http.StatusForbidden
+		resp.ErrorCode = api.ErrorCodeAccountLocked
+		resp.Message = lockedError.Error()
+
 	case errors.As(err, &overLimitError):
-		c.Writer.Header().Set("Retry-After", strconv.Itoa(int(overLimitError.RetryAfter.Seconds())))
+		c.Writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(overLimitError.RetryAfter.Seconds()))))
 		resp.Code = http.StatusTooManyRequests
 		resp.Message = err.Error()
 
@@ -111,18 +139,43 @@ func sendAPIError(c *gin.Context, err error) {
 		resp.Code = 499
 		resp.Message = fmt.Sprintf("client closed the request: %v", err)
 
+	case data.IsStatementTimeout(err):
+		resp.Code = http.StatusServiceUnavailable
+		resp.Message = "request timed out waiting for the database"
+
+	case data.IsConnectionError(err):
+		// every request fails with the same error while the database is
+		// unavailable, so sample the log lines
+		log = repeatedErrors.Event(logger, zerolog.ErrorLevel, "db-connection")
+
 	default:
-		log = logging.L.Error()
+		log = logger.Error()
+	}
+
+	if resp.ErrorCode == "" {
+		resp.ErrorCode = errorCodeForStatus(resp.Code)
 	}
 
 	log.CallerSkipFrame(1).
+		Stack().
 		Err(err).
-		Str("method", c.Request.Method).
-		Str("path", c.Request.URL.Path).
 		Int32("statusCode", resp.Code).
-		Str("remoteAddr", c.Request.RemoteAddr).
+		Str("remoteAddr", logging.ClientIP(c.Request.Context())).
 		Msg("api request error")
 
+	if c.Writer.Written() {
+		// the handler already started streaming the response, the error can
+		// not be sent.
+		c.Abort()
+		return
+	}
+	if resp.Code != http.StatusNotModified && resp.Code != http.StatusPreconditionFailed {
+		// an ETag set by the handler only describes a successful response,
+		// except for a failed precondition, where it describes the current
+		// version of the resource.
+		c.Writer.Header().Del("ETag")
+	}
+
 	c.JSON(int(resp.Code), resp)
 	c.Abort()
 }
@@ -134,11 +187,60 @@ func newAPIErrorForUniqueConstraintError(ucErr data.UniqueConstraintError, msg s
 	}
 	apiError.FieldErrors = []api.FieldError{{
 		FieldName: ucErr.Column,
+		ErrorCode: api.ErrorCodeAlreadyExists,
 		Errors:    []string{ucErr.Error()},
 	}}
 	return apiError
 }
 
+// errorCodeForStatus returns the api.ErrorCode for an error response with
+// the HTTP status code.
+func errorCodeForStatus(code int32) api.ErrorCode {
+	switch code {
+	case http.StatusBadRequest:
+		return api.ErrorCodeBadRequest
+	case http.StatusUnauthorized:
+		return api.ErrorCodeUnauthorized
+	case http.StatusForbidden:
+		return api.ErrorCodeForbidden
+	case http.StatusNotFound:
+		return api.ErrorCodeNotFound
+	case http.StatusConflict:
+		return api.ErrorCodeConflict
+	case http.StatusPreconditionFailed:
+		return api.ErrorCodePreconditionFailed
+	case http.StatusGone:
+		return api.ErrorCodeExpired
+	case http.StatusRequestEntityTooLarge:
+		return api.ErrorCodeRequestTooLarge
+	case http.StatusTooManyRequests:
+		return api.ErrorCodeRateLimited
+	case 499:
+		return api.ErrorCodeCanceled
+	case http.StatusBadGateway:
+		return api.ErrorCodeBadGateway
+	case http.StatusServiceUnavailable:
+		return api.ErrorCodeUnavailable
+	case http.StatusGatewayTimeout:
+		return api.ErrorCodeTimeout
+	}
+	if code >= http.StatusInternalServerError {
+		return api.ErrorCodeInternal
+	}
+	return ""
+}
+
+// fieldErrorCode returns the api.ErrorCode of a field that failed validation
+// with problems.
+func fieldErrorCode(problems []string) api.ErrorCode {
+	for _, problem := range problems {
+		if problem == validate.ProblemRequired {
+			return api.ErrorCodeRequired
+		}
+	}
+	return api.ErrorCodeInvalid
+}
+
 // AuthenticationError is used to respond with a 401 Unauthorized response code.
 // Unlike internal.ErrUnauthorized, AuthenticationError includes an error message
 // in the response.
@@ -4,19 +4,26 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"syscall"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
 	"gotest.tools/v3/assert"
 
 	"github.com/infrahq/infra/api"
 	"github.com/infrahq/infra/internal"
 	"github.com/infrahq/infra/internal/access"
 	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
 	"github.com/infrahq/infra/internal/validate"
+	"github.com/infrahq/infra/uid"
 )
 
 func TestSendAPIError(t *testing.T) {
@@ -27,44 +34,61 @@ func TestSendAPIError(t *testing.T) {
 	}{
 		{
 			err:    internal.ErrBadRequest,
-			result: api.Error{Code: http.StatusBadRequest, Message: "bad request"},
+			result: api.Error{Code: http.StatusBadRequest, ErrorCode: api.ErrorCodeBadRequest, Message: "bad request"},
 		},
 		{
 			err: fmt.Errorf("not right: %w", internal.ErrBadRequest),
 			result: api.Error{
-				Code:    http.StatusBadRequest,
-				Message: "not right: bad request",
+				Code:      http.StatusBadRequest,
+				ErrorCode: api.ErrorCodeBadRequest,
+				Message:   "not right: bad request",
 			},
 		},
 		{
 			err:    internal.ErrUnauthorized,
-			result: api.Error{Code: http.StatusUnauthorized, Message: "unauthorized"},
+			result: api.Error{Code: http.StatusUnauthorized, ErrorCode: api.ErrorCodeUnauthorized, Message: "unauthorized"},
 		},
 		{
 			err:    AuthenticationError{Message: "this message is ok"},
-			result: api.Error{Code: http.StatusUnauthorized, Message: "this message is ok"},
+			result: api.Error{Code: http.StatusUnauthorized, ErrorCode: api.ErrorCodeUnauthorized, Message: "this message is ok"},
 		},
 		{
 			err: validate.Error{"fieldname": []string{"is required"}},
 			result: api.Error{
-				Code:    http.StatusBadRequest,
-				Message: "validation failed: fieldname: is required",
+				Code:      http.StatusBadRequest,
+				ErrorCode: api.ErrorCodeValidationFailed,
+				Message:   "validation failed: fieldname: is required",
 				FieldErrors: []api.FieldError{
-					{FieldName: "fieldname", Errors: []string{"is required"}},
+					{FieldName: "fieldname", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
+				},
+			},
+		},
+		{
+			err: validate.Error{
+				"name":  []string{"is required"},
+				"email": []string{"invalid email address"},
+			},
+			result: api.Error{
+				Code:      http.StatusBadRequest,
+				ErrorCode: api.ErrorCodeValidationFailed,
+				// the order of fields in the message is not stable
+				FieldErrors: []api.FieldError{
+					{FieldName: "email", ErrorCode: api.ErrorCodeInvalid, Errors: []string{"invalid email address"}},
+					{FieldName: "name", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
 				},
 			},
 		},
 		{
 			err:    fmt.Errorf("hide this: %w", internal.ErrUnauthorized),
-			result: api.Error{Code: http.StatusUnauthorized, Message: "unauthorized"},
+			result: api.Error{Code: http.StatusUnauthorized, ErrorCode: api.ErrorCodeUnauthorized, Message: "unauthorized"},
 		},
 		{
 			err:    data.ErrAccessKeyExpired,
-			result: api.Error{Code: http.StatusUnauthorized, Message: "unauthorized: " + data.ErrAccessKeyExpired.Error()},
+			result: api.Error{Code: http.StatusUnauthorized, ErrorCode: api.ErrorCodeUnauthorized, Message: "unauthorized: " + data.ErrAccessKeyExpired.Error()},
 		},
 		{
 			err:    data.ErrAccessInactivityTimeout,
-			result: api.Error{Code: http.StatusUnauthorized, Message: "unauthorized: " + data.ErrAccessInactivityTimeout.Error()},
+			result: api.Error{Code: http.StatusUnauthorized, ErrorCode: api.ErrorCodeUnauthorized, Message: "unauthorized: " + data.ErrAccessInactivityTimeout.Error()},
 		},
 		{
 			err: access.AuthorizationError{
@@ -73,29 +97,32 @@ func TestSendAPIError(t *testing.T) {
 				RequiredRoles: []string{"admin"},
 			},
 			result: api.Error{
-				Code:    http.StatusForbidden,
-				Message: "you do not have permission to create provider, requires role admin",
+				Code:      http.StatusForbidden,
+				ErrorCode: api.ErrorCodeForbidden,
+				Message:   "you do not have permission to create provider, requires role admin",
 			},
 		},
 		{
 			err: fmt.Errorf("wrapped: %w", access.ErrNotAuthorized),
 			result: api.Error{
-				Code:    http.StatusForbidden,
-				Message: "wrapped: not authorized",
+				Code:      http.StatusForbidden,
+				ErrorCode: api.ErrorCodeForbidden,
+				Message:   "wrapped: not authorized",
 			},
 		},
 		{
 			err:    internal.ErrNotFound,
-			result: api.Error{Code: http.StatusNotFound, Message: "record not found"},
+			result: api.Error{Code: http.StatusNotFound, ErrorCode: api.ErrorCodeNotFound, Message: "record not found"},
 		},
 		{
 			err: fmt.Errorf("with context: %w",
 				data.UniqueConstraintError{Table: "user", Column: "name"}),
 			result: api.Error{
-				Code:    http.StatusConflict,
-				Message: "with context: a user with that name already exists",
+				Code:      http.StatusConflict,
+				ErrorCode: api.ErrorCodeConflict,
+				Message:   "with context: a user with that name already exists",
 				FieldErrors: []api.FieldError{
-					{FieldName: "name", Errors: []string{"a user with that name already exists"}},
+					{FieldName: "name", ErrorCode: api.ErrorCodeAlreadyExists, Errors: []string{"a user with that name already exists"}},
 				},
 			},
 		},
@@ -120,18 +147,47 @@ func TestSendAPIError(t *testing.T) {
 			result:            api.Error{Code: http.StatusNotModified},
 			emptyResponseBody: true,
 		},
+		{
+			err: fmt.Errorf("%w: the resource was modified", internal.ErrPreconditionFailed),
+			result: api.Error{
+				Code:      http.StatusPreconditionFailed,
+				ErrorCode: api.ErrorCodePreconditionFailed,
+				Message:   "precondition failed: the resource was modified",
+			},
+		},
 		{
 			err: fmt.Errorf("wrapped: %w", context.DeadlineExceeded),
 			result: api.Error{
-				Code:    http.StatusGatewayTimeout,
-				Message: "request timed out",
+				Code:      http.StatusGatewayTimeout,
+				ErrorCode: api.ErrorCodeTimeout,
+				Message:   "request timed out",
 			},
 		},
 		{
 			err: fmt.Errorf("wrapped: %w", context.Canceled),
 			result: api.Error{
-				Code:    499,
-				Message: "client closed the request: wrapped: context canceled",
+				Code:      499,
+				ErrorCode: api.ErrorCodeCanceled,
+				Message:   "client closed the request: wrapped: context canceled",
+			},
+		},
+		{
+			err: fmt.Errorf("list grants: %w", &pgconn.PgError{
+				Code:    pgerrcode.QueryCanceled,
+				Message: "canceling statement due to statement timeout",
+			}),
+			result: api.Error{
+				Code:      http.StatusServiceUnavailable,
+				ErrorCode: api.ErrorCodeUnavailable,
+				Message:   "request timed out waiting for the database",
+			},
+		},
+		{
+			err: fmt.Errorf("list grants: %w", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}),
+			result: api.Error{
+				Code:      http.StatusInternalServerError,
+				ErrorCode: api.ErrorCodeInternal,
+				Message:   "internal server error",
 			},
 		},
 	}
@@ -160,9 +216,72 @@ func TestSendAPIError(t *testing.T) {
 			assert.NilError(t, err)
 
 			assert.Equal(t, test.result.Code, actual.Code)
-			assert.Equal(t, test.result.Message, actual.Message)
+			assert.Equal(t, test.result.ErrorCode, actual.ErrorCode)
+			if test.result.Message != "" {
+				assert.Equal(t, test.result.Message, actual.Message)
+			}
 
 			assert.DeepEqual(t, test.result.FieldErrors, actual.FieldErrors)
 		})
 	}
 }
+
+func TestAPI_ErrorCodes(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+
+	existing := &models.Group{Name: "existing"}
+	err := data.CreateGroup(srv.DB(), existing)
+	assert.NilError(t, err)
+
+	send := func(t *testing.T, method, path string, body any) api.Error {
+		t.Helper()
+		var reqBody io.Reader
+		if body != nil {
+			reqBody = jsonBody(t, body)
+		}
+		// nolint:noctx
+		req := httptest.NewRequest(method, path, reqBody)
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+
+		var apiError api.Error
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &apiError))
+		assert.Equal(t, apiError.Code, int32(resp.Code))
+		return apiError
+	}
+
+	t.Run("not found", func(t *testing.T) {
+		apiError := send(t, http.MethodGet, "/api/users/"+uid.New().String(), nil)
+		assert.Equal(t, apiError.Code, int32(http.StatusNotFound))
+		assert.Equal(t, apiError.ErrorCode, api.ErrorCodeNotFound)
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		apiError := send(t, http.MethodPost, "/api/groups", api.CreateGroupRequest{Name: existing.Name})
+		assert.Equal(t, apiError.Code, int32(http.StatusConflict))
+		assert.Equal(t, apiError.ErrorCode, api.ErrorCodeConflict)
+		assert.DeepEqual(t, apiError.FieldErrors, []api.FieldError{{
+			FieldName: "name",
+			ErrorCode: api.ErrorCodeAlreadyExists,
+			Errors:    []string{"a group with that name already exists"},
+		}})
+	})
+
+	t.Run("validation failed", func(t *testing.T) {
+		apiError := send(t, http.MethodPost, "/api/grants", api.GrantRequest{})
+		assert.Equal(t, apiError.Code, int32(http.StatusBadRequest))
+		assert.Equal(t, apiError.ErrorCode, api.ErrorCodeValidationFailed)
+		assert.DeepEqual(t, apiError.FieldErrors, []api.FieldError{
+			{
+				FieldName: "",
+				ErrorCode: api.ErrorCodeInvalid,
+				Errors:    []string{"one of (user, userName, group, groupName) is required"},
+			},
+			{FieldName: "privilege", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
+			{FieldName: "resource", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
+		})
+	})
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/internal"
+)
+
+// setETag sets the ETag of the response to a weak entity tag built from
+// updateIndex. The Cache-Control header is set so that a client or proxy
+// revalidates the response before using a cached copy.
+//
+// setETag returns internal.ErrNotModified when the If-None-Match header of the
+// request matches the ETag. A handler should call setETag before loading the
+// resource, so that the query can be skipped when the client already has the
+// latest version.
+func setETag(c *gin.Context, updateIndex int64) error {
+	if c.Request.Method != http.MethodGet {
+		return nil
+	}
+
+	etag := weakETag(updateIndex)
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "no-cache")
+
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		return internal.ErrNotModified
+	}
+	return nil
+}
+
+func weakETag(updateIndex int64) string {
+	return `W/"` + strconv.FormatInt(updateIndex, 10) + `"`
+}
+
+// hasIfMatch returns true if the request has an If-Match header, which means
+// the update must only be applied to the version of the resource that was read
+// by the client.
+func hasIfMatch(c *gin.Context) bool {
+	return c.Request != nil && c.GetHeader("If-Match") != ""
+}
+
+// checkIfMatch returns an error that wraps internal.ErrPreconditionFailed when
+// the If-Match header of the request does not match etag, the entity tag of the
+// current version of the resource. A request without an If-Match header always
+// passes the check.
+//
+// Every ETag set by the server is a weak entity tag, so If-Match uses weak
+// comparison instead of the strong comparison required by RFC 9110 section
+// 13.1.1.
+func checkIfMatch(c *gin.Context, etag string) error {
+	if !hasIfMatch(c) || etagMatches(c.GetHeader("If-Match"), etag) {
+		return nil
+	}
+	return newPreconditionFailedError(c, etag)
+}
+
+// newPreconditionFailedError sets the ETag of the response to etag, the
+// entity tag of the current version of the resource, so that the client can
+// fetch the resource again, merge its changes, and retry.
+func newPreconditionFailedError(c *gin.Context, etag string) error {
+	c.Header("ETag", etag)
+	return fmt.Errorf("%w: the resource was modified by another request, the current ETag is %v",
+		internal.ErrPreconditionFailed, etag)
+}
+
+// etagMatches returns true if any of the entity tags in the value of an
+// If-None-Match or If-Match header are equal to etag. The comparison is weak,
+// so the W/ prefix is ignored. See RFC 9110 section 13.1.2.
+func etagMatches(header string, etag string) bool {
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
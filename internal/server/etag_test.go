@@ -0,0 +1,256 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestETagMatches(t *testing.T) {
+	etag := weakETag(10042)
+	assert.Equal(t, etag, `W/"10042"`)
+
+	testCases := []struct {
+		ifNoneMatch string
+		expected    bool
+	}{
+		{ifNoneMatch: "", expected: false},
+		{ifNoneMatch: `W/"10042"`, expected: true},
+		{ifNoneMatch: `"10042"`, expected: true},
+		{ifNoneMatch: `W/"10041"`, expected: false},
+		{ifNoneMatch: `W/"1", W/"10042"`, expected: true},
+		{ifNoneMatch: `W/"1",W/"2"`, expected: false},
+		{ifNoneMatch: `*`, expected: true},
+		{ifNoneMatch: `10042`, expected: false},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, etagMatches(tc.ifNoneMatch, etag), tc.expected, "If-None-Match: %v", tc.ifNoneMatch)
+	}
+}
+
+func TestAPI_GrantsETag(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+
+	user := &models.Identity{Name: "etag@example.com"}
+	assert.NilError(t, data.CreateIdentity(srv.DB(), user))
+
+	grant := &models.Grant{
+		Subject:   uid.NewIdentityPolymorphicID(user.ID),
+		Privilege: "view",
+		Resource:  "example",
+	}
+	assert.NilError(t, data.CreateGrant(srv.DB(), grant))
+
+	get := func(t *testing.T, path string, ifNoneMatch string) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("list grants", func(t *testing.T) {
+		resp := get(t, "/api/grants?resource=example", "")
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		etag := resp.Header().Get("ETag")
+		assert.Assert(t, etag != "")
+		assert.Equal(t, resp.Header().Get("Cache-Control"), "no-cache")
+
+		resp = get(t, "/api/grants?resource=example", etag)
+		assert.Equal(t, resp.Code, http.StatusNotModified, resp.Body.String())
+		assert.Equal(t, resp.Body.Len(), 0)
+		assert.Equal(t, resp.Header().Get("ETag"), etag)
+
+		// a change to any grant in the org changes the ETag
+		other := &models.Grant{
+			Subject:   uid.NewIdentityPolymorphicID(user.ID),
+			Privilege: "edit",
+			Resource:  "example",
+		}
+		assert.NilError(t, data.CreateGrant(srv.DB(), other))
+
+		resp = get(t, "/api/grants?resource=example", etag)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		assert.Assert(t, resp.Header().Get("ETag") != etag)
+	})
+
+	t.Run("list grants after delete", func(t *testing.T) {
+		resp := get(t, "/api/grants", "")
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		etag := resp.Header().Get("ETag")
+
+		toDelete := &models.Grant{
+			Subject:   uid.NewIdentityPolymorphicID(user.ID),
+			Privilege: "admin",
+			Resource:  "example",
+		}
+		assert.NilError(t, data.CreateGrant(srv.DB(), toDelete))
+		assert.NilError(t, data.DeleteGrants(srv.DB(), data.DeleteGrantsOptions{ByID: toDelete.ID}))
+
+		resp = get(t, "/api/grants", etag)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		assert.Assert(t, resp.Header().Get("ETag") != etag)
+	})
+
+	t.Run("list inherited grants has no ETag", func(t *testing.T) {
+		resp := get(t, "/api/grants?showInherited=1&user="+user.ID.String(), `*`)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		assert.Equal(t, resp.Header().Get("ETag"), "")
+	})
+
+	t.Run("get grant", func(t *testing.T) {
+		path := "/api/grants/" + grant.ID.String()
+		resp := get(t, path, "")
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		etag := resp.Header().Get("ETag")
+		created, err := data.GetGrant(srv.DB(), data.GetGrantOptions{ByID: grant.ID})
+		assert.NilError(t, err)
+		assert.Equal(t, etag, weakETag(created.UpdateIndex))
+
+		resp = get(t, path, etag)
+		assert.Equal(t, resp.Code, http.StatusNotModified, resp.Body.String())
+
+		grant.Privilege = "connect"
+		assert.NilError(t, data.UpdateGrant(srv.DB(), grant))
+
+		resp = get(t, path, etag)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		assert.Equal(t, resp.Header().Get("ETag"), weakETag(grant.UpdateIndex))
+	})
+}
+
+func TestAPI_IfMatch(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+
+	user := &models.Identity{Name: "if-match@example.com"}
+	assert.NilError(t, data.CreateIdentity(srv.DB(), user))
+
+	grant := &models.Grant{
+		Subject:   uid.NewIdentityPolymorphicID(user.ID),
+		Privilege: "view",
+		Resource:  "example",
+	}
+	assert.NilError(t, data.CreateGrant(srv.DB(), grant))
+
+	request := func(t *testing.T, method, path, body, ifMatch string) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	expectPreconditionFailed := func(t *testing.T, resp *httptest.ResponseRecorder, currentETag string) {
+		t.Helper()
+		assert.Equal(t, resp.Code, http.StatusPreconditionFailed, resp.Body.String())
+		assert.Equal(t, resp.Header().Get("ETag"), currentETag)
+
+		var respBody api.Error
+		assert.NilError(t, json.NewDecoder(resp.Body).Decode(&respBody))
+		assert.Equal(t, respBody.ErrorCode, api.ErrorCodePreconditionFailed)
+	}
+
+	t.Run("patch grant", func(t *testing.T) {
+		path := "/api/grants/" + grant.ID.String()
+		resp := request(t, http.MethodGet, path, "", "")
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		etag := resp.Header().Get("ETag")
+
+		// matching precondition
+		resp = request(t, http.MethodPatch, path, `{"privilege": "edit"}`, etag)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		current, err := data.GetGrant(srv.DB(), data.GetGrantOptions{ByID: grant.ID})
+		assert.NilError(t, err)
+		assert.Equal(t, current.Privilege, "edit")
+		currentETag := weakETag(current.UpdateIndex)
+		assert.Assert(t, currentETag != etag)
+
+		// stale precondition
+		resp = request(t, http.MethodPatch, path, `{"privilege": "admin"}`, etag)
+		expectPreconditionFailed(t, resp, currentETag)
+
+		current, err = data.GetGrant(srv.DB(), data.GetGrantOptions{ByID: grant.ID})
+		assert.NilError(t, err)
+		assert.Equal(t, current.Privilege, "edit")
+
+		// absent precondition
+		resp = request(t, http.MethodPatch, path, `{"privilege": "admin"}`, "")
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		current, err = data.GetGrant(srv.DB(), data.GetGrantOptions{ByID: grant.ID})
+		assert.NilError(t, err)
+		assert.Equal(t, current.Privilege, "admin")
+	})
+
+	t.Run("patch user", func(t *testing.T) {
+		path := "/api/users/" + user.ID.String()
+		resp := request(t, http.MethodGet, path, "", "")
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		etag := resp.Header().Get("ETag")
+		assert.Assert(t, etag != "")
+
+		resp = request(t, http.MethodGet, path, "", "")
+		assert.Equal(t, resp.Header().Get("ETag"), etag)
+
+		// matching precondition
+		resp = request(t, http.MethodPatch, path, `{"sshLoginName": "ifmatch1"}`, etag)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		current, err := data.GetIdentity(srv.DB(), data.GetIdentityOptions{ByID: user.ID})
+		assert.NilError(t, err)
+		assert.Equal(t, current.SSHLoginName, "ifmatch1")
+		currentETag := weakETag(userETagVersion(current))
+		assert.Assert(t, currentETag != etag)
+
+		// stale precondition
+		resp = request(t, http.MethodPatch, path, `{"sshLoginName": "ifmatch2"}`, etag)
+		expectPreconditionFailed(t, resp, currentETag)
+
+		current, err = data.GetIdentity(srv.DB(), data.GetIdentityOptions{ByID: user.ID})
+		assert.NilError(t, err)
+		assert.Equal(t, current.SSHLoginName, "ifmatch1")
+
+		// absent precondition
+		resp = request(t, http.MethodPatch, path, `{"sshLoginName": "ifmatch3"}`, "")
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		current, err = data.GetIdentity(srv.DB(), data.GetIdentityOptions{ByID: user.ID})
+		assert.NilError(t, err)
+		assert.Equal(t, current.SSHLoginName, "ifmatch3")
+	})
+
+	t.Run("put user with stale precondition", func(t *testing.T) {
+		path := "/api/users/" + user.ID.String()
+		resp := request(t, http.MethodPut, path, `{"password": "new-password-123"}`, `W/"1"`)
+
+		current, err := data.GetIdentity(srv.DB(), data.GetIdentityOptions{ByID: user.ID})
+		assert.NilError(t, err)
+		expectPreconditionFailed(t, resp, weakETag(userETagVersion(current)))
+	})
+}
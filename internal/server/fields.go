@@ -0,0 +1,150 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/infrahq/infra/internal/validate"
+)
+
+type hasFieldSelection interface {
+	SelectedFields() []string
+}
+
+// fieldSelection describes the fields selected by a request that embeds
+// api.FieldsRequest.
+type fieldSelection struct {
+	fields []string
+	// list is true when the fields are the fields of the items of a list
+	// response.
+	list bool
+}
+
+// fieldSelectionFromRequest returns the fields selected by req, or nil if req
+// does not select fields. The fields are validated against the JSON field
+// names of the response type Res, and an unknown field is a validation error.
+func fieldSelectionFromRequest[Res any](req any) (*fieldSelection, error) {
+	r, ok := req.(hasFieldSelection)
+	if !ok {
+		return nil, nil
+	}
+	fields := r.SelectedFields()
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	selection := &fieldSelection{fields: fields}
+	respType := indirectType(reflect.TypeOf((*Res)(nil)).Elem())
+	if items, ok := respType.FieldByName("Items"); ok && items.Type.Kind() == reflect.Slice {
+		selection.list = true
+		respType = indirectType(items.Type.Elem())
+	}
+
+	known := jsonFieldNames(respType)
+	var problems []string
+	for _, field := range fields {
+		if _, ok := known[field]; !ok {
+			problems = append(problems, fmt.Sprintf("unknown field %q", field))
+		}
+	}
+	if len(problems) > 0 {
+		names := make([]string, 0, len(known))
+		for name := range known {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		problems = append(problems, "must be one of ("+strings.Join(names, ", ")+")")
+		return nil, validate.Error{"fields": problems}
+	}
+	return selection, nil
+}
+
+// apply returns the JSON object of resp with only the selected fields. For a
+// list response the fields of each item are selected, and the other fields of
+// the response, like pagination, are unchanged.
+func (s fieldSelection) apply(resp any) (any, error) {
+	raw, err := json.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.list {
+		return s.selectFields(raw)
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, err
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(body["items"], &items); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]any, len(body))
+	for k, v := range body {
+		result[k] = v
+	}
+	selected := make([]map[string]json.RawMessage, 0, len(items))
+	for _, item := range items {
+		obj, err := s.selectFields(item)
+		if err != nil {
+			return nil, err
+		}
+		selected = append(selected, obj)
+	}
+	result["items"] = selected
+	return result, nil
+}
+
+func (s fieldSelection) selectFields(raw json.RawMessage) (map[string]json.RawMessage, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, err
+	}
+	result := make(map[string]json.RawMessage, len(s.fields))
+	for _, field := range s.fields {
+		if value, ok := obj[field]; ok {
+			result[field] = value
+		}
+	}
+	return result, nil
+}
+
+// jsonFieldNames returns the names of the fields of the struct type t as they
+// appear in JSON. Fields of embedded structs are included.
+func jsonFieldNames(t reflect.Type) map[string]struct{} {
+	names := make(map[string]struct{})
+	if t.Kind() != reflect.Struct {
+		return names
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch {
+		case name == "-":
+			continue
+		case field.Anonymous && name == "":
+			for embedded := range jsonFieldNames(indirectType(field.Type)) {
+				names[embedded] = struct{}{}
+			}
+			continue
+		case !field.IsExported():
+			continue
+		case name == "":
+			name = field.Name
+		}
+		names[name] = struct{}{}
+	}
+	return names
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gocmp "github.com/google/go-cmp/cmp"
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/internal/validate"
+)
+
+func TestFieldSelectionFromRequest(t *testing.T) {
+	t.Run("no fields", func(t *testing.T) {
+		selection, err := fieldSelectionFromRequest[api.User](&api.GetUserRequest{})
+		assert.NilError(t, err)
+		assert.Assert(t, selection == nil)
+	})
+	t.Run("request without field selection", func(t *testing.T) {
+		selection, err := fieldSelectionFromRequest[api.User](&api.Resource{})
+		assert.NilError(t, err)
+		assert.Assert(t, selection == nil)
+	})
+	t.Run("object response", func(t *testing.T) {
+		req := &api.GetUserRequest{FieldsRequest: api.FieldsRequest{Fields: []string{"id, name", "sshLoginName"}}}
+		selection, err := fieldSelectionFromRequest[*api.User](req)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, selection, &fieldSelection{fields: []string{"id", "name", "sshLoginName"}},
+			cmpFieldSelection)
+	})
+	t.Run("list response", func(t *testing.T) {
+		req := &api.ListUsersRequest{FieldsRequest: api.FieldsRequest{Fields: []string{"name"}}}
+		selection, err := fieldSelectionFromRequest[*api.ListResponse[api.User]](req)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, selection, &fieldSelection{fields: []string{"name"}, list: true},
+			cmpFieldSelection)
+	})
+	t.Run("unknown field", func(t *testing.T) {
+		req := &api.ListGroupsRequest{FieldsRequest: api.FieldsRequest{Fields: []string{"name,totalCount"}}}
+		_, err := fieldSelectionFromRequest[*api.ListResponse[api.Group]](req)
+		var verr validate.Error
+		assert.Assert(t, errors.As(err, &verr), "wrong error type %T", err)
+		assert.Equal(t, verr["fields"][0], `unknown field "totalCount"`)
+	})
+}
+
+var cmpFieldSelection = gocmp.AllowUnexported(fieldSelection{})
+
+func TestAPI_FieldSelection(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+
+	user := &models.Identity{Name: "fields@example.com"}
+	assert.NilError(t, data.CreateIdentity(srv.DB(), user))
+
+	get := func(t *testing.T, path string) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("list users", func(t *testing.T) {
+		resp := get(t, "/api/users?name=fields@example.com&fields=id,name")
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		var body struct {
+			Count int
+			Items []map[string]any
+		}
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+		assert.Equal(t, body.Count, 1)
+		expected := []map[string]any{
+			{"id": user.ID.String(), "name": "fields@example.com"},
+		}
+		assert.DeepEqual(t, body.Items, expected)
+	})
+	t.Run("get user with repeated fields", func(t *testing.T) {
+		resp := get(t, "/api/users/"+user.ID.String()+"?fields=name&fields=sshLoginName")
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		expected := map[string]any{"name": "fields@example.com", "sshLoginName": user.SSHLoginName}
+		assert.DeepEqual(t, jsonUnmarshal(t, resp.Body.String()), expected)
+	})
+	t.Run("get user with all fields", func(t *testing.T) {
+		resp := get(t, "/api/users/"+user.ID.String())
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		actual := jsonUnmarshal(t, resp.Body.String()).(map[string]any)
+		assert.Equal(t, actual["name"], "fields@example.com")
+		assert.Assert(t, actual["created"] != nil)
+	})
+	t.Run("unknown field", func(t *testing.T) {
+		resp := get(t, "/api/users?fields=id,password")
+		assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+
+		respBody := &api.Error{}
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), respBody))
+		assert.Equal(t, len(respBody.FieldErrors), 1)
+		assert.Equal(t, respBody.FieldErrors[0].FieldName, "fields")
+		assert.Equal(t, respBody.FieldErrors[0].Errors[0], `unknown field "password"`)
+	})
+}
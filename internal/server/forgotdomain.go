@@ -9,6 +9,9 @@ import (
 	"github.com/infrahq/infra/internal/server/redis"
 )
 
+// RequestForgotDomains sends an email with the organizations of a user. Like
+// RequestPasswordReset, the response is the same whether or not the user
+// exists.
 func (a *API) RequestForgotDomains(c *gin.Context, r *api.ForgotDomainRequest) (*api.EmptyResponse, error) {
 	rCtx := getRequestContext(c)
 
@@ -24,10 +27,8 @@ func (a *API) RequestForgotDomains(c *gin.Context, r *api.ForgotDomainRequest) (
 		return nil, nil // This is okay. we don't notify the user if we failed to find the email.
 	}
 
-	err = email.SendForgotDomainsEmail("", r.Email, email.ForgottenDomainData{Domains: domains})
-	if err != nil {
-		return nil, err
-	}
-
+	a.sendEmailAfterCommit(c, func() error {
+		return email.SendForgotDomainsEmail("", r.Email, email.ForgottenDomainData{Domains: domains})
+	})
 	return nil, nil
 }
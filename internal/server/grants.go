@@ -1,10 +1,13 @@
 package server
 
 import (
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
@@ -12,17 +15,30 @@ import (
 	"github.com/infrahq/infra/api"
 	"github.com/infrahq/infra/internal"
 	"github.com/infrahq/infra/internal/access"
+	"github.com/infrahq/infra/internal/server/audit"
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
 	"github.com/infrahq/infra/uid"
 )
 
-type ListGrantsResponse api.ListResponse[api.Grant]
+type ListGrantsResponse api.ListGrantsResponse
 
 func (r ListGrantsResponse) SetHeaders(h http.Header) {
 	if r.LastUpdateIndex.Index > 0 {
 		h.Set("Last-Update-Index", strconv.FormatInt(r.LastUpdateIndex.Index, 10))
 	}
+	if r.Signature != "" {
+		h.Set("Infra-Signature", r.Signature)
+	}
+}
+
+// MarshalJSON returns the signed payload when the response is signed, so that
+// the response body is exactly the bytes covered by the signature.
+func (r ListGrantsResponse) MarshalJSON() ([]byte, error) {
+	if r.Signature != "" {
+		return r.Payload, nil
+	}
+	return json.Marshal(api.ListGrantsResponse(r))
 }
 
 func (a *API) ListGrants(c *gin.Context, r *api.ListGrantsRequest) (*ListGrantsResponse, error) {
@@ -52,10 +68,26 @@ func (a *API) ListGrants(c *gin.Context, r *api.ListGrantsRequest) (*ListGrantsR
 		opts.ByPrivileges = []string{r.Privilege}
 	}
 	if !r.IsBlockingRequest() {
-		p = PaginationFromRequest(r.PaginationRequest)
+		var err error
+		p, err = CursorPaginationFromRequest(r.PaginationRequest, r.Cursor)
+		if err != nil {
+			return nil, err
+		}
 		opts.Pagination = &p
 	}
 
+	// Every change to a grant increments the max update index, but a change to
+	// group membership does not, so inherited grants can not use an ETag.
+	if !r.IsBlockingRequest() && !r.ShowInherited {
+		maxUpdateIndex, err := access.GrantsMaxUpdateIndex(c, subject, r.Destination)
+		if err != nil {
+			return nil, err
+		}
+		if err := setETag(c, maxUpdateIndex); err != nil {
+			return nil, err
+		}
+	}
+
 	grants, err := access.ListGrants(c, opts, r.LastUpdateIndex)
 	if err != nil {
 		return nil, err
@@ -70,7 +102,56 @@ func (a *API) ListGrants(c *gin.Context, r *api.ListGrantsRequest) (*ListGrantsR
 	})
 	result.LastUpdateIndex.Index = grants.MaxUpdateIndex
 
-	return (*ListGrantsResponse)(result), nil
+	resp := &ListGrantsResponse{ListResponse: *result}
+	for _, token := range grants.RevokedTokens {
+		resp.RevokedTokens = append(resp.RevokedTokens, api.RevokedToken{
+			ID:      token.ID.String(),
+			Expires: api.Time(token.ExpiresAt),
+		})
+	}
+
+	// Sign the grants of a destination, so that the connector can verify the
+	// grants were not modified by a proxy between the server and the connector.
+	// A selection of fields changes the response body, so it is not signed.
+	if r.Destination != "" && len(r.Fields) == 0 {
+		headers := map[string]interface{}{
+			api.SignatureHeaderDestination: r.Destination,
+			api.SignatureHeaderUpdateIndex: resp.LastUpdateIndex.Index,
+			api.SignatureHeaderIssuedAt:    time.Now().Unix(),
+		}
+		if err := signResponse(rCtx, r.IsBlockingRequest(), &resp.SignedResponse, api.ListGrantsResponse(*resp), headers); err != nil {
+			return nil, fmt.Errorf("sign response: %w", err)
+		}
+	}
+	return resp, nil
+}
+
+// signResponse sets signed to the JSON encoding of body, and its signature.
+// The signature includes headers in its protected header.
+// Blocking requests close the request transaction while they wait, so a new
+// transaction is used to read the signing key.
+func signResponse(rCtx access.RequestContext, blocking bool, signed *api.SignedResponse, body any, headers map[string]interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	var tx data.ReadTxn = rCtx.DBTxn
+	if blocking {
+		txn, err := rCtx.DataDB.Begin(rCtx.Request.Context(), &sql.TxOptions{ReadOnly: true})
+		if err != nil {
+			return err
+		}
+		defer logError(txn.Rollback, "failed to rollback transaction")
+		tx = txn.WithOrgID(rCtx.DBTxn.OrganizationID())
+	}
+
+	signature, err := data.SignPayload(tx, payload, headers)
+	if err != nil {
+		return err
+	}
+	signed.Signature, signed.Payload = signature, payload
+	return nil
 }
 
 func (a *API) GetGrant(c *gin.Context, r *api.Resource) (*api.Grant, error) {
@@ -78,6 +159,9 @@ func (a *API) GetGrant(c *gin.Context, r *api.Resource) (*api.Grant, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := setETag(c, grant.UpdateIndex); err != nil {
+		return nil, err
+	}
 
 	return grant.ToAPI(), nil
 }
@@ -89,6 +173,7 @@ func (a *API) CreateGrant(c *gin.Context, r *api.GrantRequest) (*api.CreateGrant
 	}
 
 	err = access.CreateGrant(c, grant)
+	a.recordAuditOnCommit(c, audit.ActionGrantCreate, grantAuditTarget(grant), err)
 	var ucerr data.UniqueConstraintError
 
 	if errors.As(err, &ucerr) {
@@ -113,6 +198,9 @@ func (a *API) CreateGrant(c *gin.Context, r *api.GrantRequest) (*api.CreateGrant
 	if err != nil {
 		return nil, err
 	}
+	if err := a.emitWebhookEvent(c, api.WebhookEventGrantCreated, grant.ToAPI()); err != nil {
+		return nil, err
+	}
 
 	return &api.CreateGrantResponse{Grant: grant.ToAPI(), WasCreated: true}, nil
 
@@ -139,7 +227,93 @@ func (a *API) DeleteGrant(c *gin.Context, r *api.Resource) (*api.EmptyResponse,
 		}
 	}
 
-	return nil, access.DeleteGrant(c, r.ID)
+	err = access.DeleteGrant(c, grant)
+	a.recordAuditOnCommit(c, audit.ActionGrantDelete, grantAuditTarget(grant), err)
+	if err != nil {
+		return nil, err
+	}
+	return nil, a.emitWebhookEvent(c, api.WebhookEventGrantDeleted, grant.ToAPI())
+}
+
+// BulkDeleteGrants deletes each of the grants in the request. A grant that can
+// not be deleted does not prevent the others from being deleted.
+func (a *API) BulkDeleteGrants(c *gin.Context, r *api.BulkDeleteRequest) (*api.BulkDeleteResponse, error) {
+	ids := uniqueIDs(r.IDs)
+	deleted, failed, err := access.DeleteGrants(c, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if err, ok := failed[id]; ok {
+			a.recordAuditOnCommit(c, audit.ActionGrantDelete, auditTarget{Type: "grant", ID: id.String()}, err)
+		}
+	}
+	for i := range deleted {
+		grant := &deleted[i]
+		a.recordAuditOnCommit(c, audit.ActionGrantDelete, grantAuditTarget(grant), nil)
+		if err := a.emitWebhookEvent(c, api.WebhookEventGrantDeleted, grant.ToAPI()); err != nil {
+			return nil, err
+		}
+	}
+	return newBulkDeleteResponse(ids, failed), nil
+}
+
+func (a *API) PatchGrant(c *gin.Context, r *api.PatchGrantRequest) (*api.Grant, error) {
+	grant, err := access.GetGrant(c, r.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkIfMatch(c, weakETag(grant.UpdateIndex)); err != nil {
+		return nil, err
+	}
+
+	updated := *grant
+	if r.Privilege != nil {
+		updated.Privilege = *r.Privilege
+	}
+
+	if isLastInfraAdminChange(grant, &updated) {
+		opts := data.ListGrantsOptions{
+			ByResource:   access.ResourceInfraAPI,
+			ByPrivileges: []string{models.InfraAdminRole},
+		}
+		infraAdminGrants, err := access.ListGrants(c, opts, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(infraAdminGrants.Grants) == 1 {
+			return nil, fmt.Errorf("%w: cannot remove the last infra admin", internal.ErrBadRequest)
+		}
+	}
+
+	if hasIfMatch(c) {
+		// the grant may have been updated by a concurrent request after it
+		// was read, so only update the version that matched If-Match.
+		err = access.UpdateGrantIfUnmodified(c, grant, &updated, grant.UpdateIndex)
+	} else {
+		err = access.UpdateGrant(c, grant, &updated)
+	}
+	a.recordAuditOnCommit(c, audit.ActionGrantUpdate, grantAuditTarget(&updated), err)
+	if errors.Is(err, data.ErrUpdateConflict) {
+		current, err := data.GetGrant(getRequestContext(c).DBTxn, data.GetGrantOptions{ByID: r.ID})
+		if err != nil {
+			return nil, fmt.Errorf("get grant after conflict: %w", err)
+		}
+		return nil, newPreconditionFailedError(c, weakETag(current.UpdateIndex))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return updated.ToAPI(), nil
+}
+
+// isLastInfraAdminChange returns true if the change from current to updated
+// removes the infra admin role granted by current.
+func isLastInfraAdminChange(current, updated *models.Grant) bool {
+	return current.Resource == access.ResourceInfraAPI &&
+		current.Privilege == models.InfraAdminRole &&
+		updated.Privilege != models.InfraAdminRole
 }
 
 func (a *API) UpdateGrants(c *gin.Context, r *api.UpdateGrantsRequest) (*api.EmptyResponse, error) {
@@ -163,7 +337,28 @@ func (a *API) UpdateGrants(c *gin.Context, r *api.UpdateGrantsRequest) (*api.Emp
 		rmGrants = append(rmGrants, grant)
 	}
 
-	return nil, access.UpdateGrants(c, addGrants, rmGrants)
+	err := access.UpdateGrants(c, addGrants, rmGrants)
+	for _, grant := range addGrants {
+		a.recordAuditOnCommit(c, audit.ActionGrantCreate, grantAuditTarget(grant), err)
+	}
+	for _, grant := range rmGrants {
+		a.recordAuditOnCommit(c, audit.ActionGrantDelete, grantAuditTarget(grant), err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, grant := range addGrants {
+		if err := a.emitWebhookEvent(c, api.WebhookEventGrantCreated, grant.ToAPI()); err != nil {
+			return nil, err
+		}
+	}
+	for _, grant := range rmGrants {
+		if err := a.emitWebhookEvent(c, api.WebhookEventGrantDeleted, grant.ToAPI()); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
 }
 
 func getGrantFromGrantRequest(c *gin.Context, r api.GrantRequest) (*models.Grant, error) {
@@ -8,15 +8,20 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"sort"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	gocmp "github.com/google/go-cmp/cmp"
 	"golang.org/x/sync/errgroup"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
 	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/opt"
 
 	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal"
 	"github.com/infrahq/infra/internal/access"
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
@@ -215,7 +220,7 @@ func TestAPI_ListGrants(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{Errors: []string{"only one of (user, group) can have a value"}},
+					{ErrorCode: api.ErrorCodeInvalid, Errors: []string{"only one of (user, group) can have a value"}},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
 			},
@@ -295,6 +300,21 @@ func TestAPI_ListGrants(t *testing.T) {
 				assert.Equal(t, grants.PaginationResponse, api.PaginationResponse{Limit: 2, Page: 2, TotalCount: 5, TotalPages: 3})
 			},
 		},
+		"no filter, page 2 without total": {
+			urlPath: "/api/grants?page=2&limit=2&showSystem=true&withTotal=false",
+			setup: func(t *testing.T, req *http.Request) {
+				req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+			},
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+				var grants api.ListResponse[api.Grant]
+				err := json.NewDecoder(resp.Body).Decode(&grants)
+				assert.NilError(t, err)
+
+				assert.Equal(t, len(grants.Items), 2)
+				assert.Equal(t, grants.PaginationResponse, api.PaginationResponse{Limit: 2, Page: 2, TotalCount: -1, TotalPages: -1})
+			},
+		},
 		"hide infra connector": {
 			urlPath: "/api/grants",
 			setup: func(t *testing.T, req *http.Request) {
@@ -454,6 +474,7 @@ func TestAPI_ListGrants(t *testing.T) {
 				expected := []api.FieldError{
 					{
 						FieldName: "lastUpdateIndex",
+						ErrorCode: api.ErrorCodeInvalid,
 						Errors:    []string{"can not be used with user parameter(s)"},
 					},
 				}
@@ -475,6 +496,7 @@ func TestAPI_ListGrants(t *testing.T) {
 				expected := []api.FieldError{
 					{
 						FieldName: "lastUpdateIndex",
+						ErrorCode: api.ErrorCodeInvalid,
 						Errors:    []string{"requires a supported filter"},
 					},
 				}
@@ -658,7 +680,7 @@ func TestAPI_ListGrants_InheritedGrants(t *testing.T) {
 				assert.DeepEqual(t, grants.Items, expected, cmpAPIGrantShallow)
 			},
 		},
-		"requires a userID with showInherited": {
+		"requires a user with showInherited": {
 			urlPath: "/api/grants?showInherited=1&resource=dinosaurs",
 			setup: func(t *testing.T, req *http.Request) {
 				loginAs(t, idInGroup, req)
@@ -671,7 +693,7 @@ func TestAPI_ListGrants_InheritedGrants(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{FieldName: "showInherited", Errors: []string{"requires a user ID"}},
+					{FieldName: "user", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
 			},
@@ -929,6 +951,142 @@ func TestAPI_ListGrants_BlockingRequest_NotFoundBlocksUntilUpdate(t *testing.T)
 	assert.Equal(t, len(respBody.Items), 1)
 }
 
+func TestAPI_ListGrants_RevokedTokens(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+
+	user := &models.Identity{Name: "revoked@example.com"}
+	assert.NilError(t, data.CreateIdentity(srv.DB(), user))
+
+	token, err := data.CreateIdentityToken(srv.DB(), user.ID, "infra", time.Minute)
+	assert.NilError(t, err)
+	tok, err := jwt.ParseSigned(token.Token)
+	assert.NilError(t, err)
+	var claims jwt.Claims
+	assert.NilError(t, tok.UnsafeClaimsWithoutVerification(&claims))
+
+	listGrants := func(t *testing.T, urlPath string) api.ListGrantsResponse {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, urlPath, nil)
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Add("Infra-Version", apiVersionLatest)
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+
+		var respBody api.ListGrantsResponse
+		assert.NilError(t, json.NewDecoder(resp.Body).Decode(&respBody))
+		return respBody
+	}
+
+	resp := listGrants(t, "/api/grants?destination=infra")
+	assert.Equal(t, len(resp.RevokedTokens), 0)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/users/"+user.ID.String(), nil)
+	req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+	req.Header.Add("Infra-Version", apiVersionLatest)
+	deleteResp := httptest.NewRecorder()
+	routes.ServeHTTP(deleteResp, req)
+	assert.Equal(t, deleteResp.Code, http.StatusNoContent, (*responseDebug)(deleteResp))
+
+	t.Run("destination", func(t *testing.T) {
+		resp := listGrants(t, "/api/grants?destination=infra")
+		assert.Equal(t, len(resp.RevokedTokens), 1)
+		assert.Equal(t, resp.RevokedTokens[0].ID, claims.ID)
+	})
+	t.Run("other destination", func(t *testing.T) {
+		resp := listGrants(t, "/api/grants?destination=other")
+		assert.Equal(t, len(resp.RevokedTokens), 0)
+	})
+}
+
+func TestAPI_ListGrants_SignedResponse(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+
+	err := data.CreateGrant(srv.DB(), &models.Grant{
+		Subject:   "i:abcd",
+		Privilege: "view",
+		Resource:  "signed",
+	})
+	assert.NilError(t, err)
+
+	settings, err := data.GetSettings(srv.DB())
+	assert.NilError(t, err)
+	var pub jose.JSONWebKey
+	assert.NilError(t, pub.UnmarshalJSON(settings.PublicJWK))
+
+	listGrants := func(t *testing.T, urlPath string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, urlPath, nil)
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Add("Infra-Version", apiVersionLatest)
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+		return resp
+	}
+
+	t.Run("destination", func(t *testing.T) {
+		resp := listGrants(t, "/api/grants?destination=signed")
+		signature := resp.Header().Get("Infra-Signature")
+		assert.Assert(t, signature != "")
+
+		jws, err := jose.ParseDetached(signature, resp.Body.Bytes())
+		assert.NilError(t, err)
+		assert.Equal(t, jws.Signatures[0].Header.KeyID, pub.KeyID)
+		_, err = jws.Verify(&pub)
+		assert.NilError(t, err)
+
+		// the signature is bound to the destination, and the time it was signed
+		protected := jws.Signatures[0].Protected.ExtraHeaders
+		assert.Equal(t, protected[api.SignatureHeaderDestination], "signed")
+		issuedAt, ok := protected[api.SignatureHeaderIssuedAt].(float64)
+		assert.Assert(t, ok)
+		assert.DeepEqual(t, time.Unix(int64(issuedAt), 0), time.Now(), opt.TimeWithThreshold(time.Minute))
+
+		respBody := &api.ListGrantsResponse{}
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), respBody))
+		assert.Equal(t, len(respBody.Items), 1)
+	})
+	t.Run("blocking request", func(t *testing.T) {
+		resp := listGrants(t, "/api/grants?destination=signed&lastUpdateIndex=1")
+		signature := resp.Header().Get("Infra-Signature")
+		assert.Assert(t, signature != "")
+
+		jws, err := jose.ParseDetached(signature, resp.Body.Bytes())
+		assert.NilError(t, err)
+		_, err = jws.Verify(&pub)
+		assert.NilError(t, err)
+
+		// the signature is bound to the update index of the response
+		index, err := strconv.ParseInt(resp.Header().Get("Last-Update-Index"), 10, 64)
+		assert.NilError(t, err)
+		assert.Assert(t, index > 1)
+		assert.Equal(t, jws.Signatures[0].Protected.ExtraHeaders[api.SignatureHeaderUpdateIndex], float64(index))
+	})
+	t.Run("tampered body", func(t *testing.T) {
+		resp := listGrants(t, "/api/grants?destination=signed")
+		signature := resp.Header().Get("Infra-Signature")
+		body := bytes.Replace(resp.Body.Bytes(), []byte(`"view"`), []byte(`"admin"`), 1)
+
+		jws, err := jose.ParseDetached(signature, body)
+		assert.NilError(t, err)
+		_, err = jws.Verify(&pub)
+		assert.ErrorContains(t, err, "error in cryptographic primitive")
+	})
+	t.Run("not a destination", func(t *testing.T) {
+		resp := listGrants(t, "/api/grants?resource=signed")
+		assert.Equal(t, resp.Header().Get("Infra-Signature"), "")
+	})
+	t.Run("selected fields", func(t *testing.T) {
+		resp := listGrants(t, "/api/grants?destination=signed&fields=privilege")
+		assert.Equal(t, resp.Header().Get("Infra-Signature"), "")
+	})
+}
+
 func TestAPI_CreateGrant(t *testing.T) {
 	srv := setupServer(t, withAdminUser, withMultiOrgEnabled)
 	routes := srv.GenerateRoutes()
@@ -1014,9 +1172,9 @@ func TestAPI_CreateGrant(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{Errors: []string{"one of (user, userName, group, groupName) is required"}},
-					{FieldName: "privilege", Errors: []string{"is required"}},
-					{FieldName: "resource", Errors: []string{"is required"}},
+					{ErrorCode: api.ErrorCodeInvalid, Errors: []string{"one of (user, userName, group, groupName) is required"}},
+					{FieldName: "privilege", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
+					{FieldName: "resource", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
 			},
@@ -1114,6 +1272,7 @@ func TestAPI_CreateGrant(t *testing.T) {
 				expected := jsonUnmarshal(t, `
 				{
 					"code": 400,
+					"errorCode": "bad_request",
 					"message": "bad request: couldn't find userName 'someone@random.org'"
 				}`)
 				actual := jsonUnmarshal(t, resp.Body.String())
@@ -1167,6 +1326,7 @@ func TestAPI_CreateGrant(t *testing.T) {
 				expected := jsonUnmarshal(t, `
 				{
 					"code": 400,
+					"errorCode": "bad_request",
 					"message": "bad request: couldn't find groupName 'fake-group'"
 				}`)
 				actual := jsonUnmarshal(t, resp.Body.String())
@@ -1260,6 +1420,70 @@ func TestAPI_CreateGrant(t *testing.T) {
 	}
 }
 
+func TestAPI_BulkDeleteGrants(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+	db := srv.DB()
+
+	user := &models.Identity{Name: "grantee@example.com"}
+	createIdentities(t, db, user)
+
+	createGrant := func(t *testing.T, grant *models.Grant) *models.Grant {
+		t.Helper()
+		assert.NilError(t, data.CreateGrant(db, grant))
+		return grant
+	}
+
+	infraAdminGrants, err := data.ListGrants(db, data.ListGrantsOptions{
+		ByPrivileges: []string{models.InfraAdminRole},
+		ByResource:   access.ResourceInfraAPI,
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, len(infraAdminGrants), 1)
+	lastAdminGrant := infraAdminGrants[0]
+
+	viewGrant := createGrant(t, &models.Grant{
+		Subject:   user.PolyID(),
+		Privilege: models.InfraViewRole,
+		Resource:  access.ResourceInfraAPI,
+	})
+	supportAdminGrant := createGrant(t, &models.Grant{
+		Subject:   user.PolyID(),
+		Privilege: models.InfraSupportAdminRole,
+		Resource:  access.ResourceInfraAPI,
+	})
+	otherAdminGrant := createGrant(t, &models.Grant{
+		Subject:   user.PolyID(),
+		Privilege: models.InfraAdminRole,
+		Resource:  access.ResourceInfraAPI,
+	})
+	missing := uid.New()
+
+	results := bulkDelete(t, routes, "/api/grants/bulk-delete", adminAccessKey(srv),
+		viewGrant.ID, missing, supportAdminGrant.ID, otherAdminGrant.ID, lastAdminGrant.ID)
+	expected := []api.BulkDeleteResult{
+		{ID: viewGrant.ID, Status: "deleted"},
+		{ID: missing, Status: "not_found", Message: "record not found: grant not found"},
+		{
+			ID:      supportAdminGrant.ID,
+			Status:  "forbidden",
+			Message: "you do not have permission to delete grant, requires role support-admin",
+		},
+		{ID: otherAdminGrant.ID, Status: "deleted"},
+		{ID: lastAdminGrant.ID, Status: "bad_request", Message: "bad request: cannot remove the last infra admin"},
+	}
+	assert.DeepEqual(t, results, expected)
+
+	for _, id := range []uid.ID{viewGrant.ID, otherAdminGrant.ID} {
+		_, err := data.GetGrant(db, data.GetGrantOptions{ByID: id})
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+	}
+	for _, id := range []uid.ID{supportAdminGrant.ID, lastAdminGrant.ID} {
+		_, err := data.GetGrant(db, data.GetGrantOptions{ByID: id})
+		assert.NilError(t, err)
+	}
+}
+
 func TestAPI_DeleteGrant(t *testing.T) {
 	srv := setupServer(t, withAdminUser, withMultiOrgEnabled)
 	routes := srv.GenerateRoutes()
@@ -1368,6 +1592,85 @@ func TestAPI_DeleteGrant(t *testing.T) {
 	})
 }
 
+func TestAPI_PatchGrant(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+
+	user := &models.Identity{Name: "non-admin"}
+	err := data.CreateIdentity(srv.DB(), user)
+	assert.NilError(t, err)
+
+	patchGrant := func(t *testing.T, id uid.ID, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodPatch, "/api/grants/"+id.String(), strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("missing privilege", func(t *testing.T) {
+		grant := &models.Grant{
+			Subject:   uid.NewIdentityPolymorphicID(user.ID),
+			Privilege: "view",
+			Resource:  "example",
+		}
+		assert.NilError(t, data.CreateGrant(srv.DB(), grant))
+
+		resp := patchGrant(t, grant.ID, `{}`)
+		assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+
+		respBody := &api.Error{}
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), respBody))
+		expected := []api.FieldError{
+			{FieldName: "privilege", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
+		}
+		assert.DeepEqual(t, respBody.FieldErrors, expected)
+	})
+	t.Run("not found", func(t *testing.T) {
+		resp := patchGrant(t, uid.New(), `{"privilege": "edit"}`)
+		assert.Equal(t, resp.Code, http.StatusNotFound, resp.Body.String())
+	})
+	t.Run("update privilege", func(t *testing.T) {
+		grant := &models.Grant{
+			Subject:   uid.NewIdentityPolymorphicID(user.ID),
+			Privilege: "view",
+			Resource:  "example.namespace",
+		}
+		assert.NilError(t, data.CreateGrant(srv.DB(), grant))
+
+		resp := patchGrant(t, grant.ID, `{"privilege": "edit"}`)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		respBody := &api.Grant{}
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), respBody))
+		assert.Equal(t, respBody.ID, grant.ID)
+		assert.Equal(t, respBody.Privilege, "edit")
+		assert.Equal(t, respBody.Resource, "example.namespace")
+
+		updated, err := data.GetGrant(srv.DB(), data.GetGrantOptions{ByID: grant.ID})
+		assert.NilError(t, err)
+		assert.Equal(t, updated.Privilege, "edit")
+		assert.Equal(t, updated.Subject, grant.Subject)
+		assert.Assert(t, updated.UpdateIndex > grant.UpdateIndex)
+	})
+	t.Run("last infra admin is changed", func(t *testing.T) {
+		infraAdminGrants, err := data.ListGrants(srv.DB(), data.ListGrantsOptions{
+			ByPrivileges: []string{models.InfraAdminRole},
+			ByResource:   "infra",
+		})
+		assert.NilError(t, err)
+		assert.Assert(t, len(infraAdminGrants) == 1)
+
+		resp := patchGrant(t, infraAdminGrants[0].ID, `{"privilege": "view"}`)
+		assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+		assert.Assert(t, strings.Contains(resp.Body.String(), "cannot remove the last infra admin"))
+	})
+}
+
 func TestAPI_UpdateGrants(t *testing.T) {
 	srv := setupServer(t, withAdminUser, withMultiOrgEnabled)
 	routes := srv.GenerateRoutes()
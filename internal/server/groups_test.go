@@ -242,7 +242,7 @@ func TestAPI_CreateGroup(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{FieldName: "name", Errors: []string{"is required"}},
+					{FieldName: "name", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
 			},
@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/getkin/kin-openapi/openapi3"
@@ -16,6 +17,7 @@ import (
 	"github.com/infrahq/infra/internal"
 	"github.com/infrahq/infra/internal/access"
 	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/server/audit"
 	"github.com/infrahq/infra/internal/server/authn"
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
@@ -30,7 +32,11 @@ type API struct {
 	openAPIDoc openapi3.T
 }
 
-func (a *API) CreateToken(c *gin.Context, r *api.EmptyRequest) (*api.CreateTokenResponse, error) {
+// defaultDestinationTokenDuration is the lifetime of a JWT when
+// Options.DestinationTokenDuration is not set.
+const defaultDestinationTokenDuration = 5 * time.Minute
+
+func (a *API) CreateToken(c *gin.Context, r *api.CreateTokenRequest) (*api.CreateTokenResponse, error) {
 	rCtx := getRequestContext(c)
 
 	if rCtx.Authenticated.User == nil {
@@ -41,7 +47,16 @@ func (a *API) CreateToken(c *gin.Context, r *api.EmptyRequest) (*api.CreateToken
 		// this will fail if the user was removed from the IDP, which means they no longer are a valid user
 		return nil, fmt.Errorf("%w: failed to update identity info from provider: %s", internal.ErrUnauthorized, err)
 	}
-	token, err := data.CreateIdentityToken(rCtx.DBTxn, rCtx.Authenticated.User.ID)
+	lifetime := a.server.options.DestinationTokenDuration
+	if lifetime == 0 {
+		lifetime = defaultDestinationTokenDuration
+	}
+	target, err := destinationAuditTarget(rCtx.DBTxn, r.Destination)
+	if err != nil {
+		return nil, err
+	}
+	token, err := data.CreateIdentityToken(rCtx.DBTxn, rCtx.Authenticated.User.ID, r.Destination, lifetime)
+	a.recordAuditOnCommit(c, audit.ActionDestinationLogin, target, err)
 	if err != nil {
 		return nil, err
 	}
@@ -73,40 +88,93 @@ type WellKnownJWKResponse struct {
 	Keys []jose.JSONWebKey `json:"keys"`
 }
 
+// sendEmailAfterCommit sends an email in the background after the request
+// transaction commits. Endpoints that do not require authentication use it so
+// that neither the response nor the time it takes reveals whether an email was
+// sent. Errors are logged, because the response has already been sent.
+func (a *API) sendEmailAfterCommit(c *gin.Context, send func() error) {
+	logger := logging.FromContext(c.Request.Context())
+	getRequestContext(c).DBTxn.OnCommit(func() {
+		a.server.backgroundEmails.Add(1)
+		go func() {
+			defer a.server.backgroundEmails.Done()
+			if err := send(); err != nil {
+				logger.Error().Err(err).Msg("failed to send email")
+			}
+		}()
+	})
+}
+
 func wrapLinkWithVerification(link, domain, verificationToken string) string {
 	link = base64.URLEncoding.EncodeToString([]byte(link))
 	return fmt.Sprintf("https://%s/link?vt=%s&r=%s", domain, verificationToken, link)
 }
 
 func (a *API) Login(c *gin.Context, r *api.LoginRequest) (*api.LoginResponse, error) {
+	return a.login(c, r, true)
+}
+
+// login authenticates the user of r. When retry is true the login runs in a
+// new transaction that is retried on serialization failures. Otherwise it runs
+// in the request transaction, so that it can see the writes of the request,
+// for example a password that was just reset.
+func (a *API) login(c *gin.Context, r *api.LoginRequest, retry bool) (*api.LoginResponse, error) {
 	rCtx := getRequestContext(c)
 
-	var onSuccess, onFailure func()
+	var onFailure func()
+
+	settings, err := a.server.orgSettings(rCtx.DBTxn)
+	if err != nil {
+		return nil, err
+	}
 
 	var loginMethod authn.LoginMethod
 	switch {
 	case r.AccessKey != "":
-		loginMethod = authn.NewKeyExchangeAuthentication(r.AccessKey)
+		loginMethod = authn.NewKeyExchangeAuthentication(r.AccessKey, a.server.accessKeyOptions())
 	case r.PasswordCredentials != nil:
 		if err := redis.NewLimiter(a.server.redis).RateOK(r.PasswordCredentials.Name, 10); err != nil {
 			return nil, err
 		}
 
-		usernameWithOrganization := fmt.Sprintf("%s:%s", r.PasswordCredentials.Name, rCtx.Authenticated.Organization.ID)
-		limiter := redis.NewLimiter(a.server.redis)
-		if err := limiter.LoginOK(usernameWithOrganization); err != nil {
+		// failed logins from the same address are delayed no matter which
+		// user they are for. Failed logins for each user are counted by
+		// checkLoginThrottle and recordFailedLogin.
+		clientIP := "ip:" + logging.ClientIP(c.Request.Context())
+		if err := a.server.addressLogins.LoginOK(clientIP); err != nil {
 			return nil, err
 		}
 
-		onSuccess = func() {
-			limiter.LoginGood(usernameWithOrganization)
+		cred, err := a.checkLoginThrottle(rCtx, r.PasswordCredentials.Name)
+		if err != nil {
+			event := newAuditEvent(c, audit.ActionLogin, auditTarget{}, err)
+			event.ActorName = r.PasswordCredentials.Name
+			event.Reason = err.Error()
+			a.server.auditLog.Record(c.Request.Context(), event)
+			return nil, err
 		}
 
 		onFailure = func() {
-			limiter.LoginBad(usernameWithOrganization, 10)
+			a.server.addressLogins.LoginBad(clientIP, loginFailuresPerAddress)
+			if cred != nil {
+				a.recordFailedLogin(c, r.PasswordCredentials.Name, cred)
+			} else {
+				a.recordFailedUnknownUserLogin(c, r.PasswordCredentials.Name)
+			}
 		}
 
 		loginMethod = authn.NewPasswordCredentialAuthentication(r.PasswordCredentials.Name, r.PasswordCredentials.Password)
+	case r.MFA != nil:
+		// limit the number of codes that can be tried for a user, no matter
+		// how many challenges they have.
+		keyID, _, _ := strings.Cut(r.MFA.Token, ".")
+		if challenge, err := data.GetAccessKeyByKeyID(rCtx.DBTxn, keyID); err == nil {
+			if _, err := a.server.rateLimiter.Allow(mfaRateLimitKey(challenge.IssuedFor.String()), mfaRateLimit); err != nil {
+				return nil, err
+			}
+		}
+
+		loginMethod = authn.NewMFAAuthentication(r.MFA.Token, r.MFA.Code, r.MFA.RecoveryCode, a.server.now(), a.server.accessKeyOptions())
 	case r.OIDC != nil:
 		var provider *models.Provider
 		if r.OIDC.ProviderID == models.InternalGoogleProviderID {
@@ -134,6 +202,7 @@ func (a *API) Login(c *gin.Context, r *api.LoginRequest) (*api.LoginResponse, er
 			r.OIDC.Code,
 			providerClient,
 			rCtx.Authenticated.Organization.AllowedDomains,
+			settings.AllowedSignupDomains,
 		)
 		if err != nil {
 			return nil, err
@@ -145,11 +214,36 @@ func (a *API) Login(c *gin.Context, r *api.LoginRequest) (*api.LoginResponse, er
 
 	// do the actual login now that we know the method selected
 	expires := time.Now().UTC().Add(a.server.options.SessionDuration)
-	result, err := authn.Login(rCtx.Request.Context(), rCtx.DBTxn, loginMethod, expires, a.server.options.SessionInactivityTimeout)
+	ctx := rCtx.Request.Context()
+	var result authn.LoginResult
+	login := func(tx *data.Transaction) error {
+		var err error
+		result, err = authn.Login(ctx, tx, loginMethod, expires, settings.SessionInactivityTimeout)
+		return err
+	}
+	if r.OIDC != nil || !retry {
+		// the authorization code can only be exchanged once, so an OIDC login
+		// can not be retried.
+		err = login(rCtx.DBTxn)
+	} else {
+		err = data.RetryTxn(ctx, rCtx.DataDB, rCtx.DBTxn.OrganizationID(), login)
+	}
 	if err != nil {
 		if onFailure != nil {
 			onFailure()
 		}
+		if !errors.Is(err, internal.ErrBadGateway) {
+			authFailuresCounter.WithLabelValues(authFailureLogin).Inc()
+		}
+
+		// the response does not say why the login failed, so that it can not
+		// be used to find which users exist. The audit event has the cause.
+		event := newAuditEvent(c, audit.ActionLogin, auditTarget{}, err)
+		event.Reason = err.Error()
+		if r.PasswordCredentials != nil {
+			event.ActorName = r.PasswordCredentials.Name
+		}
+		a.server.auditLog.Record(c.Request.Context(), event)
 
 		if errors.Is(err, internal.ErrBadGateway) {
 			// the user should be shown this explicitly
@@ -160,8 +254,18 @@ func (a *API) Login(c *gin.Context, r *api.LoginRequest) (*api.LoginResponse, er
 		return nil, fmt.Errorf("%w: login failed: %v", internal.ErrUnauthorized, err)
 	}
 
-	if onSuccess != nil {
-		onSuccess()
+	if result.MFARequired {
+		// the password was correct, but the user must complete the login
+		// with a TOTP code before they receive an access key.
+		return &api.LoginResponse{
+			UserID:                 result.User.ID,
+			Name:                   result.User.Name,
+			Expires:                api.Time(result.AccessKey.ExpiresAt),
+			PasswordUpdateRequired: result.CredentialUpdateRequired,
+			OrganizationName:       result.OrganizationName,
+			MFARequired:            true,
+			MFAToken:               result.Bearer,
+		}, nil
 	}
 
 	cookie := cookieConfig{
@@ -170,7 +274,7 @@ func (a *API) Login(c *gin.Context, r *api.LoginRequest) (*api.LoginResponse, er
 		Domain:  c.Request.Host,
 		Expires: result.AccessKey.ExpiresAt,
 	}
-	setCookie(c.Request, c.Writer, cookie)
+	setCookie(c.Writer, cookie)
 
 	key := result.AccessKey
 	a.t.User(key.IssuedFor.String(), result.User.Name)
@@ -183,6 +287,7 @@ func (a *API) Login(c *gin.Context, r *api.LoginRequest) (*api.LoginResponse, er
 	// Update the request context so that logging middleware can include the userID
 	rCtx.Authenticated.User = result.User
 	c.Set(access.RequestContextKey, rCtx)
+	a.recordAudit(c, audit.ActionLogin, userAuditTarget(result.User), nil)
 
 	return &api.LoginResponse{
 		UserID:                 key.IssuedFor,
@@ -191,6 +296,7 @@ func (a *API) Login(c *gin.Context, r *api.LoginRequest) (*api.LoginResponse, er
 		Expires:                api.Time(key.ExpiresAt),
 		PasswordUpdateRequired: result.CredentialUpdateRequired,
 		OrganizationName:       result.OrganizationName,
+		MFAEnrollmentRequired:  result.MFAEnrollmentRequired,
 	}, nil
 }
 
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/square/go-jose.v2"
+
+	"github.com/infrahq/infra/internal/server/data"
+)
+
+const (
+	// readinessPingTimeout is the time budget for the database ping made by
+	// the readiness endpoint.
+	readinessPingTimeout = time.Second
+	// healthCheckRateLimit is the number of requests per minute allowed to
+	// each of the health check endpoints.
+	healthCheckRateLimit = 300
+
+	checkStatusOK   = "ok"
+	checkStatusFail = "fail"
+)
+
+// HealthResponse is the JSON document returned by /healthz and /readyz.
+// Checks is only set by /readyz.
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// CheckResult is the result of checking a single dependency of the server.
+type CheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// healthHandler responds with 200 OK as long as the process is able to serve
+// requests. It does not check any dependencies, so that a liveness probe does
+// not restart the server when the database is unavailable.
+func healthHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, HealthResponse{Status: checkStatusOK})
+}
+
+// readinessChecker checks that the dependencies of the server are available,
+// so that a load balancer only sends requests to a server that can handle
+// them.
+type readinessChecker struct {
+	db *data.DB
+	// migrationsApplied is set once all the migrations known to this binary
+	// have been applied. Migrations are never reverted, so the check does not
+	// need to query the database again.
+	migrationsApplied atomic.Bool
+}
+
+// readyHandler responds with 200 OK when every check passes, and 503 Service
+// Unavailable when any check fails.
+func (r *readinessChecker) readyHandler(c *gin.Context) {
+	resp := HealthResponse{Status: checkStatusOK, Checks: map[string]CheckResult{}}
+
+	dbErr := r.checkDatabase(c.Request.Context())
+	resp.Checks["database"] = checkResult(dbErr)
+
+	migrationsErr := errors.New("skipped: database is unreachable")
+	if dbErr == nil {
+		migrationsErr = r.checkMigrations()
+	}
+	resp.Checks["migrations"] = checkResult(migrationsErr)
+	resp.Checks["signingKey"] = checkResult(r.checkSigningKey())
+
+	status := http.StatusOK
+	for _, check := range resp.Checks {
+		if check.Status != checkStatusOK {
+			resp.Status = checkStatusFail
+			status = http.StatusServiceUnavailable
+		}
+	}
+	c.JSON(status, resp)
+}
+
+func checkResult(err error) CheckResult {
+	if err != nil {
+		return CheckResult{Status: checkStatusFail, Error: err.Error()}
+	}
+	return CheckResult{Status: checkStatusOK}
+}
+
+func (r *readinessChecker) checkDatabase(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, readinessPingTimeout)
+	defer cancel()
+	return r.db.SQLdb().PingContext(ctx)
+}
+
+func (r *readinessChecker) checkMigrations() error {
+	if r.migrationsApplied.Load() {
+		return nil
+	}
+	migrations, err := data.MigrationStatus(r.db)
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if m.Pending {
+			return fmt.Errorf("migration %v has not been applied", m.ID)
+		}
+	}
+	r.migrationsApplied.Store(true)
+	return nil
+}
+
+func (r *readinessChecker) checkSigningKey() error {
+	settings := r.db.DefaultOrgSettings
+	if settings == nil || len(settings.PrivateJWK) == 0 {
+		return errors.New("signing key is not loaded")
+	}
+	var key jose.JSONWebKey
+	if err := key.UnmarshalJSON([]byte(settings.PrivateJWK)); err != nil {
+		return fmt.Errorf("invalid signing key: %w", err)
+	}
+	if !key.Valid() || key.IsPublic() {
+		return errors.New("invalid signing key")
+	}
+	return nil
+}
+
+// healthCheckRateLimitMiddleware limits the number of requests to each health
+// check endpoint. The endpoints do not require authentication, so the limit
+// prevents anyone from using /readyz to put load on the database. The limit
+// uses a separate in-memory rate limiter, because probes are sent to each
+// replica of the server.
+func healthCheckRateLimitMiddleware() gin.HandlerFunc {
+	limiter := newMemoryRateLimiter(0)
+	return func(c *gin.Context) {
+		if _, err := limiter.Allow(c.FullPath(), healthCheckRateLimit); err != nil {
+			sendAPIError(c, err)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gotest.tools/v3/assert"
+)
+
+// brokenConnector is a driver.Connector that fails to open every connection,
+// so that a connection pool created from it acts like a database that is
+// unreachable.
+type brokenConnector struct {
+	connect func(ctx context.Context) (driver.Conn, error)
+}
+
+func (b brokenConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return b.connect(ctx)
+}
+
+func (b brokenConnector) Driver() driver.Driver {
+	return nil
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	srv := setupServer(t)
+	routes := srv.GenerateRoutes()
+
+	get := func(t *testing.T, path string) (int, HealthResponse) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+
+		var body HealthResponse
+		assert.NilError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return resp.Code, body
+	}
+
+	breakDB := func(t *testing.T, connect func(ctx context.Context) (driver.Conn, error)) {
+		t.Helper()
+		pool := srv.db.DB
+		broken := sql.OpenDB(brokenConnector{connect: connect})
+		srv.db.DB = broken
+		t.Cleanup(func() {
+			srv.db.DB = pool
+			assert.NilError(t, broken.Close())
+		})
+	}
+
+	t.Run("healthy", func(t *testing.T) {
+		code, body := get(t, "/healthz")
+		assert.Equal(t, code, http.StatusOK)
+		assert.DeepEqual(t, body, HealthResponse{Status: "ok"})
+
+		code, body = get(t, "/readyz")
+		assert.Equal(t, code, http.StatusOK)
+		expected := HealthResponse{
+			Status: "ok",
+			Checks: map[string]CheckResult{
+				"database":   {Status: "ok"},
+				"migrations": {Status: "ok"},
+				"signingKey": {Status: "ok"},
+			},
+		}
+		assert.DeepEqual(t, body, expected)
+	})
+
+	t.Run("database unreachable", func(t *testing.T) {
+		breakDB(t, func(ctx context.Context) (driver.Conn, error) {
+			return nil, errors.New("connection refused")
+		})
+
+		code, body := get(t, "/healthz")
+		assert.Equal(t, code, http.StatusOK)
+		assert.DeepEqual(t, body, HealthResponse{Status: "ok"})
+
+		code, body = get(t, "/readyz")
+		assert.Equal(t, code, http.StatusServiceUnavailable)
+		expected := HealthResponse{
+			Status: "fail",
+			Checks: map[string]CheckResult{
+				"database":   {Status: "fail", Error: "connection refused"},
+				"migrations": {Status: "fail", Error: "skipped: database is unreachable"},
+				"signingKey": {Status: "ok"},
+			},
+		}
+		assert.DeepEqual(t, body, expected)
+	})
+
+	t.Run("database ping exceeds the time budget", func(t *testing.T) {
+		breakDB(t, func(ctx context.Context) (driver.Conn, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+
+		start := time.Now()
+		code, body := get(t, "/readyz")
+		assert.Equal(t, code, http.StatusServiceUnavailable)
+		assert.Assert(t, time.Since(start) < 5*time.Second)
+		assert.Equal(t, body.Checks["database"].Error, "context deadline exceeded")
+
+		code, _ = get(t, "/healthz")
+		assert.Equal(t, code, http.StatusOK)
+	})
+
+	t.Run("recovers when the database is reachable", func(t *testing.T) {
+		code, body := get(t, "/readyz")
+		assert.Equal(t, code, http.StatusOK)
+		assert.Equal(t, body.Status, "ok")
+	})
+
+	t.Run("signing key not loaded", func(t *testing.T) {
+		settings := srv.db.DefaultOrgSettings
+		srv.db.DefaultOrgSettings = nil
+		t.Cleanup(func() {
+			srv.db.DefaultOrgSettings = settings
+		})
+
+		code, body := get(t, "/readyz")
+		assert.Equal(t, code, http.StatusServiceUnavailable)
+		assert.DeepEqual(t, body.Checks["signingKey"],
+			CheckResult{Status: "fail", Error: "signing key is not loaded"})
+	})
+}
+
+func TestHealthCheckRateLimit(t *testing.T) {
+	router := gin.New()
+	router.Use(healthCheckRateLimitMiddleware())
+	router.GET("/healthz", healthHandler)
+
+	for i := 0; i < healthCheckRateLimit; i++ {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		assert.Equal(t, resp.Code, http.StatusOK, "request %d", i)
+	}
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, resp.Code, http.StatusTooManyRequests)
+}
@@ -323,3 +323,22 @@ var cmpAnyValidAccessKey = gocmp.Comparer(func(x, y interface{}) bool {
 
 	return xs == ys
 })
+
+// bulkDelete sends a bulk delete request for ids to path, and returns the
+// results. It fails the test if the response is not 200 OK.
+func bulkDelete(t *testing.T, routes Routes, path, accessKey string, ids ...uid.ID) []api.BulkDeleteResult {
+	t.Helper()
+	body := jsonBody(t, api.BulkDeleteRequest{IDs: ids})
+	// nolint:noctx
+	req := httptest.NewRequest(http.MethodPost, path, body)
+	req.Header.Set("Authorization", "Bearer "+accessKey)
+	req.Header.Set("Infra-Version", apiVersionLatest)
+
+	resp := httptest.NewRecorder()
+	routes.ServeHTTP(resp, req)
+	assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+	var result api.BulkDeleteResponse
+	assert.NilError(t, json.NewDecoder(resp.Body).Decode(&result))
+	return result.Items
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/access"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+const (
+	// idempotencyKeyHeader is the request header that identifies a request
+	// which may be retried. Only routes with routeSettings.idempotencyKey
+	// accept the header.
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotentReplayedHeader is set on a response that was replayed from the
+	// response to an earlier request with the same idempotency key.
+	idempotentReplayedHeader = "Idempotent-Replayed"
+
+	idempotencyKeyMaxLength = 255
+)
+
+// idempotentRequest is a request with an idempotency key.
+type idempotentRequest struct {
+	key string
+	// hash identifies the request, so that a key used for a different request
+	// can be rejected.
+	hash string
+}
+
+// readIdempotentRequest returns the idempotentRequest for the request, or nil
+// if the request does not have an idempotency key. The request body is read to
+// compute the hash of the request, and replaced so that it can be read again.
+func readIdempotentRequest(c *gin.Context, authned access.Authenticated) (*idempotentRequest, error) {
+	key := c.GetHeader(idempotencyKeyHeader)
+	if key == "" {
+		return nil, nil
+	}
+	if len(key) > idempotencyKeyMaxLength {
+		return nil, fmt.Errorf("%w: %v header must be at most %d characters",
+			internal.ErrBadRequest, idempotencyKeyHeader, idempotencyKeyMaxLength)
+	}
+
+	var body []byte
+	if c.Request.Body != nil {
+		var err error
+		body, err = io.ReadAll(c.Request.Body)
+		if err != nil {
+			return nil, fmt.Errorf("read request body: %w", err)
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	// The user is part of the hash so that the response, which may include
+	// secrets, is only replayed to the user who made the original request.
+	h := sha256.New()
+	fmt.Fprintf(h, "%v %v\n", c.Request.Method, c.Request.URL.RequestURI())
+	if authned.User != nil {
+		fmt.Fprintf(h, "user %v\n", authned.User.ID)
+	}
+	h.Write(body)
+	return &idempotentRequest{key: key, hash: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// replay sends the stored response for the idempotency key. It returns false
+// if there is no stored response, and the request should be handled. A key
+// that was used for a different request is a conflict.
+func (r *idempotentRequest) replay(c *gin.Context, tx data.WriteTxn) (bool, error) {
+	stored, err := data.GetIdempotencyKey(tx, r.key)
+	switch {
+	case errors.Is(err, internal.ErrNotFound):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+
+	if time.Since(stored.CreatedAt) > data.IdempotencyKeyTTL {
+		// the purge job has not removed the expired key yet
+		return false, data.DeleteIdempotencyKey(tx, stored.ID)
+	}
+	if stored.RequestHash != r.hash {
+		return false, api.Error{
+			Code:    http.StatusConflict,
+			Message: fmt.Sprintf("the %v was already used for a different request", idempotencyKeyHeader),
+		}
+	}
+
+	c.Header(idempotentReplayedHeader, "true")
+	c.Data(stored.StatusCode, "application/json; charset=utf-8", []byte(stored.ResponseBody))
+	return true, nil
+}
+
+// save stores the response to the request, so that it can be replayed when
+// the request is retried. The response must be saved in the same transaction
+// as the changes made by the request.
+func (r *idempotentRequest) save(tx data.WriteTxn, status int, resp any) error {
+	body, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return data.CreateIdempotencyKey(tx, &models.IdempotencyKey{
+		Key:          r.key,
+		RequestHash:  r.hash,
+		StatusCode:   status,
+		ResponseBody: models.EncryptedAtRest(body),
+	})
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+func TestAPI_IdempotencyKey(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+
+	post := func(t *testing.T, path string, key string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodPost, path, jsonBody(t, body))
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	countUsers := func(t *testing.T, name string) int {
+		t.Helper()
+		users, err := data.ListIdentities(srv.DB(), data.ListIdentityOptions{ByName: name})
+		assert.NilError(t, err)
+		return len(users)
+	}
+
+	t.Run("replay with the same request", func(t *testing.T) {
+		body := api.CreateUserRequest{Name: "replay@example.com"}
+		first := post(t, "/api/users", "key-replay", body)
+		assert.Equal(t, first.Code, http.StatusCreated, first.Body.String())
+		assert.Equal(t, first.Header().Get("Idempotent-Replayed"), "")
+
+		second := post(t, "/api/users", "key-replay", body)
+		assert.Equal(t, second.Code, http.StatusCreated, second.Body.String())
+		assert.Equal(t, second.Header().Get("Idempotent-Replayed"), "true")
+		assert.Equal(t, second.Body.String(), first.Body.String())
+
+		assert.Equal(t, countUsers(t, "replay@example.com"), 1)
+	})
+
+	t.Run("replay of a response with a secret", func(t *testing.T) {
+		user := &models.Identity{Name: "replay-key@example.com"}
+		assert.NilError(t, data.CreateIdentity(srv.DB(), user))
+
+		body := api.CreateAccessKeyRequest{UserID: user.ID, Name: "replayed"}
+		first := post(t, "/api/access-keys", "key-access-key", body)
+		assert.Equal(t, first.Code, http.StatusCreated, first.Body.String())
+
+		second := post(t, "/api/access-keys", "key-access-key", body)
+		assert.Equal(t, second.Code, http.StatusCreated, second.Body.String())
+		assert.Equal(t, second.Header().Get("Idempotent-Replayed"), "true")
+
+		var firstKey, secondKey api.CreateAccessKeyResponse
+		assert.NilError(t, json.Unmarshal(first.Body.Bytes(), &firstKey))
+		assert.NilError(t, json.Unmarshal(second.Body.Bytes(), &secondKey))
+		assert.Equal(t, secondKey.AccessKey, firstKey.AccessKey)
+
+		keys, err := data.ListAccessKeys(srv.DB(), data.ListAccessKeyOptions{ByIssuedForID: user.ID})
+		assert.NilError(t, err)
+		assert.Equal(t, len(keys), 1)
+	})
+
+	t.Run("replay with a different request", func(t *testing.T) {
+		first := post(t, "/api/users", "key-different", api.CreateUserRequest{Name: "first@example.com"})
+		assert.Equal(t, first.Code, http.StatusCreated, first.Body.String())
+
+		second := post(t, "/api/users", "key-different", api.CreateUserRequest{Name: "second@example.com"})
+		assert.Equal(t, second.Code, http.StatusConflict, second.Body.String())
+		assert.Equal(t, second.Header().Get("Idempotent-Replayed"), "")
+
+		respBody := &api.Error{}
+		assert.NilError(t, json.Unmarshal(second.Body.Bytes(), respBody))
+		assert.Equal(t, respBody.Message, "the Idempotency-Key was already used for a different request")
+		assert.Equal(t, countUsers(t, "second@example.com"), 0)
+
+		grant := api.GrantRequest{UserName: "first@example.com", Privilege: "view", Resource: "infra"}
+		third := post(t, "/api/grants", "key-different", grant)
+		assert.Equal(t, third.Code, http.StatusConflict, third.Body.String())
+	})
+
+	t.Run("expired key", func(t *testing.T) {
+		expired := &models.IdempotencyKey{
+			Key:          "key-expired",
+			RequestHash:  "a different request",
+			StatusCode:   http.StatusCreated,
+			ResponseBody: models.EncryptedAtRest(`{}`),
+			CreatedAt:    time.Now().Add(-data.IdempotencyKeyTTL - time.Hour),
+		}
+		assert.NilError(t, data.CreateIdempotencyKey(srv.DB(), expired))
+
+		resp := post(t, "/api/users", "key-expired", api.CreateUserRequest{Name: "expired@example.com"})
+		assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+		assert.Equal(t, resp.Header().Get("Idempotent-Replayed"), "")
+		assert.Equal(t, countUsers(t, "expired@example.com"), 1)
+
+		stored, err := data.GetIdempotencyKey(srv.DB(), "key-expired")
+		assert.NilError(t, err)
+		assert.Equal(t, string(stored.ResponseBody), resp.Body.String())
+	})
+
+	t.Run("failed request is not stored", func(t *testing.T) {
+		resp := post(t, "/api/users", "key-failed", api.CreateUserRequest{Name: "replay@example.com"})
+		assert.Equal(t, resp.Code, http.StatusConflict, resp.Body.String())
+
+		_, err := data.GetIdempotencyKey(srv.DB(), "key-failed")
+		assert.ErrorContains(t, err, "not found")
+	})
+
+	t.Run("key is too long", func(t *testing.T) {
+		resp := post(t, "/api/users", strings.Repeat("a", 256), api.CreateUserRequest{Name: "long@example.com"})
+		assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+		assert.Equal(t, countUsers(t, "long@example.com"), 0)
+	})
+}
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/access"
+	"github.com/infrahq/infra/internal/server/audit"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestAPI_ImpersonateUser(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+	sink := withMemoryAuditSink(srv)
+
+	grant := func(t *testing.T, user *models.Identity, role string) {
+		t.Helper()
+		err := data.CreateGrant(srv.DB(), &models.Grant{
+			Subject:   user.PolyID(),
+			Privilege: role,
+			Resource:  access.ResourceInfraAPI,
+		})
+		assert.NilError(t, err)
+	}
+
+	supportKey, support := createAccessKey(t, srv.DB(), "support@example.com")
+	grant(t, support, models.InfraImpersonatorRole)
+	approverKey, approver := createAccessKey(t, srv.DB(), "approver@example.com")
+	grant(t, approver, models.InfraImpersonatorRole)
+	userKey, user := createAccessKey(t, srv.DB(), "user@example.com")
+	_, otherAdmin := createAccessKey(t, srv.DB(), "other-admin@example.com")
+	grant(t, otherAdmin, models.InfraAdminRole)
+
+	request := func(t *testing.T, method, path, token string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, nil)
+		if body != nil {
+			req = httptest.NewRequest(method, path, jsonBody(t, body))
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	impersonate := func(t *testing.T, token string, userID uid.ID, req api.ImpersonateUserRequest) *httptest.ResponseRecorder {
+		t.Helper()
+		return request(t, http.MethodPost, "/api/users/"+userID.String()+"/impersonate", token, req)
+	}
+
+	t.Run("requires the impersonator role", func(t *testing.T) {
+		resp := impersonate(t, adminAccessKey(srv), user.ID, api.ImpersonateUserRequest{})
+		assert.Equal(t, resp.Code, http.StatusForbidden, (*responseDebug)(resp))
+
+		resp = impersonate(t, userKey, support.ID, api.ImpersonateUserRequest{})
+		assert.Equal(t, resp.Code, http.StatusForbidden, (*responseDebug)(resp))
+		sink.Events(t)
+	})
+
+	t.Run("impersonate a user", func(t *testing.T) {
+		resp := impersonate(t, supportKey, user.ID, api.ImpersonateUserRequest{})
+		assert.Equal(t, resp.Code, http.StatusCreated, (*responseDebug)(resp))
+
+		var created api.ImpersonateUserResponse
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &created))
+		assert.Equal(t, created.IssuedFor, user.ID)
+		assert.Assert(t, time.Until(created.Expires.Time()) <= access.ImpersonationDuration)
+
+		expected := []models.AuditEvent{
+			{
+				OrganizationMember: models.OrganizationMember{OrganizationID: srv.db.DefaultOrg.ID},
+				ActorID:            support.ID,
+				ActorName:          "support@example.com",
+				Action:             audit.ActionUserImpersonate,
+				TargetType:         "user",
+				TargetID:           user.ID.String(),
+				Result:             models.AuditResultSuccess,
+			},
+		}
+		assert.DeepEqual(t, sink.Events(t), expected)
+
+		resp = request(t, http.MethodGet, "/api/users/self", created.AccessKey, nil)
+		assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+		var self api.User
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &self))
+		assert.Equal(t, self.ID, user.ID)
+
+		// access keys can not be created from an impersonation session, and
+		// requests with the key are audited with both identities
+		resp = request(t, http.MethodPost, "/api/access-keys", created.AccessKey, api.CreateAccessKeyRequest{
+			UserID: user.ID,
+			Name:   "from-impersonation",
+			Expiry: api.Duration(time.Hour),
+		})
+		assert.Equal(t, resp.Code, http.StatusBadRequest, (*responseDebug)(resp))
+		assert.Assert(t, strings.Contains(resp.Body.String(), "impersonation session"), (*responseDebug)(resp))
+		events := sink.Events(t)
+		assert.Assert(t, len(events) > 0)
+		for _, event := range events {
+			assert.Equal(t, event.ActorID, user.ID)
+			assert.Equal(t, event.ImpersonatorID, support.ID)
+			assert.Equal(t, event.ImpersonatorName, "support@example.com")
+		}
+
+		// the user sees the impersonation in their sessions, even after it expires
+		key, err := data.GetAccessKey(srv.DB(), data.GetAccessKeysOptions{ByID: created.ID})
+		assert.NilError(t, err)
+		key.ExpiresAt = time.Now().Add(-time.Minute)
+		assert.NilError(t, data.UpdateAccessKey(srv.DB(), key))
+
+		resp = request(t, http.MethodGet, "/api/users/"+user.ID.String()+"/sessions", userKey, nil)
+		assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+		var sessions api.ListResponse[api.UserSession]
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &sessions))
+
+		var found bool
+		for _, session := range sessions.Items {
+			if session.ID == created.ID {
+				found = true
+				assert.Equal(t, session.ImpersonatedBy, support.ID)
+			}
+		}
+		assert.Assert(t, found, "impersonation session not listed")
+	})
+
+	t.Run("exchange an impersonation key", func(t *testing.T) {
+		resp := impersonate(t, supportKey, user.ID, api.ImpersonateUserRequest{})
+		assert.Equal(t, resp.Code, http.StatusCreated, (*responseDebug)(resp))
+		var created api.ImpersonateUserResponse
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &created))
+
+		resp = request(t, http.MethodPost, "/api/login", "", api.LoginRequest{AccessKey: created.AccessKey})
+		assert.Equal(t, resp.Code, http.StatusCreated, (*responseDebug)(resp))
+		var login api.LoginResponse
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &login))
+		assert.Assert(t, !login.Expires.Time().After(created.Expires.Time()))
+
+		sink.Events(t)
+
+		// the exchanged key is still an impersonation session
+		resp = request(t, http.MethodPost, "/api/access-keys", login.AccessKey, api.CreateAccessKeyRequest{
+			UserID: user.ID,
+			Name:   "from-exchanged-impersonation",
+			Expiry: api.Duration(time.Hour),
+		})
+		assert.Equal(t, resp.Code, http.StatusBadRequest, (*responseDebug)(resp))
+		events := sink.Events(t)
+		assert.Assert(t, len(events) > 0)
+		for _, event := range events {
+			assert.Equal(t, event.ActorID, user.ID)
+			assert.Equal(t, event.ImpersonatorID, support.ID)
+		}
+	})
+
+	approve := func(t *testing.T, token string, userID, impersonatorID uid.ID) *httptest.ResponseRecorder {
+		t.Helper()
+		path := "/api/users/" + userID.String() + "/impersonation-approvals"
+		return request(t, http.MethodPost, path, token, api.CreateImpersonationApprovalRequest{Impersonator: impersonatorID})
+	}
+
+	t.Run("impersonate an admin requires an approver", func(t *testing.T) {
+		resp := impersonate(t, supportKey, otherAdmin.ID, api.ImpersonateUserRequest{})
+		assert.Equal(t, resp.Code, http.StatusBadRequest, (*responseDebug)(resp))
+
+		resp = impersonate(t, supportKey, otherAdmin.ID, api.ImpersonateUserRequest{ApprovedBy: support.ID})
+		assert.Equal(t, resp.Code, http.StatusBadRequest, (*responseDebug)(resp))
+
+		resp = impersonate(t, supportKey, otherAdmin.ID, api.ImpersonateUserRequest{ApprovedBy: user.ID})
+		assert.Equal(t, resp.Code, http.StatusBadRequest, (*responseDebug)(resp))
+
+		// the approver has not approved the impersonation
+		resp = impersonate(t, supportKey, otherAdmin.ID, api.ImpersonateUserRequest{ApprovedBy: approver.ID})
+		assert.Equal(t, resp.Code, http.StatusBadRequest, (*responseDebug)(resp))
+
+		events := sink.Events(t)
+		assert.Equal(t, len(events), 4)
+		assert.Equal(t, events[0].Result, models.AuditResultFailure)
+	})
+
+	t.Run("approve the impersonation of an admin", func(t *testing.T) {
+		// the impersonator can not approve their own impersonation
+		resp := approve(t, supportKey, otherAdmin.ID, support.ID)
+		assert.Equal(t, resp.Code, http.StatusBadRequest, (*responseDebug)(resp))
+
+		resp = approve(t, userKey, otherAdmin.ID, support.ID)
+		assert.Equal(t, resp.Code, http.StatusForbidden, (*responseDebug)(resp))
+
+		resp = approve(t, approverKey, otherAdmin.ID, support.ID)
+		assert.Equal(t, resp.Code, http.StatusCreated, (*responseDebug)(resp))
+		var approval api.ImpersonationApproval
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &approval))
+		assert.Equal(t, approval.User, otherAdmin.ID)
+		assert.Equal(t, approval.Impersonator, support.ID)
+		assert.Equal(t, approval.ApprovedBy, approver.ID)
+
+		events := sink.Events(t)
+		assert.Equal(t, len(events), 3)
+		assert.Equal(t, events[2].Action, audit.ActionUserImpersonateApprove)
+		assert.Equal(t, events[2].ActorID, approver.ID)
+		assert.Equal(t, events[2].Result, models.AuditResultSuccess)
+
+		resp = impersonate(t, supportKey, otherAdmin.ID, api.ImpersonateUserRequest{ApprovedBy: approver.ID})
+		assert.Equal(t, resp.Code, http.StatusCreated, (*responseDebug)(resp))
+
+		// each approval is used once
+		resp = impersonate(t, supportKey, otherAdmin.ID, api.ImpersonateUserRequest{ApprovedBy: approver.ID})
+		assert.Equal(t, resp.Code, http.StatusBadRequest, (*responseDebug)(resp))
+		sink.Events(t)
+	})
+
+	t.Run("impersonate yourself", func(t *testing.T) {
+		resp := impersonate(t, supportKey, support.ID, api.ImpersonateUserRequest{})
+		assert.Equal(t, resp.Code, http.StatusBadRequest, (*responseDebug)(resp))
+	})
+}
@@ -2,7 +2,9 @@ package jobs
 
 import (
 	"context"
+	"time"
 
+	"github.com/infrahq/infra/internal/server/audit"
 	"github.com/infrahq/infra/internal/server/data"
 )
 
@@ -17,3 +19,28 @@ func RemoveExpiredAccessKeys(ctx context.Context, tx *data.Transaction) error {
 func RemoveExpiredPasswordResetTokens(ctx context.Context, tx *data.Transaction) error {
 	return data.RemoveExpiredPasswordResetTokens(tx)
 }
+
+func RemoveExpiredImpersonationApprovals(ctx context.Context, tx *data.Transaction) error {
+	return data.RemoveExpiredImpersonationApprovals(tx)
+}
+
+func RemoveExpiredIssuedTokens(ctx context.Context, tx *data.Transaction) error {
+	return data.DeleteExpiredIssuedTokens(tx)
+}
+
+// AggregateDestinationUsage aggregates the usage of every destination on the
+// current and the previous day, so that the logins recorded after the
+// previous run are included.
+func AggregateDestinationUsage(ctx context.Context, tx *data.Transaction) error {
+	now := time.Now().UTC()
+	for _, day := range []time.Time{now.Add(-24 * time.Hour), now} {
+		opts := data.AggregateDestinationUsageOptions{
+			Day:         day,
+			LoginAction: audit.ActionDestinationLogin,
+		}
+		if _, err := data.AggregateDestinationUsage(tx, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
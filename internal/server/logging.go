@@ -11,6 +11,7 @@ import (
 
 	"github.com/infrahq/infra/internal/access"
 	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/uid"
 )
 
 type logSampler struct {
@@ -33,7 +34,15 @@ func (c *logSampler) Get(fields ...string) zerolog.Sampler {
 	return raw.(zerolog.Sampler) // nolint:forcetypeassert
 }
 
-func loggingMiddleware(enableSampling bool) gin.HandlerFunc {
+// healthCheckPaths are the paths of health check endpoints. Access logs for
+// these paths are demoted to debug when AccessLogOptions.DemoteHealthChecks is
+// set.
+var healthCheckPaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+func loggingMiddleware(enableSampling bool, opts logging.AccessLogOptions) gin.HandlerFunc {
 	sampler := newLogSampler(func() zerolog.Sampler {
 		return &zerolog.BurstSampler{
 			Burst:  1,
@@ -43,22 +52,30 @@ func loggingMiddleware(enableSampling bool) gin.HandlerFunc {
 
 	return func(c *gin.Context) {
 		begin := time.Now()
+		method := c.Request.Method
+
+		// add a request scoped logger to the context, so that log lines from
+		// the request handler can be correlated with this request
+		ctx := logging.WithRequestID(c.Request.Context(), uid.New().String())
+		ctx = logging.WithFields(ctx,
+			"method", method,
+			"path", c.Request.URL.Path)
+		c.Request = c.Request.WithContext(ctx)
+		logger := *logging.FromContext(ctx)
+
 		c.Next()
 
-		method := c.Request.Method
 		status := c.Writer.Status()
-		logger := logging.L.Logger
 
 		// sample logs for successful GET request if the log level is INFO or above
 		if enableSampling && status < 400 && method == http.MethodGet && zerolog.GlobalLevel() >= zerolog.InfoLevel {
 			logger = logger.Sample(sampler.Get(c.Request.Method, c.FullPath()))
 		}
 
-		event := logger.Info().
-			Str("method", method).
-			Str("path", c.Request.URL.Path).
+		level := opts.EventLevel(healthCheckPaths[c.Request.URL.Path])
+		event := logger.WithLevel(level).
 			Str("localAddr", c.Request.Host).
-			Str("remoteAddr", c.ClientIP()).
+			Str("remoteAddr", logging.ClientIP(c.Request.Context())).
 			Str("userAgent", c.Request.UserAgent())
 
 		if c.Request.ContentLength > 0 {
@@ -72,6 +89,9 @@ func loggingMiddleware(enableSampling bool) gin.HandlerFunc {
 		if org := rCtx.Authenticated.Organization; org != nil {
 			event = event.Str("orgID", org.ID.String())
 		}
+		if rCtx.APIVersion != "" {
+			event = event.Str("apiVersion", rCtx.APIVersion)
+		}
 		rCtx.Response.ApplyLogFields(event)
 
 		event.Dur("elapsed", time.Since(begin)).
@@ -80,3 +100,16 @@ func loggingMiddleware(enableSampling bool) gin.HandlerFunc {
 			Msg("API request completed")
 	}
 }
+
+// authenticatedLogFields returns the log fields that identify the organization
+// and user of an authenticated request.
+func authenticatedLogFields(authned access.Authenticated) []interface{} {
+	var fields []interface{}
+	if org := authned.Organization; org != nil {
+		fields = append(fields, "orgID", org.ID.String())
+	}
+	if user := authned.User; user != nil {
+		fields = append(fields, "userID", user.ID.String())
+	}
+	return fields
+}
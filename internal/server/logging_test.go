@@ -10,20 +10,27 @@ import (
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
 	"gotest.tools/v3/assert"
 
 	"github.com/infrahq/infra/internal/access"
 	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
 	"github.com/infrahq/infra/uid"
 )
 
 func TestLoggingMiddleware(t *testing.T) {
-	setup := func(t *testing.T, writer io.Writer) *gin.Engine {
+	setup := func(t *testing.T, writer io.Writer, opts ...logging.AccessLogOptions) *gin.Engine {
 		logging.PatchLogger(t, writer)
 
 		router := gin.New()
-		router.Use(loggingMiddleware(true))
+		accessLogOpts := logging.AccessLogOptions{DemoteHealthChecks: true}
+		if len(opts) > 0 {
+			accessLogOpts = opts[0]
+		}
+		router.Use(loggingMiddleware(true, accessLogOpts))
+		router.GET("/healthz", healthHandler)
 
 		router.GET("/good/:id", func(c *gin.Context) {})
 		router.POST("/good/:id", func(c *gin.Context) {})
@@ -115,6 +122,43 @@ func TestLoggingMiddleware(t *testing.T) {
 		}
 		assert.DeepEqual(t, actual, expected)
 	})
+
+	t.Run("health checks are demoted to debug", func(t *testing.T) {
+		b := &bytes.Buffer{}
+		router := setup(t, b)
+		resp := httptest.NewRecorder()
+
+		router.ServeHTTP(resp, httptest.NewRequest("GET", "/healthz", nil))
+		assert.Equal(t, len(decodeLogs(t, b)), 0)
+
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+		t.Cleanup(func() {
+			zerolog.SetGlobalLevel(zerolog.InfoLevel)
+		})
+		router.ServeHTTP(resp, httptest.NewRequest("GET", "/healthz", nil))
+
+		actual := decodeLogs(t, b)
+		expected := []logEntry{
+			{Method: "GET", Path: "/healthz", StatusCode: 200, Level: "debug"},
+		}
+		assert.DeepEqual(t, actual, expected)
+	})
+
+	t.Run("with access log level", func(t *testing.T) {
+		b := &bytes.Buffer{}
+		router := setup(t, b, logging.AccessLogOptions{Level: "warn"})
+		resp := httptest.NewRecorder()
+
+		router.ServeHTTP(resp, httptest.NewRequest("POST", "/good/1", nil))
+		router.ServeHTTP(resp, httptest.NewRequest("GET", "/healthz", nil))
+
+		actual := decodeLogs(t, b)
+		expected := []logEntry{
+			{Method: "POST", Path: "/good/1", StatusCode: 200, Level: "warn"},
+			{Method: "GET", Path: "/healthz", StatusCode: 200, Level: "warn"},
+		}
+		assert.DeepEqual(t, actual, expected)
+	})
 }
 
 func decodeLogs(t *testing.T, input io.Reader) []logEntry {
@@ -140,3 +184,61 @@ type logEntry struct {
 	UserID     uid.ID `json:"userID"`
 	OrgID      uid.ID `json:"orgID"`
 }
+
+func TestAPI_RequestScopedLogger(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+
+	b := &bytes.Buffer{}
+	logging.PatchLogger(t, b)
+	zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	t.Cleanup(func() {
+		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	})
+
+	// the error is logged from sendAPIError, which is called by the route handler
+	req := httptest.NewRequest(http.MethodGet, "/api/users/"+uid.New().String(), nil)
+	req.Header.Set("Infra-Version", apiVersionLatest)
+	req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+	resp := httptest.NewRecorder()
+	routes.ServeHTTP(resp, req)
+	assert.Equal(t, resp.Code, http.StatusNotFound, resp.Body.String())
+
+	type entry struct {
+		Message   string `json:"message"`
+		RequestID string `json:"requestID"`
+		Method    string `json:"method"`
+		Path      string `json:"path"`
+		OrgID     uid.ID `json:"orgID"`
+		UserID    uid.ID `json:"userID"`
+	}
+	var apiError, completed entry
+	dec := json.NewDecoder(b)
+	for dec.More() {
+		var e entry
+		assert.NilError(t, dec.Decode(&e))
+		switch e.Message {
+		case "api request error":
+			apiError = e
+		case "API request completed":
+			completed = e
+		}
+	}
+
+	admin, err := data.GetIdentity(srv.DB(), data.GetIdentityOptions{ByName: "admin@example.com"})
+	assert.NilError(t, err)
+
+	assert.Assert(t, apiError.RequestID != "")
+	expected := entry{
+		Message:   "api request error",
+		RequestID: apiError.RequestID,
+		Method:    http.MethodGet,
+		Path:      req.URL.Path,
+		OrgID:     srv.db.DefaultOrg.ID,
+		UserID:    admin.ID,
+	}
+	assert.DeepEqual(t, apiError, expected)
+
+	// the access log line has the same request ID
+	assert.Equal(t, completed.RequestID, apiError.RequestID)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"sort"
 	"testing"
 	"time"
 
@@ -101,7 +102,8 @@ func TestAPI_Login(t *testing.T) {
 						Domain:   "example.com",
 						MaxAge:   600,
 						HttpOnly: true,
-						SameSite: http.SameSiteStrictMode,
+						Secure:   true,
+						SameSite: http.SameSiteLaxMode,
 					},
 				}
 				actual := resp.Result().Cookies()
@@ -163,7 +165,8 @@ func TestAPI_Login(t *testing.T) {
 						Domain:   "example.com",
 						MaxAge:   600,
 						HttpOnly: true,
-						SameSite: http.SameSiteStrictMode,
+						Secure:   true,
+						SameSite: http.SameSiteLaxMode,
 					},
 				}
 				actual := resp.Result().Cookies()
@@ -183,7 +186,7 @@ func TestAPI_Login(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{Errors: []string{"one of (accessKey, passwordCredentials, oidc) is required"}},
+					{ErrorCode: api.ErrorCodeInvalid, Errors: []string{"one of (accessKey, passwordCredentials, oidc, mfa) is required"}},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
 			},
@@ -211,7 +214,7 @@ func TestAPI_Login(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{Errors: []string{"only one of (passwordCredentials, oidc) can have a value"}},
+					{ErrorCode: api.ErrorCodeInvalid, Errors: []string{"only one of (passwordCredentials, oidc) can have a value"}},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
 			},
@@ -233,10 +236,12 @@ func TestAPI_Login(t *testing.T) {
 				expected := []api.FieldError{
 					{
 						FieldName: "passwordCredentials.name",
+						ErrorCode: api.ErrorCodeRequired,
 						Errors:    []string{"is required"},
 					},
 					{
 						FieldName: "passwordCredentials.password",
+						ErrorCode: api.ErrorCodeRequired,
 						Errors:    []string{"is required"},
 					},
 				}
@@ -258,10 +263,12 @@ func TestAPI_Login(t *testing.T) {
 				expected := []api.FieldError{
 					{
 						FieldName: "oidc.code",
+						ErrorCode: api.ErrorCodeRequired,
 						Errors:    []string{"is required"},
 					},
 					{
 						FieldName: "oidc.redirectURL",
+						ErrorCode: api.ErrorCodeRequired,
 						Errors:    []string{"is required"},
 					},
 				}
@@ -308,3 +315,60 @@ func cmpApiTimeWithThreshold(threshold time.Duration) cmp.Option {
 		return delta <= threshold && delta >= -threshold
 	})
 }
+
+func TestAPI_Login_FailuresAreIndistinguishable(t *testing.T) {
+	if testing.Short() {
+		t.Skip("too slow for -short run")
+	}
+	srv := setupServer(t)
+	routes := srv.GenerateRoutes()
+
+	user := &models.Identity{Name: "someone@example.com"}
+	createIdentities(t, srv.DB(), user)
+	hash, err := bcrypt.GenerateFromPassword([]byte("the-password"), bcrypt.DefaultCost)
+	assert.NilError(t, err)
+	err = data.CreateCredential(srv.DB(), &models.Credential{IdentityID: user.ID, PasswordHash: hash})
+	assert.NilError(t, err)
+
+	login := func(t *testing.T, name string) (*httptest.ResponseRecorder, time.Duration) {
+		t.Helper()
+		body := jsonBody(t, api.LoginRequest{
+			PasswordCredentials: &api.LoginRequestPasswordCredentials{Name: name, Password: "wrong"},
+		})
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodPost, "/api/login", body)
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		start := time.Now()
+		routes.ServeHTTP(resp, req)
+		return resp, time.Since(start)
+	}
+
+	// median returns the median time of n failed logins for name
+	median := func(t *testing.T, name string, n int) (*httptest.ResponseRecorder, time.Duration) {
+		t.Helper()
+		var resp *httptest.ResponseRecorder
+		durations := make([]time.Duration, n)
+		for i := range durations {
+			resp, durations[i] = login(t, name)
+		}
+		sort.Slice(durations, func(i, j int) bool {
+			return durations[i] < durations[j]
+		})
+		return resp, durations[n/2]
+	}
+
+	wrongPassword, wrongPasswordTime := median(t, user.Name, 5)
+	unknownUser, unknownUserTime := median(t, "nobody@example.com", 5)
+
+	assert.Equal(t, wrongPassword.Code, http.StatusUnauthorized)
+	assert.Equal(t, unknownUser.Code, wrongPassword.Code)
+	assert.Equal(t, unknownUser.Body.String(), wrongPassword.Body.String())
+
+	// the password is compared even when the user does not exist, so the
+	// time of the two failures is similar. Without the comparison the
+	// unknown user is an order of magnitude faster.
+	ratio := float64(unknownUserTime) / float64(wrongPasswordTime)
+	assert.Assert(t, ratio > 0.5 && ratio < 2,
+		"unknown user took %v, wrong password took %v", unknownUserTime, wrongPasswordTime)
+}
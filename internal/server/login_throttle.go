@@ -0,0 +1,182 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/access"
+	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/lru"
+	"github.com/infrahq/infra/internal/server/audit"
+	"github.com/infrahq/infra/internal/server/authn"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+// loginFailuresPerAddress is the number of failed password logins from a
+// client address, for any user, after which logins from the address are
+// refused.
+const loginFailuresPerAddress = 10
+
+// addressLoginLimiter counts the failed password logins from each client
+// address. redis.Limiter is used when the server is configured with redis, so
+// that the failures are counted by all the replicas of the server.
+//
+// A successful login does not reset the count of the address, because the
+// failures may have been for a different user.
+type addressLoginLimiter interface {
+	// LoginOK returns a redis.OverLimitError when logins from key are refused.
+	LoginOK(key string) error
+	// LoginBad counts a failed login from key.
+	LoginBad(key string, limit int)
+}
+
+// memoryLoginLimiter counts the failed logins from each address with a
+// memoryRateLimiter. Each failure uses a request of the limit, so an address
+// can fail loginFailuresPerAddress logins a minute.
+type memoryLoginLimiter struct {
+	limiter *memoryRateLimiter
+}
+
+func newMemoryLoginLimiter() memoryLoginLimiter {
+	return memoryLoginLimiter{limiter: newMemoryRateLimiter(maxAddressRateLimitBuckets)}
+}
+
+func (m memoryLoginLimiter) LoginOK(key string) error {
+	return m.limiter.Check(key, loginFailuresPerAddress)
+}
+
+func (m memoryLoginLimiter) LoginBad(key string, limit int) {
+	// an error means the address is already over the limit, or the limiter is
+	// full. Either way there is nothing more to count.
+	_, _ = m.limiter.Allow(key, limit)
+}
+
+// maxUnknownUserLogins is the maximum number of usernames without a password
+// for which failed logins are counted.
+const maxUnknownUserLogins = 10_000
+
+// unknownUserLogins counts the failed password logins for usernames that do
+// not exist or have no password. The logins are delayed and locked the same
+// way as the logins of a user with a password, so that the responses do not
+// show which usernames exist. The counts are stored in memory, because there
+// is no credential to store them in.
+type unknownUserLogins struct {
+	mu    sync.Mutex
+	creds *lru.Cache[string, models.Credential]
+}
+
+func newUnknownUserLogins() *unknownUserLogins {
+	return &unknownUserLogins{
+		creds: lru.New[string, models.Credential](lru.Options{
+			Name:       "unknown-user-logins",
+			MaxEntries: maxUnknownUserLogins,
+		}),
+	}
+}
+
+func unknownUserLoginKey(orgID uid.ID, username string) string {
+	return orgID.String() + ":" + username
+}
+
+func (u *unknownUserLogins) check(throttle authn.LoginThrottle, key string, now time.Time) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	cred, ok := u.creds.Get(key)
+	if !ok {
+		return nil
+	}
+	return throttle.Check(&cred, now)
+}
+
+func (u *unknownUserLogins) recordFailure(throttle authn.LoginThrottle, key string, now time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	cred, _ := u.creds.Get(key)
+	throttle.RecordFailure(&cred, now)
+	u.creds.Add(key, cred)
+}
+
+// checkLoginThrottle returns an error if a password login for username is
+// delayed, or the account is locked. Returns the credential of the user, or
+// nil if the user does not exist or has no password. Logins for those users
+// are throttled by unknownUserLogins.
+func (a *API) checkLoginThrottle(rCtx access.RequestContext, username string) (*models.Credential, error) {
+	checkUnknownUser := func() error {
+		key := unknownUserLoginKey(rCtx.DBTxn.OrganizationID(), username)
+		return a.server.unknownUserLogins.check(a.server.options.LoginThrottle, key, a.server.now())
+	}
+
+	identity, err := data.GetIdentity(rCtx.DBTxn, data.GetIdentityOptions{ByName: username})
+	if err != nil {
+		if errors.Is(err, internal.ErrNotFound) {
+			return nil, checkUnknownUser()
+		}
+		return nil, err
+	}
+
+	cred, err := data.GetCredentialByUserID(rCtx.DBTxn, identity.ID)
+	if err != nil {
+		if errors.Is(err, internal.ErrNotFound) {
+			return nil, checkUnknownUser()
+		}
+		return nil, err
+	}
+
+	return cred, a.server.options.LoginThrottle.Check(cred, a.server.now())
+}
+
+// recordFailedUnknownUserLogin counts a failed password login for a username
+// that does not exist or has no password.
+func (a *API) recordFailedUnknownUserLogin(c *gin.Context, username string) {
+	rCtx := getRequestContext(c)
+	key := unknownUserLoginKey(rCtx.DBTxn.OrganizationID(), username)
+	a.server.unknownUserLogins.recordFailure(a.server.options.LoginThrottle, key, a.server.now())
+}
+
+// recordFailedLogin counts a failed password login for the user, and locks the
+// account if there have been too many failures. The login transaction is
+// rolled back when the login fails, so the count is saved in a new
+// transaction.
+func (a *API) recordFailedLogin(c *gin.Context, username string, cred *models.Credential) {
+	rCtx := getRequestContext(c)
+	ctx := rCtx.Request.Context()
+
+	var locked bool
+	err := data.RetryTxn(ctx, rCtx.DataDB, rCtx.DBTxn.OrganizationID(), func(tx *data.Transaction) error {
+		current, err := data.GetCredentialByUserID(tx, cred.IdentityID)
+		if err != nil {
+			return err
+		}
+		locked = a.server.options.LoginThrottle.RecordFailure(current, a.server.now())
+		return data.UpdateCredentialLoginAttempts(tx, current)
+	})
+	if err != nil {
+		logging.L.Error().Err(err).Msg("failed to record failed login")
+		return
+	}
+
+	if locked {
+		event := newAuditEvent(c, audit.ActionUserLockout, auditTarget{Type: "user", ID: cred.IdentityID.String()}, nil)
+		event.ActorName = username
+		a.server.auditLog.Record(ctx, event)
+	}
+}
+
+// UnlockUser resets the failed password logins of a user, so that an account
+// that is locked can be used before the lockout expires.
+func (a *API) UnlockUser(c *gin.Context, r *api.Resource) (*api.EmptyResponse, error) {
+	err := access.UnlockCredential(c, r.ID)
+	a.recordAuditOnCommit(c, audit.ActionUserUnlock, auditTarget{Type: "user", ID: r.ID.String()}, err)
+	if err != nil {
+		return nil, fmt.Errorf("unlock user: %w", err)
+	}
+	return nil, nil
+}
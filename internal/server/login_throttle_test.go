@@ -0,0 +1,362 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/opt"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/server/audit"
+	"github.com/infrahq/infra/internal/server/authn"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+func TestAPI_LoginThrottle(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	srv.options.LoginThrottle = authn.LoginThrottle{
+		DelayThreshold:   2,
+		LockoutThreshold: 4,
+		LockoutDuration:  10 * time.Minute,
+	}
+	routes := srv.GenerateRoutes()
+	sink := withMemoryAuditSink(srv)
+
+	now := time.Date(2023, 1, 25, 10, 0, 0, 0, time.UTC)
+	srv.now = func() time.Time { return now }
+
+	user := createPasswordUser(t, srv, "bob@example.com", "hunter2")
+	admin, err := data.GetIdentity(srv.DB(), data.GetIdentityOptions{ByName: "admin@example.com"})
+	assert.NilError(t, err)
+
+	login := func(t *testing.T, password string) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodPost, "/api/login", jsonBody(t, api.LoginRequest{
+			PasswordCredentials: &api.LoginRequestPasswordCredentials{Name: user.Name, Password: password},
+		}))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	failLogin := func(t *testing.T) {
+		t.Helper()
+		resp := login(t, "wrong")
+		assert.Equal(t, resp.Code, http.StatusUnauthorized, (*responseDebug)(resp))
+	}
+
+	failedLoginEvent := models.AuditEvent{
+		OrganizationMember: models.OrganizationMember{OrganizationID: srv.db.DefaultOrg.ID},
+		ActorName:          user.Name,
+		Action:             audit.ActionLogin,
+		Result:             models.AuditResultFailure,
+		Reason:             "failed to login: incorrect password: " + bcrypt.ErrMismatchedHashAndPassword.Error(),
+	}
+	lockoutEvent := models.AuditEvent{
+		OrganizationMember: models.OrganizationMember{OrganizationID: srv.db.DefaultOrg.ID},
+		ActorName:          user.Name,
+		Action:             audit.ActionUserLockout,
+		TargetType:         "user",
+		TargetID:           user.ID.String(),
+		Result:             models.AuditResultSuccess,
+	}
+
+	// lock drives failed logins until the account is locked
+	lock := func(t *testing.T) {
+		t.Helper()
+		failLogin(t)
+		failLogin(t)
+
+		// after DelayThreshold failures logins are delayed, even with the
+		// right password
+		resp := login(t, "hunter2")
+		assert.Equal(t, resp.Code, http.StatusTooManyRequests, (*responseDebug)(resp))
+		assert.Equal(t, resp.Header().Get("Retry-After"), "1")
+
+		now = now.Add(time.Second)
+		failLogin(t)
+
+		// the delay doubles after each failure
+		resp = login(t, "hunter2")
+		assert.Equal(t, resp.Code, http.StatusTooManyRequests, (*responseDebug)(resp))
+		assert.Equal(t, resp.Header().Get("Retry-After"), "2")
+
+		now = now.Add(2 * time.Second)
+		sink.Events(t) // discard the events from the previous attempts
+		failLogin(t)
+
+		assert.DeepEqual(t, sink.Events(t), []models.AuditEvent{lockoutEvent, failedLoginEvent})
+	}
+
+	t.Run("lockout expires after the cooldown", func(t *testing.T) {
+		lock(t)
+
+		resp := login(t, "hunter2")
+		assert.Equal(t, resp.Code, http.StatusForbidden, (*responseDebug)(resp))
+		assert.Equal(t, resp.Header().Get("Retry-After"), "600")
+
+		var respErr api.Error
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &respErr))
+		assert.Equal(t, respErr.ErrorCode, api.ErrorCodeAccountLocked)
+		lockedLoginEvent := failedLoginEvent
+		lockedLoginEvent.Reason = "account is locked because of too many failed login attempts, retry after 10m0s"
+		assert.DeepEqual(t, sink.Events(t), []models.AuditEvent{lockedLoginEvent})
+
+		now = now.Add(9 * time.Minute)
+		resp = login(t, "hunter2")
+		assert.Equal(t, resp.Code, http.StatusForbidden, (*responseDebug)(resp))
+
+		now = now.Add(time.Minute)
+		resp = login(t, "hunter2")
+		assert.Equal(t, resp.Code, http.StatusCreated, (*responseDebug)(resp))
+
+		// a successful login resets the count
+		cred, err := data.GetCredentialByUserID(srv.DB(), user.ID)
+		assert.NilError(t, err)
+		assert.Equal(t, cred.FailedLoginAttempts, 0)
+		assert.Assert(t, cred.LockedUntil == nil)
+	})
+
+	t.Run("admin unlock", func(t *testing.T) {
+		now = now.Add(time.Hour)
+		lock(t)
+
+		path := "/api/users/" + user.ID.String() + "/lockout"
+
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodDelete, path, nil)
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		assert.Equal(t, resp.Code, http.StatusNoContent, (*responseDebug)(resp))
+
+		assert.DeepEqual(t, sink.Events(t), []models.AuditEvent{
+			{
+				OrganizationMember: models.OrganizationMember{OrganizationID: srv.db.DefaultOrg.ID},
+				ActorID:            admin.ID,
+				ActorName:          admin.Name,
+				Action:             audit.ActionUserUnlock,
+				TargetType:         "user",
+				TargetID:           user.ID.String(),
+				Result:             models.AuditResultSuccess,
+			},
+		})
+
+		resp = login(t, "hunter2")
+		assert.Equal(t, resp.Code, http.StatusCreated, (*responseDebug)(resp))
+	})
+}
+
+func TestAPI_LoginThrottle_UnknownUser(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	srv.options.LoginThrottle = authn.LoginThrottle{
+		DelayThreshold:   2,
+		LockoutThreshold: 4,
+		LockoutDuration:  10 * time.Minute,
+	}
+	routes := srv.GenerateRoutes()
+
+	now := time.Date(2023, 1, 25, 10, 0, 0, 0, time.UTC)
+	srv.now = func() time.Time { return now }
+
+	createPasswordUser(t, srv, "bob@example.com", "hunter2")
+
+	login := func(t *testing.T, name string) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodPost, "/api/login", jsonBody(t, api.LoginRequest{
+			PasswordCredentials: &api.LoginRequestPasswordCredentials{Name: name, Password: "wrong"},
+		}))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	type response struct {
+		Code       int
+		RetryAfter string
+	}
+
+	// attempts returns the responses to the same sequence of failed logins
+	// that locks the account of a user.
+	attempts := func(t *testing.T, name string) []response {
+		var responses []response
+		record := func() {
+			resp := login(t, name)
+			responses = append(responses, response{Code: resp.Code, RetryAfter: resp.Header().Get("Retry-After")})
+		}
+		record()
+		record()
+		record()
+		now = now.Add(time.Second)
+		record()
+		record()
+		now = now.Add(2 * time.Second)
+		record()
+		record()
+		return responses
+	}
+
+	expected := []response{
+		{Code: http.StatusUnauthorized},
+		{Code: http.StatusUnauthorized},
+		{Code: http.StatusTooManyRequests, RetryAfter: "1"},
+		{Code: http.StatusUnauthorized},
+		{Code: http.StatusTooManyRequests, RetryAfter: "2"},
+		{Code: http.StatusUnauthorized},
+		{Code: http.StatusForbidden, RetryAfter: "600"},
+	}
+	assert.DeepEqual(t, attempts(t, "bob@example.com"), expected)
+	assert.DeepEqual(t, attempts(t, "nobody@example.com"), expected)
+}
+
+func TestAPI_LoginThrottle_ClientAddress(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+
+	limiter := newMemoryRateLimiter(maxAddressRateLimitBuckets)
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	srv.addressLogins = memoryLoginLimiter{limiter: limiter}
+
+	createPasswordUser(t, srv, "mallory@example.com", "mallory-password")
+
+	login := func(t *testing.T, name, password string) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodPost, "/api/login", jsonBody(t, api.LoginRequest{
+			PasswordCredentials: &api.LoginRequestPasswordCredentials{Name: name, Password: password},
+		}))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+	// failures are for different users, so that only the limit of the
+	// address applies.
+	fail := func(t *testing.T, count int) {
+		t.Helper()
+		for i := 0; i < count; i++ {
+			resp := login(t, fmt.Sprintf("user%d@example.com", i), "wrong")
+			assert.Equal(t, resp.Code, http.StatusUnauthorized, resp.Body.String())
+		}
+	}
+
+	fail(t, loginFailuresPerAddress/2)
+
+	// a successful login for another user does not reset the failures
+	resp := login(t, "mallory@example.com", "mallory-password")
+	assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+
+	fail(t, loginFailuresPerAddress-loginFailuresPerAddress/2)
+
+	resp = login(t, "mallory@example.com", "mallory-password")
+	assert.Equal(t, resp.Code, http.StatusTooManyRequests, resp.Body.String())
+	assert.Equal(t, resp.Header().Get("Retry-After"), "6")
+
+	// a login is allowed once a failure is refilled
+	now = now.Add(6 * time.Second)
+	resp = login(t, "mallory@example.com", "mallory-password")
+	assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+}
+
+func TestAPI_LoginOneTimePassword(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	srv.options.LoginThrottle = authn.LoginThrottle{OneTimePasswordAttempts: 3}
+	routes := srv.GenerateRoutes()
+
+	login := func(t *testing.T, name, password string) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodPost, "/api/login", jsonBody(t, api.LoginRequest{
+			PasswordCredentials: &api.LoginRequestPasswordCredentials{Name: name, Password: password},
+		}))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	createUser := func(t *testing.T, name string) api.CreateUserResponse {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodPost, "/api/users", jsonBody(t, api.CreateUserRequest{Name: name}))
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		assert.Equal(t, resp.Code, http.StatusCreated, (*responseDebug)(resp))
+
+		var created api.CreateUserResponse
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &created))
+		return created
+	}
+
+	t.Run("invite expiry", func(t *testing.T) {
+		user := createUser(t, "expiry@example.com")
+
+		cred, err := data.GetCredentialByUserID(srv.DB(), user.ID)
+		assert.NilError(t, err)
+		assert.Assert(t, cred.OneTimePasswordExpiresAt != nil)
+		assert.DeepEqual(t, *cred.OneTimePasswordExpiresAt, time.Now().Add(defaultInviteExpiry), opt.TimeWithThreshold(time.Minute))
+
+		expired := time.Now().Add(-time.Second)
+		cred.OneTimePasswordExpiresAt = &expired
+		assert.NilError(t, data.UpdateCredentialLoginAttempts(srv.DB(), cred))
+
+		resp := login(t, user.Name, user.OneTimePassword)
+		assert.Equal(t, resp.Code, http.StatusUnauthorized, (*responseDebug)(resp))
+	})
+
+	t.Run("reuse after success", func(t *testing.T) {
+		user := createUser(t, "reuse@example.com")
+
+		resp := login(t, user.Name, user.OneTimePassword)
+		assert.Equal(t, resp.Code, http.StatusCreated, (*responseDebug)(resp))
+
+		resp = login(t, user.Name, user.OneTimePassword)
+		assert.Equal(t, resp.Code, http.StatusUnauthorized, (*responseDebug)(resp))
+	})
+
+	t.Run("attempts exhausted", func(t *testing.T) {
+		user := createUser(t, "attempts@example.com")
+
+		for i := 0; i < 3; i++ {
+			resp := login(t, user.Name, "wrong")
+			assert.Equal(t, resp.Code, http.StatusUnauthorized, (*responseDebug)(resp))
+		}
+
+		// the right password no longer works
+		resp := login(t, user.Name, user.OneTimePassword)
+		assert.Equal(t, resp.Code, http.StatusUnauthorized, (*responseDebug)(resp))
+
+		// an admin re-issues a one-time password
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodPut, "/api/users/"+user.ID.String(), jsonBody(t, api.UpdateUserRequest{
+			Password: "reissued-password",
+		}))
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp = httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+
+		cred, err := data.GetCredentialByUserID(srv.DB(), user.ID)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, *cred.OneTimePasswordExpiresAt, time.Now().Add(defaultPasswordResetExpiry), opt.TimeWithThreshold(time.Minute))
+
+		resp = login(t, user.Name, "reissued-password")
+		assert.Equal(t, resp.Code, http.StatusCreated, (*responseDebug)(resp))
+	})
+}
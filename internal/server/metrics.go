@@ -1,17 +1,37 @@
 package server
 
 import (
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
 
 	"github.com/infrahq/infra/internal/logging"
 	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
 	"github.com/infrahq/infra/metrics"
+	"github.com/infrahq/infra/uid"
 )
 
-func setupMetrics(db *data.DB) *prometheus.Registry {
+// setupMetrics returns a registry with the metrics of db, and of the in-memory
+// caches of the server. orgLabel adds the ID of the organization to the labels
+// of the metrics of each destination.
+func setupMetrics(db *data.DB, orgLabel bool, caches ...prometheus.Collector) *prometheus.Registry {
 	registry := metrics.NewRegistry(productVersion())
+	registry.MustRegister(caches...)
 	registry.MustRegister(collectors.NewDBStatsCollector(db.SQLdb(), "postgres"))
+	if replica := db.ReplicaSQLdb(); replica != nil {
+		registry.MustRegister(collectors.NewDBStatsCollector(replica, "postgres_replica"))
+	}
+	if cache := db.CacheMetrics(); cache != nil {
+		registry.MustRegister(cache)
+	}
+	registry.MustRegister(db.SlowQueryCounter())
+	registry.MustRegister(db.QueryDurationHistogram())
+	registry.MustRegister(authFailuresCounter)
+	registry.MustRegister(purgedRowsCounter)
 
 	registry.MustRegister(metrics.NewCollector(prometheus.Opts{
 		Namespace: "infra",
@@ -123,5 +143,175 @@ func setupMetrics(db *data.DB) *prometheus.Registry {
 		}
 	}))
 
+	registry.MustRegister(newDestinationMetricsCollector(db, orgLabel))
+
 	return registry
 }
+
+// destinationMetricsCollector exports the latest metrics reported by the
+// connector of each destination. When a connector stops reporting, only
+// infra_destination_metrics_stale is exported for its destination, so that a
+// missing report can not be mistaken for a destination without any requests.
+type destinationMetricsCollector struct {
+	db *data.DB
+	// orgLabel adds the ID of the organization to the labels. Without it,
+	// destinations with the same name in different organizations are
+	// exported as a single destination.
+	orgLabel    bool
+	requestRate *prometheus.Desc
+	errorRate   *prometheus.Desc
+	syncLag     *prometheus.Desc
+	stale       *prometheus.Desc
+
+	mu       sync.Mutex
+	cached   []data.DestinationMetrics
+	cachedAt time.Time
+}
+
+// destinationMetricsCacheTTL is how long the metrics read from the database
+// are used for scrapes. Connectors report once a minute, so scrapes within
+// this period would read the same reports.
+const destinationMetricsCacheTTL = 30 * time.Second
+
+// maxDestinationMetrics is the maximum number of destinations exported by
+// destinationMetricsCollector.
+const maxDestinationMetrics = 10_000
+
+func newDestinationMetricsCollector(db *data.DB, orgLabel bool) *destinationMetricsCollector {
+	labels := []string{"destination"}
+	if orgLabel {
+		labels = []string{"org", "destination"}
+	}
+	return &destinationMetricsCollector{
+		db:       db,
+		orgLabel: orgLabel,
+		requestRate: prometheus.NewDesc("infra_destination_proxy_request_rate",
+			"Requests per second proxied by the connector of the destination", labels, nil),
+		errorRate: prometheus.NewDesc("infra_destination_proxy_error_rate",
+			"Fraction of the requests proxied by the connector of the destination that failed", labels, nil),
+		syncLag: prometheus.NewDesc("infra_destination_sync_lag_seconds",
+			"Seconds since the connector of the destination confirmed its grants were up to date", labels, nil),
+		stale: prometheus.NewDesc("infra_destination_metrics_stale",
+			"1 when the connector of the destination has not reported metrics recently", labels, nil),
+	}
+}
+
+func (c *destinationMetricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.requestRate
+	ch <- c.errorRate
+	ch <- c.syncLag
+	ch <- c.stale
+}
+
+// list returns the metrics of every destination, read from the database at
+// most once every destinationMetricsCacheTTL.
+func (c *destinationMetricsCollector) list(now time.Time) ([]data.DestinationMetrics, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cached != nil && now.Sub(c.cachedAt) < destinationMetricsCacheTTL {
+		return c.cached, nil
+	}
+	all, err := data.ListAllDestinationMetrics(c.db, maxDestinationMetrics)
+	if err != nil {
+		return nil, err
+	}
+	if len(all) == maxDestinationMetrics {
+		logging.L.Warn().Int("limit", maxDestinationMetrics).Msg("destination metrics are only exported for some destinations")
+	}
+	c.cached, c.cachedAt = all, now
+	return all, nil
+}
+
+// destinationSeries is the value of the metrics of one set of labels. It
+// combines every destination with those labels.
+type destinationSeries struct {
+	labels       []string
+	stale        bool
+	reporting    bool
+	requestRate  float64
+	errorsPerSec float64
+	syncLag      *float64
+}
+
+func (s *destinationSeries) add(history models.DestinationMetricsHistory, now time.Time) {
+	if history.Stale(now) {
+		s.stale = true
+		return
+	}
+	s.reporting = true
+	latest := history.Latest()
+	s.requestRate += latest.ProxyRequestRate()
+	s.errorsPerSec += latest.ProxyRequestRate() * latest.ProxyErrorRate()
+	if lag := latest.SyncLagSeconds; lag != nil && (s.syncLag == nil || *lag > *s.syncLag) {
+		s.syncLag = lag
+	}
+}
+
+func (c *destinationMetricsCollector) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+	all, err := c.list(now)
+	if err != nil {
+		logging.L.Warn().Err(err).Msg("destination metrics")
+		return
+	}
+
+	type seriesKey struct {
+		org  uid.ID
+		name string
+	}
+	var series []*destinationSeries
+	byKey := make(map[seriesKey]*destinationSeries, len(all))
+	for _, dest := range all {
+		key := seriesKey{name: dest.DestinationName}
+		labels := []string{dest.DestinationName}
+		if c.orgLabel {
+			key.org = dest.OrganizationID
+			labels = []string{dest.OrganizationID.String(), dest.DestinationName}
+		}
+		s, ok := byKey[key]
+		if !ok {
+			s = &destinationSeries{labels: labels}
+			byKey[key] = s
+			series = append(series, s)
+		}
+		s.add(dest.History, now)
+	}
+
+	for _, s := range series {
+		stale := 0.0
+		if s.stale {
+			stale = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.stale, prometheus.GaugeValue, stale, s.labels...)
+		if !s.reporting {
+			continue
+		}
+
+		errorRate := 0.0
+		if s.requestRate > 0 {
+			errorRate = s.errorsPerSec / s.requestRate
+		}
+		ch <- prometheus.MustNewConstMetric(c.requestRate, prometheus.GaugeValue, s.requestRate, s.labels...)
+		ch <- prometheus.MustNewConstMetric(c.errorRate, prometheus.GaugeValue, errorRate, s.labels...)
+		if s.syncLag != nil {
+			ch <- prometheus.MustNewConstMetric(c.syncLag, prometheus.GaugeValue, *s.syncLag, s.labels...)
+		}
+	}
+}
+
+func (s *Server) metricsMiddlewareOptions() metrics.MiddlewareOptions {
+	if !s.options.Metrics.OrgLabel {
+		return metrics.MiddlewareOptions{}
+	}
+	return metrics.MiddlewareOptions{OrgLabel: requestOrgLabel}
+}
+
+// requestOrgLabel returns the ID of the organization of the request, or an
+// empty string when the request did not identify an organization.
+func requestOrgLabel(c *gin.Context) string {
+	org := getRequestContext(c).Authenticated.Organization
+	if org == nil {
+		return ""
+	}
+	return org.ID.String()
+}
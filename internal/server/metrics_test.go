@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io/ioutil"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,9 +17,9 @@ import (
 )
 
 func TestMetrics(t *testing.T) {
-	run := func(db *data.DB, s string) []byte {
+	run := func(db *data.DB, s string, caches ...prometheus.Collector) []byte {
 		patchProductVersion(t, "9.9.9")
-		registry := setupMetrics(db)
+		registry := setupMetrics(db, false, caches...)
 
 		tempfile, err := ioutil.TempFile(t.TempDir(), t.Name())
 		assert.NilError(t, err)
@@ -41,6 +42,21 @@ func TestMetrics(t *testing.T) {
 		assert.Equal(t, string(actual), expected)
 	})
 
+	t.Run("database pool", func(t *testing.T) {
+		db := setupDB(t)
+
+		actual := string(run(db, `go_sql_[a-z_]+{db_name="postgres"}`))
+		for _, name := range []string{
+			"go_sql_max_open_connections",
+			"go_sql_open_connections",
+			"go_sql_in_use_connections",
+			"go_sql_wait_count_total",
+			"go_sql_wait_duration_seconds_total",
+		} {
+			assert.Assert(t, strings.Contains(actual, name+`{db_name="postgres"}`), actual)
+		}
+	})
+
 	t.Run("infra users", func(t *testing.T) {
 		db := setupDB(t)
 
@@ -94,4 +110,36 @@ func TestMetrics(t *testing.T) {
 		actual := run(db, `infra_destinations({.*})? \d+`)
 		golden.Assert(t, string(actual), t.Name())
 	})
+
+	t.Run("db reads cache", func(t *testing.T) {
+		db := setupDB(t)
+		_, err := data.GetOrgSettings(db)
+		assert.NilError(t, err)
+
+		actual := string(run(db, `infra_cache_[a-z_]+{cache="db-reads"} \d+`))
+		for _, name := range []string{
+			"infra_cache_entries",
+			"infra_cache_evictions_total",
+			"infra_cache_hits_total",
+			"infra_cache_misses_total",
+		} {
+			assert.Assert(t, strings.Contains(actual, name+`{cache="db-reads"}`), actual)
+		}
+	})
+
+	t.Run("caches", func(t *testing.T) {
+		db := setupDB(t)
+		cache := newUnknownUserLogins().creds
+		cache.Add("nobody@example.com", models.Credential{})
+		cache.Get("nobody@example.com")
+
+		actual := string(run(db, `infra_cache_[a-z_]+{cache="unknown-user-logins"} \d+`, cache))
+		expected := strings.Join([]string{
+			`infra_cache_entries{cache="unknown-user-logins"} 1`,
+			`infra_cache_evictions_total{cache="unknown-user-logins"} 0`,
+			`infra_cache_hits_total{cache="unknown-user-logins"} 1`,
+			`infra_cache_misses_total{cache="unknown-user-logins"} 0`,
+		}, "\n")
+		assert.Equal(t, actual, expected)
+	})
 }
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/access"
+	"github.com/infrahq/infra/internal/server/audit"
+	"github.com/infrahq/infra/internal/server/authn"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/internal/validate"
+)
+
+// mfaRateLimit is the number of TOTP codes a user may try per minute, for
+// both confirming an enrollment and logging in.
+const mfaRateLimit = 5
+
+// mfaIssuer is the issuer shown by authenticator apps.
+const mfaIssuer = "Infra"
+
+func mfaRateLimitKey(userID string) string {
+	return "mfa:" + userID
+}
+
+// EnrollTOTP creates a new TOTP secret for the calling user. The enrollment
+// is not used to log in until it is confirmed with ConfirmTOTP.
+func (a *API) EnrollTOTP(c *gin.Context, _ *api.EmptyRequest) (*api.EnrollTOTPResponse, error) {
+	rCtx := getRequestContext(c)
+	user := rCtx.Authenticated.User
+	if user == nil {
+		return nil, fmt.Errorf("%w: only users can enroll in mfa", internal.ErrBadRequest)
+	}
+
+	// MFA is only used for password logins, other identity providers are
+	// responsible for their own MFA
+	if _, err := data.GetCredentialByUserID(rCtx.DBTxn, user.ID); err != nil {
+		if errors.Is(err, internal.ErrNotFound) {
+			return nil, fmt.Errorf("%w: only users who log in with a password can enroll in mfa", internal.ErrBadRequest)
+		}
+		return nil, err
+	}
+
+	existing, err := data.GetUserMFA(rCtx.DBTxn, user.ID)
+	switch {
+	case errors.Is(err, internal.ErrNotFound):
+	case err != nil:
+		return nil, err
+	case existing.Confirmed:
+		return nil, fmt.Errorf("%w: already enrolled in mfa, an admin must reset it before enrolling again", internal.ErrBadRequest)
+	default:
+		// replace an enrollment that was never confirmed
+		if err := data.DeleteUserMFA(rCtx.DBTxn, user.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	secret, err := authn.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	mfa := &models.UserMFA{
+		IdentityID: user.ID,
+		TOTPSecret: models.EncryptedAtRest(secret),
+	}
+	if err := data.CreateUserMFA(rCtx.DBTxn, mfa); err != nil {
+		return nil, err
+	}
+
+	return &api.EnrollTOTPResponse{
+		Secret: secret,
+		URI:    authn.TOTPURI(mfaIssuer, user.Name, secret),
+	}, nil
+}
+
+// ConfirmTOTP completes an enrollment with the first code from the
+// authenticator app, and returns the recovery codes.
+func (a *API) ConfirmTOTP(c *gin.Context, r *api.ConfirmTOTPRequest) (*api.ConfirmTOTPResponse, error) {
+	rCtx := getRequestContext(c)
+	user := rCtx.Authenticated.User
+	if user == nil {
+		return nil, fmt.Errorf("%w: only users can enroll in mfa", internal.ErrBadRequest)
+	}
+
+	if _, err := a.server.rateLimiter.Allow(mfaRateLimitKey(user.ID.String()), mfaRateLimit); err != nil {
+		return nil, err
+	}
+
+	mfa, err := data.GetUserMFA(rCtx.DBTxn, user.ID)
+	if err != nil {
+		if errors.Is(err, internal.ErrNotFound) {
+			return nil, fmt.Errorf("%w: not enrolled in mfa", internal.ErrBadRequest)
+		}
+		return nil, err
+	}
+	if mfa.Confirmed {
+		return nil, fmt.Errorf("%w: mfa enrollment is already confirmed", internal.ErrBadRequest)
+	}
+
+	step, err := authn.ValidateTOTPCode(string(mfa.TOTPSecret), r.Code, a.server.now(), mfa.LastUsedStep)
+	if err != nil {
+		if errors.Is(err, authn.ErrInvalidTOTPCode) {
+			return nil, validate.Error{"code": {"invalid code"}}
+		}
+		return nil, err
+	}
+
+	codes, hashes, err := authn.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	mfa.Confirmed = true
+	mfa.LastUsedStep = step
+	mfa.RecoveryCodes = hashes
+	err = data.UpdateUserMFA(rCtx.DBTxn, mfa)
+	a.recordAuditOnCommit(c, audit.ActionMFAEnroll, userAuditTarget(user), err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.ConfirmTOTPResponse{RecoveryCodes: codes}, nil
+}
+
+// ResetUserMFA removes the MFA enrollment of a user, for when they have lost
+// both their authenticator app and their recovery codes.
+func (a *API) ResetUserMFA(c *gin.Context, r *api.ResetUserMFARequest) (*api.EmptyResponse, error) {
+	err := access.ResetUserMFA(c, r.ID)
+	a.recordAuditOnCommit(c, audit.ActionMFAReset, auditTarget{Type: "user", ID: r.ID.String()}, err)
+	return nil, err
+}
@@ -0,0 +1,305 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/server/authn"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+func TestAPI_MFA(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+
+	now := time.Date(2023, 1, 24, 10, 0, 0, 0, time.UTC)
+	srv.now = func() time.Time { return now }
+	srv.rateLimiter.(*memoryRateLimiter).now = srv.now
+
+	user := createPasswordUser(t, srv, "alice@example.com", "hunter2")
+
+	request := func(t *testing.T, method, path, accessKey string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(method, path, jsonBody(t, body))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		if accessKey != "" {
+			req.Header.Set("Authorization", "Bearer "+accessKey)
+		}
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	login := func(t *testing.T, req api.LoginRequest) api.LoginResponse {
+		t.Helper()
+		resp := request(t, http.MethodPost, "/api/login", "", req)
+		assert.Equal(t, resp.Code, http.StatusCreated, (*responseDebug)(resp))
+
+		var loginResp api.LoginResponse
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &loginResp))
+		return loginResp
+	}
+
+	passwordLogin := func(t *testing.T) api.LoginResponse {
+		t.Helper()
+		return login(t, api.LoginRequest{
+			PasswordCredentials: &api.LoginRequestPasswordCredentials{Name: user.Name, Password: "hunter2"},
+		})
+	}
+
+	codeAt := func(t *testing.T, secret string, at time.Time) string {
+		t.Helper()
+		code, err := authn.TOTPCode(secret, at)
+		assert.NilError(t, err)
+		return code
+	}
+
+	// login before enrolling does not require a code
+	loginResp := passwordLogin(t)
+	assert.Assert(t, loginResp.AccessKey != "")
+	assert.Assert(t, !loginResp.MFARequired)
+	accessKey := loginResp.AccessKey
+
+	var secret string
+	var recoveryCodes []string
+
+	t.Run("enroll", func(t *testing.T) {
+		resp := request(t, http.MethodPost, "/api/users/self/mfa/totp", accessKey, api.EmptyRequest{})
+		assert.Equal(t, resp.Code, http.StatusCreated, (*responseDebug)(resp))
+
+		var enrollResp api.EnrollTOTPResponse
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &enrollResp))
+		assert.Assert(t, enrollResp.Secret != "")
+		assert.Equal(t, enrollResp.URI, authn.TOTPURI("Infra", user.Name, enrollResp.Secret))
+		secret = enrollResp.Secret
+
+		// the enrollment is not confirmed until the first code is used
+		mfa, err := data.GetUserMFA(srv.DB(), user.ID)
+		assert.NilError(t, err)
+		assert.Equal(t, string(mfa.TOTPSecret), secret)
+		assert.Assert(t, !mfa.Confirmed)
+
+		// an unconfirmed enrollment is not used to log in
+		assert.Assert(t, passwordLogin(t).AccessKey != "")
+	})
+
+	t.Run("confirm with the wrong code", func(t *testing.T) {
+		code := codeAt(t, secret, now.Add(-2*30*time.Second))
+		resp := request(t, http.MethodPost, "/api/users/self/mfa/totp/confirm", accessKey, api.ConfirmTOTPRequest{Code: code})
+		assert.Equal(t, resp.Code, http.StatusBadRequest, (*responseDebug)(resp))
+	})
+
+	t.Run("confirm", func(t *testing.T) {
+		code := codeAt(t, secret, now)
+		resp := request(t, http.MethodPost, "/api/users/self/mfa/totp/confirm", accessKey, api.ConfirmTOTPRequest{Code: code})
+		assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+
+		var confirmResp api.ConfirmTOTPResponse
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &confirmResp))
+		assert.Equal(t, len(confirmResp.RecoveryCodes), 10)
+		recoveryCodes = confirmResp.RecoveryCodes
+
+		// can not enroll again
+		resp = request(t, http.MethodPost, "/api/users/self/mfa/totp", accessKey, api.EmptyRequest{})
+		assert.Equal(t, resp.Code, http.StatusBadRequest, (*responseDebug)(resp))
+	})
+
+	t.Run("login with a code", func(t *testing.T) {
+		challenge := passwordLogin(t)
+		assert.Assert(t, challenge.MFARequired)
+		assert.Equal(t, challenge.AccessKey, "")
+		assert.Assert(t, challenge.MFAToken != "")
+
+		// the challenge can not be used as an access key
+		resp := request(t, http.MethodGet, "/api/users/self", challenge.MFAToken, nil)
+		assert.Equal(t, resp.Code, http.StatusUnauthorized, (*responseDebug)(resp))
+
+		// the challenge can not be exchanged for an access key
+		resp = request(t, http.MethodPost, "/api/login", "", api.LoginRequest{AccessKey: challenge.MFAToken})
+		assert.Equal(t, resp.Code, http.StatusUnauthorized, (*responseDebug)(resp))
+
+		// the code used to confirm the enrollment can not be used again
+		resp = request(t, http.MethodPost, "/api/login", "", api.LoginRequest{
+			MFA: &api.LoginRequestMFA{Token: challenge.MFAToken, Code: codeAt(t, secret, now)},
+		})
+		assert.Equal(t, resp.Code, http.StatusUnauthorized, (*responseDebug)(resp))
+
+		// the code from the next time step is accepted
+		loginResp := login(t, api.LoginRequest{
+			MFA: &api.LoginRequestMFA{Token: challenge.MFAToken, Code: codeAt(t, secret, now.Add(30*time.Second))},
+		})
+		assert.Equal(t, loginResp.UserID, user.ID)
+		assert.Assert(t, loginResp.AccessKey != "")
+		assert.Assert(t, !loginResp.MFARequired)
+
+		resp = request(t, http.MethodGet, "/api/users/self", loginResp.AccessKey, nil)
+		assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+
+		// the challenge can only be used once
+		now = now.Add(time.Minute)
+		resp = request(t, http.MethodPost, "/api/login", "", api.LoginRequest{
+			MFA: &api.LoginRequestMFA{Token: challenge.MFAToken, Code: codeAt(t, secret, now)},
+		})
+		assert.Equal(t, resp.Code, http.StatusUnauthorized, (*responseDebug)(resp))
+	})
+
+	t.Run("login with a recovery code", func(t *testing.T) {
+		now = now.Add(time.Minute)
+		challenge := passwordLogin(t)
+		assert.Assert(t, challenge.MFARequired)
+
+		loginResp := login(t, api.LoginRequest{
+			MFA: &api.LoginRequestMFA{Token: challenge.MFAToken, RecoveryCode: recoveryCodes[0]},
+		})
+		assert.Assert(t, loginResp.AccessKey != "")
+
+		mfa, err := data.GetUserMFA(srv.DB(), user.ID)
+		assert.NilError(t, err)
+		assert.Equal(t, len(mfa.RecoveryCodes), 9)
+
+		// recovery codes can only be used once
+		challenge = passwordLogin(t)
+		resp := request(t, http.MethodPost, "/api/login", "", api.LoginRequest{
+			MFA: &api.LoginRequestMFA{Token: challenge.MFAToken, RecoveryCode: recoveryCodes[0]},
+		})
+		assert.Equal(t, resp.Code, http.StatusUnauthorized, (*responseDebug)(resp))
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		now = now.Add(time.Minute)
+		challenge := passwordLogin(t)
+		for i := 0; i < 5; i++ {
+			resp := request(t, http.MethodPost, "/api/login", "", api.LoginRequest{
+				MFA: &api.LoginRequestMFA{Token: challenge.MFAToken, Code: "000000"},
+			})
+			assert.Equal(t, resp.Code, http.StatusUnauthorized, (*responseDebug)(resp))
+		}
+
+		resp := request(t, http.MethodPost, "/api/login", "", api.LoginRequest{
+			MFA: &api.LoginRequestMFA{Token: challenge.MFAToken, Code: codeAt(t, secret, now)},
+		})
+		assert.Equal(t, resp.Code, http.StatusTooManyRequests, (*responseDebug)(resp))
+
+		now = now.Add(time.Minute)
+		login(t, api.LoginRequest{
+			MFA: &api.LoginRequestMFA{Token: challenge.MFAToken, Code: codeAt(t, secret, now)},
+		})
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		path := "/api/users/" + user.ID.String() + "/mfa"
+
+		// users can not reset their own enrollment
+		resp := request(t, http.MethodDelete, path, accessKey, nil)
+		assert.Equal(t, resp.Code, http.StatusForbidden, (*responseDebug)(resp))
+
+		resp = request(t, http.MethodDelete, path, adminAccessKey(srv), nil)
+		assert.Equal(t, resp.Code, http.StatusNoContent, (*responseDebug)(resp))
+
+		resp = request(t, http.MethodDelete, path, adminAccessKey(srv), nil)
+		assert.Equal(t, resp.Code, http.StatusNotFound, (*responseDebug)(resp))
+
+		loginResp := passwordLogin(t)
+		assert.Assert(t, loginResp.AccessKey != "")
+		assert.Assert(t, !loginResp.MFARequired)
+	})
+}
+
+func TestAPI_MFA_RequireMFA(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+
+	now := time.Date(2023, 1, 24, 10, 0, 0, 0, time.UTC)
+	srv.now = func() time.Time { return now }
+
+	user := createPasswordUser(t, srv, "bob@example.com", "hunter2")
+
+	settings, err := data.GetOrgSettings(srv.DB())
+	assert.NilError(t, err)
+	settings.RequireMFA = true
+	assert.NilError(t, data.UpdateOrgSettings(srv.DB(), settings))
+
+	request := func(t *testing.T, method, path, accessKey string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(method, path, jsonBody(t, body))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		if accessKey != "" {
+			req.Header.Set("Authorization", "Bearer "+accessKey)
+		}
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	passwordLogin := func(t *testing.T) api.LoginResponse {
+		t.Helper()
+		resp := request(t, http.MethodPost, "/api/login", "", api.LoginRequest{
+			PasswordCredentials: &api.LoginRequestPasswordCredentials{Name: user.Name, Password: "hunter2"},
+		})
+		assert.Equal(t, resp.Code, http.StatusCreated, (*responseDebug)(resp))
+
+		var loginResp api.LoginResponse
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &loginResp))
+		return loginResp
+	}
+
+	loginResp := passwordLogin(t)
+	assert.Assert(t, loginResp.MFAEnrollmentRequired)
+	accessKey := loginResp.AccessKey
+
+	// the key can only be used to enroll
+	resp := request(t, http.MethodGet, "/api/users/self", accessKey, nil)
+	assert.Equal(t, resp.Code, http.StatusForbidden, (*responseDebug)(resp))
+
+	resp = request(t, http.MethodPost, "/api/login", "", api.LoginRequest{AccessKey: accessKey})
+	assert.Equal(t, resp.Code, http.StatusUnauthorized, (*responseDebug)(resp))
+
+	resp = request(t, http.MethodPost, "/api/users/self/mfa/totp", accessKey, api.EmptyRequest{})
+	assert.Equal(t, resp.Code, http.StatusCreated, (*responseDebug)(resp))
+
+	var enrollResp api.EnrollTOTPResponse
+	assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &enrollResp))
+
+	code, err := authn.TOTPCode(enrollResp.Secret, now)
+	assert.NilError(t, err)
+	resp = request(t, http.MethodPost, "/api/users/self/mfa/totp/confirm", accessKey, api.ConfirmTOTPRequest{Code: code})
+	assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+
+	// after enrolling, login requires a code
+	loginResp = passwordLogin(t)
+	assert.Assert(t, loginResp.MFARequired)
+	assert.Assert(t, !loginResp.MFAEnrollmentRequired)
+
+	t.Run("settings", func(t *testing.T) {
+		resp := request(t, http.MethodGet, "/api/settings", adminAccessKey(srv), nil)
+		assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+
+		var settingsResp api.Settings
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &settingsResp))
+		assert.Assert(t, settingsResp.RequireMFA)
+	})
+}
+
+func createPasswordUser(t *testing.T, srv *Server, name, password string) *models.Identity {
+	t.Helper()
+	user := &models.Identity{Name: name}
+	assert.NilError(t, data.CreateIdentity(srv.DB(), user))
+
+	_, err := data.CreateProviderUser(srv.DB(), data.InfraProvider(srv.DB()), user)
+	assert.NilError(t, err)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	assert.NilError(t, err)
+	assert.NilError(t, data.CreateCredential(srv.DB(), &models.Credential{IdentityID: user.ID, PasswordHash: hash}))
+	return user
+}
@@ -8,15 +8,16 @@ import (
 	"net/url"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/infrahq/infra/internal"
 	"github.com/infrahq/infra/internal/access"
 	"github.com/infrahq/infra/internal/logging"
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
-	"github.com/infrahq/infra/internal/server/redis"
 )
 
 func handleInfraDestinationHeader(rCtx access.RequestContext, headers http.Header) error {
@@ -40,7 +41,7 @@ func handleInfraDestinationHeader(rCtx access.RequestContext, headers http.Heade
 	// only save if there's significant difference between LastSeenAt and Now
 	if time.Since(destination.LastSeenAt) > lastSeenUpdateThreshold {
 		destination.LastSeenAt = time.Now()
-		if err := access.UpdateDestination(rCtx, destination); err != nil {
+		if err := access.UpdateDestinationLastSeenAt(rCtx, destination); err != nil {
 			return fmt.Errorf("failed to update destination lastSeenAt: %w", err)
 		}
 	}
@@ -74,6 +75,7 @@ func authenticateRequest(c *gin.Context, route routeSettings, srv *Server) (acce
 
 	authned, err := requireAccessKey(c, tx, srv)
 	if !route.authenticationOptional && err != nil {
+		countAuthFailure(err)
 		return authned, err
 	}
 
@@ -98,8 +100,7 @@ func authenticateRequest(c *gin.Context, route routeSettings, srv *Server) (acce
 	}
 
 	if org != nil {
-		// TODO: limit should be a per-organization setting
-		if err := redis.NewLimiter(srv.redis).RateOK(org.ID.String(), 5000); err != nil {
+		if err := applyRateLimit(c, tx, srv, authned, org); err != nil {
 			return authned, err
 		}
 	}
@@ -150,27 +151,96 @@ func validateOrgMatchesRequest(req *http.Request, tx data.ReadTxn, accessKeyOrg
 	}
 }
 
+// authFailuresCounter counts failed authentication, labeled by the reason it
+// failed. The reason is one of the authFailure constants, never a value from
+// the request, so that the number of series is bounded.
+var authFailuresCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "infra",
+	Subsystem: "authn",
+	Name:      "failures_total",
+	Help:      "The number of requests and logins that failed authentication, labeled by reason",
+}, []string{"reason"})
+
+const (
+	authFailureMissingToken = "missing_token"
+	authFailureExpired      = "expired"
+	authFailureInvalidToken = "invalid_token"
+	authFailureCSRF         = "csrf"
+	authFailureScope        = "scope"
+	authFailureLogin        = "login"
+	authFailureOther        = "other"
+)
+
+// authFailure is an error from requireAccessKey that records why the
+// authentication failed, so that the failure can be counted by reason.
+type authFailure struct {
+	reason string
+	err    error
+}
+
+func (a authFailure) Error() string {
+	return a.err.Error()
+}
+
+func (a authFailure) Unwrap() error {
+	return a.err
+}
+
+func countAuthFailure(err error) {
+	reason := authFailureOther
+	var failure authFailure
+	if errors.As(err, &failure) {
+		reason = failure.reason
+	}
+	authFailuresCounter.WithLabelValues(reason).Inc()
+}
+
 // requireAccessKey checks the bearer token is present and valid
 func requireAccessKey(c *gin.Context, db *data.Transaction, srv *Server) (access.Authenticated, error) {
 	var u access.Authenticated
 
-	bearer, err := reqBearerToken(c, srv.options)
+	bearer, fromCookie, err := reqBearerToken(c, srv.options)
 	if err != nil {
-		return u, err
+		return u, authFailure{reason: authFailureMissingToken, err: err}
 	}
 
-	accessKey, err := data.ValidateRequestAccessKey(db, bearer)
+	validateKey := data.ValidateRequestAccessKey
+	if srv.options.DisableImplicitSessionExtension {
+		validateKey = data.ValidateRequestAccessKeyWithoutExtension
+	}
+	accessKey, err := validateKey(db, bearer, srv.accessKeyOptions())
 	if err != nil {
 		if errors.Is(err, data.ErrAccessKeyExpired) {
-			return u, AuthenticationError{Message: "access key has expired"}
+			return u, authFailure{reason: authFailureExpired, err: AuthenticationError{Message: "access key has expired"}}
+		}
+		err = fmt.Errorf("%w: invalid token: %s", internal.ErrUnauthorized, err)
+		return u, authFailure{reason: authFailureInvalidToken, err: err}
+	}
+
+	if fromCookie {
+		if err := validateCSRF(c.Request, accessKey); err != nil {
+			return u, authFailure{reason: authFailureCSRF, err: err}
 		}
-		return u, fmt.Errorf("%w: invalid token: %s", internal.ErrUnauthorized, err)
 	}
 
 	if accessKey.Scopes.Includes(models.ScopePasswordReset) {
 		// PUT /api/users/:id only
 		if c.Request.URL.Path != "/api/users/"+accessKey.IssuedFor.String() || c.Request.Method != http.MethodPut {
-			return u, fmt.Errorf("%w: temporary passwords can only be used to set new passwords", access.ErrNotAuthorized)
+			err := fmt.Errorf("%w: temporary passwords can only be used to set new passwords", access.ErrNotAuthorized)
+			return u, authFailure{reason: authFailureScope, err: err}
+		}
+	}
+
+	if accessKey.Scopes.Includes(models.ScopeMFAChallenge) {
+		err := fmt.Errorf("%w: mfa challenges can only be used to log in", internal.ErrUnauthorized)
+		return u, authFailure{reason: authFailureScope, err: err}
+	}
+
+	if accessKey.Scopes.Includes(models.ScopeMFAEnrollment) {
+		// POST /api/users/self/mfa/totp and /api/users/self/mfa/totp/confirm only
+		if !strings.HasPrefix(c.Request.URL.Path, "/api/users/self/mfa/totp") || c.Request.Method != http.MethodPost {
+			err := fmt.Errorf("%w: the organization requires mfa, enroll before using infra", access.ErrNotAuthorized)
+			return u, authFailure{reason: authFailureScope, err: err}
 		}
 	}
 
@@ -184,6 +254,10 @@ func requireAccessKey(c *gin.Context, db *data.Transaction, srv *Server) (access
 	// remove the need for this WithOrgID.
 	db = db.WithOrgID(org.ID)
 
+	if err := updateAccessKeyLastUsed(db, c, accessKey); err != nil {
+		return u, fmt.Errorf("access key update fail: %w", err)
+	}
+
 	// either this access key was issued for a user or for an identity provider to do SCIM
 	if accessKey.IssuedFor == accessKey.ProviderID {
 		// this access key was issued for SCIM for an identity provider, validate the provider still exists
@@ -200,12 +274,22 @@ func requireAccessKey(c *gin.Context, db *data.Transaction, srv *Server) (access
 
 		if time.Since(identity.LastSeenAt) > lastSeenUpdateThreshold {
 			identity.LastSeenAt = time.Now().UTC()
-			if err = data.UpdateIdentity(db, identity); err != nil {
+			if err = data.UpdateIdentityLastSeenAt(db, identity); err != nil {
 				return u, fmt.Errorf("identity update fail: %w", err)
 			}
 		}
 
 		u.User = identity
+
+		if accessKey.ImpersonatedBy != 0 {
+			// the key was created by a support admin to act as the user. The
+			// support admin is kept so that audit events record both.
+			impersonator, err := data.GetIdentity(db, data.GetIdentityOptions{ByID: accessKey.ImpersonatedBy})
+			if err != nil {
+				return u, fmt.Errorf("impersonator for access key: %w", err)
+			}
+			u.Impersonator = impersonator
+		}
 	}
 
 	u.AccessKey = accessKey
@@ -213,6 +297,42 @@ func requireAccessKey(c *gin.Context, db *data.Transaction, srv *Server) (access
 	return u, nil
 }
 
+// maxLastUsedUserAgentLength limits the length of the User-Agent stored with an
+// access key, because the header is provided by the client.
+const maxLastUsedUserAgentLength = 256
+
+// updateAccessKeyLastUsed records the time, client IP, and user agent of the
+// request on the access key. Like LastSeenAt the time is only updated after
+// lastSeenUpdateThreshold, unless the request is from a different client.
+func updateAccessKeyLastUsed(db data.WriteTxn, c *gin.Context, key *models.AccessKey) error {
+	ip := logging.ClientIP(c.Request.Context())
+	userAgent := lastUsedUserAgent(c.Request.UserAgent())
+
+	sameClient := key.LastUsedIP == ip && key.LastUsedUserAgent == userAgent
+	if sameClient && time.Since(key.LastUsedAt) <= lastSeenUpdateThreshold {
+		return nil
+	}
+
+	key.LastUsedAt = time.Now().UTC()
+	key.LastUsedIP = ip
+	key.LastUsedUserAgent = userAgent
+	return data.UpdateAccessKeyLastUsed(db, key)
+}
+
+// lastUsedUserAgent returns userAgent as valid UTF-8, truncated to at most
+// maxLastUsedUserAgentLength bytes without splitting a character.
+func lastUsedUserAgent(userAgent string) string {
+	userAgent = strings.ToValidUTF8(userAgent, string(utf8.RuneError))
+	if len(userAgent) <= maxLastUsedUserAgentLength {
+		return userAgent
+	}
+	end := maxLastUsedUserAgentLength
+	for end > 0 && !utf8.RuneStart(userAgent[end]) {
+		end--
+	}
+	return userAgent[:end]
+}
+
 func getCookie(req *http.Request, name string) (string, error) {
 	cookie, err := req.Cookie(name)
 	if err != nil {
@@ -235,8 +355,9 @@ func getRequestContext(c *gin.Context) access.RequestContext {
 
 func getOrgFromRequest(req *http.Request, tx data.ReadTxn) (*models.Organization, error) {
 	host := req.Host
+	logger := logging.FromContext(req.Context())
 
-	logging.Debugf("Host: %s", host)
+	logger.Debug().Str("host", host).Msg("get organization from request host")
 	if host == "" {
 		return nil, nil
 	}
@@ -245,7 +366,7 @@ hostLookup:
 	org, err := data.GetOrganization(tx, data.GetOrganizationOptions{ByDomain: host})
 	if err != nil {
 		if errors.Is(err, internal.ErrNotFound) {
-			logging.Debugf("Host not found: %s", host)
+			logger.Debug().Str("host", host).Msg("organization not found for host")
 			// first, remove port and try again
 			h, p, err := net.SplitHostPort(host)
 			if len(p) > 0 && err == nil {
@@ -259,11 +380,12 @@ hostLookup:
 	return org, nil
 }
 
-func reqBearerToken(c *gin.Context, opts Options) (string, error) {
+// reqBearerToken returns the access key from the Authorization header, or from
+// the auth cookie when the header is not set. fromCookie is true when the key
+// was read from a cookie.
+func reqBearerToken(c *gin.Context, opts Options) (bearer string, fromCookie bool, err error) {
 	header := c.Request.Header.Get("Authorization")
 
-	bearer := ""
-
 	parts := strings.Split(header, " ")
 	if len(parts) == 2 && parts[0] == "Bearer" {
 		bearer = parts[1]
@@ -276,24 +398,24 @@ func reqBearerToken(c *gin.Context, opts Options) (string, error) {
 		*/
 		cookie := exchangeSignupCookieForSession(c.Request, c.Writer, opts)
 		if cookie == "" {
-			logging.L.Trace().Msg("sign-up cookie not found, falling back to auth cookie")
+			logging.FromContext(c.Request.Context()).Trace().Msg("sign-up cookie not found, falling back to auth cookie")
 
-			var err error
 			cookie, err = getCookie(c.Request, cookieAuthorizationName)
 			if err != nil {
-				return "", AuthenticationError{Message: "authentication is required"}
+				return "", false, AuthenticationError{Message: "authentication is required"}
 			}
 		}
 
 		bearer = cookie
+		fromCookie = true
 	}
 
 	// this will get caught by key validation, but check to be safe
 	if strings.TrimSpace(bearer) == "" {
-		return "", AuthenticationError{Message: "bearer token was missing"}
+		return "", false, AuthenticationError{Message: "bearer token was missing"}
 	}
 
-	return bearer, nil
+	return bearer, fromCookie, nil
 }
 
 // logError calls fn and writes a log line at the warning level if the error is
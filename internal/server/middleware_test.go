@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,8 +11,10 @@ import (
 	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"gotest.tools/v3/assert"
 	"gotest.tools/v3/assert/opt"
 
@@ -30,7 +33,10 @@ func setupDB(t *testing.T) *data.DB {
 	t.Helper()
 	tpatch.ModelsSymmetricKey(t)
 
-	db, err := data.NewDB(data.NewDBOptions{DSN: database.PostgresDriver(t, "_server").DSN})
+	db, err := data.NewDB(data.NewDBOptions{
+		DSN:             database.PostgresDriver(t, "_server").DSN,
+		EnforceOrgScope: true,
+	})
 	assert.NilError(t, err)
 	t.Cleanup(func() {
 		assert.NilError(t, db.Close())
@@ -332,6 +338,68 @@ func TestRequireAccessKey(t *testing.T) {
 	}
 }
 
+func TestCountAuthFailure(t *testing.T) {
+	expired := authFailure{reason: authFailureExpired, err: AuthenticationError{Message: "access key has expired"}}
+
+	var authnErr AuthenticationError
+	assert.Assert(t, errors.As(expired, &authnErr), "authFailure must not hide the cause")
+	assert.Error(t, expired, "access key has expired")
+
+	before := testutil.ToFloat64(authFailuresCounter.WithLabelValues(authFailureExpired))
+	countAuthFailure(fmt.Errorf("wrapped: %w", expired))
+	after := testutil.ToFloat64(authFailuresCounter.WithLabelValues(authFailureExpired))
+	assert.Equal(t, after-before, float64(1))
+
+	before = testutil.ToFloat64(authFailuresCounter.WithLabelValues(authFailureOther))
+	countAuthFailure(fmt.Errorf("identity for access key: %w", internal.ErrNotFound))
+	after = testutil.ToFloat64(authFailuresCounter.WithLabelValues(authFailureOther))
+	assert.Equal(t, after-before, float64(1))
+}
+
+func TestLastUsedUserAgent(t *testing.T) {
+	type testCase struct {
+		name      string
+		userAgent string
+		expected  string
+	}
+
+	run := func(t *testing.T, tc testCase) {
+		actual := lastUsedUserAgent(tc.userAgent)
+		assert.Equal(t, actual, tc.expected)
+		assert.Assert(t, utf8.ValidString(actual))
+		assert.Assert(t, len(actual) <= maxLastUsedUserAgentLength)
+	}
+
+	long := strings.Repeat("a", maxLastUsedUserAgentLength-1)
+	testCases := []testCase{
+		{
+			name:      "short",
+			userAgent: "the-agent/1.0",
+			expected:  "the-agent/1.0",
+		},
+		{
+			name:      "truncated",
+			userAgent: long + "bc",
+			expected:  long + "b",
+		},
+		{
+			name:      "truncated before a multi-byte character",
+			userAgent: long + "é",
+			expected:  long,
+		},
+		{
+			name:      "invalid utf8",
+			userAgent: "the-agent/\xff1.0",
+			expected:  "the-agent/\ufffd1.0",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
+
 func TestHandleInfraDestinationHeader(t *testing.T) {
 	srv := setupServer(t, withAdminUser)
 	routes := srv.GenerateRoutes()
@@ -597,7 +665,7 @@ func TestAuthenticateRequest(t *testing.T) {
 		{
 			name: "LastSeenAt and InactivityTimeout updates are throttled",
 			setup: func(t *testing.T, req *http.Request) {
-				now = time.Now().Truncate(time.Microsecond) // truncate to DB precision
+				now = time.Now().Truncate(api.TimePrecision) // truncate to DB precision
 
 				tx := txnForTestCase(t, srv.db, org.ID)
 				user := *user // shallow copy user
@@ -167,6 +167,52 @@ func (a *API) addResponseRewrites() {
 			WasCreated: newResponse.WasCreated,
 		}
 	})
+
+	type destinationV0_19_1 struct {
+		ID          uid.ID                    `json:"id"`
+		UniqueID    string                    `json:"uniqueID"`
+		Name        string                    `json:"name"`
+		Kind        string                    `json:"kind"`
+		Created     api.Time                  `json:"created"`
+		Updated     api.Time                  `json:"updated"`
+		Connection  api.DestinationConnection `json:"connection"`
+		Resources   []string                  `json:"resources"`
+		Roles       []string                  `json:"roles"`
+		LastSeen    api.Time                  `json:"lastSeen"`
+		Connected   bool                      `json:"connected"`
+		Version     string                    `json:"version"`
+		UpdateIndex int64                     `json:"updateIndex"`
+	}
+	toDestinationV0_19_1 := func(newResponse api.Destination) destinationV0_19_1 {
+		return destinationV0_19_1{
+			ID:          newResponse.ID,
+			UniqueID:    newResponse.UniqueID,
+			Name:        newResponse.Name,
+			Kind:        newResponse.Kind,
+			Created:     newResponse.Created,
+			Updated:     newResponse.Updated,
+			Connection:  newResponse.Connection,
+			Resources:   newResponse.Resources,
+			Roles:       newResponse.Roles,
+			LastSeen:    newResponse.LastSeenAt,
+			Connected:   newResponse.Connected,
+			Version:     newResponse.Version,
+			UpdateIndex: newResponse.UpdateIndex,
+		}
+	}
+	addResponseRewrite(a, http.MethodGet, "/api/destinations", "0.19.1", func(newResponse *api.ListResponse[api.Destination]) *api.ListResponse[destinationV0_19_1] {
+		return api.NewListResponse(newResponse.Items, newResponse.PaginationResponse, toDestinationV0_19_1)
+	})
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		addResponseRewrite(a, method, "/api/destinations/:id", "0.19.1", func(newResponse *api.Destination) *destinationV0_19_1 {
+			old := toDestinationV0_19_1(*newResponse)
+			return &old
+		})
+	}
+	addResponseRewrite(a, http.MethodPost, "/api/destinations", "0.19.1", func(newResponse *api.Destination) *destinationV0_19_1 {
+		old := toDestinationV0_19_1(*newResponse)
+		return &old
+	})
 	// all response migrations go here
 }
 
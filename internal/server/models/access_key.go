@@ -15,6 +15,13 @@ var (
 const (
 	ScopePasswordReset        string = "password-reset"
 	ScopeAllowCreateAccessKey string = "create-key"
+	// ScopeMFAChallenge keys are issued after a password login when the user
+	// must also enter a TOTP code. They can only be exchanged for a new key
+	// by logging in with the code.
+	ScopeMFAChallenge string = "mfa-challenge"
+	// ScopeMFAEnrollment keys can only be used to enroll in TOTP, and are
+	// issued when the organization requires MFA and the user has not enrolled.
+	ScopeMFAEnrollment string = "mfa-enrollment"
 )
 
 // AccessKey is a session token presented to the Infra server as proof of authentication
@@ -39,6 +46,17 @@ type AccessKey struct {
 	SecretChecksum []byte
 
 	Scopes CommaSeparatedStrings // if set, scopes limit what the key can be used for
+
+	// ImpersonatedBy is the ID of the support admin that created the key to
+	// act as the user it was issued for. Zero for all other keys.
+	ImpersonatedBy uid.ID
+
+	// LastUsedAt, LastUsedIP, and LastUsedUserAgent describe the last request
+	// that was authenticated with the key. Like Identity.LastSeenAt, they are
+	// not updated by every request when the key is used frequently.
+	LastUsedAt        time.Time
+	LastUsedIP        string
+	LastUsedUserAgent string
 }
 
 func (ak *AccessKey) ToAPI() *api.AccessKey {
@@ -53,6 +71,23 @@ func (ak *AccessKey) ToAPI() *api.AccessKey {
 		Expires:           api.Time(ak.ExpiresAt),
 		InactivityTimeout: api.Time(ak.InactivityTimeout),
 		Scopes:            ak.Scopes,
+		ImpersonatedBy:    ak.ImpersonatedBy,
+	}
+}
+
+// ToUserSession returns the key as a session of the user it was issued for.
+func (ak *AccessKey) ToUserSession() *api.UserSession {
+	return &api.UserSession{
+		ID:                ak.ID,
+		Name:              ak.Name,
+		Created:           api.Time(ak.CreatedAt),
+		Expires:           api.Time(ak.ExpiresAt),
+		InactivityTimeout: api.Time(ak.InactivityTimeout),
+		LastUsed:          api.Time(ak.LastUsedAt),
+		LastUsedIP:        ak.LastUsedIP,
+		LastUsedUserAgent: ak.LastUsedUserAgent,
+		Scopes:            ak.Scopes,
+		ImpersonatedBy:    ak.ImpersonatedBy,
 	}
 }
 
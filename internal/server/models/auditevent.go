@@ -0,0 +1,88 @@
+package models
+
+import (
+	"time"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/uid"
+)
+
+const (
+	AuditResultSuccess = "success"
+	AuditResultFailure = "failure"
+)
+
+// AuditEvent is a record of a security relevant action, like a login or a
+// change to a grant. Audit events are written to the audit log, which is
+// separate from the diagnostic logs.
+type AuditEvent struct {
+	ID uid.ID
+	OrganizationMember
+	CreatedAt time.Time
+
+	// ActorID is the ID of the user that performed the action. It is zero
+	// when the user is not known, for example a failed login.
+	ActorID uid.ID
+	// ActorName is the name of the user that performed the action, or the
+	// name they attempted to login with.
+	ActorName string
+	// ImpersonatorID and ImpersonatorName identify the support admin that
+	// performed the action as the actor. They are empty unless the request
+	// used an access key created by impersonating the actor.
+	ImpersonatorID   uid.ID
+	ImpersonatorName string
+
+	// Action is the name of the action, for example grant.create.
+	Action string
+	// TargetType is the kind of the resource the action was performed on.
+	TargetType string
+	// TargetID identifies the resource the action was performed on.
+	TargetID string
+	// TargetName is the name of the resource when the action was performed.
+	// It is a snapshot, so it does not change when the resource is renamed
+	// or deleted.
+	TargetName string
+	// Metadata contains other details of the action, like the privilege of
+	// a grant.
+	Metadata JSONMap
+
+	// Result is either AuditResultSuccess or AuditResultFailure.
+	Result string
+	// Reason describes why the action failed. It may include details that
+	// are hidden from the response, like whether a user exists.
+	Reason    string
+	RequestID string
+	// SourceIP is the address of the client that made the request, resolved
+	// through any trusted proxies.
+	SourceIP string
+}
+
+func (e *AuditEvent) OnInsert() error {
+	if e.ID == 0 {
+		e.ID = uid.New()
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	return nil
+}
+
+func (e *AuditEvent) ToAPI() *api.AuditEvent {
+	return &api.AuditEvent{
+		ID:               e.ID,
+		Created:          api.Time(e.CreatedAt),
+		ActorID:          e.ActorID,
+		ActorName:        e.ActorName,
+		ImpersonatorID:   e.ImpersonatorID,
+		ImpersonatorName: e.ImpersonatorName,
+		Action:           e.Action,
+		TargetType:       e.TargetType,
+		TargetID:         e.TargetID,
+		TargetName:       e.TargetName,
+		Metadata:         e.Metadata,
+		Result:           e.Result,
+		Reason:           e.Reason,
+		RequestID:        e.RequestID,
+		SourceIP:         e.SourceIP,
+	}
+}
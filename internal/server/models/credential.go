@@ -1,6 +1,10 @@
 package models
 
-import "github.com/infrahq/infra/uid"
+import (
+	"time"
+
+	"github.com/infrahq/infra/uid"
+)
 
 type Credential struct {
 	Model
@@ -9,4 +13,17 @@ type Credential struct {
 	IdentityID      uid.ID
 	PasswordHash    []byte
 	OneTimePassword bool
+	// OneTimePasswordExpiresAt is the time after which the one-time password
+	// can no longer be used to log in. It is set to the time of the first
+	// successful login, or the last failed login allowed, so that the password
+	// can only be used once. Nil when the password does not expire.
+	OneTimePasswordExpiresAt *time.Time
+
+	// FailedLoginAttempts is the number of consecutive failed logins with
+	// this credential. It is reset by a successful login.
+	FailedLoginAttempts int
+	LastFailedLoginAt   *time.Time
+	// LockedUntil is set when the account is locked because of too many
+	// failed logins. The credential can not be used until this time.
+	LockedUntil *time.Time
 }
@@ -28,6 +28,10 @@ type Destination struct {
 	Resources CommaSeparatedStrings
 	Roles     CommaSeparatedStrings
 	Kind      DestinationKind
+
+	// UpdateIndex is set by the database each time the destination is
+	// updated. It is used to detect concurrent modifications.
+	UpdateIndex int64 `db:"-"`
 }
 
 func (d *Destination) ToAPI() *api.Destination {
@@ -47,10 +51,12 @@ func (d *Destination) ToAPI() *api.Destination {
 			URL: d.ConnectionURL,
 			CA:  api.PEM(d.ConnectionCA),
 		},
-		Resources: d.Resources,
-		Roles:     d.Roles,
-		LastSeen:  api.Time(d.LastSeenAt),
-		Connected: connected,
-		Version:   d.Version,
+		Resources:  d.Resources,
+		Roles:      d.Roles,
+		LastSeenAt: api.Time(d.LastSeenAt),
+		Connected:  connected,
+		Version:    d.Version,
+
+		UpdateIndex: d.UpdateIndex,
 	}
 }
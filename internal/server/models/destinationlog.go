@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/uid"
+)
+
+// DestinationLog is a log entry written by a connector, and forwarded to the
+// server so that support admins can troubleshoot connectors that run in
+// environments they can not access.
+type DestinationLog struct {
+	ID uid.ID
+	OrganizationMember
+	DestinationID uid.ID
+	// CreatedAt is the time the entry was logged by the connector.
+	CreatedAt time.Time
+	Level     string
+	Line      string
+}
+
+func (l *DestinationLog) OnInsert() error {
+	if l.ID == 0 {
+		l.ID = uid.New()
+	}
+	if l.CreatedAt.IsZero() {
+		l.CreatedAt = time.Now()
+	}
+	return nil
+}
+
+func (l *DestinationLog) ToAPI() *api.DestinationLog {
+	return &api.DestinationLog{
+		Time:  api.Time(l.CreatedAt),
+		Level: l.Level,
+		Line:  l.Line,
+	}
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/uid"
+)
+
+// DestinationMetricsStaleAfter is how long the metrics of a destination are
+// current. Connectors report every minute, so a destination without a report
+// in this period has missed several reports.
+const DestinationMetricsStaleAfter = 5 * time.Minute
+
+// DestinationMetricsReport is a snapshot of the metrics of a connector,
+// reported with the periodic registration of its destination. The counts are
+// the totals since the previous report.
+type DestinationMetricsReport struct {
+	ReportedAt    time.Time `json:"reportedAt"`
+	PeriodSeconds float64   `json:"periodSeconds"`
+	ProxyRequests int64     `json:"proxyRequests"`
+	ProxyErrors   int64     `json:"proxyErrors"`
+	// SyncLagSeconds is nil when the connector never synced its grants.
+	SyncLagSeconds *float64 `json:"syncLagSeconds,omitempty"`
+}
+
+// ProxyRequestRate is the number of proxied requests per second.
+func (r DestinationMetricsReport) ProxyRequestRate() float64 {
+	if r.PeriodSeconds <= 0 {
+		return 0
+	}
+	return float64(r.ProxyRequests) / r.PeriodSeconds
+}
+
+// ProxyErrorRate is the fraction of the proxied requests that failed.
+func (r DestinationMetricsReport) ProxyErrorRate() float64 {
+	if r.ProxyRequests == 0 {
+		return 0
+	}
+	return float64(r.ProxyErrors) / float64(r.ProxyRequests)
+}
+
+func (r DestinationMetricsReport) ToAPI() api.DestinationMetricsReport {
+	return api.DestinationMetricsReport{
+		ReportedAt:       api.Time(r.ReportedAt),
+		PeriodSeconds:    r.PeriodSeconds,
+		ProxyRequests:    r.ProxyRequests,
+		ProxyErrors:      r.ProxyErrors,
+		ProxyRequestRate: r.ProxyRequestRate(),
+		ProxyErrorRate:   r.ProxyErrorRate(),
+		SyncLagSeconds:   r.SyncLagSeconds,
+	}
+}
+
+// DestinationMetricsHistory is the most recent metrics reports of a
+// destination, from the oldest to the most recent. It is stored as a JSON
+// array.
+type DestinationMetricsHistory []DestinationMetricsReport
+
+func (h DestinationMetricsHistory) Value() (driver.Value, error) {
+	if h == nil {
+		return "[]", nil
+	}
+	raw, err := json.Marshal([]DestinationMetricsReport(h))
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
+
+func (h *DestinationMetricsHistory) Scan(v interface{}) error {
+	var raw []byte
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("expected string type for metrics history, got %T", v)
+	}
+	var result []DestinationMetricsReport
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return err
+	}
+	*h = result
+	return nil
+}
+
+// Latest returns the most recent report, or nil if there are no reports.
+func (h DestinationMetricsHistory) Latest() *DestinationMetricsReport {
+	if len(h) == 0 {
+		return nil
+	}
+	return &h[len(h)-1]
+}
+
+// Stale returns true when the connector has not reported metrics within
+// DestinationMetricsStaleAfter of now, including when it never reported.
+func (h DestinationMetricsHistory) Stale(now time.Time) bool {
+	latest := h.Latest()
+	return latest == nil || now.Sub(latest.ReportedAt) > DestinationMetricsStaleAfter
+}
+
+func (h DestinationMetricsHistory) ToAPI(destinationID uid.ID, now time.Time) *api.DestinationMetrics {
+	result := &api.DestinationMetrics{
+		DestinationID: destinationID,
+		Stale:         h.Stale(now),
+		History:       make([]api.DestinationMetricsReport, 0, len(h)),
+	}
+	for _, r := range h {
+		result.History = append(result.History, r.ToAPI())
+	}
+	if latest := h.Latest(); latest != nil {
+		report := latest.ToAPI()
+		result.Latest = &report
+	}
+	return result
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/uid"
+)
+
+// DestinationUsage is the activity of a destination on a single day. The
+// logins are aggregated from audit events, so that the usage is kept after
+// the events are purged. The proxy requests are reported by the connector.
+type DestinationUsage struct {
+	ID uid.ID
+	OrganizationMember
+	DestinationID uid.ID
+	// Day is the start of the day, in UTC.
+	Day time.Time
+
+	// Logins is the number of times a user was issued a token for the
+	// destination.
+	Logins int64
+	// DistinctUsers is the number of different users that logged in.
+	DistinctUsers int64
+	// ProxyRequests is the number of requests the connector proxied to the
+	// destination.
+	ProxyRequests int64
+}
+
+func (u *DestinationUsage) OnInsert() error {
+	if u.ID == 0 {
+		u.ID = uid.New()
+	}
+	return nil
+}
+
+func (u *DestinationUsage) ToAPI() *api.DestinationUsageDay {
+	return &api.DestinationUsageDay{
+		Day:           api.Time(u.Day),
+		Logins:        u.Logins,
+		DistinctUsers: u.DistinctUsers,
+		ProxyRequests: u.ProxyRequests,
+	}
+}
+
+// UsageDay returns the start of the UTC day that contains t.
+func UsageDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
@@ -19,6 +19,14 @@ type DeviceFlowAuthRequest struct {
 
 	// ProviderID when set means the device flow request has been approved by a user with this provider
 	ProviderID uid.ID
+
+	// Denied is true when a user rejected the request. A denied request can
+	// not be approved.
+	Denied bool
+
+	// LastPolledAt is the last time the device checked the status of the
+	// request, used to detect devices that poll too frequently.
+	LastPolledAt *time.Time
 }
 
 func (dr *DeviceFlowAuthRequest) Approved() bool {
@@ -2,6 +2,8 @@ package models
 
 import (
 	"database/sql/driver"
+	"encoding/base64"
+	"encoding/binary"
 	"fmt"
 
 	"github.com/infrahq/secrets"
@@ -14,9 +16,20 @@ type EncryptedAtRest string
 // SymmetricKey is the key used to encrypt and decrypt this field.
 var SymmetricKey *secrets.SymmetricKey
 
+// DecryptionKeys are additional keys used to decrypt fields that were encrypted
+// with a previous SymmetricKey. They are set while the database key is being
+// rotated. Fields are always encrypted with SymmetricKey.
+var DecryptionKeys []*secrets.SymmetricKey
+
 // SkipSymmetricKey is used for tests that specifically want to avoid field encryption
 var SkipSymmetricKey bool
 
+// AllowPlaintext permits reading a value that was stored before the field was
+// encrypted. It is only set by data.RotateDBKey, which encrypts those values.
+// Otherwise a value that is not sealed is an error, so that a value written to
+// the database without the key is never trusted as a secret.
+var AllowPlaintext bool
+
 func (s EncryptedAtRest) Encrypt() (string, error) {
 	if SkipSymmetricKey || s == "" {
 		return string(s), nil
@@ -47,12 +60,44 @@ func decrypt(s string) (string, error) {
 		return "", fmt.Errorf("models.SymmetricKey is not set")
 	}
 
+	if !IsSealed(s) {
+		if !AllowPlaintext {
+			return "", fmt.Errorf("secret field is not encrypted, rotate the database encryption key to encrypt it")
+		}
+		// a value written before the field was encrypted, which is being
+		// encrypted by the key rotation.
+		return s, nil
+	}
+
 	b, err := secrets.Unseal(SymmetricKey, []byte(s))
-	if err != nil {
-		return "", fmt.Errorf("unsealing secret field: %w", err)
+	if err == nil {
+		return string(b), nil
 	}
+	for _, key := range DecryptionKeys {
+		if b, keyErr := secrets.Unseal(key, []byte(s)); keyErr == nil {
+			return string(b), nil
+		}
+	}
+	return "", fmt.Errorf("unsealing secret field: %w", err)
+}
 
-	return string(b), err
+// IsSealed returns true if s has the format of a value encrypted by
+// secrets.Seal. A sealed value that was modified is still reported as sealed,
+// so that decrypting it fails instead of returning the value as plaintext.
+func IsSealed(s string) bool {
+	payload, err := base64.RawStdEncoding.DecodeString(s)
+	if err != nil || len(payload) < 4 {
+		return false
+	}
+	// the payload starts with the length of the ciphertext, followed by the
+	// ciphertext, and the length and name of the algorithm.
+	ln := int(binary.BigEndian.Uint32(payload))
+	if ln > len(payload)-5 {
+		return false
+	}
+	alg := payload[4+ln:]
+	algLen := int(alg[0])
+	return algLen < len(alg) && string(alg[1:1+algLen]) == secrets.AlgorithmAESGCM
 }
 
 func (s *EncryptedAtRest) Scan(v interface{}) error {
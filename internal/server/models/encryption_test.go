@@ -1,8 +1,11 @@
 package models_test
 
 import (
+	"encoding/base64"
 	"testing"
 
+	"github.com/infrahq/secrets"
+
 	"gotest.tools/v3/assert"
 	is "gotest.tools/v3/assert/cmp"
 
@@ -89,3 +92,66 @@ func TestEncryptedAtRest_WithBytes(t *testing.T) {
 		assert.Equal(t, string(updated.PrivateJWK), string(settings.PrivateJWK))
 	})
 }
+
+func TestEncryptedAtRest_Scan(t *testing.T) {
+	patch.ModelsSymmetricKey(t)
+
+	sealed, err := models.EncryptedAtRest("don't tell").Value()
+	assert.NilError(t, err)
+
+	t.Run("round trip", func(t *testing.T) {
+		var field models.EncryptedAtRest
+		assert.NilError(t, field.Scan(sealed))
+		assert.Equal(t, string(field), "don't tell")
+		assert.Assert(t, models.IsSealed(sealed.(string)))
+	})
+
+	t.Run("plaintext", func(t *testing.T) {
+		for _, value := range []string{"client-secret", "c2VjcmV0", "JBSWY3DPEHPK3PXP"} {
+			assert.Assert(t, !models.IsSealed(value), value)
+
+			var field models.EncryptedAtRest
+			err := field.Scan(value)
+			assert.ErrorContains(t, err, "secret field is not encrypted")
+		}
+	})
+
+	t.Run("plaintext while the key is rotated", func(t *testing.T) {
+		models.AllowPlaintext = true
+		t.Cleanup(func() {
+			models.AllowPlaintext = false
+		})
+
+		var field models.EncryptedAtRest
+		assert.NilError(t, field.Scan("client-secret"))
+		assert.Equal(t, string(field), "client-secret")
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		payload, err := base64.RawStdEncoding.DecodeString(sealed.(string))
+		assert.NilError(t, err)
+		payload[5] ^= 0xff // flip a byte of the ciphertext
+		tampered := base64.RawStdEncoding.EncodeToString(payload)
+		assert.Assert(t, models.IsSealed(tampered))
+
+		var field models.EncryptedAtRest
+		err = field.Scan(tampered)
+		assert.ErrorContains(t, err, "opening seal")
+	})
+
+	t.Run("previous key", func(t *testing.T) {
+		previous := models.SymmetricKey
+		patch.ModelsSymmetricKey(t)
+
+		var field models.EncryptedAtRest
+		err := field.Scan(sealed)
+		assert.ErrorContains(t, err, "wrong key was used")
+
+		models.DecryptionKeys = []*secrets.SymmetricKey{previous}
+		t.Cleanup(func() {
+			models.DecryptionKeys = nil
+		})
+		assert.NilError(t, field.Scan(sealed))
+		assert.Equal(t, string(field), "don't tell")
+	})
+}
@@ -10,6 +10,16 @@ const (
 	InfraAdminRole        = "admin"
 	InfraViewRole         = "view"
 	InfraConnectorRole    = "connector"
+	// InfraUserAdminRole can manage users, their credentials, and their
+	// sessions, but can not change grants.
+	InfraUserAdminRole = "user-admin"
+	// InfraGrantAdminRole can manage grants, except for grants on the infra
+	// resource.
+	InfraGrantAdminRole = "grant-admin"
+	// InfraImpersonatorRole can act as another user with a short-lived access
+	// key. It is not implied by the admin role, and must be granted explicitly
+	// to the support admins who need it.
+	InfraImpersonatorRole = "impersonator"
 )
 
 // BasePermissionConnect is the first-principle permission that all other permissions are defined from.
@@ -44,6 +54,10 @@ type Grant struct {
 
 	// Subject is the user or group ID the grant applies to.
 	Subject uid.PolymorphicID
+	// SubjectID is the ID of the user or group in Subject. It is set by the
+	// data package when the grant is created, so that grants can be joined
+	// with group memberships.
+	SubjectID uid.ID
 	// Privilege is the role or permission being granted.
 	Privilege string
 	// Resource identifies the resource the privilege applies to.
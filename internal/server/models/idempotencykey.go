@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/infrahq/infra/uid"
+)
+
+// IdempotencyKey is the response to a request that included an
+// Idempotency-Key header. A retry of the same request with the same key
+// receives the stored response, instead of making the change again.
+type IdempotencyKey struct {
+	ID uid.ID
+	OrganizationMember
+	Key string
+	// RequestHash is a hash of the method, path, user, and body of the request,
+	// used to reject a different request that uses the same key.
+	RequestHash string
+	StatusCode  int
+	// ResponseBody is encrypted because responses may include secrets, like
+	// an access key or a one time password.
+	ResponseBody EncryptedAtRest
+	CreatedAt    time.Time
+}
+
+func (k *IdempotencyKey) OnInsert() error {
+	if k.ID == 0 {
+		k.ID = uid.New()
+	}
+	if k.CreatedAt.IsZero() {
+		k.CreatedAt = time.Now()
+	}
+	return nil
+}
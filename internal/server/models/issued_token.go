@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/infrahq/infra/uid"
+)
+
+// IssuedToken is a record of a JWT issued to a user for a destination. The ID
+// of the IssuedToken is the jti claim of the JWT, so that the JWT can be
+// revoked before it expires.
+type IssuedToken struct {
+	Model
+	OrganizationMember
+
+	IdentityID uid.ID
+	// DestinationName is the audience of the JWT. When empty the JWT is
+	// accepted by every destination.
+	DestinationName string
+	ExpiresAt       time.Time
+	// RevokedAt is the time the JWT was revoked, or nil if it is still valid.
+	RevokedAt *time.Time
+}
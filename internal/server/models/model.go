@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"time"
 
+	"github.com/infrahq/infra/api"
 	"github.com/infrahq/infra/uid"
 )
 
@@ -12,7 +13,8 @@ const CreatedBySystem = 1
 type Model struct {
 	ID uid.ID
 	// CreatedAt is set to time.Now on insert and should not be changed after
-	// insert.
+	// insert. Like all times stored in the database, it is truncated to
+	// api.TimePrecision.
 	CreatedAt time.Time
 	// UpdatedAt is set to time.Now on insert and update.
 	UpdatedAt time.Time
@@ -29,13 +31,19 @@ func (m *Model) OnInsert() error {
 		m.ID = uid.New()
 	}
 	if m.CreatedAt.IsZero() {
-		m.CreatedAt = time.Now()
+		m.CreatedAt = now()
 	}
 	m.UpdatedAt = m.CreatedAt
 	return nil
 }
 
 func (m *Model) OnUpdate() error {
-	m.UpdatedAt = time.Now()
+	m.UpdatedAt = now()
 	return nil
 }
+
+// now returns the current time with the precision of the times stored in the
+// database.
+func now() time.Time {
+	return time.Now().UTC().Truncate(api.TimePrecision)
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"github.com/infrahq/infra/api"
 	"github.com/infrahq/infra/uid"
 )
@@ -12,11 +14,16 @@ type Organization struct {
 	Domain         string
 	AllowedDomains CommaSeparatedStrings // the email domains that are allowed to login to this org
 
+	// DomainAlias is a previous domain of the organization. Requests to the
+	// alias are routed to the organization until DomainAliasExpiresAt.
+	DomainAlias          string
+	DomainAliasExpiresAt *time.Time
+
 	CreatedBy uid.ID
 }
 
 func (o *Organization) ToAPI() *api.Organization {
-	return &api.Organization{
+	result := &api.Organization{
 		ID:             o.ID,
 		Name:           o.Name,
 		Created:        api.Time(o.CreatedAt),
@@ -24,6 +31,12 @@ func (o *Organization) ToAPI() *api.Organization {
 		Domain:         o.Domain,
 		AllowedDomains: o.AllowedDomains,
 	}
+	if o.DomainAlias != "" && o.DomainAliasExpiresAt != nil && time.Now().Before(*o.DomainAliasExpiresAt) {
+		result.DomainAlias = o.DomainAlias
+		expires := api.Time(*o.DomainAliasExpiresAt)
+		result.DomainAliasExpires = &expires
+	}
+	return result
 }
 
 type OrganizationMember struct {
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"github.com/infrahq/infra/api"
 )
 
@@ -37,3 +39,57 @@ func (s *Settings) SetFromAPI(a *api.Settings) {
 	s.SymbolMin = a.PasswordRequirements.SymbolMin
 	s.NumberMin = a.PasswordRequirements.NumberMin
 }
+
+// OrgSettings are the settings of an organization which are not related to
+// authentication keys or password requirements. A zero value for any field
+// indicates the server default should be used.
+type OrgSettings struct {
+	OrganizationMember
+	UpdatedAt time.Time
+
+	// AccessKeyTTL is the default expiry of new access keys.
+	AccessKeyTTL time.Duration
+	// MaxAccessKeyTTL is the longest expiry allowed for access keys created
+	// with the API. Zero allows any expiry.
+	MaxAccessKeyTTL time.Duration
+	// SessionInactivityTimeout is the default inactivity timeout of new
+	// access keys and login sessions.
+	SessionInactivityTimeout time.Duration
+	// PublicKeyAlgorithms is the list of SSH key types users are allowed to
+	// add. An empty list allows all key types.
+	PublicKeyAlgorithms CommaSeparatedStrings
+
+	// RateLimit is the number of API requests per minute allowed for the
+	// organization. Zero uses the limit from the server options.
+	RateLimit int
+	// ConnectorRateLimit is the number of API requests per minute allowed for
+	// the connectors of the organization. Connectors have a separate limit so
+	// that they are not throttled by other requests. Zero uses the limit from
+	// the server options.
+	ConnectorRateLimit int
+
+	// AllowedSignupDomains is the list of email domains that can create a new
+	// user by logging in with Google. An empty list means users must be
+	// added by an admin before they can log in.
+	AllowedSignupDomains CommaSeparatedStrings
+
+	// RequireMFA requires users who log in with a password to enter a TOTP
+	// code. Users who have not enrolled can only enroll until they do.
+	RequireMFA bool
+
+	// AuditEventRetention is how long audit events are kept before they are
+	// deleted. Zero uses the retention from the server options.
+	AuditEventRetention time.Duration
+}
+
+func (s *OrgSettings) AllowsPublicKeyAlgorithm(algo string) bool {
+	if len(s.PublicKeyAlgorithms) == 0 {
+		return true
+	}
+	for _, allowed := range s.PublicKeyAlgorithms {
+		if allowed == algo {
+			return true
+		}
+	}
+	return false
+}
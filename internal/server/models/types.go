@@ -2,6 +2,7 @@ package models
 
 import (
 	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"strings"
 )
@@ -52,3 +53,37 @@ func (s *CommaSeparatedStrings) Includes(str string) bool {
 
 	return false
 }
+
+// JSONMap is a map of strings stored as a JSON object.
+type JSONMap map[string]string
+
+func (m JSONMap) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	raw, err := json.Marshal(map[string]string(m))
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
+
+func (m *JSONMap) Scan(v interface{}) error {
+	var raw []byte
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("expected string type for JSON map, got %T", v)
+	}
+	result := map[string]string{}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return err
+	}
+	*m = result
+	return nil
+}
@@ -0,0 +1,26 @@
+package models
+
+import "github.com/infrahq/infra/uid"
+
+// UserMFA is the second factor of a user that logs in with a password. Users
+// who log in with an identity provider get their second factor from the
+// provider.
+type UserMFA struct {
+	Model
+	OrganizationMember
+
+	IdentityID uid.ID
+
+	// TOTPSecret is the base32 encoded seed used to generate TOTP codes.
+	TOTPSecret EncryptedAtRest
+	// Confirmed is true once the user entered a valid code from their
+	// authenticator app. Codes are only required at login after the
+	// enrollment is confirmed.
+	Confirmed bool
+	// LastUsedStep is the TOTP time step of the last code that was accepted,
+	// so that each code can only be used once.
+	LastUsedStep int64
+	// RecoveryCodes are the SHA-256 hashes of the recovery codes that have not
+	// been used. Each recovery code can be used once in place of a TOTP code.
+	RecoveryCodes CommaSeparatedStrings
+}
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/uid"
+)
+
+// Webhook is a URL that receives the events of an organization.
+type Webhook struct {
+	Model
+	OrganizationMember
+
+	URL string
+	// Secret is used to sign the events sent to the webhook.
+	Secret EncryptedAtRest
+	// Events are the types of events sent to the webhook. Every type of event
+	// is sent when Events is empty.
+	Events CommaSeparatedStrings
+}
+
+func (w *Webhook) ToAPI() *api.Webhook {
+	events := []string(w.Events)
+	if events == nil {
+		events = []string{}
+	}
+	return &api.Webhook{
+		ID:      w.ID,
+		Created: api.Time(w.CreatedAt),
+		Updated: api.Time(w.UpdatedAt),
+		URL:     w.URL,
+		Events:  events,
+	}
+}
+
+// Accepts returns true if events of eventType are sent to the webhook.
+func (w *Webhook) Accepts(eventType string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, event := range w.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Status of a WebhookDelivery.
+const (
+	WebhookDeliveryPending    = api.WebhookDeliveryPending
+	WebhookDeliveryDelivered  = api.WebhookDeliveryDelivered
+	WebhookDeliveryDeadLetter = api.WebhookDeliveryDeadLetter
+)
+
+// WebhookDelivery is an event that is sent to a webhook. Deliveries are
+// created in the same transaction as the change that caused the event, and
+// sent after the transaction is committed.
+type WebhookDelivery struct {
+	ID uid.ID
+	OrganizationMember
+	WebhookID uid.ID
+	EventType string
+	// Payload is the api.WebhookEvent sent to the webhook.
+	Payload string
+	// Status is one of WebhookDeliveryPending, WebhookDeliveryDelivered, or
+	// WebhookDeliveryDeadLetter.
+	Status         string
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastAttemptAt  time.Time
+	ResponseStatus int
+	LastError      string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (d *WebhookDelivery) OnInsert() error {
+	if d.ID == 0 {
+		d.ID = uid.New()
+	}
+	if d.CreatedAt.IsZero() {
+		d.CreatedAt = time.Now()
+	}
+	d.UpdatedAt = d.CreatedAt
+	if d.Status == "" {
+		d.Status = WebhookDeliveryPending
+	}
+	if d.NextAttemptAt.IsZero() && d.Status == WebhookDeliveryPending {
+		d.NextAttemptAt = d.CreatedAt
+	}
+	return nil
+}
+
+func (d *WebhookDelivery) ToAPI() *api.WebhookDelivery {
+	delivery := &api.WebhookDelivery{
+		ID:             d.ID,
+		Created:        api.Time(d.CreatedAt),
+		EventType:      d.EventType,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		LastAttempt:    api.Time(d.LastAttemptAt),
+		ResponseStatus: d.ResponseStatus,
+		LastError:      d.LastError,
+		Payload:        json.RawMessage(d.Payload),
+	}
+	if d.Status == WebhookDeliveryPending {
+		delivery.NextAttempt = api.Time(d.NextAttemptAt)
+	}
+	return delivery
+}
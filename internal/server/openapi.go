@@ -9,6 +9,7 @@ import (
 	"reflect"
 	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -34,6 +35,8 @@ var funcPartialNameToTagNames = []struct {
 	partial string
 	tag     string
 }{
+	{partial: "AuditEvent", tag: "Audit"},
+	{partial: "AuthenticationReport", tag: "Audit"},
 	{partial: "AccessKey", tag: "Authentication"},
 	{partial: "Login", tag: "Authentication"},
 	{partial: "Logout", tag: "Authentication"},
@@ -93,6 +96,15 @@ func (a *API) register(method, path, funcName string, rqt, rst reflect.Type, req
 	op.Summary = funcName
 	buildRequest(rqt, op, method, requiresAuthentication)
 	op.Responses = buildResponse(a.openAPIDoc.Components.Schemas, rst)
+	if _, ok := reflect.New(rqt).Interface().(isPaginatedRequest); ok && method == http.MethodGet {
+		op.AddParameter(&openapi3.Parameter{
+			Name:        describeQueryParam,
+			In:          "query",
+			Description: "If true, the response is a ListDescription of the filters, sorting, and page sizes supported by this endpoint, instead of the list",
+			Schema:      &openapi3.SchemaRef{Value: &openapi3.Schema{Type: "boolean"}},
+			Example:     false,
+		})
+	}
 
 	for _, item := range funcPartialNameToTagNames {
 		if strings.Contains(funcName, item.partial) {
@@ -147,6 +159,23 @@ func createComponent(schemas openapi3.Schemas, rst reflect.Type) *openapi3.Schem
 	name = strings.ReplaceAll(name, "[", "_")
 	name = strings.ReplaceAll(name, "]", "")
 
+	addStructProperties(schema, rst)
+
+	if _, ok := schemas[name]; ok {
+		return &openapi3.SchemaRef{
+			Ref: "#/components/schemas/" + name,
+		}
+	}
+
+	schemas[name] = &openapi3.SchemaRef{Value: schema}
+	return &openapi3.SchemaRef{
+		Ref: "#/components/schemas/" + name,
+	}
+}
+
+// addStructProperties adds a property to schema for each field of rst. The
+// fields of embedded structs are added as properties of schema.
+func addStructProperties(schema *openapi3.Schema, rst reflect.Type) {
 	for i := 0; i < rst.NumField(); i++ {
 		f := rst.Field(i)
 
@@ -161,26 +190,12 @@ func createComponent(schemas openapi3.Schemas, rst reflect.Type) *openapi3.Schem
 			}
 
 			if typeOrElem.Kind() == reflect.Struct {
-				for j := 0; j < typeOrElem.NumField(); j++ {
-					af := typeOrElem.Field(j)
-					schema.Properties[getFieldName(af, typeOrElem)] = buildProperty(af, af.Type, typeOrElem, schema)
-				}
+				addStructProperties(schema, typeOrElem)
 				continue
 			}
 		}
 		schema.Properties[getFieldName(f, rst)] = buildProperty(f, f.Type, rst, schema)
 	}
-
-	if _, ok := schemas[name]; ok {
-		return &openapi3.SchemaRef{
-			Ref: "#/components/schemas/" + name,
-		}
-	}
-
-	schemas[name] = &openapi3.SchemaRef{Value: schema}
-	return &openapi3.SchemaRef{
-		Ref: "#/components/schemas/" + name,
-	}
 }
 
 func buildProperty(f reflect.StructField, t, parent reflect.Type, parentSchema *openapi3.Schema) *openapi3.SchemaRef {
@@ -193,10 +208,13 @@ func buildProperty(f reflect.StructField, t, parent reflect.Type, parentSchema *
 	updateSchemaFromStructTags(f, s)
 
 	if s.Type == "array" {
-		s.Items = buildProperty(f, t.Elem(), parent, parentSchema)
+		// the note and example of the field describe the array, not the items
+		item := f
+		item.Tag = ""
+		s.Items = buildProperty(item, t.Elem(), parent, parentSchema)
 	}
 
-	if s.Type == "object" {
+	if s.Type == "object" && t.Kind() == reflect.Struct {
 		s.Properties = openapi3.Schemas{}
 
 		for i := 0; i < t.NumField(); i++ {
@@ -248,7 +266,7 @@ func WriteOpenAPIDocToFile(openAPIDoc openapi3.T, version string, filename strin
 
 func updateSchemaFromStructTags(field reflect.StructField, schema *openapi3.Schema) {
 	if example, ok := field.Tag.Lookup("example"); ok {
-		schema.Example = example
+		schema.Example = exampleFromTag(example, schema)
 	}
 
 	if note, ok := field.Tag.Lookup("note"); ok {
@@ -256,6 +274,45 @@ func updateSchemaFromStructTags(field reflect.StructField, schema *openapi3.Sche
 	}
 }
 
+// exampleFromTag converts the value of an example struct tag to a value of the
+// type of the schema. Examples of arrays use a list syntax, like
+// "['okta', 'google']". An example that can not be converted is used as a
+// string.
+func exampleFromTag(example string, schema *openapi3.Schema) any {
+	switch schema.Type {
+	case "integer":
+		if v, err := strconv.ParseInt(example, 10, 64); err == nil {
+			return v
+		}
+	case "number":
+		if v, err := strconv.ParseFloat(example, 64); err == nil {
+			return v
+		}
+	case "boolean":
+		if v, err := strconv.ParseBool(example); err == nil {
+			return v
+		}
+	case "array":
+		return exampleList(example)
+	}
+	return example
+}
+
+func exampleList(example string) []any {
+	example = strings.TrimSpace(example)
+	example = strings.TrimPrefix(example, "[")
+	example = strings.TrimSuffix(example, "]")
+
+	items := []any{}
+	for _, item := range strings.Split(example, ",") {
+		item = strings.Trim(strings.TrimSpace(item), `'"`)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 type describeSchema interface {
 	DescribeSchema(schema *openapi3.Schema)
 }
@@ -281,6 +338,11 @@ func setTypeInfo(t reflect.Type, schema *openapi3.Schema) {
 		t = t.Elem()
 	}
 
+	if t == reflect.TypeOf(json.RawMessage{}) {
+		schema.Type = "object"
+		return
+	}
+
 	//nolint:exhaustive
 	switch t.Kind() {
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
@@ -303,6 +365,14 @@ func setTypeInfo(t reflect.Type, schema *openapi3.Schema) {
 			return
 		}
 		schema.Type = "array"
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			panic("map key must be a string")
+		}
+		schema.Type = "object"
+		valueSchema := &openapi3.Schema{}
+		setTypeInfo(t.Elem(), valueSchema)
+		schema.AdditionalProperties = &openapi3.SchemaRef{Value: valueSchema}
 	case reflect.Struct:
 		schema.Type = "object"
 	default:
@@ -374,6 +444,20 @@ func buildResponse(schemas openapi3.Schemas, rst reflect.Type) openapi3.Response
 		},
 	}
 
+	resp["429"] = &openapi3.ResponseRef{
+		Value: &openapi3.Response{
+			Description: pstr("Too Many Requests: Requestor exceeded the rate limit"),
+			Content:     content,
+		},
+	}
+
+	resp["500"] = &openapi3.ResponseRef{
+		Value: &openapi3.Response{
+			Description: pstr("Internal Server Error"),
+			Content:     content,
+		},
+	}
+
 	return resp
 }
 
@@ -393,15 +477,14 @@ func buildRequest(r reflect.Type, op *openapi3.Operation, method string, require
 	op.Parameters = openapi3.NewParameters()
 
 	op.AddParameter(&openapi3.Parameter{
-		Name:     "Infra-Version",
-		In:       "header",
-		Required: true,
+		Name: "Infra-Version",
+		In:   "header",
 		Schema: &openapi3.SchemaRef{
 			Value: &openapi3.Schema{
 				Example:     productVersion(),
 				Format:      `\d+\.\d+\(.\d+)?(-.\w(+\w)?)?`,
 				Type:        "string",
-				Description: "Version of the API being requested",
+				Description: "Version of the API being requested. Defaults to the latest version",
 			},
 		},
 	})
@@ -473,9 +556,8 @@ func buildRequest(r reflect.Type, op *openapi3.Operation, method string, require
 			panic(fmt.Sprintf("field %q of struct %q must have a tag (json, form, or uri) with a name or '-'", f.Name, r.Name()))
 		}
 
-		// TODO: share this with updateSchemaFromStructTags
 		if example, ok := f.Tag.Lookup("example"); ok {
-			p.Example = example
+			p.Example = exampleFromTag(example, propSchema.Value)
 		}
 		if note, ok := f.Tag.Lookup("note"); ok {
 			p.Description = note
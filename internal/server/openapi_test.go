@@ -1,6 +1,7 @@
 package server
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"path/filepath"
 	"testing"
@@ -40,3 +41,36 @@ func patchProductVersion(t *testing.T, version string) {
 	})
 
 }
+
+// TestOpenAPIDocument_Operations checks the schema generated for a few
+// operations in detail. To update the expected values, run:
+//
+//	go test ./internal/server -run TestOpenAPIDocument_Operations -update
+func TestOpenAPIDocument_Operations(t *testing.T) {
+	patchProductVersion(t, "0.0.0")
+	s := Server{metricsRegistry: prometheus.NewRegistry()}
+	doc := s.GenerateRoutes().OpenAPIDocument
+
+	run := func(t *testing.T, value any) {
+		t.Helper()
+		actual, err := json.MarshalIndent(value, "", "  ")
+		assert.NilError(t, err)
+		golden.Assert(t, string(actual)+"\n", t.Name())
+	}
+
+	t.Run("list users", func(t *testing.T) {
+		run(t, doc.Paths["/api/users"].Get)
+	})
+	t.Run("create webhook", func(t *testing.T) {
+		run(t, doc.Paths["/api/webhooks"].Post)
+	})
+	t.Run("list webhook deliveries", func(t *testing.T) {
+		run(t, doc.Paths["/api/webhooks/{id}/deliveries"].Get)
+	})
+	t.Run("error", func(t *testing.T) {
+		run(t, doc.Components.Schemas["Error"])
+	})
+	t.Run("user", func(t *testing.T) {
+		run(t, doc.Components.Schemas["User"])
+	})
+}
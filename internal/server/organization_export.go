@@ -0,0 +1,180 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/access"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+// ExportOrganization streams an api.OrganizationExport of the organization.
+// The response is written one section at a time, so that the export of a
+// large organization is never held in memory. The route uses a repeatable
+// read transaction, so that every section is read from the same snapshot.
+//
+// An error after the response has started can not be sent to the client. The
+// response is left incomplete, and is not valid JSON.
+func (a *API) ExportOrganization(c *gin.Context, r *api.Resource) (*api.OrganizationExport, error) {
+	org, err := access.GetOrganization(c, r.ID)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := access.ExportOrganization(c, org.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	maxUpdateIndex, err := data.GrantsMaxUpdateIndex(tx, data.GrantsMaxUpdateIndexOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("grants max update index: %w", err)
+	}
+	settings, err := data.GetSettings(tx)
+	if err != nil {
+		return nil, fmt.Errorf("get settings: %w", err)
+	}
+	orgSettings, err := data.GetOrgSettings(tx)
+	if err != nil {
+		return nil, fmt.Errorf("get org settings: %w", err)
+	}
+	apiSettings := settings.ToAPI()
+	a.setOrgSettingsResponse(apiSettings, orgSettings)
+
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	out := newJSONObjectWriter(c.Writer)
+	out.field("version", api.OrganizationExportVersion)
+	out.field("exportedAt", api.Time(time.Now()))
+	out.field("organization", org.ToAPI())
+	out.field("grantsMaxUpdateIndex", maxUpdateIndex)
+	out.field("settings", apiSettings)
+
+	sections := []struct {
+		name    string
+		forEach func() error
+	}{
+		{name: "users", forEach: func() error {
+			return data.ForEachIdentity(tx, func(i models.Identity) error {
+				return out.item(i.ToAPI())
+			})
+		}},
+		{name: "groups", forEach: func() error {
+			return data.ForEachGroup(tx, func(g models.Group) error {
+				return out.item(g.ToAPI())
+			})
+		}},
+		{name: "memberships", forEach: func() error {
+			return data.ForEachGroupMembership(tx, func(m data.GroupMembership) error {
+				return out.item(api.GroupMembership{GroupID: m.GroupID, UserID: m.IdentityID})
+			})
+		}},
+		{name: "grants", forEach: func() error {
+			return data.ForEachGrant(tx, func(g models.Grant) error {
+				return out.item(g.ToAPI())
+			})
+		}},
+		{name: "providers", forEach: func() error {
+			return data.ForEachProvider(tx, func(p models.Provider) error {
+				return out.item(p.ToAPI())
+			})
+		}},
+		{name: "destinations", forEach: func() error {
+			return data.ForEachDestination(tx, func(d models.Destination) error {
+				return out.item(d.ToAPI())
+			})
+		}},
+	}
+	for _, section := range sections {
+		out.startArray(section.name)
+		if err := section.forEach(); err != nil {
+			return nil, fmt.Errorf("export %v: %w", section.name, err)
+		}
+		out.endArray()
+	}
+	return nil, out.close()
+}
+
+// jsonObjectWriter writes a JSON object one field at a time. Arrays are
+// written one item at a time, so that they can be streamed. The first error
+// from writing is kept, and returned by every call after it.
+type jsonObjectWriter struct {
+	w      *bufio.Writer
+	fields int
+	items  int
+	err    error
+}
+
+func newJSONObjectWriter(w io.Writer) *jsonObjectWriter {
+	o := &jsonObjectWriter{w: bufio.NewWriter(w)}
+	o.write([]byte("{"))
+	return o
+}
+
+func (o *jsonObjectWriter) write(b []byte) {
+	if o.err == nil {
+		_, o.err = o.w.Write(b)
+	}
+}
+
+func (o *jsonObjectWriter) writeValue(v any) {
+	if o.err != nil {
+		return
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		o.err = err
+		return
+	}
+	o.write(raw)
+}
+
+func (o *jsonObjectWriter) key(name string) {
+	if o.fields > 0 {
+		o.write([]byte(","))
+	}
+	o.fields++
+	o.writeValue(name)
+	o.write([]byte(":"))
+}
+
+func (o *jsonObjectWriter) field(name string, v any) {
+	o.key(name)
+	o.writeValue(v)
+}
+
+func (o *jsonObjectWriter) startArray(name string) {
+	o.key(name)
+	o.write([]byte("["))
+	o.items = 0
+}
+
+func (o *jsonObjectWriter) item(v any) error {
+	if o.items > 0 {
+		o.write([]byte(","))
+	}
+	o.items++
+	o.writeValue(v)
+	return o.err
+}
+
+func (o *jsonObjectWriter) endArray() {
+	o.write([]byte("]"))
+}
+
+// close ends the object and flushes any buffered output.
+func (o *jsonObjectWriter) close() error {
+	o.write([]byte("}\n"))
+	if o.err != nil {
+		return o.err
+	}
+	return o.w.Flush()
+}
@@ -2,12 +2,17 @@ package server
 
 import (
 	"fmt"
+	"sort"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/infrahq/infra/api"
 	"github.com/infrahq/infra/internal/access"
+	"github.com/infrahq/infra/internal/server/audit"
+	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/internal/validate"
 )
 
 func (a *API) ListOrganizations(c *gin.Context, r *api.ListOrganizationsRequest) (*api.ListResponse[api.Organization], error) {
@@ -40,7 +45,7 @@ func (a *API) GetOrganization(c *gin.Context, r *api.GetOrganizationRequest) (*a
 	return org.ToAPI(), nil
 }
 
-func (a *API) CreateOrganization(c *gin.Context, r *api.CreateOrganizationRequest) (*api.Organization, error) {
+func (a *API) CreateOrganization(c *gin.Context, r *api.CreateOrganizationRequest) (*api.CreateOrganizationResponse, error) {
 	org := &models.Organization{
 		Name:   r.Name,
 		Domain: r.Domain,
@@ -57,11 +62,151 @@ func (a *API) CreateOrganization(c *gin.Context, r *api.CreateOrganizationReques
 		return nil, err
 	}
 
+	resp := &api.CreateOrganizationResponse{Organization: *org.ToAPI()}
+
+	if r.AdminEmail != "" {
+		admin, tmpPassword, err := access.CreateOrganizationAdmin(c, org, r.AdminEmail, a.server.options.OneTimePasswords.inviteExpiry())
+		if err != nil {
+			return nil, fmt.Errorf("create organization admin: %w", err)
+		}
+
+		resp.AdminUser = &api.CreateUserResponse{ID: admin.ID, Name: admin.Name}
+		if r.AdminInviteLink {
+			tx := getRequestContext(c).DBTxn.WithOrgID(org.ID)
+			token, err := data.CreatePasswordResetToken(tx, admin.ID, a.server.options.OneTimePasswords.inviteExpiry())
+			if err != nil {
+				return nil, err
+			}
+			resp.AdminInviteLink = fmt.Sprintf("https://%s/accept-invite?token=%s", org.Domain, token)
+		} else {
+			resp.AdminUser.OneTimePassword = tmpPassword
+		}
+	}
+
 	a.t.Org(org.ID.String(), authIdent.ID.String(), org.Name, org.Domain)
 
+	return resp, nil
+}
+
+func (a *API) UpdateOrganization(c *gin.Context, r *api.UpdateOrganizationRequest) (*api.Organization, error) {
+	org, err := access.GetOrganization(c, r.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Name != "" {
+		org.Name = r.Name
+	}
+	if r.Domain != "" && r.Domain != org.Domain {
+		if r.DomainAliasDuration > 0 {
+			expires := time.Now().Add(time.Duration(r.DomainAliasDuration))
+			org.DomainAlias = org.Domain
+			org.DomainAliasExpiresAt = &expires
+		} else {
+			org.DomainAlias = ""
+			org.DomainAliasExpiresAt = nil
+		}
+		org.Domain = r.Domain
+	}
+
+	if err := access.UpdateOrganization(c, org); err != nil {
+		return nil, err
+	}
 	return org.ToAPI(), nil
 }
 
-func (a *API) DeleteOrganization(c *gin.Context, r *api.Resource) (*api.EmptyResponse, error) {
-	return nil, access.DeleteOrganization(c, r.ID)
+func (a *API) GetOrganizationRateLimits(c *gin.Context, r *api.Resource) (*api.OrganizationRateLimits, error) {
+	org, err := access.GetOrganization(c, r.ID)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := access.GetOrganizationSettings(c, org.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &api.OrganizationRateLimits{
+		RateLimit:          settings.RateLimit,
+		ConnectorRateLimit: settings.ConnectorRateLimit,
+	}, nil
+}
+
+func (a *API) UpdateOrganizationRateLimits(c *gin.Context, r *api.UpdateOrganizationRateLimitsRequest) (*api.OrganizationRateLimits, error) {
+	org, err := access.GetOrganization(c, r.ID)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := access.GetOrganizationSettings(c, org.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	settings.RateLimit = r.RateLimit
+	settings.ConnectorRateLimit = r.ConnectorRateLimit
+	if err := access.UpdateOrganizationSettings(c, settings); err != nil {
+		return nil, err
+	}
+
+	return &api.OrganizationRateLimits{
+		RateLimit:          settings.RateLimit,
+		ConnectorRateLimit: settings.ConnectorRateLimit,
+	}, nil
+}
+
+func (a *API) GetOrganizationStats(c *gin.Context, r *api.Resource) (*api.OrganizationStats, error) {
+	org, err := access.GetOrganization(c, r.ID)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := access.GetOrganizationStats(c, org.ID)
+	if err != nil {
+		return nil, err
+	}
+	return organizationStatsToAPI(stats), nil
+}
+
+// GetStats returns the stats of the organization of the request.
+func (a *API) GetStats(c *gin.Context, _ *api.EmptyRequest) (*api.OrganizationStats, error) {
+	rCtx := getRequestContext(c)
+	stats, err := access.GetOrganizationStats(c, rCtx.DBTxn.OrganizationID())
+	if err != nil {
+		return nil, err
+	}
+	return organizationStatsToAPI(stats), nil
+}
+
+func organizationStatsToAPI(stats *data.OrganizationStats) *api.OrganizationStats {
+	return &api.OrganizationStats{
+		Users:            stats.Users,
+		Groups:           stats.Groups,
+		Grants:           stats.Grants,
+		Destinations:     stats.Destinations,
+		ActiveAccessKeys: stats.ActiveAccessKeys,
+	}
+}
+
+func (a *API) DeleteOrganization(c *gin.Context, r *api.DeleteOrganizationRequest) (*api.DeleteOrganizationResponse, error) {
+	org, err := access.GetOrganization(c, r.ID)
+	if err != nil {
+		return nil, err
+	}
+	if r.Confirm != org.Domain {
+		return nil, validate.Error{"confirm": {"must match the domain of the organization"}}
+	}
+
+	counts, err := access.DeleteOrganization(c, org.ID, r.DryRun)
+	if !r.DryRun {
+		target := auditTarget{Type: "organization", ID: org.ID.String(), Name: org.Name}
+		a.recordAuditOnCommit(c, audit.ActionOrganizationDelete, target, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp := &api.DeleteOrganizationResponse{DryRun: r.DryRun}
+	for name, count := range counts {
+		resp.Tables = append(resp.Tables, api.TableCount{Name: name, Count: count})
+	}
+	sort.Slice(resp.Tables, func(i, j int) bool {
+		return resp.Tables[i].Name < resp.Tables[j].Name
+	})
+	return resp, nil
 }
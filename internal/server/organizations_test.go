@@ -6,14 +6,17 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	gocmp "github.com/google/go-cmp/cmp"
 	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
 
 	"github.com/infrahq/infra/api"
 	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/server/audit"
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
 	"github.com/infrahq/infra/internal/server/providers"
@@ -310,6 +313,130 @@ func TestAPI_CreateOrganization(t *testing.T) {
 				Domain: "awesome.example.com",
 			},
 		},
+		"with an admin user": {
+			setup: func(t *testing.T, req *http.Request) {
+				req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+			},
+			body: api.CreateOrganizationRequest{
+				Name:       "WithAdmin",
+				Domain:     "withadmin.example.com",
+				AdminEmail: "admin@withadmin.example.com",
+			},
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+
+				respBody := &api.CreateOrganizationResponse{}
+				err := json.Unmarshal(resp.Body.Bytes(), respBody)
+				assert.NilError(t, err)
+				assert.Equal(t, respBody.Name, "WithAdmin")
+				assert.Assert(t, respBody.AdminUser != nil)
+				assert.Equal(t, respBody.AdminUser.Name, "admin@withadmin.example.com")
+				assert.Assert(t, respBody.AdminUser.OneTimePassword != "")
+				assert.Equal(t, respBody.AdminInviteLink, "")
+
+				tx := txnForTestCase(t, srv.db, respBody.ID)
+				admin, err := data.GetIdentity(tx, data.GetIdentityOptions{
+					ByID:          respBody.AdminUser.ID,
+					LoadProviders: true,
+				})
+				assert.NilError(t, err)
+				assert.Equal(t, admin.OrganizationID, respBody.ID)
+				assert.Equal(t, len(admin.Providers), 1)
+				assert.Equal(t, admin.Providers[0].ID, data.InfraProvider(tx).ID)
+				assert.Equal(t, admin.Providers[0].OrganizationID, respBody.ID)
+
+				cred, err := data.GetCredentialByUserID(tx, admin.ID)
+				assert.NilError(t, err)
+				assert.Assert(t, cred.OneTimePassword)
+				assert.Equal(t, cred.OrganizationID, respBody.ID)
+
+				grants, err := data.ListGrants(tx, data.ListGrantsOptions{
+					BySubject: uid.NewIdentityPolymorphicID(admin.ID),
+				})
+				assert.NilError(t, err)
+				assert.Equal(t, len(grants), 1)
+				assert.Equal(t, grants[0].Privilege, models.InfraAdminRole)
+				assert.Equal(t, grants[0].Resource, "infra")
+				assert.Equal(t, grants[0].OrganizationID, respBody.ID)
+
+				// the admin must not exist in the organization of the caller
+				_, err = data.GetIdentity(srv.DB(), data.GetIdentityOptions{ByID: admin.ID})
+				assert.ErrorIs(t, err, internal.ErrNotFound)
+			},
+		},
+		"with an admin user invite link": {
+			setup: func(t *testing.T, req *http.Request) {
+				req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+			},
+			body: api.CreateOrganizationRequest{
+				Name:            "WithInvite",
+				Domain:          "withinvite.example.com",
+				AdminEmail:      "admin@withinvite.example.com",
+				AdminInviteLink: true,
+			},
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+
+				respBody := &api.CreateOrganizationResponse{}
+				err := json.Unmarshal(resp.Body.Bytes(), respBody)
+				assert.NilError(t, err)
+				assert.Assert(t, respBody.AdminUser != nil)
+				assert.Equal(t, respBody.AdminUser.OneTimePassword, "")
+
+				prefix := "https://withinvite.example.com/accept-invite?token="
+				assert.Assert(t, strings.HasPrefix(respBody.AdminInviteLink, prefix), respBody.AdminInviteLink)
+
+				tx := txnForTestCase(t, srv.db, respBody.ID)
+				token := strings.TrimPrefix(respBody.AdminInviteLink, prefix)
+				userID, err := data.ClaimPasswordResetToken(tx, token)
+				assert.NilError(t, err)
+				assert.Equal(t, userID, respBody.AdminUser.ID)
+			},
+		},
+		"duplicate name": {
+			setup: func(t *testing.T, req *http.Request) {
+				createOrgs(t, srv.DB(), &models.Organization{Name: "Taken", Domain: "taken.example.com"})
+				req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+			},
+			body: api.CreateOrganizationRequest{
+				Name:       "Taken",
+				Domain:     "different.example.com",
+				AdminEmail: "admin@different.example.com",
+			},
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Equal(t, resp.Code, http.StatusConflict, resp.Body.String())
+
+				_, err := data.GetOrganization(srv.DB(), data.GetOrganizationOptions{ByDomain: "different.example.com"})
+				assert.ErrorIs(t, err, internal.ErrNotFound)
+			},
+		},
+		"duplicate domain": {
+			setup: func(t *testing.T, req *http.Request) {
+				createOrgs(t, srv.DB(), &models.Organization{Name: "Existing", Domain: "existing.example.com"})
+				req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+			},
+			body: api.CreateOrganizationRequest{
+				Name:       "NotExisting",
+				Domain:     "existing.example.com",
+				AdminEmail: "admin@existing.example.com",
+			},
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Equal(t, resp.Code, http.StatusConflict, resp.Body.String())
+			},
+		},
+		"invalid admin email": {
+			setup: func(t *testing.T, req *http.Request) {
+				req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+			},
+			body: api.CreateOrganizationRequest{
+				Name:       "BadEmail",
+				Domain:     "bademail.example.com",
+				AdminEmail: "not-an-email",
+			},
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+			},
+		},
 		"missing required fields": {
 			setup: func(t *testing.T, req *http.Request) {
 				req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
@@ -323,8 +450,8 @@ func TestAPI_CreateOrganization(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{FieldName: "domain", Errors: []string{"is required"}},
-					{FieldName: "name", Errors: []string{"is required"}},
+					{FieldName: "domain", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
+					{FieldName: "name", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
 			},
@@ -337,12 +464,313 @@ func TestAPI_CreateOrganization(t *testing.T) {
 	}
 }
 
+func TestAPI_UpdateOrganization(t *testing.T) {
+	srv := setupServer(t, withAdminUser, withSupportAdminGrant, withMultiOrgEnabled)
+	routes := srv.GenerateRoutes()
+
+	first := models.Organization{Name: "first", Domain: "first.example.com"}
+	second := models.Organization{Name: "second", Domain: "second.example.com"}
+	createOrgs(t, srv.DB(), &first, &second)
+
+	update := func(t *testing.T, id uid.ID, body api.UpdateOrganizationRequest) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodPatch, "/api/organizations/"+id.String(), jsonBody(t, body))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// routedTo sends an unauthenticated request which requires an organization
+	// to host, and returns the response status code.
+	routedTo := func(t *testing.T, host string) int {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodGet, "/api/settings", nil)
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		req.Host = host
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	t.Run("invalid domain", func(t *testing.T) {
+		resp := update(t, first.ID, api.UpdateOrganizationRequest{Domain: "Not_A.Domain"})
+		assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+	})
+
+	t.Run("domain used by another org", func(t *testing.T) {
+		resp := update(t, first.ID, api.UpdateOrganizationRequest{Domain: "second.example.com"})
+		assert.Equal(t, resp.Code, http.StatusConflict, resp.Body.String())
+	})
+
+	t.Run("name used by another org", func(t *testing.T) {
+		resp := update(t, first.ID, api.UpdateOrganizationRequest{Name: "second"})
+		assert.Equal(t, resp.Code, http.StatusConflict, resp.Body.String())
+	})
+
+	t.Run("rename with domain alias", func(t *testing.T) {
+		assert.Equal(t, routedTo(t, "first.example.com"), http.StatusOK)
+		assert.Equal(t, routedTo(t, "renamed.example.com"), http.StatusBadRequest)
+
+		resp := update(t, first.ID, api.UpdateOrganizationRequest{
+			Name:                "renamed",
+			Domain:              "renamed.example.com",
+			DomainAliasDuration: api.Duration(time.Hour),
+		})
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		respBody := &api.Organization{}
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), respBody))
+		assert.Equal(t, respBody.Name, "renamed")
+		assert.Equal(t, respBody.Domain, "renamed.example.com")
+		assert.Equal(t, respBody.DomainAlias, "first.example.com")
+		assert.Assert(t, respBody.DomainAliasExpires != nil)
+
+		// requests to both the old and new domain are routed to the org
+		assert.Equal(t, routedTo(t, "renamed.example.com"), http.StatusOK)
+		assert.Equal(t, routedTo(t, "first.example.com"), http.StatusOK)
+
+		// the alias can not be claimed by another org
+		resp = update(t, second.ID, api.UpdateOrganizationRequest{Domain: "first.example.com"})
+		assert.Equal(t, resp.Code, http.StatusConflict, resp.Body.String())
+	})
+
+	t.Run("rename without domain alias", func(t *testing.T) {
+		resp := update(t, second.ID, api.UpdateOrganizationRequest{Domain: "moved.example.com"})
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		assert.Equal(t, routedTo(t, "moved.example.com"), http.StatusOK)
+		assert.Equal(t, routedTo(t, "second.example.com"), http.StatusBadRequest)
+	})
+}
+
+func TestAPI_UpdateOrganizationRateLimits(t *testing.T) {
+	srv := setupServer(t, withAdminUser, withSupportAdminGrant, withMultiOrgEnabled)
+	routes := srv.GenerateRoutes()
+
+	org := models.Organization{Name: "limited", Domain: "limited.example.com"}
+	createOrgs(t, srv.DB(), &org)
+
+	send := func(t *testing.T, method string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(method, "/api/organizations/"+org.ID.String()+"/rate-limits", jsonBody(t, body))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("negative limit", func(t *testing.T) {
+		resp := send(t, http.MethodPut, api.UpdateOrganizationRateLimitsRequest{RateLimit: -1})
+		assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+	})
+
+	t.Run("update and get", func(t *testing.T) {
+		resp := send(t, http.MethodPut, api.UpdateOrganizationRateLimitsRequest{
+			RateLimit:          100,
+			ConnectorRateLimit: 1000,
+		})
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		resp = send(t, http.MethodGet, nil)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		respBody := &api.OrganizationRateLimits{}
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), respBody))
+		expected := &api.OrganizationRateLimits{RateLimit: 100, ConnectorRateLimit: 1000}
+		assert.DeepEqual(t, respBody, expected)
+
+		tx := txnForTestCase(t, srv.db, org.ID)
+		settings, err := srv.orgSettings(tx)
+		assert.NilError(t, err)
+		assert.Equal(t, settings.RateLimit, 100)
+	})
+}
+
+func TestAPI_GetOrganizationStats(t *testing.T) {
+	srv := setupServer(t, withAdminUser, withSupportAdminGrant, withMultiOrgEnabled)
+	routes := srv.GenerateRoutes()
+
+	org := models.Organization{Name: "counted", Domain: "counted.example.com"}
+	createOrgs(t, srv.DB(), &org)
+
+	get := func(t *testing.T, path string, key string) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("support admin gets stats of another org", func(t *testing.T) {
+		resp := get(t, "/api/organizations/"+org.ID.String()+"/stats", adminAccessKey(srv))
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		respBody := &api.OrganizationStats{}
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), respBody))
+		// only the connector and its grant exist in a new org
+		expected := &api.OrganizationStats{Grants: 1}
+		assert.DeepEqual(t, respBody, expected)
+	})
+
+	t.Run("admin gets stats of their own org", func(t *testing.T) {
+		resp := get(t, "/api/stats", adminAccessKey(srv))
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		respBody := &api.OrganizationStats{}
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), respBody))
+		assert.Equal(t, respBody.Users, int64(1)) // the admin, the connector is excluded
+	})
+
+	t.Run("user without admin role", func(t *testing.T) {
+		tx := txnForTestCase(t, srv.db, srv.db.DefaultOrg.ID)
+		user := &models.Identity{Name: "viewer@example.com"}
+		assert.NilError(t, data.CreateIdentity(tx, user))
+		key, err := data.CreateAccessKey(tx, &models.AccessKey{
+			IssuedFor:  user.ID,
+			ProviderID: data.InfraProvider(tx).ID,
+			ExpiresAt:  time.Now().Add(time.Minute),
+		})
+		assert.NilError(t, err)
+		assert.NilError(t, tx.Commit())
+
+		resp := get(t, "/api/stats", key)
+		assert.Equal(t, resp.Code, http.StatusForbidden, resp.Body.String())
+	})
+}
+
+func TestAPI_ExportOrganization(t *testing.T) {
+	srv := setupServer(t, withAdminUser, withSupportAdminGrant, withMultiOrgEnabled)
+	routes := srv.GenerateRoutes()
+
+	other := models.Organization{Name: "other", Domain: "other.example.com"}
+	createOrgs(t, srv.DB(), &other)
+
+	tx := txnForTestCase(t, srv.db, srv.db.DefaultOrg.ID)
+	user := &models.Identity{Name: "member@example.com"}
+	assert.NilError(t, data.CreateIdentity(tx, user))
+	group := &models.Group{Name: "developers"}
+	assert.NilError(t, data.CreateGroup(tx, group))
+	assert.NilError(t, data.AddUsersToGroup(tx, group.ID, []uid.ID{user.ID}))
+	grant := &models.Grant{Subject: group.PolyID(), Privilege: "view", Resource: "production"}
+	assert.NilError(t, data.CreateGrant(tx, grant))
+	provider := &models.Provider{
+		Name:         "okta",
+		Kind:         models.ProviderKindOkta,
+		URL:          "example.okta.com",
+		ClientID:     "the-client-id",
+		ClientSecret: "the-client-secret",
+	}
+	assert.NilError(t, data.CreateProvider(tx, provider))
+	destination := &models.Destination{Name: "production", UniqueID: "unique-id", Kind: models.DestinationKindKubernetes}
+	assert.NilError(t, data.CreateDestination(tx, destination))
+	viewer := &models.Identity{Name: "viewer@example.com"}
+	assert.NilError(t, data.CreateIdentity(tx, viewer))
+	viewerKey, err := data.CreateAccessKey(tx, &models.AccessKey{
+		IssuedFor:  viewer.ID,
+		ProviderID: data.InfraProvider(tx).ID,
+		ExpiresAt:  time.Now().Add(time.Minute),
+	})
+	assert.NilError(t, err)
+	assert.NilError(t, tx.Commit())
+
+	get := func(t *testing.T, orgID uid.ID, key string) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodGet, "/api/organizations/"+orgID.String()+"/export", nil)
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("admin exports their own org", func(t *testing.T) {
+		resp := get(t, srv.db.DefaultOrg.ID, adminAccessKey(srv))
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		assert.Equal(t, resp.Header().Get("Content-Type"), "application/json; charset=utf-8")
+		assert.Assert(t, !strings.Contains(resp.Body.String(), "the-client-secret"))
+
+		export := &api.OrganizationExport{}
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), export))
+		assert.Equal(t, export.Version, api.OrganizationExportVersion)
+		assert.Equal(t, export.Organization.ID, srv.db.DefaultOrg.ID)
+		assert.Assert(t, export.GrantsMaxUpdateIndex >= grant.UpdateIndex)
+		assert.Equal(t, export.Settings.PasswordRequirements.LengthMin, 8)
+
+		var userNames []string
+		for _, u := range export.Users {
+			userNames = append(userNames, u.Name)
+		}
+		assert.Assert(t, is.Contains(userNames, "member@example.com"))
+		assert.Assert(t, is.Contains(userNames, "viewer@example.com"))
+
+		assert.Equal(t, len(export.Groups), 1)
+		assert.Equal(t, export.Groups[0].ID, group.ID)
+		assert.Equal(t, export.Groups[0].Name, "developers")
+		assert.DeepEqual(t, export.Memberships,
+			[]api.GroupMembership{{GroupID: group.ID, UserID: user.ID}})
+
+		var grantIDs []uid.ID
+		for _, g := range export.Grants {
+			grantIDs = append(grantIDs, g.ID)
+		}
+		assert.Assert(t, is.Contains(grantIDs, grant.ID))
+
+		var providerNames []string
+		for _, p := range export.Providers {
+			providerNames = append(providerNames, p.Name)
+		}
+		assert.DeepEqual(t, providerNames, []string{"infra", "okta"})
+
+		assert.Equal(t, len(export.Destinations), 1)
+		assert.Equal(t, export.Destinations[0].ID, destination.ID)
+	})
+
+	t.Run("support admin exports another org", func(t *testing.T) {
+		resp := get(t, other.ID, adminAccessKey(srv))
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		export := &api.OrganizationExport{}
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), export))
+		assert.Equal(t, export.Organization.ID, other.ID)
+		assert.Equal(t, len(export.Groups), 0)
+		assert.Equal(t, len(export.Destinations), 0)
+		// only the connector and its grant exist in a new org
+		assert.Equal(t, len(export.Users), 1)
+		assert.Equal(t, len(export.Grants), 1)
+	})
+
+	t.Run("user without admin role", func(t *testing.T) {
+		resp := get(t, srv.db.DefaultOrg.ID, viewerKey)
+		assert.Equal(t, resp.Code, http.StatusForbidden, resp.Body.String())
+	})
+}
+
+func tableCounts(resp *api.DeleteOrganizationResponse) map[string]int64 {
+	result := make(map[string]int64, len(resp.Tables))
+	for _, table := range resp.Tables {
+		result[table.Name] = table.Count
+	}
+	return result
+}
+
 func TestAPI_DeleteOrganization(t *testing.T) {
 	srv := setupServer(t, withAdminUser, withSupportAdminGrant)
 	routes := srv.GenerateRoutes()
+	sink := withMemoryAuditSink(srv)
 
 	first := models.Organization{Name: "first", Domain: "first.example.com"}
-	createOrgs(t, srv.DB(), &first)
+	second := models.Organization{Name: "second", Domain: "second.example.com"}
+	createOrgs(t, srv.DB(), &first, &second)
 
 	type testCase struct {
 		urlPath  string
@@ -375,15 +803,77 @@ func TestAPI_DeleteOrganization(t *testing.T) {
 				assert.Equal(t, resp.Code, http.StatusUnauthorized)
 			},
 		},
-		"authorized by grant": {
+		"missing confirmation": {
 			urlPath: "/api/organizations/" + first.ID.String(),
 			setup: func(t *testing.T, req *http.Request) {
 				req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
 			},
 			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
-				assert.Equal(t, resp.Code, http.StatusNoContent, resp.Body.String())
+				assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+			},
+		},
+		"wrong confirmation": {
+			urlPath: "/api/organizations/" + first.ID.String() + "?confirm=other.example.com",
+			setup: func(t *testing.T, req *http.Request) {
+				req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+			},
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
 				_, err := data.GetOrganization(srv.DB(), data.GetOrganizationOptions{ByID: first.ID})
+				assert.NilError(t, err)
+			},
+		},
+		"default organization": {
+			urlPath: "/api/organizations/" + srv.db.DefaultOrg.ID.String() + "?confirm=" + srv.db.DefaultOrg.Domain,
+			setup: func(t *testing.T, req *http.Request) {
+				req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+			},
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+			},
+		},
+		"dry run": {
+			urlPath: "/api/organizations/" + first.ID.String() + "?confirm=first.example.com&dryRun=true",
+			setup: func(t *testing.T, req *http.Request) {
+				req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+			},
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+				respBody := &api.DeleteOrganizationResponse{}
+				assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), respBody))
+				assert.Assert(t, respBody.DryRun)
+				counts := tableCounts(respBody)
+				assert.Equal(t, counts["organizations"], int64(1))
+				assert.Equal(t, counts["identities"], int64(1)) // the connector
+
+				_, err := data.GetOrganization(srv.DB(), data.GetOrganizationOptions{ByID: first.ID})
+				assert.NilError(t, err)
+				assert.Equal(t, len(sink.Events(t)), 0)
+			},
+		},
+		"authorized by grant": {
+			urlPath: "/api/organizations/" + second.ID.String() + "?confirm=second.example.com",
+			setup: func(t *testing.T, req *http.Request) {
+				req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+			},
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+				respBody := &api.DeleteOrganizationResponse{}
+				assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), respBody))
+				assert.Assert(t, !respBody.DryRun)
+				assert.Equal(t, tableCounts(respBody)["organizations"], int64(1))
+
+				_, err := data.GetOrganization(srv.DB(), data.GetOrganizationOptions{ByID: second.ID})
 				assert.ErrorIs(t, err, internal.ErrNotFound)
+
+				// the deletion is audited in the organization of the admin
+				events := sink.Events(t)
+				assert.Equal(t, len(events), 1)
+				assert.Equal(t, events[0].Action, audit.ActionOrganizationDelete)
+				assert.Equal(t, events[0].TargetID, second.ID.String())
+				assert.Equal(t, events[0].OrganizationID, srv.db.DefaultOrg.ID)
 			},
 		},
 	}
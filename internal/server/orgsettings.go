@@ -0,0 +1,30 @@
+package server
+
+import (
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+// orgSettings returns the settings of the organization of tx, with any unset
+// fields populated from the server options. The settings are read from the
+// cache of the data package, which is invalidated when an update commits.
+func (s *Server) orgSettings(tx data.ReadTxn) (models.OrgSettings, error) {
+	orgSettings, err := data.GetOrgSettings(tx)
+	if err != nil {
+		return models.OrgSettings{}, err
+	}
+	settings := *orgSettings
+	if settings.AccessKeyTTL == 0 {
+		settings.AccessKeyTTL = s.options.SessionDuration
+	}
+	if settings.SessionInactivityTimeout == 0 {
+		settings.SessionInactivityTimeout = s.options.SessionInactivityTimeout
+	}
+	if settings.RateLimit == 0 {
+		settings.RateLimit = s.options.API.RateLimit
+	}
+	if settings.ConnectorRateLimit == 0 {
+		settings.ConnectorRateLimit = s.options.API.ConnectorRateLimit
+	}
+	return settings, nil
+}
@@ -1,29 +1,73 @@
 package server
 
 import (
+	"encoding/base64"
 	"math"
 
 	"github.com/infrahq/infra/api"
 	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/validate"
+	"github.com/infrahq/infra/uid"
 )
 
 // PaginationFromRequest translates an api.PaginationRequest into the internal
-// Pagination type.
+// Pagination type. The limit of the request is checked by wrapRoute before the
+// handler is called.
 func PaginationFromRequest(pr api.PaginationRequest) data.Pagination {
-	page, limit := 1, 100
+	p := data.Pagination{Page: pr.Page, Limit: pr.Limit}
+	if pr.WithTotal != nil && !*pr.WithTotal {
+		p.SkipTotalCount = true
+	}
+	p.SetDefaults()
+	return p
+}
+
+// isPaginatedRequest is implemented by every request that embeds
+// api.PaginationRequest.
+type isPaginatedRequest interface {
+	PaginationLimit() int
+}
 
-	if pr.Limit != 0 {
-		limit = pr.Limit
+// validatePaginationLimit returns an error if req is a paginated request with a
+// limit that is greater than maxLimit.
+func validatePaginationLimit(req any, maxLimit int) error {
+	r, ok := req.(isPaginatedRequest)
+	if !ok {
+		return nil
 	}
+	p := data.Pagination{Limit: r.PaginationLimit()}
+	return p.Validate(maxLimit)
+}
 
-	if pr.Page != 0 {
-		page = pr.Page
+// CursorPaginationFromRequest translates an api.PaginationRequest and a cursor
+// into the internal Pagination type. When cursor is empty the request uses page
+// pagination, the same as PaginationFromRequest.
+func CursorPaginationFromRequest(pr api.PaginationRequest, cursor string) (data.Pagination, error) {
+	p := PaginationFromRequest(pr)
+	if cursor == "" {
+		return p, nil
+	}
+	afterID, err := decodeCursor(cursor)
+	if err != nil {
+		return data.Pagination{}, validate.Error{"cursor": {"invalid cursor"}}
 	}
+	return data.Pagination{Limit: p.Limit, Cursor: true, AfterID: afterID}, nil
+}
+
+// encodeCursor returns an opaque cursor for the page of objects after id.
+func encodeCursor(id uid.ID) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id.String()))
+}
 
-	return data.Pagination{
-		Page:  page,
-		Limit: limit,
+func decodeCursor(cursor string) (uid.ID, error) {
+	if cursor == api.PaginationCursorStart {
+		return 0, nil
 	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	return uid.Parse(raw)
 }
 
 // PaginationToResponse translates an internal Pagination type into the pagination
@@ -32,6 +76,16 @@ func PaginationToResponse(p data.Pagination) api.PaginationResponse {
 	if p.Limit == 0 {
 		return api.PaginationResponse{}
 	}
+	if p.Cursor {
+		resp := api.PaginationResponse{Limit: p.Limit}
+		if p.NextAfterID != 0 {
+			resp.NextCursor = encodeCursor(p.NextAfterID)
+		}
+		return resp
+	}
+	if p.SkipTotalCount {
+		return api.PaginationResponse{Page: p.Page, Limit: p.Limit, TotalCount: -1, TotalPages: -1}
+	}
 	return api.PaginationResponse{
 		Page:       p.Page,
 		Limit:      p.Limit,
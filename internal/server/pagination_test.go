@@ -0,0 +1,161 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/validate"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestCursorPaginationFromRequest(t *testing.T) {
+	t.Run("no cursor uses pages", func(t *testing.T) {
+		p, err := CursorPaginationFromRequest(api.PaginationRequest{Page: 2, Limit: 10}, "")
+		assert.NilError(t, err)
+		assert.DeepEqual(t, p, data.Pagination{Page: 2, Limit: 10})
+	})
+	t.Run("start cursor", func(t *testing.T) {
+		p, err := CursorPaginationFromRequest(api.PaginationRequest{}, api.PaginationCursorStart)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, p, data.Pagination{Limit: 100, Cursor: true})
+	})
+	t.Run("next cursor round trip", func(t *testing.T) {
+		resp := PaginationToResponse(data.Pagination{Limit: 10, Cursor: true, NextAfterID: uid.ID(12345)})
+		assert.Equal(t, resp.Limit, 10)
+		assert.Assert(t, resp.NextCursor != "")
+
+		p, err := CursorPaginationFromRequest(api.PaginationRequest{Limit: 10}, resp.NextCursor)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, p, data.Pagination{Limit: 10, Cursor: true, AfterID: uid.ID(12345)})
+	})
+	t.Run("last page has no next cursor", func(t *testing.T) {
+		resp := PaginationToResponse(data.Pagination{Limit: 10, Cursor: true})
+		assert.DeepEqual(t, resp, api.PaginationResponse{Limit: 10})
+	})
+	t.Run("invalid cursor", func(t *testing.T) {
+		_, err := CursorPaginationFromRequest(api.PaginationRequest{}, "not a cursor!")
+		assert.DeepEqual(t, err, validate.Error{"cursor": {"invalid cursor"}})
+	})
+}
+
+func TestPaginationToResponse(t *testing.T) {
+	for _, tc := range []struct {
+		totalCount int
+		totalPages int
+	}{
+		{totalCount: 0, totalPages: 0},
+		{totalCount: 1, totalPages: 1},
+		{totalCount: 99, totalPages: 1},
+		{totalCount: 100, totalPages: 1},
+		{totalCount: 101, totalPages: 2},
+		{totalCount: 300, totalPages: 3},
+	} {
+		resp := PaginationToResponse(data.Pagination{Page: 4, Limit: 100, TotalCount: tc.totalCount})
+		expected := api.PaginationResponse{
+			Page:       4,
+			Limit:      100,
+			TotalCount: tc.totalCount,
+			TotalPages: tc.totalPages,
+		}
+		assert.DeepEqual(t, resp, expected)
+	}
+}
+
+func TestPagination_WithoutTotal(t *testing.T) {
+	withTotal := false
+	p := PaginationFromRequest(api.PaginationRequest{Page: 2, Limit: 10, WithTotal: &withTotal})
+	assert.DeepEqual(t, p, data.Pagination{Page: 2, Limit: 10, SkipTotalCount: true})
+
+	resp := PaginationToResponse(p)
+	expected := api.PaginationResponse{Page: 2, Limit: 10, TotalCount: -1, TotalPages: -1}
+	assert.DeepEqual(t, resp, expected)
+
+	t.Run("with total", func(t *testing.T) {
+		withTotal := true
+		p := PaginationFromRequest(api.PaginationRequest{Page: 2, Limit: 10, WithTotal: &withTotal})
+		assert.DeepEqual(t, p, data.Pagination{Page: 2, Limit: 10})
+	})
+}
+
+func TestAPI_PaginationLimits(t *testing.T) {
+	type testCase struct {
+		name          string
+		maxLimit      int
+		query         string
+		expectedLimit int
+		expectedErr   []api.FieldError
+	}
+
+	run := func(t *testing.T, path string, tc testCase) {
+		srv := setupServer(t, withAdminUser, func(t *testing.T, options *Options) {
+			options.API.MaxPaginationLimit = tc.maxLimit
+		})
+		routes := srv.GenerateRoutes()
+
+		req := httptest.NewRequest(http.MethodGet, path+tc.query, nil)
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+
+		if tc.expectedErr != nil {
+			assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+			var respBody api.Error
+			assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &respBody))
+			assert.DeepEqual(t, respBody.FieldErrors, tc.expectedErr)
+			return
+		}
+
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		var respBody api.PaginationResponse
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &respBody))
+		assert.Equal(t, respBody.Limit, tc.expectedLimit)
+	}
+
+	testCases := []testCase{
+		{name: "default limit", query: "", expectedLimit: 100},
+		{name: "zero uses the default limit", query: "?limit=0", expectedLimit: 100},
+		{name: "limit of one", query: "?limit=1", expectedLimit: 1},
+		{name: "default max", query: "?limit=1000", expectedLimit: 1000},
+		{
+			name:  "above default max",
+			query: "?limit=1001",
+			expectedErr: []api.FieldError{
+				{FieldName: "limit", ErrorCode: api.ErrorCodeInvalid, Errors: []string{"value 1001 must be at most 1000"}},
+			},
+		},
+		{
+			name:  "negative limit",
+			query: "?limit=-1",
+			expectedErr: []api.FieldError{
+				{FieldName: "limit", ErrorCode: api.ErrorCodeInvalid, Errors: []string{"value -1 must be at least 0"}},
+			},
+		},
+		{name: "configured max", maxLimit: 50, query: "?limit=50", expectedLimit: 50},
+		{
+			name:     "above configured max",
+			maxLimit: 50,
+			query:    "?limit=51",
+			expectedErr: []api.FieldError{
+				{FieldName: "limit", ErrorCode: api.ErrorCodeInvalid, Errors: []string{"value 51 must be at most 50"}},
+			},
+		},
+		{name: "configured max above the default", maxLimit: 5000, query: "?limit=5000", expectedLimit: 5000},
+	}
+
+	for _, path := range []string{"/api/users", "/api/groups"} {
+		t.Run(path, func(t *testing.T) {
+			for _, tc := range testCases {
+				t.Run(tc.name, func(t *testing.T) {
+					run(t, path, tc)
+				})
+			}
+		})
+	}
+}
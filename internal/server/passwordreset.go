@@ -3,7 +3,6 @@ package server
 import (
 	"errors"
 	"fmt"
-	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -15,6 +14,9 @@ import (
 	"github.com/infrahq/infra/internal/server/redis"
 )
 
+// RequestPasswordReset sends an email with a link to reset the password of
+// the user. The response is the same whether or not the user exists, or has a
+// password, so that it can not be used to find which users exist.
 func (a *API) RequestPasswordReset(c *gin.Context, r *api.PasswordResetRequest) (*api.EmptyResponse, error) {
 	rCtx := getRequestContext(c)
 	// no authorization required
@@ -31,21 +33,25 @@ func (a *API) RequestPasswordReset(c *gin.Context, r *api.PasswordResetRequest)
 	}
 
 	_, err = data.GetCredentialByUserID(rCtx.DBTxn, user.ID)
-	if err != nil {
-		// if credential is not found, the user cannot reset their password.
+	switch {
+	case errors.Is(err, internal.ErrNotFound):
+		// the user cannot reset their password, because they do not have one
+		return nil, nil
+	case err != nil:
 		return nil, err
 	}
 
-	token, err := data.CreatePasswordResetToken(rCtx.DBTxn, user.ID, 15*time.Minute)
+	token, err := data.CreatePasswordResetToken(rCtx.DBTxn, user.ID, a.server.options.OneTimePasswords.resetExpiry())
 	if err != nil {
 		return nil, err
 	}
 
 	org := rCtx.Authenticated.Organization
-	err = email.SendPasswordResetEmail("", r.Email, email.PasswordResetData{
-		Link: wrapLinkWithVerification(fmt.Sprintf("https://%s/password-reset?token=%s", org.Domain, token), org.Domain, user.VerificationToken),
+	link := wrapLinkWithVerification(fmt.Sprintf("https://%s/password-reset?token=%s", org.Domain, token), org.Domain, user.VerificationToken)
+	a.sendEmailAfterCommit(c, func() error {
+		return email.SendPasswordResetEmail("", r.Email, email.PasswordResetData{Link: link})
 	})
-	return nil, err
+	return nil, nil
 }
 
 func (a *API) VerifiedPasswordReset(c *gin.Context, r *api.VerifiedResetPasswordRequest) (*api.LoginResponse, error) {
@@ -54,10 +60,12 @@ func (a *API) VerifiedPasswordReset(c *gin.Context, r *api.VerifiedResetPassword
 		return nil, err
 	}
 
-	return a.Login(c, &api.LoginRequest{
+	// the new password is not committed yet, so the login must use the
+	// request transaction.
+	return a.login(c, &api.LoginRequest{
 		PasswordCredentials: &api.LoginRequestPasswordCredentials{
 			Name:     user.Name,
 			Password: r.Password,
 		},
-	})
+	}, false)
 }
@@ -50,6 +50,7 @@ func TestPasswordResetFlow(t *testing.T) {
 	routes.ServeHTTP(resp, req)
 
 	assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+	s.backgroundEmails.Wait()
 	assert.Assert(t, len(email.TestDataSent) > 0)
 
 	// cheat and grab the token from the db.
@@ -110,3 +111,43 @@ func TestPasswordResetFlow(t *testing.T) {
 		assert.Equal(t, http.StatusNotFound, resp.Code, (*responseDebug)(resp))
 	})
 }
+
+func TestAPI_RequestPasswordReset_SameResponse(t *testing.T) {
+	srv := setupServer(t)
+	routes := srv.GenerateRoutes()
+
+	email.TestMode = true
+	t.Cleanup(func() {
+		email.TestDataSent = []any{}
+	})
+
+	createPasswordUser(t, srv, "has-password@example.com", "password")
+	createIdentities(t, srv.DB(), &models.Identity{Name: "no-password@example.com"})
+
+	request := func(t *testing.T, address string) *httptest.ResponseRecorder {
+		t.Helper()
+		body := jsonBody(t, api.PasswordResetRequest{Email: address})
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodPost, "/api/password-reset-request", body)
+		req.Header.Add("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		srv.backgroundEmails.Wait()
+		return resp
+	}
+
+	email.TestDataSent = []any{}
+	expected := request(t, "has-password@example.com")
+	assert.Equal(t, expected.Code, http.StatusCreated, (*responseDebug)(expected))
+	assert.Equal(t, len(email.TestDataSent), 1)
+
+	for _, address := range []string{"unknown@example.com", "no-password@example.com"} {
+		t.Run(address, func(t *testing.T) {
+			email.TestDataSent = []any{}
+			resp := request(t, address)
+			assert.Equal(t, resp.Code, expected.Code, (*responseDebug)(resp))
+			assert.Equal(t, resp.Body.String(), expected.Body.String())
+			assert.Equal(t, len(email.TestDataSent), 0)
+		})
+	}
+}
@@ -11,12 +11,47 @@ import (
 	"golang.org/x/oauth2"
 
 	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/lru"
 	"github.com/infrahq/infra/internal/server/models"
 	"github.com/infrahq/infra/internal/validate"
 )
 
 const oidcProviderRequestTimeout = time.Second * 30
 
+// oidcProviders caches the oidc.Provider of each issuer, which holds the
+// discovery document and the signing keys (JWKS) of the identity provider, so
+// that they are not fetched for every login. The keys are fetched again when a
+// token is signed by a key that is not cached, and the discovery document when
+// the entry expires or is evicted.
+var oidcProviders = lru.New[string, *oidc.Provider](lru.Options{
+	Name:       "oidc-providers",
+	MaxEntries: 1000,
+	MaxAge:     time.Hour,
+})
+
+// OIDCProviderCache returns the cache of the discovery documents and signing
+// keys of the OIDC identity providers, so that the server can report its
+// metrics.
+func OIDCProviderCache() *lru.Cache[string, *oidc.Provider] {
+	return oidcProviders
+}
+
+// oidcProvider returns the provider for the issuer at domain, from the cache or
+// from the discovery document of the issuer. The provider only keeps the HTTP
+// client of ctx, so it can be used after ctx is done.
+func oidcProvider(ctx context.Context, domain string) (*oidc.Provider, error) {
+	issuer := fmt.Sprintf("https://%s", domain)
+	if provider, ok := oidcProviders.Get(issuer); ok {
+		return provider, nil
+	}
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+	oidcProviders.Add(issuer, provider)
+	return provider, nil
+}
+
 // UserInfoClaims captures the claims fields from a user-info response that we care about
 type UserInfoClaims struct {
 	Email  string   `json:"email"` // returned by default for Okta user info
@@ -131,7 +166,7 @@ func (o *oidcClientImplementation) AuthServerInfo(ctx context.Context) (*AuthSer
 	ctx, cancel := context.WithTimeout(ctx, oidcProviderRequestTimeout)
 	defer cancel()
 	// find out what the authorization endpoint is
-	provider, err := oidc.NewProvider(ctx, fmt.Sprintf("https://%s", o.Domain))
+	provider, err := oidcProvider(ctx, o.Domain)
 	if err != nil {
 		return nil, fmt.Errorf("get provider oidc info: %w", err)
 	}
@@ -167,7 +202,7 @@ func (o *oidcClientImplementation) AuthServerInfo(ctx context.Context) (*AuthSer
 
 // clientConfig returns the OAuth client configuration needed to interact with an identity provider
 func (o *oidcClientImplementation) clientConfig(ctx context.Context) (*oauth2.Config, *oidc.Provider, error) {
-	provider, err := oidc.NewProvider(ctx, fmt.Sprintf("https://%s", o.Domain))
+	provider, err := oidcProvider(ctx, o.Domain)
 	if err != nil {
 		return nil, nil, fmt.Errorf("get provider openid info: %w", err)
 	}
@@ -13,6 +13,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -635,3 +636,48 @@ func TestOIDC_GetUserInfo(t *testing.T) {
 		})
 	}
 }
+
+type countingTransport struct {
+	transport http.RoundTripper
+	mu        sync.Mutex
+	requests  map[string]int
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	c.requests[req.URL.Path]++
+	c.mu.Unlock()
+	return c.transport.RoundTrip(req)
+}
+
+func (c *countingTransport) count(path string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.requests[path]
+}
+
+func TestOIDCProviderCache(t *testing.T) {
+	server, ctx := setupOIDCTest(t, "")
+	serverURL := server.run(t, nil)
+
+	client, ok := ctx.Value(oauth2.HTTPClient).(*http.Client)
+	assert.Assert(t, ok)
+	transport := &countingTransport{transport: client.Transport, requests: map[string]int{}}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: transport})
+
+	provider := NewOIDCClient(models.Provider{Kind: models.ProviderKindOIDC, URL: serverURL, ClientID: "client-id"}, "some_client_secret", "https://example.com/callback")
+
+	_, err := provider.AuthServerInfo(ctx)
+	assert.NilError(t, err)
+	_, err = provider.AuthServerInfo(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, transport.count("/.well-known/openid-configuration"), 1)
+
+	t.Run("evicted provider is fetched again", func(t *testing.T) {
+		OIDCProviderCache().Remove("https://" + serverURL)
+
+		_, err := provider.AuthServerInfo(ctx)
+		assert.NilError(t, err)
+		assert.Equal(t, transport.count("/.well-known/openid-configuration"), 2)
+	})
+}
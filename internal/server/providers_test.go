@@ -309,9 +309,9 @@ func TestAPI_CreateProvider(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{FieldName: "clientID", Errors: []string{"is required"}},
-					{FieldName: "clientSecret", Errors: []string{"is required"}},
-					{FieldName: "url", Errors: []string{"is required"}},
+					{FieldName: "clientID", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
+					{FieldName: "clientSecret", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
+					{FieldName: "url", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
 			},
@@ -341,8 +341,8 @@ func TestAPI_CreateProvider(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{FieldName: "api.clientEmail", Errors: []string{"invalid email address"}},
-					{FieldName: "api.domainAdminEmail", Errors: []string{"invalid email address"}},
+					{FieldName: "api.clientEmail", ErrorCode: api.ErrorCodeInvalid, Errors: []string{"invalid email address"}},
+					{FieldName: "api.domainAdminEmail", ErrorCode: api.ErrorCodeInvalid, Errors: []string{"invalid email address"}},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
 			},
@@ -364,7 +364,7 @@ func TestAPI_CreateProvider(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{FieldName: "kind", Errors: []string{"must be one of (oidc, okta, azure, google)"}},
+					{FieldName: "kind", ErrorCode: api.ErrorCodeInvalid, Errors: []string{"must be one of (oidc, okta, azure, google)"}},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
 			},
@@ -573,10 +573,10 @@ func TestAPI_UpdateProvider(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{FieldName: "clientID", Errors: []string{"is required"}},
-					{FieldName: "clientSecret", Errors: []string{"is required"}},
-					{FieldName: "name", Errors: []string{"is required"}},
-					{FieldName: "url", Errors: []string{"is required"}},
+					{FieldName: "clientID", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
+					{FieldName: "clientSecret", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
+					{FieldName: "name", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
+					{FieldName: "url", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
 			},
@@ -598,7 +598,7 @@ func TestAPI_UpdateProvider(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{FieldName: "kind", Errors: []string{"must be one of (oidc, okta, azure, google)"}},
+					{FieldName: "kind", ErrorCode: api.ErrorCodeInvalid, Errors: []string{"must be one of (oidc, okta, azure, google)"}},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
 			},
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/uid"
+)
+
+const (
+	purgeInterval          = 24 * time.Hour
+	defaultPurgeBatchSize  = 1000
+	defaultPurgeBatchDelay = 100 * time.Millisecond
+
+	// defaultAuditEventRetention is used when neither the organization nor
+	// the server options set a retention period for audit events.
+	defaultAuditEventRetention = 365 * 24 * time.Hour
+)
+
+var purgedRowsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "infra",
+	Subsystem: "db",
+	Name:      "purged_rows_total",
+	Help:      "The number of soft deleted rows and expired audit events that were permanently deleted",
+}, []string{"table"})
+
+func (s *Server) registerPurgeJob(ctx context.Context) {
+	s.routines = append(s.routines, routine{
+		run: func() error {
+			t := time.NewTicker(purgeInterval)
+			defer t.Stop()
+			for {
+				select {
+				case <-t.C:
+					purgeSoftDeleted(ctx, s.db, s.options.Purge)
+					purgeAuditEvents(ctx, s.db, s.options.Purge, s.options.Audit)
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		},
+		stop: func() {}, // uses the context to stop
+	})
+}
+
+// purgeSoftDeleted permanently deletes the rows of each table that were soft
+// deleted before the retention period of the table. Rows are deleted in
+// batches, and each batch is committed before the next, so that locks are not
+// held on a large number of rows. purgeSoftDeleted returns the number of rows
+// deleted from each table.
+func purgeSoftDeleted(ctx context.Context, db *data.DB, opts PurgeOptions) map[string]int64 {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultPurgeBatchSize
+	}
+	delay := opts.BatchDelay
+	if delay <= 0 {
+		delay = defaultPurgeBatchDelay
+	}
+
+	result := make(map[string]int64)
+	for _, table := range data.PurgeTables() {
+		retention := table.Retention
+		if r, ok := opts.Retention[table.Name]; ok {
+			retention = r
+		}
+		olderThan := time.Now().Add(-retention)
+
+		total, err := purgeInBatches(ctx, db, batchSize, delay, func(tx data.WriteTxn) (int64, error) {
+			return data.PurgeSoftDeleted(tx, table.Name, olderThan, batchSize)
+		})
+		if err != nil {
+			logging.L.Error().Err(err).Str("table", table.Name).Msg("failed to purge soft deleted rows")
+		}
+
+		result[table.Name] = total
+		purgedRowsCounter.WithLabelValues(table.Name).Add(float64(total))
+		logging.L.Info().
+			Str("table", table.Name).
+			Int64("count", total).
+			Dur("retention", retention).
+			Msg("purged soft deleted rows")
+	}
+	return result
+}
+
+// purgeAuditEvents permanently deletes the audit events that are older than
+// the retention period of their organization. An organization without a
+// retention period in its settings uses the retention from opts.
+// purgeAuditEvents returns the number of events deleted.
+func purgeAuditEvents(ctx context.Context, db *data.DB, purge PurgeOptions, opts AuditOptions) int64 {
+	batchSize := purge.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultPurgeBatchSize
+	}
+	delay := purge.BatchDelay
+	if delay <= 0 {
+		delay = defaultPurgeBatchDelay
+	}
+	defaultRetention := opts.Retention
+	if defaultRetention <= 0 {
+		defaultRetention = defaultAuditEventRetention
+	}
+
+	retentions, err := data.ListAuditEventRetentions(db)
+	if err != nil {
+		logging.L.Error().Err(err).Msg("failed to list audit event retention")
+		return 0
+	}
+
+	// the organizations with their own retention are purged one at a time,
+	// then all the others are purged together.
+	var total int64
+	orgIDs := make([]uid.ID, 0, len(retentions))
+	for orgID, retention := range retentions {
+		orgIDs = append(orgIDs, orgID)
+		purgeOpts := data.PurgeAuditEventsOptions{
+			ByOrganizationID: orgID,
+			OlderThan:        time.Now().Add(-retention),
+			Limit:            batchSize,
+		}
+		count, err := purgeInBatches(ctx, db, batchSize, delay, func(tx data.WriteTxn) (int64, error) {
+			return data.PurgeAuditEvents(tx, purgeOpts)
+		})
+		total += count
+		if err != nil {
+			logging.L.Error().Err(err).Str("org", orgID.String()).Msg("failed to purge audit events")
+		}
+	}
+
+	purgeOpts := data.PurgeAuditEventsOptions{
+		NotOrganizationIDs: orgIDs,
+		OlderThan:          time.Now().Add(-defaultRetention),
+		Limit:              batchSize,
+	}
+	count, err := purgeInBatches(ctx, db, batchSize, delay, func(tx data.WriteTxn) (int64, error) {
+		return data.PurgeAuditEvents(tx, purgeOpts)
+	})
+	total += count
+	if err != nil {
+		logging.L.Error().Err(err).Msg("failed to purge audit events")
+	}
+
+	purgedRowsCounter.WithLabelValues("audit_events").Add(float64(total))
+	logging.L.Info().
+		Int64("count", total).
+		Dur("retention", defaultRetention).
+		Msg("purged audit events")
+	return total
+}
+
+// purgeInBatches calls purge, each time in a new transaction, until purge
+// deletes fewer than batchSize rows, and returns the total number of rows
+// deleted. It waits for delay between batches.
+func purgeInBatches(ctx context.Context, db *data.DB, batchSize int, delay time.Duration, purge func(tx data.WriteTxn) (int64, error)) (int64, error) {
+	var total int64
+	for ctx.Err() == nil {
+		count, err := purgeBatch(ctx, db, purge)
+		total += count
+		if err != nil {
+			return total, err
+		}
+		if count < int64(batchSize) {
+			break
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+	return total, nil
+}
+
+func purgeBatch(ctx context.Context, db *data.DB, purge func(tx data.WriteTxn) (int64, error)) (int64, error) {
+	tx, err := db.Begin(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer logError(tx.Rollback, "failed to rollback purge transaction")
+
+	count, err := purge(tx)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestPurgeSoftDeleted(t *testing.T) {
+	db := setupDB(t)
+
+	var groups []*models.Group
+	for i := 0; i < 5; i++ {
+		group := &models.Group{Name: "group" + string(rune('a'+i))}
+		assert.NilError(t, data.CreateGroup(db, group))
+		groups = append(groups, group)
+	}
+	grant := &models.Grant{Subject: uid.NewGroupPolymorphicID(groups[0].ID), Privilege: "view", Resource: "any"}
+	assert.NilError(t, data.CreateGrant(db, grant))
+
+	softDelete := func(table string, id uid.ID, deletedAt time.Time) {
+		t.Helper()
+		_, err := db.Exec("UPDATE "+table+" SET deleted_at = ? WHERE id = ?", deletedAt, id)
+		assert.NilError(t, err)
+	}
+	// four groups were deleted long ago, and one group is still active
+	for _, group := range groups[:4] {
+		softDelete("groups", group.ID, time.Now().Add(-100*24*time.Hour))
+	}
+	// the grant was deleted recently
+	softDelete("grants", grant.ID, time.Now().Add(-2*time.Hour))
+
+	before := testutil.ToFloat64(purgedRowsCounter.WithLabelValues("groups"))
+	result := purgeSoftDeleted(context.Background(), db, PurgeOptions{
+		Retention:  map[string]time.Duration{"grants": time.Hour},
+		BatchSize:  3,
+		BatchDelay: time.Millisecond,
+	})
+	assert.Equal(t, result["groups"], int64(4))
+	assert.Equal(t, result["grants"], int64(1))
+	assert.Equal(t, result["identities"], int64(0))
+	assert.Equal(t, testutil.ToFloat64(purgedRowsCounter.WithLabelValues("groups"))-before, float64(4))
+
+	_, err := data.GetGroup(db, data.GetGroupOptions{ByID: groups[4].ID})
+	assert.NilError(t, err)
+}
+
+func TestPurgeAuditEvents(t *testing.T) {
+	db := setupDB(t)
+	day := 24 * time.Hour
+
+	otherOrg := &models.Organization{Name: "other", Domain: "other.example.com"}
+	assert.NilError(t, data.CreateOrganization(db, otherOrg))
+
+	now := time.Now()
+	for _, orgID := range []uid.ID{db.DefaultOrg.ID, otherOrg.ID} {
+		tx := txnForTestCase(t, db, orgID)
+		for _, age := range []time.Duration{time.Hour, 10 * day, 40 * day, 400 * day} {
+			event := &models.AuditEvent{CreatedAt: now.Add(-age), Action: "login", Result: models.AuditResultSuccess}
+			assert.NilError(t, data.CreateAuditEvent(tx, event))
+		}
+		assert.NilError(t, tx.Commit())
+	}
+
+	// the other org keeps events for a shorter period than the server default
+	tx := txnForTestCase(t, db, otherOrg.ID)
+	assert.NilError(t, data.UpdateOrgSettings(tx, &models.OrgSettings{AuditEventRetention: 7 * day}))
+	assert.NilError(t, tx.Commit())
+
+	before := testutil.ToFloat64(purgedRowsCounter.WithLabelValues("audit_events"))
+	count := purgeAuditEvents(context.Background(), db,
+		PurgeOptions{BatchSize: 1, BatchDelay: time.Millisecond},
+		AuditOptions{Retention: 30 * day})
+	assert.Equal(t, count, int64(5))
+	assert.Equal(t, testutil.ToFloat64(purgedRowsCounter.WithLabelValues("audit_events"))-before, float64(5))
+
+	remaining := func(orgID uid.ID) int {
+		t.Helper()
+		events, err := data.ListAuditEvents(txnForTestCase(t, db, orgID), data.ListAuditEventsOptions{})
+		assert.NilError(t, err)
+		return len(events)
+	}
+	assert.Equal(t, remaining(db.DefaultOrg.ID), 2)
+	assert.Equal(t, remaining(otherOrg.ID), 1)
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/internal/access"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/internal/server/redis"
+)
+
+// rateLimiter limits the number of requests per minute for a key.
+// memoryRateLimiter is used when the server is not configured with redis.
+// redis.Limiter stores the counts in redis, so that the limit is shared by
+// all the replicas of the server.
+type rateLimiter interface {
+	// Allow records a request for key, and returns the number of requests that
+	// remain in the limit. If the limit has been reached, Allow returns a
+	// redis.OverLimitError.
+	Allow(key string, limit int) (remaining int, err error)
+}
+
+// memoryRateLimiter is a token bucket rate limiter. Each key has a bucket that
+// holds up to limit tokens, and is refilled at a rate of limit tokens per
+// minute. A bucket that was not used for a minute is full again, so it is
+// removed. A bucket that has spent tokens is never removed, because that would
+// reset the limit of its key.
+type memoryRateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	// maxBuckets is the maximum number of buckets, or zero for no maximum.
+	// When the limiter is full requests for new keys are refused until idle
+	// buckets are removed. A maximum is required when the keys are chosen by
+	// an unauthenticated caller (ex: the client address).
+	maxBuckets int
+	// swept is the last time idle buckets were removed.
+	swept time.Time
+	now   func() time.Time
+}
+
+// maxAddressRateLimitBuckets is the maximum number of buckets in the limiter
+// of the requests from each client address. A bucket uses less than 100
+// bytes, so a full limiter uses a few MB.
+const maxAddressRateLimitBuckets = 50_000
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// newMemoryRateLimiter returns a memoryRateLimiter that holds at most
+// maxBuckets buckets. Zero means no maximum, which must only be used when the
+// keys are bounded (ex: one or two for each organization or user).
+func newMemoryRateLimiter(maxBuckets int) *memoryRateLimiter {
+	return &memoryRateLimiter{
+		buckets:    map[string]*tokenBucket{},
+		maxBuckets: maxBuckets,
+		now:        time.Now,
+	}
+}
+
+func (m *memoryRateLimiter) Allow(key string, limit int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.removeIdleBuckets(now)
+
+	bucket, ok := m.buckets[key]
+	if !ok {
+		if m.maxBuckets > 0 && len(m.buckets) >= m.maxBuckets {
+			// the limiter is full of buckets used in the last minute, refuse
+			// the new key until the idle buckets are removed
+			return 0, redis.OverLimitError{RetryAfter: m.swept.Add(time.Minute).Sub(now)}
+		}
+		bucket = &tokenBucket{tokens: float64(limit), updated: now}
+		m.buckets[key] = bucket
+	}
+
+	bucket.refill(now, limit)
+	if err := bucket.checkEmpty(limit); err != nil {
+		return 0, err
+	}
+	bucket.tokens--
+	return int(bucket.tokens), nil
+}
+
+// Check returns a redis.OverLimitError if the limit of key has been reached,
+// like Allow, but does not record a request.
+func (m *memoryRateLimiter) Check(key string, limit int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bucket, ok := m.buckets[key]
+	if !ok {
+		return nil
+	}
+	bucket.refill(m.now(), limit)
+	return bucket.checkEmpty(limit)
+}
+
+// refill adds the tokens for the time since the bucket was last updated.
+func (b *tokenBucket) refill(now time.Time, limit int) {
+	refill := float64(now.Sub(b.updated)) * float64(limit) / float64(time.Minute)
+	b.tokens = math.Min(float64(limit), b.tokens+refill)
+	b.updated = now
+}
+
+// checkEmpty returns a redis.OverLimitError if the bucket does not have a
+// token for another request.
+func (b *tokenBucket) checkEmpty(limit int) error {
+	if b.tokens >= 1 {
+		return nil
+	}
+	retryAfter := time.Duration(math.Round((1 - b.tokens) * float64(time.Minute) / float64(limit)))
+	return redis.OverLimitError{RetryAfter: retryAfter}
+}
+
+// removeIdleBuckets removes the buckets that have not been used for a minute.
+// The buckets are checked at most once a minute, so that Allow does not scan
+// every bucket on each request. The caller must hold the lock.
+func (m *memoryRateLimiter) removeIdleBuckets(now time.Time) {
+	if now.Sub(m.swept) < time.Minute {
+		return
+	}
+	m.swept = now
+	for key, bucket := range m.buckets {
+		if now.Sub(bucket.updated) >= time.Minute {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// applyRateLimit counts the request against the rate limit of org, and sets
+// the X-RateLimit-Limit and X-RateLimit-Remaining response headers. Requests
+// from connectors are counted separately from all other requests, so that
+// destination updates are not throttled by other traffic to the organization.
+func applyRateLimit(c *gin.Context, tx *data.Transaction, srv *Server, authned access.Authenticated, org *models.Organization) error {
+	settings, err := srv.orgSettings(tx.WithOrgID(org.ID))
+	if err != nil {
+		return err
+	}
+
+	limit, key := settings.RateLimit, org.ID.String()
+	if authned.User != nil && authned.User.Name == models.InternalInfraConnectorIdentityName {
+		limit, key = settings.ConnectorRateLimit, org.ID.String()+":connector"
+	}
+	if limit <= 0 {
+		return nil
+	}
+
+	remaining, err := srv.rateLimiter.Allow(key, limit)
+	c.Header("X-RateLimit-Limit", strconv.Itoa(limit))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	return err
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/internal/server/redis"
+)
+
+func TestMemoryRateLimiter(t *testing.T) {
+	now := time.Date(2022, 12, 21, 10, 0, 0, 0, time.UTC)
+	limiter := newMemoryRateLimiter(0)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		remaining, err := limiter.Allow("org", 3)
+		assert.NilError(t, err)
+		assert.Equal(t, remaining, 2-i)
+	}
+
+	_, err := limiter.Allow("org", 3)
+	assert.DeepEqual(t, err, redis.OverLimitError{RetryAfter: 20 * time.Second})
+
+	t.Run("other keys have their own limit", func(t *testing.T) {
+		remaining, err := limiter.Allow("org:connector", 3)
+		assert.NilError(t, err)
+		assert.Equal(t, remaining, 2)
+	})
+
+	t.Run("tokens are refilled over time", func(t *testing.T) {
+		now = now.Add(5 * time.Second)
+		_, err := limiter.Allow("org", 3)
+		assert.DeepEqual(t, err, redis.OverLimitError{RetryAfter: 15 * time.Second})
+
+		now = now.Add(15 * time.Second)
+		remaining, err := limiter.Allow("org", 3)
+		assert.NilError(t, err)
+		assert.Equal(t, remaining, 0)
+	})
+
+	t.Run("bucket never holds more than limit", func(t *testing.T) {
+		now = now.Add(time.Hour)
+		remaining, err := limiter.Allow("org", 3)
+		assert.NilError(t, err)
+		assert.Equal(t, remaining, 2)
+	})
+}
+
+func TestMemoryRateLimiter_RemovesIdleBuckets(t *testing.T) {
+	now := time.Date(2022, 12, 21, 10, 0, 0, 0, time.UTC)
+	limiter := newMemoryRateLimiter(0)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		_, err := limiter.Allow(mfaRateLimitKey(fmt.Sprintf("user-%d", i)), 3)
+		assert.NilError(t, err)
+	}
+	assert.Equal(t, len(limiter.buckets), 3)
+
+	now = now.Add(30 * time.Second)
+	_, err := limiter.Allow(mfaRateLimitKey("user-0"), 3)
+	assert.NilError(t, err)
+	assert.Equal(t, len(limiter.buckets), 3)
+
+	// user-1 and user-2 have been idle for a minute, and their buckets are full
+	now = now.Add(40 * time.Second)
+	_, err = limiter.Allow(mfaRateLimitKey("user-3"), 3)
+	assert.NilError(t, err)
+	assert.Equal(t, len(limiter.buckets), 2)
+	_, ok := limiter.buckets[mfaRateLimitKey("user-0")]
+	assert.Assert(t, ok, "bucket of user-0 was used recently")
+}
+
+func TestMemoryRateLimiter_MaxBuckets(t *testing.T) {
+	now := time.Date(2022, 12, 21, 10, 0, 0, 0, time.UTC)
+	limiter := newMemoryRateLimiter(3)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		_, err := limiter.Allow(fmt.Sprintf("verify:192.0.2.%d", i), verifyRateLimit)
+		assert.NilError(t, err)
+	}
+
+	// new keys are refused while the limiter is full
+	now = now.Add(20 * time.Second)
+	_, err := limiter.Allow("verify:192.0.2.3", verifyRateLimit)
+	assert.DeepEqual(t, err, redis.OverLimitError{RetryAfter: 40 * time.Second})
+	assert.Equal(t, len(limiter.buckets), 3)
+
+	// existing keys are still counted
+	remaining, err := limiter.Allow("verify:192.0.2.0", verifyRateLimit)
+	assert.NilError(t, err)
+	assert.Equal(t, remaining, verifyRateLimit-1)
+
+	// the idle buckets are removed after a minute, which makes room for new keys
+	now = now.Add(45 * time.Second)
+	_, err = limiter.Allow("verify:192.0.2.3", verifyRateLimit)
+	assert.NilError(t, err)
+	assert.Equal(t, len(limiter.buckets), 2)
+}
+
+func TestAPI_RateLimit_MFABucketSurvivesAddressFlood(t *testing.T) {
+	srv := setupServer(t)
+	srv.addressRateLimiter = newMemoryRateLimiter(3)
+	routes := srv.GenerateRoutes()
+
+	// spend the TOTP attempts of a user
+	mfaKey := mfaRateLimitKey("1234")
+	for i := 0; i < mfaRateLimit; i++ {
+		_, err := srv.rateLimiter.Allow(mfaKey, mfaRateLimit)
+		assert.NilError(t, err)
+	}
+
+	url := wrapLinkWithVerification("https://example.com/hello", "example.com", "not-a-token")
+	var refused int
+	for i := 0; i < 20; i++ {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.RemoteAddr = fmt.Sprintf("[2001:db8::%x]:4000", i)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		if resp.Code == http.StatusTooManyRequests {
+			refused++
+		}
+	}
+	assert.Equal(t, refused, 17)
+
+	_, err := srv.rateLimiter.Allow(mfaKey, mfaRateLimit)
+	assert.ErrorType(t, err, redis.OverLimitError{})
+}
+
+func TestAPI_RateLimit(t *testing.T) {
+	srv := setupServer(t, withAdminUser, func(_ *testing.T, opts *Options) {
+		opts.API.RateLimit = 3
+		opts.API.ConnectorRateLimit = 5
+	})
+	now := time.Now()
+	limiter := newMemoryRateLimiter(0)
+	limiter.now = func() time.Time { return now }
+	srv.rateLimiter = limiter
+	routes := srv.GenerateRoutes()
+
+	tx := txnForTestCase(t, srv.db, srv.db.DefaultOrg.ID)
+	connectorKey, err := data.CreateAccessKey(tx, &models.AccessKey{
+		IssuedFor:  data.InfraConnectorIdentity(tx).ID,
+		ExpiresAt:  time.Now().Add(time.Hour),
+		ProviderID: data.InfraProvider(tx).ID,
+	})
+	assert.NilError(t, err)
+	assert.NilError(t, tx.Commit())
+
+	getSettings := func(t *testing.T, key string) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodGet, "/api/settings", nil)
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		req.Header.Set("Authorization", "Bearer "+key)
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	adminKey := adminAccessKey(srv)
+	for _, remaining := range []string{"2", "1", "0"} {
+		resp := getSettings(t, adminKey)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		assert.Equal(t, resp.Header().Get("X-RateLimit-Limit"), "3")
+		assert.Equal(t, resp.Header().Get("X-RateLimit-Remaining"), remaining)
+	}
+
+	resp := getSettings(t, adminKey)
+	assert.Equal(t, resp.Code, http.StatusTooManyRequests, resp.Body.String())
+	assert.Equal(t, resp.Header().Get("X-RateLimit-Limit"), "3")
+	assert.Equal(t, resp.Header().Get("X-RateLimit-Remaining"), "0")
+	assert.Equal(t, resp.Header().Get("Retry-After"), "20")
+
+	t.Run("connectors have a separate limit", func(t *testing.T) {
+		resp := getSettings(t, connectorKey)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		assert.Equal(t, resp.Header().Get("X-RateLimit-Limit"), "5")
+		assert.Equal(t, resp.Header().Get("X-RateLimit-Remaining"), "4")
+	})
+
+	t.Run("recovers after retry after", func(t *testing.T) {
+		now = now.Add(20 * time.Second)
+		resp := getSettings(t, adminKey)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		assert.Equal(t, resp.Header().Get("X-RateLimit-Remaining"), "0")
+	})
+
+	t.Run("limit from organization settings", func(t *testing.T) {
+		tx := txnForTestCase(t, srv.db, srv.db.DefaultOrg.ID)
+		err := data.UpdateOrgSettings(tx, &models.OrgSettings{RateLimit: 10})
+		assert.NilError(t, err)
+		assert.NilError(t, tx.Commit())
+
+		now = now.Add(time.Minute)
+		resp := getSettings(t, adminKey)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		assert.Equal(t, resp.Header().Get("X-RateLimit-Limit"), "10")
+	})
+}
@@ -2,28 +2,46 @@ package server
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal"
 	"github.com/infrahq/infra/internal/logging"
 	"github.com/infrahq/infra/internal/server/data"
 )
 
-var verifyAndRedirectRoute = route[api.VerifyAndRedirectRequest, *api.RedirectResponse]{
-	handler: VerifyAndRedirect,
-	routeSettings: routeSettings{
-		omitFromDocs:               true,
-		omitFromTelemetry:          true,
-		infraVersionHeaderOptional: true,
-	},
+// verifyRateLimit is the number of verification links that can be followed
+// from one address per minute. A verification token does not identify the
+// user, so attempts to guess a token are limited by address instead.
+const verifyRateLimit = 5
+
+func (a *API) verifyAndRedirectRoute() route[api.VerifyAndRedirectRequest, *api.RedirectResponse] {
+	return route[api.VerifyAndRedirectRequest, *api.RedirectResponse]{
+		handler: a.VerifyAndRedirect,
+		routeSettings: routeSettings{
+			omitFromDocs:               true,
+			omitFromTelemetry:          true,
+			infraVersionHeaderOptional: true,
+		},
+	}
 }
 
-func VerifyAndRedirect(c *gin.Context, r *api.VerifyAndRedirectRequest) (*api.RedirectResponse, error) {
+func (a *API) VerifyAndRedirect(c *gin.Context, r *api.VerifyAndRedirectRequest) (*api.RedirectResponse, error) {
 	// No authorization required
 	rCtx := getRequestContext(c)
-	if err := data.SetIdentityVerified(rCtx.DBTxn, r.VerificationToken); err != nil {
+	key := "verify:" + logging.ClientIP(c.Request.Context())
+	if _, err := a.server.addressRateLimiter.Allow(key, verifyRateLimit); err != nil {
+		return nil, err
+	}
+
+	err := data.SetIdentityVerified(rCtx.DBTxn, r.VerificationToken)
+	switch {
+	case errors.Is(err, internal.ErrNotFound):
+		// the token is wrong, or was already used. The user is still redirected.
+	case err != nil:
 		logging.L.Error().Msg("VerifyUserByToken: " + err.Error())
 	}
 
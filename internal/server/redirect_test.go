@@ -37,4 +37,23 @@ func TestVerifyAndRedirect_Works(t *testing.T) {
 	storedUser, err := data.GetIdentity(s.db, data.GetIdentityOptions{ByID: user.ID})
 	assert.NilError(t, err)
 	assert.Equal(t, storedUser.Verified, true)
+	assert.Assert(t, storedUser.VerificationToken != user.VerificationToken, "token must only be used once")
+}
+
+func TestVerifyAndRedirect_RateLimit(t *testing.T) {
+	s := setupServer(t)
+	routes := s.GenerateRoutes()
+
+	url := wrapLinkWithVerification("https://example.com/hello", "example.com", "not-a-token")
+	for i := 0; i < verifyRateLimit; i++ {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusPermanentRedirect, resp.Code, resp.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	resp := httptest.NewRecorder()
+	routes.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code, resp.Body.String())
 }
@@ -33,15 +33,23 @@ func NewLimiter(redis *Redis) *Limiter {
 
 // RateOK checks if the rate per minute is acceptable for the specified key
 func (lim *Limiter) RateOK(key string, limit int) error {
+	_, err := lim.Allow(key, limit)
+	return err
+}
+
+// Allow records a request for key, and returns the number of requests that
+// remain in the limit per minute. If the limit has been reached Allow returns
+// an OverLimitError.
+func (lim *Limiter) Allow(key string, limit int) (remaining int, err error) {
 	if lim.redis == nil {
-		return nil
+		return limit, nil
 	}
 
 	ctx := context.TODO()
 	limiter := rate.NewLimiter(lim.redis.client)
 	result, err := limiter.Allow(ctx, key, rate.PerMinute(limit))
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	logging.L.Debug().
@@ -53,12 +61,12 @@ func (lim *Limiter) RateOK(key string, limit int) error {
 		Msg("rate limit check")
 
 	if result.Allowed <= 0 {
-		return OverLimitError{
+		return 0, OverLimitError{
 			RetryAfter: result.RetryAfter,
 		}
 	}
 
-	return nil
+	return result.Remaining, nil
 }
 
 func loginKey(key string) string {
@@ -115,13 +123,24 @@ func (lim *Limiter) LoginGood(key string) {
 	}
 }
 
+// loginFailuresExpiry is how long the failed logins of a key are counted after
+// the last failure. Without an expiry the count of a key that never has a
+// successful login would only grow.
+const loginFailuresExpiry = time.Hour
+
 func (lim *Limiter) LoginBad(key string, limit int) {
 	if lim.redis != nil {
 		ctx := context.TODO()
-		rate, err := lim.redis.client.Incr(ctx, loginKey(key)).Result()
+		var incr *redis.IntCmd
+		_, err := lim.redis.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			incr = pipe.Incr(ctx, loginKey(key))
+			pipe.Expire(ctx, loginKey(key), loginFailuresExpiry)
+			return nil
+		})
 		if err != nil {
 			logging.L.Error().Err(err).Msg("could not increment lockout timer")
 		}
+		rate := incr.Val()
 
 		if rate >= int64(limit) {
 			retryAfter := time.Duration(math.Pow(1.5, float64(rate)) * float64(time.Second))
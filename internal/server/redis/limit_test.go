@@ -157,6 +157,21 @@ func TestLoginOK(t *testing.T) {
 		assert.NilError(t, err)
 	})
 
+	t.Run("failures expire", func(t *testing.T) {
+		srv, lim := setup(t)
+
+		for i := 0; i < 9; i++ {
+			lim.LoginBad("admin@example.com", 10)
+		}
+		assert.NilError(t, lim.LoginOK("admin@example.com"))
+
+		srv.FastForward(loginFailuresExpiry)
+
+		// the count starts again, so this failure does not lock out the key
+		lim.LoginBad("admin@example.com", 10)
+		assert.NilError(t, lim.LoginOK("admin@example.com"))
+	})
+
 	t.Run("failed after lockout period", func(t *testing.T) {
 		srv, lim := setup(t)
 
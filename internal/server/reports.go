@@ -0,0 +1,135 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/access"
+	"github.com/infrahq/infra/internal/server/audit"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+// defaultAuthenticationReportPeriod is the period of the authentication report
+// when the request does not set after.
+const defaultAuthenticationReportPeriod = 7 * 24 * time.Hour
+
+// authenticationReportLimit is the maximum number of entries in each section
+// of the authentication report.
+const authenticationReportLimit = 1000
+
+var getAuthenticationReportRoute = route[api.AuthenticationReportRequest, *api.AuthenticationReport]{
+	handler: getAuthenticationReportHandler,
+	routeSettings: routeSettings{
+		txnOptions: &sql.TxOptions{ReadOnly: true},
+	},
+}
+
+// getAuthenticationReportHandler returns a summary of the failed logins and
+// lockouts in a period, and the addresses users logged in from for the first
+// time. The report is computed from the audit events recorded by the database
+// sink.
+func getAuthenticationReportHandler(c *gin.Context, r *api.AuthenticationReportRequest) (*api.AuthenticationReport, error) {
+	db, err := access.RequireInfraRole(c, models.InfraAdminRole)
+	if err != nil {
+		return nil, access.HandleAuthErr(err, "authentication report", "get", models.InfraAdminRole)
+	}
+
+	before := r.Before.Time()
+	if before.IsZero() {
+		before = time.Now()
+	}
+	after := r.After.Time()
+	if after.IsZero() {
+		after = before.Add(-defaultAuthenticationReportPeriod)
+	}
+
+	report, err := data.GetAuthenticationReport(db, data.AuthenticationReportOptions{
+		CreatedAfter:  after,
+		CreatedBefore: before,
+		LoginAction:   audit.ActionLogin,
+		LockoutAction: audit.ActionUserLockout,
+		Limit:         authenticationReportLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &api.AuthenticationReport{
+		After:              api.Time(after),
+		Before:             api.Time(before),
+		FailedLogins:       report.FailedLogins,
+		FailuresByIdentity: authenticationReportEntriesToAPI(report.FailuresByIdentity),
+		FailuresBySourceIP: authenticationReportEntriesToAPI(report.FailuresBySourceIP),
+		NewSourceIPs:       authenticationReportEntriesToAPI(report.NewSourceIPs),
+		Lockouts:           authenticationReportEntriesToAPI(report.Lockouts),
+	}
+	if r.Format == api.ReportFormatCSV {
+		return nil, writeAuthenticationReportCSV(c, result)
+	}
+	return result, nil
+}
+
+func authenticationReportEntriesToAPI(entries []data.AuthenticationReportEntry) []api.AuthenticationReportEntry {
+	result := make([]api.AuthenticationReportEntry, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, api.AuthenticationReportEntry{
+			UserID:     e.UserID,
+			Name:       e.Name,
+			SourceIP:   e.SourceIP,
+			Count:      e.Count,
+			Identities: e.Identities,
+			First:      api.Time(e.First),
+			Last:       api.Time(e.Last),
+		})
+	}
+	return result
+}
+
+// writeAuthenticationReportCSV writes the report as a CSV file with one row
+// for each entry. The section column identifies the section of the entry, and
+// uses the name of the field in the JSON response.
+func writeAuthenticationReportCSV(c *gin.Context, report *api.AuthenticationReport) error {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="authentication-report.csv"`)
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write([]string{"section", "userID", "name", "sourceIP", "count", "identities", "first", "last"})
+
+	sections := []struct {
+		name    string
+		entries []api.AuthenticationReportEntry
+	}{
+		{name: "failuresByIdentity", entries: report.FailuresByIdentity},
+		{name: "failuresBySourceIP", entries: report.FailuresBySourceIP},
+		{name: "newSourceIPs", entries: report.NewSourceIPs},
+		{name: "lockouts", entries: report.Lockouts},
+	}
+	for _, section := range sections {
+		for _, e := range section.entries {
+			var userID string
+			if e.UserID != 0 {
+				userID = e.UserID.String()
+			}
+			_ = w.Write([]string{
+				section.name,
+				userID,
+				e.Name,
+				e.SourceIP,
+				strconv.FormatInt(e.Count, 10),
+				strconv.FormatInt(e.Identities, 10),
+				e.First.Time().UTC().Format(time.RFC3339),
+				e.Last.Time().UTC().Format(time.RFC3339),
+			})
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
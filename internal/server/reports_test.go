@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/server/audit"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+func TestAPI_GetAuthenticationReport(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	user := &models.Identity{Name: "someone@example.com"}
+	assert.NilError(t, data.CreateIdentity(srv.DB(), user))
+
+	events := []*models.AuditEvent{
+		{CreatedAt: now.Add(-3 * time.Hour), ActorName: "someone@example.com", Action: audit.ActionLogin, SourceIP: "198.51.100.7", Result: models.AuditResultFailure},
+		{CreatedAt: now.Add(-2 * time.Hour), ActorName: "someone@example.com", Action: audit.ActionLogin, SourceIP: "198.51.100.7", Result: models.AuditResultFailure},
+		{CreatedAt: now.Add(-2 * time.Hour), ActorName: "someone@example.com", Action: audit.ActionUserLockout, TargetType: "user", TargetID: user.ID.String(), Result: models.AuditResultSuccess},
+		{CreatedAt: now.Add(-time.Hour), ActorID: user.ID, ActorName: "someone@example.com", Action: audit.ActionLogin, SourceIP: "192.0.2.1", Result: models.AuditResultSuccess},
+		// older than the default period
+		{CreatedAt: now.Add(-8 * 24 * time.Hour), ActorName: "someone@example.com", Action: audit.ActionLogin, SourceIP: "192.0.2.1", Result: models.AuditResultFailure},
+	}
+	for _, event := range events {
+		assert.NilError(t, data.CreateAuditEvent(srv.DB(), event))
+	}
+
+	get := func(t *testing.T, query string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/reports/authentication?"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("json", func(t *testing.T) {
+		resp := get(t, "")
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		var report api.AuthenticationReport
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &report))
+		assert.Assert(t, report.Before.Time().After(report.After.Time()))
+		assert.Equal(t, report.Before.Time().Sub(report.After.Time()), 7*24*time.Hour)
+
+		expected := api.AuthenticationReport{
+			After:        report.After,
+			Before:       report.Before,
+			FailedLogins: 2,
+			FailuresByIdentity: []api.AuthenticationReportEntry{
+				{Name: "someone@example.com", Count: 2, First: api.Time(now.Add(-3 * time.Hour)), Last: api.Time(now.Add(-2 * time.Hour))},
+			},
+			FailuresBySourceIP: []api.AuthenticationReportEntry{
+				{SourceIP: "198.51.100.7", Count: 2, Identities: 1, First: api.Time(now.Add(-3 * time.Hour)), Last: api.Time(now.Add(-2 * time.Hour))},
+			},
+			NewSourceIPs: []api.AuthenticationReportEntry{
+				{UserID: user.ID, Name: "someone@example.com", SourceIP: "192.0.2.1", Count: 1, First: api.Time(now.Add(-time.Hour)), Last: api.Time(now.Add(-time.Hour))},
+			},
+			Lockouts: []api.AuthenticationReportEntry{
+				{UserID: user.ID, Name: "someone@example.com", Count: 1, First: api.Time(now.Add(-2 * time.Hour)), Last: api.Time(now.Add(-2 * time.Hour))},
+			},
+		}
+		assert.DeepEqual(t, report, expected)
+	})
+	t.Run("csv", func(t *testing.T) {
+		resp := get(t, "format=csv")
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		assert.Equal(t, resp.Header().Get("Content-Type"), "text/csv; charset=utf-8")
+
+		records, err := csv.NewReader(resp.Body).ReadAll()
+		assert.NilError(t, err)
+
+		first := now.Add(-3 * time.Hour).Format(time.RFC3339)
+		last := now.Add(-2 * time.Hour).Format(time.RFC3339)
+		login := now.Add(-time.Hour).Format(time.RFC3339)
+		expected := [][]string{
+			{"section", "userID", "name", "sourceIP", "count", "identities", "first", "last"},
+			{"failuresByIdentity", "", "someone@example.com", "", "2", "0", first, last},
+			{"failuresBySourceIP", "", "", "198.51.100.7", "2", "1", first, last},
+			{"newSourceIPs", user.ID.String(), "someone@example.com", "192.0.2.1", "1", "0", login, login},
+			{"lockouts", user.ID.String(), "someone@example.com", "", "1", "0", last, last},
+		}
+		assert.DeepEqual(t, records, expected)
+	})
+	t.Run("time range", func(t *testing.T) {
+		query := url.Values{
+			"after":  {now.Add(-9 * 24 * time.Hour).Format(time.RFC3339)},
+			"before": {now.Add(-150 * time.Minute).Format(time.RFC3339)},
+		}
+		resp := get(t, query.Encode())
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		var report api.AuthenticationReport
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &report))
+		assert.Equal(t, report.FailedLogins, int64(2))
+		assert.DeepEqual(t, report.NewSourceIPs, []api.AuthenticationReportEntry{})
+		assert.DeepEqual(t, report.Lockouts, []api.AuthenticationReportEntry{})
+	})
+	t.Run("invalid format", func(t *testing.T) {
+		resp := get(t, "format=xml")
+		assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+		assert.Assert(t, strings.Contains(resp.Body.String(), "format"))
+	})
+	t.Run("requires admin", func(t *testing.T) {
+		key, _ := createAccessKey(t, srv.DB(), "viewer@example.com")
+		req := httptest.NewRequest(http.MethodGet, "/api/reports/authentication", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		assert.Equal(t, resp.Code, http.StatusForbidden, resp.Body.String())
+	})
+}
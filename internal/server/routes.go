@@ -3,20 +3,27 @@ package server
 import (
 	"context"
 	"database/sql"
+	"encoding"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"path"
 	"reflect"
 	"strings"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/gin-gonic/gin"
 
+	"github.com/infrahq/infra/api"
 	"github.com/infrahq/infra/internal"
 	"github.com/infrahq/infra/internal/access"
 	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/validate"
 	"github.com/infrahq/infra/metrics"
+	"github.com/infrahq/infra/tracing"
 )
 
 // Routes is the return value of GenerateRoutes.
@@ -43,28 +50,54 @@ func (s *Server) GenerateRoutes() Routes {
 	router.NoRoute(a.notFoundHandler)
 
 	router.Use(gin.Recovery())
-	router.GET("/healthz", healthHandler)
 
 	// This group of middleware will apply to everything, including the UI
-	router.Use(loggingMiddleware(s.options.EnableLogSampling))
+	router.Use(clientIPMiddleware(s.trustedProxies))
+	// tracing is before logging, so that log lines include the trace ID
+	router.Use(tracing.Middleware())
+	router.Use(loggingMiddleware(s.options.EnableLogSampling, s.options.AccessLog))
+	healthChecks := router.Group("/", healthCheckRateLimitMiddleware())
+	healthChecks.GET("/healthz", healthHandler)
+	healthChecks.GET("/readyz", (&readinessChecker{db: s.db}).readyHandler)
 
 	// This group of middleware only applies to non-ui routes
-	apiGroup := router.Group("/", metrics.Middleware(s.metricsRegistry))
+	apiGroup := router.Group("/", metrics.Middleware(s.metricsRegistry, s.metricsMiddlewareOptions()), compressionMiddleware())
 
 	// auth required, org required
 	authn := &routeGroup{RouterGroup: apiGroup.Group("/")}
 
 	get(a, authn, "/api/users", a.ListUsers)
-	post(a, authn, "/api/users", a.CreateUser)
+	add(a, authn, http.MethodPost, "/api/users", route[api.CreateUserRequest, *api.CreateUserResponse]{
+		handler:       a.CreateUser,
+		routeSettings: routeSettings{idempotencyKey: true},
+	})
 	get(a, authn, "/api/users/:id", a.GetUser)
 	put(a, authn, "/api/users/:id", a.UpdateUser)
+	patch(a, authn, "/api/users/:id", a.PatchUser)
 	del(a, authn, "/api/users/:id", a.DeleteUser)
+	post(a, authn, "/api/users/bulk-delete", a.BulkDeleteUsers)
 	put(a, authn, "/api/users/public-key", AddUserPublicKey)
+	post(a, authn, "/api/users/self/mfa/totp", a.EnrollTOTP)
+	post(a, authn, "/api/users/self/mfa/totp/confirm", a.ConfirmTOTP)
+	del(a, authn, "/api/users/:id/mfa", a.ResetUserMFA)
+	del(a, authn, "/api/users/:id/lockout", a.UnlockUser)
+	get(a, authn, "/api/users/:id/sessions", a.ListUserSessions)
+	del(a, authn, "/api/users/:id/sessions", a.DeleteUserSessions)
+	post(a, authn, "/api/users/:id/impersonate", a.ImpersonateUser)
+	post(a, authn, "/api/users/:id/impersonation-approvals", a.CreateImpersonationApproval)
 
 	get(a, authn, "/api/access-keys", a.ListAccessKeys)
-	post(a, authn, "/api/access-keys", a.CreateAccessKey)
+	add(a, authn, http.MethodPost, "/api/access-keys", route[api.CreateAccessKeyRequest, *api.CreateAccessKeyResponse]{
+		handler:       a.CreateAccessKey,
+		routeSettings: routeSettings{idempotencyKey: true},
+	})
 	del(a, authn, "/api/access-keys/:id", a.DeleteAccessKey)
 	del(a, authn, "/api/access-keys", a.DeleteAccessKeys)
+	post(a, authn, "/api/access-keys/bulk-delete", a.BulkDeleteAccessKeys)
+	post(a, authn, "/api/access-keys/self/extend", a.ExtendAccessKey)
+
+	add(a, authn, http.MethodGet, "/api/audit-events", listAuditEventsRoute)
+	add(a, authn, http.MethodGet, "/api/reports/authentication", getAuthenticationReportRoute)
 
 	get(a, authn, "/api/groups", a.ListGroups)
 	post(a, authn, "/api/groups", a.CreateGroup)
@@ -75,13 +108,30 @@ func (s *Server) GenerateRoutes() Routes {
 	get(a, authn, "/api/organizations", a.ListOrganizations)
 	post(a, authn, "/api/organizations", a.CreateOrganization)
 	get(a, authn, "/api/organizations/:id", a.GetOrganization)
+	patch(a, authn, "/api/organizations/:id", a.UpdateOrganization)
+	get(a, authn, "/api/organizations/:id/rate-limits", a.GetOrganizationRateLimits)
+	put(a, authn, "/api/organizations/:id/rate-limits", a.UpdateOrganizationRateLimits)
+	get(a, authn, "/api/organizations/:id/stats", a.GetOrganizationStats)
+	add(a, authn, http.MethodGet, "/api/organizations/:id/export", route[api.Resource, *api.OrganizationExport]{
+		handler: a.ExportOrganization,
+		routeSettings: routeSettings{
+			omitFromTelemetry: true,
+			txnOptions:        &sql.TxOptions{ReadOnly: true, Isolation: sql.LevelRepeatableRead},
+		},
+	})
+	get(a, authn, "/api/stats", a.GetStats)
 	del(a, authn, "/api/organizations/:id", a.DeleteOrganization)
 
 	get(a, authn, "/api/grants", a.ListGrants)
 	get(a, authn, "/api/grants/:id", a.GetGrant)
-	post(a, authn, "/api/grants", a.CreateGrant)
+	add(a, authn, http.MethodPost, "/api/grants", route[api.GrantRequest, *api.CreateGrantResponse]{
+		handler:       a.CreateGrant,
+		routeSettings: routeSettings{idempotencyKey: true},
+	})
 	del(a, authn, "/api/grants/:id", a.DeleteGrant)
+	post(a, authn, "/api/grants/bulk-delete", a.BulkDeleteGrants)
 	patch(a, authn, "/api/grants", a.UpdateGrants)
+	patch(a, authn, "/api/grants/:id", a.PatchGrant)
 
 	post(a, authn, "/api/providers", a.CreateProvider)
 	patch(a, authn, "/api/providers/:id", a.PatchProvider)
@@ -93,9 +143,21 @@ func (s *Server) GenerateRoutes() Routes {
 	post(a, authn, "/api/destinations", a.CreateDestination)
 	put(a, authn, "/api/destinations/:id", a.UpdateDestination)
 	del(a, authn, "/api/destinations/:id", a.DeleteDestination)
+	add(a, authn, http.MethodGet, "/api/destinations/:id/logs", listDestinationLogsRoute)
+	add(a, authn, http.MethodPost, "/api/destinations/:id/logs", createDestinationLogsRoute)
+	add(a, authn, http.MethodGet, "/api/destinations/:id/usage", getDestinationUsageRoute)
+	add(a, authn, http.MethodGet, "/api/destinations/:id/metrics", getDestinationMetricsRoute)
+
+	get(a, authn, "/api/webhooks", a.ListWebhooks)
+	post(a, authn, "/api/webhooks", a.CreateWebhook)
+	get(a, authn, "/api/webhooks/:id", a.GetWebhook)
+	del(a, authn, "/api/webhooks/:id", a.DeleteWebhook)
+	get(a, authn, "/api/webhooks/:id/deliveries", a.ListWebhookDeliveries)
 
 	post(a, authn, "/api/tokens", a.CreateToken)
 	post(a, authn, "/api/logout", a.Logout)
+	get(a, authn, "/api/self", a.GetSelf)
+	get(a, authn, "/api/csrf-token", a.GetCSRFToken)
 
 	// SCIM inbound provisioning
 	add(a, authn, http.MethodGet, "/api/scim/v2/Users/:id", getProviderUsersRoute)
@@ -108,6 +170,11 @@ func (s *Server) GenerateRoutes() Routes {
 	put(a, authn, "/api/settings", a.UpdateSettings)
 
 	add(a, authn, http.MethodGet, "/api/debug/pprof/*profile", pprofRoute)
+	add(a, authn, http.MethodGet, "/api/debug/loglevel", getLogLevelRoute)
+	add(a, authn, http.MethodPut, "/api/debug/loglevel", updateLogLevelRoute)
+	add(a, authn, http.MethodGet, "/api/debug/migrations", listMigrationsRoute)
+	add(a, authn, http.MethodGet, "/api/debug/caches", a.listCachesRoute())
+	add(a, authn, http.MethodDelete, "/api/debug/caches/:name", a.flushCacheRoute())
 
 	// no auth required, org not required
 	noAuthnNoOrg := &routeGroup{RouterGroup: apiGroup.Group("/"), noAuthentication: true, noOrgRequired: true}
@@ -126,7 +193,7 @@ func (s *Server) GenerateRoutes() Routes {
 	get(a, noAuthnWithOrg, "/api/providers/:id", a.GetProvider)
 	get(a, noAuthnWithOrg, "/api/providers", a.ListProviders)
 	get(a, noAuthnWithOrg, "/api/settings", a.GetSettings)
-	add(a, noAuthnWithOrg, http.MethodGet, "/link", verifyAndRedirectRoute)
+	add(a, noAuthnWithOrg, http.MethodGet, "/link", a.verifyAndRedirectRoute())
 
 	add(a, noAuthnWithOrg, http.MethodGet, "/.well-known/jwks.json", wellKnownJWKsRoute)
 
@@ -134,6 +201,7 @@ func (s *Server) GenerateRoutes() Routes {
 	post(a, noAuthnNoOrg, "/api/device", a.StartDeviceFlow)
 	post(a, noAuthnWithOrg, "/api/device/status", a.GetDeviceFlowStatus)
 	post(a, authn, "/api/device/approve", a.ApproveDeviceFlow)
+	post(a, authn, "/api/device/deny", a.DenyDeviceFlow)
 
 	a.deprecatedRoutes(noAuthnNoOrg)
 
@@ -160,6 +228,12 @@ type routeSettings struct {
 	authenticationOptional     bool
 	organizationOptional       bool
 	txnOptions                 *sql.TxOptions
+	// maxRequestBodySize overrides APIOptions.MaxRequestBodySize for routes
+	// that accept a larger request body.
+	maxRequestBodySize int64
+	// idempotencyKey enables the Idempotency-Key header, which allows a
+	// client to retry a request without making the change twice.
+	idempotencyKey bool
 }
 
 type routeIdentifier struct {
@@ -210,27 +284,67 @@ func wrapRoute[Req, Res any](a *API, routeID routeIdentifier, route route[Req, R
 		defer cancel()
 		c.Request = c.Request.WithContext(ctx)
 
-		if !route.infraVersionHeaderOptional {
-			if _, err := requestVersion(c.Request); err != nil {
-				return err
-			}
+		version, err := requestVersion(c.Request)
+		switch {
+		case err != nil && !route.infraVersionHeaderOptional:
+			return err
+		case err != nil:
+			version = semver.MustParse(internal.FullVersion())
 		}
+		// tell the client which version of the API the response uses
+		c.Header("Infra-Version", version.String())
 
 		authned, err := authenticateRequest(c, route.routeSettings, a.server)
 		if err != nil {
 			return err
 		}
+		if fields := authenticatedLogFields(authned); len(fields) > 0 {
+			origRequestContext = logging.WithFields(origRequestContext, fields...)
+			c.Request = c.Request.WithContext(logging.WithFields(c.Request.Context(), fields...))
+		}
+
+		if c.Request.Body != nil {
+			limit := route.maxRequestBodySize
+			if limit == 0 {
+				limit = a.server.options.API.MaxRequestBodySize
+			}
+			if limit == 0 {
+				limit = DefaultMaxRequestBodySize
+			}
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		}
+
+		var idempotent *idempotentRequest
+		if route.idempotencyKey {
+			if idempotent, err = readIdempotentRequest(c, authned); err != nil {
+				return err
+			}
+		}
 
 		req := new(Req)
+		if isDescribeRequest(c, req) {
+			c.JSON(http.StatusOK, listDescription(reflect.TypeOf(req).Elem(), a.server.options.API.MaxPaginationLimit))
+			return nil
+		}
 		if err := readRequest(c, req); err != nil {
 			return err
 		}
+		if err := validatePaginationLimit(req, a.server.options.API.MaxPaginationLimit); err != nil {
+			return err
+		}
+		selection, err := fieldSelectionFromRequest[Res](req)
+		if err != nil {
+			return err
+		}
 
 		if r, ok := any(req).(isBlockingRequest); ok && r.IsBlockingRequest() {
 			ctx, cancel := context.WithTimeout(
 				origRequestContext, a.server.options.API.BlockingRequestTimeout)
 			defer cancel()
-			c.Request = c.Request.WithContext(ctx)
+			// Blocking requests wait for changes after an update index read
+			// from the primary, so they must not read from a replica that
+			// may not have those changes yet.
+			c.Request = c.Request.WithContext(data.RequirePrimary(ctx))
 		}
 
 		tx, err := a.server.db.Begin(c.Request.Context(), route.txnOptions)
@@ -248,14 +362,28 @@ func wrapRoute[Req, Res any](a *API, routeID routeIdentifier, route route[Req, R
 			Authenticated: authned,
 			DataDB:        a.server.db,
 			Response:      &access.ResponseMetadata{},
+			APIVersion:    version.String(),
 		}
 		c.Set(access.RequestContextKey, rCtx)
 
+		if idempotent != nil {
+			replayed, err := idempotent.replay(c, tx)
+			if err != nil || replayed {
+				return err
+			}
+		}
+
 		resp, err := route.handler(c, req)
 		if err != nil {
 			return err
 		}
 
+		if idempotent != nil {
+			if err := idempotent.save(tx, responseStatusCode(routeID.method, resp), resp); err != nil {
+				return err
+			}
+		}
+
 		completeTx := tx.Commit
 		if route.txnOptions != nil && route.txnOptions.ReadOnly {
 			// use rollback to avoid an error when the request handler already completed the txn
@@ -269,6 +397,11 @@ func wrapRoute[Req, Res any](a *API, routeID routeIdentifier, route route[Req, R
 			a.t.RouteEvent(c, routeID.path, Properties{"method": strings.ToLower(routeID.method)})
 		}
 
+		if c.Writer.Written() {
+			// the handler streamed the response body
+			return nil
+		}
+
 		// TODO: extract all response header/status/body writing to another function
 		if respHeaders, ok := any(resp).(hasResponseHeaders); ok {
 			respHeaders.SetHeaders(c.Writer.Header())
@@ -276,7 +409,13 @@ func wrapRoute[Req, Res any](a *API, routeID routeIdentifier, route route[Req, R
 		if r, ok := any(resp).(isRedirect); ok {
 			c.Redirect(http.StatusPermanentRedirect, r.RedirectURL())
 		} else {
-			c.JSON(responseStatusCode(routeID.method, resp), resp)
+			var body any = resp
+			if selection != nil {
+				if body, err = selection.apply(resp); err != nil {
+					return err
+				}
+			}
+			c.JSON(responseStatusCode(routeID.method, resp), body)
 		}
 		return nil
 	}
@@ -365,28 +504,70 @@ func readRequest(c *gin.Context, req interface{}) error {
 		return fmt.Errorf("%w: %s", internal.ErrBadRequest, err)
 	}
 
+	fieldErrs := validate.Error{}
 	if c.Request.Body != nil && c.Request.ContentLength > 0 {
 		if err := c.ShouldBindJSON(req); err != nil {
-			return fmt.Errorf("%w: %s", internal.ErrBadRequest, err)
+			var maxBytesErr *http.MaxBytesError
+			var typeErr *json.UnmarshalTypeError
+			switch {
+			case errors.As(err, &maxBytesErr):
+				return fmt.Errorf("read request body: %w", err)
+			case errors.As(err, &typeErr) && typeErr.Field != "":
+				// the rest of the body is still decoded, so continue to
+				// validate the request to report every invalid field.
+				fieldErrs[typeErr.Field] = []string{"must be " + jsonTypeName(typeErr.Type)}
+			default:
+				return fmt.Errorf("%w: %s", internal.ErrBadRequest, err)
+			}
 		}
 	}
 
 	if r, ok := req.(validate.Request); ok {
-		if err := validate.Validate(r); err != nil {
-			return err
+		var validationErr validate.Error
+		if err := validate.Validate(r); errors.As(err, &validationErr) {
+			for name, problems := range validationErr {
+				// a field with the wrong type was not decoded, so any other
+				// problems with the field are not useful.
+				if _, ok := fieldErrs[name]; !ok {
+					fieldErrs[name] = problems
+				}
+			}
 		}
 	}
+	if len(fieldErrs) > 0 {
+		return fieldErrs
+	}
 
 	trimWhitespace(req)
 	return nil
 }
 
-func init() {
-	gin.DisableBindValidation()
+// jsonTypeName returns the JSON type, with an article, that is decoded into a
+// value of type t.
+func jsonTypeName(t reflect.Type) string {
+	if t.Implements(textUnmarshaler) || reflect.PointerTo(t).Implements(textUnmarshaler) {
+		return "a string"
+	}
+	switch t.Kind() { // nolint:exhaustive
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	default:
+		return "an object"
+	}
 }
 
-func healthHandler(c *gin.Context) {
-	c.Status(http.StatusOK)
+var textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+func init() {
+	gin.DisableBindValidation()
 }
 
 func (a *API) notFoundHandler(c *gin.Context) {
@@ -3,6 +3,7 @@ package server
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -20,6 +21,7 @@ import (
 	"github.com/infrahq/infra/internal"
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/internal/validate"
 	"github.com/infrahq/infra/uid"
 )
 
@@ -111,13 +113,68 @@ func TestReadRequest_EmptyRequest(t *testing.T) {
 	assert.NilError(t, err)
 }
 
+type exampleValidatedRequest struct {
+	Name    string   `json:"name"`
+	Count   int      `json:"count"`
+	Enabled bool     `json:"enabled"`
+	Kind    string   `json:"kind"`
+	IDs     []uid.ID `json:"ids"`
+}
+
+func (r exampleValidatedRequest) ValidationRules() []validate.ValidationRule {
+	return []validate.ValidationRule{
+		validate.Required("name", r.Name),
+		validate.StringRule{Name: "name", Value: r.Name, MaxLength: 3},
+		validate.Required("count", r.Count),
+		validate.Enum("kind", r.Kind, []string{"fruit", "grain"}),
+	}
+}
+
+func TestReadRequest_ReportsEveryInvalidField(t *testing.T) {
+	readJSON := func(t *testing.T, body string) error {
+		t.Helper()
+		c, _ := gin.CreateTestContext(nil)
+		c.Request = httptest.NewRequest(http.MethodPost, "/foo", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		return readRequest(c, &exampleValidatedRequest{})
+	}
+
+	t.Run("type errors and rule failures", func(t *testing.T) {
+		err := readJSON(t, `{"name": "abcdef", "count": "many", "enabled": 1, "kind": "legume"}`)
+
+		var fieldErrs validate.Error
+		assert.Assert(t, errors.As(err, &fieldErrs), "wrong error type %T", err)
+		expected := validate.Error{
+			"name":  {"can be at most 3 characters"},
+			"count": {"must be a number"},
+			"kind":  {"must be one of (fruit, grain)"},
+		}
+		// only the first type error is reported by encoding/json
+		assert.DeepEqual(t, fieldErrs, expected)
+	})
+
+	t.Run("type error replaces other problems with the field", func(t *testing.T) {
+		err := readJSON(t, `{"name": 12, "count": 2, "ids": "abc"}`)
+
+		var fieldErrs validate.Error
+		assert.Assert(t, errors.As(err, &fieldErrs), "wrong error type %T", err)
+		expected := validate.Error{"name": {"must be a string"}}
+		assert.DeepEqual(t, fieldErrs, expected)
+	})
+
+	t.Run("malformed json", func(t *testing.T) {
+		err := readJSON(t, `{"name": `)
+		assert.ErrorIs(t, err, internal.ErrBadRequest)
+	})
+}
+
 func TestTimestampAndDurationSerialization(t *testing.T) {
 	c, _ := gin.CreateTestContext(nil)
 
 	uri, err := url.Parse("/foo")
 	assert.NilError(t, err)
 
-	orig := `{"deadline":"2022-03-23T17:50:59Z","extension":"1h35m0s"}`
+	orig := `{"deadline":"2022-03-23T17:50:59.000Z","extension":"1h35m0s"}`
 	body := bytes.NewBufferString(orig)
 	c.Request = &http.Request{
 		URL:           uri,
@@ -256,21 +313,50 @@ func TestInfraVersionHeader(t *testing.T) {
 	srv := setupServer(t, withAdminUser)
 	routes := srv.GenerateRoutes()
 
-	body := jsonBody(t, api.CreateUserRequest{Name: "usera@example.com"})
-	// nolint:noctx
-	req := httptest.NewRequest(http.MethodPost, "/api/users", body)
-	req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+	t.Run("missing header uses the latest version", func(t *testing.T) {
+		body := jsonBody(t, api.CreateUserRequest{Name: "usera@example.com"})
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodPost, "/api/users", body)
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
 
-	resp := httptest.NewRecorder()
-	routes.ServeHTTP(resp, req)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
 
-	assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+		assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+		assert.Equal(t, resp.Header().Get("Infra-Version"), apiVersionLatest)
+	})
 
-	respBody := &api.Error{}
-	err := json.Unmarshal(resp.Body.Bytes(), respBody)
-	assert.NilError(t, err)
+	t.Run("older version", func(t *testing.T) {
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Set("Infra-Version", "0.18.0")
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		assert.Equal(t, resp.Header().Get("Infra-Version"), "0.18.0")
+	})
+
+	t.Run("invalid header", func(t *testing.T) {
+		body := jsonBody(t, api.CreateUserRequest{Name: "userb@example.com"})
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodPost, "/api/users", body)
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Set("Infra-Version", "yesterday")
 
-	assert.Assert(t, strings.Contains(respBody.Message, "Infra-Version header is required"), respBody.Message)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+
+		assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+
+		respBody := &api.Error{}
+		err := json.Unmarshal(resp.Body.Bytes(), respBody)
+		assert.NilError(t, err)
+
+		assert.Assert(t, strings.Contains(respBody.Message, "invalid Infra-Version header"), respBody.Message)
+	})
 }
 
 var apiVersionLatest = internal.FullVersion()
@@ -355,3 +441,80 @@ func TestGenerateRoutes_OneRequestDoesNotBlockOthers(t *testing.T) {
 	// Anything more than 2 should indicate the requests did not block each other.
 	assert.Assert(t, count >= 3, "count=%d", count)
 }
+
+func TestRequestBodySizeLimit(t *testing.T) {
+	srv := setupServer(t, withAdminUser, func(t *testing.T, options *Options) {
+		options.API.MaxRequestBodySize = 1024
+	})
+	routes := srv.GenerateRoutes()
+	router, ok := routes.Handler.(*gin.Engine)
+	assert.Assert(t, ok)
+	a := &API{server: srv}
+
+	type bodyRequest struct {
+		Value string `json:"value"`
+	}
+	handler := func(c *gin.Context, req *bodyRequest) (*api.EmptyResponse, error) {
+		return nil, nil
+	}
+	group := &routeGroup{RouterGroup: router.Group("/"), noAuthentication: true, noOrgRequired: true}
+	add(a, group, http.MethodPost, "/body", route[bodyRequest, *api.EmptyResponse]{
+		handler:       handler,
+		routeSettings: routeSettings{omitFromDocs: true},
+	})
+	add(a, group, http.MethodPost, "/large-body", route[bodyRequest, *api.EmptyResponse]{
+		handler:       handler,
+		routeSettings: routeSettings{omitFromDocs: true, maxRequestBodySize: 4096},
+	})
+
+	post := func(t *testing.T, path string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		var buf bytes.Buffer
+		assert.NilError(t, json.NewEncoder(&buf).Encode(body))
+
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodPost, path, &buf)
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("body under the limit", func(t *testing.T) {
+		resp := post(t, "/body", bodyRequest{Value: strings.Repeat("a", 512)})
+		assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+	})
+	t.Run("body over the limit", func(t *testing.T) {
+		resp := post(t, "/body", bodyRequest{Value: strings.Repeat("a", 2048)})
+		assert.Equal(t, resp.Code, http.StatusRequestEntityTooLarge, resp.Body.String())
+
+		var respBody api.Error
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &respBody))
+		expected := api.Error{
+			Code:      http.StatusRequestEntityTooLarge,
+			ErrorCode: api.ErrorCodeRequestTooLarge,
+			Message:   "request body is larger than the limit of 1024 bytes",
+		}
+		assert.DeepEqual(t, respBody, expected)
+	})
+	t.Run("route with a larger limit", func(t *testing.T) {
+		resp := post(t, "/large-body", bodyRequest{Value: strings.Repeat("a", 2048)})
+		assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+
+		resp = post(t, "/large-body", bodyRequest{Value: strings.Repeat("a", 8192)})
+		assert.Equal(t, resp.Code, http.StatusRequestEntityTooLarge, resp.Body.String())
+	})
+	t.Run("field over the limit", func(t *testing.T) {
+		resp := post(t, "/api/groups", api.CreateGroupRequest{Name: strings.Repeat("a", 300)})
+		assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+
+		var respBody api.Error
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &respBody))
+		expected := []api.FieldError{
+			{FieldName: "name", ErrorCode: api.ErrorCodeInvalid, Errors: []string{"can be at most 256 characters"}},
+		}
+		assert.DeepEqual(t, respBody.FieldErrors, expected)
+	})
+}
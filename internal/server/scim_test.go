@@ -418,7 +418,7 @@ func TestAPI_CreateProviderUser(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{FieldName: "schemas", Errors: []string{"is required"}},
+					{FieldName: "schemas", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
 			},
@@ -620,7 +620,7 @@ func TestAPI_UpdateProviderUser(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{FieldName: "schemas", Errors: []string{"is required"}},
+					{FieldName: "schemas", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
 			},
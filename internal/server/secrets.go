@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/infrahq/secrets"
+
+	"github.com/infrahq/infra/internal/server/data"
+)
+
+// defaultExecSecretTimeout is the maximum amount of time a command run by
+// execSecretProvider can take to print the secret.
+const defaultExecSecretTimeout = 30 * time.Second
+
+// execSecretProvider is a secret storage that runs a command to get a secret,
+// so that any external tool can be used to fetch secrets. The name of the
+// secret is the command and its arguments separated by spaces, ex:
+// exec:/usr/local/bin/fetch-secret db-password. The secret is the output of
+// the command, without the trailing newline.
+type execSecretProvider struct {
+	timeout time.Duration
+}
+
+var _ secrets.SecretStorage = &execSecretProvider{}
+
+func (p *execSecretProvider) GetSecret(name string) ([]byte, error) {
+	args := strings.Fields(name)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing command")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	stderr := new(bytes.Buffer)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("run %v: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	out = bytes.TrimSuffix(out, []byte("\n"))
+	return bytes.TrimSuffix(out, []byte("\r")), nil
+}
+
+func (p *execSecretProvider) SetSecret(string, []byte) error {
+	return fmt.Errorf("exec secrets are read-only")
+}
+
+// rootKeyStorage is the secret storage used by the default native key
+// provider. A root key ID that refers to a configured secret storage, like
+// env:INFRA_ROOT_KEY or exec:/usr/local/bin/fetch-root-key, is read from that
+// storage. Any other root key ID is the path of a file.
+type rootKeyStorage struct {
+	file    secrets.SecretStorage
+	storage map[string]secrets.SecretStorage
+}
+
+func (r rootKeyStorage) isReference(name string) bool {
+	kind, _, ok := strings.Cut(name, ":")
+	if !ok {
+		return false
+	}
+	_, found := r.storage[kind]
+	return found
+}
+
+func (r rootKeyStorage) GetSecret(name string) ([]byte, error) {
+	if r.isReference(name) {
+		return secrets.GetSecretRaw(name, r.storage)
+	}
+	return r.file.GetSecret(name)
+}
+
+func (r rootKeyStorage) SetSecret(name string, secret []byte) error {
+	if r.isReference(name) {
+		return secrets.SetSecret(name, string(secret), r.storage)
+	}
+	return r.file.SetSecret(name, secret)
+}
+
+// reloadableSecret is a secret that is fetched again from its storage every
+// time the server reloads its secrets.
+type reloadableSecret struct {
+	name    string
+	storage map[string]secrets.SecretStorage
+
+	mu    sync.RWMutex
+	value string
+}
+
+// get returns the value from the last reload, or an empty string if the
+// secret was never reloaded.
+func (s *reloadableSecret) get() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.value
+}
+
+func (s *reloadableSecret) reload() error {
+	value, err := secrets.GetSecret(s.name, s.storage)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.value = value
+	return nil
+}
+
+// ReloadSecrets fetches the secrets used by the server again, so that they
+// can be rotated without restarting the server. The database password is used
+// for new connections to the database. The root key is checked to make sure it
+// still decrypts the database key, so that a mistake in the rotation of the
+// root key is reported immediately, instead of at the next restart.
+func (s *Server) ReloadSecrets() error {
+	if s.dbPassword != nil {
+		if err := s.dbPassword.reload(); err != nil {
+			return fmt.Errorf("db password: %w", err)
+		}
+	}
+
+	if s.dbKeyProvider != nil {
+		tx, err := s.db.Begin(context.Background(), nil)
+		if err != nil {
+			return err
+		}
+		defer logError(tx.Rollback, "failed to rollback reload secrets transaction")
+
+		if err := data.VerifyDBKey(tx, s.dbKeyProvider, s.options.DBEncryptionKey); err != nil {
+			return fmt.Errorf("db encryption key: %w", err)
+		}
+	}
+	return nil
+}
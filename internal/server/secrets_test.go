@@ -0,0 +1,186 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/infrahq/secrets"
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+// writeScript writes an executable shell script to a temporary directory, and
+// returns the path to the script.
+func writeScript(t *testing.T, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("exec secrets tests use a shell script")
+	}
+	filename := filepath.Join(t.TempDir(), "fetch-secret")
+	err := os.WriteFile(filename, []byte("#!/bin/sh\n"+script+"\n"), 0o700) // nolint:gosec
+	assert.NilError(t, err)
+	return filename
+}
+
+func TestExecSecretProvider(t *testing.T) {
+	provider := &execSecretProvider{timeout: defaultExecSecretTimeout}
+
+	t.Run("secret from stdout", func(t *testing.T) {
+		script := writeScript(t, `echo "secret-for-$1"`)
+
+		secret, err := provider.GetSecret(script + " db")
+		assert.NilError(t, err)
+		assert.Equal(t, string(secret), "secret-for-db")
+	})
+
+	t.Run("secret with crlf", func(t *testing.T) {
+		script := writeScript(t, `printf 'the-secret\r\n'`)
+
+		secret, err := provider.GetSecret(script)
+		assert.NilError(t, err)
+		assert.Equal(t, string(secret), "the-secret")
+	})
+
+	t.Run("command fails", func(t *testing.T) {
+		script := writeScript(t, `echo "no such secret" >&2; exit 3`)
+
+		_, err := provider.GetSecret(script)
+		assert.ErrorContains(t, err, "exit status 3: no such secret")
+	})
+
+	t.Run("command times out", func(t *testing.T) {
+		script := writeScript(t, `exec sleep 10`)
+
+		provider := &execSecretProvider{timeout: 50 * time.Millisecond}
+		_, err := provider.GetSecret(script)
+		assert.ErrorContains(t, err, "signal: killed")
+	})
+
+	t.Run("missing command", func(t *testing.T) {
+		_, err := provider.GetSecret("  ")
+		assert.ErrorContains(t, err, "missing command")
+	})
+
+	t.Run("read only", func(t *testing.T) {
+		err := provider.SetSecret("/bin/true", []byte("secret"))
+		assert.ErrorContains(t, err, "exec secrets are read-only")
+	})
+}
+
+func TestDefaultSecretStorage(t *testing.T) {
+	storage := map[string]secrets.SecretStorage{}
+	assert.NilError(t, loadDefaultSecretConfig(storage))
+
+	t.Run("env", func(t *testing.T) {
+		t.Setenv("INFRA_TEST_DB_PASSWORD", "from-env")
+
+		secret, err := secrets.GetSecret("env:INFRA_TEST_DB_PASSWORD", storage)
+		assert.NilError(t, err)
+		assert.Equal(t, secret, "from-env")
+	})
+
+	t.Run("file", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "db")
+		assert.NilError(t, os.WriteFile(filename, []byte("from-file"), 0o600))
+
+		secret, err := secrets.GetSecret("file:"+filename, storage)
+		assert.NilError(t, err)
+		assert.Equal(t, secret, "from-file")
+	})
+
+	t.Run("exec", func(t *testing.T) {
+		script := writeScript(t, `echo "from-exec"`)
+
+		secret, err := secrets.GetSecret("exec:"+script+" db", storage)
+		assert.NilError(t, err)
+		assert.Equal(t, secret, "from-exec")
+	})
+}
+
+func TestRootKeyStorage(t *testing.T) {
+	storage := map[string]secrets.SecretStorage{}
+	assert.NilError(t, loadDefaultSecretConfig(storage))
+	rootKeys := rootKeyStorage{file: storage["file"], storage: storage}
+
+	t.Run("file path", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "root.key")
+
+		assert.NilError(t, rootKeys.SetSecret(filename, []byte("the-root-key")))
+		key, err := rootKeys.GetSecret(filename)
+		assert.NilError(t, err)
+		assert.Equal(t, string(key), "the-root-key")
+	})
+
+	t.Run("secret reference", func(t *testing.T) {
+		t.Setenv("INFRA_TEST_ROOT_KEY", "root-key-from-env")
+
+		key, err := rootKeys.GetSecret("env:INFRA_TEST_ROOT_KEY")
+		assert.NilError(t, err)
+		assert.Equal(t, string(key), "root-key-from-env")
+	})
+
+	t.Run("unknown kind is a file path", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "other:root.key")
+		assert.NilError(t, os.WriteFile(filename, []byte("file-root-key"), 0o600))
+
+		key, err := rootKeys.GetSecret(filename)
+		assert.NilError(t, err)
+		assert.Equal(t, string(key), "file-root-key")
+	})
+}
+
+func TestServer_ReloadSecrets(t *testing.T) {
+	srv := setupServer(t)
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	assert.NilError(t, os.WriteFile(passwordFile, []byte("first"), 0o600))
+	script := writeScript(t, "cat "+passwordFile)
+	srv.dbPassword = &reloadableSecret{name: "exec:" + script, storage: srv.secrets}
+
+	rootKeyID := "env:INFRA_TEST_ROOT_KEY"
+	t.Setenv("INFRA_TEST_ROOT_KEY", "0123456789abcdef0123456789abcdef")
+	provider := secrets.NewNativeKeyProvider(rootKeyStorage{file: srv.secrets["file"], storage: srv.secrets})
+	sKey, err := provider.GenerateDataKey(rootKeyID)
+	assert.NilError(t, err)
+	err = data.CreateEncryptionKey(srv.db, &models.EncryptionKey{
+		Name:      "dbkey",
+		Encrypted: sKey.Encrypted,
+		Algorithm: sKey.Algorithm,
+		RootKeyID: sKey.RootKeyID,
+	})
+	assert.NilError(t, err)
+	srv.dbKeyProvider = provider
+	srv.options.DBEncryptionKey = rootKeyID
+
+	assert.Equal(t, srv.dbPassword.get(), "")
+	assert.NilError(t, srv.ReloadSecrets())
+	assert.Equal(t, srv.dbPassword.get(), "first")
+
+	t.Run("rotated password", func(t *testing.T) {
+		assert.NilError(t, os.WriteFile(passwordFile, []byte("second"), 0o600))
+
+		assert.NilError(t, srv.ReloadSecrets())
+		assert.Equal(t, srv.dbPassword.get(), "second")
+	})
+
+	t.Run("failed reload keeps the previous password", func(t *testing.T) {
+		assert.NilError(t, os.Remove(passwordFile))
+
+		err := srv.ReloadSecrets()
+		assert.ErrorContains(t, err, "db password: ")
+		assert.Equal(t, srv.dbPassword.get(), "second")
+		assert.NilError(t, os.WriteFile(passwordFile, []byte("second"), 0o600))
+	})
+
+	t.Run("root key that does not decrypt the db key", func(t *testing.T) {
+		t.Setenv("INFRA_TEST_ROOT_KEY", "fedcba9876543210fedcba9876543210")
+
+		err := srv.ReloadSecrets()
+		assert.ErrorContains(t, err, "db encryption key: decrypt db key")
+	})
+}
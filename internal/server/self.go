@@ -0,0 +1,80 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/access"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+// GetSelf returns the user, organization, privileges, and session of the
+// caller, so that a client can learn all of them with a single request.
+func (a *API) GetSelf(c *gin.Context, _ *api.EmptyRequest) (*api.Self, error) {
+	// does not need authorization check, this action is limited to the calling key
+	rCtx := getRequestContext(c)
+	user, key := rCtx.Authenticated.User, rCtx.Authenticated.AccessKey
+	if user == nil || key == nil {
+		return nil, fmt.Errorf("no authenticated user")
+	}
+
+	privileges, err := infraPrivileges(rCtx.DBTxn, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := a.server.Google
+	if provider == nil || provider.ID != key.ProviderID {
+		provider, err = data.GetProvider(rCtx.DBTxn, data.GetProviderOptions{ByID: key.ProviderID})
+		if err != nil {
+			return nil, fmt.Errorf("get provider: %w", err)
+		}
+	}
+
+	self := &api.Self{
+		Kind:       api.SelfKindUser,
+		User:       *user.ToAPI(),
+		Privileges: privileges,
+		Organization: api.SelfOrganization{
+			ID:   rCtx.Authenticated.Organization.ID,
+			Name: rCtx.Authenticated.Organization.Name,
+		},
+		ProviderID:        provider.ID,
+		ProviderName:      provider.Name,
+		Expires:           api.Time(key.ExpiresAt),
+		InactivityTimeout: api.Time(key.InactivityTimeout),
+	}
+	if user.Name == models.InternalInfraConnectorIdentityName {
+		self.Kind = api.SelfKindConnector
+	}
+	return self, nil
+}
+
+// infraPrivileges returns the sorted roles granted to the user on the infra
+// resource, including the roles granted to the groups of the user.
+func infraPrivileges(tx data.ReadTxn, userID uid.ID) ([]string, error) {
+	grants, err := data.ListGrants(tx, data.ListGrantsOptions{
+		BySubject:                  uid.NewIdentityPolymorphicID(userID),
+		ByResource:                 access.ResourceInfraAPI,
+		IncludeInheritedFromGroups: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list grants: %w", err)
+	}
+
+	privileges := []string{}
+	seen := map[string]bool{}
+	for _, grant := range grants {
+		if !seen[grant.Privilege] {
+			seen[grant.Privilege] = true
+			privileges = append(privileges, grant.Privilege)
+		}
+	}
+	sort.Strings(privileges)
+	return privileges, nil
+}
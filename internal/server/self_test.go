@@ -0,0 +1,150 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gocmp "github.com/google/go-cmp/cmp"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/opt"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestAPI_GetSelf(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	inactivity := time.Now().Add(10 * time.Minute).Truncate(time.Second)
+
+	tx := txnForTestCase(t, srv.db, srv.db.DefaultOrg.ID)
+	provider := data.InfraProvider(tx)
+
+	createKey := func(t *testing.T, user *models.Identity) string {
+		t.Helper()
+		key, err := data.CreateAccessKey(tx, &models.AccessKey{
+			IssuedFor:           user.ID,
+			ProviderID:          provider.ID,
+			ExpiresAt:           expires,
+			InactivityTimeout:   inactivity,
+			InactivityExtension: 10 * time.Minute,
+		})
+		assert.NilError(t, err)
+		return key
+	}
+
+	admin, err := data.GetIdentity(tx, data.GetIdentityOptions{ByName: "admin@example.com"})
+	assert.NilError(t, err)
+	adminKey := createKey(t, admin)
+
+	// the user is only granted view on the infra resource through a group
+	plain := &models.Identity{Name: "plain@example.com"}
+	createIdentities(t, tx, plain)
+	group := &models.Group{Name: "viewers"}
+	assert.NilError(t, data.CreateGroup(tx, group))
+	assert.NilError(t, data.AddUsersToGroup(tx, group.ID, []uid.ID{plain.ID}))
+	assert.NilError(t, data.CreateGrant(tx, &models.Grant{
+		Subject:   uid.NewGroupPolymorphicID(group.ID),
+		Privilege: models.InfraViewRole,
+		Resource:  "infra",
+	}))
+	assert.NilError(t, data.CreateGrant(tx, &models.Grant{
+		Subject:   uid.NewIdentityPolymorphicID(plain.ID),
+		Privilege: models.InfraAdminRole,
+		Resource:  "cluster.namespace",
+	}))
+	plainKey := createKey(t, plain)
+
+	connector := data.InfraConnectorIdentity(tx)
+	connectorKey := createKey(t, connector)
+	assert.NilError(t, tx.Commit())
+
+	getSelf := func(t *testing.T, key string) (*httptest.ResponseRecorder, api.Self) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/self", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+
+		var self api.Self
+		if resp.Code == http.StatusOK {
+			assert.NilError(t, json.NewDecoder(resp.Body).Decode(&self))
+		}
+		return resp, self
+	}
+
+	org := api.SelfOrganization{ID: srv.db.DefaultOrg.ID, Name: srv.db.DefaultOrg.Name}
+	cmpSelf := gocmp.Options{
+		gocmp.FilterPath(opt.PathField(api.User{}, "LastSeenAt"), gocmp.Ignore()),
+		gocmp.FilterPath(opt.PathField(api.User{}, "Updated"), gocmp.Ignore()),
+		// the inactivity timeout may be extended by the request
+		gocmp.Comparer(func(x, y api.Time) bool {
+			d := time.Time(x).Sub(time.Time(y))
+			return d > -3*time.Second && d < 3*time.Second
+		}),
+	}
+
+	t.Run("org admin", func(t *testing.T) {
+		resp, self := getSelf(t, adminKey)
+		assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+
+		expected := api.Self{
+			Kind:              api.SelfKindUser,
+			User:              *admin.ToAPI(),
+			Organization:      org,
+			Privileges:        []string{models.InfraAdminRole},
+			ProviderID:        provider.ID,
+			ProviderName:      models.InternalInfraProviderName,
+			Expires:           api.Time(expires),
+			InactivityTimeout: api.Time(inactivity),
+		}
+		assert.DeepEqual(t, self, expected, cmpSelf)
+	})
+
+	t.Run("plain user", func(t *testing.T) {
+		resp, self := getSelf(t, plainKey)
+		assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+
+		expected := api.Self{
+			Kind:              api.SelfKindUser,
+			User:              *plain.ToAPI(),
+			Organization:      org,
+			Privileges:        []string{models.InfraViewRole},
+			ProviderID:        provider.ID,
+			ProviderName:      models.InternalInfraProviderName,
+			Expires:           api.Time(expires),
+			InactivityTimeout: api.Time(inactivity),
+		}
+		assert.DeepEqual(t, self, expected, cmpSelf)
+	})
+
+	t.Run("connector", func(t *testing.T) {
+		resp, self := getSelf(t, connectorKey)
+		assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+
+		expected := api.Self{
+			Kind:              api.SelfKindConnector,
+			User:              *connector.ToAPI(),
+			Organization:      org,
+			Privileges:        []string{models.InfraConnectorRole},
+			ProviderID:        provider.ID,
+			ProviderName:      models.InternalInfraProviderName,
+			Expires:           api.Time(expires),
+			InactivityTimeout: api.Time(inactivity),
+		}
+		assert.DeepEqual(t, self, expected, cmpSelf)
+	})
+
+	t.Run("not authenticated", func(t *testing.T) {
+		resp, _ := getSelf(t, "")
+		assert.Equal(t, resp.Code, http.StatusUnauthorized, (*responseDebug)(resp))
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
@@ -22,11 +23,17 @@ import (
 	"github.com/infrahq/infra/internal/ginutil"
 	"github.com/infrahq/infra/internal/logging"
 	"github.com/infrahq/infra/internal/repeat"
+	"github.com/infrahq/infra/internal/server/audit"
+	"github.com/infrahq/infra/internal/server/authn"
 	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/data/fixtures"
+	"github.com/infrahq/infra/internal/server/data/migrator"
 	"github.com/infrahq/infra/internal/server/email"
 	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/internal/server/providers"
 	"github.com/infrahq/infra/internal/server/redis"
 	"github.com/infrahq/infra/metrics"
+	"github.com/infrahq/infra/tracing"
 )
 
 type Options struct {
@@ -46,8 +53,68 @@ type Options struct {
 	// grouped by the request path.
 	EnableLogSampling bool
 
+	// SeedDemoData populates the default organization with demo users, groups,
+	// and grants when the server starts. Rows that already exist are not
+	// changed, so it is safe to use with an existing database.
+	SeedDemoData bool
+
+	// LogFormat is the format of the server logs. One of json, console, or
+	// auto. When auto, logs are written as JSON unless the server is being
+	// run in an interactive terminal.
+	LogFormat string
+
+	// LogFile is the path to a file where logs are written instead of stderr.
+	// Logs in the file are always written as JSON.
+	LogFile string
+	// LogRotation configures the rotation of LogFile.
+	LogRotation logging.FileLoggerOptions
+
+	// AccessLog configures the log line written for each HTTP request.
+	AccessLog logging.AccessLogOptions
+
+	// Audit configures where audit events are recorded.
+	Audit AuditOptions
+
+	// Purge configures the job that permanently deletes soft deleted rows.
+	Purge PurgeOptions
+
+	// Metrics configures the prometheus metrics served on Addr.Metrics.
+	Metrics MetricsOptions
+
+	// Tracing configures the export of OpenTelemetry traces of API requests
+	// and database queries.
+	Tracing tracing.Options
+
 	SessionDuration          time.Duration // the lifetime of the access key infra issues on login
 	SessionInactivityTimeout time.Duration // access keys issued on login must be used within this window of time, or they become invalid
+	// DisableImplicitSessionExtension stops requests from extending the
+	// inactivity timeout of the access key used for the request. When set, the
+	// timeout is only extended by POST /api/access-keys/self/extend.
+	DisableImplicitSessionExtension bool
+
+	// DestinationTokenDuration is the lifetime of the JWTs that users present
+	// to destinations. Defaults to 5 minutes. JWTs can be revoked before they
+	// expire, but a short lifetime limits how long a revoked JWT is accepted by
+	// a connector that has not received the revocation.
+	DestinationTokenDuration time.Duration
+
+	// ClockSkewLeeway is the amount of time an access key is accepted after it
+	// expires or passes its inactivity timeout, to allow for a difference
+	// between the clock of the server and the clocks of other hosts.
+	ClockSkewLeeway time.Duration
+
+	// LoginThrottle configures the delays and account lockout after failed
+	// password logins.
+	LoginThrottle authn.LoginThrottle
+
+	// OneTimePasswords configures how long one-time passwords, and the links
+	// sent to invite users and reset passwords, can be used.
+	OneTimePasswords OneTimePasswordOptions
+
+	// TrustedProxies is a list of CIDR ranges of the proxies in front of the
+	// server. The X-Forwarded-For and Forwarded headers are only used to find
+	// the IP address of a client when the request was sent by a trusted proxy.
+	TrustedProxies []string
 
 	// Redis contains configuration options to the cache server.
 	Redis redis.Options
@@ -64,6 +131,9 @@ type Options struct {
 	DBPassword              string
 	DBParameters            string
 	DBConnectionString      string
+	// DBReplicaConnectionString is the connection string for a read replica
+	// of the database. When set, read-only requests use the replica.
+	DBReplicaConnectionString string
 
 	EmailAppDomain   string
 	EmailFromAddress string
@@ -118,6 +188,89 @@ type TLSOptions struct {
 type APIOptions struct {
 	RequestTimeout         time.Duration
 	BlockingRequestTimeout time.Duration
+
+	// RateLimit is the number of requests per minute allowed for each
+	// organization. Zero disables the limit. Organizations may override the
+	// limit in their settings.
+	RateLimit int
+	// ConnectorRateLimit is the number of requests per minute allowed for the
+	// connectors of each organization. Zero disables the limit.
+	ConnectorRateLimit int
+	// MaxPaginationLimit is the largest page size allowed by list endpoints.
+	// Requests with a larger limit are rejected. Zero uses
+	// data.DefaultMaxPaginationLimit.
+	MaxPaginationLimit int
+	// MaxRequestBodySize is the largest request body, in bytes, accepted by
+	// API endpoints. Requests with a larger body are rejected. Zero uses
+	// DefaultMaxRequestBodySize.
+	MaxRequestBodySize int64
+}
+
+// DefaultMaxRequestBodySize is the default value of
+// APIOptions.MaxRequestBodySize.
+const DefaultMaxRequestBodySize = 1 << 20 // 1MB
+
+type AuditOptions struct {
+	// File is the path to a file where audit events are written as JSON lines.
+	// No file is written when File is empty.
+	File string
+	// FileRotation configures the rotation of File.
+	FileRotation logging.FileLoggerOptions
+	// Database stores audit events in the database.
+	Database bool
+	// Retention is the period audit events are kept in the database before
+	// they are purged, unless the organization sets its own retention. When
+	// zero the events are kept for one year.
+	Retention time.Duration
+}
+
+type PurgeOptions struct {
+	// Retention overrides the default period that soft deleted rows are kept
+	// before they are purged, keyed by table name.
+	Retention map[string]time.Duration
+	// BatchSize is the maximum number of rows deleted in each transaction.
+	BatchSize int
+	// BatchDelay is the time to wait between batches.
+	BatchDelay time.Duration
+}
+
+type MetricsOptions struct {
+	// BearerToken, when set, must be sent as a bearer token to read the
+	// metrics. Without it the metrics can be read by anyone who can connect to
+	// Addr.Metrics.
+	BearerToken string
+	// OrgLabel adds the ID of the organization to the labels of the HTTP
+	// request metrics. Every organization adds another set of series, so this
+	// should only be enabled when there are few organizations.
+	OrgLabel bool
+}
+
+type OneTimePasswordOptions struct {
+	// InviteExpiry is how long the one-time password of a new user, or the
+	// link in their invite email, can be used. Defaults to 7 days.
+	InviteExpiry time.Duration
+	// ResetExpiry is how long a one-time password set by an admin, or a
+	// password reset link, can be used. Defaults to 15 minutes.
+	ResetExpiry time.Duration
+}
+
+const (
+	defaultInviteExpiry        = 7 * 24 * time.Hour
+	defaultPasswordResetExpiry = 15 * time.Minute
+)
+
+func (o OneTimePasswordOptions) inviteExpiry() time.Duration {
+	if o.InviteExpiry == 0 {
+		return defaultInviteExpiry
+	}
+	return o.InviteExpiry
+}
+
+func (o OneTimePasswordOptions) resetExpiry() time.Duration {
+	if o.ResetExpiry == 0 {
+		return defaultPasswordResetExpiry
+	}
+	return o.ResetExpiry
 }
 
 type Server struct {
@@ -127,10 +280,43 @@ type Server struct {
 	tel             *Telemetry
 	secrets         map[string]secrets.SecretStorage
 	keys            map[string]secrets.SymmetricKeyProvider
+	dbKeyProvider   secrets.SymmetricKeyProvider
+	dbPassword      *reloadableSecret
 	Addrs           Addrs
 	routines        []routine
 	metricsRegistry *prometheus.Registry
+	stopTracing     func(context.Context) error
 	Google          *models.Provider
+	auditLog        *audit.Logger
+
+	caches *cacheRegistry
+	// rateLimiter limits requests by organization or user.
+	rateLimiter rateLimiter
+	// addressRateLimiter limits unauthenticated requests by client address.
+	// It is separate from rateLimiter, so that a caller with many addresses
+	// can not fill it and affect the limits of organizations and users.
+	addressRateLimiter rateLimiter
+	// addressLogins counts failed password logins by client address.
+	addressLogins addressLoginLimiter
+	// unknownUserLogins throttles password logins for users without a
+	// password, see checkLoginThrottle.
+	unknownUserLogins *unknownUserLogins
+	webhooks          *webhookDeliverer
+	trustedProxies    []*net.IPNet
+
+	// backgroundEmails tracks emails that are sent after the response to
+	// the request that sent them.
+	backgroundEmails *sync.WaitGroup
+
+	// now returns the current time. It is replaced in tests that need a
+	// deterministic clock, ex: to generate TOTP codes.
+	now func() time.Time
+}
+
+// accessKeyOptions returns the options used to check the expiry of access
+// keys, using the same clock as the rest of the server.
+func (s *Server) accessKeyOptions() data.ValidateAccessKeyOptions {
+	return data.ValidateAccessKeyOptions{Now: s.now, Leeway: s.options.ClockSkewLeeway}
 }
 
 type Addrs struct {
@@ -141,11 +327,22 @@ type Addrs struct {
 
 // newServer creates a Server with base dependencies initialized to zero values.
 func newServer(options Options) *Server {
-	return &Server{
+	server := &Server{
 		options: options,
 		secrets: map[string]secrets.SecretStorage{},
 		keys:    map[string]secrets.SymmetricKeyProvider{},
-	}
+
+		caches:             newCacheRegistry(),
+		rateLimiter:        newMemoryRateLimiter(0),
+		addressRateLimiter: newMemoryRateLimiter(maxAddressRateLimitBuckets),
+		addressLogins:      newMemoryLoginLimiter(),
+		unknownUserLogins:  newUnknownUserLogins(),
+		webhooks:           newWebhookDeliverer(),
+		backgroundEmails:   &sync.WaitGroup{},
+		now:                time.Now,
+	}
+	server.caches.register(cacheNameOIDCProviders, registeredLRUCache{cache: providers.OIDCProviderCache()})
+	return server
 }
 
 // New creates a Server, and initializes it. The returned Server is ready to run.
@@ -156,6 +353,12 @@ func New(options Options) (*Server, error) {
 
 	server := newServer(options)
 
+	trustedProxies, err := parseTrustedProxies(options.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	server.trustedProxies = trustedProxies
+
 	if err := importSecrets(options.Secrets, server.secrets); err != nil {
 		return nil, fmt.Errorf("secrets config: %w", err)
 	}
@@ -164,16 +367,21 @@ func New(options Options) (*Server, error) {
 		return nil, fmt.Errorf("key config: %w", err)
 	}
 
-	dsn, err := getPostgresConnectionString(options, server.secrets)
-	if err != nil {
-		return nil, fmt.Errorf("postgres dsn: %w", err)
+	if err := setDatabaseDSN(&options, server.secrets); err != nil {
+		return nil, err
+	}
+	options.DB.ReplicaDSN = options.DBReplicaConnectionString
+	if options.DBPassword != "" && options.DB.Driver != data.DriverSQLite {
+		// the password in the DSN is used until the secrets are reloaded
+		server.dbPassword = &reloadableSecret{name: options.DBPassword, storage: server.secrets}
+		options.DB.Password = server.dbPassword.get
 	}
-	options.DB.DSN = dsn
 
 	dbKeyProvider, ok := server.keys[options.DBEncryptionKeyProvider]
 	if !ok {
 		return nil, fmt.Errorf("key provider %s not configured", options.DBEncryptionKeyProvider)
 	}
+	server.dbKeyProvider = dbKeyProvider
 	options.DB.EncryptionKeyProvider = dbKeyProvider
 	options.DB.RootKeyID = options.DBEncryptionKey
 
@@ -181,8 +389,18 @@ func New(options Options) (*Server, error) {
 	if err != nil {
 		return nil, fmt.Errorf("db: %w", err)
 	}
+	if err := data.CheckDBKeyRotation(db); err != nil {
+		db.Close()
+		return nil, err
+	}
 	server.db = db
-	server.metricsRegistry = setupMetrics(server.db)
+	server.caches.register(cacheNameDBReads, db)
+	server.metricsRegistry = setupMetrics(server.db, options.Metrics.OrgLabel, providers.OIDCProviderCache(), server.unknownUserLogins.creds)
+	server.stopTracing, err = tracing.Setup(context.Background(), "infra-server", options.Tracing)
+	if err != nil {
+		return nil, err
+	}
+	server.auditLog = newAuditLogger(options.Audit, server.db)
 
 	redisPassword, err := secrets.GetSecret(options.Redis.Password, server.secrets)
 	if err != nil {
@@ -190,11 +408,16 @@ func New(options Options) (*Server, error) {
 	}
 
 	options.Redis.Password = redisPassword
-	redis, err := redis.NewRedis(options.Redis)
+	server.redis, err = redis.NewRedis(options.Redis)
 	if err != nil {
 		return nil, err
 	}
-	server.redis = redis
+	if server.redis != nil {
+		// share the rate limits with the other replicas of the server
+		server.rateLimiter = redis.NewLimiter(server.redis)
+		server.addressRateLimiter = server.rateLimiter
+		server.addressLogins = redis.NewLimiter(server.redis)
+	}
 
 	if options.EnableTelemetry {
 		server.tel = NewTelemetry(server.db, db.DefaultOrgSettings.ID)
@@ -220,6 +443,12 @@ func New(options Options) (*Server, error) {
 		return nil, fmt.Errorf("configs: %w", err)
 	}
 
+	if options.SeedDemoData {
+		if err := server.seedDemoData(); err != nil {
+			return nil, fmt.Errorf("seed demo data: %w", err)
+		}
+	}
+
 	if err := server.listen(); err != nil {
 		return nil, fmt.Errorf("listening: %w", err)
 	}
@@ -229,6 +458,20 @@ func New(options Options) (*Server, error) {
 	return server, nil
 }
 
+func (s *Server) seedDemoData() error {
+	tx, err := s.db.Begin(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer logError(tx.Rollback, "failed to rollback seed demo data transaction")
+	tx = tx.WithOrgID(s.db.DefaultOrg.ID)
+
+	if err := fixtures.SeedDemo(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 // DB returns an instance of a database connection pool that is used by the server.
 // It is primarily used by tests to create fixture data.
 func (s *Server) DB() *data.DB {
@@ -265,6 +508,14 @@ func (s *Server) Run(ctx context.Context) error {
 	err := group.Wait()
 	s.tel.Close()
 
+	if s.stopTracing != nil {
+		stopCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := s.stopTracing(stopCtx); err != nil {
+			logging.L.Warn().Err(err).Msg("failed to flush traces")
+		}
+		cancel()
+	}
+
 	if err := s.db.Close(); err != nil {
 		logging.L.Warn().Err(err).Msg("failed to close database connection")
 	}
@@ -318,7 +569,7 @@ func (s *Server) listen() error {
 		ReadHeaderTimeout: 30 * time.Second,
 		ReadTimeout:       60 * time.Second,
 		Addr:              s.options.Addr.Metrics,
-		Handler:           metrics.NewHandler(s.metricsRegistry),
+		Handler:           metrics.NewHandler(s.metricsRegistry, metrics.HandlerOptions{BearerToken: s.options.Metrics.BearerToken}),
 		ErrorLog:          httpErrorLog,
 	}
 
@@ -395,6 +646,88 @@ type routine struct {
 	stop func()
 }
 
+// PendingMigrations connects to the database configured by options, and
+// returns the migrations that would be applied by New, without applying them.
+func PendingMigrations(options Options) ([]migrator.MigrationStatus, error) {
+	storage := map[string]secrets.SecretStorage{}
+	if err := importSecrets(options.Secrets, storage); err != nil {
+		return nil, fmt.Errorf("secrets config: %w", err)
+	}
+
+	if err := setDatabaseDSN(&options, storage); err != nil {
+		return nil, err
+	}
+	return data.PendingMigrations(options.DB)
+}
+
+// rotateDBKeyBatchSize is the number of rows re-encrypted in each transaction
+// when the database encryption key is rotated.
+const rotateDBKeyBatchSize = 500
+
+// RotateDBEncryptionKey replaces the key used to encrypt secrets in the
+// database with a new key, encrypted by the root key options.DBEncryptionKey,
+// and re-encrypts every secret with the new key. The server must not be
+// running, and all migrations must be applied.
+func RotateDBEncryptionKey(options Options) error {
+	storage := map[string]secrets.SecretStorage{}
+	if err := importSecrets(options.Secrets, storage); err != nil {
+		return fmt.Errorf("secrets config: %w", err)
+	}
+
+	keys := map[string]secrets.SymmetricKeyProvider{}
+	if err := importKeyProviders(options.Keys, storage, keys); err != nil {
+		return fmt.Errorf("key config: %w", err)
+	}
+
+	if err := setDatabaseDSN(&options, storage); err != nil {
+		return err
+	}
+
+	keyProvider, ok := keys[options.DBEncryptionKeyProvider]
+	if !ok {
+		return fmt.Errorf("key provider %s not configured", options.DBEncryptionKeyProvider)
+	}
+
+	pending, err := data.PendingMigrations(options.DB)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("the database has %d pending migrations, start the server to apply them before rotating the key", len(pending))
+	}
+
+	// the current key is loaded by RotateDBKey, because it may be encrypted
+	// by a different root key than options.DBEncryptionKey
+	db, err := data.NewDB(options.DB)
+	if err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+	defer db.Close()
+
+	return data.RotateDBKey(db, keyProvider, options.DBEncryptionKey, rotateDBKeyBatchSize)
+}
+
+// setDatabaseDSN sets the data source name of options.DB from the database
+// options. When the driver is sqlite DBConnectionString is the path to the
+// database file.
+func setDatabaseDSN(options *Options, secretStorage map[string]secrets.SecretStorage) error {
+	if err := data.ValidateDriver(options.DB.Driver); err != nil {
+		return err
+	}
+
+	if options.DB.Driver == data.DriverSQLite {
+		options.DB.DSN = options.DBConnectionString
+		return nil
+	}
+
+	dsn, err := getPostgresConnectionString(*options, secretStorage)
+	if err != nil {
+		return fmt.Errorf("postgres dsn: %w", err)
+	}
+	options.DB.DSN = dsn
+	return nil
+}
+
 // getPostgresConnectionString parses postgres configuration options and returns the connection string
 func getPostgresConnectionString(options Options, secretStorage map[string]secrets.SecretStorage) (string, error) {
 	var pgConn strings.Builder
@@ -24,6 +24,7 @@ import (
 	"github.com/infrahq/infra/api"
 	"github.com/infrahq/infra/internal/cmd/types"
 	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/server/data/fixtures"
 	"github.com/infrahq/infra/internal/testing/database"
 )
 
@@ -44,6 +45,7 @@ func setupServer(t *testing.T, ops ...func(*testing.T, *Options)) *Server {
 	}
 	s := newServer(options)
 	s.db = setupDB(t)
+	s.caches.register(cacheNameDBReads, s.db)
 
 	// TODO: share more of this with Server.New
 	err := loadDefaultSecretConfig(s.secrets)
@@ -120,7 +122,8 @@ func TestServer_Run(t *testing.T) {
 			CA:           types.StringOrFile(golden.Get(t, "pki/ca.crt")),
 			CAPrivateKey: string(golden.Get(t, "pki/ca.key")),
 		},
-		API: APIOptions{RequestTimeout: time.Minute},
+		API:     APIOptions{RequestTimeout: time.Minute},
+		Metrics: MetricsOptions{BearerToken: "metrics-token"},
 	}
 
 	driver := database.PostgresDriver(t, "_server_run")
@@ -146,11 +149,26 @@ func TestServer_Run(t *testing.T) {
 		defer resp.Body.Close()
 		assert.Equal(t, http.StatusOK, resp.StatusCode)
 
+		// a request without an access key, to populate the auth failure metric
+		req, err = http.NewRequest("GET", "http://"+srv.Addrs.HTTP.String()+"/api/users", nil)
+		assert.NilError(t, err)
+		req.Header.Set("Infra-Version", apiVersionLatest)
+
+		resp, err = http.DefaultClient.Do(req)
+		assert.NilError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
 		// nolint:noctx
 		req, err = http.NewRequest("GET", "http://"+srv.Addrs.Metrics.String()+"/metrics", nil)
 		assert.NilError(t, err)
-		req.Header.Set("Infra-Version", apiVersionLatest)
 
+		resp, err = http.DefaultClient.Do(req)
+		assert.NilError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "metrics require the bearer token")
+
+		req.Header.Set("Authorization", "Bearer metrics-token")
 		resp, err = http.DefaultClient.Do(req)
 		assert.NilError(t, err)
 		defer resp.Body.Close()
@@ -160,6 +178,13 @@ func TestServer_Run(t *testing.T) {
 		assert.NilError(t, err)
 		// the infra http request metric
 		assert.Assert(t, is.Contains(string(body), "# HELP http_request_duration_seconds"))
+		assert.Assert(t, is.Contains(string(body),
+			`http_request_duration_seconds_count{blocking="false",method="GET",path="/api/version",status="2xx"} 1`))
+		assert.Assert(t, is.Contains(string(body),
+			`http_request_duration_seconds_count{blocking="false",method="GET",path="/api/users",status="4xx"} 1`))
+		// authentication and database metrics
+		assert.Assert(t, is.Contains(string(body), `infra_authn_failures_total{reason="missing_token"}`))
+		assert.Assert(t, is.Contains(string(body), "# TYPE infra_db_query_duration_seconds histogram"))
 		// standard go metrics
 		assert.Assert(t, is.Contains(string(body), "# HELP go_threads"))
 		// standard process metrics
@@ -417,3 +442,33 @@ func TestServer_PersistSignupUser(t *testing.T) {
 	// retry the authenticated endpoint
 	checkAuthenticated()
 }
+
+func TestServer_SeedDemoData(t *testing.T) {
+	s := setupServer(t)
+	routes := s.GenerateRoutes()
+
+	// seeding is idempotent, so a restart seeds the same data again
+	assert.NilError(t, s.seedDemoData())
+	assert.NilError(t, s.seedDemoData())
+
+	tx, err := s.db.Begin(context.Background(), nil)
+	assert.NilError(t, err)
+	alice, err := fixtures.User("alice@example.com").WithKey(time.Minute).Create(tx.WithOrgID(s.db.DefaultOrg.ID))
+	assert.NilError(t, err)
+	assert.NilError(t, tx.Commit())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/groups", nil)
+	req.Header.Set("Authorization", "Bearer "+alice.Secrets[0])
+	req.Header.Set("Infra-Version", apiVersionLatest)
+	resp := httptest.NewRecorder()
+	routes.ServeHTTP(resp, req)
+	assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+	groups := api.ListResponse[api.Group]{}
+	assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &groups))
+	var names []string
+	for _, group := range groups.Items {
+		names = append(names, group.Name)
+	}
+	assert.DeepEqual(t, names, []string{"Engineering", "Operations"})
+}
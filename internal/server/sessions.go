@@ -0,0 +1,85 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/access"
+	"github.com/infrahq/infra/internal/server/audit"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+// ListUserSessions lists the access keys of a user, with the client that last
+// used each key.
+func (a *API) ListUserSessions(c *gin.Context, r *api.ListUserSessionsRequest) (*api.ListResponse[api.UserSession], error) {
+	p := PaginationFromRequest(r.PaginationRequest)
+	keys, err := access.ListUserSessions(getRequestContext(c), r.ID, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	result := api.NewListResponse(keys, PaginationToResponse(p), func(key models.AccessKey) api.UserSession {
+		return *key.ToUserSession()
+	})
+	return result, nil
+}
+
+// DeleteUserSessions revokes every session of a user, except for the access
+// keys in the request. It is used to sign out a user from every client, for
+// example when the user leaves the organization.
+func (a *API) DeleteUserSessions(c *gin.Context, r *api.DeleteUserSessionsRequest) (*api.EmptyResponse, error) {
+	deleted, err := access.DeleteUserSessions(getRequestContext(c), r.ID, r.NotIDs)
+	if err != nil {
+		a.recordAuditOnCommit(c, audit.ActionAccessKeyDelete, auditTarget{Type: "user", ID: r.ID.String()}, err)
+		return nil, err
+	}
+	for _, key := range deleted {
+		a.recordAuditOnCommit(c, audit.ActionAccessKeyDelete, accessKeyAuditTarget(&key), nil)
+		if err := a.emitWebhookEvent(c, api.WebhookEventAccessKeyRevoked, key.ToAPI()); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// ImpersonateUser creates a short-lived access key that a support admin uses
+// to act as another user. Every request made with the key is audited with
+// both the user and the support admin.
+func (a *API) ImpersonateUser(c *gin.Context, r *api.ImpersonateUserRequest) (*api.ImpersonateUserResponse, error) {
+	key, body, err := access.ImpersonateUser(getRequestContext(c), r.ID, r.ApprovedBy)
+	a.recordAuditOnCommit(c, audit.ActionUserImpersonate, auditTarget{Type: "user", ID: r.ID.String()}, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.ImpersonateUserResponse{
+		ID:        key.ID,
+		IssuedFor: key.IssuedFor,
+		Expires:   api.Time(key.ExpiresAt),
+		AccessKey: body,
+	}, nil
+}
+
+// CreateImpersonationApproval allows another support admin to impersonate a
+// user with an admin role once. Impersonating an admin requires this approval,
+// so that one support admin can not act as an admin alone.
+func (a *API) CreateImpersonationApproval(c *gin.Context, r *api.CreateImpersonationApprovalRequest) (*api.ImpersonationApproval, error) {
+	approval, err := access.ApproveImpersonation(getRequestContext(c), r.ID, r.Impersonator)
+	target := auditTarget{
+		Type:     "user",
+		ID:       r.ID.String(),
+		Metadata: models.JSONMap{"impersonator": r.Impersonator.String()},
+	}
+	a.recordAuditOnCommit(c, audit.ActionUserImpersonateApprove, target, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.ImpersonationApproval{
+		ID:           approval.ID,
+		User:         approval.IdentityID,
+		Impersonator: approval.ImpersonatorID,
+		ApprovedBy:   approval.ApprovedBy,
+		Expires:      api.Time(approval.ExpiresAt),
+	}, nil
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestAPI_UserSessions(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+
+	provider := data.InfraProvider(srv.DB())
+	createKey := func(t *testing.T, user *models.Identity, name string) (*models.AccessKey, string) {
+		t.Helper()
+		key := &models.AccessKey{
+			Name:       name,
+			IssuedFor:  user.ID,
+			ProviderID: provider.ID,
+			ExpiresAt:  time.Now().Add(time.Hour),
+		}
+		token, err := data.CreateAccessKey(srv.DB(), key)
+		assert.NilError(t, err)
+		return key, token
+	}
+
+	alice := &models.Identity{Name: "alice@example.com"}
+	bob := &models.Identity{Name: "bob@example.com"}
+	createIdentities(t, srv.DB(), alice, bob)
+
+	aliceLaptop, aliceLaptopToken := createKey(t, alice, "alice-laptop")
+	aliceCI, aliceCIToken := createKey(t, alice, "alice-ci")
+	_, bobLaptopToken := createKey(t, bob, "bob-laptop")
+	_, bobCIToken := createKey(t, bob, "bob-ci")
+
+	request := func(t *testing.T, method, path, token string) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		req.Header.Set("User-Agent", "the-agent/1.0")
+		req.RemoteAddr = "192.0.2.10:4321"
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	listSessions := func(t *testing.T, userID uid.ID) []api.UserSession {
+		t.Helper()
+		resp := request(t, http.MethodGet, "/api/users/"+userID.String()+"/sessions", adminAccessKey(srv))
+		assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+
+		var respBody api.ListResponse[api.UserSession]
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &respBody))
+		return respBody.Items
+	}
+
+	sessionNames := func(sessions []api.UserSession) []string {
+		var names []string
+		for _, session := range sessions {
+			names = append(names, session.Name)
+		}
+		return names
+	}
+
+	// use the laptop key, so that the last use is recorded
+	resp := request(t, http.MethodGet, "/api/users/self", aliceLaptopToken)
+	assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+
+	t.Run("list sessions", func(t *testing.T) {
+		sessions := listSessions(t, alice.ID)
+		assert.DeepEqual(t, sessionNames(sessions), []string{"alice-ci", "alice-laptop"})
+
+		laptop := sessions[1]
+		assert.Equal(t, laptop.ID, aliceLaptop.ID)
+		assert.Equal(t, laptop.LastUsedIP, "192.0.2.10")
+		assert.Equal(t, laptop.LastUsedUserAgent, "the-agent/1.0")
+		assert.Assert(t, time.Since(laptop.LastUsed.Time()) < time.Minute)
+
+		ci := sessions[0]
+		assert.Equal(t, ci.LastUsedIP, "")
+		assert.Equal(t, ci.LastUsedUserAgent, "")
+
+		assert.DeepEqual(t, sessionNames(listSessions(t, bob.ID)), []string{"bob-ci", "bob-laptop"})
+	})
+
+	t.Run("non-admin can not list sessions", func(t *testing.T) {
+		resp := request(t, http.MethodGet, "/api/users/"+bob.ID.String()+"/sessions", aliceLaptopToken)
+		assert.Equal(t, resp.Code, http.StatusForbidden, (*responseDebug)(resp))
+	})
+
+	t.Run("non-admin can not delete sessions", func(t *testing.T) {
+		resp := request(t, http.MethodDelete, "/api/users/"+bob.ID.String()+"/sessions", aliceLaptopToken)
+		assert.Equal(t, resp.Code, http.StatusForbidden, (*responseDebug)(resp))
+
+		resp = request(t, http.MethodGet, "/api/users/self", bobLaptopToken)
+		assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		resp := request(t, http.MethodGet, "/api/users/"+uid.New().String()+"/sessions", adminAccessKey(srv))
+		assert.Equal(t, resp.Code, http.StatusNotFound, (*responseDebug)(resp))
+
+		resp = request(t, http.MethodDelete, "/api/users/"+uid.New().String()+"/sessions", adminAccessKey(srv))
+		assert.Equal(t, resp.Code, http.StatusNotFound, (*responseDebug)(resp))
+	})
+
+	t.Run("delete sessions except notIDs", func(t *testing.T) {
+		_, err := data.CreateIdentityToken(srv.DB(), alice.ID, "the-dest", time.Minute)
+		assert.NilError(t, err)
+
+		path := "/api/users/" + alice.ID.String() + "/sessions?notIDs=" + aliceCI.ID.String()
+		resp := request(t, http.MethodDelete, path, adminAccessKey(srv))
+		assert.Equal(t, resp.Code, http.StatusNoContent, (*responseDebug)(resp))
+
+		resp = request(t, http.MethodGet, "/api/users/self", aliceLaptopToken)
+		assert.Equal(t, resp.Code, http.StatusUnauthorized, (*responseDebug)(resp))
+		resp = request(t, http.MethodGet, "/api/users/self", aliceCIToken)
+		assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+
+		assert.DeepEqual(t, sessionNames(listSessions(t, alice.ID)), []string{"alice-ci"})
+
+		// tokens issued for destinations are revoked
+		revoked, err := data.ListRevokedTokens(srv.DB(), "the-dest")
+		assert.NilError(t, err)
+		assert.Equal(t, len(revoked), 1)
+		assert.Equal(t, revoked[0].IdentityID, alice.ID)
+
+		// the sessions of other users are not deleted
+		assert.DeepEqual(t, sessionNames(listSessions(t, bob.ID)), []string{"bob-ci", "bob-laptop"})
+		resp = request(t, http.MethodGet, "/api/users/self", bobCIToken)
+		assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+	})
+
+	t.Run("delete own sessions keeps the key used by the request", func(t *testing.T) {
+		admin, err := data.GetIdentity(srv.DB(), data.GetIdentityOptions{ByName: "admin@example.com"})
+		assert.NilError(t, err)
+		_, otherAdminToken := createKey(t, admin, "admin-other")
+
+		resp := request(t, http.MethodDelete, "/api/users/"+admin.ID.String()+"/sessions", adminAccessKey(srv))
+		assert.Equal(t, resp.Code, http.StatusNoContent, (*responseDebug)(resp))
+
+		resp = request(t, http.MethodGet, "/api/users/self", otherAdminToken)
+		assert.Equal(t, resp.Code, http.StatusUnauthorized, (*responseDebug)(resp))
+		resp = request(t, http.MethodGet, "/api/users/self", adminAccessKey(srv))
+		assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+	})
+}
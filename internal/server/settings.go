@@ -1,24 +1,79 @@
 package server
 
 import (
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/ssh"
 
 	"github.com/infrahq/infra/api"
 	"github.com/infrahq/infra/internal/access"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/internal/validate"
 )
 
+// publicKeyAlgorithms are the SSH key types that may be used in
+// Settings.PublicKeyAlgorithms.
+var publicKeyAlgorithms = []string{
+	ssh.KeyAlgoRSA,
+	ssh.KeyAlgoECDSA256,
+	ssh.KeyAlgoECDSA384,
+	ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoSKECDSA256,
+	ssh.KeyAlgoED25519,
+	ssh.KeyAlgoSKED25519,
+}
+
 func (a *API) GetSettings(c *gin.Context, r *api.EmptyRequest) (*api.Settings, error) {
 	settings, err := access.GetSettings(c)
 	if err != nil {
 		return nil, fmt.Errorf("get settings: %w", err)
 	}
+	resp := settings.ToAPI()
+
+	// password requirements are public so that they can be shown when setting
+	// a password. The remaining settings are only visible to admins.
+	if getRequestContext(c).Authenticated.User == nil {
+		return resp, nil
+	}
+	orgSettings, err := access.GetOrgSettings(c)
+	switch {
+	case errors.Is(err, access.ErrNotAuthorized):
+	case err != nil:
+		return nil, fmt.Errorf("get org settings: %w", err)
+	default:
+		a.setOrgSettingsResponse(resp, orgSettings)
+	}
 
-	return settings.ToAPI(), nil
+	return resp, nil
 }
 
 func (a *API) UpdateSettings(c *gin.Context, s *api.Settings) (*api.Settings, error) {
+	if err := validatePublicKeyAlgorithms(s.PublicKeyAlgorithms); err != nil {
+		return nil, err
+	}
+	if s.AccessKeyTTL < 0 {
+		return nil, validate.Error{"accessKeyTTL": {"must not be negative"}}
+	}
+	if s.MaxAccessKeyTTL < 0 {
+		return nil, validate.Error{"maxAccessKeyTTL": {"must not be negative"}}
+	}
+	if s.MaxAccessKeyTTL > 0 && s.AccessKeyTTL > s.MaxAccessKeyTTL {
+		return nil, validate.Error{"accessKeyTTL": {"must not be longer than maxAccessKeyTTL"}}
+	}
+	if s.SessionInactivityTimeout < 0 {
+		return nil, validate.Error{"sessionInactivityTimeout": {"must not be negative"}}
+	}
+	if s.AuditEventRetention < 0 {
+		return nil, validate.Error{"auditEventRetention": {"must not be negative"}}
+	}
+	if err := validateSignupDomains(s.AllowedSignupDomains); err != nil {
+		return nil, err
+	}
+
 	settings, err := access.GetSettings(c)
 	if err != nil {
 		return nil, err
@@ -29,5 +84,79 @@ func (a *API) UpdateSettings(c *gin.Context, s *api.Settings) (*api.Settings, er
 		return nil, err
 	}
 
-	return s, nil
+	// load the existing org settings so that fields which are not part of
+	// api.Settings (ex: rate limits) are preserved
+	orgSettings, err := access.GetOrgSettings(c)
+	if err != nil {
+		return nil, err
+	}
+	orgSettings.AccessKeyTTL = time.Duration(s.AccessKeyTTL)
+	orgSettings.MaxAccessKeyTTL = time.Duration(s.MaxAccessKeyTTL)
+	orgSettings.SessionInactivityTimeout = time.Duration(s.SessionInactivityTimeout)
+	orgSettings.PublicKeyAlgorithms = s.PublicKeyAlgorithms
+	orgSettings.AllowedSignupDomains = s.AllowedSignupDomains
+	orgSettings.RequireMFA = s.RequireMFA
+	orgSettings.AuditEventRetention = time.Duration(s.AuditEventRetention)
+	if err := access.SaveOrgSettings(c, orgSettings); err != nil {
+		return nil, err
+	}
+
+	resp := settings.ToAPI()
+	a.setOrgSettingsResponse(resp, orgSettings)
+	return resp, nil
+}
+
+// setOrgSettingsResponse sets the fields of resp from settings, using the
+// server defaults for any fields that are not set.
+func (a *API) setOrgSettingsResponse(resp *api.Settings, settings *models.OrgSettings) {
+	resp.AccessKeyTTL = api.Duration(settings.AccessKeyTTL)
+	if resp.AccessKeyTTL == 0 {
+		resp.AccessKeyTTL = api.Duration(a.server.options.SessionDuration)
+	}
+	resp.MaxAccessKeyTTL = api.Duration(settings.MaxAccessKeyTTL)
+	resp.SessionInactivityTimeout = api.Duration(settings.SessionInactivityTimeout)
+	if resp.SessionInactivityTimeout == 0 {
+		resp.SessionInactivityTimeout = api.Duration(a.server.options.SessionInactivityTimeout)
+	}
+	resp.PublicKeyAlgorithms = settings.PublicKeyAlgorithms
+	if resp.PublicKeyAlgorithms == nil {
+		resp.PublicKeyAlgorithms = []string{}
+	}
+	resp.AllowedSignupDomains = settings.AllowedSignupDomains
+	if resp.AllowedSignupDomains == nil {
+		resp.AllowedSignupDomains = []string{}
+	}
+	resp.RequireMFA = settings.RequireMFA
+	resp.AuditEventRetention = api.Duration(settings.AuditEventRetention)
+	if resp.AuditEventRetention == 0 {
+		resp.AuditEventRetention = api.Duration(a.server.options.Audit.Retention)
+	}
+	if resp.AuditEventRetention == 0 {
+		resp.AuditEventRetention = api.Duration(defaultAuditEventRetention)
+	}
+}
+
+func validateSignupDomains(domains []string) error {
+	for _, domain := range domains {
+		if domain == "" || strings.ContainsAny(domain, "@, ") {
+			return validate.Error{"allowedSignupDomains": {fmt.Sprintf("invalid email domain %q", domain)}}
+		}
+	}
+	return nil
+}
+
+func validatePublicKeyAlgorithms(algos []string) error {
+	for _, algo := range algos {
+		valid := false
+		for _, known := range publicKeyAlgorithms {
+			if algo == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return validate.Error{"publicKeyAlgorithms": {fmt.Sprintf("unsupported key type %q", algo)}}
+		}
+	}
+	return nil
 }
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+)
+
+func TestAPI_Settings(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+
+	getSettings := func(t *testing.T, key string) *api.Settings {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/settings", nil)
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		settings := &api.Settings{}
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), settings))
+		return settings
+	}
+
+	updateSettings := func(t *testing.T, body api.Settings) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPut, "/api/settings", jsonBody(t, body))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		settings := getSettings(t, adminAccessKey(srv))
+		expected := &api.Settings{
+			PasswordRequirements:     api.PasswordRequirements{LengthMin: 8},
+			AccessKeyTTL:             api.Duration(srv.options.SessionDuration),
+			SessionInactivityTimeout: api.Duration(srv.options.SessionInactivityTimeout),
+			PublicKeyAlgorithms:      []string{},
+			AllowedSignupDomains:     []string{},
+			AuditEventRetention:      api.Duration(defaultAuditEventRetention),
+		}
+		assert.DeepEqual(t, settings, expected)
+	})
+
+	t.Run("org settings are not public", func(t *testing.T) {
+		settings := getSettings(t, "")
+		expected := &api.Settings{
+			PasswordRequirements: api.PasswordRequirements{LengthMin: 8},
+		}
+		assert.DeepEqual(t, settings, expected)
+	})
+
+	t.Run("invalid public key algorithm", func(t *testing.T) {
+		resp := updateSettings(t, api.Settings{
+			PasswordRequirements: api.PasswordRequirements{LengthMin: 8},
+			PublicKeyAlgorithms:  []string{"ssh-dss"},
+		})
+		assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+	})
+
+	t.Run("invalid signup domain", func(t *testing.T) {
+		resp := updateSettings(t, api.Settings{
+			PasswordRequirements: api.PasswordRequirements{LengthMin: 8},
+			AllowedSignupDomains: []string{"user@example.com"},
+		})
+		assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+	})
+
+	t.Run("access key TTL longer than the maximum", func(t *testing.T) {
+		resp := updateSettings(t, api.Settings{
+			PasswordRequirements: api.PasswordRequirements{LengthMin: 8},
+			AccessKeyTTL:         api.Duration(48 * time.Hour),
+			MaxAccessKeyTTL:      api.Duration(24 * time.Hour),
+		})
+		assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+	})
+
+	t.Run("update", func(t *testing.T) {
+		tx := txnForTestCase(t, srv.db, srv.db.DefaultOrg.ID)
+		assert.NilError(t, data.UpdateOrgSettings(tx, &models.OrgSettings{RateLimit: 100}))
+		assert.NilError(t, tx.Commit())
+
+		body := api.Settings{
+			PasswordRequirements:     api.PasswordRequirements{LengthMin: 10},
+			AccessKeyTTL:             api.Duration(2 * time.Hour),
+			MaxAccessKeyTTL:          api.Duration(24 * time.Hour),
+			SessionInactivityTimeout: api.Duration(time.Hour),
+			PublicKeyAlgorithms:      []string{"ssh-ed25519"},
+			AllowedSignupDomains:     []string{"example.com"},
+			AuditEventRetention:      api.Duration(90 * 24 * time.Hour),
+		}
+		resp := updateSettings(t, body)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		settings := getSettings(t, adminAccessKey(srv))
+		assert.DeepEqual(t, settings, &body)
+
+		// settings that are not part of the request are not changed
+		orgSettings, err := data.GetOrgSettings(srv.db)
+		assert.NilError(t, err)
+		assert.Equal(t, orgSettings.RateLimit, 100)
+	})
+}
+
+func TestServer_orgSettings(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+	db := srv.DB()
+
+	settings, err := srv.orgSettings(db)
+	assert.NilError(t, err)
+	assert.Equal(t, settings.AccessKeyTTL, srv.options.SessionDuration)
+	assert.Equal(t, settings.SessionInactivityTimeout, srv.options.SessionInactivityTimeout)
+
+	// the cached settings are invalidated when they are updated
+	err = data.UpdateOrgSettings(db, &models.OrgSettings{AccessKeyTTL: 3 * time.Hour})
+	assert.NilError(t, err)
+	settings, err = srv.orgSettings(db)
+	assert.NilError(t, err)
+	assert.Equal(t, settings.AccessKeyTTL, 3*time.Hour)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/settings", jsonBody(t, api.Settings{
+		PasswordRequirements: api.PasswordRequirements{LengthMin: 8},
+		AccessKeyTTL:         api.Duration(4 * time.Hour),
+	}))
+	req.Header.Set("Infra-Version", apiVersionLatest)
+	req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+	resp := httptest.NewRecorder()
+	routes.ServeHTTP(resp, req)
+	assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+	settings, err = srv.orgSettings(db)
+	assert.NilError(t, err)
+	assert.Equal(t, settings.AccessKeyTTL, 4*time.Hour)
+
+	// new access keys use the setting as the default expiry
+	user := createUser(t, srv, routes, "defaults@example.com")
+	req = httptest.NewRequest(http.MethodPost, "/api/access-keys", jsonBody(t, api.CreateAccessKeyRequest{
+		UserID: user.ID,
+	}))
+	req.Header.Set("Infra-Version", apiVersionLatest)
+	req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+	resp = httptest.NewRecorder()
+	routes.ServeHTTP(resp, req)
+	assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+
+	key := &api.CreateAccessKeyResponse{}
+	assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), key))
+	assert.Assert(t, time.Until(key.Expires.Time()) > 3*time.Hour, key.Expires)
+	assert.Assert(t, time.Until(key.InactivityTimeout.Time()) <= srv.options.SessionInactivityTimeout)
+}
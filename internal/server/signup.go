@@ -105,7 +105,7 @@ func (a *API) Signup(c *gin.Context, r *api.SignupRequest) (*api.SignupResponse,
 		Domain:  a.server.options.BaseDomain,
 		Expires: time.Now().Add(1 * time.Minute),
 	}
-	setCookie(c.Request, c.Writer, cookie)
+	setCookie(c.Writer, cookie)
 
 	a.t.User(created.Identity.ID.String(), created.Identity.Name)
 	a.t.Org(created.Organization.ID.String(), created.Identity.ID.String(), created.Organization.Name, created.Organization.Domain)
@@ -225,6 +225,14 @@ func createOrgAndUserForSignup(c *gin.Context, keyExpiresAt time.Time, baseDomai
 
 	db = db.WithOrgID(details.Org.ID)
 	rCtx.DBTxn = db
+
+	if len(details.Org.AllowedDomains) > 0 {
+		// users with the same email domain as the admin can sign up with social login
+		settings := &models.OrgSettings{AllowedSignupDomains: details.Org.AllowedDomains}
+		if err := data.UpdateOrgSettings(db, settings); err != nil {
+			return nil, fmt.Errorf("update org settings on sign-up: %w", err)
+		}
+	}
 	rCtx.Authenticated.Organization = details.Org
 	c.Set(access.RequestContextKey, rCtx)
 
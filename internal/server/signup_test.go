@@ -59,9 +59,9 @@ func TestAPI_Signup(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{FieldName: "", Errors: []string{"one of (social, user) is required"}},
-					{FieldName: "orgName", Errors: []string{"is required"}},
-					{FieldName: "subDomain", Errors: []string{"is required"}},
+					{FieldName: "", ErrorCode: api.ErrorCodeInvalid, Errors: []string{"one of (social, user) is required"}},
+					{FieldName: "orgName", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
+					{FieldName: "subDomain", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
 			},
@@ -162,10 +162,10 @@ func TestAPI_SignupSocial(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{FieldName: "orgName", Errors: []string{"is required"}},
-					{FieldName: "social.code", Errors: []string{"is required"}},
-					{FieldName: "social.redirectURL", Errors: []string{"is required"}},
-					{FieldName: "subDomain", Errors: []string{"is required"}},
+					{FieldName: "orgName", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
+					{FieldName: "social.code", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
+					{FieldName: "social.redirectURL", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
+					{FieldName: "subDomain", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
 			},
@@ -230,6 +230,13 @@ func TestAPI_SignupSocial(t *testing.T) {
 				tx, err := srv.db.Begin(context.Background(), nil)
 				assert.NilError(t, err)
 				validateSuccessfulSignup(t, tx, validateTestSignup)
+
+				// users with the same email domain can sign up
+				org, err := data.GetOrganization(tx, data.GetOrganizationOptions{ByDomain: "success-social.exampledomain.com"})
+				assert.NilError(t, err)
+				settings, err := data.GetOrgSettings(tx.WithOrgID(org.ID))
+				assert.NilError(t, err)
+				assert.DeepEqual(t, settings.AllowedSignupDomains, models.CommaSeparatedStrings{"bruce-macdonald.com"})
 				assert.NilError(t, tx.Commit())
 			},
 		},
@@ -388,7 +395,7 @@ func TestAPI_SignupOrg(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{FieldName: "subDomain", Errors: []string{
+					{FieldName: "subDomain", ErrorCode: api.ErrorCodeInvalid, Errors: []string{
 						"must be at least 4 characters",
 						"character '@' at position 1 is not allowed",
 					}},
@@ -416,7 +423,7 @@ func TestAPI_SignupOrg(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{FieldName: "user.password", Errors: []string{
+					{FieldName: "user.password", ErrorCode: api.ErrorCodeInvalid, Errors: []string{
 						"must be at least 8 characters",
 					}},
 				}
@@ -442,10 +449,10 @@ func TestAPI_SignupOrg(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{FieldName: "orgName", Errors: []string{"is required"}},
-					{FieldName: "subDomain", Errors: []string{"is required"}},
-					{FieldName: "user.password", Errors: []string{"is required"}},
-					{FieldName: "user.username", Errors: []string{"is required"}},
+					{FieldName: "orgName", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
+					{FieldName: "subDomain", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
+					{FieldName: "user.password", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
+					{FieldName: "user.username", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
 			},
@@ -505,7 +512,8 @@ func TestAPI_SignupOrg(t *testing.T) {
 				expected := []api.FieldError{
 					{
 						FieldName: "org.subDomain",
-						Errors:    []string{"an organization with that domain already exists"},
+						ErrorCode: api.ErrorCodeAlreadyExists,
+						Errors:    []string{"an organization with domain taken.exampledomain.com already exists"},
 					},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/server/data"
+)
+
+// timeFormat matches the format of every api.Time in a response.
+var timeFormat = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{3}Z$`)
+
+// TestAPI_TimestampsRoundTrip creates each resource that has timestamps, and
+// checks that the times in the response are byte for byte the same as the
+// times returned when the resource is read back from the database.
+func TestAPI_TimestampsRoundTrip(t *testing.T) {
+	srv := setupServer(t, withAdminUser, withSupportAdminGrant)
+	routes := srv.GenerateRoutes()
+
+	request := func(t *testing.T, method, path string, body any) map[string]any {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(method, path, nil)
+		if body != nil {
+			// nolint:noctx
+			req = httptest.NewRequest(method, path, jsonBody(t, body))
+		}
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		assert.Assert(t, resp.Code < 300, "%v %v: %v %v", method, path, resp.Code, resp.Body.String())
+
+		result := map[string]any{}
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &result))
+		return result
+	}
+
+	// findItem returns the item with id from the items of a list response.
+	findItem := func(t *testing.T, list map[string]any, id any) map[string]any {
+		t.Helper()
+		items, _ := list["items"].([]any)
+		for _, item := range items {
+			item, _ := item.(map[string]any)
+			if item["id"] == id {
+				return item
+			}
+		}
+		t.Fatalf("item %v not found in %v", id, list)
+		return nil
+	}
+
+	type testCase struct {
+		name string
+		// create returns the response to the request that created the
+		// resource, and the same resource read back with another request.
+		create     func(t *testing.T) (created, fetched map[string]any)
+		timeFields []string
+	}
+
+	testCases := []testCase{
+		{
+			name: "user",
+			create: func(t *testing.T) (map[string]any, map[string]any) {
+				user := request(t, http.MethodPost, "/api/users", api.CreateUserRequest{Name: "times@example.com"})
+				path := "/api/users/" + user["id"].(string)
+				updated := request(t, http.MethodPatch, path, api.PatchUserRequest{SSHLoginName: stringPtr("times")})
+				return updated, request(t, http.MethodGet, path, nil)
+			},
+			timeFields: []string{"created", "updated"},
+		},
+		{
+			name: "group",
+			create: func(t *testing.T) (map[string]any, map[string]any) {
+				group := request(t, http.MethodPost, "/api/groups", api.CreateGroupRequest{Name: "times"})
+				return group, request(t, http.MethodGet, "/api/groups/"+group["id"].(string), nil)
+			},
+			timeFields: []string{"created", "updated"},
+		},
+		{
+			name: "grant",
+			create: func(t *testing.T) (map[string]any, map[string]any) {
+				admin, err := data.GetIdentity(srv.DB(), data.GetIdentityOptions{ByName: "admin@example.com"})
+				assert.NilError(t, err)
+				grant := request(t, http.MethodPost, "/api/grants", api.GrantRequest{
+					User:      admin.ID,
+					Privilege: "view",
+					Resource:  "times",
+				})
+				return grant, request(t, http.MethodGet, "/api/grants/"+grant["id"].(string), nil)
+			},
+			timeFields: []string{"created", "updated"},
+		},
+		{
+			name: "access key",
+			create: func(t *testing.T) (map[string]any, map[string]any) {
+				admin, err := data.GetIdentity(srv.DB(), data.GetIdentityOptions{ByName: "admin@example.com"})
+				assert.NilError(t, err)
+				key := request(t, http.MethodPost, "/api/access-keys", api.CreateAccessKeyRequest{
+					UserID: admin.ID,
+					Name:   "times",
+				})
+				list := request(t, http.MethodGet, "/api/access-keys?name=times", nil)
+				return key, findItem(t, list, key["id"])
+			},
+			timeFields: []string{"created", "expires", "inactivityTimeout"},
+		},
+		{
+			name: "destination",
+			create: func(t *testing.T) (map[string]any, map[string]any) {
+				dest := request(t, http.MethodPost, "/api/destinations", api.CreateDestinationRequest{
+					Name:     "times",
+					UniqueID: "times",
+					Kind:     "kubernetes",
+					Connection: api.DestinationConnection{
+						URL: "times.example.com",
+						CA:  "-----BEGIN CERTIFICATE-----\nok\n-----END CERTIFICATE-----\n",
+					},
+				})
+				return dest, request(t, http.MethodGet, "/api/destinations/"+dest["id"].(string), nil)
+			},
+			timeFields: []string{"created", "updated", "lastSeenAt"},
+		},
+		{
+			name: "organization",
+			create: func(t *testing.T) (map[string]any, map[string]any) {
+				org := request(t, http.MethodPost, "/api/organizations", api.CreateOrganizationRequest{
+					Name:   "times",
+					Domain: "times.example.com",
+				})
+				return org, request(t, http.MethodGet, "/api/organizations/"+org["id"].(string), nil)
+			},
+			timeFields: []string{"created", "updated"},
+		},
+		{
+			name: "webhook",
+			create: func(t *testing.T) (map[string]any, map[string]any) {
+				webhook := request(t, http.MethodPost, "/api/webhooks", api.CreateWebhookRequest{
+					URL:    "https://example.com/times",
+					Secret: "the-secret-of-the-webhook",
+				})
+				return webhook, request(t, http.MethodGet, "/api/webhooks/"+webhook["id"].(string), nil)
+			},
+			timeFields: []string{"created", "updated"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			created, fetched := tc.create(t)
+			for _, field := range tc.timeFields {
+				createdTime, _ := created[field].(string)
+				if strings.HasPrefix(field, "lastSeen") && createdTime == "" {
+					// the resource has not been seen yet
+					assert.Equal(t, fetched[field], nil)
+					continue
+				}
+				assert.Assert(t, timeFormat.MatchString(createdTime), "field %v: %q", field, createdTime)
+				assert.Equal(t, createdTime, fetched[field], "field %v", field)
+			}
+		})
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
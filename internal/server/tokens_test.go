@@ -2,11 +2,14 @@ package server
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"gopkg.in/square/go-jose.v2/jwt"
 	"gotest.tools/v3/assert"
 
 	"github.com/infrahq/infra/api"
@@ -74,6 +77,44 @@ func TestAPI_CreateToken(t *testing.T) {
 				assert.Assert(t, respBody.Token != "")
 			},
 		},
+		"token with a destination audience": {
+			setup: func(t *testing.T, req *http.Request) {
+				user := &models.Identity{
+					Name: "spike3@example.com",
+				}
+				err := data.CreateIdentity(srv.DB(), user)
+				assert.NilError(t, err)
+				_, err = data.CreateProviderUser(srv.DB(), data.InfraProvider(srv.DB()), user)
+				assert.NilError(t, err)
+
+				key := &models.AccessKey{
+					IssuedFor:  user.ID,
+					ProviderID: data.InfraProvider(srv.DB()).ID,
+					ExpiresAt:  time.Now().Add(10 * time.Second),
+				}
+				accessKey, err := data.CreateAccessKey(srv.DB(), key)
+				assert.NilError(t, err)
+
+				req.Header.Set("Authorization", "Bearer "+accessKey)
+				body := `{"destination": "vcluster"}`
+				req.Body = io.NopCloser(strings.NewReader(body))
+				req.ContentLength = int64(len(body))
+			},
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Equal(t, resp.Code, http.StatusCreated)
+
+				respBody := &api.CreateTokenResponse{}
+				err := json.Unmarshal(resp.Body.Bytes(), respBody)
+				assert.NilError(t, err)
+
+				tok, err := jwt.ParseSigned(respBody.Token)
+				assert.NilError(t, err)
+				var claims jwt.Claims
+				assert.NilError(t, tok.UnsafeClaimsWithoutVerification(&claims))
+				assert.DeepEqual(t, claims.Audience, jwt.Audience{"vcluster"})
+				assert.Assert(t, claims.ID != "")
+			},
+		},
 		"infra provider user with expired inactivity timeout on the access key": {
 			setup: func(t *testing.T, req *http.Request) {
 				user := &models.Identity{
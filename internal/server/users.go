@@ -1,10 +1,9 @@
 package server
 
 import (
-	"bytes"
 	"encoding/base64"
+	"errors"
 	"fmt"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/ssh"
@@ -12,6 +11,7 @@ import (
 	"github.com/infrahq/infra/api"
 	"github.com/infrahq/infra/internal/access"
 	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/server/audit"
 	"github.com/infrahq/infra/internal/server/data"
 	"github.com/infrahq/infra/internal/server/email"
 	"github.com/infrahq/infra/internal/server/models"
@@ -19,7 +19,10 @@ import (
 )
 
 func (a *API) ListUsers(c *gin.Context, r *api.ListUsersRequest) (*api.ListResponse[api.User], error) {
-	p := PaginationFromRequest(r.PaginationRequest)
+	p, err := CursorPaginationFromRequest(r.PaginationRequest, r.Cursor)
+	if err != nil {
+		return nil, err
+	}
 
 	opts := data.ListIdentityOptions{
 		Pagination:             &p,
@@ -27,8 +30,8 @@ func (a *API) ListUsers(c *gin.Context, r *api.ListUsersRequest) (*api.ListRespo
 		ByIDs:                  r.IDs,
 		ByGroupID:              r.Group,
 		ByPublicKeyFingerprint: r.PublicKeyFingerprint,
-		LoadProviders:          true,
-		LoadPublicKeys:         r.PublicKeyFingerprint != "",
+		LoadProviders:          r.IncludesField("providerNames"),
+		LoadPublicKeys:         r.PublicKeyFingerprint != "" && r.IncludesField("publicKeys"),
 	}
 	if !r.ShowSystem {
 		opts.ByNotName = models.InternalInfraConnectorIdentityName
@@ -54,18 +57,54 @@ func (a *API) GetUser(c *gin.Context, r *api.GetUserRequest) (*api.User, error)
 		}
 		r.ID.ID = iden.ID
 	}
-	identity, err := access.GetIdentity(c, data.GetIdentityOptions{
+	opts := data.GetIdentityOptions{
 		ByID:           r.ID.ID,
-		LoadProviders:  true,
-		LoadPublicKeys: true,
-	})
+		LoadProviders:  r.IncludesField("providerNames"),
+		LoadPublicKeys: r.IncludesField("publicKeys"),
+	}
+	getIdentity := access.GetIdentity
+	if r.ID.Name != "" {
+		opts.ByName = r.ID.Name
+		getIdentity = access.GetIdentityByName
+	}
+	identity, err := getIdentity(c, opts)
 	if err != nil {
 		return nil, err
 	}
+	if err := setETag(c, userETagVersion(identity)); err != nil {
+		return nil, err
+	}
 
 	return identity.ToAPI(), nil
 }
 
+// userETagVersion returns the version of the user used in its ETag. Users do
+// not have an update_index, so the version is the time of the last update.
+func userETagVersion(identity *models.Identity) int64 {
+	return identity.UpdatedAt.UnixNano()
+}
+
+// checkUserIfMatch checks the If-Match header of a request that updates the
+// user. When the header matches, the user is updated with
+// data.UpdateIdentityIfUnmodified, so that a concurrent request with the same
+// If-Match fails, even when it only changes the credentials of the user.
+func checkUserIfMatch(c *gin.Context, identity *models.Identity) error {
+	if err := checkIfMatch(c, weakETag(userETagVersion(identity))); err != nil || !hasIfMatch(c) {
+		return err
+	}
+
+	tx := getRequestContext(c).DBTxn
+	err := data.UpdateIdentityIfUnmodified(tx, identity, identity.UpdatedAt)
+	if errors.Is(err, data.ErrUpdateConflict) {
+		current, err := data.GetIdentity(tx, data.GetIdentityOptions{ByID: identity.ID})
+		if err != nil {
+			return fmt.Errorf("get user after conflict: %w", err)
+		}
+		return newPreconditionFailedError(c, weakETag(userETagVersion(current)))
+	}
+	return err
+}
+
 // CreateUser creates a user with the Infra provider
 func (a *API) CreateUser(c *gin.Context, r *api.CreateUserRequest) (*api.CreateUserResponse, error) {
 	user := &models.Identity{Name: r.Name}
@@ -78,9 +117,14 @@ func (a *API) CreateUser(c *gin.Context, r *api.CreateUserRequest) (*api.CreateU
 
 	switch len(identities) {
 	case 0:
-		if err := access.CreateIdentity(c, user); err != nil {
+		err := access.CreateIdentity(c, user)
+		a.recordAuditOnCommit(c, audit.ActionUserCreate, userAuditTarget(user), err)
+		if err != nil {
 			return nil, fmt.Errorf("create identity: %w", err)
 		}
+		if err := a.emitWebhookEvent(c, api.WebhookEventUserCreated, user.ToAPI()); err != nil {
+			return nil, err
+		}
 	case 1:
 		user.ID = identities[0].ID
 	default:
@@ -94,7 +138,7 @@ func (a *API) CreateUser(c *gin.Context, r *api.CreateUserRequest) (*api.CreateU
 	}
 
 	// Always create a temporary password for infra users.
-	tmpPassword, err := access.CreateCredential(c, *user)
+	tmpPassword, err := access.CreateCredential(c, *user, a.server.options.OneTimePasswords.inviteExpiry())
 	if err != nil {
 		return nil, fmt.Errorf("create credential: %w", err)
 	}
@@ -107,7 +151,7 @@ func (a *API) CreateUser(c *gin.Context, r *api.CreateUserRequest) (*api.CreateU
 		// hack because we don't have names.
 		fromName := email.BuildNameFromEmail(currentUser.Name)
 
-		token, err := data.CreatePasswordResetToken(rCtx.DBTxn, user.ID, 72*time.Hour)
+		token, err := data.CreatePasswordResetToken(rCtx.DBTxn, user.ID, a.server.options.OneTimePasswords.inviteExpiry())
 		if err != nil {
 			return nil, err
 		}
@@ -132,16 +176,76 @@ func (a *API) UpdateUser(c *gin.Context, r *api.UpdateUserRequest) (*api.User, e
 	if err != nil {
 		return nil, err
 	}
+	if err := checkUserIfMatch(c, identity); err != nil {
+		return nil, err
+	}
 
-	err = access.UpdateCredential(c, identity, r.OldPassword, r.Password)
+	err = access.UpdateCredential(c, identity, r.OldPassword, r.Password, a.server.options.OneTimePasswords.resetExpiry())
 	if err != nil {
 		return nil, err
 	}
 	return identity.ToAPI(), nil
 }
 
+func (a *API) PatchUser(c *gin.Context, r *api.PatchUserRequest) (*api.User, error) {
+	identity, err := access.GetIdentity(c, data.GetIdentityOptions{ByID: r.ID, LoadProviders: true})
+	if err != nil {
+		return nil, err
+	}
+	if err := checkUserIfMatch(c, identity); err != nil {
+		return nil, err
+	}
+
+	if r.Password != nil {
+		var oldPassword string
+		if r.OldPassword != nil {
+			oldPassword = *r.OldPassword
+		}
+		if err := access.UpdateCredential(c, identity, oldPassword, *r.Password, a.server.options.OneTimePasswords.resetExpiry()); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.SSHLoginName != nil {
+		identity.SSHLoginName = *r.SSHLoginName
+		err = access.UpdateIdentity(c, identity)
+		a.recordAuditOnCommit(c, audit.ActionUserUpdate, userAuditTarget(identity), err)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return identity.ToAPI(), nil
+}
+
 func (a *API) DeleteUser(c *gin.Context, r *api.Resource) (*api.EmptyResponse, error) {
-	return nil, access.DeleteIdentity(c, r.ID)
+	err := access.DeleteIdentity(c, r.ID)
+	a.recordAuditOnCommit(c, audit.ActionUserDelete, auditTarget{Type: "user", ID: r.ID.String()}, err)
+	if err != nil {
+		return nil, err
+	}
+	return nil, a.emitWebhookEvent(c, api.WebhookEventUserDeleted, deletedResource{ID: r.ID})
+}
+
+// BulkDeleteUsers deletes each of the users in the request. A user that can
+// not be deleted does not prevent the others from being deleted.
+func (a *API) BulkDeleteUsers(c *gin.Context, r *api.BulkDeleteRequest) (*api.BulkDeleteResponse, error) {
+	ids := uniqueIDs(r.IDs)
+	deleted, failed, err := access.DeleteIdentities(c, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if err, ok := failed[id]; ok {
+			a.recordAuditOnCommit(c, audit.ActionUserDelete, auditTarget{Type: "user", ID: id.String()}, err)
+		}
+	}
+	for _, id := range deleted {
+		a.recordAuditOnCommit(c, audit.ActionUserDelete, auditTarget{Type: "user", ID: id.String()}, nil)
+		if err := a.emitWebhookEvent(c, api.WebhookEventUserDeleted, deletedResource{ID: id}); err != nil {
+			return nil, err
+		}
+	}
+	return newBulkDeleteResponse(ids, failed), nil
 }
 
 func AddUserPublicKey(c *gin.Context, r *api.AddUserPublicKeyRequest) (*api.UserPublicKey, error) {
@@ -152,14 +256,18 @@ func AddUserPublicKey(c *gin.Context, r *api.AddUserPublicKeyRequest) (*api.User
 		return nil, fmt.Errorf("missing authentication")
 	}
 
-	key, _, _, rest, err := ssh.ParseAuthorizedKey([]byte(r.PublicKey))
-	switch {
-	case err != nil:
-		// the error text is always the same "ssh: no key found", so we return
-		// a better error message.
-		return nil, validate.Error{"publicKey": {"must be in authorized_keys format"}}
-	case len(bytes.TrimSpace(rest)) > 0:
-		return nil, validate.Error{"publicKey": {"must be only a single key"}}
+	// the format of the key is checked by the validation rules of the request
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(r.PublicKey))
+	if err != nil {
+		return nil, fmt.Errorf("parse public key: %w", err)
+	}
+
+	settings, err := data.GetOrgSettings(rCtx.DBTxn)
+	if err != nil {
+		return nil, err
+	}
+	if !settings.AllowsPublicKeyAlgorithm(key.Type()) {
+		return nil, validate.Error{"publicKey": {fmt.Sprintf("key type %v is not allowed by the organization", key.Type())}}
 	}
 
 	userPublicKey := &models.UserPublicKey{
@@ -18,6 +18,7 @@ import (
 	"gotest.tools/v3/assert"
 
 	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal"
 	"github.com/infrahq/infra/internal/access"
 	"github.com/infrahq/infra/internal/generate"
 	"github.com/infrahq/infra/internal/server/data"
@@ -150,6 +151,49 @@ func TestAPI_GetUser(t *testing.T) {
 				assert.Equal(t, idResponse.ID, idMe)
 			},
 		},
+		"identity by name": {
+			urlPath: "/api/users/HAL%40example.com",
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Equal(t, resp.Code, http.StatusOK, resp.Body)
+
+				idResponse := api.User{}
+				err := json.NewDecoder(resp.Body).Decode(&idResponse)
+				assert.NilError(t, err)
+				assert.Equal(t, idResponse.ID, idHal)
+			},
+		},
+		"identity by name for self": {
+			urlPath: "/api/users/mememe@example.com",
+			setup: func(t *testing.T, req *http.Request) {
+				req.Header.Set("Authorization", "Bearer "+accessKeyMe)
+			},
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Equal(t, resp.Code, http.StatusOK, resp.Body)
+
+				idResponse := api.User{}
+				err := json.NewDecoder(resp.Body).Decode(&idResponse)
+				assert.NilError(t, err)
+				assert.Equal(t, idResponse.ID, idMe)
+			},
+		},
+		"identity by name not found": {
+			urlPath: "/api/users/nobody%40example.com",
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Equal(t, resp.Code, http.StatusNotFound, resp.Body)
+			},
+		},
+		"identity by name not authorized": {
+			urlPath: "/api/users/HAL%40example.com",
+			setup: func(t *testing.T, req *http.Request) {
+				key, _ := createAccessKey(t, srv.DB(), "someoneelse@example.com")
+
+				req.Header.Set("Authorization", "Bearer "+key)
+			},
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				// the same response as an unknown name, so that names can not be discovered
+				assert.Equal(t, resp.Code, http.StatusNotFound, resp.Body)
+			},
+		},
 		"full JSON response": {
 			urlPath: "/api/users/" + idMe.String(),
 			setup: func(t *testing.T, req *http.Request) {
@@ -442,7 +486,7 @@ func TestAPI_ListUsers(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{FieldName: "limit", Errors: []string{"value 1001 must be at most 1000"}},
+					{FieldName: "limit", ErrorCode: api.ErrorCodeInvalid, Errors: []string{"value 1001 must be at most 1000"}},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
 			},
@@ -457,7 +501,7 @@ func TestAPI_ListUsers(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{FieldName: "page", Errors: []string{"value -1 must be at least 0"}},
+					{FieldName: "page", ErrorCode: api.ErrorCodeInvalid, Errors: []string{"value -1 must be at least 0"}},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
 			},
@@ -559,7 +603,7 @@ func TestAPI_CreateUser(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{FieldName: "name", Errors: []string{"is required"}},
+					{FieldName: "name", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
 				}
 				assert.DeepEqual(t, apiError.FieldErrors, expected)
 			},
@@ -574,7 +618,26 @@ func TestAPI_CreateUser(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{FieldName: "name", Errors: []string{"invalid email address"}},
+					{FieldName: "name", ErrorCode: api.ErrorCodeInvalid, Errors: []string{"invalid email address"}},
+				}
+				assert.DeepEqual(t, apiError.FieldErrors, expected)
+			},
+		},
+		"many problems with the name": {
+			body: api.CreateUserRequest{Name: strings.Repeat("a", 257)},
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+
+				var apiError api.Error
+				err := json.NewDecoder(resp.Body).Decode(&apiError)
+				assert.NilError(t, err)
+
+				expected := []api.FieldError{
+					{
+						FieldName: "name",
+						ErrorCode: api.ErrorCodeInvalid,
+						Errors:    []string{"invalid email address", "can be at most 256 characters"},
+					},
 				}
 				assert.DeepEqual(t, apiError.FieldErrors, expected)
 			},
@@ -843,6 +906,86 @@ func TestAPI_DeleteUser(t *testing.T) {
 	}
 }
 
+func TestAPI_BulkDeleteUsers(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+	db := srv.DB()
+
+	connector := data.InfraConnectorIdentity(db)
+	missing := uid.New()
+
+	t.Run("mix of valid, missing, and internal users", func(t *testing.T) {
+		first := &models.Identity{Name: "first@example.com"}
+		second := &models.Identity{Name: "second@example.com"}
+		createIdentities(t, db, first, second)
+
+		key := &models.AccessKey{
+			IssuedFor:  second.ID,
+			ProviderID: data.InfraProvider(db).ID,
+			ExpiresAt:  time.Now().Add(time.Minute),
+		}
+		_, err := data.CreateAccessKey(db, key)
+		assert.NilError(t, err)
+
+		results := bulkDelete(t, routes, "/api/users/bulk-delete", adminAccessKey(srv),
+			first.ID, missing, connector.ID, second.ID, first.ID)
+		expected := []api.BulkDeleteResult{
+			{ID: first.ID, Status: "deleted"},
+			{ID: missing, Status: "not_found", Message: "record not found: user not found"},
+			{ID: connector.ID, Status: "bad_request", Message: "bad request: the connector user can not be deleted"},
+			{ID: second.ID, Status: "deleted"},
+		}
+		assert.DeepEqual(t, results, expected)
+
+		for _, id := range []uid.ID{first.ID, second.ID} {
+			_, err = data.GetIdentity(db, data.GetIdentityOptions{ByID: id})
+			assert.ErrorIs(t, err, internal.ErrNotFound)
+		}
+		// access keys of the deleted user are deleted with it
+		_, err = data.GetAccessKey(db, data.GetAccessKeysOptions{ByID: key.ID})
+		assert.ErrorIs(t, err, internal.ErrNotFound)
+
+		_, err = data.GetIdentity(db, data.GetIdentityOptions{ByID: connector.ID})
+		assert.NilError(t, err)
+	})
+
+	t.Run("not authorized", func(t *testing.T) {
+		target := &models.Identity{Name: "target@example.com"}
+		createIdentities(t, db, target)
+		accessKey, _ := createAccessKey(t, db, "not-admin@example.com")
+
+		results := bulkDelete(t, routes, "/api/users/bulk-delete", accessKey, target.ID, missing)
+		message := "you do not have permission to delete user, requires role user-admin, or admin"
+		expected := []api.BulkDeleteResult{
+			{ID: target.ID, Status: "forbidden", Message: message},
+			{ID: missing, Status: "forbidden", Message: message},
+		}
+		assert.DeepEqual(t, results, expected)
+
+		_, err := data.GetIdentity(db, data.GetIdentityOptions{ByID: target.ID})
+		assert.NilError(t, err)
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		tooMany := make([]uid.ID, api.MaxBulkDeleteIDs+1)
+		for i := range tooMany {
+			tooMany[i] = uid.New()
+		}
+
+		for _, ids := range [][]uid.ID{nil, tooMany} {
+			body := jsonBody(t, api.BulkDeleteRequest{IDs: ids})
+			// nolint:noctx
+			req := httptest.NewRequest(http.MethodPost, "/api/users/bulk-delete", body)
+			req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+			req.Header.Set("Infra-Version", apiVersionLatest)
+
+			resp := httptest.NewRecorder()
+			routes.ServeHTTP(resp, req)
+			assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+		}
+	})
+}
+
 func TestAPI_UpdateUser(t *testing.T) {
 	srv := setupServer(t, withAdminUser)
 	routes := srv.GenerateRoutes()
@@ -910,7 +1053,7 @@ func TestAPI_UpdateUser(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{FieldName: "password", Errors: []string{"is required"}},
+					{FieldName: "password", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
 			},
@@ -926,7 +1069,7 @@ func TestAPI_UpdateUser(t *testing.T) {
 				assert.NilError(t, err)
 
 				expected := []api.FieldError{
-					{FieldName: "password", Errors: []string{"8 characters"}},
+					{FieldName: "password", ErrorCode: api.ErrorCodeInvalid, Errors: []string{"8 characters"}},
 				}
 				assert.DeepEqual(t, respBody.FieldErrors, expected)
 			},
@@ -940,6 +1083,163 @@ func TestAPI_UpdateUser(t *testing.T) {
 	}
 }
 
+func TestAPI_PatchUser(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+
+	user := &models.Identity{Name: "salsa@example.com"}
+	err := data.CreateIdentity(srv.DB(), user)
+	assert.NilError(t, err)
+
+	other := &models.Identity{Name: "verde@example.com"}
+	err = data.CreateIdentity(srv.DB(), other)
+	assert.NilError(t, err)
+
+	type testCase struct {
+		name     string
+		body     string
+		setup    func(t *testing.T, req *http.Request)
+		expected func(t *testing.T, response *httptest.ResponseRecorder)
+	}
+
+	run := func(t *testing.T, tc testCase) {
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodPatch, "/api/users/"+user.ID.String(), strings.NewReader(tc.body))
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+
+		if tc.setup != nil {
+			tc.setup(t, req)
+		}
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+
+		tc.expected(t, resp)
+	}
+
+	expectFieldErrors := func(t *testing.T, resp *httptest.ResponseRecorder, expected []api.FieldError) {
+		t.Helper()
+		assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+
+		respBody := &api.Error{}
+		err := json.Unmarshal(resp.Body.Bytes(), respBody)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, respBody.FieldErrors, expected)
+	}
+
+	testCases := []testCase{
+		{
+			name: "not authenticated",
+			body: `{"sshLoginName": "salsa"}`,
+			setup: func(t *testing.T, req *http.Request) {
+				req.Header.Del("Authorization")
+			},
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Equal(t, resp.Code, http.StatusUnauthorized, resp.Body.String())
+			},
+		},
+		{
+			name: "not authorized",
+			body: `{"sshLoginName": "salsa"}`,
+			setup: func(t *testing.T, req *http.Request) {
+				accessKey, _ := createAccessKey(t, srv.DB(), "usera@example.com")
+				req.Header.Set("Authorization", "Bearer "+accessKey)
+			},
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Equal(t, resp.Code, http.StatusForbidden, resp.Body.String())
+			},
+		},
+		{
+			name: "no fields",
+			body: `{}`,
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				expectFieldErrors(t, resp, []api.FieldError{
+					{ErrorCode: api.ErrorCodeInvalid, Errors: []string{"one of (password, sshLoginName) is required"}},
+				})
+			},
+		},
+		{
+			name: "empty value",
+			body: `{"sshLoginName": ""}`,
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				expectFieldErrors(t, resp, []api.FieldError{
+					{FieldName: "sshLoginName", ErrorCode: api.ErrorCodeRequired, Errors: []string{"is required"}},
+				})
+			},
+		},
+		{
+			name: "invalid sshLoginName",
+			body: `{"sshLoginName": "Salsa"}`,
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				expectFieldErrors(t, resp, []api.FieldError{
+					{FieldName: "sshLoginName", ErrorCode: api.ErrorCodeInvalid, Errors: []string{
+						"first character 'S' is not allowed",
+						"character 'S' at position 0 is not allowed",
+					}},
+				})
+			},
+		},
+		{
+			name: "reserved sshLoginName",
+			body: `{"sshLoginName": "root"}`,
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				expectFieldErrors(t, resp, []api.FieldError{
+					{FieldName: "sshLoginName", ErrorCode: api.ErrorCodeInvalid, Errors: []string{"is reserved and can not be used"}},
+				})
+			},
+		},
+		{
+			name: "sshLoginName used by another user",
+			body: `{"sshLoginName": "` + other.SSHLoginName + `"}`,
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Equal(t, resp.Code, http.StatusConflict, resp.Body.String())
+			},
+		},
+		{
+			name: "update sshLoginName",
+			body: `{"sshLoginName": "salsa_verde"}`,
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+				respBody := &api.User{}
+				err := json.Unmarshal(resp.Body.Bytes(), respBody)
+				assert.NilError(t, err)
+				assert.Equal(t, respBody.SSHLoginName, "salsa_verde")
+
+				updated, err := data.GetIdentity(srv.DB(), data.GetIdentityOptions{ByID: user.ID})
+				assert.NilError(t, err)
+				assert.Equal(t, updated.SSHLoginName, "salsa_verde")
+
+				_, err = data.GetCredentialByUserID(srv.DB(), user.ID)
+				assert.ErrorIs(t, err, internal.ErrNotFound, "password should not be changed")
+			},
+		},
+		{
+			name: "update password",
+			body: `{"password": "new-password"}`,
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+				credential, err := data.GetCredentialByUserID(srv.DB(), user.ID)
+				assert.NilError(t, err)
+				err = bcrypt.CompareHashAndPassword(credential.PasswordHash, []byte("new-password"))
+				assert.NilError(t, err)
+
+				updated, err := data.GetIdentity(srv.DB(), data.GetIdentityOptions{ByID: user.ID})
+				assert.NilError(t, err)
+				assert.Equal(t, updated.SSHLoginName, "salsa_verde", "sshLoginName should not be changed")
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
+
 func TestAddUserPublicKey(t *testing.T) {
 	srv := setupServer(t, withAdminUser)
 	routes := srv.GenerateRoutes()
@@ -985,6 +1285,34 @@ func TestAddUserPublicKey(t *testing.T) {
 				assert.Equal(t, resp.Code, http.StatusUnauthorized, (*responseDebug)(resp))
 			},
 		},
+		{
+			name: "every invalid field is reported",
+			body: func(t *testing.T) api.AddUserPublicKeyRequest {
+				return api.AddUserPublicKeyRequest{
+					Name:      "not a name!",
+					PublicKey: "ssh-rsa not-a-key",
+				}
+			},
+			expected: func(t *testing.T, resp *httptest.ResponseRecorder) {
+				assert.Equal(t, resp.Code, http.StatusBadRequest, (*responseDebug)(resp))
+
+				var respBody api.Error
+				assert.NilError(t, json.NewDecoder(resp.Body).Decode(&respBody))
+				expected := []api.FieldError{
+					{
+						FieldName: "name",
+						ErrorCode: api.ErrorCodeInvalid,
+						Errors:    []string{"character ' ' at position 3 is not allowed"},
+					},
+					{
+						FieldName: "publicKey",
+						ErrorCode: api.ErrorCodeInvalid,
+						Errors:    []string{"must be in authorized_keys format"},
+					},
+				}
+				assert.DeepEqual(t, respBody.FieldErrors, expected)
+			},
+		},
 		{
 			name: "success",
 			body: func(t *testing.T) api.AddUserPublicKeyRequest {
@@ -1020,3 +1348,101 @@ func TestAddUserPublicKey(t *testing.T) {
 		})
 	}
 }
+
+func TestAPI_ScopedAdminRoles(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+	db := srv.DB()
+
+	userAdminKey, userAdmin := createAccessKey(t, db, "helpdesk@example.com")
+	grantAdminKey, grantAdmin := createAccessKey(t, db, "grants@example.com")
+	for _, g := range []*models.Grant{
+		{Subject: userAdmin.PolyID(), Privilege: models.InfraUserAdminRole, Resource: access.ResourceInfraAPI},
+		{Subject: grantAdmin.PolyID(), Privilege: models.InfraGrantAdminRole, Resource: access.ResourceInfraAPI},
+	} {
+		assert.NilError(t, data.CreateGrant(db, g))
+	}
+
+	target := &models.Identity{Name: "target@example.com"}
+	createIdentities(t, db, target)
+
+	request := func(t *testing.T, method, path, accessKey string, body interface{}) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(method, path, jsonBody(t, body))
+		req.Header.Set("Authorization", "Bearer "+accessKey)
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	clusterGrant := api.GrantRequest{User: target.ID, Privilege: "view", Resource: "production"}
+	infraAdminGrant := api.GrantRequest{User: target.ID, Privilege: models.InfraAdminRole, Resource: access.ResourceInfraAPI}
+
+	t.Run("user-admin manages users", func(t *testing.T) {
+		resp := request(t, http.MethodPost, "/api/users", userAdminKey, api.CreateUserRequest{Name: "new@example.com"})
+		assert.Equal(t, resp.Code, http.StatusCreated, (*responseDebug)(resp))
+
+		resp = request(t, http.MethodGet, "/api/users", userAdminKey, nil)
+		assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+
+		resp = request(t, http.MethodPut, "/api/users/"+target.ID.String(), userAdminKey,
+			api.UpdateUserRequest{Password: "a-new-password"})
+		assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+
+		resp = request(t, http.MethodGet, "/api/users/"+target.ID.String()+"/sessions", userAdminKey, nil)
+		assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+	})
+
+	t.Run("user-admin can not reset the password of an admin", func(t *testing.T) {
+		admin := &models.Identity{Name: "other-admin@example.com"}
+		createIdentities(t, db, admin)
+		grant := &models.Grant{Subject: admin.PolyID(), Privilege: models.InfraAdminRole, Resource: access.ResourceInfraAPI}
+		assert.NilError(t, data.CreateGrant(db, grant))
+
+		resp := request(t, http.MethodPut, "/api/users/"+admin.ID.String(), userAdminKey,
+			api.UpdateUserRequest{Password: "a-new-password"})
+		assert.Equal(t, resp.Code, http.StatusForbidden, (*responseDebug)(resp))
+
+		resp = request(t, http.MethodPut, "/api/users/"+admin.ID.String(), adminAccessKey(srv),
+			api.UpdateUserRequest{Password: "a-new-password"})
+		assert.Equal(t, resp.Code, http.StatusOK, (*responseDebug)(resp))
+	})
+
+	t.Run("user-admin can not create grants", func(t *testing.T) {
+		for _, grant := range []api.GrantRequest{clusterGrant, infraAdminGrant} {
+			resp := request(t, http.MethodPost, "/api/grants", userAdminKey, grant)
+			assert.Equal(t, resp.Code, http.StatusForbidden, (*responseDebug)(resp))
+		}
+	})
+
+	t.Run("grant-admin manages grants", func(t *testing.T) {
+		resp := request(t, http.MethodPost, "/api/grants", grantAdminKey, clusterGrant)
+		assert.Equal(t, resp.Code, http.StatusCreated, (*responseDebug)(resp))
+
+		var created api.CreateGrantResponse
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &created))
+
+		resp = request(t, http.MethodDelete, "/api/grants/"+created.ID.String(), grantAdminKey, nil)
+		assert.Equal(t, resp.Code, http.StatusNoContent, (*responseDebug)(resp))
+	})
+
+	t.Run("grant-admin can not create grants on infra", func(t *testing.T) {
+		resp := request(t, http.MethodPost, "/api/grants", grantAdminKey, infraAdminGrant)
+		assert.Equal(t, resp.Code, http.StatusForbidden, (*responseDebug)(resp))
+	})
+
+	t.Run("grant-admin can not manage users", func(t *testing.T) {
+		resp := request(t, http.MethodPost, "/api/users", grantAdminKey, api.CreateUserRequest{Name: "other@example.com"})
+		assert.Equal(t, resp.Code, http.StatusForbidden, (*responseDebug)(resp))
+	})
+
+	t.Run("admin can do both", func(t *testing.T) {
+		resp := request(t, http.MethodPost, "/api/users", adminAccessKey(srv), api.CreateUserRequest{Name: "third@example.com"})
+		assert.Equal(t, resp.Code, http.StatusCreated, (*responseDebug)(resp))
+
+		resp = request(t, http.MethodPost, "/api/grants", adminAccessKey(srv), infraAdminGrant)
+		assert.Equal(t, resp.Code, http.StatusCreated, (*responseDebug)(resp))
+	})
+}
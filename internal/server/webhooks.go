@@ -0,0 +1,324 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal"
+	"github.com/infrahq/infra/internal/access"
+	"github.com/infrahq/infra/internal/logging"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+func (a *API) ListWebhooks(c *gin.Context, r *api.ListWebhooksRequest) (*api.ListResponse[api.Webhook], error) {
+	p := PaginationFromRequest(r.PaginationRequest)
+	webhooks, err := access.ListWebhooks(c, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	result := api.NewListResponse(webhooks, PaginationToResponse(p), func(webhook models.Webhook) api.Webhook {
+		return *webhook.ToAPI()
+	})
+	return result, nil
+}
+
+func (a *API) GetWebhook(c *gin.Context, r *api.Resource) (*api.Webhook, error) {
+	webhook, err := access.GetWebhook(c, r.ID)
+	if err != nil {
+		return nil, err
+	}
+	return webhook.ToAPI(), nil
+}
+
+func (a *API) CreateWebhook(c *gin.Context, r *api.CreateWebhookRequest) (*api.Webhook, error) {
+	webhook := &models.Webhook{
+		URL:    r.URL,
+		Secret: models.EncryptedAtRest(r.Secret),
+		Events: r.Events,
+	}
+	if err := access.CreateWebhook(c, webhook); err != nil {
+		return nil, err
+	}
+	return webhook.ToAPI(), nil
+}
+
+func (a *API) DeleteWebhook(c *gin.Context, r *api.Resource) (*api.EmptyResponse, error) {
+	return nil, access.DeleteWebhook(c, r.ID)
+}
+
+func (a *API) ListWebhookDeliveries(c *gin.Context, r *api.ListWebhookDeliveriesRequest) (*api.ListResponse[api.WebhookDelivery], error) {
+	p := PaginationFromRequest(r.PaginationRequest)
+	deliveries, err := access.ListWebhookDeliveries(c, data.ListWebhookDeliveriesOptions{
+		ByWebhookID: r.ID,
+		ByStatus:    r.Status,
+		Pagination:  &p,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := api.NewListResponse(deliveries, PaginationToResponse(p), func(delivery models.WebhookDelivery) api.WebhookDelivery {
+		return *delivery.ToAPI()
+	})
+	return result, nil
+}
+
+// deletedResource is the data of an event about a resource that was deleted,
+// when only the ID of the resource is known.
+type deletedResource struct {
+	ID uid.ID `json:"id"`
+}
+
+// emitWebhookEvent creates a delivery of the event to every webhook of the
+// organization that accepts events of eventType. The deliveries are created in
+// the request transaction, so that an event is only sent when the change is
+// committed. resource is the data of the event.
+func (a *API) emitWebhookEvent(c *gin.Context, eventType string, resource any) error {
+	tx := getRequestContext(c).DBTxn
+	webhooks, err := data.ListWebhooks(tx, data.ListWebhooksOptions{})
+	if err != nil {
+		return fmt.Errorf("list webhooks: %w", err)
+	}
+
+	var raw []byte
+	now := time.Now()
+	for _, webhook := range webhooks {
+		if !webhook.Accepts(eventType) {
+			continue
+		}
+		if raw == nil {
+			if raw, err = json.Marshal(resource); err != nil {
+				return err
+			}
+		}
+
+		delivery := &models.WebhookDelivery{
+			ID:        uid.New(),
+			WebhookID: webhook.ID,
+			EventType: eventType,
+			CreatedAt: now,
+		}
+		payload, err := json.Marshal(api.WebhookEvent{
+			ID:             delivery.ID,
+			Type:           eventType,
+			Created:        api.Time(now),
+			OrganizationID: tx.OrganizationID(),
+			Data:           raw,
+		})
+		if err != nil {
+			return err
+		}
+		delivery.Payload = string(payload)
+		if err := data.CreateWebhookDelivery(tx, delivery); err != nil {
+			return fmt.Errorf("create webhook delivery: %w", err)
+		}
+	}
+
+	if raw != nil {
+		tx.OnCommit(a.server.webhooks.notify)
+	}
+	return nil
+}
+
+const (
+	webhookPollInterval     = 10 * time.Second
+	webhookBatchSize        = 100
+	webhookMaxAttempts      = 8
+	webhookMinBackoff       = 30 * time.Second
+	webhookMaxBackoff       = time.Hour
+	webhookRequestTimeout   = 10 * time.Second
+	webhookMaxResponseBytes = 64 * 1024
+)
+
+// webhookDeliverer sends pending webhook deliveries. Deliveries that fail are
+// retried with an exponential backoff, and are moved to the dead letter status
+// after maxAttempts.
+//
+// The deliverer is woken up when a request transaction that created deliveries
+// commits. Deliveries are also polled, so that deliveries created by other
+// servers, and retries, are sent.
+type webhookDeliverer struct {
+	client      *http.Client
+	wake        chan struct{}
+	maxAttempts int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	// lease is how long a claimed delivery is hidden from other servers while
+	// it is attempted. It must be longer than the client timeout.
+	lease time.Duration
+	now   func() time.Time
+}
+
+func newWebhookDeliverer() *webhookDeliverer {
+	return &webhookDeliverer{
+		client:      &http.Client{Timeout: webhookRequestTimeout},
+		wake:        make(chan struct{}, 1),
+		maxAttempts: webhookMaxAttempts,
+		minBackoff:  webhookMinBackoff,
+		maxBackoff:  webhookMaxBackoff,
+		lease:       6 * webhookRequestTimeout,
+		now:         time.Now,
+	}
+}
+
+// notify wakes up the deliverer to send new deliveries.
+func (d *webhookDeliverer) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default: // already notified
+	}
+}
+
+func (s *Server) registerWebhookDeliverer(ctx context.Context) {
+	s.routines = append(s.routines, routine{
+		run: func() error {
+			t := time.NewTicker(webhookPollInterval)
+			defer t.Stop()
+			for {
+				select {
+				case <-t.C:
+				case <-s.webhooks.wake:
+				case <-ctx.Done():
+					return nil
+				}
+				s.webhooks.deliverDue(ctx, s.db)
+			}
+		},
+		stop: func() {}, // uses the context to stop
+	})
+}
+
+// deliverDue attempts a batch of the deliveries that are due. If the batch is
+// full the deliverer notifies itself to send the next batch.
+func (d *webhookDeliverer) deliverDue(ctx context.Context, db *data.DB) {
+	deliveries, err := data.ListDueWebhookDeliveries(db, d.now(), webhookBatchSize)
+	if err != nil {
+		logging.L.Error().Err(err).Msg("failed to list webhook deliveries")
+		return
+	}
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := d.attempt(ctx, db, delivery); err != nil {
+			logging.L.Error().Err(err).Str("delivery", delivery.ID.String()).
+				Msg("failed to attempt webhook delivery")
+		}
+	}
+	if len(deliveries) == webhookBatchSize {
+		d.notify()
+	}
+}
+
+// attempt claims the delivery and sends it to the webhook. The request to the
+// webhook is made outside of a transaction, so that a slow webhook does not
+// hold a database connection.
+func (d *webhookDeliverer) attempt(ctx context.Context, db *data.DB, delivery models.WebhookDelivery) error {
+	now := d.now()
+	var webhook *models.Webhook
+	var claimed bool
+	err := withOrgTxn(ctx, db, delivery.OrganizationID, func(tx *data.Transaction) error {
+		var err error
+		claimed, err = data.ClaimWebhookDelivery(tx, &delivery, now, now.Add(d.lease))
+		if err != nil || !claimed {
+			return err
+		}
+		webhook, err = data.GetWebhook(tx, delivery.WebhookID)
+		if errors.Is(err, internal.ErrNotFound) {
+			delivery.Status = models.WebhookDeliveryDeadLetter
+			delivery.LastError = "the webhook was deleted"
+			return data.UpdateWebhookDelivery(tx, &delivery)
+		}
+		return err
+	})
+	if err != nil || !claimed || webhook == nil {
+		return err
+	}
+
+	status, sendErr := d.send(ctx, webhook, delivery, now)
+	delivery.Attempts++
+	delivery.LastAttemptAt = now
+	delivery.ResponseStatus = status
+	switch {
+	case sendErr == nil:
+		delivery.Status = models.WebhookDeliveryDelivered
+		delivery.LastError = ""
+	case delivery.Attempts >= d.maxAttempts:
+		delivery.Status = models.WebhookDeliveryDeadLetter
+		delivery.LastError = sendErr.Error()
+	default:
+		delivery.NextAttemptAt = now.Add(d.backoff(delivery.Attempts))
+		delivery.LastError = sendErr.Error()
+	}
+
+	return withOrgTxn(ctx, db, delivery.OrganizationID, func(tx *data.Transaction) error {
+		return data.UpdateWebhookDelivery(tx, &delivery)
+	})
+}
+
+// send posts the payload of the delivery to the webhook, and returns the
+// status of the response. Any status other than 2xx is an error.
+func (d *webhookDeliverer) send(ctx context.Context, webhook *models.Webhook, delivery models.WebhookDelivery, now time.Time) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(api.WebhookEventHeader, delivery.EventType)
+	req.Header.Set(api.WebhookDeliveryHeader, delivery.ID.String())
+	req.Header.Set(api.WebhookSignatureHeader, api.SignWebhookPayload(string(webhook.Secret), now, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// read some of the body so that the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, webhookMaxResponseBytes))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay before the next attempt of a delivery that failed
+// attempts times.
+func (d *webhookDeliverer) backoff(attempts int) time.Duration {
+	delay := d.minBackoff
+	for i := 1; i < attempts && delay < d.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.maxBackoff {
+		delay = d.maxBackoff
+	}
+	return delay
+}
+
+// withOrgTxn runs fn in a transaction scoped to the organization with orgID,
+// and commits the transaction if fn returns nil.
+func withOrgTxn(ctx context.Context, db *data.DB, orgID uid.ID, fn func(tx *data.Transaction) error) error {
+	tx, err := db.Begin(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer logError(tx.Rollback, "failed to rollback transaction")
+
+	if err := fn(tx.WithOrgID(orgID)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
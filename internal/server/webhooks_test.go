@@ -0,0 +1,332 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/infrahq/infra/api"
+	"github.com/infrahq/infra/internal/server/data"
+	"github.com/infrahq/infra/internal/server/models"
+	"github.com/infrahq/infra/uid"
+)
+
+func TestAPI_Webhooks(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+
+	request := func(t *testing.T, method, path string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(method, path, nil)
+		if body != nil {
+			// nolint:noctx
+			req = httptest.NewRequest(method, path, jsonBody(t, body))
+		}
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	var created api.Webhook
+	t.Run("create", func(t *testing.T) {
+		resp := request(t, http.MethodPost, "/api/webhooks", api.CreateWebhookRequest{
+			URL:    "https://example.com/hooks",
+			Secret: "the-secret-of-the-webhook",
+			Events: []string{api.WebhookEventUserCreated},
+		})
+		assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+		assert.Assert(t, !strings.Contains(resp.Body.String(), "the-secret-of-the-webhook"),
+			"the secret must not be returned")
+
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &created))
+		assert.Equal(t, created.URL, "https://example.com/hooks")
+		assert.DeepEqual(t, created.Events, []string{api.WebhookEventUserCreated})
+	})
+
+	t.Run("create with invalid request", func(t *testing.T) {
+		resp := request(t, http.MethodPost, "/api/webhooks", api.CreateWebhookRequest{
+			URL:    "example.com",
+			Secret: "short",
+			Events: []string{"user.renamed"},
+		})
+		assert.Equal(t, resp.Code, http.StatusBadRequest, resp.Body.String())
+
+		respBody := &api.Error{}
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), respBody))
+		var fields []string
+		for _, f := range respBody.FieldErrors {
+			fields = append(fields, f.FieldName)
+		}
+		assert.DeepEqual(t, fields, []string{"events", "secret", "url"})
+	})
+
+	t.Run("get and list", func(t *testing.T) {
+		resp := request(t, http.MethodGet, "/api/webhooks/"+created.ID.String(), nil)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		var webhook api.Webhook
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &webhook))
+		assert.DeepEqual(t, webhook, created)
+
+		resp = request(t, http.MethodGet, "/api/webhooks", nil)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+		var list api.ListResponse[api.Webhook]
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &list))
+		assert.DeepEqual(t, list.Items, []api.Webhook{created})
+	})
+
+	t.Run("deliveries of an unknown webhook", func(t *testing.T) {
+		resp := request(t, http.MethodGet, "/api/webhooks/"+uid.New().String()+"/deliveries", nil)
+		assert.Equal(t, resp.Code, http.StatusNotFound, resp.Body.String())
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		resp := request(t, http.MethodDelete, "/api/webhooks/"+created.ID.String(), nil)
+		assert.Equal(t, resp.Code, http.StatusNoContent, resp.Body.String())
+
+		resp = request(t, http.MethodGet, "/api/webhooks/"+created.ID.String(), nil)
+		assert.Equal(t, resp.Code, http.StatusNotFound, resp.Body.String())
+	})
+
+	t.Run("requires the admin role", func(t *testing.T) {
+		key, _ := createAccessKey(t, srv.DB(), "notadmin@example.com")
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodGet, "/api/webhooks", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		req.Header.Set("Infra-Version", apiVersionLatest)
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		assert.Equal(t, resp.Code, http.StatusForbidden, resp.Body.String())
+	})
+}
+
+// fakeWebhookReceiver records the events sent to it, and responds with the
+// next status in statuses, or 200 OK when there are none left.
+type fakeWebhookReceiver struct {
+	t      *testing.T
+	secret string
+
+	mu       sync.Mutex
+	statuses []int
+	events   []api.WebhookEvent
+}
+
+func (f *fakeWebhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	assert.Check(f.t, err)
+	assert.Check(f.t, api.VerifyWebhookSignature(f.secret, req.Header.Get(api.WebhookSignatureHeader), body, time.Minute))
+
+	var event api.WebhookEvent
+	assert.Check(f.t, json.Unmarshal(body, &event))
+	assert.Check(f.t, req.Header.Get(api.WebhookEventHeader) == event.Type)
+	assert.Check(f.t, req.Header.Get(api.WebhookDeliveryHeader) == event.ID.String())
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status := http.StatusOK
+	if len(f.statuses) > 0 {
+		status, f.statuses = f.statuses[0], f.statuses[1:]
+	}
+	if status == http.StatusOK {
+		f.events = append(f.events, event)
+	}
+	w.WriteHeader(status)
+}
+
+func (f *fakeWebhookReceiver) received() []api.WebhookEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]api.WebhookEvent(nil), f.events...)
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	srv := setupServer(t, withAdminUser)
+	routes := srv.GenerateRoutes()
+	ctx := context.Background()
+
+	now := time.Now()
+	srv.webhooks.now = func() time.Time { return now }
+	srv.webhooks.maxAttempts = 3
+
+	request := func(t *testing.T, method, path string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(method, path, jsonBody(t, body))
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		return resp
+	}
+
+	createWebhook := func(t *testing.T, receiver *fakeWebhookReceiver, events ...string) api.Webhook {
+		t.Helper()
+		server := httptest.NewServer(receiver)
+		t.Cleanup(server.Close)
+
+		resp := request(t, http.MethodPost, "/api/webhooks", api.CreateWebhookRequest{
+			URL:    server.URL,
+			Secret: receiver.secret,
+			Events: events,
+		})
+		assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+		var webhook api.Webhook
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &webhook))
+		t.Cleanup(func() {
+			resp := request(t, http.MethodDelete, "/api/webhooks/"+webhook.ID.String(), nil)
+			assert.Equal(t, resp.Code, http.StatusNoContent, resp.Body.String())
+		})
+		return webhook
+	}
+
+	listDeliveries := func(t *testing.T, webhook api.Webhook, status string) []api.WebhookDelivery {
+		t.Helper()
+		// nolint:noctx
+		req := httptest.NewRequest(http.MethodGet,
+			"/api/webhooks/"+webhook.ID.String()+"/deliveries?status="+status, nil)
+		req.Header.Set("Authorization", "Bearer "+adminAccessKey(srv))
+		req.Header.Set("Infra-Version", apiVersionLatest)
+		resp := httptest.NewRecorder()
+		routes.ServeHTTP(resp, req)
+		assert.Equal(t, resp.Code, http.StatusOK, resp.Body.String())
+
+		var list api.ListResponse[api.WebhookDelivery]
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &list))
+		return list.Items
+	}
+
+	t.Run("success with signature", func(t *testing.T) {
+		receiver := &fakeWebhookReceiver{t: t, secret: "the-secret-of-the-first-hook"}
+		webhook := createWebhook(t, receiver, api.WebhookEventUserCreated)
+
+		resp := request(t, http.MethodPost, "/api/users", api.CreateUserRequest{Name: "webhook@example.com"})
+		assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+		var user api.CreateUserResponse
+		assert.NilError(t, json.Unmarshal(resp.Body.Bytes(), &user))
+
+		now = time.Now()
+		srv.webhooks.deliverDue(ctx, srv.db)
+
+		events := receiver.received()
+		assert.Equal(t, len(events), 1)
+		assert.Equal(t, events[0].Type, api.WebhookEventUserCreated)
+		assert.Equal(t, events[0].OrganizationID, srv.db.DefaultOrg.ID)
+		var created api.User
+		assert.NilError(t, json.Unmarshal(events[0].Data, &created))
+		assert.Equal(t, created.ID, user.ID)
+		assert.Equal(t, created.Name, "webhook@example.com")
+
+		deliveries := listDeliveries(t, webhook, api.WebhookDeliveryDelivered)
+		assert.Equal(t, len(deliveries), 1)
+		assert.Equal(t, deliveries[0].ID, events[0].ID)
+		assert.Equal(t, deliveries[0].Attempts, 1)
+		assert.Equal(t, deliveries[0].ResponseStatus, http.StatusOK)
+	})
+
+	t.Run("retry after failure", func(t *testing.T) {
+		receiver := &fakeWebhookReceiver{
+			t:        t,
+			secret:   "the-secret-of-the-retry-hook",
+			statuses: []int{http.StatusServiceUnavailable},
+		}
+		webhook := createWebhook(t, receiver, api.WebhookEventAccessKeyCreated)
+
+		user := &models.Identity{Name: "retry@example.com"}
+		assert.NilError(t, data.CreateIdentity(srv.DB(), user))
+		resp := request(t, http.MethodPost, "/api/access-keys", api.CreateAccessKeyRequest{
+			UserID: user.ID, Name: "retry",
+		})
+		assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+
+		now = time.Now()
+		srv.webhooks.deliverDue(ctx, srv.db)
+		assert.Equal(t, len(receiver.received()), 0)
+
+		pending := listDeliveries(t, webhook, api.WebhookDeliveryPending)
+		assert.Equal(t, len(pending), 1)
+		assert.Equal(t, pending[0].Attempts, 1)
+		assert.Equal(t, pending[0].ResponseStatus, http.StatusServiceUnavailable)
+		assert.Equal(t, pending[0].LastError, "webhook responded with status 503")
+		assert.Assert(t, time.Time(pending[0].NextAttempt).After(now))
+
+		// not due yet
+		srv.webhooks.deliverDue(ctx, srv.db)
+		assert.Equal(t, len(receiver.received()), 0)
+
+		now = now.Add(srv.webhooks.backoff(1))
+		srv.webhooks.deliverDue(ctx, srv.db)
+
+		events := receiver.received()
+		assert.Equal(t, len(events), 1)
+		assert.Equal(t, events[0].ID, pending[0].ID)
+		assert.Assert(t, !strings.Contains(string(events[0].Data), "accessKey"),
+			"the secret of the access key must not be sent")
+
+		delivered := listDeliveries(t, webhook, api.WebhookDeliveryDelivered)
+		assert.Equal(t, len(delivered), 1)
+		assert.Equal(t, delivered[0].Attempts, 2)
+		assert.Equal(t, delivered[0].LastError, "")
+	})
+
+	t.Run("dead letter after max attempts", func(t *testing.T) {
+		receiver := &fakeWebhookReceiver{
+			t:        t,
+			secret:   "the-secret-of-the-failing-hook",
+			statuses: []int{500, 500, 500},
+		}
+		webhook := createWebhook(t, receiver, api.WebhookEventUserDeleted)
+
+		user := &models.Identity{Name: "deleted@example.com"}
+		assert.NilError(t, data.CreateIdentity(srv.DB(), user))
+		resp := request(t, http.MethodDelete, "/api/users/"+user.ID.String(), nil)
+		assert.Equal(t, resp.Code, http.StatusNoContent, resp.Body.String())
+
+		now = time.Now()
+		for i := 1; i <= 3; i++ {
+			srv.webhooks.deliverDue(ctx, srv.db)
+			now = now.Add(srv.webhooks.backoff(i))
+		}
+		assert.Equal(t, len(receiver.received()), 0)
+
+		dead := listDeliveries(t, webhook, api.WebhookDeliveryDeadLetter)
+		assert.Equal(t, len(dead), 1)
+		assert.Equal(t, dead[0].Attempts, 3)
+		assert.Equal(t, dead[0].EventType, api.WebhookEventUserDeleted)
+		assert.Equal(t, dead[0].ResponseStatus, http.StatusInternalServerError)
+
+		var event api.WebhookEvent
+		assert.NilError(t, json.Unmarshal(dead[0].Payload, &event))
+		assert.Equal(t, string(event.Data), `{"id":"`+user.ID.String()+`"}`)
+
+		// dead letters are not attempted again
+		now = now.Add(24 * time.Hour)
+		srv.webhooks.deliverDue(ctx, srv.db)
+		assert.Equal(t, len(listDeliveries(t, webhook, api.WebhookDeliveryDeadLetter)), 1)
+	})
+
+	t.Run("events are filtered by type", func(t *testing.T) {
+		receiver := &fakeWebhookReceiver{t: t, secret: "the-secret-of-the-filtered-hook"}
+		webhook := createWebhook(t, receiver, api.WebhookEventDestinationRegistered)
+
+		resp := request(t, http.MethodPost, "/api/users", api.CreateUserRequest{Name: "filtered@example.com"})
+		assert.Equal(t, resp.Code, http.StatusCreated, resp.Body.String())
+
+		now = time.Now()
+		srv.webhooks.deliverDue(ctx, srv.db)
+		assert.Equal(t, len(receiver.received()), 0)
+		assert.Equal(t, len(listDeliveries(t, webhook, "")), 0)
+	})
+}
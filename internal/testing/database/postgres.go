@@ -43,7 +43,7 @@ func PostgresDriver(t TestingT, schemaSuffix string) *Driver {
 	suffix := strings.NewReplacer("--", "", ";", "", "/", "").Replace(schemaSuffix)
 	name := "testing"
 	if schemaSuffix != "" {
-		name = fmt.Sprintf("testing_%v_%v", suffix, generate.MathRandom(5, generate.CharsetNumbers))
+		name = fmt.Sprintf("testing_%v_%v", suffix, generate.MathRandom(10, generate.CharsetNumbers))
 	}
 	db, err := sql.Open("pgx", pgConn)
 	assert.NilError(t, err, "connect to postgresql")
@@ -0,0 +1,26 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+
+	"gotest.tools/v3/assert"
+)
+
+// SQLiteDriver returns a driver for a new sqlite database in a temporary
+// directory. Tests using the driver are skipped unless the INFRA_TEST_SQLITE
+// environment variable is set, because sqlite is only supported for
+// evaluation.
+func SQLiteDriver(t TestingT) *Driver {
+	t.Helper()
+	if os.Getenv("INFRA_TEST_SQLITE") == "" {
+		t.Skip("Set INFRA_TEST_SQLITE=1 to test against sqlite")
+	}
+
+	dir, err := os.MkdirTemp("", "infra-sqlite")
+	assert.NilError(t, err)
+	t.Cleanup(func() {
+		assert.NilError(t, os.RemoveAll(dir))
+	})
+	return &Driver{DSN: filepath.Join(dir, "infra.db")}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/infrahq/infra/internal/server/data/table"
+)
+
+// loader reads struct types from the syntax of Go source files. The types are
+// not type checked, which keeps the tool independent of the version of Go used
+// to run it, and of any errors in a previously generated file.
+type loader struct {
+	fileset *token.FileSet
+	byDir   map[string]*pkg
+}
+
+type pkg struct {
+	name  string
+	dir   string
+	types map[string]typeDecl
+}
+
+type typeDecl struct {
+	spec *ast.TypeSpec
+	file *ast.File
+}
+
+func newLoader() *loader {
+	return &loader{fileset: token.NewFileSet(), byDir: make(map[string]*pkg)}
+}
+
+// loadDir parses the non-test Go files of the package in dir.
+func (l *loader) loadDir(dir string) (*pkg, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := l.byDir[dir]; ok {
+		return p, nil
+	}
+
+	bpkg, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, fmt.Errorf("find package in %v: %w", dir, err)
+	}
+
+	p := &pkg{name: bpkg.Name, dir: dir, types: make(map[string]typeDecl)}
+	for _, name := range bpkg.GoFiles {
+		file, err := parser.ParseFile(l.fileset, filepath.Join(dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				spec := spec.(*ast.TypeSpec) // nolint:forcetypeassert
+				p.types[spec.Name.Name] = typeDecl{spec: spec, file: file}
+			}
+		}
+	}
+	l.byDir[dir] = p
+	return p, nil
+}
+
+// importPackage loads the package imported by file with the name used in
+// selector expressions.
+func (l *loader) importPackage(from *pkg, file *ast.File, name string) (*pkg, error) {
+	for _, imp := range file.Imports {
+		importPath, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case imp.Name != nil && imp.Name.Name != name:
+			continue
+		case imp.Name == nil && path.Base(importPath) != name:
+			continue
+		}
+
+		bpkg, err := build.Import(importPath, from.dir, build.FindOnly)
+		if err != nil {
+			return nil, fmt.Errorf("find package %v: %w", importPath, err)
+		}
+		return l.loadDir(bpkg.Dir)
+	}
+	return nil, fmt.Errorf("no import found for %v", name)
+}
+
+// structFields returns the fields of the struct type with name that are stored
+// in table columns. Fields of embedded structs are included, and unexported
+// fields and fields with a struct tag of `db:"-"` are excluded.
+func (l *loader) structFields(p *pkg, name string) ([]table.Field, error) {
+	decl, ok := p.types[name]
+	if !ok {
+		return nil, fmt.Errorf("type %v not found in %v", name, p.dir)
+	}
+	return l.fieldsOfType(p, decl.file, decl.spec.Type)
+}
+
+func (l *loader) fieldsOfType(p *pkg, file *ast.File, expr ast.Expr) ([]table.Field, error) {
+	switch typ := expr.(type) {
+	case *ast.Ident:
+		return l.structFields(p, typ.Name)
+	case *ast.SelectorExpr:
+		pkgIdent, ok := typ.X.(*ast.Ident)
+		if !ok {
+			return nil, fmt.Errorf("unsupported type %T", typ.X)
+		}
+		imported, err := l.importPackage(p, file, pkgIdent.Name)
+		if err != nil {
+			return nil, err
+		}
+		return l.structFields(imported, typ.Sel.Name)
+	case *ast.StructType:
+		return l.fieldsOfStruct(p, file, typ)
+	default:
+		return nil, fmt.Errorf("unsupported type %T", expr)
+	}
+}
+
+func (l *loader) fieldsOfStruct(p *pkg, file *ast.File, st *ast.StructType) ([]table.Field, error) {
+	var fields []table.Field
+	for _, field := range st.Fields.List {
+		var tag reflect.StructTag
+		if field.Tag != nil {
+			value, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+			tag = reflect.StructTag(value)
+		}
+		if strings.HasPrefix(tag.Get("db"), "-") {
+			continue
+		}
+
+		if len(field.Names) == 0 {
+			if !ast.IsExported(embeddedName(field.Type)) {
+				continue
+			}
+			embedded, err := l.fieldsOfType(p, file, field.Type)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, embedded...)
+			continue
+		}
+
+		for _, name := range field.Names {
+			if !name.IsExported() {
+				continue
+			}
+			fields = append(fields, table.Field{
+				Name:   name.Name,
+				Column: table.ColumnName(name.Name, tag),
+			})
+		}
+	}
+	return fields, nil
+}
+
+func embeddedName(expr ast.Expr) string {
+	switch typ := expr.(type) {
+	case *ast.Ident:
+		return typ.Name
+	case *ast.SelectorExpr:
+		return typ.Sel.Name
+	case *ast.StarExpr:
+		return embeddedName(typ.X)
+	default:
+		return ""
+	}
+}
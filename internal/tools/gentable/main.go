@@ -0,0 +1,62 @@
+// Command gentable generates the Table, Columns, Values, and ScanFields
+// methods of table types from the fields of their model structs. It is run by
+// go generate from the package that defines the table types.
+//
+//	gentable -output tables_gen.go grantsTable=grants accessKeyTable=access_keys
+//
+// Each argument is the name of a type, and the name of the database table of
+// that type. Column names are read from the `db` struct tag of each field, or
+// the field name converted to snake case when there is no tag. Fields with a
+// `db:"-"` tag are not stored in the table.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/infrahq/infra/internal/server/data/table"
+)
+
+func main() {
+	output := flag.String("output", "tables_gen.go", "name of the file to write")
+	flag.Parse()
+
+	if err := run(*output, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "gentable: "+err.Error())
+		os.Exit(1)
+	}
+}
+
+func run(output string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("at least one typeName=table argument is required")
+	}
+
+	ld := newLoader()
+	pkg, err := ld.loadDir(".")
+	if err != nil {
+		return err
+	}
+
+	models := make([]table.Model, 0, len(args))
+	for _, arg := range args {
+		typeName, tableName, ok := strings.Cut(arg, "=")
+		if !ok || typeName == "" || tableName == "" {
+			return fmt.Errorf("argument %q must be in the form typeName=table", arg)
+		}
+
+		fields, err := ld.structFields(pkg, typeName)
+		if err != nil {
+			return fmt.Errorf("type %v: %w", typeName, err)
+		}
+		models = append(models, table.Model{TypeName: typeName, Table: tableName, Fields: fields})
+	}
+
+	src, err := table.GenerateFile(pkg.name, models)
+	if err != nil {
+		return fmt.Errorf("generate: %w", err)
+	}
+	return os.WriteFile(output, src, 0o644) // nolint:gosec // source code is not secret
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"go/ast"
 	"go/token"
+	"go/types"
 
 	"golang.org/x/tools/go/analysis"
 	"golang.org/x/tools/go/ast/astutil"
@@ -32,6 +33,9 @@ func run(pass *analysis.Pass) error {
 			if err = checkB(pass, node); err != nil {
 				return false
 			}
+			if err = checkInColumn(pass, node); err != nil {
+				return false
+			}
 
 			checkConstructorNotACallExpr(pass, cursor)
 			checkBNotACallExpr(pass, cursor)
@@ -47,6 +51,7 @@ func run(pass *analysis.Pass) error {
 var (
 	constructorName           = "New"
 	buildFuncName             = "B"
+	inFuncNames               = []string{"In", "NotIn"}
 	pkgName                   = "querybuilder"
 	columnsMethodName         = "Columns"
 	tableMethodName           = "Table"
@@ -135,6 +140,53 @@ func checkB(pass *analysis.Pass, node ast.Node) error {
 	return nil
 }
 
+// checkInColumn checks that the column argument to querybuilder.In and
+// querybuilder.NotIn is a string literal.
+func checkInColumn(pass *analysis.Pass, node ast.Node) error {
+	call, ok := node.(*ast.CallExpr)
+	if !ok {
+		return nil
+	}
+
+	fun := call.Fun
+	// explicit instantiation, ex: querybuilder.In[string](...)
+	if index, ok := fun.(*ast.IndexExpr); ok {
+		fun = index.X
+	}
+	se, ok := fun.(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+
+	name, ok := inFuncName(pass, se)
+	if !ok {
+		return nil
+	}
+
+	if count := len(call.Args); count != 3 {
+		return fmt.Errorf("unexpected argument count %v to querybuilder.%v", count, name)
+	}
+
+	if _, ok := call.Args[1].(*ast.BasicLit); !ok {
+		pass.Reportf(call.Pos(), "column argument to %v must be a string literal, not %T",
+			name, call.Args[1])
+	}
+	return nil
+}
+
+func inFuncName(pass *analysis.Pass, se *ast.SelectorExpr) (string, bool) {
+	fn, ok := pass.TypesInfo.Uses[se.Sel].(*types.Func)
+	if !ok || fn.Pkg() == nil || fn.Pkg().Path() != packagePath {
+		return "", false
+	}
+	for _, name := range inFuncNames {
+		if fn.Name() == name {
+			return name, true
+		}
+	}
+	return "", false
+}
+
 func isTableMethod(callExpr *ast.CallExpr) bool {
 	sel, ok := callExpr.Fun.(*ast.SelectorExpr)
 	if !ok {
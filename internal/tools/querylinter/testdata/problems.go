@@ -31,6 +31,11 @@ func Problems() {
 	receiveQueryBuilderFunc(qb.B) // want `Query.B must be called directly`
 
 	qb.B(otherSignatures{}.Table(couldBeFromAnywhere)) // want `first argument to Query.B must be a string literal`
+
+	querybuilder.In(qb, "ok", []string{couldBeFromAnywhere})
+	querybuilder.In(qb, couldBeFromAnywhere, []string{"a"}) // want `column argument to In must be a string literal`
+	querybuilder.NotIn(qb, "lit"+giveStr(), []int{1})       // want `column argument to NotIn must be a string literal`
+	querybuilder.In[string](qb, giveStr(), nil)             // want `column argument to In must be a string literal`
 }
 
 func GoodExamples() {
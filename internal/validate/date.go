@@ -41,10 +41,10 @@ func (s DateRule) Validate() *Failure {
 		problems = append(problems, fmt.Sprintf(format, args...))
 	}
 	if value.Before(s.NotBefore) {
-		add("must be after %s", s.NotBefore)
+		add("must be after %s", s.NotBefore.Format(time.RFC3339))
 	}
 	if value.After(s.NotAfter) {
-		add("must be before %s", s.NotAfter)
+		add("must be before %s", s.NotAfter.Format(time.RFC3339))
 	}
 
 	if len(problems) > 0 {
@@ -0,0 +1,57 @@
+package validate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Domain validates a field that should contain a DNS hostname. The hostname
+// must be lowercase, and every label must follow the DNS label rules.
+func Domain(name string, value string) ValidationRule {
+	return domain{name: name, value: value}
+}
+
+type domain struct {
+	name  string
+	value string
+}
+
+func (d domain) Validate() *Failure {
+	if d.value == "" {
+		return nil
+	}
+	if len(d.value) > 253 {
+		return Fail(d.name, "must be at most 253 characters")
+	}
+
+	var problems []string
+	for _, label := range strings.Split(d.value, ".") {
+		switch {
+		case label == "":
+			problems = append(problems, "must not contain empty labels")
+		case len(label) > 63:
+			problems = append(problems, fmt.Sprintf("label %q must be at most 63 characters", label))
+		case label[0] == '-' || label[len(label)-1] == '-':
+			problems = append(problems, fmt.Sprintf("label %q must not start or end with '-'", label))
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+				problems = append(problems, fmt.Sprintf("character %q is not allowed, only lowercase letters, numbers, '-' and '.' are allowed", r))
+				break
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return Fail(d.name, problems...)
+	}
+	return nil
+}
+
+func (d domain) DescribeSchema(parent *openapi3.Schema) {
+	schema := schemaForProperty(parent, d.name)
+	schema.Format = "hostname"
+	max := uint64(253)
+	schema.MaxLength = &max
+}
@@ -0,0 +1,54 @@
+package validate
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+type DomainExample struct {
+	Host string
+}
+
+func (e DomainExample) ValidationRules() []ValidationRule {
+	return []ValidationRule{
+		Domain("host", e.Host),
+	}
+}
+
+func TestDomain_Validate(t *testing.T) {
+	type testCase struct {
+		name        string
+		domain      string
+		expectedErr string
+	}
+
+	run := func(t *testing.T, tc testCase) {
+		err := Validate(DomainExample{Host: tc.domain})
+		if tc.expectedErr == "" {
+			assert.NilError(t, err)
+			return
+		}
+		assert.ErrorContains(t, err, tc.expectedErr)
+	}
+
+	var testCases = []testCase{
+		{name: "subdomain", domain: "acme.infrahq.com"},
+		{name: "with numbers and dash", domain: "acme-2.example.com"},
+		{name: "single label", domain: "localhost"},
+		{name: "uppercase", domain: "Acme.example.com", expectedErr: `character 'A' is not allowed`},
+		{name: "leading dash", domain: "-acme.example.com", expectedErr: `label "-acme" must not start or end with '-'`},
+		{name: "trailing dot", domain: "acme.example.com.", expectedErr: "must not contain empty labels"},
+		{name: "underscore", domain: "ac_me.example.com", expectedErr: `character '_' is not allowed`},
+		{
+			name:        "long label",
+			domain:      "a123456789012345678901234567890123456789012345678901234567890123.example.com",
+			expectedErr: "must be at most 63 characters",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
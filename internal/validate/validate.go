@@ -3,6 +3,7 @@ package validate
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/getkin/kin-openapi/openapi3"
@@ -31,7 +32,7 @@ func validateStruct(v reflect.Value) Error {
 	if ok && (v.Kind() != reflect.Pointer || !v.IsNil()) {
 		for _, rule := range req.ValidationRules() {
 			if failure := rule.Validate(); failure != nil {
-				err[failure.Name] = append(err[failure.Name], failure.Problems...)
+				err.add(failure.Name, failure.Problems...)
 			}
 		}
 	}
@@ -39,28 +40,22 @@ func validateStruct(v reflect.Value) Error {
 	switch v.Kind() { // nolint:exhaustive
 	case reflect.Struct:
 		for i := 0; i < v.NumField(); i++ {
+			if !v.Type().Field(i).IsExported() {
+				// unexported fields, like the fields of a time.Time, can not
+				// have validation rules
+				continue
+			}
 			f := v.Field(i)
 			if v.Type().Field(i).Anonymous {
 				// validate the embedded struct
-				for k, v := range validateStruct(f) {
-					err[k] = append(err[k], v...)
-				}
+				err.merge("", validateStruct(f))
 				continue
 			}
-			name := fieldName(v.Type().Field(i))
-			for k, v := range validateStruct(f) {
-				n := name
-				if k != "" {
-					n = name + "." + k
-				}
-				err[n] = append(err[n], v...)
-			}
+			err.merge(fieldName(v.Type().Field(i)), validateStruct(f))
 		}
 	case reflect.Slice:
 		for i := 0; i < v.Len(); i++ {
-			for k, v := range validateStruct(v.Index(i)) {
-				err[k] = append(err[k], v...)
-			}
+			err.merge("", validateStruct(v.Index(i)))
 		}
 	}
 	return err
@@ -105,15 +100,71 @@ type Request interface {
 // "".
 type Error map[string][]string
 
+// add the problems to the field name. A problem that was already added to the
+// field is skipped, so that a rule that applies to every item of a list, or
+// a rule of an embedded struct that is promoted to the parent, is only
+// reported once. When the field is missing, any other problems are skipped,
+// because the other rules for the field can not succeed.
+func (e Error) add(name string, problems ...string) {
+	for _, problem := range problems {
+		existing := e[name]
+		if contains(existing, problem) {
+			continue
+		}
+		if contains(existing, ProblemRequired) {
+			return
+		}
+		if problem == ProblemRequired {
+			existing = nil
+		}
+		e[name] = append(existing, problem)
+	}
+}
+
+// merge adds all the problems from other to e. The field names from other are
+// prefixed with prefix.
+func (e Error) merge(prefix string, other Error) {
+	for _, k := range other.fieldNames() {
+		name := prefix
+		switch {
+		case prefix == "":
+			name = k
+		case k != "":
+			name = prefix + "." + k
+		}
+		e.add(name, other[k]...)
+	}
+}
+
+// fieldNames returns the names of the fields with problems in sorted order.
+func (e Error) fieldNames() []string {
+	names := make([]string, 0, len(e))
+	for k := range e {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
+
+// Error returns a message with the problems of every field. The fields are
+// sorted by name, so that the message is the same every time.
 func (e Error) Error() string {
 	var buf strings.Builder
 	buf.WriteString("validation failed: ")
-	i := 0
-	for k, v := range e {
+	for i, k := range e.fieldNames() {
+		v := e[k]
 		if i != 0 {
 			buf.WriteString(", ")
 		}
-		i++
 		if k == "" {
 			buf.WriteString(strings.Join(v, ", "))
 			continue
@@ -129,6 +180,9 @@ func Fail(name string, problems ...string) *Failure {
 	return &Failure{Name: name, Problems: problems}
 }
 
+// ProblemRequired is the problem of a field that fails the Required rule.
+const ProblemRequired = "is required"
+
 type requiredRule struct {
 	name  string
 	value any
@@ -151,7 +205,30 @@ func (r requiredRule) Validate() *Failure {
 	if !reflect.ValueOf(r.value).IsZero() {
 		return nil
 	}
-	return Fail(r.name, "is required")
+	return Fail(r.name, ProblemRequired)
+}
+
+type requiredIfRule struct {
+	requiredRule
+	condition bool
+}
+
+// RequiredIf is like Required, but only checks the value when condition is
+// true. Use it for a field that is required only when another field is set, or
+// only for some callers.
+func RequiredIf(name string, value any, condition bool) ValidationRule {
+	return requiredIfRule{requiredRule: requiredRule{name: name, value: value}, condition: condition}
+}
+
+// DescribeSchema does nothing, because the schema can not describe a field
+// that is only required some of the time.
+func (r requiredIfRule) DescribeSchema(*openapi3.Schema) {}
+
+func (r requiredIfRule) Validate() *Failure {
+	if !r.condition {
+		return nil
+	}
+	return r.requiredRule.Validate()
 }
 
 // Field is used to construct validation rules that incorporate multiple fields.
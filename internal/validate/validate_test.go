@@ -3,6 +3,7 @@ package validate
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"gotest.tools/v3/assert"
 )
@@ -128,6 +129,7 @@ type NestedExample struct {
 	Sub      SubExample `json:"sub"`
 	ExampleRequest
 	Many []ExampleRequest
+	When time.Time
 }
 
 func (n NestedExample) ValidationRules() []ValidationRule {
@@ -155,6 +157,7 @@ func TestValidate_Traversal(t *testing.T) {
 				Nested: ExampleRequest{ID: "id", Third: true},
 			},
 			ExampleRequest: ExampleRequest{ID: "ok", First: "1"},
+			When:           time.Now(),
 		}
 		err := Validate(n)
 		assert.NilError(t, err)
@@ -196,6 +199,61 @@ func TestValidate_Traversal(t *testing.T) {
 		}
 		assert.DeepEqual(t, fieldError, expected)
 	})
+
+	t.Run("problems are reported once", func(t *testing.T) {
+		n := NestedExample{
+			Sub: SubExample{
+				Ok:     true,
+				Nested: ExampleRequest{ID: "id", Third: true},
+			},
+			ExampleRequest: ExampleRequest{ID: "ok", First: "1"},
+			Many: []ExampleRequest{
+				{First: "1", TooMany: "abcdefg"},
+				{First: "1"},
+				{ID: "ok", First: "1", TooMany: "abcdefg"},
+			},
+		}
+		err := Validate(n)
+		var fieldError Error
+		assert.Assert(t, errors.As(err, &fieldError))
+		expected := Error{
+			"many.id":      {"is required"},
+			"many.tooMany": {"can be at most 5 characters"},
+		}
+		assert.DeepEqual(t, fieldError, expected)
+		assert.Error(t, err, "validation failed: many.id: is required, many.tooMany: can be at most 5 characters")
+	})
+}
+
+func TestError_Add(t *testing.T) {
+	t.Run("duplicate problems", func(t *testing.T) {
+		e := Error{}
+		e.add("name", "must be lowercase")
+		e.add("name", "must be lowercase", "can be at most 3 characters")
+		assert.DeepEqual(t, e, Error{"name": {"must be lowercase", "can be at most 3 characters"}})
+	})
+	t.Run("required replaces other problems", func(t *testing.T) {
+		e := Error{}
+		e.add("name", "must be lowercase")
+		e.add("name", ProblemRequired)
+		e.add("name", "can be at most 3 characters")
+		assert.DeepEqual(t, e, Error{"name": {ProblemRequired}})
+	})
+}
+
+func TestError_Error(t *testing.T) {
+	e := Error{
+		"zeta":  {"is required"},
+		"alpha": {"must be lowercase", "can be at most 3 characters"},
+		"":      {"one of (alpha, zeta) is required"},
+		"beta":  {"is required"},
+	}
+	expected := "validation failed: one of (alpha, zeta) is required, " +
+		"alpha: must be lowercase, can be at most 3 characters, " +
+		"beta: is required, zeta: is required"
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, e.Error(), expected)
+	}
 }
 
 type MutualExample struct {
@@ -313,3 +371,36 @@ func TestRequireOneOf_Validate(t *testing.T) {
 		assert.Error(t, err, "validation failed: only one of (first, third) can have a value")
 	})
 }
+
+type RequiredIfExample struct {
+	Kind  string
+	Value string
+}
+
+func (m RequiredIfExample) ValidationRules() []ValidationRule {
+	return []ValidationRule{
+		RequiredIf("value", m.Value, m.Kind == "custom"),
+	}
+}
+
+func TestRequiredIf_Validate(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		e := RequiredIfExample{}
+		assert.NilError(t, Validate(e))
+
+		e = RequiredIfExample{Kind: "custom", Value: "value"}
+		assert.NilError(t, Validate(e))
+
+		e = RequiredIfExample{Kind: "other"}
+		assert.NilError(t, Validate(e))
+	})
+	t.Run("with failure", func(t *testing.T) {
+		e := RequiredIfExample{Kind: "custom"}
+		err := Validate(e)
+		assert.Error(t, err, "validation failed: value: is required")
+
+		var verr Error
+		assert.Assert(t, errors.As(err, &verr))
+		assert.DeepEqual(t, verr, Error{"value": {ProblemRequired}})
+	})
+}
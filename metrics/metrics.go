@@ -1,8 +1,10 @@
 package metrics
 
 import (
+	"crypto/subtle"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -38,15 +40,33 @@ func NewRegistry(version string) *prometheus.Registry {
 	return registry
 }
 
+// MiddlewareOptions configures the metrics emitted by Middleware.
+type MiddlewareOptions struct {
+	// OrgLabel returns the value of an org label for the request. When
+	// OrgLabel is nil the metrics have no org label. Every organization adds
+	// another set of series to the histogram, so this should only be used
+	// when there are few organizations.
+	OrgLabel func(c *gin.Context) string
+}
+
 // Middleware registers the http_request_duration_seconds histogram metric with registry
 // and returns a middleware that emits a request_duration_seconds metric on every request.
-func Middleware(registry prometheus.Registerer) gin.HandlerFunc {
+//
+// Requests are labeled by the route template, not the path of the request,
+// and by the class of the status code (ex: 2xx), so that the number of series
+// does not grow with the number of resources.
+func Middleware(registry prometheus.Registerer, opts MiddlewareOptions) gin.HandlerFunc {
+	labels := []string{"method", "path", "status", "blocking"}
+	if opts.OrgLabel != nil {
+		labels = append(labels, "org")
+	}
+
 	requestDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace: "http",
 		Name:      "request_duration_seconds",
 		Help:      "A histogram of duration, in seconds, handling HTTP requests.",
 		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
-	}, []string{"host", "method", "path", "status", "blocking"})
+	}, labels)
 
 	requestCount := prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: "http",
@@ -66,16 +86,27 @@ func Middleware(registry prometheus.Registerer) gin.HandlerFunc {
 		t := time.Now()
 		c.Next()
 
-		requestDuration.With(prometheus.Labels{
-			"host":     c.Request.Host,
+		values := prometheus.Labels{
 			"method":   c.Request.Method,
 			"path":     c.FullPath(),
-			"status":   strconv.Itoa(c.Writer.Status()),
+			"status":   statusClassLabel(c.Writer.Status()),
 			"blocking": blocking,
-		}).Observe(time.Since(t).Seconds())
+		}
+		if opts.OrgLabel != nil {
+			values["org"] = opts.OrgLabel(c)
+		}
+		requestDuration.With(values).Observe(time.Since(t).Seconds())
 	}
 }
 
+// statusClassLabel returns the class of an HTTP status code, for example 4xx.
+func statusClassLabel(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
 func blockingRequestLabel(req *http.Request) string {
 	switch req.URL.Query().Get("lastUpdateIndex") {
 	case "", "0":
@@ -85,19 +116,40 @@ func blockingRequestLabel(req *http.Request) string {
 	}
 }
 
+// HandlerOptions configures the handler returned by NewHandler.
+type HandlerOptions struct {
+	// BearerToken, when set, must be sent as a bearer token in the
+	// Authorization header of every request for metrics.
+	BearerToken string
+}
+
 // NewHandler creates a new gin.Engine, and adds a 'GET /metrics' handler to it.
 // The handler serves prometheus metrics from the promRegistry.
-func NewHandler(promRegistry *prometheus.Registry) *gin.Engine {
+func NewHandler(promRegistry *prometheus.Registry, opts HandlerOptions) *gin.Engine {
 	engine := gin.New()
+	handler := promhttp.InstrumentMetricHandler(
+		promRegistry,
+		promhttp.HandlerFor(promRegistry, promhttp.HandlerOpts{}))
 	engine.GET("/metrics", func(c *gin.Context) {
-		handler := promhttp.InstrumentMetricHandler(
-			promRegistry,
-			promhttp.HandlerFor(promRegistry, promhttp.HandlerOpts{}))
+		if opts.BearerToken != "" && !validBearerToken(c.Request, opts.BearerToken) {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
 		handler.ServeHTTP(c.Writer, c.Request)
 	})
 	return engine
 }
 
+func validBearerToken(req *http.Request, expected string) bool {
+	header := req.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(header, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
 // Metric is a container for a count metric and its related labels
 type Metric struct {
 	Count       float64
@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gotest.tools/v3/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	send := func(t *testing.T, router *gin.Engine, path string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Host = "anything.example.com"
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	newRouter := func(registry prometheus.Registerer, opts MiddlewareOptions) *gin.Engine {
+		router := gin.New()
+		router.Use(Middleware(registry, opts))
+		router.GET("/api/users/:id", func(c *gin.Context) {
+			if c.Param("id") == "missing" {
+				c.Status(http.StatusNotFound)
+				return
+			}
+			c.Status(http.StatusOK)
+		})
+		return router
+	}
+
+	t.Run("labeled by route and status class", func(t *testing.T) {
+		registry := prometheus.NewRegistry()
+		router := newRouter(registry, MiddlewareOptions{})
+
+		send(t, router, "/api/users/1")
+		send(t, router, "/api/users/2")
+		send(t, router, "/api/users/missing")
+
+		count, err := testutil.GatherAndCount(registry, "http_request_duration_seconds")
+		assert.NilError(t, err)
+		assert.Equal(t, count, 2)
+
+		actual := gatherText(t, registry)
+		assert.Assert(t, strings.Contains(actual,
+			`http_request_duration_seconds_count{blocking="false",method="GET",path="/api/users/:id",status="2xx"} 2`), actual)
+		assert.Assert(t, strings.Contains(actual,
+			`http_request_duration_seconds_count{blocking="false",method="GET",path="/api/users/:id",status="4xx"} 1`), actual)
+		assert.Assert(t, !strings.Contains(actual, "anything.example.com"), actual)
+	})
+
+	t.Run("with org label", func(t *testing.T) {
+		registry := prometheus.NewRegistry()
+		router := newRouter(registry, MiddlewareOptions{
+			OrgLabel: func(c *gin.Context) string {
+				return "org-" + c.Param("id")
+			},
+		})
+
+		send(t, router, "/api/users/1")
+
+		actual := gatherText(t, registry)
+		assert.Assert(t, strings.Contains(actual,
+			`http_request_duration_seconds_count{blocking="false",method="GET",org="org-1",path="/api/users/:id",status="2xx"} 1`), actual)
+	})
+}
+
+func TestStatusClassLabel(t *testing.T) {
+	cases := map[int]string{
+		http.StatusOK:                  "2xx",
+		http.StatusNoContent:           "2xx",
+		http.StatusFound:               "3xx",
+		http.StatusUnauthorized:        "4xx",
+		http.StatusInternalServerError: "5xx",
+		0:                              "unknown",
+		999:                            "unknown",
+	}
+	for status, expected := range cases {
+		assert.Equal(t, statusClassLabel(status), expected, status)
+	}
+}
+
+func TestNewHandler(t *testing.T) {
+	registry := NewRegistry("0.0.1")
+
+	get := func(t *testing.T, handler http.Handler, authorization string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("without a bearer token", func(t *testing.T) {
+		handler := NewHandler(registry, HandlerOptions{})
+		resp := get(t, handler, "")
+		assert.Equal(t, resp.Code, http.StatusOK)
+		assert.Assert(t, strings.Contains(resp.Body.String(), "build_info"))
+	})
+
+	t.Run("with a bearer token", func(t *testing.T) {
+		handler := NewHandler(registry, HandlerOptions{BearerToken: "the-token"})
+
+		resp := get(t, handler, "")
+		assert.Equal(t, resp.Code, http.StatusUnauthorized)
+		assert.Equal(t, resp.Body.Len(), 0)
+
+		resp = get(t, handler, "Bearer wrong-token")
+		assert.Equal(t, resp.Code, http.StatusUnauthorized)
+
+		resp = get(t, handler, "the-token")
+		assert.Equal(t, resp.Code, http.StatusUnauthorized)
+
+		resp = get(t, handler, "Bearer the-token")
+		assert.Equal(t, resp.Code, http.StatusOK)
+		assert.Assert(t, strings.Contains(resp.Body.String(), "build_info"))
+	})
+}
+
+func gatherText(t *testing.T, registry *prometheus.Registry) string {
+	t.Helper()
+	handler := NewHandler(registry, HandlerOptions{})
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, resp.Code, http.StatusOK)
+	return resp.Body.String()
+}
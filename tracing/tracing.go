@@ -0,0 +1,199 @@
+// Package tracing exports OpenTelemetry traces of HTTP requests, and
+// propagates the W3C trace context between the CLI, the infra server, the
+// connector, and the kubernetes API server.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/infrahq/infra/internal"
+)
+
+const instrumentationName = "github.com/infrahq/infra/tracing"
+
+// propagator reads and writes the traceparent and tracestate headers. It is
+// used even when traces are not exported, so that a trace started by a client
+// continues through every hop.
+var propagator = propagation.TraceContext{}
+
+// Options configures the export of traces.
+type Options struct {
+	// Endpoint is the URL of an OTLP/HTTP collector, for example
+	// http://localhost:4318. Traces are not exported when Endpoint is empty.
+	Endpoint string
+	// SampleRatio is the fraction of new traces that are sampled, from 0 to 1.
+	// Requests that continue a trace follow the sampling decision of the
+	// caller.
+	SampleRatio float64
+}
+
+// Setup configures the global tracer provider to export traces to the
+// endpoint in opts. The returned function flushes and stops the export, and
+// must be called before the process exits. When opts.Endpoint is empty,
+// traces are propagated but not recorded.
+func Setup(ctx context.Context, serviceName string, opts Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagator)
+	if opts.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	if opts.SampleRatio < 0 || opts.SampleRatio > 1 {
+		return nil, fmt.Errorf("tracing sample ratio must be between 0 and 1, got %v", opts.SampleRatio)
+	}
+
+	u, err := url.Parse(opts.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("tracing endpoint: %w", err)
+	}
+	clientOpts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+	switch u.Scheme {
+	case "http":
+		clientOpts = append(clientOpts, otlptracehttp.WithInsecure())
+	case "https":
+	default:
+		return nil, fmt.Errorf("tracing endpoint must be an http or https URL, got %q", opts.Endpoint)
+	}
+	if u.Path != "" && u.Path != "/" {
+		clientOpts = append(clientOpts, otlptracehttp.WithURLPath(u.Path))
+	}
+
+	exporter, err := otlptracehttp.New(ctx, clientOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("create trace exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceNameKey.String(serviceName),
+			semconv.ServiceVersionKey.String(internal.FullVersion()))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// ContextFromEnv returns a copy of ctx that continues the trace in the
+// TRACEPARENT and TRACESTATE environment variables. It allows a CLI command to
+// be part of a trace started by the program that ran the command. ctx is
+// returned unchanged when TRACEPARENT is not set.
+func ContextFromEnv(ctx context.Context) context.Context {
+	carrier := propagation.MapCarrier{
+		"traceparent": os.Getenv("TRACEPARENT"),
+		"tracestate":  os.Getenv("TRACESTATE"),
+	}
+	if carrier["traceparent"] == "" {
+		return ctx
+	}
+	return propagator.Extract(ctx, carrier)
+}
+
+// Start starts a span named name as a child of the span in ctx. The span is
+// created by the global tracer provider, so it is only recorded when tracing
+// is enabled.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// End the span, and record err on the span when it is not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Middleware starts a server span for every request. The span continues the
+// trace from the traceparent header of the request, and is added to the
+// context of the request, so that spans created by handlers are its children.
+//
+// The span is named by the route of the request instead of the path, so that
+// IDs in the path do not create a new span name for every request.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := propagator.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		name := "HTTP " + c.Request.Method
+		route := c.FullPath()
+		if route != "" {
+			name += " " + route
+		}
+		ctx, span := Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethodKey.String(c.Request.Method),
+				semconv.HTTPRouteKey.String(route)))
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
+
+// Transport returns a http.RoundTripper that starts a client span for every
+// request sent by base, and adds the traceparent header of the span to the
+// request. A nil base uses http.DefaultTransport.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base}
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := Start(req.Context(), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPMethodKey.String(req.Method),
+			semconv.NetPeerNameKey.String(req.URL.Hostname())))
+	defer span.End()
+
+	// a RoundTripper must not modify the request it was given
+	req = req.Clone(ctx)
+	propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+	}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the base transport, so
+// that http.Client.CloseIdleConnections works with a wrapped transport.
+func (t *transport) CloseIdleConnections() {
+	type closeIdler interface{ CloseIdleConnections() }
+	if tr, ok := t.base.(closeIdler); ok {
+		tr.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,164 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"gotest.tools/v3/assert"
+)
+
+func setupTestTracer(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	})
+	return exporter
+}
+
+func spanByName(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("no span named %q in %v", name, spanNames(spans))
+	return tracetest.SpanStub{}
+}
+
+func spanNames(spans tracetest.SpanStubs) []string {
+	var names []string
+	for _, span := range spans {
+		names = append(names, span.Name)
+	}
+	return names
+}
+
+func TestMiddleware_AcrossProxy(t *testing.T) {
+	exporter := setupTestTracer(t)
+
+	var upstreamTraceparent string
+	upstreamRouter := gin.New()
+	upstreamRouter.Use(Middleware())
+	upstreamRouter.GET("/api/v1/namespaces/:name", func(c *gin.Context) {
+		upstreamTraceparent = c.GetHeader("traceparent")
+		c.Status(http.StatusOK)
+	})
+	upstream := httptest.NewServer(upstreamRouter)
+	t.Cleanup(upstream.Close)
+
+	u, err := url.Parse(upstream.URL)
+	assert.NilError(t, err)
+	proxy := httputil.NewSingleHostReverseProxy(u)
+	proxy.Transport = Transport(nil)
+
+	proxyRouter := gin.New()
+	proxyRouter.Use(Middleware())
+	proxyRouter.Any("/*path", func(c *gin.Context) {
+		proxy.ServeHTTP(c.Writer, c.Request)
+	})
+	// httptest.ResponseRecorder does not support CloseNotify, which is
+	// required by the reverse proxy, so use a real server.
+	srv := httptest.NewServer(proxyRouter)
+	t.Cleanup(srv.Close)
+
+	// the trace started by the client
+	traceID := trace.TraceID{0x0a, 0x0b}
+	clientSpanID := trace.SpanID{0x01}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL+"/api/v1/namespaces/default", nil)
+	assert.NilError(t, err)
+	req.Header.Set("traceparent", "00-"+traceID.String()+"-"+clientSpanID.String()+"-01")
+
+	resp, err := srv.Client().Do(req)
+	assert.NilError(t, err)
+	assert.NilError(t, resp.Body.Close())
+	assert.Equal(t, resp.StatusCode, http.StatusOK)
+
+	spans := exporter.GetSpans()
+	assert.Equal(t, len(spans), 3, spanNames(spans))
+
+	proxyServer := spanByName(t, spans, "HTTP GET /*path")
+	proxyClient := spanByName(t, spans, "HTTP GET")
+	upstreamServer := spanByName(t, spans, "HTTP GET /api/v1/namespaces/:name")
+
+	for _, span := range spans {
+		assert.Equal(t, span.SpanContext.TraceID(), traceID, span.Name)
+	}
+	assert.Equal(t, proxyServer.Parent.SpanID(), clientSpanID)
+	assert.Assert(t, proxyServer.Parent.IsRemote())
+	assert.Equal(t, proxyServer.SpanKind, trace.SpanKindServer)
+
+	assert.Equal(t, proxyClient.Parent.SpanID(), proxyServer.SpanContext.SpanID())
+	assert.Equal(t, proxyClient.SpanKind, trace.SpanKindClient)
+
+	assert.Equal(t, upstreamServer.Parent.SpanID(), proxyClient.SpanContext.SpanID())
+	assert.Equal(t, upstreamTraceparent,
+		"00-"+traceID.String()+"-"+proxyClient.SpanContext.SpanID().String()+"-01")
+}
+
+func TestMiddleware_NewTrace(t *testing.T) {
+	exporter := setupTestTracer(t)
+
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/api/users/:id", func(c *gin.Context) {
+		_, span := Start(c.Request.Context(), "child")
+		span.End()
+		c.Status(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/1234", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	assert.Equal(t, len(spans), 2, spanNames(spans))
+	server := spanByName(t, spans, "HTTP GET /api/users/:id")
+	child := spanByName(t, spans, "child")
+
+	assert.Assert(t, !server.Parent.IsValid())
+	assert.Equal(t, child.Parent.SpanID(), server.SpanContext.SpanID())
+	assert.Equal(t, server.Status.Description, "Internal Server Error")
+}
+
+func TestContextFromEnv(t *testing.T) {
+	t.Run("with traceparent", func(t *testing.T) {
+		t.Setenv("TRACEPARENT", "00-0a0b0000000000000000000000000000-0100000000000000-01")
+		t.Setenv("TRACESTATE", "vendor=value")
+
+		sc := trace.SpanContextFromContext(ContextFromEnv(context.Background()))
+		assert.Equal(t, sc.TraceID(), trace.TraceID{0x0a, 0x0b})
+		assert.Equal(t, sc.SpanID(), trace.SpanID{0x01})
+		assert.Assert(t, sc.IsSampled())
+		assert.Equal(t, sc.TraceState().Get("vendor"), "value")
+	})
+	t.Run("without traceparent", func(t *testing.T) {
+		t.Setenv("TRACEPARENT", "")
+		sc := trace.SpanContextFromContext(ContextFromEnv(context.Background()))
+		assert.Assert(t, !sc.IsValid())
+	})
+}
+
+func TestSetup_InvalidOptions(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := Setup(ctx, "test", Options{Endpoint: "http://localhost:4318", SampleRatio: 2})
+	assert.ErrorContains(t, err, "sample ratio must be between 0 and 1")
+
+	_, err = Setup(ctx, "test", Options{Endpoint: "localhost:4318", SampleRatio: 1})
+	assert.ErrorContains(t, err, "must be an http or https URL")
+
+	stop, err := Setup(ctx, "test", Options{})
+	assert.NilError(t, err)
+	assert.NilError(t, stop(ctx))
+}
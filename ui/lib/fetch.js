@@ -2,19 +2,38 @@ const fetch = global.fetch
 
 const base = '0.19.1'
 
-// Patch the global fetch to include our base API
-// version for requests to the same domain
-global.fetch = (resource, info) =>
-  fetch(resource, {
-    ...(resource.startsWith('/')
-      ? {
-          headers: {
-            'Infra-Version': base,
-          },
-        }
-      : {}),
+const safeMethods = ['GET', 'HEAD', 'OPTIONS']
+
+// csrfToken returns the CSRF token of the current session, or undefined when
+// there is no session. The token is fetched for every request that needs it,
+// because it changes when the user logs in again.
+async function csrfToken() {
+  const res = await fetch('/api/csrf-token', {
+    headers: { 'Infra-Version': base },
+  })
+  if (!res.ok) return undefined
+
+  const { token } = await res.json()
+  return token
+}
+
+// Patch the global fetch to include our base API version for requests to the
+// same domain, and the CSRF token for requests that change state
+global.fetch = async (resource, info = {}) => {
+  if (!resource.startsWith('/')) return fetch(resource, info)
+
+  const headers = { 'Infra-Version': base }
+  const method = (info.method || 'GET').toUpperCase()
+  if (!safeMethods.includes(method)) {
+    const token = await csrfToken()
+    if (token) headers['X-CSRF-Token'] = token
+  }
+
+  return fetch(resource, {
     ...info,
+    headers: { ...headers, ...info.headers },
   })
+}
 
 // jsonBody returns a js object or throws an error matching the {code: x, message: y} format, where x is a number and y is a string.
 global.jsonBody = async res => {
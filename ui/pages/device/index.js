@@ -7,15 +7,14 @@ export default function Device() {
   const router = useRouter()
   const [code, setCode] = useState(router.query.code)
   const [codeEntered, setCodeEntered] = useState(false)
+  const [denied, setDenied] = useState(false)
   const [error, setError] = useState('')
 
-  async function onSubmit(e) {
-    e.preventDefault()
-
+  async function submit(action) {
     if (code.length == 9) setCode(code.substring(0, 4) + code.substring(5, 9))
 
     try {
-      const res = await fetch('/api/device/approve', {
+      const res = await fetch(`/api/device/${action}`, {
         method: 'post',
         body: JSON.stringify({
           userCode: code,
@@ -24,14 +23,24 @@ export default function Device() {
 
       await jsonBody(res)
 
+      setDenied(action === 'deny')
       setCodeEntered(true)
     } catch (e) {
       setError(e.message)
     }
+  }
 
+  async function onSubmit(e) {
+    e.preventDefault()
+    await submit('approve')
     return false
   }
 
+  async function onDeny(e) {
+    e.preventDefault()
+    await submit('deny')
+  }
+
   async function setCodeSegment(segment, pos) {
     var codeCopy = code || ''
     for (; codeCopy.length < 8; ) {
@@ -99,7 +108,9 @@ export default function Device() {
         <h1 className='text-base font-bold leading-snug'>Confirm Log In</h1>
         {codeEntered ? (
           <p className='text-s my-3 flex max-w-[260px] flex-1 flex-col items-center justify-center text-center text-gray-600'>
-            You are logged in. You may now close this window.
+            {denied
+              ? 'The log in was denied. You may now close this window.'
+              : 'You are logged in. You may now close this window.'}
           </p>
         ) : (
           <>
@@ -145,6 +156,14 @@ export default function Device() {
               >
                 Confirm and Authorize New Device
               </button>
+              <button
+                type='button'
+                onClick={onDeny}
+                disabled={codeEntered}
+                className='mb-2 flex w-full cursor-pointer justify-center rounded-md border border-gray-300 bg-white py-2 px-4 font-medium text-gray-700 shadow-sm hover:bg-gray-50 focus:outline-none focus:ring-2 focus:ring-blue-500 focus:ring-offset-2 disabled:cursor-not-allowed disabled:opacity-30 sm:text-sm'
+              >
+                Deny
+              </button>
             </form>
           </>
         )}
@@ -61,6 +61,10 @@ export default function Login() {
       } else {
         if (e.code === 401 && e.message === 'unauthorized') {
           setError('Invalid credentials')
+        } else if (e.errorCode === 'account_locked') {
+          setError(
+            'Your account is locked after too many failed login attempts. Try again later, or ask an admin to unlock it.'
+          )
         } else {
           setError(e.message)
         }